@@ -33,6 +33,26 @@ export interface NestingRelation {
   order: number;
 }
 
+// Links a range of generated lines (1-based, inclusive) back to the diagram node that produced them
+export interface SourceMapping {
+  line: number;
+  endLine: number;
+  nodeId: string;
+  label: string;
+}
+
+// Source map for code generated from a diagram
+export interface DiagramSourceMap {
+  version: 1;
+  diagram: string;
+  mappings: SourceMapping[];
+}
+
+export interface GeneratedCode {
+  code: string;
+  sourceMap: DiagramSourceMap;
+}
+
 // Public options for code generation
 export type GenerateOptions = {
   // When true (default), append a base64-encoded diagram payload for reverse mapping
@@ -152,9 +172,18 @@ export class ChariotCodeGenerator {
   }
 
   public generateChariotCode(options?: GenerateOptions): string {
+    return this.generateWithSourceMap(options).code;
+  }
+
+  // Generate code together with a source map of top-level diagram nodes to generated lines.
+  // Nested nodes are folded into the line range of the parent that emits them.
+  public generateWithSourceMap(options?: GenerateOptions): GeneratedCode {
     const lines: string[] = [];
+    const mappings: SourceMapping[] = [];
     lines.push(`// ${this.diagram.name}`);
     lines.push('');
+    // Entries in `lines` may span several lines, so track the emitted line count separately
+    let emittedLines = lines.length;
     const inlineProcessedNodes = new Set<string>();
     for (const [parentId, childIds] of this.nestingMap) {
       const parentNode = this.nodeMap.get(parentId);
@@ -188,9 +217,18 @@ export class ChariotCodeGenerator {
       if (!node) continue;
       const chariotCode = this.generateNodeCode(node);
       if (chariotCode) {
+        const line = emittedLines + 1;
         lines.push(chariotCode);
+        emittedLines += chariotCode.split('\n').length;
+        mappings.push({
+          line,
+          endLine: emittedLines,
+          nodeId: node.id,
+          label: this.getNodeLabel(node),
+        });
       }
     }
+    const sourceMap: DiagramSourceMap = { version: 1, diagram: this.diagram.name, mappings };
     // Append embedded diagram payload for reverse mapping (code -> diagram)
   const shouldEmbed = options?.embedSource !== false;
     if (shouldEmbed) {
@@ -199,11 +237,12 @@ export class ChariotCodeGenerator {
         const encoded = encodeBase64(payload);
         lines.push('');
         lines.push(`// __VDSL_SOURCE__: base64:${encoded}`);
+        lines.push(`// __VDSL_MAP__: base64:${encodeBase64(JSON.stringify(sourceMap))}`);
       } catch (e) {
         // If embedding fails, skip silently to avoid breaking codegen
       }
     }
-    return lines.join('\n');
+    return { code: lines.join('\n'), sourceMap };
   }
 
   private calculateExecutionOrder(): void {
@@ -520,6 +559,8 @@ export class ChariotCodeGenerator {
         return this.generateValueOfCode(node);
       case 'Function':
         return this.generateFunctionCode(node);
+      case 'Sub Diagram':
+        return this.generateSubDiagramCode(node);
       case 'If':
         return this.generateIfCode(node);
       case 'While':
@@ -1083,6 +1124,18 @@ export class ChariotCodeGenerator {
     return `logPrint(${args.join(', ')})`;
   }
 
+  // The function for the referenced diagram is compiled by the server
+  // (POST /api/diagrams/:name/run), which defines flow_<name> ahead of the main flow.
+  private generateSubDiagramCode(node: VisualDSLNode): string {
+    const props = node.data.properties || {};
+    const diagram = (props.diagram ?? '').toString().trim();
+    const fn = 'flow_' + diagram.replace(/[^a-zA-Z0-9_]+/g, '_').replace(/^_+|_+$/g, '');
+    const args = this.normalizeExpressionList((props as { arguments?: unknown }).arguments);
+    const call = `call(${[fn, ...args].join(', ')})`;
+    const result = (props.resultVariable ?? '').toString().trim();
+    return result ? `setq(${result}, ${call})` : call;
+  }
+
   private generateSleepCode(node: VisualDSLNode): string {
     const props = node.data.properties || {};
     const milliseconds = props.milliseconds || '1000';
@@ -3166,6 +3219,16 @@ export function generateChariotCodeFromDiagram(diagramJson: string, options?: Ge
   }
 }
 
+export function generateChariotCodeWithSourceMap(diagramJson: string, options?: GenerateOptions): GeneratedCode {
+  try {
+    const diagram: VisualDSLDiagram = JSON.parse(diagramJson);
+    const generator = new ChariotCodeGenerator(diagram);
+    return generator.generateWithSourceMap(options);
+  } catch (error) {
+    throw new Error(`Failed to generate Chariot code: ${error instanceof Error ? error.message : 'Unknown error'}`);
+  }
+}
+
 // Helper functions for base64 encoding/decoding that work in both browser and Node
 function encodeBase64(input: string): string {
   try {
@@ -1,2 +1,2 @@
 export * from './chariotCodeGenerator';
-export type { GenerateOptions } from './chariotCodeGenerator';
+export type { GenerateOptions, DiagramSourceMap, SourceMapping, GeneratedCode } from './chariotCodeGenerator';
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Editor assets vendored by vendor-assets.sh. Only the README is checked in,
+// so a plain checkout builds and serves Monaco from the CDN.
+//
+//go:embed assets
+var embeddedAssets embed.FS
+
+const monacoCDN = "https://cdn.jsdelivr.net/npm/monaco-editor@0.45.0/min/vs"
+
+var assetsMode = flag.String("assets", "", "Editor asset source: auto, embedded or cdn (default auto)")
+
+// assetManifest is assets/manifest.json as written by vendor-assets.sh.
+type assetManifest struct {
+	Monaco string            `json:"monaco"`
+	Files  map[string]string `json:"files"` // path under assets/ -> hex SHA-256
+}
+
+// editorAssets says where the editor page loads Monaco from. It is settled
+// once at startup by initEditorAssets.
+var editorAssets = struct {
+	Offline         bool   // serve the embedded bundle
+	MonacoBase      string // AMD path for "vs"
+	LoaderIntegrity string // SRI hash of loader.js when served locally
+}{MonacoBase: monacoCDN}
+
+// getAssetsMode returns the asset mode from flag, environment variable, or default
+func getAssetsMode() string {
+	if *assetsMode != "" {
+		return *assetsMode
+	}
+	if env := os.Getenv("CHARIOT_EDITOR_ASSETS"); env != "" {
+		return env
+	}
+	return "auto"
+}
+
+// initEditorAssets verifies the embedded bundle against its manifest and picks
+// the asset source. In embedded mode a missing or tampered bundle is fatal; in
+// auto mode it falls back to the CDN.
+func initEditorAssets() {
+	mode := strings.ToLower(getAssetsMode())
+	switch mode {
+	case "cdn":
+		log.Printf("Editor assets: loading Monaco from %s", monacoCDN)
+		return
+	case "auto", "embedded":
+	default:
+		log.Fatalf("invalid assets mode %q (want auto, embedded or cdn)", mode)
+	}
+
+	manifest, err := verifyEmbeddedAssets()
+	if err != nil {
+		if mode == "embedded" {
+			log.Fatalf("Editor assets: %v", err)
+		}
+		log.Printf("Editor assets: offline bundle unavailable (%v); loading Monaco from %s", err, monacoCDN)
+		return
+	}
+	loader, _ := fs.ReadFile(embeddedAssets, "assets/monaco/vs/loader.js")
+	sum := sha256.Sum256(loader)
+	editorAssets.Offline = true
+	editorAssets.MonacoBase = "assets/monaco/vs"
+	editorAssets.LoaderIntegrity = "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+	log.Printf("Editor assets: serving embedded Monaco %s (%d files verified)", manifest.Monaco, len(manifest.Files))
+}
+
+// verifyEmbeddedAssets checks every file listed in the manifest against its
+// SHA-256, and that the files the editor needs are listed.
+func verifyEmbeddedAssets() (*assetManifest, error) {
+	data, err := fs.ReadFile(embeddedAssets, "assets/manifest.json")
+	if err != nil {
+		return nil, fmt.Errorf("no manifest.json; run make assets")
+	}
+	var manifest assetManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("manifest.json: %w", err)
+	}
+	for _, required := range []string{"monaco/vs/loader.js", "monaco/vs/editor/editor.main.js", "chariot-codegen.js"} {
+		if _, ok := manifest.Files[required]; !ok {
+			return nil, fmt.Errorf("manifest.json does not list %s", required)
+		}
+	}
+	for name, want := range manifest.Files {
+		content, err := fs.ReadFile(embeddedAssets, "assets/"+name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		sum := sha256.Sum256(content)
+		if hex.EncodeToString(sum[:]) != strings.ToLower(want) {
+			return nil, fmt.Errorf("%s does not match its manifest hash", name)
+		}
+	}
+	return &manifest, nil
+}
+
+// assetsHandler serves the embedded bundle under /assets/ and /charioteer/assets/.
+// Vendored files never change within a build, so they are cached for a day.
+func assetsHandler() http.Handler {
+	sub, _ := fs.Sub(embeddedAssets, "assets")
+	files := http.FileServer(http.FS(sub))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !editorAssets.Offline {
+			http.NotFound(w, r)
+			return
+		}
+		name := r.URL.Path
+		if i := strings.Index(name, "/assets/"); i >= 0 {
+			name = name[i+len("/assets/"):]
+		}
+		if name == "" || strings.HasSuffix(name, "/") || name == "manifest.json" || name == "README.md" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/" + name
+		files.ServeHTTP(w, r2)
+	})
+}
+
+// embeddedCodegenJS returns the embedded chariot-codegen bundle when the
+// offline bundle is in use.
+func embeddedCodegenJS() ([]byte, bool) {
+	if !editorAssets.Offline {
+		return nil, false
+	}
+	data, err := fs.ReadFile(embeddedAssets, "assets/chariot-codegen.js")
+	return data, err == nil
+}
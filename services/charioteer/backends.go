@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var healthIntervalSeconds = flag.Int("health-interval", 0, "Seconds between backend health checks (default 10)")
+
+// backend is one go-chariot server charioteer can proxy to.
+type backend struct {
+	URL       string    `json:"url"`
+	Healthy   bool      `json:"healthy"`
+	LastCheck time.Time `json:"last_check"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// backendPool tracks the configured backends and their health. Requests go to
+// the first healthy backend in configured order, so one backend serves while
+// it is up and the next takes over when it is not.
+type backendPool struct {
+	mu       sync.RWMutex
+	specs    []string
+	backends []*backend
+}
+
+var backends = &backendPool{}
+
+// getBackendSpec returns the backend list from flag, environment variable, or
+// default: comma-separated URLs and DNS SRV names written as
+// srv+https://_chariot._tcp.example.com (or srv+http://). With -environments,
+// the backends of the default environment.
+func getBackendSpec() string {
+	if defaultEnvironment != nil {
+		return defaultEnvironment.Backend
+	}
+	if *backendURL != "" {
+		return *backendURL
+	}
+	if env := os.Getenv("CHARIOT_BACKEND_URL"); env != "" {
+		return env
+	}
+	return "https://localhost:8087"
+}
+
+// getHealthInterval returns the health check interval from flag, environment variable, or default
+func getHealthInterval() time.Duration {
+	if *healthIntervalSeconds > 0 {
+		return time.Duration(*healthIntervalSeconds) * time.Second
+	}
+	if env := os.Getenv("CHARIOT_HEALTH_INTERVAL"); env != "" {
+		if seconds, err := strconv.Atoi(env); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return 10 * time.Second
+}
+
+// getBackendURL returns the backend requests should go to: the first healthy
+// one, or the first configured when none is healthy so errors still surface.
+func getBackendURL() string {
+	candidates := backends.candidates()
+	if len(candidates) == 0 {
+		return strings.TrimRight(strings.Split(getBackendSpec(), ",")[0], "/")
+	}
+	return candidates[0]
+}
+
+// initBackends loads the environments, then resolves each backend list,
+// checks it once and keeps checking it in the background.
+func initBackends() {
+	loadEnvironments()
+	backends.start(getBackendSpec())
+	for _, env := range environments {
+		if env.pool != backends {
+			log.Printf("Environment %s:", env.Name)
+			env.pool.start(env.Backend)
+		}
+	}
+}
+
+// start resolves and checks the backends of spec, and keeps checking them.
+func (p *backendPool) start(spec string) {
+	for _, s := range strings.Split(spec, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			p.specs = append(p.specs, s)
+		}
+	}
+	p.refresh()
+	for _, b := range p.snapshot() {
+		state := "healthy"
+		if !b.Healthy {
+			state = "unhealthy: " + b.LastError
+		}
+		log.Printf("Backend %s (%s)", b.URL, state)
+	}
+	go func() {
+		ticker := time.NewTicker(getHealthInterval())
+		defer ticker.Stop()
+		for range ticker.C {
+			p.refresh()
+		}
+	}()
+}
+
+// resolve expands SRV names into URLs, in the order the resolver returns
+// them (priority, then weight).
+func (p *backendPool) resolve() []string {
+	var urls []string
+	for _, spec := range p.specs {
+		if !strings.HasPrefix(spec, "srv+") {
+			urls = append(urls, strings.TrimRight(spec, "/"))
+			continue
+		}
+		scheme, name, ok := strings.Cut(strings.TrimPrefix(spec, "srv+"), "://")
+		if !ok {
+			log.Printf("Invalid backend SRV name %q (want srv+https://_service._tcp.domain)", spec)
+			continue
+		}
+		_, records, err := net.LookupSRV("", "", name)
+		if err != nil {
+			log.Printf("Backend SRV lookup %s failed: %v", name, err)
+			continue
+		}
+		for _, rec := range records {
+			host := strings.TrimSuffix(rec.Target, ".")
+			urls = append(urls, fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(int(rec.Port)))))
+		}
+	}
+	return urls
+}
+
+// refresh re-resolves the backend list and health-checks every backend.
+func (p *backendPool) refresh() {
+	urls := p.resolve()
+	p.mu.RLock()
+	known := map[string]*backend{}
+	for _, b := range p.backends {
+		known[b.URL] = b
+	}
+	p.mu.RUnlock()
+
+	next := make([]*backend, 0, len(urls))
+	var wg sync.WaitGroup
+	for _, u := range urls {
+		if containsBackend(next, u) {
+			continue
+		}
+		b := &backend{URL: u}
+		next = append(next, b)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := checkBackend(b.URL)
+			b.LastCheck = time.Now()
+			b.Healthy = err == nil
+			if err != nil {
+				b.LastError = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	for _, b := range next {
+		if old, ok := known[b.URL]; ok && old.Healthy != b.Healthy {
+			log.Printf("Backend %s is now %s", b.URL, healthWord(b.Healthy))
+		}
+	}
+	if len(next) > 0 {
+		p.backends = next
+	}
+	p.mu.Unlock()
+}
+
+func containsBackend(list []*backend, url string) bool {
+	for _, b := range list {
+		if b.URL == url {
+			return true
+		}
+	}
+	return false
+}
+
+func healthWord(healthy bool) string {
+	if healthy {
+		return "healthy"
+	}
+	return "unhealthy"
+}
+
+// checkBackend calls the backend's /health endpoint.
+func checkBackend(base string) error {
+	client := &http.Client{
+		Timeout: 3 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: *insecureSkipVerify},
+		},
+	}
+	resp, err := client.Get(base + "/health")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// markDown takes a backend out of rotation after a failed request, until the
+// next health check finds it up again.
+func (p *backendPool) markDown(url string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, b := range p.backends {
+		if b.URL == url && b.Healthy {
+			b.Healthy = false
+			b.LastError = err.Error()
+			log.Printf("Backend %s is now unhealthy: %v", url, err)
+		}
+	}
+}
+
+// candidates lists backend URLs to try: healthy ones first, then the rest.
+func (p *backendPool) candidates() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var healthy, down []string
+	for _, b := range p.backends {
+		if b.Healthy {
+			healthy = append(healthy, b.URL)
+		} else {
+			down = append(down, b.URL)
+		}
+	}
+	return append(healthy, down...)
+}
+
+func (p *backendPool) snapshot() []backend {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	out := make([]backend, len(p.backends))
+	for i, b := range p.backends {
+		out[i] = *b
+	}
+	return out
+}
+
+func (p *backendPool) healthyCount() int {
+	n := 0
+	for _, b := range p.snapshot() {
+		if b.Healthy {
+			n++
+		}
+	}
+	return n
+}
+
+// doBackend sends a request to the current backend of the environment r works
+// against. A backend that cannot be reached is marked down. Idempotent
+// requests (see idempotentRequest) that cannot connect or get a 502, 503 or
+// 504 are retried after a jittered backoff, on the next healthy backend when
+// there is one, up to -retries times and while the retry budget of r's route
+// group lasts; the response to r reports the retries in X-Retry-Count. Other
+// requests return the first error. While the group's circuit breaker is open,
+// requests fail at once with a *degradedError. Compressed responses are
+// decoded before they are returned.
+func doBackend(r *http.Request, client *http.Client, method, path string, body []byte, prepare func(*http.Request)) (*http.Response, error) {
+	env := environmentFor(r)
+	pool := env.backendPool()
+	group := retryRouteFor(strings.TrimPrefix(r.URL.Path, "/charioteer")).Name
+	breaker := breakerFor(r, group)
+	if err := breaker.allow(); err != nil {
+		return nil, err
+	}
+	budget := retryBudgets[group]
+	maxRetries := getRetries()
+	for retries := 0; ; retries++ {
+		base := env.backendURL()
+		if candidates := pool.candidates(); len(candidates) > 0 {
+			base = candidates[0]
+		}
+		req, err := http.NewRequest(method, base+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+		if prepare != nil {
+			prepare(req)
+		}
+		started := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			pool.markDown(base, err)
+			noteBackendCall(r.Context(), method, base+path, 0, err, started)
+		} else {
+			noteBackendCall(r.Context(), method, base+path, resp.StatusCode, nil, started)
+		}
+		failed := err != nil || retryableStatus(resp.StatusCode)
+		if !failed || retries >= maxRetries || !idempotentRequest(req) || !budget.take() {
+			if retries > 0 {
+				reportRetries(r, retries)
+			}
+			if err != nil {
+				breaker.record(true, err.Error())
+				return nil, err
+			}
+			breaker.record(failed, resp.Status)
+			if err := decodeBackendBody(resp); err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if !sleepRetry(r, retries+1) {
+			breaker.abandon()
+			return nil, r.Context().Err()
+		}
+		log.Printf("Retrying %s %s (retry %d of %d)", method, path, retries+1, maxRetries)
+	}
+}
+
+// backendsHandler reports the backends of the request's environment and
+// their health.
+func backendsHandler(w http.ResponseWriter, r *http.Request) {
+	sendSuccess(w, environmentFor(r).backendPool().snapshot())
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Each route group of retryRoutes has a circuit breaker per environment.
+// After -breaker-failures backend requests of the group fail in a row, the
+// breaker opens and the group's requests fail at once with a "backend
+// degraded" error instead of piling onto a backend that is down. Once the
+// cooldown has passed, one request is let through as a probe: if it
+// succeeds the breaker closes, otherwise it opens again for twice as long,
+// up to maxBreakerCooldown.
+
+var (
+	breakerFailuresFlag = flag.Int("breaker-failures", -1, "Consecutive backend failures that open a route group's circuit breaker (default 5, 0 disables)")
+	breakerCooldownFlag = flag.Duration("breaker-cooldown", 0, "Time an open circuit breaker waits before probing the backend, doubled after each failed probe (default 10s)")
+)
+
+// maxBreakerCooldown caps the wait between probes of an open breaker.
+const maxBreakerCooldown = 5 * time.Minute
+
+// Breaker states.
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// getBreakerFailures returns the failure threshold from flag, environment variable, or default
+func getBreakerFailures() int {
+	if *breakerFailuresFlag >= 0 {
+		return *breakerFailuresFlag
+	}
+	if env := os.Getenv("CHARIOT_BREAKER_FAILURES"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return 5
+}
+
+// getBreakerCooldown returns the first probe delay from flag, environment variable, or default
+func getBreakerCooldown() time.Duration {
+	if *breakerCooldownFlag > 0 {
+		return *breakerCooldownFlag
+	}
+	if env := os.Getenv("CHARIOT_BREAKER_COOLDOWN"); env != "" {
+		if d, err := time.ParseDuration(env); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 10 * time.Second
+}
+
+// circuitBreaker guards the backend requests of one route group of one
+// environment.
+type circuitBreaker struct {
+	mu          sync.Mutex
+	environment string
+	group       string
+	state       string
+	failures    int // consecutive failed requests
+	cooldown    time.Duration
+	nextProbe   time.Time
+	lastError   string
+}
+
+// breakerInfo is the state of a breaker as /healthz reports it.
+type breakerInfo struct {
+	Environment string     `json:"environment,omitempty"`
+	Group       string     `json:"group"`
+	State       string     `json:"state"`
+	Failures    int        `json:"failures"`
+	NextProbe   *time.Time `json:"next_probe,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// degradedError is returned for requests an open breaker refuses.
+type degradedError struct {
+	group      string
+	failures   int
+	retryAfter time.Duration
+}
+
+func (e *degradedError) Error() string {
+	return fmt.Sprintf("backend degraded: %s requests failed %d times in a row; retry in %s",
+		e.group, e.failures, e.retryAfter.Round(time.Second))
+}
+
+var breakers = struct {
+	mu    sync.Mutex
+	byKey map[string]*circuitBreaker
+}{byKey: map[string]*circuitBreaker{}}
+
+// breakerFor returns the breaker of a route group in the environment r
+// works against, or nil when breakers are disabled.
+func breakerFor(r *http.Request, group string) *circuitBreaker {
+	if getBreakerFailures() == 0 {
+		return nil
+	}
+	envName := ""
+	if env := environmentFor(r); env != nil {
+		envName = env.Name
+	}
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+	key := envName + "\x00" + group
+	b := breakers.byKey[key]
+	if b == nil {
+		b = &circuitBreaker{environment: envName, group: group, state: breakerClosed}
+		breakers.byKey[key] = b
+	}
+	return b
+}
+
+// allow reports whether a request may go to the backend. An open breaker
+// whose cooldown has passed lets the request through as its probe and
+// refuses the others until the probe's outcome is recorded.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if wait := time.Until(b.nextProbe); wait > 0 {
+			return &degradedError{group: b.group, failures: b.failures, retryAfter: wait}
+		}
+		b.state = breakerHalfOpen
+		return nil
+	case breakerHalfOpen:
+		return &degradedError{group: b.group, failures: b.failures, retryAfter: b.cooldown}
+	}
+	return nil
+}
+
+// record counts the outcome of an allowed request, opening or closing the
+// breaker.
+func (b *circuitBreaker) record(failed bool, reason string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		if b.state != breakerClosed {
+			log.Printf("Circuit breaker %s closed: backend recovered", b.name())
+		}
+		b.state, b.failures, b.cooldown, b.lastError = breakerClosed, 0, 0, ""
+		return
+	}
+	b.failures++
+	b.lastError = reason
+	switch {
+	case b.state == breakerHalfOpen:
+		b.cooldown *= 2
+		if b.cooldown > maxBreakerCooldown {
+			b.cooldown = maxBreakerCooldown
+		}
+	case b.state == breakerClosed && b.failures >= getBreakerFailures():
+		b.cooldown = getBreakerCooldown()
+	default:
+		return
+	}
+	b.state = breakerOpen
+	b.nextProbe = time.Now().Add(b.cooldown)
+	log.Printf("Circuit breaker %s open after %d failures (%s); probing in %s", b.name(), b.failures, reason, b.cooldown)
+}
+
+// abandon hands back the probe of a request that ended without an outcome,
+// such as one whose client went away, so the next request probes instead.
+func (b *circuitBreaker) abandon() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+	}
+}
+
+func (b *circuitBreaker) name() string {
+	if b.environment != "" {
+		return b.environment + "/" + b.group
+	}
+	return b.group
+}
+
+// breakerSnapshot lists the breakers of the route groups that have had
+// backend traffic.
+func breakerSnapshot() []breakerInfo {
+	breakers.mu.Lock()
+	list := make([]*circuitBreaker, 0, len(breakers.byKey))
+	for _, b := range breakers.byKey {
+		list = append(list, b)
+	}
+	breakers.mu.Unlock()
+	out := make([]breakerInfo, 0, len(list))
+	for _, b := range list {
+		b.mu.Lock()
+		info := breakerInfo{Environment: b.environment, Group: b.group, State: b.state, Failures: b.failures, LastError: b.lastError}
+		if b.state != breakerClosed {
+			next := b.nextProbe
+			info.NextProbe = &next
+		}
+		b.mu.Unlock()
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Environment != out[j].Environment {
+			return out[i].Environment < out[j].Environment
+		}
+		return out[i].Group < out[j].Group
+	})
+	return out
+}
+
+// sendBackendError reports a failed backend request: a request refused by
+// an open breaker gets a 503 with Retry-After and the degraded message,
+// other errors the given status and message followed by the error.
+func sendBackendError(w http.ResponseWriter, status int, message string, err error) {
+	var degraded *degradedError
+	if errors.As(err, &degraded) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(degraded.retryAfter.Seconds()))))
+		sendError(w, http.StatusServiceUnavailable, degraded.Error())
+		return
+	}
+	sendError(w, status, message+err.Error())
+}
@@ -0,0 +1,33 @@
+#!/bin/bash
+# Build the Chariot parser and diagram code generator for the browser and
+# place them in assets/wasm/, where they are embedded in the charioteer binary.
+# The editor uses them for syntax checking and codegen preview.
+#
+# Usage: ./build-wasm.sh
+#   GO  Go toolchain to build with (default go); wasm_exec.js is copied from
+#       the same release so the glue matches the binary.
+
+set -euo pipefail
+
+cd "$(dirname "$0")"
+GO="${GO:-go}"
+OUT_DIR="$(pwd)/assets/wasm"
+GOROOT_DIR="$("$GO" env GOROOT)"
+
+mkdir -p "$OUT_DIR"
+echo "Building chariot.wasm..."
+(cd ../go-chariot && GOOS=js GOARCH=wasm CGO_ENABLED=0 "$GO" build -trimpath -ldflags="-s -w" -o "$OUT_DIR/chariot.wasm" ./cmd/chariot-wasm)
+
+# Go 1.24 moved wasm_exec.js from misc/wasm to lib/wasm
+for glue in "$GOROOT_DIR/lib/wasm/wasm_exec.js" "$GOROOT_DIR/misc/wasm/wasm_exec.js"; do
+    if [ -f "$glue" ]; then
+        cp "$glue" "$OUT_DIR/wasm_exec.js"
+        break
+    fi
+done
+if [ ! -f "$OUT_DIR/wasm_exec.js" ]; then
+    echo "wasm_exec.js not found under $GOROOT_DIR" >&2
+    exit 1
+fi
+
+echo "Built $(du -k "$OUT_DIR/chariot.wasm" | cut -f1) KB chariot.wasm."
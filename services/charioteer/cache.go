@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheRoute is a group of read-only list endpoints whose responses
+// charioteer keeps for a short time. Paths are given without the /charioteer
+// prefix.
+type cacheRoute struct {
+	Name    string
+	TTL     time.Duration // default, overridden by -cache
+	Paths   []string      // GET requests to these exact paths are cached
+	Writes  []string      // non-GET requests under these prefixes invalidate the group
+	Actions []string      // any request under these prefixes invalidates the group
+}
+
+// cacheRegistry lists the cached route groups. Workspace-wide operations
+// (library load) invalidate every group.
+var cacheRegistry = []cacheRoute{
+	{Name: "files", TTL: 5 * time.Second,
+		Paths:   []string{"/api/files"},
+		Writes:  []string{"/api/files", "/api/library/save"},
+		Actions: []string{"/api/library/load"}},
+	{Name: "functions", TTL: 10 * time.Second,
+		Paths:   []string{"/api/functions"},
+		Writes:  []string{"/api/function/save"},
+		Actions: []string{"/api/function/delete", "/api/library/load"}},
+	{Name: "diagrams", TTL: 5 * time.Second,
+		Paths:   []string{"/api/diagrams"},
+		Writes:  []string{"/api/diagrams"},
+		Actions: []string{"/api/library/load"}},
+	{Name: "builtins", TTL: 5 * time.Minute,
+		Paths: []string{"/api/builtins"}},
+}
+
+// maxCacheEntries bounds each group; a full group is emptied rather than
+// tracking recency.
+const maxCacheEntries = 1024
+
+var cacheFlag = flag.String("cache", "", "Response cache TTLs per route group, e.g. files=5s,functions=10s,diagrams=0, or off")
+
+type cacheEntry struct {
+	token       string
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+type cacheGroup struct {
+	route      cacheRoute
+	ttl        time.Duration
+	generation uint64 // bumped on every invalidation
+	entries    map[string]*cacheEntry
+}
+
+type responseCacheStore struct {
+	mu     sync.Mutex
+	groups map[string]*cacheGroup
+}
+
+var responseCache = &responseCacheStore{groups: map[string]*cacheGroup{}}
+
+// loadCacheConfig resolves the group TTLs from -cache, then CHARIOT_CACHE,
+// then the registry defaults. "off" disables caching; a TTL of 0 disables
+// one group.
+func loadCacheConfig() {
+	ttls := map[string]time.Duration{}
+	for _, r := range cacheRegistry {
+		ttls[r.Name] = r.TTL
+	}
+	spec := *cacheFlag
+	if spec == "" {
+		spec = os.Getenv("CHARIOT_CACHE")
+	}
+	if strings.EqualFold(strings.TrimSpace(spec), "off") {
+		log.Println("Response cache disabled")
+		return
+	}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if _, ok := ttls[name]; !ok {
+			log.Fatalf("unknown cache route group %q", name)
+		}
+		value = strings.TrimSpace(value)
+		if value == "0" {
+			ttls[name] = 0
+			continue
+		}
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl < 0 {
+			log.Fatalf("invalid cache TTL for %s: %q", name, value)
+		}
+		ttls[name] = ttl
+	}
+	for _, r := range cacheRegistry {
+		if ttls[r.Name] > 0 {
+			responseCache.groups[r.Name] = &cacheGroup{route: r, ttl: ttls[r.Name], entries: map[string]*cacheEntry{}}
+			log.Printf("Caching %s responses for %s", r.Name, ttls[r.Name])
+		}
+	}
+}
+
+func matchesPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// requestToken returns the credentials a request carries, the same way
+// authMiddleware and backendRequest look for them.
+func requestToken(r *http.Request) string {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		if c, err := r.Cookie(environmentFor(r).tokenKey()); err == nil {
+			token = c.Value
+		}
+	}
+	return token
+}
+
+// invalidatedBy returns the groups a request invalidates.
+func (s *responseCacheStore) invalidatedBy(r *http.Request, path string) []*cacheGroup {
+	var out []*cacheGroup
+	for _, g := range s.groups {
+		if matchesPrefix(path, g.route.Actions) || (r.Method != http.MethodGet && r.Method != http.MethodHead && matchesPrefix(path, g.route.Writes)) {
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// cachedGroup returns the group caching a GET request, if any.
+func (s *responseCacheStore) cachedGroup(r *http.Request, path string) *cacheGroup {
+	if r.Method != http.MethodGet {
+		return nil
+	}
+	for _, g := range s.groups {
+		for _, p := range g.route.Paths {
+			if path == p {
+				return g
+			}
+		}
+	}
+	return nil
+}
+
+func (s *responseCacheStore) invalidate(groups []*cacheGroup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, g := range groups {
+		g.generation++
+		g.entries = map[string]*cacheEntry{}
+	}
+}
+
+// forget drops every entry cached for a token, so a logged out session is
+// not served from the cache.
+func (s *responseCacheStore) forget(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, g := range s.groups {
+		for key, e := range g.entries {
+			if e.token == token {
+				delete(g.entries, key)
+			}
+		}
+	}
+}
+
+func (s *responseCacheStore) lookup(g *cacheGroup, key string) (*cacheEntry, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := g.entries[key]
+	if e != nil && time.Now().After(e.expires) {
+		delete(g.entries, key)
+		e = nil
+	}
+	return e, g.generation
+}
+
+// store keeps a response unless the group was invalidated while it was
+// being fetched.
+func (s *responseCacheStore) store(g *cacheGroup, key string, generation uint64, e *cacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if g.generation != generation {
+		return
+	}
+	if len(g.entries) >= maxCacheEntries {
+		g.entries = map[string]*cacheEntry{}
+	}
+	e.expires = time.Now().Add(g.ttl)
+	g.entries[key] = e
+}
+
+// cacheRecorder passes a response through while keeping a copy of it.
+type cacheRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *cacheRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *cacheRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(p)
+	return rec.ResponseWriter.Write(p)
+}
+
+// cacheResponses serves cached list responses and drops them when a
+// request changes what they list. Responses are cached per token, so users
+// never see each other's lists, and only successful ones are kept.
+func cacheResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(responseCache.groups) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		path := strings.TrimPrefix(r.URL.Path, "/charioteer")
+		if path == "/logout" {
+			if token := requestToken(r); token != "" {
+				responseCache.forget(token)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if groups := responseCache.invalidatedBy(r, path); len(groups) > 0 {
+			// Invalidate again afterwards so a list fetched while the
+			// change was in flight is not kept
+			responseCache.invalidate(groups)
+			next.ServeHTTP(w, r)
+			responseCache.invalidate(groups)
+			return
+		}
+		g := responseCache.cachedGroup(r, path)
+		token := requestToken(r)
+		if g == nil || token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := token + "\x00" + path + "?" + r.URL.RawQuery
+		if env := environmentFor(r); env != nil {
+			key = env.Name + "\x00" + key
+		}
+		e, generation := responseCache.lookup(g, key)
+		if e != nil {
+			if e.contentType != "" {
+				w.Header().Set("Content-Type", e.contentType)
+			}
+			w.Header().Set("X-Cache", "HIT")
+			w.WriteHeader(http.StatusOK)
+			w.Write(e.body)
+			return
+		}
+		w.Header().Set("X-Cache", "MISS")
+		rec := &cacheRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == http.StatusOK {
+			responseCache.store(g, key, generation, &cacheEntry{
+				token:       token,
+				contentType: w.Header().Get("Content-Type"),
+				body:        rec.body.Bytes(),
+			})
+		}
+	})
+}
@@ -0,0 +1,689 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/gorilla/websocket"
+)
+
+// ---- Collaborative editing ----
+// Each open file or diagram gets a document channel at /charioteer/ws/collab?doc=<kind>:<scope>/<name>.
+// Text edits are operational transforms in the ot.js wire format (retain n > 0, delete n < 0,
+// insert "text"), with lengths in UTF-16 code units to match Monaco offsets. The server keeps the
+// authoritative text, transforms late operations against the ones applied since their base version,
+// and fans them out. Presence (who is connected, cursor ranges) and save notifications share the channel.
+
+const collabHistoryLimit = 1000
+
+var collabColors = []string{"#e91e63", "#3f51b5", "#009688", "#ff9800", "#9c27b0", "#795548", "#607d8b", "#4caf50"}
+
+type otComponent struct {
+	retain int      // characters kept
+	delete int      // characters removed
+	insert []uint16 // characters added
+}
+
+// textOp is a sequence of retain/delete/insert components covering the whole document.
+type textOp []otComponent
+
+func parseTextOp(raw []json.RawMessage) (textOp, error) {
+	var op textOp
+	for _, part := range raw {
+		var n int
+		if err := json.Unmarshal(part, &n); err == nil {
+			switch {
+			case n > 0:
+				op = op.retainN(n)
+			case n < 0:
+				op = op.deleteN(-n)
+			}
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(part, &s); err != nil {
+			return nil, fmt.Errorf("invalid operation component %s", string(part))
+		}
+		op = op.insertS(utf16.Encode([]rune(s)))
+	}
+	return op, nil
+}
+
+func (op textOp) MarshalJSON() ([]byte, error) {
+	out := make([]interface{}, 0, len(op))
+	for _, c := range op {
+		switch {
+		case c.retain > 0:
+			out = append(out, c.retain)
+		case c.delete > 0:
+			out = append(out, -c.delete)
+		default:
+			out = append(out, string(utf16.Decode(c.insert)))
+		}
+	}
+	return json.Marshal(out)
+}
+
+func (op textOp) retainN(n int) textOp {
+	if n <= 0 {
+		return op
+	}
+	if last := len(op) - 1; last >= 0 && op[last].retain > 0 {
+		op[last].retain += n
+		return op
+	}
+	return append(op, otComponent{retain: n})
+}
+
+func (op textOp) deleteN(n int) textOp {
+	if n <= 0 {
+		return op
+	}
+	if last := len(op) - 1; last >= 0 && op[last].delete > 0 {
+		op[last].delete += n
+		return op
+	}
+	return append(op, otComponent{delete: n})
+}
+
+// insertS keeps inserts ahead of an adjacent delete so equivalent operations compare equal.
+func (op textOp) insertS(s []uint16) textOp {
+	if len(s) == 0 {
+		return op
+	}
+	last := len(op) - 1
+	if last >= 0 && len(op[last].insert) > 0 {
+		op[last].insert = append(append([]uint16{}, op[last].insert...), s...)
+		return op
+	}
+	if last >= 0 && op[last].delete > 0 {
+		if last > 0 && len(op[last-1].insert) > 0 {
+			op[last-1].insert = append(append([]uint16{}, op[last-1].insert...), s...)
+			return op
+		}
+		op = append(op, op[last])
+		op[last] = otComponent{insert: s}
+		return op
+	}
+	return append(op, otComponent{insert: s})
+}
+
+// baseLen is the document length the operation applies to.
+func (op textOp) baseLen() int {
+	n := 0
+	for _, c := range op {
+		n += c.retain + c.delete
+	}
+	return n
+}
+
+func (op textOp) apply(doc []uint16) ([]uint16, error) {
+	if op.baseLen() != len(doc) {
+		return nil, fmt.Errorf("operation expects a document of length %d, got %d", op.baseLen(), len(doc))
+	}
+	out := make([]uint16, 0, len(doc))
+	pos := 0
+	for _, c := range op {
+		switch {
+		case c.retain > 0:
+			out = append(out, doc[pos:pos+c.retain]...)
+			pos += c.retain
+		case c.delete > 0:
+			pos += c.delete
+		default:
+			out = append(out, c.insert...)
+		}
+	}
+	return out, nil
+}
+
+// transformOps returns a' and b' such that applying a then b' equals applying b then a'.
+// Inserts from a win ties, matching ot.js so browser and server agree.
+func transformOps(a, b textOp) (textOp, textOp, error) {
+	if a.baseLen() != b.baseLen() {
+		return nil, nil, errors.New("concurrent operations have different base lengths")
+	}
+	var aPrime, bPrime textOp
+	i, j := 0, 0
+	var c1, c2 *otComponent
+	next := func(op textOp, idx *int) *otComponent {
+		if *idx >= len(op) {
+			return nil
+		}
+		c := op[*idx]
+		*idx++
+		return &c
+	}
+	c1, c2 = next(a, &i), next(b, &j)
+	for c1 != nil || c2 != nil {
+		if c1 != nil && len(c1.insert) > 0 {
+			aPrime = aPrime.insertS(c1.insert)
+			bPrime = bPrime.retainN(len(c1.insert))
+			c1 = next(a, &i)
+			continue
+		}
+		if c2 != nil && len(c2.insert) > 0 {
+			aPrime = aPrime.retainN(len(c2.insert))
+			bPrime = bPrime.insertS(c2.insert)
+			c2 = next(b, &j)
+			continue
+		}
+		if c1 == nil || c2 == nil {
+			return nil, nil, errors.New("operations do not cover the same document")
+		}
+		len1, len2 := c1.retain+c1.delete, c2.retain+c2.delete
+		n := len1
+		if len2 < n {
+			n = len2
+		}
+		switch {
+		case c1.retain > 0 && c2.retain > 0:
+			aPrime, bPrime = aPrime.retainN(n), bPrime.retainN(n)
+		case c1.delete > 0 && c2.retain > 0:
+			aPrime = aPrime.deleteN(n)
+		case c1.retain > 0 && c2.delete > 0:
+			bPrime = bPrime.deleteN(n)
+		}
+		// both deleting the same range needs no output
+		if len1 == n {
+			c1 = next(a, &i)
+		} else if c1.retain > 0 {
+			c1.retain -= n
+		} else {
+			c1.delete -= n
+		}
+		if len2 == n {
+			c2 = next(b, &j)
+		} else if c2.retain > 0 {
+			c2.retain -= n
+		} else {
+			c2.delete -= n
+		}
+	}
+	return aPrime, bPrime, nil
+}
+
+type collabMessage struct {
+	Type    string            `json:"type"`
+	Content *string           `json:"content,omitempty"`
+	Version int               `json:"version"`
+	Op      []json.RawMessage `json:"op,omitempty"`
+	From    int               `json:"from"`
+	To      int               `json:"to"`
+}
+
+type collabPeer struct {
+	ID    string `json:"id"`
+	User  string `json:"user"`
+	Color string `json:"color"`
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+}
+
+type collabClient struct {
+	peer collabPeer
+	send chan []byte
+}
+
+type collabDoc struct {
+	key       string
+	text      []uint16
+	version   int
+	seeded    bool
+	history   []textOp // history[i] produced version historyBase+i+1
+	histBase  int
+	clients   map[*collabClient]bool
+	nextColor int
+}
+
+type collabHub struct {
+	mu     sync.Mutex
+	docs   map[string]*collabDoc
+	nextID int
+}
+
+var collab = &collabHub{docs: make(map[string]*collabDoc)}
+
+// collabWSHandler serves the collaboration channel for one document.
+func collabWSHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = r.Header.Get("Authorization")
+	}
+	if token == "" {
+		if c, err := r.Cookie(environmentFor(r).tokenKey()); err == nil {
+			token = c.Value
+		}
+	}
+	if token == "" {
+		sendError(w, http.StatusUnauthorized, "Authorization token required")
+		return
+	}
+	if tokenExpired(token) {
+		sendTokenExpired(w)
+		return
+	}
+	if _, err := validateToken(r, token); err != nil {
+		sendTokenError(w, err)
+		return
+	}
+	key := r.URL.Query().Get("doc")
+	if !strings.HasPrefix(key, "file:") && !strings.HasPrefix(key, "diagram:") {
+		sendError(w, http.StatusBadRequest, "doc must be file:<scope>/<name> or diagram:<scope>/<name>")
+		return
+	}
+	user := collabUsername(r, token)
+	// Documents of different environments are different documents
+	if env := environmentFor(r); env != nil {
+		key = env.Name + "|" + key
+	}
+
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     func(r *http.Request) bool { return true },
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("collab upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+	session := websockets.admit(conn, "collab", user)
+	if session == nil {
+		return
+	}
+	defer session.release()
+	session.watchToken(r, token)
+
+	client := collab.join(key, user)
+	defer collab.leave(key, client)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case msg := <-client.send:
+				session.touch()
+				if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+					conn.Close()
+					return
+				}
+			case <-ticker.C:
+				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+					conn.Close()
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		session.touch()
+		if reply, ok := session.reauth(data); ok {
+			client.emit(json.RawMessage(reply))
+			continue
+		}
+		var msg collabMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			client.emit(map[string]interface{}{"type": "error", "message": "invalid message"})
+			continue
+		}
+		collab.handle(key, client, &msg)
+	}
+}
+
+// collabUsername resolves the display name for a token from the backend
+// session profile, through the token cache.
+func collabUsername(r *http.Request, token string) string {
+	id, err := validateToken(r, token)
+	if err != nil || id.User == "" {
+		return "anonymous"
+	}
+	return id.User
+}
+
+func (c *collabClient) emit(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+		log.Printf("collab: dropping message for slow client %s", c.peer.ID)
+	}
+}
+
+func (h *collabHub) join(key, user string) *collabClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	doc := h.docs[key]
+	if doc == nil {
+		doc = &collabDoc{key: key, clients: make(map[*collabClient]bool)}
+		h.docs[key] = doc
+	}
+	h.nextID++
+	client := &collabClient{
+		peer: collabPeer{ID: fmt.Sprintf("c%d", h.nextID), User: user, Color: collabColors[doc.nextColor%len(collabColors)]},
+		send: make(chan []byte, 256),
+	}
+	doc.nextColor++
+	doc.clients[client] = true
+	doc.broadcastPresence()
+	return client
+}
+
+func (h *collabHub) leave(key string, client *collabClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	doc := h.docs[key]
+	if doc == nil {
+		return
+	}
+	delete(doc.clients, client)
+	if len(doc.clients) == 0 {
+		delete(h.docs, key)
+		return
+	}
+	doc.broadcastPresence()
+}
+
+func (h *collabHub) handle(key string, client *collabClient, msg *collabMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	doc := h.docs[key]
+	if doc == nil {
+		return
+	}
+	switch msg.Type {
+	case "join":
+		// The first client seeds the document with the content it loaded; later ones adopt the live text.
+		if !doc.seeded && msg.Content != nil {
+			doc.text = utf16.Encode([]rune(*msg.Content))
+			doc.seeded = true
+		}
+		doc.sendSnapshot(client)
+	case "op":
+		if err := doc.applyOp(client, msg); err != nil {
+			client.emit(map[string]interface{}{"type": "error", "message": err.Error()})
+			doc.sendSnapshot(client)
+		}
+	case "cursor":
+		client.peer.From, client.peer.To = msg.From, msg.To
+		doc.broadcast(client, map[string]interface{}{"type": "cursor", "peer": client.peer})
+	case "saved":
+		doc.broadcast(client, map[string]interface{}{"type": "saved", "user": client.peer.User, "version": doc.version})
+	}
+}
+
+func (d *collabDoc) applyOp(client *collabClient, msg *collabMessage) error {
+	if !d.seeded {
+		return errors.New("document not joined")
+	}
+	op, err := parseTextOp(msg.Op)
+	if err != nil {
+		return err
+	}
+	if msg.Version < d.histBase || msg.Version > d.version {
+		return fmt.Errorf("version %d is no longer available", msg.Version)
+	}
+	for _, applied := range d.history[msg.Version-d.histBase:] {
+		if op, _, err = transformOps(op, applied); err != nil {
+			return err
+		}
+	}
+	text, err := op.apply(d.text)
+	if err != nil {
+		return err
+	}
+	d.text = text
+	d.version++
+	d.history = append(d.history, op)
+	if len(d.history) > collabHistoryLimit {
+		drop := len(d.history) - collabHistoryLimit
+		d.history = append([]textOp(nil), d.history[drop:]...)
+		d.histBase += drop
+	}
+	client.emit(map[string]interface{}{"type": "ack", "version": d.version})
+	d.broadcast(client, map[string]interface{}{"type": "op", "version": d.version, "op": op, "peer": client.peer.ID})
+	return nil
+}
+
+func (d *collabDoc) sendSnapshot(client *collabClient) {
+	client.emit(map[string]interface{}{
+		"type":    "snapshot",
+		"content": string(utf16.Decode(d.text)),
+		"version": d.version,
+		"self":    client.peer,
+		"peers":   d.peers(),
+	})
+}
+
+func (d *collabDoc) peers() []collabPeer {
+	out := make([]collabPeer, 0, len(d.clients))
+	for c := range d.clients {
+		out = append(out, c.peer)
+	}
+	return out
+}
+
+func (d *collabDoc) broadcastPresence() {
+	d.broadcast(nil, map[string]interface{}{"type": "presence", "peers": d.peers()})
+}
+
+// broadcast sends v to every client except the sender.
+func (d *collabDoc) broadcast(sender *collabClient, v interface{}) {
+	for c := range d.clients {
+		if c != sender {
+			c.emit(v)
+		}
+	}
+}
+
+// ---- Diagram save merge ----
+
+// diagramSaveRequest is the charioteer diagram save body. Base is the diagram as the client
+// loaded it; when the stored diagram has changed since, the save is merged instead of overwriting.
+type diagramSaveRequest struct {
+	Name    string                 `json:"name"`
+	Content map[string]interface{} `json:"content"`
+	Scope   string                 `json:"scope,omitempty"`
+	Base    map[string]interface{} `json:"base,omitempty"`
+}
+
+// diagramSaveHandler saves a diagram through the backend, merging with concurrent saves.
+func diagramSaveHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	var req diagramSaveRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.Base == nil || req.Name == "" {
+		proxyToBackendJSON(w, r, http.MethodPost, appendQuery("/api/diagrams", r), body)
+		return
+	}
+	theirs, err := fetchStoredDiagram(r, req.Name)
+	if err != nil || theirs == nil || reflect.DeepEqual(theirs, req.Base) {
+		req.Base = nil
+		forward, _ := json.Marshal(req)
+		proxyToBackendJSON(w, r, http.MethodPost, appendQuery("/api/diagrams", r), forward)
+		return
+	}
+	merged, conflicts := mergeDiagrams(req.Base, req.Content, theirs)
+	req.Base, req.Content = nil, merged
+	forward, _ := json.Marshal(req)
+	status, respBody, err := backendRequest(r, http.MethodPost, appendQuery("/api/diagrams", r), forward)
+	if err != nil {
+		sendError(w, http.StatusServiceUnavailable, "Failed to contact backend: "+err.Error())
+		return
+	}
+	if status >= 300 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write(respBody)
+		return
+	}
+	sendSuccess(w, map[string]interface{}{"merged": true, "content": merged, "conflicts": conflicts})
+}
+
+func fetchStoredDiagram(r *http.Request, name string) (map[string]interface{}, error) {
+	status, body, err := backendRequest(r, http.MethodGet, appendQuery("/api/diagrams/"+url.PathEscape(name), r), nil)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("backend returned %d", status)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// backendRequest performs a backend call with the caller's credentials and returns the raw response.
+func backendRequest(r *http.Request, method, path string, body []byte) (int, []byte, error) {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		if c, err := r.Cookie(environmentFor(r).tokenKey()); err == nil {
+			token = c.Value
+		}
+	}
+	resp, err := doBackend(r, getHTTPClient(), method, path, body, func(req *http.Request) {
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, data, err
+}
+
+// mergeDiagrams three-way merges nodes, edges and nesting relations by identity. Elements changed
+// on only one side take that side's version; elements changed on both sides keep the saving
+// client's version and are reported as conflicts. Other top-level fields follow the same rule.
+func mergeDiagrams(base, mine, theirs map[string]interface{}) (map[string]interface{}, []string) {
+	merged := make(map[string]interface{})
+	var conflicts []string
+	keys := make(map[string]bool)
+	for _, m := range []map[string]interface{}{base, mine, theirs} {
+		for k := range m {
+			keys[k] = true
+		}
+	}
+	for k := range keys {
+		switch k {
+		case "nodes", "edges", "nestingRelations":
+			list, c := mergeElements(k, base[k], mine[k], theirs[k])
+			merged[k] = list
+			conflicts = append(conflicts, c...)
+		default:
+			b, bok := base[k]
+			m, mok := mine[k]
+			t, tok := theirs[k]
+			mineChanged := mok != bok || !reflect.DeepEqual(m, b)
+			theirsChanged := tok != bok || !reflect.DeepEqual(t, b)
+			switch {
+			case theirsChanged && !mineChanged:
+				if tok {
+					merged[k] = t
+				}
+			case mok:
+				merged[k] = m
+			}
+		}
+	}
+	return merged, conflicts
+}
+
+func mergeElements(kind string, base, mine, theirs interface{}) ([]interface{}, []string) {
+	baseMap, _ := indexElements(kind, base)
+	mineMap, mineOrder := indexElements(kind, mine)
+	theirsMap, theirsOrder := indexElements(kind, theirs)
+	var out []interface{}
+	var conflicts []string
+	seen := make(map[string]bool)
+	for _, id := range append(mineOrder, theirsOrder...) {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		b, inBase := baseMap[id]
+		m, inMine := mineMap[id]
+		t, inTheirs := theirsMap[id]
+		mineChanged := inMine != inBase || !reflect.DeepEqual(m, b)
+		theirsChanged := inTheirs != inBase || !reflect.DeepEqual(t, b)
+		switch {
+		case !theirsChanged:
+			if inMine {
+				out = append(out, m)
+			}
+		case !mineChanged:
+			if inTheirs {
+				out = append(out, t)
+			}
+		default:
+			if !reflect.DeepEqual(m, t) {
+				conflicts = append(conflicts, fmt.Sprintf("%s %s changed by both saves; kept this version", strings.TrimSuffix(kind, "s"), id))
+			}
+			if inMine {
+				out = append(out, m)
+			}
+		}
+	}
+	if out == nil {
+		out = []interface{}{}
+	}
+	return out, conflicts
+}
+
+func indexElements(kind string, raw interface{}) (map[string]interface{}, []string) {
+	list, _ := raw.([]interface{})
+	index := make(map[string]interface{}, len(list))
+	order := make([]string, 0, len(list))
+	for i, e := range list {
+		obj, _ := e.(map[string]interface{})
+		var id string
+		if kind == "nestingRelations" {
+			id = fmt.Sprint(obj["parentId"]) + ">" + fmt.Sprint(obj["childId"])
+		} else if v, ok := obj["id"].(string); ok {
+			id = v
+		}
+		if id == "" {
+			id = fmt.Sprintf("#%d", i)
+		}
+		if _, dup := index[id]; !dup {
+			order = append(order, id)
+		}
+		index[id] = e
+	}
+	return index, order
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Named environments let one charioteer serve several backends, such as
+// dev, staging and prod. Each browser session works against one environment
+// at a time, chosen with POST /api/environments/active, and keeps a separate
+// login per environment: its token cookie and the editor's stored token are
+// named after the environment, so credentials never travel to another
+// environment's backends.
+
+var environmentsFlag = flag.String("environments", "", "JSON file of named backend environments (dev, staging, prod...), each with its own backends and logins")
+
+// environmentCookie holds the environment a browser session is switched to;
+// clients without cookies send the X-Chariot-Environment header instead.
+const environmentCookie = "chariot_env"
+
+// environment is a named group of backends.
+type environment struct {
+	Name       string `json:"name"`
+	Label      string `json:"label,omitempty"`      // shown in the page banner (default the name)
+	Backend    string `json:"backend"`              // backend URLs or SRV names, as -backend takes them
+	Color      string `json:"color,omitempty"`      // banner color (default by name)
+	Production bool   `json:"production,omitempty"` // the editor asks before running code
+	pool       *backendPool
+}
+
+// environmentsFile is the document -environments names:
+//
+//	{"default": "dev", "environments": [{"name": "dev", "backend": "https://localhost:8087"}, ...]}
+type environmentsFile struct {
+	Default      string         `json:"default"` // environment of sessions that have not switched (default the first)
+	Environments []*environment `json:"environments"`
+}
+
+// environmentInfo describes an environment to pages and API clients; backend
+// URLs are left out.
+type environmentInfo struct {
+	Name       string `json:"name"`
+	Label      string `json:"label"`
+	Color      string `json:"color"`
+	Production bool   `json:"production"`
+	Active     bool   `json:"active"`
+	Healthy    int    `json:"healthy"`  // healthy backends
+	Backends   int    `json:"backends"` // configured backends
+}
+
+var (
+	// environments lists the configured environments in file order; it is
+	// empty without -environments, and charioteer then serves the backends
+	// of -backend alone.
+	environments       []*environment
+	defaultEnvironment *environment
+)
+
+var environmentName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Banner colors of environments that do not set one.
+var environmentColors = map[string]string{"dev": "#2e7d32", "staging": "#ef6c00", "prod": "#c62828", "production": "#c62828"}
+
+// getEnvironmentsFile returns the environments file from flag or environment variable.
+func getEnvironmentsFile() string {
+	if *environmentsFlag != "" {
+		return *environmentsFlag
+	}
+	return os.Getenv("CHARIOT_ENVIRONMENTS")
+}
+
+// loadEnvironments reads the environments file. The default environment
+// uses the shared backend pool, so code that does not know about
+// environments keeps reaching it; the others get pools of their own.
+func loadEnvironments() {
+	path := getEnvironmentsFile()
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("environments: %v", err)
+	}
+	var file environmentsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		log.Fatalf("environments: %s: %v", path, err)
+	}
+	if len(file.Environments) == 0 {
+		log.Fatalf("environments: %s defines no environments", path)
+	}
+	seen := map[string]bool{}
+	for _, env := range file.Environments {
+		if !environmentName.MatchString(env.Name) {
+			log.Fatalf("environments: invalid name %q (lowercase letters, digits, '_' and '-')", env.Name)
+		}
+		if seen[env.Name] {
+			log.Fatalf("environments: %q is defined twice", env.Name)
+		}
+		seen[env.Name] = true
+		if strings.TrimSpace(env.Backend) == "" {
+			log.Fatalf("environments: %q has no backend", env.Name)
+		}
+		if env.Label == "" {
+			env.Label = env.Name
+		}
+		if env.Color == "" {
+			env.Color = environmentColors[env.Name]
+		}
+		if env.Color == "" {
+			env.Color = "#455a64"
+		}
+		env.pool = &backendPool{}
+	}
+	defaultEnvironment = file.Environments[0]
+	if file.Default != "" {
+		defaultEnvironment = nil
+		for _, env := range file.Environments {
+			if env.Name == file.Default {
+				defaultEnvironment = env
+			}
+		}
+		if defaultEnvironment == nil {
+			log.Fatalf("environments: default %q is not defined", file.Default)
+		}
+	}
+	defaultEnvironment.pool = backends
+	environments = file.Environments
+	log.Printf("Environments: %d configured, default %s", len(environments), defaultEnvironment.Name)
+}
+
+// lookupEnvironment returns the environment named name, or nil.
+func lookupEnvironment(name string) *environment {
+	for _, env := range environments {
+		if env.Name == name {
+			return env
+		}
+	}
+	return nil
+}
+
+// environmentFor returns the environment a request works against: the one
+// its header or cookie names, else the default. It is nil when no
+// environments are configured.
+func environmentFor(r *http.Request) *environment {
+	if len(environments) == 0 {
+		return nil
+	}
+	name := r.Header.Get("X-Chariot-Environment")
+	if name == "" {
+		if c, err := r.Cookie(environmentCookie); err == nil {
+			name = c.Value
+		}
+	}
+	if env := lookupEnvironment(name); env != nil {
+		return env
+	}
+	return defaultEnvironment
+}
+
+// backendPool returns the environment's backends; nil stands for the
+// backends of -backend.
+func (e *environment) backendPool() *backendPool {
+	if e == nil {
+		return backends
+	}
+	return e.pool
+}
+
+// backendURL returns the backend requests to the environment go to, as
+// getBackendURL does for the default.
+func (e *environment) backendURL() string {
+	if e == nil || e.pool == backends {
+		return getBackendURL()
+	}
+	if candidates := e.pool.candidates(); len(candidates) > 0 {
+		return candidates[0]
+	}
+	return strings.TrimRight(strings.TrimSpace(strings.Split(e.Backend, ",")[0]), "/")
+}
+
+// tokenKey names the cookie, and the editor's local storage entry, holding
+// the login token for the environment. The default environment keeps the
+// plain chariot_token so existing sessions stay logged in.
+func (e *environment) tokenKey() string {
+	if e == nil || e == defaultEnvironment {
+		return "chariot_token"
+	}
+	return "chariot_token_" + e.Name
+}
+
+// refreshKey names the cookie holding the environment's refresh token.
+func (e *environment) refreshKey() string {
+	return e.tokenKey() + "_refresh"
+}
+
+// info describes the environment, marked active when it is active.
+func (e *environment) info(active *environment) environmentInfo {
+	snapshot := e.pool.snapshot()
+	healthy := 0
+	for _, b := range snapshot {
+		if b.Healthy {
+			healthy++
+		}
+	}
+	return environmentInfo{Name: e.Name, Label: e.Label, Color: e.Color, Production: e.Production, Active: e == active, Healthy: healthy, Backends: len(snapshot)}
+}
+
+// environmentsHandler lists the environments and the one the session works
+// against. It is public, so a user can pick an environment before logging in
+// to it.
+func environmentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	active := environmentFor(r)
+	out := struct {
+		Active       string            `json:"active"`
+		Environments []environmentInfo `json:"environments"`
+	}{Environments: []environmentInfo{}}
+	if active != nil {
+		out.Active = active.Name
+	}
+	for _, env := range environments {
+		out.Environments = append(out.Environments, env.info(active))
+	}
+	sendSuccess(w, out)
+}
+
+// environmentActiveHandler switches the session to another environment:
+// POST {"name": "staging"}. Logins to other environments stay valid for
+// switching back.
+func environmentActiveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	env := lookupEnvironment(req.Name)
+	if env == nil {
+		sendError(w, http.StatusNotFound, "unknown environment: "+req.Name)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     environmentCookie,
+		Value:    env.Name,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	log.Printf("Session switched to environment %s", env.Name)
+	sendSuccess(w, env.info(env))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// featureFlag is a subsystem operators can switch off. A disabled feature's
+// editor tab is hidden and its proxied API calls are rejected.
+type featureFlag struct {
+	Name      string
+	Tab       string   // editor toolbar tab hidden when disabled
+	Paths     []string // request path prefixes rejected when disabled, without the /charioteer prefix
+	CollabDoc string   // collaboration document kind rejected when disabled
+}
+
+// featureRegistry lists the flags charioteer knows; all default to enabled.
+var featureRegistry = []featureFlag{
+	{Name: "enable_agents", Tab: "agents", Paths: []string{"/api/agents", "/ws/agents"}},
+	{Name: "enable_diagrams", Tab: "diagrams", Paths: []string{"/api/diagrams"}, CollabDoc: "diagram:"},
+	{Name: "enable_listeners", Paths: []string{"/api/listeners", "/api/listener/"}},
+	{Name: "enable_dashboard", Tab: "dashboard", Paths: []string{"/dashboard", "/api/dashboard", "/ws/dashboard"}},
+	{Name: "enable_collab", Paths: []string{"/ws/collab"}},
+	{Name: "enable_repl", Paths: []string{"/ws/repl"}},
+	{Name: "enable_wasm_check", Paths: []string{"/wasm"}},
+}
+
+var featuresFlag = flag.String("features", "", "Comma-separated feature flags, e.g. enable_agents=false,enable_listeners=false")
+
+// features holds the resolved flag values; see loadFeatures.
+var features = map[string]bool{}
+
+// loadFeatures resolves every registered flag from -features, then
+// CHARIOT_FEATURES, then a per-flag environment variable such as
+// CHARIOT_ENABLE_AGENTS, defaulting to enabled.
+func loadFeatures() {
+	for _, f := range featureRegistry {
+		features[f.Name] = true
+	}
+	list := *featuresFlag
+	if list == "" {
+		list = os.Getenv("CHARIOT_FEATURES")
+	}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, hasValue := strings.Cut(item, "=")
+		enabled := true
+		if hasValue {
+			b, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				log.Fatalf("invalid value for feature %s: %q", name, value)
+			}
+			enabled = b
+		}
+		setFeature(strings.TrimSpace(name), enabled)
+	}
+	for _, f := range featureRegistry {
+		if env := os.Getenv("CHARIOT_" + strings.ToUpper(f.Name)); env != "" {
+			if b, err := strconv.ParseBool(env); err == nil {
+				features[f.Name] = b
+			}
+		}
+	}
+
+	var disabled []string
+	for name, on := range features {
+		if !on {
+			disabled = append(disabled, name)
+		}
+	}
+	sort.Strings(disabled)
+	if len(disabled) > 0 {
+		log.Printf("Features disabled: %s", strings.Join(disabled, ", "))
+	}
+}
+
+func setFeature(name string, enabled bool) {
+	if _, ok := features[name]; !ok {
+		log.Fatalf("unknown feature flag %q", name)
+	}
+	features[name] = enabled
+}
+
+// featureEnabled reports whether a registered feature is on.
+func featureEnabled(name string) bool {
+	on, ok := features[name]
+	return !ok || on
+}
+
+// featureSnapshot copies the flag values for injection into a page.
+func featureSnapshot() map[string]bool {
+	out := make(map[string]bool, len(features))
+	for name, on := range features {
+		out[name] = on
+	}
+	return out
+}
+
+// disabledFeatureFor returns the disabled feature guarding the request, if any.
+func disabledFeatureFor(r *http.Request) (featureFlag, bool) {
+	path := strings.TrimPrefix(r.URL.Path, "/charioteer")
+	for _, f := range featureRegistry {
+		if featureEnabled(f.Name) {
+			continue
+		}
+		for _, prefix := range f.Paths {
+			if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+				return f, true
+			}
+		}
+		if f.CollabDoc != "" && path == "/ws/collab" && strings.HasPrefix(r.URL.Query().Get("doc"), f.CollabDoc) {
+			return f, true
+		}
+	}
+	return featureFlag{}, false
+}
+
+// featureGate rejects requests for disabled features before they reach the
+// proxy handlers.
+func featureGate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f, blocked := disabledFeatureFor(r); blocked {
+			sendError(w, http.StatusForbidden, "feature disabled on this server: "+f.Name)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
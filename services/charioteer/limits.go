@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// bodyRoute is a group of routes sharing a request body size limit. Paths
+// are prefixes given without the /charioteer prefix; requests matching no
+// group get the "default" limit.
+type bodyRoute struct {
+	Name  string
+	Limit int64
+	Paths []string
+}
+
+// bodyRoutes lists the limit groups, most specific first.
+var bodyRoutes = []bodyRoute{
+	{Name: "execute", Limit: 2 << 20, Paths: []string{"/api/execute", "/api/execute-async"}},
+	{Name: "save", Limit: 5 << 20, Paths: []string{"/api/files", "/api/function/save", "/api/library/save", "/api/notebooks"}},
+	{Name: "diagrams", Limit: 10 << 20, Paths: []string{"/api/diagrams"}},
+	{Name: "default", Limit: 1 << 20},
+}
+
+var bodyLimitsFlag = flag.String("body-limits", "", "Request body limits per route group, e.g. execute=2MB,save=5MB,diagrams=10MB,default=1MB")
+
+// jsonSchema is the subset of JSON Schema charioteer checks request payloads
+// against before proxying them.
+type jsonSchema struct {
+	Type       string // object, array, string, number, boolean; empty accepts any type
+	Nullable   bool
+	Required   []string
+	Properties map[string]*jsonSchema
+	Items      *jsonSchema
+	MinLength  int
+}
+
+// bodySchemas maps "METHOD path" to the schema its payload must satisfy.
+var bodySchemas = map[string]*jsonSchema{
+	"POST /api/execute":       executeSchema,
+	"POST /api/execute-async": executeSchema,
+	"POST /api/files": {Type: "object", Required: []string{"name", "content"}, Properties: map[string]*jsonSchema{
+		"name":    {Type: "string", MinLength: 1},
+		"content": {Type: "string"},
+	}},
+	"POST /api/function/save": {Type: "object", Required: []string{"name"}, Properties: map[string]*jsonSchema{
+		"name": {Type: "string", MinLength: 1},
+		"code": {Type: "string"},
+		"args": {Type: "array", Items: &jsonSchema{Type: "string"}},
+		"body": {Type: "string"},
+	}},
+	"POST /api/diagrams": {Type: "object", Required: []string{"name", "content"}, Properties: map[string]*jsonSchema{
+		"name":    {Type: "string", MinLength: 1},
+		"content": {Type: "object"},
+		"scope":   {Type: "string"},
+		"base":    {Type: "object", Nullable: true},
+	}},
+	"POST /api/runtime/watches": {Type: "object", Required: []string{"expression"}, Properties: map[string]*jsonSchema{
+		"expression": {Type: "string", MinLength: 1},
+	}},
+	"POST /api/runtime/snapshots": {Type: "object", Required: []string{"name"}, Properties: map[string]*jsonSchema{
+		"name": {Type: "string", MinLength: 1},
+	}},
+	"POST /api/notebooks": {Type: "object", Required: []string{"name", "cells"}, Properties: map[string]*jsonSchema{
+		"name": {Type: "string", MinLength: 1},
+		"cells": {Type: "array", Items: &jsonSchema{Type: "object", Properties: map[string]*jsonSchema{
+			"id":     {Type: "string"},
+			"kind":   {Type: "string"},
+			"source": {Type: "string"},
+		}}},
+		"scope": {Type: "string"},
+	}},
+	"POST /api/diagrams/validate":  {Type: "object"},
+	"POST /api/diagrams/from-code": {Type: "object"},
+}
+
+var executeSchema = &jsonSchema{Type: "object", Required: []string{"program"}, Properties: map[string]*jsonSchema{
+	"program":   {Type: "string", MinLength: 1},
+	"filename":  {Type: "string"},
+	"sourceMap": {Type: "object", Nullable: true},
+	"diagram":   {Type: "string"},
+	"scope":     {Type: "string"},
+	"runtime":   {Type: "string"},
+}}
+
+// validate returns one message per violation, each prefixed with the
+// location of the offending value.
+func (s *jsonSchema) validate(v interface{}, at string) []string {
+	name := at
+	if name == "" {
+		name = "body"
+	}
+	if v == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return []string{name + ": must not be null"}
+	}
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return []string{name + ": must be an object"}
+		}
+		var problems []string
+		for _, key := range s.Required {
+			if _, ok := obj[key]; !ok {
+				problems = append(problems, joinPath(at, key)+": is required")
+			}
+		}
+		keys := make([]string, 0, len(s.Properties))
+		for key := range s.Properties {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if value, ok := obj[key]; ok {
+				problems = append(problems, s.Properties[key].validate(value, joinPath(at, key))...)
+			}
+		}
+		return problems
+	case "array":
+		list, ok := v.([]interface{})
+		if !ok {
+			return []string{name + ": must be an array"}
+		}
+		var problems []string
+		if s.Items != nil {
+			for i, item := range list {
+				problems = append(problems, s.Items.validate(item, fmt.Sprintf("%s[%d]", name, i))...)
+			}
+		}
+		return problems
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return []string{name + ": must be a string"}
+		}
+		if len(str) < s.MinLength {
+			return []string{name + ": must not be empty"}
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			return []string{name + ": must be a number"}
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return []string{name + ": must be a boolean"}
+		}
+	}
+	return nil
+}
+
+func joinPath(at, key string) string {
+	if at == "" {
+		return key
+	}
+	return at + "." + key
+}
+
+// parseByteSize parses sizes such as 1048576, 512KB or 10MB.
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, multiplier = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// loadBodyLimits applies -body-limits, then CHARIOT_BODY_LIMITS, over the
+// defaults in bodyRoutes. An unknown group name stops startup.
+func loadBodyLimits() {
+	spec := *bodyLimitsFlag
+	if spec == "" {
+		spec = os.Getenv("CHARIOT_BODY_LIMITS")
+	}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		limit, err := parseByteSize(value)
+		if err != nil {
+			log.Fatalf("invalid body limit for %s: %v", name, err)
+		}
+		found := false
+		for i := range bodyRoutes {
+			if bodyRoutes[i].Name == name {
+				bodyRoutes[i].Limit, found = limit, true
+			}
+		}
+		if !found {
+			log.Fatalf("unknown body limit group %q", name)
+		}
+	}
+}
+
+// bodyRouteFor returns the limit group of a request path.
+func bodyRouteFor(path string) bodyRoute {
+	for _, route := range bodyRoutes {
+		if len(route.Paths) == 0 || matchesPrefix(path, route.Paths) {
+			return route
+		}
+	}
+	return bodyRoutes[len(bodyRoutes)-1]
+}
+
+// formatByteSize renders a limit for error messages.
+func formatByteSize(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%d MB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// limitBodies caps request bodies by route group and checks JSON payloads
+// against bodySchemas before any handler reads them. Oversized bodies are
+// rejected with 413 and malformed or invalid payloads with 422. Routes with a
+// body limit of their own are left to their middleware chain.
+func limitBodies(routes *router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody || r.Method == http.MethodGet || r.Method == http.MethodHead || routes.ownBodyLimit(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route := bodyRouteFor(strings.TrimPrefix(r.URL.Path, "/charioteer"))
+		if readBody(w, r, route.Name, route.Limit) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// capBody is the middleware of a route with a body limit of its own. It
+// checks the body as limitBodies does for route groups, naming the route in
+// the 413.
+func capBody(name string, limit int64) middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody || r.Method == http.MethodGet || r.Method == http.MethodHead || readBody(w, r, name, limit) {
+				next(w, r)
+			}
+		}
+	}
+}
+
+// readBody reads the request body into memory, up to limit bytes, and checks
+// it against its schema in bodySchemas. It answers the request and returns
+// false when the body is too large or invalid.
+func readBody(w http.ResponseWriter, r *http.Request, name string, limit int64) bool {
+	tooLarge := func() {
+		sendError(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("request body exceeds the %s limit for %s requests", formatByteSize(limit), name))
+	}
+	if r.ContentLength > limit {
+		tooLarge()
+		return false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			tooLarge()
+			return false
+		}
+		sendError(w, http.StatusBadRequest, "failed to read request body")
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	path := strings.TrimPrefix(r.URL.Path, "/charioteer")
+	if schema := bodySchemas[r.Method+" "+path]; schema != nil {
+		var payload interface{}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&payload); err != nil {
+			sendError(w, http.StatusUnprocessableEntity, "invalid JSON in request body: "+err.Error())
+			return false
+		}
+		if dec.More() {
+			sendError(w, http.StatusUnprocessableEntity, "invalid JSON in request body: unexpected data after the value")
+			return false
+		}
+		if problems := schema.validate(payload, ""); len(problems) > 0 {
+			sendError(w, http.StatusUnprocessableEntity, "invalid request body: "+strings.Join(problems, "; "))
+			return false
+		}
+	}
+	return true
+}
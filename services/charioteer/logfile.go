@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	logFileFlag     = flag.String("log-file", "", "Structured log file, rotated and queried at /api/logs/system, or off (default logs/charioteer.log)")
+	logMaxSizeFlag  = flag.Int("log-max-size", 0, "MB a log file reaches before it is rotated (default 10)")
+	logMaxFilesFlag = flag.Int("log-max-files", 0, "Rotated log files kept (default 5)")
+)
+
+// systemLogPath is the log file in use, "" when logging to stderr only, and
+// systemLogKeep the number of rotated files kept.
+var (
+	systemLogPath string
+	systemLogKeep int
+)
+
+// logComponent tags charioteer's entries in the log files.
+const logComponent = "charioteer"
+
+// systemLogLimit is how many entries /api/logs/system returns by default.
+const systemLogLimit = 500
+
+// logEntry is a line of the log files, as the backend writes them too.
+type logEntry struct {
+	Time      time.Time              `json:"time"`
+	Level     string                 `json:"level"`
+	Component string                 `json:"component,omitempty"`
+	Message   string                 `json:"message"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+var logLevelRank = map[string]int{"debug": 0, "info": 1, "warn": 2, "error": 3}
+
+// systemLog is the standard logger's output: each line goes to stderr as
+// before and, as a JSON entry, to the rotating log file.
+type systemLog struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	keep     int
+	file     *os.File
+	size     int64
+}
+
+// logSetting reads an integer setting from flag, environment variable, or
+// default.
+func logSetting(flagValue int, env string, def int) int {
+	if flagValue > 0 {
+		return flagValue
+	}
+	if v, err := strconv.Atoi(os.Getenv(env)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// initLogging sends the standard logger's output to the log file as well.
+func initLogging() {
+	path := *logFileFlag
+	if path == "" {
+		path = os.Getenv("CHARIOT_LOG_FILE")
+	}
+	if path == "" {
+		path = "logs/charioteer.log"
+	}
+	if path == "off" {
+		return
+	}
+	l := &systemLog{
+		path:     path,
+		maxBytes: int64(logSetting(*logMaxSizeFlag, "CHARIOT_LOG_MAX_SIZE", 10)) << 20,
+		keep:     logSetting(*logMaxFilesFlag, "CHARIOT_LOG_MAX_FILES", 5),
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		log.Printf("Cannot create log directory, logging to stderr only: %v", err)
+		return
+	}
+	if err := l.open(); err != nil {
+		log.Printf("Cannot open log file %s, logging to stderr only: %v", l.path, err)
+		return
+	}
+	systemLogPath, systemLogKeep = l.path, l.keep
+	log.SetFlags(0)
+	log.SetOutput(l)
+}
+
+func (l *systemLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file, l.size = f, info.Size()
+	return nil
+}
+
+// Write receives one line of the standard logger.
+func (l *systemLog) Write(p []byte) (int, error) {
+	now := time.Now()
+	msg := strings.TrimRight(string(p), "\n")
+	fmt.Fprintf(os.Stderr, "%s %s\n", now.Format("2006/01/02 15:04:05"), msg)
+
+	line, _ := json.Marshal(map[string]interface{}{
+		"ts":        now.Format(time.RFC3339Nano),
+		"level":     lineLevel(msg),
+		"component": logComponent,
+		"msg":       msg,
+	})
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxBytes > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return len(p), nil // Still logged to stderr
+		}
+	}
+	n, _ := l.file.Write(line)
+	l.size += int64(n)
+	return len(p), nil
+}
+
+// rotate renames the file to path.1, path.1 to path.2 and so on, dropping
+// the oldest beyond keep.
+func (l *systemLog) rotate() error {
+	l.file.Close()
+	if l.keep > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", l.path, l.keep))
+		for i := l.keep - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		os.Rename(l.path, l.path+".1")
+	} else {
+		os.Remove(l.path)
+	}
+	return l.open()
+}
+
+// lineLevel guesses the level of a log.Printf line, which has none: error
+// when it reports an error or a failure, warn when it warns, else info.
+func lineLevel(msg string) string {
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.Contains(lower, "error") || strings.Contains(lower, "fail") || strings.Contains(lower, "panic"):
+		return "error"
+	case strings.Contains(lower, "warn"):
+		return "warn"
+	}
+	return "info"
+}
+
+// systemLogQuery selects log entries; zero fields do not filter.
+type systemLogQuery struct {
+	since     time.Time
+	level     string
+	component string
+	contains  string // Lower case
+}
+
+func (q systemLogQuery) match(e logEntry) bool {
+	return !e.Time.Before(q.since) && logLevelRank[e.Level] >= logLevelRank[q.level] &&
+		(q.component == "" || e.Component == q.component) &&
+		(q.contains == "" || strings.Contains(strings.ToLower(e.Message), q.contains))
+}
+
+// readLogEntries returns the entries of the log file and its rotated files
+// matching q, oldest first.
+func readLogEntries(path string, q systemLogQuery) []logEntry {
+	var out []logEntry
+	for i := systemLogKeep; i >= 0; i-- {
+		file := path
+		if i > 0 {
+			file = fmt.Sprintf("%s.%d", path, i)
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var raw struct {
+				TS        string `json:"ts"`
+				Level     string `json:"level"`
+				Component string `json:"component"`
+				Msg       string `json:"msg"`
+			}
+			if json.Unmarshal(scanner.Bytes(), &raw) != nil {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339Nano, raw.TS)
+			if err != nil {
+				continue
+			}
+			e := logEntry{Time: t, Level: raw.Level, Component: raw.Component, Message: raw.Msg}
+			if q.match(e) {
+				out = append(out, e)
+			}
+		}
+		f.Close()
+	}
+	return out
+}
+
+// systemLogsHandler answers GET /api/logs/system with the backend's entries
+// and charioteer's own, merged by time. The backend decides who may read
+// them (admins), so charioteer's entries are only added to its answer.
+func systemLogsHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := systemLogQuery{
+		level:     strings.ToLower(params.Get("level")),
+		component: params.Get("component"),
+		contains:  strings.ToLower(params.Get("q")),
+	}
+	if q.level == "warning" {
+		q.level = "warn"
+	}
+	if _, ok := logLevelRank[q.level]; q.level != "" && !ok {
+		sendError(w, http.StatusBadRequest, "unknown log level '"+params.Get("level")+"'")
+		return
+	}
+	if since := params.Get("since"); since != "" {
+		if d, err := time.ParseDuration(since); err == nil {
+			q.since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			q.since = t
+		} else {
+			sendError(w, http.StatusBadRequest, "since must be an RFC 3339 time or a duration such as 15m")
+			return
+		}
+	}
+	limit := systemLogLimit
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			sendError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = n
+	}
+
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		if c, err := r.Cookie(environmentFor(r).tokenKey()); err == nil {
+			token = c.Value
+		}
+	}
+	resp, err := doBackend(r, getHTTPClient(), http.MethodGet, appendQuery("/api/logs/system", r), nil, func(req *http.Request) {
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+	})
+	if err != nil {
+		sendBackendError(w, http.StatusServiceUnavailable, "Failed to contact backend: ", err)
+		return
+	}
+	defer resp.Body.Close()
+	var backend struct {
+		Result string     `json:"result"`
+		Data   []logEntry `json:"data"`
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(&backend); err != nil {
+			sendError(w, http.StatusBadGateway, "invalid backend response: "+err.Error())
+			return
+		}
+	case http.StatusNotFound:
+		// The backend keeps no log files; charioteer's entries remain
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	entries := backend.Data
+	if systemLogPath != "" {
+		entries = append(entries, readLogEntries(systemLogPath, q)...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	if entries == nil {
+		entries = []logEntry{}
+	}
+	sendSuccess(w, entries)
+}
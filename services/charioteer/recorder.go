@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recording mode keeps the last API exchanges in memory, for diagnosing
+// requests that fail between the editor and the backend: each holds the
+// request as charioteer received it, the response it sent back, and the
+// backend calls made on its behalf. Credentials are redacted and bodies cut
+// to recordBodyLimit before anything is kept. Admins read the recordings
+// with GET /api/admin/recordings.
+
+var recordFlag = flag.Int("record", 0, "Record the last N API requests and responses, redacted, for GET /api/admin/recordings (default 0, off)")
+
+// recordBodyLimit is how much of each body is kept.
+const recordBodyLimit = 8 << 10
+
+const redacted = "[redacted]"
+
+// exchange is one recorded API request.
+type exchange struct {
+	ID              uint64            `json:"id"`
+	Time            time.Time         `json:"time"`
+	DurationMS      float64           `json:"duration_ms"`
+	Environment     string            `json:"environment,omitempty"`
+	Method          string            `json:"method"`
+	URL             string            `json:"url"`
+	RequestHeaders  map[string]string `json:"request_headers"`
+	RequestBody     string            `json:"request_body,omitempty"`
+	Status          int               `json:"status"`
+	ResponseHeaders map[string]string `json:"response_headers"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+	Truncated       bool              `json:"truncated,omitempty"` // a body was longer than recordBodyLimit
+	Backend         []backendCall     `json:"backend"`
+	mu              sync.Mutex
+}
+
+// backendCall is one request doBackend sent for a recorded exchange; a
+// retried request has one per attempt.
+type backendCall struct {
+	Method     string  `json:"method"`
+	URL        string  `json:"url"`
+	Status     int     `json:"status,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+type exchangeRecorder struct {
+	mu     sync.Mutex
+	ring   []*exchange
+	next   int
+	lastID uint64
+}
+
+var recorder *exchangeRecorder
+
+// getRecordSize returns the number of exchanges to keep from flag, environment variable, or default
+func getRecordSize() int {
+	if *recordFlag > 0 {
+		return *recordFlag
+	}
+	if env := os.Getenv("CHARIOT_RECORD"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// initRecorder turns recording on when a buffer size is configured.
+func initRecorder() {
+	if n := getRecordSize(); n > 0 {
+		recorder = &exchangeRecorder{ring: make([]*exchange, n)}
+		log.Printf("Recording the last %d API exchanges (GET /api/admin/recordings)", n)
+	}
+}
+
+func (rec *exchangeRecorder) add(e *exchange) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.lastID++
+	e.ID = rec.lastID
+	rec.ring[rec.next] = e
+	rec.next = (rec.next + 1) % len(rec.ring)
+}
+
+// list returns the recorded exchanges newest first.
+func (rec *exchangeRecorder) list() []*exchange {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	out := make([]*exchange, 0, len(rec.ring))
+	for i := 1; i <= len(rec.ring); i++ {
+		if e := rec.ring[(rec.next-i+len(rec.ring))%len(rec.ring)]; e != nil {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func (rec *exchangeRecorder) clear() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.ring = make([]*exchange, len(rec.ring))
+	rec.next = 0
+}
+
+// recordedPath reports whether requests to path are recorded: API calls and
+// logins, except reads of the recordings themselves. Pages, assets and
+// WebSocket connections are not.
+func recordedPath(r *http.Request) bool {
+	path := strings.TrimPrefix(r.URL.Path, "/charioteer")
+	if strings.HasPrefix(path, "/api/admin/recordings") || strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	return strings.HasPrefix(path, "/api/") || path == "/login" || path == "/logout"
+}
+
+// recordExchanges records the API requests passing through it while
+// recording mode is on.
+func recordExchanges(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if recorder == nil || !recordedPath(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		e := &exchange{
+			Time:           time.Now(),
+			Method:         r.Method,
+			URL:            redactURL(r.URL),
+			RequestHeaders: redactHeaders(r.Header),
+			Backend:        []backendCall{},
+		}
+		if env := environmentFor(r); env != nil {
+			e.Environment = env.Name
+		}
+		if r.Body != nil && r.Body != http.NoBody {
+			// Keep the start of the body and hand the handler all of it
+			head, _ := io.ReadAll(io.LimitReader(r.Body, recordBodyLimit+1))
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+			e.RequestBody, e.Truncated = recordedBody(head, r.Header.Get("Content-Type"))
+		}
+		rw := &recordWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), contextKey("exchange"), e)))
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.DurationMS = msSince(e.Time)
+		e.Status = rw.status
+		e.ResponseHeaders = redactHeaders(w.Header())
+		body := rw.body.Bytes()
+		if enc := w.Header().Get("Content-Encoding"); enc != "" {
+			// The body was compressed on its way out; decode what was kept
+			resp := &http.Response{Header: http.Header{"Content-Encoding": {enc}}, Body: io.NopCloser(bytes.NewReader(body))}
+			body = nil
+			if decodeBackendBody(resp) == nil {
+				body, _ = io.ReadAll(io.LimitReader(resp.Body, recordBodyLimit+1))
+			}
+		}
+		var truncated bool
+		e.ResponseBody, truncated = recordedBody(body, w.Header().Get("Content-Type"))
+		e.Truncated = e.Truncated || truncated || rw.truncated
+		recorder.add(e)
+	})
+}
+
+// noteBackendCall adds a backend request to the exchange being recorded in
+// ctx, if any.
+func noteBackendCall(ctx context.Context, method, target string, status int, err error, started time.Time) {
+	e, ok := ctx.Value(contextKey("exchange")).(*exchange)
+	if !ok {
+		return
+	}
+	call := backendCall{Method: method, URL: target, Status: status, DurationMS: msSince(started)}
+	if u, perr := url.Parse(target); perr == nil {
+		call.URL = redactURL(u)
+	}
+	if err != nil {
+		call.Error = err.Error()
+	}
+	e.mu.Lock()
+	e.Backend = append(e.Backend, call)
+	e.mu.Unlock()
+}
+
+// doRecorded sends a backend request made outside doBackend, noting it on
+// the exchange being recorded in ctx.
+func doRecorded(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	started := time.Now()
+	resp, err := client.Do(req)
+	status := 0
+	if err == nil {
+		status = resp.StatusCode
+	}
+	noteBackendCall(ctx, req.Method, req.URL.String(), status, err, started)
+	return resp, err
+}
+
+func msSince(t time.Time) float64 {
+	return float64(time.Since(t).Microseconds()) / 1000
+}
+
+// readCloser pairs a reader with the closer of the body it reads.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// recordWriter keeps the start of a response as it is written.
+type recordWriter struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	truncated   bool
+	wroteHeader bool
+}
+
+func (rw *recordWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status, rw.wroteHeader = status, true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordWriter) Write(p []byte) (int, error) {
+	rw.wroteHeader = true
+	if room := recordBodyLimit + 1 - rw.body.Len(); room > 0 {
+		rw.body.Write(p[:min(len(p), room)])
+	} else {
+		rw.truncated = true
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+// Flush passes flushes through so event streams keep streaming.
+func (rw *recordWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *recordWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func (rw *recordWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := rw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// secretName matches header, query and JSON field names whose values are
+// credentials.
+var secretName = regexp.MustCompile(`(?i)(authorization|cookie|password|passwd|secret|token|api[_-]?key|credential|private[_-]?key|^otp$|^totp$)`)
+
+// secretField matches "name": "value" pairs with a secret name in JSON text,
+// including text cut off mid-document.
+var secretField = regexp.MustCompile(`(?i)("[^"]*(?:password|passwd|secret|token|api[_-]?key|credential|private[_-]?key|otp)[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+
+// bearerToken matches JWTs and bearer credentials wherever they appear.
+var bearerToken = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+|eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		value := strings.Join(values, ", ")
+		switch {
+		case strings.EqualFold(name, "Authorization"):
+			scheme, _, _ := strings.Cut(value, " ")
+			value = scheme + " " + redacted
+		case strings.EqualFold(name, "Idempotency-Key"):
+		case secretName.MatchString(name):
+			value = redacted
+		}
+		out[name] = value
+	}
+	return out
+}
+
+func redactURL(u *url.URL) string {
+	c := *u
+	q := c.Query()
+	for name := range q {
+		if secretName.MatchString(name) {
+			q.Set(name, redacted)
+		}
+	}
+	c.RawQuery = q.Encode()
+	c.User = nil
+	return c.String()
+}
+
+// recordedBody redacts the kept start of a body, reporting whether the
+// body was longer. Binary bodies are summarized.
+func recordedBody(body []byte, contentType string) (string, bool) {
+	truncated := len(body) > recordBodyLimit
+	if truncated {
+		body = body[:recordBodyLimit]
+	}
+	if len(body) == 0 {
+		return "", truncated
+	}
+	if ct := strings.ToLower(contentType); ct != "" && !strings.Contains(ct, "json") && !strings.HasPrefix(ct, "text/") && !strings.Contains(ct, "form") {
+		return "[" + strconv.Itoa(len(body)) + " bytes of " + contentType + "]", truncated
+	}
+	if strings.Contains(strings.ToLower(contentType), "form") {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			for name := range values {
+				if secretName.MatchString(name) {
+					values.Set(name, redacted)
+				}
+			}
+			return values.Encode(), truncated
+		}
+	}
+	text := secretField.ReplaceAllString(string(body), `$1"`+redacted+`"`)
+	text = bearerToken.ReplaceAllStringFunc(text, func(m string) string {
+		if sub := bearerToken.FindStringSubmatch(m); sub[1] != "" {
+			return sub[1] + redacted
+		}
+		return redacted
+	})
+	return text, truncated
+}
+
+// recordingsHandler lists the recorded exchanges newest first (GET), or
+// empties the buffer (DELETE). ?errors=true keeps exchanges answered with
+// an error status or with a failed backend call, ?path= those whose path
+// contains the text, and ?limit= caps the count.
+func recordingsHandler(w http.ResponseWriter, r *http.Request) {
+	if recorder == nil {
+		sendError(w, http.StatusNotFound, "recording is off; start charioteer with -record=N")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		recorder.clear()
+		sendSuccess(w, "recordings cleared")
+		return
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	params := r.URL.Query()
+	errorsOnly := params.Get("errors") == "true"
+	pathFilter := params.Get("path")
+	limit := 0
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			sendError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = n
+	}
+	out := []json.RawMessage{}
+	for _, e := range recorder.list() {
+		e.mu.Lock()
+		keep := (!errorsOnly || e.failed()) && (pathFilter == "" || strings.Contains(e.URL, pathFilter))
+		var data []byte
+		if keep {
+			data, _ = json.Marshal(e)
+		}
+		e.mu.Unlock()
+		if keep {
+			out = append(out, data)
+			if limit > 0 && len(out) == limit {
+				break
+			}
+		}
+	}
+	sendSuccess(w, out)
+}
+
+// failed reports whether the exchange ended in an error status or one of
+// its backend calls failed.
+func (e *exchange) failed() bool {
+	if e.Status >= 400 {
+		return true
+	}
+	for _, c := range e.Backend {
+		if c.Error != "" || c.Status >= 500 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// retryRoute is a group of routes sharing a retry budget: the group may
+// retry at most Budget backend requests a minute, so a backend that stays
+// down sees a bounded number of extra requests rather than every request
+// repeated. Paths are prefixes given without the /charioteer prefix;
+// requests matching no group use the "default" budget.
+type retryRoute struct {
+	Name   string
+	Budget int
+	Paths  []string
+}
+
+// retryRoutes lists the retry budget groups, most specific first.
+var retryRoutes = []retryRoute{
+	{Name: "execute", Budget: 30, Paths: []string{"/api/execute", "/api/execute-async", "/api/result", "/api/logs"}},
+	{Name: "listeners", Budget: 30, Paths: []string{"/api/listeners"}},
+	{Name: "default", Budget: 120},
+}
+
+var (
+	retriesFlag      = flag.Int("retries", -1, "Times a failed idempotent backend request is retried (default 2, 0 disables)")
+	retryBackoffFlag = flag.Duration("retry-backoff", 0, "Base delay before a retry, doubled for each further retry and jittered (default 200ms)")
+	retryBudgetsFlag = flag.String("retry-budgets", "", "Backend retries allowed per minute per route group, e.g. execute=30,listeners=30,default=120")
+)
+
+// retryCountHeader reports on a response how many times charioteer retried
+// the backend request behind it.
+const retryCountHeader = "X-Retry-Count"
+
+// getRetries returns the retry count from flag, environment variable, or default
+func getRetries() int {
+	if *retriesFlag >= 0 {
+		return *retriesFlag
+	}
+	if env := os.Getenv("CHARIOT_RETRIES"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return 2
+}
+
+// getRetryBackoff returns the base retry delay from flag, environment variable, or default
+func getRetryBackoff() time.Duration {
+	if *retryBackoffFlag > 0 {
+		return *retryBackoffFlag
+	}
+	if env := os.Getenv("CHARIOT_RETRY_BACKOFF"); env != "" {
+		if d, err := time.ParseDuration(env); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 200 * time.Millisecond
+}
+
+// retryBudget is a token bucket holding up to a minute's worth of retries
+// and refilling at the group's rate.
+type retryBudget struct {
+	mu       sync.Mutex
+	perMin   int
+	tokens   float64
+	refilled time.Time
+}
+
+var retryBudgets = map[string]*retryBudget{}
+
+// loadRetryBudgets applies -retry-budgets, then CHARIOT_RETRY_BUDGETS, over
+// the defaults in retryRoutes. A budget of 0 turns retries off for a group;
+// an unknown group name stops startup.
+func loadRetryBudgets() {
+	spec := *retryBudgetsFlag
+	if spec == "" {
+		spec = os.Getenv("CHARIOT_RETRY_BUDGETS")
+	}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		budget, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || budget < 0 {
+			log.Fatalf("invalid retry budget for %s: %q", name, value)
+		}
+		found := false
+		for i := range retryRoutes {
+			if retryRoutes[i].Name == name {
+				retryRoutes[i].Budget, found = budget, true
+			}
+		}
+		if !found {
+			log.Fatalf("unknown retry budget group %q", name)
+		}
+	}
+	for _, route := range retryRoutes {
+		retryBudgets[route.Name] = &retryBudget{perMin: route.Budget, tokens: float64(route.Budget), refilled: time.Now()}
+	}
+	if n := getRetries(); n > 0 {
+		log.Printf("Retrying idempotent backend requests up to %d times (backoff %s)", n, getRetryBackoff())
+	}
+}
+
+// retryRouteFor returns the budget group of a request path.
+func retryRouteFor(path string) retryRoute {
+	for _, route := range retryRoutes {
+		if len(route.Paths) == 0 || matchesPrefix(path, route.Paths) {
+			return route
+		}
+	}
+	return retryRoutes[len(retryRoutes)-1]
+}
+
+// take spends one retry from the budget, reporting whether there was one.
+func (b *retryBudget) take() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.refilled).Minutes() * float64(b.perMin)
+	if b.tokens > float64(b.perMin) {
+		b.tokens = float64(b.perMin)
+	}
+	b.refilled = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// idempotentRequest reports whether a backend request may be sent again:
+// its method is idempotent, or the client gave it an Idempotency-Key the
+// backend deduplicates on.
+func idempotentRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// retryableStatus reports whether a response means the backend, or a proxy
+// in front of it, was briefly unavailable.
+func retryableStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// retryDelay returns the wait before retry n (1-based): a random duration
+// up to the base backoff doubled n-1 times, so clients retrying together
+// spread out.
+func retryDelay(n int) time.Duration {
+	ceiling := getRetryBackoff() << (n - 1)
+	if ceiling <= 0 || ceiling > 10*time.Second {
+		ceiling = 10 * time.Second
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)) + 1)
+}
+
+// sleepRetry waits out the delay before retry n, returning false when the
+// client goes away first.
+func sleepRetry(r *http.Request, n int) bool {
+	timer := time.NewTimer(retryDelay(n))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// exposeRetries lets doBackend report its retries on the response of the
+// request it serves, by handing it the response headers before the handler
+// writes them.
+func exposeRetries(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey("responseHeader"), w.Header())))
+	})
+}
+
+// reportRetries sets the retry count header on the response to r.
+func reportRetries(r *http.Request, retries int) {
+	if header, ok := r.Context().Value(contextKey("responseHeader")).(http.Header); ok {
+		header.Set(retryCountHeader, strconv.Itoa(retries))
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Routes are registered through a router instead of on the mux directly.
+// Each route is annotated with what it needs: a valid token, session roles,
+// a per-user rate limit, a body limit, and any further middleware. The
+// router turns the annotations into a middleware chain around the handler
+// and registers the route under /charioteer as well when asked. A new
+// cross-cutting check is a middleware or an annotation here rather than an
+// edit to every handler.
+//
+// Patterns are those of http.ServeMux: an optional method, and named path
+// parameters read with r.PathValue, as in "GET /api/traces/{name}". A
+// request whose path matches a route but whose method matches none is
+// answered with a JSON 405 and an Allow header listing the methods that do.
+
+var loginRateFlag = flag.Int("login-rate", -1, "Login attempts allowed per minute per client address (default 20, 0 unlimited)")
+
+// getLoginRate returns the login rate limit from flag, environment variable, or default
+func getLoginRate() int {
+	if *loginRateFlag >= 0 {
+		return *loginRateFlag
+	}
+	if env := os.Getenv("CHARIOT_LOGIN_RATE"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return 20
+}
+
+// middleware wraps a handler with a check or a side effect.
+type middleware func(http.HandlerFunc) http.HandlerFunc
+
+// routeSpec is a route and its annotations.
+type routeSpec struct {
+	Pattern   string       // mux pattern, with the method if any, without the /charioteer prefix
+	Auth      bool         // requires a valid token
+	Roles     []string     // session roles of which the caller needs one
+	RateLimit int          // requests per minute per user (per client address without auth); 0 unlimited
+	BodyLimit int64        // request body limit replacing the route group's; 0 keeps it
+	Prefixed  bool         // also served under /charioteer
+	Chain     []middleware // further middleware, outermost first, inside the checks above
+}
+
+// routeOption annotates a route.
+type routeOption func(*routeSpec)
+
+// authRequired makes a route refuse requests without a valid token.
+func authRequired() routeOption {
+	return func(s *routeSpec) { s.Auth = true }
+}
+
+// requireRoles lets through only callers holding one of roles; it implies
+// authRequired.
+func requireRoles(roles ...string) routeOption {
+	return func(s *routeSpec) { s.Auth, s.Roles = true, roles }
+}
+
+// rateLimit caps each user at perMin requests a minute to the route.
+func rateLimit(perMin int) routeOption {
+	return func(s *routeSpec) { s.RateLimit = perMin }
+}
+
+// bodyLimit caps request bodies to the route at n bytes.
+func bodyLimit(n int64) routeOption {
+	return func(s *routeSpec) { s.BodyLimit = n }
+}
+
+// withPrefix serves a route under /charioteer as well.
+func withPrefix() routeOption {
+	return func(s *routeSpec) { s.Prefixed = true }
+}
+
+// with appends middleware to a route's chain.
+func with(mw ...middleware) routeOption {
+	return func(s *routeSpec) { s.Chain = append(s.Chain, mw...) }
+}
+
+// allowMethods answers 405 to requests with other methods.
+func allowMethods(methods ...string) middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			for _, m := range methods {
+				if r.Method == m {
+					next(w, r)
+					return
+				}
+			}
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// router registers annotated routes on a mux.
+type router struct {
+	mux        *http.ServeMux
+	defaults   []routeOption    // annotations of every route, before its own
+	bodyLimits map[string]int64 // body limits of the routes that have their own, by registered pattern
+}
+
+func newRouter(mux *http.ServeMux) *router {
+	return &router{mux: mux, bodyLimits: map[string]int64{}}
+}
+
+// group returns a router on the same mux whose routes carry opts in
+// addition to this router's annotations.
+func (rt *router) group(opts ...routeOption) *router {
+	return &router{mux: rt.mux, defaults: append(append([]routeOption(nil), rt.defaults...), opts...), bodyLimits: rt.bodyLimits}
+}
+
+// ownBodyLimit reports whether the route r goes to has a body limit of its
+// own, which its chain applies in place of the route group's.
+func (rt *router) ownBodyLimit(r *http.Request) bool {
+	_, pattern := rt.mux.Handler(r)
+	_, ok := rt.bodyLimits[pattern]
+	return ok
+}
+
+// routeMethods are the methods a request is tried with to tell a 405 from a
+// 404.
+var routeMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+
+// ServeHTTP dispatches to the matching route, answering 405 in the API's
+// JSON form where the mux would answer in plain text.
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, pattern := rt.mux.Handler(r); pattern == "" {
+		var allowed []string
+		for _, method := range routeMethods {
+			if method == r.Method {
+				continue
+			}
+			probe := r.Clone(r.Context())
+			probe.Method = method
+			if _, p := rt.mux.Handler(probe); p != "" {
+				allowed = append(allowed, method)
+			}
+		}
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+	}
+	rt.mux.ServeHTTP(w, r)
+}
+
+// handle registers h for pattern with the router's and the route's
+// annotations.
+func (rt *router) handle(pattern string, h http.HandlerFunc, opts ...routeOption) {
+	spec := routeSpec{Pattern: pattern}
+	method, path := "", pattern
+	if m, p, ok := strings.Cut(pattern, " "); ok {
+		method, path = m+" ", p
+	}
+	for _, opt := range append(append([]routeOption(nil), rt.defaults...), opts...) {
+		opt(&spec)
+	}
+	// The chain runs outermost to innermost: body limit, authentication,
+	// roles, rate limit, then the route's own middleware
+	for i := len(spec.Chain) - 1; i >= 0; i-- {
+		h = spec.Chain[i](h)
+	}
+	if spec.RateLimit > 0 {
+		h = limitRate(spec.Pattern, spec.RateLimit)(h)
+	}
+	if len(spec.Roles) > 0 {
+		h = requireRole(spec.Roles)(h)
+	}
+	if spec.Auth {
+		h = authMiddleware(h)
+	}
+	if spec.BodyLimit > 0 {
+		h = capBody(strings.TrimPrefix(path, "/charioteer"), spec.BodyLimit)(h)
+		rt.bodyLimits[pattern] = spec.BodyLimit
+		if spec.Prefixed {
+			rt.bodyLimits[method+"/charioteer"+path] = spec.BodyLimit
+		}
+	}
+	rt.mux.HandleFunc(pattern, h)
+	if spec.Prefixed {
+		rt.mux.HandleFunc(method+"/charioteer"+path, h)
+	}
+}
+
+// requireRole lets through callers whose session holds one of roles and
+// answers 403 to the others.
+func requireRole(roles []string) middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			id, err := validateToken(r, requestToken(r))
+			if err != nil {
+				sendTokenError(w, err)
+				return
+			}
+			for _, role := range roles {
+				if id.hasRole(role) {
+					next(w, r)
+					return
+				}
+			}
+			if len(roles) == 1 && roles[0] == "admin" {
+				sendError(w, http.StatusForbidden, "admins only")
+				return
+			}
+			sendError(w, http.StatusForbidden, "requires role "+strings.Join(roles, " or "))
+		}
+	}
+}
+
+// rateBuckets holds a token bucket per route and caller, refilled at the
+// route's rate like the retry budgets.
+var rateBuckets = struct {
+	mu      sync.Mutex
+	buckets map[string]*retryBudget
+	swept   time.Time
+}{buckets: map[string]*retryBudget{}}
+
+// limitRate answers 429 to a caller over perMin requests a minute to route.
+// Callers are told apart by user, or by client address on routes without
+// authentication.
+func limitRate(route string, perMin int) middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			caller := ""
+			if token := requestToken(r); token != "" {
+				if id, err := validateToken(r, token); err == nil && id.User != "" {
+					caller = "user:" + id.User
+				}
+			}
+			if caller == "" {
+				host, _, err := net.SplitHostPort(r.RemoteAddr)
+				if err != nil {
+					host = r.RemoteAddr
+				}
+				caller = "addr:" + host
+			}
+			if !takeRate(route+" "+caller, perMin) {
+				w.Header().Set("Retry-After", strconv.Itoa(int((time.Minute/time.Duration(perMin)).Seconds())+1))
+				sendError(w, http.StatusTooManyRequests, fmt.Sprintf("rate limit of %d requests a minute exceeded", perMin))
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// takeRate spends one request from the caller's bucket, reporting whether
+// there was one.
+func takeRate(key string, perMin int) bool {
+	now := time.Now()
+	rateBuckets.mu.Lock()
+	bucket := rateBuckets.buckets[key]
+	if bucket == nil {
+		bucket = &retryBudget{perMin: perMin, tokens: float64(perMin), refilled: now}
+		rateBuckets.buckets[key] = bucket
+	}
+	if now.Sub(rateBuckets.swept) > time.Minute {
+		// A bucket untouched for a minute is full again; drop it
+		rateBuckets.swept = now
+		for k, b := range rateBuckets.buckets {
+			b.mu.Lock()
+			idle := now.Sub(b.refilled) > time.Minute
+			b.mu.Unlock()
+			if idle && b != bucket {
+				delete(rateBuckets.buckets, k)
+			}
+		}
+	}
+	rateBuckets.mu.Unlock()
+	return bucket.take()
+}
@@ -0,0 +1,121 @@
+        const BACKEND_URL = '{{.BackendURL}}';
+        let refreshInterval;
+        let authToken = null;
+
+        // Extract token from URL parameter
+        function getTokenFromURL() {
+            const urlParams = new URLSearchParams(window.location.search);
+            return urlParams.get('token');
+        }
+
+        // Initialize auth token
+        authToken = getTokenFromURL();
+
+        async function fetchDashboardData() {
+            try {
+                const headers = {
+                    'Content-Type': 'application/json'
+                };
+                
+                // Add authorization header if we have a token
+                if (authToken) {
+                    headers['Authorization'] = authToken;
+                }
+
+                const response = await fetch('/charioteer/api/dashboard/status', {
+                    method: 'GET',
+                    headers: headers
+                });
+
+                if (!response.ok) {
+                    throw new Error('Failed to fetch dashboard data: ' + response.statusText);
+                }
+
+                const result = await response.json();
+                if (result.result !== 'OK') {
+                    throw new Error('Dashboard API error: ' + (result.data || 'Unknown error'));
+                }
+
+                return result.data;
+            } catch (error) {
+                console.error('Error fetching dashboard data:', error);
+                throw error;
+            }
+        }
+
+        function updateDashboard(data) {
+            // Update metrics
+            document.getElementById('activeSessions').textContent = data.activeSessions || 0;
+            document.getElementById('totalSessions').textContent = data.totalSessions || 0;
+            document.getElementById('uptime').textContent = data.uptime || 'Unknown';
+            document.getElementById('systemStatus').textContent = data.systemStatus || 'Unknown';
+
+            // Update sessions table
+            const tbody = document.getElementById('sessionsTableBody');
+            tbody.innerHTML = '';
+
+            if (data.sessions && data.sessions.length > 0) {
+                data.sessions.forEach(session => {
+                    const row = document.createElement('tr');
+                    row.innerHTML = '<td>' + escapeHtml(session.username || 'Unknown') + '</td>' +
+                                   '<td>' + escapeHtml(session.sessionId ? session.sessionId.substring(0, 8) + '...' : 'Unknown') + '</td>' +
+                                   '<td>' + escapeHtml(session.created || 'Unknown') + '</td>' +
+                                   '<td>' + escapeHtml(session.lastAccess || 'Unknown') + '</td>' +
+                                   '<td class="' + (session.active ? 'status-active' : 'status-expired') + '">' + 
+                                   (session.active ? 'Active' : 'Expired') + '</td>';
+                    tbody.appendChild(row);
+                });
+            } else {
+                const row = document.createElement('tr');
+                row.innerHTML = '<td colspan="5" style="text-align: center;">No sessions found</td>';
+                tbody.appendChild(row);
+            }
+        }
+
+        function escapeHtml(text) {
+            const div = document.createElement('div');
+            div.textContent = text;
+            return div.innerHTML;
+        }
+
+        function showError(message) {
+            const errorDiv = document.getElementById('errorMessage');
+            errorDiv.textContent = message;
+            errorDiv.style.display = 'block';
+            document.getElementById('loading').style.display = 'none';
+            document.getElementById('dashboardContent').style.display = 'none';
+        }
+
+        function hideError() {
+            document.getElementById('errorMessage').style.display = 'none';
+        }
+
+        async function refreshDashboard() {
+            try {
+                hideError();
+                document.getElementById('loading').style.display = 'block';
+                document.getElementById('dashboardContent').style.display = 'none';
+
+                const data = await fetchDashboardData();
+                updateDashboard(data);
+
+                document.getElementById('loading').style.display = 'none';
+                document.getElementById('dashboardContent').style.display = 'block';
+            } catch (error) {
+                showError('Failed to load dashboard data: ' + error.message);
+            }
+        }
+
+        // Initialize dashboard
+        document.addEventListener('DOMContentLoaded', function() {
+            refreshDashboard();
+            // Refresh every 30 seconds
+            refreshInterval = setInterval(refreshDashboard, 30000);
+        });
+
+        // Cleanup interval when page unloads
+        window.addEventListener('beforeunload', function() {
+            if (refreshInterval) {
+                clearInterval(refreshInterval);
+            }
+        });
@@ -0,0 +1,388 @@
+        async function login() {
+            console.log('DEBUG: Login function called');
+            const username = document.getElementById('usernameInput').value.trim();
+            const password = document.getElementById('passwordInput').value;
+            
+            console.log('DEBUG: Username:', username, 'Password length:', password.length);
+            
+            if (!username || !password) {
+                showOutput('Please enter both username and password', 'error');
+                return;
+            }
+            
+            const loginButton = document.getElementById('loginButton');
+            loginButton.disabled = true;
+            loginButton.textContent = 'Logging in...';
+            
+            try {
+                // The server may ask for a one-time code or a new password;
+                // prompt for it and try again
+                const credentials = { username: username, password: password };
+                let response, result;
+                for (;;) {
+                    response = await fetch(getAPIPath('/login'), {
+                        method: 'POST',
+                        headers: {
+                            'Content-Type': 'application/json'
+                        },
+                        body: JSON.stringify(credentials)
+                    });
+                    result = await response.json();
+                    const need = result && result.result === 'ERROR' && result.data && typeof result.data === 'object' ? result.data : null;
+                    if (need && need.password_expired && !credentials.new_password) {
+                        const next = prompt('Your password has expired. Choose a new password:');
+                        if (!next) break;
+                        if (prompt('Repeat the new password:') !== next) {
+                            showOutput('Login failed: the new passwords do not match', 'error');
+                            return;
+                        }
+                        credentials.new_password = next;
+                        continue;
+                    }
+                    if (need && need.mfa_required && !credentials.otp) {
+                        const code = prompt('Enter the code from your authenticator app (or a recovery code):');
+                        if (!code) break;
+                        credentials.otp = code.trim();
+                        continue;
+                    }
+                    break;
+                }
+                if (response.ok && result.result === "OK" && result.data && result.data.token) {
+                    authToken = result.data.token;
+                    sessionId = authToken; // Use token as session ID for debug API
+                    currentUser = username;
+
+                    // Save to localStorage
+                    localStorage.setItem(CHARIOTEER_CONFIG.tokenKey, authToken);
+                    localStorage.setItem('chariot_user', currentUser);
+
+                    // Start session management, timed to the token's real lifetime when known
+                    startSessionManagement(result.data.expires_in, !!result.data.refresh_token);
+                    
+                    updateAuthUI(true);
+                    await fetchSessionProfile({ syncFileScope: true });
+                    await fetchBuiltins();
+                    const functionNames = await fetchUserFunctions();
+                    setChariotTokenizer(functionNames);
+                    updateLeftPanel();
+                    
+                    // Clear password field
+                    document.getElementById('passwordInput').value = '';
+                } else {
+                    let errorMsg = result.result === "ERROR" ? result.data : 'Invalid credentials';
+                    if (errorMsg && typeof errorMsg === 'object') errorMsg = errorMsg.error;
+                    showOutput('Login failed: ' + errorMsg, 'error');
+                }
+            } catch (error) {
+                showOutput('Login error: ' + error.message, 'error');
+            } finally {
+                loginButton.disabled = false;
+                loginButton.textContent = 'Login';
+            }
+        }
+        
+        // Logout functionality
+        function logout() {
+            console.log('DEBUG: Logout function called');
+            collabDisconnect();
+
+            clearBreakpointsOnServer(null, { clearAll: true });
+            
+            // Close debug WebSocket
+            if (debugSocket) {
+                debugSocket.close();
+                debugSocket = null;
+            }
+            
+            // Reset debug state
+            updateDebugStatus('stopped', 'Stopped');
+            breakpoints.clear();
+            currentDebugLine = null;
+            renderBreakpoints();
+            renderCallStack([]);
+            renderVariables({});
+            updateEditorBreakpoints();
+            ensureDebugSocketConnected();
+            
+            // Clear session timers
+            clearSessionTimers();
+            
+            // Close any open warning dialog
+            closeSessionWarning();
+
+            // Drop the console connection; it was opened with the old token
+            closeConsole();
+            
+            authToken = null;
+            sessionId = null;
+            currentUser = null;
+            debuggerSessionReady = false;
+            resetSandboxProfile();
+            
+            // Clear localStorage
+            localStorage.removeItem(CHARIOTEER_CONFIG.tokenKey);
+            localStorage.removeItem(CHARIOTEER_CONFIG.tokenKey + '_expires');
+            localStorage.removeItem('chariot_user');
+            
+            // Clear editor and file list
+            if (editor) {
+                editor.setValue('');
+            }
+            currentFileName = '';
+            
+            const fileSelect = document.getElementById('fileSelect');
+            fileSelect.innerHTML = '<option value="">Select a file...</option>';
+            
+            updateAuthUI(false);
+        }
+
+        // Session management functions. With expiresIn (seconds, from a login or
+        // refresh response) the timers follow the token's real lifetime; a
+        // reload picks the stored expiry of a refreshable token back up, and
+        // otherwise the configured session length is used, extended on
+        // activity. When the backend issued a refresh token, an active user is
+        // refreshed shortly before expiry and only an idle one sees the warning.
+        function startSessionManagement(expiresIn, canRefresh) {
+            console.log('DEBUG: Starting session management');
+            
+            // Clear any existing timers
+            clearSessionTimers();
+            
+            const now = Date.now();
+            const expiresKey = CHARIOTEER_CONFIG.tokenKey + '_expires';
+            let stored = null;
+            try { stored = JSON.parse(localStorage.getItem(expiresKey) || 'null'); } catch (e) { stored = null; }
+            if (expiresIn > 0) {
+                sessionExpiresAt = now + expiresIn * 1000;
+                sessionCanRefresh = !!canRefresh;
+                sessionIssuedAt = now;
+                if (sessionCanRefresh) {
+                    localStorage.setItem(expiresKey, JSON.stringify({ at: sessionExpiresAt, refresh: true, issued: now }));
+                } else {
+                    localStorage.removeItem(expiresKey);
+                }
+            } else if (stored && stored.refresh && stored.at <= now) {
+                // The token expired while the page was closed
+                sessionCanRefresh = true;
+                refreshAccessToken();
+                return;
+            } else if (stored && stored.refresh) {
+                sessionExpiresAt = stored.at;
+                sessionCanRefresh = !!stored.refresh;
+                sessionIssuedAt = stored.issued || now;
+            } else {
+                sessionExpiresAt = now + SESSION_DURATION_MINUTES * 60 * 1000;
+                sessionCanRefresh = false;
+                sessionIssuedAt = now;
+                localStorage.removeItem(expiresKey);
+            }
+            
+            const remainingMs = sessionExpiresAt - now;
+            // Short tokens are refreshed halfway through instead of minutes before expiry
+            const leadMs = Math.min(WARNING_BEFORE_MINUTES * 60 * 1000, (sessionExpiresAt - sessionIssuedAt) / 2);
+            const warningTimeMs = Math.max(0, remainingMs - leadMs);
+            const logoutTimeMs = Math.max(0, remainingMs - (LOGOUT_BEFORE_SECONDS * 1000));
+            
+            console.log('DEBUG: Session timers set - Warning in:', warningTimeMs, 'ms, Logout in:', logoutTimeMs, 'ms');
+            
+            // Set warning timer
+            warningTimer = setTimeout(() => {
+                if (sessionCanRefresh && lastActivityAt > sessionIssuedAt) {
+                    refreshAccessToken();
+                } else {
+                    showSessionWarning();
+                }
+            }, warningTimeMs);
+            
+            // Set logout timer
+            logoutTimer = setTimeout(() => {
+                showOutput('Session expired. You have been logged out.', 'error');
+                logout();
+            }, logoutTimeMs);
+        }
+
+        // refreshAccessToken exchanges the refresh token, kept by charioteer in
+        // an HttpOnly cookie, for a new access token, and moves the open
+        // WebSockets over to it. It resolves to whether the refresh worked;
+        // a failed one logs the user out.
+        function refreshAccessToken() {
+            if (tokenRefreshInFlight) return tokenRefreshInFlight;
+            tokenRefreshInFlight = (async () => {
+                try {
+                    const response = await fetch(getAPIPath('/api/token/refresh'), {
+                        method: 'POST',
+                        headers: { 'Content-Type': 'application/json' },
+                        credentials: 'same-origin',
+                        body: '{}'
+                    });
+                    const result = await response.json().catch(() => ({}));
+                    if (!response.ok || result.result !== 'OK' || !result.data || !result.data.token) {
+                        throw new Error((result && result.data) || ('HTTP ' + response.status));
+                    }
+                    authToken = result.data.token;
+                    sessionId = authToken;
+                    localStorage.setItem(CHARIOTEER_CONFIG.tokenKey, authToken);
+                    closeSessionWarning();
+                    startSessionManagement(result.data.expires_in, !!result.data.refresh_token);
+                    reauthSockets(authToken);
+                    console.log('DEBUG: Access token refreshed');
+                    return true;
+                } catch (error) {
+                    console.warn('Token refresh failed', error);
+                    if (authToken) {
+                        showOutput('Session expired. You have been logged out.', 'error');
+                        logout();
+                    }
+                    return false;
+                } finally {
+                    tokenRefreshInFlight = null;
+                }
+            })();
+            return tokenRefreshInFlight;
+        }
+
+        // reauthSockets hands a refreshed token to the open WebSockets, which
+        // charioteer would otherwise close when the old token expires.
+        function reauthSockets(token) {
+            const sockets = [consoleWS, collabSession && collabSession.ws, agentsWS, dashboardWS];
+            sockets.forEach(ws => {
+                if (ws && ws.readyState === 1) {
+                    try { ws.send(JSON.stringify({ type: 'reauth', token: token })); } catch (e) { /* closes on expiry */ }
+                }
+            });
+        }
+
+        function clearSessionTimers() {
+            if (warningTimer) {
+                clearTimeout(warningTimer);
+                warningTimer = null;
+            }
+            if (logoutTimer) {
+                clearTimeout(logoutTimer);
+                logoutTimer = null;
+            }
+            if (sessionTimer) {
+                clearTimeout(sessionTimer);
+                sessionTimer = null;
+            }
+        }
+
+        function showSessionWarning() {
+            if (sessionWarningShown) return;
+            
+            console.log('DEBUG: Showing session warning');
+            sessionWarningShown = true;
+            
+            // Create modal HTML
+            const modal = document.createElement('div');
+            modal.className = 'session-warning-modal';
+            modal.innerHTML = '' +
+                '<div class="session-warning-dialog">' +
+                    '<div class="session-warning-title">' +
+                        '⚠️ Session Expiring Soon' +
+                    '</div>' +
+                    '<div class="session-warning-message">' +
+                        'Your session will expire in approximately <strong>' + Math.max(1, Math.round((sessionExpiresAt - Date.now()) / 60000)) + ' minutes</strong>. ' +
+                        'If you don\'t extend your session, you will be automatically logged out in 30 seconds.' +
+                    '</div>' +
+                    '<div class="session-warning-countdown" id="sessionCountdown">' +
+                        'Time remaining: <span id="countdownTime">03:00</span>' +
+                    '</div>' +
+                    '<div class="session-warning-buttons">' +
+                        '<button class="session-warning-button extend" id="extendSessionButton">' +
+                            'Extend Session' +
+                        '</button>' +
+                        '<button class="session-warning-button logout" id="logoutNowButton">' +
+                            'Logout Now' +
+                        '</button>' +
+                    '</div>' +
+                '</div>';
+            
+            document.body.appendChild(modal);
+            
+            // Add event listeners
+            document.getElementById('extendSessionButton').addEventListener('click', () => {
+                extendSession();
+                closeSessionWarning();
+            });
+            
+            document.getElementById('logoutNowButton').addEventListener('click', () => {
+                closeSessionWarning();
+                logout();
+            });
+            
+            // Start countdown
+            startWarningCountdown();
+        }
+
+        function startWarningCountdown() {
+            const countdownElement = document.getElementById('countdownTime');
+            if (!countdownElement) return;
+            
+            let remainingSeconds = Math.max(0, Math.round((sessionExpiresAt - Date.now()) / 1000)); // until expiry
+            
+            const countdownInterval = setInterval(() => {
+                remainingSeconds--;
+                
+                if (remainingSeconds <= 0) {
+                    clearInterval(countdownInterval);
+                    return;
+                }
+                
+                const minutes = Math.floor(remainingSeconds / 60);
+                const seconds = remainingSeconds % 60;
+                const timeString = minutes.toString().padStart(2, '0') + ':' + seconds.toString().padStart(2, '0');
+                
+                countdownElement.textContent = timeString;
+                
+                // Change color when less than 1 minute remaining
+                if (remainingSeconds <= 60) {
+                    countdownElement.style.color = '#dc3545';
+                }
+            }, 1000);
+        }
+
+        function extendSession() {
+            console.log('DEBUG: Extending session');
+            if (sessionCanRefresh) {
+                refreshAccessToken().then(ok => {
+                    if (ok) showOutput('Session extended successfully', 'success');
+                });
+                return;
+            }
+            
+            // Clear existing timers
+            clearSessionTimers();
+            
+            // Restart session management
+            startSessionManagement();
+            
+            // Reset warning flag
+            sessionWarningShown = false;
+            
+            showOutput('Session extended successfully', 'success');
+        }
+
+        function extendSessionSilently() {
+            // Short-lived tokens are refreshed before expiry instead
+            if (sessionCanRefresh) return;
+            console.log('DEBUG: Silently extending session');
+            
+            // Clear existing timers
+            clearSessionTimers();
+            
+            // Restart session management
+            startSessionManagement();
+            
+            // Reset warning flag
+            sessionWarningShown = false;
+        }
+
+        function closeSessionWarning() {
+            const modal = document.querySelector('.session-warning-modal');
+            if (modal) {
+                document.body.removeChild(modal);
+            }
+            sessionWarningShown = false;
+        }
+
@@ -0,0 +1,316 @@
+        // ---- Collaborative editing ----
+        // A file open in the Files tab joins /ws/collab as a shared text document: local edits are sent as
+        // operations in the ot.js format (retain n > 0, delete n < 0, insert "text") against the last
+        // acknowledged version, one at a time, and concurrent remote operations are transformed against
+        // the unacknowledged ones. Diagrams join for presence and save notices only; concurrent diagram
+        // saves are merged server-side.
+        let collabSession = null;
+        let collabApplyingRemote = false;
+        const collabStyledColors = new Set();
+
+        function collabConnect(kind, scope, name, content) {
+            collabDisconnect();
+            if (kind === 'file') acquireFileLease(scope, name);
+            if (!featureEnabled('enable_collab')) return;
+            const token = (authToken || localStorage.getItem(CHARIOTEER_CONFIG.tokenKey) || '').trim();
+            if (!token || !name) return;
+            const proto = (window.location.protocol === 'https:') ? 'wss' : 'ws';
+            const basePath = window.location.pathname.startsWith('/charioteer/') ? '/charioteer' : '';
+            const doc = kind + ':' + (scope || 'global') + '/' + name;
+            const wsURL = proto + '://' + window.location.host + basePath + '/ws/collab?doc=' + encodeURIComponent(doc) + '&token=' + encodeURIComponent(token);
+            const session = { kind, name, ws: null, version: 0, pending: null, buffer: [], self: null, peers: [], ready: false, decorations: [] };
+            try {
+                session.ws = new WebSocket(wsURL);
+            } catch (e) {
+                console.warn('Collaboration unavailable:', e);
+                return;
+            }
+            collabSession = session;
+            session.ws.onopen = () => {
+                session.ws.send(JSON.stringify({ type: 'join', content: content === null ? undefined : content }));
+            };
+            session.ws.onmessage = (ev) => {
+                if (collabSession !== session) return;
+                let msg;
+                try { msg = JSON.parse(ev.data); } catch (_) { return; }
+                collabHandleMessage(session, msg);
+            };
+            session.ws.onclose = () => {
+                if (collabSession === session) {
+                    collabSession = null;
+                    renderCollabPresence(null);
+                }
+            };
+        }
+
+        function collabDisconnect() {
+            releaseFileLease();
+            const session = collabSession;
+            collabSession = null;
+            if (!session) return;
+            try { session.ws.close(); } catch (_) { /* ignore */ }
+            if (editor) session.decorations = editor.deltaDecorations(session.decorations, []);
+            renderCollabPresence(null);
+        }
+
+        // ---- File edit leases ----
+        // Opening a file takes an advisory lease on it. While another session holds the lease, the
+        // toolbar shows who has it and the server rejects our saves with 409. Leases end with the session.
+        let fileLease = null;
+
+        async function acquireFileLease(scope, name) {
+            const lease = { scope: scope || 'global', name, holder: null };
+            fileLease = lease;
+            renderFileLockStatus();
+            try {
+                const response = await fetch(getAPIPath('/api/file/lock?scope=' + encodeURIComponent(lease.scope)), {
+                    method: 'POST',
+                    headers: getAuthHeadersWithJSON(),
+                    body: JSON.stringify({ name })
+                });
+                if (fileLease !== lease) return;
+                if (response.status === 409) {
+                    const result = await response.json();
+                    lease.holder = (result.data && result.data.holder) || 'another user';
+                } else if (!response.ok) {
+                    fileLease = null;
+                }
+            } catch (e) {
+                console.warn('File lease unavailable:', e);
+                if (fileLease === lease) fileLease = null;
+            }
+            renderFileLockStatus();
+        }
+
+        function releaseFileLease() {
+            const lease = fileLease;
+            fileLease = null;
+            renderFileLockStatus();
+            if (!lease || lease.holder || !authToken) return;
+            fetch(getAPIPath('/api/file/lock?scope=' + encodeURIComponent(lease.scope) + '&name=' + encodeURIComponent(lease.name)), {
+                method: 'DELETE',
+                headers: getAuthHeaders()
+            }).catch(() => { /* the lease ends with the session anyway */ });
+        }
+
+        function renderFileLockStatus() {
+            const el = document.getElementById('fileLockStatus');
+            if (!el) return;
+            el.textContent = (fileLease && fileLease.holder) ? '🔒 Locked by ' + fileLease.holder : '';
+        }
+
+        // lockConflictMessage extracts the holder's name from a 409 save response body.
+        function lockConflictMessage(text) {
+            try {
+                const result = JSON.parse(text);
+                if (result.data && result.data.holder) {
+                    if (fileLease) {
+                        fileLease.holder = result.data.holder;
+                        renderFileLockStatus();
+                    }
+                    return 'file is locked by ' + result.data.holder;
+                }
+            } catch (_) { /* not JSON */ }
+            return text;
+        }
+
+        function collabNotifySaved() {
+            if (collabSession && collabSession.ready && collabSession.ws.readyState === WebSocket.OPEN) {
+                collabSession.ws.send(JSON.stringify({ type: 'saved' }));
+            }
+        }
+
+        function collabHandleMessage(session, msg) {
+            switch (msg.type) {
+                case 'snapshot':
+                    session.version = msg.version;
+                    session.pending = null;
+                    session.buffer = [];
+                    session.self = msg.self;
+                    session.peers = msg.peers || [];
+                    session.ready = true;
+                    if (session.kind === 'file' && editor && editor.getValue() !== msg.content) {
+                        collabApplyingRemote = true;
+                        try { editor.setValue(msg.content); } finally { collabApplyingRemote = false; }
+                        showProblem('Joined a live session for ' + session.name + '; showing collaborators\' unsaved edits.', 'info');
+                    }
+                    renderCollabPresence(session);
+                    break;
+                case 'ack':
+                    session.version = msg.version;
+                    session.pending = null;
+                    collabFlush(session);
+                    break;
+                case 'op': {
+                    let op = msg.op;
+                    if (session.pending) {
+                        const t = otTransform(session.pending, op);
+                        session.pending = t[0];
+                        op = t[1];
+                    }
+                    session.buffer = session.buffer.map(buffered => {
+                        const t = otTransform(buffered, op);
+                        op = t[1];
+                        return t[0];
+                    });
+                    session.version = msg.version;
+                    if (session.kind === 'file' && editor) {
+                        collabApplyingRemote = true;
+                        try { otApplyToModel(editor.getModel(), op); } finally { collabApplyingRemote = false; }
+                    }
+                    break;
+                }
+                case 'presence':
+                    session.peers = msg.peers || [];
+                    renderCollabPresence(session);
+                    break;
+                case 'cursor':
+                    session.peers = session.peers.map(p => p.id === msg.peer.id ? msg.peer : p);
+                    renderCollabPresence(session);
+                    break;
+                case 'saved':
+                    if (session.kind === 'file' && editor) {
+                        originalContent = editor.getValue();
+                        isFileModified = false;
+                        updateSaveButtonStates();
+                        showProblem((msg.user || 'A collaborator') + ' saved ' + session.name + '.', 'info');
+                    } else {
+                        showProblem((msg.user || 'A collaborator') + ' saved diagram ' + session.name + '; your next save is merged with their changes.', 'info');
+                    }
+                    break;
+                case 'error':
+                    console.warn('Collaboration error:', msg.message);
+                    break;
+            }
+        }
+
+        // Send the next buffered operation once the previous one is acknowledged
+        function collabFlush(session) {
+            if (session.pending || session.buffer.length === 0) return;
+            session.pending = session.buffer.shift();
+            session.ws.send(JSON.stringify({ type: 'op', version: session.version, op: session.pending }));
+        }
+
+        function collabOnLocalChange(e) {
+            const session = collabSession;
+            if (collabApplyingRemote || !session || !session.ready || session.kind !== 'file') return;
+            // Offsets are relative to the model before the edit; applying in descending order keeps them valid
+            const changes = e.changes.slice().sort((a, b) => b.rangeOffset - a.rangeOffset);
+            let length = editor.getModel().getValueLength();
+            changes.forEach(c => { length -= c.text.length - c.rangeLength; });
+            changes.forEach(c => {
+                const op = [];
+                if (c.rangeOffset > 0) op.push(c.rangeOffset);
+                if (c.text.length > 0) op.push(c.text);
+                if (c.rangeLength > 0) op.push(-c.rangeLength);
+                const rest = length - c.rangeOffset - c.rangeLength;
+                if (rest > 0) op.push(rest);
+                session.buffer.push(op);
+                length += c.text.length - c.rangeLength;
+            });
+            collabFlush(session);
+        }
+
+        function collabOnCursor(e) {
+            const session = collabSession;
+            if (!session || !session.ready || session.kind !== 'file' || session.ws.readyState !== WebSocket.OPEN) return;
+            const model = editor.getModel();
+            const from = model.getOffsetAt(e.selection.getStartPosition());
+            const to = model.getOffsetAt(e.selection.getEndPosition());
+            session.ws.send(JSON.stringify({ type: 'cursor', from, to }));
+        }
+
+        function otIsRetain(c) { return typeof c === 'number' && c > 0; }
+        function otIsDelete(c) { return typeof c === 'number' && c < 0; }
+        function otIsInsert(c) { return typeof c === 'string'; }
+
+        function otPush(op, c) {
+            const last = op.length - 1;
+            if (otIsRetain(c) && last >= 0 && otIsRetain(op[last])) { op[last] += c; return; }
+            if (otIsDelete(c) && last >= 0 && otIsDelete(op[last])) { op[last] += c; return; }
+            if (otIsInsert(c)) {
+                if (last >= 0 && otIsInsert(op[last])) { op[last] += c; return; }
+                if (last >= 0 && otIsDelete(op[last])) {
+                    if (last > 0 && otIsInsert(op[last - 1])) { op[last - 1] += c; return; }
+                    op.splice(last, 0, c);
+                    return;
+                }
+            }
+            op.push(c);
+        }
+
+        // otTransform returns [a', b'] such that applying a then b' equals b then a'; a's inserts win ties
+        function otTransform(a, b) {
+            const aPrime = [], bPrime = [];
+            let i = 0, j = 0;
+            let c1 = a[i++], c2 = b[j++];
+            while (c1 !== undefined || c2 !== undefined) {
+                if (otIsInsert(c1)) { otPush(aPrime, c1); otPush(bPrime, c1.length); c1 = a[i++]; continue; }
+                if (otIsInsert(c2)) { otPush(aPrime, c2.length); otPush(bPrime, c2); c2 = b[j++]; continue; }
+                if (c1 === undefined || c2 === undefined) throw new Error('operations do not cover the same document');
+                const len1 = Math.abs(c1), len2 = Math.abs(c2);
+                const n = Math.min(len1, len2);
+                if (otIsRetain(c1) && otIsRetain(c2)) { otPush(aPrime, n); otPush(bPrime, n); }
+                else if (otIsDelete(c1) && otIsRetain(c2)) { otPush(aPrime, -n); }
+                else if (otIsRetain(c1) && otIsDelete(c2)) { otPush(bPrime, -n); }
+                if (len1 === n) { c1 = a[i++]; } else { c1 = otIsRetain(c1) ? c1 - n : c1 + n; }
+                if (len2 === n) { c2 = b[j++]; } else { c2 = otIsRetain(c2) ? c2 - n : c2 + n; }
+            }
+            return [aPrime, bPrime];
+        }
+
+        function otApplyToModel(model, op) {
+            let index = 0;
+            op.forEach(c => {
+                if (otIsRetain(c)) {
+                    index += c;
+                } else if (otIsInsert(c)) {
+                    const pos = model.getPositionAt(index);
+                    model.applyEdits([{ range: new monaco.Range(pos.lineNumber, pos.column, pos.lineNumber, pos.column), text: c }]);
+                    index += c.length;
+                } else {
+                    const start = model.getPositionAt(index);
+                    const end = model.getPositionAt(index - c);
+                    model.applyEdits([{ range: new monaco.Range(start.lineNumber, start.column, end.lineNumber, end.column), text: '' }]);
+                }
+            });
+        }
+
+        function collabColorClass(color) {
+            const cls = 'collab-c-' + color.replace(/[^a-zA-Z0-9]/g, '');
+            if (!collabStyledColors.has(cls)) {
+                collabStyledColors.add(cls);
+                const style = document.createElement('style');
+                style.textContent = '.' + cls + ' { background: ' + color + '33; border-left: 2px solid ' + color + '; }';
+                document.head.appendChild(style);
+            }
+            return cls;
+        }
+
+        function renderCollabPresence(session) {
+            ['fileCollabPresence', 'diagramCollabPresence'].forEach(id => {
+                const el = document.getElementById(id);
+                if (!el) return;
+                const show = session && ((session.kind === 'file') === (id === 'fileCollabPresence'));
+                const others = show ? session.peers.filter(p => !session.self || p.id !== session.self.id) : [];
+                el.innerHTML = others.map(p => '<span class="collab-peer" style="background:' + escapeHtml(p.color) + '" title="Also editing">' + escapeHtml(p.user) + '</span>').join('');
+            });
+            if (!editor) return;
+            const decorations = [];
+            if (session && session.kind === 'file') {
+                const model = editor.getModel();
+                session.peers.forEach(p => {
+                    if (session.self && p.id === session.self.id) return;
+                    const max = model.getValueLength();
+                    const start = model.getPositionAt(Math.min(p.from || 0, max));
+                    const end = model.getPositionAt(Math.min(p.to || 0, max));
+                    decorations.push({
+                        range: new monaco.Range(start.lineNumber, start.column, end.lineNumber, end.column),
+                        options: { className: collabColorClass(p.color), hoverMessage: { value: p.user }, stickiness: 1 }
+                    });
+                });
+            }
+            const target = session || { decorations: [] };
+            target.decorations = editor.deltaDecorations(target.decorations, decorations);
+        }
+
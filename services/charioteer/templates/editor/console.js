@@ -0,0 +1,121 @@
+        // Console: a WebSocket to /ws/repl that keeps a runtime open and
+        // evaluates one expression per entry, so trying things out does not
+        // need a full execute round-trip
+        let consoleWS = null;
+        let consoleQueue = [];      // entries typed before the socket opened
+        let consoleHistory = [];
+        let consoleHistoryIndex = 0;
+        let consoleNextId = 1;
+        let consoleBound = false;
+
+        function consoleAppend(html) {
+            const log = document.getElementById('consoleLog');
+            if (!log) return;
+            const entry = document.createElement('div');
+            entry.className = 'console-entry';
+            entry.innerHTML = html;
+            log.appendChild(entry);
+            log.scrollTop = log.scrollHeight;
+        }
+
+        function renderConsoleResult(res) {
+            const meta = '<span class="console-meta">' +
+                (res.valueType ? escapeHtml(res.valueType) + ' · ' : '') +
+                (Number(res.durationMs) || 0).toFixed(2) + ' ms</span>';
+            if (res.result === 'OK') {
+                const value = JSON.stringify(res.value === undefined ? null : res.value);
+                consoleAppend('<span class="tree-leaf">' + escapeHtml(value) + '</span>' + meta);
+            } else {
+                consoleAppend('<span class="output-error">' + escapeHtml(res.error || 'error') + '</span>' + meta);
+            }
+        }
+
+        function bindConsole() {
+            if (consoleBound) return;
+            const input = document.getElementById('consoleInput');
+            const runtime = document.getElementById('consoleRuntime');
+            if (!input) return;
+            consoleBound = true;
+            input.addEventListener('keydown', (e) => {
+                if (e.key === 'Enter') {
+                    e.preventDefault();
+                    sendConsoleEntry(input.value);
+                    input.value = '';
+                } else if (e.key === 'ArrowUp' && consoleHistoryIndex > 0) {
+                    e.preventDefault();
+                    consoleHistoryIndex--;
+                    input.value = consoleHistory[consoleHistoryIndex];
+                } else if (e.key === 'ArrowDown' && consoleHistoryIndex < consoleHistory.length) {
+                    e.preventDefault();
+                    consoleHistoryIndex++;
+                    input.value = consoleHistory[consoleHistoryIndex] || '';
+                }
+            });
+            if (runtime) {
+                // A scratch runtime lives as long as the connection, so switching reconnects
+                runtime.addEventListener('change', () => {
+                    closeConsole();
+                    consoleAppend('<span class="output-info">Using the ' + escapeHtml(runtime.options[runtime.selectedIndex].text.toLowerCase()) + '</span>');
+                    openConsole();
+                });
+            }
+        }
+
+        function openConsole() {
+            bindConsole();
+            if (!featureEnabled('enable_repl')) return;
+            if (consoleWS && (consoleWS.readyState === 0 || consoleWS.readyState === 1)) return;
+            const token = (authToken || localStorage.getItem(CHARIOTEER_CONFIG.tokenKey) || '').trim();
+            if (!token) {
+                consoleAppend('<span class="output-error">Log in to use the console</span>');
+                return;
+            }
+            const proto = (window.location.protocol === 'https:') ? 'wss' : 'ws';
+            const basePath = window.location.pathname.startsWith('/charioteer/') ? '/charioteer' : '';
+            const runtime = document.getElementById('consoleRuntime');
+            const qs = '?token=' + encodeURIComponent(token) + '&runtime=' + encodeURIComponent(runtime ? runtime.value : 'session');
+            const ws = new WebSocket(proto + '://' + window.location.host + basePath + '/ws/repl' + qs);
+            consoleWS = ws;
+            ws.onopen = () => {
+                const pending = consoleQueue;
+                consoleQueue = [];
+                pending.forEach(entry => ws.send(JSON.stringify(entry)));
+            };
+            ws.onmessage = (evt) => {
+                let msg;
+                try { msg = JSON.parse(evt.data); } catch (e) { return; }
+                if (msg && msg.type === 'result') renderConsoleResult(msg);
+            };
+            ws.onclose = (ev) => {
+                if (consoleWS === ws) {
+                    consoleWS = null;
+                    if (ev && ev.reason) {
+                        consoleAppend('<span class="output-error">Console closed: ' + escapeHtml(ev.reason) + '</span>');
+                    }
+                }
+            };
+        }
+
+        function closeConsole() {
+            if (consoleWS) {
+                const ws = consoleWS;
+                consoleWS = null;
+                try { ws.close(); } catch (e) { /* ignore */ }
+            }
+            consoleQueue = [];
+        }
+
+        function sendConsoleEntry(expr) {
+            if (!expr.trim()) return;
+            consoleHistory.push(expr);
+            consoleHistoryIndex = consoleHistory.length;
+            consoleAppend('<span class="console-prompt">&gt;</span> ' + escapeHtml(expr));
+            const entry = { id: consoleNextId++, expr: expr };
+            if (consoleWS && consoleWS.readyState === 1) {
+                consoleWS.send(JSON.stringify(entry));
+                return;
+            }
+            consoleQueue.push(entry);
+            openConsole();
+        }
+
@@ -0,0 +1,1919 @@
+        // Dashboard functions
+        function refreshDashboardData() {
+            // Show a message in the output panel about dashboard refresh
+            showOutput('Refreshing dashboard data...', 'info');
+            if (currentTab === 'dashboard' && dashboardLoaded) {
+                fetchAndUpdateDashboard();
+            }
+        }
+
+        // Load dashboard content into the editor area
+        async function loadDashboardContent() {
+            try {
+                const editorElement = document.getElementById('editorContainer');
+                if (!editorElement) {
+                    showOutput('Editor container not found', 'error');
+                    return;
+                }
+
+                // Hide Monaco editor when displaying dashboard
+                if (editor) {
+                    editor.getModel()?.dispose();
+                    editor.dispose();
+                    editor = null;
+                }
+
+                // Create dashboard HTML
+                const dashboardHTML = '<div class="dashboard-container" style="padding: 20px; color: #d4d4d4; background-color: #1e1e1e; height: 100%; overflow-y: auto; font-family: \'Segoe UI\', Tahoma, Geneva, Verdana, sans-serif;">' +
+                    
+                    '<div id="dashboardError" style="display: none; background-color: #f44747; color: white; padding: 15px; border-radius: 4px; margin-bottom: 20px;"></div>' +
+                    
+                    '<div id="dashboardLoading" style="text-align: center; padding: 40px; color: #569cd6;">' +
+                        '<p>Loading dashboard data...</p>' +
+                    '</div>' +
+                    
+                    '<div id="dashboardContent" style="display: none;">' +
+                        '<div class="metrics-grid" style="display: grid; grid-template-columns: repeat(auto-fit, minmax(300px, 1fr)); gap: 20px; margin-bottom: 30px;">' +
+                            '<div class="metric-card" style="background: #2d2d30; border: 1px solid #3e3e42; border-radius: 8px; padding: 20px;">' +
+                                '<h3 style="margin: 0 0 15px 0; color: #569cd6; font-size: 18px;">Active Sessions</h3>' +
+                                '<div id="activeSessions" style="font-size: 24px; font-weight: bold; color: #4ec9b0; margin-bottom: 10px;">0</div>' +
+                                '<div style="color: #cccccc; font-size: 14px;">Currently active user sessions</div>' +
+                            '</div>' +
+                            
+                            '<div class="metric-card" style="background: #2d2d30; border: 1px solid #3e3e42; border-radius: 8px; padding: 20px;">' +
+                                '<h3 style="margin: 0 0 15px 0; color: #569cd6; font-size: 18px;">Total Sessions</h3>' +
+                                '<div id="totalSessions" style="font-size: 24px; font-weight: bold; color: #4ec9b0; margin-bottom: 10px;">0</div>' +
+                                '<div style="color: #cccccc; font-size: 14px;">Total sessions since startup</div>' +
+                            '</div>' +
+                            
+                            '<div class="metric-card" style="background: #2d2d30; border: 1px solid #3e3e42; border-radius: 8px; padding: 20px;">' +
+                                '<h3 style="margin: 0 0 15px 0; color: #569cd6; font-size: 18px;">System Uptime</h3>' +
+                                '<div id="uptime" style="font-size: 24px; font-weight: bold; color: #4ec9b0; margin-bottom: 10px;">Unknown</div>' +
+                                '<div style="color: #cccccc; font-size: 14px;">Server uptime</div>' +
+                            '</div>' +
+                            
+                            '<div class="metric-card" style="background: #2d2d30; border: 1px solid #3e3e42; border-radius: 8px; padding: 20px;">' +
+                                '<h3 style="margin: 0 0 15px 0; color: #569cd6; font-size: 18px;">System Status</h3>' +
+                                '<div id="systemStatus" style="font-size: 24px; font-weight: bold; color: #4ec9b0; margin-bottom: 10px;">Unknown</div>' +
+                                '<div style="color: #cccccc; font-size: 14px;">Current system status</div>' +
+                            '</div>' +
+                        '</div>' +
+                        
+                        '<div class="sessions-section" style="background: #2d2d30; border: 1px solid #3e3e42; border-radius: 8px; padding: 20px;">' +
+                            '<h3 style="margin: 0 0 20px 0; color: #569cd6; font-size: 18px;">Active Sessions</h3>' +
+                            '<div style="overflow-x: auto;">' +
+                                '<table style="width: 100%; border-collapse: collapse; color: #d4d4d4;">' +
+                                    '<thead>' +
+                                        '<tr style="border-bottom: 1px solid #3e3e42;">' +
+                                            '<th style="text-align: left; padding: 12px; color: #569cd6;">Username</th>' +
+                                            '<th style="text-align: left; padding: 12px; color: #569cd6;">Session ID</th>' +
+                                            '<th style="text-align: left; padding: 12px; color: #569cd6;">Created</th>' +
+                                            '<th style="text-align: left; padding: 12px; color: #569cd6;">Last Access</th>' +
+                                            '<th style="text-align: left; padding: 12px; color: #569cd6;">Client</th>' +
+                                            '<th style="text-align: left; padding: 12px; color: #569cd6;">Last Script</th>' +
+                                            '<th style="text-align: left; padding: 12px; color: #569cd6;">Status</th>' +
+                                            '<th style="text-align: left; padding: 12px; color: #569cd6;">Actions</th>' +
+                                        '</tr>' +
+                                    '</thead>' +
+                                    '<tbody id="sessionsTableBody">' +
+                                        '<tr>' +
+                                            '<td colspan="8" style="text-align: center; padding: 20px; color: #888;">Loading sessions...</td>' +
+                                        '</tr>' +
+                                    '</tbody>' +
+                                '</table>' +
+                            '</div>' +
+                        '</div>' +
+                    '</div>' +
+                '</div>';
+
+                // Set the dashboard HTML
+                editorElement.innerHTML = dashboardHTML;
+                
+                // Save dashboard content for state management
+                dashboardContent = dashboardHTML;
+                dashboardLoaded = true;
+
+                // Load dashboard data
+                await fetchAndUpdateDashboard();
+
+            } catch (error) {
+                console.error('Error loading dashboard content:', error);
+                showOutput('Failed to load dashboard: ' + error.message, 'error');
+            }
+        }
+
+        // Agents UI state and helpers
+    let agentsContent = '';
+    let agentsLoaded = false;
+    let runOnceAgentNames = [];
+    let runOnceAgentUserTouched = false;
+    let agentsWS = null;
+    let agentsWSBackoffMs = 1000;
+    let agentsWSForcedPolling = false;
+    let agentsWSReconnectEnabled = false; // only reconnect when Agents tab is active
+    let agentsWSReconnectTimer = null;    // pending reconnect timer id
+    let agentsWSConnecting = false;       // prevent concurrent connect attempts
+    let agentsShowHeartbeats = false;     // UI toggle to show/hide heartbeat messages
+    let agentsLastEventTime = '';         // time of the last agent event shown, replayed from on reconnect
+
+        function stopAgentsWS() {
+            // Disable reconnects and close any existing socket
+            agentsWSReconnectEnabled = false;
+            if (agentsWSReconnectTimer) { try { clearTimeout(agentsWSReconnectTimer); } catch (e) {} agentsWSReconnectTimer = null; }
+            try { if (agentsWS) { agentsWS.onclose = null; agentsWS.onerror = null; agentsWS.close(); } } catch (e) {}
+            agentsWS = null;
+            agentsWSConnecting = false;
+        }
+
+        // Build and load the Agents UI into the editor area
+        async function loadAgentsContent() {
+            try {
+                // Hide Monaco editor when displaying agents
+                const editorElement = document.getElementById('editorContainer');
+                if (editor) {
+                    editor.getModel()?.dispose();
+                    editor.dispose();
+                    editor = null;
+                }
+                                const agentsHTML = '<div class="agents-container" style="padding: 20px; color: #d4d4d4; background-color: #1e1e1e; height: 100%; overflow-y: auto; font-family: \'Segoe UI\', Tahoma, Geneva, Verdana, sans-serif;">' +
+                    '<div id="agentsError" style="display: none; background-color: #f44747; color: white; padding: 15px; border-radius: 4px; margin-bottom: 20px;"></div>' +
+                    '<div id="agentsLoading" style="text-align: center; padding: 40px; color: #569cd6;">' +
+                        '<p>Loading agents…</p>' +
+                    '</div>' +
+                    '<div id="agentsContent" style="display:none;">' +
+                        '<div style="display:flex; justify-content:space-between; align-items:center; margin-bottom:20px;">' +
+                            '<h2 style="margin:0; color:#569cd6;">BDI Agents</h2>' +
+                            '<button id="createAgentBtn" class="toolbar-button" style="padding:8px 16px;">➕ Create Agent</button>' +
+                        '</div>' +
+                        '<div style="background:#252526; border:1px solid #333; border-radius:6px; padding:16px; margin-bottom:24px;">' +
+                            '<table style="width:100%; border-collapse:collapse; color:#d4d4d4; font-size:13px;">' +
+                                '<thead>' +
+                                    '<tr style="border-bottom:2px solid #444;">' +
+                                        '<th style="text-align:left; padding:10px; color:#569cd6;">Name</th>' +
+                                        '<th style="text-align:left; padding:10px; color:#569cd6;">Plans</th>' +
+                                        '<th style="text-align:left; padding:10px; color:#569cd6;">Status</th>' +
+                                        '<th style="text-align:left; padding:10px; color:#569cd6;">Beliefs</th>' +
+                                        '<th style="text-align:right; padding:10px; color:#569cd6;">Actions</th>' +
+                                    '</tr>' +
+                                '</thead>' +
+                                '<tbody id="agentsTableBody" style="font-family:monospace;">' +
+                                    '<tr><td colspan="5" style="text-align:center; padding:20px; color:#888;">No agents running</td></tr>' +
+                                '</tbody>' +
+                            '</table>' +
+                        '</div>' +
+                        '<div style="display:flex; gap:24px;">' +
+                            '<div style="flex:1; background:#252526; border:1px solid #333; border-radius:6px; padding:16px;">' +
+                                '<div style="display:flex; justify-content:space-between; align-items:center; margin-bottom:12px;">' +
+                                    '<h3 style="margin:0; color:#569cd6;">One-Shot Plan Execution</h3>' +
+                                '</div>' +
+                                '<div style="display:flex; gap:12px; align-items:center; margin-bottom:12px;">' +
+                                    '<select id="planSelectRunOnce" style="flex:1; padding:8px; background:#1e1e1e; color:#d4d4d4; border:1px solid #444; border-radius:4px;">' +
+                                        '<option value="">Select plan...</option>' +
+                                    '</select>' +
+                                    '<button id="runOnceBtn" class="toolbar-button" style="padding:8px 16px;">▶️ Run Once</button>' +
+                                '</div>' +
+                                '<label for="agentSelectRunOnce" style="display:block; font-size:12px; color:#bbb; margin-bottom:6px;">Agent context (optional):</label>' +
+                                '<select id="agentSelectRunOnce" style="width:100%; padding:8px; background:#1e1e1e; color:#d4d4d4; border:1px solid #444; border-radius:4px; margin-bottom:12px;">' +
+                                    '<option value="">Run without touching agent beliefs</option>' +
+                                '</select>' +
+                                '<label for="runOnceVarsInput" style="display:block; font-size:12px; color:#bbb; margin-bottom:6px;">Optional varsMap JSON passed to the plan:</label>' +
+                                '<textarea id="runOnceVarsInput" style="width:100%; min-height:90px; padding:8px; background:#1e1e1e; color:#d4d4d4; border:1px solid #444; border-radius:4px; resize:vertical; font-family:monospace;" placeholder="Example: {&quot;temperature&quot;:72, &quot;unit&quot;:&quot;F&quot;}"></textarea>' +
+                                '<div style="font-size:11px; color:#888; margin-top:6px;">Use JSON object syntax. If you selected an agent, these keys are applied to its beliefs before the plan runs and are also available as per-run vars.</div>' +
+                            '</div>' +
+                            '<div style="flex:1; background:#252526; border:1px solid #333; border-radius:6px; padding:16px;">' +
+                                '<div style="display:flex; align-items:center; justify-content:space-between; gap:12px; margin-bottom:12px;">' +
+                                    '<h3 style="margin:0; color:#569cd6;">Agent Events</h3>' +
+                                    '<div style="display:flex; align-items:center; gap:10px;">' +
+                                        '<label style="font-size:12px; color:#bbb; display:flex; align-items:center; gap:6px;">' +
+                                             '<input type="checkbox" id="toggleHeartbeats" /> Show heartbeats' +
+                                        '</label>' +
+                                        '<button id="clearAgentsStreamButton" class="toolbar-button">🧹 Clear</button>' +
+                                    '</div>' +
+                                '</div>' +
+                                '<pre id="agentsStream" style="height:30vh; overflow:auto; background:#1e1e1e; color:#d4d4d4; padding:12px; border-radius:4px; border:1px solid #333; white-space:pre-wrap; word-break:break-word; font-size:11px;"></pre>' +
+                            '</div>' +
+                        '</div>' +
+                    '</div>' +
+                '</div>' +
+                // Create Agent Modal
+                '<div id="createAgentModal" style="display:none; position:fixed; top:0; left:0; width:100%; height:100%; background:rgba(0,0,0,0.7); z-index:10000;">' +
+                    '<div style="position:absolute; top:50%; left:50%; transform:translate(-50%,-50%); background:#252526; border:1px solid #444; border-radius:8px; padding:24px; min-width:400px;">' +
+                        '<h3 style="margin-top:0; color:#569cd6;">Create New Agent</h3>' +
+                        '<div style="margin-bottom:16px;">' +
+                            '<label style="display:block; margin-bottom:4px; color:#bbb;">Agent Name:</label>' +
+                            '<input id="createAgentName" type="text" style="width:100%; padding:8px; background:#1e1e1e; color:#d4d4d4; border:1px solid #444; border-radius:4px;" placeholder="my_agent" />' +
+                        '</div>' +
+                        '<div style="margin-bottom:16px;">' +
+                            '<label style="display:block; margin-bottom:4px; color:#bbb;">Plan:</label>' +
+                            '<select id="createAgentPlan" style="width:100%; padding:8px; background:#1e1e1e; color:#d4d4d4; border:1px solid #444; border-radius:4px;">' +
+                                '<option value="">Select plan...</option>' +
+                            '</select>' +
+                        '</div>' +
+                        '<div style="margin-bottom:16px;">' +
+                            '<label style="display:block; margin-bottom:4px; color:#bbb;">Max Concurrent:</label>' +
+                            '<input id="createAgentMaxConcurrent" type="number" value="1" min="1" style="width:100%; padding:8px; background:#1e1e1e; color:#d4d4d4; border:1px solid #444; border-radius:4px;" />' +
+                        '</div>' +
+                        '<div style="margin-bottom:24px;">' +
+                            '<label style="display:block; margin-bottom:4px; color:#bbb;">Poll Seconds:</label>' +
+                            '<input id="createAgentPollSeconds" type="number" value="3" min="0.1" step="0.1" style="width:100%; padding:8px; background:#1e1e1e; color:#d4d4d4; border:1px solid#444; border-radius:4px;" />' +
+                        '</div>' +
+                        '<div style="display:flex; gap:12px; justify-content:flex-end;">' +
+                            '<button id="cancelCreateAgent" class="toolbar-button">Cancel</button>' +
+                            '<button id="confirmCreateAgent" class="toolbar-button" style="background:#0e639c;">Create</button>' +
+                        '</div>' +
+                    '</div>' +
+                '</div>' +
+                // Beliefs Modal
+                '<div id="beliefsModal" style="display:none; position:fixed; top:0; left:0; width:100%; height:100%; background:rgba(0,0,0,0.7); z-index:10000;">' +
+                    '<div style="position:absolute; top:50%; left:50%; transform:translate(-50%,-50%); background:#252526; border:1px solid #444; border-radius:8px; padding:24px; min-width:500px; max-height:80vh; overflow:auto;">' +
+                        '<h3 style="margin-top:0; color:#569cd6;">Agent Beliefs: <span id="beliefsAgentName"></span></h3>' +
+                        '<div id="beliefsContent" style="margin-bottom:16px;"></div>' +
+                        '<div style="display:flex; gap:12px; margin-bottom:16px;">' +
+                            '<input id="newBeliefKey" type="text" placeholder="Key" style="flex:1; padding:8px; background:#1e1e1e; color:#d4d4d4; border:1px solid #444; border-radius:4px;" />' +
+                            '<input id="newBeliefValue" type="text" placeholder="Value" style="flex:1; padding:8px; background:#1e1e1e; color:#d4d4d4; border:1px solid #444; border-radius:4px;" />' +
+                            '<button id="addBeliefBtn" class="toolbar-button">Add</button>' +
+                        '</div>' +
+                        '<div style="display:flex; gap:12px; justify-content:flex-end;">' +
+                            '<button id="closeBeliefsModal" class="toolbar-button" onclick="hideBeliefsModal()">Close</button>' +
+                        '</div>' +
+                    '</div>' +
+                '</div>';
+
+                // Inject and save state
+                editorElement.innerHTML = agentsHTML;
+                agentsContent = agentsHTML;
+                agentsLoaded = true;
+
+                // Bind UI event handlers
+                const clearBtn = document.getElementById('clearAgentsStreamButton');
+                if (clearBtn) {
+                    clearBtn.addEventListener('click', function() {
+                        const s = document.getElementById('agentsStream');
+                        if (s) s.textContent = '';
+                    });
+                }
+                const hbToggle = document.getElementById('toggleHeartbeats');
+                if (hbToggle) {
+                    hbToggle.checked = agentsShowHeartbeats;
+                    hbToggle.addEventListener('change', function() {
+                        agentsShowHeartbeats = hbToggle.checked;
+                    });
+                }
+
+                // Create Agent button
+                const createAgentBtn = document.getElementById('createAgentBtn');
+                if (createAgentBtn) {
+                    createAgentBtn.addEventListener('click', showCreateAgentModal);
+                }
+
+                // Create Agent modal handlers
+                const cancelCreateBtn = document.getElementById('cancelCreateAgent');
+                if (cancelCreateBtn) {
+                    cancelCreateBtn.addEventListener('click', () => {
+                        document.getElementById('createAgentModal').style.display = 'none';
+                    });
+                }
+                const confirmCreateBtn = document.getElementById('confirmCreateAgent');
+                if (confirmCreateBtn) {
+                    confirmCreateBtn.addEventListener('click', createAgent);
+                }
+
+                // Run Once button
+                const runOnceBtn = document.getElementById('runOnceBtn');
+                if (runOnceBtn) {
+                    runOnceBtn.addEventListener('click', runPlanOnce);
+                }
+                const runOnceAgentSelect = document.getElementById('agentSelectRunOnce');
+                if (runOnceAgentSelect) {
+                    runOnceAgentSelect.addEventListener('change', () => {
+                        runOnceAgentUserTouched = true;
+                    });
+                }
+
+                // Beliefs modal handlers
+                const beliefsModal = document.getElementById('beliefsModal');
+                const closeBeliefsBtn = document.getElementById('closeBeliefsModal');
+                if (closeBeliefsBtn) {
+                    closeBeliefsBtn.addEventListener('click', hideBeliefsModal);
+                }
+                if (beliefsModal && !beliefsModal.dataset.dismissHandlerAttached) {
+                    beliefsModal.dataset.dismissHandlerAttached = 'true';
+                    beliefsModal.addEventListener('click', (event) => {
+                        if (event.target === beliefsModal) {
+                            hideBeliefsModal();
+                        }
+                    });
+                }
+                if (!window.__beliefsEscHandlerAttached) {
+                    window.__beliefsEscHandlerAttached = true;
+                    document.addEventListener('keydown', (event) => {
+                        if (event.key === 'Escape') {
+                            const modal = document.getElementById('beliefsModal');
+                            if (modal && modal.style.display !== 'none') {
+                                hideBeliefsModal();
+                            }
+                        }
+                    });
+                }
+                const addBeliefBtn = document.getElementById('addBeliefBtn');
+                if (addBeliefBtn) {
+                    addBeliefBtn.addEventListener('click', addBelief);
+                }
+
+                // Load available plans for dropdowns
+                await loadPlansForAgents();
+
+                // Initial list load
+                await fetchAndRenderAgents();
+            } catch (error) {
+                console.error('Error loading agents content:', error);
+                showOutput('Failed to load agents: ' + error.message, 'error');
+            }
+        }
+
+        function connectAgentsWS() {
+            // Only connect/reconnect if enabled (Agents tab active)
+            if (!agentsWSReconnectEnabled) return;
+            // Prevent parallel attempts
+            if (agentsWSConnecting) return;
+            agentsWSConnecting = true;
+            // Clear any pending reconnect timer to avoid stacked connects
+            if (agentsWSReconnectTimer) { try { clearTimeout(agentsWSReconnectTimer); } catch (e) {} agentsWSReconnectTimer = null; }
+            // Avoid duplicate sockets: if an open or connecting socket exists, don't disrupt it
+            try {
+                if (agentsWS) {
+                    const rs = agentsWS.readyState; // 0=CONNECTING,1=OPEN,2=CLOSING,3=CLOSED
+                    if (rs === 0 || rs === 1 || rs === 2) {
+                        agentsWSConnecting = false;
+                        return;
+                    }
+                    // CLOSED: allow a fresh connect
+                }
+            } catch (e) { /* ignore */ }
+            const proto = (window.location.protocol === 'https:') ? 'wss' : 'ws';
+            const basePath = window.location.pathname.startsWith('/charioteer/') ? '/charioteer' : '';
+            const token = (authToken || localStorage.getItem(CHARIOTEER_CONFIG.tokenKey) || '').trim();
+            // Replay what was missed: the last hour on first connect, else since the last event shown
+            const params = new URLSearchParams();
+            if (token) params.set('token', token);
+            params.set('since', agentsLastEventTime || '1h');
+            const wsURL = proto + '://' + window.location.host + basePath + '/ws/agents?' + params.toString();
+            try {
+                agentsWS = new WebSocket(wsURL);
+                agentsWS.onopen = () => {
+                    console.log('Agents WS connected');
+                    agentsWSBackoffMs = 1000;
+                    agentsWSForcedPolling = false;
+                    agentsWSConnecting = false;
+                    if (agentsWSReconnectTimer) { try { clearTimeout(agentsWSReconnectTimer); } catch (e) {} agentsWSReconnectTimer = null; }
+                    const err = document.getElementById('agentsError');
+                    if (err) { err.style.display = 'none'; }
+                };
+                agentsWS.onmessage = (evt) => {
+                    const s = document.getElementById('agentsStream');
+                    if (!s) return;
+                    try {
+                        const msg = JSON.parse(evt.data);
+                        // Filter heartbeats unless explicitly enabled
+                        if (msg && msg.type === 'heartbeat' && !agentsShowHeartbeats) {
+                            return;
+                        }
+                        if (msg && msg.type === 'reauth') return; // answer to a token refresh
+                        if (msg && msg.agent && msg.time) {
+                            agentsLastEventTime = msg.time;
+                        }
+                        const line = (typeof msg === 'string') ? msg : JSON.stringify(msg);
+                        s.textContent += (s.textContent ? '\n' : '') + line;
+                        s.scrollTop = s.scrollHeight;
+                    } catch (e) {
+                        s.textContent += (s.textContent ? '\n' : '') + evt.data;
+                        s.scrollTop = s.scrollHeight;
+                    }
+                    const loading = document.getElementById('agentsLoading');
+                    const content = document.getElementById('agentsContent');
+                    if (loading) loading.style.display = 'none';
+                    if (content) content.style.display = 'block';
+                };
+                agentsWS.onclose = (ev) => {
+                    console.log('Agents WS closed', ev && ev.code, ev && ev.reason);
+                    agentsWSConnecting = false;
+                    if (ev && ev.code === 4429) {
+                        // Over the server's connection limit: retrying would only be refused again
+                        const err = document.getElementById('agentsError');
+                        if (err) { err.textContent = 'Realtime updates off: ' + ev.reason; err.style.display = 'block'; }
+                        return;
+                    }
+                    if (agentsWSReconnectEnabled && token && !agentsWSForcedPolling && currentTab === 'agents') {
+                        const err = document.getElementById('agentsError');
+                        if (err) { err.textContent = 'Realtime link lost, retrying…'; err.style.display = 'block'; }
+                        if (agentsWSReconnectTimer) { try { clearTimeout(agentsWSReconnectTimer); } catch (e) {} }
+                        agentsWSReconnectTimer = setTimeout(() => { agentsWSReconnectTimer = null; connectAgentsWS(); }, Math.min(agentsWSBackoffMs, 30000));
+                        agentsWSBackoffMs = Math.min(agentsWSBackoffMs * 2, 30000);
+                    }
+                };
+                agentsWS.onerror = (e) => {
+                    console.log('Agents WS error', e);
+                    agentsWSConnecting = false;
+                    if (agentsWSReconnectEnabled && token && !agentsWSForcedPolling && currentTab === 'agents') {
+                        const err = document.getElementById('agentsError');
+                        if (err) { err.textContent = 'Realtime error, retrying…'; err.style.display = 'block'; }
+                        try { agentsWS.close(); } catch (e) {}
+                        if (agentsWSReconnectTimer) { try { clearTimeout(agentsWSReconnectTimer); } catch (e) {} }
+                        agentsWSReconnectTimer = setTimeout(() => { agentsWSReconnectTimer = null; connectAgentsWS(); }, Math.min(agentsWSBackoffMs, 30000));
+                        agentsWSBackoffMs = Math.min(agentsWSBackoffMs * 2, 30000);
+                    }
+                };
+            } catch (e) {
+                console.warn('Agents WS not available, using no-op');
+                agentsWSConnecting = false;
+            }
+        }
+
+    async function fetchAndRenderAgents() {
+            const err = document.getElementById('agentsError');
+            const loading = document.getElementById('agentsLoading');
+            const content = document.getElementById('agentsContent');
+            try {
+                if (err) err.style.display = 'none';
+                if (loading) loading.style.display = 'block';
+                if (content) content.style.display = 'none';
+                const resp = await fetch('/charioteer/api/agents', { headers: getAuthHeaders() });
+                if (!resp.ok) throw new Error('Failed to fetch agents: ' + resp.statusText);
+                const result = await resp.json();
+                let agents = [];
+                if (result) {
+                    if (Array.isArray(result)) {
+                        agents = result;
+                    } else if (Array.isArray(result.agents)) {
+                        agents = result.agents;
+                    } else if (result.data) {
+                        if (Array.isArray(result.data)) {
+                            agents = result.data;
+                        } else if (Array.isArray(result.data.agents)) {
+                            agents = result.data.agents;
+                        }
+                    }
+                }
+
+                const agentNamesForDropdown = [];
+                // Render agents table
+                const tbody = document.getElementById('agentsTableBody');
+                if (tbody) {
+                    if (!agents || agents.length === 0) {
+                        tbody.innerHTML = '<tr><td colspan="5" style="text-align:center; padding:20px; color:#888;">No agents running</td></tr>';
+                    } else {
+                        tbody.innerHTML = '';
+                        for (const agentName of agents) {
+                            // Fetch detailed info for each agent
+                            const name = typeof agentName === 'string' ? agentName : agentName.name || agentName;
+                            if (name && !agentNamesForDropdown.includes(name)) {
+                                agentNamesForDropdown.push(name);
+                            }
+                            const infoResp = await fetch('/charioteer/api/agents/' + encodeURIComponent(name), { headers: getAuthHeaders() });
+                            let info = { name: name, plans: [], running: true, beliefCount: 0, intentions: [] };
+                            if (infoResp.ok) {
+                                const infoResult = await infoResp.json();
+                                if (infoResult.result === 'OK' && infoResult.data) {
+                                    info = infoResult.data;
+                                    info.beliefCount = Object.keys(info.beliefs || {}).length;
+                                }
+                            }
+                            // Plans show their conditions on hover; executing plans show their step
+                            const plansHtml = (info.plans || []).map(p => {
+                                if (typeof p === 'string') return escapeHtml(p);
+                                const conditions = ['trigger', 'guard', 'drop'].filter(k => p[k]).map(k => k + ': ' + p[k]).join('\n');
+                                return '<span title="' + escapeHtml(conditions).replace(/"/g, '&quot;') + '">' + escapeHtml(p.name) + '</span>';
+                            }).join(', ');
+                            const intentionsHtml = (info.intentions || []).map(it =>
+                                '<div style="font-size:11px; color:#ccc;">▶ ' + escapeHtml(it.plan) + ' step ' + (it.step + 1) + '/' + it.steps + '</div>'
+                            ).join('');
+
+                            const row = document.createElement('tr');
+                            row.style.borderBottom = '1px solid #444';
+                            row.innerHTML =
+                                '<td style="padding:12px;">' + escapeHtml(info.name) + '</td>' +
+                                '<td style="padding:12px;">' + (plansHtml || '-') + '</td>' +
+                                '<td style="padding:12px;"><span style="color:' + (info.running ? '#4ec9b0' : '#f44747') + ';">' + (info.running ? 'Running' : 'Stopped') + '</span>' + intentionsHtml + '</td>' +
+                                '<td style="padding:12px;">' + (info.beliefCount || 0) + ' belief(s) <button class="toolbar-button" onclick="viewBeliefs(\'' + escapeHtml(info.name) + '\')" style="padding:4px 8px; font-size:11px; margin-left:8px;">View/Edit</button></td>' +
+                                '<td style="padding:12px; text-align:right;">' +
+                                    '<button class="toolbar-button" onclick="publishAgentAction(\'' + escapeHtml(info.name) + '\')" style="padding:4px 8px; font-size:11px; margin-right:4px;">📢 Nudge</button>' +
+                                    '<button class="toolbar-button" onclick="stopAgentAction(\'' + escapeHtml(info.name) + '\')" style="padding:4px 8px; font-size:11px; background:#dc3545;">🛑 Stop</button>' +
+                                '</td>';
+                            tbody.appendChild(row);
+                        }
+                    }
+                }
+                updateRunOnceAgentDropdown(agentNamesForDropdown);
+                if (loading) loading.style.display = 'none';
+                if (content) content.style.display = 'block';
+            } catch (e) {
+                console.error('Agents API error:', e);
+                if (err) { err.textContent = e.message; err.style.display = 'block'; }
+                if (loading) loading.style.display = 'none';
+                if (content) content.style.display = 'none';
+            }
+        }
+
+        // Load available plans into dropdowns
+        async function loadPlansForAgents() {
+            console.log('[loadPlansForAgents] Starting...');
+            try {
+                // Use the listPlans() function to get all plan names directly
+                const chariotCode = 'listPlans()\n';
+                
+                console.log('[loadPlansForAgents] Executing listPlans()...');
+                const resp = await fetch('/charioteer/api/execute', {
+                    method: 'POST',
+                    headers: {
+                        ...getAuthHeaders(),
+                        'Content-Type': 'application/json'
+                    },
+                    body: JSON.stringify({ program: chariotCode })
+                });
+                
+                if (!resp.ok) {
+                    const errorResult = await resp.json();
+                    console.error('[loadPlansForAgents] Execute failed:', resp.status, errorResult);
+                    return;
+                }
+                
+                const result = await resp.json();
+                console.log('[loadPlansForAgents] Execute result:', result);
+                
+                // Extract plan names from result
+                let planNames = [];
+                if (result.data && Array.isArray(result.data)) {
+                    planNames = result.data;
+                } else if (result.result && Array.isArray(result.result)) {
+                    planNames = result.result;
+                }
+                
+                console.log('[loadPlansForAgents] Plan names found:', planNames);
+                
+                // Populate dropdowns
+                const createSelect = document.getElementById('createAgentPlan');
+                const runOnceSelect = document.getElementById('planSelectRunOnce');
+                
+                [createSelect, runOnceSelect].forEach(select => {
+                    if (select) {
+                        const previousValue = select.value;
+                        let previousStillExists = false;
+                        select.innerHTML = '<option value="">Select plan...</option>';
+                        if (planNames.length === 0) {
+                            const opt = document.createElement('option');
+                            opt.value = '';
+                            opt.textContent = '(No plans found)';
+                            opt.disabled = true;
+                            select.appendChild(opt);
+                        } else {
+                            planNames.forEach(planName => {
+                                const opt = document.createElement('option');
+                                opt.value = planName;
+                                opt.textContent = planName;
+                                if (planName === previousValue) {
+                                    previousStillExists = true;
+                                }
+                                select.appendChild(opt);
+                            });
+                            if (previousValue && previousStillExists) {
+                                select.value = previousValue;
+                            }
+                        }
+                    }
+                });
+                console.log('[loadPlansForAgents] Completed successfully');
+            } catch (e) {
+                console.error('[loadPlansForAgents] Error:', e);
+            }
+        }
+
+        // Show create agent modal
+        function showCreateAgentModal() {
+            const modal = document.getElementById('createAgentModal');
+            if (modal) {
+                document.getElementById('createAgentName').value = '';
+                document.getElementById('createAgentPlan').value = '';
+                document.getElementById('createAgentMaxConcurrent').value = '1';
+                document.getElementById('createAgentPollSeconds').value = '3';
+                modal.style.display = 'flex';
+            }
+        }
+
+        // Create agent
+        async function createAgent() {
+            const name = document.getElementById('createAgentName').value.trim();
+            const plan = document.getElementById('createAgentPlan').value;
+            const maxConcurrent = parseInt(document.getElementById('createAgentMaxConcurrent').value) || 1;
+            const pollSeconds = parseFloat(document.getElementById('createAgentPollSeconds').value) || 3;
+
+            if (!name || !plan) {
+                alert('Please provide agent name and select a plan');
+                return;
+            }
+
+            try {
+                const resp = await fetch('/charioteer/api/agents/create', {
+                    method: 'POST',
+                    headers: Object.assign({ 'Content-Type': 'application/json' }, getAuthHeaders()),
+                    body: JSON.stringify({ name, plan, maxConcurrent, pollSeconds })
+                });
+
+                if (!resp.ok) {
+                    const result = await resp.json();
+                    throw new Error(result.data || result.message || 'Failed to create agent');
+                }
+
+                document.getElementById('createAgentModal').style.display = 'none';
+                showOutput('Agent "' + name + '" created successfully', 'success');
+                await fetchAndRenderAgents();
+            } catch (e) {
+                alert('Failed to create agent: ' + e.message);
+            }
+        }
+
+        // Stop agent
+        async function stopAgentAction(name) {
+            if (!confirm('Stop agent "' + name + '"?')) return;
+
+            try {
+                const resp = await fetch('/charioteer/api/agents/stop', {
+                    method: 'POST',
+                    headers: Object.assign({ 'Content-Type': 'application/json' }, getAuthHeaders()),
+                    body: JSON.stringify({ name })
+                });
+
+                if (!resp.ok) {
+                    const result = await resp.json();
+                    throw new Error(result.data || 'Failed to stop agent');
+                }
+
+                showOutput('Agent "' + name + '" stopped', 'success');
+                await fetchAndRenderAgents();
+            } catch (e) {
+                alert('Failed to stop agent: ' + e.message);
+            }
+        }
+
+        // Publish/Nudge agent
+        async function publishAgentAction(name) {
+            try {
+                const resp = await fetch('/charioteer/api/agents/publish', {
+                    method: 'POST',
+                    headers: Object.assign({ 'Content-Type': 'application/json' }, getAuthHeaders()),
+                    body: JSON.stringify({ name })
+                });
+
+                if (!resp.ok) {
+                    const result = await resp.json();
+                    throw new Error(result.data || 'Failed to publish agent');
+                }
+
+                showOutput('Agent "' + name + '" nudged', 'success');
+            } catch (e) {
+                alert('Failed to nudge agent: ' + e.message);
+            }
+        }
+
+        function hideBeliefsModal() {
+            const modal = document.getElementById('beliefsModal');
+            if (!modal) {
+                return;
+            }
+            modal.style.display = 'none';
+            modal.removeAttribute('data-agent-name');
+            const keyInput = document.getElementById('newBeliefKey');
+            const valueInput = document.getElementById('newBeliefValue');
+            if (keyInput) keyInput.value = '';
+            if (valueInput) valueInput.value = '';
+        }
+
+        // View/Edit beliefs
+        async function viewBeliefs(name) {
+            try {
+                const resp = await fetch('/charioteer/api/agents/' + encodeURIComponent(name) + '/beliefs', {
+                    headers: getAuthHeaders()
+                });
+
+                if (!resp.ok) {
+                    const result = await resp.json();
+                    throw new Error(result.data || 'Failed to fetch beliefs');
+                }
+
+                const result = await resp.json();
+                const beliefs = result.data || {};
+
+                const modal = document.getElementById('beliefsModal');
+                const nameSpan = document.getElementById('beliefsAgentName');
+                const content = document.getElementById('beliefsContent');
+
+                if (nameSpan) nameSpan.textContent = name;
+                if (content) {
+                    if (Object.keys(beliefs).length === 0) {
+                        content.innerHTML = '<div style="color:#888; padding:12px;">No beliefs set</div>';
+                    } else {
+                        let html = '<table style="width:100%; border-collapse:collapse;">';
+                        for (const [key, value] of Object.entries(beliefs)) {
+                            html += '<tr style="border-bottom:1px solid #444;">' +
+                                '<td style="padding:8px; color:#569cd6;">' + escapeHtml(key) + '</td>' +
+                                '<td style="padding:8px; font-family:monospace;">' + escapeHtml(JSON.stringify(value)) + '</td>' +
+                                '</tr>';
+                        }
+                        html += '</table>';
+                        content.innerHTML = html;
+                    }
+                }
+
+                modal.setAttribute('data-agent-name', name);
+                modal.style.display = 'flex';
+            } catch (e) {
+                alert('Failed to load beliefs: ' + e.message);
+            }
+        }
+
+        // Helper to keep Run Once agent dropdown in sync with registry
+        function updateRunOnceAgentDropdown(agentNames) {
+            const select = document.getElementById('agentSelectRunOnce');
+            if (!select) {
+                return;
+            }
+            const previous = select.value || '';
+            const names = Array.isArray(agentNames) ? agentNames.filter(Boolean) : [];
+            runOnceAgentNames = names;
+            select.innerHTML = '<option value="">Run without touching agent beliefs</option>';
+            names.forEach(name => {
+                const opt = document.createElement('option');
+                opt.value = name;
+                opt.textContent = name;
+                select.appendChild(opt);
+            });
+            if (previous && names.includes(previous)) {
+                select.value = previous;
+            } else if (!runOnceAgentUserTouched && names.length > 0) {
+                select.value = names[0];
+            } else {
+                select.value = '';
+            }
+        }
+
+        // Add belief
+        async function addBelief() {
+            const modal = document.getElementById('beliefsModal');
+            const name = modal.getAttribute('data-agent-name');
+            const key = document.getElementById('newBeliefKey').value.trim();
+            const valueStr = document.getElementById('newBeliefValue').value.trim();
+
+            if (!key || !valueStr) {
+                alert('Please provide key and value');
+                return;
+            }
+
+            try {
+                // Parse value as JSON or treat as string
+                let value;
+                try {
+                    value = JSON.parse(valueStr);
+                } catch {
+                    value = valueStr; // Treat as string if not valid JSON
+                }
+
+                const resp = await fetch('/charioteer/api/agents/belief', {
+                    method: 'POST',
+                    headers: Object.assign({ 'Content-Type': 'application/json' }, getAuthHeaders()),
+                    body: JSON.stringify({ name, key, value })
+                });
+
+                if (!resp.ok) {
+                    const result = await resp.json();
+                    throw new Error(result.data || 'Failed to set belief');
+                }
+
+                document.getElementById('newBeliefKey').value = '';
+                document.getElementById('newBeliefValue').value = '';
+                showOutput('Belief set on agent "' + name + '"', 'success');
+                
+                // Refresh beliefs display
+                await viewBeliefs(name);
+            } catch (e) {
+                alert('Failed to set belief: ' + e.message);
+            }
+        }
+
+        // Run plan once
+        async function runPlanOnce() {
+            const plan = document.getElementById('planSelectRunOnce').value;
+            if (!plan) {
+                alert('Please select a plan');
+                return;
+            }
+
+            const agentSelectEl = document.getElementById('agentSelectRunOnce');
+            const agentName = agentSelectEl ? (agentSelectEl.value || '').trim() : '';
+
+            let varsMap = {};
+            const varsInputEl = document.getElementById('runOnceVarsInput');
+            if (varsInputEl) {
+                const raw = varsInputEl.value.trim();
+                if (raw.length > 0) {
+                    try {
+                        const parsed = JSON.parse(raw);
+                        if (!parsed || typeof parsed !== 'object' || Array.isArray(parsed)) {
+                            throw new Error('Vars map must be a JSON object.');
+                        }
+                        varsMap = parsed;
+                    } catch (err) {
+                        alert('Invalid vars map JSON: ' + err.message);
+                        return;
+                    }
+                }
+            }
+
+            try {
+                const payload = { plan, mode: 'bdi', varsMap };
+                if (agentName) {
+                    payload.agentName = agentName;
+                }
+                const resp = await fetch('/charioteer/api/agents/run-once', {
+                    method: 'POST',
+                    headers: Object.assign({ 'Content-Type': 'application/json' }, getAuthHeaders()),
+                    body: JSON.stringify(payload)
+                });
+
+                if (!resp.ok) {
+                    const result = await resp.json();
+                    throw new Error(result.data || 'Failed to run plan');
+                }
+
+                const result = await resp.json();
+                const agentBlurb = agentName ? (' using agent "' + agentName + '"') : '';
+                showOutput('Plan "' + plan + '" executed' + agentBlurb + ': ' + JSON.stringify(result.data), 'success');
+            } catch (e) {
+                alert('Failed to run plan: ' + e.message);
+            }
+        }
+
+        // (removed duplicate connectAgentsWS definition)
+
+        // WebSocket client for dashboard stream
+        let dashboardWS = null;
+        let dashboardWSBackoffMs = 1000; // start at 1s, cap later
+        let dashboardWSForcedPolling = false; // only used if we truly can't WS at all
+        let dashboardWSFailures = 0; // attempts in a row that never connected
+        const dashboardWSMaxFailures = 3; // then fall back to long polling
+
+        function showDashboardStatusBanner(text, kind) {
+            const elId = 'dashboardError';
+            let el = document.getElementById(elId);
+            if (!el) {
+                // Create hidden placeholder but we will not inject into DOM prominently
+                el = document.createElement('div');
+                el.id = elId;
+                el.style.display = 'none';
+            }
+            // Hide when no text provided
+            if (!text) {
+                el.style.display = 'none';
+                el.textContent = '';
+                return;
+            }
+            // Route transient alerts to Problems tab instead of visible banner
+            const level = (kind === 'warn' || kind === 'warning') ? 'warn' : (kind === 'error' ? 'error' : 'info');
+            showProblem(text, level);
+        }
+
+    function connectDashboardWS() {
+            try {
+                // Determine WS URL based on current path and protocol
+                const proto = (window.location.protocol === 'https:') ? 'wss' : 'ws';
+                const basePath = window.location.pathname.startsWith('/charioteer/') ? '/charioteer' : '';
+        const token = (authToken || localStorage.getItem(CHARIOTEER_CONFIG.tokenKey) || '').trim();
+        const qs = token ? ('?token=' + encodeURIComponent(token)) : '';
+        const wsURL = proto + '://' + window.location.host + basePath + '/ws/dashboard' + qs;
+                // Browser WebSocket cannot set custom headers; we rely on authMiddleware
+                // which reads Authorization header from the initial HTTP request. To supply it,
+                // we append it as a query parameter that our proxy ignores for security, but
+                // our authMiddleware still checks request headers. As browsers cannot set headers,
+                // we also support a cookie or localStorage-based transfer via a small fetch before WS.
+
+                // Attempt direct connect; server-side proxy will read Authorization from initial HTTP upgrade
+                dashboardWS = new WebSocket(wsURL);
+                dashboardWS.onopen = () => {
+                    console.log('Dashboard WS connected');
+                    dashboardWSBackoffMs = 1000; // reset backoff on success
+                    dashboardWSForcedPolling = false;
+                    dashboardWSFailures = 0;
+                    stopDashboardLongPoll();
+                    // Ask for JSON Patch updates instead of the whole status every tick
+                    dashboardWSState = null;
+                    dashboardWSSeq = 0;
+                    try { dashboardWS.send(JSON.stringify({ protocol: 'delta' })); } catch (e) {}
+                    showDashboardStatusBanner('', '');
+                };
+                dashboardWS.onmessage = (evt) => {
+                    try {
+                        const msg = JSON.parse(evt.data);
+                        if (msg && msg.type === 'reauth') return; // answer to a token refresh
+                        if (msg && msg.result === 'OK') {
+                            const data = dashboardWSApply(msg);
+                            if (!data) return;
+                            // Throttle UI updates
+                            pendingDashboardData = data;
+                            if (!dashboardWSUpdateTimer) {
+                                dashboardWSUpdateTimer = setTimeout(() => {
+                                    dashboardWSUpdateTimer = null;
+                                    const data = pendingDashboardData;
+                                    pendingDashboardData = null;
+                                    if (data) updateDashboardUI(data);
+                                    const dl = document.getElementById('dashboardLoading');
+                                    const dc = document.getElementById('dashboardContent');
+                                    if (dl) dl.style.display = 'none';
+                                    if (dc) dc.style.display = 'block';
+                                }, 500);
+                            }
+                        }
+                    } catch (e) {
+                        console.warn('WS message parse error', e);
+                    }
+                };
+                dashboardWS.onclose = (ev) => {
+                    console.log('Dashboard WS closed', ev && ev.code, ev && ev.reason);
+                    if (ev && ev.target !== dashboardWS) return; // replaced by a newer connection
+                    if (ev && ev.code === 4429) {
+                        // Over the server's connection limit: poll instead of taking a connection
+                        showDashboardStatusBanner(ev.reason, 'warn');
+                        startDashboardLongPoll();
+                        return;
+                    }
+                    dashboardWSFailures++;
+                    // If we have a token, prefer reconnect with backoff instead of polling
+                    const token = (authToken || localStorage.getItem(CHARIOTEER_CONFIG.tokenKey) || '').trim();
+                    if (token && !dashboardWSForcedPolling && dashboardWSFailures < dashboardWSMaxFailures) {
+                        showDashboardStatusBanner('Realtime link lost, retrying…', 'warn');
+                        setTimeout(() => connectDashboardWS(), Math.min(dashboardWSBackoffMs, 30000));
+                        dashboardWSBackoffMs = Math.min(dashboardWSBackoffMs * 2, 30000);
+                        return;
+                    }
+                    // WS blocked or no token: long poll, which falls back to timer polling
+                    startDashboardLongPoll();
+                };
+                dashboardWS.onerror = (e) => {
+                    console.log('Dashboard WS error', e);
+                    // Try reconnect with backoff when token exists
+                    const token = (authToken || localStorage.getItem(CHARIOTEER_CONFIG.tokenKey) || '').trim();
+                    if (token && !dashboardWSForcedPolling) {
+                        // onclose follows and decides whether to retry or long poll
+                        showDashboardStatusBanner('Realtime error, retrying…', 'warn');
+                        try { dashboardWS.close(); } catch (e) {}
+                        return;
+                    }
+                    startDashboardLongPoll();
+                };
+            } catch (e) {
+                console.warn('WS connect failed, fallback to long polling', e);
+                // If we truly cannot WS at all (e.g., environment restrictions), switch to polling
+                dashboardWSForcedPolling = true;
+                startDashboardLongPoll();
+            }
+        }
+
+        // Delta stream state: the dashboard as of update dashboardWSSeq
+        let dashboardWSState = null;
+        let dashboardWSSeq = 0;
+
+        // Bring the dashboard state up to a stream message and return it, or
+        // null after a gap, when a full update is requested instead
+        function dashboardWSApply(msg) {
+            if (msg.type === 'full') {
+                dashboardWSState = msg.data;
+                dashboardWSSeq = msg.seq;
+                return dashboardWSState;
+            }
+            if (msg.type !== 'delta') return msg.data; // server without delta support
+            if (!dashboardWSState || msg.base !== dashboardWSSeq) {
+                dashboardWSResync();
+                return null;
+            }
+            try {
+                dashboardWSState = applyJSONPatch(dashboardWSState, msg.patch || []);
+            } catch (e) {
+                console.warn('Dashboard patch failed; resyncing', e);
+                dashboardWSResync();
+                return null;
+            }
+            dashboardWSSeq = msg.seq;
+            return dashboardWSState;
+        }
+
+        function dashboardWSResync() {
+            dashboardWSState = null;
+            try { if (dashboardWS) dashboardWS.send(JSON.stringify({ resync: true })); } catch (e) {}
+        }
+
+        // Apply RFC 6902 add, remove and replace operations to doc
+        function applyJSONPatch(doc, ops) {
+            for (const op of ops) {
+                const keys = op.path.split('/').slice(1).map(k => k.replace(/~1/g, '/').replace(/~0/g, '~'));
+                if (keys.length === 0) {
+                    if (op.op === 'remove') throw new Error('cannot remove the document');
+                    doc = op.value;
+                    continue;
+                }
+                let parent = doc;
+                for (const k of keys.slice(0, -1)) {
+                    parent = parent[Array.isArray(parent) ? Number(k) : k];
+                    if (parent === null || typeof parent !== 'object') throw new Error('no target for ' + op.path);
+                }
+                const last = keys[keys.length - 1];
+                if (Array.isArray(parent)) {
+                    const i = last === '-' ? parent.length : Number(last);
+                    if (op.op === 'add') parent.splice(i, 0, op.value);
+                    else if (op.op === 'remove') parent.splice(i, 1);
+                    else if (op.op === 'replace') parent[i] = op.value;
+                    else throw new Error('unsupported op ' + op.op);
+                } else if (op.op === 'remove') {
+                    delete parent[last];
+                } else if (op.op === 'add' || op.op === 'replace') {
+                    parent[last] = op.value;
+                } else {
+                    throw new Error('unsupported op ' + op.op);
+                }
+            }
+            return doc;
+        }
+
+        // Long-poll client, the second transport tier: each request is held
+        // until dashboard sections change and returns only those, which are
+        // merged into the last state. Repeated failures fall back to timer
+        // polling of the full status.
+        let dashboardPollCursor = '';
+        let dashboardPollState = {};
+        let dashboardPolling = false;
+
+        async function startDashboardLongPoll() {
+            if (dashboardPolling) return;
+            dashboardPolling = true;
+            let failures = 0;
+            while (dashboardPolling && currentTab === 'dashboard') {
+                try {
+                    const url = '/charioteer/api/dashboard/poll?cursor=' + encodeURIComponent(dashboardPollCursor);
+                    const response = await fetch(url, { headers: getAuthHeaders() });
+                    if (!response.ok) throw new Error(response.statusText || ('HTTP ' + response.status));
+                    const result = await response.json();
+                    if (result.result !== 'OK') throw new Error(result.data || 'Unknown error');
+                    const delta = result.data || {};
+                    const sections = delta.sections || {};
+                    if (delta.full) dashboardPollState = {};
+                    Object.assign(dashboardPollState, sections);
+                    dashboardPollCursor = delta.cursor || '';
+                    failures = 0;
+                    if (dashboardPolling && Object.keys(sections).length > 0) {
+                        updateDashboardUI(dashboardPollState);
+                        const dl = document.getElementById('dashboardLoading');
+                        const dc = document.getElementById('dashboardContent');
+                        if (dl) dl.style.display = 'none';
+                        if (dc) dc.style.display = 'block';
+                    }
+                } catch (e) {
+                    console.warn('Dashboard long poll failed', e);
+                    if (++failures >= 3) {
+                        dashboardPolling = false;
+                        showDashboardStatusBanner('Live dashboard unavailable, refreshing every 30 seconds', 'warn');
+                        startDashboardAutoRefresh();
+                        return;
+                    }
+                    await new Promise(resolve => setTimeout(resolve, 2000 * failures));
+                }
+            }
+            dashboardPolling = false;
+        }
+
+        function stopDashboardLongPoll() {
+            dashboardPolling = false;
+        }
+
+        // Fetch and update dashboard data (HTTP fallback)
+        async function fetchAndUpdateDashboard() {
+            try {
+                const dashboardError = document.getElementById('dashboardError');
+                const dashboardLoading = document.getElementById('dashboardLoading');
+                const dashboardContent = document.getElementById('dashboardContent');
+
+                if (dashboardError) dashboardError.style.display = 'none';
+                if (dashboardLoading) dashboardLoading.style.display = 'block';
+                if (dashboardContent) dashboardContent.style.display = 'none';
+
+                // Get auth headers
+                const headers = getAuthHeaders();
+                headers['Content-Type'] = 'application/json';
+
+                const response = await fetch('/charioteer/api/dashboard/status', {
+                    method: 'GET',
+                    headers: headers
+                });
+
+                if (!response.ok) {
+                    throw new Error('Failed to fetch dashboard data: ' + response.statusText);
+                }
+
+                const result = await response.json();
+                if (result.result !== 'OK') {
+                    throw new Error('Dashboard API error: ' + (result.data || 'Unknown error'));
+                }
+
+                // Update dashboard with data
+                console.log('Dashboard API response:', result.data);
+                updateDashboardUI(result.data);
+
+                if (dashboardLoading) dashboardLoading.style.display = 'none';
+                if (dashboardContent) dashboardContent.style.display = 'block';
+
+            } catch (error) {
+                console.error('Error fetching dashboard data:', error);
+                
+                const dashboardError = document.getElementById('dashboardError');
+                const dashboardLoading = document.getElementById('dashboardLoading');
+                const dashboardContent = document.getElementById('dashboardContent');
+
+                // Route error to Problems tab, keep banner hidden
+                showProblem('Failed to load dashboard data: ' + error.message, 'error');
+                if (dashboardError) { dashboardError.style.display = 'none'; }
+                if (dashboardLoading) dashboardLoading.style.display = 'none';
+                if (dashboardContent) dashboardContent.style.display = 'none';
+            }
+    }
+
+        // Function to format Go duration string to human readable format
+        function formatUptime(uptimeStr) {
+            if (!uptimeStr || uptimeStr === 'Unknown') return 'Unknown';
+            
+            // Parse Go duration string like "2h33m30.783968579s"
+            const timeUnits = {
+                'h': 'hour',
+                'm': 'minute', 
+                's': 'second'
+            };
+            
+            let result = [];
+            let remaining = uptimeStr;
+            
+            // Extract hours
+            const hourMatch = remaining.match(/(\d+)h/);
+            if (hourMatch) {
+                const hours = parseInt(hourMatch[1]);
+                if (hours > 0) {
+                    result.push(hours + ' ' + (hours === 1 ? 'hour' : 'hours'));
+                }
+                remaining = remaining.replace(/\d+h/, '');
+            }
+            
+            // Extract minutes
+            const minuteMatch = remaining.match(/(\d+)m/);
+            if (minuteMatch) {
+                const minutes = parseInt(minuteMatch[1]);
+                if (minutes > 0) {
+                    result.push(minutes + ' ' + (minutes === 1 ? 'minute' : 'minutes'));
+                }
+                remaining = remaining.replace(/\d+m/, '');
+            }
+            
+            // Extract seconds (only show if less than 1 hour)
+            const secondMatch = remaining.match(/(\d+(?:\.\d+)?)s/);
+            if (secondMatch && result.length === 0) {
+                const seconds = Math.floor(parseFloat(secondMatch[1]));
+                if (seconds > 0) {
+                    result.push(seconds + ' ' + (seconds === 1 ? 'second' : 'seconds'));
+                }
+            }
+            
+            return result.length > 0 ? result.slice(0, 2).join(', ') : 'Just started';
+        }
+
+        // End one session or all sessions of a user through the admin API
+        async function adminEndSessions(url, question) {
+            if (!confirm(question)) return;
+            try {
+                const resp = await fetch(url, { method: 'DELETE', headers: getAuthHeaders() });
+                const result = await resp.json().catch(() => ({}));
+                if (!resp.ok || result.result !== 'OK') {
+                    return alert('Log out failed: ' + (result.data || resp.statusText));
+                }
+                showOutput('Logged out ' + (result.data && result.data.user ? result.data.ended + ' session(s) of ' + result.data.user : 'session'), 'success');
+            } catch (err) {
+                return alert('Log out failed: ' + err.message);
+            }
+            fetchAndUpdateDashboard();
+        }
+
+        // Send a request to the account administration API and return its data,
+        // or alert and return null on failure
+        async function adminUsersRequest(method, path, body, what) {
+            const headers = getAuthHeaders();
+            const opts = { method: method, headers: headers };
+            if (body !== undefined) {
+                headers['Content-Type'] = 'application/json';
+                opts.body = JSON.stringify(body);
+            }
+            try {
+                const resp = await fetch('/charioteer/api/admin/users' + path, opts);
+                const result = await resp.json().catch(() => ({}));
+                if (!resp.ok || result.result !== 'OK') {
+                    alert(what + ' failed: ' + (result.data || resp.statusText));
+                    return null;
+                }
+                return result.data;
+            } catch (err) {
+                alert(what + ' failed: ' + err.message);
+                return null;
+            }
+        }
+
+        // Create the admin-only Users panel once, below the listeners
+        function renderUsersSection() {
+            const existing = document.getElementById('usersSection');
+            if (existing) {
+                existing.style.display = sessionIsAdmin ? '' : 'none';
+                return;
+            }
+            const container = document.querySelector('.dashboard-container');
+            if (!container) return;
+            const section = document.createElement('div');
+            section.id = 'usersSection';
+            section.className = 'sessions-section';
+            section.style.cssText = 'background: #2d2d30; border: 1px solid #3e3e42; border-radius: 8px; padding: 20px; margin-top: 20px;';
+            if (!sessionIsAdmin) section.style.display = 'none';
+            section.innerHTML = '' +
+                '<div style="display:flex; align-items:center; justify-content:space-between; margin: 0 0 20px 0;">' +
+                    '<h3 style="margin: 0; color: #569cd6; font-size: 18px;">Users</h3>' +
+                    '<div style="display:flex; gap:8px;">' +
+                        '<button id="createUserBtn" class="toolbar-button">Create</button>' +
+                        '<button id="refreshUsersBtn" class="toolbar-button">Refresh</button>' +
+                    '</div>' +
+                '</div>' +
+                '<div style="overflow-x: auto;">' +
+                    '<table style="width: 100%; border-collapse: collapse; color: #d4d4d4;">' +
+                        '<thead>' +
+                            '<tr style="border-bottom: 1px solid #3e3e42;">' +
+                                '<th style="text-align: left; padding: 12px; color: #569cd6;">User</th>' +
+                                '<th style="text-align: left; padding: 12px; color: #569cd6;">Name</th>' +
+                                '<th style="text-align: left; padding: 12px; color: #569cd6;">Roles</th>' +
+                                '<th style="text-align: left; padding: 12px; color: #569cd6;">Status</th>' +
+                                '<th style="text-align: left; padding: 12px; color: #569cd6;">Last Login</th>' +
+                                '<th style="text-align: left; padding: 12px; color: #569cd6;">Actions</th>' +
+                            '</tr>' +
+                        '</thead>' +
+                        '<tbody id="usersTableBody"></tbody>' +
+                    '</table>' +
+                '</div>';
+            container.appendChild(section);
+            document.getElementById('createUserBtn').onclick = createUserPrompt;
+            document.getElementById('refreshUsersBtn').onclick = refreshUsers;
+            if (sessionIsAdmin) refreshUsers();
+        }
+
+        let userRoles = ['admin', 'contributor', 'viewer'];
+
+        // Load the accounts into the Users panel
+        async function refreshUsers() {
+            const tbody = document.getElementById('usersTableBody');
+            if (!tbody) return;
+            const data = await adminUsersRequest('GET', '', undefined, 'Loading users');
+            if (!data) return;
+            if (Array.isArray(data.roles) && data.roles.length) userRoles = data.roles;
+            const list = data.users || [];
+            tbody.innerHTML = '';
+            if (list.length === 0) {
+                const row = document.createElement('tr');
+                row.innerHTML = '<td colspan="6" style="text-align:center; padding:20px; color:#888;">No accounts: logins are not checked until the first admin is created</td>';
+                tbody.appendChild(row);
+                return;
+            }
+            list.forEach(u => {
+                const row = document.createElement('tr');
+                row.style.borderBottom = '1px solid #3e3e42';
+                const lastLogin = u.last_login_at && !u.last_login_at.startsWith('0001') ? new Date(u.last_login_at).toLocaleString() : 'Never';
+                row.innerHTML =
+                    '<td style="padding:12px;">' + escapeHtml(u.user_id) + '</td>' +
+                    '<td style="padding:12px;" title="' + escapeHtml(u.email || '') + '">' + escapeHtml(u.display_name || '-') + '</td>' +
+                    '<td style="padding:12px;">' + escapeHtml((u.roles || []).join(', ') || '-') + '</td>' +
+                    '<td style="padding:12px; color: ' + (u.disabled ? '#f44747' : '#4ec9b0') + ';">' + (u.disabled ? 'Disabled' : 'Active') + (u.mfa_enabled ? ' (2FA)' : '') + '</td>' +
+                    '<td style="padding:12px;">' + escapeHtml(lastLogin) + '</td>' +
+                    '<td style="padding:12px; white-space: nowrap;">' +
+                        '<button class="toolbar-button" data-act="toggle">' + (u.disabled ? 'Enable' : 'Disable') + '</button> ' +
+                        '<button class="toolbar-button" data-act="roles">Roles</button> ' +
+                        '<button class="toolbar-button" data-act="password">Reset password</button> ' +
+                        (u.mfa_enabled ? '<button class="toolbar-button" data-act="mfa">Reset 2FA</button> ' : '') +
+                        '<button class="toolbar-button" data-act="delete" style="background-color:#dc3545;">Delete</button>' +
+                    '</td>';
+                const path = '/' + encodeURIComponent(u.user_id);
+                row.querySelector('button[data-act="toggle"]').onclick = async () => {
+                    if (!u.disabled && !confirm('Disable ' + u.user_id + ' and log out their sessions?')) return;
+                    if (await adminUsersRequest('PUT', path, { disabled: !u.disabled }, 'Update')) refreshUsers();
+                };
+                row.querySelector('button[data-act="roles"]').onclick = async () => {
+                    const input = prompt('Roles for ' + u.user_id + ' (comma separated: ' + userRoles.join(', ') + ')', (u.roles || []).join(', '));
+                    if (input === null) return;
+                    const roles = input.split(',').map(r => r.trim()).filter(Boolean);
+                    if (await adminUsersRequest('PUT', path, { roles: roles }, 'Update')) refreshUsers();
+                };
+                row.querySelector('button[data-act="password"]').onclick = async () => {
+                    const input = prompt('New password for ' + u.user_id + ' (leave empty to generate one)', '');
+                    if (input === null) return;
+                    const data = await adminUsersRequest('POST', path + '/password', { password: input }, 'Password reset');
+                    if (!data) return;
+                    if (data.password) {
+                        prompt('Password for ' + u.user_id + ' (shown once):', data.password);
+                    } else {
+                        showOutput('Password reset for ' + u.user_id, 'success');
+                    }
+                };
+                const mfaBtn = row.querySelector('button[data-act="mfa"]');
+                if (mfaBtn) mfaBtn.onclick = async () => {
+                    if (!confirm('Remove the two-factor authentication of ' + u.user_id + '? They can log in with their password alone until they set it up again.')) return;
+                    if (await adminUsersRequest('DELETE', path + '/mfa', undefined, 'Two-factor reset')) refreshUsers();
+                };
+                row.querySelector('button[data-act="delete"]').onclick = async () => {
+                    if (!confirm('Delete the account ' + u.user_id + '?')) return;
+                    if (await adminUsersRequest('DELETE', path, undefined, 'Delete')) refreshUsers();
+                };
+                tbody.appendChild(row);
+            });
+        }
+
+        // Send a request to the execution trace API and return its result, or
+        // alert and return null on failure
+        async function tracesRequest(method, path, body, what) {
+            const headers = getAuthHeaders();
+            const opts = { method: method, headers: headers };
+            if (body !== undefined) {
+                headers['Content-Type'] = 'application/json';
+                opts.body = JSON.stringify(body);
+            }
+            try {
+                const resp = await fetch('/charioteer/api/traces' + path, opts);
+                const result = await resp.json().catch(() => ({}));
+                if (!resp.ok || result.result !== 'OK') {
+                    alert(what + ' failed: ' + (result.data || resp.statusText));
+                    return null;
+                }
+                return result;
+            } catch (err) {
+                alert(what + ' failed: ' + err.message);
+                return null;
+            }
+        }
+
+        // Create the Execution Traces panel once, below the listeners
+        function renderTracesSection() {
+            if (document.getElementById('tracesSection')) return;
+            const container = document.querySelector('.dashboard-container');
+            if (!container) return;
+            const section = document.createElement('div');
+            section.id = 'tracesSection';
+            section.className = 'sessions-section';
+            section.style.cssText = 'background: #2d2d30; border: 1px solid #3e3e42; border-radius: 8px; padding: 20px; margin-top: 20px;';
+            section.innerHTML = '' +
+                '<div style="display:flex; align-items:center; justify-content:space-between; margin: 0 0 20px 0;">' +
+                    '<h3 style="margin: 0; color: #569cd6; font-size: 18px;">Execution Traces</h3>' +
+                    '<button id="refreshTracesBtn" class="toolbar-button">Refresh</button>' +
+                '</div>' +
+                '<div style="overflow-x: auto;">' +
+                    '<table style="width: 100%; border-collapse: collapse; color: #d4d4d4;">' +
+                        '<thead>' +
+                            '<tr style="border-bottom: 1px solid #3e3e42;">' +
+                                '<th style="text-align: left; padding: 12px; color: #569cd6;">Trace</th>' +
+                                '<th style="text-align: left; padding: 12px; color: #569cd6;">Recorded</th>' +
+                                '<th style="text-align: left; padding: 12px; color: #569cd6;">By</th>' +
+                                '<th style="text-align: left; padding: 12px; color: #569cd6;">Actions</th>' +
+                            '</tr>' +
+                        '</thead>' +
+                        '<tbody id="tracesTableBody"></tbody>' +
+                    '</table>' +
+                '</div>';
+            container.appendChild(section);
+            document.getElementById('refreshTracesBtn').onclick = refreshTraces;
+            refreshTraces();
+        }
+
+        // Load the traces recorded by the user's runs and by listeners
+        async function refreshTraces() {
+            const tbody = document.getElementById('tracesTableBody');
+            if (!tbody) return;
+            const result = await tracesRequest('GET', '', undefined, 'Loading traces');
+            if (!result) return;
+            const list = result.data || [];
+            tbody.innerHTML = '';
+            if (list.length === 0) {
+                const row = document.createElement('tr');
+                row.innerHTML = '<td colspan="4" style="text-align:center; padding:20px; color:#888;">No traces: tick Record before running, or set a listener to record</td>';
+                tbody.appendChild(row);
+                return;
+            }
+            list.forEach(tr => {
+                const row = document.createElement('tr');
+                row.style.borderBottom = '1px solid #3e3e42';
+                row.innerHTML =
+                    '<td style="padding:12px;">' + escapeHtml(tr.name) + '</td>' +
+                    '<td style="padding:12px;">' + escapeHtml(new Date(tr.created).toLocaleString()) + '</td>' +
+                    '<td style="padding:12px;">' + (tr.shared ? 'Listener' : 'You') + '</td>' +
+                    '<td style="padding:12px; white-space: nowrap;">' +
+                        '<button class="toolbar-button" data-act="replay">Replay</button> ' +
+                        '<button class="toolbar-button" data-act="details">Details</button> ' +
+                        '<button class="toolbar-button" data-act="delete" style="background-color:#dc3545;">Delete</button>' +
+                    '</td>';
+                const path = '/' + encodeURIComponent(tr.name);
+                row.querySelector('button[data-act="replay"]').onclick = () => replayTrace(tr.name);
+                row.querySelector('button[data-act="details"]').onclick = async () => {
+                    const result = await tracesRequest('GET', path, undefined, 'Loading trace');
+                    if (!result) return;
+                    const t = result.data;
+                    const calls = (t.calls || []).map((c, i) => (i + 1) + '. ' + c.func + (c.error ? ' -> error: ' + c.error : ''));
+                    switchTab('output');
+                    showOutput('Trace ' + t.name + (t.source ? ' (' + t.source + ')' : '') +
+                        (t.error ? '\nRecorded error: ' + t.error : '') +
+                        '\n\nProgram:\n' + (t.program || '') +
+                        '\n\nRecorded calls:\n' + (calls.join('\n') || 'none'), 'info');
+                };
+                row.querySelector('button[data-act="delete"]').onclick = async () => {
+                    if (!confirm('Delete the trace ' + tr.name + '?')) return;
+                    if (await tracesRequest('DELETE', path, undefined, 'Delete')) refreshTraces();
+                };
+                tbody.appendChild(row);
+            });
+        }
+
+        // Run a trace again with its recorded inputs and show how it went
+        async function replayTrace(name) {
+            const result = await tracesRequest('POST', '/' + encodeURIComponent(name) + '/replay', {}, 'Replay');
+            if (!result) return;
+            const r = result.data || {};
+            const summary = 'Replayed ' + name + ' (' + r.calls_used + ' of ' + r.calls_recorded + ' recorded calls): ' +
+                (r.reproduced ? 'same outcome as recorded' : 'different outcome from recorded');
+            switchTab('output');
+            if (r.error) {
+                showOutput(summary + '\nError: ' + r.error, 'error');
+                reportScriptError(result.error);
+            } else {
+                showOutput(summary + '\nResult: ' + JSON.stringify(r.result, null, 2), r.reproduced ? 'success' : 'error');
+            }
+        }
+
+        // POST to the caller's account API and return its data, or alert and
+        // return null on failure
+        async function accountRequest(path, body, what) {
+            const headers = getAuthHeaders();
+            headers['Content-Type'] = 'application/json';
+            try {
+                const resp = await fetch('/charioteer/api/account' + path, { method: 'POST', headers: headers, body: JSON.stringify(body || {}) });
+                const result = await resp.json().catch(() => ({}));
+                if (!resp.ok || result.result !== 'OK') {
+                    alert(what + ' failed: ' + (result.data || resp.statusText));
+                    return null;
+                }
+                return result.data;
+            } catch (err) {
+                alert(what + ' failed: ' + err.message);
+                return null;
+            }
+        }
+
+        // Show the caller's password and second factor controls when the
+        // session has an account
+        function renderAccountSection() {
+            let section = document.getElementById('accountSection');
+            if (!section) {
+                const container = document.querySelector('.dashboard-container');
+                if (!container) return;
+                section = document.createElement('div');
+                section.id = 'accountSection';
+                section.className = 'sessions-section';
+                section.style.cssText = 'background: #2d2d30; border: 1px solid #3e3e42; border-radius: 8px; padding: 20px; margin-top: 20px;';
+                container.appendChild(section);
+            }
+            if (!accountProfile) {
+                section.style.display = 'none';
+                return;
+            }
+            section.style.display = '';
+            // Dashboard updates arrive often; keep an enrollment in progress
+            const state = JSON.stringify(accountProfile);
+            if (section.dataset.state === state) return;
+            section.dataset.state = state;
+            const expires = accountProfile.passwordExpiresAt ? new Date(accountProfile.passwordExpiresAt).toLocaleDateString() : 'never';
+            section.innerHTML =
+                '<div style="display:flex; align-items:center; justify-content:space-between;">' +
+                    '<h3 style="margin: 0; color: #569cd6; font-size: 18px;">My Account</h3>' +
+                    '<div style="display:flex; gap:8px;">' +
+                        '<button id="changePasswordBtn" class="toolbar-button">Change password</button>' +
+                        '<button id="mfaBtn" class="toolbar-button">' + (accountProfile.mfaEnabled ? 'Remove two-factor' : 'Set up two-factor') + '</button>' +
+                    '</div>' +
+                '</div>' +
+                '<div style="margin-top: 12px; color: #d4d4d4;">Two-factor authentication: ' +
+                    (accountProfile.mfaEnabled ? '<span style="color:#4ec9b0;">on</span>' : '<span style="color:#888;">off</span>') +
+                    ' &middot; Password expires: ' + escapeHtml(expires) +
+                '</div>' +
+                '<div id="mfaEnrollment" style="display:none; margin-top: 16px;"></div>';
+            document.getElementById('changePasswordBtn').onclick = changePasswordPrompt;
+            document.getElementById('mfaBtn').onclick = accountProfile.mfaEnabled ? disableMFAPrompt : startMFAEnrollment;
+        }
+
+        async function changePasswordPrompt() {
+            const current = prompt('Current password:');
+            if (!current) return;
+            const next = prompt('New password:');
+            if (!next) return;
+            if (prompt('Repeat the new password:') !== next) return alert('The new passwords do not match');
+            if (await accountRequest('/password', { current_password: current, new_password: next }, 'Password change')) {
+                showOutput('Password changed', 'success');
+                await fetchSessionProfile();
+                renderAccountSection();
+            }
+        }
+
+        async function startMFAEnrollment() {
+            const data = await accountRequest('/mfa/enroll', {}, 'Two-factor setup');
+            if (!data) return;
+            const box = document.getElementById('mfaEnrollment');
+            if (!box) return;
+            box.style.display = 'block';
+            box.innerHTML =
+                '<div style="display:flex; gap:20px; align-items:flex-start;">' +
+                    '<img id="mfaQr" alt="QR code" style="width:200px; height:200px; background:#fff;"/>' +
+                    '<div style="display:flex; flex-direction:column; gap:8px; color:#d4d4d4;">' +
+                        '<div>Scan the code with an authenticator app, or enter this key:</div>' +
+                        '<code style="user-select:all;">' + escapeHtml(data.secret) + '</code>' +
+                        '<input id="mfaCode" placeholder="6-digit code" autocomplete="one-time-code" style="padding:8px; width:140px; background:#1e1e1e; color:#d4d4d4; border:1px solid #3e3e42; border-radius:4px;"/>' +
+                        '<div style="display:flex; gap:8px;">' +
+                            '<button id="mfaConfirmBtn" class="toolbar-button">Confirm</button>' +
+                            '<button id="mfaCancelBtn" class="toolbar-button">Cancel</button>' +
+                        '</div>' +
+                    '</div>' +
+                '</div>';
+            // The QR endpoint needs the auth header, so load it as a blob
+            try {
+                const resp = await fetch('/charioteer/api/account/mfa/qr', { headers: getAuthHeaders() });
+                if (resp.ok) document.getElementById('mfaQr').src = URL.createObjectURL(await resp.blob());
+            } catch (err) {
+                console.warn('Failed to load the enrollment QR code', err);
+            }
+            document.getElementById('mfaCancelBtn').onclick = () => { box.style.display = 'none'; box.innerHTML = ''; };
+            document.getElementById('mfaConfirmBtn').onclick = async () => {
+                const code = document.getElementById('mfaCode').value.trim();
+                if (!code) return;
+                const result = await accountRequest('/mfa/confirm', { code: code }, 'Two-factor setup');
+                if (!result) return;
+                prompt('Two-factor authentication is on. Save these recovery codes; each works once in place of a code and they are not shown again:', (result.recovery_codes || []).join(' '));
+                await fetchSessionProfile();
+                renderAccountSection();
+            };
+        }
+
+        async function disableMFAPrompt() {
+            const code = prompt('Enter a code from your authenticator app (or a recovery code) to remove two-factor authentication:');
+            if (!code) return;
+            if (await accountRequest('/mfa/disable', { code: code.trim() }, 'Removing two-factor')) {
+                showOutput('Two-factor authentication removed', 'success');
+                await fetchSessionProfile();
+                renderAccountSection();
+            }
+        }
+
+        async function createUserPrompt() {
+            const id = prompt('User ID for the new account');
+            if (!id) return;
+            const name = prompt('Display name (optional)', '');
+            if (name === null) return;
+            const input = prompt('Roles (comma separated: ' + userRoles.join(', ') + ')', 'contributor');
+            if (input === null) return;
+            const roles = input.split(',').map(r => r.trim()).filter(Boolean);
+            const data = await adminUsersRequest('POST', '', { user_id: id.trim(), display_name: name, roles: roles }, 'Create');
+            if (!data) return;
+            if (data.password) {
+                prompt('Password for ' + id + ' (shown once):', data.password);
+            }
+            refreshUsers();
+        }
+
+        // Update dashboard UI with data
+        function updateDashboardUI(data) {
+            // Update metrics - map from actual API response structure
+            const activeSessions = document.getElementById('activeSessions');
+            const totalSessions = document.getElementById('totalSessions');
+            const uptime = document.getElementById('uptime');
+            const systemStatus = document.getElementById('systemStatus');
+
+            // Map from go-chariot API response structure
+            if (activeSessions) activeSessions.textContent = (data.session_stats && data.session_stats.active_count) || 0;
+            if (totalSessions) totalSessions.textContent = (data.session_stats && data.session_stats.active_count) || 0; // Using active_count as total for now
+            if (uptime) uptime.textContent = formatUptime((data.server_status && data.server_status.uptime) || 'Unknown');
+            if (systemStatus) systemStatus.textContent = (data.server_status && data.server_status.status) || 'Unknown';
+
+            // Update sessions table
+            const tbody = document.getElementById('sessionsTableBody');
+            if (tbody) {
+                tbody.innerHTML = '';
+                
+                console.log('Active sessions data:', data.active_sessions);
+                console.log('Active sessions length:', data.active_sessions ? data.active_sessions.length : 'undefined');
+
+                if (data.active_sessions && data.active_sessions.length > 0) {
+                    const fmt = (iso) => {
+                        if (!iso) return 'Unknown';
+                        const d = new Date(iso);
+                        if (isNaN(d)) return 'Unknown';
+                        return d.toLocaleString(undefined, { year: 'numeric', month: 'short', day: '2-digit', hour: 'numeric', minute: '2-digit' });
+                    };
+
+                    data.active_sessions.forEach(session => {
+                        const row = document.createElement('tr');
+                        row.style.borderBottom = '1px solid #3e3e42';
+                        const sid = session.session_id || session.sessionId || session.id || 'Unknown';
+                        const status = session.status || ((session.expires_at && new Date(session.expires_at) > new Date()) ? 'active' : 'expired');
+                        row.innerHTML = 
+                            '<td style="padding: 12px;">' + escapeHtml(session.username || session.user_id || 'Unknown') + '</td>' +
+                            '<td style="padding: 12px;">' + escapeHtml(sid !== 'Unknown' ? (sid.substring(0, 8) + '...') : 'Unknown') + '</td>' +
+                            '<td style="padding: 12px;">' + escapeHtml(fmt(session.created)) + '</td>' +
+                            '<td style="padding: 12px;">' + escapeHtml(fmt(session.last_access || session.lastSeen || session.last_accessed)) + '</td>' +
+                            '<td style="padding: 12px;" title="' + escapeHtml(session.user_agent || '') + '">' + escapeHtml(session.remote_addr || '-') + '</td>' +
+                            '<td style="padding: 12px;" title="' + escapeHtml(session.last_script ? (session.executions + ' executions, last ' + fmt(session.last_executed)) : '') + '">' +
+                                escapeHtml(session.last_script || '-') + (session.running ? ' (running)' : '') + '</td>' +
+                            '<td style="padding: 12px; color: ' + (status === 'active' ? '#4ec9b0' : '#f44747') + ';">' + 
+                            (status === 'active' ? 'Active' : 'Expired') + '</td>' +
+                            '<td style="padding: 12px; white-space: nowrap;">' +
+                                '<button class="toolbar-button" data-act="end">Log out</button> ' +
+                                '<button class="toolbar-button" data-act="end-user">Log out user</button>' +
+                            '</td>';
+                        const user = session.user_id || '';
+                        row.querySelector('button[data-act="end"]').onclick = () => {
+                            if (!session.ref) return alert('This backend does not support ending sessions');
+                            adminEndSessions('/charioteer/api/admin/sessions/' + encodeURIComponent(session.ref), 'Log out this session of ' + user + '?');
+                        };
+                        row.querySelector('button[data-act="end-user"]').onclick = () => {
+                            adminEndSessions('/charioteer/api/admin/users/' + encodeURIComponent(user) + '/sessions', 'Log out every session of ' + user + '?');
+                        };
+                        tbody.appendChild(row);
+                    });
+                } else {
+                    const row = document.createElement('tr');
+                    row.innerHTML = '<td colspan="8" style="text-align: center; padding: 20px; color: #888;">No sessions found</td>';
+                    tbody.appendChild(row);
+                }
+            }
+
+                        // Render listeners grid under sessions
+            const existing = document.getElementById('listenersSection');
+            if (!existing) {
+                const container = document.querySelector('.dashboard-container');
+                if (container) {
+                                        const section = document.createElement('div');
+                                        section.id = 'listenersSection';
+                                        // Match the Sessions panel styling exactly
+                                        section.className = 'sessions-section';
+                                        section.style.cssText = 'background: #2d2d30; border: 1px solid #3e3e42; border-radius: 8px; padding: 20px; margin-top: 20px;';
+                                        if (!featureEnabled('enable_listeners')) section.style.display = 'none';
+                                        section.innerHTML = ''+
+                                            '<div style="display:flex; align-items:center; justify-content:space-between; margin: 0 0 20px 0;">' +
+                                                '<h3 style="margin: 0; color: #569cd6; font-size: 18px;">Listeners</h3>' +
+                                                '<div style="display:flex; gap:8px;">' +
+                                                    '<button id="createListenerBtn" class="toolbar-button">Create</button>' +
+                                                    '<button id="deleteListenerBtn" class="toolbar-button">Delete</button>' +
+                                                '</div>' +
+                                            '</div>' +
+                                            '<div style="overflow-x: auto;">' +
+                                                '<table style="width: 100%; border-collapse: collapse; color: #d4d4d4;">' +
+                                                    '<thead>' +
+                                                        '<tr style="border-bottom: 1px solid #3e3e42;">' +
+                                                            '<th style="text-align: left; padding: 12px; vertical-align: middle; width: 34px;">' +
+                                                                '<div style="display:flex; align-items:center;">' +
+                                                                    '<input type="checkbox" id="listenersSelectAll" style="margin:0;"/>' +
+                                                                '</div>' +
+                                                            '</th>' +
+                                                            '<th style="text-align: left; padding: 12px; color: #569cd6;">Name</th>' +
+                                                            '<th style="text-align: left; padding: 12px; color: #569cd6;">Status</th>' +
+                                                            '<th style="text-align: left; padding: 12px; color: #569cd6;">Auto Start</th>' +
+                                                            '<th style="text-align: left; padding: 12px; color: #569cd6;">Health</th>' +
+                                                            '<th style="text-align: left; padding: 12px; color: #569cd6;">Actions</th>' +
+                                                        '</tr>' +
+                                                    '</thead>' +
+                                                    '<tbody id="listenersTableBody">' +
+                                                    '</tbody>' +
+                                                '</table>' +
+                                            '</div>' +
+                                                // Delete confirm modal
+                                                '<div id="listenerDeleteConfirmOverlay" style="display:none; position:fixed; inset:0; background:rgba(0,0,0,0.5); z-index:10000; align-items:center; justify-content:center;">'+
+                                                    '<div style="background:#252526; color:#d4d4d4; border:1px solid #3e3e42; border-radius:6px; width:420px; max-width:90vw; box-shadow:0 6px 18px rgba(0,0,0,0.4);">'+
+                                                        '<div style="padding:14px 16px; border-bottom:1px solid #3e3e42; font-weight:600;">Confirm Delete</div>'+ 
+                                                        '<div style="padding:16px;">Delete selected Listeners?</div>'+ 
+                                                        '<div style="padding:12px 16px; border-top:1px solid #3e3e42; display:flex; justify-content:flex-end; gap:8px;">'+ 
+                                                            '<button id="listenerDeleteCancel" class="toolbar-button">Cancel</button>'+ 
+                                                            '<button id="listenerDeleteOk" class="toolbar-button" style="background-color:#dc3545;">OK</button>'+ 
+                                                        '</div>'+ 
+                                                    '</div>'+ 
+                                                '</div>'+
+                                                // Modal root
+                                                '<div id="listenerModalOverlay" style="display:none; position:fixed; inset:0; background:rgba(0,0,0,0.5); z-index:9999; align-items:center; justify-content:center;">'+
+                                                    '<div id="listenerModal" style="background:#252526; color:#d4d4d4; border:1px solid #3e3e42; border-radius:6px; width:520px; max-width:90vw; box-shadow:0 6px 18px rgba(0,0,0,0.4);">'+
+                                                        '<div style="padding:12px 16px; border-bottom:1px solid #3e3e42; display:flex; justify-content:space-between; align-items:center;">'+
+                                                            '<div id="listenerModalTitle" style="font-weight:600;">Create Listener</div>'+
+                                                            '<button id="listenerModalClose" class="toolbar-button">Close</button>'+ 
+                                                        '</div>'+ 
+                                                        '<div style="padding:16px; display:flex; flex-direction:column; gap:10px;">'+
+                                                            '<label style="display:flex; flex-direction:column; gap:4px;">Name<input id="listenerName" placeholder="orders-listener" style="padding:8px; background:#1e1e1e; color:#d4d4d4; border:1px solid #3e3e42; border-radius:4px;"/></label>'+ 
+                                                            '<label style="display:flex; flex-direction:column; gap:4px;">On Start<select id="listenerOnStartSelect" style="padding:8px; background:#1e1e1e; color:#d4d4d4; border:1px solid #3e3e42; border-radius:4px;"></select></label>'+ 
+                                                            '<label style="display:flex; flex-direction:column; gap:4px;">On Exit<select id="listenerOnExitSelect" style="padding:8px; background:#1e1e1e; color:#d4d4d4; border:1px solid #3e3e42; border-radius:4px;"></select></label>'+ 
+                                                            '<label style="display:flex; align-items:center; gap:8px;"><input type="checkbox" id="listenerAutoStart"/> Auto Start</label>'+ 
+                                                        '</div>'+ 
+                                                        '<div style="padding:12px 16px; border-top:1px solid #3e3e42; display:flex; justify-content:flex-end; gap:8px;">'+ 
+                                                            '<button id="listenerModalCancel" class="toolbar-button">Cancel</button>'+ 
+                                                            '<button id="listenerModalSave" class="toolbar-button">Save</button>'+ 
+                                                        '</div>'+ 
+                                                    '</div>'+ 
+                                                '</div>';
+                                        container.appendChild(section);
+                                        // Bind all Listeners panel handlers once elements exist
+                                        bindListenersPanelHandlers();
+                }
+            }
+            const lbody = document.getElementById('listenersTableBody');
+            if (lbody) {
+                lbody.innerHTML = '';
+                const listeners = (data && data.listeners) || [];
+                if (listeners.length === 0) {
+                    const row = document.createElement('tr');
+                    row.innerHTML = '<td colspan="6" style="text-align:center; padding:20px; color:#888;">No listeners</td>';
+                    lbody.appendChild(row);
+                } else {
+                    listeners.forEach(ls => {
+                        const row = document.createElement('tr');
+                        row.style.borderBottom = '1px solid #3e3e42';
+                        const status = ls.status || 'stopped';
+                        const health = ls.is_healthy ? 'Healthy' : 'Unhealthy';
+                        const isChecked = selectedListeners.has(ls.name || '');
+                        row.innerHTML =
+                            '<td style="padding:12px; width:34px; vertical-align:middle;">' +
+                                '<div style="display:flex; align-items:center;">' +
+                                    '<input type="checkbox" class="listenerRowChk" data-name="' + (ls.name || '') + '" style="margin:0;" ' + (isChecked ? 'checked' : '') + '/>' +
+                                '</div>' +
+                            '</td>'+
+                            '<td style="padding:12px;">' + escapeHtml(ls.name || '') + '</td>'+
+                            '<td style="padding:12px;">' + '<span style="color:' + (status==='running'?'#4ec9b0':'#f44747') + '">' + status + '</span></td>'+
+                            '<td style="padding:12px;">' + (ls.auto_start ? 'Yes' : 'No') + '</td>'+ 
+                            '<td style="padding:12px;">' + health + '</td>'+ 
+                            '<td style="padding:12px;">' +
+                                '<button class="toolbar-button" data-act="start">Start</button> ' +
+                                '<button class="toolbar-button" data-act="stop">Exit</button>' +
+                            '</td>';
+                        // Wire actions
+                        setTimeout(() => {
+                            const startBtn = row.querySelector('button[data-act="start"]');
+                            const stopBtn = row.querySelector('button[data-act="stop"]');
+                            const chk = row.querySelector('input.listenerRowChk');
+                            if (chk) {
+                                chk.addEventListener('change', (ev) => {
+                                    const name = chk.getAttribute('data-name') || '';
+                                    if (chk.checked) selectedListeners.add(name); else selectedListeners.delete(name);
+                                    // Update header checkbox tri-state
+                                    updateListenersHeaderCheckboxState(listeners);
+                                });
+                            }
+                            if (startBtn) startBtn.onclick = async () => {
+                                const resp = await fetch('/charioteer/api/listener/start?name=' + encodeURIComponent(ls.name), { method:'POST', headers: getAuthHeaders() });
+                                if (!resp.ok) { const t = await resp.text(); return alert('Start failed: ' + t); }
+                                fetchAndUpdateDashboard();
+                            };
+                            if (stopBtn) stopBtn.onclick = async () => {
+                                const resp = await fetch('/charioteer/api/listener/stop?name=' + encodeURIComponent(ls.name), { method:'POST', headers: getAuthHeaders() });
+                                if (!resp.ok) { const t = await resp.text(); return alert('Stop failed: ' + t); }
+                                fetchAndUpdateDashboard();
+                            };
+                        }, 0);
+                        lbody.appendChild(row);
+                    });
+                    // Update header checkbox based on selection
+                    updateListenersHeaderCheckboxState(listeners);
+                }
+            }
+
+            renderUsersSection();
+            renderAccountSection();
+            renderTracesSection();
+        }
+
+        function updateListenersHeaderCheckboxState(listeners) {
+            const selAll = document.getElementById('listenersSelectAll');
+            if (!selAll) return;
+            const names = (listeners || []).map(ls => ls.name || '');
+            const allSelected = names.length > 0 && names.every(n => selectedListeners.has(n));
+            const noneSelected = names.every(n => !selectedListeners.has(n));
+            selAll.indeterminate = !allSelected && !noneSelected;
+            selAll.checked = allSelected;
+        }
+
+        function bindListenersPanelHandlers() {
+            const openModal = () => { const o = document.getElementById('listenerModalOverlay'); if (o) { o.style.display='flex'; }};
+            const closeModal = () => { const o = document.getElementById('listenerModalOverlay'); if (o) { o.style.display='none'; }};
+            const createBtn = document.getElementById('createListenerBtn');
+            const deleteBtn = document.getElementById('deleteListenerBtn');
+            const modalClose = document.getElementById('listenerModalClose');
+            const modalCancel = document.getElementById('listenerModalCancel');
+            const modalSave = document.getElementById('listenerModalSave');
+            const selAll = document.getElementById('listenersSelectAll');
+            const delOverlay = document.getElementById('listenerDeleteConfirmOverlay');
+            const delCancel = document.getElementById('listenerDeleteCancel');
+            const delOk = document.getElementById('listenerDeleteOk');
+
+            if (modalClose) modalClose.onclick = closeModal;
+            if (modalCancel) modalCancel.onclick = closeModal;
+            if (modalSave) modalSave.onclick = async () => {
+                const name = (document.getElementById('listenerName').value || '').trim();
+                const onStartSelect = document.getElementById('listenerOnStartSelect');
+                const onExitSelect = document.getElementById('listenerOnExitSelect');
+                const autoStart = !!(document.getElementById('listenerAutoStart') && document.getElementById('listenerAutoStart').checked);
+                const onStart = onStartSelect ? (onStartSelect.value || '').trim() : '';
+                const onExit = onExitSelect ? (onExitSelect.value || '').trim() : '';
+                if (!name) { alert('Name is required'); return; }
+                const resp = await fetch('/charioteer/api/listeners', {
+                    method: 'POST',
+                    headers: Object.assign({'Content-Type':'application/json'}, getAuthHeaders()),
+                    body: JSON.stringify({ name, on_start: onStart, on_exit: onExit, auto_start: autoStart })
+                });
+                if (!resp.ok) { const t = await resp.text(); alert('Create failed: ' + t); return; }
+                closeModal();
+                fetchAndUpdateDashboard();
+            };
+
+            if (createBtn) createBtn.onclick = async () => {
+                const t = document.getElementById('listenerModalTitle'); if (t) t.textContent = 'Create Listener';
+                const fields = ['listenerName'];
+                fields.forEach(id => { const el = document.getElementById(id); if (el) el.value = ''; });
+                // Populate dropdowns from Files list
+                try {
+                    const url = getAPIPath('/api/files?folder=' + encodeURIComponent(CHARIOT_FILES_FOLDER));
+                    const response = await fetch(url, { headers: getAuthHeaders() });
+                    if (response.ok) {
+                        const result = await response.json();
+                        const files = (result && result.result === 'OK') ? result.data : [];
+                        const startSel = document.getElementById('listenerOnStartSelect');
+                        const exitSel = document.getElementById('listenerOnExitSelect');
+                        if (startSel) { startSel.innerHTML = '<option value="">Select a file...</option>'; }
+                        if (exitSel) { exitSel.innerHTML = '<option value="">Select a file...</option>'; }
+                        (files || []).forEach(file => {
+                            const opt1 = document.createElement('option'); opt1.value = file; opt1.textContent = file; if (startSel) startSel.appendChild(opt1);
+                            const opt2 = document.createElement('option'); opt2.value = file; opt2.textContent = file; if (exitSel) exitSel.appendChild(opt2);
+                        });
+                    }
+                } catch (e) { /* ignore */ }
+                openModal();
+            };
+            if (deleteBtn) deleteBtn.onclick = () => {
+                const names = Array.from(selectedListeners);
+                if (names.length === 0) { alert('Select one or more listeners to delete.'); return; }
+                if (delOverlay) delOverlay.style.display = 'flex';
+            };
+            if (delCancel) delCancel.onclick = () => { if (delOverlay) delOverlay.style.display = 'none'; };
+            if (delOk) delOk.onclick = async () => {
+                const names = Array.from(selectedListeners);
+                if (names.length === 0) { if (delOverlay) delOverlay.style.display = 'none'; return; }
+                // Optimistically remove from UI first
+                const lbody = document.getElementById('listenersTableBody');
+                if (lbody) {
+                    names.forEach(n => {
+                        const row = lbody.querySelector('input.listenerRowChk[data-name="' + CSS.escape(n) + '"]');
+                        if (row) {
+                            const tr = row.closest('tr');
+                            if (tr) tr.remove();
+                        }
+                    });
+                }
+                // Call backend to delete from registry JSON
+                for (const n of names) {
+                    const resp = await fetch('/charioteer/api/listener/delete?name=' + encodeURIComponent(n), { method: 'POST', headers: getAuthHeaders() });
+                    if (!resp.ok) {
+                        const t = await resp.text();
+                        alert('Delete failed for ' + n + ': ' + t);
+                        if (delOverlay) delOverlay.style.display = 'none';
+                        return;
+                    }
+                    selectedListeners.delete(n);
+                }
+                if (delOverlay) delOverlay.style.display = 'none';
+                // Refresh to reflect backend state
+                fetchAndUpdateDashboard();
+            };
+            if (selAll) selAll.onclick = () => {
+                const lbody = document.getElementById('listenersTableBody');
+                const checks = lbody ? Array.from(lbody.querySelectorAll('.listenerRowChk')) : [];
+                if (selAll.checked) {
+                    checks.forEach(chk => { chk.checked = true; selectedListeners.add(chk.getAttribute('data-name') || ''); });
+                } else {
+                    checks.forEach(chk => { chk.checked = false; selectedListeners.delete(chk.getAttribute('data-name') || ''); });
+                }
+                // Update indeterminate explicitly
+                selAll.indeterminate = false;
+            };
+        }
+
+        function escapeHtml(text) {
+            const div = document.createElement('div');
+            div.textContent = text;
+            return div.innerHTML;
+        }
+
@@ -0,0 +1,742 @@
+        // Toggle between runtime inspection and debugger panels
+        function showDebuggerPanel() {
+            const runtimePanel = document.getElementById('runtimePanel');
+            const debuggerPanel = document.getElementById('debuggerPanel');
+            if (runtimePanel && debuggerPanel) {
+                runtimePanel.style.display = 'none';
+                debuggerPanel.style.display = 'block';
+            } else {
+                console.error('Panels not found:', { runtimePanel: !!runtimePanel, debuggerPanel: !!debuggerPanel });
+            }
+        }
+        
+        function showRuntimePanel() {
+            const runtimePanel = document.getElementById('runtimePanel');
+            const debuggerPanel = document.getElementById('debuggerPanel');
+            if (runtimePanel && debuggerPanel) {
+                runtimePanel.style.display = 'block';
+                debuggerPanel.style.display = 'none';
+            } else {
+                console.error('Panels not found:', { runtimePanel: !!runtimePanel, debuggerPanel: !!debuggerPanel });
+            }
+        }
+
+        // Debugger state
+        let debugSocket = null;
+        let debugState = 'stopped'; // stopped, running, paused, stepping
+        let breakpoints = new Map(); // line number -> { line, enabled }
+        let currentDebugLine = null;
+        let debugDecorations = [];
+        let isExecuting = false; // Flag to prevent runtime inspection during execution
+        let debuggerSessionReady = false;
+        let debugSocketReconnectTimer = null;
+        let debugSocketShouldReconnect = false;
+        const DEBUG_SOCKET_RETRY_MS = 2000;
+        const DEBUG_SOCKET_READY_TIMEOUT_MS = 5000;
+        let debugSocketReadyResolvers = [];
+
+        // Toggle debug section collapse
+        function toggleDebugSection(header) {
+            const content = header.nextElementSibling;
+            header.classList.toggle('collapsed');
+            content.classList.toggle('collapsed');
+        }
+
+        function expandDebugSection(contentId) {
+            const content = document.getElementById(contentId);
+            if (!content) return;
+            const header = content.previousElementSibling;
+            if (header) {
+                header.classList.remove('collapsed');
+            }
+            content.classList.remove('collapsed');
+        }
+
+        function ensureDebuggerDetailsVisible() {
+            expandDebugSection('callStackContent');
+            expandDebugSection('variablesContent');
+        }
+
+        // Update debug status UI
+        function updateDebugStatus(state, text) {
+            debugState = state;
+            const icon = document.getElementById('debugStatusIcon');
+            const statusText = document.getElementById('debugStatusText');
+            
+            icon.className = 'debug-status-icon ' + state;
+            statusText.textContent = text || state.charAt(0).toUpperCase() + state.slice(1);
+            
+            // Update button states
+            const continueBtn = document.getElementById('debugContinue');
+            const pauseBtn = document.getElementById('debugPause');
+            const stepOverBtn = document.getElementById('debugStepOver');
+            const stepIntoBtn = document.getElementById('debugStepInto');
+            const stepOutBtn = document.getElementById('debugStepOut');
+            
+            if (state === 'paused' || state === 'stepping') {
+                continueBtn.disabled = false;
+                pauseBtn.disabled = true;
+                stepOverBtn.disabled = false;
+                stepIntoBtn.disabled = false;
+                stepOutBtn.disabled = false;
+            } else if (state === 'running') {
+                continueBtn.disabled = true;
+                pauseBtn.disabled = false;
+                stepOverBtn.disabled = true;
+                stepIntoBtn.disabled = true;
+                stepOutBtn.disabled = true;
+            } else {
+                continueBtn.disabled = true;
+                pauseBtn.disabled = true;
+                stepOverBtn.disabled = true;
+                stepIntoBtn.disabled = true;
+                stepOutBtn.disabled = true;
+            }
+        }
+
+        // Render breakpoints list
+        function renderBreakpoints() {
+            const container = document.getElementById('breakpointsContent');
+            if (!container) return; // Element doesn't exist yet
+            
+            if (breakpoints.size === 0) {
+                container.innerHTML = '<div style="padding: 8px; color: #888; font-size: 11px;">No breakpoints set. Click on a line number to add one.</div>';
+                return;
+            }
+            
+            let html = '';
+            const fileLabel = getCurrentFilename();
+            breakpoints.forEach((bp, lineNum) => {
+                html += `
+                    <div class="breakpoint-item" data-line="${lineNum}">
+                        <div>
+                            <div class="breakpoint-location">${fileLabel}</div>
+                            <div class="breakpoint-line">Line ${lineNum}</div>
+                        </div>
+                        <span class="breakpoint-remove" onclick="removeBreakpoint(${lineNum})">✖</span>
+                    </div>
+                `;
+            });
+            container.innerHTML = html;
+        }
+
+        // Render call stack
+        function renderCallStack(stack) {
+            const container = document.getElementById('callStackContent');
+            if (!container) return; // Element doesn't exist yet
+            
+            if (!stack || stack.length === 0) {
+                container.innerHTML = '<div style="padding: 8px; color: #888; font-size: 11px;">Not paused</div>';
+                return;
+            }
+            
+            let html = '';
+            stack.forEach((frame, index) => {
+                html += `
+                    <div class="callstack-item">
+                        <div class="callstack-function">${frame.functionName || 'anonymous'}</div>
+                        <div class="callstack-location">${frame.file}:${frame.line}</div>
+                    </div>
+                `;
+            });
+            container.innerHTML = html;
+        }
+
+        // Render variables
+        function renderVariables(vars) {
+            const container = document.getElementById('variablesContent');
+            if (!container) return; // Element doesn't exist yet
+            
+            if (!vars || Object.keys(vars).length === 0) {
+                container.innerHTML = '<div style="padding: 8px; color: #888; font-size: 11px;">No variables</div>';
+                return;
+            }
+            
+            let html = '';
+            Object.entries(vars).forEach(([name, value]) => {
+                const displayValue = typeof value === 'string' ? `"${value}"` : JSON.stringify(value);
+                html += `
+                    <div class="variable-item">
+                        <span class="variable-name">${name}</span>
+                        <span class="variable-value">${displayValue}</span>
+                    </div>
+                `;
+            });
+            container.innerHTML = html;
+        }
+
+        function resetDebuggerUI(reasonText, options) {
+            updateDebugStatus('stopped', reasonText || 'Stopped');
+            currentDebugLine = null;
+            updateEditorBreakpoints();
+            renderCallStack([]);
+            renderVariables({});
+            if (!options || !options.preservePanelState) {
+                showRuntimePanel();
+            }
+        }
+
+        // Toggle breakpoint at line
+        function toggleBreakpoint(line) {
+            if (breakpoints.has(line)) {
+                removeBreakpoint(line);
+            } else {
+                addBreakpoint(line);
+            }
+        }
+
+        // Add breakpoint
+        async function addBreakpoint(line) {
+            console.log('Adding breakpoint at line:', line);
+            breakpoints.set(line, { line: line, enabled: true });
+            
+            // Sync with backend for the active file
+            if (sessionId && authToken) {
+                const filename = getCurrentFilename();
+                console.log('Syncing breakpoint to backend:', filename, line);
+                try {
+                    const response = await fetch(`/api/debug/breakpoint?session=${sessionId}`, {
+                        method: 'POST',
+                        headers: {
+                            'Content-Type': 'application/json',
+                            'Authorization': authToken
+                        },
+                        credentials: 'include',
+                        body: JSON.stringify({
+                            file: filename,
+                            line: line,
+                            action: 'add'
+                        })
+                    });
+                    console.log('Breakpoint sync response:', response.status, response.ok);
+                } catch (err) {
+                    console.error('Failed to add breakpoint:', err);
+                }
+            } else {
+                console.log('No sessionId or authToken, breakpoint not synced to backend');
+            }
+            
+            renderBreakpoints();
+            updateEditorBreakpoints();
+            ensureDebugSocketConnected();
+        }
+
+        // Remove breakpoint
+        async function removeBreakpoint(line) {
+            breakpoints.delete(line);
+            
+            // Sync with backend for the active file
+            if (sessionId && authToken) {
+                const filename = getCurrentFilename();
+                try {
+                    await fetch(`/api/debug/breakpoint?session=${sessionId}`, {
+                        method: 'POST',
+                        headers: {
+                            'Content-Type': 'application/json',
+                            'Authorization': authToken
+                        },
+                        credentials: 'include',
+                        body: JSON.stringify({
+                            file: filename,
+                            line: line,
+                            action: 'remove'
+                        })
+                    });
+                } catch (err) {
+                    console.error('Failed to remove breakpoint:', err);
+                }
+            }
+            
+            renderBreakpoints();
+            updateEditorBreakpoints();
+            ensureDebugSocketConnected();
+        }
+
+        async function clearBreakpointsOnServer(targetFile, options) {
+            breakpoints.clear();
+            renderBreakpoints();
+            updateEditorBreakpoints();
+            ensureDebugSocketConnected();
+
+            if (!sessionId || !authToken) {
+                return;
+            }
+
+            const opts = options || {};
+            const clearAll = opts.clearAll === true;
+            const fileToClear = clearAll
+                ? ''
+                : (targetFile && targetFile.trim()
+                    ? targetFile.trim()
+                    : ((currentFileName && currentFileName.trim()) ? currentFileName.trim() : ''));
+
+            try {
+                const response = await fetch(getAPIPath('/api/debug/breakpoint?session=' + encodeURIComponent(sessionId)), {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                        'Authorization': authToken
+                    },
+                    credentials: 'include',
+                    body: JSON.stringify({
+                        file: fileToClear,
+                        action: 'clear'
+                    })
+                });
+
+                if (response.status === 404) {
+                    debuggerSessionReady = false;
+                    return;
+                }
+
+                if (!response.ok) {
+                    console.warn('Failed to clear breakpoints on server, status:', response.status);
+                }
+                debuggerSessionReady = true;
+            } catch (err) {
+                console.error('Failed to clear breakpoints on server:', err);
+            }
+        }
+
+        async function syncBreakpointsWithServer(targetFile) {
+            const filename = targetFile || getCurrentFilename();
+            if (!sessionId || !authToken) {
+                breakpoints.clear();
+                renderBreakpoints();
+                updateEditorBreakpoints();
+                debuggerSessionReady = false;
+                ensureDebugSocketConnected();
+                return;
+            }
+
+            try {
+                const res = await fetch(getAPIPath('/api/debug/state?session=' + encodeURIComponent(sessionId)), {
+                    headers: { 'Authorization': authToken },
+                    credentials: 'include'
+                });
+
+                if (!res.ok) {
+                    if (res.status === 404) {
+                        console.warn('Debugger session not ready yet; skipping breakpoint sync until a session exists');
+                        debuggerSessionReady = false;
+                        ensureDebugSocketConnected();
+                        return;
+                    }
+                    console.warn('Failed to sync breakpoints, status:', res.status);
+                    breakpoints.clear();
+                    debuggerSessionReady = false;
+                } else {
+                    const state = await res.json();
+                    debuggerSessionReady = true;
+                    const allRemote = state.breakpoints || [];
+                    const targetBreakpoints = [];
+                    const staleBreakpoints = [];
+
+                    allRemote.forEach(bp => {
+                        const bpFile = bp.file || 'main.ch';
+                        if (bpFile === filename) {
+                            targetBreakpoints.push(bp);
+                        } else {
+                            staleBreakpoints.push(bp);
+                        }
+                    });
+
+                    if (staleBreakpoints.length > 0) {
+                        console.log('Removing stale breakpoints:', staleBreakpoints.map(bp => (bp.file || 'main.ch') + ':' + bp.line));
+                        for (const stale of staleBreakpoints) {
+                            try {
+                                await fetch(getAPIPath('/api/debug/breakpoint?session=' + encodeURIComponent(sessionId)), {
+                                    method: 'POST',
+                                    headers: {
+                                        'Content-Type': 'application/json',
+                                        'Authorization': authToken
+                                    },
+                                    credentials: 'include',
+                                    body: JSON.stringify({
+                                        file: stale.file || 'main.ch',
+                                        line: stale.line,
+                                        action: 'remove'
+                                    })
+                                });
+                            } catch (removeErr) {
+                                console.error('Failed to remove stale breakpoint:', removeErr);
+                            }
+                        }
+                    }
+
+                    breakpoints.clear();
+                    targetBreakpoints.forEach(bp => {
+                        breakpoints.set(bp.line, { line: bp.line, enabled: bp.enabled !== false });
+                    });
+                }
+            } catch (err) {
+                console.error('Failed to sync breakpoints:', err);
+                breakpoints.clear();
+                debuggerSessionReady = false;
+            }
+
+            renderBreakpoints();
+            updateEditorBreakpoints();
+            ensureDebugSocketConnected();
+        }
+
+        // Update editor breakpoint decorations
+        function updateEditorBreakpoints() {
+            if (!editor) return;
+            
+            const decorations = [];
+            breakpoints.forEach((bp, lineNum) => {
+                decorations.push({
+                    range: new monaco.Range(lineNum, 1, lineNum, 1),
+                    options: {
+                        isWholeLine: true,
+                        className: 'breakpoint-line',
+                        glyphMarginClassName: 'breakpoint-glyph',
+                        glyphMarginHoverMessage: { value: 'Breakpoint' }
+                    }
+                });
+            });
+            
+            // Add current debug line if paused
+            if (currentDebugLine && (debugState === 'paused' || debugState === 'stepping')) {
+                decorations.push({
+                    range: new monaco.Range(currentDebugLine, 1, currentDebugLine, 1),
+                    options: {
+                        isWholeLine: true,
+                        className: 'debug-current-line',
+                        glyphMarginClassName: 'debug-current-glyph'
+                    }
+                });
+            }
+            
+            debugDecorations = editor.deltaDecorations(debugDecorations, decorations);
+        }
+
+        function revealEditorLine(line) {
+            if (!editor) return;
+            const targetLine = Number(line);
+            if (!Number.isFinite(targetLine) || targetLine < 1) {
+                return;
+            }
+            editor.revealLineInCenter(targetLine);
+        }
+
+        function shouldConnectDebugSocket() {
+            return !!(sessionId && authToken && breakpoints.size > 0);
+        }
+
+        function ensureDebugSocketConnected() {
+            if (shouldConnectDebugSocket()) {
+                connectDebugSocket();
+                return;
+            }
+
+            debugSocketShouldReconnect = false;
+            if (debugSocketReconnectTimer) {
+                clearTimeout(debugSocketReconnectTimer);
+                debugSocketReconnectTimer = null;
+            }
+            if (debugSocket) {
+                try {
+                    debugSocket.close();
+                } catch (err) {
+                    console.warn('Failed to close debug WebSocket:', err);
+                }
+                debugSocket = null;
+            }
+        }
+
+        function scheduleDebugSocketReconnect() {
+            if (debugSocketReconnectTimer || !shouldConnectDebugSocket()) {
+                return;
+            }
+            debugSocketReconnectTimer = setTimeout(() => {
+                debugSocketReconnectTimer = null;
+                if (shouldConnectDebugSocket()) {
+                    connectDebugSocket();
+                }
+            }, DEBUG_SOCKET_RETRY_MS);
+        }
+
+        function settleDebugSocketWaiters(err) {
+            if (!debugSocketReadyResolvers.length) {
+                return;
+            }
+            const waiters = debugSocketReadyResolvers;
+            debugSocketReadyResolvers = [];
+            waiters.forEach(({ resolve, reject, timer }) => {
+                if (timer) {
+                    clearTimeout(timer);
+                }
+                if (err) {
+                    reject(err);
+                } else {
+                    resolve();
+                }
+            });
+        }
+
+        function waitForDebugSocketReady() {
+            if (!shouldConnectDebugSocket()) {
+                return Promise.resolve();
+            }
+            if (debugSocket && debugSocket.readyState === WebSocket.OPEN) {
+                return Promise.resolve();
+            }
+
+            return new Promise((resolve, reject) => {
+                const waiter = { resolve, reject, timer: null };
+                waiter.timer = setTimeout(() => {
+                    debugSocketReadyResolvers = debugSocketReadyResolvers.filter(item => item !== waiter);
+                    reject(new Error('Timed out waiting for debugger connection'));
+                }, DEBUG_SOCKET_READY_TIMEOUT_MS);
+                debugSocketReadyResolvers.push(waiter);
+                connectDebugSocket();
+            });
+        }
+
+        // Debug control actions
+        async function debugContinue() {
+            if (!sessionId || !authToken) return;
+            
+            try {
+                await fetch(`/api/debug/continue?session=${sessionId}`, {
+                    method: 'POST',
+                    headers: { 'Authorization': authToken },
+                    credentials: 'include'
+                });
+                updateDebugStatus('running', 'Running');
+            } catch (err) {
+                console.error('Continue failed:', err);
+            }
+        }
+
+        async function debugPause() {
+            if (!sessionId || !authToken) return;
+            
+            try {
+                await fetch(`/api/debug/pause?session=${sessionId}`, {
+                    method: 'POST',
+                    headers: { 'Authorization': authToken },
+                    credentials: 'include'
+                });
+                updateDebugStatus('paused', 'Paused');
+            } catch (err) {
+                console.error('Pause failed:', err);
+            }
+        }
+
+        async function debugStepOver() {
+            if (!sessionId || !authToken) return;
+            
+            try {
+                await fetch(`/api/debug/step?session=${sessionId}`, {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                        'Authorization': authToken
+                    },
+                    credentials: 'include',
+                    body: JSON.stringify({ mode: 'over' })
+                });
+                updateDebugStatus('stepping', 'Stepping');
+            } catch (err) {
+                console.error('Step over failed:', err);
+            }
+        }
+
+        async function debugStepInto() {
+            if (!sessionId || !authToken) return;
+            
+            try {
+                await fetch(`/api/debug/step?session=${sessionId}`, {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                        'Authorization': authToken
+                    },
+                    credentials: 'include',
+                    body: JSON.stringify({ mode: 'into' })
+                });
+                updateDebugStatus('stepping', 'Stepping');
+            } catch (err) {
+                console.error('Step into failed:', err);
+            }
+        }
+
+        async function debugStepOut() {
+            if (!sessionId || !authToken) return;
+            
+            try {
+                await fetch(`/api/debug/step?session=${sessionId}`, {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                        'Authorization': authToken
+                    },
+                    credentials: 'include',
+                    body: JSON.stringify({ mode: 'out' })
+                });
+                updateDebugStatus('stepping', 'Stepping');
+            } catch (err) {
+                console.error('Step out failed:', err);
+            }
+        }
+
+        // Connect to debug WebSocket (called when execution starts)
+        function connectDebugSocket() {
+            if (!shouldConnectDebugSocket()) {
+                console.log('Cannot connect debug socket: waiting for session/auth or breakpoints');
+                return;
+            }
+            
+            if (debugSocket) {
+                const state = debugSocket.readyState;
+                if (state === WebSocket.OPEN || state === WebSocket.CONNECTING) {
+                    console.log('Debug WebSocket already active (state ' + state + ')');
+                    return;
+                }
+                try {
+                    debugSocket.close();
+                } catch (err) {
+                    console.warn('Failed to close stale debug WebSocket:', err);
+                }
+            }
+
+            if (debugSocketReconnectTimer) {
+                clearTimeout(debugSocketReconnectTimer);
+                debugSocketReconnectTimer = null;
+            }
+            debugSocketShouldReconnect = true;
+            
+            const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+            const wsUrl = `${protocol}//${window.location.host}/api/debug/events?session=${sessionId}`;
+            
+            console.log('Connecting debug WebSocket:', wsUrl);
+            debugSocket = new WebSocket(wsUrl);
+            
+            debugSocket.onopen = () => {
+                console.log('Debug WebSocket connected');
+                settleDebugSocketWaiters();
+            };
+            
+            debugSocket.onmessage = (event) => {
+                try {
+                    const debugEvent = JSON.parse(event.data);
+                    handleDebugEvent(debugEvent);
+                } catch (err) {
+                    console.error('Failed to parse debug event:', err);
+                }
+            };
+            
+            debugSocket.onerror = (err) => {
+                console.error('Debug WebSocket error:', err);
+                settleDebugSocketWaiters(err || new Error('Debug WebSocket error'));
+                if (debugSocketShouldReconnect) {
+                    scheduleDebugSocketReconnect();
+                }
+            };
+            
+            debugSocket.onclose = (event) => {
+                console.log('Debug WebSocket closed', event ? { code: event.code, reason: event.reason } : undefined);
+                settleDebugSocketWaiters(new Error('Debug WebSocket closed'));
+                debugSocket = null;
+                if (debugSocketShouldReconnect && shouldConnectDebugSocket()) {
+                    console.log('Scheduling debug WebSocket reconnect');
+                    scheduleDebugSocketReconnect();
+                    return;
+                }
+                if (debugState === 'paused' || debugState === 'stepping') {
+                    console.log('Debugger socket closed while paused/stepping; retaining current panel state');
+                    return;
+                }
+                resetDebuggerUI('Debugger disconnected');
+            };
+        }
+
+        // Handle debug events from WebSocket
+        function handleDebugEvent(event) {
+            console.log('Debug event:', event);
+            
+            switch (event.type) {
+                case 'breakpoint':
+                    showDebuggerPanel(); // Switch to debugger view
+                    ensureDebuggerDetailsVisible();
+                    updateDebugStatus('paused', `Paused at ${event.file}:${event.line}`);
+                    currentDebugLine = event.line;
+                    updateEditorBreakpoints();
+                    revealEditorLine(event.line);
+                    fetchDebugState();
+                    break;
+                    
+                case 'step':
+                    showDebuggerPanel(); // Switch to debugger view
+                    ensureDebuggerDetailsVisible();
+                    currentDebugLine = event.line;
+                    updateEditorBreakpoints();
+                    revealEditorLine(event.line);
+                    fetchDebugState();
+                    break;
+                    
+                case 'error':
+                    updateDebugStatus('stopped', 'Error: ' + event.message);
+                    currentDebugLine = null;
+                    updateEditorBreakpoints();
+                    break;
+                    
+                case 'stopped':
+				resetDebuggerUI(event.message || 'Stopped');
+                    break;
+            }
+        }
+
+        // Fetch current debug state
+        async function fetchDebugState() {
+            if (!sessionId || !authToken) return;
+            
+            try {
+                const res = await fetch(`/api/debug/state?session=${sessionId}`, {
+                    headers: { 'Authorization': authToken },
+                    credentials: 'include'
+                });
+                
+                if (res.ok) {
+                    debuggerSessionReady = true;
+                    const state = await res.json();
+                    renderCallStack(state.callStack || []);
+                    renderVariables(state.variables || {});
+                }
+            } catch (err) {
+                console.error('Failed to fetch debug state:', err);
+            }
+        }
+
+        // Bind debug control buttons
+        function bindDebugHandlers() {
+            document.getElementById('debugContinue').addEventListener('click', debugContinue);
+            document.getElementById('debugPause').addEventListener('click', debugPause);
+            document.getElementById('debugStepOver').addEventListener('click', debugStepOver);
+            document.getElementById('debugStepInto').addEventListener('click', debugStepInto);
+            document.getElementById('debugStepOut').addEventListener('click', debugStepOut);
+            
+            // Keyboard shortcuts
+            document.addEventListener('keydown', (e) => {
+                if (e.key === 'F5') {
+                    e.preventDefault();
+                    if (debugState === 'paused' || debugState === 'stepping') {
+                        debugContinue();
+                    }
+                } else if (e.key === 'F10') {
+                    e.preventDefault();
+                    debugStepOver();
+                } else if (e.key === 'F11') {
+                    e.preventDefault();
+                    if (e.shiftKey) {
+                        debugStepOut();
+                    } else {
+                        debugStepInto();
+                    }
+                }
+            });
+        }
+        
@@ -0,0 +1,384 @@
+        // Load diagrams list from backend and populate dropdown
+        async function loadDiagramsList(retainSelection = true) {
+            const select = document.getElementById('diagramSelect');
+            if (!select) return;
+            const previousSelection = retainSelection ? select.value : '';
+            select.innerHTML = '<option value="">Select a diagram...</option>';
+            select.disabled = true;
+            toggleDiagramActionButtons(false);
+            try {
+                const resp = await fetch(buildDiagramURL('/api/diagrams'), { headers: getAuthHeaders() });
+                if (!resp.ok) {
+                    if (resp.status === 401) { logout(); return; }
+                    const t = await resp.text();
+                    showOutput('Failed to load diagrams: ' + t, 'error');
+                    return;
+                }
+                const resolvedScope = (resp.headers.get('X-Chariot-Scope') || '').toLowerCase();
+                if (resolvedScope && resolvedScope !== sandboxProfile.currentScope) {
+                    sandboxProfile.currentScope = resolvedScope;
+                    applyDiagramScopeUI();
+                }
+                const result = await resp.json();
+                const list = Array.isArray(result) ? result : (result && result.result === 'OK' ? result.data : []);
+                if (Array.isArray(list)) {
+                    list.forEach(item => {
+                        const name = typeof item === 'string' ? item : item.name;
+                        if (!name) return;
+                        const opt = document.createElement('option');
+                        opt.value = name;
+                        opt.textContent = name;
+                        select.appendChild(opt);
+                    });
+                    select.disabled = false;
+                } else {
+                    showOutput('No diagrams available', 'info');
+                }
+            } catch (e) {
+                showOutput('Error loading diagrams: ' + e.message, 'error');
+            }
+            const options = Array.from(select.options || []);
+            if (retainSelection && previousSelection && options.some(opt => opt.value === previousSelection)) {
+                select.value = previousSelection;
+                currentDiagramName = previousSelection;
+                toggleDiagramActionButtons(true);
+            } else {
+                select.value = '';
+                currentDiagramName = '';
+                currentDiagramJSON = null;
+                toggleDiagramActionButtons(false);
+            }
+            select.disabled = false;
+        }
+
+        // Fetch selected diagram JSON and generate Chariot code using shared codegen
+        async function generateFromSelectedDiagram() {
+            const select = document.getElementById('diagramSelect');
+            if (!select || !select.value) {
+                showOutput('Please select a diagram first', 'error');
+                return;
+            }
+            const jsCodegen = window.ChariotCodegen && typeof window.ChariotCodegen.generateChariotCodeFromDiagram === 'function';
+            if (!jsCodegen && !chariotWasmReady()) {
+                showOutput('Code generator not loaded. Ensure /chariot-codegen.js is available and built.', 'error');
+                return;
+            }
+            const name = select.value;
+            try {
+                const resp = await fetch(buildDiagramURL('/api/diagrams/' + encodeURIComponent(name)), { headers: getAuthHeaders() });
+                if (!resp.ok) {
+                    if (resp.status === 401) { logout(); return; }
+                    const t = await resp.text();
+                    showOutput('Failed to load diagram: ' + t, 'error');
+                    return;
+                }
+                // Backend returns raw diagram JSON (not wrapped)
+                const diagram = await resp.json();
+                currentDiagramJSON = diagram;
+                currentDiagramBase = JSON.parse(JSON.stringify(diagram));
+                collabConnect('diagram', getCurrentDiagramScope(), name, null);
+                await reportDiagramIssues(diagram);
+                let code = '';
+                currentDiagramSourceMap = null;
+                const savedCode = diagram && typeof diagram.code === 'string' && diagram.code.trim().length > 0;
+                const wasmGenerated = savedCode ? null : generateDiagramCodeWasm(diagram);
+                if (savedCode) {
+                    // Prefer user-authored/saved code when present
+                    code = diagram.code;
+                    currentDiagramSourceMap = diagram.sourceMap || null;
+                } else if (wasmGenerated) {
+                    // Same generator the server runs diagrams with
+                    code = wasmGenerated.code;
+                    currentDiagramSourceMap = wasmGenerated.sourceMap;
+                } else if (!jsCodegen) {
+                    showOutput('This diagram needs the JavaScript code generator. Ensure /chariot-codegen.js is available and built.', 'error');
+                    return;
+                } else if (typeof window.ChariotCodegen.generateChariotCodeWithSourceMap === 'function') {
+                    const generated = window.ChariotCodegen.generateChariotCodeWithSourceMap(JSON.stringify(diagram));
+                    code = generated.code;
+                    currentDiagramSourceMap = generated.sourceMap;
+                } else {
+                    code = window.ChariotCodegen.generateChariotCodeFromDiagram(JSON.stringify(diagram));
+                }
+                code = stripEmbeddedDiagramMarker(code);
+                currentGeneratedCode = code;
+                if (editor) {
+                    editor.setValue(code);
+                    showOutput('Generated code from diagram: ' + name, 'success');
+                    updateRunButtonState();
+                }
+            } catch (e) {
+                showOutput('Error generating code: ' + e.message, 'error');
+            }
+        }
+
+        // Validate a diagram on the server and list structural issues in the Problems tab
+        async function reportDiagramIssues(diagram) {
+            try {
+                const resp = await fetch(buildDiagramURL('/api/diagrams/validate'), {
+                    method: 'POST',
+                    headers: getAuthHeadersWithJSON(),
+                    body: JSON.stringify(diagram)
+                });
+                if (!resp.ok) return;
+                const result = await resp.json();
+                const issues = (result && result.data && result.data.issues) || [];
+                issues.filter(i => i.severity !== 'info').forEach(i => {
+                    const block = i.nodeId ? ' [' + (i.label || 'block') + ' ' + i.nodeId + ']' : '';
+                    showProblem('Diagram ' + i.severity + ': ' + i.message + block, i.severity);
+                });
+            } catch (_) {
+                // Validation is advisory; generation proceeds regardless
+            }
+        }
+
+        // Remove embedded diagram payload marker from displayed code
+        function stripEmbeddedDiagramMarker(code) {
+            try {
+                const lines = code.split(/\r?\n/);
+                const filtered = lines.filter(l => l.indexOf('__VDSL_SOURCE__: base64:') === -1 && l.indexOf('__VDSL_MAP__: base64:') === -1);
+                return filtered.join('\n').trimEnd();
+            } catch (_) { return code; }
+        }
+
+        // Source map for the editor code, if it is still the unmodified output of the diagram generator
+        function activeDiagramSourceMap(code) {
+            if (!currentDiagramSourceMap || currentGeneratedCode === null) return null;
+            return code === currentGeneratedCode ? currentDiagramSourceMap : null;
+        }
+
+        function toggleDiagramActionButtons(enabled) {
+            const saveBtn = document.getElementById('saveDiagramButton');
+            const saveAsBtn = document.getElementById('saveAsDiagramButton');
+            const delBtn = document.getElementById('deleteDiagramButton');
+            if (saveBtn) saveBtn.disabled = !enabled;
+            if (saveAsBtn) saveAsBtn.disabled = !enabled;
+            if (delBtn) delBtn.disabled = !enabled;
+        }
+
+        function getCurrentDiagramScope() {
+            return sandboxProfile.currentScope || 'global';
+        }
+
+        function getScopeLabel(scope) {
+            return scope === 'sandbox' ? 'Sandbox' : 'Global';
+        }
+
+        function getSaveTargetScope() {
+            const shareCheckbox = document.getElementById('diagramGlobalShareCheckbox');
+            if (shareCheckbox && shareCheckbox.checked) {
+                return 'global';
+            }
+            return getCurrentDiagramScope();
+        }
+
+        function resetDiagramShareOverride() {
+            const shareCheckbox = document.getElementById('diagramGlobalShareCheckbox');
+            if (shareCheckbox) {
+                shareCheckbox.checked = false;
+            }
+        }
+
+        function applyDiagramScopeUI() {
+            const controls = document.getElementById('diagramScopeControls');
+            const select = document.getElementById('diagramScopeSelect');
+            const shareLabel = document.getElementById('diagramGlobalShareLabel');
+            const shareCheckbox = document.getElementById('diagramGlobalShareCheckbox');
+            if (!controls || !select) {
+                return;
+            }
+            // Always show all available scopes from profile (baseline feature)
+            const scopes = sandboxProfile.scopes.length ? sandboxProfile.scopes : ['global', 'sandbox'];
+            select.innerHTML = '';
+            scopes.forEach(scope => {
+                const opt = document.createElement('option');
+                opt.value = scope;
+                opt.textContent = getScopeLabel(scope);
+                select.appendChild(opt);
+            });
+            if (!scopes.includes(sandboxProfile.currentScope)) {
+                const fallback = scopes.includes(sandboxProfile.defaultScope) ? sandboxProfile.defaultScope : scopes[0];
+                sandboxProfile.currentScope = fallback || 'global';
+            }
+            select.value = sandboxProfile.currentScope;
+            select.disabled = !authToken;
+            // Always show scope controls when logged in
+            controls.style.display = authToken ? 'flex' : 'none';
+            if (shareLabel && shareCheckbox) {
+                const showShare = sandboxProfile.enabled;
+                shareLabel.style.display = showShare ? 'flex' : 'none';
+                const disableShare = !showShare || sandboxProfile.currentScope === 'global';
+                shareCheckbox.disabled = disableShare;
+                if (disableShare) {
+                    shareCheckbox.checked = false;
+                }
+            }
+        }
+
+        function applyFileScopeUI() {
+            const controls = document.getElementById('fileScopeControls');
+            const select = document.getElementById('fileScopeSelect');
+            if (!controls || !select) {
+                return;
+            }
+            // Always show all available scopes from profile (baseline feature)
+            const scopes = sandboxProfile.scopes.length ? sandboxProfile.scopes : ['global', 'sandbox'];
+            select.innerHTML = '';
+            scopes.forEach(scope => {
+                const opt = document.createElement('option');
+                opt.value = scope;
+                opt.textContent = getScopeLabel(scope);
+                select.appendChild(opt);
+            });
+            if (!scopes.includes(currentFileScope)) {
+                const fallback = scopes.includes(sandboxProfile.defaultScope) ? sandboxProfile.defaultScope : scopes[0];
+                currentFileScope = fallback || 'global';
+            }
+            select.value = currentFileScope;
+            select.disabled = !authToken;
+            // Always show scope controls when logged in
+            controls.style.display = authToken ? 'flex' : 'none';
+        }
+
+        function buildDiagramURL(pathname, scopeOverride) {
+            const target = getAPIPath(pathname);
+            const url = new URL(target, window.location.origin);
+            const scope = scopeOverride || getCurrentDiagramScope();
+            if (scope) {
+                url.searchParams.set('scope', scope);
+            }
+            return url.toString();
+        }
+
+        async function saveCurrentDiagram(asNew) {
+            if (!authToken) { showOutput('Please log in first', 'error'); return; }
+            const select = document.getElementById('diagramSelect');
+            if (!select) return;
+            let name = currentDiagramName || select.value;
+            if (asNew || !name) {
+                const input = prompt('Enter diagram name:', name || 'new-diagram');
+                if (!input) return;
+                name = input.trim();
+            }
+            // Code edited since generation is converted back into blocks; when every statement maps,
+            // the rebuilt diagram replaces the last loaded one, otherwise the code is saved alongside it.
+            if (editor && currentGeneratedCode !== null && editor.getValue() !== currentGeneratedCode) {
+                const rebuilt = await rebuildDiagramFromCode(editor.getValue(), name);
+                if (rebuilt) {
+                    currentDiagramJSON = rebuilt;
+                    currentGeneratedCode = editor.getValue();
+                    currentDiagramSourceMap = null;
+                }
+            }
+            const contentJSON = (function() {
+                try {
+                    // Clone to avoid mutating in-memory object
+                    const clone = JSON.parse(JSON.stringify(currentDiagramJSON || {}));
+                    if (editor) {
+                        clone.code = editor.getValue();
+                        // Keep the source map only while it still describes the code being saved
+                        const map = activeDiagramSourceMap(clone.code);
+                        if (map) { clone.sourceMap = map; } else { delete clone.sourceMap; }
+                    }
+                    return clone;
+                } catch (_) {
+                    return currentDiagramJSON;
+                }
+            })();
+            if (!contentJSON) {
+                showOutput('No diagram content available to save.', 'error');
+                return;
+            }
+            try {
+                const targetScope = getSaveTargetScope();
+                const resp = await fetch(buildDiagramURL('/api/diagrams', targetScope), {
+                    method: 'POST',
+                    headers: getAuthHeadersWithJSON(),
+                    body: JSON.stringify({ name, content: contentJSON, base: name === currentDiagramName ? currentDiagramBase : null })
+                });
+                if (resp.status === 401) { logout(); return; }
+                if (resp.ok) {
+                    let saved = contentJSON;
+                    if (resp.status === 200) {
+                        const result = await resp.json().catch(() => null);
+                        const data = (result && result.data) || {};
+                        if (data.merged) {
+                            saved = data.content;
+                            showProblem('Diagram "' + name + '" was changed by someone else since you loaded it; both sets of changes were merged.', 'warning');
+                            (data.conflicts || []).forEach(c => showProblem(c, 'warning'));
+                        }
+                    }
+                    currentDiagramJSON = saved;
+                    currentDiagramBase = JSON.parse(JSON.stringify(saved));
+                    collabNotifySaved();
+                    showOutput('Diagram saved to ' + getScopeLabel(targetScope) + ' scope: ' + name, 'success');
+                    await loadDiagramsList();
+                    const sel = document.getElementById('diagramSelect');
+                    if (sel) sel.value = name;
+                    currentDiagramName = name;
+                    resetDiagramShareOverride();
+                } else {
+                    const t = await resp.text();
+                    showOutput('Save failed: ' + t, 'error');
+                }
+            } catch (e) {
+                showOutput('Save error: ' + e.message, 'error');
+            }
+        }
+
+        // Convert editor code to a diagram; returns the diagram only when the conversion is complete
+        async function rebuildDiagramFromCode(code, name) {
+            try {
+                const resp = await fetch(buildDiagramURL('/api/diagrams/from-code'), {
+                    method: 'POST',
+                    headers: getAuthHeadersWithJSON(),
+                    body: JSON.stringify({ code, name })
+                });
+                if (!resp.ok) {
+                    const t = await resp.text();
+                    showProblem('Could not update diagram from code: ' + t, 'warning');
+                    return null;
+                }
+                const result = await resp.json();
+                const data = (result && result.data) || {};
+                const report = data.report || {};
+                if (report.complete) return data.diagram;
+                (report.unmapped || []).forEach(u => {
+                    showProblem('No diagram block for line ' + (u.line || '?') + ': ' + u.code + (u.inline ? ' (kept as inline code)' : ''), 'warning');
+                });
+                showProblem('Diagram not updated from code; the edited code is saved with the existing diagram.', 'warning');
+                return null;
+            } catch (e) {
+                return null;
+            }
+        }
+
+        async function deleteCurrentDiagram() {
+            if (!authToken) { showOutput('Please log in first', 'error'); return; }
+            const select = document.getElementById('diagramSelect');
+            if (!select || !select.value) { showOutput('No diagram selected', 'error'); return; }
+            const name = select.value;
+            if (!confirm('Delete diagram "' + name + '"? This cannot be undone.')) return;
+            try {
+                const resp = await fetch(buildDiagramURL('/api/diagrams/' + encodeURIComponent(name)), {
+                    method: 'DELETE',
+                    headers: getAuthHeaders(),
+                });
+                if (resp.status === 401) { logout(); return; }
+                if (resp.ok) {
+                    showOutput('Diagram deleted: ' + name, 'success');
+                    await loadDiagramsList();
+                    const sel = document.getElementById('diagramSelect');
+                    if (sel) sel.value = '';
+                    currentDiagramName = '';
+                    currentDiagramJSON = null;
+                    if (editor) editor.setValue('');
+                    toggleDiagramActionButtons(false);
+                } else {
+                    const t = await resp.text();
+                    showOutput('Delete failed: ' + t, 'error');
+                }
+            } catch (e) {
+                showOutput('Delete error: ' + e.message, 'error');
+            }
+        }
@@ -0,0 +1,606 @@
+        // Track file modifications
+        function trackFileChanges() {
+            if (editor) {
+                editor.onDidChangeModelContent(collabOnLocalChange);
+                editor.onDidChangeCursorSelection(collabOnCursor);
+                editor.onDidChangeModelContent(() => {
+                    const currentContent = editor.getValue();
+                    const wasModified = isFileModified;
+                    isFileModified = (currentContent !== originalContent);
+                    
+                    console.log('Content changed - isFileModified:', isFileModified, 'currentContent length:', currentContent.length, 'originalContent length:', originalContent.length);
+                    
+                    // Always update button states when content changes
+                    updateSaveButtonStates();
+                    updateRunButtonState(); // Update Run button state on any content change
+                });
+            }
+        }
+
+        // Update save button states
+        function updateSaveButtonStates() {
+            const saveButton = document.getElementById('saveButton');
+            const saveAsButton = document.getElementById('saveAsButton');
+            const renameButton = document.getElementById('renameButton');
+            const deleteButton = document.getElementById('deleteButton');
+            
+            // Functions tab buttons
+            const saveFunctionButton = document.getElementById('saveFunctionButton');
+            const saveAsFunctionButton = document.getElementById('saveAsFunctionButton');
+            const deleteFunctionButton = document.getElementById('deleteFunctionButton');
+            
+            // Check if main buttons exist
+            if (!saveButton || !saveAsButton) {
+                return;
+            }
+            
+            const hasAuth = authToken !== null;
+            const hasFile = currentFileName !== '';
+            const hasContent = editor && editor.getValue().trim() !== '';
+            const activeTab = document.querySelector('.toolbar-tab.active')?.textContent;
+            
+            // Debug logging
+            console.log('updateSaveButtonStates - activeTab:', activeTab, 'hasAuth:', hasAuth, 'hasContent:', hasContent, 'isFileModified:', isFileModified);
+            
+            // Files tab buttons
+            if (activeTab === 'Files') {
+                // Save button: enabled if authenticated, has current file, and content is modified
+                saveButton.disabled = !(hasAuth && hasFile && isFileModified);
+                if (isFileModified && hasFile) {
+                    saveButton.classList.add('modified');
+                } else {
+                    saveButton.classList.remove('modified');
+                }
+                
+                // Save As button: enabled if authenticated and has content
+                saveAsButton.disabled = !(hasAuth && hasContent);
+                
+                // Rename and Delete buttons: enabled only if authenticated and a file is loaded
+                if (renameButton) {
+                    renameButton.disabled = !(hasAuth && hasFile);
+                }
+                if (deleteButton) {
+                    deleteButton.disabled = !(hasAuth && hasFile);
+                }
+            }
+            
+            // Functions tab buttons
+            if (activeTab === 'Function Library') {
+                console.log('In Function Library tab, functionEditorFunctionName:', functionEditorFunctionName);
+                
+                // Save Function button: enabled if authenticated, has function loaded, and content is modified
+                if (saveFunctionButton) {
+                    const hasFunction = functionEditorFunctionName !== '';
+                    saveFunctionButton.disabled = !(hasAuth && hasFunction && isFileModified);
+                    console.log('Save Function button - hasFunction:', hasFunction, 'disabled:', saveFunctionButton.disabled);
+                }
+                
+                // Save As Function button: enabled if authenticated and has content
+                if (saveAsFunctionButton) {
+                    saveAsFunctionButton.disabled = !(hasAuth && hasContent);
+                    console.log('Save As Function button - disabled:', saveAsFunctionButton.disabled);
+                }
+                
+                // Delete Function button: enabled if authenticated and has function loaded
+                if (deleteFunctionButton) {
+                    const hasFunction = functionEditorFunctionName !== '';
+                    deleteFunctionButton.disabled = !(hasAuth && hasFunction);
+                }
+            }
+        }
+
+        // Save current file
+        async function saveFile() {
+            if (!authToken) {
+                showOutput('Please log in first', 'error');
+                return;
+            }
+            
+            if (!currentFileName) {
+                showOutput('No file selected to save', 'error');
+                return;
+            }
+            
+            const content = editor.getValue();
+            const saveButton = document.getElementById('saveButton');
+            
+            saveButton.disabled = true;
+            saveButton.textContent = '💾 Saving...';
+            
+            try {
+                const url = getAPIPath('/api/files?scope=' + encodeURIComponent(currentFileScope));
+                console.log('DEBUG: Save - scope:', currentFileScope, 'fileName:', currentFileName, 'url:', url);
+                const response = await fetch(url, {
+                    method: 'POST',
+                    headers: getAuthHeadersWithJSON(),
+                    body: JSON.stringify({
+                        name: currentFileName,
+                        content: content
+                    })
+                });
+                
+                if (response.status === 401) {
+                    logout();
+                    return;
+                }
+                
+                if (response.ok) {
+                    originalContent = content;
+                    isFileModified = false;
+                    updateSaveButtonStates();
+                    collabNotifySaved();
+                    showOutput('File saved successfully: ' + currentFileName, 'success');
+                } else if (response.status === 409) {
+                    showOutput('Save failed: ' + lockConflictMessage(await response.text()), 'error');
+                } else {
+                    const error = await response.text();
+                    showOutput('Save failed: ' + error, 'error');
+                }
+                
+            } catch (error) {
+                showOutput('Save error: ' + error.message, 'error');
+            } finally {
+                saveButton.disabled = false;
+                saveButton.textContent = '💾 Save';
+            }
+        }
+
+        // Create new file
+        function newFile() {
+            if (!authToken) {
+                showOutput('Please log in first', 'error');
+                return;
+            }
+            
+            // Clear the editor
+            collabDisconnect();
+            if (editor) {
+                editor.setValue('// New Chariot Script\n');
+                currentFileName = '';
+                originalContent = '';
+                isFileModified = true;
+                updateSaveButtonStates();
+                updateRunButtonState();
+                
+                // Clear file selection
+                const fileSelect = document.getElementById('fileSelect');
+                if (fileSelect) {
+                    fileSelect.value = '';
+                }
+                
+                showOutput('New file created. Use "Save As..." to save with a filename.', 'info');
+
+                resetDebuggerUI('Ready', { preservePanelState: true });
+            }
+        }
+
+        // Save as new file
+        async function saveAsFile() {
+            if (!authToken) {
+                showOutput('Please log in first', 'error');
+                return;
+            }
+            
+            const content = editor.getValue();
+            if (!content.trim()) {
+                showOutput('No content to save', 'error');
+                return;
+            }
+            
+            // Prompt for filename
+            const fileName = prompt('Enter filename (with .ch extension):', 'new_file.ch');
+            if (!fileName) {
+                return; // User cancelled
+            }
+            
+            // Validate filename
+            if (!fileName.endsWith('.ch')) {
+                showOutput('Filename must end with .ch extension', 'error');
+                return;
+            }
+            
+            const saveAsButton = document.getElementById('saveAsButton');
+            saveAsButton.disabled = true;
+            saveAsButton.textContent = '💾 Saving...';
+            
+            try {
+                const url = getAPIPath('/api/files?scope=' + encodeURIComponent(currentFileScope));
+                console.log('DEBUG: Save As - scope:', currentFileScope, 'fileName:', fileName, 'url:', url);
+                const response = await fetch(url, {
+                    method: 'POST',
+                    headers: getAuthHeadersWithJSON(),
+                    body: JSON.stringify({
+                        name: fileName,
+                        content: content
+                    })
+                });
+                
+                if (response.status === 401) {
+                    logout();
+                    return;
+                }
+                
+                if (response.ok) {
+                    // Switch to the new file
+                    currentFileName = fileName;
+                    originalContent = content;
+                    isFileModified = false;
+                    collabConnect('file', currentFileScope, fileName, content);
+                    
+                    // Refresh file list and select the new file
+                    await loadFileList();
+                    document.getElementById('fileSelect').value = fileName;
+                    
+                    updateSaveButtonStates();
+                    showOutput('File saved as: ' + fileName, 'success');
+                } else {
+                    const error = await response.text();
+                    showOutput('Save As failed: ' + error, 'error');
+                }
+                
+            } catch (error) {
+                showOutput('Save As error: ' + error.message, 'error');
+            } finally {
+                saveAsButton.disabled = false;
+                saveAsButton.textContent = '💾 Save As...';
+            }
+        }
+
+        // Save button event listener        
+        async function refreshFilesForCurrentScope(options) {
+            const opts = options || {};
+            const fileSelect = document.getElementById('fileSelect');
+            if (fileSelect) {
+                fileSelect.innerHTML = '<option value="">Select a file...</option>';
+                fileSelect.value = '';
+            }
+            currentFileName = '';
+            fileEditorContent = '';
+            fileEditorFileName = '';
+            collabDisconnect();
+            if (editor && !opts.preserveEditorContent) {
+                editor.setValue('');
+            }
+            updateSaveButtonStates();
+            updateRunButtonState();
+            if (!authToken || opts.skipLoadList) {
+                return;
+            }
+            await loadFileList();
+        }
+
+        // Load list of files from the server
+        async function loadFileList() {
+            console.log('DEBUG: loadFileList called, authToken:', !!authToken, 'scope:', currentFileScope);
+            
+            if (!authToken) {
+                console.log('DEBUG: No authToken, skipping file list load');
+                return;
+            }
+            
+            try {
+                const url = getAPIPath('/api/files?scope=' + encodeURIComponent(currentFileScope));
+                console.log('DEBUG: Fetching file list from:', url);
+                
+                const headers = getAuthHeaders();
+                console.log('DEBUG: Using headers:', headers);
+                
+                const response = await fetch(url, {
+                    headers: headers
+                });
+                
+                console.log('DEBUG: Response status:', response.status);
+                
+                if (response.status === 401) {
+                    console.log('DEBUG: Unauthorized, logging out');
+                    logout();
+                    return;
+                }
+                
+                if (response.ok) {
+                    const result = await response.json();
+                    console.log('DEBUG: Received response:', result);
+                    
+                    if (result.result === "OK") {
+                        const files = result.data;
+                        console.log('DEBUG: Received files:', files);
+                        
+                        const fileSelect = document.getElementById('fileSelect');
+                        fileSelect.innerHTML = '<option value="">Select a file...</option>';
+                        
+                        if (files && files.length > 0) {
+                            files.forEach(file => {
+                                const option = document.createElement('option');
+                                option.value = file;
+                                option.textContent = file;
+                                fileSelect.appendChild(option);
+                            });
+                            fileSelect.disabled = false;
+                            console.log('DEBUG: Added', files.length, 'files to dropdown');
+                        } else {
+                            console.log('DEBUG: No files found');
+                        }
+                    } else {
+                        console.log('DEBUG: File list error:', result.data);
+                        showOutput('Failed to load file list: ' + result.data, 'error');
+                    }
+                } else {
+                    console.error('DEBUG: Failed to load files:', response.statusText);
+                }
+            } catch (error) {
+                console.error('DEBUG: Error loading file list:', error);
+            }
+        }        
+        // Populate the dropdown with files
+        function populateFileDropdown(files) {
+            const select = document.getElementById('fileSelect');
+            
+            select.innerHTML = '<option value="">Select a file...</option>';
+            
+            files.forEach(file => {
+                const option = document.createElement('option');
+                option.value = file;
+                option.textContent = file;
+                select.appendChild(option);
+            });
+        }
+        
+        // Get function list
+        async function fetchUserFunctions() {
+            try {
+                const response = await fetch(getAPIPath('/api/functions'), {
+                    headers: getAuthHeaders()
+                });
+                if (response.ok) {
+                    const result = await response.json();
+                    if (result.result === "OK" && Array.isArray(result.data)) {
+                        return result.data;
+                    }
+                }
+            } catch (e) {
+                console.error('Failed to fetch user functions:', e);
+            }
+            return [];
+        }
+
+        // Search the backend symbol index for workspace functions and variables
+        async function fetchWorkspaceSymbols(query) {
+            try {
+                const url = getAPIPath('/api/index/symbols?q=' + encodeURIComponent(query || '') + '&scope=' + encodeURIComponent(currentFileScope));
+                const response = await fetch(url, {
+                    headers: getAuthHeaders()
+                });
+                if (response.ok) {
+                    const result = await response.json();
+                    if (result.result === "OK" && Array.isArray(result.data)) {
+                        return result.data;
+                    }
+                }
+            } catch (e) {
+                console.error('Failed to fetch workspace symbols:', e);
+            }
+            return [];
+        }
+
+        // Load the builtin metadata (name, category, signature, summary, example)
+        async function fetchBuiltins() {
+            try {
+                const response = await fetch(getAPIPath('/api/builtins'), {
+                    headers: getAuthHeaders()
+                });
+                if (response.ok) {
+                    const result = await response.json();
+                    if (result.result === "OK" && Array.isArray(result.data)) {
+                        chariotBuiltins = result.data;
+                    }
+                }
+            } catch (e) {
+                console.error('Failed to fetch builtins:', e);
+            }
+            return chariotBuiltins;
+        }
+
+        // Update the loadFile function to track original content
+        async function loadFile(fileName) {
+            if (!authToken) return;
+
+            const previousFileName = currentFileName;
+            
+            try {
+                const url = getAPIPath('/api/files/' + encodeURIComponent(fileName) + '?scope=' + encodeURIComponent(currentFileScope));
+                console.log('DEBUG: Load file - scope:', currentFileScope, 'fileName:', fileName, 'url:', url);
+                const response = await fetch(url, {
+                    headers: getAuthHeaders()
+                });
+                
+                if (response.status === 401) {
+                    logout();
+                    return;
+                }
+                
+                if (response.ok) {
+                    const result = await response.json();
+                    if (result.result === "OK") {
+                        const content = result.data;
+                        if (editor) {
+                            collabDisconnect();
+                            editor.setValue(content);
+                            currentFileName = fileName;
+                            originalContent = content; // Track original content
+                            isFileModified = false;
+                            fileEditorContent = content;
+                            fileEditorFileName = fileName;
+                            collabConnect('file', currentFileScope, fileName, content);
+                            updateSaveButtonStates();
+                            updateRunButtonState(); // Update Run button state on file load
+                            await clearBreakpointsOnServer(previousFileName || fileName);
+                            await syncBreakpointsWithServer(fileName);
+                            resetDebuggerUI('Ready', { preservePanelState: true });
+                        }
+                    } else {
+                        console.error('Failed to load file:', result.data);
+                        alert('Failed to load file: ' + result.data);
+                    }
+                } else {
+                    console.error('Failed to load file:', response.statusText);
+                    alert('Failed to load file: ' + fileName);
+                }
+            } catch (error) {
+                console.error('Error loading file:', error);
+                alert('Error loading file: ' + fileName);
+            }
+        }
+
+        // Rename current file
+        async function renameFile() {
+            if (!authToken) {
+                showOutput('Please log in first', 'error');
+                return;
+            }
+            
+            if (!currentFileName) {
+                showOutput('No file selected to rename', 'error');
+                return;
+            }
+            
+            // Prompt for new filename
+            const newFileName = prompt('Enter new filename (with .ch extension):', currentFileName);
+            if (!newFileName || newFileName === currentFileName) {
+                return; // User cancelled or didn't change name
+            }
+            
+            // Validate filename
+            if (!newFileName.endsWith('.ch')) {
+                showOutput('Filename must end with .ch extension', 'error');
+                return;
+            }
+            
+            const renameButton = document.getElementById('renameButton');
+            renameButton.disabled = true;
+            renameButton.textContent = '📝 Renaming...';
+            
+            try {
+                // Get current content
+                const content = editor.getValue();
+                
+                // Save with new name
+                const saveUrl = getAPIPath('/api/files?scope=' + encodeURIComponent(currentFileScope));
+                const saveResponse = await fetch(saveUrl, {
+                    method: 'POST',
+                    headers: getAuthHeadersWithJSON(),
+                    body: JSON.stringify({
+                        name: newFileName,
+                        content: content
+                    })
+                });
+                
+                if (saveResponse.status === 401) {
+                    logout();
+                    return;
+                }
+                
+                if (!saveResponse.ok) {
+                    const error = await saveResponse.text();
+                    showOutput('Rename failed: ' + error, 'error');
+                    return;
+                }
+                
+                // Delete old file
+                const deleteUrl = getAPIPath('/api/files/' + encodeURIComponent(currentFileName) + '?scope=' + encodeURIComponent(currentFileScope));
+                const deleteResponse = await fetch(deleteUrl, {
+                    method: 'DELETE',
+                    headers: getAuthHeaders()
+                });
+                
+                if (deleteResponse.status === 401) {
+                    logout();
+                    return;
+                }
+                
+                const oldFileName = currentFileName;
+                currentFileName = newFileName;
+                originalContent = content;
+                collabConnect('file', currentFileScope, newFileName, content);
+                
+                // Refresh file list and select the renamed file
+                await loadFileList();
+                document.getElementById('fileSelect').value = newFileName;
+                
+                updateSaveButtonStates();
+                showOutput('File renamed from "' + oldFileName + '" to "' + newFileName + '"', 'success');
+                
+            } catch (error) {
+                showOutput('Rename error: ' + error.message, 'error');
+            } finally {
+                renameButton.disabled = false;
+                renameButton.textContent = '📝 Rename';
+            }
+        }
+
+        // Delete current file
+        async function deleteFile() {
+            if (!authToken) {
+                showOutput('Please log in first', 'error');
+                return;
+            }
+            
+            if (!currentFileName) {
+                showOutput('No file selected to delete', 'error');
+                return;
+            }
+            
+            // Confirm deletion
+            if (!confirm('Are you sure you want to delete "' + currentFileName + '"? This action cannot be undone.')) {
+                return;
+            }
+            
+            const deleteButton = document.getElementById('deleteButton');
+            deleteButton.disabled = true;
+            deleteButton.textContent = '🗑️ Deleting...';
+            
+            try {
+                const url = getAPIPath('/api/files/' + encodeURIComponent(currentFileName) + '?scope=' + encodeURIComponent(currentFileScope));
+                const response = await fetch(url, {
+                    method: 'DELETE',
+                    headers: getAuthHeaders()
+                });
+                
+                if (response.status === 401) {
+                    logout();
+                    return;
+                }
+                
+                if (response.ok) {
+                    const deletedFileName = currentFileName;
+                    collabDisconnect();
+                    
+                    // Clear editor and file selection
+                    if (editor) {
+                        editor.setValue('');
+                    }
+                    currentFileName = '';
+                    originalContent = '';
+                    isFileModified = false;
+                    
+                    // Refresh file list and reset selection
+                    await loadFileList();
+                    document.getElementById('fileSelect').value = '';
+                    
+                    updateSaveButtonStates();
+                    updateRunButtonState();
+                    showOutput('File deleted: "' + deletedFileName + '"', 'success');
+                } else if (response.status === 409) {
+                    showOutput('Delete failed: ' + lockConflictMessage(await response.text()), 'error');
+                } else {
+                    const error = await response.text();
+                    showOutput('Delete failed: ' + error, 'error');
+                }
+                
+            } catch (error) {
+                showOutput('Delete error: ' + error.message, 'error');
+            } finally {
+                deleteButton.disabled = false;
+                deleteButton.textContent = '🗑️ Delete';
+            }
+        }
+
@@ -0,0 +1,327 @@
+        function initializeFunctionLibraryToolbar() {
+            if (functionsToolbarInitialized) return;
+            const functionSelect = document.getElementById('functionSelect');
+            const newFunctionButton = document.getElementById('newFunctionButton');
+            const saveFunctionButton = document.getElementById('saveFunctionButton');
+            const saveAsFunctionButton = document.getElementById('saveAsFunctionButton');
+            const deleteFunctionButton = document.getElementById('deleteFunctionButton');
+            const saveLibraryButton = document.getElementById('saveLibraryButton');
+
+            // Populate dropdown when Function Library tab is activated
+            document.getElementById('functionsTab').addEventListener('click', async function() {
+                await loadFunctionList();
+                // Restore previous selection if available
+                const functionSelect = document.getElementById('functionSelect');
+                if (functionEditorFunctionName && functionSelect) {
+                    functionSelect.value = functionEditorFunctionName;
+                }
+            });
+
+            // New function handler
+            newFunctionButton.addEventListener('click', newFunction);
+
+            // Save function handler
+            saveFunctionButton.addEventListener('click', saveFunction);
+
+            // Save As function handler
+            saveAsFunctionButton.addEventListener('click', saveAsFunction);
+
+            // Save library handler
+            saveLibraryButton.addEventListener('click', saveLibrary);
+
+            // Delete function handler
+            deleteFunctionButton.addEventListener('click', async function() {
+                if (!authToken) {
+                    showOutput('Please log in first', 'error');
+                    return;
+                }
+                const functionName = functionSelect.value;
+                if (!functionName) {
+                    showOutput('No function selected to delete', 'error');
+                    return;
+                }
+                if (!confirm('Are you sure you want to delete the function "' + functionName + '"? This cannot be undone.')) {
+                    return;
+                }
+                deleteFunctionButton.disabled = true;
+                deleteFunctionButton.textContent = '🗑️ Deleting...';
+                try {
+                    const response = await fetch('/charioteer/api/function/delete?name=' + encodeURIComponent(functionName), {
+                        method: 'DELETE',
+                        headers: getAuthHeaders()
+                    });
+                    const result = await response.json();
+                    if (response.ok && result.result === "OK") {
+                        showOutput('Function deleted: ' + functionName, 'success');
+                        await loadFunctionList();
+                        functionSelect.value = ''; // Clear selection
+                        editor.setValue(''); // Clear editor
+                    } else {
+                        showOutput('Delete failed: ' + (result.data || response.statusText), 'error');
+                    }
+                } catch (e) {
+                    showOutput('Delete error: ' + e.message, 'error');
+                } finally {
+                    deleteFunctionButton.disabled = false;
+                    deleteFunctionButton.textContent = '🗑️ Delete';
+                }
+            });
+
+            // Enable/disable buttons based on selection
+            functionSelect.addEventListener('change', async function() {
+                const hasSelection = !!functionSelect.value;
+                saveFunctionButton.disabled = !hasSelection;
+                deleteFunctionButton.disabled = !hasSelection;
+
+                if (hasSelection) {
+                    await loadFunctionSource(functionSelect.value);
+                }
+            });
+
+            // Initially disable all buttons
+            newFunctionButton.disabled = false; // Enable new function button if logged in
+            saveFunctionButton.disabled = true;
+            saveAsFunctionButton.disabled = true; // Enable as needed
+            deleteFunctionButton.disabled = true;
+            saveLibraryButton.disabled = false; // Enable as needed
+            functionsToolbarInitialized = true;
+        }
+
+        function newFunction() {
+            if (!authToken) {
+                showOutput('Please log in first', 'error');
+                return;
+            }
+            // Clear editor and reset state for new function
+            editor.setValue('');
+            currentFileName = '';
+            originalContent = '';
+            isFileModified = false;
+            functionEditorContent = '';
+            functionEditorFunctionName = '';
+            updateSaveButtonStates();
+            updateRunButtonState();
+        }
+
+        // Load function list from backend and populate dropdown
+        async function loadFunctionList() {
+            const functionSelect = document.getElementById('functionSelect');
+            functionSelect.innerHTML = '<option value="">Select a function...</option>';
+            functionSelect.disabled = true;
+
+            try {
+                const response = await fetch('/charioteer/api/functions', { headers: getAuthHeaders() });
+                if (response.ok) {
+                    const result = await response.json();
+                    if (result.result === "OK" && Array.isArray(result.data)) {
+                        const unique = Array.from(new Set(result.data));
+                        unique.forEach(fn => {
+                            const option = document.createElement('option');
+                            option.value = fn;
+                            option.textContent = fn;
+                            functionSelect.appendChild(option);
+                        });
+                        functionSelect.disabled = false;
+                    }
+                }
+            } catch (e) {
+                console.error('Failed to load function list:', e);
+            }
+        }
+
+        // Fetch and display the selected function's source code
+        async function loadFunctionSource(functionName) {
+            try {
+                const response = await fetch('/charioteer/api/function?name=' + encodeURIComponent(functionName), {
+                    headers: getAuthHeaders()
+                });
+                if (response.ok) {
+                    const result = await response.json();
+                    if (result.result === "OK" && result.data && typeof result.data === "object") {
+                        // Assume result.data = { name: "foo", args: ["a", "b"], body: "..." }
+                        const fn = result.data;
+                        // Format as Chariot function definition
+                        let code = "function " + fn.name + "(" + (fn.args || []).join(', ') + ") {\n" + fn.body + "\n}";
+                        if (editor) {
+                            editor.setValue(code);
+                            currentFileName = ''; // Not a file
+                            originalContent = code;
+                            isFileModified = false;
+                            functionEditorContent = code;
+                            functionEditorFunctionName = functionName;
+                            updateSaveButtonStates();
+                            updateRunButtonState();
+                        }
+                    } else if (result.result === "OK" && typeof result.data === "string") {
+                        // If backend just returns the raw function code as a string
+                        if (editor) {
+                            editor.setValue(result.data);
+                            currentFileName = '';
+                            originalContent = result.data;
+                            isFileModified = false;
+                            functionEditorContent = result.data;
+                            functionEditorFunctionName = functionName;
+                            updateSaveButtonStates();
+                            updateRunButtonState();
+                        }
+                    } else {
+                        showOutput('Failed to load function: ' + (result.data || 'Unknown error'), 'error');
+                    }
+                } else {
+                    showOutput('Failed to load function: ' + response.statusText, 'error');
+                }
+            } catch (e) {
+                showOutput('Error loading function: ' + e.message, 'error');
+            }
+        }
+
+        // Save/update a function
+        async function saveFunction() {
+            if (!authToken) {
+                showOutput('Please log in first', 'error');
+                return;
+            }
+            const code = editor.getValue();
+            // Simple regex to extract function name, args, and body
+            const match = code.match(/function\s+([a-zA-Z_][\w]*)\s*\(([^)]*)\)\s*\{([\s\S]*)\}$/);
+            if (!match) {
+                showOutput('Invalid function format. Please use: function name(args) { ... }', 'error');
+                return;
+            }
+            const name = match[1].trim();
+            const args = match[2].split(',').map(s => s.trim()).filter(Boolean);
+            let body = match[3];
+            // Remove the last closing brace if present (since [\s\S]*$ is greedy)
+            if (body.endsWith('}')) {
+                body = body.slice(0, -1);
+            }
+            body = body.replace(/^\s*\n/, ''); // Remove leading newline
+
+            const saveFunctionButton = document.getElementById('saveFunctionButton');
+            saveFunctionButton.disabled = true;
+            saveFunctionButton.textContent = '💾 Saving...';
+
+            try {
+                const response = await fetch('/charioteer/api/function/save', {
+                    method: 'POST',
+                    headers: getAuthHeadersWithJSON(),
+                    body: JSON.stringify({
+                        name: name,
+                        code: code // send the full code string
+                    })
+                });
+                const result = await response.json();
+                if (response.ok && result.result === "OK") {
+                    showOutput('Function saved: ' + name, 'success');
+                    await loadFunctionList();
+                    document.getElementById('functionSelect').value = name;
+                } else {
+                    showOutput('Save failed: ' + (result.data || response.statusText), 'error');
+                }
+            } catch (e) {
+                showOutput('Save error: ' + e.message, 'error');
+            } finally {
+                saveFunctionButton.disabled = false;
+                saveFunctionButton.textContent = '💾 Save';
+            }
+        }
+
+        // Save as new file
+        async function saveAsFunction() {
+            if (!authToken) {
+                showOutput('Please log in first', 'error');
+                return;
+            }
+            
+            const content = editor.getValue();
+            if (!content.trim()) {
+                showOutput('No content to save', 'error');
+                return;
+            }
+            
+            // Prompt for function name
+            const functionName = prompt('Enter function name:', 'newFunction');
+            if (!functionName) {
+                return; // User cancelled
+            }
+
+            // Validate function name
+            if (!/^[a-zA-Z_][\w]*$/.test(functionName)) {
+                showOutput('Invalid function name. Please use a valid identifier.', 'error');
+                return;
+            }
+
+            const saveAsButton = document.getElementById('saveAsButton');
+            saveAsButton.disabled = true;
+            saveAsButton.textContent = '💾 Saving...';
+
+            try {
+                const response = await fetch('/charioteer/api/function/save', {
+                    method: 'POST',
+                    headers: getAuthHeadersWithJSON(),
+                    body: JSON.stringify({
+                        name: functionName,
+                        code: content
+                    })
+                });
+
+                if (response.status === 401) {
+                    logout();
+                    return;
+                }
+
+                if (response.ok) {
+                    // Switch to the new function
+                    currentFunctionName = functionName;
+                    originalContent = content;
+                    isFileModified = false;
+
+                    // Refresh function list and select the new function
+                    await loadFunctionList();
+                    document.getElementById('functionSelect').value = functionName;
+
+                    updateSaveButtonStates();
+                    showOutput('Function saved as: ' + functionName, 'success');
+                } else {
+                    const error = await response.text();
+                    showOutput('Save As failed: ' + error, 'error');
+                }
+
+            } catch (error) {
+                showOutput('Save As error: ' + error.message, 'error');
+            } finally {
+                saveAsButton.disabled = false;
+                saveAsButton.textContent = '💾 Save As...';
+            }
+        }
+
+        // Save the entire function library
+        async function saveLibrary() {
+            if (!authToken) {
+                showOutput('Please log in first', 'error');
+                return;
+            }
+            const saveLibraryButton = document.getElementById('saveLibraryButton');
+            saveLibraryButton.disabled = true;
+            saveLibraryButton.textContent = '💾 Saving...';
+
+            try {
+                const response = await fetch('/charioteer/api/library/save', {
+                    method: 'POST',
+                    headers: getAuthHeadersWithJSON()
+                });
+                const result = await response.json();
+                if (response.ok && result.result === "OK") {
+                    showOutput('Library saved successfully', 'success');
+                } else {
+                    showOutput('Save library failed: ' + (result.data || response.statusText), 'error');
+                }
+            } catch (e) {
+                showOutput('Save library error: ' + e.message, 'error');
+            } finally {
+                saveLibraryButton.disabled = false;
+                saveLibraryButton.textContent = '💾 Save Library';
+            }
+        }
+         
+        // Login functionality
@@ -0,0 +1,481 @@
+        // Initialize the editor
+        function initializeEditor() {
+            // Initialize Monaco Editor
+            require(['vs/editor/editor.main'], function () {
+                setupMonacoEditor();
+            });
+        }
+        
+        // Initialize splitter for resizing
+        function initializeSplitter() {
+            const splitter = document.getElementById('splitter');
+            const bottomPanel = document.getElementById('bottomPanel');
+            
+            splitter.addEventListener('mousedown', function(e) {
+                isResizing = true;
+                document.addEventListener('mousemove', handleResize);
+                document.addEventListener('mouseup', stopResize);
+                e.preventDefault();
+            });
+            
+            function handleResize(e) {
+                if (!isResizing) return;
+                
+                const containerHeight = window.innerHeight - 50;
+                const mouseY = e.clientY - 50;
+                const newBottomHeight = containerHeight - mouseY;
+                
+                if (newBottomHeight >= 100 && newBottomHeight <= containerHeight - 200) {
+                    bottomPanel.style.height = newBottomHeight + 'px';
+                    if (editor) {
+                        editor.layout();
+                    }
+                }
+            }
+            
+            function stopResize() {
+                isResizing = false;
+                document.removeEventListener('mousemove', handleResize);
+                document.removeEventListener('mouseup', stopResize);
+            }
+        }
+
+
+        // Initialize left panel splitter for resizing
+        function initializeLeftSplitter() {
+            const leftSplitter = document.getElementById('leftSplitter');
+            const leftPanel = document.getElementById('leftPanel');
+            let isLeftResizing = false;
+            
+            leftSplitter.addEventListener('mousedown', function(e) {
+                isLeftResizing = true;
+                document.addEventListener('mousemove', handleLeftResize);
+                document.addEventListener('mouseup', stopLeftResize);
+                e.preventDefault();
+            });
+            
+            function handleLeftResize(e) {
+                if (!isLeftResizing) return;
+                
+                const newWidth = e.clientX;
+                
+                if (newWidth >= 200 && newWidth <= 600) {
+                    leftPanel.style.width = newWidth + 'px';
+                    if (editor) {
+                        editor.layout();
+                    }
+                }
+            }
+            
+            function stopLeftResize() {
+                isLeftResizing = false;
+                document.removeEventListener('mousemove', handleLeftResize);
+                document.removeEventListener('mouseup', stopLeftResize);
+            }
+        }
+
+        // Helper function to get auth headers
+        function getAuthHeaders() {
+            const headers = {};
+            if (authToken) {
+                headers['Authorization'] = authToken;
+            } else {
+                // Check localStorage for token
+                const savedToken = localStorage.getItem(CHARIOTEER_CONFIG.tokenKey);
+                if (savedToken) {
+                    headers['Authorization'] = savedToken;
+                    authToken = savedToken; // Update current token
+                }
+            }
+            console.log('DEBUG: getAuthHeaders', headers);
+            return headers;
+        }
+        
+        // Helper function to get auth headers with JSON content type
+        function getAuthHeadersWithJSON() {
+            const headers = getAuthHeaders();
+            headers['Content-Type'] = 'application/json';
+            console.log('DEBUG: getAuthHeadersWithJSON', headers);
+            return headers;
+        }
+        
+        // Helper function to get the correct API path (with /charioteer prefix when needed)
+        function getAPIPath(path) {
+            // The server tells us the base path it was reached through
+            const base = CHARIOTEER_CONFIG.apiBase;
+            if (base) {
+                return path.startsWith(base + '/') ? path : base + path;
+            }
+            // Check if we're being accessed through a proxy path (like /charioteer/)
+            const currentPath = window.location.pathname;
+            if (currentPath.startsWith('/charioteer/')) {
+                // If the path doesn't already start with /charioteer/, add it
+                if (!path.startsWith('/charioteer/')) {
+                    return '/charioteer' + path;
+                }
+            }
+            return path;
+        }
+
+        async function fetchSessionProfile(options) {
+            const opts = options || {};
+            if (!authToken) {
+                return null;
+            }
+            try {
+                const resp = await fetch(getAPIPath('/api/session/profile'), { headers: getAuthHeaders() });
+                if (!resp.ok) {
+                    if (resp.status === 401) {
+                        logout();
+                    }
+                    return null;
+                }
+                const payload = await resp.json().catch(() => null);
+                const data = payload?.data || payload?.Data || payload;
+                if (!data) {
+                    return null;
+                }
+                // Parse scopes from backend, default to both global and sandbox if not provided
+                const scopes = Array.isArray(data.sandbox_scopes)
+                    ? data.sandbox_scopes.map(s => String(s || '').toLowerCase()).filter(Boolean)
+                    : ['global', 'sandbox'];
+                const resolvedScope = String(data.sandbox_scope_default || 'global').toLowerCase();
+                sandboxProfile = {
+                    enabled: data.sandbox_enabled !== undefined ? !!data.sandbox_enabled : true,
+                    scopes: scopes.length ? Array.from(new Set(scopes)) : ['global', 'sandbox'],
+                    defaultScope: resolvedScope,
+                    currentScope: resolvedScope
+                };
+                currentFileScope = sandboxProfile.currentScope;
+                sessionIsAdmin = !!data.admin;
+                accountProfile = data.mfa_enabled === undefined ? null : {
+                    mfaEnabled: !!data.mfa_enabled,
+                    passwordExpiresAt: data.password_expires_at || null
+                };
+                applyDiagramScopeUI();
+                applyFileScopeUI();
+                if (opts.syncFileScope) {
+                    await refreshFilesForCurrentScope();
+                }
+                return data;
+            } catch (e) {
+                console.warn('Failed to load session profile', e);
+                return null;
+            }
+        }
+
+        function resetSandboxProfile() {
+            sandboxProfile = {
+                enabled: false,
+                scopes: ['global'],
+                defaultScope: 'global',
+                currentScope: 'global'
+            };
+            currentFileScope = 'global';
+            applyDiagramScopeUI();
+            applyFileScopeUI();
+        }
+        
+        // Set up Monaco editor (called from initializeEditor)
+        function setupMonacoEditor() {
+            // Dispose of existing editor instance completely before creating new one
+            if (editor) {
+                try {
+                    const model = editor.getModel();
+                    if (model) model.dispose();
+                    editor.dispose();
+                } catch (e) {
+                    console.warn('Editor disposal error:', e);
+                }
+                editor = null;
+            }
+            
+            // Register Chariot language
+            monaco.languages.register({ id: 'chariot' });
+            
+            // Set up Chariot syntax highlighting with NO user functions initially
+            setChariotTokenizer([]);
+            registerChariotProviders();
+            
+            // Create editor with empty content
+            editor = monaco.editor.create(document.getElementById('editorContainer'), {
+                value: '',
+                language: 'chariot',
+                theme: 'vs-dark',
+                automaticLayout: true,
+                fontSize: 14,
+                minimap: { enabled: true },
+                scrollBeyondLastLine: false,
+                wordWrap: 'on',
+                glyphMargin: true, // Enable glyph margin for breakpoints
+                // Add bracket matching configuration
+                matchBrackets: 'always',
+                renderLineHighlight: 'gutter',
+                bracketPairColorization: {
+                    enabled: true
+                },
+                guides: {
+                    bracketPairs: true,
+                    bracketPairsHorizontal: false,
+                    highlightActiveBracketPair: true
+                },
+                // Disable any conflicting keybindings
+                cursorBlinking: 'smooth',
+                cursorSmoothCaretAnimation: false
+            });
+            
+            // Add glyph margin click handler for breakpoints
+            editor.onMouseDown((e) => {
+                if (e.target.type === monaco.editor.MouseTargetType.GUTTER_GLYPH_MARGIN) {
+                    const lineNumber = e.target.position.lineNumber;
+                    toggleBreakpoint(lineNumber);
+                }
+            });
+            
+            // Add event listener for content changes            
+            // Initialize UI
+            trackFileChanges(); // Add this line
+            initSyntaxChecking();
+            
+            // Initialize event handlers
+            initializeEventHandlers();
+ 
+            // Initialize splitters
+            initializeSplitter();
+            initializeLeftSplitter();
+
+            applyDiagramScopeUI();
+            applyFileScopeUI();
+
+            // Set initial UI state (logged out)
+            updateAuthUI(false);
+            
+            // Check for existing token
+            checkExistingAuth();
+
+            initializeFunctionLibraryToolbar();
+        }
+        
+        // Check for existing authentication
+        async function checkExistingAuth() {
+            const savedToken = localStorage.getItem(CHARIOTEER_CONFIG.tokenKey);
+            const savedUser = localStorage.getItem('chariot_user');
+            
+            if (savedToken && savedUser) {
+                authToken = savedToken;
+                sessionId = savedToken; // Use token as session ID
+                currentUser = savedUser;
+
+                // Start session management for existing session
+                startSessionManagement();                
+
+                updateAuthUI(true);
+                await fetchSessionProfile({ syncFileScope: true });
+                await fetchBuiltins();
+                const functionNames = await fetchUserFunctions();
+                setChariotTokenizer(functionNames);
+            }
+        }
+        
+        // Regex source matching calls of the named functions
+        function callRegexSource(names) {
+            const escaped = names.map(fn => fn.replace(/[.*+?^${}()|[\]\\]/g, '\\$&'));
+            // Build the regex as a string, not a RegExp object!
+            return "\\b(" + escaped.join('|') + ")\\b(?=\\s*\\()";
+        }
+
+        function setChariotTokenizer(userFunctions) {
+            // Clone the base rules
+            let rules = CHARIOT_MONARCH_BASE_RULES.slice();
+            chariotUserFunctions = userFunctions || [];
+
+            // Builtin rules (one per category), then the user function rule, before the identifier rule
+            const byCategory = {};
+            chariotBuiltins.forEach(b => {
+                (byCategory[b.category] = byCategory[b.category] || []).push(b.name);
+            });
+            const callRules = Object.keys(byCategory).sort().map(category =>
+                [callRegexSource(byCategory[category]), 'keyword.chariot.' + category]);
+            if (userFunctions && userFunctions.length > 0) {
+                callRules.push([callRegexSource(userFunctions), 'keyword.function.user']);
+            }
+            // Find the index of the identifier rule
+            const idx = rules.findIndex(rule => Array.isArray(rule) && rule[1] === 'identifier');
+            if (idx !== -1) {
+                rules.splice(idx, 0, ...callRules);
+            }
+
+            monaco.languages.setMonarchTokensProvider('chariot', {
+                tokenizer: {
+                    root: rules,
+                    comment: [
+                        [/[^/*]+/, 'comment'],
+                        [/\*\//, 'comment', '@pop'],
+                        [/[/*]/, 'comment']
+                    ],
+                    
+                    string: [
+                        [/[^\\"]+/, 'string'],
+                        [/\\./, 'string.escape'],
+                        [/"/, 'string', '@pop']
+                    ],
+                    
+                    string_single: [
+                        [/[^\\']+/, 'string'],
+                        [/\\./, 'string.escape'],
+                        [/'/, 'string', '@pop']
+                    ]
+                }
+            });
+            // Configure bracket pairs for Chariot language
+            monaco.languages.setLanguageConfiguration('chariot', {
+                brackets: [
+                    ['(', ')'],
+                    ['[', ']'],
+                    ['{', '}']
+                ],
+                autoClosingPairs: [
+                    { open: '(', close: ')' },
+                    { open: '[', close: ']' },
+                    { open: '{', close: '}' },
+                    { open: '"', close: '"' },
+                    { open: "'", close: "'" }
+                ],
+                surroundingPairs: [
+                    { open: '(', close: ')' },
+                    { open: '[', close: ']' },
+                    { open: '{', close: '}' },
+                    { open: '"', close: '"' },
+                    { open: "'", close: "'" }
+                ],
+                colorizedBracketPairs: [
+                    ['(', ')'],
+                    ['[', ']'],
+                    ['{', '}']
+                ]
+            });
+
+        }
+
+        // Completion and hover from the builtin metadata and the user functions,
+        // completion adding the workspace symbols the backend has indexed.
+        // Registered once; the providers read chariotBuiltins and
+        // chariotUserFunctions, so they follow setChariotTokenizer.
+        let chariotProvidersRegistered = false;
+        function registerChariotProviders() {
+            if (chariotProvidersRegistered) return;
+            chariotProvidersRegistered = true;
+
+            const builtinDoc = b => {
+                let doc = b.summary || '';
+                if (b.example) doc += '\n\n```\n' + b.example + '\n```';
+                return { value: doc };
+            };
+
+            monaco.languages.registerCompletionItemProvider('chariot', {
+                provideCompletionItems: async (model, position) => {
+                    const word = model.getWordUntilPosition(position);
+                    const range = {
+                        startLineNumber: position.lineNumber,
+                        endLineNumber: position.lineNumber,
+                        startColumn: word.startColumn,
+                        endColumn: word.endColumn
+                    };
+                    const snippet = monaco.languages.CompletionItemInsertTextRule.InsertAsSnippet;
+                    const suggestions = chariotBuiltins.map(b => ({
+                        label: b.name,
+                        kind: monaco.languages.CompletionItemKind.Function,
+                        detail: b.signature + (b.types ? '  ' + b.types : ''),
+                        documentation: builtinDoc(b),
+                        insertText: b.name + '($0)',
+                        insertTextRules: snippet,
+                        range: range
+                    }));
+                    chariotUserFunctions.forEach(name => suggestions.push({
+                        label: name,
+                        kind: monaco.languages.CompletionItemKind.Method,
+                        detail: 'user function',
+                        insertText: name + '($0)',
+                        insertTextRules: snippet,
+                        range: range
+                    }));
+                    if (authToken && word.word) {
+                        const known = new Set(suggestions.map(s => s.label));
+                        (await fetchWorkspaceSymbols(word.word)).forEach(sym => {
+                            if (known.has(sym.name)) return;
+                            const where = (sym.definitions || [])[0];
+                            const isFunction = sym.kind === 'function';
+                            suggestions.push({
+                                label: sym.name,
+                                kind: isFunction ? monaco.languages.CompletionItemKind.Method : monaco.languages.CompletionItemKind.Variable,
+                                detail: sym.kind + (where ? ' — ' + where.file + ':' + where.line : ''),
+                                insertText: isFunction ? sym.name + '($0)' : sym.name,
+                                insertTextRules: snippet,
+                                range: range
+                            });
+                        });
+                    }
+                    return { suggestions: suggestions };
+                }
+            });
+
+            monaco.languages.registerHoverProvider('chariot', {
+                provideHover: (model, position) => {
+                    const word = model.getWordAtPosition(position);
+                    if (!word) return null;
+                    const b = chariotBuiltins.find(b => b.name === word.word);
+                    if (!b) return null;
+                    return {
+                        range: new monaco.Range(position.lineNumber, word.startColumn, position.lineNumber, word.endColumn),
+                        contents: [
+                            { value: '`' + b.signature + '`' + (b.types ? ' ' + b.types : '') + ' — ' + b.category },
+                            builtinDoc(b)
+                        ]
+                    };
+                }
+            });
+        }
+
+        // Update authentication UI
+        function updateAuthUI(isLoggedIn) {
+            const loginSection = document.getElementById('loginSection');
+            const loggedInSection = document.getElementById('loggedInSection');
+            const fileSelect = document.getElementById('fileSelect');
+            const runButton = document.getElementById('runButton');
+            const currentUserSpan = document.getElementById('currentUserSpan');
+
+            // Check if elements exist before trying to use them
+            if (!loginSection || !loggedInSection || !fileSelect || !runButton) {
+                console.log('DEBUG: Some UI elements not found, deferring updateAuthUI');
+                console.log('DEBUG: loginSection:', !!loginSection, 'loggedInSection:', !!loggedInSection, 'fileSelect:', !!fileSelect, 'runButton:', !!runButton);
+                return;
+            }
+
+            updateSaveButtonStates();            
+
+            if (isLoggedIn) {
+                loginSection.style.display = 'none';
+                loggedInSection.style.display = 'flex';
+                fileSelect.disabled = false;
+                // Don't enable run button here - it should only be enabled when there's code
+                console.log('DEBUG: Login successful, Run button remains disabled until code is present');
+                if (currentUserSpan) {
+                    currentUserSpan.textContent = currentUser;
+                }
+                showOutput('Ready', 'success');
+                loadWatches();
+                
+                // Note: Debug WebSocket will connect when execution starts, not on login
+            } else {
+                currentFileName = '';
+                originalContent = '';
+                loginSection.style.display = 'flex';
+                loggedInSection.style.display = 'none';
+                fileSelect.disabled = true;
+                runButton.disabled = true;
+                watchResults = [];
+                renderWatches();
+                showOutput('Please log in to use the editor', 'info');
+            }
+        }
+        
@@ -0,0 +1,880 @@
+        // Tab switching
+        function switchTab(tabName) {
+            document.querySelectorAll('.tab').forEach(tab => {
+                tab.classList.remove('active');
+            });
+            document.querySelector('[data-tab="' + tabName + '"]').classList.add('active');
+            // Toggle visible content for bottom panel
+            if (tabName !== 'problems' && tabName !== 'console') {
+                tabName = 'output';
+            }
+            ['output', 'problems', 'console'].forEach(name => {
+                const content = document.getElementById(name + 'Content');
+                if (content) content.style.display = (name === tabName) ? (name === 'console' ? 'flex' : 'block') : 'none';
+            });
+            currentBottomTab = tabName;
+            if (tabName === 'console') openConsole();
+            updateTabContent();
+        }
+        
+        // Update tab content based on current tab
+        function updateTabContent() {
+            const content = document.getElementById('tabContent');
+            // Content will be updated by specific functions (showOutput, showProblem, etc.)
+        }
+
+        // Runtime inspector state: the state shown in the left panel and the
+        // cursor of the response it came from, so a refresh only fetches the
+        // entries that changed. Nesting deeper than the depth is loaded on click.
+        let runtimeInspect = { cursor: 0, data: null };
+        const RUNTIME_INSPECT_DEPTH = 4;
+
+        function runtimeInspectURL(params) {
+            return '/charioteer/api/runtime/inspect?' + params.toString();
+        }
+
+        function setAtInspectPath(root, path, value) {
+            let node = root;
+            for (let i = 0; i < path.length - 1; i++) {
+                if (node[path[i]] === null || typeof node[path[i]] !== 'object') node[path[i]] = {};
+                node = node[path[i]];
+            }
+            node[path[path.length - 1]] = value;
+        }
+
+        function deleteAtInspectPath(root, path) {
+            let node = root;
+            for (let i = 0; i < path.length - 1; i++) {
+                node = node && node[path[i]];
+            }
+            if (node && typeof node === 'object') delete node[path[path.length - 1]];
+        }
+
+        // Turn the entries of an inspect response back into the object or array they list
+        function inspectEntriesValue(res) {
+            if (res.kind === 'array') return (res.keys || []).map(k => res.entries[k]);
+            if (res.kind === 'object') return res.entries || {};
+            return res.value;
+        }
+
+        function renderRuntimePanel(panel) {
+            panel.innerHTML = '<h3 style="margin: 10px; font-size: 14px; color: #ccc;">Runtime Inspector</h3>' +
+                             '<div class="tree-view">' + renderTree(runtimeInspect.data, null, []) + '</div>';
+            addTreeToggleHandlers(panel);
+        }
+
+        // Refresh the runtime panel, applying the changes since the last refresh
+        async function updateLeftPanel() {
+            // Skip runtime inspection during active execution or when the debugger is paused/stepping with an open socket
+            const debuggerEngaged = !!debugSocket && (debugState === 'paused' || debugState === 'stepping');
+            if (isExecuting || debuggerEngaged) {
+                console.log('Skipping runtime inspection - execution in progress or debugger active');
+                return;
+            }
+            
+            const panel = document.getElementById('runtimePanel');
+            if (!panel) {
+                console.error('runtimePanel not found');
+                return;
+            }
+            try {
+                const params = new URLSearchParams({ depth: RUNTIME_INSPECT_DEPTH });
+                if (runtimeInspect.data && runtimeInspect.cursor) {
+                    params.set('since', runtimeInspect.cursor);
+                }
+                const response = await fetch(runtimeInspectURL(params), { headers: getAuthHeaders() });
+                if (response.ok) {
+                    const result = await response.json();
+                    if (result.result === "OK" && result.data) {
+                        const res = result.data;
+                        if (res.diff && runtimeInspect.data) {
+                            (res.changed || []).forEach(ch => setAtInspectPath(runtimeInspect.data, ch.path, ch.value));
+                            (res.removed || []).forEach(path => deleteAtInspectPath(runtimeInspect.data, path));
+                        } else {
+                            runtimeInspect.data = inspectEntriesValue(res);
+                        }
+                        runtimeInspect.cursor = res.cursor;
+                        renderRuntimePanel(panel);
+                    } else {
+                        runtimeInspect = { cursor: 0, data: null };
+                        panel.innerHTML = '<h3 style="margin: 10px; font-size: 14px; color: #ccc;">Runtime Inspector</h3>' +
+                                         '<div style="color:#f44747; padding:10px;">No runtime data available.</div>';
+                    }
+                } else {
+                    runtimeInspect = { cursor: 0, data: null };
+                    panel.innerHTML = '<h3 style="margin: 10px; font-size: 14px; color: #ccc;">Runtime Inspector</h3>' +
+                                     '<div style="color:#f44747; padding:10px;">Failed to load runtime info.</div>';
+                }
+            } catch (e) {
+                runtimeInspect = { cursor: 0, data: null };
+                panel.innerHTML = '<h3 style="margin: 10px; font-size: 14px; color: #ccc;">Runtime Inspector</h3>' +
+                                 '<div style="color:#f44747; padding:10px;">Error loading runtime info.</div>';
+            }
+        }
+
+        // Load a subtree the inspector cut off at RUNTIME_INSPECT_DEPTH
+        async function loadTruncatedRuntimeNode(path) {
+            const params = new URLSearchParams({ depth: RUNTIME_INSPECT_DEPTH });
+            path.forEach(p => params.append('path', p));
+            try {
+                const response = await fetch(runtimeInspectURL(params), { headers: getAuthHeaders() });
+                const result = await response.json();
+                if (!response.ok || result.result !== "OK" || !runtimeInspect.data) {
+                    showOutput('Failed to load ' + path.join('.') + ': ' + (result.data || response.statusText), 'error');
+                    return;
+                }
+                setAtInspectPath(runtimeInspect.data, path, inspectEntriesValue(result.data));
+                const panel = document.getElementById('runtimePanel');
+                if (panel) renderRuntimePanel(panel);
+            } catch (e) {
+                showOutput('Failed to load ' + path.join('.') + ': ' + e.message, 'error');
+            }
+        }
+
+        // Run code functionality
+        // Ask before running code against an environment marked production
+        function confirmProductionRun() {
+            const env = CHARIOTEER_CONFIG.environment;
+            return !env || !env.production || confirm('Run this code on ' + env.label + '?');
+        }
+
+        async function runCode() {
+            console.log('DEBUG: runCode called');
+            if (!authToken) {
+                // Check local storage for token
+                const savedToken = localStorage.getItem(CHARIOTEER_CONFIG.tokenKey);
+                const savedUser = localStorage.getItem('chariot_user');
+
+                if (savedToken && savedUser) {
+                    authToken = savedToken;
+                    currentUser = savedUser;
+                    updateAuthUI(true);
+                } else {
+                    showOutput('Please log in first', 'error');
+                    return;
+                }
+            }
+            
+            const code = editor.getValue();
+            if (!code.trim()) {
+                showOutput('No code to run', 'info');
+                return;
+            }
+            if (!confirmProductionRun()) return;
+            
+            console.log('DEBUG: Code from editor (' + code.length + ' chars):');
+            console.log(code);
+            console.log('DEBUG: --- END CODE ---');
+            
+            const runButton = document.getElementById('runButton');
+
+            // Connect debug WebSocket if breakpoints are set
+            if (breakpoints.size > 0) {
+                console.log('Breakpoints detected (' + breakpoints.size + '), ensuring debug WebSocket connectivity');
+                try {
+                    await waitForDebugSocketReady();
+                } catch (err) {
+                    console.error('Failed to establish debugger socket before execution:', err);
+                    showOutput('Debugger connection failed. Please retry after reconnecting.', 'error');
+                    if (runButton) {
+                        runButton.disabled = false;
+                        runButton.textContent = '▶ Run';
+                    }
+                    return;
+                }
+            } else {
+                console.log('No breakpoints set, running without debugger');
+                ensureDebugSocketConnected();
+            }
+            
+            if (runButton) {
+                runButton.disabled = true;
+                runButton.textContent = '⏳ Running...';
+            }
+            
+            isExecuting = true; // Block runtime inspection during execution
+            
+            try {
+                showOutput('Executing code...', 'loading');
+                switchTab('output');
+
+                headers = getAuthHeadersWithJSON();  // Use the version with Content-Type
+                console.log('DEBUG: runCode headers', headers);
+                const activeFilename = getCurrentFilename();
+                console.log('DEBUG: Executing with filename:', activeFilename);
+                console.log('DEBUG: Active breakpoints:', Array.from(breakpoints.keys()));
+                
+                const response = await fetch(getAPIPath('/api/execute'), {
+                    method: 'POST',
+                    headers: headers,
+                    body: JSON.stringify({ 
+                        program: code,
+                        filename: activeFilename,
+                        sourceMap: activeDiagramSourceMap(code) || undefined,
+                        record: recordRequested() || undefined,
+                        dryRun: dryRunRequested() || undefined
+                    })
+                });
+                
+                if (response.status === 401) {
+                    showOutput('Authentication expired. Please log in again.', 'error');
+                    logout();
+                    return;
+                }
+                
+                const result = await response.json();
+                updateWatchesFromResult(result);
+                
+                if (response.ok && result.result === "OK") {
+                    showOutput('Result: ' + JSON.stringify(result.data, null, 2), 'success');
+                } else {
+                    const errorMsg = result.result === "ERROR" ? result.data : 'Execution failed';
+                    showOutput('Error: ' + errorMsg, 'error');
+                    reportScriptError(result.error);
+                }
+                renderArtifacts(result);
+                reportTruncated(result);
+                reportTrace(result);
+                reportPlanned(result);
+                
+            } catch (error) {
+                showOutput('Network Error: ' + error.message, 'error');
+            } finally {
+                isExecuting = false; // Re-enable runtime inspection
+                runButton.disabled = false;
+                runButton.textContent = '▶ Run';
+                
+                // Update left panel now that execution is complete
+                // But only if not in a debug session
+                if (debugState !== 'paused' && debugState !== 'stepping') {
+                    updateLeftPanel();
+                }
+                if (!debugSocket && debugState !== 'stopped') {
+                    resetDebuggerUI('Ready');
+                } else if (debugState !== 'paused' && debugState !== 'stepping') {
+                    showRuntimePanel();
+                }
+            }
+        }
+
+        // Run code with streaming logs via SSE
+        async function runCodeAsync() {
+            if (!authToken) {
+                // Try to get the token from the cookie
+                const token = getCookie(CHARIOTEER_CONFIG.tokenKey);
+                if (token) {
+                    authToken = token;
+                    updateAuthUI(true);
+                } else {
+                    showOutput('Please log in first', 'error');
+                    return;
+                }
+            }
+            
+            const code = editor.getValue();
+            if (!code.trim()) {
+                showOutput('No code to run', 'info');
+                return;
+            }
+            if (!confirmProductionRun()) return;
+            
+            const runButton = document.getElementById('runButton');
+            runButton.disabled = true;
+            runButton.textContent = '⏳ Running...';
+            
+            try {
+                showOutput('Starting execution...', 'loading');
+                switchTab('output');
+
+                // Step 1: Start async execution
+                const execResponse = await fetch(getAPIPath('/api/execute-async'), {
+                    method: 'POST',
+                    headers: getAuthHeadersWithJSON(),
+                    body: JSON.stringify({
+                        program: code,
+                        filename: getCurrentFilename(),
+                        sourceMap: activeDiagramSourceMap(code) || undefined,
+                        record: recordRequested() || undefined,
+                        dryRun: dryRunRequested() || undefined,
+                        log_level: controlValue('logLevelSelect') || undefined
+                    })
+                });
+                
+                if (execResponse.status === 401) {
+                    showOutput('Authentication expired. Please log in again.', 'error');
+                    logout();
+                    return;
+                }
+                
+                const execResult = await execResponse.json();
+                
+                if (!execResponse.ok || execResult.result !== "OK") {
+                    const errorMsg = execResult.result === "ERROR" ? execResult.data : 'Failed to start execution';
+                    showOutput('Error: ' + errorMsg, 'error');
+                    return;
+                }
+                
+                const executionId = execResult.data.execution_id;
+                showOutput('Execution ID: ' + executionId + '\n--- Streaming Logs ---\n', 'info');
+                
+                // Step 2: Stream logs via SSE
+                await streamExecutionLogs(executionId);
+                
+                // Step 3: Get final result
+                await getExecutionResult(executionId);
+                
+                // Update left panel to reflect any changes
+                updateLeftPanel();
+                
+            } catch (error) {
+                showOutput('\nNetwork Error: ' + error.message, 'error');
+            } finally {
+                runButton.disabled = false;
+                runButton.textContent = '▶ Run';
+            }
+        }
+
+        // Stream execution logs via Server-Sent Events
+        function streamExecutionLogs(executionId) {
+            return new Promise((resolve, reject) => {
+                // EventSource doesn't support custom headers, so pass token as query param
+                let url = getAPIPath('/api/logs/' + executionId) + '?token=' + encodeURIComponent(authToken);
+                // Filtered on the server, so noisy runs don't flood the page
+                const filter = controlValue('logFilterInput');
+                if (filter) url += '&q=' + encodeURIComponent(filter);
+                const eventSource = new EventSource(url);
+                let failures = 0;           // Reconnects since the last event
+                
+                eventSource.onmessage = (event) => {
+                    failures = 0;
+                    try {
+                        const logEntry = JSON.parse(event.data);
+                        const timestamp = new Date(logEntry.timestamp).toLocaleTimeString();
+                        const levelColor = {
+                            'DEBUG': '#569cd6',
+                            'INFO': '#4ec9b0',
+                            'WARN': '#dcdcaa',
+                            'ERROR': '#f44747'
+                        }[logEntry.level] || '#cccccc';
+                        
+                        const logLine = '<span style="color:' + levelColor + '">[' + logEntry.level + ']</span> ' + 
+                                       '<span style="color:#666">' + timestamp + '</span> ' + 
+                                       logEntry.message;
+                        appendToOutput(logLine);
+                    } catch (err) {
+                        console.error('Failed to parse log entry:', err);
+                    }
+                };
+                
+                eventSource.addEventListener('done', () => {
+                    eventSource.close();
+                    appendToOutput('\n--- Execution Complete ---\n', 'info');
+                    resolve();
+                });
+                
+                // Partial results the script sends with emit
+                eventSource.addEventListener('result', (event) => {
+                    failures = 0;
+                    appendToOutput('<span style="color:#c586c0">[RESULT]</span> ' + escapeHtml(event.data));
+                });
+                
+                // Entries dropped from the server's buffer while disconnected
+                eventSource.addEventListener('gap', (event) => {
+                    try {
+                        const gap = JSON.parse(event.data);
+                        appendToOutput('--- ' + gap.missed + ' log lines missed while reconnecting ---', 'info');
+                    } catch (err) {
+                        console.error('Failed to parse gap event:', err);
+                    }
+                });
+                
+                eventSource.onerror = (error) => {
+                    console.error('SSE error:', error);
+                    // The browser reconnects by itself, sending the last event id so the
+                    // stream resumes where it stopped; give up after a few attempts
+                    failures++;
+                    if (eventSource.readyState !== EventSource.CLOSED && failures <= 3) {
+                        return;
+                    }
+                    eventSource.close();
+                    // Don't reject, just resolve to continue to result fetching
+                    resolve();
+                };
+            });
+        }
+
+        // Get final execution result
+        async function getExecutionResult(executionId) {
+            try {
+                const response = await fetch(getAPIPath('/api/result/' + executionId), {
+                    headers: getAuthHeaders()
+                });
+                
+                if (!response.ok) {
+                    appendToOutput('\nFailed to fetch result (status: ' + response.status + ')', 'error');
+                    return;
+                }
+                
+                const result = await response.json();
+                updateWatchesFromResult(result);
+                
+                if (result.result === "OK") {
+                    appendToOutput('\nFinal Result: ' + JSON.stringify(result.data, null, 2), 'success');
+                } else if (result.result === "ERROR") {
+                    appendToOutput('\nExecution Error: ' + result.data, 'error');
+                    reportScriptError(result.error);
+                } else if (result.result === "PENDING") {
+                    appendToOutput('\nExecution still running...', 'info');
+                }
+                renderArtifacts(result);
+                reportTruncated(result);
+                reportTrace(result);
+                reportPlanned(result);
+            } catch (error) {
+                appendToOutput('\nFailed to fetch result: ' + error.message, 'error');
+            }
+        }
+
+        // Helper function to append to output without clearing
+        function appendToOutput(text, type) {
+            const outputContent = document.getElementById('outputContent');
+            if (!outputContent) return;
+            
+            const line = document.createElement('div');
+            if (type === 'error') {
+                line.style.color = '#f44747';
+            } else if (type === 'success') {
+                line.style.color = '#4ec9b0';
+            } else if (type === 'info') {
+                line.style.color = '#569cd6';
+            } else if (type === 'loading') {
+                line.style.color = '#dcdcaa';
+            }
+            line.innerHTML = text;
+            outputContent.appendChild(line);
+            
+            // Auto-scroll to bottom
+            outputContent.scrollTop = outputContent.scrollHeight;
+        }
+
+        // Whether the run should save an execution trace for replaying
+        function recordRequested() {
+            const toggle = document.getElementById('recordToggle');
+            return !!(toggle && toggle.checked);
+        }
+
+        // Trimmed value of a run control, '' when it is missing
+        function controlValue(id) {
+            const control = document.getElementById(id);
+            return control ? control.value.trim() : '';
+        }
+
+        // Whether the run should skip its writes and report them instead
+        function dryRunRequested() {
+            const toggle = document.getElementById('dryRunToggle');
+            return !!(toggle && toggle.checked);
+        }
+
+        // List the writes a dry run skipped
+        function reportPlanned(result) {
+            if (!result || !result.planned) return;
+            const changes = result.planned.changes || [];
+            if (changes.length === 0) {
+                appendToOutput('Dry run: no changes planned', 'info');
+                return;
+            }
+            const lines = changes.map((c, i) => {
+                const args = (c.args || []).map(a => {
+                    const text = JSON.stringify(a);
+                    return text && text.length > 80 ? text.slice(0, 80) + '...' : text;
+                });
+                return `${i + 1}. ${c.func}(${args.join(', ')})`;
+            });
+            appendToOutput('Dry run: ' + changes.length + ' planned change(s)\n' + escapeHtml(lines.join('\n')), 'info');
+        }
+
+        // Say what was cut from a result over the server's size limit
+        function reportTruncated(result) {
+            if (!result || !result.truncated) return;
+            const t = result.truncated;
+            let note = 'Result truncated: ' + formatBytes(t.size) + ' is over the ' + formatBytes(t.limit) + ' limit';
+            if (t.items) {
+                note += '; showing the first ' + t.kept + ' of ' + t.items + ' items';
+            }
+            note += t.artifact ? '. Download result.full.json below for all of it.' : '. The full result was too large to keep.';
+            appendToOutput(escapeHtml(note), 'info');
+        }
+
+        // Name the execution trace a recorded run saved
+        function reportTrace(result) {
+            if (!result || !result.trace) return;
+            appendToOutput('Trace saved: ' + escapeHtml(result.trace) + ' (replay it from Execution Traces on the dashboard)', 'info');
+        }
+
+        // Show the artifacts a run handed back: small images inline, and a
+        // download link for each
+        function renderArtifacts(result) {
+            const outputContent = document.getElementById('outputContent');
+            if (!outputContent || !result || !Array.isArray(result.artifacts)) return;
+
+            result.artifacts.forEach(artifact => {
+                const figure = document.createElement('figure');
+                figure.className = 'output-artifact';
+                if (artifact.data && artifact.mime_type.startsWith('image/')) {
+                    const img = document.createElement('img');
+                    img.src = 'data:' + artifact.mime_type + ';base64,' + artifact.data;
+                    img.alt = artifact.name;
+                    figure.appendChild(img);
+                }
+                const caption = document.createElement('figcaption');
+                const link = document.createElement('a');
+                link.href = '#';
+                link.textContent = artifact.name;
+                link.title = 'Download until ' + new Date(artifact.expires_at).toLocaleString();
+                link.addEventListener('click', (e) => {
+                    e.preventDefault();
+                    downloadArtifact(artifact);
+                });
+                caption.appendChild(link);
+                caption.appendChild(document.createTextNode(' (' + formatBytes(artifact.size) + ')'));
+                figure.appendChild(caption);
+                outputContent.appendChild(figure);
+            });
+            outputContent.scrollTop = outputContent.scrollHeight;
+        }
+
+        // Download an artifact with the session's credentials
+        async function downloadArtifact(artifact) {
+            try {
+                const response = await fetch(getAPIPath(artifact.url), { headers: getAuthHeaders() });
+                if (!response.ok) {
+                    appendToOutput('Download of ' + escapeHtml(artifact.name) + ' failed (status: ' + response.status + ')', 'error');
+                    return;
+                }
+                const url = URL.createObjectURL(await response.blob());
+                const a = document.createElement('a');
+                a.href = url;
+                a.download = artifact.name;
+                document.body.appendChild(a);
+                a.click();
+                a.remove();
+                setTimeout(() => URL.revokeObjectURL(url), 1000);
+            } catch (error) {
+                appendToOutput('Download of ' + escapeHtml(artifact.name) + ' failed: ' + escapeHtml(error.message), 'error');
+            }
+        }
+
+        function formatBytes(n) {
+            if (n < 1024) return n + ' B';
+            if (n < 1024 * 1024) return (n / 1024).toFixed(1) + ' KB';
+            return (n / (1024 * 1024)).toFixed(1) + ' MB';
+        }
+
+        // Add expand/collapse handlers
+        function addTreeToggleHandlers(panel) {
+            panel.querySelectorAll('.tree-toggle').forEach(toggle => {
+                toggle.parentElement.classList.add('tree-collapsed');
+                toggle.addEventListener('click', function(e) {
+                    e.stopPropagation();
+                    this.parentElement.classList.toggle('tree-collapsed');
+                    this.textContent = this.parentElement.classList.contains('tree-collapsed') ? '▶' : '▼';
+                });
+            });
+
+            // Add click handlers for functions
+            panel.querySelectorAll('.tree-function').forEach(funcElement => {
+                funcElement.addEventListener('click', function(e) {
+                    e.stopPropagation();
+                    const functionText = this.textContent;
+                    
+                    // Extract function details from the tree structure
+                    const attributeName = this.closest('div').querySelector('.tree-key').textContent;
+                    const nodePath = findNodePath(this);
+                    
+                    loadTreeNodeFunctionForEditing(nodePath, attributeName, functionText);
+                });
+            });
+
+            panel.querySelectorAll('.tree-truncated').forEach(el => {
+                el.addEventListener('click', function(e) {
+                    e.stopPropagation();
+                    loadTruncatedRuntimeNode(JSON.parse(this.dataset.inspectPath));
+                });
+            });
+        }
+
+        // Find the path of the node in the tree view
+        function findNodePath(element) {
+            const path = [];
+            let current = element.closest('div');
+            
+            while (current && current.closest('.tree-view')) {
+                const keyElement = current.querySelector(':scope > .tree-key');
+                if (keyElement) {
+                    const keyText = keyElement.textContent;
+                    // Skip attribute names, we want the node path
+                    const parentDiv = current.parentElement?.parentElement;
+                    if (parentDiv && parentDiv.querySelector(':scope > .tree-node-type')) {
+                        path.unshift(keyText);
+                    }
+                }
+                current = current.parentElement?.parentElement;
+            }
+            
+            return path;
+        }
+
+        // Load TreeNode function attribute for editing
+        async function loadTreeNodeFunctionForEditing(nodePath, attributeName, functionText) {
+            try {
+                // Try to extract function code from the function string representation
+                let functionCode = functionText;
+                
+                // If it's a "Function(...)" representation, we need to get the actual source
+                if (functionText.startsWith('Function(') && functionText.endsWith(')')) {
+                    // For now, we'll create a placeholder - in a real implementation,
+                    // you might need to call the backend to get the function source
+                    functionCode = "func(profile) { \n    // Edit this function code\n    // Original: " + functionText + "\n    bigger(getAttribute(profile, 'age'), 18) \n}";
+                }
+                
+                // Build the node access path
+                let nodeAccessCode = 'agent'; // Start with the root node
+                if (nodePath.length > 0) {
+                    // Build path like: getChildAt(agent, 0) for first level, etc.
+                    for (let i = 0; i < nodePath.length; i++) {
+                        const childName = nodePath[i];
+                        // This is simplified - you might need more sophisticated path building
+                        // based on how your tree structure works
+                        if (childName === 'offer') {
+                            nodeAccessCode = "getChildAt(" + nodeAccessCode + ", 0)";
+                        } else if (childName === 'rules') {
+                            nodeAccessCode = "getChildAt(" + nodeAccessCode + ", 1)";
+                        } else if (childName === 'handlers') {
+                            nodeAccessCode = "getChildAt(" + nodeAccessCode + ", 2)";
+                        }
+                    }
+                }
+                
+                // Create wrapper code that will update the function in the TreeNode
+                const wrapperCode = "// TreeNode Function: " + attributeName + "\n" +
+                    "// This code will update the function attribute in the TreeNode when executed\n\n" +
+                    "// Get the node reference\n" +
+                    "setq(targetNode, " + nodeAccessCode + ")\n\n" +
+                    "// Define the updated function\n" +
+                    "setq(updatedFunction, " + functionCode + ")\n\n" +
+                    "// Set the attribute with the new function\n" +
+                    "setAttribute(targetNode, '" + attributeName + "', updatedFunction)\n\n" +
+                    "// Optional: Save the tree structure\n" +
+                    "// treeSave(agent, 'decisionAgent1.json')\n\n" +
+                    "// Return confirmation\n" +
+                    "concat(\"Updated function '" + attributeName + "' in node\")";
+
+                if (editor) {
+                    editor.setValue(wrapperCode);
+                    currentFileName = ''; // Not a file
+                    originalContent = wrapperCode;
+                    isFileModified = false;
+                    
+                    // Switch to Files tab to show the code
+                    document.getElementById('filesTab').click();
+                    
+                    updateSaveButtonStates();
+                    updateRunButtonState();
+                    
+                    showOutput("Loaded TreeNode function \"" + attributeName + "\" for editing. Run to update the node.", 'info');
+                }
+            } catch (e) {
+                showOutput('Error loading TreeNode function: ' + e.message, 'error');
+            }
+        }
+
+        // Recursively render a JS object as a tree
+        function renderTree(obj, key = null, nodePath = []) {
+            if (obj === null) {
+                if (key !== null) {
+                    return '<span class="tree-key">' + escapeHtml(key) + '</span>: <span class="tree-leaf">null</span>';
+                }
+                return '<span class="tree-leaf">null</span>';
+            }
+            if (obj.$truncated === true && Array.isArray(obj.path)) {
+                // Nesting the inspector left out; loaded on click
+                const summary = obj.kind === 'array' ? '[… ' + obj.size + ' items]' : '{… ' + obj.size + ' entries}';
+                const keyPart = key !== null ? '<span class="tree-key">' + escapeHtml(key) + '</span>: ' : '';
+                return keyPart + '<span class="tree-truncated" title="Load" data-inspect-path="' + escapeHtml(JSON.stringify(obj.path)) + '">' + summary + '</span>';
+            }
+            if (typeof obj !== 'object') {
+                // Check if this is a function representation
+                const objStr = obj.toString();
+                if (objStr.startsWith('Function(') && objStr.endsWith(')')) {
+                    if (key !== null) {
+                        return '<span class="tree-key">' + escapeHtml(key) + '</span>: <span class="tree-function" data-node-path="' + escapeHtml(JSON.stringify(nodePath)) + '" data-attribute="' + escapeHtml(key) + '">' + escapeHtml(objStr) + '</span>';
+                    } else {
+                        return '<span class="tree-function" data-node-path="' + escapeHtml(JSON.stringify(nodePath)) + '">' + escapeHtml(objStr) + '</span>';
+                    }
+                }
+                
+                if (key !== null) {
+                    return '<span class="tree-key">' + escapeHtml(key) + '</span>: <span class="tree-leaf">' + escapeHtml(objStr) + '</span>';
+                } else {
+                    return '<span class="tree-leaf">' + escapeHtml(objStr) + '</span>';
+                }
+            }
+            let html = '';
+            if (Array.isArray(obj)) {
+                const keyPart = key !== null ? escapeHtml(key) : '[Array]';
+                html += '<div><span class="tree-toggle">▶</span><span class="tree-key">' + keyPart + '</span>: [<div class="tree-children" style="margin-left:16px;">';
+                obj.forEach((item, idx) => {
+                    html += '<div>' + renderTree(item, idx, [...nodePath, idx]) + '</div>';
+                });
+                html += '</div>]</div>';
+            } else {
+                // Check if this looks like a TreeNode/Node object
+                const hasTypeAndName = obj.hasOwnProperty('type') && obj.hasOwnProperty('name');
+                const hasNodeProperties = obj.hasOwnProperty('children') || obj.hasOwnProperty('attributes') || obj.hasOwnProperty('text');
+                const isTreeNode = hasTypeAndName || hasNodeProperties;
+                
+                if (isTreeNode) {
+                    const keyPart = key !== null ? escapeHtml(key) : 'Node';
+                    const nodeName = obj.name || obj.type || 'unnamed';
+                    const currentNodePath = key !== null ? [...nodePath, key] : nodePath;
+                    html += '<div><span class="tree-toggle">▶</span><span class="tree-key">' + keyPart + '</span>: <span class="tree-node-type">Node(' + escapeHtml(nodeName) + ')</span><div class="tree-children" style="margin-left:16px;">';
+                    for (const k in obj) {
+                        html += '<div>' + renderTree(obj[k], k, currentNodePath) + '</div>';
+                    }
+                    html += '</div></div>';
+                } else {
+                    // Regular object
+                    const keyPart = key !== null ? escapeHtml(key) : 'Object';
+                    const currentPath = key !== null ? [...nodePath, key] : nodePath;
+                    html += '<div><span class="tree-toggle">▶</span><span class="tree-key">' + keyPart + '</span>: {<div class="tree-children" style="margin-left:16px;">';
+                    for (const k in obj) {
+                        html += '<div>' + renderTree(obj[k], k, currentPath) + '</div>';
+                    }
+                    html += '</div>}</div>';
+                }
+            }
+            return html;
+        }
+
+        // Problems tab logger
+        function showProblem(text, level) {
+            const content = document.getElementById('problemsContent');
+            if (!content) return;
+            const timestamp = new Date().toLocaleTimeString();
+            let color = '#d4d4d4';
+            if (level === 'error') color = '#f44747';
+            else if (level === 'warn' || level === 'warning') color = '#d7ba7d';
+            else if (level === 'info') color = '#4fc1ff';
+            const line = document.createElement('div');
+            line.style.padding = '6px 8px';
+            line.style.borderBottom = '1px solid #3e3e42';
+            line.innerHTML = '[' + timestamp + '] <span style="color:' + color + '">' + escapeHtml(text) + '</span>';
+            content.appendChild(line);
+            // Auto-scroll to latest
+            content.scrollTop = content.scrollHeight;
+        }
+        
+        // Report a structured script error (message + Chariot stack trace) in the Problems tab
+        function reportScriptError(info) {
+            if (!info || !info.message) return;
+            const where = info.line ? ' (' + (info.file || 'script') + ':' + info.line + ':' + (info.column || 0) + ')' : '';
+            const block = info.nodeId ? ' in diagram ' + (info.diagram || '') + ' block "' + (info.nodeLabel || info.nodeId) + '" [' + info.nodeId + ']' : '';
+            showProblem(info.message + where + block, 'error');
+            const frames = info.stack || [];
+            if (frames.length === 0) return;
+            const content = document.getElementById('problemsContent');
+            if (!content) return;
+            const trace = document.createElement('pre');
+            trace.style.margin = '0';
+            trace.style.padding = '2px 8px 8px 24px';
+            trace.style.color = '#9d9d9d';
+            trace.style.borderBottom = '1px solid #3e3e42';
+            trace.textContent = frames.map(f => {
+                let line = 'at ' + f.function;
+                if (f.line) line += ' (' + (f.file || 'script') + ':' + f.line + ':' + (f.column || 0) + ')';
+                if (f.tailCalls) line += ' [' + f.tailCalls + ' tail calls]';
+                if (f.nodeId) line += ' <' + (f.nodeLabel || 'block') + ' ' + f.nodeId + '>';
+                return line;
+            }).join('\n');
+            content.appendChild(trace);
+            content.scrollTop = content.scrollHeight;
+        }
+        
+        // Update Run button state based on editor content
+        function updateRunButtonState() {
+            const runButton = document.getElementById('runButton');
+            if (!runButton) return;
+            
+            const hasAuth = authToken !== null;
+            const hasContent = editor && editor.getValue().trim() !== '';
+            
+            // Enable Run button only if authenticated AND there's code to run
+            runButton.disabled = !(hasAuth && hasContent);
+            
+            console.log('DEBUG: Run button state updated - hasAuth:', hasAuth, 'hasContent:', hasContent, 'disabled:', runButton.disabled);
+        }
+        
+        // Show output in the output tab
+        function showOutput(text, type) {
+            const content = document.getElementById('outputContent');
+            if (!content) {
+                console.log('DEBUG: outputContent element not found, message:', text);
+                return;
+            }
+            
+            const timestamp = new Date().toLocaleTimeString();
+            
+            let className = '';
+            switch (type) {
+                case 'success': className = 'output-success'; break;
+                case 'error': className = 'output-error'; break;
+                case 'info': className = 'output-info'; break;
+                case 'loading': className = 'loading'; break;
+            }
+            
+            content.innerHTML = '[' + timestamp + '] <span class="' + className + '">' + escapeHtml(text) + '</span>';
+            content.scrollTop = content.scrollHeight;
+        }
+        
+        // Escape HTML for safe display
+        function escapeHtml(text) {
+            const div = document.createElement('div');
+            div.textContent = text;
+            return div.innerHTML;
+        }
+        
+        // Initialize splitter for resizing
+        function initializeSplitter() {
+            const splitter = document.getElementById('splitter');
+            const bottomPanel = document.getElementById('bottomPanel');
+            
+            splitter.addEventListener('mousedown', function(e) {
+                isResizing = true;
+                document.addEventListener('mousemove', handleResize);
+                document.addEventListener('mouseup', stopResize);
+                e.preventDefault();
+            });
+            
+            function handleResize(e) {
+                if (!isResizing) return;
+                
+                const containerHeight = window.innerHeight - 50;
+                const mouseY = e.clientY - 50;
+                const newBottomHeight = containerHeight - mouseY;
+                
+                if (newBottomHeight >= 100 && newBottomHeight <= containerHeight - 200) {
+                    bottomPanel.style.height = newBottomHeight + 'px';
+                    if (editor) {
+                        editor.layout();
+                    }
+                }
+            }
+            
+            function stopResize() {
+                isResizing = false;
+                document.removeEventListener('mousemove', handleResize);
+                document.removeEventListener('mouseup', stopResize);
+            }
+        }
+
+
@@ -0,0 +1,128 @@
+        // Configuration
+        const CHARIOT_FILES_FOLDER = 'files';
+        const SESSION_DURATION_MINUTES = CHARIOTEER_CONFIG.sessionMinutes || 30; // server-configured session duration
+        const WARNING_BEFORE_MINUTES = CHARIOTEER_CONFIG.warningMinutes || 3; // Show warning this many minutes before expiration
+
+        // Feature flags set by the server; unknown flags count as enabled
+        function featureEnabled(name) {
+            return !CHARIOTEER_CONFIG.features || CHARIOTEER_CONFIG.features[name] !== false;
+        }
+        const LOGOUT_BEFORE_SECONDS = 30; // Auto-logout 30 seconds before expiration        
+        // Chariot base rules
+        const CHARIOT_MONARCH_BASE_RULES = [
+            // Comments
+            [/\/\/.*$/, 'comment'],
+            [/\/\*/, 'comment', '@comment'],
+
+            // Strings
+            [/"([^"\\]|\\.)*$/, 'string.invalid'],
+            [/"/, 'string', '@string'],
+            [/'([^'\\]|\\.)*$/, 'string.invalid'],
+            [/'/, 'string', '@string_single'],
+
+            // Numbers
+            [/\d*\.\d+([eE][-+]?\d+)?/, 'number.float'],
+            [/\d+/, 'number'],
+
+            // True keywords (special parser handling, not function calls)
+            [/\belse|break|continue\b(?!\s*\()/, 'keyword.control.chariot'],
+
+            // Special control flow constructs (create special AST nodes, not FuncCall)
+            [/\b(if|while|func|switch|case|default)\b(?=\s*\()/, 'keyword.control.chariot'],
+
+            // Builtins are added by setChariotTokenizer from /api/builtins, one rule per category
+            [/\bfunction\b/, 'keyword.control.chariot'], // Always highlight 'function' as a keyword
+            [/[a-zA-Z_$][\w$]*/, 'identifier'], 
+        ];
+
+        // Wait for DOM to be ready (and handle already-loaded state)
+        (function initWhenReady() {
+            const start = function() {
+                try { bindAuthHandlers(); } catch (e) { console.warn('bindAuthHandlers error', e); }
+                initializeEditor();
+            };
+            if (document.readyState === 'loading') {
+                document.addEventListener('DOMContentLoaded', start);
+            } else {
+                start();
+            }
+        })();
+        
+        // Monaco is pinned to a specific version for stability, served from the binary in offline mode
+        require.config({ paths: { vs: '{{.MonacoBase}}' } });
+        // Ensure auth/login handlers are attached at least once
+        let authHandlersInitialized = false;
+        function bindAuthHandlers() {
+            if (authHandlersInitialized) return;
+            const loginButton = document.getElementById('loginButton');
+            const logoutButton = document.getElementById('logoutButton');
+            const passwordInput = document.getElementById('passwordInput');
+            if (loginButton) {
+                loginButton.addEventListener('click', login);
+            }
+            if (logoutButton) {
+                logoutButton.addEventListener('click', logout);
+            }
+            if (passwordInput) {
+                passwordInput.addEventListener('keypress', function(e) { if (e.key === 'Enter') login(); });
+            }
+            authHandlersInitialized = true;
+        }
+        
+        let editor;
+        let fileEditorContent = '';         // Last content loaded in Files tab
+        let fileEditorFileName = '';        // Last file loaded in Files tab
+        let functionEditorContent = '';     // Last content loaded in Function Library tab
+    let functionEditorFunctionName = ''; // Last function loaded in Function Library tab
+        let dashboardContent = '';          // Last dashboard HTML content
+        let dashboardLoaded = false;        // Track if dashboard has been loaded
+        let chariotBuiltins = [];           // Builtin metadata from /api/builtins: name, category, signature, summary, example
+        let chariotUserFunctions = [];      // Names of the user's functions, for completion
+        let currentFileName = '';
+        let currentTab = 'output';
+    let dashboardAutoRefresh = null;    // Timer for auto-refreshing dashboard when visible
+    let currentBottomTab = 'output';    // Tracks the bottom panel tab (output|problems|console)
+    // Throttle WS updates to avoid overwhelming UI
+    let dashboardWSUpdateTimer = null;
+    let pendingDashboardData = null;
+    // Persist listener row selections across updates
+    const selectedListeners = new Set();
+    let isResizing = false;
+        let authToken = null;
+        let sessionId = null; // Session ID for debug API calls
+        let currentUser = null;
+        let isFileModified = false;
+        let originalContent = '';
+    // Ensure toolbar handlers for Function Library are only initialized once across editor rebuilds
+    let functionsToolbarInitialized = false;
+    let diagramsToolbarInitialized = false;
+    // Diagrams state
+    let currentDiagramName = '';
+    let currentDiagramJSON = null; // last loaded JSON for selected diagram
+    let currentDiagramBase = null; // diagram as loaded, sent on save so concurrent saves are merged
+    let currentDiagramSourceMap = null; // source map for code generated from the selected diagram
+    let currentGeneratedCode = null;    // generated code the source map applies to
+    let currentFileScope = 'global'; // Current scope for file operations
+    let sandboxProfile = {
+        enabled: true,
+        scopes: ['global', 'sandbox'],
+        defaultScope: 'global',
+        currentScope: 'global'
+    };
+    let sessionIsAdmin = false; // from the session profile; shows the Users panel
+    let accountProfile = null; // { mfaEnabled, passwordExpiresAt } when the session has an account
+        // Session management variables
+        let sessionTimer = null;
+        let warningTimer = null;
+        let logoutTimer = null;
+        let sessionWarningShown = false;        
+        let sessionExpiresAt = 0;      // when the access token expires (ms since epoch)
+        let sessionCanRefresh = false; // the backend issued a refresh token
+        let sessionIssuedAt = 0;       // when the current access token was issued
+        let lastActivityAt = 0;        // last user input, to refresh only for active users
+        let tokenRefreshInFlight = null;
+
+        function getCurrentFilename() {
+            return (currentFileName && currentFileName.trim()) ? currentFileName.trim() : 'main.ch';
+        }
+
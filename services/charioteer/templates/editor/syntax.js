@@ -0,0 +1,100 @@
+
+        // In-browser syntax checking with the server's own parser, compiled to
+        // WebAssembly (see build-wasm.sh). Without it the editor relies on the
+        // Monarch highlighter and the chariot-codegen bundle alone.
+        const SYNTAX_CHECK_DELAY_MS = 300;
+        let chariotWasmPromise = null;
+        let syntaxCheckTimer = null;
+
+        // Load chariot.wasm once; resolves to the chariotWasm API, or null when
+        // the server does not offer it or it fails to start
+        function loadChariotWasm() {
+            if (chariotWasmPromise) return chariotWasmPromise;
+            if (!CHARIOTEER_CONFIG.wasm || !featureEnabled('enable_wasm_check') || typeof WebAssembly !== 'object') {
+                chariotWasmPromise = Promise.resolve(null);
+                return chariotWasmPromise;
+            }
+            chariotWasmPromise = new Promise((resolve, reject) => {
+                const script = document.createElement('script');
+                script.src = getAPIPath('/wasm/wasm_exec.js');
+                script.onload = resolve;
+                script.onerror = () => reject(new Error('wasm_exec.js failed to load'));
+                document.head.appendChild(script);
+            }).then(async () => {
+                const go = new Go();
+                const ready = new Promise(resolve => { window.onChariotWasmReady = resolve; });
+                const url = getAPIPath('/wasm/chariot.wasm');
+                let result;
+                if (WebAssembly.instantiateStreaming) {
+                    result = await WebAssembly.instantiateStreaming(fetch(url), go.importObject);
+                } else {
+                    const bytes = await (await fetch(url)).arrayBuffer();
+                    result = await WebAssembly.instantiate(bytes, go.importObject);
+                }
+                go.run(result.instance); // runs until the page is closed
+                await ready;
+                console.log('Chariot wasm parser loaded');
+                return window.chariotWasm;
+            }).catch(e => {
+                console.warn('Chariot wasm parser unavailable:', e);
+                return null;
+            });
+            return chariotWasmPromise;
+        }
+
+        // The wasm API if it has finished loading, else null
+        function chariotWasmReady() {
+            return window.chariotWasm && typeof window.chariotWasm.check === 'function' ? window.chariotWasm : null;
+        }
+
+        // Parse the editor content and mark a syntax error at its position
+        function checkEditorSyntax() {
+            const wasm = chariotWasmReady();
+            if (!wasm || !editor) return;
+            const model = editor.getModel();
+            if (!model || model.getLanguageId() !== 'chariot') return;
+            const name = currentFileName || 'main.ch';
+            const result = wasm.check(model.getValue(), name);
+            const markers = [];
+            if (result && !result.ok && result.error) {
+                const err = result.error;
+                const line = Math.min(Math.max(err.line || 1, 1), model.getLineCount());
+                const column = Math.min(Math.max(err.column || 1, 1), model.getLineMaxColumn(line));
+                markers.push({
+                    severity: monaco.MarkerSeverity.Error,
+                    message: err.message || 'syntax error',
+                    startLineNumber: line,
+                    startColumn: column,
+                    endLineNumber: line,
+                    endColumn: Math.max(column + 1, model.getLineMaxColumn(line))
+                });
+            }
+            monaco.editor.setModelMarkers(model, 'chariot-syntax', markers);
+        }
+
+        function scheduleSyntaxCheck() {
+            clearTimeout(syntaxCheckTimer);
+            syntaxCheckTimer = setTimeout(checkEditorSyntax, SYNTAX_CHECK_DELAY_MS);
+        }
+
+        // Start checking the editor's content once the parser is loaded
+        function initSyntaxChecking() {
+            if (!editor) return;
+            editor.onDidChangeModelContent(scheduleSyntaxCheck);
+            editor.onDidChangeModel(scheduleSyntaxCheck);
+            loadChariotWasm().then(wasm => { if (wasm) checkEditorSyntax(); });
+        }
+
+        // Generate code for a diagram with the server's generator when the wasm
+        // build is loaded. Returns null when it is not, or when the diagram uses
+        // blocks only the JavaScript generator supports.
+        function generateDiagramCodeWasm(diagram) {
+            const wasm = chariotWasmReady();
+            if (!wasm) return null;
+            const generated = wasm.generate(JSON.stringify(diagram));
+            if (!generated || generated.error) {
+                if (generated && generated.error) console.warn('wasm codegen:', generated.error);
+                return null;
+            }
+            return { code: generated.code, sourceMap: generated.sourceMap || null };
+        }
@@ -0,0 +1,600 @@
+        // Add this function and call it after the editor is initialized
+        // Ensure we only bind global UI handlers once across editor rebuilds
+        let uiHandlersInitialized = false;
+        function initializeEventHandlers() {
+            if (uiHandlersInitialized) { return; }
+            // Mark immediately to avoid duplicate bindings during early calls
+            uiHandlersInitialized = true;
+            console.log('DEBUG: Initializing event handlers');
+
+            // Bind debugger handlers
+            bindDebugHandlers();
+
+            // Activity tracking for session extension
+            const activityEvents = ['click', 'keydown', 'mousemove', 'scroll'];
+            let lastActivityTime = Date.now();
+
+            activityEvents.forEach(eventType => {
+                document.addEventListener(eventType, () => {
+                    const now = Date.now();
+                    lastActivityAt = now;
+                    // Only extend session if there's been activity and user is logged in
+                    if (authToken && now - lastActivityTime > 60000) { // Only extend every minute
+                        lastActivityTime = now;
+                        if (!sessionWarningShown) {
+                            // Silently extend session on activity (only if warning not shown)
+                            extendSessionSilently();
+                        }
+                    }
+                });
+            });            
+            
+            // Login functionality (also bound in bindAuthHandlers as a fallback)
+            const loginButton = document.getElementById('loginButton');
+            const logoutButton = document.getElementById('logoutButton');
+            const usernameInput = document.getElementById('usernameInput');
+            const passwordInput = document.getElementById('passwordInput');
+            
+            if (loginButton && !authHandlersInitialized) {
+                loginButton.addEventListener('click', login);
+                console.log('DEBUG: Login button handler added');
+            }
+            
+            if (logoutButton && !authHandlersInitialized) {
+                logoutButton.addEventListener('click', logout);
+                console.log('DEBUG: Logout button handler added');
+            }
+            
+            // Enter key in password field
+            if (passwordInput && !authHandlersInitialized) {
+                passwordInput.addEventListener('keypress', function(e) {
+                    if (e.key === 'Enter') {
+                        login();
+                    }
+                });
+            }
+            // Mark initialized to avoid double-binding later
+            authHandlersInitialized = true;
+            
+            // File selection
+            const fileSelect = document.getElementById('fileSelect');
+            if (fileSelect) {
+                fileSelect.addEventListener('change', function() {
+                    const fileName = this.value;
+                    if (fileName) {
+                        loadFile(fileName);
+                    }
+                });
+                console.log('DEBUG: File select handler added');
+            }
+
+            // File scope selection
+            const fileScopeSelect = document.getElementById('fileScopeSelect');
+            if (fileScopeSelect) {
+                fileScopeSelect.addEventListener('change', async function() {
+                    const nextScope = (this.value || 'global').toLowerCase();
+                    if (nextScope === currentFileScope) {
+                        return;
+                    }
+                    currentFileScope = nextScope;
+                    console.log('DEBUG: File scope changed to', currentFileScope);
+                    await refreshFilesForCurrentScope();
+                });
+                console.log('DEBUG: File scope select handler added');
+            }
+            
+            // Save buttons
+            const newButton = document.getElementById('newButton');
+            const saveButton = document.getElementById('saveButton');
+            const saveAsButton = document.getElementById('saveAsButton');
+            const runButton = document.getElementById('runButton');
+            
+            if (newButton) {
+                newButton.addEventListener('click', newFile);
+                console.log('DEBUG: New button handler added');
+            }
+            
+            if (saveButton) {
+                saveButton.addEventListener('click', saveFile);
+                console.log('DEBUG: Save button handler added');
+            }
+            
+            if (saveAsButton) {
+                saveAsButton.addEventListener('click', saveAsFile);
+                console.log('DEBUG: Save As button handler added');
+            }
+            
+            // File action buttons
+            const renameButton = document.getElementById('renameButton');
+            const deleteButton = document.getElementById('deleteButton');
+            
+            if (renameButton) {
+                renameButton.addEventListener('click', renameFile);
+                console.log('DEBUG: Rename button handler added');
+            }
+            
+            if (deleteButton) {
+                deleteButton.addEventListener('click', deleteFile);
+                console.log('DEBUG: Delete button handler added');
+            }
+            
+            if (runButton) {
+                runButton.addEventListener('click', function() {
+                    const streamingToggle = document.getElementById('streamingToggle');
+                    // Force synchronous execution when breakpoints are set (needed for debugging)
+                    if (breakpoints.size > 0) {
+                        console.log('Breakpoints detected - using synchronous execution for debugging');
+                        runCode();
+                    } else if (streamingToggle && streamingToggle.checked) {
+                        runCodeAsync();
+                    } else {
+                        runCode();
+                    }
+                });
+                console.log('DEBUG: Run button handler added');
+            }
+            
+            // Tab functionality
+            const tabs = document.querySelectorAll('.tab');
+            tabs.forEach(tab => {
+                tab.addEventListener('click', function() {
+                    switchTab(this.dataset.tab);
+                });
+            });
+            console.log('DEBUG: Tab handlers added');
+            
+            // Keyboard shortcuts (only register once)
+            if (!window.chariotKeyboardHandlerRegistered) {
+                document.addEventListener('keydown', function(e) {
+                    // Skip if event is from Monaco editor
+                    if (e.target.closest('.monaco-editor')) {
+                        // Only handle Ctrl/Cmd+S, ignore arrow keys
+                        if ((e.ctrlKey || e.metaKey) && e.key === 's') {
+                            e.preventDefault();
+                            if (e.shiftKey) {
+                                saveAsFile();
+                            } else {
+                                saveFile();
+                            }
+                        }
+                        return; // Don't interfere with Monaco's key handling
+                    }
+                    
+                    // Original keyboard shortcut logic for non-Monaco elements
+                    if (e.ctrlKey || e.metaKey) {
+                        if (e.key === 's') {
+                            e.preventDefault();
+                            if (e.shiftKey) {
+                                saveAsFile();
+                            } else {
+                                saveFile();
+                            }
+                        }
+                    }
+                });
+                window.chariotKeyboardHandlerRegistered = true;
+                console.log('DEBUG: Keyboard shortcuts added');
+            }
+            // Toolbar tab switching
+            const filesTab = document.getElementById('filesTab');
+            const functionsTab = document.getElementById('functionsTab');
+            const dashboardTab = document.getElementById('dashboardTab');
+            const agentsTab = document.getElementById('agentsTab');
+            const diagramsTab = document.getElementById('diagramsTab');
+            const fileToolbar = document.getElementById('fileToolbar');
+            const functionsToolbar = document.getElementById('functionsToolbar');
+            const dashboardToolbar = document.getElementById('dashboardToolbar');
+            const agentsToolbar = document.getElementById('agentsToolbar');
+            const diagramsToolbar = document.getElementById('diagramsToolbar');
+
+            if (filesTab && functionsTab && dashboardTab && agentsTab && diagramsTab && fileToolbar && functionsToolbar && dashboardToolbar && agentsToolbar && diagramsToolbar) {
+                // Helpers to manage dashboard auto-refresh lifecycle
+                function stopDashboardAutoRefresh() {
+                    if (dashboardAutoRefresh) {
+                        clearInterval(dashboardAutoRefresh);
+                        dashboardAutoRefresh = null;
+                    }
+                    // Also close WS if open, and end long polling
+                    try { if (dashboardWS) { dashboardWS.close(); dashboardWS = null; } } catch (e) {}
+                    stopDashboardLongPoll();
+                }
+
+                function startDashboardAutoRefresh() {
+                    // Ensure only one timer is running
+                    stopDashboardAutoRefresh();
+                    // Poll every 30 seconds to reflect session changes/timeouts
+                    dashboardAutoRefresh = setInterval(() => {
+                        if (currentTab === 'dashboard' && typeof fetchAndUpdateDashboard === 'function') {
+                            try { fetchAndUpdateDashboard(); } catch (e) { /* ignore */ }
+                        } else {
+                            stopDashboardAutoRefresh();
+                        }
+                    }, 30000);
+                }
+
+                function showToolbar(selected) {
+                    // Collaboration follows the document shown in the editor
+                    if (selected !== currentTab) {
+                        collabDisconnect();
+                    }
+                    // Hide all toolbars
+                    fileToolbar.classList.remove('active');
+                    functionsToolbar.classList.remove('active');
+                    dashboardToolbar.classList.remove('active');
+                    agentsToolbar.classList.remove('active');
+                    diagramsToolbar.classList.remove('active');
+                    // Remove active from all tabs
+                    filesTab.classList.remove('active');
+                    functionsTab.classList.remove('active');
+                    dashboardTab.classList.remove('active');
+                    agentsTab.classList.remove('active');
+                    diagramsTab.classList.remove('active');
+
+                    if (selected === 'files') {
+                        // Leaving dashboard: stop auto refresh
+                        stopDashboardAutoRefresh();
+                        // Leaving agents: stop WS and restore editor container
+                        if (currentTab === 'agents') {
+                            stopAgentsWS();
+                            const editorContainer = document.getElementById('editorContainer');
+                            if (editorContainer) {
+                                editorContainer.innerHTML = '';
+                                setupMonacoEditor();
+                            }
+                        }
+                        // Save current function editor state
+                        if (currentTab === 'functions') {
+                            functionEditorContent = editor.getValue();
+                            functionEditorFunctionName = document.getElementById('functionSelect').value;
+                        }
+                        // Save current dashboard state
+                        if (currentTab === 'dashboard') {
+                            const editorContainer = document.getElementById('editorContainer');
+                            if (editorContainer) {
+                                dashboardContent = editorContainer.innerHTML;
+                            }
+                        }
+                        // Restore Monaco editor if coming from dashboard or agents
+                        if (currentTab === 'dashboard' || currentTab === 'agents') {
+                            // Clear dashboard content and restore editor container
+                            const editorContainer = document.getElementById('editorContainer');
+                            editorContainer.innerHTML = '';
+                            setupMonacoEditor();
+                        }
+                        // Restore file editor state
+                        fileToolbar.classList.add('active');
+                        filesTab.classList.add('active');
+                        if (fileEditorContent !== '') {
+                            editor.setValue(fileEditorContent);
+                            currentFileName = fileEditorFileName;
+                            originalContent = fileEditorContent;
+                            isFileModified = false;
+                            if (currentTab !== 'files') {
+                                collabConnect('file', currentFileScope, currentFileName, fileEditorContent);
+                            }
+                        } else {
+                            editor.setValue('');
+                            currentFileName = '';
+                            originalContent = '';
+                            isFileModified = false;
+                        }
+                        updateSaveButtonStates();
+                        updateRunButtonState();
+                        currentTab = 'files';
+                    } else if (selected === 'functions') {
+                        // Leaving dashboard: stop auto refresh
+                        stopDashboardAutoRefresh();
+                        // Leaving agents: stop WS and restore editor
+                        if (currentTab === 'agents') {
+                            stopAgentsWS();
+                            const editorContainer = document.getElementById('editorContainer');
+                            if (editorContainer) {
+                                editorContainer.innerHTML = '';
+                                setupMonacoEditor();
+                            }
+                        }
+                        // Save current file editor state
+                        if (currentTab === 'files') {
+                            fileEditorContent = editor.getValue();
+                            fileEditorFileName = currentFileName;
+                        }
+                        // Save current dashboard state
+                        if (currentTab === 'dashboard') {
+                            const editorContainer = document.getElementById('editorContainer');
+                            if (editorContainer) {
+                                dashboardContent = editorContainer.innerHTML;
+                            }
+                        }
+                        // Restore Monaco editor if coming from dashboard or agents
+                        if (currentTab === 'dashboard' || currentTab === 'agents') {
+                            // Clear dashboard content and restore editor container
+                            const editorContainer = document.getElementById('editorContainer');
+                            editorContainer.innerHTML = '';
+                            setupMonacoEditor();
+                        }
+                        // Restore function editor state
+                        functionsToolbar.classList.add('active');
+                        functionsTab.classList.add('active');
+                        const functionSelect = document.getElementById('functionSelect');
+                        if (functionEditorFunctionName && functionSelect) {
+                            functionSelect.value = functionEditorFunctionName;
+                        }
+                        if (functionEditorContent !== '') {
+                            editor.setValue(functionEditorContent);
+                            originalContent = functionEditorContent;
+                            isFileModified = false;
+                            // Optionally, set functionSelect.value = functionEditorFunctionName;
+                        } else {
+                            editor.setValue('');
+                            originalContent = '';
+                            isFileModified = false;
+                        }
+                        updateSaveButtonStates();
+                        updateRunButtonState();
+                        currentTab = 'functions';
+                    } else if (selected === 'dashboard') {
+                        // Save current editor state
+                        if (currentTab === 'files') {
+                            fileEditorContent = editor.getValue();
+                            fileEditorFileName = currentFileName;
+                        } else if (currentTab === 'functions') {
+                            functionEditorContent = editor.getValue();
+                            functionEditorFunctionName = document.getElementById('functionSelect').value;
+                        } else if (currentTab === 'agents') {
+                            // Ensure we fully stop the Agents WS loop when switching to dashboard
+                            stopAgentsWS();
+                        }
+                        // Show dashboard toolbar
+                        dashboardToolbar.classList.add('active');
+                        dashboardTab.classList.add('active');
+                        
+                        // Load or restore dashboard content
+                        if (dashboardLoaded && dashboardContent) {
+                            // Restore existing dashboard content
+                            const editorContainer = document.getElementById('editorContainer');
+                            if (editor) {
+                                editor.getModel()?.dispose();
+                                editor.dispose();
+                                editor = null;
+                            }
+                            editorContainer.innerHTML = dashboardContent;
+                            // Prefer WebSocket stream; it will fallback to polling on error
+                            connectDashboardWS();
+                            // Rebind listeners panel handlers after restoring DOM
+                            bindListenersPanelHandlers();
+                        } else {
+                            // Load dashboard content for first time
+                            loadDashboardContent();
+                            // Prefer WebSocket stream; it will fallback to polling on error
+                            connectDashboardWS();
+                        }
+                        
+                        // Dashboard will replace the editor content entirely
+                        originalContent = '';
+                        isFileModified = false;
+                        updateSaveButtonStates();
+                        updateRunButtonState();
+                        currentTab = 'dashboard';
+                    } else if (selected === 'agents') {
+                        // Ensure any dashboard auto-refresh/WS is stopped when entering Agents
+                        stopDashboardAutoRefresh();
+                        // Save current editor state when switching to Agents
+                        if (currentTab === 'files') {
+                            fileEditorContent = editor.getValue();
+                            fileEditorFileName = currentFileName;
+                        } else if (currentTab === 'functions') {
+                            functionEditorContent = editor.getValue();
+                            const fnSel = document.getElementById('functionSelect');
+                            functionEditorFunctionName = fnSel ? fnSel.value : '';
+                        }
+                        // If coming from dashboard, ensure Monaco editor is torn down (agents replaces editor area)
+                        if (currentTab === 'dashboard') {
+                            const editorContainer = document.getElementById('editorContainer');
+                            if (editor) {
+                                editor.getModel()?.dispose();
+                                editor.dispose();
+                                editor = null;
+                            }
+                            editorContainer.innerHTML = '';
+                        }
+                        // Activate Agents toolbar/tab
+                        agentsToolbar.classList.add('active');
+                        agentsTab.classList.add('active');
+                        // Load or restore Agents content
+                        const editorElement = document.getElementById('editorContainer');
+                        // reset reconnect state before enabling
+                        if (agentsWSReconnectTimer) { try { clearTimeout(agentsWSReconnectTimer); } catch (e) {} agentsWSReconnectTimer = null; }
+                        agentsWSBackoffMs = 1000;
+                        agentsWSConnecting = false;
+                        agentsWSReconnectEnabled = true; // allow WS to reconnect while Agents is active
+                        if (agentsLoaded && agentsContent) {
+                            if (editor) {
+                                editor.getModel()?.dispose();
+                                editor.dispose();
+                                editor = null;
+                            }
+                            editorElement.innerHTML = agentsContent;
+                            // Re-bind UI handlers for restored DOM
+                            const clearBtn = document.getElementById('clearAgentsStreamButton');
+                            if (clearBtn) {
+                                clearBtn.addEventListener('click', function() {
+                                    const s = document.getElementById('agentsStream');
+                                    if (s) s.textContent = '';
+                                });
+                            }
+                            const hbToggle = document.getElementById('toggleHeartbeats');
+                            if (hbToggle) {
+                                hbToggle.checked = agentsShowHeartbeats;
+                                hbToggle.addEventListener('change', function() {
+                                    agentsShowHeartbeats = hbToggle.checked;
+                                });
+                            }
+                            try { fetchAndRenderAgents(); } catch (e) {}
+                            connectAgentsWS();
+                        } else {
+                            // Ensure content is loaded before connecting WS to avoid races with DOM elements
+                            try {
+                                loadAgentsContent().then(() => {
+                                    connectAgentsWS();
+                                });
+                            } catch (e) {
+                                // Fallback: attempt WS connect regardless
+                                connectAgentsWS();
+                            }
+                        }
+                        originalContent = '';
+                        isFileModified = false;
+                        updateSaveButtonStates();
+                        updateRunButtonState();
+                        currentTab = 'agents';
+                    } else if (selected === 'diagrams') {
+                        // Leaving dashboard: stop auto refresh
+                        stopDashboardAutoRefresh();
+                        // Leaving agents: stop WS and restore editor
+                        if (currentTab === 'agents') {
+                            stopAgentsWS();
+                            const editorContainer = document.getElementById('editorContainer');
+                            if (editor) {
+                                editor.getModel()?.dispose();
+                                editor.dispose();
+                                editor = null;
+                            }
+                            // also clear any pending reconnects
+                            if (agentsWSReconnectTimer) { try { clearTimeout(agentsWSReconnectTimer); } catch (e) {} agentsWSReconnectTimer = null; }
+                            if (editorContainer) {
+                                editorContainer.innerHTML = '';
+                                setupMonacoEditor();
+                            }
+                        }
+                        // Save current editor states when switching away
+                        if (currentTab === 'files') {
+                            fileEditorContent = editor.getValue();
+                            fileEditorFileName = currentFileName;
+                        } else if (currentTab === 'functions') {
+                            functionEditorContent = editor.getValue();
+                            const fnSel = document.getElementById('functionSelect');
+                            functionEditorFunctionName = fnSel ? fnSel.value : '';
+                        }
+                        // Restore Monaco if coming from dashboard
+                        if (currentTab === 'dashboard') {
+                            const editorContainer = document.getElementById('editorContainer');
+                            if (editor) {
+                                editor.getModel()?.dispose();
+                                editor.dispose();
+                                editor = null;
+                            }
+                            editorContainer.innerHTML = '';
+                            setupMonacoEditor();
+                        }
+                        // Show diagrams toolbar and set active tab
+                        diagramsToolbar.classList.add('active');
+                        diagramsTab.classList.add('active');
+                        // Ensure buttons reflect current editor state
+                        updateSaveButtonStates();
+                        updateRunButtonState();
+                        currentTab = 'diagrams';
+                        // Load diagrams list on first enter or refresh as needed
+                        try { loadDiagramsList(); } catch (e) { /* ignore */ }
+                    }
+                }
+                filesTab.addEventListener('click', function() {
+                    showToolbar('files');
+                });
+                functionsTab.addEventListener('click', function() {
+                    showToolbar('functions');
+                });
+                dashboardTab.addEventListener('click', function() {
+                    showToolbar('dashboard');
+                });
+                agentsTab.addEventListener('click', function() {
+                    showToolbar('agents');
+                });
+                diagramsTab.addEventListener('click', function() {
+                    showToolbar('diagrams');
+                });
+            }
+            // Diagrams toolbar handlers (initialize once)
+            if (!diagramsToolbarInitialized) {
+                const refreshDiagramsButton = document.getElementById('refreshDiagramsButton');
+                const saveDiagramButton = document.getElementById('saveDiagramButton');
+                const saveAsDiagramButton = document.getElementById('saveAsDiagramButton');
+                const deleteDiagramButton = document.getElementById('deleteDiagramButton');
+                const diagramSelect = document.getElementById('diagramSelect');
+                const scopeSelect = document.getElementById('diagramScopeSelect');
+                const shareCheckbox = document.getElementById('diagramGlobalShareCheckbox');
+
+                if (diagramSelect) {
+                    diagramSelect.addEventListener('change', async function() {
+                        const hasSelection = !!diagramSelect.value;
+                        currentDiagramName = hasSelection ? diagramSelect.value : '';
+                        toggleDiagramActionButtons(hasSelection);
+                        if (hasSelection) {
+                            await generateFromSelectedDiagram();
+                        } else if (editor) {
+                            editor.setValue('');
+                        }
+                    });
+                }
+
+                if (scopeSelect) {
+                    scopeSelect.addEventListener('change', async function() {
+                        sandboxProfile.currentScope = scopeSelect.value || 'global';
+                        applyDiagramScopeUI();
+                        await loadDiagramsList(false);
+                        currentDiagramName = '';
+                        currentDiagramJSON = null;
+                        toggleDiagramActionButtons(false);
+                        if (editor) {
+                            editor.setValue('');
+                        }
+                    });
+                }
+
+                if (shareCheckbox) {
+                    shareCheckbox.addEventListener('change', function() {
+                        applyDiagramScopeUI();
+                    });
+                }
+
+                if (refreshDiagramsButton) {
+                    refreshDiagramsButton.addEventListener('click', async function() {
+                        await loadDiagramsList();
+                        // If a diagram is selected, re-generate from source to discard unsaved edits
+                        const select = document.getElementById('diagramSelect');
+                        if (select && select.value) {
+                            await generateFromSelectedDiagram();
+                        }
+                    });
+                }
+
+                if (saveDiagramButton) {
+                    saveDiagramButton.addEventListener('click', async function() {
+                        await saveCurrentDiagram(false);
+                    });
+                }
+                if (saveAsDiagramButton) {
+                    saveAsDiagramButton.addEventListener('click', async function() {
+                        await saveCurrentDiagram(true);
+                    });
+                }
+                if (deleteDiagramButton) {
+                    deleteDiagramButton.addEventListener('click', async function() {
+                        await deleteCurrentDiagram();
+                    });
+                }
+
+                diagramsToolbarInitialized = true;
+            }
+
+            // Agents toolbar handlers (initialize once)
+            if (!window.agentsToolbarInitialized) {
+                const refreshAgentsButton = document.getElementById('refreshAgentsButton');
+                if (refreshAgentsButton) {
+                    refreshAgentsButton.addEventListener('click', async function() {
+                        await fetchAndRenderAgents();
+                    });
+                }
+                window.agentsToolbarInitialized = true;
+            }
+        }        
+
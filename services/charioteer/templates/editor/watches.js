@@ -0,0 +1,77 @@
+        // Watch expressions: the backend evaluates them after every run and
+        // returns their values with the result, so the panel refreshes
+        // without re-running the script
+        let watchResults = [];
+
+        function renderWatches() {
+            const list = document.getElementById('watchList');
+            if (!list) return;
+            if (watchResults.length === 0) {
+                list.innerHTML = '<div class="watch-empty">No watch expressions</div>';
+                return;
+            }
+            list.innerHTML = watchResults.map((w, i) => {
+                const value = w.error
+                    ? '<span class="watch-error">' + escapeHtml(w.error) + '</span>'
+                    : '<span class="tree-leaf">' + escapeHtml(JSON.stringify(w.value === undefined ? null : w.value)) + '</span>';
+                return '<div class="watch-item"><span class="tree-key">' + escapeHtml(w.expression) + '</span>: ' + value +
+                       '<button class="watch-remove" data-index="' + i + '" title="Remove watch">×</button></div>';
+            }).join('');
+            list.querySelectorAll('.watch-remove').forEach(btn => {
+                btn.addEventListener('click', () => removeWatch(watchResults[Number(btn.dataset.index)].expression));
+            });
+        }
+
+        // Take the watch values returned with an execution result
+        function updateWatchesFromResult(result) {
+            if (result && Array.isArray(result.watches)) {
+                watchResults = result.watches;
+                renderWatches();
+            }
+        }
+
+        async function watchRequest(method, query, body) {
+            const options = { method: method, headers: body ? getAuthHeadersWithJSON() : getAuthHeaders() };
+            if (body) options.body = JSON.stringify(body);
+            const response = await fetch(getAPIPath('/api/runtime/watches' + query), options);
+            if (response.status === 401) {
+                logout();
+                return;
+            }
+            const result = await response.json();
+            if (response.ok && result.result === "OK") {
+                watchResults = result.data || [];
+                renderWatches();
+            } else {
+                showOutput('Watch: ' + (result.data || response.statusText), 'error');
+            }
+        }
+
+        async function loadWatches() {
+            try {
+                await watchRequest('GET', '');
+            } catch (e) {
+                console.error('Failed to load watch expressions:', e);
+            }
+        }
+
+        async function addWatch() {
+            const input = document.getElementById('watchInput');
+            const expression = input ? input.value.trim() : '';
+            if (!expression) return;
+            try {
+                await watchRequest('POST', '', { expression: expression });
+                input.value = '';
+            } catch (e) {
+                showOutput('Failed to add watch: ' + e.message, 'error');
+            }
+        }
+
+        async function removeWatch(expression) {
+            try {
+                await watchRequest('DELETE', '?expression=' + encodeURIComponent(expression));
+            } catch (e) {
+                showOutput('Failed to remove watch: ' + e.message, 'error');
+            }
+        }
+
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backend tokens are opaque, so charioteer checks one by asking the backend
+// for the session profile it stands for. The answer is cached per
+// environment and token: a token the backend vouched for is trusted for the
+// cache period, and one it rejected is refused without asking again for
+// tokenRejectedCache. While the backend cannot be reached, tokens it vouched
+// for within tokenStaleGrace stay trusted; others are refused with 503.
+
+var tokenCacheFlag = flag.Duration("token-cache", 0, "How long a token the backend vouched for is trusted before it is checked again (default 1m)")
+
+// tokenRejectedCache is how long a token the backend rejected is refused
+// without asking again.
+const tokenRejectedCache = 10 * time.Second
+
+// tokenStaleGrace is how long past the cache period a vouched-for token is
+// still trusted while the backend cannot be reached.
+const tokenStaleGrace = 5 * time.Minute
+
+// errTokenInvalid is returned for a token the backend does not know.
+var errTokenInvalid = errors.New("invalid token")
+
+// getTokenCache returns the token cache period from flag, environment variable, or default
+func getTokenCache() time.Duration {
+	if *tokenCacheFlag > 0 {
+		return *tokenCacheFlag
+	}
+	if env := os.Getenv("CHARIOT_TOKEN_CACHE"); env != "" {
+		if d, err := time.ParseDuration(env); err == nil && d > 0 {
+			return d
+		}
+	}
+	return time.Minute
+}
+
+// tokenIdentity is who a token belongs to, from the session profile.
+type tokenIdentity struct {
+	User  string
+	Admin bool
+	Roles []string
+}
+
+// hasRole reports whether the identity holds role; admins hold "admin".
+func (id tokenIdentity) hasRole(role string) bool {
+	if role == "admin" && id.Admin {
+		return true
+	}
+	for _, r := range id.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenCheck is the backend's answer for a token. done is closed once the
+// answer is in, so concurrent requests with the same token ask once.
+type tokenCheck struct {
+	done    chan struct{}
+	id      tokenIdentity
+	err     error // errTokenInvalid, or why the backend could not answer
+	checked time.Time
+}
+
+var tokenChecks = struct {
+	mu    sync.Mutex
+	byKey map[string]*tokenCheck
+	swept time.Time
+}{byKey: map[string]*tokenCheck{}}
+
+// tokenCheckKey keeps the answers of each environment's backends apart.
+func tokenCheckKey(r *http.Request, token string) string {
+	return environmentFor(r).tokenKey() + " " + token
+}
+
+// validateToken returns who token belongs to, asking the backend when
+// the cached answer is missing or out of date. It fails with errTokenInvalid
+// when the backend rejects the token, or with the reason the backend could
+// not be asked.
+func validateToken(r *http.Request, token string) (tokenIdentity, error) {
+	token = strings.TrimPrefix(token, "Bearer ")
+	if token == "" {
+		return tokenIdentity{}, errTokenInvalid
+	}
+	key := tokenCheckKey(r, token)
+	now := time.Now()
+
+	tokenChecks.mu.Lock()
+	prev := tokenChecks.byKey[key]
+	if prev != nil {
+		select {
+		case <-prev.done:
+			if prev.fresh(now) {
+				tokenChecks.mu.Unlock()
+				return prev.id, prev.err
+			}
+		default:
+			// Another request is asking the backend; wait for its answer
+			tokenChecks.mu.Unlock()
+			select {
+			case <-prev.done:
+				return prev.id, prev.err
+			case <-r.Context().Done():
+				return tokenIdentity{}, r.Context().Err()
+			}
+		}
+	}
+	check := &tokenCheck{done: make(chan struct{})}
+	tokenChecks.byKey[key] = check
+	sweepTokenChecks(now)
+	tokenChecks.mu.Unlock()
+
+	check.id, check.err = introspectToken(r, token)
+	check.checked = time.Now()
+	if check.err != nil && !errors.Is(check.err, errTokenInvalid) && prev != nil && prev.err == nil &&
+		check.checked.Sub(prev.checked) < getTokenCache()+tokenStaleGrace {
+		// The backend is unreachable: keep trusting what it said before
+		check.id, check.err, check.checked = prev.id, nil, prev.checked
+	}
+	close(check.done)
+	if check.err != nil && !errors.Is(check.err, errTokenInvalid) {
+		// Not an answer about the token; the next request asks again
+		tokenChecks.mu.Lock()
+		if tokenChecks.byKey[key] == check {
+			delete(tokenChecks.byKey, key)
+		}
+		tokenChecks.mu.Unlock()
+	}
+	return check.id, check.err
+}
+
+// fresh reports whether a finished check can still be relied on.
+func (c *tokenCheck) fresh(now time.Time) bool {
+	if c.err != nil {
+		return now.Sub(c.checked) < tokenRejectedCache
+	}
+	return now.Sub(c.checked) < getTokenCache()
+}
+
+// sweepTokenChecks drops answers too old to be used; tokenChecks.mu must be held.
+func sweepTokenChecks(now time.Time) {
+	if now.Sub(tokenChecks.swept) < time.Minute {
+		return
+	}
+	tokenChecks.swept = now
+	for key, check := range tokenChecks.byKey {
+		select {
+		case <-check.done:
+			if now.Sub(check.checked) > getTokenCache()+tokenStaleGrace {
+				delete(tokenChecks.byKey, key)
+			}
+		default:
+		}
+	}
+}
+
+// forgetToken drops the cached answer for a token that was logged out.
+func forgetToken(r *http.Request, token string) {
+	token = strings.TrimPrefix(token, "Bearer ")
+	if token == "" {
+		return
+	}
+	tokenChecks.mu.Lock()
+	defer tokenChecks.mu.Unlock()
+	delete(tokenChecks.byKey, tokenCheckKey(r, token))
+}
+
+// introspectToken asks the backend whose session token stands for.
+func introspectToken(r *http.Request, token string) (tokenIdentity, error) {
+	resp, err := doBackend(r, getHTTPClient(), http.MethodGet, "/api/session/profile", nil, func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+token)
+	})
+	if err != nil {
+		return tokenIdentity{}, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return tokenIdentity{}, errTokenInvalid
+	case resp.StatusCode != http.StatusOK:
+		return tokenIdentity{}, errors.New("backend answered " + resp.Status)
+	}
+	var profile struct {
+		Data struct {
+			Username string   `json:"username"`
+			Admin    bool     `json:"admin"`
+			Roles    []string `json:"roles"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return tokenIdentity{}, errors.New("unreadable session profile: " + err.Error())
+	}
+	return tokenIdentity{User: profile.Data.Username, Admin: profile.Data.Admin, Roles: profile.Data.Roles}, nil
+}
+
+// sendTokenError answers a request whose token validateToken did not accept.
+func sendTokenError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errTokenInvalid) {
+		sendError(w, http.StatusUnauthorized, "Invalid token")
+		return
+	}
+	sendBackendError(w, http.StatusServiceUnavailable, "Could not verify token: ", err)
+}
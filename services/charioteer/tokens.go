@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A backend with short-lived access tokens says in its login and refresh
+// responses how long the token is valid, and hands out a refresh token.
+// charioteer keeps the refresh token in an HttpOnly cookie, remembers when
+// each access token it passed on expires, and refuses requests and
+// WebSocket upgrades made with an expired one. Open WebSockets are closed
+// when their token expires, unless the client re-authenticates them after a
+// refresh by sending {"type": "reauth", "token": "<new token>"}.
+
+// wsCloseTokenExpired closes a WebSocket whose access token expired.
+const wsCloseTokenExpired = 4401
+
+// expiredTokenMemory is how long an expired token is still reported as
+// expired rather than unknown.
+const expiredTokenMemory = time.Hour
+
+var tokenExpiries = struct {
+	mu      sync.Mutex
+	byToken map[string]time.Time
+	swept   time.Time
+}{byToken: map[string]time.Time{}}
+
+// tokenGrant is the data of a login or refresh response.
+type tokenGrant struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // seconds
+}
+
+// noteTokenExpiry remembers when a short-lived token expires.
+func noteTokenExpiry(token string, expiresIn int) {
+	if token == "" || expiresIn <= 0 {
+		return
+	}
+	now := time.Now()
+	tokenExpiries.mu.Lock()
+	defer tokenExpiries.mu.Unlock()
+	tokenExpiries.byToken[token] = now.Add(time.Duration(expiresIn) * time.Second)
+	if now.Sub(tokenExpiries.swept) > time.Minute {
+		tokenExpiries.swept = now
+		for t, at := range tokenExpiries.byToken {
+			if now.Sub(at) > expiredTokenMemory {
+				delete(tokenExpiries.byToken, t)
+			}
+		}
+	}
+}
+
+// tokenExpiry returns when token expires; zero when charioteer did not see
+// it issued or it lasts as long as its session.
+func tokenExpiry(token string) time.Time {
+	tokenExpiries.mu.Lock()
+	defer tokenExpiries.mu.Unlock()
+	return tokenExpiries.byToken[strings.TrimPrefix(token, "Bearer ")]
+}
+
+// tokenExpired reports whether token is known to have expired.
+func tokenExpired(token string) bool {
+	at := tokenExpiry(token)
+	return !at.IsZero() && time.Now().After(at)
+}
+
+// sendTokenExpired answers a request made with an expired access token.
+func sendTokenExpired(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="access token expired"`)
+	sendError(w, http.StatusUnauthorized, "Token expired")
+}
+
+// noteTokenResponse sets the token cookies and remembers the expiry of the
+// token in a successful login or refresh response.
+func noteTokenResponse(w http.ResponseWriter, r *http.Request, status int, body []byte) {
+	if status != http.StatusOK {
+		return
+	}
+	var parsed struct {
+		Result string     `json:"result"`
+		Data   tokenGrant `json:"data"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil || !strings.EqualFold(parsed.Result, "OK") || parsed.Data.Token == "" {
+		return
+	}
+	noteTokenExpiry(parsed.Data.Token, parsed.Data.ExpiresIn)
+	env := environmentFor(r)
+	http.SetCookie(w, tokenCookie(r, env.tokenKey(), parsed.Data.Token))
+	if parsed.Data.RefreshToken != "" {
+		http.SetCookie(w, tokenCookie(r, env.refreshKey(), parsed.Data.RefreshToken))
+	}
+}
+
+// tokenCookie returns an HttpOnly session cookie; an empty value deletes it.
+func tokenCookie(r *http.Request, name, value string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		// Secure when behind TLS or reverse proxy indicating HTTPS
+		Secure:   r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https"),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if value == "" {
+		cookie.Expires = time.Unix(0, 0)
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// tokenRefreshHandler exchanges the refresh token, from the body or the
+// environment's refresh cookie, for a new token pair.
+func tokenRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var grant tokenGrant
+	if body, err := io.ReadAll(r.Body); err == nil && len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &grant); err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid JSON body")
+			return
+		}
+	}
+	env := environmentFor(r)
+	if grant.RefreshToken == "" {
+		if c, err := r.Cookie(env.refreshKey()); err == nil {
+			grant.RefreshToken = c.Value
+		}
+	}
+	if grant.RefreshToken == "" {
+		sendError(w, http.StatusUnauthorized, "Refresh token required")
+		return
+	}
+
+	content, _ := json.Marshal(map[string]string{"refresh_token": grant.RefreshToken})
+	req, err := http.NewRequest(http.MethodPost, env.backendURL()+"/token/refresh", bytes.NewReader(content))
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, "Failed to create request")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// A refresh token is good once, so the request is never retried
+	resp, err := doRecorded(r.Context(), getHTTPClient(), req)
+	if err != nil {
+		log.Printf("Failed to connect to Chariot server for token refresh: %v", err)
+		sendError(w, http.StatusServiceUnavailable, "Chariot server unavailable")
+		return
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, "Failed to read response")
+		return
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		// The refresh token is spent or its session ended
+		http.SetCookie(w, tokenCookie(r, env.refreshKey(), ""))
+	}
+	noteTokenResponse(w, r, resp.StatusCode, responseBody)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	if _, err := w.Write(responseBody); err != nil {
+		log.Printf("error writing token refresh response: %v", err)
+	}
+}
+
+// watchToken makes the session track the expiry of the token the client
+// connected with.
+func (s *wsSession) watchToken(r *http.Request, token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.req, s.expires = r, tokenExpiry(token)
+}
+
+// tokenExpired reports whether the session's token has expired.
+func (s *wsSession) tokenExpired() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.expires.IsZero() && time.Now().After(s.expires)
+}
+
+// reauth handles a message from the client if it is a reauth request,
+// returning the reply to send back and whether it was one. The new token
+// must be current and belong to the same user; the reply is
+// {"type": "reauth", "result": "OK"} or an ERROR result with the reason.
+func (s *wsSession) reauth(msg []byte) ([]byte, bool) {
+	if !bytes.Contains(msg, []byte(`"reauth"`)) {
+		return nil, false
+	}
+	var req struct {
+		Type  string `json:"type"`
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(msg, &req); err != nil || req.Type != "reauth" {
+		return nil, false
+	}
+	s.mu.Lock()
+	r := s.req
+	s.mu.Unlock()
+	reply := map[string]interface{}{"type": "reauth", "result": "OK"}
+	switch {
+	case req.Token == "":
+		reply["result"], reply["error"] = "ERROR", "token required"
+	case tokenExpired(req.Token):
+		reply["result"], reply["error"] = "ERROR", "token expired"
+	case r == nil || wsUser(r, req.Token) != s.user:
+		reply["result"], reply["error"] = "ERROR", "token does not belong to this connection's user"
+	default:
+		s.watchToken(r, req.Token)
+		if at := tokenExpiry(req.Token); !at.IsZero() {
+			reply["expires_in"] = int(time.Until(at).Seconds())
+		}
+	}
+	data, _ := json.Marshal(reply)
+	return data, true
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"embed"
+	"flag"
+	"html/template"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The editor and dashboard pages are built from templates/: layout.html wraps
+// every page, and each page directory holds a page.html that fills the
+// layout's "styles", "content" and "scripts" blocks from its fragments.
+//
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	brandName      = flag.String("brand", "", "Product name shown in page titles (default Charioteer)")
+	sessionMinutes = flag.Int("session-minutes", 0, "Session length the editor assumes when the backend does not say how long tokens last (default 30)")
+)
+
+// sessionWarningMinutes is how long before expiry the editor warns the user.
+const sessionWarningMinutes = 3
+
+var pageTemplates = map[string]*template.Template{
+	"editor":    parsePage("editor"),
+	"dashboard": parsePage("dashboard"),
+}
+
+func parsePage(name string) *template.Template {
+	return template.Must(template.New(name).ParseFS(templateFS, "templates/layout.html", "templates/"+name+"/*"))
+}
+
+// uiConfig is injected into every page as CHARIOTEER_CONFIG.
+type uiConfig struct {
+	APIBase        string          `json:"apiBase"`        // path prefix the page was served under, e.g. /charioteer
+	SessionMinutes int             `json:"sessionMinutes"` // token lifetime when login does not report expires_in
+	WarningMinutes int             `json:"warningMinutes"` // warn this many minutes before expiry
+	Brand          string          `json:"brand"`
+	Features       map[string]bool `json:"features"`
+	Wasm           bool            `json:"wasm"` // the wasm parser is available; see wasm.go
+	// The environment the session works against and those it can switch
+	// to, when -environments is set; see environments.go
+	Environment  *environmentInfo  `json:"environment,omitempty"`
+	Environments []environmentInfo `json:"environments,omitempty"`
+	TokenKey     string            `json:"tokenKey"` // local storage key of the login token
+}
+
+// uiTab is a toolbar tab of the editor. Hidden tabs stay in the page so the
+// scripts that bind them keep working.
+type uiTab struct {
+	ID     string
+	Label  string
+	Active bool
+	Hidden bool
+}
+
+type EditorData struct {
+	Title           string
+	Config          uiConfig
+	Tabs            []uiTab
+	InitialCode     string
+	MonacoBase      string // where Monaco's "vs" modules load from
+	LoaderIntegrity string // SRI hash for loader.js, set when served from the binary
+}
+
+type DashboardData struct {
+	Title      string
+	Config     uiConfig
+	BackendURL string
+}
+
+// getBrand returns the brand name from flag, environment variable, or default
+func getBrand() string {
+	if *brandName != "" {
+		return *brandName
+	}
+	if env := os.Getenv("CHARIOT_BRAND"); env != "" {
+		return env
+	}
+	return "Charioteer"
+}
+
+// getSessionMinutes returns the session length from flag, environment variable, or default
+func getSessionMinutes() int {
+	if *sessionMinutes > 0 {
+		return *sessionMinutes
+	}
+	if env := os.Getenv("CHARIOT_SESSION_MINUTES"); env != "" {
+		if minutes, err := strconv.Atoi(env); err == nil && minutes > 0 {
+			return minutes
+		}
+	}
+	return 30
+}
+
+// pageConfig builds the configuration injected into a page served for r.
+func pageConfig(r *http.Request) uiConfig {
+	apiBase := ""
+	if strings.HasPrefix(r.URL.Path, "/charioteer/") {
+		apiBase = "/charioteer"
+	}
+	env := environmentFor(r)
+	config := uiConfig{
+		APIBase:        apiBase,
+		SessionMinutes: getSessionMinutes(),
+		WarningMinutes: sessionWarningMinutes,
+		Brand:          getBrand(),
+		Features:       featureSnapshot(),
+		Wasm:           wasmEnabled(),
+		TokenKey:       env.tokenKey(),
+	}
+	for _, e := range environments {
+		info := e.info(env)
+		if info.Active {
+			config.Environment = &info
+		}
+		config.Environments = append(config.Environments, info)
+	}
+	return config
+}
+
+// editorTabs lists the editor's toolbar tabs for the request; this is the
+// place to hide tabs a deployment does not offer. Tabs of disabled features
+// are hidden.
+func editorTabs(r *http.Request, config uiConfig) []uiTab {
+	tabs := []uiTab{
+		{ID: "files", Label: "Files", Active: true},
+		{ID: "functions", Label: "Function Library"},
+		{ID: "diagrams", Label: "Diagrams"},
+		{ID: "dashboard", Label: "Dashboard"},
+		{ID: "agents", Label: "Agents"},
+	}
+	for i := range tabs {
+		for _, f := range featureRegistry {
+			if f.Tab == tabs[i].ID && !config.Features[f.Name] {
+				tabs[i].Hidden = true
+			}
+		}
+	}
+	return tabs
+}
+
+// renderPage executes a page template into the layout.
+func renderPage(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pageTemplates[name].ExecuteTemplate(w, "layout", data); err != nil {
+		http.Error(w, "Template execution error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func editorHandler(w http.ResponseWriter, r *http.Request) {
+	config := pageConfig(r)
+	renderPage(w, "editor", EditorData{
+		Title:  config.Brand + " Code Editor",
+		Config: config,
+		Tabs:   editorTabs(r, config),
+		InitialCode: `// Chariot Script Example
+    declare(x, 'N', 100)
+    setq(result, add(x, 100))
+    result`,
+		MonacoBase:      editorAssets.MonacoBase,
+		LoaderIntegrity: editorAssets.LoaderIntegrity,
+	})
+}
+
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	config := pageConfig(r)
+	renderPage(w, "dashboard", DashboardData{
+		Title:      config.Brand + " Dashboard",
+		Config:     config,
+		BackendURL: environmentFor(r).backendURL(),
+	})
+}
@@ -0,0 +1,53 @@
+#!/bin/bash
+# Vendor the Monaco editor and the chariot-codegen bundle into assets/ so they
+# are embedded in the charioteer binary, then record their SHA-256 hashes in
+# assets/manifest.json.
+#
+# Usage: ./vendor-assets.sh [monaco-tarball]
+#   MONACO_VERSION  monaco-editor release to fetch (default 0.45.0)
+#   The optional tarball argument is a pre-downloaded monaco-editor-<ver>.tgz
+#   for machines without registry access.
+
+set -euo pipefail
+
+cd "$(dirname "$0")"
+MONACO_VERSION="${MONACO_VERSION:-0.45.0}"
+ASSETS_DIR="assets"
+CODEGEN_BUNDLE="../../packages/chariot-codegen/dist/index.global.js"
+
+work="$(mktemp -d)"
+trap 'rm -rf "$work"' EXIT
+
+tarball="${1:-}"
+if [ -z "$tarball" ]; then
+    tarball="$work/monaco.tgz"
+    echo "Fetching monaco-editor@${MONACO_VERSION}..."
+    curl -fsSL "https://registry.npmjs.org/monaco-editor/-/monaco-editor-${MONACO_VERSION}.tgz" -o "$tarball"
+fi
+tar -xzf "$tarball" -C "$work"
+
+rm -rf "$ASSETS_DIR/monaco"
+mkdir -p "$ASSETS_DIR/monaco"
+cp -R "$work/package/min/vs" "$ASSETS_DIR/monaco/vs"
+
+if [ ! -f "$CODEGEN_BUNDLE" ]; then
+    echo "Building chariot-codegen bundle..."
+    (cd ../../packages/chariot-codegen && npm ci && npm run build)
+fi
+cp "$CODEGEN_BUNDLE" "$ASSETS_DIR/chariot-codegen.js"
+
+echo "Writing $ASSETS_DIR/manifest.json..."
+{
+    printf '{\n  "monaco": "%s",\n  "files": {\n' "$MONACO_VERSION"
+    first=1
+    while IFS= read -r f; do
+        rel="${f#"$ASSETS_DIR"/}"
+        sum="$(sha256sum "$f" | cut -d' ' -f1)"
+        [ $first -eq 1 ] || printf ',\n'
+        printf '    "%s": "%s"' "$rel" "$sum"
+        first=0
+    done < <(find "$ASSETS_DIR/monaco" "$ASSETS_DIR/chariot-codegen.js" -type f | LC_ALL=C sort)
+    printf '\n  }\n}\n'
+} > "$ASSETS_DIR/manifest.json"
+
+echo "Vendored $(find "$ASSETS_DIR/monaco" -type f | wc -l) Monaco files."
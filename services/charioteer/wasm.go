@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// wasmFiles are the WebAssembly build of the Chariot parser and diagram code
+// generator (go-chariot/cmd/chariot-wasm) and the Go runtime glue it needs,
+// as written to assets/wasm/ by build-wasm.sh. Like the vendored Monaco
+// bundle they are not checked in.
+var wasmFiles = map[string]string{
+	"chariot.wasm": "application/wasm",
+	"wasm_exec.js": "application/javascript; charset=utf-8",
+}
+
+// wasmAsset is an embedded wasm file and the ETag it is served with.
+type wasmAsset struct {
+	data        []byte
+	contentType string
+	etag        string
+}
+
+// wasmAssets holds the embedded wasm files, loaded once by initWasm. It is
+// empty when the binary was built without them.
+var wasmAssets = map[string]wasmAsset{}
+
+// initWasm loads the embedded wasm build. Without it the editor falls back to
+// its JavaScript highlighter and code generator.
+func initWasm() {
+	loaded := map[string]wasmAsset{}
+	for name, contentType := range wasmFiles {
+		data, err := fs.ReadFile(embeddedAssets, "assets/wasm/"+name)
+		if err != nil {
+			log.Printf("Editor wasm: %s not embedded (run make wasm); using JavaScript syntax checking", name)
+			return
+		}
+		sum := sha256.Sum256(data)
+		loaded[name] = wasmAsset{data: data, contentType: contentType, etag: `"` + hex.EncodeToString(sum[:16]) + `"`}
+	}
+	wasmAssets = loaded
+	log.Printf("Editor wasm: serving Chariot parser (%d KB)", len(loaded["chariot.wasm"].data)/1024)
+}
+
+// wasmEnabled reports whether the editor should load the wasm parser.
+func wasmEnabled() bool {
+	return featureEnabled("enable_wasm_check") && len(wasmAssets) == len(wasmFiles)
+}
+
+// wasmHandler serves the wasm build under /wasm/ and /charioteer/wasm/. Unlike
+// the vendored bundle it is served in every asset mode, since it is built
+// from this repository rather than fetched from a CDN. The files change with
+// each build, so clients revalidate them by ETag.
+func wasmHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asset, ok := wasmAssets[path.Base(r.URL.Path)]
+		if !ok || !strings.Contains(r.URL.Path, "/wasm/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", asset.contentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", asset.etag)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(asset.data))
+	})
+}
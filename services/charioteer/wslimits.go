@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Every WebSocket connection charioteer serves (dashboard, agents, console
+// and collaboration) is counted against a limit per user and a global one.
+// A connection over a limit is accepted and closed at once with close code
+// wsCloseTooMany and a reason, so the browser can tell it apart from a
+// network failure; one that carries no message either way for the idle
+// timeout is closed with wsCloseIdle, and one whose access token expires
+// without being re-authenticated with wsCloseTokenExpired.
+
+var (
+	wsPerUserFlag = flag.Int("ws-per-user", -1, "Concurrent WebSocket connections allowed per user (default 20, 0 unlimited)")
+	wsMaxFlag     = flag.Int("ws-max", -1, "Concurrent WebSocket connections allowed in total (default 1000, 0 unlimited)")
+	wsIdleFlag    = flag.Duration("ws-idle-timeout", 0, "Close WebSocket connections that carry no message either way for this long (default 30m)")
+)
+
+// Close codes of connections charioteer ends itself, in the range RFC 6455
+// leaves to applications, after the HTTP statuses they correspond to.
+const (
+	wsCloseTooMany = 4429
+	wsCloseIdle    = 4408
+)
+
+// getWSPerUser returns the per-user connection limit from flag, environment variable, or default
+func getWSPerUser() int {
+	if *wsPerUserFlag >= 0 {
+		return *wsPerUserFlag
+	}
+	if env := os.Getenv("CHARIOT_WS_PER_USER"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return 20
+}
+
+// getWSMax returns the global connection limit from flag, environment variable, or default
+func getWSMax() int {
+	if *wsMaxFlag >= 0 {
+		return *wsMaxFlag
+	}
+	if env := os.Getenv("CHARIOT_WS_MAX"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return 1000
+}
+
+// getWSIdleTimeout returns the idle timeout from flag, environment variable, or default
+func getWSIdleTimeout() time.Duration {
+	if *wsIdleFlag > 0 {
+		return *wsIdleFlag
+	}
+	if env := os.Getenv("CHARIOT_WS_IDLE_TIMEOUT"); env != "" {
+		if d, err := time.ParseDuration(env); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 30 * time.Minute
+}
+
+// wsSession is an admitted connection.
+type wsSession struct {
+	kind    string // dashboard, agents, repl or collab
+	user    string
+	conn    *websocket.Conn
+	last    atomic.Int64 // time of the last message, in Unix nanoseconds
+	closed  chan struct{}
+	once    sync.Once
+	writeMu sync.Mutex // serializes writes of data messages to conn
+
+	mu      sync.Mutex
+	req     *http.Request // the upgrade request, for checking reauth tokens
+	expires time.Time     // when the access token expires; zero if unknown
+}
+
+// wsRegistry counts the open connections and keeps the metrics.
+type wsRegistry struct {
+	mu             sync.Mutex
+	open           map[*wsSession]bool
+	perUser        map[string]int
+	accepted       uint64
+	rejectedUser   uint64
+	rejectedGlobal uint64
+	idleClosed     uint64
+	tokenClosed    uint64
+}
+
+var websockets = &wsRegistry{open: map[*wsSession]bool{}, perUser: map[string]int{}}
+
+// wsMetrics is what GET /api/admin/websockets reports.
+type wsMetrics struct {
+	Open               int            `json:"open"`
+	Limit              int            `json:"limit"`          // 0 = unlimited
+	PerUserLimit       int            `json:"per_user_limit"` // 0 = unlimited
+	IdleTimeoutSeconds int            `json:"idle_timeout_seconds"`
+	ByKind             map[string]int `json:"by_kind"`
+	ByUser             map[string]int `json:"by_user"`
+	Accepted           uint64         `json:"accepted"`
+	RejectedUserLimit  uint64         `json:"rejected_user_limit"`
+	RejectedGlobal     uint64         `json:"rejected_global_limit"`
+	IdleClosed         uint64         `json:"idle_closed"`
+	TokenExpired       uint64         `json:"token_expired"`
+}
+
+// wsUser names the user a token belongs to for accounting: the username
+// of its session, or a digest of the token when the backend does not say.
+func wsUser(r *http.Request, token string) string {
+	if name := collabUsername(r, token); name != "anonymous" {
+		return name
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:4])
+}
+
+// admit counts an upgraded connection of user against the limits. Over a
+// limit, it closes the connection with wsCloseTooMany and returns nil.
+// Otherwise the caller must release the session when the connection ends,
+// and touch it for every message, or it is closed once idle.
+func (reg *wsRegistry) admit(conn *websocket.Conn, kind, user string) *wsSession {
+	perUser, max := getWSPerUser(), getWSMax()
+	reg.mu.Lock()
+	reason := ""
+	switch {
+	case max > 0 && len(reg.open) >= max:
+		reg.rejectedGlobal++
+		reason = fmt.Sprintf("too many connections to the server (limit %d)", max)
+	case perUser > 0 && reg.perUser[user] >= perUser:
+		reg.rejectedUser++
+		reason = fmt.Sprintf("too many connections for %s (limit %d); close other tabs", user, perUser)
+	}
+	if reason != "" {
+		reg.mu.Unlock()
+		log.Printf("Rejected %s WebSocket of %s: %s", kind, user, reason)
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(wsCloseTooMany, reason), time.Now().Add(time.Second))
+		conn.Close()
+		return nil
+	}
+	s := &wsSession{kind: kind, user: user, conn: conn, closed: make(chan struct{})}
+	s.touch()
+	reg.open[s] = true
+	reg.perUser[user]++
+	reg.accepted++
+	reg.mu.Unlock()
+	go reg.watchIdle(s, getWSIdleTimeout())
+	return s
+}
+
+// watchIdle closes the session's connection once it has carried no
+// message for the timeout, or its access token has expired.
+func (reg *wsRegistry) watchIdle(s *wsSession, timeout time.Duration) {
+	interval := timeout / 10
+	if interval > 5*time.Second {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			code, reason := 0, ""
+			switch {
+			case time.Since(time.Unix(0, s.last.Load())) >= timeout:
+				code, reason = wsCloseIdle, fmt.Sprintf("idle for %s", timeout)
+			case s.tokenExpired():
+				code, reason = wsCloseTokenExpired, "access token expired; refresh it and reconnect"
+			default:
+				continue
+			}
+			reg.mu.Lock()
+			if code == wsCloseIdle {
+				reg.idleClosed++
+			} else {
+				reg.tokenClosed++
+			}
+			reg.mu.Unlock()
+			s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+			// Closing the connection ends the handler's read loop, which
+			// releases the session
+			s.conn.Close()
+			return
+		}
+	}
+}
+
+// touch records traffic on the connection.
+func (s *wsSession) touch() {
+	s.last.Store(time.Now().UnixNano())
+}
+
+// write sends a data message to the client.
+func (s *wsSession) write(messageType int, data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteMessage(messageType, data)
+}
+
+// release stops counting the connection.
+func (s *wsSession) release() {
+	s.once.Do(func() {
+		close(s.closed)
+		websockets.mu.Lock()
+		defer websockets.mu.Unlock()
+		delete(websockets.open, s)
+		if websockets.perUser[s.user]--; websockets.perUser[s.user] <= 0 {
+			delete(websockets.perUser, s.user)
+		}
+	})
+}
+
+func (reg *wsRegistry) metrics() wsMetrics {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	m := wsMetrics{
+		Open:               len(reg.open),
+		Limit:              getWSMax(),
+		PerUserLimit:       getWSPerUser(),
+		IdleTimeoutSeconds: int(getWSIdleTimeout().Seconds()),
+		ByKind:             map[string]int{},
+		ByUser:             map[string]int{},
+		Accepted:           reg.accepted,
+		RejectedUserLimit:  reg.rejectedUser,
+		RejectedGlobal:     reg.rejectedGlobal,
+		IdleClosed:         reg.idleClosed,
+		TokenExpired:       reg.tokenClosed,
+	}
+	for s := range reg.open {
+		m.ByKind[s.kind]++
+	}
+	for user, n := range reg.perUser {
+		m.ByUser[user] = n
+	}
+	return m
+}
+
+// pumpWS copies messages from one connection to the other, touching the
+// session for each, until either fails. Reauth requests from the client are
+// answered rather than passed on.
+func pumpWS(s *wsSession, from, to *websocket.Conn, errc chan<- error) {
+	for {
+		mt, msg, err := from.ReadMessage()
+		if err != nil {
+			errc <- err
+			return
+		}
+		s.touch()
+		if from == s.conn && mt == websocket.TextMessage {
+			if reply, ok := s.reauth(msg); ok {
+				msg, to = reply, s.conn
+			}
+		}
+		if to == s.conn {
+			err = s.write(mt, msg)
+		} else {
+			err = to.WriteMessage(mt, msg)
+		}
+		if err != nil {
+			errc <- err
+			return
+		}
+	}
+}
+
+// websocketsHandler reports the WebSocket connection metrics.
+func websocketsHandler(w http.ResponseWriter, r *http.Request) {
+	sendSuccess(w, websockets.metrics())
+}
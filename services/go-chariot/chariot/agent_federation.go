@@ -0,0 +1,194 @@
+package chariot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Agents on other backends are addressed as "peer/agent", where peer is the
+// name the federation configuration gives that backend. Setting a belief on
+// or nudging such an agent goes over the bridge, and a local agent can
+// follow a remote one: each event of the followed agent becomes a belief of
+// the follower named after it.
+
+// RemoteAgents reaches the agents of federated peers.
+type RemoteAgents interface {
+	HasPeer(peer string) bool
+	Publish(peer, agent string) error
+	SetBelief(peer, agent, key string, v Value, opts BeliefOptions) error
+	Belief(peer, agent, key string) (Value, error)
+}
+
+var (
+	remoteAgentsMu sync.RWMutex
+	remoteAgents   RemoteAgents
+)
+
+// SetRemoteAgents installs the bridge to federated peers; nil removes it.
+func SetRemoteAgents(r RemoteAgents) {
+	remoteAgentsMu.Lock()
+	remoteAgents = r
+	remoteAgentsMu.Unlock()
+}
+
+// remoteAgent splits a "peer/agent" name when peer is a federated peer.
+func remoteAgent(name string) (RemoteAgents, string, string, bool) {
+	remoteAgentsMu.RLock()
+	r := remoteAgents
+	remoteAgentsMu.RUnlock()
+	if r == nil {
+		return nil, "", "", false
+	}
+	peer, agent, found := strings.Cut(name, "/")
+	if !found || agent == "" || !r.HasPeer(peer) {
+		return nil, "", "", false
+	}
+	return r, peer, agent, true
+}
+
+// agentFollows maps a followed agent to its local followers. Events reach
+// the followers from their own goroutine, so an event broadcast while an
+// agent or the registry is locked cannot deadlock.
+var agentFollows = struct {
+	sync.Mutex
+	followers map[string]map[string]bool
+	events    chan AgentEvent
+	once      sync.Once
+}{followers: map[string]map[string]bool{}}
+
+// FollowAgent makes the local agent follower keep the last event of the
+// agent followed, local or "peer/agent", as the belief named followed.
+func FollowAgent(follower, followed string) error {
+	if follower == followed {
+		return errors.New("an agent cannot follow itself")
+	}
+	if defaultAgents.Get(follower) == nil {
+		return fmt.Errorf("agent '%s' not found", follower)
+	}
+	agentFollows.once.Do(func() {
+		agentFollows.events = make(chan AgentEvent, 256)
+		RegisterAgentEventSink(agentFollows.events)
+		go func() {
+			for ev := range agentFollows.events {
+				deliverFollows(ev)
+			}
+		}()
+	})
+	agentFollows.Lock()
+	defer agentFollows.Unlock()
+	if agentFollows.followers[followed] == nil {
+		agentFollows.followers[followed] = map[string]bool{}
+	}
+	agentFollows.followers[followed][follower] = true
+	return nil
+}
+
+// UnfollowAgent stops follower following followed.
+func UnfollowAgent(follower, followed string) bool {
+	agentFollows.Lock()
+	defer agentFollows.Unlock()
+	if !agentFollows.followers[followed][follower] {
+		return false
+	}
+	delete(agentFollows.followers[followed], follower)
+	if len(agentFollows.followers[followed]) == 0 {
+		delete(agentFollows.followers, followed)
+	}
+	return true
+}
+
+// AgentFollowers lists the local agents following name.
+func AgentFollowers(name string) []string {
+	agentFollows.Lock()
+	defer agentFollows.Unlock()
+	var out []string
+	for f := range agentFollows.followers[name] {
+		out = append(out, f)
+	}
+	return out
+}
+
+// DeliverRemoteAgentEvent hands an event of a federated agent, named
+// "peer/agent", to the local agents following it. Remote events are not
+// broadcast locally, so they are never sent back to a peer.
+func DeliverRemoteAgentEvent(ev AgentEvent) {
+	agentFollows.Lock()
+	events, followed := agentFollows.events, len(agentFollows.followers[ev.Agent]) > 0
+	agentFollows.Unlock()
+	if !followed {
+		return
+	}
+	select {
+	case events <- ev:
+	default: /* drop on slow followers */
+	}
+}
+
+func deliverFollows(ev AgentEvent) {
+	agentFollows.Lock()
+	if ev.Type == "agent" && ev.Status == "stop" {
+		// A stopped agent no longer follows anyone
+		for followed, followers := range agentFollows.followers {
+			delete(followers, ev.Agent)
+			if len(followers) == 0 {
+				delete(agentFollows.followers, followed)
+			}
+		}
+	}
+	followers := make([]string, 0, len(agentFollows.followers[ev.Agent]))
+	for f := range agentFollows.followers[ev.Agent] {
+		followers = append(followers, f)
+	}
+	agentFollows.Unlock()
+	if len(followers) == 0 {
+		return
+	}
+	b := NewMap()
+	b.Set("type", Str(ev.Type))
+	b.Set("plan", Str(ev.Plan))
+	b.Set("step", Number(ev.Step))
+	b.Set("status", Str(ev.Status))
+	b.Set("error", Str(ev.Error))
+	b.Set("time", Str(ev.Time.Format(time.RFC3339Nano)))
+	for _, f := range followers {
+		if ag := defaultAgents.Get(f); ag != nil {
+			ag.SetBelief(ev.Agent, b)
+		}
+	}
+}
+
+// RegisterAgentFederationFunctions wires agent following into the runtime
+func RegisterAgentFederationFunctions(rt *Runtime) {
+	// agentFollow(name, agentName) -> true; the last event of agentName
+	// (local or "peer/agent") becomes the belief agentName of name
+	rt.Register("agentFollow", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, errors.New("agentFollow(name, agentName)")
+		}
+		name, ok1 := args[0].(Str)
+		followed, ok2 := args[1].(Str)
+		if !ok1 || !ok2 || name == "" || followed == "" {
+			return nil, errors.New("agent names must be non-empty strings")
+		}
+		if err := FollowAgent(string(name), string(followed)); err != nil {
+			return nil, err
+		}
+		return Bool(true), nil
+	})
+
+	// agentUnfollow(name, agentName) -> true|false
+	rt.Register("agentUnfollow", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, errors.New("agentUnfollow(name, agentName)")
+		}
+		name, ok1 := args[0].(Str)
+		followed, ok2 := args[1].(Str)
+		if !ok1 || !ok2 {
+			return nil, errors.New("agent names must be strings")
+		}
+		return Bool(UnfollowAgent(string(name), string(followed))), nil
+	})
+}
@@ -0,0 +1,677 @@
+package chariot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Apache Arrow IPC, the interchange format of pyarrow, pandas (Feather v2)
+// and Spark, for DataFrames. Arrow messages are FlatBuffers; the few
+// tables needed here are built and read by hand with fbBuilder and
+// fbTable rather than through the Arrow libraries.
+//
+// Only flat columns are supported. Tables are written with a column of
+// Float64, Utf8, Bool or Null for each number, string, bool or all-null
+// column; columns of mixed values are written as Utf8, with values other
+// than strings as JSON. Reading also accepts integer, Float32, LargeUtf8,
+// Date and Timestamp columns; dates and timestamps become RFC 3339 strings.
+
+var arrowMagic = []byte("ARROW1")
+
+const (
+	arrowContinuation = 0xFFFFFFFF
+	arrowVersionV5    = 4
+
+	arrowHeaderSchema          = 1
+	arrowHeaderDictionaryBatch = 2
+	arrowHeaderRecordBatch     = 3
+
+	arrowTypeNull          = 1
+	arrowTypeInt           = 2
+	arrowTypeFloatingPoint = 3
+	arrowTypeUtf8          = 5
+	arrowTypeBool          = 6
+	arrowTypeDate          = 8
+	arrowTypeTimestamp     = 10
+	arrowTypeLargeUtf8     = 20
+)
+
+// fbBuilder builds a FlatBuffer back to front, as FlatBuffers builders
+// do, so that offsets always point forward. Positions are counted from the
+// end of the buffer. Arrow metadata is small, so prepending by copying is
+// fine.
+type fbBuilder struct {
+	b      []byte
+	start  int
+	fields [][2]int // slot, position
+}
+
+func (fb *fbBuilder) prepend(p []byte) {
+	fb.b = append(append(make([]byte, 0, len(p)+len(fb.b)), p...), fb.b...)
+}
+
+// align pads so that the next extra bytes prepended end size-aligned.
+func (fb *fbBuilder) align(size, extra int) {
+	if pad := (size - (len(fb.b)+extra)%size) % size; pad > 0 {
+		fb.prepend(make([]byte, pad))
+	}
+}
+
+func (fb *fbBuilder) prependUint32(v uint32) {
+	fb.align(4, 4)
+	fb.prepend(binary.LittleEndian.AppendUint32(nil, v))
+}
+
+func (fb *fbBuilder) prependOffset(target int) {
+	fb.align(4, 4)
+	fb.prepend(binary.LittleEndian.AppendUint32(nil, uint32(len(fb.b)+4-target)))
+}
+
+func (fb *fbBuilder) createString(s string) int {
+	fb.align(4, len(s)+1)
+	fb.prepend(append([]byte(s), 0))
+	fb.prependUint32(uint32(len(s)))
+	return len(fb.b)
+}
+
+func (fb *fbBuilder) createOffsetVector(offsets []int) int {
+	fb.align(4, 4*len(offsets))
+	for i := len(offsets) - 1; i >= 0; i-- {
+		fb.prependOffset(offsets[i])
+	}
+	fb.prependUint32(uint32(len(offsets)))
+	return len(fb.b)
+}
+
+// createStructVector stores n structs, laid out in data, 8-aligned.
+func (fb *fbBuilder) createStructVector(data []byte, n int) int {
+	fb.align(8, len(data))
+	fb.prepend(data)
+	fb.prependUint32(uint32(n))
+	return len(fb.b)
+}
+
+func (fb *fbBuilder) startTable() {
+	fb.start, fb.fields = len(fb.b), nil
+}
+
+func (fb *fbBuilder) addScalar(slot int, v []byte) {
+	fb.align(len(v), len(v))
+	fb.prepend(v)
+	fb.fields = append(fb.fields, [2]int{slot, len(fb.b)})
+}
+
+func (fb *fbBuilder) addUint8(slot int, v uint8) { fb.addScalar(slot, []byte{v}) }
+
+func (fb *fbBuilder) addInt16(slot int, v int16) {
+	fb.addScalar(slot, binary.LittleEndian.AppendUint16(nil, uint16(v)))
+}
+
+func (fb *fbBuilder) addInt64(slot int, v int64) {
+	fb.addScalar(slot, binary.LittleEndian.AppendUint64(nil, uint64(v)))
+}
+
+func (fb *fbBuilder) addOffset(slot, target int) {
+	fb.prependOffset(target)
+	fb.fields = append(fb.fields, [2]int{slot, len(fb.b)})
+}
+
+// endTable writes the table's vtable and returns the table's position.
+func (fb *fbBuilder) endTable() int {
+	fb.prependUint32(0) // Offset to the vtable, set below
+	table := len(fb.b)
+	slots := 0
+	for _, f := range fb.fields {
+		if f[0]+1 > slots {
+			slots = f[0] + 1
+		}
+	}
+	vtable := make([]byte, 4+2*slots)
+	binary.LittleEndian.PutUint16(vtable, uint16(len(vtable)))
+	binary.LittleEndian.PutUint16(vtable[2:], uint16(table-fb.start))
+	for _, f := range fb.fields {
+		binary.LittleEndian.PutUint16(vtable[4+2*f[0]:], uint16(table-f[1]))
+	}
+	fb.prepend(vtable)
+	binary.LittleEndian.PutUint32(fb.b[len(fb.b)-table:], uint32(len(fb.b)-table))
+	return table
+}
+
+// finish returns the buffer with root as its root table, 8-aligned.
+func (fb *fbBuilder) finish(root int) []byte {
+	fb.align(8, 4)
+	fb.prependOffset(root)
+	return fb.b
+}
+
+// fbTable reads a FlatBuffers table; pos is its offset in b.
+type fbTable struct {
+	b   []byte
+	pos int
+}
+
+func fbRoot(b []byte) fbTable {
+	return fbTable{b, int(binary.LittleEndian.Uint32(b))}
+}
+
+// field returns the offset in b of the table's field in slot, or 0 when it
+// is absent.
+func (t fbTable) field(slot int) int {
+	vtable := t.pos - int(int32(binary.LittleEndian.Uint32(t.b[t.pos:])))
+	entry := 4 + 2*slot
+	if entry >= int(binary.LittleEndian.Uint16(t.b[vtable:])) {
+		return 0
+	}
+	if off := int(binary.LittleEndian.Uint16(t.b[vtable+entry:])); off != 0 {
+		return t.pos + off
+	}
+	return 0
+}
+
+func (t fbTable) byteField(slot int, def uint8) uint8 {
+	if p := t.field(slot); p != 0 {
+		return t.b[p]
+	}
+	return def
+}
+
+func (t fbTable) int16Field(slot int, def int16) int16 {
+	if p := t.field(slot); p != 0 {
+		return int16(binary.LittleEndian.Uint16(t.b[p:]))
+	}
+	return def
+}
+
+func (t fbTable) int32Field(slot int, def int32) int32 {
+	if p := t.field(slot); p != 0 {
+		return int32(binary.LittleEndian.Uint32(t.b[p:]))
+	}
+	return def
+}
+
+func (t fbTable) int64Field(slot int, def int64) int64 {
+	if p := t.field(slot); p != 0 {
+		return int64(binary.LittleEndian.Uint64(t.b[p:]))
+	}
+	return def
+}
+
+func (t fbTable) indirect(p int) int {
+	return p + int(binary.LittleEndian.Uint32(t.b[p:]))
+}
+
+func (t fbTable) tableField(slot int) (fbTable, bool) {
+	p := t.field(slot)
+	if p == 0 {
+		return fbTable{}, false
+	}
+	return fbTable{t.b, t.indirect(p)}, true
+}
+
+func (t fbTable) stringField(slot int) string {
+	p := t.field(slot)
+	if p == 0 {
+		return ""
+	}
+	p = t.indirect(p)
+	n := int(binary.LittleEndian.Uint32(t.b[p:]))
+	return string(t.b[p+4 : p+4+n])
+}
+
+// vectorField returns the offset in b of the first element of the vector in
+// slot, and its length.
+func (t fbTable) vectorField(slot int) (int, int) {
+	p := t.field(slot)
+	if p == 0 {
+		return 0, 0
+	}
+	p = t.indirect(p)
+	return p + 4, int(binary.LittleEndian.Uint32(t.b[p:]))
+}
+
+// arrowField is a column of an Arrow schema.
+type arrowField struct {
+	name     string
+	typ      uint8
+	bitWidth int32
+	signed   bool
+	unit     int16 // Precision, DateUnit or TimeUnit
+}
+
+// arrowFieldForColumn is the Arrow type a DataFrame column is written as.
+func arrowFieldForColumn(name string, c *frameColumn) arrowField {
+	switch c.kind {
+	case "number":
+		return arrowField{name: name, typ: arrowTypeFloatingPoint, unit: 2}
+	case "bool":
+		return arrowField{name: name, typ: arrowTypeBool}
+	case "":
+		return arrowField{name: name, typ: arrowTypeNull}
+	}
+	return arrowField{name: name, typ: arrowTypeUtf8}
+}
+
+func buildArrowSchema(fb *fbBuilder, fields []arrowField) int {
+	offsets := make([]int, len(fields))
+	for i, f := range fields {
+		name := fb.createString(f.name)
+		fb.startTable()
+		if f.typ == arrowTypeFloatingPoint {
+			fb.addInt16(0, f.unit)
+		}
+		typ := fb.endTable()
+		children := fb.createOffsetVector(nil)
+		fb.startTable()
+		fb.addOffset(0, name)
+		fb.addUint8(1, 1) // nullable
+		fb.addUint8(2, f.typ)
+		fb.addOffset(3, typ)
+		fb.addOffset(5, children)
+		offsets[i] = fb.endTable()
+	}
+	vector := fb.createOffsetVector(offsets)
+	fb.startTable()
+	fb.addInt16(0, 0) // Little endian
+	fb.addOffset(1, vector)
+	return fb.endTable()
+}
+
+func readArrowSchema(t fbTable) ([]arrowField, error) {
+	if t.int16Field(0, 0) != 0 {
+		return nil, errors.New("big-endian Arrow data is not supported")
+	}
+	start, n := t.vectorField(1)
+	fields := make([]arrowField, n)
+	for i := range fields {
+		ft := fbTable{t.b, t.indirect(start + 4*i)}
+		f := arrowField{name: ft.stringField(0), typ: ft.byteField(2, 0)}
+		if _, ok := ft.tableField(4); ok {
+			return nil, fmt.Errorf("column '%s': dictionary-encoded columns are not supported", f.name)
+		}
+		if _, n := ft.vectorField(5); n > 0 {
+			return nil, fmt.Errorf("column '%s': nested columns are not supported", f.name)
+		}
+		typ, _ := ft.tableField(3)
+		switch f.typ {
+		case arrowTypeNull, arrowTypeUtf8, arrowTypeLargeUtf8, arrowTypeBool:
+		case arrowTypeInt:
+			f.bitWidth, f.signed = typ.int32Field(0, 0), typ.byteField(1, 0) != 0
+		case arrowTypeFloatingPoint:
+			f.unit = typ.int16Field(0, 0)
+			if f.unit == 0 {
+				return nil, fmt.Errorf("column '%s': half-precision floats are not supported", f.name)
+			}
+		case arrowTypeDate:
+			f.unit = typ.int16Field(0, 1)
+		case arrowTypeTimestamp:
+			f.unit = typ.int16Field(0, 0)
+		default:
+			return nil, fmt.Errorf("column '%s': Arrow type %d is not supported", f.name, f.typ)
+		}
+		fields[i] = f
+	}
+	return fields, nil
+}
+
+// arrowMessage frames a message, metadata then body, as the IPC format
+// encapsulates it.
+func arrowMessage(headerType uint8, build func(fb *fbBuilder) int, bodyLength int) []byte {
+	fb := &fbBuilder{}
+	header := build(fb)
+	fb.startTable()
+	fb.addInt16(0, arrowVersionV5)
+	fb.addUint8(1, headerType)
+	fb.addOffset(2, header)
+	fb.addInt64(3, int64(bodyLength))
+	meta := fb.finish(fb.endTable())
+	out := binary.LittleEndian.AppendUint32(nil, arrowContinuation)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(meta)))
+	return append(out, meta...)
+}
+
+// arrowBody collects the buffers of a record batch, each 8-aligned.
+type arrowBody struct {
+	data    []byte
+	buffers []byte // Buffer structs: offset, length
+	nodes   []byte // FieldNode structs: length, null count
+	count   int
+}
+
+func (b *arrowBody) addBuffer(p []byte) {
+	b.buffers = binary.LittleEndian.AppendUint64(b.buffers, uint64(len(b.data)))
+	b.buffers = binary.LittleEndian.AppendUint64(b.buffers, uint64(len(p)))
+	b.data = append(b.data, p...)
+	for len(b.data)%8 != 0 {
+		b.data = append(b.data, 0)
+	}
+	b.count++
+}
+
+// addColumn adds rows [from, to) of c, as the Arrow type f.
+func (b *arrowBody) addColumn(c *frameColumn, f arrowField, from, to int) error {
+	n := to - from
+	var validity []byte
+	nulls := 0
+	for i := from; i < to; i++ {
+		if c.isNull(i) {
+			nulls++
+		}
+	}
+	b.nodes = binary.LittleEndian.AppendUint64(b.nodes, uint64(n))
+	b.nodes = binary.LittleEndian.AppendUint64(b.nodes, uint64(nulls))
+	if f.typ == arrowTypeNull {
+		return nil
+	}
+	if nulls > 0 {
+		validity = make([]byte, (n+7)/8)
+		for i := from; i < to; i++ {
+			if !c.isNull(i) {
+				validity[(i-from)/8] |= 1 << ((i - from) % 8)
+			}
+		}
+	}
+	b.addBuffer(validity)
+	switch f.typ {
+	case arrowTypeFloatingPoint:
+		data := make([]byte, 8*n)
+		for i := from; i < to; i++ {
+			binary.LittleEndian.PutUint64(data[8*(i-from):], math.Float64bits(c.nums[i]))
+		}
+		b.addBuffer(data)
+	case arrowTypeBool:
+		data := make([]byte, (n+7)/8)
+		for i := from; i < to; i++ {
+			if !c.isNull(i) && c.bools[i] {
+				data[(i-from)/8] |= 1 << ((i - from) % 8)
+			}
+		}
+		b.addBuffer(data)
+	case arrowTypeUtf8:
+		offsets := make([]byte, 4*(n+1))
+		var text []byte
+		for i := from; i < to; i++ {
+			if !c.isNull(i) {
+				s, err := arrowText(c, i)
+				if err != nil {
+					return err
+				}
+				text = append(text, s...)
+			}
+			if len(text) > math.MaxInt32 {
+				return errors.New("more than 2 GB of text in one batch; use a smaller batchSize")
+			}
+			binary.LittleEndian.PutUint32(offsets[4*(i-from+1):], uint32(len(text)))
+		}
+		b.addBuffer(offsets)
+		b.addBuffer(text)
+	}
+	return nil
+}
+
+// arrowText is row i of a string or mixed column as text.
+func arrowText(c *frameColumn, i int) (string, error) {
+	if c.kind == "string" {
+		return c.strs[i], nil
+	}
+	native := c.native(i)
+	if s, ok := native.(string); ok {
+		return s, nil
+	}
+	text, err := json.Marshal(native)
+	return string(text), err
+}
+
+// writeArrow writes f to w as an Arrow IPC stream or, when file is set, an
+// Arrow IPC file, in record batches of at most batchSize rows.
+func writeArrow(w io.Writer, f *DataFrame, file bool, batchSize int) error {
+	fields := make([]arrowField, len(f.columns))
+	for i, c := range f.columns {
+		fields[i] = arrowFieldForColumn(f.names[i], c)
+	}
+	written := 0
+	write := func(p []byte) error {
+		n, err := w.Write(p)
+		written += n
+		return err
+	}
+	if file {
+		if err := write(append(append([]byte(nil), arrowMagic...), 0, 0)); err != nil {
+			return err
+		}
+	}
+	schema := arrowMessage(arrowHeaderSchema, func(fb *fbBuilder) int { return buildArrowSchema(fb, fields) }, 0)
+	if err := write(schema); err != nil {
+		return err
+	}
+	var blocks []byte // Block structs: offset, metadata length, body length
+	for from := 0; from < f.rows || from == 0; from += batchSize {
+		to := from + batchSize
+		if to > f.rows {
+			to = f.rows
+		}
+		body := &arrowBody{}
+		for i, c := range f.columns {
+			if err := body.addColumn(c, fields[i], from, to); err != nil {
+				return fmt.Errorf("column '%s': %v", f.names[i], err)
+			}
+		}
+		meta := arrowMessage(arrowHeaderRecordBatch, func(fb *fbBuilder) int {
+			buffers := fb.createStructVector(body.buffers, body.count)
+			nodes := fb.createStructVector(body.nodes, len(f.columns))
+			fb.startTable()
+			fb.addInt64(0, int64(to-from))
+			fb.addOffset(1, nodes)
+			fb.addOffset(2, buffers)
+			return fb.endTable()
+		}, len(body.data))
+		blocks = binary.LittleEndian.AppendUint64(blocks, uint64(written))
+		blocks = binary.LittleEndian.AppendUint32(blocks, uint32(len(meta)))
+		blocks = binary.LittleEndian.AppendUint32(blocks, 0)
+		blocks = binary.LittleEndian.AppendUint64(blocks, uint64(len(body.data)))
+		if err := write(meta); err != nil {
+			return err
+		}
+		if err := write(body.data); err != nil {
+			return err
+		}
+		if to == f.rows {
+			break
+		}
+	}
+	if err := write(binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, arrowContinuation), 0)); err != nil {
+		return err
+	}
+	if !file {
+		return nil
+	}
+	fb := &fbBuilder{}
+	schemaTable := buildArrowSchema(fb, fields)
+	batches := fb.createStructVector(blocks, len(blocks)/24)
+	dictionaries := fb.createStructVector(nil, 0)
+	fb.startTable()
+	fb.addInt16(0, arrowVersionV5)
+	fb.addOffset(1, schemaTable)
+	fb.addOffset(2, dictionaries)
+	fb.addOffset(3, batches)
+	footer := fb.finish(fb.endTable())
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	return write(append(footer, arrowMagic...))
+}
+
+// readArrow reads an Arrow IPC stream or file into a DataFrame.
+func readArrow(data []byte) (f *DataFrame, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			f, err = nil, errors.New("malformed Arrow data")
+		}
+	}()
+	if len(data) >= 18 && bytes.HasPrefix(data, arrowMagic) {
+		// The file format is the stream format between the magic and a
+		// footer, whose length precedes the closing magic
+		footer := int(binary.LittleEndian.Uint32(data[len(data)-10:]))
+		data = data[8 : len(data)-10-footer]
+	}
+	var fields []arrowField
+	for pos := 0; pos+4 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[pos:]))
+		pos += 4
+		if uint32(size) == arrowContinuation {
+			size = int(binary.LittleEndian.Uint32(data[pos:]))
+			pos += 4
+		}
+		if size == 0 {
+			break // End of stream
+		}
+		msg := fbRoot(data[pos : pos+size])
+		pos += size
+		bodyLength := int(msg.int64Field(3, 0))
+		body := data[pos : pos+bodyLength]
+		pos += bodyLength
+		header, ok := msg.tableField(2)
+		if !ok {
+			return nil, errors.New("Arrow message without a header")
+		}
+		switch msg.byteField(1, 0) {
+		case arrowHeaderSchema:
+			if fields, err = readArrowSchema(header); err != nil {
+				return nil, err
+			}
+			names := make([]string, len(fields))
+			for i, field := range fields {
+				names[i] = field.name
+			}
+			f = newDataFrame(names, nil)
+		case arrowHeaderRecordBatch:
+			if f == nil {
+				return nil, errors.New("Arrow record batch before the schema")
+			}
+			if err := readArrowBatch(f, fields, header, body); err != nil {
+				return nil, err
+			}
+		case arrowHeaderDictionaryBatch:
+			return nil, errors.New("dictionary-encoded columns are not supported")
+		default:
+			return nil, fmt.Errorf("unexpected Arrow message type %d", msg.byteField(1, 0))
+		}
+	}
+	if f == nil {
+		return nil, errors.New("no Arrow schema found")
+	}
+	return f, nil
+}
+
+func readArrowBatch(f *DataFrame, fields []arrowField, batch fbTable, body []byte) error {
+	if _, ok := batch.tableField(3); ok {
+		return errors.New("compressed Arrow data is not supported")
+	}
+	length := int(batch.int64Field(0, 0))
+	nodes, _ := batch.vectorField(1)
+	buffers, count := batch.vectorField(2)
+	b := batch.b
+	next := 0
+	buffer := func() []byte {
+		if next >= count {
+			panic("missing buffer")
+		}
+		p := buffers + 16*next
+		next++
+		offset := int(binary.LittleEndian.Uint64(b[p:]))
+		return body[offset : offset+int(binary.LittleEndian.Uint64(b[p+8:]))]
+	}
+	for j, field := range fields {
+		nulls := int(binary.LittleEndian.Uint64(b[nodes+16*j+8:]))
+		c := f.columns[j]
+		if field.typ == arrowTypeNull {
+			for i := 0; i < length; i++ {
+				c.appendValue(nil)
+			}
+			continue
+		}
+		validity := buffer()
+		valid := func(i int) bool {
+			return nulls == 0 || validity[i/8]&(1<<(i%8)) != 0
+		}
+		var offsets, values []byte
+		if field.typ == arrowTypeUtf8 || field.typ == arrowTypeLargeUtf8 {
+			offsets = buffer()
+		}
+		values = buffer()
+		for i := 0; i < length; i++ {
+			if !valid(i) {
+				c.appendValue(nil)
+				continue
+			}
+			c.appendValue(arrowValue(field, offsets, values, i))
+		}
+	}
+	f.rows += length
+	return nil
+}
+
+// arrowValue is row i of a column of type field held in offsets and values.
+func arrowValue(field arrowField, offsets, values []byte, i int) interface{} {
+	le := binary.LittleEndian
+	switch field.typ {
+	case arrowTypeBool:
+		return values[i/8]&(1<<(i%8)) != 0
+	case arrowTypeUtf8:
+		return string(values[le.Uint32(offsets[4*i:]):le.Uint32(offsets[4*i+4:])])
+	case arrowTypeLargeUtf8:
+		return string(values[le.Uint64(offsets[8*i:]):le.Uint64(offsets[8*i+8:])])
+	case arrowTypeFloatingPoint:
+		if field.unit == 1 {
+			return float64(math.Float32frombits(le.Uint32(values[4*i:])))
+		}
+		return math.Float64frombits(le.Uint64(values[8*i:]))
+	case arrowTypeInt:
+		switch field.bitWidth {
+		case 8:
+			if field.signed {
+				return float64(int8(values[i]))
+			}
+			return float64(values[i])
+		case 16:
+			if field.signed {
+				return float64(int16(le.Uint16(values[2*i:])))
+			}
+			return float64(le.Uint16(values[2*i:]))
+		case 32:
+			if field.signed {
+				return float64(int32(le.Uint32(values[4*i:])))
+			}
+			return float64(le.Uint32(values[4*i:]))
+		default:
+			if field.signed {
+				return float64(int64(le.Uint64(values[8*i:])))
+			}
+			return float64(le.Uint64(values[8*i:]))
+		}
+	case arrowTypeDate:
+		if field.unit == 0 {
+			days := int64(int32(le.Uint32(values[4*i:])))
+			return time.Unix(days*86400, 0).UTC().Format("2006-01-02")
+		}
+		return time.UnixMilli(int64(le.Uint64(values[8*i:]))).UTC().Format("2006-01-02")
+	case arrowTypeTimestamp:
+		v := int64(le.Uint64(values[8*i:]))
+		var t time.Time
+		switch field.unit {
+		case 0:
+			t = time.Unix(v, 0)
+		case 1:
+			t = time.UnixMilli(v)
+		case 2:
+			t = time.UnixMicro(v)
+		default:
+			t = time.Unix(0, v)
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return nil
+}
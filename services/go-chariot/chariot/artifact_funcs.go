@@ -0,0 +1,220 @@
+package chariot
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// RegisterArtifactFunctions registers emitArtifact, which hands a file back
+// with the execution result, emit, which streams partial results while the
+// run goes on, and resultType, which declares how the result should be read.
+func RegisterArtifactFunctions(rt *Runtime) {
+	// emit(value) -> streamed
+	// Streams a partial result to the clients following the execution, as
+	// NDJSON or as "result" events on its log stream, before the run ends.
+	// It returns false when nothing follows the run, as in a synchronous
+	// execution, and the value is dropped.
+	rt.Register("emit", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, errors.New("emit requires 1 argument: value")
+		}
+		args = unwrapScopeEntries(args)
+		streamed, err := rt.Emit(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("emit: %w", err)
+		}
+		return Bool(streamed), nil
+	})
+
+	// resultType(kind, [columns | artifact]) -> kind
+	// kind is json (the default), table, text or artifact. A table may name
+	// its columns in order; an artifact result names the artifact.
+	rt.Register("resultType", func(args ...Value) (Value, error) {
+		if len(args) < 1 || len(args) > 2 {
+			return nil, errors.New("resultType requires 1 or 2 arguments: kind, [columns | artifact]")
+		}
+		args = unwrapScopeEntries(args)
+		kind, ok := args[0].(Str)
+		if !ok {
+			return nil, fmt.Errorf("resultType: kind must be a string, got %T", args[0])
+		}
+		t := ResultType{Kind: string(kind)}
+		switch t.Kind {
+		case ResultJSON, ResultText:
+			if len(args) == 2 {
+				return nil, fmt.Errorf("resultType: %s takes no second argument", t.Kind)
+			}
+		case ResultTable:
+			if len(args) == 2 {
+				cols, ok := args[1].(*ArrayValue)
+				if !ok {
+					return nil, fmt.Errorf("resultType: columns must be an array, got %T", args[1])
+				}
+				for _, c := range cols.Elements {
+					name, ok := c.(Str)
+					if !ok {
+						return nil, fmt.Errorf("resultType: column names must be strings, got %T", c)
+					}
+					t.Columns = append(t.Columns, string(name))
+				}
+			}
+		case ResultArtifact:
+			if len(args) != 2 {
+				return nil, errors.New("resultType: artifact requires the artifact name")
+			}
+			name, ok := args[1].(Str)
+			if !ok {
+				return nil, fmt.Errorf("resultType: artifact name must be a string, got %T", args[1])
+			}
+			if err := validArtifactName(string(name)); err != nil {
+				return nil, fmt.Errorf("resultType: %w", err)
+			}
+			t.Artifact = string(name)
+		default:
+			return nil, fmt.Errorf("resultType: unknown kind %q (want json, table, text or artifact)", t.Kind)
+		}
+		rt.SetResultType(t)
+		return kind, nil
+	})
+
+	// emitArtifact(name, content, [mimeType]) -> name
+	// A string is stored as is. An array saved under a .csv name becomes CSV
+	// (rows of arrays, or maps with their keys as the header). Anything else
+	// is stored as JSON.
+	rt.Register("emitArtifact", func(args ...Value) (Value, error) {
+		if len(args) < 2 || len(args) > 3 {
+			return nil, errors.New("emitArtifact requires 2 or 3 arguments: name, content, [mimeType]")
+		}
+		args = unwrapScopeEntries(args)
+		nameStr, ok := args[0].(Str)
+		if !ok {
+			return nil, fmt.Errorf("emitArtifact: name must be a string, got %T", args[0])
+		}
+		name := string(nameStr)
+		if err := validArtifactName(name); err != nil {
+			return nil, fmt.Errorf("emitArtifact: %w", err)
+		}
+		ext := strings.ToLower(path.Ext(name))
+
+		var data []byte
+		var err error
+		mimeType := mime.TypeByExtension(ext)
+		if ext == ".csv" {
+			mimeType = "text/csv; charset=utf-8" // not in every mime table
+		}
+		text, isStr := args[1].(Str)
+		rows, isArray := args[1].(*ArrayValue)
+		switch {
+		case isStr:
+			data = []byte(text)
+			if mimeType == "" {
+				mimeType = "text/plain; charset=utf-8"
+			}
+		case isArray && ext == ".csv":
+			if data, err = artifactCSV(rows); err != nil {
+				return nil, fmt.Errorf("emitArtifact: %w", err)
+			}
+		default:
+			v := ValueToJSON(args[1])
+			if jn, ok := args[1].(interface{ GetJSONValue() interface{} }); ok {
+				v = jn.GetJSONValue()
+			}
+			if data, err = json.MarshalIndent(v, "", "  "); err != nil {
+				return nil, fmt.Errorf("emitArtifact: %w", err)
+			}
+			if mimeType == "" {
+				mimeType = "application/json"
+			}
+		}
+		if len(args) == 3 {
+			mt, ok := args[2].(Str)
+			if !ok {
+				return nil, fmt.Errorf("emitArtifact: mimeType must be a string, got %T", args[2])
+			}
+			if _, _, err := mime.ParseMediaType(string(mt)); err != nil {
+				return nil, fmt.Errorf("emitArtifact: mimeType: %w", err)
+			}
+			mimeType = string(mt)
+		}
+
+		if err := rt.AddArtifact(Artifact{Name: name, MimeType: mimeType, Data: data}); err != nil {
+			return nil, fmt.Errorf("emitArtifact: %w", err)
+		}
+		return Str(name), nil
+	})
+}
+
+// validArtifactName accepts plain file names: artifacts are downloaded by
+// name, so paths and control characters are refused.
+func validArtifactName(name string) error {
+	if name == "" || name == "." || name == ".." || len(name) > 255 {
+		return fmt.Errorf("invalid artifact name %q", name)
+	}
+	for _, r := range name {
+		if r == '/' || r == '\\' || unicode.IsControl(r) {
+			return fmt.Errorf("artifact name %q must be a plain file name", name)
+		}
+	}
+	return nil
+}
+
+// artifactCSV renders rows of arrays, or of maps with their sorted keys as
+// the header row.
+func artifactCSV(rows *ArrayValue) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	var header []string
+	for i, row := range rows.Elements {
+		var record []string
+		switch r := row.(type) {
+		case *ArrayValue:
+			for _, v := range r.Elements {
+				record = append(record, csvField(v))
+			}
+		case *MapValue:
+			if header == nil {
+				for k := range r.Values {
+					header = append(header, k)
+				}
+				sort.Strings(header)
+				if err := w.Write(header); err != nil {
+					return nil, err
+				}
+			}
+			for _, k := range header {
+				record = append(record, csvField(r.Values[k]))
+			}
+		default:
+			return nil, fmt.Errorf("CSV row %d must be an array or a map, got %T", i+1, row)
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func csvField(v Value) string {
+	if se, ok := v.(ScopeEntry); ok {
+		v = se.Value
+	}
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case Str:
+		return string(val)
+	}
+	if v == DBNull {
+		return ""
+	}
+	return interfaceToString(ValueToJSON(v))
+}
@@ -0,0 +1,139 @@
+package chariot
+
+import (
+	"fmt"
+	"sync"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+// Artifact is a named file a script hands back alongside its result, such as
+// a chart from plot or a CSV from emitArtifact.
+type Artifact struct {
+	Name     string
+	MimeType string
+	Data     []byte
+}
+
+// Default artifact limits, used when the artifact_max_size and
+// artifact_max_total settings are 0.
+const (
+	DefaultArtifactMaxSize  = 10 << 20 // bytes per artifact
+	DefaultArtifactMaxTotal = 50 << 20 // bytes per run
+)
+
+// DefaultResultMaxSize is the size of a result's JSON, and of each emitted
+// value, used when the result_max_size setting is 0.
+const DefaultResultMaxSize = 1 << 20
+
+// ResultMaxSize returns the configured result size limit in bytes.
+func ResultMaxSize() int {
+	if n := cfg.ChariotConfig.ResultMaxSize << 10; n > 0 {
+		return n
+	}
+	return DefaultResultMaxSize
+}
+
+type artifactList struct {
+	mu         sync.Mutex
+	items      []Artifact
+	total      int
+	resultType *ResultType
+}
+
+// Result kinds a script can declare with resultType
+const (
+	ResultJSON     = "json"     // a JSON value, the default
+	ResultTable    = "table"    // an array of rows: arrays, or maps keyed by column
+	ResultText     = "text"     // a string
+	ResultArtifact = "artifact" // one of the run's artifacts
+)
+
+// ResultType is how a run declared its result should be read.
+type ResultType struct {
+	Kind     string
+	Columns  []string // column order of a table; its maps' sorted keys when empty
+	Artifact string   // name of the artifact that is the result
+}
+
+// ArtifactLimits returns the configured size limits in bytes: per artifact
+// and for all artifacts of one run.
+func ArtifactLimits() (maxSize, maxTotal int) {
+	maxSize, maxTotal = cfg.ChariotConfig.ArtifactMaxSize<<10, cfg.ChariotConfig.ArtifactMaxTotal<<10
+	if maxSize <= 0 {
+		maxSize = DefaultArtifactMaxSize
+	}
+	if maxTotal <= 0 {
+		maxTotal = DefaultArtifactMaxTotal
+	}
+	return maxSize, maxTotal
+}
+
+// AddArtifact adds an artifact to the current run, replacing one with the
+// same name. It fails when the artifact or the run's artifacts together
+// would exceed the configured limits.
+func (rt *Runtime) AddArtifact(a Artifact) error {
+	if a.Name == "" {
+		return fmt.Errorf("artifact name must not be empty")
+	}
+	maxSize, maxTotal := ArtifactLimits()
+	if len(a.Data) > maxSize {
+		return fmt.Errorf("artifact %s is %d bytes; the limit is %d", a.Name, len(a.Data), maxSize)
+	}
+	rt.artifacts.mu.Lock()
+	defer rt.artifacts.mu.Unlock()
+	replace := -1
+	total := rt.artifacts.total + len(a.Data)
+	for i := range rt.artifacts.items {
+		if rt.artifacts.items[i].Name == a.Name {
+			replace = i
+			total -= len(rt.artifacts.items[i].Data)
+		}
+	}
+	if total > maxTotal {
+		return fmt.Errorf("artifact %s would bring this run's artifacts to %d bytes; the limit is %d", a.Name, total, maxTotal)
+	}
+	rt.artifacts.total = total
+	if replace >= 0 {
+		rt.artifacts.items[replace] = a
+	} else {
+		rt.artifacts.items = append(rt.artifacts.items, a)
+	}
+	return nil
+}
+
+// TakeArtifacts returns the artifacts added since the last call and clears
+// them. Hosts call it before a run to drop leftovers and after it to collect
+// what the run produced.
+func (rt *Runtime) TakeArtifacts() []Artifact {
+	rt.artifacts.mu.Lock()
+	defer rt.artifacts.mu.Unlock()
+	items := rt.artifacts.items
+	rt.artifacts.items = nil
+	rt.artifacts.total = 0
+	return items
+}
+
+// SetResultType declares the kind of the current run's result.
+func (rt *Runtime) SetResultType(t ResultType) {
+	rt.artifacts.mu.Lock()
+	defer rt.artifacts.mu.Unlock()
+	rt.artifacts.resultType = &t
+}
+
+// TakeResultType returns the result type declared since the last call, or
+// nil, and clears it. Hosts call it like TakeArtifacts.
+func (rt *Runtime) TakeResultType() *ResultType {
+	rt.artifacts.mu.Lock()
+	defer rt.artifacts.mu.Unlock()
+	t := rt.artifacts.resultType
+	rt.artifacts.resultType = nil
+	return t
+}
+
+// artifactCount returns the number of artifacts pending on rt.
+func (rt *Runtime) artifactCount() int {
+	rt.artifacts.mu.Lock()
+	defer rt.artifacts.mu.Unlock()
+	return len(rt.artifacts.items)
+}
@@ -89,6 +89,9 @@ func (a *ArrayLiteralNode) ToString() string {
 // FunctionDefNode represents a function definition
 type FunctionDefNode struct {
 	Parameters []string
+	ParamTypes []string // Type code annotated on each parameter, "" for none; nil when none is annotated
+	ReturnType string   // Type code annotated on the result, "" for none
+	Doc        string   // Doc comment (/// lines) written before the function
 	Body       Node
 	Source     string
 	Position   int // Source position for error reporting (deprecated, use Pos)
@@ -103,6 +106,9 @@ func (f *FunctionDefNode) Exec(rt *Runtime) (Value, error) {
 	return &FunctionValue{
 		Body:       f.Body,
 		Parameters: f.Parameters,
+		ParamTypes: f.ParamTypes,
+		ReturnType: f.ReturnType,
+		Doc:        f.Doc,
 		SourceCode: f.Source,
 		IsParsed:   true,            // Already parsed
 		Scope:      rt.currentScope, // Capture closure
@@ -110,26 +116,51 @@ func (f *FunctionDefNode) Exec(rt *Runtime) (Value, error) {
 }
 
 func (f *FunctionDefNode) ToMap() map[string]interface{} {
-	return map[string]interface{}{
+	m := map[string]interface{}{
 		"_node_type": "FunctionDefNode",
 		"parameters": f.Parameters,
 		"body":       f.Body.ToMap(),
 		"source":     f.Source,
 		"position":   f.Position,
 	}
+	if f.ParamTypes != nil {
+		m["param_types"] = f.ParamTypes
+	}
+	if f.ReturnType != "" {
+		m["return_type"] = f.ReturnType
+	}
+	if f.Doc != "" {
+		m["doc"] = f.Doc
+	}
+	return m
+}
+
+// Signature returns the function's parameter list as written, with its
+// type annotations: func(x: N, y): S
+func (f *FunctionDefNode) Signature() string {
+	return formatSignature(f.Parameters, f.ParamTypes, f.ReturnType)
+}
+
+func formatSignature(params, paramTypes []string, returnType string) string {
+	parts := make([]string, len(params))
+	for i, name := range params {
+		parts[i] = name
+		if i < len(paramTypes) && paramTypes[i] != "" {
+			parts[i] += ": " + paramTypes[i]
+		}
+	}
+	sig := "func(" + strings.Join(parts, ", ") + ")"
+	if returnType != "" {
+		sig += ": " + returnType
+	}
+	return sig
 }
 
 // ToString returns the function definition as a string.
 func (f *FunctionDefNode) ToString() string {
 	var sb strings.Builder
-	sb.WriteString("function(")
-	for i, param := range f.Parameters {
-		sb.WriteString(param)
-		if i < len(f.Parameters)-1 {
-			sb.WriteString(", ")
-		}
-	}
-	sb.WriteString(") {\n")
+	sb.WriteString(strings.Replace(f.Signature(), "func", "function", 1))
+	sb.WriteString(" {\n")
 	if bodyStr := f.Body.ToString(); bodyStr == "" {
 		return ""
 	} else {
@@ -824,6 +855,15 @@ func (b *Block) Exec(rt *Runtime) (Value, error) {
 			}
 		}
 
+		if err := rt.interrupted(); err != nil {
+			return nil, err
+		}
+		if err := rt.deadlineCheck(); err != nil {
+			return nil, err
+		}
+		if pos := stmt.GetPos(); pos.Line > 0 {
+			rt.callSite = pos
+		}
 		v, err := stmt.Exec(rt)
 		if err != nil {
 			return nil, err
@@ -871,6 +911,9 @@ func (f *FuncCall) SetPos(pos SourcePos) { f.Pos = pos }
 
 // Exec handles built-ins, control-flow functions, and host binding calls.
 func (f *FuncCall) Exec(rt *Runtime) (Value, error) {
+	if f.Pos.Line > 0 {
+		rt.callSite = f.Pos
+	}
 	// Special handling for declare and declareGlobal - don't evaluate first arg
 	if f.Name == "declare" || f.Name == "declareGlobal" || f.Name == "setq" {
 		if len(f.Args) < 2 {
@@ -947,6 +990,26 @@ func (f *FuncCall) Exec(rt *Runtime) (Value, error) {
 		return last, nil
 	}
 
+	// UDF calls that don't shadow a builtin evaluate into a pooled argument slice
+	if _, isBuiltin := rt.funcs[f.Name]; !isBuiltin {
+		if fn, ok := rt.functions[f.Name]; ok && !strings.Contains(f.Name, ".") {
+			argsPtr := getArgSlice(len(f.Args))
+			defer putArgSlice(argsPtr)
+			args := *argsPtr
+			for i, arg := range f.Args {
+				v, err := arg.Exec(rt)
+				if err != nil {
+					return nil, err
+				}
+				args[i] = v
+			}
+			if f.Pos.Line > 0 {
+				rt.callSite = f.Pos
+			}
+			return executeFunctionValue(rt, fn, args)
+		}
+	}
+
 	// Evaluate all arguments for other calls
 	vals := make([]Value, len(f.Args))
 	for i, arg := range f.Args {
@@ -956,6 +1019,9 @@ func (f *FuncCall) Exec(rt *Runtime) (Value, error) {
 		}
 		vals[i] = v
 	}
+	if f.Pos.Line > 0 {
+		rt.callSite = f.Pos // argument evaluation may have moved it
+	}
 
 	// Host object method: obj.Method()
 	if parts := strings.SplitN(f.Name, ".", 2); len(parts) == 2 {
@@ -966,11 +1032,11 @@ func (f *FuncCall) Exec(rt *Runtime) (Value, error) {
 
 	// Built-in function dispatch
 	if h, ok := rt.funcs[f.Name]; ok {
-		return h(vals...)
+		return rt.callBuiltin(f.Name, h, vals)
 	}
 	// UDF function call
 	if fn, ok := rt.functions[f.Name]; ok {
-		return rt.funcs["call"](fn, vals)
+		return executeFunctionValue(rt, fn, vals)
 	}
 	return nil, fmt.Errorf("undefined function '%s'", f.Name)
 }
@@ -77,9 +77,13 @@ func NodeFromMap(m map[string]interface{}) (Node, error) {
 		name, _ := m["name"].(string)
 		return &VarRef{Name: name}, nil
 	case "Literal":
-		val := m["val"]
-		// You may need to convert val to the correct Value type
-		return &Literal{Val: Value(val)}, nil
+		// Values decoded from JSON arrive as float64, string and so on
+		switch val := m["val"].(type) {
+		case float64, string, bool, nil:
+			return &Literal{Val: convertFromNativeValue(val)}, nil
+		default:
+			return &Literal{Val: val}, nil
+		}
 	case "FunctionDefNode":
 		// Reconstruct parameters
 		var params []string
@@ -99,10 +103,16 @@ func NodeFromMap(m map[string]interface{}) (Node, error) {
 		if err != nil {
 			return nil, err
 		}
-		return &FunctionDefNode{
-			Parameters: params,
-			Body:       body,
-		}, nil
+		fn := &FunctionDefNode{Parameters: params, Body: body}
+		if arr, ok := m["param_types"].([]interface{}); ok {
+			for _, t := range arr {
+				ts, _ := t.(string)
+				fn.ParamTypes = append(fn.ParamTypes, ts)
+			}
+		}
+		fn.ReturnType, _ = m["return_type"].(string)
+		fn.Doc, _ = m["doc"].(string)
+		return fn, nil
 	default:
 		return nil, fmt.Errorf("unknown node type: %s", nodeType)
 	}
@@ -0,0 +1,638 @@
+package chariot
+
+import (
+	"sort"
+	"strings"
+)
+
+// Builtin metadata: the category, call signature, one-line summary and an
+// example of each builtin, for the editor's highlighting and completion and
+// for the function reference. A builtin added to a Register function gets an
+// entry in builtinMetaTable; plugin functions are described by their
+// manifests.
+
+// BuiltinInfo describes a builtin.
+type BuiltinInfo struct {
+	Name      string `json:"name"`
+	Category  string `json:"category"`
+	Signature string `json:"signature"`       // Call with parameter names; [optional], more...
+	Types     string `json:"types,omitempty"` // Argument and result types the type checker knows, e.g. (N, N) N
+	Summary   string `json:"summary"`
+	Example   string `json:"example,omitempty"`
+}
+
+// builtinMetaTable lists the builtins by category, each as signature,
+// summary and example. The name is the signature up to "(".
+var builtinMetaTable = []struct {
+	category string
+	entries  [][3]string
+}{
+	{"value", [][3]string{
+		{"declare(name, type, [value])", "Declares a local variable with a type code and an optional initial value.", "declare(total, 'N', 0)"},
+		{"declareGlobal(name, type, [value])", "Declares a variable in the global scope, visible to every program in the runtime.", "declareGlobal(region, 'S', 'emea')"},
+		{"setq(name, value, [namespace, key])", "Assigns a value to a variable, declaring it if needed.", "setq(count, add(count, 1))"},
+		{"valueOf(name)", "Returns the value of a variable given its name.", "valueOf('count')"},
+		{"getVariable(name)", "Returns the value of the named variable.", "getVariable('count')"},
+		{"exists(name)", "Reports whether a variable with the name exists.", "exists('count')"},
+		{"destroy(name)", "Removes a variable from the runtime.", "destroy('count')"},
+		{"symbol(name)", "Returns a reference to the variable with the given name.", "symbol('count')"},
+		{"setValue(array, index, value)", "Sets the element at an index of an array.", "setValue(items, 0, 'first')"},
+		{"typeOf(value)", "Returns the one-letter type code of a value.", "typeOf(42)"},
+		{"valueType(value)", "Returns the name of a value's type.", "valueType(items)"},
+		{"isNull(value)", "Reports whether a value is null.", "isNull(result)"},
+		{"isNumeric(value)", "Reports whether a value is a number or a numeric string.", "isNumeric('3.14')"},
+		{"empty(value)", "Reports whether a value is empty: an empty string, array or map, or null.", "empty(items)"},
+		{"boolean(value)", "Converts a value to a boolean.", "boolean('true')"},
+		{"toBool(value)", "Converts a value to a boolean.", "toBool(1)"},
+		{"toNumber(value)", "Converts a value to a number.", "toNumber('42')"},
+		{"toString(value)", "Converts a value to its string form.", "toString(42)"},
+		{"toMapValue(value)", "Converts a map node or JSON object to a map value.", "toMapValue(jsonNode('{\"a\": 1}'))"},
+		{"mapValue(key, value, ...)", "Creates a map from key-value pairs.", "mapValue('name', 'Ada', 'age', 36)"},
+		{"hasMeta(doc, key)", "Reports whether a document carries the metadata key.", "hasMeta(doc, 'owner')"},
+		{"merge(template, map, [profile, offer])", "Fills a template string with the values of a map.", "merge('Hello {{name}}', person)"},
+		{"offerVariable(value, format)", "Formats a value for an offer with a format tag.", "offerVariable(rate, 'pct')"},
+		{"offerVar(value, format)", "Short form of offerVariable.", "offerVar(amount, 'currency')"},
+		{"func(params...) { body }", "Creates a function value; parameters and the result may carry type annotations.", "func(x: N): N { mul(x, 2) }"},
+		{"function(body)", "Creates a function value from a body.", "function(add(1, 2))"},
+		{"call(function, args...)", "Calls a function value with arguments.", "call(double, 21)"},
+		{"registerFunction(name, function, [source])", "Registers a function value under a name, so it can be called like a builtin.", "registerFunction('double', func(x) { mul(x, 2) })"},
+		{"getFunction(name)", "Returns the registered function with the name.", "getFunction('double')"},
+		{"deleteFunction(name)", "Removes a registered function.", "deleteFunction('double')"},
+		{"listFunctions()", "Lists the names of the registered functions.", "listFunctions()"},
+		{"loadFunctions(filename)", "Loads a function library file and registers its functions.", "loadFunctions('stlib.json')"},
+		{"saveFunctions(filename)", "Saves the registered functions to a function library file.", "saveFunctions('mylib.json')"},
+		{"listPlans()", "Lists the plans defined in the runtime.", "listPlans()"},
+		{"inspectRuntime()", "Returns the variables, functions and objects of the runtime.", "inspectRuntime()"},
+		{"runtimeSnapshot(name)", "Saves the state of the runtime under a name.", "runtimeSnapshot('before-import')"},
+		{"runtimeRestore(name)", "Restores the runtime from a snapshot.", "runtimeRestore('before-import')"},
+		{"runtimeSnapshots()", "Lists the saved runtime snapshots.", "runtimeSnapshots()"},
+	}},
+	{"flow", [][3]string{
+		{"break()", "Leaves the innermost loop.", "if(bigger(i, 10)) { break() }"},
+		{"return([value])", "Returns from the current function with a value.", "return(total)"},
+		{"withTimeout(ms, function, [fallback])", "Runs a function, giving up after ms milliseconds with the fallback or an error.", "withTimeout(500, func() { sqlQuery('db', q) }, array())"},
+		{"retry(function, attempts, backoffMs, [retryableErrorCodes])", "Calls a function until it succeeds, waiting longer between attempts.", "retry(func() { sqlQuery('db', q) }, 3, 200, array('1213', 'timeout'))"},
+		{"circuit(name, function, [options])", "Calls a function through a named circuit breaker shared by all scripts.", "circuit('billing-api', func() { mcpCallTool(client, 'charge', args) }, map('threshold', 5, 'resetMs', 30000))"},
+		{"deadlineRemaining()", "Returns the milliseconds left before the nearest deadline, or -1 without one.", "deadlineRemaining()"},
+	}},
+	{"array", [][3]string{
+		{"array(values...)", "Creates an array of the values.", "array(1, 2, 3)"},
+		{"addTo(array, values...)", "Appends values to an array.", "addTo(items, 'd', 'e')"},
+		{"removeAt(array, index)", "Removes the element at an index.", "removeAt(items, 0)"},
+		{"lastIndex(array, value)", "Returns the last index of a value in an array, or -1.", "lastIndex(items, 'b')"},
+		{"range(start, end)", "Creates an array of the numbers from start up to end.", "range(1, 10)"},
+		{"reverse(array)", "Returns the elements in reverse order.", "reverse(items)"},
+		{"slice(array, start, [end])", "Returns the elements from start up to end.", "slice(items, 1, 3)"},
+	}},
+	{"comparison", [][3]string{
+		{"equal(a, b, more...)", "Reports whether the values are equal.", "equal(status, 'open')"},
+		{"equals(a, b, more...)", "Alias of equal.", "equals(a, b)"},
+		{"unequal(a, b, more...)", "Reports whether the values differ.", "unequal(status, 'closed')"},
+		{"bigger(a, b)", "Reports whether a is greater than b.", "bigger(score, 600)"},
+		{"biggerEq(a, b)", "Reports whether a is greater than or equal to b.", "biggerEq(age, 18)"},
+		{"smaller(a, b)", "Reports whether a is less than b.", "smaller(amount, 10000)"},
+		{"smallerEq(a, b)", "Reports whether a is less than or equal to b.", "smallerEq(n, 5)"},
+		{"and(conditions...)", "Reports whether all conditions hold.", "and(bigger(score, 600), smaller(amount, 10000))"},
+		{"or(conditions...)", "Reports whether any condition holds.", "or(equal(tier, 'gold'), bigger(spend, 1000))"},
+		{"not(condition)", "Negates a condition.", "not(isNull(x))"},
+		{"iif(condition, then, else)", "Returns then when the condition holds, else otherwise.", "iif(bigger(x, 0), 'positive', 'not positive')"},
+	}},
+	{"math", [][3]string{
+		{"add(a, b)", "Sum of two numbers.", "add(2, 3)"},
+		{"sub(a, b)", "Difference of two numbers.", "sub(10, 4)"},
+		{"mul(a, b)", "Product of two numbers.", "mul(price, qty)"},
+		{"div(a, b)", "Quotient of two numbers.", "div(total, count)"},
+		{"mod(a, b)", "Remainder of dividing a by b.", "mod(n, 2)"},
+		{"pow(base, exponent)", "Raises a number to a power.", "pow(2, 10)"},
+		{"abs(x)", "Absolute value.", "abs(-4)"},
+		{"floor(x)", "Largest integer not greater than x.", "floor(3.7)"},
+		{"ceiling(x)", "Smallest integer not less than x.", "ceiling(3.2)"},
+		{"ceil(x)", "Alias of ceiling.", "ceil(3.2)"},
+		{"int(x)", "Integer part of a number.", "int(3.9)"},
+		{"round(x, [places])", "Rounds to a number of decimal places.", "round(3.14159, 2)"},
+		{"sqrt(x)", "Square root.", "sqrt(16)"},
+		{"exp(x)", "e raised to x.", "exp(1)"},
+		{"ln(x)", "Natural logarithm.", "ln(10)"},
+		{"log(x)", "Natural logarithm.", "log(10)"},
+		{"log10(x)", "Base-10 logarithm.", "log10(1000)"},
+		{"log2(x)", "Base-2 logarithm.", "log2(8)"},
+		{"sin(x)", "Sine of an angle in radians.", "sin(div(pi(), 2))"},
+		{"cos(x)", "Cosine of an angle in radians.", "cos(0)"},
+		{"tan(x)", "Tangent of an angle in radians.", "tan(0)"},
+		{"pi()", "The constant pi.", "mul(2, pi())"},
+		{"e()", "The constant e.", "e()"},
+		{"min(values...)", "Smallest of the numbers.", "min(3, 1, 2)"},
+		{"max(values...)", "Largest of the numbers.", "max(3, 1, 2)"},
+		{"sum(values...)", "Sum of the numbers, or of an array of numbers.", "sum(1, 2, 3)"},
+		{"avg(values...)", "Average of the numbers, or of an array of numbers.", "avg(scores)"},
+		{"pct(part, whole)", "Percentage part is of whole.", "pct(25, 200)"},
+		{"random([max])", "Random number.", "random(100)"},
+		{"randomSeed(seed)", "Seeds the random number generator.", "randomSeed(42)"},
+		{"randomString(length)", "Random alphanumeric string.", "randomString(12)"},
+		{"pmt(principal, rate, years)", "Periodic payment of a loan.", "pmt(250000, 0.05, 30)"},
+		{"pv(fv, rate, nper)", "Present value of a future amount.", "pv(10000, 0.04, 5)"},
+		{"fv(rate, nper, pmt)", "Future value of periodic payments.", "fv(0.04, 10, 1000)"},
+		{"nper(rate, pmt, pv)", "Number of periods to pay off a loan.", "nper(0.005, 500, 20000)"},
+		{"rate(nper, pmt, pv)", "Interest rate per period of a loan.", "rate(60, 400, 20000)"},
+		{"npv(rate, cashflows...)", "Net present value of cash flows.", "npv(0.08, -1000, 300, 400, 500)"},
+		{"irr(cashflows...)", "Internal rate of return of cash flows.", "irr(-1000, 300, 400, 500)"},
+		{"apr(rate, nper, [fees])", "Annual percentage rate including fees.", "apr(0.05, 360, 2500)"},
+		{"amortize(rate, nper, pv)", "Amortization schedule of a loan.", "amortize(0.005, 360, 250000)"},
+		{"balloon(rate, nper, pv, paid)", "Balloon payment due after the periods paid.", "balloon(0.005, 360, 250000, 60)"},
+		{"loanBalance(rate, nper, pv, paid)", "Balance left on a loan after the periods paid.", "loanBalance(0.005, 360, 250000, 60)"},
+		{"interestOnly(rate, pv)", "Interest-only payment per period.", "interestOnly(0.005, 250000)"},
+		{"interestOnlySchedule(rate, nper, pv)", "Schedule of interest-only payments.", "interestOnlySchedule(0.005, 12, 250000)"},
+		{"depreciation(cost, salvage, life, method)", "Depreciation schedule of an asset.", "depreciation(10000, 1000, 5, 'straight')"},
+	}},
+	{"date", [][3]string{
+		{"now()", "Current date and time.", "now()"},
+		{"today()", "Current date, without the time.", "today()"},
+		{"date(value, [format])", "Creates a date from a string or parts.", "date('2024-03-15')"},
+		{"parseDate(value, [format])", "Parses a date string.", "parseDate('15/03/2024', '02/01/2006')"},
+		{"formatDate(date, [format])", "Formats a date.", "formatDate(now(), '2006-01-02')"},
+		{"isDate(value)", "Reports whether a value is a date.", "isDate(due)"},
+		{"dateAdd(date, interval, value)", "Adds a number of intervals (day, month, year...) to a date.", "dateAdd(today(), 'day', 30)"},
+		{"dateDiff(interval, date1, date2)", "Number of intervals between two dates.", "dateDiff('day', start, end)"},
+		{"dateSchedule(start, n, interval, [options])", "Series of n dates an interval apart.", "dateSchedule(today(), 12, 'month')"},
+		{"year(date)", "Year of a date.", "year(now())"},
+		{"month(date)", "Month of a date.", "month(now())"},
+		{"day(date)", "Day of the month of a date.", "day(now())"},
+		{"dayOfWeek(date)", "Day of the week of a date, 0 for Sunday.", "dayOfWeek(today())"},
+		{"julianDay(date)", "Julian day number of a date.", "julianDay(today())"},
+		{"dayCount(start, end, convention)", "Days between dates under a day-count convention.", "dayCount(start, end, '30/360')"},
+		{"yearFraction(start, end, convention)", "Fraction of a year between dates under a day-count convention.", "yearFraction(start, end, 'ACT/365')"},
+		{"endOfMonth(date)", "Last day of the date's month.", "endOfMonth(today())"},
+		{"isEndOfMonth(date)", "Reports whether a date is the last day of its month.", "isEndOfMonth(today())"},
+		{"isBusinessDay(date, [holidays])", "Reports whether a date is a weekday and not a holiday.", "isBusinessDay(today(), holidays)"},
+		{"nextBusinessDay(date, [holidays])", "Next business day after a date.", "nextBusinessDay(today())"},
+		{"getTimezone()", "Time zone dates are interpreted in.", "getTimezone()"},
+		{"setTimezone(timezone)", "Sets the time zone dates are interpreted in.", "setTimezone('Europe/Paris')"},
+		{"localTime(utc, [format])", "Converts a UTC time to local time.", "localTime(now())"},
+		{"utcTime(local, [format])", "Converts a local time to UTC.", "utcTime(now())"},
+	}},
+	{"string", [][3]string{
+		{"concat(values...)", "Joins the values into one string.", "concat('Hello, ', name)"},
+		{"append(values...)", "Alias of concat.", "append('Result: n=', n)"},
+		{"format(format, values...)", "Formats values with a printf-style format.", "format('%.2f', total)"},
+		{"sprintf(format, values...)", "Alias of format.", "sprintf('%d items', count)"},
+		{"interpolate(template)", "Replaces ${name} in a template with the variable's value.", "interpolate('Hello ${name}')"},
+		{"string(value)", "Converts a value to a string.", "string(42)"},
+		{"strlen(string)", "Length of a string.", "strlen('chariot')"},
+		{"upper(string)", "Converts to upper case.", "upper('abc')"},
+		{"lower(string)", "Converts to lower case.", "lower('ABC')"},
+		{"trim(string, [cutset])", "Removes leading and trailing whitespace or characters.", "trim('  hi  ')"},
+		{"trimLeft(string)", "Removes leading whitespace.", "trimLeft('  hi')"},
+		{"trimRight(string)", "Removes trailing whitespace.", "trimRight('hi  ')"},
+		{"padLeft(string, length, pad)", "Pads on the left to a length.", "padLeft('7', 3, '0')"},
+		{"padRight(string, length, pad)", "Pads on the right to a length.", "padRight('ab', 5, '.')"},
+		{"replace(string, old, new, [count])", "Replaces occurrences of old with new.", "replace(path, '/', '_')"},
+		{"substring(string, start, [length])", "Part of a string.", "substring('chariot', 0, 4)"},
+		{"substr(string, start, [length])", "Alias of substring.", "substr('chariot', 4)"},
+		{"right(string, count)", "Last characters of a string.", "right('invoice-2024', 4)"},
+		{"charAt(string, index)", "Character at an index.", "charAt('abc', 1)"},
+		{"char(string, position)", "Character at a position.", "char('abc', 0)"},
+		{"atPos(string, position)", "Character at a position.", "atPos('abc', 2)"},
+		{"ascii(string)", "Character code of the first character.", "ascii('A')"},
+		{"lastPos(string, substring)", "Index of the last occurrence of a substring, or -1.", "lastPos('a.b.c', '.')"},
+		{"occurs(string, substring)", "Number of occurrences of a substring.", "occurs('banana', 'a')"},
+		{"digits(string)", "The digits in a string.", "digits('(555) 123-4567')"},
+		{"hasPrefix(string, prefix)", "Reports whether a string starts with a prefix.", "hasPrefix(name, 'tmp_')"},
+		{"hasSuffix(string, suffix)", "Reports whether a string ends with a suffix.", "hasSuffix(file, '.csv')"},
+	}},
+	{"collection", [][3]string{
+		{"length(value)", "Length of a string, array, map or node's children.", "length(items)"},
+		{"contains(collection, value)", "Reports whether a string, array or map contains a value.", "contains(tags, 'urgent')"},
+		{"indexOf(collection, value, [start])", "Index of a value in a string or array, or -1.", "indexOf(items, 'b')"},
+		{"getAt(collection, index)", "Element at an index or key.", "getAt(items, 0)"},
+		{"setAt(collection, index, value)", "Sets the element at an index or key.", "setAt(items, 0, 'a')"},
+		{"split(string, delimiter)", "Splits a string into an array.", "split('a,b,c', ',')"},
+		{"join(array, delimiter)", "Joins an array into a string.", "join(items, ', ')"},
+		{"apply(function, collection)", "Calls a function on each element and returns the results.", "apply(func(x) { mul(x, 2) }, numbers)"},
+		{"clone(value)", "Deep copy of a node or collection.", "clone(config)"},
+		{"getProp(object, path)", "Property of an object or node by name or dotted path.", "getProp(order, 'customer.name')"},
+		{"setProp(object, path, value)", "Sets a property by name or dotted path.", "setProp(order, 'status', 'paid')"},
+		{"getAttribute(node, key)", "Attribute of a node.", "getAttribute(node, 'id')"},
+		{"setAttribute(node, key, value)", "Sets an attribute of a node.", "setAttribute(node, 'id', 42)"},
+		{"getAttributes(node)", "All attributes of a node as a map.", "getAttributes(node)"},
+		{"getMeta(object, key)", "Metadata value of an object.", "getMeta(doc, 'owner')"},
+		{"setMeta(object, key, value)", "Sets a metadata value.", "setMeta(doc, 'owner', 'ops')"},
+		{"getAllMeta(node)", "All metadata of a node.", "getAllMeta(doc)"},
+	}},
+	{"node", [][3]string{
+		{"create(name)", "Creates an empty tree node.", "create('customers')"},
+		{"jsonNode([name], [json])", "Creates a JSON node, optionally from a JSON string.", "jsonNode('{\"a\": 1}')"},
+		{"mapNode([name])", "Creates a map node.", "mapNode('settings')"},
+		{"xmlNode(xml)", "Creates a node from an XML string.", "xmlNode('<a><b>1</b></a>')"},
+		{"yamlNode([name])", "Creates a YAML node.", "yamlNode('config')"},
+		{"csvNode(filename, [options])", "Creates a node from a CSV file.", "csvNode('orders.csv')"},
+		{"addChild(parent, child)", "Adds a child node.", "addChild(root, create('item'))"},
+		{"removeChild(parent, child)", "Removes a child node.", "removeChild(root, item)"},
+		{"getChildAt(node, index)", "Child at an index.", "getChildAt(root, 0)"},
+		{"getChildByName(node, name)", "Child with a name.", "getChildByName(root, 'users')"},
+		{"setChildByName(node, name, child)", "Replaces or adds the child with a name.", "setChildByName(root, 'users', users)"},
+		{"getChildren(node)", "Children of a node.", "getChildren(root)"},
+		{"childCount(node)", "Number of children.", "childCount(root)"},
+		{"firstChild(node)", "First child.", "firstChild(root)"},
+		{"lastChild(node)", "Last child.", "lastChild(root)"},
+		{"findByName(node, name)", "Descendant with a name.", "findByName(root, 'address')"},
+		{"getName(node)", "Name of a node.", "getName(node)"},
+		{"setName(node, name)", "Renames a node.", "setName(node, 'archive')"},
+		{"getText(node)", "Text content of a node.", "getText(node)"},
+		{"setText(node, text)", "Sets the text content of a node.", "setText(node, 'hello')"},
+		{"getParent(node)", "Parent of a node.", "getParent(node)"},
+		{"getRoot(node)", "Root of the node's tree.", "getRoot(node)"},
+		{"getSiblings(node)", "Other children of the node's parent.", "getSiblings(node)"},
+		{"getPath(node)", "Path from the root to a node.", "getPath(node)"},
+		{"getDepth(node)", "Depth of the tree below a node.", "getDepth(root)"},
+		{"getLevel(node)", "Distance of a node from the root.", "getLevel(node)"},
+		{"isLeaf(node)", "Reports whether a node has no children.", "isLeaf(node)"},
+		{"isRoot(node)", "Reports whether a node has no parent.", "isRoot(node)"},
+		{"hasAttribute(node, key)", "Reports whether a node has an attribute.", "hasAttribute(node, 'id')"},
+		{"removeAttribute(node, key)", "Removes an attribute.", "removeAttribute(node, 'tmp')"},
+		{"setAttributes(node, map)", "Sets several attributes from a map.", "setAttributes(node, mapValue('a', 1, 'b', 2))"},
+		{"clear(node)", "Removes the children and attributes of a node.", "clear(cache)"},
+		{"list(node)", "Children of a node as an array.", "list(root)"},
+		{"nodeToString(node)", "Readable form of a node and its children.", "nodeToString(root)"},
+		{"nodeDiff(a, b)", "Attributes and children added, removed and changed from one tree to another, by path.", "nodeDiff(oldConfig, newConfig)"},
+		{"nodeMerge(base, ours, theirs, [prefer])", "Three-way merge of two trees changed from a common base, with conflicts marked.", "nodeMerge(base, local, remote)"},
+		{"queryNode(node, predicate|query)", "Descendants for which a function returns true, or which a tree query selects.", "queryNode(root, \"orders[status='open' and total>100]\")"},
+		{"traverseNode(node, function)", "Calls a function on a node and each descendant.", "traverseNode(root, func(n) { logPrint(getName(n)) })"},
+	}},
+	{"file", [][3]string{
+		{"readFile(path)", "Contents of a file.", "readFile('notes.txt')"},
+		{"writeFile(path, content)", "Writes a file.", "writeFile('out.txt', report)"},
+		{"deleteFile(path)", "Deletes a file.", "deleteFile('out.txt')"},
+		{"fileExists(path)", "Reports whether a file exists.", "fileExists('config.json')"},
+		{"getFileSize(path)", "Size of a file in bytes.", "getFileSize('orders.csv')"},
+		{"listFiles([directory])", "Names of the files in the data directory or a subdirectory.", "listFiles('exports')"},
+	}},
+	{"json", [][3]string{
+		{"parseJSON(json, [name])", "Parses a JSON string into a node.", "parseJSON('{\"a\": 1}')"},
+		{"parseJSONValue(json)", "Parses a JSON string into plain values.", "parseJSONValue('[1, 2, 3]')"},
+		{"parseJSONSimple(json)", "Parses a JSON string into plain values.", "parseJSONSimple('{\"a\": 1}')"},
+		{"toJSON(value)", "JSON string of a value.", "toJSON(order)"},
+		{"toSimpleJSON(value)", "JSON string of a value, without type metadata.", "toSimpleJSON(order)"},
+		{"loadJSON(path)", "Loads a JSON file into a node.", "loadJSON('orders.json')"},
+		{"loadJSONRaw(path)", "Contents of a JSON file as a string.", "loadJSONRaw('orders.json')"},
+		{"saveJSON(value, path)", "Saves a value as a JSON file.", "saveJSON(order, 'order.json')"},
+		{"saveJSONRaw(json, path)", "Saves a JSON string to a file.", "saveJSONRaw('{}', 'empty.json')"},
+		{"parseJSONStream(path, pathFilter, function)", "Calls a function with each value of a JSON file a path selects, without loading the file.", "parseJSONStream('orders.json', 'orders.*', func(o) { logPrint(o) })"},
+	}},
+	{"yaml", [][3]string{
+		{"loadYAML(path)", "Loads a YAML file into a node.", "loadYAML('config.yaml')"},
+		{"loadYAMLRaw(path)", "Contents of a YAML file as a string.", "loadYAMLRaw('config.yaml')"},
+		{"loadYAMLMultiDoc(path)", "Loads the documents of a multi-document YAML file.", "loadYAMLMultiDoc('manifests.yaml')"},
+		{"saveYAML(node, path)", "Saves a node as a YAML file.", "saveYAML(config, 'config.yaml')"},
+		{"saveYAMLRaw(yaml, path)", "Saves a YAML string to a file.", "saveYAMLRaw(text, 'config.yaml')"},
+		{"saveYAMLMultiDoc(array, path)", "Saves nodes as a multi-document YAML file.", "saveYAMLMultiDoc(docs, 'all.yaml')"},
+		{"yamlRegisterTag(tag, decodeFn[, encodeFn])", "Registers functions converting the values of a custom YAML tag.", "yamlRegisterTag('!env', func(name) { getEnv(name) })"},
+		{"yamlValidate(value, schema)", "Validates a node or YAML string against a JSON Schema subset.", "yamlValidate(config, loadYAML('config.schema.yaml'))"},
+		{"jsonToYAML(node)", "YAML string of a JSON node.", "jsonToYAML(config)"},
+		{"jsonToYAMLNode(node)", "Converts a JSON node to a YAML node.", "jsonToYAMLNode(config)"},
+		{"yamlToJSON(yaml)", "JSON string of a YAML string.", "yamlToJSON(text)"},
+		{"yamlToJSONNode(node)", "Converts a YAML node to a JSON node.", "yamlToJSONNode(config)"},
+		{"convertJSONFileToYAML(input, output)", "Converts a JSON file to YAML.", "convertJSONFileToYAML('a.json', 'a.yaml')"},
+		{"convertYAMLFileToJSON(input, output)", "Converts a YAML file to JSON.", "convertYAMLFileToJSON('a.yaml', 'a.json')"},
+	}},
+	{"xml", [][3]string{
+		{"loadXML(path)", "Loads an XML file into a node.", "loadXML('feed.xml')"},
+		{"loadXMLRaw(path)", "Contents of an XML file as a string.", "loadXMLRaw('feed.xml')"},
+		{"parseXMLString(xml)", "Parses an XML string into a node.", "parseXMLString('<a>1</a>')"},
+		{"parseXMLStream(path, pathFilter, function)", "Calls a function with each element of an XML file a path selects, without loading the file.", "parseXMLStream('catalog.xml', 'catalog/book', func(b) { logPrint(b) })"},
+		{"saveXML(node, path, [root])", "Saves a node as an XML file.", "saveXML(feed, 'feed.xml')"},
+		{"saveXMLRaw(xml, path)", "Saves an XML string to a file.", "saveXMLRaw(text, 'feed.xml')"},
+	}},
+	{"csv", [][3]string{
+		{"loadCSV(path, [hasHeaders], [options])", "Loads a CSV file into a node.", "loadCSV('orders.csv', true)"},
+		{"loadCSVRaw(path)", "Contents of a CSV file as a string.", "loadCSVRaw('orders.csv')"},
+		{"saveCSV(nodeOrView, path, [includeHeaders])", "Saves a node or CSV view as a CSV file.", "saveCSV(orders, 'out.csv', true)"},
+		{"saveCSVRaw(csv, path)", "Saves a CSV string to a file.", "saveCSVRaw(text, 'out.csv')"},
+		{"csvLoad(node, path, [options])", "Loads a CSV file into a CSV node.", "csvLoad(orders, 'orders.csv', map('delimiter', ';'))"},
+		{"csvHeaders(nodeOrPath)", "Column headers of a CSV.", "csvHeaders('orders.csv')"},
+		{"csvRowCount(nodeOrPath)", "Number of rows.", "csvRowCount(orders)"},
+		{"csvColumnCount(nodeOrPath)", "Number of columns.", "csvColumnCount(orders)"},
+		{"csvGetRow(nodeOrPath, index)", "Row at an index.", "csvGetRow(orders, 0)"},
+		{"csvGetRows(nodeOrPath)", "All rows.", "csvGetRows(orders)"},
+		{"csvGetCell(nodeOrPath, row, column)", "Cell at a row and a column index or name.", "csvGetCell(orders, 0, 'total')"},
+		{"csvToCSV(nodeOrPath)", "CSV text of a CSV node.", "csvToCSV(orders)"},
+		{"csvOpen(path, [options])", "Opens a CSV file as a view read lazily, a row at a time.", "csvOpen('orders.csv', map('encoding', 'latin-1'))"},
+		{"csvSelect(source, columns)", "View of some columns of a CSV view, file or rows.", "csvSelect(orders, array('id', 'total'))"},
+		{"csvFilter(source, function)", "View of the rows a function returns true for.", "csvFilter(orders, func(row) { bigger(getProp(row, 'total'), 100) })"},
+		{"csvJoin(left, right, on, [options])", "View joining two CSV views on a key column.", "csvJoin(orders, 'customers.csv', array('customer', 'id'))"},
+		{"csvRows(view, [limit])", "Reads the rows of a CSV view into a node.", "csvRows(orders, 10)"},
+	}},
+	{"table", [][3]string{
+		{"tableFromCSV(source, [options])", "Reads a CSV file, view or rows into a columnar table.", "tableFromCSV('orders.csv', map('delimiter', ';'))"},
+		{"tableToCSV(table, path, [includeHeaders])", "Writes a table to a CSV file.", "tableToCSV(report, 'report.csv')"},
+		{"tableFromJSON(source)", "Makes a table of a JSON node, array or string of row objects.", "tableFromJSON(parseJSON(body))"},
+		{"tableToJSON(table)", "Converts a table to a node of row objects.", "tableToJSON(report)"},
+		{"tableFromSQL(nodeName, query, [params...])", "Runs a query into a table, streaming its rows.", "tableFromSQL('db', 'SELECT * FROM orders WHERE year = ?', 2024)"},
+		{"tableToSQL(table, nodeName, tableName)", "Inserts the rows of a table into a SQL table.", "tableToSQL(report, 'db', 'sales_report')"},
+		{"tableFromArrow(path)", "Reads an Arrow IPC file or stream, such as pyarrow and Spark write, into a table.", "tableFromArrow('features.arrow')"},
+		{"tableToArrow(table, path, [options])", "Writes a table as an Arrow IPC file, or a stream for .arrows paths.", "tableToArrow(report, 'report.arrow', map('batchSize', 10000))"},
+		{"sqlToArrow(nodeName, query, path, [params...])", "Writes the result of a query as Arrow IPC.", "sqlToArrow('db', 'SELECT * FROM orders', 'orders.arrow')"},
+		{"tableFilter(table, function | column, operator, value)", "Table of the rows a function or a column comparison selects.", "tableFilter(orders, 'total', '>', 1000)"},
+		{"tableSelect(table, columns)", "Table of some columns of a table.", "tableSelect(orders, array('id', 'total'))"},
+		{"tableGroupBy(table, keys, aggregations)", "Groups rows by key columns and aggregates each group.", "tableGroupBy(orders, 'region', map('revenue', 'sum(total)', 'orders', 'count()'))"},
+		{"tableJoin(left, right, on, [options])", "Joins two tables on a key column.", "tableJoin(orders, customers, array('customer', 'id'), map('type', 'left'))"},
+		{"tableSort(table, columns)", "Sorts a table by columns; a '-' prefix sorts descending.", "tableSort(orders, array('region', '-total'))"},
+		{"tableColumns(table)", "Names of the columns of a table.", "tableColumns(orders)"},
+		{"tableRowCount(table)", "Number of rows of a table.", "tableRowCount(orders)"},
+		{"tableRow(table, index)", "Row of a table as a map.", "tableRow(orders, 0)"},
+	}},
+	{"system", [][3]string{
+		{"logPrint(message, [level], [fields...])", "Writes a message to the execution log.", "logPrint('import done', 'info')"},
+		{"logPrintf(level, format, [args...])", "Writes a formatted message to the execution log at a level.", "logPrintf('warn', '%v rows skipped', skipped)"},
+		{"logDebugf(format, [args...])", "Writes a formatted debug message to the execution log.", "logDebugf('row %v', row)"},
+		{"logInfof(format, [args...])", "Writes a formatted info message to the execution log.", "logInfof('loaded %v orders', length(orders))"},
+		{"logWarnf(format, [args...])", "Writes a formatted warning to the execution log.", "logWarnf('%s has no total', id)"},
+		{"logErrorf(format, [args...])", "Writes a formatted error to the execution log.", "logErrorf('import failed: %s', reason)"},
+		{"getEnv(name)", "Value of an environment variable.", "getEnv('REGION')"},
+		{"hasEnv(name)", "Reports whether an environment variable is set.", "hasEnv('REGION')"},
+		{"platform()", "Operating system and architecture of the server.", "platform()"},
+		{"sleep(milliseconds)", "Pauses the program.", "sleep(500)"},
+		{"timestamp()", "Current Unix time.", "timestamp()"},
+		{"timeFormat(timestamp, format)", "Formats a Unix time.", "timeFormat(timestamp(), '2006-01-02 15:04')"},
+		{"listen(port, [onStart], [onExit])", "Runs the program as a listener on a port.", "listen(8090, 'onStart', 'onExit')"},
+		{"exit([code])", "Ends the program.", "exit(0)"},
+	}},
+	{"host", [][3]string{
+		{"hostObject(name, [object])", "Binds or returns a host object.", "hostObject('db')"},
+		{"getHostObject(name)", "Host object bound under a name.", "getHostObject('db')"},
+		{"createHostObject(name)", "Creates an empty host object.", "createHostObject('cache')"},
+		{"callMethod(object, method, args...)", "Calls a method of a host object.", "callMethod(db, 'Ping')"},
+		{"callHostMethod(object, method, args...)", "Calls a method of a host object.", "callHostMethod(db, 'Query', sql)"},
+		{"getHostProperty(object, property)", "Property of a host object.", "getHostProperty(db, 'Name')"},
+		{"setHostProperty(object, property, value)", "Sets a property of a host object.", "setHostProperty(db, 'Timeout', 30)"},
+	}},
+	{"sql", [][3]string{
+		{"sqlConnect(node, driver, connection, [options...])", "Opens a SQL connection under a node name.", "sqlConnect('db', 'postgres', dsn)"},
+		{"sqlQuery(node, query, [params...])", "Runs a query and returns the rows.", "sqlQuery('db', 'SELECT * FROM orders WHERE id = $1', id)"},
+		{"sqlExecute(node, statement, [params...])", "Runs a statement and returns the rows affected.", "sqlExecute('db', 'DELETE FROM tmp')"},
+		{"sqlBegin(node)", "Starts a transaction.", "sqlBegin('db')"},
+		{"sqlCommit(node)", "Commits the transaction.", "sqlCommit('db')"},
+		{"sqlRollback(node)", "Rolls back the transaction.", "sqlRollback('db')"},
+		{"sqlListTables(node)", "Names of the tables.", "sqlListTables('db')"},
+		{"sqlClose(node)", "Closes the connection.", "sqlClose('db')"},
+	}},
+	{"couchbase", [][3]string{
+		{"cbConnect(node, connection, username, password)", "Connects to a Couchbase cluster under a node name.", "cbConnect('cb', 'couchbase://localhost', user, pass)"},
+		{"cbOpenBucket(node, bucket)", "Opens a bucket.", "cbOpenBucket('cb', 'orders')"},
+		{"cbSetScope(node, scope, collection)", "Selects the scope and collection.", "cbSetScope('cb', 'sales', 'orders')"},
+		{"cbGet(node, id)", "Document with an ID.", "cbGet('cb', 'order::1')"},
+		{"cbInsert(node, id, document, [expiry])", "Inserts a document.", "cbInsert('cb', newID('order'), order)"},
+		{"cbUpsert(node, id, document, [expiry])", "Inserts or replaces a document.", "cbUpsert('cb', 'order::1', order)"},
+		{"cbReplace(node, id, document, [cas], [expiry])", "Replaces a document.", "cbReplace('cb', 'order::1', order)"},
+		{"cbRemove(node, id)", "Removes a document.", "cbRemove('cb', 'order::1')"},
+		{"cbQuery(node, query, [params...])", "Runs a N1QL query.", "cbQuery('cb', 'SELECT * FROM orders LIMIT 10')"},
+		{"cbClose(node)", "Closes the connection.", "cbClose('cb')"},
+		{"newID([prefix], [format], [length])", "New unique document ID.", "newID('order')"},
+	}},
+	{"etl", [][3]string{
+		{"createTransform(name)", "Creates an ETL transform.", "createTransform('orders')"},
+		{"registerTransform(name, config)", "Registers a transform under a name.", "registerTransform('orders', t)"},
+		{"getTransform(name)", "Registered transform with a name.", "getTransform('orders')"},
+		{"listTransforms()", "Names of the registered transforms.", "listTransforms()"},
+		{"addMapping(transform, source, target, program, type, required)", "Adds a field mapping with a program.", "addMapping(t, 'amt', 'amount', 'toNumber(value)', 'N', true)"},
+		{"addMappingWithTransform(transform, source, target, transformName, type, required)", "Adds a field mapping using a named transform.", "addMappingWithTransform(t, 'name', 'name', 'trim', 'S', true)"},
+		{"addMappingDirect(mappings, source, target, transform)", "Adds a mapping to a mapping array.", "addMappingDirect(m, 'a', 'b', 'upper')"},
+		{"createFieldMapping()", "Creates an empty mapping array.", "createFieldMapping()"},
+		{"getMappings(transform)", "Mappings of a transform.", "getMappings(t)"},
+		{"getMappingCount(mappings)", "Number of mappings.", "getMappingCount(m)"},
+		{"getMappingSource(mappings, index)", "Source field of a mapping.", "getMappingSource(m, 0)"},
+		{"getMappingTarget(mappings, index)", "Target column of a mapping.", "getMappingTarget(m, 0)"},
+		{"getMappingTransform(mappings, index)", "Transform of a mapping.", "getMappingTransform(m, 0)"},
+		{"doETL(jobId, csvFile, transform, target)", "Runs an ETL job from a CSV file into a target.", "doETL('job1', 'orders.csv', t, target)"},
+		{"etlStatus(jobId)", "Status of an ETL job.", "etlStatus('job1')"},
+		{"extractCSV(csvFile, [hasHeaders])", "Rows of a CSV file.", "extractCSV('orders.csv', true)"},
+		{"generateHeaders(csvFile)", "Column headers of a CSV file.", "generateHeaders('orders.csv')"},
+		{"generateCreateTable(csvFile, table, [options])", "CREATE TABLE statement fitting a CSV file.", "generateCreateTable('orders.csv', 'orders')"},
+		{"map(key, value, ...)", "Creates a map from key-value pairs.", "map('name', 'Ada')"},
+		{"transform(data, function)", "Applies a function to each row.", "transform(rows, func(r) { r })"},
+	}},
+	{"tree", [][3]string{
+		{"newTree([name])", "Creates an empty tree.", "newTree('catalog')"},
+		{"treeNode([name])", "Creates a tree node.", "treeNode('item')"},
+		{"treeSave(node, filename, [format], [compression])", "Saves a tree to a file.", "treeSave(catalog, 'catalog.json')"},
+		{"treeLoad(filename)", "Loads a tree from a file.", "treeLoad('catalog.json')"},
+		{"treeSaveSecure(node, filename, encryptionKey, signingKey, watermark, [options])", "Saves a tree encrypted and signed.", "treeSaveSecure(catalog, 'catalog.sec', 'enc', 'sig', 'wm')"},
+		{"treeLoadSecure(filename, decryptionKey, verificationKey)", "Loads an encrypted, signed tree.", "treeLoadSecure('catalog.sec', 'enc', 'sig')"},
+		{"treeValidateSecure(filename, verificationKey)", "Checks the signature of a secure tree file.", "treeValidateSecure('catalog.sec', 'sig')"},
+		{"treeGetMetadata(filename)", "Metadata of a saved tree.", "treeGetMetadata('catalog.json')"},
+		{"treeIndex(node, [attribute...])", "Indexes a tree by node name and attribute values for queryNode.", "treeIndex(catalog, 'status', 'total')"},
+		{"treeDropIndex(node)", "Removes the index of a tree.", "treeDropIndex(catalog)"},
+		{"treeOpenLazy(filename, [options])", "Opens a JSON or XML file as a tree whose nodes are read as they are reached.", "treeOpenLazy('orders.xml', map('cacheSize', 5000))"},
+		{"treeOpenLazyCouchbase(node, documentId, [options])", "Opens a tree kept as one Couchbase document per node.", "treeOpenLazyCouchbase('cb', 'catalog::root')"},
+		{"treeLazyStats(node)", "How many nodes of a lazy tree are read and held.", "treeLazyStats(orders)"},
+		{"treeReencrypt(filename, [newKey])", "Encrypts a secure tree again with the current version of its key, or another key.", "treeReencrypt('catalog.sec', 'trees-2025')"},
+		{"treeFind([forest], attribute, value, [operator])", "Nodes whose attribute matches a value.", "treeFind('status', 'active')"},
+		{"treeSearch(node, attribute, value, [operator], [existsOnly])", "Descendants whose attribute matches a value.", "treeSearch(catalog, 'price', 100, '>')"},
+		{"treeWalk(node, function)", "Calls a function on each node of a tree.", "treeWalk(catalog, func(n) { logPrint(getName(n)) })"},
+		{"treeToXML(node, [pretty])", "XML string of a tree.", "treeToXML(catalog, true)"},
+		{"treeToYAML(node)", "YAML string of a tree.", "treeToYAML(catalog)"},
+	}},
+	{"crypto", [][3]string{
+		{"encrypt(keyId, data)", "Encrypts data with a stored key.", "encrypt('data-key', secret)"},
+		{"decrypt(keyId, data)", "Decrypts data with a stored key.", "decrypt('data-key', cipher)"},
+		{"encryptDirect(key, data)", "Encrypts data with a key given as a value.", "encryptDirect(key, secret)"},
+		{"decryptDirect(key, data)", "Decrypts data with a key given as a value.", "decryptDirect(key, cipher)"},
+		{"sign(keyId, data)", "Signs data with a stored key.", "sign('signing-key', payload)"},
+		{"verify(keyId, data, signature)", "Verifies a signature.", "verify('signing-key', payload, sig)"},
+		{"hash256(data)", "SHA-256 hash, hex encoded.", "hash256('hello')"},
+		{"hash512(data)", "SHA-512 hash, hex encoded.", "hash512('hello')"},
+		{"generateKey(size)", "Random symmetric key.", "generateKey(32)"},
+		{"generateRSAKey(bits)", "New RSA key pair.", "generateRSAKey(2048)"},
+		{"randomBytes(size)", "Random bytes, base64 encoded.", "randomBytes(16)"},
+	}},
+	{"jwt", [][3]string{
+		{"jwtSign(claims, key, [options])", "Signs a JWT with a key.", "jwtSign(mapValue('sub', 'ada'), secret)"},
+		{"jwtVerify(token, key, [options])", "Verifies a JWT and returns its claims.", "jwtVerify(token, secret)"},
+		{"jwtSignWithKey(claims, keyName, [options])", "Signs a JWT with a key from the key store.", "jwtSignWithKey(claims, 'api')"},
+		{"jwtVerifyWithKey(token, keyName, [options])", "Verifies a JWT with a key from the key store.", "jwtVerifyWithKey(token, 'api')"},
+		{"hmacSHA256(key, data)", "HMAC-SHA256 of data.", "hmacSHA256(secret, body)"},
+		{"hmacSHA256WithKey(keyName, data)", "HMAC-SHA256 with a key from the key store.", "hmacSHA256WithKey('webhook', body)"},
+		{"generateECKey()", "New EC key pair.", "generateECKey()"},
+		{"publicKeyPEM(pem)", "Public key of a private key PEM.", "publicKeyPEM(privatePem)"},
+		{"keyCreate(name, type)", "Creates a key in the key store.", "keyCreate('api', 'hmac')"},
+		{"keyImport(name, material)", "Imports key material into the key store.", "keyImport('partner', pem)"},
+		{"keyExport(name)", "Public part of a stored key.", "keyExport('api')"},
+		{"keyRotate(name)", "Adds a new version of a stored key.", "keyRotate('api')"},
+		{"keyPrune(name, keep)", "Deletes old versions of a key.", "keyPrune('api', 2)"},
+		{"keyDelete(name)", "Deletes a stored key.", "keyDelete('api')"},
+		{"keyList()", "Stored keys and their versions.", "keyList()"},
+	}},
+	{"certificate", [][3]string{
+		{"parseCertificate(pem)", "Subject, issuer, validity and names of a certificate.", "parseCertificate(pem)"},
+		{"certExpiry(pem)", "Expiry date of a certificate.", "certExpiry(pem)"},
+		{"fetchCertificate(address, [tlsOptions])", "Certificate chain a TLS server presents.", "fetchCertificate('example.com:443')"},
+		{"verifyCertificateChain(pem, [options])", "Verifies a certificate chain.", "verifyCertificateChain(chain)"},
+	}},
+	{"auth", [][3]string{
+		{"findUser(users, userId)", "User with an ID.", "findUser(users, 'ada')"},
+		{"createUser(users, userId, displayName, roles)", "Adds a user.", "createUser(users, 'ada', 'Ada', array('admin'))"},
+		{"updateUser(users, userId, updates)", "Updates a user.", "updateUser(users, 'ada', mapValue('displayName', 'Ada L.'))"},
+		{"deleteUser(users, userId)", "Deletes a user.", "deleteUser(users, 'ada')"},
+		{"authenticateUser(users, userId, password)", "Checks a user's password.", "authenticateUser(users, 'ada', pw)"},
+		{"setUserPassword(users, userId, password)", "Sets a user's password.", "setUserPassword(users, 'ada', pw)"},
+		{"generateToken()", "Random session token.", "generateToken()"},
+		{"validateDisplayName(users, displayName)", "Checks that a display name is valid and free.", "validateDisplayName(users, 'Ada')"},
+	}},
+	{"rbac", [][3]string{
+		{"createRole(roles, name, functions)", "Creates a role allowed to call functions.", "createRole(roles, 'analyst', array('sql*'))"},
+		{"findRole(roles, name)", "Role with a name.", "findRole(roles, 'analyst')"},
+		{"updateRole(roles, name, updates)", "Updates a role.", "updateRole(roles, 'analyst', updates)"},
+		{"deleteRole(roles, name)", "Deletes a role.", "deleteRole(roles, 'analyst')"},
+		{"getUserRoles(user)", "Roles of a user.", "getUserRoles(user)"},
+		{"getFunctionWhitelist(user, roles)", "Functions a user's roles allow.", "getFunctionWhitelist(user, roles)"},
+		{"createRoleBasedRuntime(user, roles)", "Runtime with only the functions a user may call.", "createRoleBasedRuntime(user, roles)"},
+		{"expandFunctionWildcards(patterns)", "Function names matching patterns such as sql*.", "expandFunctionWildcards(array('sql*'))"},
+		{"getAvailableFunctions()", "Names of all builtins.", "getAvailableFunctions()"},
+		{"registerFunctionToMaster(name, function)", "Adds a function to the set roles can allow.", "registerFunctionToMaster('score', scoreFn)"},
+	}},
+	{"registry", [][3]string{
+		{"getFunctionsByCategory(prefix)", "Builtin names starting with a prefix.", "getFunctionsByCategory('sql')"},
+		{"hasFunction(name)", "Reports whether a builtin exists.", "hasFunction('sqlQuery')"},
+		{"getFunctionCount()", "Number of builtins.", "getFunctionCount()"},
+	}},
+	{"mcp", [][3]string{
+		{"mcpConnect(options)", "Connects to an MCP server.", "mcpConnect(mapValue('command', 'mcp-server'))"},
+		{"mcpListTools(client)", "Tools the MCP server offers.", "mcpListTools(client)"},
+		{"mcpCallTool(client, name, [args])", "Calls a tool of the MCP server.", "mcpCallTool(client, 'search', mapValue('q', 'chariot'))"},
+		{"mcpClose(client)", "Closes the MCP connection.", "mcpClose(client)"},
+	}},
+	{"knapsack", [][3]string{
+		{"knapsack(config, [options])", "Solves a knapsack problem given as JSON.", "knapsack(toJSON(problem))"},
+		{"knapsackConfig(items, capacity, weights, values, [constraints])", "Builds a knapsack problem configuration.", "knapsackConfig(items, 50, weights, values)"},
+	}},
+	{"rl", [][3]string{
+		{"rlInit(config)", "Initializes a reinforcement learning scorer.", "rlInit(config)"},
+		{"rlScore(handle, features, actions)", "Scores actions for features.", "rlScore(rl, features, actions)"},
+		{"rlLearn(handle, feedback)", "Updates the scorer from feedback.", "rlLearn(rl, feedback)"},
+		{"rlExplore(handle, scores, epsilon)", "Picks an action, exploring with a probability.", "rlExplore(rl, scores, 0.1)"},
+		{"rlSelectBest(scores, actions)", "Action with the best score.", "rlSelectBest(scores, actions)"},
+		{"rlClose(handle)", "Releases the scorer.", "rlClose(rl)"},
+		{"extractRLFeatures(customer, context)", "Feature vector of a customer in a context.", "extractRLFeatures(customer, ctx)"},
+		{"nbaDecision(customer, offers)", "Next best action for a customer.", "nbaDecision(customer, offers)"},
+	}},
+	{"notify", [][3]string{
+		{"sendEmail(to, subject, body, [options])", "Sends an email.", "sendEmail('ops@example.com', 'Import done', report)"},
+		{"slackPost(channel, message, [options])", "Posts a message to Slack.", "slackPost('#ops', 'Import done')"},
+	}},
+	{"output", [][3]string{
+		{"plot(series, [options])", "Chart of one or more series, shown with the result.", "plot(array(1, 4, 9, 16))"},
+		{"emitArtifact(name, content, [mimeType])", "Attaches a file to the execution.", "emitArtifact('report.csv', csv, 'text/csv')"},
+		{"emit(value)", "Streams a partial result to clients following an async execution.", "emit(map('batch', 3, 'rows', rows))"},
+		{"resultType(kind, [columns | artifact])", "Declares the result as json, table, text or one of the run's artifacts, for clients that negotiate its format.", "resultType('table', array('id', 'name'))"},
+	}},
+	{"test", [][3]string{
+		{"mock(name, function)", "Answers calls of a builtin with a function of their arguments until the calling function returns.", "mock('sqlQuery', func(args) { array(mapValue('id', 1)) })"},
+		{"mockFixture(trace, [builtins])", "Answers database and other external calls from a recorded trace until the calling function returns.", "mockFixture('orders-import', array('sqlQuery'))"},
+		{"mockCalls(name)", "Arguments of the calls the mocks of a builtin answered.", "length(mockCalls('sendEmail'))"},
+		{"unmock([name])", "Removes the mocks the current function set up.", "unmock('sqlQuery')"},
+	}},
+	{"agent", [][3]string{
+		{"plan(name, params, trigger, guard, steps, drop)", "Defines a BDI plan.", "plan('restock', array(), trigger, guard, steps, drop)"},
+		{"planDefine(plan)", "Adds a plan to the shared plan library.", "planDefine(restock)"},
+		{"planLibrary()", "Names of the plans in the shared library.", "planLibrary()"},
+		{"libraryPlan(name)", "Plan from the shared library.", "libraryPlan('restock')"},
+		{"runPlanOnce(plan)", "Runs a plan once.", "runPlanOnce(restock)"},
+		{"runPlanOnceEx(plan, [mode], [vars])", "Runs a plan once in a mode, with variables.", "runPlanOnceEx(restock, 'bdi', vars)"},
+		{"runPlanOnceBDI(plan, [vars])", "Runs a plan once with BDI semantics.", "runPlanOnceBDI(restock)"},
+		{"agentNew([maxConcurrent], [pollSeconds])", "Creates an agent.", "agentNew(1, 3)"},
+		{"agentRegister(agent, plan)", "Adds a plan to an agent.", "agentRegister(a, restock)"},
+		{"agentStart(agent)", "Starts an agent.", "agentStart(a)"},
+		{"agentStop(agent)", "Stops an agent.", "agentStop(a)"},
+		{"agentStartNamed(name)", "Starts a registered agent.", "agentStartNamed('stock')"},
+		{"agentStopNamed(name)", "Stops a registered agent.", "agentStopNamed('stock')"},
+		{"agentList()", "Names of the registered agents.", "agentList()"},
+		{"agentAttach(agent, plan)", "Attaches a library plan to an agent.", "agentAttach('stock', 'restock')"},
+		{"agentDetach(agent, plan)", "Detaches a plan from an agent.", "agentDetach('stock', 'restock')"},
+		{"agentBelief(name, key, value, [options])", "Sets a belief of a named agent.", "agentBelief('stock', 'level', 12)"},
+		{"agentPublish(name, ...)", "Publishes an event to a named agent.", "agentPublish('stock')"},
+		{"agentSubscribe(name, plan, keys)", "Runs a plan when the named agent's beliefs change.", "agentSubscribe('stock', 'restock', array('level'))"},
+		{"agentUnsubscribe(name, plan)", "Removes a belief subscription.", "agentUnsubscribe('stock', 'restock')"},
+		{"agentFollow(agent, peerAgent)", "Follows the events of a local or federated agent.", "agentFollow('stock', 'eu/stock')"},
+		{"agentUnfollow(agent, peerAgent)", "Stops following an agent.", "agentUnfollow('stock', 'eu/stock')"},
+		{"belief(name, key)", "A belief of a named agent.", "belief('stock', 'level')"},
+		{"beliefInfo(name, key)", "A belief with when and by whom it was set.", "beliefInfo('stock', 'level')"},
+	}},
+}
+
+var builtinMeta = func() map[string]BuiltinInfo {
+	m := make(map[string]BuiltinInfo)
+	for _, group := range builtinMetaTable {
+		for _, e := range group.entries {
+			name, _, _ := strings.Cut(e[0], "(")
+			info := BuiltinInfo{Name: name, Category: group.category, Signature: e[0], Summary: e[1], Example: e[2]}
+			if sig, ok := BuiltinSignature(name); ok {
+				info.Types = sig.String()
+			}
+			m[name] = info
+		}
+	}
+	return m
+}()
+
+// BuiltinMetadata returns the description of a builtin.
+func BuiltinMetadata(name string) (BuiltinInfo, bool) {
+	info, ok := builtinMeta[name]
+	return info, ok
+}
+
+// Builtins describes the builtins registered in rt, sorted by category and
+// name. Plugin functions are in the plugin category, described by their
+// manifests; builtins registered outside this package without an entry are in
+// the other category.
+func Builtins(rt *Runtime) []BuiltinInfo {
+	pluginRegistry.RLock()
+	plugins := make(map[string]PluginFunction, len(pluginRegistry.functions))
+	for name, ref := range pluginRegistry.functions {
+		plugins[name] = ref.fn
+	}
+	pluginRegistry.RUnlock()
+
+	out := make([]BuiltinInfo, 0, len(rt.funcs))
+	for name := range rt.funcs {
+		if info, ok := builtinMeta[name]; ok {
+			out = append(out, info)
+		} else if fn, ok := plugins[name]; ok {
+			out = append(out, pluginInfo(fn))
+		} else {
+			out = append(out, BuiltinInfo{Name: name, Category: "other", Signature: name + "(...)"})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Category != out[j].Category {
+			return out[i].Category < out[j].Category
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func pluginInfo(fn PluginFunction) BuiltinInfo {
+	params := make([]string, len(fn.Params))
+	types := make([]string, len(fn.Params))
+	for i, p := range fn.Params {
+		params[i], types[i] = p.Name, p.Type
+		if types[i] == "" {
+			types[i] = TypeVariableExpr
+		}
+		if fn.Variadic && i == len(fn.Params)-1 {
+			params[i] += "..."
+		} else if p.Optional {
+			params[i] = "[" + params[i] + "]"
+		}
+	}
+	info := BuiltinInfo{
+		Name:      fn.Name,
+		Category:  "plugin",
+		Signature: fn.Name + "(" + strings.Join(params, ", ") + ")",
+		Types:     "(" + strings.Join(types, ", ") + ")",
+		Summary:   fn.Description,
+	}
+	if fn.Returns != "" {
+		info.Types += " " + fn.Returns
+	}
+	return info
+}
@@ -0,0 +1,321 @@
+package chariot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultMaxCallDepth bounds nested user-defined function calls when the
+// runtime has no explicit limit configured. It is well below the depth at which
+// the tree-walking interpreter would exhaust the Go stack.
+const DefaultMaxCallDepth = 10000
+
+// maxReportedFrames caps how many frames are rendered in error messages; the
+// innermost and outermost frames are kept and the middle is summarized.
+const maxReportedFrames = 20
+
+// CallFrame is one entry of a Chariot stack trace: a function and the source
+// position executing within it.
+type CallFrame struct {
+	Function  string `json:"function"`
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	TailCalls int    `json:"tailCalls,omitempty"` // calls folded into this frame by tail-call elimination
+	NodeID    string `json:"nodeId,omitempty"`    // diagram node that generated this line, when source-mapped
+	NodeLabel string `json:"nodeLabel,omitempty"`
+}
+
+func (f CallFrame) String() string {
+	var sb strings.Builder
+	sb.WriteString(f.Function)
+	if f.Line > 0 {
+		file := f.File
+		if file == "" {
+			file = "<script>"
+		}
+		fmt.Fprintf(&sb, " (%s:%d:%d)", file, f.Line, f.Column)
+	}
+	if f.TailCalls > 0 {
+		fmt.Fprintf(&sb, " [%d tail calls]", f.TailCalls)
+	}
+	if f.NodeID != "" {
+		fmt.Fprintf(&sb, " <diagram node %s %q>", f.NodeID, f.NodeLabel)
+	}
+	return sb.String()
+}
+
+// CallDepthError is returned when a call would exceed the runtime's maximum
+// call depth. Stack holds the Chariot call stack, innermost frame first.
+type CallDepthError struct {
+	Limit int
+	Stack []CallFrame
+}
+
+func (e *CallDepthError) Error() string {
+	return fmt.Sprintf("maximum call depth of %d exceeded\n%s", e.Limit, FormatCallStack(e.Stack))
+}
+
+// FormatCallStack renders frames (innermost first) as a readable trace.
+func FormatCallStack(frames []CallFrame) string {
+	var sb strings.Builder
+	sb.WriteString("Chariot call stack (most recent call first):")
+	if len(frames) <= maxReportedFrames {
+		for _, f := range frames {
+			sb.WriteString("\n  at ")
+			sb.WriteString(f.String())
+		}
+		return sb.String()
+	}
+	half := maxReportedFrames / 2
+	for _, f := range frames[:half] {
+		sb.WriteString("\n  at ")
+		sb.WriteString(f.String())
+	}
+	fmt.Fprintf(&sb, "\n  ... %d frames omitted ...", len(frames)-2*half)
+	for _, f := range frames[len(frames)-half:] {
+		sb.WriteString("\n  at ")
+		sb.WriteString(f.String())
+	}
+	return sb.String()
+}
+
+// SetMaxCallDepth sets the maximum nesting of user-defined function calls.
+// A value <= 0 restores DefaultMaxCallDepth.
+func (rt *Runtime) SetMaxCallDepth(depth int) {
+	if depth <= 0 {
+		depth = DefaultMaxCallDepth
+	}
+	rt.maxCallDepth = depth
+}
+
+// MaxCallDepth returns the effective call depth limit.
+func (rt *Runtime) MaxCallDepth() int {
+	if rt.maxCallDepth <= 0 {
+		return DefaultMaxCallDepth
+	}
+	return rt.maxCallDepth
+}
+
+// activeCall is an entry on the runtime's internal call stack: the function
+// being executed and the position it was called from.
+type activeCall struct {
+	function  string
+	site      SourcePos
+	tailCalls int
+}
+
+// CallStack returns the active Chariot call stack, innermost frame first. Each
+// frame names a function and the position currently executing within it; the
+// last frame is the top-level script ("<main>").
+func (rt *Runtime) CallStack() []CallFrame {
+	frames := make([]CallFrame, 0, len(rt.callStack)+1)
+	pos := rt.callSite
+	for i := len(rt.callStack) - 1; i >= 0; i-- {
+		call := rt.callStack[i]
+		frames = append(frames, CallFrame{
+			Function:  call.function,
+			File:      pos.File,
+			Line:      pos.Line,
+			Column:    pos.Column,
+			TailCalls: call.tailCalls,
+		})
+		pos = call.site
+	}
+	return append(frames, CallFrame{Function: "<main>", File: pos.File, Line: pos.Line, Column: pos.Column})
+}
+
+// pushCallFrame enters a user-defined function, enforcing the depth limit.
+func (rt *Runtime) pushCallFrame(fn *FunctionValue) error {
+	if len(rt.callStack) >= rt.MaxCallDepth() {
+		return &CallDepthError{Limit: rt.MaxCallDepth(), Stack: rt.CallStack()}
+	}
+	rt.callStack = append(rt.callStack, activeCall{function: functionName(fn), site: rt.callSite})
+	return nil
+}
+
+// replaceCallFrame reuses the innermost frame for a tail call.
+func (rt *Runtime) replaceCallFrame(fn *FunctionValue) {
+	top := &rt.callStack[len(rt.callStack)-1]
+	top.function = functionName(fn)
+	top.tailCalls++
+}
+
+func functionName(fn *FunctionValue) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
+
+// RuntimeError is a script error annotated with the Chariot call stack at the
+// point of failure. Error() returns the original message unchanged.
+type RuntimeError struct {
+	Err   error
+	Stack []CallFrame // innermost frame first
+}
+
+func (e *RuntimeError) Error() string { return e.Err.Error() }
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// withStackTrace attaches the current call stack to err unless it is flow
+// control or already carries a trace.
+func (rt *Runtime) withStackTrace(err error) error {
+	switch err.(type) {
+	case nil, *BreakError, *ContinueError, *ReturnError, *RuntimeError, *CallDepthError:
+		return err
+	}
+	return &RuntimeError{Err: err, Stack: rt.CallStack()}
+}
+
+// StackTrace returns the Chariot call stack recorded on err, if any.
+func StackTrace(err error) []CallFrame {
+	var rtErr *RuntimeError
+	if errors.As(err, &rtErr) {
+		return rtErr.Stack
+	}
+	var depthErr *CallDepthError
+	if errors.As(err, &depthErr) {
+		return depthErr.Stack
+	}
+	return nil
+}
+
+// ErrorInfo is the structured form of a script error returned by the API.
+type ErrorInfo struct {
+	Message string      `json:"message"`
+	File    string      `json:"file,omitempty"`
+	Line    int         `json:"line,omitempty"`
+	Column  int         `json:"column,omitempty"`
+	Stack   []CallFrame `json:"stack,omitempty"`
+
+	// Diagram location, set by ApplySourceMap for code generated from a diagram
+	Diagram   string `json:"diagram,omitempty"`
+	NodeID    string `json:"nodeId,omitempty"`
+	NodeLabel string `json:"nodeLabel,omitempty"`
+}
+
+// DescribeError converts err into an ErrorInfo, locating it at the innermost
+// stack frame when a trace is available, or at the parser position for a
+// syntax error.
+func DescribeError(err error) *ErrorInfo {
+	if err == nil {
+		return nil
+	}
+	info := &ErrorInfo{Message: err.Error(), Stack: StackTrace(err)}
+	var perr *ParseError
+	switch {
+	case len(info.Stack) > 0:
+		info.File = info.Stack[0].File
+		info.Line = info.Stack[0].Line
+		info.Column = info.Stack[0].Column
+	case errors.As(err, &perr):
+		info.File = perr.Pos.File
+		info.Line = perr.Pos.Line
+		info.Column = perr.Pos.Column
+	}
+	return info
+}
+
+// tailCall is a pending call in tail position, executed by the caller's
+// trampoline in executeFunctionValue instead of growing the Go stack.
+type tailCall struct {
+	fn    *FunctionValue
+	args  []Value
+	pos   SourcePos
+	scope *Scope // Of the calling function, the parent of a callee without a closure
+}
+
+// execTail evaluates node in tail position of a function body. Qualifying
+// call shapes are returned as a tailCall rather than executed:
+//
+//	name(args...)           user-defined function that does not shadow a builtin
+//	call(fn, args...)       function value invoked through call()
+//	return(<tail call>)     either of the above wrapped in return()
+//	if (c) { ...; <tail> } else { ...; <tail> }  the last statement of each branch
+//
+// Anything else is executed normally.
+func (rt *Runtime) execTail(node Node) (Value, *tailCall, error) {
+	switch n := node.(type) {
+	case *FuncCall:
+		return rt.execTailCall(n)
+	case *IfNode:
+		return rt.execTailIf(n)
+	}
+	v, err := node.Exec(rt)
+	return v, nil, err
+}
+
+func (rt *Runtime) execTailCall(f *FuncCall) (Value, *tailCall, error) {
+	_, isBuiltin := rt.funcs[f.Name]
+	switch {
+	case f.Name == "return" && isBuiltin && len(f.Args) == 1:
+		return rt.execTail(f.Args[0])
+
+	case f.Name == "call" && isBuiltin && len(f.Args) >= 1:
+		args, err := rt.evalArgs(f.Args)
+		if err != nil {
+			return nil, nil, err
+		}
+		fn, ok := args[0].(*FunctionValue)
+		if !ok {
+			return nil, nil, fmt.Errorf("expected function value, got %T", args[0])
+		}
+		return nil, &tailCall{fn: fn, args: args[1:], pos: f.Pos, scope: rt.currentScope}, nil
+
+	case !isBuiltin && !strings.Contains(f.Name, "."):
+		fn, ok := rt.functions[f.Name]
+		if !ok {
+			break
+		}
+		args, err := rt.evalArgs(f.Args)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, &tailCall{fn: fn, args: args, pos: f.Pos, scope: rt.currentScope}, nil
+	}
+	v, err := f.Exec(rt)
+	return v, nil, err
+}
+
+func (rt *Runtime) execTailIf(n *IfNode) (Value, *tailCall, error) {
+	cond, err := n.Condition.Exec(rt)
+	if err != nil {
+		return nil, nil, err
+	}
+	branch := n.FalseBranch
+	if boolify(cond) {
+		branch = n.TrueBranch
+	} else if len(branch) == 0 {
+		return DBNull, nil, nil
+	}
+	if len(branch) == 0 {
+		return nil, nil, nil
+	}
+
+	prevScope := rt.currentScope
+	rt.currentScope = NewScope(prevScope)
+	defer func() { rt.currentScope = prevScope }()
+
+	for _, stmt := range branch[:len(branch)-1] {
+		if _, err := stmt.Exec(rt); err != nil {
+			return nil, nil, err
+		}
+	}
+	// Arguments of a pending tail call are evaluated here, inside the branch
+	// scope, so restoring the scope afterwards is safe.
+	return rt.execTail(branch[len(branch)-1])
+}
+
+func (rt *Runtime) evalArgs(nodes []Node) ([]Value, error) {
+	vals := make([]Value, len(nodes))
+	for i, arg := range nodes {
+		v, err := arg.Exec(rt)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
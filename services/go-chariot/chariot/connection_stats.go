@@ -0,0 +1,65 @@
+package chariot
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/couchbase/gocb/v2"
+)
+
+// The database connections scripts hold open, for the dashboard. Nodes
+// register their pool or cluster when they connect and remove it when they
+// close.
+var (
+	openConnMu    sync.Mutex
+	openSQL       = map[*sql.DB]string{} // driver by pool
+	openCouchbase = map[*gocb.Cluster]struct{}{}
+)
+
+// ConnectionStats counts the open database connections of this process.
+type ConnectionStats struct {
+	SQLPools    int            `json:"sql_pools"`     // Connected SQL nodes
+	SQLOpen     int            `json:"sql_open"`      // Connections in their pools
+	SQLInUse    int            `json:"sql_in_use"`    // Connections running a statement
+	SQLByDriver map[string]int `json:"sql_by_driver"` // Connections in the pools of each driver
+	Couchbase   int            `json:"couchbase"`     // Connected Couchbase clusters
+}
+
+// OpenConnections reports the database connections scripts hold open.
+func OpenConnections() ConnectionStats {
+	openConnMu.Lock()
+	defer openConnMu.Unlock()
+	stats := ConnectionStats{SQLByDriver: map[string]int{}, Couchbase: len(openCouchbase)}
+	for db, driver := range openSQL {
+		s := db.Stats()
+		stats.SQLPools++
+		stats.SQLOpen += s.OpenConnections
+		stats.SQLInUse += s.InUse
+		stats.SQLByDriver[driver] += s.OpenConnections
+	}
+	return stats
+}
+
+func trackSQL(db *sql.DB, driver string) {
+	openConnMu.Lock()
+	defer openConnMu.Unlock()
+	openSQL[db] = driver
+}
+
+func untrackSQL(db *sql.DB) {
+	openConnMu.Lock()
+	defer openConnMu.Unlock()
+	delete(openSQL, db)
+}
+
+func trackCouchbase(c *gocb.Cluster) {
+	openConnMu.Lock()
+	defer openConnMu.Unlock()
+	openCouchbase[c] = struct{}{}
+}
+
+func untrackCouchbase(c *gocb.Cluster) {
+	openConnMu.Lock()
+	defer openConnMu.Unlock()
+	delete(openCouchbase, c)
+}
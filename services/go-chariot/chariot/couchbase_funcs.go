@@ -6,6 +6,7 @@ import (
 	"time"
 
 	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/couchbase/gocb/v2"
 )
 
 // RegisterCouchbaseFunctions registers all Couchbase-related functions
@@ -135,7 +136,7 @@ func RegisterCouchbaseFunctions(rt *Runtime) {
 			}
 		}
 
-		if err := cbNode.Query(queryStr, params); err != nil {
+		if err := cbNode.QueryContext(rt.Context(), queryStr, params); err != nil {
 			return nil, fmt.Errorf("query failed: %v", err)
 		}
 
@@ -213,7 +214,7 @@ func RegisterCouchbaseFunctions(rt *Runtime) {
 		}
 
 		// Insert document
-		docMeta, err := cbNode.Insert(docId, doc, expiryDuration)
+		docMeta, err := cbNode.InsertContext(rt.Context(), docId, doc, expiryDuration)
 		if err != nil {
 			return nil, fmt.Errorf("failed to insert document: %v", err)
 		}
@@ -301,7 +302,7 @@ func RegisterCouchbaseFunctions(rt *Runtime) {
 		}
 
 		// Upsert document
-		docMeta, err := cbNode.Upsert(docId, doc, expiryDuration)
+		docMeta, err := cbNode.UpsertContext(rt.Context(), docId, doc, expiryDuration)
 		if err != nil {
 			return nil, fmt.Errorf("failed to upsert document: %v", err)
 		}
@@ -340,7 +341,7 @@ func RegisterCouchbaseFunctions(rt *Runtime) {
 			return nil, err
 		}
 
-		docRes, err := cbNode.Collection.Get(docId, nil) // ← Use Collection.Get directly
+		docRes, err := cbNode.Collection.Get(docId, &gocb.GetOptions{Context: rt.Context()}) // ← Use Collection.Get directly
 		if err != nil {
 			return nil, fmt.Errorf("failed to get document: %v", err)
 		}
@@ -385,7 +386,7 @@ func RegisterCouchbaseFunctions(rt *Runtime) {
 			return nil, err
 		}
 
-		if err := cbNode.Remove(docId); err != nil {
+		if err := cbNode.RemoveContext(rt.Context(), docId); err != nil {
 			return nil, fmt.Errorf("failed to remove document: %v", err)
 		}
 
@@ -483,7 +484,7 @@ func RegisterCouchbaseFunctions(rt *Runtime) {
 		}
 
 		// Replace document
-		docMeta, err := cbNode.Replace(docId, doc, cas, expiryDuration)
+		docMeta, err := cbNode.ReplaceContext(rt.Context(), docId, doc, cas, expiryDuration)
 		if err != nil {
 			return nil, fmt.Errorf("failed to replace document: %v", err)
 		}
@@ -125,6 +125,7 @@ func (n *CouchbaseNode) Connect(connStr, username, password string) error {
 
 	n.Cluster = cluster
 	n.connected = true
+	trackCouchbase(cluster)
 	return nil
 }
 
@@ -210,6 +211,11 @@ func (n *CouchbaseNode) SetScope(scopeName, collectionName string) error {
 
 // Query executes a N1QL query
 func (n *CouchbaseNode) Query(query string, params map[string]interface{}) error {
+	return n.QueryContext(context.Background(), query, params)
+}
+
+// QueryContext is Query, giving up when ctx is done
+func (n *CouchbaseNode) QueryContext(ctx context.Context, query string, params map[string]interface{}) error {
 	if !n.connected {
 		return errors.New("not connected to Couchbase")
 	}
@@ -220,6 +226,7 @@ func (n *CouchbaseNode) Query(query string, params map[string]interface{}) error
 	// Create query options
 	opts := &gocb.QueryOptions{
 		NamedParameters: params,
+		Context:         ctx,
 	}
 
 	// Execute query
@@ -320,6 +327,11 @@ func (n *CouchbaseNode) Get(id string) (*JSONNode, error) {
 
 // Insert adds a new document
 func (n *CouchbaseNode) Insert(id string, document interface{}, expiry time.Duration) (*gocb.MutationResult, error) {
+	return n.InsertContext(context.Background(), id, document, expiry)
+}
+
+// InsertContext is Insert, giving up when ctx is done
+func (n *CouchbaseNode) InsertContext(ctx context.Context, id string, document interface{}, expiry time.Duration) (*gocb.MutationResult, error) {
 	if n.Collection == nil {
 		return nil, errors.New("no collection selected")
 	}
@@ -328,7 +340,7 @@ func (n *CouchbaseNode) Insert(id string, document interface{}, expiry time.Dura
 	doc := n.prepareDocument(document)
 
 	// Create insert options with expiry
-	opts := &gocb.InsertOptions{}
+	opts := &gocb.InsertOptions{Context: ctx}
 	if expiry > 0 {
 		opts.Expiry = expiry
 	}
@@ -345,6 +357,11 @@ func (n *CouchbaseNode) Insert(id string, document interface{}, expiry time.Dura
 
 // Upsert creates or updates a document
 func (n *CouchbaseNode) Upsert(id string, document interface{}, expiry time.Duration) (*gocb.MutationResult, error) {
+	return n.UpsertContext(context.Background(), id, document, expiry)
+}
+
+// UpsertContext is Upsert, giving up when ctx is done
+func (n *CouchbaseNode) UpsertContext(ctx context.Context, id string, document interface{}, expiry time.Duration) (*gocb.MutationResult, error) {
 	if n.Collection == nil {
 		return nil, errors.New("no collection selected")
 	}
@@ -353,7 +370,7 @@ func (n *CouchbaseNode) Upsert(id string, document interface{}, expiry time.Dura
 	doc := n.prepareDocument(document)
 
 	// Create upsert options with expiry
-	opts := &gocb.UpsertOptions{}
+	opts := &gocb.UpsertOptions{Context: ctx}
 	if expiry > 0 {
 		opts.Expiry = expiry
 	}
@@ -370,12 +387,17 @@ func (n *CouchbaseNode) Upsert(id string, document interface{}, expiry time.Dura
 
 // Remove deletes a document
 func (n *CouchbaseNode) Remove(id string) error {
+	return n.RemoveContext(context.Background(), id)
+}
+
+// RemoveContext is Remove, giving up when ctx is done
+func (n *CouchbaseNode) RemoveContext(ctx context.Context, id string) error {
 	var err error
 	if n.Collection == nil {
 		return errors.New("no collection selected")
 	}
 	// Remove document
-	_, err = n.Collection.Remove(id, nil)
+	_, err = n.Collection.Remove(id, &gocb.RemoveOptions{Context: ctx})
 	if err != nil {
 		n.LastError = err
 		return err
@@ -386,6 +408,11 @@ func (n *CouchbaseNode) Remove(id string) error {
 
 // Replace updates an existing document
 func (n *CouchbaseNode) Replace(id string, document interface{}, cas string, expiry time.Duration) (*gocb.MutationResult, error) {
+	return n.ReplaceContext(context.Background(), id, document, cas, expiry)
+}
+
+// ReplaceContext is Replace, giving up when ctx is done
+func (n *CouchbaseNode) ReplaceContext(ctx context.Context, id string, document interface{}, cas string, expiry time.Duration) (*gocb.MutationResult, error) {
 	if n.Collection == nil {
 		return nil, errors.New("no collection selected")
 	}
@@ -394,7 +421,7 @@ func (n *CouchbaseNode) Replace(id string, document interface{}, cas string, exp
 	doc := n.prepareDocument(document)
 
 	// Create replace options
-	opts := &gocb.ReplaceOptions{}
+	opts := &gocb.ReplaceOptions{Context: ctx}
 
 	// Set CAS if provided
 	if cas != "" {
@@ -423,6 +450,7 @@ func (n *CouchbaseNode) Replace(id string, document interface{}, cas string, exp
 // Close closes the connection
 func (n *CouchbaseNode) Close() {
 	if n.Cluster != nil {
+		untrackCouchbase(n.Cluster)
 		n.Cluster.Close(nil)
 		n.Cluster = nil
 		n.Bucket = nil
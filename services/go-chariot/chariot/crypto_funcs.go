@@ -12,6 +12,7 @@ import (
 func RegisterCryptoFunctions(rt *Runtime) {
 	crypto := getCryptoManager()
 	crypto.RegisterCryptoFunctions(rt)
+	registerTokenFunctions(rt)
 }
 
 // Chariot function registration
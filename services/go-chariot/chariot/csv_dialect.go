@@ -0,0 +1,591 @@
+package chariot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// A csvDialect describes how a CSV file is written: its delimiter, quote
+// and comment characters, text encoding and header row, and the type of
+// each column. loadCSV, csvLoad and csvOpen take it as options.
+type csvDialect struct {
+	delimiter  rune
+	quote      rune // 0 when fields are never quoted
+	comment    rune // 0 when there are no comment lines
+	encoding   string
+	header     string            // "true", "false" or "auto"
+	infer      bool              // Infer column types from the first rows
+	types      map[string]string // Column name or index -> type
+	sampleSize int               // Rows type inference and header detection look at
+}
+
+// csvColumnTypes are the types a column can be given.
+var csvColumnTypes = map[string]bool{"string": true, "number": true, "bool": true}
+
+func defaultCSVDialect() *csvDialect {
+	return &csvDialect{
+		delimiter:  ',',
+		quote:      '"',
+		encoding:   "auto",
+		header:     "true",
+		infer:      true,
+		types:      map[string]string{},
+		sampleSize: 100,
+	}
+}
+
+// csvDialectChar is the single character a delimiter, quote or comment
+// option names; "\t" and "tab" name a tab, "" and "none" no character.
+func csvDialectChar(name string, v Value) (rune, error) {
+	s, ok := v.(Str)
+	if !ok {
+		return 0, fmt.Errorf("%s option must be a string, got %T", name, v)
+	}
+	switch string(s) {
+	case "", "none":
+		return 0, nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	if utf8.RuneCountInString(string(s)) != 1 {
+		return 0, fmt.Errorf("%s option must be a single character, got '%s'", name, s)
+	}
+	r, _ := utf8.DecodeRuneInString(string(s))
+	return r, nil
+}
+
+// setOption applies one option to d. It returns false for keys that are
+// not dialect options, which the caller may accept for itself.
+func (d *csvDialect) setOption(key string, v Value) (bool, error) {
+	if tvar, ok := v.(ScopeEntry); ok {
+		v = tvar.Value
+	}
+	var err error
+	switch key {
+	case "delimiter":
+		if d.delimiter, err = csvDialectChar(key, v); err == nil && d.delimiter == 0 {
+			err = errors.New("delimiter option cannot be empty")
+		}
+	case "quote":
+		d.quote, err = csvDialectChar(key, v)
+	case "comment":
+		d.comment, err = csvDialectChar(key, v)
+	case "encoding":
+		s, ok := v.(Str)
+		if !ok {
+			return true, fmt.Errorf("encoding option must be a string, got %T", v)
+		}
+		d.encoding = normalizeCSVEncoding(string(s))
+		if d.encoding == "" {
+			err = fmt.Errorf("unsupported encoding '%s', use utf-8, utf-16, utf-16le, utf-16be or latin-1", s)
+		}
+	case "header":
+		switch h := v.(type) {
+		case Bool:
+			d.header = strconv.FormatBool(bool(h))
+		case Str:
+			if h != "auto" {
+				return true, fmt.Errorf("header option must be true, false or 'auto', got '%s'", h)
+			}
+			d.header = "auto"
+		default:
+			return true, fmt.Errorf("header option must be true, false or 'auto', got %T", v)
+		}
+	case "infer":
+		b, ok := v.(Bool)
+		if !ok {
+			return true, fmt.Errorf("infer option must be a boolean, got %T", v)
+		}
+		d.infer = bool(b)
+	case "sampleSize":
+		n, ok := v.(Number)
+		if !ok || n < 1 {
+			return true, fmt.Errorf("sampleSize option must be a positive number, got %v", v)
+		}
+		d.sampleSize = int(n)
+	case "types":
+		m, ok := v.(*MapValue)
+		if !ok {
+			return true, fmt.Errorf("types option must be a map of column to type, got %T", v)
+		}
+		for col, t := range m.Values {
+			if tvar, ok := t.(ScopeEntry); ok {
+				t = tvar.Value
+			}
+			s, ok := t.(Str)
+			if !ok || !csvColumnTypes[string(s)] {
+				return true, fmt.Errorf("type of column '%s' must be 'string', 'number' or 'bool', got %v", col, t)
+			}
+			d.types[col] = string(s)
+		}
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+// csvDialectFromOptions builds a dialect from an options map, passing keys
+// that are not dialect options to other, which may be nil.
+func csvDialectFromOptions(opts *MapValue, other func(key string, v Value) error) (*csvDialect, error) {
+	d := defaultCSVDialect()
+	if opts == nil {
+		return d, nil
+	}
+	for k, v := range opts.Values {
+		ok, err := d.setOption(k, v)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			continue
+		}
+		if other == nil {
+			return nil, fmt.Errorf("unknown CSV option %q", k)
+		}
+		if tvar, isEntry := v.(ScopeEntry); isEntry {
+			v = tvar.Value
+		}
+		if err := other(k, v); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+func normalizeCSVEncoding(name string) string {
+	switch strings.ToLower(strings.ReplaceAll(name, "_", "-")) {
+	case "auto":
+		return "auto"
+	case "utf-8", "utf8":
+		return "utf-8"
+	case "utf-16", "utf16":
+		return "utf-16"
+	case "utf-16le", "utf16le":
+		return "utf-16le"
+	case "utf-16be", "utf16be":
+		return "utf-16be"
+	case "latin-1", "latin1", "iso-8859-1", "iso8859-1":
+		return "latin-1"
+	}
+	return ""
+}
+
+// runeSourceReader turns a source of runes into UTF-8 text.
+type runeSourceReader struct {
+	next func() (rune, error)
+	buf  []byte
+	err  error
+}
+
+func (r *runeSourceReader) Read(p []byte) (int, error) {
+	for len(r.buf) < len(p) && r.err == nil {
+		var c rune
+		if c, r.err = r.next(); r.err == nil {
+			r.buf = utf8.AppendRune(r.buf, c)
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	if n == 0 && r.err != nil {
+		return 0, r.err
+	}
+	return n, nil
+}
+
+// decodeCSVInput returns a reader of r's text as UTF-8. The "auto"
+// encoding reads UTF-16 when r starts with its byte order mark and UTF-8
+// otherwise. UTF-16 without a byte order mark is read as little-endian,
+// as Windows tools write it. A leading byte order mark is dropped.
+func decodeCSVInput(r io.Reader, encoding string) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	bom, _ := br.Peek(3)
+	utf16BOM := func() binary.ByteOrder {
+		switch {
+		case bytes.HasPrefix(bom, []byte{0xFF, 0xFE}):
+			return binary.LittleEndian
+		case bytes.HasPrefix(bom, []byte{0xFE, 0xFF}):
+			return binary.BigEndian
+		}
+		return nil
+	}
+
+	var order binary.ByteOrder
+	switch encoding {
+	case "auto", "utf-8":
+		if encoding == "auto" {
+			order = utf16BOM()
+		}
+		if order == nil {
+			if bytes.HasPrefix(bom, []byte{0xEF, 0xBB, 0xBF}) {
+				br.Discard(3)
+			}
+			return br, nil
+		}
+	case "latin-1":
+		return &runeSourceReader{next: func() (rune, error) {
+			b, err := br.ReadByte()
+			return rune(b), err
+		}}, nil
+	case "utf-16", "utf-16le", "utf-16be":
+		order = utf16BOM()
+		switch {
+		case encoding == "utf-16be" && order != binary.LittleEndian:
+			order = binary.BigEndian
+		case encoding == "utf-16le" && order != binary.BigEndian:
+			order = binary.LittleEndian
+		case order == nil:
+			order = binary.LittleEndian
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encoding '%s'", encoding)
+	}
+
+	if utf16BOM() != nil {
+		br.Discard(2)
+	}
+	unit := func() (uint16, error) {
+		var b [2]byte
+		if _, err := io.ReadFull(br, b[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return 0, errors.New("truncated UTF-16 input")
+			}
+			return 0, err
+		}
+		return order.Uint16(b[:]), nil
+	}
+	var pending uint16
+	var hasPending bool
+	return &runeSourceReader{next: func() (rune, error) {
+		u := pending
+		if hasPending {
+			hasPending = false
+		} else {
+			var err error
+			if u, err = unit(); err != nil {
+				return 0, err
+			}
+		}
+		if !utf16.IsSurrogate(rune(u)) {
+			return rune(u), nil
+		}
+		low, err := unit()
+		if err == io.EOF {
+			return utf8.RuneError, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		r := utf16.DecodeRune(rune(u), rune(low))
+		if r == utf8.RuneError {
+			// Not a surrogate pair; the second unit starts the next rune
+			pending, hasPending = low, true
+		}
+		return r, nil
+	}}, nil
+}
+
+// csvRecordReader reads the records of a CSV file in a dialect. Unlike
+// encoding/csv, it takes any quote character or none, and rows may have
+// any number of fields.
+type csvRecordReader struct {
+	r       *bufio.Reader
+	d       *csvDialect
+	line    int
+	pending [][]string // Records read ahead by header detection and inference
+}
+
+func newCSVRecordReader(r io.Reader, d *csvDialect) (*csvRecordReader, error) {
+	text, err := decodeCSVInput(r, d.encoding)
+	if err != nil {
+		return nil, err
+	}
+	return &csvRecordReader{r: bufio.NewReader(text), d: d}, nil
+}
+
+// Read returns the next record, or io.EOF after the last one.
+func (cr *csvRecordReader) Read() ([]string, error) {
+	for {
+		record, err := cr.readRecord()
+		if err != nil {
+			return nil, err
+		}
+		// Blank lines and comment lines hold no record
+		if len(record) == 1 && record[0] == "" {
+			continue
+		}
+		return record, nil
+	}
+}
+
+func (cr *csvRecordReader) readRecord() ([]string, error) {
+	cr.line++
+	first, _, err := cr.r.ReadRune()
+	if err != nil {
+		return nil, err
+	}
+	if cr.d.comment != 0 && first == cr.d.comment {
+		if _, err := cr.r.ReadString('\n'); err != nil && err != io.EOF {
+			return nil, err
+		}
+		return []string{""}, nil
+	}
+	cr.r.UnreadRune()
+
+	startLine := cr.line
+	record := []string{}
+	var field strings.Builder
+	quoted := false // Inside a quoted part of the field
+	atStart := true
+	for {
+		c, _, err := cr.r.ReadRune()
+		if err == io.EOF {
+			if quoted {
+				return nil, fmt.Errorf("line %d: unterminated quoted field", startLine)
+			}
+			return append(record, field.String()), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case quoted:
+			if c == cr.d.quote {
+				next, _, err := cr.r.ReadRune()
+				if err == nil && next == cr.d.quote {
+					field.WriteRune(c) // Doubled quote
+					continue
+				}
+				if err == nil {
+					cr.r.UnreadRune()
+				}
+				quoted = false
+				continue
+			}
+			if c == '\n' {
+				cr.line++
+			}
+			field.WriteRune(c)
+		case c == cr.d.quote && cr.d.quote != 0 && atStart:
+			quoted, atStart = true, false
+		case c == cr.d.delimiter:
+			record = append(record, field.String())
+			field.Reset()
+			atStart = true
+		case c == '\n':
+			return append(record, field.String()), nil
+		case c == '\r':
+			if next, _, err := cr.r.ReadRune(); err == nil && next != '\n' {
+				cr.r.UnreadRune()
+			}
+			return append(record, field.String()), nil
+		default:
+			// Text after a closing quote belongs to the field, as with
+			// encoding/csv's LazyQuotes
+			field.WriteRune(c)
+			atStart = false
+		}
+	}
+}
+
+// csvTable is the shape of a CSV file found by reading its first rows:
+// its columns and their types. Reading continues from rows.
+type csvTable struct {
+	columns  []string
+	types    []string
+	header   bool   // The file has a header row
+	row      int    // Data rows read
+	explicit []bool // The type came from the types option
+	rows     *csvRecordReader
+}
+
+// openCSVTable reads the header row of r, when the dialect has one or
+// header detection finds one, and gives each column a type: its types
+// option, else the type inferred from the first sampleSize rows, else
+// string. Columns without a header are named col1, col2, ...
+func openCSVTable(r io.Reader, d *csvDialect) (*csvTable, error) {
+	rows, err := newCSVRecordReader(r, d)
+	if err != nil {
+		return nil, err
+	}
+	sample := [][]string{}
+	for len(sample) <= d.sampleSize {
+		record, err := rows.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		sample = append(sample, record)
+	}
+
+	hasHeader := d.header == "true"
+	if d.header == "auto" && len(sample) > 0 {
+		hasHeader = detectCSVHeader(sample[0], sample[1:])
+	}
+	var header []string
+	if hasHeader && len(sample) > 0 {
+		header, sample = sample[0], sample[1:]
+	}
+	rows.pending = sample
+
+	width := len(header)
+	for _, record := range sample {
+		if len(record) > width {
+			width = len(record)
+		}
+	}
+	t := &csvTable{columns: make([]string, width), types: make([]string, width), explicit: make([]bool, width), header: header != nil, rows: rows}
+	for i := range t.columns {
+		if i < len(header) && header[i] != "" {
+			t.columns[i] = header[i]
+		} else {
+			t.columns[i] = fmt.Sprintf("col%d", i+1)
+		}
+		t.types[i] = "string"
+		if typ, ok := d.types[t.columns[i]]; ok {
+			t.types[i], t.explicit[i] = typ, true
+		} else if typ, ok := d.types[strconv.Itoa(i)]; ok {
+			t.types[i], t.explicit[i] = typ, true
+		} else if d.infer {
+			t.types[i] = inferCSVColumnType(sample, i)
+		}
+	}
+	return t, nil
+}
+
+// nextRecord returns the fields of the next data row as written, or
+// io.EOF after the last one.
+func (t *csvTable) nextRecord() ([]string, error) {
+	if len(t.rows.pending) > 0 {
+		record := t.rows.pending[0]
+		t.rows.pending = t.rows.pending[1:]
+		t.row++
+		return record, nil
+	}
+	record, err := t.rows.Read()
+	if err == nil {
+		t.row++
+	}
+	return record, err
+}
+
+// next returns the next data row, typed, or io.EOF after the last one.
+func (t *csvTable) next() ([]interface{}, error) {
+	record, err := t.nextRecord()
+	if err != nil {
+		return nil, err
+	}
+	row := make([]interface{}, len(t.columns))
+	for i := range row {
+		if i >= len(record) {
+			continue
+		}
+		v, ok := convertCSVValue(record[i], t.types[i])
+		if !ok {
+			if t.explicit[i] {
+				return nil, fmt.Errorf("row %d: column '%s': '%s' is not a %s", t.row, t.columns[i], record[i], t.types[i])
+			}
+			v = record[i] // Inferred from the sample, but not every row fits
+		}
+		row[i] = v
+	}
+	return row, nil
+}
+
+// inferCSVColumnType is the narrowest type all non-empty values of column
+// i fit: number, bool or string. Numbers with leading zeros, such as zip
+// codes, are strings.
+func inferCSVColumnType(sample [][]string, i int) string {
+	typ := ""
+	for _, record := range sample {
+		if i >= len(record) || record[i] == "" {
+			continue
+		}
+		valueType := "string"
+		if _, ok := convertCSVValue(record[i], "number"); ok {
+			valueType = "number"
+		} else if _, ok := convertCSVValue(record[i], "bool"); ok {
+			valueType = "bool"
+		}
+		if typ != "" && typ != valueType {
+			return "string"
+		}
+		typ = valueType
+	}
+	if typ == "" {
+		return "string"
+	}
+	return typ
+}
+
+// convertCSVValue converts a field to typ. Empty fields are null.
+func convertCSVValue(s, typ string) (interface{}, bool) {
+	if s == "" {
+		return nil, true
+	}
+	switch typ {
+	case "number":
+		digits := strings.TrimLeft(s, "+-")
+		if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' {
+			return nil, false
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || strings.ContainsAny(s, "xXpP_") || strings.EqualFold(digits, "inf") || strings.EqualFold(digits, "infinity") || strings.EqualFold(digits, "nan") {
+			return nil, false
+		}
+		return f, true
+	case "bool":
+		switch strings.ToLower(s) {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		}
+		return nil, false
+	}
+	return s, true
+}
+
+// detectCSVHeader guesses whether first is a header row: every field is
+// filled in, unique and not a number or boolean, and some column of rest
+// is typed or never holds the header's text.
+func detectCSVHeader(first []string, rest [][]string) bool {
+	seen := map[string]bool{}
+	for _, f := range first {
+		if f == "" || seen[f] {
+			return false
+		}
+		seen[f] = true
+		if inferCSVColumnType([][]string{{f}}, 0) != "string" {
+			return false
+		}
+	}
+	if len(rest) == 0 {
+		return false
+	}
+	for i, f := range first {
+		if inferCSVColumnType(rest, i) != "string" {
+			return true
+		}
+		repeated := false
+		for _, record := range rest {
+			if i < len(record) && record[i] == f {
+				repeated = true
+				break
+			}
+		}
+		if !repeated {
+			return true
+		}
+	}
+	return false
+}
@@ -4,10 +4,11 @@ import (
 	"encoding/csv"
 	"errors"
 	"fmt"
-	"net/http"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -198,10 +199,10 @@ func RegisterCSVFunctions(rt *Runtime) {
 	})
 
 	// Optional helper to load a CSV into an existing node:
-	// csvLoad(node, path) -> true
+	// csvLoad(node, path, [options]) -> true
 	rt.Register("csvLoad", func(args ...Value) (Value, error) {
-		if len(args) != 2 {
-			return nil, fmt.Errorf("csvLoad requires 2 arguments: node, path")
+		if len(args) < 2 || len(args) > 3 {
+			return nil, fmt.Errorf("csvLoad requires 2-3 arguments: node, path, [options]")
 		}
 		n, _, err := asCSVNodeFromArg(args[0])
 		if err != nil {
@@ -212,6 +213,22 @@ func RegisterCSVFunctions(rt *Runtime) {
 		if !ok {
 			return nil, fmt.Errorf("path must be string, got %T", p)
 		}
+		// Dialect options are kept in the node's metadata, where
+		// LoadFromReader and StreamProcess read them
+		if len(args) == 3 {
+			opts, ok := unwrapCSVArg(args[2]).(*MapValue)
+			if !ok {
+				return nil, fmt.Errorf("options must be a map, got %T", unwrapCSVArg(args[2]))
+			}
+			if _, err := csvDialectFromOptions(opts, nil); err != nil {
+				return nil, err
+			}
+			for meta, option := range csvNodeDialectMeta {
+				if v, ok := opts.Get(option); ok {
+					n.SetMeta(meta, unwrapCSVArg(v))
+				}
+			}
+		}
 		// Resolve against secure data path
 		fullPath, err := getSecureFilePath(string(s), "data")
 		if err != nil {
@@ -222,13 +239,189 @@ func RegisterCSVFunctions(rt *Runtime) {
 		}
 		return true, nil
 	})
+
+	// csvOpen(path, [options]) -> view
+	rt.Register("csvOpen", func(args ...Value) (Value, error) {
+		if len(args) < 1 || len(args) > 2 {
+			return nil, fmt.Errorf("csvOpen requires 1-2 arguments: path, [options]")
+		}
+		p, ok := unwrapCSVArg(args[0]).(Str)
+		if !ok {
+			return nil, fmt.Errorf("path must be string, got %T", unwrapCSVArg(args[0]))
+		}
+		var opts *MapValue
+		if len(args) == 2 {
+			if opts, ok = unwrapCSVArg(args[1]).(*MapValue); !ok {
+				return nil, fmt.Errorf("options must be a map, got %T", unwrapCSVArg(args[1]))
+			}
+		}
+		dialect, err := csvDialectFromOptions(opts, nil)
+		if err != nil {
+			return nil, err
+		}
+		fullPath, err := getSecureFilePath(string(p), "data")
+		if err != nil {
+			return nil, err
+		}
+		view, err := openCSVView(fullPath, dialect)
+		if err != nil {
+			return nil, fmt.Errorf("csvOpen: %v", err)
+		}
+		return view, nil
+	})
+
+	// csvSelect(source, columns) -> view
+	rt.Register("csvSelect", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("csvSelect requires 2 arguments: source, columns")
+		}
+		view, err := csvViewArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		switch c := unwrapCSVArg(args[1]).(type) {
+		case Str:
+			names = []string{string(c)}
+		case *ArrayValue:
+			for i := 0; i < c.Length(); i++ {
+				name, ok := unwrapCSVArg(c.Get(i)).(Str)
+				if !ok {
+					return nil, fmt.Errorf("column names must be strings, got %T", c.Get(i))
+				}
+				names = append(names, string(name))
+			}
+		default:
+			return nil, fmt.Errorf("columns must be a column name or an array of them, got %T", c)
+		}
+		selected, err := view.selectColumns(names)
+		if err != nil {
+			return nil, fmt.Errorf("csvSelect: %v", err)
+		}
+		return selected, nil
+	})
+
+	// csvFilter(source, function) -> view
+	rt.Register("csvFilter", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("csvFilter requires 2 arguments: source, function")
+		}
+		view, err := csvViewArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		fn, ok := unwrapCSVArg(args[1]).(*FunctionValue)
+		if !ok {
+			return nil, fmt.Errorf("second argument must be a function, got %T", unwrapCSVArg(args[1]))
+		}
+		return view.filterRows(func(row map[string]interface{}) (bool, error) {
+			result, err := executeFunctionValue(rt, fn, []Value{convertFromNativeValue(row)})
+			if err != nil {
+				return false, err
+			}
+			return result == Bool(true), nil
+		}), nil
+	})
+
+	// csvJoin(left, right, on, [options]) -> view
+	rt.Register("csvJoin", func(args ...Value) (Value, error) {
+		if len(args) < 3 || len(args) > 4 {
+			return nil, fmt.Errorf("csvJoin requires 3-4 arguments: left, right, on, [options]")
+		}
+		left, err := csvViewArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		right, err := csvViewArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		var leftKey, rightKey string
+		switch on := unwrapCSVArg(args[2]).(type) {
+		case Str:
+			leftKey, rightKey = string(on), string(on)
+		case *ArrayValue:
+			if on.Length() != 2 {
+				return nil, errors.New("on must be a column name or an array of a left and a right column name")
+			}
+			l, lok := unwrapCSVArg(on.Get(0)).(Str)
+			r, rok := unwrapCSVArg(on.Get(1)).(Str)
+			if !lok || !rok {
+				return nil, errors.New("on must be a column name or an array of a left and a right column name")
+			}
+			leftKey, rightKey = string(l), string(r)
+		default:
+			return nil, fmt.Errorf("on must be a column name or an array of a left and a right column name, got %T", on)
+		}
+		leftJoin := false
+		if len(args) == 4 {
+			opts, ok := unwrapCSVArg(args[3]).(*MapValue)
+			if !ok {
+				return nil, fmt.Errorf("options must be a map, got %T", unwrapCSVArg(args[3]))
+			}
+			for k, v := range opts.Values {
+				if k != "type" {
+					return nil, fmt.Errorf("unknown csvJoin option %q", k)
+				}
+				switch unwrapCSVArg(v) {
+				case Str("inner"):
+				case Str("left"):
+					leftJoin = true
+				default:
+					return nil, fmt.Errorf("join type must be 'inner' or 'left', got %v", v)
+				}
+			}
+		}
+		joined, err := left.joinRows(right, leftKey, rightKey, leftJoin)
+		if err != nil {
+			return nil, fmt.Errorf("csvJoin: %v", err)
+		}
+		return joined, nil
+	})
+
+	// csvRows(view, [limit]) -> node of rows, as loadCSV returns them
+	rt.Register("csvRows", func(args ...Value) (Value, error) {
+		if len(args) < 1 || len(args) > 2 {
+			return nil, fmt.Errorf("csvRows requires 1-2 arguments: view, [limit]")
+		}
+		view, err := csvViewArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		limit := -1
+		if len(args) == 2 {
+			n, ok := unwrapCSVArg(args[1]).(Number)
+			if !ok || n < 0 {
+				return nil, fmt.Errorf("limit must be a non-negative number, got %v", unwrapCSVArg(args[1]))
+			}
+			limit = int(n)
+		}
+		rows := []interface{}{}
+		errLimit := errors.New("limit reached")
+		err = view.each(func(row []interface{}) error {
+			if len(rows) == limit {
+				return errLimit
+			}
+			if err := rt.interrupted(); err != nil {
+				return err
+			}
+			rows = append(rows, view.rowMap(row))
+			return nil
+		})
+		if err != nil && err != errLimit {
+			return nil, err
+		}
+		node := NewJSONNode("csv_data")
+		node.SetJSONValue(rows)
+		return node, nil
+	})
 }
 
 // === CSV SPECIFIC ===
 func registerCSVFileOps(rt *Runtime) {
 	rt.Register("loadCSV", func(args ...Value) (Value, error) {
-		if len(args) < 1 || len(args) > 2 {
-			return nil, errors.New("loadCSV requires 1-2 arguments: filepath and optional hasHeaders (boolean)")
+		if len(args) < 1 || len(args) > 3 {
+			return nil, errors.New("loadCSV requires 1-3 arguments: filepath, optional hasHeaders (boolean) and optional options map")
 		}
 
 		// Unwrap arguments
@@ -243,10 +436,37 @@ func registerCSVFileOps(rt *Runtime) {
 			return nil, fmt.Errorf("fileName must be a string, got %T", args[0])
 		}
 
-		hasHeaders := true // default
-		if len(args) == 2 {
+		// Options: the CSV dialect (see csvDialect) and tls (map of TLS
+		// settings for URL sources, see tlsConfigFromOptions)
+		var opts *MapValue
+		if len(args) == 3 {
+			var ok bool
+			if opts, ok = args[2].(*MapValue); !ok {
+				return nil, fmt.Errorf("options must be a map, got %T", args[2])
+			}
+		}
+		var tlsOpts *MapValue
+		dialect, err := csvDialectFromOptions(opts, func(k string, v Value) error {
+			if k != "tls" {
+				return fmt.Errorf("unknown loadCSV option %q", k)
+			}
+			var ok bool
+			if tlsOpts, ok = v.(*MapValue); !ok {
+				return fmt.Errorf("tls option must be a map, got %T", v)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		// The hasHeaders argument applies unless the options set header
+		headerSet := false
+		if opts != nil {
+			_, headerSet = opts.Get("header")
+		}
+		if len(args) >= 2 && !headerSet {
 			if headerFlag, ok := args[1].(Bool); ok {
-				hasHeaders = bool(headerFlag)
+				dialect.header = strconv.FormatBool(bool(headerFlag))
 			}
 		}
 
@@ -255,10 +475,13 @@ func registerCSVFileOps(rt *Runtime) {
 		if filepath.Ext(fileNameStr) != ".csv" {
 			return nil, fmt.Errorf("file must have .csv extension, got '%s'", fileNameStr)
 		}
-		var reader *csv.Reader
+		var reader io.Reader
 		// Support HTTP(S) sources (e.g., Azure Blob SAS URLs) for large ETL inputs
 		if strings.HasPrefix(strings.ToLower(fileNameStr), "http://") || strings.HasPrefix(strings.ToLower(fileNameStr), "https://") {
-			client := &http.Client{Timeout: 2 * time.Minute}
+			client, err := httpClientWithTLS(tlsOpts, 2*time.Minute)
+			if err != nil {
+				return nil, err
+			}
 			resp, err := client.Get(fileNameStr)
 			if err != nil {
 				return nil, fmt.Errorf("failed to fetch CSV from URL '%s': %v", fileNameStr, err)
@@ -268,7 +491,7 @@ func registerCSVFileOps(rt *Runtime) {
 				return nil, fmt.Errorf("failed to fetch CSV from URL '%s': HTTP %d", fileNameStr, resp.StatusCode)
 			}
 			defer resp.Body.Close()
-			reader = csv.NewReader(resp.Body)
+			reader = resp.Body
 		} else {
 			// Local file path under configured DataPath
 			fullPath, err := getSecureFilePath(fileNameStr, "data")
@@ -280,69 +503,34 @@ func registerCSVFileOps(rt *Runtime) {
 				return nil, fmt.Errorf("failed to open CSV file '%s': %v", fileNameStr, err)
 			}
 			defer file.Close()
-			reader = csv.NewReader(file)
+			reader = file
 		}
 
-		// Parse CSV
-		records, err := reader.ReadAll()
+		// Parse CSV, typing each column
+		table, err := openCSVTable(reader, dialect)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse CSV from '%s': %v", fileNameStr, err)
 		}
 
-		if len(records) == 0 {
-			// Return empty JSONNode with array
-			node := NewJSONNode("csv_data")
-			node.SetJSONValue([]interface{}{})
-			return node, nil
-		}
-
-		var result []interface{}
-
-		if hasHeaders && len(records) > 0 {
-			// Use first row as headers
-			headers := records[0]
-			for i := 1; i < len(records); i++ {
-				row := records[i]
-				rowObj := make(map[string]interface{})
-
-				for j, value := range row {
-					if j < len(headers) {
-						// Try to convert numbers
-						if num, err := parseNumber(value); err == nil {
-							rowObj[headers[j]] = num
-						} else if value == "true" {
-							rowObj[headers[j]] = true
-						} else if value == "false" {
-							rowObj[headers[j]] = false
-						} else if value == "" {
-							rowObj[headers[j]] = nil
-						} else {
-							rowObj[headers[j]] = value
-						}
-					}
-				}
-				result = append(result, rowObj)
+		// Rows are objects keyed by header, or arrays without a header row
+		result := []interface{}{}
+		for {
+			row, err := table.next()
+			if err == io.EOF {
+				break
 			}
-		} else {
-			// No headers - return array of arrays
-			for _, row := range records {
-				var rowArray []interface{}
-				for _, value := range row {
-					// Try to convert numbers
-					if num, err := parseNumber(value); err == nil {
-						rowArray = append(rowArray, num)
-					} else if value == "true" {
-						rowArray = append(rowArray, true)
-					} else if value == "false" {
-						rowArray = append(rowArray, false)
-					} else if value == "" {
-						rowArray = append(rowArray, nil)
-					} else {
-						rowArray = append(rowArray, value)
-					}
-				}
-				result = append(result, rowArray)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse CSV from '%s': %v", fileNameStr, err)
 			}
+			if !table.header {
+				result = append(result, row)
+				continue
+			}
+			rowObj := make(map[string]interface{}, len(row))
+			for j, value := range row {
+				rowObj[table.columns[j]] = value
+			}
+			result = append(result, rowObj)
 		}
 
 		// Create JSONNode with the CSV data
@@ -354,7 +542,7 @@ func registerCSVFileOps(rt *Runtime) {
 
 	rt.Register("saveCSV", func(args ...Value) (Value, error) {
 		if len(args) < 2 || len(args) > 3 {
-			return nil, errors.New("saveCSV requires 2-3 arguments: data (JSONNode), filepath, and optional includeHeaders (boolean)")
+			return nil, errors.New("saveCSV requires 2-3 arguments: data (JSONNode or CSV view), filepath, and optional includeHeaders (boolean)")
 		}
 
 		// Unwrap arguments
@@ -365,8 +553,9 @@ func registerCSVFileOps(rt *Runtime) {
 		}
 
 		jsonNode, ok := args[0].(*JSONNode)
-		if !ok {
-			return nil, fmt.Errorf("first argument must be a JSONNode, got %T", args[0])
+		view, isView := args[0].(*CSVView)
+		if !ok && !isView {
+			return nil, fmt.Errorf("first argument must be a JSONNode or CSV view, got %T", args[0])
 		}
 
 		fileName, ok := args[1].(Str)
@@ -393,6 +582,11 @@ func registerCSVFileOps(rt *Runtime) {
 			}
 		}
 
+		// Views are written as they are read, a row at a time
+		if isView {
+			return writeCSVView(view, fullPath, includeHeaders)
+		}
+
 		// Get data from JSONNode
 		data := jsonNode.GetJSONValue()
 
@@ -527,3 +721,34 @@ func registerCSVFileOps(rt *Runtime) {
 		return Bool(true), nil
 	})
 }
+
+// writeCSVView writes the rows of view to a CSV file as they are read.
+func writeCSVView(view *CSVView, path string, includeHeaders bool) (Value, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CSV file '%s': %v", path, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if includeHeaders {
+		if err := writer.Write(view.columns); err != nil {
+			return nil, fmt.Errorf("failed to write CSV row: %v", err)
+		}
+	}
+	record := make([]string, len(view.columns))
+	err = view.each(func(row []interface{}) error {
+		for i, value := range row {
+			record[i] = interfaceToString(value)
+		}
+		return writer.Write(record)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write CSV view: %v", err)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write CSV row: %v", err)
+	}
+	return Bool(true), nil
+}
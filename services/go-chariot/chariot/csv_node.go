@@ -1,7 +1,6 @@
 package chariot
 
 import (
-	"encoding/csv"
 	"fmt"
 	"io"
 	"os"
@@ -50,38 +49,79 @@ func (n *CSVNode) LoadFromFile(path string) error {
 	return n.LoadFromReader(file)
 }
 
-func (n *CSVNode) LoadFromReader(r io.Reader) error {
-	delimiter := ","
-	if delim, exists := n.GetMeta("delimiter"); exists {
-		delimiter = delim.(string)
-	}
+// csvNodeDialectMeta maps the metadata describing a node's CSV dialect to
+// the dialect options csvLoad takes.
+var csvNodeDialectMeta = map[string]string{
+	"delimiter":  "delimiter",
+	"quote":      "quote",
+	"comment":    "comment",
+	"encoding":   "encoding",
+	"hasHeaders": "header",
+	"types":      "types",
+	"infer":      "infer",
+	"sampleSize": "sampleSize",
+}
 
-	hasHeaders := true
-	if headers, exists := n.GetMeta("hasHeaders"); exists {
-		hasHeaders = headers.(bool)
+// dialect is the CSV dialect the node's metadata describes.
+func (n *CSVNode) dialect() (*csvDialect, error) {
+	d := defaultCSVDialect()
+	for meta, option := range csvNodeDialectMeta {
+		if v, exists := n.GetMeta(meta); exists {
+			switch v.(type) {
+			case string, bool, int, float64: // Set by NewCSVNode or LoadFromReader
+				v = convertFromNativeValue(v)
+			}
+			if _, err := d.setOption(option, v); err != nil {
+				return nil, err
+			}
+		}
 	}
+	return d, nil
+}
 
-	reader := csv.NewReader(r)
-	reader.Comma = rune(delimiter[0])
-
-	var headers []string
+// openTable reads the header row and first rows of r in the node's
+// dialect, recording the headers, whether there were any, and the type of
+// each column in the node's metadata.
+func (n *CSVNode) openTable(r io.Reader) (*csvTable, error) {
+	d, err := n.dialect()
+	if err != nil {
+		return nil, err
+	}
+	table, err := openCSVTable(r, d)
+	if err != nil {
+		return nil, err
+	}
+	n.SetMeta("hasHeaders", table.header)
+	if table.header {
+		n.SetMeta("headers", convertFromNativeValue(table.columns))
+		n.SetMeta("columnCount", len(table.columns))
+	}
+	types := NewMap()
+	for i, c := range table.columns {
+		types.Set(c, Str(table.types[i]))
+	}
+	n.SetMeta("columnTypes", types)
+	return table, nil
+}
 
-	// Read headers if present
-	if hasHeaders {
-		headerRow, err := reader.Read()
-		if err != nil {
-			return err
-		}
-		headers = headerRow
-		n.SetMeta("headers", convertFromNativeValue(headers))
-		n.SetMeta("columnCount", len(headers))
+func (n *CSVNode) LoadFromReader(r io.Reader) error {
+	table, err := n.openTable(r)
+	if err != nil {
+		return err
 	}
 
 	// For small files, cache all rows
 	// For large files, this method should be avoided in favor of streaming
-	rows, err := reader.ReadAll()
-	if err != nil {
-		return err
+	rows := [][]string{}
+	for {
+		record, err := table.nextRecord()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rows = append(rows, record)
 	}
 
 	// Store rows as attribute (use with caution for large files)
@@ -104,27 +144,13 @@ func (n *CSVNode) StreamProcess(chunkSize int, processor func([][]string) error)
 	}
 	defer file.Close()
 
-	delimiter := ","
-	if delim, exists := n.GetMeta("delimiter"); exists {
-		delimiter = delim.(string)
-	}
-
-	hasHeaders := true
-	if headers, exists := n.GetMeta("hasHeaders"); exists {
-		hasHeaders = headers.(bool)
-	}
-
-	reader := csv.NewReader(file)
-	reader.Comma = rune(delimiter[0])
-
 	// Skip headers if present and store them
-	if hasHeaders {
-		headerRow, err := reader.Read()
-		if err != nil {
-			return err
-		}
-		n.SetAttribute("headers", convertFromNativeValue(headerRow))
-		n.SetMeta("columnCount", len(headerRow))
+	table, err := n.openTable(file)
+	if err != nil {
+		return err
+	}
+	if table.header {
+		n.SetAttribute("headers", convertFromNativeValue(table.columns))
 	}
 
 	batch := make([][]string, 0, chunkSize)
@@ -132,7 +158,7 @@ func (n *CSVNode) StreamProcess(chunkSize int, processor func([][]string) error)
 	batchCount := 0
 
 	for {
-		row, err := reader.Read()
+		row, err := table.nextRecord()
 		if err == io.EOF {
 			// Process final batch
 			if len(batch) > 0 {
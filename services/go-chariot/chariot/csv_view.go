@@ -0,0 +1,365 @@
+package chariot
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// A CSVView is a table read lazily from a CSV file. csvOpen opens one;
+// csvSelect, csvFilter and csvJoin derive new views from it without
+// reading anything. Rows are read, one at a time, only when a view is
+// iterated by csvRows or saveCSV, so views work over files of any size.
+type CSVView struct {
+	columns []string
+	types   []string
+	open    func() (csvRowIterator, error)
+}
+
+// csvRowIterator returns the rows of a view, with one value per column,
+// and io.EOF after the last one.
+type csvRowIterator interface {
+	next() ([]interface{}, error)
+	close() error
+}
+
+// Columns returns the names of the view's columns.
+func (v *CSVView) Columns() []string {
+	return append([]string(nil), v.columns...)
+}
+
+func (v *CSVView) String() string {
+	return fmt.Sprintf("CSVView(%s)", strings.Join(v.columns, ", "))
+}
+
+func (v *CSVView) columnIndex(name string) (int, error) {
+	for i, c := range v.columns {
+		if c == name {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("no column '%s' (columns are %s)", name, strings.Join(v.columns, ", "))
+}
+
+// each calls fn with each row of the view until fn returns an error.
+func (v *CSVView) each(fn func([]interface{}) error) error {
+	it, err := v.open()
+	if err != nil {
+		return err
+	}
+	defer it.close()
+	for {
+		row, err := it.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// rowMap is a row as a map of column to value.
+func (v *CSVView) rowMap(row []interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(v.columns))
+	for i, c := range v.columns {
+		m[c] = row[i]
+	}
+	return m
+}
+
+// csvFileIterator reads the rows of a CSV file.
+type csvFileIterator struct {
+	file  *os.File
+	table *csvTable
+}
+
+func (it *csvFileIterator) next() ([]interface{}, error) { return it.table.next() }
+func (it *csvFileIterator) close() error                 { return it.file.Close() }
+
+// openCSVView reads the header and first rows of the file at path to find
+// its columns and their types, and returns a view of it.
+func openCSVView(path string, d *csvDialect) (*CSVView, error) {
+	openTable := func() (*csvFileIterator, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		table, err := openCSVTable(file, d)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &csvFileIterator{file: file, table: table}, nil
+	}
+	first, err := openTable()
+	if err != nil {
+		return nil, err
+	}
+	first.close()
+	view := &CSVView{columns: first.table.columns, types: first.table.types}
+	view.open = func() (csvRowIterator, error) {
+		it, err := openTable()
+		if err != nil {
+			return nil, err
+		}
+		if len(it.table.columns) != len(view.columns) {
+			it.close()
+			return nil, fmt.Errorf("'%s' changed since it was opened", path)
+		}
+		return it, nil
+	}
+	return view, nil
+}
+
+// sliceRowIterator returns rows held in memory.
+type sliceRowIterator struct {
+	rows [][]interface{}
+}
+
+func (it *sliceRowIterator) next() ([]interface{}, error) {
+	if len(it.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := it.rows[0]
+	it.rows = it.rows[1:]
+	return row, nil
+}
+
+func (it *sliceRowIterator) close() error { return nil }
+
+// csvViewFromRows is a view of rows held in memory, such as those loadCSV
+// returns: maps of column to value. Columns are ordered as in the first row.
+func csvViewFromRows(rows []interface{}) (*CSVView, error) {
+	view := &CSVView{}
+	if len(rows) > 0 {
+		first, ok := rows[0].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("rows must be maps of column to value, got %T", rows[0])
+		}
+		view.columns = sortedKeys(first)
+	}
+	data := make([][]interface{}, len(rows))
+	for i, r := range rows {
+		m, ok := r.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("rows must be maps of column to value, got %T", r)
+		}
+		data[i] = make([]interface{}, len(view.columns))
+		for j, c := range view.columns {
+			data[i][j] = m[c]
+		}
+	}
+	view.types = make([]string, len(view.columns))
+	for i := range view.types {
+		view.types[i] = "string"
+	}
+	view.open = func() (csvRowIterator, error) {
+		return &sliceRowIterator{rows: data}, nil
+	}
+	return view, nil
+}
+
+// csvViewArg accepts a view, a CSV file path, opened with the default
+// dialect, a DataFrame, or a node of rows as loadCSV returns them.
+func csvViewArg(arg Value) (*CSVView, error) {
+	switch a := unwrapCSVArg(arg).(type) {
+	case *CSVView:
+		return a, nil
+	case *DataFrame:
+		return a.csvView(), nil
+	case Str:
+		fullPath, err := getSecureFilePath(string(a), "data")
+		if err != nil {
+			return nil, err
+		}
+		return openCSVView(fullPath, defaultCSVDialect())
+	case *JSONNode:
+		rows, ok := a.GetJSONValue().([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("node must hold an array of rows")
+		}
+		return csvViewFromRows(rows)
+	case *ArrayValue:
+		rows, _ := ConvertToNativeJSON(a).([]interface{})
+		return csvViewFromRows(rows)
+	default:
+		return nil, fmt.Errorf("expected a CSV view, path or rows, got %T", a)
+	}
+}
+
+// mappedRowIterator applies fn to the rows of another iterator; fn
+// returns nil to drop a row.
+type mappedRowIterator struct {
+	csvRowIterator
+	fn func([]interface{}) ([]interface{}, error)
+}
+
+func (it *mappedRowIterator) next() ([]interface{}, error) {
+	for {
+		row, err := it.csvRowIterator.next()
+		if err != nil {
+			return nil, err
+		}
+		out, err := it.fn(row)
+		if err != nil {
+			return nil, err
+		}
+		if out != nil {
+			return out, nil
+		}
+	}
+}
+
+// derive is a view whose rows are those of v passed through fn.
+func (v *CSVView) derive(columns, types []string, fn func([]interface{}) ([]interface{}, error)) *CSVView {
+	return &CSVView{
+		columns: columns,
+		types:   types,
+		open: func() (csvRowIterator, error) {
+			it, err := v.open()
+			if err != nil {
+				return nil, err
+			}
+			return &mappedRowIterator{csvRowIterator: it, fn: fn}, nil
+		},
+	}
+}
+
+// selectColumns is a view of the named columns of v, in that order.
+func (v *CSVView) selectColumns(names []string) (*CSVView, error) {
+	index := make([]int, len(names))
+	types := make([]string, len(names))
+	for i, name := range names {
+		j, err := v.columnIndex(name)
+		if err != nil {
+			return nil, err
+		}
+		index[i], types[i] = j, v.types[j]
+	}
+	return v.derive(append([]string(nil), names...), types, func(row []interface{}) ([]interface{}, error) {
+		out := make([]interface{}, len(index))
+		for i, j := range index {
+			out[i] = row[j]
+		}
+		return out, nil
+	}), nil
+}
+
+// filterRows is a view of the rows of v keep returns true for.
+func (v *CSVView) filterRows(keep func(map[string]interface{}) (bool, error)) *CSVView {
+	return v.derive(v.columns, v.types, func(row []interface{}) ([]interface{}, error) {
+		ok, err := keep(v.rowMap(row))
+		if err != nil || !ok {
+			return nil, err
+		}
+		return row, nil
+	})
+}
+
+// joinRows is a view of the rows of v joined with those of right whose
+// rightKey column equals v's leftKey column. right is read into memory
+// when the view is iterated, so it should be the smaller table. A left
+// join keeps rows of v without a match, with nulls for right's columns.
+// Right columns named like a column of v get a "_right" suffix.
+func (v *CSVView) joinRows(right *CSVView, leftKey, rightKey string, leftJoin bool) (*CSVView, error) {
+	li, err := v.columnIndex(leftKey)
+	if err != nil {
+		return nil, err
+	}
+	ri, err := right.columnIndex(rightKey)
+	if err != nil {
+		return nil, err
+	}
+	columns := append([]string(nil), v.columns...)
+	types := append([]string(nil), v.types...)
+	taken := map[string]bool{}
+	for _, c := range columns {
+		taken[c] = true
+	}
+	for i, c := range right.columns {
+		if i == ri {
+			continue
+		}
+		for taken[c] {
+			c += "_right"
+		}
+		taken[c] = true
+		columns = append(columns, c)
+		types = append(types, right.types[i])
+	}
+
+	// Keys compare as text, so 7 in one file matches "7" in the other
+	joinKey := func(v interface{}) string { return fmt.Sprint(v) }
+	return &CSVView{
+		columns: columns,
+		types:   types,
+		open: func() (csvRowIterator, error) {
+			matches := map[string][][]interface{}{}
+			err := right.each(func(row []interface{}) error {
+				if row[ri] != nil {
+					k := joinKey(row[ri])
+					matches[k] = append(matches[k], row)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			it, err := v.open()
+			if err != nil {
+				return nil, err
+			}
+			return &joinRowIterator{left: it, matches: matches, key: func(row []interface{}) string {
+				if row[li] == nil {
+					return ""
+				}
+				return joinKey(row[li])
+			}, skip: ri, width: len(columns), leftJoin: leftJoin}, nil
+		},
+	}, nil
+}
+
+// joinRowIterator returns each row of left once for each of its matches.
+type joinRowIterator struct {
+	left     csvRowIterator
+	matches  map[string][][]interface{}
+	key      func([]interface{}) string
+	skip     int // Index of the right key column, which is not repeated
+	width    int
+	leftJoin bool
+	pending  [][]interface{}
+}
+
+func (it *joinRowIterator) next() ([]interface{}, error) {
+	for len(it.pending) == 0 {
+		row, err := it.left.next()
+		if err != nil {
+			return nil, err
+		}
+		found := it.matches[it.key(row)]
+		if len(found) == 0 && it.leftJoin {
+			out := make([]interface{}, it.width)
+			copy(out, row)
+			return out, nil
+		}
+		for _, match := range found {
+			out := append(make([]interface{}, 0, it.width), row...)
+			for i, value := range match {
+				if i != it.skip {
+					out = append(out, value)
+				}
+			}
+			it.pending = append(it.pending, out)
+		}
+	}
+	row := it.pending[0]
+	it.pending = it.pending[1:]
+	return row, nil
+}
+
+func (it *joinRowIterator) close() error { return it.left.close() }
@@ -0,0 +1,777 @@
+package chariot
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DataFrame is a table held by column, each column a typed Go slice. It
+// is meant for ETL scripts working on many rows: unlike a TableValue,
+// whose rows are maps, a DataFrame filters, sorts, groups and joins whole
+// columns at a time and shares the columns an operation leaves unchanged.
+// DataFrames are never changed in place; every operation returns a new one.
+type DataFrame struct {
+	names   []string
+	columns []*frameColumn
+	rows    int
+}
+
+// frameColumn is one column of a DataFrame. kind says which slice holds
+// its values: nums, strs or bools, or vals for a column of mixed values.
+// A column of nothing but nulls has no kind.
+type frameColumn struct {
+	kind   string // "number", "string", "bool", "any" or ""
+	nums   []float64
+	strs   []string
+	bools  []bool
+	vals   []Value
+	nulls  []bool // nil while the column has no nulls
+	length int
+}
+
+// frameValue normalizes v, a Chariot or native Go value, to the kind of
+// column that holds it and the value stored there.
+func frameValue(v interface{}) (string, interface{}) {
+	switch x := v.(type) {
+	case nil:
+		return "", nil
+	case ScopeEntry:
+		return frameValue(x.Value)
+	case Number:
+		return "number", float64(x)
+	case float64:
+		return "number", x
+	case float32:
+		return "number", float64(x)
+	case int:
+		return "number", float64(x)
+	case int32:
+		return "number", float64(x)
+	case int64:
+		return "number", float64(x)
+	case uint64:
+		return "number", float64(x)
+	case Str:
+		return "string", string(x)
+	case string:
+		return "string", x
+	case []byte:
+		return "string", string(x)
+	case time.Time:
+		return "string", x.Format(time.RFC3339)
+	case Bool:
+		return "bool", bool(x)
+	case bool:
+		return "bool", x
+	case *dbNullType:
+		return "", nil
+	case map[string]interface{}, []interface{}:
+		return "any", convertFromNativeValue(x)
+	}
+	return "any", v
+}
+
+func (c *frameColumn) isNull(i int) bool {
+	return c.kind == "" || (c.nulls != nil && c.nulls[i])
+}
+
+// value returns row i as a Chariot value, DBNull for a null.
+func (c *frameColumn) value(i int) Value {
+	if c.isNull(i) {
+		return DBNull
+	}
+	switch c.kind {
+	case "number":
+		return Number(c.nums[i])
+	case "string":
+		return Str(c.strs[i])
+	case "bool":
+		return Bool(c.bools[i])
+	}
+	return c.vals[i]
+}
+
+// native returns row i as a native Go value, nil for a null.
+func (c *frameColumn) native(i int) interface{} {
+	if c.isNull(i) {
+		return nil
+	}
+	switch c.kind {
+	case "number":
+		return c.nums[i]
+	case "string":
+		return c.strs[i]
+	case "bool":
+		return c.bools[i]
+	}
+	return ConvertToNativeJSON(c.vals[i])
+}
+
+// appendValue adds v to the end of the column. A value of another kind
+// than the column's turns it into a column of mixed values.
+func (c *frameColumn) appendValue(v interface{}) {
+	kind, x := frameValue(v)
+	n := c.length
+	c.length++
+	if kind == "" {
+		if c.nulls == nil {
+			c.nulls = make([]bool, n, n+1)
+		}
+		c.nulls = append(c.nulls, true)
+		c.appendZero()
+		return
+	}
+	if c.nulls != nil {
+		c.nulls = append(c.nulls, false)
+	}
+	switch {
+	case c.kind == "":
+		// Everything so far was null
+		c.kind = kind
+		for i := 0; i < n; i++ {
+			c.appendZero()
+		}
+	case c.kind != kind && c.kind != "any":
+		vals := make([]Value, n, n+1)
+		for i := range vals {
+			vals[i] = c.value(i)
+		}
+		c.kind, c.vals, c.nums, c.strs, c.bools = "any", vals, nil, nil, nil
+	}
+	switch c.kind {
+	case "number":
+		c.nums = append(c.nums, x.(float64))
+	case "string":
+		c.strs = append(c.strs, x.(string))
+	case "bool":
+		c.bools = append(c.bools, x.(bool))
+	default:
+		c.vals = append(c.vals, frameChariotValue(kind, x))
+	}
+}
+
+// frameChariotValue is the Chariot value of x, as frameValue returns it.
+func frameChariotValue(kind string, x interface{}) Value {
+	switch kind {
+	case "number":
+		return Number(x.(float64))
+	case "string":
+		return Str(x.(string))
+	case "bool":
+		return Bool(x.(bool))
+	}
+	return x
+}
+
+func (c *frameColumn) appendZero() {
+	switch c.kind {
+	case "number":
+		c.nums = append(c.nums, 0)
+	case "string":
+		c.strs = append(c.strs, "")
+	case "bool":
+		c.bools = append(c.bools, false)
+	case "any":
+		c.vals = append(c.vals, DBNull)
+	}
+}
+
+// take returns the column made of rows idx of c, in that order; an index
+// of -1 gives a null.
+func (c *frameColumn) take(idx []int) *frameColumn {
+	out := &frameColumn{kind: c.kind, length: len(idx)}
+	switch c.kind {
+	case "number":
+		out.nums = make([]float64, len(idx))
+	case "string":
+		out.strs = make([]string, len(idx))
+	case "bool":
+		out.bools = make([]bool, len(idx))
+	case "any":
+		out.vals = make([]Value, len(idx))
+	}
+	for i, j := range idx {
+		if j < 0 || c.isNull(j) {
+			if out.nulls == nil {
+				out.nulls = make([]bool, len(idx))
+			}
+			out.nulls[i] = true
+			if out.vals != nil {
+				out.vals[i] = DBNull
+			}
+			continue
+		}
+		switch c.kind {
+		case "number":
+			out.nums[i] = c.nums[j]
+		case "string":
+			out.strs[i] = c.strs[j]
+		case "bool":
+			out.bools[i] = c.bools[j]
+		case "any":
+			out.vals[i] = c.vals[j]
+		}
+	}
+	return out
+}
+
+// key is row i as text, for grouping and joining. Nulls give "", which
+// joins never match.
+func (c *frameColumn) key(i int) string {
+	if c.isNull(i) {
+		return ""
+	}
+	switch c.kind {
+	case "number":
+		return fmt.Sprint(c.nums[i])
+	case "string":
+		return c.strs[i]
+	case "bool":
+		return fmt.Sprint(c.bools[i])
+	}
+	return fmt.Sprint(c.native(i))
+}
+
+// compare orders rows i and j: numbers and strings by value, false before
+// true, mixed values by their text. Nulls are compared by the caller.
+func (c *frameColumn) compare(i, j int) int {
+	switch c.kind {
+	case "number":
+		return compareOrdered(c.nums[i], c.nums[j])
+	case "string":
+		return strings.Compare(c.strs[i], c.strs[j])
+	}
+	ak, a := frameValue(c.value(i))
+	bk, b := frameValue(c.value(j))
+	if ak != bk {
+		ak, a = "any", c.native(i)
+		b = c.native(j)
+	}
+	return compareFrameValues(ak, a, b)
+}
+
+// compareFrameValues orders two values of kind as frameValue returns them.
+func compareFrameValues(kind string, a, b interface{}) int {
+	switch kind {
+	case "number":
+		return compareOrdered(a.(float64), b.(float64))
+	case "string":
+		return strings.Compare(a.(string), b.(string))
+	case "bool":
+		if a == b {
+			return 0
+		}
+		if b.(bool) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(fmt.Sprint(ConvertToNativeJSON(a)), fmt.Sprint(ConvertToNativeJSON(b)))
+}
+
+func compareOrdered(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// newDataFrame builds a DataFrame from rows of values, one per column.
+func newDataFrame(names []string, rows [][]interface{}) *DataFrame {
+	f := &DataFrame{names: names, columns: make([]*frameColumn, len(names))}
+	for i := range f.columns {
+		f.columns[i] = &frameColumn{}
+	}
+	for _, row := range rows {
+		f.appendRow(row)
+	}
+	return f
+}
+
+func (f *DataFrame) appendRow(row []interface{}) {
+	for i, c := range f.columns {
+		var v interface{}
+		if i < len(row) {
+			v = row[i]
+		}
+		c.appendValue(v)
+	}
+	f.rows++
+}
+
+// dataFrameFromMaps builds a DataFrame from maps of column to value, such
+// as the rows of a JSON array. Columns are sorted by name.
+func dataFrameFromMaps(rows []interface{}) (*DataFrame, error) {
+	seen := map[string]bool{}
+	maps := make([]map[string]interface{}, len(rows))
+	for i, r := range rows {
+		m, ok := r.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("row %d must be an object of column to value, got %T", i, r)
+		}
+		maps[i] = m
+		for k := range m {
+			seen[k] = true
+		}
+	}
+	names := sortedKeys(seen)
+	f := newDataFrame(names, nil)
+	row := make([]interface{}, len(names))
+	for _, m := range maps {
+		for i, name := range names {
+			row[i] = m[name]
+		}
+		f.appendRow(row)
+	}
+	return f, nil
+}
+
+func (f *DataFrame) String() string {
+	cols := make([]string, len(f.names))
+	for i, name := range f.names {
+		kind := f.columns[i].kind
+		if kind == "" {
+			kind = "null"
+		}
+		cols[i] = name + " " + kind
+	}
+	return fmt.Sprintf("DataFrame(%d rows: %s)", f.rows, strings.Join(cols, ", "))
+}
+
+// Columns returns the names of the columns.
+func (f *DataFrame) Columns() []string {
+	return append([]string(nil), f.names...)
+}
+
+// RowCount returns the number of rows.
+func (f *DataFrame) RowCount() int {
+	return f.rows
+}
+
+func (f *DataFrame) columnIndex(name string) (int, error) {
+	for i, n := range f.names {
+		if n == name {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("no column '%s' (columns are %s)", name, strings.Join(f.names, ", "))
+}
+
+// rowMap returns row i as a map of column to native value.
+func (f *DataFrame) rowMap(i int) map[string]interface{} {
+	m := make(map[string]interface{}, len(f.names))
+	for j, name := range f.names {
+		m[name] = f.columns[j].native(i)
+	}
+	return m
+}
+
+// rowMaps returns every row as a map of column to native value.
+func (f *DataFrame) rowMaps() []interface{} {
+	rows := make([]interface{}, f.rows)
+	for i := range rows {
+		rows[i] = f.rowMap(i)
+	}
+	return rows
+}
+
+// takeRows returns the DataFrame of rows idx of f.
+func (f *DataFrame) takeRows(idx []int) *DataFrame {
+	out := &DataFrame{names: f.names, columns: make([]*frameColumn, len(f.columns)), rows: len(idx)}
+	for i, c := range f.columns {
+		out.columns[i] = c.take(idx)
+	}
+	return out
+}
+
+// filterRows returns the DataFrame of the rows keep returns true for.
+func (f *DataFrame) filterRows(keep func(i int) (bool, error)) (*DataFrame, error) {
+	idx := []int{}
+	for i := 0; i < f.rows; i++ {
+		ok, err := keep(i)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			idx = append(idx, i)
+		}
+	}
+	return f.takeRows(idx), nil
+}
+
+// frameComparisons are the operators of filterColumn.
+var frameComparisons = map[string]func(int) bool{
+	"=":  func(c int) bool { return c == 0 },
+	"==": func(c int) bool { return c == 0 },
+	"!=": func(c int) bool { return c != 0 },
+	"<":  func(c int) bool { return c < 0 },
+	"<=": func(c int) bool { return c <= 0 },
+	">":  func(c int) bool { return c > 0 },
+	">=": func(c int) bool { return c >= 0 },
+}
+
+// filterColumn returns the DataFrame of the rows whose column compares to
+// v as op says, working on the column's slice directly. Nulls never match,
+// and values of another kind than v only match "!=".
+func (f *DataFrame) filterColumn(column, op string, v Value) (*DataFrame, error) {
+	ci, err := f.columnIndex(column)
+	if err != nil {
+		return nil, err
+	}
+	test, ok := frameComparisons[op]
+	if !ok {
+		return nil, fmt.Errorf("unknown operator '%s', use =, !=, <, <=, > or >=", op)
+	}
+	c := f.columns[ci]
+	kind, x := frameValue(v)
+	if kind == "" {
+		return nil, fmt.Errorf("cannot compare with null")
+	}
+	idx := []int{}
+	switch {
+	case c.kind == "number" && kind == "number":
+		y := x.(float64)
+		for i, n := range c.nums {
+			if !c.isNull(i) && test(compareOrdered(n, y)) {
+				idx = append(idx, i)
+			}
+		}
+	case c.kind == "string" && kind == "string":
+		y := x.(string)
+		for i, s := range c.strs {
+			if !c.isNull(i) && test(strings.Compare(s, y)) {
+				idx = append(idx, i)
+			}
+		}
+	default:
+		for i := 0; i < f.rows; i++ {
+			if c.isNull(i) {
+				continue
+			}
+			rk, rx := frameValue(c.value(i))
+			if rk != kind {
+				if op == "!=" {
+					idx = append(idx, i)
+				}
+				continue
+			}
+			if test(compareFrameValues(kind, rx, x)) {
+				idx = append(idx, i)
+			}
+		}
+	}
+	return f.takeRows(idx), nil
+}
+
+// selectColumns returns the DataFrame of the named columns, in that order,
+// sharing them with f.
+func (f *DataFrame) selectColumns(names []string) (*DataFrame, error) {
+	out := &DataFrame{names: append([]string(nil), names...), columns: make([]*frameColumn, len(names)), rows: f.rows}
+	for i, name := range names {
+		j, err := f.columnIndex(name)
+		if err != nil {
+			return nil, err
+		}
+		out.columns[i] = f.columns[j]
+	}
+	return out, nil
+}
+
+// sortRows returns f sorted by keys, column names that sort descending
+// when prefixed with "-". Nulls sort last; rows that compare equal keep
+// their order.
+func (f *DataFrame) sortRows(keys []string) (*DataFrame, error) {
+	type sortKey struct {
+		col  *frameColumn
+		desc bool
+	}
+	sortKeys := make([]sortKey, len(keys))
+	for i, k := range keys {
+		desc := strings.HasPrefix(k, "-")
+		ci, err := f.columnIndex(strings.TrimPrefix(k, "-"))
+		if err != nil {
+			return nil, err
+		}
+		sortKeys[i] = sortKey{f.columns[ci], desc}
+	}
+	idx := make([]int, f.rows)
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		i, j := idx[a], idx[b]
+		for _, k := range sortKeys {
+			ni, nj := k.col.isNull(i), k.col.isNull(j)
+			if ni || nj {
+				if ni != nj {
+					return nj
+				}
+				continue
+			}
+			c := k.col.compare(i, j)
+			if k.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return f.takeRows(idx), nil
+}
+
+// frameAggregate is one aggregation of groupBy: op applied to a column,
+// or count of the rows when column is "".
+type frameAggregate struct {
+	name   string
+	op     string
+	column string
+}
+
+// parseFrameAggregate parses "op(column)", or "count()" and "count(*)".
+func parseFrameAggregate(name, spec string) (frameAggregate, error) {
+	open, close := strings.Index(spec, "("), strings.LastIndex(spec, ")")
+	if open < 1 || close != len(spec)-1 {
+		return frameAggregate{}, fmt.Errorf("aggregation '%s' must look like sum(column)", spec)
+	}
+	agg := frameAggregate{name: name, op: strings.TrimSpace(spec[:open]), column: strings.TrimSpace(spec[open+1 : close])}
+	switch agg.op {
+	case "count":
+		if agg.column == "*" {
+			agg.column = ""
+		}
+	case "sum", "avg", "min", "max", "first", "last":
+		if agg.column == "" || agg.column == "*" {
+			return frameAggregate{}, fmt.Errorf("%s needs a column", agg.op)
+		}
+	default:
+		return frameAggregate{}, fmt.Errorf("unknown aggregation '%s', use count, sum, avg, min, max, first or last", agg.op)
+	}
+	return agg, nil
+}
+
+// groupBy returns a DataFrame with a row for each distinct combination of
+// the keys columns, in order of first appearance, holding the keys and the
+// aggregations of the group's rows. Aggregations skip nulls; sum and avg
+// need number columns.
+func (f *DataFrame) groupBy(keys []string, aggs []frameAggregate) (*DataFrame, error) {
+	keyCols := make([]*frameColumn, len(keys))
+	for i, k := range keys {
+		ci, err := f.columnIndex(k)
+		if err != nil {
+			return nil, err
+		}
+		keyCols[i] = f.columns[ci]
+	}
+	aggCols := make([]*frameColumn, len(aggs))
+	for i, a := range aggs {
+		if a.column == "" {
+			continue
+		}
+		ci, err := f.columnIndex(a.column)
+		if err != nil {
+			return nil, err
+		}
+		aggCols[i] = f.columns[ci]
+		if (a.op == "sum" || a.op == "avg") && aggCols[i].kind != "number" && aggCols[i].kind != "" {
+			return nil, fmt.Errorf("%s(%s): column is %s, not number", a.op, a.column, aggCols[i].kind)
+		}
+	}
+
+	// Group the row indexes
+	groups := map[string]int{}
+	members := [][]int{}
+	var keyText strings.Builder
+	for i := 0; i < f.rows; i++ {
+		keyText.Reset()
+		for _, c := range keyCols {
+			if c.isNull(i) {
+				keyText.WriteString("\x00null")
+			} else {
+				keyText.WriteString(c.kind)
+				keyText.WriteByte(':')
+				keyText.WriteString(c.key(i))
+			}
+			keyText.WriteByte('\x1f')
+		}
+		g, ok := groups[keyText.String()]
+		if !ok {
+			g = len(members)
+			groups[keyText.String()] = g
+			members = append(members, nil)
+		}
+		members[g] = append(members[g], i)
+	}
+
+	firstRows := make([]int, len(members))
+	for g, rows := range members {
+		firstRows[g] = rows[0]
+	}
+	out := &DataFrame{rows: len(members)}
+	for i, k := range keys {
+		out.names = append(out.names, k)
+		out.columns = append(out.columns, keyCols[i].take(firstRows))
+	}
+	for i, a := range aggs {
+		col := &frameColumn{}
+		for _, rows := range members {
+			col.appendValue(aggregateFrameRows(a.op, aggCols[i], rows))
+		}
+		out.names = append(out.names, a.name)
+		out.columns = append(out.columns, col)
+	}
+	return out, nil
+}
+
+func aggregateFrameRows(op string, c *frameColumn, rows []int) interface{} {
+	if c == nil {
+		return float64(len(rows))
+	}
+	present := make([]int, 0, len(rows))
+	for _, i := range rows {
+		if !c.isNull(i) {
+			present = append(present, i)
+		}
+	}
+	switch op {
+	case "count":
+		return float64(len(present))
+	case "sum", "avg":
+		if len(present) == 0 {
+			return nil
+		}
+		sum := 0.0
+		for _, i := range present {
+			sum += c.nums[i]
+		}
+		if op == "avg" {
+			return sum / float64(len(present))
+		}
+		return sum
+	case "min", "max":
+		if len(present) == 0 {
+			return nil
+		}
+		best := present[0]
+		for _, i := range present[1:] {
+			cmp := c.compare(i, best)
+			if (op == "min" && cmp < 0) || (op == "max" && cmp > 0) {
+				best = i
+			}
+		}
+		return c.value(best)
+	case "first":
+		if len(present) == 0 {
+			return nil
+		}
+		return c.value(present[0])
+	case "last":
+		if len(present) == 0 {
+			return nil
+		}
+		return c.value(present[len(present)-1])
+	}
+	return nil
+}
+
+// join returns the rows of f joined with the rows of right whose rightKey
+// column matches f's leftKey column, as csvJoin joins views: keys compare
+// as text, nulls never match, a left join keeps rows of f without a
+// match, and right columns named like a column of f get a "_right" suffix.
+func (f *DataFrame) join(right *DataFrame, leftKey, rightKey string, leftJoin bool) (*DataFrame, error) {
+	li, err := f.columnIndex(leftKey)
+	if err != nil {
+		return nil, err
+	}
+	ri, err := right.columnIndex(rightKey)
+	if err != nil {
+		return nil, err
+	}
+	matches := map[string][]int{}
+	rk := right.columns[ri]
+	for j := 0; j < right.rows; j++ {
+		if !rk.isNull(j) {
+			matches[rk.key(j)] = append(matches[rk.key(j)], j)
+		}
+	}
+	lk := f.columns[li]
+	leftIdx, rightIdx := []int{}, []int{}
+	for i := 0; i < f.rows; i++ {
+		var found []int
+		if !lk.isNull(i) {
+			found = matches[lk.key(i)]
+		}
+		if len(found) == 0 && leftJoin {
+			leftIdx, rightIdx = append(leftIdx, i), append(rightIdx, -1)
+		}
+		for _, j := range found {
+			leftIdx, rightIdx = append(leftIdx, i), append(rightIdx, j)
+		}
+	}
+
+	out := f.takeRows(leftIdx)
+	out.names = append([]string(nil), f.names...)
+	taken := map[string]bool{}
+	for _, name := range out.names {
+		taken[name] = true
+	}
+	for j, c := range right.columns {
+		if j == ri {
+			continue
+		}
+		name := right.names[j]
+		for taken[name] {
+			name += "_right"
+		}
+		taken[name] = true
+		out.names = append(out.names, name)
+		out.columns = append(out.columns, c.take(rightIdx))
+	}
+	return out, nil
+}
+
+// csvView is a view of the rows of f, so that saveCSV, csvJoin and the
+// other view functions accept DataFrames.
+func (f *DataFrame) csvView() *CSVView {
+	types := make([]string, len(f.columns))
+	for i, c := range f.columns {
+		types[i] = c.kind
+		if c.kind == "" || c.kind == "any" {
+			types[i] = "string"
+		}
+	}
+	return &CSVView{
+		columns: f.Columns(),
+		types:   types,
+		open: func() (csvRowIterator, error) {
+			return &frameRowIterator{frame: f}, nil
+		},
+	}
+}
+
+// frameRowIterator returns the rows of a DataFrame as native values.
+type frameRowIterator struct {
+	frame *DataFrame
+	row   int
+}
+
+func (it *frameRowIterator) next() ([]interface{}, error) {
+	if it.row == it.frame.rows {
+		return nil, io.EOF
+	}
+	out := make([]interface{}, len(it.frame.columns))
+	for i, c := range it.frame.columns {
+		out[i] = c.native(it.row)
+	}
+	it.row++
+	return out, nil
+}
+
+func (it *frameRowIterator) close() error { return nil }
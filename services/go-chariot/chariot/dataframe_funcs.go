@@ -0,0 +1,657 @@
+package chariot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// sqlIdentifierPattern matches the table and column names tableToSQL
+// writes into its INSERT statements, which cannot be bound as parameters.
+var sqlIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// tableToSQLBatch is how many rows tableToSQL inserts per InsertBatch call.
+const tableToSQLBatch = 1000
+
+func frameArg(arg Value) (*DataFrame, error) {
+	f, ok := unwrapCSVArg(arg).(*DataFrame)
+	if !ok {
+		return nil, fmt.Errorf("expected a table, got %T", unwrapCSVArg(arg))
+	}
+	return f, nil
+}
+
+// frameNamesArg accepts a column name or an array of them.
+func frameNamesArg(arg Value) ([]string, error) {
+	switch c := unwrapCSVArg(arg).(type) {
+	case Str:
+		return []string{string(c)}, nil
+	case *ArrayValue:
+		names := make([]string, 0, c.Length())
+		for i := 0; i < c.Length(); i++ {
+			name, ok := unwrapCSVArg(c.Get(i)).(Str)
+			if !ok {
+				return nil, fmt.Errorf("column names must be strings, got %T", c.Get(i))
+			}
+			names = append(names, string(name))
+		}
+		return names, nil
+	default:
+		return nil, fmt.Errorf("columns must be a column name or an array of them, got %T", c)
+	}
+}
+
+// frameRowValue is row i of f as a map of column to value, DBNull for nulls.
+func frameRowValue(f *DataFrame, i int) *MapValue {
+	row := NewMap()
+	for j, name := range f.names {
+		row.Set(name, f.columns[j].value(i))
+	}
+	return row
+}
+
+func sqlNodeArg(rt *Runtime, arg Value) (*SQLNode, error) {
+	nodeName, ok := unwrapCSVArg(arg).(Str)
+	if !ok {
+		return nil, fmt.Errorf("node name must be a string")
+	}
+	obj, exists := rt.objects[string(nodeName)]
+	if !exists {
+		return nil, fmt.Errorf("SQL node '%s' not found", nodeName)
+	}
+	sqlNode, ok := obj.(*SQLNode)
+	if !ok {
+		return nil, fmt.Errorf("object '%s' is not a SQL node", nodeName)
+	}
+	return sqlNode, nil
+}
+
+// querySQLFrame runs query on sqlNode, reading its rows straight into a
+// DataFrame.
+func querySQLFrame(rt *Runtime, sqlNode *SQLNode, query string, args []Value) (*DataFrame, error) {
+	params := make([]interface{}, len(args))
+	for i, arg := range args {
+		params[i] = convertToInterface(unwrapCSVArg(arg))
+	}
+	var f *DataFrame
+	var row []interface{}
+	var interruptErr error
+	err := sqlNode.QuerySQLStream(query, func(i int, values map[string]interface{}) bool {
+		if f == nil {
+			f = newDataFrame(append([]string(nil), sqlNode.GetColumnNames()...), nil)
+			row = make([]interface{}, len(f.names))
+		}
+		if i%1000 == 0 {
+			if interruptErr = rt.interrupted(); interruptErr != nil {
+				return false
+			}
+		}
+		for j, name := range f.names {
+			row[j] = values[name]
+		}
+		f.appendRow(row)
+		return true
+	}, params...)
+	if err == nil {
+		err = interruptErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		f = newDataFrame(append([]string(nil), sqlNode.GetColumnNames()...), nil)
+	}
+	return f, nil
+}
+
+// saveArrow writes f to the data file name as Arrow IPC. The format is a
+// stream for names ending in .arrows, and a file, which pandas also reads
+// as Feather, otherwise; options may set format and batchSize.
+func saveArrow(f *DataFrame, name string, opts *MapValue) error {
+	file := !strings.HasSuffix(strings.ToLower(name), ".arrows")
+	batchSize := 65536
+	if opts != nil {
+		for k, v := range opts.Values {
+			switch v = unwrapCSVArg(v); k {
+			case "format":
+				switch v {
+				case Str("file"):
+					file = true
+				case Str("stream"):
+					file = false
+				default:
+					return fmt.Errorf("format must be 'file' or 'stream', got %v", v)
+				}
+			case "batchSize":
+				n, ok := v.(Number)
+				if !ok || n < 1 {
+					return fmt.Errorf("batchSize must be a positive number, got %v", v)
+				}
+				batchSize = int(n)
+			default:
+				return fmt.Errorf("unknown Arrow option %q", k)
+			}
+		}
+	}
+	fullPath, err := getSecureFilePath(name, "data")
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(fullPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	if err := writeArrow(w, f, file, batchSize); err != nil {
+		out.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// arrowOptionsArg accepts an optional map of Arrow options.
+func arrowOptionsArg(args []Value, i int) (*MapValue, error) {
+	if len(args) <= i {
+		return nil, nil
+	}
+	opts, ok := unwrapCSVArg(args[i]).(*MapValue)
+	if !ok {
+		return nil, fmt.Errorf("options must be a map, got %T", unwrapCSVArg(args[i]))
+	}
+	return opts, nil
+}
+
+// RegisterDataFrameFunctions registers the functions of tables held by
+// column: conversion from and to CSV, JSON and SQL, and the relational
+// operations on them.
+func RegisterDataFrameFunctions(rt *Runtime) {
+	// tableFromCSV(source, [options]) -> table
+	rt.Register("tableFromCSV", func(args ...Value) (Value, error) {
+		if len(args) < 1 || len(args) > 2 {
+			return nil, fmt.Errorf("tableFromCSV requires 1-2 arguments: source, [options]")
+		}
+		var view *CSVView
+		var err error
+		if len(args) == 2 {
+			p, ok := unwrapCSVArg(args[0]).(Str)
+			if !ok {
+				return nil, fmt.Errorf("options need a path, got %T", unwrapCSVArg(args[0]))
+			}
+			opts, ok := unwrapCSVArg(args[1]).(*MapValue)
+			if !ok {
+				return nil, fmt.Errorf("options must be a map, got %T", unwrapCSVArg(args[1]))
+			}
+			dialect, err := csvDialectFromOptions(opts, nil)
+			if err != nil {
+				return nil, err
+			}
+			fullPath, err := getSecureFilePath(string(p), "data")
+			if err != nil {
+				return nil, err
+			}
+			if view, err = openCSVView(fullPath, dialect); err != nil {
+				return nil, fmt.Errorf("tableFromCSV: %v", err)
+			}
+		} else {
+			view, err = csvViewArg(args[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tableFromCSV: %v", err)
+		}
+		f := newDataFrame(view.Columns(), nil)
+		err = view.each(func(row []interface{}) error {
+			if f.rows%1000 == 0 {
+				if err := rt.interrupted(); err != nil {
+					return err
+				}
+			}
+			f.appendRow(row)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("tableFromCSV: %v", err)
+		}
+		return f, nil
+	})
+
+	// tableToCSV(table, path, [includeHeaders]) -> true
+	rt.Register("tableToCSV", func(args ...Value) (Value, error) {
+		if len(args) < 2 || len(args) > 3 {
+			return nil, fmt.Errorf("tableToCSV requires 2-3 arguments: table, path, [includeHeaders]")
+		}
+		f, err := frameArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		p, ok := unwrapCSVArg(args[1]).(Str)
+		if !ok {
+			return nil, fmt.Errorf("path must be string, got %T", unwrapCSVArg(args[1]))
+		}
+		includeHeaders := true
+		if len(args) == 3 {
+			b, ok := unwrapCSVArg(args[2]).(Bool)
+			if !ok {
+				return nil, fmt.Errorf("includeHeaders must be boolean, got %T", unwrapCSVArg(args[2]))
+			}
+			includeHeaders = bool(b)
+		}
+		fullPath, err := getSecureFilePath(string(p), "data")
+		if err != nil {
+			return nil, err
+		}
+		return writeCSVView(f.csvView(), fullPath, includeHeaders)
+	})
+
+	// tableFromJSON(source) -> table
+	rt.Register("tableFromJSON", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("tableFromJSON requires 1 argument: source")
+		}
+		var data interface{}
+		switch s := unwrapCSVArg(args[0]).(type) {
+		case *JSONNode:
+			data = s.GetJSONValue()
+		case *ArrayValue:
+			data = ConvertToNativeJSON(s)
+		case Str:
+			if err := json.Unmarshal([]byte(s), &data); err != nil {
+				return nil, fmt.Errorf("tableFromJSON: invalid JSON: %v", err)
+			}
+		default:
+			return nil, fmt.Errorf("source must be a JSON node, an array or a JSON string, got %T", s)
+		}
+		rows, ok := data.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("tableFromJSON: source must hold an array of rows, got %T", data)
+		}
+		f, err := dataFrameFromMaps(rows)
+		if err != nil {
+			return nil, fmt.Errorf("tableFromJSON: %v", err)
+		}
+		return f, nil
+	})
+
+	// tableToJSON(table) -> node of rows, as loadCSV returns them
+	rt.Register("tableToJSON", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("tableToJSON requires 1 argument: table")
+		}
+		f, err := frameArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		node := NewJSONNode("table_data")
+		node.SetJSONValue(f.rowMaps())
+		return node, nil
+	})
+
+	// tableFromSQL(nodeName, query, [params...]) -> table
+	rt.Register("tableFromSQL", func(args ...Value) (Value, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("tableFromSQL requires at least 2 arguments: nodeName, query, [params...]")
+		}
+		sqlNode, err := sqlNodeArg(rt, args[0])
+		if err != nil {
+			return nil, err
+		}
+		query, ok := unwrapCSVArg(args[1]).(Str)
+		if !ok {
+			return nil, fmt.Errorf("query must be a string")
+		}
+		f, err := querySQLFrame(rt, sqlNode, string(query), args[2:])
+		if err != nil {
+			return nil, fmt.Errorf("tableFromSQL: %v", err)
+		}
+		return f, nil
+	})
+
+	// tableToSQL(table, nodeName, tableName) -> rows inserted
+	rt.Register("tableToSQL", func(args ...Value) (Value, error) {
+		if len(args) != 3 {
+			return nil, fmt.Errorf("tableToSQL requires 3 arguments: table, nodeName, tableName")
+		}
+		f, err := frameArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		sqlNode, err := sqlNodeArg(rt, args[1])
+		if err != nil {
+			return nil, err
+		}
+		tableName, ok := unwrapCSVArg(args[2]).(Str)
+		if !ok {
+			return nil, fmt.Errorf("table name must be a string")
+		}
+		for _, name := range append([]string{string(tableName)}, f.names...) {
+			if !sqlIdentifierPattern.MatchString(name) {
+				return nil, fmt.Errorf("tableToSQL: '%s' is not a valid SQL identifier", name)
+			}
+		}
+
+		// InsertBatch inserts into the table the node's metadata names
+		previous, hadTable := sqlNode.GetMeta("tableName")
+		sqlNode.SetMeta("tableName", string(tableName))
+		defer func() {
+			if hadTable {
+				sqlNode.SetMeta("tableName", previous)
+			} else {
+				sqlNode.SetMeta("tableName", "")
+			}
+		}()
+
+		// Insert in a transaction of our own unless the script began one
+		ownTx := sqlNode.tx == nil
+		if ownTx {
+			if err := sqlNode.Begin(); err != nil {
+				return nil, fmt.Errorf("tableToSQL: %v", err)
+			}
+		}
+		batch := make([]map[string]interface{}, 0, tableToSQLBatch)
+		for i := 0; i < f.rows; i++ {
+			batch = append(batch, f.rowMap(i))
+			if len(batch) == tableToSQLBatch || i == f.rows-1 {
+				if err = rt.interrupted(); err == nil {
+					err = sqlNode.InsertBatch(batch)
+				}
+				if err != nil {
+					if ownTx {
+						sqlNode.Rollback()
+					}
+					return nil, fmt.Errorf("tableToSQL: %v", err)
+				}
+				batch = batch[:0]
+			}
+		}
+		if ownTx {
+			if err := sqlNode.Commit(); err != nil {
+				return nil, fmt.Errorf("tableToSQL: %v", err)
+			}
+		}
+		return Number(f.rows), nil
+	})
+
+	// tableFromArrow(path) -> table
+	rt.Register("tableFromArrow", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("tableFromArrow requires 1 argument: path")
+		}
+		p, ok := unwrapCSVArg(args[0]).(Str)
+		if !ok {
+			return nil, fmt.Errorf("path must be string, got %T", unwrapCSVArg(args[0]))
+		}
+		fullPath, err := getSecureFilePath(string(p), "data")
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(fullPath)
+		if err != nil {
+			return nil, fmt.Errorf("tableFromArrow: %v", err)
+		}
+		f, err := readArrow(data)
+		if err != nil {
+			return nil, fmt.Errorf("tableFromArrow: %v", err)
+		}
+		return f, nil
+	})
+
+	// tableToArrow(table, path, [options]) -> true
+	rt.Register("tableToArrow", func(args ...Value) (Value, error) {
+		if len(args) < 2 || len(args) > 3 {
+			return nil, fmt.Errorf("tableToArrow requires 2-3 arguments: table, path, [options]")
+		}
+		f, err := frameArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		p, ok := unwrapCSVArg(args[1]).(Str)
+		if !ok {
+			return nil, fmt.Errorf("path must be string, got %T", unwrapCSVArg(args[1]))
+		}
+		opts, err := arrowOptionsArg(args, 2)
+		if err != nil {
+			return nil, err
+		}
+		if err := saveArrow(f, string(p), opts); err != nil {
+			return nil, fmt.Errorf("tableToArrow: %v", err)
+		}
+		return Bool(true), nil
+	})
+
+	// sqlToArrow(nodeName, query, path, [params...]) -> rows written
+	rt.Register("sqlToArrow", func(args ...Value) (Value, error) {
+		if len(args) < 3 {
+			return nil, fmt.Errorf("sqlToArrow requires at least 3 arguments: nodeName, query, path, [params...]")
+		}
+		sqlNode, err := sqlNodeArg(rt, args[0])
+		if err != nil {
+			return nil, err
+		}
+		query, ok := unwrapCSVArg(args[1]).(Str)
+		if !ok {
+			return nil, fmt.Errorf("query must be a string")
+		}
+		p, ok := unwrapCSVArg(args[2]).(Str)
+		if !ok {
+			return nil, fmt.Errorf("path must be string, got %T", unwrapCSVArg(args[2]))
+		}
+		f, err := querySQLFrame(rt, sqlNode, string(query), args[3:])
+		if err == nil {
+			err = saveArrow(f, string(p), nil)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sqlToArrow: %v", err)
+		}
+		return Number(f.rows), nil
+	})
+
+	// tableFilter(table, function) or tableFilter(table, column, operator, value) -> table
+	rt.Register("tableFilter", func(args ...Value) (Value, error) {
+		if len(args) != 2 && len(args) != 4 {
+			return nil, fmt.Errorf("tableFilter requires 2 or 4 arguments: table, function or table, column, operator, value")
+		}
+		f, err := frameArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 4 {
+			column, ok := unwrapCSVArg(args[1]).(Str)
+			if !ok {
+				return nil, fmt.Errorf("column must be a string, got %T", unwrapCSVArg(args[1]))
+			}
+			op, ok := unwrapCSVArg(args[2]).(Str)
+			if !ok {
+				return nil, fmt.Errorf("operator must be a string, got %T", unwrapCSVArg(args[2]))
+			}
+			filtered, err := f.filterColumn(string(column), string(op), unwrapCSVArg(args[3]))
+			if err != nil {
+				return nil, fmt.Errorf("tableFilter: %v", err)
+			}
+			return filtered, nil
+		}
+		fn, ok := unwrapCSVArg(args[1]).(*FunctionValue)
+		if !ok {
+			return nil, fmt.Errorf("second argument must be a function, got %T", unwrapCSVArg(args[1]))
+		}
+		return f.filterRows(func(i int) (bool, error) {
+			if err := rt.interrupted(); err != nil {
+				return false, err
+			}
+			result, err := executeFunctionValue(rt, fn, []Value{frameRowValue(f, i)})
+			if err != nil {
+				return false, err
+			}
+			return result == Bool(true), nil
+		})
+	})
+
+	// tableSelect(table, columns) -> table
+	rt.Register("tableSelect", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("tableSelect requires 2 arguments: table, columns")
+		}
+		f, err := frameArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		names, err := frameNamesArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		selected, err := f.selectColumns(names)
+		if err != nil {
+			return nil, fmt.Errorf("tableSelect: %v", err)
+		}
+		return selected, nil
+	})
+
+	// tableSort(table, columns) -> table
+	rt.Register("tableSort", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("tableSort requires 2 arguments: table, columns")
+		}
+		f, err := frameArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		keys, err := frameNamesArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		sorted, err := f.sortRows(keys)
+		if err != nil {
+			return nil, fmt.Errorf("tableSort: %v", err)
+		}
+		return sorted, nil
+	})
+
+	// tableGroupBy(table, keys, aggregations) -> table
+	rt.Register("tableGroupBy", func(args ...Value) (Value, error) {
+		if len(args) != 3 {
+			return nil, fmt.Errorf("tableGroupBy requires 3 arguments: table, keys, aggregations")
+		}
+		f, err := frameArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		keys, err := frameNamesArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		specs, ok := unwrapCSVArg(args[2]).(*MapValue)
+		if !ok {
+			return nil, fmt.Errorf("aggregations must be a map of column name to aggregation, got %T", unwrapCSVArg(args[2]))
+		}
+		aggs := []frameAggregate{}
+		for _, name := range specs.Keys() {
+			v, _ := specs.Get(name)
+			spec, ok := unwrapCSVArg(v).(Str)
+			if !ok {
+				return nil, fmt.Errorf("aggregation for '%s' must be a string such as 'sum(total)', got %T", name, unwrapCSVArg(v))
+			}
+			agg, err := parseFrameAggregate(name, string(spec))
+			if err != nil {
+				return nil, fmt.Errorf("tableGroupBy: %v", err)
+			}
+			aggs = append(aggs, agg)
+		}
+		grouped, err := f.groupBy(keys, aggs)
+		if err != nil {
+			return nil, fmt.Errorf("tableGroupBy: %v", err)
+		}
+		return grouped, nil
+	})
+
+	// tableJoin(left, right, on, [options]) -> table
+	rt.Register("tableJoin", func(args ...Value) (Value, error) {
+		if len(args) < 3 || len(args) > 4 {
+			return nil, fmt.Errorf("tableJoin requires 3-4 arguments: left, right, on, [options]")
+		}
+		left, err := frameArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		right, err := frameArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		on, err := frameNamesArg(args[2])
+		if err != nil || len(on) == 0 || len(on) > 2 {
+			return nil, fmt.Errorf("on must be a column name or an array of a left and a right column name")
+		}
+		leftKey, rightKey := on[0], on[len(on)-1]
+		leftJoin := false
+		if len(args) == 4 {
+			opts, ok := unwrapCSVArg(args[3]).(*MapValue)
+			if !ok {
+				return nil, fmt.Errorf("options must be a map, got %T", unwrapCSVArg(args[3]))
+			}
+			for k, v := range opts.Values {
+				if k != "type" {
+					return nil, fmt.Errorf("unknown tableJoin option %q", k)
+				}
+				switch unwrapCSVArg(v) {
+				case Str("inner"):
+				case Str("left"):
+					leftJoin = true
+				default:
+					return nil, fmt.Errorf("join type must be 'inner' or 'left', got %v", v)
+				}
+			}
+		}
+		joined, err := left.join(right, leftKey, rightKey, leftJoin)
+		if err != nil {
+			return nil, fmt.Errorf("tableJoin: %v", err)
+		}
+		return joined, nil
+	})
+
+	// tableColumns(table) -> [string]
+	rt.Register("tableColumns", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("tableColumns requires 1 argument: table")
+		}
+		f, err := frameArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return convertFromNativeValue(f.Columns()), nil
+	})
+
+	// tableRowCount(table) -> number
+	rt.Register("tableRowCount", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("tableRowCount requires 1 argument: table")
+		}
+		f, err := frameArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return Number(f.rows), nil
+	})
+
+	// tableRow(table, index) -> map
+	rt.Register("tableRow", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("tableRow requires 2 arguments: table, index")
+		}
+		f, err := frameArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		n, ok := unwrapCSVArg(args[1]).(Number)
+		if !ok {
+			return nil, fmt.Errorf("index must be a number, got %T", unwrapCSVArg(args[1]))
+		}
+		if int(n) < 0 || int(n) >= f.rows {
+			return nil, fmt.Errorf("row %d out of range", int(n))
+		}
+		return frameRowValue(f, int(n)), nil
+	})
+}
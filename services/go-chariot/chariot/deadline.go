@@ -0,0 +1,125 @@
+package chariot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDeadlineExceeded is the error a program fails with once the time given
+// to withTimeout has passed.
+var ErrDeadlineExceeded = errors.New("deadline exceeded")
+
+// runDeadline is the time the program running on a runtime must finish by,
+// and the error it fails with afterwards: ErrDeadlineExceeded for
+// withTimeout, the context's error for ExecContext.
+type runDeadline struct {
+	at  time.Time
+	err error
+	ctx context.Context // Done at the deadline; see Context
+}
+
+// deadlineCheck fails once the runtime's deadline, if any, has passed.
+func (rt *Runtime) deadlineCheck() error {
+	if !rt.deadline.at.IsZero() && !time.Now().Before(rt.deadline.at) {
+		return rt.deadline.err
+	}
+	return nil
+}
+
+// Deadline returns the time the program running on rt must finish by, the
+// nearest of the enclosing withTimeout calls and the deadline of the
+// context it runs under, or false when there is none.
+func (rt *Runtime) Deadline() (time.Time, bool) {
+	return rt.deadline.at, !rt.deadline.at.IsZero()
+}
+
+// Context returns the context external calls hand to the databases and
+// services they call, so that those give up at the runtime's deadline.
+// Without a deadline it is never done.
+func (rt *Runtime) Context() context.Context {
+	if rt.deadline.ctx != nil {
+		return rt.deadline.ctx
+	}
+	return context.Background()
+}
+
+// setDeadline narrows the runtime's deadline to at, failing with err once it
+// passes, and returns the function that restores the one before. The
+// context of external calls is derived from parent.
+func (rt *Runtime) setDeadline(parent context.Context, at time.Time, err error) func() {
+	prev := rt.deadline
+	if !prev.at.IsZero() && !at.Before(prev.at) {
+		return func() {}
+	}
+	ctx, cancel := context.WithDeadline(parent, at)
+	rt.deadline = runDeadline{at: at, err: err, ctx: ctx}
+	return func() {
+		cancel()
+		rt.deadline = prev
+	}
+}
+
+// afterDeadline fails the external call name once the runtime's deadline
+// has passed while it ran. Calls that pass on Context are cut short there;
+// the answer of one that returns late anyway is dropped.
+func (rt *Runtime) afterDeadline(name string, val Value, err error) (Value, error) {
+	if derr := rt.deadlineCheck(); derr != nil {
+		return nil, fmt.Errorf("%s: %w", name, derr)
+	}
+	return val, err
+}
+
+// RegisterDeadlineFunctions registers withTimeout and deadlineRemaining.
+func RegisterDeadlineFunctions(rt *Runtime) {
+	// withTimeout(ms, function, [fallback]) runs function with no arguments
+	// and returns its result, but gives up once ms milliseconds have passed:
+	// statements stop running, database, MCP, notification and certificate
+	// calls are cut short, and the answer of a plugin call that returns late
+	// is dropped. It then returns fallback, or fails when there is none. An
+	// enclosing deadline that is nearer still applies.
+	rt.Register("withTimeout", func(args ...Value) (Value, error) {
+		if len(args) < 2 || len(args) > 3 {
+			return nil, errors.New("withTimeout requires 2-3 arguments: milliseconds, function, [fallback]")
+		}
+		ms, ok := args[0].(Number)
+		if !ok || ms <= 0 {
+			return nil, errors.New("withTimeout: milliseconds must be a positive number")
+		}
+		fn, ok := args[1].(*FunctionValue)
+		if !ok {
+			return nil, fmt.Errorf("withTimeout: expected function value, got %T", args[1])
+		}
+		deadline := time.Now().Add(time.Duration(float64(ms) * float64(time.Millisecond)))
+		restore := rt.setDeadline(rt.Context(), deadline, ErrDeadlineExceeded)
+		val, err := executeFunctionValue(rt, fn, nil)
+		restore()
+		// Only its own deadline is given up on; a nearer one that passed
+		// fails the enclosing call
+		if err == nil || !errors.Is(err, ErrDeadlineExceeded) || time.Now().Before(deadline) {
+			return val, err
+		}
+		if len(args) == 3 {
+			return args[2], nil
+		}
+		return nil, fmt.Errorf("withTimeout: gave up after %v ms: %w", ms, ErrDeadlineExceeded)
+	})
+
+	// deadlineRemaining() returns the milliseconds left before the nearest
+	// deadline, 0 once it has passed, or -1 when there is none.
+	rt.Register("deadlineRemaining", func(args ...Value) (Value, error) {
+		if len(args) != 0 {
+			return nil, errors.New("deadlineRemaining takes no arguments")
+		}
+		deadline, ok := rt.Deadline()
+		if !ok {
+			return Number(-1), nil
+		}
+		remaining := time.Until(deadline)
+		if remaining < 0 {
+			remaining = 0
+		}
+		return Number(remaining.Milliseconds()), nil
+	})
+}
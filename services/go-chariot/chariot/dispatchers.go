@@ -309,6 +309,9 @@ func RegisterTypeDispatchedFunctions(rt *Runtime) {
 			return nil, fmt.Errorf("attribute key must be a string, got %T", args[1])
 		}
 		value := args[2]
+		if tn, ok := node.(TreeNode); ok {
+			markTreeChanged(tn)
+		}
 
 		// Handle different node types
 		switch n := node.(type) {
@@ -417,6 +420,10 @@ func RegisterTypeDispatchedFunctions(rt *Runtime) {
 			}
 		}
 
+		if tn, ok := args[0].(TreeNode); ok {
+			markTreeChanged(tn)
+		}
+
 		switch args[0].(type) {
 		case map[string]Value:
 			return setPropMap(args...)
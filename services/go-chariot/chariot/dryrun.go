@@ -0,0 +1,137 @@
+package chariot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"go.uber.org/zap"
+)
+
+// PlannedChange is a write a dry run skipped.
+type PlannedChange struct {
+	Func string        `json:"func"`
+	Args []interface{} `json:"args,omitempty"` // null for arguments that cannot be stored
+}
+
+// DryRunReport lists the writes a dry run skipped, in order, with how often
+// each builtin was called.
+type DryRunReport struct {
+	Changes []PlannedChange `json:"changes"`
+	Counts  map[string]int  `json:"counts"`
+}
+
+// Builtins that change data outside the runtime. In a dry run they do
+// nothing and answer with what a successful call usually returns, computed
+// from the arguments.
+var dryRunFunctions = map[string]func(args []Value) Value{
+	"sqlExecute":     func([]Value) Value { return Number(0) },
+	"cbInsert":       dryRunArg(2),
+	"cbUpsert":       dryRunArg(2),
+	"cbReplace":      dryRunArg(2),
+	"cbRemove":       func([]Value) Value { return Str("Document removed") },
+	"writeFile":      dryRunTrue,
+	"deleteFile":     dryRunTrue,
+	"saveCSV":        dryRunTrue,
+	"saveCSVRaw":     dryRunTrue,
+	"saveJSON":       dryRunTrue,
+	"saveJSONRaw":    dryRunTrue,
+	"saveXML":        dryRunTrue,
+	"saveXMLRaw":     dryRunTrue,
+	"saveYAML":       dryRunTrue,
+	"saveYAMLRaw":    dryRunTrue,
+	"tableToCSV":     dryRunTrue,
+	"tableToSQL":     dryRunTableRows,
+	"tableToArrow":   dryRunTrue,
+	"sqlToArrow":     func([]Value) Value { return Number(0) },
+	"treeSave":       dryRunTrue,
+	"treeSaveSecure": dryRunTrue,
+	"treeReencrypt":  dryRunTrue,
+	"sendEmail":      dryRunTrue,
+	"slackPost":      func([]Value) Value { return Str("") },
+}
+
+func dryRunTrue([]Value) Value { return Bool(true) }
+
+// dryRunArg answers with argument i, the document the Couchbase writes
+// return.
+func dryRunArg(i int) func([]Value) Value {
+	return func(args []Value) Value {
+		if i < len(args) {
+			return args[i]
+		}
+		return DBNull
+	}
+}
+
+// dryRunTableRows answers with the number of rows of the table tableToSQL
+// would insert.
+func dryRunTableRows(args []Value) Value {
+	if len(args) > 0 {
+		if f, ok := unwrapCSVArg(args[0]).(*DataFrame); ok {
+			return Number(f.rows)
+		}
+	}
+	return Number(0)
+}
+
+// IsDryRunFunction reports whether a dry run skips the builtin name.
+func IsDryRunFunction(name string) bool {
+	_, ok := dryRunFunctions[name]
+	return ok
+}
+
+type dryRunState struct {
+	report DryRunReport
+}
+
+// StartDryRun makes the writing builtins of the programs rt runs from now on
+// do nothing; each skipped call is logged and listed in the report StopDryRun
+// returns. Reads still go to the databases and files.
+func (rt *Runtime) StartDryRun() {
+	rt.dryRun = &dryRunState{report: DryRunReport{Changes: []PlannedChange{}, Counts: map[string]int{}}}
+}
+
+// StopDryRun ends the dry run and returns the writes it skipped, or nil when
+// none was running.
+func (rt *Runtime) StopDryRun() *DryRunReport {
+	ds := rt.dryRun
+	rt.dryRun = nil
+	if ds == nil {
+		return nil
+	}
+	return &ds.report
+}
+
+// planCall records a write skipped by the dry run and returns the answer
+// standing in for it.
+func (rt *Runtime) planCall(name string, args []Value) Value {
+	change := PlannedChange{Func: name}
+	shown := make([]string, 0, len(args))
+	for _, a := range args {
+		v, ok := traceValue(a)
+		change.Args = append(change.Args, v)
+		shown = append(shown, dryRunArgText(a, v, ok))
+	}
+	ds := rt.dryRun
+	ds.report.Changes = append(ds.report.Changes, change)
+	ds.report.Counts[name]++
+	msg := fmt.Sprintf("%s(%s)", name, strings.Join(shown, ", "))
+	cfg.ChariotLogger.Info("Dry run skipped write", zap.String("call", msg))
+	rt.WriteLog("INFO", "[dry run] "+msg)
+	return dryRunFunctions[name](args)
+}
+
+// dryRunArgText shortens an argument for the log.
+func dryRunArgText(a Value, stored interface{}, ok bool) string {
+	const limit = 120
+	data, err := json.Marshal(stored)
+	if !ok || err != nil {
+		return fmt.Sprintf("<%T>", a)
+	}
+	if len(data) <= limit {
+		return string(data)
+	}
+	return string(data[:limit]) + "..."
+}
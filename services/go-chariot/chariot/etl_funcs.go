@@ -478,7 +478,7 @@ func RegisterETLFunctions(rt *Runtime) {
 
 				for j, header := range headers {
 					if j < len(row) {
-						rowNode.Set(header, Str(row[j]))
+						rowNode.Set(header, InternStr(row[j]))
 					}
 				}
 
@@ -559,11 +559,11 @@ func RegisterETLFunctions(rt *Runtime) {
 							// Handle both int64 and float64 from parseNumber
 							switch n := num.(type) {
 							case float64:
-								rowNode.Set(header, Number(n))
+								rowNode.Set(header, BoxNumber(n))
 							case int64:
-								rowNode.Set(header, Number(float64(n)))
+								rowNode.Set(header, BoxNumber(float64(n)))
 							default:
-								rowNode.Set(header, Number(float64(n.(int))))
+								rowNode.Set(header, BoxNumber(float64(n.(int))))
 							}
 						} else if value == "true" {
 							rowNode.Set(header, Bool(true))
@@ -572,7 +572,7 @@ func RegisterETLFunctions(rt *Runtime) {
 						} else if value == "" {
 							rowNode.Set(header, DBNull)
 						} else {
-							rowNode.Set(header, Str(value))
+							rowNode.Set(header, InternStr(value))
 						}
 					}
 				}
@@ -589,11 +589,11 @@ func RegisterETLFunctions(rt *Runtime) {
 						// Handle both int64 and float64 from parseNumber
 						switch n := num.(type) {
 						case float64:
-							rowArray.Append(Number(n))
+							rowArray.Append(BoxNumber(n))
 						case int64:
-							rowArray.Append(Number(float64(n)))
+							rowArray.Append(BoxNumber(float64(n)))
 						default:
-							rowArray.Append(Number(float64(n.(int))))
+							rowArray.Append(BoxNumber(float64(n.(int))))
 						}
 					} else if value == "true" {
 						rowArray.Append(Bool(true))
@@ -602,7 +602,7 @@ func RegisterETLFunctions(rt *Runtime) {
 					} else if value == "" {
 						rowArray.Append(DBNull)
 					} else {
-						rowArray.Append(Str(value))
+						rowArray.Append(InternStr(value))
 					}
 				}
 				result.Append(rowArray)
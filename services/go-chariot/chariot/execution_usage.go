@@ -0,0 +1,119 @@
+package chariot
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ExecutionUsage counts what one run took from outside the runtime, so its
+// cost can be attributed: the calls of builtins that reach databases, MCP
+// servers, notification services and plugins, and the rows queries returned
+// or statements changed.
+type ExecutionUsage struct {
+	ExternalCalls int `json:"external_calls"`
+	Rows          int `json:"rows"`
+}
+
+// Builtins counted as external calls. Plugin functions are added as they
+// are registered.
+var meteredFunctions = struct {
+	sync.RWMutex
+	names map[string]bool
+}{names: map[string]bool{
+	"sqlConnect": true, "sqlQuery": true, "sqlExecute": true, "sqlBegin": true,
+	"sqlCommit": true, "sqlRollback": true, "sqlListTables": true,
+	"cbConnect": true, "cbOpenBucket": true, "cbQuery": true, "cbGet": true,
+	"cbInsert": true, "cbUpsert": true, "cbReplace": true, "cbRemove": true,
+	"mcpConnect": true, "mcpListTools": true, "mcpCallTool": true,
+	"sendEmail": true, "slackPost": true, "fetchCertificate": true,
+}}
+
+// Builtins whose answer is rows: the rows returned, or for sqlExecute the
+// number of rows changed.
+var rowFunctions = map[string]bool{"sqlQuery": true, "sqlExecute": true, "cbQuery": true}
+
+// Limits on the tags an execution carries.
+const (
+	MaxExecutionTags  = 16
+	maxTagKeyLength   = 64
+	maxTagValueLength = 128
+)
+
+// ValidateTags checks the tags of an execution, such as team, project or
+// ticket: at most MaxExecutionTags, keys of letters, digits, '_', '-' and
+// '.', and values of up to 128 characters.
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > MaxExecutionTags {
+		return fmt.Errorf("at most %d tags are allowed", MaxExecutionTags)
+	}
+	for key, value := range tags {
+		if key == "" || len(key) > maxTagKeyLength {
+			return fmt.Errorf("tag keys must be 1 to %d characters", maxTagKeyLength)
+		}
+		for _, r := range key {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.') {
+				return fmt.Errorf("tag key '%s' may only contain letters, digits, '_', '-' and '.'", key)
+			}
+		}
+		if len(value) > maxTagValueLength {
+			return fmt.Errorf("tag '%s' is longer than %d characters", key, maxTagValueLength)
+		}
+	}
+	return nil
+}
+
+// MeterFunctions counts calls of the builtins names as external calls.
+func MeterFunctions(names ...string) {
+	meteredFunctions.Lock()
+	defer meteredFunctions.Unlock()
+	for _, n := range names {
+		meteredFunctions.names[n] = true
+	}
+}
+
+// IsMeteredFunction reports whether calls of the builtin name are counted
+// as external calls.
+func IsMeteredFunction(name string) bool {
+	meteredFunctions.RLock()
+	defer meteredFunctions.RUnlock()
+	return meteredFunctions.names[name]
+}
+
+// StartUsage starts counting the external calls and rows of the programs rt
+// runs from now on.
+func (rt *Runtime) StartUsage() {
+	rt.usage = &ExecutionUsage{}
+}
+
+// StopUsage stops counting and returns what was counted since StartUsage,
+// or nil when nothing was being counted.
+func (rt *Runtime) StopUsage() *ExecutionUsage {
+	u := rt.usage
+	rt.usage = nil
+	return u
+}
+
+// note counts a call of the builtin name that answered val.
+func (u *ExecutionUsage) note(name string, val Value, err error) {
+	u.ExternalCalls++
+	if err == nil && rowFunctions[name] {
+		u.Rows += resultRows(val)
+	}
+}
+
+// resultRows is the number of rows in a query's answer.
+func resultRows(val Value) int {
+	switch v := val.(type) {
+	case []interface{}:
+		return len(v)
+	case *ArrayValue:
+		return v.Length()
+	case *SimpleJSON:
+		if rows, ok := v.value.([]interface{}); ok {
+			return len(rows)
+		}
+	case Number:
+		return int(v)
+	}
+	return 0
+}
@@ -0,0 +1,147 @@
+package chariot
+
+import (
+	"sort"
+	"strings"
+)
+
+// Doc comments. The /// lines directly before a function document it:
+//
+//	/// Total of an order line, after the discount.
+//	/// @param price unit price
+//	/// @param qty number of units
+//	/// @return the total, rounded to cents
+//	setq(lineTotal, func(price: N, qty: N): N { ... })
+//
+// The comment is kept with the function (FunctionValue.Doc) and saved with it
+// in the function library. Lines before the first tag are the summary.
+
+// ParamDoc documents one parameter.
+type ParamDoc struct {
+	Name        string `json:"name,omitempty"`
+	Type        string `json:"type,omitempty"` // Type code; "" accepts any value
+	Description string `json:"description,omitempty"`
+}
+
+// FunctionDoc is the reference entry of a builtin or user function.
+type FunctionDoc struct {
+	Name         string     `json:"name"`
+	Signature    string     `json:"signature"`
+	Summary      string     `json:"summary,omitempty"`
+	Params       []ParamDoc `json:"params"`
+	Returns      string     `json:"returns,omitempty"`
+	ReturnType   string     `json:"return_type,omitempty"`
+	Builtin      bool       `json:"builtin,omitempty"`
+	Category     string     `json:"category,omitempty"` // Builtins only
+	Example      string     `json:"example,omitempty"`  // Builtins only
+	Deprecated   bool       `json:"deprecated,omitempty"`
+	Note         string     `json:"note,omitempty"` // Deprecation note
+	Undocumented bool       `json:"undocumented,omitempty"`
+}
+
+// splitDocComment separates the /// lines at the start of code from the
+// rest.
+func splitDocComment(code string) (doc, rest string) {
+	var lines []string
+	rest = code
+	for {
+		trimmed := strings.TrimLeft(rest, " \t\r\n")
+		if !strings.HasPrefix(trimmed, "///") {
+			break
+		}
+		line, after, _ := strings.Cut(trimmed[3:], "\n")
+		lines = append(lines, strings.TrimPrefix(strings.TrimRight(line, "\r"), " "))
+		rest = after
+	}
+	if lines == nil {
+		return "", code
+	}
+	return strings.Join(lines, "\n"), rest
+}
+
+// DocumentFunction builds the reference entry of a user function from its
+// doc comment and type annotations.
+func DocumentFunction(name string, fn *FunctionValue) FunctionDoc {
+	d := FunctionDoc{
+		Name:       name,
+		Signature:  name + strings.TrimPrefix(formatSignature(fn.Parameters, fn.ParamTypes, fn.ReturnType), "func"),
+		ReturnType: fn.ReturnType,
+		Params:     make([]ParamDoc, len(fn.Parameters)),
+	}
+	for i, p := range fn.Parameters {
+		d.Params[i].Name = p
+		if i < len(fn.ParamTypes) {
+			d.Params[i].Type = fn.ParamTypes[i]
+		}
+	}
+	d.Undocumented = strings.TrimSpace(fn.Doc) == ""
+
+	var summary []string
+	tagged := false
+	for _, line := range strings.Split(fn.Doc, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "@param"):
+			tagged = true
+			pname, desc, _ := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, "@param")), " ")
+			for i := range d.Params {
+				if d.Params[i].Name == pname {
+					d.Params[i].Description = strings.TrimSpace(desc)
+				}
+			}
+		case strings.HasPrefix(line, "@returns"):
+			tagged = true
+			d.Returns = strings.TrimSpace(strings.TrimPrefix(line, "@returns"))
+		case strings.HasPrefix(line, "@return"):
+			tagged = true
+			d.Returns = strings.TrimSpace(strings.TrimPrefix(line, "@return"))
+		case strings.HasPrefix(line, "@"):
+			tagged = true
+		case !tagged:
+			summary = append(summary, line)
+		}
+	}
+	d.Summary = strings.TrimSpace(strings.Join(summary, "\n"))
+
+	usageMu.RLock()
+	d.Note, d.Deprecated = deprecations[name]
+	usageMu.RUnlock()
+	return d
+}
+
+// documentBuiltin builds the reference entry of a builtin from its metadata
+// and the signature the type checker knows, if any.
+func documentBuiltin(info BuiltinInfo) FunctionDoc {
+	d := FunctionDoc{
+		Name:      info.Name,
+		Signature: info.Signature,
+		Summary:   info.Summary,
+		Builtin:   true,
+		Category:  info.Category,
+		Example:   info.Example,
+		Params:    []ParamDoc{},
+	}
+	if sig, ok := BuiltinSignature(info.Name); ok {
+		d.ReturnType = sig.Result
+		for _, t := range sig.Params {
+			d.Params = append(d.Params, ParamDoc{Type: t})
+		}
+	}
+	return d
+}
+
+// FunctionDocs returns the reference of the builtins, sorted by category and
+// name, and of the user functions registered in rt, sorted by name.
+func FunctionDocs(rt *Runtime) (builtins, functions []FunctionDoc) {
+	infos := Builtins(rt)
+	builtins = make([]FunctionDoc, len(infos))
+	for i, info := range infos {
+		builtins[i] = documentBuiltin(info)
+	}
+	functions = make([]FunctionDoc, 0, len(rt.functions))
+	for name, fn := range rt.functions {
+		functions = append(functions, DocumentFunction(name, fn))
+	}
+	sort.Slice(functions, func(i, j int) bool { return functions[i].Name < functions[j].Name })
+	return builtins, functions
+}
@@ -102,6 +102,14 @@ func GetDataAnalystChariotFunctions() []string {
 		// CSV Node support
 		"csvLoad", "csvSave", "csvParse", "csvFormat",
 		"csvHeaders", "csvRows", "csvColumns",
+		"csvOpen", "csvSelect", "csvFilter", "csvJoin",
+
+		// Columnar tables
+		"tableFromCSV", "tableToCSV", "tableFromJSON", "tableToJSON",
+		"tableFromSQL", "tableToSQL", "tableFilter", "tableSelect",
+		"tableGroupBy", "tableJoin", "tableSort", "tableColumns",
+		"tableRowCount", "tableRow",
+		"tableFromArrow", "tableToArrow", "sqlToArrow",
 
 		// YAML Node support
 		"yamlLoad", "yamlSave", "yamlParse", "yamlFormat",
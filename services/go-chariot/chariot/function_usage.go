@@ -0,0 +1,242 @@
+package chariot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"go.uber.org/zap"
+)
+
+// Usage of stored functions and script files, for finding what the function
+// library no longer needs. A call is counted for functions registered in a
+// runtime by name, such as the library's and those saved from the editor,
+// but not for anonymous functions held in variables; a file is counted each
+// time a script file is executed. Counts are kept per process.
+//
+// A deprecated function still runs, but calling it logs a warning, once per
+// function in each execution's log.
+
+type usageCounter struct {
+	calls atomic.Int64
+	last  atomic.Int64 // UnixNano of the last use
+}
+
+func (u *usageCounter) note() {
+	u.calls.Add(1)
+	u.last.Store(time.Now().UnixNano())
+}
+
+var (
+	usageMu       sync.RWMutex
+	functionUsage = map[string]*usageCounter{}
+	fileUsage     = map[string]*usageCounter{}
+	deprecations  = map[string]string{} // note by deprecated function
+)
+
+func usageCounterFor(m map[string]*usageCounter, name string) *usageCounter {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	u := m[name]
+	if u == nil {
+		u = &usageCounter{}
+		m[name] = u
+	}
+	return u
+}
+
+// noteFunctionCall counts a call of fn when it is a stored function, and
+// warns when that function is deprecated.
+func (rt *Runtime) noteFunctionCall(fn *FunctionValue) {
+	if fn.Name == "" || rt.functions[fn.Name] != fn {
+		return
+	}
+	usageMu.RLock()
+	u := functionUsage[fn.Name]
+	note, deprecated := deprecations[fn.Name]
+	usageMu.RUnlock()
+	if u == nil {
+		u = usageCounterFor(functionUsage, fn.Name)
+	}
+	u.note()
+	if deprecated {
+		rt.warnDeprecated(fn.Name, note)
+	}
+}
+
+func (rt *Runtime) warnDeprecated(name, note string) {
+	if rt.deprecationWarned[name] {
+		return
+	}
+	if rt.deprecationWarned == nil {
+		rt.deprecationWarned = map[string]bool{}
+	}
+	rt.deprecationWarned[name] = true
+	msg := fmt.Sprintf("function '%s' is deprecated", name)
+	if note != "" {
+		msg += ": " + note
+	}
+	cfg.ChariotLogger.Warn("Deprecated function called", zap.String("function", name), zap.String("note", note))
+	rt.WriteLog("WARN", msg)
+}
+
+// RecordFileUse counts an execution of a script file.
+func RecordFileUse(name string) {
+	if name == "" {
+		return
+	}
+	usageMu.RLock()
+	u := fileUsage[name]
+	usageMu.RUnlock()
+	if u == nil {
+		u = usageCounterFor(fileUsage, name)
+	}
+	u.note()
+}
+
+// DeprecateFunction marks a function deprecated, with a note telling
+// callers what to use instead. The function need not be defined.
+func DeprecateFunction(name, note string) {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	deprecations[name] = note
+}
+
+// UndeprecateFunction clears a deprecation and reports whether there was one.
+func UndeprecateFunction(name string) bool {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	_, ok := deprecations[name]
+	delete(deprecations, name)
+	return ok
+}
+
+// UsageEntry is the usage of one function or script file.
+type UsageEntry struct {
+	Name       string    `json:"name"`
+	Calls      int64     `json:"calls"`
+	LastUsed   time.Time `json:"last_used,omitempty"`
+	Deprecated bool      `json:"deprecated,omitempty"`
+	Note       string    `json:"note,omitempty"` // Deprecation note
+}
+
+// UsageReport is the usage of the stored functions and script files, each
+// sorted by name.
+type UsageReport struct {
+	Functions []UsageEntry `json:"functions"`
+	Files     []UsageEntry `json:"files"`
+}
+
+func usageEntries(m map[string]*usageCounter) []UsageEntry {
+	out := make([]UsageEntry, 0, len(m))
+	for name, u := range m {
+		e := UsageEntry{Name: name, Calls: u.calls.Load()}
+		if last := u.last.Load(); last != 0 {
+			e.LastUsed = time.Unix(0, last)
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// Usage reports the usage recorded so far. The functions named in known,
+// typically the library's, are listed even if they were never called, as
+// are the deprecated functions.
+func Usage(known ...string) UsageReport {
+	usageMu.RLock()
+	functions := usageEntries(functionUsage)
+	files := usageEntries(fileUsage)
+	notes := make(map[string]string, len(deprecations))
+	for name, note := range deprecations {
+		notes[name] = note
+	}
+	usageMu.RUnlock()
+
+	seen := make(map[string]bool, len(functions))
+	for _, e := range functions {
+		seen[e.Name] = true
+	}
+	for _, name := range known {
+		if !seen[name] {
+			seen[name] = true
+			functions = append(functions, UsageEntry{Name: name})
+		}
+	}
+	for name := range notes {
+		if !seen[name] {
+			functions = append(functions, UsageEntry{Name: name})
+		}
+	}
+	for i := range functions {
+		functions[i].Note, functions[i].Deprecated = notes[functions[i].Name]
+	}
+	sort.Slice(functions, func(i, j int) bool { return functions[i].Name < functions[j].Name })
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return UsageReport{Functions: functions, Files: files}
+}
+
+// SaveUsage writes the usage and the deprecations to path, so they survive
+// a restart.
+func SaveUsage(path string) error {
+	data, err := json.MarshalIndent(Usage(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadUsage restores the usage and the deprecations SaveUsage wrote to path,
+// replacing those recorded so far. A missing file is not an error.
+func LoadUsage(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved UsageReport
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	restore := func(entries []UsageEntry) map[string]*usageCounter {
+		m := make(map[string]*usageCounter, len(entries))
+		for _, e := range entries {
+			if e.Calls == 0 && e.LastUsed.IsZero() {
+				continue
+			}
+			u := &usageCounter{}
+			u.calls.Store(e.Calls)
+			if !e.LastUsed.IsZero() {
+				u.last.Store(e.LastUsed.UnixNano())
+			}
+			m[e.Name] = u
+		}
+		return m
+	}
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	functionUsage = restore(saved.Functions)
+	fileUsage = restore(saved.Files)
+	deprecations = map[string]string{}
+	for _, e := range saved.Functions {
+		if e.Deprecated {
+			deprecations[e.Name] = e.Note
+		}
+	}
+	return nil
+}
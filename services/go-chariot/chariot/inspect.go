@@ -0,0 +1,336 @@
+package chariot
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrInspectPath is returned when an inspection path does not exist in the runtime.
+var ErrInspectPath = errors.New("inspection path not found")
+
+// InspectState returns the runtime state shown by the editor's runtime panel,
+// converted to plain JSON values. inspectRuntime() returns the same map.
+func (rt *Runtime) InspectState() map[string]interface{} {
+	return map[string]interface{}{
+		"globals":          ConvertToNativeJSON(rt.ListGlobalVariables()),
+		"variables":        ConvertToNativeJSON(rt.ListLocalVariables()),
+		"objects":          ConvertToNativeJSON(rt.ListObjects()),
+		"lists":            ConvertToNativeJSON(rt.ListLists()),
+		"namespaces":       ConvertToNativeJSON(rt.ListNamespaces()),
+		"nodes":            ConvertToNativeJSON(rt.ListNodes()),
+		"tables":           ConvertToNativeJSON(rt.ListTables()),
+		"keycolumns":       ConvertToNativeJSON(rt.ListKeyColumns()),
+		"default_template": rt.DefaultTemplateID,
+		"timeoffset":       rt.timeOffset,
+	}
+}
+
+// RuntimeSize counts what a runtime holds. Bytes approximates its memory
+// use by the size of the inspected state encoded as JSON.
+type RuntimeSize struct {
+	Globals   int `json:"globals"`
+	Variables int `json:"variables"`
+	Objects   int `json:"objects"`
+	Lists     int `json:"lists"`
+	Nodes     int `json:"nodes"`
+	Tables    int `json:"tables"`
+	TableRows int `json:"table_rows"`
+	Functions int `json:"functions"`
+	Bytes     int `json:"bytes"`
+}
+
+// Size measures the runtime's state.
+func (rt *Runtime) Size() RuntimeSize {
+	size := RuntimeSize{
+		Globals:   len(rt.ListGlobalVariables()),
+		Variables: len(rt.ListLocalVariables()),
+		Objects:   len(rt.objects),
+		Lists:     len(rt.lists),
+		Nodes:     len(rt.nodes),
+		Tables:    len(rt.tables),
+		Functions: len(rt.functions),
+	}
+	for _, rows := range rt.tables {
+		size.TableRows += len(rows)
+	}
+	if data, err := json.Marshal(rt.InspectState()); err == nil {
+		size.Bytes = len(data)
+	}
+	return size
+}
+
+// InspectQuery selects part of the runtime state.
+type InspectQuery struct {
+	Path   []string // section, entry name, then object keys or array indexes
+	Depth  int      // nesting levels kept below each entry; 0 keeps everything
+	Offset int      // first entry returned
+	Limit  int      // entries returned; 0 returns all
+	Since  uint64   // cursor of an earlier result; non-zero requests only changes
+}
+
+// InspectChange is an entry that was added or changed since a cursor. Its
+// path is relative to the query path.
+type InspectChange struct {
+	Path  []string    `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// InspectResult is one page of the selected state, or the changes since a cursor.
+type InspectResult struct {
+	Path    []string               `json:"path"`
+	Kind    string                 `json:"kind"` // object, array or value
+	Cursor  uint64                 `json:"cursor"`
+	Total   int                    `json:"total,omitempty"`
+	Offset  int                    `json:"offset,omitempty"`
+	Keys    []string               `json:"keys,omitempty"` // entry order for the page
+	Entries map[string]interface{} `json:"entries,omitempty"`
+	Value   interface{}            `json:"value,omitempty"`
+	Diff    bool                   `json:"diff,omitempty"`
+	Changed []InspectChange        `json:"changed,omitempty"`
+	Removed [][]string             `json:"removed,omitempty"`
+}
+
+// RuntimeInspector answers inspection queries for one session and remembers
+// what it last returned for each path, so a later query can ask for the
+// changes only.
+type RuntimeInspector struct {
+	mu        sync.Mutex
+	cursor    uint64
+	snapshots map[string]*inspectSnapshot
+}
+
+type inspectSnapshot struct {
+	cursor uint64
+	hashes map[string]string // unit key -> content hash
+	paths  map[string][]string
+}
+
+// NewRuntimeInspector creates an inspector with no remembered state.
+func NewRuntimeInspector() *RuntimeInspector {
+	return &RuntimeInspector{snapshots: make(map[string]*inspectSnapshot)}
+}
+
+// Inspect selects q.Path in state. With q.Since set to the cursor of the
+// previous result for the same path it returns the entries that changed or
+// disappeared since then; with any other cursor it returns a full page, so
+// a client that missed a result starts over. Changes are tracked per entry,
+// or per section entry when the whole state is inspected.
+func (in *RuntimeInspector) Inspect(state map[string]interface{}, q InspectQuery) (*InspectResult, error) {
+	root, err := normalizeInspectValue(state)
+	if err != nil {
+		return nil, err
+	}
+	node := root
+	for i, key := range q.Path {
+		next, ok := inspectChild(node, key)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInspectPath, strings.Join(q.Path[:i+1], "."))
+		}
+		node = next
+	}
+	path := append([]string{}, q.Path...)
+
+	// Units are the values whose changes are reported: the entries of each
+	// section at the top level, the entries of the selected value below it
+	units := map[string]interface{}{}
+	unitPaths := map[string][]string{}
+	level := 1
+	if len(q.Path) == 0 {
+		level = 2
+	}
+	collectInspectUnits(node, nil, level, units, unitPaths)
+	hashes := make(map[string]string, len(units))
+	for key, value := range units {
+		hashes[key] = inspectHash(value)
+	}
+
+	in.mu.Lock()
+	scope := strings.Join(path, "\x00")
+	prev := in.snapshots[scope]
+	in.cursor++
+	cursor := in.cursor
+	in.snapshots[scope] = &inspectSnapshot{cursor: cursor, hashes: hashes, paths: unitPaths}
+	in.mu.Unlock()
+
+	res := &InspectResult{Path: path, Kind: inspectKind(node), Cursor: cursor}
+	if q.Since != 0 && prev != nil && prev.cursor == q.Since {
+		res.Diff = true
+		keys := sortedKeys(hashes)
+		for _, key := range keys {
+			if prev.hashes[key] != hashes[key] {
+				res.Changed = append(res.Changed, InspectChange{
+					Path:  unitPaths[key],
+					Value: limitInspectDepth(units[key], q.Depth, append(append([]string{}, path...), unitPaths[key]...)),
+				})
+			}
+		}
+		for _, key := range sortedKeys(prev.hashes) {
+			if _, ok := hashes[key]; !ok {
+				res.Removed = append(res.Removed, prev.paths[key])
+			}
+		}
+		return res, nil
+	}
+
+	var keys []string
+	switch v := node.(type) {
+	case map[string]interface{}:
+		keys = sortedKeys(v)
+	case []interface{}:
+		for i := range v {
+			keys = append(keys, strconv.Itoa(i))
+		}
+	default:
+		res.Value = node
+		return res, nil
+	}
+	res.Total = len(keys)
+	res.Offset = q.Offset
+	if q.Offset > len(keys) {
+		keys = nil
+	} else {
+		keys = keys[q.Offset:]
+	}
+	if q.Limit > 0 && len(keys) > q.Limit {
+		keys = keys[:q.Limit]
+	}
+	res.Keys = keys
+	res.Entries = make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		child, _ := inspectChild(node, key)
+		res.Entries[key] = limitInspectDepth(child, q.Depth, append(append([]string{}, path...), key))
+	}
+	return res, nil
+}
+
+// normalizeInspectValue turns the state into plain maps, slices, strings,
+// numbers and booleans by a round trip through JSON.
+func normalizeInspectValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode runtime state: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var out interface{}
+	if err := dec.Decode(&out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func inspectChild(node interface{}, key string) (interface{}, bool) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		child, ok := v[key]
+		return child, ok
+	case []interface{}:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(v) {
+			return nil, false
+		}
+		return v[i], true
+	}
+	return nil, false
+}
+
+func inspectKind(node interface{}) string {
+	switch node.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return "value"
+}
+
+// collectInspectUnits gathers the values levels below node. A value that is
+// not a container before that depth is a unit itself.
+func collectInspectUnits(node interface{}, prefix []string, levels int, units map[string]interface{}, paths map[string][]string) {
+	if levels == 0 || inspectKind(node) == "value" {
+		if len(prefix) > 0 {
+			key := strings.Join(prefix, "\x00")
+			units[key] = node
+			paths[key] = prefix
+		}
+		return
+	}
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			collectInspectUnits(child, append(append([]string{}, prefix...), key), levels-1, units, paths)
+		}
+	case []interface{}:
+		for i, child := range v {
+			collectInspectUnits(child, append(append([]string{}, prefix...), strconv.Itoa(i)), levels-1, units, paths)
+		}
+	}
+}
+
+func inspectHash(v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha1.Sum(data)
+	return string(sum[:])
+}
+
+// limitInspectDepth keeps depth levels of nesting in v and replaces deeper
+// objects and arrays with a summary carrying the path to fetch them by.
+func limitInspectDepth(v interface{}, depth int, path []string) interface{} {
+	if depth <= 0 {
+		return v
+	}
+	return truncateInspectValue(v, depth, path)
+}
+
+func truncateInspectValue(v interface{}, remaining int, path []string) interface{} {
+	kind := inspectKind(v)
+	if kind == "value" {
+		return v
+	}
+	if remaining == 0 {
+		size := 0
+		switch c := v.(type) {
+		case map[string]interface{}:
+			size = len(c)
+		case []interface{}:
+			size = len(c)
+		}
+		return map[string]interface{}{
+			"$truncated": true,
+			"kind":       kind,
+			"size":       size,
+			"path":       path,
+		}
+	}
+	switch c := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(c))
+		for key, child := range c {
+			out[key] = truncateInspectValue(child, remaining-1, append(append([]string{}, path...), key))
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(c))
+		for i, child := range c {
+			out[i] = truncateInspectValue(child, remaining-1, append(append([]string{}, path...), strconv.Itoa(i)))
+		}
+		return out
+	}
+	return v
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,198 @@
+package chariot
+
+import (
+	"hash/maphash"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// String interning and boxed-value pooling.
+//
+// Large CSV/JSON workloads produce millions of small, highly repetitive cell
+// values ("Y", "N", "0", country codes, status strings, ...). Each one boxed into
+// a Value interface costs a separate heap allocation. The helpers below hand out
+// shared, immutable boxed Values instead so repeated cells point at the same
+// backing data and the GC has far fewer objects to trace.
+
+const (
+	// MaxInternLength is the longest string that will be interned. Longer strings
+	// are rarely duplicated and would only bloat the table.
+	MaxInternLength = 32
+	// maxInternEntries bounds the table so adversarial input cannot grow it forever.
+	// Once full, new strings are boxed normally.
+	maxInternEntries = 1 << 16
+	internShardCount = 64
+
+	// Integral numbers in [minPooledNumber, maxPooledNumber] are pre-boxed.
+	minPooledNumber = -128
+	maxPooledNumber = 1024
+)
+
+type internShard struct {
+	mu      sync.RWMutex
+	entries map[string]Value
+}
+
+// StringInterner deduplicates short strings into shared boxed Str values.
+type StringInterner struct {
+	seed   maphash.Seed
+	shards [internShardCount]internShard
+	size   atomic.Int64
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// InternStats reports interner effectiveness for diagnostics and benchmarks.
+type InternStats struct {
+	Entries int64 `json:"entries"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+}
+
+// NewStringInterner creates an empty interner.
+func NewStringInterner() *StringInterner {
+	si := &StringInterner{seed: maphash.MakeSeed()}
+	for i := range si.shards {
+		si.shards[i].entries = make(map[string]Value)
+	}
+	return si
+}
+
+// Intern returns a boxed Str for s, reusing a previously boxed value when available.
+func (si *StringInterner) Intern(s string) Value {
+	if len(s) > MaxInternLength {
+		return Str(s)
+	}
+	shard := &si.shards[maphash.String(si.seed, s)%internShardCount]
+
+	shard.mu.RLock()
+	v, ok := shard.entries[s]
+	shard.mu.RUnlock()
+	if ok {
+		si.hits.Add(1)
+		return v
+	}
+
+	si.misses.Add(1)
+	if si.size.Load() >= maxInternEntries {
+		return Str(s)
+	}
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if v, ok := shard.entries[s]; ok {
+		return v
+	}
+	// Clone so the table never pins a larger buffer the caller sliced s from
+	key := string([]byte(s))
+	v = Str(key)
+	shard.entries[key] = v
+	si.size.Add(1)
+	return v
+}
+
+// Stats returns a snapshot of the interner counters.
+func (si *StringInterner) Stats() InternStats {
+	return InternStats{
+		Entries: si.size.Load(),
+		Hits:    si.hits.Load(),
+		Misses:  si.misses.Load(),
+	}
+}
+
+// Reset drops all interned strings and zeroes the counters.
+func (si *StringInterner) Reset() {
+	for i := range si.shards {
+		shard := &si.shards[i]
+		shard.mu.Lock()
+		shard.entries = make(map[string]Value)
+		shard.mu.Unlock()
+	}
+	si.size.Store(0)
+	si.hits.Store(0)
+	si.misses.Store(0)
+}
+
+var (
+	defaultInterner = NewStringInterner()
+	internEnabled   atomic.Bool
+	pooledNumbers   [maxPooledNumber - minPooledNumber + 1]Value
+)
+
+func init() {
+	internEnabled.Store(true)
+	for i := range pooledNumbers {
+		pooledNumbers[i] = Number(float64(i + minPooledNumber))
+	}
+}
+
+// SetInterning toggles string interning and number pooling process-wide.
+// Primarily useful for benchmarks comparing allocation profiles.
+func SetInterning(enabled bool) {
+	internEnabled.Store(enabled)
+}
+
+// InterningEnabled reports whether interning is active.
+func InterningEnabled() bool {
+	return internEnabled.Load()
+}
+
+// InternStr returns s boxed as a Str Value, shared with other equal short strings.
+func InternStr(s string) Value {
+	if !internEnabled.Load() {
+		return Str(s)
+	}
+	return defaultInterner.Intern(s)
+}
+
+// BoxNumber returns f boxed as a Number Value, reusing a preallocated wrapper
+// for small integral values.
+func BoxNumber(f float64) Value {
+	if internEnabled.Load() && f >= minPooledNumber && f <= maxPooledNumber && f == math.Trunc(f) && !(f == 0 && math.Signbit(f)) {
+		return pooledNumbers[int(f)-minPooledNumber]
+	}
+	return Number(f)
+}
+
+// GetInternStats returns counters for the process-wide interner.
+func GetInternStats() InternStats {
+	return defaultInterner.Stats()
+}
+
+// ResetInterner clears the process-wide interner.
+func ResetInterner() {
+	defaultInterner.Reset()
+}
+
+// argSlicePool recycles argument slices for user-defined function dispatch.
+// executeFunctionValue copies each argument into the callee scope, so the
+// slice itself never escapes the call and can be reused immediately.
+var argSlicePool = sync.Pool{
+	New: func() interface{} {
+		s := make([]Value, 0, 8)
+		return &s
+	},
+}
+
+func getArgSlice(n int) *[]Value {
+	p := argSlicePool.Get().(*[]Value)
+	if cap(*p) < n {
+		s := make([]Value, n)
+		p = &s
+	}
+	*p = (*p)[:n]
+	return p
+}
+
+func putArgSlice(p *[]Value) {
+	s := *p
+	for i := range s {
+		s[i] = nil // drop references so pooled slices don't keep values alive
+	}
+	if cap(s) > 64 {
+		return
+	}
+	*p = s[:0]
+	argSlicePool.Put(p)
+}
@@ -0,0 +1,88 @@
+package chariot
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrInterrupted is the error used when Interrupt is called with a nil reason.
+var ErrInterrupted = errors.New("execution interrupted")
+
+type interruptState struct {
+	err error
+}
+
+// Interrupt asks the program running on rt to stop: the next statement that
+// starts executing fails with err. A builtin that is already running is not
+// affected. The request stays in effect until ClearInterrupt is called.
+func (rt *Runtime) Interrupt(err error) {
+	if err == nil {
+		err = ErrInterrupted
+	}
+	rt.interrupt.Store(&interruptState{err: err})
+}
+
+// ClearInterrupt withdraws a pending Interrupt so the runtime can execute again.
+func (rt *Runtime) ClearInterrupt() {
+	rt.interrupt.Store(nil)
+}
+
+func (rt *Runtime) interrupted() error {
+	if state := rt.interrupt.Load(); state != nil {
+		return state.err
+	}
+	return nil
+}
+
+// ExecContext executes a parsed program like ExecProgram, with vars defined in
+// its scope, stopping before the next statement once ctx is done. The error
+// is then ctx.Err(), unwrapped. External calls give up at ctx's deadline,
+// which deadlineRemaining reports to the program.
+func (rt *Runtime) ExecContext(ctx context.Context, ast *Block, vars map[string]Value) (Value, error) {
+	var val Value
+	err := rt.RunContext(ctx, func() error {
+		rt.ResetCurrentScope()
+		for name, v := range vars {
+			rt.currentScope.Set(name, v)
+		}
+		var err error
+		val, err = ast.Exec(rt)
+		return rt.withStackTrace(err)
+	})
+	return val, err
+}
+
+// RunContext calls run, which runs a program on rt, stopping the program
+// before its next statement once ctx is done, as ExecContext does, and
+// returning ctx.Err() then.
+func (rt *Runtime) RunContext(ctx context.Context, run func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fired := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		rt.Interrupt(ctx.Err())
+		close(fired)
+	})
+	defer func() {
+		if !stop() {
+			<-fired
+		}
+		rt.ClearInterrupt()
+	}()
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		defer rt.setDeadline(ctx, deadline, context.DeadlineExceeded)()
+	}
+	err := run()
+	// The deadline check before each statement can fire before ctx's own
+	// timer does; either way the program stopped for ctx
+	if hasDeadline && !time.Now().Before(deadline) && errors.Is(err, context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+		return ctxErr
+	}
+	return err
+}
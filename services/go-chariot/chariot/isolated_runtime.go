@@ -0,0 +1,56 @@
+package chariot
+
+import "os"
+
+// NewIsolatedRuntime creates a runtime for code that runs unattended, such
+// as the scripts of a listener, from the runtime the server bootstrapped.
+// It has the standard builtins and those the host registered on bootstrap,
+// and starts out with copies of bootstrap's globals, functions, lists and
+// named nodes, so what its scripts define or setq stays in it and what
+// other runtimes do does not reach it. Host objects such as database
+// connections are shared. Snapshots and the sandbox profile are bootstrap's.
+func NewIsolatedRuntime(bootstrap *Runtime) *Runtime {
+	rt := NewRuntime()
+	RegisterAll(rt)
+	if bootstrap == nil {
+		return rt
+	}
+	for name, fn := range bootstrap.funcs {
+		if _, ok := rt.funcs[name]; !ok {
+			rt.funcs[name] = fn
+		}
+	}
+	for name, value := range bootstrap.ListGlobalVariables() {
+		rt.globalScope.Set(name, value)
+	}
+	for name, fn := range bootstrap.ListUserFunctionsMap() {
+		// Functions see the globals of the runtime they are called in
+		rt.functions[name] = cloneFunctionValueWithScope(fn, rt.globalScope)
+	}
+	for name, obj := range bootstrap.ListObjects() {
+		rt.objects[name] = obj
+	}
+	for name, list := range bootstrap.ListLists() {
+		rt.lists[name] = list
+	}
+	for name, node := range bootstrap.ListNodes() {
+		rt.nodes[name] = node
+	}
+	rt.snapshotDir, rt.sandbox = bootstrap.snapshotDir, bootstrap.sandbox
+	return rt
+}
+
+// SetEnv sets variables getEnv and hasEnv find before looking in the
+// process environment.
+func (rt *Runtime) SetEnv(env map[string]string) {
+	rt.env = env
+}
+
+// lookupEnv finds name among the runtime's variables, then in the process
+// environment.
+func (rt *Runtime) lookupEnv(name string) (string, bool) {
+	if value, ok := rt.env[name]; ok {
+		return value, true
+	}
+	return os.LookupEnv(name)
+}
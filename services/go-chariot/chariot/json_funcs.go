@@ -2,6 +2,7 @@
 package chariot
 
 import (
+	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -354,6 +355,30 @@ func registerJSONFileOps(rt *Runtime) {
 
 		return Bool(true), nil
 	})
+
+	// parseJSONStream(filename, pathFilter, function) - call function with each
+	// value the path filter selects, reading the file once without loading it
+	rt.Register("parseJSONStream", func(args ...Value) (Value, error) {
+		filename, filter, fn, err := streamArgs("parseJSONStream", args)
+		if err != nil {
+			return nil, err
+		}
+		fullPath, err := getSecureFilePath(filename, "data")
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(fullPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file '%s': %v", filename, err)
+		}
+		defer f.Close()
+
+		count, err := streamJSON(rt, bufio.NewReader(f), parseStreamFilter(filter, "."), streamCallback(rt, fn))
+		if err != nil {
+			return nil, fmt.Errorf("parseJSONStream '%s': %w", filename, err)
+		}
+		return Number(count), nil
+	})
 }
 
 // findJSONNode function
@@ -6,6 +6,8 @@ import (
 	"io"
 	"strconv"
 	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
 // JSONNode extends MapNode with JSON-specific functionality
@@ -13,6 +15,7 @@ type JSONNode struct {
 	MapNode
 	// JSON-specific fields
 	decoder *json.Decoder
+	yamlDoc *yaml.Node // Document loaded from YAML; see yaml_doc.go
 }
 
 // NewJSONNode creates a new JSONNode
@@ -47,6 +50,7 @@ func (n *JSONNode) Clone() TreeNode {
 	clone := &JSONNode{
 		MapNode: *n.MapNode.Clone().(*MapNode), // Clone the MapNode part
 		decoder: n.decoder,                     // Keep the decoder reference (not cloned)
+		yamlDoc: n.yamlDoc,                     // Never modified, so shared
 	}
 	return clone
 }
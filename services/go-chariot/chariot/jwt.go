@@ -0,0 +1,329 @@
+package chariot
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// JWT signing algorithms supported by jwtSign and jwtVerify.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+// keyMaterial is a parsed signing or verification key: an HMAC secret, a
+// private key, or a public key on its own.
+type keyMaterial struct {
+	secret  []byte
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// parseKeyMaterial reads a PEM private or public key; anything that is not
+// PEM is taken as an HMAC secret.
+func parseKeyMaterial(s string) (*keyMaterial, error) {
+	if !strings.Contains(s, "-----BEGIN ") {
+		if s == "" {
+			return nil, errors.New("empty key")
+		}
+		return &keyMaterial{secret: []byte(s)}, nil
+	}
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("invalid PEM data")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &keyMaterial{private: key, public: &key.PublicKey}, nil
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &keyMaterial{private: key, public: &key.PublicKey}, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return &keyMaterial{private: signer, public: signer.Public()}, nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &keyMaterial{public: key}, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &keyMaterial{public: key}, nil
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &keyMaterial{public: cert.PublicKey}, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+// alg returns the JWT algorithm the key signs with.
+func (k *keyMaterial) alg() (string, error) {
+	if k.secret != nil {
+		return AlgHS256, nil
+	}
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		return AlgRS256, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return "", fmt.Errorf("ES256 needs a P-256 key, got %s", pub.Curve.Params().Name)
+		}
+		return AlgES256, nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", k.public)
+}
+
+// keyType returns the keystore type of the key.
+func (k *keyMaterial) keyType() string {
+	switch {
+	case k.secret != nil:
+		return KeyTypeHMAC
+	case isRSA(k.public):
+		return KeyTypeRSA
+	}
+	return KeyTypeEC
+}
+
+func isRSA(pub crypto.PublicKey) bool {
+	_, ok := pub.(*rsa.PublicKey)
+	return ok
+}
+
+// privatePEM encodes the private key or secret for storage.
+func (k *keyMaterial) privatePEM() (string, error) {
+	if k.secret != nil {
+		return string(k.secret), nil
+	}
+	if k.private == nil {
+		return publicKeyPEM(k.public)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+func publicKeyPEM(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// HMACSHA256 returns the HMAC-SHA256 of data under key.
+func HMACSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+var b64url = base64.RawURLEncoding
+
+// signJWT returns a compact JWS of claims, signed with key. alg may be ""
+// to use the key's own algorithm; extra header fields (such as kid) are
+// merged into the JOSE header.
+func signJWT(claims map[string]interface{}, key *keyMaterial, alg string, header map[string]interface{}) (string, error) {
+	keyAlg, err := key.alg()
+	if err != nil {
+		return "", err
+	}
+	if alg == "" {
+		alg = keyAlg
+	}
+	if alg != keyAlg {
+		return "", fmt.Errorf("algorithm %s does not match the key (%s)", alg, keyAlg)
+	}
+	if key.secret == nil && key.private == nil {
+		return "", errors.New("a public key cannot sign")
+	}
+	h := map[string]interface{}{}
+	for k, v := range header {
+		h[k] = v
+	}
+	h["alg"], h["typ"] = alg, "JWT"
+	hdr, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	input := b64url.EncodeToString(hdr) + "." + b64url.EncodeToString(body)
+	sig, err := jwsSign(alg, key, []byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + b64url.EncodeToString(sig), nil
+}
+
+func jwsSign(alg string, key *keyMaterial, input []byte) ([]byte, error) {
+	digest := sha256.Sum256(input)
+	switch alg {
+	case AlgHS256:
+		return HMACSHA256(key.secret, input), nil
+	case AlgRS256:
+		return rsa.SignPKCS1v15(rand.Reader, key.private.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+	case AlgES256:
+		r, s, err := ecdsa.Sign(rand.Reader, key.private.(*ecdsa.PrivateKey), digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// JWS wants r and s as fixed-width big-endian integers, not ASN.1
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm %s", alg)
+}
+
+func jwsVerify(alg string, key *keyMaterial, input, sig []byte) bool {
+	digest := sha256.Sum256(input)
+	switch alg {
+	case AlgHS256:
+		return hmac.Equal(sig, HMACSHA256(key.secret, input))
+	case AlgRS256:
+		pub, ok := key.public.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	case AlgES256:
+		pub, ok := key.public.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(pub, digest[:], r, s)
+	}
+	return false
+}
+
+// jwtParts is a decoded but not yet verified token.
+type jwtParts struct {
+	header map[string]interface{}
+	claims map[string]interface{}
+	input  []byte
+	sig    []byte
+}
+
+func parseJWT(token string) (*jwtParts, error) {
+	segs := strings.Split(strings.TrimSpace(token), ".")
+	if len(segs) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	p := &jwtParts{input: []byte(segs[0] + "." + segs[1])}
+	hdr, err := b64url.DecodeString(segs[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed header: %v", err)
+	}
+	if err := json.Unmarshal(hdr, &p.header); err != nil {
+		return nil, fmt.Errorf("malformed header: %v", err)
+	}
+	body, err := b64url.DecodeString(segs[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed claims: %v", err)
+	}
+	if err := json.Unmarshal(body, &p.claims); err != nil {
+		return nil, fmt.Errorf("malformed claims: %v", err)
+	}
+	if p.sig, err = b64url.DecodeString(segs[2]); err != nil {
+		return nil, fmt.Errorf("malformed signature: %v", err)
+	}
+	return p, nil
+}
+
+// jwtCheck holds the claim checks jwtVerify applies after the signature.
+type jwtCheck struct {
+	issuer   string
+	audience string
+	leeway   time.Duration
+	now      time.Time
+}
+
+// verifyJWT checks the signature of p against each key in turn and then the
+// registered claims. The algorithm is taken from the key, never from the
+// token, so an RSA public key cannot be used as an HMAC secret.
+func verifyJWT(p *jwtParts, keys []*keyMaterial, check jwtCheck) error {
+	alg, _ := p.header["alg"].(string)
+	verified := false
+	for _, key := range keys {
+		keyAlg, err := key.alg()
+		if err != nil || keyAlg != alg {
+			continue
+		}
+		if jwsVerify(alg, key, p.input, p.sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return errors.New("invalid signature")
+	}
+	if check.now.IsZero() {
+		check.now = time.Now()
+	}
+	if exp, ok := p.claims["exp"].(float64); ok && check.now.After(time.Unix(int64(exp), 0).Add(check.leeway)) {
+		return errors.New("token has expired")
+	}
+	if nbf, ok := p.claims["nbf"].(float64); ok && check.now.Before(time.Unix(int64(nbf), 0).Add(-check.leeway)) {
+		return errors.New("token is not valid yet")
+	}
+	if check.issuer != "" && p.claims["iss"] != check.issuer {
+		return fmt.Errorf("issuer %v is not %s", p.claims["iss"], check.issuer)
+	}
+	if check.audience != "" && !jwtHasAudience(p.claims["aud"], check.audience) {
+		return fmt.Errorf("token is not for audience %s", check.audience)
+	}
+	return nil
+}
+
+func jwtHasAudience(aud interface{}, want string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == want
+	case []interface{}:
+		for _, v := range a {
+			if v == want {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,437 @@
+package chariot
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// registerTokenFunctions registers the HMAC, JWT, PEM and keystore builtins.
+// Functions taking a key accept an HMAC secret or a PEM key; the *WithKey
+// variants take the name of a key in the server keystore instead.
+func registerTokenFunctions(rt *Runtime) {
+	// hmacSHA256(key, data) - hex encoded HMAC-SHA256
+	rt.Register("hmacSHA256", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, errors.New("hmacSHA256 requires: key, data")
+		}
+		args = unwrapScopeEntries(args)
+		key, err := cryptoString("hmacSHA256", "key", args[0])
+		if err != nil {
+			return nil, err
+		}
+		data, err := cryptoString("hmacSHA256", "data", args[1])
+		if err != nil {
+			return nil, err
+		}
+		return Str(hex.EncodeToString(HMACSHA256([]byte(key), []byte(data)))), nil
+	})
+
+	// hmacSHA256WithKey(keyName, data) - HMAC-SHA256 with a keystore secret
+	rt.Register("hmacSHA256WithKey", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, errors.New("hmacSHA256WithKey requires: keyName, data")
+		}
+		args = unwrapScopeEntries(args)
+		name, err := cryptoString("hmacSHA256WithKey", "keyName", args[0])
+		if err != nil {
+			return nil, err
+		}
+		data, err := cryptoString("hmacSHA256WithKey", "data", args[1])
+		if err != nil {
+			return nil, err
+		}
+		_, km, err := getKeyStore().signingKey(name)
+		if err != nil {
+			return nil, fmt.Errorf("hmacSHA256WithKey: %w", err)
+		}
+		if km.secret == nil {
+			return nil, fmt.Errorf("hmacSHA256WithKey: key %s is not an HMAC secret", name)
+		}
+		return Str(hex.EncodeToString(HMACSHA256(km.secret, []byte(data)))), nil
+	})
+
+	// jwtSign(claims, key, [options]) - compact JWT signed with a secret
+	// (HS256), an RSA private key (RS256) or a P-256 private key (ES256)
+	rt.Register("jwtSign", func(args ...Value) (Value, error) {
+		if len(args) < 2 || len(args) > 3 {
+			return nil, errors.New("jwtSign requires: claims, key, [options]")
+		}
+		args = unwrapScopeEntries(args)
+		keyStr, err := cryptoString("jwtSign", "key", args[1])
+		if err != nil {
+			return nil, err
+		}
+		km, err := parseKeyMaterial(keyStr)
+		if err != nil {
+			return nil, fmt.Errorf("jwtSign: key: %w", err)
+		}
+		return jwtSignValue("jwtSign", args[0], km, "", optionalArg(args, 2))
+	})
+
+	// jwtSignWithKey(claims, keyName, [options]) - sign with the current
+	// version of a keystore key; the kid header names the version
+	rt.Register("jwtSignWithKey", func(args ...Value) (Value, error) {
+		if len(args) < 2 || len(args) > 3 {
+			return nil, errors.New("jwtSignWithKey requires: claims, keyName, [options]")
+		}
+		args = unwrapScopeEntries(args)
+		name, err := cryptoString("jwtSignWithKey", "keyName", args[1])
+		if err != nil {
+			return nil, err
+		}
+		version, km, err := getKeyStore().signingKey(name)
+		if err != nil {
+			return nil, fmt.Errorf("jwtSignWithKey: %w", err)
+		}
+		return jwtSignValue("jwtSignWithKey", args[0], km, keyID(name, version), optionalArg(args, 2))
+	})
+
+	// jwtVerify(token, key, [options]) - verified claims; fails on a bad
+	// signature, an expired token or a failed issuer/audience check
+	rt.Register("jwtVerify", func(args ...Value) (Value, error) {
+		if len(args) < 2 || len(args) > 3 {
+			return nil, errors.New("jwtVerify requires: token, key, [options]")
+		}
+		args = unwrapScopeEntries(args)
+		keyStr, err := cryptoString("jwtVerify", "key", args[1])
+		if err != nil {
+			return nil, err
+		}
+		km, err := parseKeyMaterial(keyStr)
+		if err != nil {
+			return nil, fmt.Errorf("jwtVerify: key: %w", err)
+		}
+		return jwtVerifyValue("jwtVerify", args[0], optionalArg(args, 2), func(string) ([]*keyMaterial, error) {
+			return []*keyMaterial{km}, nil
+		})
+	})
+
+	// jwtVerifyWithKey(token, keyName, [options]) - verify against the
+	// version named by kid, or every version of a keystore key
+	rt.Register("jwtVerifyWithKey", func(args ...Value) (Value, error) {
+		if len(args) < 2 || len(args) > 3 {
+			return nil, errors.New("jwtVerifyWithKey requires: token, keyName, [options]")
+		}
+		args = unwrapScopeEntries(args)
+		name, err := cryptoString("jwtVerifyWithKey", "keyName", args[1])
+		if err != nil {
+			return nil, err
+		}
+		return jwtVerifyValue("jwtVerifyWithKey", args[0], optionalArg(args, 2), func(kid string) ([]*keyMaterial, error) {
+			return getKeyStore().verificationKeys(name, kid)
+		})
+	})
+
+	// generateECKey() - P-256 key pair as PEM, for ES256
+	rt.Register("generateECKey", func(args ...Value) (Value, error) {
+		if len(args) != 0 {
+			return nil, errors.New("generateECKey takes no arguments")
+		}
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("EC key generation failed: %v", err)
+		}
+		km := &keyMaterial{private: key, public: &key.PublicKey}
+		priv, err := km.privatePEM()
+		if err != nil {
+			return nil, err
+		}
+		pub, err := publicKeyPEM(km.public)
+		if err != nil {
+			return nil, err
+		}
+		result := NewMap()
+		result.Set("privateKey", Str(priv))
+		result.Set("publicKey", Str(pub))
+		return result, nil
+	})
+
+	// publicKeyPEM(pem) - public key of a PEM private key or certificate
+	rt.Register("publicKeyPEM", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, errors.New("publicKeyPEM requires: pem")
+		}
+		args = unwrapScopeEntries(args)
+		s, err := cryptoString("publicKeyPEM", "pem", args[0])
+		if err != nil {
+			return nil, err
+		}
+		km, err := parseKeyMaterial(s)
+		if err != nil {
+			return nil, fmt.Errorf("publicKeyPEM: %w", err)
+		}
+		if km.secret != nil {
+			return nil, errors.New("publicKeyPEM: argument is not a PEM key")
+		}
+		pub, err := publicKeyPEM(km.public)
+		if err != nil {
+			return nil, fmt.Errorf("publicKeyPEM: %w", err)
+		}
+		return Str(pub), nil
+	})
+
+	// keyCreate(name, type) - generate a keystore key: "hmac", "rsa", "ec",
+	// or "aes-gcm" or "chacha20-poly1305" to encrypt secure trees
+	rt.Register("keyCreate", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, errors.New("keyCreate requires: name, type")
+		}
+		args = unwrapScopeEntries(args)
+		name, err := cryptoString("keyCreate", "name", args[0])
+		if err != nil {
+			return nil, err
+		}
+		keyType, err := cryptoString("keyCreate", "type", args[1])
+		if err != nil {
+			return nil, err
+		}
+		return keyInfoResult("keyCreate")(getKeyStore().Create(name, keyType))
+	})
+
+	// keyImport(name, material) - store a PEM key or HMAC secret; importing
+	// to an existing key adds a version
+	rt.Register("keyImport", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, errors.New("keyImport requires: name, material")
+		}
+		args = unwrapScopeEntries(args)
+		name, err := cryptoString("keyImport", "name", args[0])
+		if err != nil {
+			return nil, err
+		}
+		material, err := cryptoString("keyImport", "material", args[1])
+		if err != nil {
+			return nil, err
+		}
+		return keyInfoResult("keyImport")(getKeyStore().Import(name, material))
+	})
+
+	// keyRotate(name) - add a new version; older versions still verify
+	rt.Register("keyRotate", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, errors.New("keyRotate requires: name")
+		}
+		args = unwrapScopeEntries(args)
+		name, err := cryptoString("keyRotate", "name", args[0])
+		if err != nil {
+			return nil, err
+		}
+		return keyInfoResult("keyRotate")(getKeyStore().Rotate(name))
+	})
+
+	// keyPrune(name, keep) - drop all but the newest keep versions
+	rt.Register("keyPrune", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, errors.New("keyPrune requires: name, keep")
+		}
+		args = unwrapScopeEntries(args)
+		name, err := cryptoString("keyPrune", "name", args[0])
+		if err != nil {
+			return nil, err
+		}
+		keep, ok := args[1].(Number)
+		if !ok {
+			return nil, fmt.Errorf("keyPrune: keep must be a number, got %T", args[1])
+		}
+		return keyInfoResult("keyPrune")(getKeyStore().Prune(name, int(keep)))
+	})
+
+	// keyExport(name) - PEM public key of an RSA or EC keystore key
+	rt.Register("keyExport", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, errors.New("keyExport requires: name")
+		}
+		args = unwrapScopeEntries(args)
+		name, err := cryptoString("keyExport", "name", args[0])
+		if err != nil {
+			return nil, err
+		}
+		pub, err := getKeyStore().PublicPEM(name)
+		if err != nil {
+			return nil, fmt.Errorf("keyExport: %w", err)
+		}
+		return Str(pub), nil
+	})
+
+	// keyList() - keystore keys without their material
+	rt.Register("keyList", func(args ...Value) (Value, error) {
+		if len(args) != 0 {
+			return nil, errors.New("keyList takes no arguments")
+		}
+		arr := NewArray()
+		for _, info := range getKeyStore().List() {
+			arr.Append(keyInfoValue(info))
+		}
+		return arr, nil
+	})
+
+	// keyDelete(name) - remove a key and all its versions
+	rt.Register("keyDelete", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, errors.New("keyDelete requires: name")
+		}
+		args = unwrapScopeEntries(args)
+		name, err := cryptoString("keyDelete", "name", args[0])
+		if err != nil {
+			return nil, err
+		}
+		if err := getKeyStore().Delete(name); err != nil {
+			return nil, fmt.Errorf("keyDelete: %w", err)
+		}
+		return Bool(true), nil
+	})
+}
+
+func cryptoString(fn, param string, v Value) (string, error) {
+	s, ok := v.(Str)
+	if !ok {
+		return "", fmt.Errorf("%s: %s must be a string, got %T", fn, param, v)
+	}
+	return string(s), nil
+}
+
+func optionalArg(args []Value, i int) Value {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+// jwtOptions reads an options map, rejecting keys not in allowed.
+func jwtOptions(fn string, v Value, allowed ...string) (map[string]Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	m, ok := v.(*MapValue)
+	if !ok {
+		return nil, fmt.Errorf("%s: options must be a map, got %T", fn, v)
+	}
+	out := make(map[string]Value, len(m.Values))
+	for k, val := range m.Values {
+		known := false
+		for _, a := range allowed {
+			known = known || k == a
+		}
+		if !known {
+			return nil, fmt.Errorf("%s: unknown option %q", fn, k)
+		}
+		if se, ok := val.(ScopeEntry); ok {
+			val = se.Value
+		}
+		out[k] = val
+	}
+	return out, nil
+}
+
+// jwtSignValue signs claims; options are alg, kid, expiresIn (seconds from
+// now, sets iat and exp) and header (extra JOSE header fields).
+func jwtSignValue(fn string, claimsArg Value, km *keyMaterial, kid string, optsArg Value) (Value, error) {
+	opts, err := jwtOptions(fn, optsArg, "alg", "kid", "expiresIn", "header")
+	if err != nil {
+		return nil, err
+	}
+	src := ValueToJSON(claimsArg)
+	if jn, ok := claimsArg.(interface{ GetJSONValue() interface{} }); ok {
+		src = jn.GetJSONValue()
+	}
+	m, ok := src.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: claims must be a map, got %T", fn, claimsArg)
+	}
+	// Copied, as expiresIn adds claims
+	claims := make(map[string]interface{}, len(m)+2)
+	for k, v := range m {
+		claims[k] = v
+	}
+	header := map[string]interface{}{}
+	if h, ok := opts["header"]; ok {
+		if header, ok = ValueToJSON(h).(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("%s: header must be a map", fn)
+		}
+	}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	if v, ok := opts["kid"].(Str); ok {
+		header["kid"] = string(v)
+	}
+	if v, ok := opts["expiresIn"]; ok {
+		secs, ok := v.(Number)
+		if !ok {
+			return nil, fmt.Errorf("%s: expiresIn must be a number of seconds", fn)
+		}
+		now := time.Now().Unix()
+		claims["iat"] = now
+		claims["exp"] = now + int64(secs)
+	}
+	alg := ""
+	if v, ok := opts["alg"].(Str); ok {
+		alg = string(v)
+	}
+	token, err := signJWT(claims, km, alg, header)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return Str(token), nil
+}
+
+// jwtVerifyValue verifies a token and returns its claims; options are
+// issuer, audience and leeway (seconds of clock skew allowed).
+func jwtVerifyValue(fn string, tokenArg Value, optsArg Value, keys func(kid string) ([]*keyMaterial, error)) (Value, error) {
+	token, err := cryptoString(fn, "token", tokenArg)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := jwtOptions(fn, optsArg, "issuer", "audience", "leeway")
+	if err != nil {
+		return nil, err
+	}
+	var check jwtCheck
+	if v, ok := opts["issuer"].(Str); ok {
+		check.issuer = string(v)
+	}
+	if v, ok := opts["audience"].(Str); ok {
+		check.audience = string(v)
+	}
+	if v, ok := opts["leeway"].(Number); ok {
+		check.leeway = time.Duration(float64(v) * float64(time.Second))
+	}
+	p, err := parseJWT(token)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	kid, _ := p.header["kid"].(string)
+	km, err := keys(kid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := verifyJWT(p, km, check); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return JSONToValue(p.claims)
+}
+
+func keyInfoValue(info KeyInfo) Value {
+	m := NewMap()
+	m.Set("name", Str(info.Name))
+	m.Set("type", Str(info.Type))
+	m.Set("public", Bool(info.Public))
+	m.Set("version", Number(info.Version))
+	m.Set("versions", Number(info.Versions))
+	m.Set("rotatedAt", Str(info.RotatedAt.Format(time.RFC3339)))
+	return m
+}
+
+func keyInfoResult(fn string) func(KeyInfo, error) (Value, error) {
+	return func(info KeyInfo, err error) (Value, error) {
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		return keyInfoValue(info), nil
+	}
+}
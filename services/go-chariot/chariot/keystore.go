@@ -0,0 +1,512 @@
+package chariot
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Key types held by the keystore.
+const (
+	KeyTypeHMAC = "hmac" // secret for HS256 and hmacSHA256WithKey
+	KeyTypeRSA  = "rsa"  // 2048-bit RSA key for RS256
+	KeyTypeEC   = "ec"   // P-256 ECDSA key for ES256
+
+	KeyTypeAESGCM   = "aes-gcm"           // 256-bit key encrypting secure trees with AES-GCM
+	KeyTypeChaCha20 = "chacha20-poly1305" // 256-bit key encrypting secure trees with ChaCha20-Poly1305
+)
+
+// isEncryptionKeyType reports whether keys of keyType encrypt rather than sign.
+func isEncryptionKeyType(keyType string) bool {
+	return keyType == KeyTypeAESGCM || keyType == KeyTypeChaCha20
+}
+
+// ErrKeyNotFound is returned for a key name the keystore does not hold.
+var ErrKeyNotFound = errors.New("key not found")
+
+var keyNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// KeyVersion is one generation of a named key.
+type KeyVersion struct {
+	Version   int       `json:"version"`
+	Material  string    `json:"material"` // secret or PEM; base64 AES-GCM ciphertext when the file is encrypted
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// StoredKey is a named key and its versions, oldest first. New signatures
+// use the last version; every version still verifies.
+type StoredKey struct {
+	Name     string       `json:"name"`
+	Type     string       `json:"type"`
+	Public   bool         `json:"public,omitempty"` // only a public key was imported; it verifies but cannot sign
+	Versions []KeyVersion `json:"versions"`
+}
+
+// KeyInfo describes a key without its material.
+type KeyInfo struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Public    bool      `json:"public,omitempty"`
+	Version   int       `json:"version"`  // current version
+	Versions  int       `json:"versions"` // number of versions kept
+	RotatedAt time.Time `json:"rotated_at"`
+}
+
+type keystoreFile struct {
+	Version   int          `json:"version"`
+	Encrypted bool         `json:"encrypted,omitempty"`
+	Keys      []*StoredKey `json:"keys"`
+}
+
+// KeyStore holds named signing and encryption keys on the server, so scripts
+// can sign, verify and encrypt by name without handling key material. Keys are persisted to a JSON
+// file, encrypted with a master key when one is configured.
+type KeyStore struct {
+	file   string
+	master []byte
+
+	mu   sync.RWMutex
+	keys map[string]*StoredKey
+}
+
+// NewKeyStore loads the keystore in file, if it exists. file "" keeps keys
+// in memory; master, when set, is the AES key material is encrypted with.
+func NewKeyStore(file string, master []byte) (*KeyStore, error) {
+	if master != nil && len(master) != 16 && len(master) != 24 && len(master) != 32 {
+		return nil, fmt.Errorf("invalid keystore master key length: %d bytes", len(master))
+	}
+	ks := &KeyStore{file: file, master: master, keys: map[string]*StoredKey{}}
+	if file == "" {
+		return ks, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ks, nil
+		}
+		return nil, err
+	}
+	var f keystoreFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if f.Encrypted && master == nil {
+		return nil, fmt.Errorf("%s is encrypted and no master key is configured", file)
+	}
+	for _, k := range f.Keys {
+		if f.Encrypted {
+			for i := range k.Versions {
+				if k.Versions[i].Material, err = ks.unseal(k.Versions[i].Material); err != nil {
+					return nil, fmt.Errorf("%s: key %s: %w", file, k.Name, err)
+				}
+			}
+		}
+		ks.keys[k.Name] = k
+	}
+	return ks, nil
+}
+
+// KeystoreKeys describes the keys of the keystore the key builtins use.
+func KeystoreKeys() []KeyInfo {
+	return getKeyStore().List()
+}
+
+var (
+	keyStoreMu sync.Mutex
+	keyStore   *KeyStore
+)
+
+// SetKeyStore sets the keystore the key builtins use.
+func SetKeyStore(ks *KeyStore) {
+	keyStoreMu.Lock()
+	keyStore = ks
+	keyStoreMu.Unlock()
+}
+
+// getKeyStore returns the configured keystore, or an in-memory one when
+// none was set.
+func getKeyStore() *KeyStore {
+	keyStoreMu.Lock()
+	defer keyStoreMu.Unlock()
+	if keyStore == nil {
+		keyStore, _ = NewKeyStore("", nil)
+	}
+	return keyStore
+}
+
+func (ks *KeyStore) seal(material string) (string, error) {
+	ct, err := getCryptoManager().EncryptAES([]byte(material), ks.master)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ct), nil
+}
+
+func (ks *KeyStore) unseal(sealed string) (string, error) {
+	ct, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	pt, err := getCryptoManager().DecryptAES(ct, ks.master)
+	if err != nil {
+		return "", err
+	}
+	return string(pt), nil
+}
+
+func (ks *KeyStore) saveLocked() error {
+	if ks.file == "" {
+		return nil
+	}
+	f := keystoreFile{Version: 1, Encrypted: ks.master != nil}
+	names := make([]string, 0, len(ks.keys))
+	for name := range ks.keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		k := *ks.keys[name]
+		if f.Encrypted {
+			k.Versions = append([]KeyVersion(nil), k.Versions...)
+			for i := range k.Versions {
+				sealed, err := ks.seal(k.Versions[i].Material)
+				if err != nil {
+					return err
+				}
+				k.Versions[i].Material = sealed
+			}
+		}
+		f.Keys = append(f.Keys, &k)
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(filepath.Dir(ks.file), 0o755)
+	// The file holds private keys and secrets
+	return os.WriteFile(ks.file, data, 0o600)
+}
+
+func (k *StoredKey) info() KeyInfo {
+	cur := k.Versions[len(k.Versions)-1]
+	return KeyInfo{Name: k.Name, Type: k.Type, Public: k.Public, Version: cur.Version, Versions: len(k.Versions), RotatedAt: cur.CreatedAt}
+}
+
+// List describes the keys, by name.
+func (ks *KeyStore) List() []KeyInfo {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	out := make([]KeyInfo, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		out = append(out, k.info())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Create generates a key of the given type under a new name.
+func (ks *KeyStore) Create(name, keyType string) (KeyInfo, error) {
+	if !keyNamePattern.MatchString(name) {
+		return KeyInfo{}, fmt.Errorf("invalid key name %q", name)
+	}
+	material, err := generateKeyMaterial(keyType)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if _, exists := ks.keys[name]; exists {
+		return KeyInfo{}, fmt.Errorf("key %s already exists", name)
+	}
+	return ks.addVersionLocked(name, keyType, false, material)
+}
+
+// Import stores a PEM key or HMAC secret under name. Encryption keys are
+// only generated, never imported. Importing to an existing
+// name adds a version of the same type, which rotates the key to it.
+func (ks *KeyStore) Import(name, material string) (KeyInfo, error) {
+	if !keyNamePattern.MatchString(name) {
+		return KeyInfo{}, fmt.Errorf("invalid key name %q", name)
+	}
+	km, err := parseKeyMaterial(material)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	if _, err := km.alg(); err != nil {
+		return KeyInfo{}, err
+	}
+	stored, err := km.privatePEM()
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.addVersionLocked(name, km.keyType(), km.secret == nil && km.private == nil, stored)
+}
+
+// Rotate adds a freshly generated version of a key. Keys imported as public
+// keys can only be rotated by importing the new public key.
+func (ks *KeyStore) Rotate(name string) (KeyInfo, error) {
+	ks.mu.RLock()
+	k, ok := ks.keys[name]
+	var keyType string
+	var public bool
+	if ok {
+		keyType, public = k.Type, k.Public
+	}
+	ks.mu.RUnlock()
+	if !ok {
+		return KeyInfo{}, fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+	}
+	if public {
+		return KeyInfo{}, fmt.Errorf("key %s is a public key; import its replacement instead", name)
+	}
+	material, err := generateKeyMaterial(keyType)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.addVersionLocked(name, keyType, false, material)
+}
+
+func (ks *KeyStore) addVersionLocked(name, keyType string, public bool, material string) (KeyInfo, error) {
+	old, exists := ks.keys[name]
+	k := &StoredKey{Name: name, Type: keyType, Public: public}
+	if exists {
+		if old.Type != keyType || old.Public != public {
+			return KeyInfo{}, fmt.Errorf("key %s holds %s keys", name, describeKeyKind(old.Type, old.Public))
+		}
+		k.Versions = append(k.Versions, old.Versions...)
+	}
+	next := 1
+	if n := len(k.Versions); n > 0 {
+		next = k.Versions[n-1].Version + 1
+	}
+	k.Versions = append(k.Versions, KeyVersion{Version: next, Material: material, CreatedAt: time.Now().UTC()})
+	ks.keys[name] = k
+	if err := ks.saveLocked(); err != nil {
+		if exists {
+			ks.keys[name] = old
+		} else {
+			delete(ks.keys, name)
+		}
+		return KeyInfo{}, err
+	}
+	return k.info(), nil
+}
+
+func describeKeyKind(keyType string, public bool) string {
+	if public {
+		return keyType + " public"
+	}
+	return keyType
+}
+
+// Prune drops all but the newest keep versions of a key, so tokens signed
+// with the dropped versions no longer verify.
+func (ks *KeyStore) Prune(name string, keep int) (KeyInfo, error) {
+	if keep < 1 {
+		return KeyInfo{}, errors.New("at least one version must be kept")
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	old, ok := ks.keys[name]
+	if !ok {
+		return KeyInfo{}, fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+	}
+	if len(old.Versions) <= keep {
+		return old.info(), nil
+	}
+	k := *old
+	k.Versions = append([]KeyVersion(nil), old.Versions[len(old.Versions)-keep:]...)
+	ks.keys[name] = &k
+	if err := ks.saveLocked(); err != nil {
+		ks.keys[name] = old
+		return KeyInfo{}, err
+	}
+	return k.info(), nil
+}
+
+// Delete removes a key and all its versions.
+func (ks *KeyStore) Delete(name string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	old, ok := ks.keys[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+	}
+	delete(ks.keys, name)
+	if err := ks.saveLocked(); err != nil {
+		ks.keys[name] = old
+		return err
+	}
+	return nil
+}
+
+// PublicPEM returns the public key of the current version of an RSA or EC
+// key, for handing to the party that verifies its signatures.
+func (ks *KeyStore) PublicPEM(name string) (string, error) {
+	_, km, err := ks.signingKey(name)
+	if err != nil && !errors.Is(err, errPublicOnly) {
+		return "", err
+	}
+	if km.secret != nil {
+		return "", fmt.Errorf("key %s is an HMAC secret and has no public key", name)
+	}
+	return publicKeyPEM(km.public)
+}
+
+var errPublicOnly = errors.New("key is a public key and cannot sign")
+
+// signingKey returns the current version of a key and its number.
+func (ks *KeyStore) signingKey(name string) (int, *keyMaterial, error) {
+	ks.mu.RLock()
+	k, ok := ks.keys[name]
+	ks.mu.RUnlock()
+	if !ok {
+		return 0, nil, fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+	}
+	if isEncryptionKeyType(k.Type) {
+		return 0, nil, fmt.Errorf("key %s is a %s encryption key and cannot sign", name, k.Type)
+	}
+	cur := k.Versions[len(k.Versions)-1]
+	km, err := parseKeyMaterial(cur.Material)
+	if err != nil {
+		return 0, nil, fmt.Errorf("key %s version %d: %w", name, cur.Version, err)
+	}
+	if k.Public {
+		return cur.Version, km, fmt.Errorf("%s: %w", name, errPublicOnly)
+	}
+	return cur.Version, km, nil
+}
+
+// verificationKeys returns the versions of a key to check a signature
+// against: only the one named by kid when it names a version of this key,
+// otherwise all of them, newest first.
+func (ks *KeyStore) verificationKeys(name, kid string) ([]*keyMaterial, error) {
+	ks.mu.RLock()
+	k, ok := ks.keys[name]
+	ks.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+	}
+	if isEncryptionKeyType(k.Type) {
+		return nil, fmt.Errorf("key %s is a %s encryption key and cannot verify", name, k.Type)
+	}
+	want := 0
+	if n, v, ok := parseKeyID(kid); ok && n == name {
+		want = v
+	}
+	var out []*keyMaterial
+	for i := len(k.Versions) - 1; i >= 0; i-- {
+		v := k.Versions[i]
+		if want != 0 && v.Version != want {
+			continue
+		}
+		km, err := parseKeyMaterial(v.Material)
+		if err != nil {
+			return nil, fmt.Errorf("key %s version %d: %w", name, v.Version, err)
+		}
+		out = append(out, km)
+	}
+	return out, nil
+}
+
+// encryptionKey returns the type, version and bytes of an encryption key:
+// the given version, or the current one for version 0.
+func (ks *KeyStore) encryptionKey(name string, version int) (string, int, []byte, error) {
+	ks.mu.RLock()
+	k, ok := ks.keys[name]
+	ks.mu.RUnlock()
+	if !ok {
+		return "", 0, nil, fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+	}
+	if !isEncryptionKeyType(k.Type) {
+		return "", 0, nil, fmt.Errorf("key %s is a %s key and cannot encrypt", name, k.Type)
+	}
+	v := k.Versions[len(k.Versions)-1]
+	if version != 0 {
+		found := false
+		for _, kv := range k.Versions {
+			if kv.Version == version {
+				v, found = kv, true
+				break
+			}
+		}
+		if !found {
+			return "", 0, nil, fmt.Errorf("key %s has no version %d; it may have been pruned", name, version)
+		}
+	}
+	material, err := base64.StdEncoding.DecodeString(v.Material)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("key %s version %d: %w", name, v.Version, err)
+	}
+	return k.Type, v.Version, material, nil
+}
+
+// keyID is the kid header of tokens signed with a keystore key.
+func keyID(name string, version int) string {
+	return name + ".v" + strconv.Itoa(version)
+}
+
+func parseKeyID(kid string) (string, int, bool) {
+	i := strings.LastIndex(kid, ".v")
+	if i < 0 {
+		return "", 0, false
+	}
+	v, err := strconv.Atoi(kid[i+2:])
+	if err != nil || v < 1 {
+		return "", 0, false
+	}
+	return kid[:i], v, true
+}
+
+// generateKeyMaterial returns a new secret or PEM private key of keyType.
+// Encryption keys are 32 random bytes in base64.
+func generateKeyMaterial(keyType string) (string, error) {
+	var km *keyMaterial
+	switch keyType {
+	case KeyTypeAESGCM, KeyTypeChaCha20:
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(key), nil
+	case KeyTypeHMAC:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return "", err
+		}
+		// Stored as text so it can be imported and used like any other secret
+		km = &keyMaterial{secret: []byte(base64.RawURLEncoding.EncodeToString(secret))}
+	case KeyTypeRSA:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return "", err
+		}
+		km = &keyMaterial{private: key, public: &key.PublicKey}
+	case KeyTypeEC:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		km = &keyMaterial{private: key, public: &key.PublicKey}
+	default:
+		return "", fmt.Errorf("unknown key type %q (want hmac, rsa, ec, aes-gcm or chacha20-poly1305)", keyType)
+	}
+	return km.privatePEM()
+}
@@ -0,0 +1,11 @@
+//go:build !cgo || !((linux && amd64) || (linux && arm64 && cuda) || (darwin && arm64))
+
+package chariot
+
+import "errors"
+
+// SolveKnapsack is unavailable on builds without the native solver, such as
+// CGO_ENABLED=0 and WebAssembly builds.
+func SolveKnapsack(configJSON string, optionsJSON string) (*V2Solution, error) {
+	return nil, errors.New("knapsack solver not available on this platform - requires CGO and specific platform support")
+}
@@ -0,0 +1,626 @@
+package chariot
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/couchbase/gocb/v2"
+	"go.uber.org/zap"
+)
+
+// A lazy tree reads its nodes from where they are kept as they are reached,
+// so documents far larger than memory can be navigated. A node is read with
+// its attributes and where its children are; the children are read the
+// first time they are asked for. The children of the least recently used
+// nodes are dropped once more than the tree's capacity are held, and read
+// again if needed. Nodes a script changes, and their ancestors, are kept.
+
+// defaultLazyCapacity is how many nodes a lazy tree holds by default.
+const defaultLazyCapacity = 10000
+
+// lazyRef locates a node of a lazy tree in its source.
+type lazyRef struct {
+	name   string // Given by the parent, for file nodes
+	offset int64  // Start of the node in a file
+	key    string // Document id, for Couchbase nodes
+	value  Value  // Scalar array items, which need no reading
+}
+
+type lazyNodeData struct {
+	name     string
+	key      string
+	attrs    map[string]Value
+	children []lazyRef
+}
+
+// lazySource reads the nodes of a lazy tree.
+type lazySource interface {
+	load(refs []lazyRef) ([]lazyNodeData, error)
+	String() string
+}
+
+// lazyTree is the state the nodes of a lazy tree share.
+type lazyTree struct {
+	source   lazySource
+	capacity int
+
+	mu        sync.Mutex
+	lru       *list.List // Nodes whose children are held, most recent first
+	held      int        // Children held by the nodes in lru
+	loads     int
+	evictions int
+	lastErr   error
+}
+
+// LazyNode is a node of a lazy tree.
+type LazyNode struct {
+	TreeNodeImpl
+	tree   *lazyTree
+	refs   []lazyRef
+	loaded bool          // Children holds the nodes of refs
+	pinned bool          // Changed, or an ancestor of a changed node
+	elem   *list.Element // In tree.lru while loaded and not pinned
+}
+
+func newLazyNode(tree *lazyTree, data lazyNodeData) *LazyNode {
+	n := &LazyNode{TreeNodeImpl: *NewTreeNode(data.name), tree: tree, refs: data.children}
+	for k, v := range data.attrs {
+		n.Attributes[k] = v
+	}
+	if data.key != "" {
+		n.meta.Set("key", Str(data.key))
+	}
+	return n
+}
+
+// openLazyTree reads the root of a lazy tree.
+func openLazyTree(source lazySource, root lazyRef, capacity int) (*LazyNode, error) {
+	if capacity <= 0 {
+		capacity = defaultLazyCapacity
+	}
+	data, err := source.load([]lazyRef{root})
+	if err != nil {
+		return nil, err
+	}
+	tree := &lazyTree{source: source, capacity: capacity, lru: list.New(), loads: 1}
+	return newLazyNode(tree, data[0]), nil
+}
+
+func (n *LazyNode) GetTypeLabel() string {
+	return "LazyNode"
+}
+
+func (n *LazyNode) String() string {
+	return fmt.Sprintf("LazyNode(%s)", n.NameStr)
+}
+
+// children returns the children of n, reading them if they are not held.
+// A failed read is logged and leaves n without children.
+func (n *LazyNode) children() []TreeNode {
+	t := n.tree
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !n.loaded {
+		data, err := t.source.load(n.refs)
+		if err != nil {
+			t.lastErr = err
+			cfg.ChariotLogger.Error("Lazy tree read failed", zap.String("source", t.source.String()), zap.String("node", n.NameStr), zap.Error(err))
+			return []TreeNode{}
+		}
+		t.loads += len(data)
+		n.Children = make([]TreeNode, len(data))
+		for i, d := range data {
+			child := newLazyNode(t, d)
+			child.ParentNode = n
+			n.Children[i] = child
+		}
+		n.loaded = true
+		if !n.pinned {
+			n.elem = t.lru.PushFront(n)
+			t.held += len(n.Children)
+		}
+	}
+	t.touchLocked(n)
+	t.evictLocked(n)
+	return n.Children
+}
+
+// touchLocked marks n and its ancestors as used, n most recently, so the
+// nodes on the path to n are the last to be dropped.
+func (t *lazyTree) touchLocked(n *LazyNode) {
+	if parent, ok := n.ParentNode.(*LazyNode); ok {
+		t.touchLocked(parent)
+	}
+	if n.elem != nil {
+		t.lru.MoveToFront(n.elem)
+	}
+}
+
+// evictLocked drops the children of the least recently used nodes until
+// the tree holds no more than its capacity, keeping those of keep and its
+// ancestors.
+func (t *lazyTree) evictLocked(keep *LazyNode) {
+	for t.held > t.capacity {
+		e := t.lru.Back()
+		if e == nil {
+			return
+		}
+		n := e.Value.(*LazyNode)
+		for p := keep; p != nil; {
+			if p == n {
+				return
+			}
+			p, _ = p.ParentNode.(*LazyNode)
+		}
+		t.collapseLocked(n)
+		t.evictions++
+	}
+}
+
+// collapseLocked drops the children of n, and theirs.
+func (t *lazyTree) collapseLocked(n *LazyNode) {
+	for _, c := range n.Children {
+		if child, ok := c.(*LazyNode); ok && child.loaded && !child.pinned {
+			t.collapseLocked(child)
+		}
+	}
+	if n.elem != nil {
+		t.lru.Remove(n.elem)
+		n.elem = nil
+		t.held -= len(n.Children)
+	}
+	n.Children = nil
+	n.loaded = false
+}
+
+// pin keeps n and its ancestors, with their children, from being dropped,
+// so that changes to them last.
+func (n *LazyNode) pin() {
+	n.children()
+	t := n.tree
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for p := n; p != nil && !p.pinned; {
+		p.pinned = true
+		if p.elem != nil {
+			t.lru.Remove(p.elem)
+			p.elem = nil
+			t.held -= len(p.Children)
+		}
+		parent, _ := p.ParentNode.(*LazyNode)
+		p = parent
+	}
+}
+
+func (n *LazyNode) GetChildren() []TreeNode {
+	return n.children()
+}
+
+func (n *LazyNode) GetChildByName(name string) (TreeNode, bool) {
+	for _, child := range n.children() {
+		if child.Name() == name {
+			return child, true
+		}
+	}
+	return nil, false
+}
+
+func (n *LazyNode) GetFirstChild() TreeNode {
+	if children := n.children(); len(children) > 0 {
+		return children[0]
+	}
+	return nil
+}
+
+func (n *LazyNode) GetLastChild() TreeNode {
+	if children := n.children(); len(children) > 0 {
+		return children[len(children)-1]
+	}
+	return nil
+}
+
+// GetChildCount counts the children without reading them.
+func (n *LazyNode) GetChildCount() int {
+	if n.pinned {
+		return len(n.children())
+	}
+	return len(n.refs)
+}
+
+func (n *LazyNode) IsLeaf() bool {
+	return n.GetChildCount() == 0
+}
+
+func (n *LazyNode) GetSiblings() []TreeNode {
+	if n.Parent() == nil {
+		return nil
+	}
+	siblings := []TreeNode{}
+	for _, sibling := range n.Parent().GetChildren() {
+		if sibling != TreeNode(n) {
+			siblings = append(siblings, sibling)
+		}
+	}
+	return siblings
+}
+
+func (n *LazyNode) Traverse(fn func(TreeNode) error) error {
+	if err := fn(n); err != nil {
+		return err
+	}
+	for _, child := range n.children() {
+		if err := child.Traverse(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *LazyNode) FindByName(name string) (TreeNode, bool) {
+	if n.NameStr == name {
+		return n, true
+	}
+	for _, child := range n.children() {
+		if found, ok := child.FindByName(name); ok {
+			return found, true
+		}
+	}
+	return nil, false
+}
+
+func (n *LazyNode) QueryTree(fn func(TreeNode) bool) []TreeNode {
+	matches := []TreeNode{}
+	if fn(n) {
+		matches = append(matches, n)
+	}
+	for _, child := range n.children() {
+		matches = append(matches, child.QueryTree(fn)...)
+	}
+	return matches
+}
+
+// Clone reads the whole subtree into an ordinary tree.
+func (n *LazyNode) Clone() TreeNode {
+	clone := NewTreeNode(n.NameStr)
+	for k, v := range n.Attributes {
+		clone.Attributes[k] = v
+	}
+	for _, key := range n.GetAllMeta().Keys() {
+		if v, ok := n.GetAllMeta().Get(key); ok {
+			clone.SetMeta(key, v)
+		}
+	}
+	for _, child := range n.children() {
+		clone.AddChild(child.Clone())
+	}
+	return clone
+}
+
+func (n *LazyNode) SetName(newName string) string {
+	n.pin()
+	return n.TreeNodeImpl.SetName(newName)
+}
+
+func (n *LazyNode) SetAttribute(name string, value Value) {
+	n.pin()
+	n.TreeNodeImpl.SetAttribute(name, value)
+}
+
+func (n *LazyNode) RemoveAttribute(name string) {
+	n.pin()
+	n.TreeNodeImpl.RemoveAttribute(name)
+}
+
+func (n *LazyNode) AddChild(child TreeNode) {
+	n.pin()
+	markTreeChanged(n)
+	n.Children = append(n.Children, child)
+	child.SetParent(n)
+}
+
+func (n *LazyNode) AddChildAt(index int, child TreeNode) {
+	n.pin()
+	if child.Parent() != nil {
+		child.Parent().RemoveChild(child)
+	}
+	markTreeChanged(n)
+	child.SetParent(n)
+	index = max(0, min(index, len(n.Children)))
+	n.Children = append(n.Children[:index], append([]TreeNode{child}, n.Children[index:]...)...)
+}
+
+func (n *LazyNode) RemoveChild(child TreeNode) {
+	n.pin()
+	n.TreeNodeImpl.RemoveChild(child)
+}
+
+func (n *LazyNode) RemoveChildren() {
+	n.pin()
+	n.TreeNodeImpl.RemoveChildren()
+}
+
+func (n *LazyNode) SetChildByName(name string, child TreeNode) {
+	n.pin()
+	markTreeChanged(n)
+	for i, c := range n.Children {
+		if c.Name() == name {
+			n.Children[i] = child
+			child.SetParent(n)
+			return
+		}
+	}
+}
+
+// LazyTreeStats describes how much of a lazy tree is held.
+type LazyTreeStats struct {
+	Source    string `json:"source"`
+	Capacity  int    `json:"capacity"`
+	Held      int    `json:"held"`      // Nodes held that may be dropped
+	Loads     int    `json:"loads"`     // Nodes read so far
+	Evictions int    `json:"evictions"` // Times children were dropped
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Stats describes the lazy tree n belongs to.
+func (n *LazyNode) Stats() LazyTreeStats {
+	t := n.tree
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := LazyTreeStats{Source: t.source.String(), Capacity: t.capacity, Held: t.held, Loads: t.loads, Evictions: t.evictions}
+	if t.lastErr != nil {
+		stats.LastError = t.lastErr.Error()
+	}
+	return stats
+}
+
+// jsonFileSource reads JSON documents the way treeLoad maps them: objects
+// are nodes with their scalar members as attributes; object and array
+// members are children named after them; array items are children named
+// item_0, item_1... and scalar items have their value in a value attribute.
+type jsonFileSource struct{ path string }
+
+func (s *jsonFileSource) String() string { return s.path }
+
+func (s *jsonFileSource) load(refs []lazyRef) ([]lazyNodeData, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out := make([]lazyNodeData, len(refs))
+	for i, ref := range refs {
+		if out[i], err = readJSONNode(f, ref); err != nil {
+			return nil, fmt.Errorf("%s at %d: %w", s.path, ref.offset, err)
+		}
+	}
+	return out, nil
+}
+
+func jsonScalar(tok json.Token) Value {
+	if tok == nil {
+		return DBNull
+	}
+	return convertToValue(tok)
+}
+
+// skipJSONValue reads the rest of a value whose opening delimiter was read.
+func skipJSONValue(dec *json.Decoder) error {
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if d, ok := tok.(json.Delim); ok {
+			if d == '{' || d == '[' {
+				depth++
+			} else {
+				depth--
+			}
+		}
+	}
+	return nil
+}
+
+func readJSONNode(f *os.File, ref lazyRef) (lazyNodeData, error) {
+	data := lazyNodeData{name: ref.name, attrs: map[string]Value{}}
+	if ref.value != nil {
+		data.attrs["value"] = ref.value
+		return data, nil
+	}
+	r := bufio.NewReader(io.NewSectionReader(f, ref.offset, math.MaxInt64-ref.offset))
+	// Offsets are taken after the key or separator before a value
+	base := ref.offset
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return data, err
+		}
+		if !strings.ContainsRune(" \t\r\n:,", rune(b)) {
+			r.UnreadByte()
+			break
+		}
+		base++
+	}
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return data, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		data.attrs["value"] = jsonScalar(tok)
+		return data, nil
+	}
+	if delim == '[' {
+		data.attrs["type"] = Str("array")
+	}
+	for i := 0; dec.More(); i++ {
+		name := fmt.Sprintf("item_%d", i)
+		if delim == '{' {
+			key, err := dec.Token()
+			if err != nil {
+				return data, err
+			}
+			name, _ = key.(string)
+		}
+		start := base + dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return data, err
+		}
+		if _, ok := tok.(json.Delim); ok {
+			data.children = append(data.children, lazyRef{name: name, offset: start})
+			if err := skipJSONValue(dec); err != nil {
+				return data, err
+			}
+		} else if delim == '[' {
+			data.children = append(data.children, lazyRef{name: name, value: jsonScalar(tok)})
+		} else {
+			data.attrs[name] = jsonScalar(tok)
+		}
+	}
+	return data, nil
+}
+
+// xmlFileSource reads XML documents: elements are nodes with their
+// attributes, and their text, trimmed, in a text attribute. Comments and
+// processing instructions are skipped.
+type xmlFileSource struct{ path string }
+
+func (s *xmlFileSource) String() string { return s.path }
+
+func (s *xmlFileSource) load(refs []lazyRef) ([]lazyNodeData, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out := make([]lazyNodeData, len(refs))
+	for i, ref := range refs {
+		if out[i], err = readXMLNode(f, ref); err != nil {
+			return nil, fmt.Errorf("%s at %d: %w", s.path, ref.offset, err)
+		}
+	}
+	return out, nil
+}
+
+func readXMLNode(f *os.File, ref lazyRef) (lazyNodeData, error) {
+	data := lazyNodeData{attrs: map[string]Value{}}
+	dec := xml.NewDecoder(bufio.NewReader(io.NewSectionReader(f, ref.offset, math.MaxInt64-ref.offset)))
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = errors.New("no element found")
+			}
+			return data, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			data.name = start.Name.Local
+			for _, attr := range start.Attr {
+				data.attrs[attr.Name.Local] = Str(attr.Value)
+			}
+			break
+		}
+	}
+	var text strings.Builder
+	for depth := 1; depth > 0; {
+		offset := ref.offset + dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return data, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				data.children = append(data.children, lazyRef{name: t.Name.Local, offset: offset})
+			}
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 1 {
+				text.Write(t)
+			}
+		}
+	}
+	if trimmed := strings.TrimSpace(text.String()); trimmed != "" {
+		data.attrs["text"] = Str(trimmed)
+	}
+	return data, nil
+}
+
+// couchbaseLazySource reads trees kept as one document per node: the
+// document's fields are the node's attributes, except for the name field,
+// its name, and the children field, the ids of its children's documents.
+type couchbaseLazySource struct {
+	collection    *gocb.Collection
+	nameField     string
+	childrenField string
+}
+
+func (s *couchbaseLazySource) String() string {
+	return "couchbase:" + s.collection.Bucket().Name() + "." + s.collection.ScopeName() + "." + s.collection.Name()
+}
+
+func (s *couchbaseLazySource) load(refs []lazyRef) ([]lazyNodeData, error) {
+	out := make([]lazyNodeData, len(refs))
+	for i, ref := range refs {
+		res, err := s.collection.Get(ref.key, nil)
+		if err != nil {
+			return nil, fmt.Errorf("document %s: %w", ref.key, err)
+		}
+		var doc map[string]interface{}
+		if err := res.Content(&doc); err != nil {
+			return nil, fmt.Errorf("document %s: %w", ref.key, err)
+		}
+		data := lazyNodeData{name: ref.key, key: ref.key, attrs: map[string]Value{}}
+		for k, v := range doc {
+			switch k {
+			case s.nameField:
+				if name, ok := v.(string); ok {
+					data.name = name
+					continue
+				}
+			case s.childrenField:
+				if ids, ok := v.([]interface{}); ok {
+					for _, id := range ids {
+						if key, ok := id.(string); ok {
+							data.children = append(data.children, lazyRef{key: key})
+						}
+					}
+					continue
+				}
+			}
+			data.attrs[k] = jsonScalar(v)
+		}
+		out[i] = data
+	}
+	return out, nil
+}
+
+// lazyTreeOptions reads the optional options map of the lazy tree builtins.
+func lazyTreeOptions(args []Value) (map[string]Value, error) {
+	if len(args) == 0 {
+		return map[string]Value{}, nil
+	}
+	switch opts := args[0].(type) {
+	case *MapValue:
+		return opts.Values, nil
+	case MapValue:
+		return opts.Values, nil
+	default:
+		return nil, fmt.Errorf("options must be a map, got %T", args[0])
+	}
+}
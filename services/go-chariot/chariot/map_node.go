@@ -52,11 +52,13 @@ func (n *MapNode) Get(key string) (Value, bool) {
 
 // Set stores a property value by key
 func (n *MapNode) Set(key string, value Value) {
+	markTreeChanged(n)
 	n.Attributes[key] = value
 }
 
 // Remove deletes a property
 func (n *MapNode) Remove(key string) {
+	markTreeChanged(n)
 	delete(n.Attributes, key)
 }
 
@@ -53,7 +53,7 @@ func RegisterMCPFunctions(rt *Runtime) {
 			timeout = time.Duration(int(v)) * time.Millisecond
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		ctx, cancel := context.WithTimeout(rt.Context(), timeout)
 		defer cancel()
 
 		client := mcp.NewClient(&mcp.Implementation{Name: "chariot-mcp-client", Version: "v0"}, nil)
@@ -151,7 +151,7 @@ func RegisterMCPFunctions(rt *Runtime) {
 		if err != nil {
 			return nil, err
 		}
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		ctx, cancel := context.WithTimeout(rt.Context(), 15*time.Second)
 		defer cancel()
 		res, err := h.session.ListTools(ctx, &mcp.ListToolsParams{})
 		if err != nil {
@@ -183,7 +183,7 @@ func RegisterMCPFunctions(rt *Runtime) {
 			nativeArgs = convertValueToNative(args[2])
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		ctx, cancel := context.WithTimeout(rt.Context(), 30*time.Second)
 		defer cancel()
 		res, err := h.session.CallTool(ctx, &mcp.CallToolParams{Name: string(name), Arguments: nativeArgs})
 		if err != nil {
@@ -0,0 +1,249 @@
+package chariot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// mockEntry stands in for builtins within the function call that set it
+// up: a function answering calls of one builtin, or a recorded trace
+// answering the traced builtins.
+type mockEntry struct {
+	name    string         // Builtin answered by fn
+	fn      *FunctionValue // Receives the call's arguments as an array
+	fixture *fixtureState
+	depth   int     // len(callStack) of the function call it belongs to
+	calls   []Value // Arguments of the calls answered, as arrays
+	running bool    // fn is answering, so its own calls of name are real
+}
+
+// fixtureState answers traced builtin calls from a recorded trace.
+type fixtureState struct {
+	trace *ExecutionTrace
+	only  map[string]bool // Builtins answered; nil for all the traced ones
+	used  []bool
+}
+
+// TraceDir returns the directory the runtime's traces are kept in, next to
+// its snapshots.
+func (rt *Runtime) TraceDir() string {
+	return filepath.Join(filepath.Dir(rt.SnapshotDir()), "traces")
+}
+
+// callMock answers a call of the builtin name from the innermost mock that
+// covers it; ok is false when none does.
+func (rt *Runtime) callMock(name string, args []Value) (val Value, ok bool, err error) {
+	for i := len(rt.mocks) - 1; i >= 0; i-- {
+		m := rt.mocks[i]
+		if m.fixture != nil {
+			if val, ok, err = m.fixture.answer(name, args); ok {
+				return val, true, err
+			}
+			continue
+		}
+		if m.name != name || m.running {
+			continue
+		}
+		arr := NewArray()
+		for _, a := range args {
+			arr.Append(a)
+		}
+		m.calls = append(m.calls, arr)
+		m.running = true
+		val, err = executeFunctionValue(rt, m.fn, []Value{arr})
+		m.running = false
+		return val, true, err
+	}
+	return nil, false, nil
+}
+
+// dropMocks removes the mocks set up by function calls at depth or deeper,
+// once the call at depth returns.
+func (rt *Runtime) dropMocks(depth int) {
+	keep := rt.mocks[:0]
+	for _, m := range rt.mocks {
+		if m.depth < depth {
+			keep = append(keep, m)
+		}
+	}
+	for i := len(keep); i < len(rt.mocks); i++ {
+		rt.mocks[i] = nil
+	}
+	rt.mocks = keep
+}
+
+// fixtureKey identifies the arguments of a call for matching it with a
+// recorded one.
+func fixtureKey(args []interface{}) string {
+	if len(args) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Sprint(args...)
+	}
+	return string(data)
+}
+
+// answer returns the recorded answer to a call of name with args: that of
+// the first call not answered yet with the same arguments, or of the last
+// one answered once all have been. Calls whose arguments were not recorded,
+// such as connections, are matched in order.
+func (f *fixtureState) answer(name string, args []Value) (Value, bool, error) {
+	if !IsTracedFunction(name) || (f.only != nil && !f.only[name]) {
+		return nil, false, nil
+	}
+	values := make([]interface{}, len(args))
+	for i, a := range args {
+		values[i], _ = traceValue(a)
+	}
+	key := fixtureKey(values)
+	match := -1
+	for i, call := range f.trace.Calls {
+		if call.Func != name || (!traceHidesArgs[name] && fixtureKey(call.Args) != key) {
+			continue
+		}
+		match = i
+		if !f.used[i] {
+			break
+		}
+	}
+	if match < 0 {
+		return nil, true, fmt.Errorf("%s: no call with these arguments recorded in fixture '%s'", name, f.trace.Name)
+	}
+	f.used[match] = true
+	call := f.trace.Calls[match]
+	switch {
+	case call.Error != "":
+		return nil, true, errors.New(call.Error)
+	case call.Opaque:
+		return nil, true, fmt.Errorf("%s: the result was not recorded in fixture '%s'", name, f.trace.Name)
+	}
+	return restoreSnapshotValue(call.Result), true, nil
+}
+
+// RegisterMockFunctions registers mock, mockFixture, mockCalls and unmock.
+func RegisterMockFunctions(rt *Runtime) {
+	// scopeDepth is the depth of the function call mocks set up now belong
+	// to; mocks only exist within a function, such as a test function.
+	scopeDepth := func(fname string) (int, error) {
+		if len(rt.callStack) == 0 {
+			return 0, fmt.Errorf("%s can only be used inside a function, such as a test function", fname)
+		}
+		return len(rt.callStack), nil
+	}
+
+	// mock(name, function) answers the calls of the builtin name with
+	// function, which receives the call's arguments as an array, until the
+	// function that called mock returns.
+	rt.Register("mock", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, errors.New("mock requires 2 arguments: builtin name, function")
+		}
+		name, ok := args[0].(Str)
+		if !ok || name == "" {
+			return nil, errors.New("mock: builtin name must be a non-empty string")
+		}
+		if _, ok := rt.funcs[string(name)]; !ok {
+			return nil, fmt.Errorf("mock: no builtin named '%s'", name)
+		}
+		fn, ok := args[1].(*FunctionValue)
+		if !ok {
+			return nil, fmt.Errorf("mock: expected function value, got %T", args[1])
+		}
+		depth, err := scopeDepth("mock")
+		if err != nil {
+			return nil, err
+		}
+		rt.mocks = append(rt.mocks, &mockEntry{name: string(name), fn: fn, depth: depth})
+		return Bool(true), nil
+	})
+
+	// mockFixture(trace, [builtins]) answers the database, MCP, file and
+	// other traced calls from a recorded execution trace, until the
+	// function that called it returns. builtins limits it to some of them.
+	rt.Register("mockFixture", func(args ...Value) (Value, error) {
+		if len(args) < 1 || len(args) > 2 {
+			return nil, errors.New("mockFixture requires 1-2 arguments: trace name, [builtins]")
+		}
+		traceName, ok := args[0].(Str)
+		if !ok {
+			return nil, errors.New("mockFixture: trace name must be a string")
+		}
+		t, err := LoadTrace(rt.TraceDir(), string(traceName))
+		if errors.Is(err, ErrTraceNotFound) && SharedTraceDir() != rt.TraceDir() {
+			t, err = LoadTrace(SharedTraceDir(), string(traceName))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("mockFixture: %w", err)
+		}
+		f := &fixtureState{trace: t, used: make([]bool, len(t.Calls))}
+		if len(args) == 2 {
+			arr, ok := args[1].(*ArrayValue)
+			if !ok {
+				return nil, fmt.Errorf("mockFixture: builtins must be an array, got %T", args[1])
+			}
+			f.only = map[string]bool{}
+			for i := 0; i < arr.Length(); i++ {
+				f.only[fmt.Sprint(arr.Get(i))] = true
+			}
+		}
+		depth, err := scopeDepth("mockFixture")
+		if err != nil {
+			return nil, err
+		}
+		rt.mocks = append(rt.mocks, &mockEntry{fixture: f, depth: depth})
+		return Number(len(t.Calls)), nil
+	})
+
+	// mockCalls(name) returns the arguments of the calls the mocks of the
+	// builtin name in effect have answered, one array per call.
+	rt.Register("mockCalls", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, errors.New("mockCalls requires 1 argument: builtin name")
+		}
+		name, ok := args[0].(Str)
+		if !ok {
+			return nil, errors.New("mockCalls: builtin name must be a string")
+		}
+		calls := NewArray()
+		for _, m := range rt.mocks {
+			if m.name == string(name) {
+				for _, c := range m.calls {
+					calls.Append(c)
+				}
+			}
+		}
+		return calls, nil
+	})
+
+	// unmock([name]) removes the mocks of the builtin name, or all of them,
+	// set up in the current function.
+	rt.Register("unmock", func(args ...Value) (Value, error) {
+		if len(args) > 1 {
+			return nil, errors.New("unmock takes at most 1 argument: builtin name")
+		}
+		var name string
+		if len(args) == 1 {
+			s, ok := args[0].(Str)
+			if !ok {
+				return nil, errors.New("unmock: builtin name must be a string")
+			}
+			name = string(s)
+		}
+		depth := len(rt.callStack)
+		keep := rt.mocks[:0]
+		removed := 0
+		for _, m := range rt.mocks {
+			if m.depth == depth && (name == "" || m.name == name) {
+				removed++
+				continue
+			}
+			keep = append(keep, m)
+		}
+		rt.mocks = keep
+		return Number(removed), nil
+	})
+}
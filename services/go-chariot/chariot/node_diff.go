@@ -0,0 +1,327 @@
+package chariot
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// nodeDiff and nodeMerge compare trees by path. A path joins child names
+// and finally an attribute name with dots, as getProp paths do. Children
+// are matched by name, and among siblings of the same name by position:
+// the second "item" child is "item[1]".
+
+// NodeChange is a difference between two trees.
+type NodeChange struct {
+	Path string
+	Kind string // "node" or "attribute"
+	From Value  // nil when added
+	To   Value  // nil when removed
+}
+
+// NodeConflict is a change both sides of a merge made differently.
+type NodeConflict struct {
+	Path   string
+	Kind   string
+	Base   Value // nil when absent
+	Ours   Value
+	Theirs Value
+}
+
+// childKey identifies a child among its siblings.
+type childKey struct {
+	name string
+	nth  int
+}
+
+func (k childKey) segment() string {
+	if k.nth == 0 {
+		return k.name
+	}
+	return fmt.Sprintf("%s[%d]", k.name, k.nth)
+}
+
+func joinNodePath(path, segment string) string {
+	if path == "" {
+		return segment
+	}
+	return path + "." + segment
+}
+
+// keyedChildren returns the children of n by key, and the keys in order.
+func keyedChildren(n TreeNode) (map[childKey]TreeNode, []childKey) {
+	children := map[childKey]TreeNode{}
+	keys := []childKey{}
+	if n == nil {
+		return children, keys
+	}
+	seen := map[string]int{}
+	for _, child := range n.GetChildren() {
+		key := childKey{child.Name(), seen[child.Name()]}
+		seen[child.Name()]++
+		children[key] = child
+		keys = append(keys, key)
+	}
+	return children, keys
+}
+
+func sortedAttributeNames(maps ...map[string]Value) []string {
+	set := map[string]bool{}
+	for _, m := range maps {
+		for name := range m {
+			set[name] = true
+		}
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func nodeAttributes(n TreeNode) map[string]Value {
+	if n == nil {
+		return nil
+	}
+	return n.GetAttributes()
+}
+
+// sameValue reports whether two values are equal, comparing arrays, maps
+// and trees by content.
+func sameValue(a, b Value) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	switch va := a.(type) {
+	case Str, Number, Bool:
+		return valuesEqual(a, b)
+	case *ArrayValue:
+		vb, ok := b.(*ArrayValue)
+		if !ok || va.Length() != vb.Length() {
+			return false
+		}
+		for i := 0; i < va.Length(); i++ {
+			if !sameValue(va.Get(i), vb.Get(i)) {
+				return false
+			}
+		}
+		return true
+	case []Value:
+		vb, ok := b.([]Value)
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for i := range va {
+			if !sameValue(va[i], vb[i]) {
+				return false
+			}
+		}
+		return true
+	case *MapValue:
+		switch vb := b.(type) {
+		case *MapValue:
+			return sameValueMaps(va.Values, vb.Values)
+		case MapValue:
+			return sameValueMaps(va.Values, vb.Values)
+		}
+		return false
+	case MapValue:
+		return sameValue(&va, b)
+	case TreeNode:
+		vb, ok := b.(TreeNode)
+		return ok && va.Name() == vb.Name() && len(diffNodes(va, vb)) == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func sameValueMaps(a, b map[string]Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, va := range a {
+		vb, ok := b[k]
+		if !ok || !sameValue(va, vb) {
+			return false
+		}
+	}
+	return true
+}
+
+// diffNodes lists how b differs from a: attributes, then children, in
+// order. The roots are compared whatever their names.
+func diffNodes(a, b TreeNode) []NodeChange {
+	changes := []NodeChange{}
+	diffNodesAt("", a, b, &changes)
+	return changes
+}
+
+func diffNodesAt(path string, a, b TreeNode, changes *[]NodeChange) {
+	attrsA, attrsB := a.GetAttributes(), b.GetAttributes()
+	for _, name := range sortedAttributeNames(attrsA, attrsB) {
+		va, inA := attrsA[name]
+		vb, inB := attrsB[name]
+		if inA && inB && sameValue(va, vb) {
+			continue
+		}
+		change := NodeChange{Path: joinNodePath(path, name), Kind: "attribute"}
+		if inA {
+			change.From = va
+		}
+		if inB {
+			change.To = vb
+		}
+		*changes = append(*changes, change)
+	}
+
+	childrenA, keysA := keyedChildren(a)
+	childrenB, keysB := keyedChildren(b)
+	for _, key := range keysA {
+		childPath := joinNodePath(path, key.segment())
+		if childB, ok := childrenB[key]; ok {
+			diffNodesAt(childPath, childrenA[key], childB, changes)
+		} else {
+			*changes = append(*changes, NodeChange{Path: childPath, Kind: "node", From: childrenA[key]})
+		}
+	}
+	for _, key := range keysB {
+		if _, ok := childrenA[key]; !ok {
+			*changes = append(*changes, NodeChange{Path: joinNodePath(path, key.segment()), Kind: "node", To: childrenB[key]})
+		}
+	}
+}
+
+// conflictMarker is what a merged tree holds where an attribute conflicts:
+// a map with conflict true and the base, ours and theirs values, those
+// absent on a side left out.
+func conflictMarker(base, ours, theirs Value) *MapValue {
+	m := NewMap()
+	m.Set("conflict", Bool(true))
+	for _, side := range []struct {
+		name  string
+		value Value
+	}{{"base", base}, {"ours", ours}, {"theirs", theirs}} {
+		if side.value != nil {
+			m.Set(side.name, side.value)
+		}
+	}
+	return m
+}
+
+// nodeMerger merges two trees changed from a common base. Where both sides
+// changed the same attribute or node differently, prefer, "ours" or
+// "theirs", decides; otherwise the merged tree holds a conflict marker.
+// Conflicts are listed either way.
+type nodeMerger struct {
+	prefer    string
+	conflicts []NodeConflict
+}
+
+// mergeNodes merges the trees under base, ours and theirs, any of which
+// may be nil where the node is absent. It returns nil when the node is
+// removed.
+func (m *nodeMerger) mergeNodes(path string, base, ours, theirs TreeNode) TreeNode {
+	switch {
+	case ours == nil && theirs == nil:
+		return nil
+	case base != nil && ours == nil:
+		if sameNode(base, theirs) {
+			return nil
+		}
+		return m.nodeConflict(path, base, ours, theirs)
+	case base != nil && theirs == nil:
+		if sameNode(base, ours) {
+			return nil
+		}
+		return m.nodeConflict(path, base, ours, theirs)
+	case base == nil && ours == nil:
+		return theirs.Clone()
+	case base == nil && theirs == nil:
+		return ours.Clone()
+	}
+
+	// Both sides have the node: merge attributes and children
+	merged := NewTreeNode(ours.Name())
+	for _, key := range ours.GetAllMeta().Keys() {
+		if v, ok := ours.GetMeta(key); ok {
+			merged.SetMeta(key, v)
+		}
+	}
+	attrsBase, attrsOurs, attrsTheirs := nodeAttributes(base), ours.GetAttributes(), theirs.GetAttributes()
+	for _, name := range sortedAttributeNames(attrsBase, attrsOurs, attrsTheirs) {
+		vb := attrsBase[name]
+		vo := attrsOurs[name]
+		vt := attrsTheirs[name]
+		var v Value
+		switch {
+		case sameValue(vo, vt), sameValue(vb, vt):
+			v = vo
+		case sameValue(vb, vo):
+			v = vt
+		default:
+			m.conflicts = append(m.conflicts, NodeConflict{Path: joinNodePath(path, name), Kind: "attribute", Base: vb, Ours: vo, Theirs: vt})
+			switch m.prefer {
+			case "ours":
+				v = vo
+			case "theirs":
+				v = vt
+			default:
+				v = conflictMarker(vb, vo, vt)
+			}
+		}
+		if v != nil {
+			merged.Attributes[name] = v
+		}
+	}
+
+	childrenBase, _ := keyedChildren(base)
+	childrenOurs, keysOurs := keyedChildren(ours)
+	childrenTheirs, keysTheirs := keyedChildren(theirs)
+	keys := keysOurs
+	for _, key := range keysTheirs {
+		if _, ok := childrenOurs[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		child := m.mergeNodes(joinNodePath(path, key.segment()), childrenBase[key], childrenOurs[key], childrenTheirs[key])
+		if child != nil {
+			merged.AddChild(child)
+		}
+	}
+	return merged
+}
+
+// nodeConflict handles a node one side removed and the other changed. The
+// changed node is kept, with the conflict in its metadata, unless prefer
+// picks the side that removed it.
+func (m *nodeMerger) nodeConflict(path string, base, ours, theirs TreeNode) TreeNode {
+	conflict := NodeConflict{Path: path, Kind: "node", Base: base}
+	kept, removedBy := ours, "theirs"
+	if ours == nil {
+		kept, removedBy = theirs, "ours"
+		conflict.Theirs = theirs
+	} else {
+		conflict.Ours = ours
+	}
+	m.conflicts = append(m.conflicts, conflict)
+	if m.prefer == removedBy {
+		return nil
+	}
+	clone := kept.Clone()
+	if m.prefer == "" {
+		clone.SetMeta("conflict", Str("removed in "+removedBy))
+	}
+	return clone
+}
+
+func sameNode(a, b TreeNode) bool {
+	return a.Name() == b.Name() && len(diffNodes(a, b)) == 0
+}
+
+// mergeTrees merges ours and theirs, both changed from base. The merged
+// root takes the name of ours.
+func mergeTrees(base, ours, theirs TreeNode, prefer string) (TreeNode, []NodeConflict) {
+	m := &nodeMerger{prefer: prefer, conflicts: []NodeConflict{}}
+	return m.mergeNodes("", base, ours, theirs), m.conflicts
+}
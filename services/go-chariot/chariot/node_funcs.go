@@ -712,10 +712,11 @@ func RegisterNode(rt *Runtime) {
 		return node, nil
 	})
 
-	// Add queryNode function
+	// queryNode(node, predicate) - nodes for which a function returns true,
+	// or queryNode(node, query) - nodes a tree query selects (see tree_query.go)
 	rt.Register("queryNode", func(args ...Value) (Value, error) {
 		if len(args) != 2 {
-			return nil, errors.New("queryNode requires 2 arguments: node and predicate function")
+			return nil, errors.New("queryNode requires 2 arguments: node and predicate function or query")
 		}
 
 		// Unwrap arguments if they're scope entries
@@ -731,10 +732,22 @@ func RegisterNode(rt *Runtime) {
 			return nil, fmt.Errorf("expected node, got %T", args[0])
 		}
 
+		if src, ok := args[1].(Str); ok {
+			query, err := compileTreeQuery(string(src))
+			if err != nil {
+				return nil, err
+			}
+			result := NewArray()
+			for _, match := range query.run(node) {
+				result.Append(match)
+			}
+			return result, nil
+		}
+
 		// Get the predicate function
 		fn, ok := args[1].(*FunctionValue)
 		if !ok {
-			return nil, fmt.Errorf("second argument must be a function, got %T", args[1])
+			return nil, fmt.Errorf("second argument must be a function or query string, got %T", args[1])
 		}
 
 		// Get the call function
@@ -933,6 +946,9 @@ func RegisterNode(rt *Runtime) {
 
 		// Get the value (third argument) - keep as original Value type
 		value := args[2]
+		if tn, ok := node.(TreeNode); ok {
+			markTreeChanged(tn)
+		}
 
 		// Handle different node types
 		switch n := node.(type) {
@@ -1013,6 +1029,9 @@ func RegisterNode(rt *Runtime) {
 		} else {
 			value = tvar.Values
 		}
+		if tn, ok := node.(TreeNode); ok {
+			markTreeChanged(tn)
+		}
 
 		switch n := node.(type) {
 		case *JSONNode:
@@ -1239,11 +1258,7 @@ func RegisterNode(rt *Runtime) {
 			return nil, fmt.Errorf("expected node, got %T", args[0])
 		}
 
-		if node.GetChildren() == nil {
-			return Number(0), nil
-		}
-
-		return Number(len(node.GetChildren())), nil
+		return Number(node.GetChildCount()), nil
 	})
 
 	// Node utilities
@@ -1338,15 +1353,109 @@ func RegisterNode(rt *Runtime) {
 		return Str(node.String()), nil
 	})
 
+	// nodeDiff(a, b) - how tree b differs from tree a
+	rt.Register("nodeDiff", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, errors.New("nodeDiff requires 2 arguments: a, b")
+		}
+
+		// Unwrap scope entries
+		for i, arg := range args {
+			if tvar, ok := arg.(ScopeEntry); ok {
+				args[i] = tvar.Value
+			}
+		}
+
+		a, ok := args[0].(TreeNode)
+		if !ok {
+			return nil, fmt.Errorf("first argument must be a node, got %T", args[0])
+		}
+		b, ok := args[1].(TreeNode)
+		if !ok {
+			return nil, fmt.Errorf("second argument must be a node, got %T", args[1])
+		}
+
+		added, removed, changed := NewArray(), NewArray(), NewArray()
+		for _, change := range diffNodes(a, b) {
+			entry := NewMap()
+			entry.Set("path", Str(change.Path))
+			entry.Set("kind", Str(change.Kind))
+			switch {
+			case change.From == nil:
+				entry.Set("value", change.To)
+				added.Append(entry)
+			case change.To == nil:
+				entry.Set("value", change.From)
+				removed.Append(entry)
+			default:
+				entry.Set("from", change.From)
+				entry.Set("to", change.To)
+				changed.Append(entry)
+			}
+		}
+		result := NewMap()
+		result.Set("added", added)
+		result.Set("removed", removed)
+		result.Set("changed", changed)
+		result.Set("equal", Bool(added.Length()+removed.Length()+changed.Length() == 0))
+		return result, nil
+	})
+
+	// nodeMerge(base, ours, theirs [, prefer]) - three-way merge of two trees
+	// changed from a common base
+	rt.Register("nodeMerge", func(args ...Value) (Value, error) {
+		if len(args) < 3 || len(args) > 4 {
+			return nil, errors.New("nodeMerge requires 3-4 arguments: base, ours, theirs, [prefer]")
+		}
+
+		// Unwrap scope entries
+		for i, arg := range args {
+			if tvar, ok := arg.(ScopeEntry); ok {
+				args[i] = tvar.Value
+			}
+		}
+
+		nodes := make([]TreeNode, 3)
+		for i, name := range []string{"base", "ours", "theirs"} {
+			node, ok := args[i].(TreeNode)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a node, got %T", name, args[i])
+			}
+			nodes[i] = node
+		}
+		prefer := ""
+		if len(args) > 3 {
+			p, ok := args[3].(Str)
+			if !ok || (p != "ours" && p != "theirs") {
+				return nil, fmt.Errorf("prefer must be 'ours' or 'theirs', got %v", args[3])
+			}
+			prefer = string(p)
+		}
+
+		merged, conflicts := mergeTrees(nodes[0], nodes[1], nodes[2], prefer)
+		list := NewArray()
+		for _, c := range conflicts {
+			entry := conflictMarker(c.Base, c.Ours, c.Theirs)
+			entry.Set("path", Str(c.Path))
+			entry.Set("kind", Str(c.Kind))
+			list.Append(entry)
+		}
+		result := NewMap()
+		result.Set("merged", merged)
+		result.Set("conflicts", list)
+		result.Set("clean", Bool(len(conflicts) == 0))
+		return result, nil
+	})
+
 }
 
 // Helper function to convert Go values to Chariot values
 func convertToChariotValue(value interface{}) Value {
 	switch v := value.(type) {
 	case string:
-		return Str(v)
+		return InternStr(v)
 	case float64:
-		return Number(v)
+		return BoxNumber(v)
 	case bool:
 		return Bool(v)
 	case nil:
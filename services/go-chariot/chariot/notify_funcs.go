@@ -0,0 +1,365 @@
+package chariot
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+// notifyTimeout bounds one SMTP session or Slack API call.
+const notifyTimeout = 30 * time.Second
+
+// RegisterNotifyFunctions registers sendEmail and slackPost. The SMTP server
+// and Slack token are server settings; recipients are checked against the
+// runtime's sandbox profile.
+func RegisterNotifyFunctions(rt *Runtime) {
+	// sendEmail(to, subject, body, [opts]) -> true
+	// to: address, comma-separated addresses or an array of addresses
+	// opts: {"cc": ..., "bcc": ..., "replyTo": "addr", "html": bool}
+	rt.Register("sendEmail", func(args ...Value) (Value, error) {
+		if len(args) < 3 || len(args) > 4 {
+			return nil, errors.New("sendEmail requires 3 or 4 arguments: to, subject, body, [options]")
+		}
+		args = unwrapScopeEntries(args)
+		to, err := emailAddresses(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("sendEmail: to: %w", err)
+		}
+		if len(to) == 0 {
+			return nil, errors.New("sendEmail: no recipients")
+		}
+		subject, ok := args[1].(Str)
+		if !ok {
+			return nil, fmt.Errorf("sendEmail: subject must be a string, got %T", args[1])
+		}
+		body, ok := args[2].(Str)
+		if !ok {
+			return nil, fmt.Errorf("sendEmail: body must be a string, got %T", args[2])
+		}
+		msg := emailMessage{To: to, Subject: string(subject), Body: string(body)}
+		if len(args) == 4 {
+			opts, ok := args[3].(*MapValue)
+			if !ok {
+				return nil, fmt.Errorf("sendEmail: options must be a map, got %T", args[3])
+			}
+			if msg.Cc, err = emailAddresses(opts.Values["cc"]); err != nil {
+				return nil, fmt.Errorf("sendEmail: cc: %w", err)
+			}
+			if msg.Bcc, err = emailAddresses(opts.Values["bcc"]); err != nil {
+				return nil, fmt.Errorf("sendEmail: bcc: %w", err)
+			}
+			if v, ok := opts.Values["replyTo"].(Str); ok && v != "" {
+				addr, err := mail.ParseAddress(string(v))
+				if err != nil {
+					return nil, fmt.Errorf("sendEmail: replyTo: %w", err)
+				}
+				msg.ReplyTo = addr
+			}
+			if v, ok := opts.Values["html"].(Bool); ok {
+				msg.HTML = bool(v)
+			}
+		}
+
+		policy := rt.SandboxProfile().Email
+		if policy == nil {
+			return nil, fmt.Errorf("sendEmail is not allowed by sandbox profile %q", rt.SandboxProfile().Name)
+		}
+		for _, addr := range msg.recipients() {
+			if !policy.permits(addr) {
+				return nil, fmt.Errorf("sendEmail: recipient %s is not allowed by sandbox profile %q", addr, rt.SandboxProfile().Name)
+			}
+		}
+		if err := sendSMTP(rt.Context(), msg); err != nil {
+			return nil, fmt.Errorf("sendEmail: %w", err)
+		}
+		return Bool(true), nil
+	})
+
+	// slackPost(channel, message, [opts]) -> message timestamp
+	// opts: {"threadTs": "...", "blocks": array} passed through to chat.postMessage
+	rt.Register("slackPost", func(args ...Value) (Value, error) {
+		if len(args) < 2 || len(args) > 3 {
+			return nil, errors.New("slackPost requires 2 or 3 arguments: channel, message, [options]")
+		}
+		args = unwrapScopeEntries(args)
+		channel, ok := args[0].(Str)
+		if !ok || channel == "" {
+			return nil, fmt.Errorf("slackPost: channel must be a non-empty string")
+		}
+		text, ok := args[1].(Str)
+		if !ok {
+			return nil, fmt.Errorf("slackPost: message must be a string, got %T", args[1])
+		}
+		payload := map[string]interface{}{"channel": string(channel), "text": string(text)}
+		if len(args) == 3 {
+			opts, ok := args[2].(*MapValue)
+			if !ok {
+				return nil, fmt.Errorf("slackPost: options must be a map, got %T", args[2])
+			}
+			if v, ok := opts.Values["threadTs"].(Str); ok && v != "" {
+				payload["thread_ts"] = string(v)
+			}
+			if v, ok := opts.Values["blocks"]; ok {
+				payload["blocks"] = ValueToJSON(v)
+			}
+		}
+
+		policy := rt.SandboxProfile().Slack
+		if !policy.permits(string(channel)) {
+			return nil, fmt.Errorf("slackPost: channel %s is not allowed by sandbox profile %q", channel, rt.SandboxProfile().Name)
+		}
+		ts, err := postSlack(rt.Context(), payload)
+		if err != nil {
+			return nil, fmt.Errorf("slackPost: %w", err)
+		}
+		return Str(ts), nil
+	})
+}
+
+func unwrapScopeEntries(args []Value) []Value {
+	out := make([]Value, len(args))
+	for i, a := range args {
+		if se, ok := a.(ScopeEntry); ok {
+			a = se.Value
+		}
+		out[i] = a
+	}
+	return out
+}
+
+// emailAddresses accepts nil, a comma-separated string or an array of
+// strings.
+func emailAddresses(v Value) ([]*mail.Address, error) {
+	var raw []string
+	switch val := v.(type) {
+	case nil:
+		return nil, nil
+	case Str:
+		raw = strings.Split(string(val), ",")
+	case *ArrayValue:
+		for _, e := range val.Elements {
+			s, ok := e.(Str)
+			if !ok {
+				return nil, fmt.Errorf("addresses must be strings, got %T", e)
+			}
+			raw = append(raw, string(s))
+		}
+	default:
+		return nil, fmt.Errorf("expected an address or an array of addresses, got %T", v)
+	}
+	var out []*mail.Address
+	for _, s := range raw {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		addr, err := mail.ParseAddress(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", s, err)
+		}
+		out = append(out, addr)
+	}
+	return out, nil
+}
+
+type emailMessage struct {
+	To, Cc, Bcc []*mail.Address
+	ReplyTo     *mail.Address
+	Subject     string
+	Body        string
+	HTML        bool
+}
+
+// recipients returns every envelope recipient.
+func (m emailMessage) recipients() []string {
+	var out []string
+	for _, list := range [][]*mail.Address{m.To, m.Cc, m.Bcc} {
+		for _, a := range list {
+			out = append(out, a.Address)
+		}
+	}
+	return out
+}
+
+func joinAddresses(list []*mail.Address) string {
+	parts := make([]string, len(list))
+	for i, a := range list {
+		parts[i] = a.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// bytes renders the message as MIME; Bcc recipients are left out of the
+// headers.
+func (m emailMessage) bytes(from *mail.Address) ([]byte, error) {
+	if strings.ContainsAny(m.Subject, "\r\n") {
+		return nil, errors.New("subject must not contain line breaks")
+	}
+	var buf bytes.Buffer
+	id := make([]byte, 12)
+	_, _ = rand.Read(id)
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+	header("From", from.String())
+	header("To", joinAddresses(m.To))
+	if len(m.Cc) > 0 {
+		header("Cc", joinAddresses(m.Cc))
+	}
+	if m.ReplyTo != nil {
+		header("Reply-To", m.ReplyTo.String())
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+hex.EncodeToString(id)+"@"+domain+">")
+	header("MIME-Version", "1.0")
+	contentType := "text/plain"
+	if m.HTML {
+		contentType = "text/html"
+	}
+	header("Content-Type", contentType+"; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := io.WriteString(qp, m.Body); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendSMTP delivers msg through the configured SMTP server, giving up when
+// ctx is done. smtp_tls selects starttls (the default; upgrade when the
+// server offers it), tls (implicit TLS, usually port 465) or none.
+func sendSMTP(ctx context.Context, msg emailMessage) error {
+	c := cfg.ChariotConfig
+	if c.SMTPHost == "" {
+		return errors.New("no SMTP server configured (set CHARIOT_SMTP_HOST)")
+	}
+	from, err := mail.ParseAddress(c.SMTPFrom)
+	if err != nil {
+		return fmt.Errorf("invalid CHARIOT_SMTP_FROM %q: %w", c.SMTPFrom, err)
+	}
+	data, err := msg.bytes(from)
+	if err != nil {
+		return err
+	}
+	port := c.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(c.SMTPHost, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: c.SMTPHost}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: notifyTimeout}
+	mode := strings.ToLower(c.SMTPTLS)
+	if mode == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(notifyTimeout)
+	if at, ok := ctx.Deadline(); ok && at.Before(deadline) {
+		deadline = at
+	}
+	_ = conn.SetDeadline(deadline)
+	client, err := smtp.NewClient(conn, c.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if mode == "" || mode == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+	if c.SMTPUsername != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.SMTPUsername, c.SMTPPassword, c.SMTPHost)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, rcpt := range msg.recipients() {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("recipient %s: %w", rcpt, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// postSlack calls chat.postMessage with the configured bot token, giving up
+// when ctx is done, and returns the timestamp Slack assigned to the message.
+func postSlack(ctx context.Context, payload map[string]interface{}) (string, error) {
+	c := cfg.ChariotConfig
+	if c.SlackToken == "" {
+		return "", errors.New("no Slack token configured (set CHARIOT_SLACK_TOKEN)")
+	}
+	base := strings.TrimSuffix(c.SlackAPIURL, "/")
+	if base == "" {
+		base = "https://slack.com/api"
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/chat.postMessage", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+c.SlackToken)
+	resp, err := (&http.Client{Timeout: notifyTimeout}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+		TS    string `json:"ts"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return "", fmt.Errorf("slack API returned %s", resp.Status)
+	}
+	if !result.OK {
+		return "", fmt.Errorf("slack API error: %s", result.Error)
+	}
+	return result.TS, nil
+}
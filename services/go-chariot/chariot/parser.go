@@ -26,6 +26,7 @@ const (
 	TOK_COMMA    // ,
 	TOK_LBRACKET // [
 	TOK_RBRACKET // ]
+	TOK_COLON    // : (type annotations)
 )
 
 // Token holds the type and literal text.
@@ -40,6 +41,13 @@ type Lexer struct {
 	pos  int
 	line int // Track current line number
 	col  int // Track current column
+
+	lineStart int // Offset of the first byte on the current line
+	tokLine   int // Line where the most recent token starts
+	tokCol    int // Column where the most recent token starts
+
+	doc    []string // Text of the last run of consecutive /// lines
+	docEnd int      // Line of the last /// line
 }
 
 // NewLexer creates a new Lexer for the given source.
@@ -47,9 +55,31 @@ func NewLexer(src string) *Lexer {
 	return &Lexer{src: src, line: 1, col: 1}
 }
 
-// getLineCol returns the current line and column
+// getLineCol returns the line and column where the most recent token starts
 func (lx *Lexer) getLineCol() (int, int) {
-	return lx.line, lx.col
+	if lx.tokLine == 0 {
+		return lx.line, lx.col
+	}
+	return lx.tokLine, lx.tokCol
+}
+
+// noteDoc records a /// line, continuing the doc comment when it follows
+// another one.
+func (lx *Lexer) noteDoc(text string) {
+	if lx.docEnd != lx.line-1 {
+		lx.doc = nil
+	}
+	text = strings.TrimRight(text, "\r")
+	lx.doc = append(lx.doc, strings.TrimPrefix(text, " "))
+	lx.docEnd = lx.line
+}
+
+// docBefore returns the doc comment ending on the line before line.
+func (lx *Lexer) docBefore(line int) string {
+	if len(lx.doc) == 0 || lx.docEnd != line-1 {
+		return ""
+	}
+	return strings.Join(lx.doc, "\n")
 }
 
 // Next returns the next Token from the input.
@@ -60,11 +90,14 @@ func (lx *Lexer) Next() Token {
 		if s[lx.pos] == '\n' {
 			lx.line++
 			lx.col = 1
+			lx.lineStart = lx.pos + 1
 		} else {
 			lx.col++
 		}
 		lx.pos++
 	}
+	lx.tokLine = lx.line
+	lx.tokCol = lx.pos - lx.lineStart + 1
 	if lx.pos >= len(s) {
 		return Token{Type: TOK_EOF}
 	}
@@ -77,9 +110,13 @@ func (lx *Lexer) Next() Token {
 		if lx.pos+1 < len(s) && s[lx.pos+1] == '/' {
 			// Skip to end of line or end of input
 			lx.pos += 2 // Skip the '//'
+			start := lx.pos
 			for lx.pos < len(s) && s[lx.pos] != '\n' {
 				lx.pos++
 			}
+			if start < lx.pos && s[start] == '/' {
+				lx.noteDoc(s[start+1 : lx.pos])
+			}
 			// Recursively get the next token
 			return lx.Next()
 		}
@@ -153,6 +190,9 @@ func (lx *Lexer) Next() Token {
 	case c == ']':
 		lx.pos++
 		return Token{Type: TOK_RBRACKET}
+	case c == ':':
+		lx.pos++
+		return Token{Type: TOK_COLON}
 	default:
 		// skip unknown
 		lx.pos++
@@ -192,6 +232,29 @@ func NewParserWithFilename(src string, filename string) *Parser {
 	return p
 }
 
+// ParseError is a syntax error and the position the parser had reached when
+// it was detected.
+type ParseError struct {
+	Err error
+	Pos SourcePos
+}
+
+func (e *ParseError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// ParseSource parses a program without executing it. The filename is used in
+// error positions and stack traces; syntax errors are returned as *ParseError.
+func ParseSource(src, filename string) (*Block, error) {
+	p := NewParserWithFilename(src, filename)
+	ast, err := p.parseProgram()
+	if err != nil {
+		return nil, &ParseError{Err: err, Pos: p.getCurrentPos()}
+	}
+	return ast, nil
+}
+
 // getCurrentPos returns the current source position
 func (p *Parser) getCurrentPos() SourcePos {
 	line, col := p.lx.getLineCol()
@@ -353,6 +416,11 @@ func (p *Parser) parseProgram() (*Block, error) {
 
 // parseExpr handles variable refs, literals, function calls, and blocks.
 func (p *Parser) parseExpr() (Node, error) {
+	// A colon only means something in a type annotation; elsewhere the lexer
+	// used to drop it, so it is still skipped
+	for p.cur.Type == TOK_COLON {
+		p.next()
+	}
 	// identifier: variable or function call
 	if p.cur.Type == TOK_IDENT {
 		ident := p.cur.Text
@@ -373,6 +441,8 @@ func (p *Parser) parseExpr() (Node, error) {
 			return p.parseFunction()
 		}
 
+		callPos := p.getCurrentPos()
+		doc := p.lx.docBefore(callPos.Line)
 		p.next()
 		// function call?
 		if p.cur.Type == TOK_LPAREN {
@@ -388,6 +458,9 @@ func (p *Parser) parseExpr() (Node, error) {
 					p.next()
 				}
 			}
+			if p.cur.Type != TOK_RPAREN {
+				return nil, fmt.Errorf("expected ')' to close the call of %s, got EOF", ident)
+			}
 			p.next() // skip ')'
 			// optional block for constructs like while
 			if p.cur.Type == TOK_LBRACE {
@@ -397,21 +470,29 @@ func (p *Parser) parseExpr() (Node, error) {
 				}
 				args = append(args, blk)
 			}
-			return &FuncCall{Name: ident, Args: args}, nil
+			if doc != "" {
+				// A doc comment before setq(name, func...) documents the function
+				for _, arg := range args {
+					if fn, ok := arg.(*FunctionDefNode); ok && fn.Doc == "" {
+						fn.Doc = doc
+					}
+				}
+			}
+			return &FuncCall{Name: ident, Args: args, Pos: callPos}, nil
 		}
 		// bare identifier => variable reference
-		return &VarRef{Name: ident}, nil
+		return &VarRef{Name: ident, Pos: callPos}, nil
 	}
 	// number literal
 	if p.cur.Type == TOK_NUMBER {
 		f, _ := strconv.ParseFloat(p.cur.Text, 64)
-		node := &Literal{Val: Number(f)}
+		node := &Literal{Val: Number(f), Pos: p.getCurrentPos()}
 		p.next()
 		return node, nil
 	}
 	// string literal
 	if p.cur.Type == TOK_STRING {
-		node := &Literal{Val: Str(p.cur.Text)}
+		node := &Literal{Val: Str(p.cur.Text), Pos: p.getCurrentPos()}
 		p.next()
 		return node, nil
 	}
@@ -747,6 +828,9 @@ func (lx *Lexer) parseStringContent(quote byte) string {
 }
 
 // Example function syntax: func(x, y) { return x + y; }
+//
+// Parameters and the result may be annotated with the type codes declare
+// takes: func(price: N, code: S): N { ... }. Unannotated ones accept any value.
 func (p *Parser) parseFunction() (Node, error) {
 	startPos := p.currentPosition
 
@@ -754,6 +838,8 @@ func (p *Parser) parseFunction() (Node, error) {
 	if p.cur.Type != TOK_IDENT || p.cur.Text != "func" {
 		return nil, errors.New("expected 'func' keyword")
 	}
+	funcLine, _ := p.lx.getLineCol()
+	doc := p.lx.docBefore(funcLine)
 	p.next() // consume "func"
 
 	// Parse parameter list
@@ -762,15 +848,27 @@ func (p *Parser) parseFunction() (Node, error) {
 	}
 	p.next() // consume "("
 
-	var params []string
+	var params, paramTypes []string
+	annotated := false
 	if p.cur.Type != TOK_RPAREN {
 		for {
 			if p.cur.Type != TOK_IDENT {
 				return nil, errors.New("parameter name expected")
 			}
-			params = append(params, p.cur.Text)
+			name := p.cur.Text
+			params = append(params, name)
 			p.next() // consume parameter name
 
+			typeCode := ""
+			if p.cur.Type == TOK_COLON {
+				code, err := p.parseTypeAnnotation("parameter " + name)
+				if err != nil {
+					return nil, err
+				}
+				typeCode, annotated = code, true
+			}
+			paramTypes = append(paramTypes, typeCode)
+
 			if p.cur.Type == TOK_RPAREN {
 				break
 			}
@@ -783,6 +881,18 @@ func (p *Parser) parseFunction() (Node, error) {
 	}
 	p.next() // consume ")"
 
+	returnType := ""
+	if p.cur.Type == TOK_COLON {
+		code, err := p.parseTypeAnnotation("the result")
+		if err != nil {
+			return nil, err
+		}
+		returnType = code
+	}
+	if !annotated {
+		paramTypes = nil
+	}
+
 	// Parse function body
 	if p.cur.Type != TOK_LBRACE {
 		return nil, errors.New("expected '{' for function body")
@@ -795,14 +905,30 @@ func (p *Parser) parseFunction() (Node, error) {
 
 	// Capture source by creating an identifier for the function
 	// This is a placeholder, you might want to enhance this
-	sourceDesc := fmt.Sprintf("func(%s)", strings.Join(params, ","))
-
-	return &FunctionDefNode{
+	fn := &FunctionDefNode{
 		Parameters: params,
+		ParamTypes: paramTypes,
+		ReturnType: returnType,
+		Doc:        doc,
 		Body:       body,
-		Source:     sourceDesc,
 		Position:   startPos,
-	}, nil
+	}
+	fn.Source = fn.Signature()
+	return fn, nil
+}
+
+// parseTypeAnnotation consumes ": code" and returns the type code.
+func (p *Parser) parseTypeAnnotation(what string) (string, error) {
+	p.next() // consume ":"
+	if p.cur.Type != TOK_IDENT {
+		return "", fmt.Errorf("type expected for %s", what)
+	}
+	code := p.cur.Text
+	if !isValidTypeCode(code) {
+		return "", fmt.Errorf("invalid type '%s' for %s", code, what)
+	}
+	p.next() // consume type code
+	return code, nil
 }
 
 func (p *Parser) parseArrayLiteral() (Node, error) {
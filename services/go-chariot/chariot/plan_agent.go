@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -11,11 +12,11 @@ import (
 
 // AgentEvent is emitted on plan/step lifecycle transitions for dashboards/clients.
 type AgentEvent struct {
-	Type   string    `json:"type"` // "plan" | "step"
+	Type   string    `json:"type"` // "plan" | "step" | "agent"
 	Agent  string    `json:"agent"`
 	Plan   string    `json:"plan"`
 	Step   int       `json:"step,omitempty"`
-	Status string    `json:"status"` // start|finish|drop|error|cancel
+	Status string    `json:"status"` // start|finish|drop|error|cancel; stop for "agent"
 	Error  string    `json:"error,omitempty"`
 	Time   time.Time `json:"time"`
 }
@@ -57,6 +58,19 @@ type Plan struct {
 	Guard   *FunctionValue
 	Steps   []*FunctionValue
 	Drop    *FunctionValue
+
+	// set on plans attached from the library: the scope holding the bound
+	// parameters, which conditions and steps run under
+	scope    *Scope
+	bindings map[string]Value
+}
+
+// instanceParent is the scope a run of p starts from.
+func (p *Plan) instanceParent(global *Scope) *Scope {
+	if p.scope != nil {
+		return p.scope
+	}
+	return global
 }
 
 func (p *Plan) String() string {
@@ -72,7 +86,11 @@ func rebindPlanToRuntime(p *Plan, rt *Runtime) *Plan {
 	if p == nil || rt == nil {
 		return nil
 	}
-	g := rt.GlobalScope()
+	return rebindPlanToScope(p, rt.GlobalScope())
+}
+
+// rebindPlanToScope returns a copy of p whose closures point at g.
+func rebindPlanToScope(p *Plan, g *Scope) *Plan {
 	cp := &Plan{
 		Name:    p.Name,
 		Params:  append([]string(nil), p.Params...),
@@ -103,11 +121,42 @@ type Agent struct {
 	rtMu      sync.Mutex // serialize runtime usage across goroutines
 	pollEvery time.Duration
 
+	// plan instances being executed, guarded by mu
+	intentions    map[int64]*AgentIntention
+	nextIntention int64
+
 	// simple belief store for this agent (plan trigger/guard/steps can consult)
 	beliefsMu sync.RWMutex
-	beliefs   map[string]Value
+	beliefs   map[string]*Belief
+	changed   map[string]bool     // belief keys changed since subscribed plans were last considered
+	subs      map[string][]string // plan name -> belief keys it is subscribed to
+}
+
+// Belief is a value an agent holds, with when it was set and when it
+// expires (zero for never). Priority and confidence are left to plans to
+// interpret; confidence defaults to 1.
+type Belief struct {
+	Value      Value
+	Priority   float64
+	Confidence float64
+	Updated    time.Time
+	Expires    time.Time
+}
+
+func (b *Belief) expired(now time.Time) bool {
+	return !b.Expires.IsZero() && !now.Before(b.Expires)
+}
+
+// BeliefOptions qualify a belief being set. A TTL <= 0 never expires.
+type BeliefOptions struct {
+	TTL        time.Duration
+	Priority   float64
+	Confidence float64
 }
 
+// DefaultBeliefOptions are used by SetBelief.
+var DefaultBeliefOptions = BeliefOptions{Confidence: 1}
+
 func newAgent(rt *Runtime, maxConcurrent int, pollEvery time.Duration) *Agent {
 	if maxConcurrent <= 0 {
 		maxConcurrent = 1
@@ -116,12 +165,13 @@ func newAgent(rt *Runtime, maxConcurrent int, pollEvery time.Duration) *Agent {
 		pollEvery = 3 * time.Second
 	}
 	return &Agent{
-		name:      "",
-		rt:        rt,
-		sem:       make(chan struct{}, maxConcurrent),
-		events:    make(chan struct{}, 64),
-		pollEvery: pollEvery,
-		beliefs:   make(map[string]Value),
+		name:       "",
+		rt:         rt,
+		sem:        make(chan struct{}, maxConcurrent),
+		events:     make(chan struct{}, 64),
+		pollEvery:  pollEvery,
+		beliefs:    make(map[string]*Belief),
+		intentions: make(map[int64]*AgentIntention),
 	}
 }
 
@@ -148,30 +198,106 @@ func (a *Agent) publish() {
 
 // SetBelief sets a key/value on this agent and nudges the scheduler
 func (a *Agent) SetBelief(key string, v Value) {
+	a.SetBeliefWithOptions(key, v, DefaultBeliefOptions)
+}
+
+// SetBeliefWithOptions sets a belief with a time-to-live, priority and
+// confidence, marks it changed for subscribed plans and nudges the scheduler
+func (a *Agent) SetBeliefWithOptions(key string, v Value, opts BeliefOptions) {
+	now := time.Now()
+	b := &Belief{Value: v, Priority: opts.Priority, Confidence: opts.Confidence, Updated: now}
+	if opts.TTL > 0 {
+		b.Expires = now.Add(opts.TTL)
+	}
 	a.beliefsMu.Lock()
-	a.beliefs[key] = v
+	if a.beliefs == nil {
+		a.beliefs = make(map[string]*Belief)
+	}
+	a.beliefs[key] = b
+	a.markChangedLocked(key)
 	a.beliefsMu.Unlock()
 	a.publish()
 }
 
-// GetBelief reads a belief by key; returns nil if unset
+func (a *Agent) markChangedLocked(key string) {
+	if a.changed == nil {
+		a.changed = make(map[string]bool)
+	}
+	a.changed[key] = true
+}
+
+// GetBelief reads a belief by key; returns nil if unset or expired
 func (a *Agent) GetBelief(key string) Value {
+	if b, ok := a.GetBeliefInfo(key); ok {
+		return b.Value
+	}
+	return nil
+}
+
+// GetBeliefInfo returns a copy of the belief under key unless it is unset or
+// expired
+func (a *Agent) GetBeliefInfo(key string) (Belief, bool) {
 	a.beliefsMu.RLock()
 	defer a.beliefsMu.RUnlock()
-	return a.beliefs[key]
+	b := a.beliefs[key]
+	if b == nil || b.expired(time.Now()) {
+		return Belief{}, false
+	}
+	return *b, true
 }
 
-// GetBeliefs returns a copy of all beliefs
+// GetBeliefs returns a copy of all unexpired beliefs
 func (a *Agent) GetBeliefs() map[string]Value {
 	a.beliefsMu.RLock()
 	defer a.beliefsMu.RUnlock()
+	now := time.Now()
 	copy := make(map[string]Value, len(a.beliefs))
-	for k, v := range a.beliefs {
-		copy[k] = v
+	for k, b := range a.beliefs {
+		if !b.expired(now) {
+			copy[k] = b.Value
+		}
 	}
 	return copy
 }
 
+// expireBeliefs drops expired beliefs, which counts as a change for plans
+// subscribed to them
+func (a *Agent) expireBeliefs() {
+	a.beliefsMu.Lock()
+	defer a.beliefsMu.Unlock()
+	now := time.Now()
+	for k, b := range a.beliefs {
+		if b.expired(now) {
+			delete(a.beliefs, k)
+			a.markChangedLocked(k)
+		}
+	}
+}
+
+// Subscribe makes the named plan event-driven: instead of being considered on
+// every poll, it is considered only when one of keys is set or expires.
+func (a *Agent) Subscribe(planName string, keys []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, p := range a.plans {
+		if p.Name == planName {
+			if a.subs == nil {
+				a.subs = make(map[string][]string)
+			}
+			a.subs[planName] = append([]string(nil), keys...)
+			return nil
+		}
+	}
+	return fmt.Errorf("plan '%s' is not registered with agent '%s'", planName, a.name)
+}
+
+// Unsubscribe returns the named plan to being considered on every poll.
+func (a *Agent) Unsubscribe(planName string) {
+	a.mu.Lock()
+	delete(a.subs, planName)
+	a.mu.Unlock()
+}
+
 // GetInfo returns agent metadata including name, plans, and status
 func (a *Agent) GetInfo() map[string]interface{} {
 	a.mu.RLock()
@@ -195,6 +321,120 @@ func (a *Agent) GetInfo() map[string]interface{} {
 	}
 }
 
+// AgentPlanInfo describes a plan registered with an agent or in the plan
+// library; the trigger, guard and drop conditions are given as source.
+type AgentPlanInfo struct {
+	Name       string                 `json:"name"`
+	Params     []string               `json:"params"`
+	Trigger    string                 `json:"trigger,omitempty"`
+	Guard      string                 `json:"guard,omitempty"`
+	Drop       string                 `json:"drop,omitempty"`
+	Steps      int                    `json:"steps"`
+	Subscribes []string               `json:"subscribes,omitempty"` // belief keys; empty when the plan is polled
+	Bindings   map[string]interface{} `json:"bindings,omitempty"`   // parameters bound when attached from the library
+}
+
+// AgentIntention is a plan instance an agent is executing.
+type AgentIntention struct {
+	ID      int64     `json:"id"`
+	Plan    string    `json:"plan"`
+	Step    int       `json:"step"` // index of the step running or about to run
+	Steps   int       `json:"steps"`
+	Started time.Time `json:"started"`
+}
+
+// AgentDetail is a snapshot of an agent's beliefs, plans and intentions.
+type AgentDetail struct {
+	Name          string           `json:"name"`
+	Running       bool             `json:"running"`
+	PollSeconds   float64          `json:"pollSeconds"`
+	MaxConcurrent int              `json:"maxConcurrent"`
+	Beliefs       map[string]Value `json:"-"`
+	Plans         []AgentPlanInfo  `json:"plans"`
+	Intentions    []AgentIntention `json:"intentions"`
+}
+
+// DescribePlan returns p's name, parameters, conditions and bindings.
+func DescribePlan(p *Plan) AgentPlanInfo {
+	info := AgentPlanInfo{
+		Name:    p.Name,
+		Params:  append([]string{}, p.Params...),
+		Trigger: functionSource(p.Trigger),
+		Guard:   functionSource(p.Guard),
+		Drop:    functionSource(p.Drop),
+		Steps:   len(p.Steps),
+	}
+	if len(p.bindings) > 0 {
+		info.Bindings = make(map[string]interface{}, len(p.bindings))
+		for k, v := range p.bindings {
+			info.Bindings[k] = ValueToJSON(v)
+		}
+	}
+	return info
+}
+
+// functionSource returns the source of fn for display.
+func functionSource(fn *FunctionValue) string {
+	switch {
+	case fn == nil:
+		return ""
+	case fn.FormattedSource != "":
+		return fn.FormattedSource
+	case fn.Body != nil:
+		return strings.TrimSpace(fn.Body.ToString())
+	}
+	return fn.SourceCode // only the parameter list for parsed functions
+}
+
+// Detail returns the agent's beliefs, plans with their conditions, and the
+// plan instances it is executing, oldest first.
+func (a *Agent) Detail() *AgentDetail {
+	a.mu.RLock()
+	d := &AgentDetail{
+		Name:          a.name,
+		Running:       a.running,
+		PollSeconds:   a.pollEvery.Seconds(),
+		MaxConcurrent: cap(a.sem),
+		Plans:         make([]AgentPlanInfo, len(a.plans)),
+		Intentions:    make([]AgentIntention, 0, len(a.intentions)),
+	}
+	for i, p := range a.plans {
+		d.Plans[i] = DescribePlan(p)
+		d.Plans[i].Subscribes = append([]string(nil), a.subs[p.Name]...)
+	}
+	for _, it := range a.intentions {
+		d.Intentions = append(d.Intentions, *it)
+	}
+	a.mu.RUnlock()
+	sort.Slice(d.Intentions, func(i, j int) bool { return d.Intentions[i].ID < d.Intentions[j].ID })
+	d.Beliefs = a.GetBeliefs()
+	return d
+}
+
+// beginIntention records that an instance of p is being executed; call the
+// returned functions to advance its step and to end it.
+func (a *Agent) beginIntention(p *Plan) (step func(int), end func()) {
+	a.mu.Lock()
+	a.nextIntention++
+	it := &AgentIntention{ID: a.nextIntention, Plan: p.Name, Steps: len(p.Steps), Started: time.Now()}
+	if a.intentions == nil {
+		a.intentions = make(map[int64]*AgentIntention)
+	}
+	a.intentions[it.ID] = it
+	a.mu.Unlock()
+	step = func(i int) {
+		a.mu.Lock()
+		it.Step = i
+		a.mu.Unlock()
+	}
+	end = func() {
+		a.mu.Lock()
+		delete(a.intentions, it.ID)
+		a.mu.Unlock()
+	}
+	return step, end
+}
+
 func (a *Agent) start(ctx context.Context) {
 	if a.running {
 		return
@@ -220,6 +460,7 @@ func (a *Agent) loop() {
 		case <-a.ctx.Done():
 			return
 		case <-ticker.C:
+			a.expireBeliefs()
 			a.trySchedule()
 		case <-a.events:
 			a.trySchedule()
@@ -230,9 +471,23 @@ func (a *Agent) loop() {
 func (a *Agent) trySchedule() {
 	a.mu.RLock()
 	plans := append([]*Plan(nil), a.plans...)
+	subs := make(map[string][]string, len(a.subs))
+	for name, keys := range a.subs {
+		subs[name] = keys
+	}
 	a.mu.RUnlock()
 
+	// Take the belief changes; if every slot is busy they are put back so
+	// subscribed plans are considered again on the next poll
+	a.beliefsMu.Lock()
+	changed := a.changed
+	a.changed = nil
+	a.beliefsMu.Unlock()
+
 	for _, p := range plans {
+		if keys, ok := subs[p.Name]; ok && !anyChanged(keys, changed) {
+			continue
+		}
 		// Evaluate trigger and guard quickly; ignore errors as false
 		if ok, _ := a.evalBool(p.Trigger); !ok {
 			continue
@@ -247,11 +502,25 @@ func (a *Agent) trySchedule() {
 				_ = a.runPlanOnce(pl)
 			}(p)
 		default:
+			a.beliefsMu.Lock()
+			for k := range changed {
+				a.markChangedLocked(k)
+			}
+			a.beliefsMu.Unlock()
 			return
 		}
 	}
 }
 
+func anyChanged(keys []string, changed map[string]bool) bool {
+	for _, k := range keys {
+		if changed[k] {
+			return true
+		}
+	}
+	return false
+}
+
 func (a *Agent) evalBool(fn *FunctionValue) (bool, error) {
 	if fn == nil {
 		return false, nil
@@ -282,9 +551,11 @@ func (a *Agent) runPlanOnce(p *Plan) error {
 	}
 	// Broadcast plan start
 	broadcastAgentEvent(AgentEvent{Type: "plan", Agent: a.name, Plan: p.Name, Status: "start", Time: time.Now()})
+	setStep, end := a.beginIntention(p)
+	defer end()
 	// Plan instance scope so variables persist across steps for this run only.
 	// Use a child scope of the agent runtime's global scope to avoid polluting globals.
-	instanceScope := NewScope(a.rt.globalScope)
+	instanceScope := NewScope(p.instanceParent(a.rt.globalScope))
 	for i, step := range p.Steps {
 		// Drop before step
 		drop, _ := a.evalBool(p.Drop)
@@ -293,6 +564,7 @@ func (a *Agent) runPlanOnce(p *Plan) error {
 			return nil
 		}
 		// Execute step
+		setStep(i)
 		broadcastAgentEvent(AgentEvent{Type: "step", Agent: a.name, Plan: p.Name, Step: i, Status: "start", Time: time.Now()})
 		a.rtMu.Lock()
 		_, err := a.execFnInScope(step, instanceScope)
@@ -353,7 +625,7 @@ func (a *Agent) runPlanOnceWithOptions(p *Plan, instanceVars map[string]Value, m
 	}
 
 	// Instance scope per run, overlay any provided variables
-	instanceScope := NewScope(a.rt.globalScope)
+	instanceScope := NewScope(p.instanceParent(a.rt.globalScope))
 	if len(instanceVars) > 0 {
 		for k, v := range instanceVars {
 			instanceScope.Set(k, v)
@@ -385,6 +657,8 @@ func (a *Agent) runPlanOnceWithOptions(p *Plan, instanceVars map[string]Value, m
 		ctx = context.Background()
 	}
 	broadcastAgentEvent(AgentEvent{Type: "plan", Agent: a.name, Plan: p.Name, Status: "start", Time: time.Now()})
+	setStep, end := a.beginIntention(p)
+	defer end()
 	for i, step := range p.Steps {
 		if respectDrop {
 			drop, _ := a.evalBool(p.Drop)
@@ -396,6 +670,7 @@ func (a *Agent) runPlanOnceWithOptions(p *Plan, instanceVars map[string]Value, m
 				return false, nil
 			}
 		}
+		setStep(i)
 		broadcastAgentEvent(AgentEvent{Type: "step", Agent: a.name, Plan: p.Name, Step: i, Status: "start", Time: time.Now()})
 		a.rtMu.Lock()
 		_, err := a.execFnInScope(step, instanceScope)
@@ -689,7 +964,7 @@ func RegisterPlanFunctions(rt *Runtime) {
 		return arr, nil
 	})
 
-	// agentPublish(name) -> true  (nudge scheduler)
+	// agentPublish(name) -> true  (nudge scheduler; "peer/agent" nudges a federated agent)
 	rt.Register("agentPublish", func(args ...Value) (Value, error) {
 		if len(args) < 1 {
 			return nil, errors.New("agentPublish(name)")
@@ -698,6 +973,12 @@ func RegisterPlanFunctions(rt *Runtime) {
 		if !ok || name == "" {
 			return nil, errors.New("first arg must be non-empty string name")
 		}
+		if r, peer, agent, ok := remoteAgent(string(name)); ok {
+			if err := r.Publish(peer, agent); err != nil {
+				return nil, err
+			}
+			return Bool(true), nil
+		}
 		if ag := defaultAgents.Get(string(name)); ag != nil {
 			ag.publish()
 			return Bool(true), nil
@@ -705,10 +986,43 @@ func RegisterPlanFunctions(rt *Runtime) {
 		return Bool(false), nil
 	})
 
-	// agentBelief(name, key, value) -> true (store belief and nudge)
+	// agentBelief(name, key, value) -> true (store belief and nudge; "peer/agent" goes over the federation bridge)
 	rt.Register("agentBelief", func(args ...Value) (Value, error) {
-		if len(args) < 3 {
-			return nil, errors.New("agentBelief(name, key, value)")
+		if len(args) < 3 || len(args) > 4 {
+			return nil, errors.New("agentBelief(name, key, value[, options])")
+		}
+		name, ok := args[0].(Str)
+		if !ok || name == "" {
+			return nil, errors.New("first arg must be non-empty string name")
+		}
+		key, ok := args[1].(Str)
+		if !ok || key == "" {
+			return nil, errors.New("second arg must be non-empty string key")
+		}
+		opts := DefaultBeliefOptions
+		if len(args) == 4 {
+			var err error
+			if opts, err = beliefOptions(args[3]); err != nil {
+				return nil, err
+			}
+		}
+		if r, peer, agent, ok := remoteAgent(string(name)); ok {
+			if err := r.SetBelief(peer, agent, string(key), args[2], opts); err != nil {
+				return nil, err
+			}
+			return Bool(true), nil
+		}
+		if ag := defaultAgents.Get(string(name)); ag != nil {
+			ag.SetBeliefWithOptions(string(key), args[2], opts)
+			return Bool(true), nil
+		}
+		return Bool(false), nil
+	})
+
+	// beliefInfo(name, key) -> map(value, priority, confidence, updated, expires)|nil
+	rt.Register("beliefInfo", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, errors.New("beliefInfo(name, key)")
 		}
 		name, ok := args[0].(Str)
 		if !ok || name == "" {
@@ -718,14 +1032,90 @@ func RegisterPlanFunctions(rt *Runtime) {
 		if !ok || key == "" {
 			return nil, errors.New("second arg must be non-empty string key")
 		}
+		ag := defaultAgents.Get(string(name))
+		if ag == nil {
+			return nil, nil
+		}
+		b, ok := ag.GetBeliefInfo(string(key))
+		if !ok {
+			return nil, nil
+		}
+		info := NewMap()
+		info.Set("value", b.Value)
+		info.Set("priority", Number(b.Priority))
+		info.Set("confidence", Number(b.Confidence))
+		info.Set("updated", Str(b.Updated.Format(time.RFC3339Nano)))
+		if b.Expires.IsZero() {
+			info.Set("expires", DBNull)
+		} else {
+			info.Set("expires", Str(b.Expires.Format(time.RFC3339Nano)))
+		}
+		return info, nil
+	})
+
+	// agentSubscribe(name, planName, keys[]) -> true; the plan then runs on
+	// changes to those beliefs instead of on every poll
+	rt.Register("agentSubscribe", func(args ...Value) (Value, error) {
+		if len(args) != 3 {
+			return nil, errors.New("agentSubscribe(name, planName, keys)")
+		}
+		name, ok := args[0].(Str)
+		if !ok || name == "" {
+			return nil, errors.New("first arg must be non-empty string name")
+		}
+		planName, ok := args[1].(Str)
+		if !ok || planName == "" {
+			return nil, errors.New("second arg must be non-empty string plan name")
+		}
+		var keys []string
+		switch k := args[2].(type) {
+		case Str:
+			keys = []string{string(k)}
+		case *ArrayValue:
+			for i := 0; i < k.Length(); i++ {
+				s, ok := k.Get(i).(Str)
+				if !ok {
+					return nil, errors.New("belief keys must be strings")
+				}
+				keys = append(keys, string(s))
+			}
+		default:
+			return nil, errors.New("third arg must be a key or an array of keys")
+		}
+		if len(keys) == 0 {
+			return nil, errors.New("agentSubscribe needs at least one belief key")
+		}
+		ag := defaultAgents.Get(string(name))
+		if ag == nil {
+			return nil, fmt.Errorf("agent '%s' not found", name)
+		}
+		if err := ag.Subscribe(string(planName), keys); err != nil {
+			return nil, err
+		}
+		return Bool(true), nil
+	})
+
+	// agentUnsubscribe(name, planName) -> true|false; the plan is polled again
+	rt.Register("agentUnsubscribe", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, errors.New("agentUnsubscribe(name, planName)")
+		}
+		name, ok := args[0].(Str)
+		if !ok || name == "" {
+			return nil, errors.New("first arg must be non-empty string name")
+		}
+		planName, ok := args[1].(Str)
+		if !ok || planName == "" {
+			return nil, errors.New("second arg must be non-empty string plan name")
+		}
 		if ag := defaultAgents.Get(string(name)); ag != nil {
-			ag.SetBelief(string(key), args[2])
+			ag.Unsubscribe(string(planName))
 			return Bool(true), nil
 		}
 		return Bool(false), nil
 	})
 
-	// belief(name, key) -> value|nil
+	// belief(name, key) -> value|nil; "peer/agent" asks the federated peer
 	rt.Register("belief", func(args ...Value) (Value, error) {
 		if len(args) < 2 {
 			return nil, errors.New("belief(name, key)")
@@ -738,6 +1128,9 @@ func RegisterPlanFunctions(rt *Runtime) {
 		if !ok || key == "" {
 			return nil, errors.New("second arg must be non-empty string key")
 		}
+		if r, peer, agent, ok := remoteAgent(string(name)); ok {
+			return r.Belief(peer, agent, string(key))
+		}
 		if ag := defaultAgents.Get(string(name)); ag != nil {
 			return ag.GetBelief(string(key)), nil
 		}
@@ -745,6 +1138,36 @@ func RegisterPlanFunctions(rt *Runtime) {
 	})
 }
 
+// beliefOptions reads the options map of agentBelief: ttl (seconds),
+// priority and confidence.
+func beliefOptions(v Value) (BeliefOptions, error) {
+	opts := DefaultBeliefOptions
+	m, ok := v.(*MapValue)
+	if !ok {
+		return opts, errors.New("options must be a map of ttl, priority and confidence")
+	}
+	for k, val := range m.Values {
+		n, ok := val.(Number)
+		if !ok {
+			return opts, fmt.Errorf("belief option %s must be a number", k)
+		}
+		switch k {
+		case "ttl":
+			opts.TTL = time.Duration(float64(n) * float64(time.Second))
+		case "priority":
+			opts.Priority = float64(n)
+		case "confidence":
+			if n < 0 || n > 1 {
+				return opts, errors.New("belief confidence must be between 0 and 1")
+			}
+			opts.Confidence = float64(n)
+		default:
+			return opts, fmt.Errorf("unknown belief option %s (want ttl, priority or confidence)", k)
+		}
+	}
+	return opts, nil
+}
+
 func asAgent(v Value) (*Agent, bool) {
 	if ho, ok := v.(*HostObjectValue); ok {
 		if ag, ok := ho.Value.(*Agent); ok {
@@ -796,6 +1219,7 @@ func (r *agentRegistry) Stop(name string) {
 	if ag, ok := r.agents[name]; ok {
 		ag.stop()
 		delete(r.agents, name)
+		broadcastAgentEvent(AgentEvent{Type: "agent", Agent: name, Status: "stop", Time: time.Now()})
 	}
 }
 
@@ -834,6 +1258,16 @@ func DefaultAgentBelief(name, key string, v Value) bool {
 	return false
 }
 
+// DefaultAgentBeliefWithOptions sets a belief with a time-to-live, priority
+// and confidence on a named agent
+func DefaultAgentBeliefWithOptions(name, key string, v Value, opts BeliefOptions) bool {
+	if ag := defaultAgents.Get(name); ag != nil {
+		ag.SetBeliefWithOptions(key, v, opts)
+		return true
+	}
+	return false
+}
+
 // DefaultAgentGetBeliefs returns all beliefs for a named agent
 func DefaultAgentGetBeliefs(name string) map[string]Value {
 	if ag := defaultAgents.Get(name); ag != nil {
@@ -842,6 +1276,14 @@ func DefaultAgentGetBeliefs(name string) map[string]Value {
 	return nil
 }
 
+// DefaultAgentDetail returns a snapshot of a named agent, or nil
+func DefaultAgentDetail(name string) *AgentDetail {
+	if ag := defaultAgents.Get(name); ag != nil {
+		return ag.Detail()
+	}
+	return nil
+}
+
 // DefaultAgentGetInfo returns detailed info about an agent
 func DefaultAgentGetInfo(name string) map[string]interface{} {
 	if ag := defaultAgents.Get(name); ag != nil {
@@ -0,0 +1,355 @@
+package chariot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+// The plan library holds plans defined once by name, which can then be
+// attached to any number of named agents, each attachment binding the plan's
+// parameters to its own values.
+
+type planLibrary struct {
+	mu    sync.RWMutex
+	plans map[string]*Plan
+}
+
+var defaultPlanLibrary = &planLibrary{plans: make(map[string]*Plan)}
+
+// DefinePlan adds p to the plan library, replacing the plan of the same
+// name. Agents the replaced plan is attached to keep running it until it is
+// attached again.
+func DefinePlan(p *Plan) error {
+	if p == nil || p.Name == "" {
+		return errors.New("a library plan needs a name")
+	}
+	defaultPlanLibrary.mu.Lock()
+	defaultPlanLibrary.plans[p.Name] = p
+	defaultPlanLibrary.mu.Unlock()
+	return nil
+}
+
+// LibraryPlan returns the named library plan, or nil.
+func LibraryPlan(name string) *Plan {
+	defaultPlanLibrary.mu.RLock()
+	defer defaultPlanLibrary.mu.RUnlock()
+	return defaultPlanLibrary.plans[name]
+}
+
+// LibraryPlans returns the library plans sorted by name.
+func LibraryPlans() []*Plan {
+	defaultPlanLibrary.mu.RLock()
+	out := make([]*Plan, 0, len(defaultPlanLibrary.plans))
+	for _, p := range defaultPlanLibrary.plans {
+		out = append(out, p)
+	}
+	defaultPlanLibrary.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// RemoveLibraryPlan removes the named plan from the library; agents it is
+// attached to keep it.
+func RemoveLibraryPlan(name string) bool {
+	defaultPlanLibrary.mu.Lock()
+	defer defaultPlanLibrary.mu.Unlock()
+	if _, ok := defaultPlanLibrary.plans[name]; !ok {
+		return false
+	}
+	delete(defaultPlanLibrary.plans, name)
+	return true
+}
+
+// PlanToMap serializes a plan in the format of the plan library file.
+func PlanToMap(p *Plan) map[string]interface{} {
+	m := map[string]interface{}{
+		"name":   p.Name,
+		"params": append([]string{}, p.Params...),
+	}
+	for key, fn := range map[string]*FunctionValue{"trigger": p.Trigger, "guard": p.Guard, "drop": p.Drop} {
+		if fn != nil {
+			m[key] = FunctionValueToMap(fn)
+		}
+	}
+	steps := make([]interface{}, 0, len(p.Steps))
+	for _, s := range p.Steps {
+		steps = append(steps, FunctionValueToMap(s))
+	}
+	m["steps"] = steps
+	return m
+}
+
+// MapToPlan reconstructs a plan written by PlanToMap and decoded from JSON.
+func MapToPlan(m map[string]interface{}) (*Plan, error) {
+	p := &Plan{}
+	p.Name, _ = m["name"].(string)
+	if p.Name == "" {
+		return nil, errors.New("plan is missing its name")
+	}
+	if params, ok := m["params"].([]interface{}); ok {
+		for _, v := range params {
+			if s, ok := v.(string); ok {
+				p.Params = append(p.Params, s)
+			}
+		}
+	}
+	function := func(key string, raw interface{}) (*FunctionValue, error) {
+		fm, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("plan '%s': %s is not a function", p.Name, key)
+		}
+		fn, err := MapToFunctionValue(fm)
+		if err != nil {
+			return nil, fmt.Errorf("plan '%s': %s: %w", p.Name, key, err)
+		}
+		return fn, nil
+	}
+	var err error
+	for key, dst := range map[string]**FunctionValue{"trigger": &p.Trigger, "guard": &p.Guard, "drop": &p.Drop} {
+		if raw, ok := m[key]; ok && raw != nil {
+			if *dst, err = function(key, raw); err != nil {
+				return nil, err
+			}
+		}
+	}
+	steps, _ := m["steps"].([]interface{})
+	for i, raw := range steps {
+		fn, err := function(fmt.Sprintf("step %d", i), raw)
+		if err != nil {
+			return nil, err
+		}
+		p.Steps = append(p.Steps, fn)
+	}
+	return p, nil
+}
+
+// LoadPlanLibrary adds the plans saved in filename, under the tree path, to
+// the library and returns how many there were.
+func LoadPlanLibrary(filename string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(cfg.ChariotConfig.TreePath, filename))
+	if err != nil {
+		return 0, err
+	}
+	var raw map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return 0, err
+	}
+	for _, m := range raw {
+		p, err := MapToPlan(m)
+		if err != nil {
+			return 0, err
+		}
+		_ = DefinePlan(p)
+	}
+	return len(raw), nil
+}
+
+// SavePlanLibrary writes every library plan to filename under the tree path.
+func SavePlanLibrary(filename string) error {
+	fullPath := filepath.Join(cfg.ChariotConfig.TreePath, filename)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	out := make(map[string]interface{})
+	for _, p := range LibraryPlans() {
+		out[p.Name] = PlanToMap(p)
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fullPath, data, 0644)
+}
+
+// bindPlan returns a copy of p for rt whose conditions and steps see
+// bindings, which may only name p's parameters.
+func bindPlan(p *Plan, rt *Runtime, bindings map[string]Value) (*Plan, error) {
+	scope := NewScope(rt.GlobalScope())
+	for k, v := range bindings {
+		known := false
+		for _, param := range p.Params {
+			known = known || param == k
+		}
+		if !known {
+			return nil, fmt.Errorf("plan '%s' has no parameter '%s'", p.Name, k)
+		}
+		scope.Set(k, v)
+	}
+	cp := rebindPlanToScope(p, scope)
+	cp.scope = scope
+	cp.bindings = make(map[string]Value, len(bindings))
+	for k, v := range bindings {
+		cp.bindings[k] = v
+	}
+	return cp, nil
+}
+
+// Attach adds the library plan p to the agent with its parameters bound,
+// replacing an attached plan of the same name, and nudges the scheduler.
+func (a *Agent) Attach(p *Plan, bindings map[string]Value) error {
+	bound, err := bindPlan(p, a.rt, bindings)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	replaced := false
+	for i, existing := range a.plans {
+		if existing.Name == p.Name {
+			a.plans[i] = bound
+			replaced = true
+		}
+	}
+	if !replaced {
+		a.plans = append(a.plans, bound)
+	}
+	a.mu.Unlock()
+	a.publish()
+	return nil
+}
+
+// Detach removes the named plan from the agent; running instances finish.
+func (a *Agent) Detach(planName string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, p := range a.plans {
+		if p.Name == planName {
+			a.plans = append(a.plans[:i:i], a.plans[i+1:]...)
+			delete(a.subs, planName)
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultAgentAttach attaches a library plan to a named agent.
+func DefaultAgentAttach(agentName, planName string, bindings map[string]Value) error {
+	ag := defaultAgents.Get(agentName)
+	if ag == nil {
+		return fmt.Errorf("agent '%s' not found", agentName)
+	}
+	p := LibraryPlan(planName)
+	if p == nil {
+		return fmt.Errorf("plan '%s' is not in the plan library", planName)
+	}
+	return ag.Attach(p, bindings)
+}
+
+// DefaultAgentDetach detaches a plan from a named agent.
+func DefaultAgentDetach(agentName, planName string) bool {
+	if ag := defaultAgents.Get(agentName); ag != nil {
+		return ag.Detach(planName)
+	}
+	return false
+}
+
+// AgentsWithPlan lists the named agents running a plan called planName.
+func AgentsWithPlan(planName string) []string {
+	var out []string
+	for _, name := range defaultAgents.List() {
+		ag := defaultAgents.Get(name)
+		if ag == nil {
+			continue
+		}
+		ag.mu.RLock()
+		for _, p := range ag.plans {
+			if p.Name == planName {
+				out = append(out, name)
+				break
+			}
+		}
+		ag.mu.RUnlock()
+	}
+	sort.Strings(out)
+	return out
+}
+
+// RegisterPlanLibraryFunctions wires the plan library into the runtime
+func RegisterPlanLibraryFunctions(rt *Runtime) {
+	// planDefine(plan) -> true; adds the plan to the library under its name
+	rt.Register("planDefine", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, errors.New("planDefine(plan)")
+		}
+		p, ok := args[0].(*Plan)
+		if !ok {
+			return nil, errors.New("argument must be plan")
+		}
+		if err := DefinePlan(p); err != nil {
+			return nil, err
+		}
+		return Bool(true), nil
+	})
+
+	// planLibrary() -> array of library plan names
+	rt.Register("planLibrary", func(args ...Value) (Value, error) {
+		if len(args) != 0 {
+			return nil, errors.New("planLibrary()")
+		}
+		names := NewArray()
+		for _, p := range LibraryPlans() {
+			names.Append(Str(p.Name))
+		}
+		return names, nil
+	})
+
+	// libraryPlan(name) -> plan|null
+	rt.Register("libraryPlan", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, errors.New("libraryPlan(name)")
+		}
+		name, ok := args[0].(Str)
+		if !ok {
+			return nil, errors.New("name must be string")
+		}
+		if p := LibraryPlan(string(name)); p != nil {
+			return p, nil
+		}
+		return DBNull, nil
+	})
+
+	// agentAttach(agentName, planName[, bindingsMap]) -> true
+	rt.Register("agentAttach", func(args ...Value) (Value, error) {
+		if len(args) < 2 || len(args) > 3 {
+			return nil, errors.New("agentAttach(agentName, planName[, bindings])")
+		}
+		agentName, ok1 := args[0].(Str)
+		planName, ok2 := args[1].(Str)
+		if !ok1 || !ok2 {
+			return nil, errors.New("agent and plan names must be strings")
+		}
+		bindings := map[string]Value{}
+		if len(args) == 3 {
+			m, ok := args[2].(*MapValue)
+			if !ok {
+				return nil, errors.New("bindings must be a map")
+			}
+			for k, v := range m.Values {
+				bindings[k] = v
+			}
+		}
+		if err := DefaultAgentAttach(string(agentName), string(planName), bindings); err != nil {
+			return nil, err
+		}
+		return Bool(true), nil
+	})
+
+	// agentDetach(agentName, planName) -> true|false
+	rt.Register("agentDetach", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, errors.New("agentDetach(agentName, planName)")
+		}
+		agentName, ok1 := args[0].(Str)
+		planName, ok2 := args[1].(Str)
+		if !ok1 || !ok2 {
+			return nil, errors.New("agent and plan names must be strings")
+		}
+		return Bool(DefaultAgentDetach(string(agentName), string(planName))), nil
+	})
+}
@@ -0,0 +1,198 @@
+package chariot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/charts"
+)
+
+// RegisterPlotFunctions registers plot, which renders a chart as an artifact
+// of the execution.
+func RegisterPlotFunctions(rt *Runtime) {
+	// plot(series, [opts]) -> artifact name
+	// series: an array of numbers, a map of series name -> array of numbers,
+	//         or an array of {"name": ..., "values": [...]} maps
+	// opts: {"type": "line"|"bar"|"scatter", "format": "svg"|"png",
+	//        "title", "xLabel", "yLabel", "x": [numbers or labels],
+	//        "width", "height", "name"}
+	rt.Register("plot", func(args ...Value) (Value, error) {
+		if len(args) < 1 || len(args) > 2 {
+			return nil, errors.New("plot requires 1 or 2 arguments: series, [options]")
+		}
+		args = unwrapScopeEntries(args)
+		series, err := plotSeries(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("plot: %w", err)
+		}
+		chart := &charts.Chart{Series: series}
+		format := charts.SVG
+		name := ""
+		if len(args) == 2 {
+			opts, ok := args[1].(*MapValue)
+			if !ok {
+				return nil, fmt.Errorf("plot: options must be a map, got %T", args[1])
+			}
+			for key, v := range opts.Values {
+				if se, ok := v.(ScopeEntry); ok {
+					v = se.Value
+				}
+				switch key {
+				case "type":
+					chart.Kind = charts.Kind(strings.ToLower(plotString(v)))
+				case "format":
+					format = charts.Format(strings.ToLower(plotString(v)))
+				case "title":
+					chart.Title = plotString(v)
+				case "xLabel":
+					chart.XLabel = plotString(v)
+				case "yLabel":
+					chart.YLabel = plotString(v)
+				case "name":
+					name = plotString(v)
+				case "width", "height":
+					n, ok := v.(Number)
+					if !ok {
+						return nil, fmt.Errorf("plot: %s must be a number, got %T", key, v)
+					}
+					if key == "width" {
+						chart.Width = int(n)
+					} else {
+						chart.Height = int(n)
+					}
+				case "x":
+					if err := plotXValues(chart, v); err != nil {
+						return nil, fmt.Errorf("plot: x: %w", err)
+					}
+				default:
+					return nil, fmt.Errorf("plot: unknown option %q", key)
+				}
+			}
+		}
+
+		data, err := chart.Render(format)
+		if err != nil {
+			return nil, fmt.Errorf("plot: %w", err)
+		}
+		ext := "." + string(format)
+		switch {
+		case name == "":
+			name = fmt.Sprintf("plot-%d%s", rt.artifactCount()+1, ext)
+		case path.Ext(name) == "":
+			name += ext
+		}
+		if err := rt.AddArtifact(Artifact{Name: name, MimeType: format.MimeType(), Data: data}); err != nil {
+			return nil, fmt.Errorf("plot: %w", err)
+		}
+		return Str(name), nil
+	})
+}
+
+// plotSeries converts the series argument of plot.
+func plotSeries(v Value) ([]charts.Series, error) {
+	switch val := v.(type) {
+	case *ArrayValue:
+		if len(val.Elements) > 0 {
+			if _, ok := val.Elements[0].(*MapValue); ok {
+				out := make([]charts.Series, 0, len(val.Elements))
+				for i, e := range val.Elements {
+					m, ok := e.(*MapValue)
+					if !ok {
+						return nil, fmt.Errorf("series %d must be a map, got %T", i+1, e)
+					}
+					values, err := plotNumbers(m.Values["values"])
+					if err != nil {
+						return nil, fmt.Errorf("series %d: %w", i+1, err)
+					}
+					out = append(out, charts.Series{Name: plotString(m.Values["name"]), Values: values})
+				}
+				return out, nil
+			}
+		}
+		values, err := plotNumbers(val)
+		if err != nil {
+			return nil, err
+		}
+		return []charts.Series{{Values: values}}, nil
+	case *MapValue:
+		names := make([]string, 0, len(val.Values))
+		for name := range val.Values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		out := make([]charts.Series, 0, len(names))
+		for _, name := range names {
+			values, err := plotNumbers(val.Values[name])
+			if err != nil {
+				return nil, fmt.Errorf("series %q: %w", name, err)
+			}
+			out = append(out, charts.Series{Name: name, Values: values})
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("series must be an array or a map, got %T", v)
+}
+
+// plotNumbers converts an array of numbers; null elements leave gaps.
+func plotNumbers(v Value) ([]float64, error) {
+	if se, ok := v.(ScopeEntry); ok {
+		v = se.Value
+	}
+	arr, ok := v.(*ArrayValue)
+	if !ok {
+		return nil, fmt.Errorf("values must be an array, got %T", v)
+	}
+	out := make([]float64, len(arr.Elements))
+	for i, e := range arr.Elements {
+		switch n := e.(type) {
+		case Number:
+			out[i] = float64(n)
+		case nil:
+			out[i] = math.NaN()
+		default:
+			if e == DBNull {
+				out[i] = math.NaN()
+				continue
+			}
+			return nil, fmt.Errorf("value %d must be a number, got %T", i+1, e)
+		}
+	}
+	return out, nil
+}
+
+// plotXValues sets numeric x coordinates or, for strings, point labels.
+func plotXValues(chart *charts.Chart, v Value) error {
+	arr, ok := v.(*ArrayValue)
+	if !ok {
+		return fmt.Errorf("must be an array, got %T", v)
+	}
+	if len(arr.Elements) > 0 {
+		if _, ok := arr.Elements[0].(Str); ok {
+			chart.Labels = make([]string, len(arr.Elements))
+			for i, e := range arr.Elements {
+				chart.Labels[i] = plotString(e)
+			}
+			return nil
+		}
+	}
+	xs, err := plotNumbers(arr)
+	if err != nil {
+		return err
+	}
+	chart.X = xs
+	return nil
+}
+
+func plotString(v Value) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case Str:
+		return string(s)
+	}
+	return fmt.Sprint(v)
+}
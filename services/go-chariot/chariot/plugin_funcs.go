@@ -0,0 +1,425 @@
+package chariot
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"go.uber.org/zap"
+)
+
+// A plugin is an external builtin pack: a program that talks the extension
+// host protocol on stdin/stdout, described by a plugin.json manifest in its
+// own directory under the plugins directory:
+//
+//	{
+//	  "name": "acme-risk",
+//	  "version": "1.2.0",
+//	  "command": "./acme-risk",
+//	  "args": ["--mode", "prod"],
+//	  "env": {"ACME_REGION": "eu"},
+//	  "timeoutMs": 10000,
+//	  "functions": [
+//	    {"name": "riskScore", "description": "Risk score for a customer",
+//	     "params": [{"name": "customerId", "type": "S"}, {"name": "options", "type": "M", "optional": true}],
+//	     "returns": "N"}
+//	  ]
+//	}
+//
+// The process is started on the first call and kept running. Each call is one
+// line of JSON on its stdin, {"id": 1, "function": "riskScore", "args": [...]},
+// answered by one line on its stdout, {"id": 1, "result": ...} or
+// {"id": 1, "error": "message"}. Arguments and results are plain JSON values.
+// Anything the plugin writes to stderr is passed through to the server's
+// stderr. A process that exits or exceeds the timeout is killed and started
+// again on the next call.
+
+// PluginManifest describes a plugin and the functions it provides.
+type PluginManifest struct {
+	Name      string            `json:"name"`
+	Version   string            `json:"version,omitempty"`
+	Command   string            `json:"command"`
+	Args      []string          `json:"args,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	TimeoutMs int               `json:"timeoutMs,omitempty"`
+	Functions []PluginFunction  `json:"functions"`
+
+	Dir string `json:"-"` // Directory of the manifest; relative commands resolve against it
+}
+
+// PluginFunction is the declared signature of a plugin function. Types are
+// Chariot type codes: N, S, L, A, M, J (JSON node), or empty for any value.
+type PluginFunction struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	Params      []PluginParam `json:"params,omitempty"`
+	Variadic    bool          `json:"variadic,omitempty"` // The last parameter repeats
+	Returns     string        `json:"returns,omitempty"`
+}
+
+// PluginParam is one declared parameter of a plugin function.
+type PluginParam struct {
+	Name     string `json:"name"`
+	Type     string `json:"type,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+// DefaultPluginTimeout bounds a plugin call when the manifest sets no timeout.
+const DefaultPluginTimeout = 30 * time.Second
+
+var pluginTypes = map[string]bool{"": true, "N": true, "S": true, "L": true, "A": true, "M": true, "J": true}
+
+type pluginHost struct {
+	manifest PluginManifest
+
+	mu        sync.Mutex // serializes calls; the protocol has one request in flight
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	responses chan pluginResponse
+	nextID    int64
+}
+
+type pluginRequest struct {
+	ID       int64         `json:"id"`
+	Function string        `json:"function"`
+	Args     []interface{} `json:"args"`
+}
+
+type pluginResponse struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  string          `json:"error"`
+}
+
+var pluginRegistry struct {
+	sync.RWMutex
+	hosts     []*pluginHost
+	functions map[string]*pluginFunctionRef
+}
+
+type pluginFunctionRef struct {
+	host *pluginHost
+	fn   PluginFunction
+}
+
+// LoadPlugins reads the plugin.json manifests in the subdirectories of dir
+// and makes their functions available to runtimes set up by RegisterAll
+// afterwards. Invalid manifests, and functions already declared by an earlier
+// plugin, are skipped with a warning. Plugins loaded before are stopped.
+func LoadPlugins(dir string) ([]PluginManifest, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	StopPlugins()
+
+	var loaded []PluginManifest
+	hosts := []*pluginHost{}
+	functions := map[string]*pluginFunctionRef{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		manifestDir := filepath.Join(dir, entry.Name())
+		m, err := readPluginManifest(manifestDir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			cfg.ChariotLogger.Warn("Skipping plugin", zap.String("dir", manifestDir), zap.Error(err))
+			continue
+		}
+		host := &pluginHost{manifest: *m}
+		kept := m.Functions[:0]
+		for _, fn := range m.Functions {
+			if prev, dup := functions[fn.Name]; dup {
+				cfg.ChariotLogger.Warn("Skipping duplicate plugin function",
+					zap.String("function", fn.Name),
+					zap.String("plugin", m.Name),
+					zap.String("declared_by", prev.host.manifest.Name))
+				continue
+			}
+			functions[fn.Name] = &pluginFunctionRef{host: host, fn: fn}
+			kept = append(kept, fn)
+		}
+		host.manifest.Functions = kept
+		hosts = append(hosts, host)
+		loaded = append(loaded, host.manifest)
+		cfg.ChariotLogger.Info("Loaded plugin",
+			zap.String("name", m.Name),
+			zap.String("version", m.Version),
+			zap.Int("functions", len(kept)))
+	}
+
+	pluginRegistry.Lock()
+	pluginRegistry.hosts = hosts
+	pluginRegistry.functions = functions
+	pluginRegistry.Unlock()
+	return loaded, nil
+}
+
+func readPluginManifest(dir string) (*PluginManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "plugin.json"))
+	if err != nil {
+		return nil, err
+	}
+	var m PluginManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("plugin.json: %w", err)
+	}
+	m.Dir = dir
+	if m.Name == "" {
+		m.Name = filepath.Base(dir)
+	}
+	if m.Command == "" {
+		return nil, errors.New("plugin.json: command is required")
+	}
+	if len(m.Functions) == 0 {
+		return nil, errors.New("plugin.json: no functions declared")
+	}
+	for _, fn := range m.Functions {
+		if fn.Name == "" {
+			return nil, errors.New("plugin.json: function without a name")
+		}
+		if !pluginTypes[fn.Returns] {
+			return nil, fmt.Errorf("plugin.json: %s: unknown return type %q", fn.Name, fn.Returns)
+		}
+		optional := false
+		for _, p := range fn.Params {
+			if !pluginTypes[p.Type] {
+				return nil, fmt.Errorf("plugin.json: %s: parameter %s: unknown type %q", fn.Name, p.Name, p.Type)
+			}
+			if optional && !p.Optional {
+				return nil, fmt.Errorf("plugin.json: %s: required parameter %s follows an optional one", fn.Name, p.Name)
+			}
+			optional = optional || p.Optional
+		}
+		if fn.Variadic && len(fn.Params) == 0 {
+			return nil, fmt.Errorf("plugin.json: %s: variadic function needs a parameter", fn.Name)
+		}
+	}
+	return &m, nil
+}
+
+// Plugins returns the manifests of the loaded plugins, sorted by name.
+func Plugins() []PluginManifest {
+	pluginRegistry.RLock()
+	defer pluginRegistry.RUnlock()
+	out := make([]PluginManifest, 0, len(pluginRegistry.hosts))
+	for _, h := range pluginRegistry.hosts {
+		out = append(out, h.manifest)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// StopPlugins stops every running plugin process. They are started again by
+// the next call.
+func StopPlugins() {
+	pluginRegistry.RLock()
+	hosts := pluginRegistry.hosts
+	pluginRegistry.RUnlock()
+	for _, h := range hosts {
+		h.mu.Lock()
+		h.stop()
+		h.mu.Unlock()
+	}
+}
+
+// RegisterPluginFunctions registers the functions of the loaded plugins.
+// Plugin functions never replace a builtin of the same name.
+func RegisterPluginFunctions(rt *Runtime) {
+	pluginRegistry.RLock()
+	defer pluginRegistry.RUnlock()
+	for name, ref := range pluginRegistry.functions {
+		if _, exists := rt.funcs[name]; exists {
+			cfg.ChariotLogger.Warn("Plugin function shadows a builtin; ignored",
+				zap.String("function", name), zap.String("plugin", ref.host.manifest.Name))
+			continue
+		}
+		ref := ref
+		rt.Register(name, func(args ...Value) (Value, error) {
+			return ref.call(args)
+		})
+		TraceFunctions(name) // plugins run outside the runtime
+		MeterFunctions(name)
+	}
+}
+
+func (ref *pluginFunctionRef) call(args []Value) (Value, error) {
+	fn := ref.fn
+	required := 0
+	for _, p := range fn.Params {
+		if !p.Optional {
+			required++
+		}
+	}
+	if len(args) < required || (!fn.Variadic && len(args) > len(fn.Params)) {
+		return nil, fmt.Errorf("%s expects %s, got %d", fn.Name, pluginArity(fn, required), len(args))
+	}
+
+	native := make([]interface{}, len(args))
+	for i, arg := range args {
+		if se, ok := arg.(ScopeEntry); ok {
+			arg = se.Value
+		}
+		param := fn.Params[min(i, len(fn.Params)-1)]
+		if param.Type != "" && GetValueTypeSpec(arg) != param.Type {
+			return nil, fmt.Errorf("%s: argument %d (%s) must be of type %s, got %s",
+				fn.Name, i+1, param.Name, param.Type, GetValueTypeSpec(arg))
+		}
+		if node, ok := arg.(*JSONNode); ok {
+			native[i] = node.GetJSONValue()
+		} else {
+			native[i] = ValueToJSON(arg)
+		}
+	}
+
+	raw, err := ref.host.call(fn.Name, native)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			return nil, fmt.Errorf("%s: invalid result from plugin %s: %w", fn.Name, ref.host.manifest.Name, err)
+		}
+	}
+	result, err := JSONToValue(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name, err)
+	}
+	if fn.Returns != "" && fn.Returns != "J" && result != nil && GetValueTypeSpec(result) != fn.Returns {
+		return nil, fmt.Errorf("%s: plugin %s returned type %s, declared %s",
+			fn.Name, ref.host.manifest.Name, GetValueTypeSpec(result), fn.Returns)
+	}
+	return result, nil
+}
+
+func pluginArity(fn PluginFunction, required int) string {
+	switch {
+	case fn.Variadic:
+		return fmt.Sprintf("at least %d arguments", required)
+	case required == len(fn.Params):
+		return fmt.Sprintf("%d arguments", required)
+	default:
+		return fmt.Sprintf("%d to %d arguments", required, len(fn.Params))
+	}
+}
+
+// call sends one request to the plugin process, starting it if necessary.
+func (h *pluginHost) call(function string, args []interface{}) (json.RawMessage, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.cmd == nil {
+		if err := h.start(); err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", h.manifest.Name, err)
+		}
+	}
+	h.nextID++
+	line, err := json.Marshal(pluginRequest{ID: h.nextID, Function: function, Args: args})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := h.stdin.Write(append(line, '\n')); err != nil {
+		h.stop()
+		return nil, fmt.Errorf("plugin %s: %w", h.manifest.Name, err)
+	}
+
+	timeout := DefaultPluginTimeout
+	if h.manifest.TimeoutMs > 0 {
+		timeout = time.Duration(h.manifest.TimeoutMs) * time.Millisecond
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case resp, ok := <-h.responses:
+			if !ok {
+				h.stop()
+				return nil, fmt.Errorf("plugin %s exited during %s", h.manifest.Name, function)
+			}
+			if resp.ID != h.nextID {
+				continue // answer to a call that timed out earlier
+			}
+			if resp.Error != "" {
+				return nil, fmt.Errorf("%s: %s", function, resp.Error)
+			}
+			return resp.Result, nil
+		case <-timer.C:
+			h.stop()
+			return nil, fmt.Errorf("plugin %s: %s timed out after %v", h.manifest.Name, function, timeout)
+		}
+	}
+}
+
+func (h *pluginHost) start() error {
+	command := h.manifest.Command
+	if !filepath.IsAbs(command) && filepath.Base(command) != command {
+		command = filepath.Join(h.manifest.Dir, command)
+	}
+	cmd := exec.Command(command, h.manifest.Args...)
+	cmd.Dir = h.manifest.Dir
+	cmd.Env = os.Environ()
+	for k, v := range h.manifest.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	responses := make(chan pluginResponse, 1)
+	go func() {
+		defer close(responses)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64<<10), 16<<20)
+		for scanner.Scan() {
+			var resp pluginResponse
+			if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+				cfg.ChariotLogger.Warn("Ignoring malformed plugin output",
+					zap.String("plugin", h.manifest.Name), zap.Error(err))
+				continue
+			}
+			responses <- resp
+		}
+		_ = cmd.Wait()
+	}()
+
+	h.cmd, h.stdin, h.responses = cmd, stdin, responses
+	cfg.ChariotLogger.Info("Started plugin", zap.String("name", h.manifest.Name), zap.Int("pid", cmd.Process.Pid))
+	return nil
+}
+
+// stop kills the plugin process; the caller holds h.mu.
+func (h *pluginHost) stop() {
+	if h.cmd == nil {
+		return
+	}
+	_ = h.stdin.Close()
+	_ = h.cmd.Process.Kill()
+	// Drain so the reader goroutine can reach Wait
+	go func(responses chan pluginResponse) {
+		for range responses {
+		}
+	}(h.responses)
+	h.cmd, h.stdin, h.responses = nil, nil, nil
+}
@@ -0,0 +1,106 @@
+package chariot
+
+import "math"
+
+// ProgramCost is a static estimate of the work a program does, made without
+// running it, so programs too expensive to run unattended can be refused.
+// Loop trip counts are unknown before a run, so each level of loop nesting
+// multiplies the cost of its body by costLoopIterations; the score compares
+// programs rather than predicting their running time.
+type ProgramCost struct {
+	Score         int `json:"score"`          // Weighted calls; see EstimateCost
+	Calls         int `json:"calls"`          // Call sites
+	ExternalCalls int `json:"external_calls"` // Call sites of builtins counted as external calls
+	LoopDepth     int `json:"loop_depth"`     // Deepest nesting of loops and callbacks
+}
+
+// Weights of EstimateCost.
+const (
+	costLoopIterations = 10 // Assumed runs of a loop body or callback
+	costExternalCall   = 25 // A database, MCP, notification or plugin call
+)
+
+// EstimateCost estimates the cost of a program: every call scores 1, or
+// costExternalCall for the builtins ExecutionUsage counts as external calls,
+// and the bodies of while loops and of function literals passed to calls
+// (the callbacks of tableFilter, treeWalk and the like) score
+// costLoopIterations times their contents. Functions defined once score
+// their body once.
+func EstimateCost(program *Block) ProgramCost {
+	var cost ProgramCost
+	cost.Score = estimateNodeCost(program, 0, &cost)
+	return cost
+}
+
+func estimateNodeCost(n Node, depth int, cost *ProgramCost) int {
+	if depth > cost.LoopDepth {
+		cost.LoopDepth = depth
+	}
+	sum := func(nodes []Node, depth int) int {
+		total := 0
+		for _, c := range nodes {
+			total = addCost(total, estimateNodeCost(c, depth, cost))
+		}
+		return total
+	}
+	switch n := n.(type) {
+	case *Block:
+		return sum(n.Stmts, depth)
+	case *FuncCall:
+		score := 1
+		cost.Calls++
+		if IsMeteredFunction(n.Name) {
+			score = costExternalCall
+			cost.ExternalCalls++
+		}
+		for _, arg := range n.Args {
+			if fn, ok := arg.(*FunctionDefNode); ok && n.Name != "setq" && n.Name != "declare" && n.Name != "declareGlobal" {
+				score = addCost(score, mulCost(estimateNodeCost(fn.Body, depth+1, cost), costLoopIterations))
+				continue
+			}
+			score = addCost(score, estimateNodeCost(arg, depth, cost))
+		}
+		return score
+	case *FunctionCallNode:
+		cost.Calls++
+		return addCost(1, sum(n.Args, depth))
+	case *FunctionDefNode:
+		return estimateNodeCost(n.Body, depth, cost)
+	case *ArrayLiteralNode:
+		return sum(n.Elements, depth)
+	case *IfNode:
+		return addCost(estimateNodeCost(n.Condition, depth, cost), addCost(sum(n.TrueBranch, depth), sum(n.FalseBranch, depth)))
+	case *WhileNode:
+		body := addCost(estimateNodeCost(n.Condition, depth+1, cost), sum(n.Body, depth+1))
+		return mulCost(body, costLoopIterations)
+	case *SwitchNode:
+		score := 0
+		if n.TestExpr != nil {
+			score = estimateNodeCost(n.TestExpr, depth, cost)
+		}
+		for _, cs := range n.Cases {
+			score = addCost(score, addCost(estimateNodeCost(cs.Condition, depth, cost), estimateNodeCost(cs.Body, depth, cost)))
+		}
+		if n.DefaultCase != nil {
+			score = addCost(score, estimateNodeCost(n.DefaultCase.Body, depth, cost))
+		}
+		return score
+	}
+	return 0
+}
+
+// addCost and mulCost saturate at math.MaxInt32 instead of overflowing on
+// deeply nested loops.
+func addCost(a, b int) int {
+	if a > math.MaxInt32-b {
+		return math.MaxInt32
+	}
+	return a + b
+}
+
+func mulCost(a, b int) int {
+	if a != 0 && b > math.MaxInt32/a {
+		return math.MaxInt32
+	}
+	return a * b
+}
@@ -0,0 +1,402 @@
+package chariot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Symbols and renaming. A source is parsed and the names it defines, calls
+// and refers to are located, so a name is changed where the program uses it
+// and nowhere else: not in comments, not in strings other than the name given
+// to registerFunction, getFunction and deleteFunction, not in a function
+// taking a parameter of the same name.
+
+// SymbolRef is one occurrence of a user function or variable name.
+type SymbolRef struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"` // function | variable
+	Role     string `json:"role"` // definition | call | reference
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Function string `json:"function,omitempty"` // Enclosing function, "" at top level
+
+	offset int             // Byte offset of the name in the source
+	params map[string]bool // Parameters in scope, which a new name must not take
+}
+
+// functionNameArgs are the builtins whose first argument is the name of a
+// registered function, as a string.
+var functionNameArgs = map[string]string{
+	"registerFunction": "definition",
+	"getFunction":      "reference",
+	"deleteFunction":   "reference",
+}
+
+// reservedNames are parsed as syntax rather than as names.
+var reservedNames = map[string]bool{
+	"if": true, "else": true, "while": true, "switch": true, "case": true, "default": true, "func": true,
+}
+
+type symbolWalker struct {
+	rt        *Runtime
+	file      string
+	src       string // Whole source, for lines and columns
+	base      int    // Offset in src of the parsed text
+	srcLines  []int
+	textLines []int
+	refs      []SymbolRef
+}
+
+// FindSymbols parses src and returns the occurrences of user function and
+// variable names in it, in source order. Calls of builtins (those of rt, or
+// all known builtins when rt is nil) are left out. Besides programs, src may
+// be a function in the form the editor saves: function name(params) { body }.
+func FindSymbols(src, file string, rt *Runtime) ([]SymbolRef, error) {
+	w := &symbolWalker{rt: rt, file: file, src: src, srcLines: lineOffsets(src)}
+
+	_, rest := splitDocComment(src)
+	base := len(src) - len(rest)
+	if m := functionFormRe.FindStringSubmatchIndex(strings.TrimRight(rest, " \t\r\n")); m != nil {
+		name := rest[m[2]:m[3]]
+		params := map[string]bool{}
+		for _, p := range strings.Split(rest[m[4]:m[5]], ",") {
+			p, _, _ = strings.Cut(p, ":")
+			if p = strings.TrimSpace(p); p != "" {
+				params[p] = true
+			}
+		}
+		w.addAt(name, "function", "definition", base+m[2], "", nil)
+		body, err := ParseSource(rest[m[8]:m[9]], file)
+		if err != nil {
+			return nil, err
+		}
+		w.base, w.textLines = base+m[8], lineOffsets(rest[m[8]:m[9]])
+		w.walk(body, name, params)
+	} else {
+		program, err := ParseSource(src, file)
+		if err != nil {
+			return nil, err
+		}
+		w.textLines = w.srcLines
+		w.walk(program, "", nil)
+	}
+	sort.SliceStable(w.refs, func(i, j int) bool { return w.refs[i].offset < w.refs[j].offset })
+	return w.refs, nil
+}
+
+// lineOffsets returns the offset of the first byte of each line.
+func lineOffsets(s string) []int {
+	offsets := []int{0}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			offsets = append(offsets, i+1)
+		}
+	}
+	return offsets
+}
+
+func (w *symbolWalker) builtin(name string) bool {
+	return isBuiltinName(w.rt, name)
+}
+
+// isBuiltinName reports whether name is a builtin of rt, or of any runtime
+// when rt is nil.
+func isBuiltinName(rt *Runtime, name string) bool {
+	if rt != nil {
+		return rt.funcs[name] != nil
+	}
+	_, ok := builtinMeta[name]
+	return ok
+}
+
+// add records the name at pos, a position in the parsed text. quoted is set
+// for string literals, whose position is that of the opening quote.
+func (w *symbolWalker) add(name, kind, role string, pos SourcePos, quoted bool, fn string, params map[string]bool) {
+	if pos.Line < 1 || pos.Line > len(w.textLines) {
+		return
+	}
+	offset := w.base + w.textLines[pos.Line-1] + pos.Column - 1
+	if quoted {
+		offset++
+	}
+	w.addAt(name, kind, role, offset, fn, params)
+}
+
+func (w *symbolWalker) addAt(name, kind, role string, offset int, fn string, params map[string]bool) {
+	// A name is only recorded where the source spells it, which escapes in a
+	// string literal may not
+	if offset < 0 || offset+len(name) > len(w.src) || w.src[offset:offset+len(name)] != name {
+		return
+	}
+	line := sort.Search(len(w.srcLines), func(i int) bool { return w.srcLines[i] > offset })
+	w.refs = append(w.refs, SymbolRef{
+		Name: name, Kind: kind, Role: role, File: w.file,
+		Line: line, Column: offset - w.srcLines[line-1] + 1,
+		Function: fn, offset: offset, params: params,
+	})
+}
+
+// withParams returns the parameters in scope inside a function taking names.
+func withParams(params map[string]bool, names []string) map[string]bool {
+	if len(names) == 0 {
+		return params
+	}
+	out := make(map[string]bool, len(params)+len(names))
+	for name := range params {
+		out[name] = true
+	}
+	for _, name := range names {
+		out[name] = true
+	}
+	return out
+}
+
+// walk records the names in n, which is inside function fn (or at top level
+// when fn is "") where params are the parameters in scope.
+func (w *symbolWalker) walk(n Node, fn string, params map[string]bool) {
+	each := func(nodes []Node) {
+		for _, c := range nodes {
+			w.walk(c, fn, params)
+		}
+	}
+	switch n := n.(type) {
+	case *Block:
+		each(n.Stmts)
+	case *VarRef:
+		if !params[n.Name] {
+			w.add(n.Name, "variable", "reference", n.Pos, false, fn, params)
+		}
+	case *FuncCall:
+		w.call(n, fn, params)
+	case *FunctionDefNode:
+		w.walk(n.Body, fn, withParams(params, n.Parameters))
+	case *ArrayLiteralNode:
+		each(n.Elements)
+	case *IfNode:
+		w.walk(n.Condition, fn, params)
+		each(n.TrueBranch)
+		each(n.FalseBranch)
+	case *WhileNode:
+		w.walk(n.Condition, fn, params)
+		each(n.Body)
+	case *SwitchNode:
+		w.walk(n.TestExpr, fn, params)
+		for _, cs := range n.Cases {
+			w.walk(cs.Condition, fn, params)
+			w.walk(cs.Body, fn, params)
+		}
+		if n.DefaultCase != nil {
+			w.walk(n.DefaultCase.Body, fn, params)
+		}
+	}
+}
+
+func (w *symbolWalker) call(f *FuncCall, fn string, params map[string]bool) {
+	if !w.builtin(f.Name) && !params[f.Name] {
+		w.add(f.Name, "function", "call", f.Pos, false, fn, params)
+	}
+	args := f.Args
+	defines := "" // Function defined by a FunctionDefNode argument
+	switch f.Name {
+	case "setq", "declare", "declareGlobal":
+		if len(args) == 0 {
+			break
+		}
+		if ref, ok := args[0].(*VarRef); ok && !params[ref.Name] {
+			kind := "variable"
+			if _, isDef := args[len(args)-1].(*FunctionDefNode); isDef && len(args) > 1 {
+				kind, defines = "function", ref.Name
+			}
+			w.add(ref.Name, kind, "definition", ref.Pos, false, fn, params)
+		}
+		args = args[1:]
+	case "createTransform":
+		// The first argument names a transform, not a variable
+		if len(args) > 0 {
+			args = args[1:]
+		}
+	case "call":
+		if len(args) > 0 {
+			if ref, ok := args[0].(*VarRef); ok {
+				if !params[ref.Name] {
+					w.add(ref.Name, "function", "call", ref.Pos, false, fn, params)
+				}
+				args = args[1:]
+			}
+		}
+	default:
+		role, ok := functionNameArgs[f.Name]
+		if !ok || len(args) == 0 {
+			break
+		}
+		if lit, isLit := args[0].(*Literal); isLit {
+			if name, isStr := lit.Val.(Str); isStr {
+				w.add(string(name), "function", role, lit.Pos, true, fn, params)
+				if role == "definition" {
+					defines = string(name)
+				}
+			}
+			args = args[1:]
+		}
+	}
+	for _, a := range args {
+		if def, ok := a.(*FunctionDefNode); ok && defines != "" {
+			w.walk(def, defines, params)
+			continue
+		}
+		w.walk(a, fn, params)
+	}
+}
+
+// IsIdentifier reports whether name can be used as a function or variable
+// name.
+func IsIdentifier(name string) bool {
+	if name == "" || reservedNames[name] {
+		return false
+	}
+	for i, r := range name {
+		if !isLetter(r) && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckRename reports why oldName cannot be renamed to newName, if it
+// cannot: a name that is not an identifier, or a builtin of rt.
+func CheckRename(rt *Runtime, oldName, newName string) error {
+	for _, name := range []string{oldName, newName} {
+		if !IsIdentifier(name) {
+			return fmt.Errorf("'%s' is not a valid name", name)
+		}
+		if isBuiltinName(rt, name) {
+			return fmt.Errorf("'%s' is a builtin", name)
+		}
+	}
+	if oldName == newName {
+		return fmt.Errorf("'%s' is already the name", newName)
+	}
+	return nil
+}
+
+// RenameConflict is a reason a rename cannot be made.
+type RenameConflict struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// RenameInSource replaces the occurrences of oldName in src with newName. It
+// returns the new source and the occurrences replaced, or the conflicts that
+// prevent the rename: newName already used in src, or taken by a parameter
+// of a function that uses oldName.
+func RenameInSource(src, file, oldName, newName string, rt *Runtime) (string, []SymbolRef, []RenameConflict, error) {
+	refs, err := FindSymbols(src, file, rt)
+	if err != nil {
+		return src, nil, nil, err
+	}
+	var renamed []SymbolRef
+	var conflicts []RenameConflict
+	for _, r := range refs {
+		switch {
+		case r.Name == newName:
+			conflicts = append(conflicts, RenameConflict{File: file, Line: r.Line, Column: r.Column,
+				Message: fmt.Sprintf("'%s' is already used", newName)})
+		case r.Name == oldName:
+			if r.params[newName] {
+				conflicts = append(conflicts, RenameConflict{File: file, Line: r.Line, Column: r.Column,
+					Message: fmt.Sprintf("'%s' would refer to the parameter '%s' of the enclosing function", oldName, newName)})
+			}
+			renamed = append(renamed, r)
+		}
+	}
+	if len(conflicts) > 0 || len(renamed) == 0 {
+		return src, renamed, conflicts, nil
+	}
+	var sb strings.Builder
+	last := 0
+	for _, r := range renamed {
+		sb.WriteString(src[last:r.offset])
+		sb.WriteString(newName)
+		last = r.offset + len(oldName)
+	}
+	sb.WriteString(src[last:])
+	return sb.String(), renamed, nil, nil
+}
+
+// FunctionSource returns the text of a library function that SaveFunction
+// can rebuild it from, for renaming and indexing: its formatted source when
+// it is one, else the source it was saved from, else the function rendered
+// from its body.
+func FunctionSource(name string, fn *FunctionValue) string {
+	for _, src := range []string{fn.FormattedSource, fn.SourceCode} {
+		if rebuildable(src) {
+			return src
+		}
+	}
+	def := &FunctionDefNode{Parameters: fn.Parameters, ParamTypes: fn.ParamTypes, ReturnType: fn.ReturnType, Body: fn.Body}
+	src := "function " + name + strings.TrimPrefix(strings.TrimSpace(def.ToString()), "function")
+	if fn.Doc != "" {
+		src = "/// " + strings.ReplaceAll(fn.Doc, "\n", "\n/// ") + "\n" + src
+	}
+	return src
+}
+
+// rebuildable reports whether SaveFunction accepts src, once trimmed: a
+// function in the editor's form, setq(name, func...) or func(...) {...}.
+func rebuildable(src string) bool {
+	_, rest := splitDocComment(strings.TrimSpace(src))
+	if functionFormRe.MatchString(rest) {
+		return true
+	}
+	program, err := ParseSource(rest, "")
+	if err != nil || len(program.Stmts) != 1 {
+		return false
+	}
+	switch n := program.Stmts[0].(type) {
+	case *FunctionDefNode:
+		return true
+	case *FuncCall:
+		if n.Name == "setq" && len(n.Args) == 2 {
+			_, ok := n.Args[1].(*FunctionDefNode)
+			return ok
+		}
+	}
+	return false
+}
+
+// LineDiff returns a unified diff, without context lines, between two
+// versions of a source with the same number of lines, as renames produce.
+func LineDiff(file, before, after string) string {
+	a, b := strings.Split(before, "\n"), strings.Split(after, "\n")
+	if len(a) != len(b) {
+		return fmt.Sprintf("--- a/%s\n+++ b/%s\n@@ -1,%d +1,%d @@\n-%s\n+%s\n", file, file, len(a), len(b),
+			strings.Join(a, "\n-"), strings.Join(b, "\n+"))
+	}
+	var sb strings.Builder
+	for i := 0; i < len(a); {
+		if a[i] == b[i] {
+			i++
+			continue
+		}
+		j := i
+		for j < len(a) && a[j] != b[j] {
+			j++
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", i+1, j-i, i+1, j-i)
+		for k := i; k < j; k++ {
+			sb.WriteString("-" + a[k] + "\n")
+		}
+		for k := i; k < j; k++ {
+			sb.WriteString("+" + b[k] + "\n")
+		}
+		i = j
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return fmt.Sprintf("--- a/%s\n+++ b/%s\n", file, file) + sb.String()
+}
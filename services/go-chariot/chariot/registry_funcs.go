@@ -18,6 +18,9 @@ func RegisterAll(rt *Runtime) {
 	// Register all functions to the runtime
 	RegisterValues(rt)
 	RegisterFlow(rt)
+	RegisterDeadlineFunctions(rt)
+	RegisterRetryFunctions(rt)
+	RegisterMockFunctions(rt)
 	RegisterArray(rt)
 	RegisterCompares(rt)
 	RegisterMath(rt)
@@ -27,20 +30,28 @@ func RegisterAll(rt *Runtime) {
 	RegisterFile(rt)
 	RegisterJSON(rt) // Registers JSON functions
 	RegisterSystem(rt)
-	RegisterHostFunctions(rt)           // Registers host functions
-	RegisterSQLFunctions(rt)            // Registers SQL functions
-	RegisterCouchbaseFunctions(rt)      // Registers Couchbase functions
-	RegisterETLFunctions(rt)            // If you have ETL functions
-	RegisterTreeFunctions(rt)           // Registers tree functions
-	RegisterCryptoFunctions(rt)         // Registers crypto functions
-	RegisterAuthFuncs(rt)               // Registers auth functions
-	RegisterRBACFuncs(rt)               // Registers RBAC functions
-	RegisterCSVFunctions(rt)            // Registers CSV functions
-	RegisterMCPFunctions(rt)            // Registers MCP client functions
-	RegisterKnapsackFunctions(rt)       // Registers knapsack solver functions
-	RegisterRLFunctions(rt)             // Registers RL Support (NBA scoring) functions
-	RegisterTypeDispatchedFunctions(rt) // Registers polymorphic functions LAST
-	RegisterPlanFunctions(rt)           // Registers plan/agent functions
+	RegisterHostFunctions(rt)            // Registers host functions
+	RegisterSQLFunctions(rt)             // Registers SQL functions
+	RegisterCouchbaseFunctions(rt)       // Registers Couchbase functions
+	RegisterETLFunctions(rt)             // If you have ETL functions
+	RegisterTreeFunctions(rt)            // Registers tree functions
+	RegisterCryptoFunctions(rt)          // Registers crypto functions
+	RegisterCertificateFunctions(rt)     // Registers X.509 certificate functions
+	RegisterAuthFuncs(rt)                // Registers auth functions
+	RegisterRBACFuncs(rt)                // Registers RBAC functions
+	RegisterCSVFunctions(rt)             // Registers CSV functions
+	RegisterDataFrameFunctions(rt)       // Registers columnar table functions
+	RegisterMCPFunctions(rt)             // Registers MCP client functions
+	RegisterKnapsackFunctions(rt)        // Registers knapsack solver functions
+	RegisterRLFunctions(rt)              // Registers RL Support (NBA scoring) functions
+	RegisterNotifyFunctions(rt)          // Registers sendEmail and slackPost
+	RegisterPlotFunctions(rt)            // Registers plot
+	RegisterArtifactFunctions(rt)        // Registers emitArtifact, emit, resultType
+	RegisterTypeDispatchedFunctions(rt)  // Registers polymorphic functions LAST
+	RegisterPlanFunctions(rt)            // Registers plan/agent functions
+	RegisterPlanLibraryFunctions(rt)     // Registers the shared plan library
+	RegisterAgentFederationFunctions(rt) // Registers following of local and federated agents
+	RegisterPluginFunctions(rt)          // Registers functions of loaded plugins; never shadows builtins
 
 	// Populate master registry from the runtime
 	PopulateMasterRegistryFromRuntime(rt)
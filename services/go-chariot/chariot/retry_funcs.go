@@ -0,0 +1,282 @@
+package chariot
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRetryBackoff caps the wait between two attempts of retry.
+const maxRetryBackoff = 30 * time.Second
+
+// Defaults of circuit.
+const (
+	defaultCircuitThreshold = 5
+	defaultCircuitReset     = 30 * time.Second
+)
+
+// ErrCircuitOpen is the error circuit fails with while its circuit is open
+// and no fallback is given.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Circuit states.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitState describes a circuit breaker of this process.
+type CircuitState struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Failures  int       `json:"failures"`  // In a row
+	Threshold int       `json:"threshold"` // Failures in a row that open it
+	ResetMs   int64     `json:"reset_ms"`  // How long it stays open before a trial call
+	Calls     int64     `json:"calls"`
+	Rejected  int64     `json:"rejected"` // Calls not made while it was open
+	OpenedAt  time.Time `json:"opened_at,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+type circuitBreaker struct {
+	CircuitState
+	trial bool // A trial call is running while half-open
+}
+
+// The circuit breakers scripts use, by name. They are shared by every
+// runtime of the process and outlive the executions that use them, so one
+// failing dependency is backed off from by all the scripts calling it.
+var (
+	circuitMu sync.Mutex
+	circuits  = map[string]*circuitBreaker{}
+)
+
+// Circuits lists the circuit breakers of this process by name.
+func Circuits() []CircuitState {
+	circuitMu.Lock()
+	defer circuitMu.Unlock()
+	list := make([]CircuitState, 0, len(circuits))
+	for _, cb := range circuits {
+		st := cb.CircuitState
+		if st.State == CircuitOpen && time.Since(st.OpenedAt) >= time.Duration(st.ResetMs)*time.Millisecond {
+			st.State = CircuitHalfOpen
+		}
+		list = append(list, st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// ResetCircuit closes the circuit breaker name, as after a successful call.
+// It reports whether the circuit exists.
+func ResetCircuit(name string) bool {
+	circuitMu.Lock()
+	defer circuitMu.Unlock()
+	cb := circuits[name]
+	if cb == nil {
+		return false
+	}
+	cb.State, cb.Failures, cb.OpenedAt, cb.trial = CircuitClosed, 0, time.Time{}, false
+	return true
+}
+
+// allow reports whether a call may go through the circuit now, and whether
+// it is the trial call of a half-open circuit.
+func (cb *circuitBreaker) allow() (ok, trial bool) {
+	cb.Calls++
+	if cb.State == CircuitOpen && time.Since(cb.OpenedAt) >= time.Duration(cb.ResetMs)*time.Millisecond {
+		cb.State = CircuitHalfOpen
+	}
+	switch {
+	case cb.State == CircuitClosed:
+		return true, false
+	case cb.State == CircuitHalfOpen && !cb.trial:
+		cb.trial = true
+		return true, true
+	}
+	cb.Rejected++
+	return false, false
+}
+
+// done records the outcome of a call allowed through the circuit.
+func (cb *circuitBreaker) done(trial bool, err error) {
+	if trial {
+		cb.trial = false
+	}
+	if err == nil {
+		cb.State, cb.Failures, cb.OpenedAt = CircuitClosed, 0, time.Time{}
+		return
+	}
+	cb.Failures++
+	cb.LastError = err.Error()
+	if trial || (cb.State == CircuitClosed && cb.Failures >= cb.Threshold) {
+		cb.State, cb.OpenedAt = CircuitOpen, time.Now()
+	}
+}
+
+// retryable reports whether err matches one of codes, which are looked for
+// in its message regardless of case; every error matches when there are no
+// codes.
+func retryable(err error, codes []string) bool {
+	if len(codes) == 0 {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, code := range codes {
+		if strings.Contains(msg, strings.ToLower(code)) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay is the wait before attempt+1: backoff doubled for each attempt
+// made, of which a random half is dropped so that scripts failing together
+// do not retry together.
+func retryDelay(backoff time.Duration, attempt int) time.Duration {
+	d := backoff
+	for i := 1; i < attempt && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// pause waits d, or until the runtime's deadline when that is nearer, and
+// fails when the program should stop.
+func (rt *Runtime) pause(d time.Duration) error {
+	if at, ok := rt.Deadline(); ok && time.Until(at) < d {
+		d = time.Until(at)
+	}
+	if d > 0 {
+		time.Sleep(d)
+	}
+	if err := rt.interrupted(); err != nil {
+		return err
+	}
+	return rt.deadlineCheck()
+}
+
+// RegisterRetryFunctions registers retry and circuit.
+func RegisterRetryFunctions(rt *Runtime) {
+	// retry(function, attempts, backoffMs, [retryableErrorCodes]) calls
+	// function with no arguments until it succeeds, at most attempts times,
+	// and returns its result. The wait between attempts starts around
+	// backoffMs and doubles each time, with jitter. With retryableErrorCodes,
+	// an array of strings such as '1213', '503' or 'timeout', only errors
+	// whose message contains one of them are retried.
+	rt.Register("retry", func(args ...Value) (Value, error) {
+		if len(args) < 3 || len(args) > 4 {
+			return nil, errors.New("retry requires 3-4 arguments: function, attempts, backoffMs, [retryableErrorCodes]")
+		}
+		fn, ok := args[0].(*FunctionValue)
+		if !ok {
+			return nil, fmt.Errorf("retry: expected function value, got %T", args[0])
+		}
+		attempts, ok := args[1].(Number)
+		if !ok || attempts < 1 {
+			return nil, errors.New("retry: attempts must be a number of at least 1")
+		}
+		backoffMs, ok := args[2].(Number)
+		if !ok || backoffMs < 0 {
+			return nil, errors.New("retry: backoffMs must be a number of at least 0")
+		}
+		var codes []string
+		if len(args) == 4 && args[3] != DBNull {
+			arr, ok := args[3].(*ArrayValue)
+			if !ok {
+				return nil, fmt.Errorf("retry: retryableErrorCodes must be an array, got %T", args[3])
+			}
+			for i := 0; i < arr.Length(); i++ {
+				codes = append(codes, fmt.Sprint(arr.Get(i)))
+			}
+		}
+		backoff := time.Duration(float64(backoffMs) * float64(time.Millisecond))
+
+		var err error
+		for attempt := 1; ; attempt++ {
+			var val Value
+			val, err = executeFunctionValue(rt, fn, nil)
+			if err == nil {
+				return val, nil
+			}
+			if attempt >= int(attempts) || !retryable(err, codes) {
+				break
+			}
+			if perr := rt.pause(retryDelay(backoff, attempt)); perr != nil {
+				return nil, perr
+			}
+		}
+		return nil, fmt.Errorf("retry: gave up after %d attempts: %w", int(attempts), err)
+	})
+
+	// circuit(name, function, [opts]) calls function with no arguments
+	// through the circuit breaker name, shared by every script of the
+	// process. After opts.threshold failures in a row (default 5) the
+	// circuit opens: calls fail at once, or return opts.fallback, for
+	// opts.resetMs milliseconds (default 30000). Then one trial call is let
+	// through, which closes the circuit when it succeeds and opens it again
+	// when it fails.
+	rt.Register("circuit", func(args ...Value) (Value, error) {
+		if len(args) < 2 || len(args) > 3 {
+			return nil, errors.New("circuit requires 2-3 arguments: name, function, [options]")
+		}
+		name, ok := args[0].(Str)
+		if !ok || name == "" {
+			return nil, errors.New("circuit: name must be a non-empty string")
+		}
+		fn, ok := args[1].(*FunctionValue)
+		if !ok {
+			return nil, fmt.Errorf("circuit: expected function value, got %T", args[1])
+		}
+		threshold, reset := defaultCircuitThreshold, defaultCircuitReset
+		var fallback Value
+		if len(args) == 3 {
+			opts, ok := args[2].(*MapValue)
+			if !ok {
+				return nil, fmt.Errorf("circuit: options must be a map, got %T", args[2])
+			}
+			if v, ok := opts.Values["threshold"].(Number); ok && v >= 1 {
+				threshold = int(v)
+			}
+			if v, ok := opts.Values["resetMs"].(Number); ok && v > 0 {
+				reset = time.Duration(float64(v) * float64(time.Millisecond))
+			}
+			fallback = opts.Values["fallback"]
+		}
+
+		circuitMu.Lock()
+		cb := circuits[string(name)]
+		if cb == nil {
+			cb = &circuitBreaker{CircuitState: CircuitState{Name: string(name), State: CircuitClosed}}
+			circuits[string(name)] = cb
+		}
+		// The latest options apply
+		cb.Threshold, cb.ResetMs = threshold, reset.Milliseconds()
+		allowed, trial := cb.allow()
+		circuitMu.Unlock()
+		if !allowed {
+			if fallback != nil {
+				return fallback, nil
+			}
+			return nil, fmt.Errorf("circuit '%s': %w", name, ErrCircuitOpen)
+		}
+
+		val, err := executeFunctionValue(rt, fn, nil)
+		circuitMu.Lock()
+		cb.done(trial, err)
+		circuitMu.Unlock()
+		return val, err
+	})
+}
@@ -7,7 +7,9 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
@@ -21,17 +23,63 @@ type LogWriter interface {
 
 // LogEntry represents a single log entry
 type LogEntry struct {
-	Timestamp time.Time `json:"timestamp"`
-	Level     string    `json:"level"`
-	Message   string    `json:"message"`
+	Timestamp time.Time       `json:"timestamp"`
+	Level     string          `json:"level"`
+	Message   string          `json:"message"`
+	Value     json.RawMessage `json:"value,omitempty"` // value of an emit, with Level LogResult
 }
 
+// LogResult is the level of the entries that carry a partial result from
+// emit rather than a message. They are not log levels: level filters let
+// them through.
+const LogResult = "RESULT"
+
 // JSON returns the JSON representation of the log entry
 func (e LogEntry) JSON() string {
 	data, _ := json.Marshal(e)
 	return string(data)
 }
 
+// logLevels are the levels of LogEntry, in increasing severity.
+var logLevels = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+// NormalizeLogLevel returns the name of a log level given in any case, with
+// "warning" meaning WARN.
+func NormalizeLogLevel(level string) (string, error) {
+	upper := strings.ToUpper(strings.TrimSpace(level))
+	if upper == "WARNING" {
+		upper = "WARN"
+	}
+	for _, l := range logLevels {
+		if l == upper {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("unknown log level '%s': use debug, info, warn or error", level)
+}
+
+// LogLevelAtLeast reports whether level is as severe as min or more. An
+// unknown level counts as INFO; an empty min lets everything through, and
+// LogResult passes any min.
+func LogLevelAtLeast(level, min string) bool {
+	return logLevelRank(level) >= logLevelRank(min)
+}
+
+func logLevelRank(level string) int {
+	if level == "" {
+		return -1
+	}
+	if level == LogResult {
+		return len(logLevels)
+	}
+	for i, l := range logLevels {
+		if l == level {
+			return i
+		}
+	}
+	return 1
+}
+
 var (
 	globalNameFilter []string = []string{
 		"True", "False", "Null", "DBNull", "true", "false", "null",
@@ -88,6 +136,35 @@ type Runtime struct {
 
 	// Debugger
 	Debugger *Debugger // Optional debugger for breakpoints and stepping
+
+	// Call tracking for depth limits and stack traces
+	callStack    []activeCall // Active user-defined function calls, outermost first
+	callSite     SourcePos    // Position of the statement or call currently executing
+	maxCallDepth int          // Maximum len(callStack); 0 means DefaultMaxCallDepth
+
+	snapshotDir string // Where runtimeSnapshot stores snapshots; see SnapshotDir
+
+	sandbox *SandboxProfile // Limits on notifications and other outside effects; see SandboxProfile
+
+	artifacts artifactList // Files the current run hands back with its result; see AddArtifact
+
+	interrupt atomic.Pointer[interruptState] // Set by Interrupt; checked before each statement
+
+	deadline runDeadline // Set by withTimeout and ExecContext; checked before each statement and after external calls
+
+	trace *traceState // Set while recording or replaying a trace; see StartRecording
+
+	dryRun *dryRunState // Set while writes are skipped; see StartDryRun
+
+	usage *ExecutionUsage // Set while external calls are counted; see StartUsage
+
+	mocks []*mockEntry // Builtins answered by mock and mockFixture, innermost last
+
+	deprecationWarned map[string]bool // Deprecated functions already warned about in this log; see DeprecateFunction
+
+	yamlTags map[string]*yamlTagHandler // YAML tag handlers registered by yamlRegisterTag
+
+	env map[string]string // Variables getEnv and hasEnv see before the process environment; see SetEnv
 }
 
 // NewRuntime creates an empty runtime environment.
@@ -131,6 +208,8 @@ func NewRuntime() *Runtime {
 	rt.globalScope.Set("false", Bool(false))
 	rt.globalScope.Set("null", DBNull)
 
+	rt.SetMaxCallDepth(cfg.ChariotConfig.MaxCallDepth)
+
 	// Load configured function library
 	if cfg.ChariotConfig.FunctionLib != "" {
 		if flib, err := LoadFunctionsFromFile(cfg.ChariotConfig.FunctionLib); err == nil {
@@ -157,6 +236,7 @@ func (rt *Runtime) ClearCaches() {
 // SetLogWriter sets the log writer for capturing logs during script execution
 func (rt *Runtime) SetLogWriter(writer LogWriter) {
 	rt.logWriter = writer
+	rt.deprecationWarned = nil
 }
 
 // WriteLog writes a log entry if a log writer is configured
@@ -175,6 +255,28 @@ func (rt *Runtime) WriteLog(level, message string) {
 	}
 }
 
+// Emit hands a partial result to the host through the log writer, which
+// streams it to clients as it arrives. It reports whether there was a
+// writer to take it; without one the value is dropped.
+func (rt *Runtime) Emit(v Value) (bool, error) {
+	var native interface{} = ValueToJSON(v)
+	if jn, ok := v.(interface{ GetJSONValue() interface{} }); ok {
+		native = jn.GetJSONValue()
+	}
+	data, err := json.Marshal(native)
+	if err != nil {
+		return false, err
+	}
+	if limit := ResultMaxSize(); len(data) > limit {
+		return false, fmt.Errorf("emitted value is %d bytes; the limit is %d", len(data), limit)
+	}
+	if rt.logWriter == nil {
+		return false, nil
+	}
+	rt.logWriter.Append(LogEntry{Timestamp: time.Now(), Level: LogResult, Value: data})
+	return true, nil
+}
+
 // GetFunction retrieves a registered user-defined function by name
 func (rt *Runtime) GetFunction(name string) (*FunctionValue, bool) {
 	if fn, exists := rt.functions[name]; exists {
@@ -326,19 +428,27 @@ func (rt *Runtime) RegisterFunction(name string, fn *FunctionValue) {
 	if rt.functions == nil {
 		rt.functions = make(map[string]*FunctionValue)
 	}
+	if fn.Name == "" {
+		fn.Name = name
+	}
 	rt.functions[name] = fn
 }
 
+// functionFormRe matches the editor's form of a function,
+// function name(params): T { body }, which SaveFunction accepts.
+var functionFormRe = regexp.MustCompile(`(?s)^function\s+(\w+)\s*\(([^)]*)\)\s*(:\s*\w+\s*)?\{(.*)\}$`)
+
 // SaveFunction saves a user-defined function to the runtime
 func (rt *Runtime) SaveFunction(name string, code string, formatted_source string) error {
-	// 1. Transform pretty-printed format if needed
-	re := regexp.MustCompile(`(?s)^function\s+(\w+)\s*\(([^)]*)\)\s*\{(.*)\}$`)
-	if matches := re.FindStringSubmatch(code); len(matches) == 4 {
-		// matches[1] = function name, matches[2] = params, matches[3] = body
+	// 1. Transform pretty-printed format if needed, keeping the doc comment
+	doc, code := splitDocComment(code)
+	if matches := functionFormRe.FindStringSubmatch(code); len(matches) == 5 {
+		// matches[1] = function name, matches[2] = params, matches[3] = result type, matches[4] = body
 		// Use the supplied name (not matches[1]) for overwrite safety
 		params := matches[2]
-		body := matches[3]
-		code = fmt.Sprintf("setq(%s, func(%s) {%s})", name, params, body)
+		result := strings.TrimSpace(matches[3])
+		body := matches[4]
+		code = fmt.Sprintf("setq(%s, func(%s)%s {%s})", name, params, result, body)
 	}
 
 	// 2. Parse the code
@@ -352,7 +462,11 @@ func (rt *Runtime) SaveFunction(name string, code string, formatted_source strin
 		if setqCall, ok := block.Stmts[0].(*FuncCall); ok && setqCall.Name == "setq" && len(setqCall.Args) == 2 {
 			if fnDef, ok := setqCall.Args[1].(*FunctionDefNode); ok {
 				fn := &FunctionValue{
+					Name:            name,
 					Parameters:      fnDef.Parameters,
+					ParamTypes:      fnDef.ParamTypes,
+					ReturnType:      fnDef.ReturnType,
+					Doc:             doc,
 					Body:            fnDef.Body,
 					SourceCode:      code,
 					FormattedSource: formatted_source,
@@ -365,7 +479,11 @@ func (rt *Runtime) SaveFunction(name string, code string, formatted_source strin
 		// Fallback: direct FunctionDefNode as statement
 		if fnDef, ok := block.Stmts[0].(*FunctionDefNode); ok {
 			fn := &FunctionValue{
+				Name:            name,
 				Parameters:      fnDef.Parameters,
+				ParamTypes:      fnDef.ParamTypes,
+				ReturnType:      fnDef.ReturnType,
+				Doc:             doc,
 				Body:            fnDef.Body,
 				SourceCode:      code,
 				FormattedSource: formatted_source,
@@ -378,7 +496,11 @@ func (rt *Runtime) SaveFunction(name string, code string, formatted_source strin
 	// If the AST is directly a FunctionDefNode
 	if fnDef, ok := ast.(*FunctionDefNode); ok {
 		fn := &FunctionValue{
+			Name:            name,
 			Parameters:      fnDef.Parameters,
+			ParamTypes:      fnDef.ParamTypes,
+			ReturnType:      fnDef.ReturnType,
+			Doc:             doc,
 			Body:            fnDef.Body,
 			SourceCode:      code,
 			FormattedSource: formatted_source,
@@ -407,7 +529,7 @@ func (rt *Runtime) ExecProgram(src string) (Value, error) {
 
 // ExecProgramWithFilename parses and executes source code with a specific filename for debugging
 func (rt *Runtime) ExecProgramWithFilename(src string, filename string) (Value, error) {
-	ast, err := NewParserWithFilename(src, filename).parseProgram()
+	ast, err := ParseSource(src, filename)
 	if err != nil {
 		return nil, err
 	}
@@ -417,7 +539,26 @@ func (rt *Runtime) ExecProgramWithFilename(src string, filename string) (Value,
 	rt.ResetCurrentScope()
 
 	// Execute with a proper scope
-	return ast.Exec(rt)
+	val, err := ast.Exec(rt)
+	return val, rt.withStackTrace(err)
+}
+
+// Evaluate parses and executes an expression in the current scope. Unlike
+// ExecProgram it does not reset the scope, so it sees the variables the last
+// program left behind.
+func (rt *Runtime) Evaluate(src string) (Value, error) {
+	return rt.EvaluateWithFilename(src, "watch")
+}
+
+// EvaluateWithFilename is Evaluate with the filename used in error positions
+// and stack traces.
+func (rt *Runtime) EvaluateWithFilename(src, filename string) (Value, error) {
+	ast, err := ParseSource(src, filename)
+	if err != nil {
+		return nil, err
+	}
+	val, err := ast.Exec(rt)
+	return val, rt.withStackTrace(err)
 }
 
 // ParseProgram parses source code, returning the AST.
@@ -867,6 +1008,20 @@ func (rt *Runtime) RunProgram(entry string, port int) error {
 	return err
 }
 
+// RunProgramWith runs entry like RunProgram, passing args to a function
+// entry and binding vars while a code entry runs.
+func (rt *Runtime) RunProgramWith(entry string, args []Value, vars map[string]Value) error {
+	if entry == "" {
+		return nil
+	}
+	if fn, ok := rt.functions[entry]; ok {
+		_, err := executeFunctionValue(rt, fn, args)
+		return err
+	}
+	_, err := rt.ExecuteWithVariables(entry, vars)
+	return err
+}
+
 // SetDefaultDocPath changes the default path for document operations
 func (rt *Runtime) SetDefaultDocPath(path string) {
 	rt.defaultDocPath = path
@@ -938,6 +1093,9 @@ func (rt *Runtime) CloneRuntime() *Runtime {
 		defaultDocPath:    rt.defaultDocPath,
 		timeOffset:        rt.timeOffset,
 		Parser:            NewParser(""),
+		snapshotDir:       rt.snapshotDir,
+		sandbox:           rt.sandbox,
+		env:               rt.env,
 	}
 
 	// Clone script errors
@@ -952,15 +1110,16 @@ func (rt *Runtime) CloneRuntime() *Runtime {
 		}
 	}
 
-	// Clone scope chain
+	// Clone scope chain, copying the entries as they are: Set would wrap
+	// each entry in another one and drop its type
 	clone.globalScope = NewScope(nil)
 	for k, v := range rt.globalScope.vars {
-		clone.globalScope.Set(k, v)
+		clone.globalScope.vars[k] = v
 	}
 
 	clone.currentScope = NewScope(clone.globalScope)
 	for k, v := range rt.currentScope.vars {
-		clone.currentScope.Set(k, v)
+		clone.currentScope.vars[k] = v
 	}
 
 	// Copy functions
@@ -1036,8 +1195,12 @@ func cloneFunctionValueWithScope(src *FunctionValue, newScope *Scope) *FunctionV
 		return nil
 	}
 	return &FunctionValue{
+		Name:            src.Name,
 		Body:            src.Body,
 		Parameters:      append([]string(nil), src.Parameters...),
+		ParamTypes:      src.ParamTypes,
+		ReturnType:      src.ReturnType,
+		Doc:             src.Doc,
 		SourceCode:      src.SourceCode,
 		FormattedSource: src.FormattedSource,
 		IsParsed:        src.IsParsed,
@@ -1134,6 +1297,77 @@ func ListRuntimes() []string {
 }
 
 func executeFunctionValue(rt *Runtime, fn *FunctionValue, args []Value) (Value, error) {
+	if err := rt.pushCallFrame(fn); err != nil {
+		return nil, err
+	}
+	rt.noteFunctionCall(fn)
+	depth := len(rt.callStack)
+	defer func() {
+		rt.callStack = rt.callStack[:depth-1]
+		if len(rt.mocks) > 0 {
+			rt.dropMocks(depth)
+		}
+	}()
+
+	// Save current scope and restore after execution (KEEP THIS)
+	prevScope := rt.currentScope
+	defer func() { rt.currentScope = prevScope }()
+
+	// Calls in tail position come back as a tailCall and are run by this loop
+	// in the same Go frame, so tail recursion runs in constant stack space.
+	// A function that made a tail call still owes its declared result type,
+	// so the result is checked against every such function.
+	callerScope := prevScope
+	var typed []*FunctionValue
+	checkResult := func(result Value) error {
+		if err := rt.checkResultType(fn, result); err != nil {
+			return err
+		}
+		for i := len(typed) - 1; i >= 0; i-- {
+			if err := rt.checkResultType(typed[i], result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for {
+		result, tail, err := invokeFunctionBody(rt, fn, args, callerScope)
+		if err != nil {
+			// Handle return statements
+			if retErr, ok := err.(*ReturnError); ok {
+				// Return is successful - extract the value
+				return retErr.Value, checkResult(retErr.Value)
+			}
+			return result, rt.withStackTrace(err)
+		}
+		if tail == nil {
+			return result, checkResult(result)
+		}
+		if fn.ReturnType != "" && !containsFunction(typed, fn) {
+			typed = append(typed, fn)
+		}
+		// A callee without a closure sees the variables of its caller, as it
+		// would had the call not been in tail position
+		callerScope = tail.scope
+		fn, args = tail.fn, tail.args
+		rt.callSite = tail.pos
+		rt.replaceCallFrame(fn)
+		rt.noteFunctionCall(fn)
+	}
+}
+
+func containsFunction(fns []*FunctionValue, fn *FunctionValue) bool {
+	for _, f := range fns {
+		if f == fn {
+			return true
+		}
+	}
+	return false
+}
+
+// invokeFunctionBody binds args in a fresh scope and runs fn's body. The last
+// statement is evaluated in tail position (see execTail).
+func invokeFunctionBody(rt *Runtime, fn *FunctionValue, args []Value, callerScope *Scope) (Value, *tailCall, error) {
 	// Create new scope with proper parent
 	var parentScope *Scope
 	if fn.Scope != nil {
@@ -1141,7 +1375,7 @@ func executeFunctionValue(rt *Runtime, fn *FunctionValue, args []Value) (Value,
 		parentScope = fn.Scope
 	} else {
 		// Use current scope for deserialized functions
-		parentScope = rt.currentScope
+		parentScope = callerScope
 	}
 
 	fnScope := NewScope(parentScope)
@@ -1154,40 +1388,25 @@ func executeFunctionValue(rt *Runtime, fn *FunctionValue, args []Value) (Value,
 			fnScope.Set(param, DBNull) // Default value for missing args
 		}
 	}
-
-	// Save current scope and restore after execution (KEEP THIS)
-	prevScope := rt.currentScope
+	if fn.ParamTypes != nil {
+		if err := checkArgTypes(fn, args); err != nil {
+			return nil, nil, err
+		}
+	}
 	rt.currentScope = fnScope
 
-	var result Value
-	var err error
-
 	// Extract statements from Body if it's a Block
 	if block, ok := fn.Body.(*Block); ok {
-		// Execute statements from the Block
-		var last Value
-		for _, stmt := range block.Stmts {
-			last, err = stmt.Exec(rt)
-			if err != nil {
-				break
-			}
+		if len(block.Stmts) == 0 {
+			return nil, nil, nil
 		}
-		result = last
-	} else {
-		// Single statement
-		result, err = fn.Body.Exec(rt)
-	}
-
-	// Restore scope (KEEP THIS)
-	rt.currentScope = prevScope
-
-	// Handle return statements
-	if err != nil {
-		if retErr, ok := err.(*ReturnError); ok {
-			// Return is successful - extract the value
-			return retErr.Value, nil
+		for _, stmt := range block.Stmts[:len(block.Stmts)-1] {
+			if _, err := stmt.Exec(rt); err != nil {
+				return nil, nil, err
+			}
 		}
+		return rt.execTail(block.Stmts[len(block.Stmts)-1])
 	}
-
-	return result, err
+	// Single statement
+	return rt.execTail(fn.Body)
 }
@@ -0,0 +1,186 @@
+package chariot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// SandboxProfile limits what scripts on a runtime may do outside the server.
+// A nil policy denies the capability.
+type SandboxProfile struct {
+	Name  string        `json:"-"`
+	Email *NotifyPolicy `json:"email,omitempty"` // sendEmail
+	Slack *NotifyPolicy `json:"slack,omitempty"` // slackPost
+}
+
+// NotifyPolicy restricts the recipients of a notification builtin.
+type NotifyPolicy struct {
+	// Allow lists recipient patterns ("*@example.com", "#ops-*"), matched
+	// case-insensitively with path.Match; empty allows any recipient.
+	Allow []string `json:"allow,omitempty"`
+}
+
+// permits reports whether the policy allows sending to recipient.
+func (p *NotifyPolicy) permits(recipient string) bool {
+	if p == nil {
+		return false
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	recipient = strings.ToLower(recipient)
+	for _, pattern := range p.Allow {
+		if ok, _ := path.Match(strings.ToLower(pattern), recipient); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sandboxProfilesFile is the JSON document LoadSandboxProfiles reads.
+type sandboxProfilesFile struct {
+	Default  string                     `json:"default"`  // profile of users not listed in Users
+	Users    map[string]string          `json:"users"`    // user ID -> profile name
+	Profiles map[string]*SandboxProfile `json:"profiles"` // by name
+}
+
+// builtinSandboxProfile applies when no profiles are configured. It allows
+// every notification; sendEmail and slackPost still need SMTP and Slack to be
+// configured on the server.
+var builtinSandboxProfile = &SandboxProfile{Name: "default", Email: &NotifyPolicy{}, Slack: &NotifyPolicy{}}
+
+var (
+	sandboxMu       sync.RWMutex
+	sandboxProfiles *sandboxProfilesFile
+)
+
+// LoadSandboxProfiles reads the sandbox profiles file at path. A missing file
+// leaves the built-in profile, which allows all notifications, in effect. A
+// file that cannot be used is reported and replaced by a profile that denies
+// everything, so a broken file never widens what scripts may do.
+func LoadSandboxProfiles(path string) error {
+	file, err := readSandboxProfiles(path)
+	if err != nil {
+		file = &sandboxProfilesFile{Default: "deny", Profiles: map[string]*SandboxProfile{"deny": {Name: "deny"}}}
+	}
+	sandboxMu.Lock()
+	sandboxProfiles = file
+	sandboxMu.Unlock()
+	return err
+}
+
+func readSandboxProfiles(path string) (*sandboxProfilesFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var file sandboxProfilesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, p := range file.Profiles {
+		if p == nil {
+			p = &SandboxProfile{}
+			file.Profiles[name] = p
+		}
+		p.Name = name
+	}
+	if _, ok := file.Profiles[file.Default]; !ok {
+		return nil, fmt.Errorf("%s: default profile %q is not defined", path, file.Default)
+	}
+	for user, name := range file.Users {
+		if _, ok := file.Profiles[name]; !ok {
+			return nil, fmt.Errorf("%s: user %s has undefined profile %q", path, user, name)
+		}
+	}
+	return &file, nil
+}
+
+// SandboxProfileFor returns the profile of a user; an empty user ID gets the
+// default profile.
+func SandboxProfileFor(userID string) *SandboxProfile {
+	sandboxMu.RLock()
+	defer sandboxMu.RUnlock()
+	if sandboxProfiles == nil {
+		return builtinSandboxProfile
+	}
+	if name, ok := sandboxProfiles.Users[userID]; ok && userID != "" {
+		return sandboxProfiles.Profiles[name]
+	}
+	return sandboxProfiles.Profiles[sandboxProfiles.Default]
+}
+
+// SetSandboxProfile sets the profile scripts on rt run under.
+func (rt *Runtime) SetSandboxProfile(p *SandboxProfile) {
+	rt.sandbox = p
+}
+
+// SandboxProfile returns the runtime's profile, by default the profile for
+// users not listed in the profiles file.
+func (rt *Runtime) SandboxProfile() *SandboxProfile {
+	if rt.sandbox != nil {
+		return rt.sandbox
+	}
+	return SandboxProfileFor("")
+}
+
+// SandboxViolation is a call a sandbox profile denies, found without running
+// the program.
+type SandboxViolation struct {
+	Pos     SourcePos `json:"pos"`
+	Message string    `json:"message"`
+}
+
+// CheckSandbox reports the calls of program that profile p denies: calls of
+// sendEmail and slackPost when it denies the capability, and literal
+// recipients its policy does not allow. Recipients computed while the program
+// runs are checked when the call is made.
+func CheckSandbox(program *Block, p *SandboxProfile) []SandboxViolation {
+	var violations []SandboxViolation
+	walkNodes(program, func(n Node) {
+		call, ok := n.(*FuncCall)
+		if !ok {
+			return
+		}
+		var policy *NotifyPolicy
+		switch call.Name {
+		case "sendEmail":
+			policy = p.Email
+		case "slackPost":
+			policy = p.Slack
+		default:
+			return
+		}
+		if policy == nil {
+			violations = append(violations, SandboxViolation{Pos: call.Pos, Message: fmt.Sprintf("%s is not allowed by sandbox profile %q", call.Name, p.Name)})
+			return
+		}
+		if len(call.Args) == 0 {
+			return
+		}
+		lit, ok := call.Args[0].(*Literal)
+		if !ok {
+			return
+		}
+		var recipients []string
+		if call.Name == "sendEmail" {
+			to, _ := emailAddresses(lit.Val)
+			recipients = emailMessage{To: to}.recipients()
+		} else if s, ok := lit.Val.(Str); ok {
+			recipients = []string{string(s)}
+		}
+		for _, r := range recipients {
+			if !policy.permits(r) {
+				violations = append(violations, SandboxViolation{Pos: call.Pos, Message: fmt.Sprintf("%s: recipient %s is not allowed by sandbox profile %q", call.Name, r, p.Name)})
+			}
+		}
+	})
+	return violations
+}
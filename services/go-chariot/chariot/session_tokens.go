@@ -0,0 +1,174 @@
+package chariot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/statestore"
+	"go.uber.org/zap"
+)
+
+// With an access token lifetime set, clients never see the token a session
+// is kept under. Login hands out a short-lived access token standing for the
+// session and a refresh token; the refresh token buys a new pair, and is
+// good once. Access tokens stay valid until they expire, so requests in
+// flight during a refresh still succeed. Both kinds are kept in the state
+// store under their SessionRef, so any replica honors them.
+
+// ErrAccessTokenExpired is returned for a request made with an access token
+// past its lifetime; the client should refresh it.
+var ErrAccessTokenExpired = errors.New("access token expired")
+
+// ErrRefreshTokenInvalid is returned for an unknown, used or expired refresh
+// token; the client has to log in again.
+var ErrRefreshTokenInvalid = errors.New("invalid or expired refresh token")
+
+// TokenGrant is the token pair handed to a client at login and on refresh.
+type TokenGrant struct {
+	AccessToken  string
+	RefreshToken string // "" when access tokens are disabled
+	ExpiresAt    time.Time
+}
+
+// tokenGrant is what an access or refresh token stands for.
+type tokenGrant struct {
+	Session   string    `json:"session"` // token the session is kept under
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func accessKey(token string) string  { return "access:" + SessionRef(token) }
+func refreshKey(token string) string { return "refresh:" + SessionRef(token) }
+
+// newToken returns a random token for a grant.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// SetAccessTokenTTL sets the lifetime of access tokens. Zero disables them:
+// clients then use the session token itself, valid while the session is.
+// Refresh tokens last for the session timeout, so the lifetime must be
+// shorter than that.
+func (sm *SessionManager) SetAccessTokenTTL(ttl time.Duration) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if ttl < 0 || (ttl > 0 && ttl >= sm.defaultTimeout) {
+		return fmt.Errorf("access token lifetime %s must be shorter than the session timeout %s", ttl, sm.defaultTimeout)
+	}
+	sm.accessTTL = ttl
+	return nil
+}
+
+// AccessTokenTTL returns the lifetime of access tokens; zero when disabled.
+func (sm *SessionManager) AccessTokenTTL() time.Duration {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.accessTTL
+}
+
+// IssueTokens returns the tokens a client uses for session.
+func (sm *SessionManager) IssueTokens(session *Session) (TokenGrant, error) {
+	ttl := sm.AccessTokenTTL()
+	if ttl == 0 {
+		session.mu.RLock()
+		defer session.mu.RUnlock()
+		return TokenGrant{AccessToken: session.ID, ExpiresAt: session.ExpiresAt}, nil
+	}
+	access, err := newToken()
+	if err != nil {
+		return TokenGrant{}, err
+	}
+	refresh, err := newToken()
+	if err != nil {
+		return TokenGrant{}, err
+	}
+	now := time.Now()
+	grant := TokenGrant{AccessToken: access, RefreshToken: refresh, ExpiresAt: now.Add(ttl)}
+	if err := sm.putGrant(accessKey(access), tokenGrant{Session: session.ID, ExpiresAt: grant.ExpiresAt}); err != nil {
+		return TokenGrant{}, err
+	}
+	if err := sm.putGrant(refreshKey(refresh), tokenGrant{Session: session.ID, ExpiresAt: now.Add(sm.defaultTimeout)}); err != nil {
+		return TokenGrant{}, err
+	}
+	return grant, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new token pair of the same
+// session, which counts as activity on it. The refresh token is used up.
+func (sm *SessionManager) RefreshTokens(refresh string) (*Session, TokenGrant, error) {
+	if sm.AccessTokenTTL() == 0 || refresh == "" {
+		return nil, TokenGrant{}, ErrRefreshTokenInvalid
+	}
+	grant, err := sm.loadGrant(refreshKey(refresh))
+	if err != nil {
+		if !errors.Is(err, statestore.ErrNotFound) {
+			cfg.ChariotLogger.Warn("Failed to load refresh token", zap.Error(err))
+		}
+		return nil, TokenGrant{}, ErrRefreshTokenInvalid
+	}
+	if time.Now().After(grant.ExpiresAt) {
+		return nil, TokenGrant{}, ErrRefreshTokenInvalid
+	}
+	// Delete before issuing, so a token raced by two clients is spent once
+	if err := sm.Store().Delete(refreshKey(refresh)); err != nil && !errors.Is(err, statestore.ErrNotFound) {
+		return nil, TokenGrant{}, err
+	}
+	session, err := sm.GetSession(grant.Session)
+	if err != nil {
+		return nil, TokenGrant{}, ErrRefreshTokenInvalid
+	}
+	tokens, err := sm.IssueTokens(session)
+	if err != nil {
+		return nil, TokenGrant{}, err
+	}
+	return session, tokens, nil
+}
+
+// resolveToken returns the session token an access token stands for, or
+// token itself when it is not an access token. An expired access token
+// fails with ErrAccessTokenExpired unless allowExpired is set.
+func (sm *SessionManager) resolveToken(token string, allowExpired bool) (string, error) {
+	if token == "" || sm.AccessTokenTTL() == 0 {
+		return token, nil
+	}
+	grant, err := sm.loadGrant(accessKey(token))
+	switch {
+	case errors.Is(err, statestore.ErrNotFound):
+		return token, nil
+	case err != nil:
+		return "", err
+	case !allowExpired && time.Now().After(grant.ExpiresAt):
+		return "", ErrAccessTokenExpired
+	}
+	return grant.Session, nil
+}
+
+func (sm *SessionManager) putGrant(key string, grant tokenGrant) error {
+	data, err := json.Marshal(grant)
+	if err != nil {
+		return err
+	}
+	// Expired access tokens are kept a while longer to tell them from
+	// unknown ones
+	return sm.Store().Put(key, data, time.Until(grant.ExpiresAt)+sm.defaultTimeout)
+}
+
+func (sm *SessionManager) loadGrant(key string) (*tokenGrant, error) {
+	data, err := sm.Store().Get(key)
+	if err != nil {
+		return nil, err
+	}
+	var grant tokenGrant
+	if err := json.Unmarshal(data, &grant); err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
@@ -1,13 +1,18 @@
 package chariot
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"sync"
 	"time"
 
 	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
 	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/statestore"
 	"go.uber.org/zap"
 )
 
@@ -19,6 +24,58 @@ type SessionManager struct {
 	cleanupInterval  time.Duration
 	stopCleanup      chan struct{}
 	bootstrapRuntime *Runtime // Shared bootstrap runtime for copying globals into new sessions
+	store            statestore.Store
+
+	// Runtimes left idle longer than runtimeIdleTimeout are reset or have
+	// their session ended, depending on runtimeIdlePolicy
+	runtimeIdleTimeout time.Duration
+	runtimeIdlePolicy  string
+
+	// Lifetime of the access tokens standing for sessions; zero when clients
+	// use session tokens directly
+	accessTTL time.Duration
+}
+
+// Runtime idle policies.
+const (
+	RuntimeIdleReset = "reset" // replace the runtime with a freshly bootstrapped one
+	RuntimeIdleEnd   = "end"   // end the session
+)
+
+// ErrRuntimeBusy is returned when a runtime is reset while a program runs on it.
+var ErrRuntimeBusy = errors.New("runtime is busy running a program")
+
+// sessionPersistInterval throttles how often an accessed session's expiry is
+// written back to the state store.
+const sessionPersistInterval = time.Minute
+
+// sessionRecord is the part of a session kept in the state store. Runtime
+// state (variables, objects, open connections) stays with the replica that
+// created it; a replica that sees the token for the first time restores the
+// session with a freshly bootstrapped runtime.
+type sessionRecord struct {
+	UserID     string    `json:"user_id"`
+	Username   string    `json:"username"`
+	Created    time.Time `json:"created"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// SessionRef identifies the session of token without revealing the token,
+// for admin tools that list and end other users' sessions.
+func SessionRef(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionKey hashes the token so it never appears as a document ID.
+func sessionKey(token string) string {
+	return sessionRefKey(SessionRef(token))
+}
+
+func sessionRefKey(ref string) string {
+	return "session:" + ref
 }
 
 // Session represents a user's interaction context
@@ -37,11 +94,23 @@ type Session struct {
 	Data          map[string]interface{} // Custom session data
 	mu            sync.RWMutex
 
+	// Client and activity, for the admin session views
+	RemoteAddr   string    // address of the latest request
+	UserAgent    string    // User-Agent of the latest request
+	LastScript   string    // filename of the latest execution
+	LastExecuted time.Time // start of the latest execution
+	Executions   int       // executions started on this replica
+
 	OnStart string // Chariot program name to run on session start
 	OnExit  string // Chariot program name to run on session exit
 
 	stopChan chan struct{} // Used to signal the session goroutine to stop
 
+	persistedAt time.Time // last time the record was written to the state store
+
+	manager     *SessionManager // creates replacement and ephemeral runtimes
+	running     int             // programs currently running on Runtime
+	runtimeUsed time.Time       // end of the last run on Runtime; zero if unused since created or reset
 }
 
 // NewSessionManager creates a session manager with the specified default timeout
@@ -51,6 +120,7 @@ func NewSessionManager(defaultTimeout, cleanupInterval time.Duration) *SessionMa
 		defaultTimeout:  defaultTimeout,
 		cleanupInterval: cleanupInterval,
 		stopCleanup:     make(chan struct{}),
+		store:           statestore.NewMemory(),
 	}
 
 	// Start background cleanup
@@ -86,6 +156,36 @@ func (sm *SessionManager) SetBootstrapRuntime(rt *Runtime) {
 	sm.bootstrapRuntime = rt
 }
 
+// SetRuntimeIdlePolicy makes the cleanup loop act on session runtimes no
+// program has run on for longer than timeout: policy RuntimeIdleReset
+// replaces the runtime, RuntimeIdleEnd ends the session. A zero timeout
+// disables the policy.
+func (sm *SessionManager) SetRuntimeIdlePolicy(timeout time.Duration, policy string) error {
+	if policy != RuntimeIdleReset && policy != RuntimeIdleEnd {
+		return fmt.Errorf("unknown runtime idle policy %q", policy)
+	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.runtimeIdleTimeout = timeout
+	sm.runtimeIdlePolicy = policy
+	return nil
+}
+
+// SetStore sets the state store sessions are shared through. Call it before
+// any session is created.
+func (sm *SessionManager) SetStore(store statestore.Store) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.store = store
+}
+
+// Store returns the state store sessions are shared through.
+func (sm *SessionManager) Store() statestore.Store {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.store
+}
+
 // NewSession creates a new session for a user
 func (sm *SessionManager) NewSession(userID string, logger logs.Logger, token string, customTimeout ...time.Duration) *Session {
 	timeout := sm.defaultTimeout
@@ -93,51 +193,75 @@ func (sm *SessionManager) NewSession(userID string, logger logs.Logger, token st
 		timeout = customTimeout[0]
 	}
 
+	session := sm.buildSession(userID, logger, token, timeout)
+
+	// Store the session
+	sm.mu.Lock()
+	sm.sessions[token] = session
+	sm.mu.Unlock()
+	sm.persist(session)
+
+	return session
+}
+
+// buildSession creates a session with a bootstrapped runtime without
+// registering it.
+func (sm *SessionManager) buildSession(userID string, logger logs.Logger, token string, timeout time.Duration) *Session {
 	now := time.Now()
 	session := &Session{
 		ID:           token,
 		Logger:       logger,
 		UserID:       userID,
 		Username:     userID,
-		Runtime:      NewRuntime(),
 		Resources:    make(map[string]interface{}),
 		Created:      now,
 		LastAccessed: now,
 		ExpiresAt:    now.Add(timeout),
 		Data:         make(map[string]interface{}),
 		stopChan:     make(chan struct{}),
+		manager:      sm,
 	}
+	session.Runtime = sm.newSessionRuntime(userID, logger)
+	return session
+}
+
+// newSessionRuntime creates a runtime with the standard builtins, the
+// resources of the bootstrap runtime and the bootstrap script applied.
+func (sm *SessionManager) newSessionRuntime(userID string, logger logs.Logger) *Runtime {
+	rt := NewRuntime()
+	rt.SetSnapshotDir(UserSnapshotDir(userID))
+	rt.SetSandboxProfile(SandboxProfileFor(userID))
 
 	// Register standard builtins
-	RegisterAll(session.Runtime)
+	RegisterAll(rt)
 
 	// Copy bootstrap resources from shared bootstrap runtime if available
 	if sm.bootstrapRuntime != nil {
 		// Copy global variables
 		bootstrapGlobals := sm.bootstrapRuntime.ListGlobalVariables()
 		for name, value := range bootstrapGlobals {
-			session.Runtime.GlobalScope().Set(name, value)
+			rt.GlobalScope().Set(name, value)
 		}
 
 		// Copy host objects (SQL connections, Couchbase nodes, etc.)
 		bootstrapObjects := sm.bootstrapRuntime.ListObjects()
 		for name, obj := range bootstrapObjects {
-			session.Runtime.objects[name] = obj
+			rt.objects[name] = obj
 		}
 
 		// Copy named lists
 		bootstrapLists := sm.bootstrapRuntime.ListLists()
 		for name, list := range bootstrapLists {
-			session.Runtime.lists[name] = list
+			rt.lists[name] = list
 		}
 
 		// Copy named tree nodes
 		bootstrapNodes := sm.bootstrapRuntime.ListNodes()
 		for name, node := range bootstrapNodes {
-			session.Runtime.nodes[name] = node
+			rt.nodes[name] = node
 		}
 
-		session.Logger.Info("Copied bootstrap resources into session",
+		logger.Info("Copied bootstrap resources into session",
 			zap.Int("globals", len(bootstrapGlobals)),
 			zap.Int("objects", len(bootstrapObjects)),
 			zap.Int("lists", len(bootstrapLists)),
@@ -148,29 +272,92 @@ func (sm *SessionManager) NewSession(userID string, logger logs.Logger, token st
 	if cfg.ChariotConfig.Bootstrap != "" {
 		fullPath, err := getSecureFilePath(cfg.ChariotConfig.Bootstrap, "data")
 		if err != nil {
-			session.Logger.Error("Failed to get secure file path", zap.String("bootstrap", cfg.ChariotConfig.Bootstrap), zap.Error(err))
+			logger.Error("Failed to get secure file path", zap.String("bootstrap", cfg.ChariotConfig.Bootstrap), zap.Error(err))
 		} else {
-			session.Logger.Info("Loading bootstrap script (session)", zap.String("path", fullPath))
+			logger.Info("Loading bootstrap script (session)", zap.String("path", fullPath))
 			content, err := os.ReadFile(fullPath)
 			if err != nil {
-				session.Logger.Error("Failed to read bootstrap script", zap.String("path", fullPath), zap.Error(err))
+				logger.Error("Failed to read bootstrap script", zap.String("path", fullPath), zap.Error(err))
 			} else {
-				if _, err := session.Runtime.ExecProgram(string(content)); err != nil {
-					session.Logger.Error("Failed to execute bootstrap script (session)", zap.String("path", fullPath), zap.Error(err))
+				if _, err := rt.ExecProgram(string(content)); err != nil {
+					logger.Error("Failed to execute bootstrap script (session)", zap.String("path", fullPath), zap.Error(err))
 				} else {
-					session.Logger.Info("Bootstrap script executed (session)", zap.String("path", fullPath))
+					logger.Info("Bootstrap script executed (session)", zap.String("path", fullPath))
 				}
 			}
 		}
 	} else {
-		session.Logger.Warn("Bootstrap filename not configured; skipping session bootstrap")
+		logger.Warn("Bootstrap filename not configured; skipping session bootstrap")
 	}
 
-	// Store the session
+	return rt
+}
+
+// persist writes the session record to the state store.
+func (sm *SessionManager) persist(s *Session) {
+	s.mu.Lock()
+	rec := sessionRecord{
+		UserID:     s.UserID,
+		Username:   s.Username,
+		Created:    s.Created,
+		ExpiresAt:  s.ExpiresAt,
+		RemoteAddr: s.RemoteAddr,
+		UserAgent:  s.UserAgent,
+	}
+	s.persistedAt = time.Now()
+	s.mu.Unlock()
+
+	data, err := json.Marshal(rec)
+	if err == nil {
+		err = sm.Store().Put(sessionKey(s.ID), data, time.Until(rec.ExpiresAt))
+	}
+	if err != nil {
+		cfg.ChariotLogger.Warn("Failed to persist session", zap.String("user", rec.UserID), zap.Error(err))
+	}
+}
+
+// loadRecord reads a session record from the state store.
+func (sm *SessionManager) loadRecord(token string) (*sessionRecord, error) {
+	data, err := sm.Store().Get(sessionKey(token))
+	if err != nil {
+		return nil, err
+	}
+	var rec sessionRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	if time.Now().After(rec.ExpiresAt) {
+		return nil, statestore.ErrNotFound
+	}
+	return &rec, nil
+}
+
+// restoreSession recreates a session another replica created, or returns nil
+// when the store has no live record for the token.
+func (sm *SessionManager) restoreSession(token string) *Session {
+	rec, err := sm.loadRecord(token)
+	if err != nil {
+		if !errors.Is(err, statestore.ErrNotFound) {
+			cfg.ChariotLogger.Warn("Failed to load session from state store", zap.Error(err))
+		}
+		return nil
+	}
+	session := sm.buildSession(rec.UserID, cfg.ChariotLogger, token, time.Until(rec.ExpiresAt))
+	session.Username = rec.Username
+	session.Created = rec.Created
+	session.RemoteAddr = rec.RemoteAddr
+	session.UserAgent = rec.UserAgent
+	session.Authenticated = true // records are only written for logged-in sessions
+	session.persistedAt = time.Now()
+
 	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if existing, ok := sm.sessions[token]; ok {
+		// Restored concurrently by another request
+		return existing
+	}
 	sm.sessions[token] = session
-	sm.mu.Unlock()
-
+	cfg.ChariotLogger.Info("Restored session from state store", zap.String("user", rec.UserID))
 	return session
 }
 
@@ -192,12 +379,24 @@ func (s *Session) Run() {
 
 // GetSession retrieves a session by token and updates its last accessed time
 func (sm *SessionManager) GetSession(token string) (*Session, error) {
+	token, err := sm.resolveToken(token, false)
+	if err != nil {
+		return nil, err
+	}
 	sm.mu.RLock()
 	session, exists := sm.sessions[token]
 	sm.mu.RUnlock()
 
 	if !exists {
-		return nil, errors.New("session not found")
+		if session = sm.restoreSession(token); session == nil {
+			return nil, errors.New("session not found")
+		}
+	} else if sm.Store().Shared() {
+		// The session may have been ended on another replica
+		if _, err := sm.loadRecord(token); errors.Is(err, statestore.ErrNotFound) {
+			sm.evictSession(token)
+			return nil, errors.New("session not found")
+		}
 	}
 
 	// Update last accessed time and extend expiration
@@ -205,7 +404,11 @@ func (sm *SessionManager) GetSession(token string) (*Session, error) {
 	session.mu.Lock()
 	session.LastAccessed = now
 	session.ExpiresAt = now.Add(sm.defaultTimeout)
+	stale := now.Sub(session.persistedAt) >= sessionPersistInterval
 	session.mu.Unlock()
+	if stale {
+		sm.persist(session)
+	}
 
 	// CRITICAL: Ensure session has bootstrap resources (for sessions created before v0.053)
 	// Check if session runtime has objects - if empty and bootstrap has objects, copy them
@@ -252,14 +455,31 @@ func (sm *SessionManager) GetSession(token string) (*Session, error) {
 
 // EndSession explicitly terminates a session
 func (sm *SessionManager) EndSession(token string) error {
+	// Logging out with an expired access token still ends its session
+	token, err := sm.resolveToken(token, true)
+	if err != nil {
+		return err
+	}
 	cfg.ChariotLogger.Info("Ending session", zap.String("token", token))
+	if err := sm.Store().Delete(sessionKey(token)); err != nil {
+		cfg.ChariotLogger.Warn("EndSession: failed to remove session from state store", zap.Error(err))
+	}
+	if !sm.evictSession(token) {
+		cfg.ChariotLogger.Warn("EndSession: session not found", zap.String("token", token))
+		return errors.New("session not found")
+	}
+	return nil
+}
+
+// evictSession releases this replica's copy of a session, leaving the state
+// store untouched. It reports whether the session was present.
+func (sm *SessionManager) evictSession(token string) bool {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	session, exists := sm.sessions[token]
 	if !exists {
-		cfg.ChariotLogger.Warn("EndSession: session not found", zap.String("token", token))
-		return errors.New("session not found")
+		return false
 	}
 
 	// Signal the session goroutine to stop
@@ -274,7 +494,64 @@ func (sm *SessionManager) EndSession(token string) error {
 	delete(sm.sessions, token)
 	cfg.ChariotLogger.Info("Session removed", zap.String("token", token))
 
-	return nil
+	return true
+}
+
+// EndSessionByRef ends the session with the given SessionRef. A session this
+// replica does not hold is still ended when its record is in a shared state
+// store; the replica holding it drops it on its next request.
+func (sm *SessionManager) EndSessionByRef(ref string) error {
+	if len(ref) != sha256.Size*2 {
+		return errors.New("session not found")
+	}
+	if _, err := hex.DecodeString(ref); err != nil {
+		return errors.New("session not found")
+	}
+	sm.mu.RLock()
+	var token string
+	for t := range sm.sessions {
+		if SessionRef(t) == ref {
+			token = t
+			break
+		}
+	}
+	sm.mu.RUnlock()
+	if token != "" {
+		return sm.EndSession(token)
+	}
+
+	store := sm.Store()
+	if !store.Shared() {
+		return errors.New("session not found")
+	}
+	if _, err := store.Get(sessionRefKey(ref)); err != nil {
+		if errors.Is(err, statestore.ErrNotFound) {
+			return errors.New("session not found")
+		}
+		return err
+	}
+	return store.Delete(sessionRefKey(ref))
+}
+
+// EndUserSessions ends every session of userID this replica holds and
+// returns how many were ended.
+func (sm *SessionManager) EndUserSessions(userID string) int {
+	sm.mu.RLock()
+	var tokens []string
+	for token, session := range sm.sessions {
+		if session.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	sm.mu.RUnlock()
+
+	ended := 0
+	for _, token := range tokens {
+		if sm.EndSession(token) == nil {
+			ended++
+		}
+	}
+	return ended
 }
 
 // SetOnStart/SetOnExit helpers:
@@ -298,12 +575,56 @@ func (sm *SessionManager) CleanupExpiredSessions() {
 	}
 	sm.mu.RUnlock()
 
-	// Remove expired sessions
+	sm.applyRuntimeIdlePolicy(now)
+
+	// Remove expired sessions. With a shared store the session may still be in
+	// use through another replica, so only this replica's copy is released.
 	for _, token := range expiredTokens {
+		if sm.Store().Shared() {
+			if _, err := sm.loadRecord(token); err == nil {
+				sm.evictSession(token)
+				continue
+			}
+		}
 		_ = sm.EndSession(token)
 	}
 }
 
+// applyRuntimeIdlePolicy resets or ends the sessions whose runtime has been
+// idle longer than the configured timeout. A reset runtime counts as unused,
+// so it is not reset again until a program runs on it.
+func (sm *SessionManager) applyRuntimeIdlePolicy(now time.Time) {
+	sm.mu.RLock()
+	timeout, policy := sm.runtimeIdleTimeout, sm.runtimeIdlePolicy
+	var idle []*Session
+	if timeout > 0 {
+		for _, session := range sm.sessions {
+			session.mu.RLock()
+			last := session.runtimeUsed
+			if last.IsZero() && policy == RuntimeIdleEnd {
+				last = session.Created
+			}
+			if session.running == 0 && !last.IsZero() && now.Sub(last) > timeout {
+				idle = append(idle, session)
+			}
+			session.mu.RUnlock()
+		}
+	}
+	sm.mu.RUnlock()
+
+	for _, session := range idle {
+		if policy == RuntimeIdleEnd {
+			cfg.ChariotLogger.Info("Ending session with idle runtime", zap.String("user", session.UserID))
+			_ = sm.EndSession(session.ID)
+			continue
+		}
+		if err := session.ResetRuntime(); err != nil {
+			continue // a run started since the scan
+		}
+		cfg.ChariotLogger.Info("Reset idle session runtime", zap.String("user", session.UserID))
+	}
+}
+
 // GetActiveSessions returns the number of active sessions
 func (sm *SessionManager) GetActiveSessions() int {
 	sm.mu.RLock()
@@ -331,16 +652,23 @@ func (sm *SessionManager) GetActiveSessionsInfo() []map[string]interface{} {
 
 		// Build comprehensive info map to avoid Unknowns on UI
 		info := map[string]interface{}{
-			"id":          session.ID,
-			"session_id":  session.ID,
-			"user_id":     session.UserID,
-			"username":    username,
-			"created":     session.Created,
-			"last_seen":   session.LastAccessed,
-			"last_access": session.LastAccessed,
-			"expires_at":  session.ExpiresAt,
+			"id":            session.ID,
+			"session_id":    session.ID,
+			"ref":           SessionRef(session.ID),
+			"user_id":       session.UserID,
+			"username":      username,
+			"created":       session.Created,
+			"last_seen":     session.LastAccessed,
+			"last_access":   session.LastAccessed,
+			"expires_at":    session.ExpiresAt,
+			"remote_addr":   session.RemoteAddr,
+			"user_agent":    session.UserAgent,
+			"last_script":   session.LastScript,
+			"last_executed": session.LastExecuted,
+			"executions":    session.Executions,
+			"running":       session.running > 0,
 			"status": func() string {
-				if session.IsExpired() {
+				if time.Now().After(session.ExpiresAt) {
 					return "expired"
 				}
 				return "active"
@@ -357,9 +685,18 @@ func (sm *SessionManager) GetActiveSessionsInfo() []map[string]interface{} {
 // Returns the session pointer and a boolean indicating existence. This should be used
 // for one-time auth checks (e.g., WebSocket upgrade) where we don't want to extend TTL.
 func (sm *SessionManager) LookupSession(token string) (*Session, bool) {
+	token, err := sm.resolveToken(token, false)
+	if err != nil {
+		return nil, false
+	}
 	sm.mu.RLock()
-	defer sm.mu.RUnlock()
 	s, ok := sm.sessions[token]
+	sm.mu.RUnlock()
+	if !ok {
+		if s = sm.restoreSession(token); s != nil {
+			return s, true
+		}
+	}
 	return s, ok
 }
 
@@ -392,6 +729,73 @@ func (s *Session) Cleanup() {
 	s.Runtime = nil
 }
 
+// BeginRun records that a program started running on the session runtime
+// and returns that runtime, which is not reset until the matching EndRun.
+func (s *Session) BeginRun() *Runtime {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running++
+	return s.Runtime
+}
+
+// EndRun records that a program finished running on the session runtime.
+func (s *Session) EndRun() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running > 0 {
+		s.running--
+	}
+	s.runtimeUsed = time.Now()
+}
+
+// Running reports whether a program is running on the session runtime.
+func (s *Session) Running() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.running > 0
+}
+
+// RuntimeUsed returns when a program last finished on the session runtime,
+// or the zero time if none has since it was created or reset.
+func (s *Session) RuntimeUsed() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.runtimeUsed
+}
+
+// NewEphemeralRuntime returns a freshly bootstrapped runtime that is not
+// attached to the session. It shares the session runtime's debugger, so
+// breakpoints apply to programs run on it.
+func (s *Session) NewEphemeralRuntime() *Runtime {
+	sm := s.manager
+	if sm == nil {
+		sm = &SessionManager{}
+	}
+	rt := sm.newSessionRuntime(s.UserID, s.Logger)
+	s.mu.RLock()
+	if s.Runtime != nil {
+		rt.Debugger = s.Runtime.Debugger
+	}
+	s.mu.RUnlock()
+	return rt
+}
+
+// ResetRuntime replaces the session runtime with a freshly bootstrapped one,
+// discarding its variables, objects, lists, nodes, tables and functions. The
+// debugger and its breakpoints are kept. It fails with ErrRuntimeBusy while a
+// program runs on the runtime or a debug session is active.
+func (s *Session) ResetRuntime() error {
+	fresh := s.NewEphemeralRuntime()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running > 0 || (s.Runtime != nil && s.Runtime.Debugger != nil && s.Runtime.Debugger.IsExecutionActive()) {
+		return ErrRuntimeBusy
+	}
+	s.Runtime = fresh
+	s.runtimeUsed = time.Time{}
+	return nil
+}
+
 // AddResource adds a named resource to the session
 func (s *Session) AddResource(name string, resource interface{}) {
 	s.mu.Lock()
@@ -426,6 +830,28 @@ func (s *Session) GetData(key string) (interface{}, bool) {
 	return data, exists
 }
 
+// SetClient records the address and User-Agent a request came from. A
+// change is written to the state store with the next access.
+func (s *Session) SetClient(remoteAddr, userAgent string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.RemoteAddr == remoteAddr && s.UserAgent == userAgent {
+		return
+	}
+	s.RemoteAddr = remoteAddr
+	s.UserAgent = userAgent
+	s.persistedAt = time.Time{}
+}
+
+// RecordExecution notes that a script started executing in the session.
+func (s *Session) RecordExecution(filename string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.LastScript = filename
+	s.LastExecuted = time.Now()
+	s.Executions++
+}
+
 // IsExpired checks if the session has expired
 func (s *Session) IsExpired() bool {
 	s.mu.RLock()
@@ -0,0 +1,478 @@
+package chariot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+// RuntimeSnapshot is the saved variable and function state of a runtime.
+// Values are stored in their native form; host objects and other values that
+// cannot be serialized are left out and their names listed in Skipped.
+type RuntimeSnapshot struct {
+	Name       string                              `json:"name"`
+	Created    time.Time                           `json:"created"`
+	Globals    map[string]snapshotEntry            `json:"globals"`
+	Variables  map[string]snapshotEntry            `json:"variables"`
+	Functions  map[string]map[string]interface{}   `json:"functions"`
+	Lists      map[string]map[string]interface{}   `json:"lists,omitempty"`
+	Tables     map[string][]map[string]interface{} `json:"tables,omitempty"`
+	KeyColumns map[string]string                   `json:"key_columns,omitempty"`
+	Nodes      map[string]interface{}              `json:"nodes,omitempty"`
+	Skipped    []string                            `json:"skipped,omitempty"`
+}
+
+// snapshotEntry is a scope variable with its type constraint.
+type snapshotEntry struct {
+	Value    interface{} `json:"value"`
+	TypeCode string      `json:"type,omitempty"`
+}
+
+// SnapshotInfo describes a stored snapshot.
+type SnapshotInfo struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Size    int64     `json:"size"`
+}
+
+// ErrSnapshotNotFound is returned when no snapshot has the requested name.
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+var snapshotNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ValidateSnapshotName checks that name can be used as a snapshot file name.
+func ValidateSnapshotName(name string) error {
+	if !snapshotNamePattern.MatchString(name) || strings.Contains(name, "..") {
+		return fmt.Errorf("invalid snapshot name %q: use up to 64 letters, digits, '.', '-' or '_'", name)
+	}
+	return nil
+}
+
+// SetSnapshotDir sets the directory runtimeSnapshot and runtimeRestore use.
+func (rt *Runtime) SetSnapshotDir(dir string) {
+	rt.snapshotDir = dir
+}
+
+// SnapshotDir returns the runtime's snapshot directory, by default the
+// snapshots directory under the data path.
+func (rt *Runtime) SnapshotDir() string {
+	if rt.snapshotDir != "" {
+		return rt.snapshotDir
+	}
+	return filepath.Join(cfg.ChariotConfig.DataPath, "snapshots")
+}
+
+// Snapshot captures the runtime's variables, functions, lists, tables and
+// named nodes.
+func (rt *Runtime) Snapshot(name string) (*RuntimeSnapshot, error) {
+	if err := ValidateSnapshotName(name); err != nil {
+		return nil, err
+	}
+	snap := &RuntimeSnapshot{
+		Name:       name,
+		Created:    time.Now().UTC(),
+		Globals:    make(map[string]snapshotEntry),
+		Variables:  make(map[string]snapshotEntry),
+		Functions:  make(map[string]map[string]interface{}),
+		Lists:      make(map[string]map[string]interface{}),
+		Tables:     make(map[string][]map[string]interface{}),
+		KeyColumns: make(map[string]string),
+		Nodes:      make(map[string]interface{}),
+	}
+	skip := func(kind, name string) {
+		snap.Skipped = append(snap.Skipped, kind+"."+name)
+	}
+
+	for name, entry := range rt.globalScope.vars {
+		if contains(globalNameFilter, name) {
+			continue
+		}
+		if v, ok := snapshotValue(entry.Value); ok {
+			snap.Globals[name] = snapshotEntry{Value: v, TypeCode: entry.TypeCode}
+		} else {
+			skip("globals", name)
+		}
+	}
+	for name, entry := range rt.currentScope.vars {
+		if v, ok := snapshotValue(entry.Value); ok {
+			snap.Variables[name] = snapshotEntry{Value: v, TypeCode: entry.TypeCode}
+		} else {
+			skip("variables", name)
+		}
+	}
+	for name, fn := range rt.functions {
+		if fn == nil || fn.Body == nil {
+			skip("functions", name)
+			continue
+		}
+		snap.Functions[name] = FunctionValueToMap(fn)
+	}
+	for name, list := range rt.lists {
+		out := make(map[string]interface{}, len(list))
+		complete := true
+		for k, item := range list {
+			v, ok := snapshotValue(item)
+			if !ok {
+				complete = false
+				break
+			}
+			out[k] = v
+		}
+		if complete {
+			snap.Lists[name] = out
+		} else {
+			skip("lists", name)
+		}
+	}
+	for name, rows := range rt.tables {
+		out := make([]map[string]interface{}, 0, len(rows))
+		complete := true
+		for _, row := range rows {
+			r := make(map[string]interface{}, len(row))
+			for k, item := range row {
+				v, ok := snapshotValue(item)
+				if !ok {
+					complete = false
+					break
+				}
+				r[k] = v
+			}
+			if !complete {
+				break
+			}
+			out = append(out, r)
+		}
+		if complete {
+			snap.Tables[name] = out
+			if key, ok := rt.keyColumns[name]; ok {
+				snap.KeyColumns[name] = key
+			}
+		} else {
+			skip("tables", name)
+		}
+	}
+	for name, node := range rt.nodes {
+		if v, ok := snapshotValue(node); ok {
+			snap.Nodes[name] = v
+		} else {
+			skip("nodes", name)
+		}
+	}
+	sort.Strings(snap.Skipped)
+	return snap, nil
+}
+
+// RestoreSnapshot replaces the runtime's variables, functions, lists, tables
+// and named nodes with those of snap. Host objects and builtins are kept, as
+// are variables the snapshot had to skip.
+func (rt *Runtime) RestoreSnapshot(snap *RuntimeSnapshot) error {
+	if snap == nil {
+		return errors.New("no snapshot to restore")
+	}
+	skipped := make(map[string]bool, len(snap.Skipped))
+	for _, s := range snap.Skipped {
+		skipped[s] = true
+	}
+
+	functions := make(map[string]*FunctionValue, len(snap.Functions))
+	for name, fnMap := range snap.Functions {
+		fn, err := MapToFunctionValue(fnMap)
+		if err != nil {
+			return fmt.Errorf("function %s: %w", name, err)
+		}
+		fn.Name = name
+		fn.Scope = rt.globalScope
+		functions[name] = fn
+	}
+
+	restoreScope := func(scope *Scope, entries map[string]snapshotEntry, kind string, keep func(string) bool) {
+		for name := range scope.vars {
+			if !keep(name) && !skipped[kind+"."+name] {
+				delete(scope.vars, name)
+			}
+		}
+		for name, entry := range entries {
+			value := restoreSnapshotValue(entry.Value)
+			if fn, ok := value.(*FunctionValue); ok && fn.Scope == nil {
+				fn.Scope = rt.globalScope
+			}
+			typeCode := entry.TypeCode
+			if typeCode == "" {
+				typeCode = TypeVariableExpr
+			}
+			scope.SetWithType(name, value, typeCode)
+		}
+	}
+	restoreScope(rt.globalScope, snap.Globals, "globals", func(name string) bool {
+		return contains(globalNameFilter, name)
+	})
+	restoreScope(rt.currentScope, snap.Variables, "variables", func(string) bool { return false })
+
+	for name := range rt.functions {
+		if !skipped["functions."+name] {
+			delete(rt.functions, name)
+		}
+	}
+	for name, fn := range functions {
+		rt.functions[name] = fn
+	}
+
+	for name := range rt.lists {
+		if !skipped["lists."+name] {
+			delete(rt.lists, name)
+		}
+	}
+	for name, list := range snap.Lists {
+		out := make(map[string]Value, len(list))
+		for k, v := range list {
+			out[k] = restoreSnapshotValue(v)
+		}
+		rt.lists[name] = out
+	}
+
+	for name := range rt.tables {
+		if !skipped["tables."+name] {
+			delete(rt.tables, name)
+			delete(rt.keyColumns, name)
+			delete(rt.cursors, name)
+		}
+	}
+	for name, rows := range snap.Tables {
+		out := make([]map[string]Value, len(rows))
+		for i, row := range rows {
+			r := make(map[string]Value, len(row))
+			for k, v := range row {
+				r[k] = restoreSnapshotValue(v)
+			}
+			out[i] = r
+		}
+		rt.tables[name] = out
+	}
+	for name, key := range snap.KeyColumns {
+		rt.keyColumns[name] = key
+	}
+
+	for name := range rt.nodes {
+		if !skipped["nodes."+name] {
+			delete(rt.nodes, name)
+		}
+	}
+	for name, v := range snap.Nodes {
+		if node, ok := restoreSnapshotValue(v).(TreeNode); ok {
+			rt.nodes[name] = node
+		}
+	}
+	return nil
+}
+
+// snapshotValue converts v to its native form, reporting false for values
+// that cannot be restored, such as host objects.
+func snapshotValue(v Value) (interface{}, bool) {
+	switch val := v.(type) {
+	case nil:
+		return nil, true
+	case Str, Number, Bool:
+		return convertValueToNative(val), true
+	case *ArrayValue:
+		out := make([]interface{}, val.Length())
+		for i := range out {
+			item, ok := snapshotValue(val.Get(i))
+			if !ok {
+				return nil, false
+			}
+			out[i] = item
+		}
+		return out, true
+	case *MapValue:
+		out := make(map[string]interface{}, len(val.Values))
+		for k, item := range val.Values {
+			nv, ok := snapshotValue(item)
+			if !ok {
+				return nil, false
+			}
+			out[k] = nv
+		}
+		return out, true
+	case *FunctionValue, *Plan, *ETLTransformValue, *OfferVariable:
+		return convertValueToNative(val), true
+	case TreeNode:
+		node := val.Clone()
+		return map[string]interface{}{
+			"_value_type": "tree",
+			"node":        NewTreeNodeSerializer().serializeNodeToMap(node),
+		}, true
+	}
+	if v == Value(DBNull) {
+		return map[string]interface{}{"_value_type": "dbnull"}, true
+	}
+	return nil, false
+}
+
+// restoreSnapshotValue converts a value stored by snapshotValue back.
+func restoreSnapshotValue(v interface{}) Value {
+	switch val := v.(type) {
+	case []interface{}:
+		arr := NewArray()
+		for _, item := range val {
+			arr.Append(restoreSnapshotValue(item))
+		}
+		return arr
+	case map[string]interface{}:
+		switch val["_value_type"] {
+		case "dbnull":
+			return DBNull
+		case "tree":
+			if data, ok := val["node"].(map[string]interface{}); ok {
+				if node, err := NewTreeNodeSerializer().deserializeNodeFromMap(data); err == nil {
+					return node
+				}
+			}
+			return DBNull
+		case nil:
+			m := NewMap()
+			for k, item := range val {
+				m.Set(k, restoreSnapshotValue(item))
+			}
+			return m
+		}
+	}
+	return convertFromNativeValue(v)
+}
+
+// SaveSnapshot writes snap to dir, replacing any snapshot with the same name.
+func SaveSnapshot(dir string, snap *RuntimeSnapshot) error {
+	if err := ValidateSnapshotName(snap.Name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create snapshot directory: %w", err)
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+	path := filepath.Join(dir, snap.Name+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadSnapshot reads the snapshot called name from dir.
+func LoadSnapshot(dir, name string) (*RuntimeSnapshot, error) {
+	if err := ValidateSnapshotName(name); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+		}
+		return nil, err
+	}
+	var snap RuntimeSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("decode snapshot %s: %w", name, err)
+	}
+	snap.Name = name
+	return &snap, nil
+}
+
+// DeleteSnapshot removes the snapshot called name from dir.
+func DeleteSnapshot(dir, name string) error {
+	if err := ValidateSnapshotName(name); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(dir, name+".json")); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// ListSnapshots returns the snapshots stored in dir, newest first.
+func ListSnapshots(dir string) ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []SnapshotInfo{}, nil
+		}
+		return nil, err
+	}
+	out := make([]SnapshotInfo, 0, len(entries))
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".json")
+		if e.IsDir() || name == e.Name() || ValidateSnapshotName(name) != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, SnapshotInfo{Name: name, Created: info.ModTime().UTC(), Size: info.Size()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out, nil
+}
+
+// SaveSnapshotTo captures the runtime under name and stores it in its
+// snapshot directory.
+func (rt *Runtime) SaveSnapshotTo(name string) (*RuntimeSnapshot, error) {
+	snap, err := rt.Snapshot(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveSnapshot(rt.SnapshotDir(), snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// RestoreSnapshotFrom loads the snapshot called name from the runtime's
+// snapshot directory and restores it.
+func (rt *Runtime) RestoreSnapshotFrom(name string) (*RuntimeSnapshot, error) {
+	snap, err := LoadSnapshot(rt.SnapshotDir(), name)
+	if err != nil {
+		return nil, err
+	}
+	return snap, rt.RestoreSnapshot(snap)
+}
+
+// snapshotSummary describes snap to scripts: its name, what it holds and
+// what it had to leave out.
+func snapshotSummary(snap *RuntimeSnapshot) *MapValue {
+	m := NewMap()
+	m.Set("name", Str(snap.Name))
+	m.Set("created", Str(snap.Created.Format(time.RFC3339)))
+	m.Set("globals", Number(len(snap.Globals)))
+	m.Set("variables", Number(len(snap.Variables)))
+	m.Set("functions", Number(len(snap.Functions)))
+	skipped := NewArray()
+	for _, s := range snap.Skipped {
+		skipped.Append(Str(s))
+	}
+	m.Set("skipped", skipped)
+	return m
+}
+
+// UserSnapshotDir returns the snapshot directory of a user: the snapshots
+// directory of the user's sandbox when sandboxes are the default storage
+// scope, otherwise the shared one under the data path.
+func UserSnapshotDir(userID string) string {
+	base, err := cfg.EnsureStorageBase(cfg.StorageKindData, cfg.DefaultStorageScope(), userID)
+	if err != nil {
+		base = cfg.ChariotConfig.DataPath
+	}
+	return filepath.Join(base, "snapshots")
+}
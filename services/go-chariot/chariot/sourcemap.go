@@ -0,0 +1,86 @@
+package chariot
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// SourceMapMarker prefixes a base64-encoded DiagramSourceMap embedded as a
+// comment in generated code, mirroring the __VDSL_SOURCE__ diagram payload.
+const SourceMapMarker = "__VDSL_MAP__: base64:"
+
+// SourceMapping links generated lines [Line, EndLine] to the diagram node that
+// produced them.
+type SourceMapping struct {
+	Line    int    `json:"line"`
+	EndLine int    `json:"endLine"`
+	NodeID  string `json:"nodeId"`
+	Label   string `json:"label,omitempty"`
+}
+
+// DiagramSourceMap is emitted by the Visual DSL code generator alongside the
+// generated code and stored with the diagram.
+type DiagramSourceMap struct {
+	Version  int             `json:"version"`
+	Diagram  string          `json:"diagram"`
+	Mappings []SourceMapping `json:"mappings"`
+}
+
+// Lookup returns the mapping covering a generated line.
+func (m *DiagramSourceMap) Lookup(line int) (SourceMapping, bool) {
+	if m == nil || line <= 0 {
+		return SourceMapping{}, false
+	}
+	for _, mp := range m.Mappings {
+		if line >= mp.Line && line <= mp.EndLine {
+			return mp, true
+		}
+	}
+	return SourceMapping{}, false
+}
+
+// ExtractSourceMap decodes a source map embedded in code with SourceMapMarker.
+func ExtractSourceMap(code string) (*DiagramSourceMap, bool) {
+	idx := strings.LastIndex(code, SourceMapMarker)
+	if idx < 0 {
+		return nil, false
+	}
+	encoded := code[idx+len(SourceMapMarker):]
+	if nl := strings.IndexAny(encoded, "\r\n"); nl >= 0 {
+		encoded = encoded[:nl]
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, false
+	}
+	var sm DiagramSourceMap
+	if err := json.Unmarshal(data, &sm); err != nil || len(sm.Mappings) == 0 {
+		return nil, false
+	}
+	return &sm, true
+}
+
+// ApplySourceMap annotates frames located in file with the diagram node that
+// generated their line. The innermost mapped frame also sets the error's
+// diagram location.
+func (info *ErrorInfo) ApplySourceMap(sm *DiagramSourceMap, file string) {
+	if info == nil || sm == nil {
+		return
+	}
+	for i := range info.Stack {
+		frame := &info.Stack[i]
+		if frame.File != file {
+			continue
+		}
+		if mp, ok := sm.Lookup(frame.Line); ok {
+			frame.NodeID = mp.NodeID
+			frame.NodeLabel = mp.Label
+			if info.NodeID == "" {
+				info.Diagram = sm.Diagram
+				info.NodeID = mp.NodeID
+				info.NodeLabel = mp.Label
+			}
+		}
+	}
+}
@@ -159,7 +159,7 @@ func RegisterSQLFunctions(rt *Runtime) {
 		}
 
 		// Execute query
-		results, err := sqlNode.QuerySQL(queryClean, params...)
+		results, err := sqlNode.QuerySQLContext(rt.Context(), queryClean, params...)
 		if err != nil {
 			return nil, fmt.Errorf("query failed: %v", err)
 		}
@@ -250,7 +250,7 @@ func RegisterSQLFunctions(rt *Runtime) {
 		}
 
 		// Execute statement
-		affected, err := sqlNode.Execute(string(stmt), params...)
+		affected, err := sqlNode.ExecuteContext(rt.Context(), string(stmt), params...)
 		if err != nil {
 			return nil, fmt.Errorf("execution failed: %v", err)
 		}
@@ -389,7 +389,7 @@ func RegisterSQLFunctions(rt *Runtime) {
 			return nil, fmt.Errorf("object '%s' is not a SQL node", nodeName)
 		}
 
-		tables, err := sqlNode.ListTables()
+		tables, err := sqlNode.ListTablesContext(rt.Context())
 		if err != nil {
 			return nil, fmt.Errorf("failed to list tables: %v", err)
 		}
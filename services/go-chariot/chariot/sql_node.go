@@ -63,6 +63,7 @@ func (n *SQLNode) Connect(driverName, sqlURL string) error {
 
 	// Close existing connection if any
 	if n.DB != nil {
+		untrackSQL(n.DB)
 		n.DB.Close()
 		n.connected = false
 	}
@@ -93,6 +94,7 @@ func (n *SQLNode) Connect(driverName, sqlURL string) error {
 
 	n.DB = db
 	n.connected = true
+	trackSQL(db, driverName)
 	return nil
 }
 
@@ -102,6 +104,7 @@ func (n *SQLNode) Close() error {
 	defer n.mu.Unlock()
 
 	if n.DB != nil {
+		untrackSQL(n.DB)
 		err := n.DB.Close()
 		n.DB = nil
 		n.connected = false
@@ -305,6 +308,11 @@ func (n *SQLNode) QueryTree(filter func(TreeNode) bool) []TreeNode {
 
 // Query executes a SQL query and returns results
 func (n *SQLNode) QuerySQL(query string, args ...interface{}) (*ArrayValue, error) {
+	return n.QuerySQLContext(context.Background(), query, args...)
+}
+
+// QuerySQLContext is QuerySQL, giving up when ctx is done
+func (n *SQLNode) QuerySQLContext(ctx context.Context, query string, args ...interface{}) (*ArrayValue, error) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
@@ -325,7 +333,7 @@ func (n *SQLNode) QuerySQL(query string, args ...interface{}) (*ArrayValue, erro
 	n.Children = nil
 
 	// Execute the query
-	rows, err := n.DB.Query(query, args...)
+	rows, err := n.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		n.lastError = err
 		return nil, err
@@ -505,6 +513,11 @@ func (n *SQLNode) QuerySQLStream(query string, callback func(int, map[string]int
 
 // Execute runs a SQL statement and returns affected rows
 func (n *SQLNode) Execute(stmt string, args ...interface{}) (int64, error) {
+	return n.ExecuteContext(context.Background(), stmt, args...)
+}
+
+// ExecuteContext is Execute, giving up when ctx is done
+func (n *SQLNode) ExecuteContext(ctx context.Context, stmt string, args ...interface{}) (int64, error) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
@@ -524,10 +537,10 @@ func (n *SQLNode) Execute(stmt string, args ...interface{}) (int64, error) {
 
 	if n.tx != nil {
 		// In transaction
-		result, err = n.tx.Exec(stmt, args...)
+		result, err = n.tx.ExecContext(ctx, stmt, args...)
 	} else {
 		// No transaction
-		result, err = n.DB.Exec(stmt, args...)
+		result, err = n.DB.ExecContext(ctx, stmt, args...)
 	}
 
 	if err != nil {
@@ -700,6 +713,11 @@ func (n *SQLNode) GetRow(row int) (map[string]interface{}, error) {
 
 // ListTables retrieves all table names in the database
 func (n *SQLNode) ListTables() (*ArrayValue, error) {
+	return n.ListTablesContext(context.Background())
+}
+
+// ListTablesContext is ListTables, giving up when ctx is done
+func (n *SQLNode) ListTablesContext(ctx context.Context) (*ArrayValue, error) {
 	var query string
 
 	// Different query based on database type
@@ -714,7 +732,7 @@ func (n *SQLNode) ListTables() (*ArrayValue, error) {
 		return nil, fmt.Errorf("unsupported database type: %s", n.DriverName)
 	}
 
-	return n.QuerySQL(query, nil)
+	return n.QuerySQLContext(ctx, query, nil)
 }
 
 // DescribeTable retrieves table schema
@@ -0,0 +1,202 @@
+package chariot
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parseJSONStream and parseXMLStream hand a script the parts of a document a
+// path filter selects, one at a time, reading the document once without
+// building it. Only the selected parts are ever held in memory.
+
+// streamFilter selects elements by path. Each segment matches one step of
+// the path, "*" any step.
+type streamFilter []string
+
+func parseStreamFilter(filter, sep string) streamFilter {
+	filter = strings.Trim(filter, sep)
+	if filter == "" {
+		return streamFilter{}
+	}
+	return strings.Split(filter, sep)
+}
+
+// matches reports whether path is selected (full) or may lead to a
+// selected element (prefix).
+func (f streamFilter) matches(path []string) (full, prefix bool) {
+	if len(path) > len(f) {
+		return false, false
+	}
+	for i, step := range path {
+		if f[i] != "*" && f[i] != step {
+			return false, false
+		}
+	}
+	return len(path) == len(f), len(path) < len(f)
+}
+
+// errStopStream ends a stream early without error.
+var errStopStream = errors.New("stream stopped")
+
+// streamCallback calls fn with a selected element and its path, or only
+// the element when fn takes one parameter. A false result stops the stream.
+func streamCallback(rt *Runtime, fn *FunctionValue) func(Value, string) error {
+	return func(v Value, path string) error {
+		args := []Value{v, Str(path)}
+		if len(fn.Parameters) < len(args) {
+			args = args[:len(fn.Parameters)]
+		}
+		result, err := executeFunctionValue(rt, fn, args)
+		if err != nil {
+			return err
+		}
+		if result == Bool(false) {
+			return errStopStream
+		}
+		return nil
+	}
+}
+
+// streamJSON calls visit with each value of the JSON in r whose path
+// matches filter, as convertToValue converts it. Paths join object keys
+// and array indexes with dots. r may hold several top-level values, as
+// JSON Lines files do; each is matched from an empty path. It returns the
+// number of values visited.
+func streamJSON(rt *Runtime, r io.Reader, filter streamFilter, visit func(Value, string) error) (int, error) {
+	dec := json.NewDecoder(r)
+	count := 0
+	var walk func(path []string) error
+	walk = func(path []string) error {
+		if err := rt.interrupted(); err != nil {
+			return err
+		}
+		full, prefix := filter.matches(path)
+		if full {
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				return err
+			}
+			count++
+			value := convertToValue(v)
+			if value == nil {
+				value = DBNull
+			}
+			return visit(value, strings.Join(path, "."))
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		delim, ok := tok.(json.Delim)
+		if !ok {
+			return nil
+		}
+		if !prefix {
+			return skipJSONValue(dec)
+		}
+		for i := 0; dec.More(); i++ {
+			step := strconv.Itoa(i)
+			if delim == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				step, _ = key.(string)
+			}
+			if err := walk(append(path, step)); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token() // Closing delimiter
+		return err
+	}
+	for dec.More() {
+		if err := walk(nil); err != nil {
+			if err == errStopStream {
+				break
+			}
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// streamXML calls visit with each element of the XML in r whose path of
+// element names, from the root element, matches filter, as an XMLNode.
+// Paths join names with slashes. It returns the number of elements visited.
+func streamXML(rt *Runtime, r io.Reader, filter streamFilter, visit func(Value, string) error) (int, error) {
+	dec := xml.NewDecoder(r)
+	count := 0
+	path := []string{}
+	for {
+		if err := rt.interrupted(); err != nil {
+			return count, err
+		}
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+			full, prefix := filter.matches(path)
+			switch {
+			case full:
+				node := NewXMLNode(t.Name.Local)
+				if err := node.UnmarshalXML(dec, t); err != nil {
+					return count, err
+				}
+				count++
+				err := visit(node, strings.Join(path, "/"))
+				path = path[:len(path)-1]
+				if err == errStopStream {
+					return count, nil
+				}
+				if err != nil {
+					return count, err
+				}
+			case !prefix:
+				if err := dec.Skip(); err != nil {
+					return count, err
+				}
+				path = path[:len(path)-1]
+			}
+		case xml.EndElement:
+			path = path[:len(path)-1]
+		}
+	}
+}
+
+// streamArgs checks the arguments of parseJSONStream and parseXMLStream:
+// a filename, a path filter and a function.
+func streamArgs(name string, args []Value) (string, string, *FunctionValue, error) {
+	if len(args) != 3 {
+		return "", "", nil, fmt.Errorf("%s requires 3 arguments: filename, pathFilter, function", name)
+	}
+	for i, arg := range args {
+		if tvar, ok := arg.(ScopeEntry); ok {
+			args[i] = tvar.Value
+		}
+	}
+	filename, ok := args[0].(Str)
+	if !ok {
+		return "", "", nil, fmt.Errorf("filename must be a string, got %T", args[0])
+	}
+	filter, ok := args[1].(Str)
+	if !ok {
+		return "", "", nil, fmt.Errorf("pathFilter must be a string, got %T", args[1])
+	}
+	fn, ok := args[2].(*FunctionValue)
+	if !ok {
+		return "", "", nil, fmt.Errorf("third argument must be a function, got %T", args[2])
+	}
+	return string(filename), string(filter), fn, nil
+}
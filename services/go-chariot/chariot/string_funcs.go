@@ -46,34 +46,7 @@ func RegisterString(rt *Runtime) {
 		if len(args) < 1 {
 			return nil, errors.New("format requires at least 1 argument")
 		}
-
-		// Unwrap first argument as format string
-		if tvar, ok := args[0].(ScopeEntry); ok {
-			args[0] = tvar.Value
-		}
-
-		format, ok := args[0].(Str)
-		if !ok {
-			return nil, fmt.Errorf("format string must be a string, got %T", args[0])
-		}
-
-		// Convert remaining args to interface{} for fmt.Sprintf
-		fmtArgs := make([]interface{}, len(args)-1)
-		for i, arg := range args[1:] {
-			switch v := arg.(type) {
-			case Str:
-				fmtArgs[i] = string(v)
-			case Number:
-				fmtArgs[i] = float64(v) // Convert Number to float64 for fmt.Sprintf
-			case Bool:
-				fmtArgs[i] = bool(v) // Convert Bool to bool for fmt.Sprintf
-			default:
-				fmtArgs[i] = arg
-			}
-		}
-
-		result := fmt.Sprintf(string(format), fmtArgs...)
-		return Str(result), nil
+		return formatValues(args)
 	})
 
 	// Alias for format
@@ -819,3 +792,34 @@ func stringGetAt(args ...Value) (Value, error) {
 
 	return Str(string(runes[index])), nil
 }
+
+// formatValues formats args[1:] with the format string args[0], as
+// fmt.Sprintf does.
+func formatValues(args []Value) (Str, error) {
+	// Unwrap first argument as format string
+	if tvar, ok := args[0].(ScopeEntry); ok {
+		args[0] = tvar.Value
+	}
+
+	format, ok := args[0].(Str)
+	if !ok {
+		return "", fmt.Errorf("format string must be a string, got %T", args[0])
+	}
+
+	// Convert remaining args to interface{} for fmt.Sprintf
+	fmtArgs := make([]interface{}, len(args)-1)
+	for i, arg := range args[1:] {
+		switch v := arg.(type) {
+		case Str:
+			fmtArgs[i] = string(v)
+		case Number:
+			fmtArgs[i] = float64(v) // Convert Number to float64 for fmt.Sprintf
+		case Bool:
+			fmtArgs[i] = bool(v) // Convert Bool to bool for fmt.Sprintf
+		default:
+			fmtArgs[i] = arg
+		}
+	}
+
+	return Str(fmt.Sprintf(string(format), fmtArgs...)), nil
+}
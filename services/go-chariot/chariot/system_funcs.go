@@ -3,7 +3,6 @@ package chariot
 import (
 	"errors"
 	"fmt"
-	"os"
 	"runtime"
 	"strconv"
 	"time"
@@ -32,7 +31,7 @@ func RegisterSystem(rt *Runtime) {
 			return nil, fmt.Errorf("variable name must be a string, got %T", args[0])
 		}
 
-		value, exists := os.LookupEnv(string(name))
+		value, exists := rt.lookupEnv(string(name))
 		if !exists {
 			return DBNull, nil
 		}
@@ -57,7 +56,7 @@ func RegisterSystem(rt *Runtime) {
 			return nil, fmt.Errorf("variable name must be a string, got %T", args[0])
 		}
 
-		_, exists := os.LookupEnv(string(name))
+		_, exists := rt.lookupEnv(string(name))
 		return Bool(exists), nil
 	})
 
@@ -86,42 +85,44 @@ func RegisterSystem(rt *Runtime) {
 			}
 		}
 
-		// Use your global or context logger
-		logger := cfg.ChariotLogger
+		rt.logAt(level, msg, fields)
+		return nil, nil
+	})
 
-		switch level {
-		case "debug":
-			if len(fields) > 0 {
-				logger.Debug(string(msg), ChariotValueToZapFields(fields)...)
-			} else {
-				logger.Debug(string(msg))
-			}
-			rt.WriteLog("DEBUG", msg)
-		case "warn":
-			if len(fields) > 0 {
-				logger.Warn(string(msg), ChariotValueToZapFields(fields)...)
-			} else {
-				logger.Warn(string(msg))
-			}
-			rt.WriteLog("WARN", msg)
-		case "error":
-			if len(fields) > 0 {
-				logger.Error(string(msg), ChariotValueToZapFields(fields)...)
-			} else {
-				logger.Error(string(msg))
-			}
-			rt.WriteLog("ERROR", msg)
-		default:
-			if len(fields) > 0 {
-				logger.Info(string(msg), ChariotValueToZapFields(fields)...)
-			} else {
-				logger.Info(string(msg))
-			}
-			rt.WriteLog("INFO", msg)
+	// logPrintf(level, format, args...) and its shorthand per level format
+	// the message as format() does
+	rt.Register("logPrintf", func(args ...Value) (Value, error) {
+		if len(args) < 2 {
+			return nil, errors.New("logPrintf requires a level and a format")
 		}
-
+		level, ok := args[0].(Str)
+		if !ok {
+			return nil, fmt.Errorf("logPrintf level must be a string, got %T", args[0])
+		}
+		if _, err := NormalizeLogLevel(string(level)); err != nil {
+			return nil, err
+		}
+		msg, err := formatValues(args[1:])
+		if err != nil {
+			return nil, err
+		}
+		rt.logAt(string(level), string(msg), nil)
 		return nil, nil
 	})
+	for name, level := range map[string]string{"logDebugf": "debug", "logInfof": "info", "logWarnf": "warn", "logErrorf": "error"} {
+		name, level := name, level
+		rt.Register(name, func(args ...Value) (Value, error) {
+			if len(args) < 1 {
+				return nil, fmt.Errorf("%s requires a format", name)
+			}
+			msg, err := formatValues(args)
+			if err != nil {
+				return nil, err
+			}
+			rt.logAt(level, string(msg), nil)
+			return nil, nil
+		})
+	}
 
 	// Runtime information
 	rt.Register("platform", func(args ...Value) (Value, error) {
@@ -301,3 +302,26 @@ func ChariotValueToZapFields(fields map[string]Value) []zap.Field {
 	}
 	return zapFields
 }
+
+// logAt writes msg to the server log and the execution log at level (debug,
+// info, warn or error, in any case; anything else is info), with fields
+// added to the server log.
+func (rt *Runtime) logAt(level, msg string, fields map[string]Value) {
+	logger := cfg.ChariotLogger
+	zapFields := ChariotValueToZapFields(fields)
+	level, err := NormalizeLogLevel(level)
+	if err != nil {
+		level = "INFO"
+	}
+	switch level {
+	case "DEBUG":
+		logger.Debug(msg, zapFields...)
+	case "WARN":
+		logger.Warn(msg, zapFields...)
+	case "ERROR":
+		logger.Error(msg, zapFields...)
+	default:
+		logger.Info(msg, zapFields...)
+	}
+	rt.WriteLog(level, msg)
+}
@@ -0,0 +1,88 @@
+package chariot
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// tlsConfigFromOptions builds the TLS settings of one outbound request from
+// a script's options map:
+//
+//	caCert      PEM certificates to trust instead of the system roots
+//	clientCert  PEM client certificate (chain) for mutual TLS
+//	clientKey   PEM private key of clientCert
+//	serverName  name to verify the server certificate against
+//	minVersion  "1.2" (default) or "1.3"
+//
+// A nil map yields the defaults.
+func tlsConfigFromOptions(opts *MapValue) (*tls.Config, error) {
+	conf := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts == nil {
+		return conf, nil
+	}
+	var certPEM, keyPEM string
+	for k, v := range opts.Values {
+		if se, ok := v.(ScopeEntry); ok {
+			v = se.Value
+		}
+		s, ok := v.(Str)
+		if !ok {
+			return nil, fmt.Errorf("tls option %s must be a string, got %T", k, v)
+		}
+		switch k {
+		case "caCert":
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM([]byte(s)) {
+				return nil, errors.New("tls option caCert holds no PEM certificate")
+			}
+			conf.RootCAs = pool
+		case "clientCert":
+			certPEM = string(s)
+		case "clientKey":
+			keyPEM = string(s)
+		case "serverName":
+			conf.ServerName = string(s)
+		case "minVersion":
+			switch s {
+			case "1.2":
+				conf.MinVersion = tls.VersionTLS12
+			case "1.3":
+				conf.MinVersion = tls.VersionTLS13
+			default:
+				return nil, fmt.Errorf("tls option minVersion must be \"1.2\" or \"1.3\", got %q", string(s))
+			}
+		default:
+			return nil, fmt.Errorf("unknown tls option %q", k)
+		}
+	}
+	if (certPEM == "") != (keyPEM == "") {
+		return nil, errors.New("tls options clientCert and clientKey must be given together")
+	}
+	if certPEM != "" {
+		cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+		if err != nil {
+			return nil, fmt.Errorf("tls client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+// httpClientWithTLS returns a client for one request with the TLS options
+// of a script; without options it returns a plain client.
+func httpClientWithTLS(opts *MapValue, timeout time.Duration) (*http.Client, error) {
+	if opts == nil {
+		return &http.Client{Timeout: timeout}, nil
+	}
+	conf, err := tlsConfigFromOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = conf
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
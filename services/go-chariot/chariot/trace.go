@@ -0,0 +1,413 @@
+package chariot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+// ExecutionTrace records what one run of a program took from outside the
+// runtime: the time, random numbers, environment variables, files read and
+// the answers of databases, MCP servers and notification services. Replaying
+// it answers those calls from the trace, so the run can be reproduced exactly,
+// for example in the editor after a listener failed in production.
+type ExecutionTrace struct {
+	Name     string                 `json:"name"`
+	Created  time.Time              `json:"created"`
+	Source   string                 `json:"source,omitempty"`   // The user, or "listener:<name>", that ran the program
+	Program  string                 `json:"program"`            // Code, or the name of the function called
+	Filename string                 `json:"filename,omitempty"` // File name the code ran as
+	Args     []interface{}          `json:"args,omitempty"`     // Arguments of a function program
+	Vars     map[string]interface{} `json:"vars,omitempty"`     // Variables bound while the code ran
+	State    *RuntimeSnapshot       `json:"state,omitempty"`    // The runtime before the run
+	Calls    []TraceCall            `json:"calls"`
+	Error    string                 `json:"error,omitempty"`   // How the recorded run failed
+	Skipped  []string               `json:"skipped,omitempty"` // Arguments and variables that could not be stored
+}
+
+// TraceCall is one traced builtin call and its answer.
+type TraceCall struct {
+	Func   string        `json:"func"`
+	Args   []interface{} `json:"args,omitempty"`
+	Result interface{}   `json:"result,omitempty"`
+	Error  string        `json:"error,omitempty"`
+	Opaque bool          `json:"opaque,omitempty"` // The result could not be stored, so replay fails here
+}
+
+// TraceInfo describes a stored trace.
+type TraceInfo struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Size    int64     `json:"size"`
+	Shared  bool      `json:"shared,omitempty"` // Recorded by a listener
+}
+
+var (
+	// ErrTraceNotFound is returned when no trace has the requested name.
+	ErrTraceNotFound = errors.New("trace not found")
+	// ErrTraceDiverged is returned when a replayed program makes other
+	// traced calls than the recorded run did.
+	ErrTraceDiverged = errors.New("replay diverged from the trace")
+)
+
+// Builtins whose answers come from outside the runtime. Plugin functions are
+// added as they are registered.
+var tracedFunctions = struct {
+	sync.RWMutex
+	names map[string]bool
+}{names: map[string]bool{
+	"now": true, "today": true, "timestamp": true,
+	"random": true, "randomString": true, "randomBytes": true, "newID": true,
+	"getEnv": true, "hasEnv": true,
+	"readFile": true, "fileExists": true, "getFileSize": true, "listFiles": true,
+	"loadCSV": true, "loadCSVRaw": true, "loadJSON": true, "loadJSONRaw": true,
+	"loadXML": true, "loadXMLRaw": true, "loadYAML": true, "loadYAMLRaw": true, "loadYAMLMultiDoc": true,
+	"treeLoad": true, "treeLoadSecure": true,
+	"sqlConnect": true, "sqlQuery": true, "sqlExecute": true, "sqlBegin": true,
+	"sqlCommit": true, "sqlRollback": true, "sqlListTables": true, "sqlClose": true,
+	"cbConnect": true, "cbOpenBucket": true, "cbSetScope": true, "cbQuery": true, "cbGet": true,
+	"cbInsert": true, "cbUpsert": true, "cbReplace": true, "cbRemove": true, "cbClose": true,
+	"mcpConnect": true, "mcpListTools": true, "mcpCallTool": true, "mcpClose": true,
+	"sendEmail": true, "slackPost": true, "fetchCertificate": true,
+}}
+
+// Traced builtins whose arguments carry credentials and are not stored.
+var traceHidesArgs = map[string]bool{"sqlConnect": true, "cbConnect": true, "mcpConnect": true}
+
+// TraceFunctions marks builtins as taking input from outside the runtime,
+// so traces record them.
+func TraceFunctions(names ...string) {
+	tracedFunctions.Lock()
+	defer tracedFunctions.Unlock()
+	for _, n := range names {
+		tracedFunctions.names[n] = true
+	}
+}
+
+// IsTracedFunction reports whether traces record calls of the builtin name.
+func IsTracedFunction(name string) bool {
+	tracedFunctions.RLock()
+	defer tracedFunctions.RUnlock()
+	return tracedFunctions.names[name]
+}
+
+// traceState is the trace a runtime is recording or replaying.
+type traceState struct {
+	trace  *ExecutionTrace
+	replay bool
+	next   int // Replay: index of the next recorded call
+}
+
+// callBuiltin calls the builtin h, recording its answer or answering from
+// the trace while one is active. In a dry run writes are skipped instead;
+// see StartDryRun. External calls are counted while usage is; see StartUsage.
+// A mock set up by a test answers the call in place of all of these.
+func (rt *Runtime) callBuiltin(name string, h func(...Value) (Value, error), args []Value) (Value, error) {
+	if len(rt.mocks) > 0 {
+		if val, ok, err := rt.callMock(name, args); ok {
+			return val, err
+		}
+	}
+	ts := rt.trace
+	traced := ts != nil && IsTracedFunction(name)
+	if traced && ts.replay {
+		return ts.replayCall(name)
+	}
+	var val Value
+	var err error
+	if rt.dryRun != nil && IsDryRunFunction(name) {
+		val = rt.planCall(name, args)
+	} else {
+		val, err = h(args...)
+		if !rt.deadline.at.IsZero() && IsMeteredFunction(name) {
+			val, err = rt.afterDeadline(name, val, err)
+		}
+		if rt.usage != nil && IsMeteredFunction(name) {
+			rt.usage.note(name, val, err)
+		}
+	}
+	if traced {
+		ts.record(name, args, val, err)
+	}
+	return val, err
+}
+
+func (ts *traceState) record(name string, args []Value, val Value, err error) {
+	call := TraceCall{Func: name}
+	if !traceHidesArgs[name] {
+		for _, a := range args {
+			v, _ := traceValue(a)
+			call.Args = append(call.Args, v)
+		}
+	}
+	if err != nil {
+		call.Error = err.Error()
+	} else if v, ok := traceValue(val); ok {
+		call.Result = v
+	} else {
+		call.Opaque = true
+	}
+	ts.trace.Calls = append(ts.trace.Calls, call)
+}
+
+func (ts *traceState) replayCall(name string) (Value, error) {
+	calls := ts.trace.Calls
+	if ts.next >= len(calls) {
+		return nil, fmt.Errorf("%w: %s called after the %d recorded calls", ErrTraceDiverged, name, len(calls))
+	}
+	call := calls[ts.next]
+	if call.Func != name {
+		return nil, fmt.Errorf("%w: call %d is %s, recorded %s", ErrTraceDiverged, ts.next+1, name, call.Func)
+	}
+	ts.next++
+	switch {
+	case call.Error != "":
+		return nil, errors.New(call.Error)
+	case call.Opaque:
+		return nil, fmt.Errorf("%w: the result of %s (call %d) was not recorded", ErrTraceDiverged, name, ts.next)
+	}
+	return restoreSnapshotValue(call.Result), nil
+}
+
+// traceValue converts v for storing in a trace, like a snapshot does.
+func traceValue(v Value) (interface{}, bool) {
+	if se, ok := v.(ScopeEntry); ok {
+		v = se.Value
+	}
+	return snapshotValue(v)
+}
+
+// StartRecording captures the runtime's state and starts recording the
+// traced calls of program, which is about to run with args or vars. The
+// trace is complete once StopTrace is called.
+func (rt *Runtime) StartRecording(name, program string, args []Value, vars map[string]Value) (*ExecutionTrace, error) {
+	if err := ValidateTraceName(name); err != nil {
+		return nil, err
+	}
+	state, err := rt.Snapshot(name)
+	if err != nil {
+		return nil, err
+	}
+	t := &ExecutionTrace{
+		Name:    name,
+		Created: time.Now().UTC(),
+		Program: program,
+		State:   state,
+		Calls:   []TraceCall{},
+	}
+	for i, a := range args {
+		v, ok := traceValue(a)
+		if !ok {
+			t.Skipped = append(t.Skipped, fmt.Sprintf("args.%d", i))
+		}
+		t.Args = append(t.Args, v)
+	}
+	for k, a := range vars {
+		if v, ok := traceValue(a); ok {
+			if t.Vars == nil {
+				t.Vars = map[string]interface{}{}
+			}
+			t.Vars[k] = v
+		} else {
+			t.Skipped = append(t.Skipped, "vars."+k)
+		}
+	}
+	sort.Strings(t.Skipped)
+	rt.trace = &traceState{trace: t}
+	return t, nil
+}
+
+// StopTrace stops recording or replaying and returns the trace.
+func (rt *Runtime) StopTrace() *ExecutionTrace {
+	ts := rt.trace
+	rt.trace = nil
+	if ts == nil {
+		return nil
+	}
+	return ts.trace
+}
+
+// Replay runs the program of t on rt from the state it was recorded in,
+// answering the traced calls from t instead of the outside world. used is
+// how many recorded calls the run consumed. A program that makes other
+// traced calls than the recorded run fails with ErrTraceDiverged.
+func (rt *Runtime) Replay(t *ExecutionTrace) (val Value, used int, err error) {
+	if t == nil {
+		return nil, 0, errors.New("no trace to replay")
+	}
+	if t.State != nil {
+		if err := rt.RestoreSnapshot(t.State); err != nil {
+			return nil, 0, fmt.Errorf("restore trace state: %w", err)
+		}
+	}
+	ts := &traceState{trace: t, replay: true}
+	rt.trace = ts
+	defer func() { rt.trace = nil }()
+
+	args := make([]Value, len(t.Args))
+	for i, a := range t.Args {
+		args[i] = restoreSnapshotValue(a)
+	}
+	if fn, ok := rt.functions[t.Program]; ok {
+		val, err = executeFunctionValue(rt, fn, args)
+	} else if len(t.Vars) > 0 {
+		vars := make(map[string]Value, len(t.Vars))
+		for k, v := range t.Vars {
+			vars[k] = restoreSnapshotValue(v)
+		}
+		val, err = rt.ExecuteWithVariables(t.Program, vars)
+	} else {
+		filename := t.Filename
+		if filename == "" {
+			filename = "main.ch"
+		}
+		val, err = rt.ExecProgramWithFilename(t.Program, filename)
+	}
+	return val, ts.next, err
+}
+
+var traceNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// NewTraceName returns a name for a trace recorded now by prefix, such as a
+// user or listener name.
+func NewTraceName(prefix string) string {
+	prefix = strings.Trim(traceNameUnsafe.ReplaceAllString(prefix, "_"), "._-")
+	if len(prefix) > 36 {
+		prefix = prefix[:36]
+	}
+	stamp := time.Now().UTC().Format("20060102-150405.000000")
+	if prefix == "" {
+		return stamp
+	}
+	return prefix + "-" + stamp
+}
+
+// ValidateTraceName checks that name can be used as a trace file name.
+func ValidateTraceName(name string) error {
+	if !snapshotNamePattern.MatchString(name) || strings.Contains(name, "..") {
+		return fmt.Errorf("invalid trace name %q: use up to 64 letters, digits, '.', '-' or '_'", name)
+	}
+	return nil
+}
+
+// SaveTrace writes t to dir, readable only by the server since traces hold
+// whatever the program read.
+func SaveTrace(dir string, t *ExecutionTrace) error {
+	if err := ValidateTraceName(t.Name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create trace directory: %w", err)
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("encode trace: %w", err)
+	}
+	path := filepath.Join(dir, t.Name+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadTrace reads the trace called name from dir.
+func LoadTrace(dir, name string) (*ExecutionTrace, error) {
+	if err := ValidateTraceName(name); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrTraceNotFound, name)
+		}
+		return nil, err
+	}
+	var t ExecutionTrace
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("decode trace %s: %w", name, err)
+	}
+	t.Name = name
+	return &t, nil
+}
+
+// DeleteTrace removes the trace called name from dir.
+func DeleteTrace(dir, name string) error {
+	if err := ValidateTraceName(name); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(dir, name+".json")); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrTraceNotFound, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// ListTraces returns the traces stored in dir, newest first.
+func ListTraces(dir string) ([]TraceInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []TraceInfo{}, nil
+		}
+		return nil, err
+	}
+	out := make([]TraceInfo, 0, len(entries))
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".json")
+		if e.IsDir() || name == e.Name() || ValidateTraceName(name) != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, TraceInfo{Name: name, Created: info.ModTime().UTC(), Size: info.Size()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out, nil
+}
+
+// PruneTraces removes all but the newest keep traces in dir whose names
+// start with prefix; keep <= 0 keeps them all.
+func PruneTraces(dir, prefix string, keep int) {
+	if keep <= 0 {
+		return
+	}
+	infos, err := ListTraces(dir)
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		if !strings.HasPrefix(info.Name, prefix) {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+		_ = os.Remove(filepath.Join(dir, info.Name+".json"))
+	}
+}
+
+// UserTraceDir returns the trace directory of a user, next to their
+// snapshots.
+func UserTraceDir(userID string) string {
+	return filepath.Join(filepath.Dir(UserSnapshotDir(userID)), "traces")
+}
+
+// SharedTraceDir returns the directory of the traces listeners record.
+func SharedTraceDir() string {
+	return filepath.Join(cfg.ChariotConfig.DataPath, "traces")
+}
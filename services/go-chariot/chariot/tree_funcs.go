@@ -265,34 +265,51 @@ func RegisterTreeFunctions(rt *Runtime) {
 		}
 
 		if len(args) > 5 {
-			// Parse options map if provided
-			if optMap, ok := args[5].(MapValue); ok {
-				if val, exists := optMap.Values["verificationKeyID"]; exists {
+			// Parse options map if provided; map() makes a *MapValue
+			var opts map[string]Value
+			switch m := args[5].(type) {
+			case *MapValue:
+				opts = m.Values
+			case MapValue:
+				opts = m.Values
+			}
+			if opts != nil {
+				if val, exists := opts["verificationKeyID"]; exists {
 					if vkid, ok := val.(Str); ok {
 						options.VerificationKeyID = string(vkid)
 					}
 				}
-				if val, exists := optMap.Values["checksum"]; exists {
+				if val, exists := opts["checksum"]; exists {
 					if checksum, ok := val.(Bool); ok {
 						options.Checksum = bool(checksum)
 					}
 				}
-				if val, exists := optMap.Values["auditTrail"]; exists {
+				if val, exists := opts["auditTrail"]; exists {
 					if audit, ok := val.(Bool); ok {
 						options.AuditTrail = bool(audit)
 					}
 				}
-				if val, exists := optMap.Values["compressionLevel"]; exists {
+				if val, exists := opts["compressionLevel"]; exists {
 					if level, ok := val.(Number); ok {
 						options.CompressionLevel = int(level)
 					}
 				}
+				if val, exists := opts["algorithm"]; exists {
+					if alg, ok := val.(Str); ok {
+						options.Algorithm = string(alg)
+					}
+				}
 			}
 		}
 
+		path, err := getSecureFilePath(string(filename), pathTypeTree)
+		if err != nil {
+			return nil, err
+		}
+
 		// Use global service
 		service := getTreeSerializerService()
-		err := service.SaveSecureAgent(node, string(filename), options)
+		err = service.SaveSecureAgent(node, path, options)
 		if err != nil {
 			return nil, fmt.Errorf("failed to save secure tree: %v", err)
 		}
@@ -339,9 +356,14 @@ func RegisterTreeFunctions(rt *Runtime) {
 			AuditTrail:        true, // Default enabled
 		}
 
+		path, err := getSecureFilePath(string(filename), pathTypeTree)
+		if err != nil {
+			return nil, err
+		}
+
 		// Use global service with the correct API
 		service := getTreeSerializerService()
-		node, err := service.LoadSecureAgent(string(filename), options)
+		node, err := service.LoadSecureAgent(path, options)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load secure tree: %v", err)
 		}
@@ -374,9 +396,14 @@ func RegisterTreeFunctions(rt *Runtime) {
 			return nil, fmt.Errorf("second argument must be a string verificationKeyID, got %T", args[1])
 		}
 
+		path, err := getSecureFilePath(string(filename), pathTypeTree)
+		if err != nil {
+			return nil, err
+		}
+
 		// Use global service
 		service := getTreeSerializerService()
-		isValid, err := service.ValidateSecureAgent(string(filename), string(verificationKeyID))
+		isValid, err := service.ValidateSecureAgent(path, string(verificationKeyID))
 		if err != nil {
 			return nil, fmt.Errorf("failed to validate secure tree: %v", err)
 		}
@@ -403,9 +430,14 @@ func RegisterTreeFunctions(rt *Runtime) {
 			return nil, fmt.Errorf("argument must be a string filename, got %T", args[0])
 		}
 
+		path, err := getSecureFilePath(string(filename), pathTypeTree)
+		if err != nil {
+			return nil, err
+		}
+
 		// Use global service
 		service := getTreeSerializerService()
-		metadata, err := service.GetMetadata(string(filename))
+		metadata, err := service.GetMetadata(path)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get metadata: %v", err)
 		}
@@ -419,6 +451,241 @@ func RegisterTreeFunctions(rt *Runtime) {
 		return MapValue{Values: values}, nil
 	})
 
+	// treeReencrypt(filename [, newKeyID]) - encrypt a secure tree again with
+	// the current version of its key, or with another key
+	rt.Register("treeReencrypt", func(args ...Value) (Value, error) {
+		if len(args) < 1 || len(args) > 2 {
+			return nil, errors.New("treeReencrypt requires 1-2 arguments: filename, [newKeyID]")
+		}
+
+		// Unwrap scope entries
+		for i, arg := range args {
+			if tvar, ok := arg.(ScopeEntry); ok {
+				args[i] = tvar.Value
+			}
+		}
+
+		filename, ok := args[0].(Str)
+		if !ok {
+			return nil, fmt.Errorf("first argument must be a string filename, got %T", args[0])
+		}
+		var newKeyID Str
+		if len(args) > 1 {
+			if newKeyID, ok = args[1].(Str); !ok {
+				return nil, fmt.Errorf("second argument must be a string newKeyID, got %T", args[1])
+			}
+		}
+
+		path, err := getSecureFilePath(string(filename), pathTypeTree)
+		if err != nil {
+			return nil, err
+		}
+		result, err := getTreeSerializerService().ReencryptSecureAgent(path, string(newKeyID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to re-encrypt secure tree: %v", err)
+		}
+		m := NewMap()
+		m.Set("file", filename)
+		m.Set("fromKey", Str(result.FromKey))
+		m.Set("fromVersion", Number(result.FromVersion))
+		m.Set("toKey", Str(result.ToKey))
+		m.Set("toVersion", Number(result.ToVersion))
+		m.Set("algorithm", Str(result.Algorithm))
+		m.Set("rewritten", Bool(result.Rewritten))
+		return m, nil
+	})
+
+	// treeIndex(node, attribute...) - index a tree by node name and the values
+	// of the given attributes for queryNode queries
+	rt.Register("treeIndex", func(args ...Value) (Value, error) {
+		if len(args) < 1 {
+			return nil, errors.New("treeIndex requires at least 1 argument: node, [attribute...]")
+		}
+
+		// Unwrap scope entries
+		for i, arg := range args {
+			if tvar, ok := arg.(ScopeEntry); ok {
+				args[i] = tvar.Value
+			}
+		}
+
+		node, ok := args[0].(TreeNode)
+		if !ok {
+			return nil, fmt.Errorf("first argument must be a TreeNode, got %T", args[0])
+		}
+		var attrs []string
+		addAttr := func(v Value) error {
+			name, ok := v.(Str)
+			if !ok {
+				return fmt.Errorf("attribute names must be strings, got %T", v)
+			}
+			attrs = append(attrs, string(name))
+			return nil
+		}
+		for _, arg := range args[1:] {
+			if arr, ok := arg.(*ArrayValue); ok {
+				for i := 0; i < arr.Length(); i++ {
+					if err := addAttr(arr.Get(i)); err != nil {
+						return nil, err
+					}
+				}
+				continue
+			}
+			if err := addAttr(arg); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := indexTree(node, attrs); err != nil {
+			return nil, err
+		}
+		return node, nil
+	})
+
+	// treeDropIndex(node) - remove the index of a tree
+	rt.Register("treeDropIndex", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, errors.New("treeDropIndex requires 1 argument: node")
+		}
+		if tvar, ok := args[0].(ScopeEntry); ok {
+			args[0] = tvar.Value
+		}
+		node, ok := args[0].(TreeNode)
+		if !ok {
+			return nil, fmt.Errorf("argument must be a TreeNode, got %T", args[0])
+		}
+		return Bool(dropTreeIndex(node)), nil
+	})
+
+	// treeOpenLazy(filename [, options]) - open a JSON or XML file under the
+	// data path as a tree whose nodes are read as they are reached
+	rt.Register("treeOpenLazy", func(args ...Value) (Value, error) {
+		if len(args) < 1 || len(args) > 2 {
+			return nil, errors.New("treeOpenLazy requires 1-2 arguments: filename, [options]")
+		}
+
+		// Unwrap scope entries
+		for i, arg := range args {
+			if tvar, ok := arg.(ScopeEntry); ok {
+				args[i] = tvar.Value
+			}
+		}
+
+		filename, ok := args[0].(Str)
+		if !ok {
+			return nil, fmt.Errorf("first argument must be a string filename, got %T", args[0])
+		}
+		options, err := lazyTreeOptions(args[1:])
+		if err != nil {
+			return nil, err
+		}
+		format := strings.TrimPrefix(strings.ToLower(filepath.Ext(string(filename))), ".")
+		if f, ok := options["format"].(Str); ok {
+			format = strings.ToLower(string(f))
+		}
+		capacity := 0
+		if n, ok := options["cacheSize"].(Number); ok {
+			capacity = int(n)
+		}
+
+		path, err := getSecureFilePath(string(filename), "data")
+		if err != nil {
+			return nil, err
+		}
+		var source lazySource
+		root := lazyRef{name: "root"}
+		switch format {
+		case "json":
+			source = &jsonFileSource{path: path}
+		case "xml":
+			source = &xmlFileSource{path: path}
+		default:
+			return nil, fmt.Errorf("treeOpenLazy reads json or xml files, not %q", format)
+		}
+		node, err := openLazyTree(source, root, capacity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open lazy tree: %v", err)
+		}
+		return node, nil
+	})
+
+	// treeOpenLazyCouchbase(nodeName, documentId [, options]) - open a tree
+	// kept as one Couchbase document per node, from its root document
+	rt.Register("treeOpenLazyCouchbase", func(args ...Value) (Value, error) {
+		if len(args) < 2 || len(args) > 3 {
+			return nil, errors.New("treeOpenLazyCouchbase requires 2-3 arguments: nodeName, documentId, [options]")
+		}
+
+		// Unwrap scope entries
+		for i, arg := range args {
+			if tvar, ok := arg.(ScopeEntry); ok {
+				args[i] = tvar.Value
+			}
+		}
+
+		nodeName, ok := args[0].(Str)
+		if !ok {
+			return nil, fmt.Errorf("first argument must be a string node name, got %T", args[0])
+		}
+		docID, ok := args[1].(Str)
+		if !ok {
+			return nil, fmt.Errorf("second argument must be a string document id, got %T", args[1])
+		}
+		options, err := lazyTreeOptions(args[2:])
+		if err != nil {
+			return nil, err
+		}
+		cbNode, err := getCouchbaseNode(rt, string(nodeName))
+		if err != nil {
+			return nil, err
+		}
+		if cbNode.Collection == nil {
+			return nil, fmt.Errorf("couchbase node '%s' is not connected", nodeName)
+		}
+		source := &couchbaseLazySource{collection: cbNode.Collection, nameField: "name", childrenField: "children"}
+		if f, ok := options["nameField"].(Str); ok {
+			source.nameField = string(f)
+		}
+		if f, ok := options["childrenField"].(Str); ok {
+			source.childrenField = string(f)
+		}
+		capacity := 0
+		if n, ok := options["cacheSize"].(Number); ok {
+			capacity = int(n)
+		}
+
+		node, err := openLazyTree(source, lazyRef{key: string(docID)}, capacity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open lazy tree: %v", err)
+		}
+		return node, nil
+	})
+
+	// treeLazyStats(node) - how much of the lazy tree a node belongs to is held
+	rt.Register("treeLazyStats", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, errors.New("treeLazyStats requires 1 argument: node")
+		}
+		if tvar, ok := args[0].(ScopeEntry); ok {
+			args[0] = tvar.Value
+		}
+		node, ok := args[0].(*LazyNode)
+		if !ok {
+			return nil, fmt.Errorf("argument must be a lazy tree node, got %T", args[0])
+		}
+		stats := node.Stats()
+		m := NewMap()
+		m.Set("source", Str(stats.Source))
+		m.Set("capacity", Number(stats.Capacity))
+		m.Set("held", Number(stats.Held))
+		m.Set("loads", Number(stats.Loads))
+		m.Set("evictions", Number(stats.Evictions))
+		if stats.LastError != "" {
+			m.Set("error", Str(stats.LastError))
+		}
+		return m, nil
+	})
+
 	// treeFind function - returns all matching records
 	rt.Register("treeFind", func(args ...Value) (Value, error) {
 		// New semantics:
@@ -0,0 +1,319 @@
+package chariot
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Where the key of a secure tree is kept, as recorded in its key_source
+// metadata. Trees saved before keys had a source used vault secrets.
+const (
+	treeKeySourceKeystore = "keystore"
+	treeKeySourceVault    = "vault"
+)
+
+// treeCipher is a key secure trees are encrypted with. Keystore keys are
+// versioned and fix the algorithm; vault secrets are base64 keys used with
+// AES-GCM unless another algorithm is asked for.
+type treeCipher struct {
+	source    string
+	keyID     string
+	version   int // keystore keys only
+	algorithm string
+	aead      cipher.AEAD
+}
+
+func newTreeAEAD(algorithm string, key []byte) (cipher.AEAD, error) {
+	switch algorithm {
+	case KeyTypeAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case KeyTypeChaCha20:
+		return chacha20poly1305.New(key)
+	default:
+		return nil, fmt.Errorf("unknown encryption algorithm %q (want aes-gcm or chacha20-poly1305)", algorithm)
+	}
+}
+
+// resolveTreeCipher finds the key keyID names: version of a keystore key (0
+// for the current one), or a vault secret when the keystore does not hold
+// it. source "" looks in the keystore first; algorithm "" uses the key's.
+func resolveTreeCipher(source, keyID string, version int, algorithm string) (*treeCipher, error) {
+	tc := &treeCipher{source: source, keyID: keyID}
+	var key []byte
+	if source == "" || source == treeKeySourceKeystore {
+		keyType, v, material, err := getKeyStore().encryptionKey(keyID, version)
+		switch {
+		case err == nil:
+			if algorithm != "" && algorithm != keyType {
+				return nil, fmt.Errorf("key %s is a %s key and cannot encrypt with %s", keyID, keyType, algorithm)
+			}
+			tc.source, tc.version, tc.algorithm, key = treeKeySourceKeystore, v, keyType, material
+		case source == "" && errors.Is(err, ErrKeyNotFound):
+			tc.source = treeKeySourceVault
+		default:
+			return nil, err
+		}
+	}
+	if tc.source == treeKeySourceVault {
+		material, err := getCryptoManager().getKeyFromVault(keyID)
+		if err != nil {
+			return nil, err
+		}
+		tc.algorithm, key = algorithm, material
+		if tc.algorithm == "" {
+			tc.algorithm = KeyTypeAESGCM
+		}
+	}
+	defer SecureZero(key)
+	aead, err := newTreeAEAD(tc.algorithm, key)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", keyID, err)
+	}
+	tc.aead = aead
+	return tc, nil
+}
+
+// additionalData binds keystore ciphertexts to the key version. Vault
+// ciphertexts have none, as trees encrypted before keystore keys had none.
+func (tc *treeCipher) additionalData() []byte {
+	if tc.source != treeKeySourceKeystore {
+		return nil
+	}
+	return []byte(keyID(tc.keyID, tc.version))
+}
+
+// seal returns the nonce followed by the ciphertext of data.
+func (tc *treeCipher) seal(data []byte) ([]byte, error) {
+	nonce := make([]byte, tc.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return tc.aead.Seal(nonce, nonce, data, tc.additionalData()), nil
+}
+
+func (tc *treeCipher) open(data []byte) ([]byte, error) {
+	if len(data) < tc.aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	n := tc.aead.NonceSize()
+	plain, err := tc.aead.Open(nil, data[:n], data[n:], tc.additionalData())
+	if err != nil {
+		return nil, fmt.Errorf("%s decryption failed: %v", tc.algorithm, err)
+	}
+	return plain, nil
+}
+
+// record stores in container metadata what decrypting the tree takes.
+func (tc *treeCipher) record(metadata map[string]interface{}) {
+	metadata["encrypted"] = true
+	metadata["encryption_key_id"] = tc.keyID
+	metadata["encryption_key_version"] = tc.version
+	metadata["encryption_algorithm"] = tc.algorithm
+	metadata["key_source"] = tc.source
+}
+
+// containerCipher returns the key to decrypt container with. keyID "" means
+// the key it records; its version, algorithm and source are those recorded
+// when keyID is that key.
+func containerCipher(container *SignedAgentContainer, keyID string) (*treeCipher, error) {
+	info := secureTreeInfo(container)
+	if keyID == "" || keyID == info.KeyID {
+		if info.KeyID == "" {
+			return nil, errors.New("the tree is not encrypted")
+		}
+		return resolveTreeCipher(info.KeySource, info.KeyID, info.KeyVersion, info.Algorithm)
+	}
+	return resolveTreeCipher("", keyID, 0, "")
+}
+
+// SecureTreeInfo describes a tree saved by treeSaveSecure and the key it is
+// encrypted with, without decrypting it.
+type SecureTreeInfo struct {
+	File         string    `json:"file"` // Relative to the tree directory
+	Saved        time.Time `json:"saved"`
+	Encrypted    bool      `json:"encrypted"`
+	KeyID        string    `json:"key_id,omitempty"`
+	KeyVersion   int       `json:"key_version,omitempty"` // Keystore keys only
+	KeySource    string    `json:"key_source,omitempty"`  // keystore or vault
+	Algorithm    string    `json:"algorithm,omitempty"`
+	Signed       bool      `json:"signed"`
+	SigningKeyID string    `json:"signing_key_id,omitempty"`
+}
+
+func secureTreeInfo(container *SignedAgentContainer) SecureTreeInfo {
+	info := SecureTreeInfo{
+		Saved:        container.Timestamp,
+		Signed:       container.Signature != nil,
+		SigningKeyID: container.SigningKeyID,
+	}
+	info.Encrypted, _ = container.Metadata["encrypted"].(bool)
+	if !info.Encrypted {
+		return info
+	}
+	info.KeyID, _ = container.Metadata["encryption_key_id"].(string)
+	info.KeyVersion, _ = container.Metadata["encryption_key_version"].(int)
+	info.KeySource, _ = container.Metadata["key_source"].(string)
+	info.Algorithm, _ = container.Metadata["encryption_algorithm"].(string)
+	if info.KeySource == "" {
+		info.KeySource = treeKeySourceVault
+	}
+	if info.Algorithm == "" {
+		info.Algorithm = KeyTypeAESGCM
+	}
+	return info
+}
+
+func decodeSignedContainer(r io.Reader) (*SignedAgentContainer, error) {
+	var container SignedAgentContainer
+	if err := gob.NewDecoder(r).Decode(&container); err != nil {
+		return nil, err
+	}
+	if container.Version == "" || container.EncryptedData == nil {
+		return nil, errors.New("not a secure tree")
+	}
+	return &container, nil
+}
+
+// ListSecureTrees describes the secure trees under the tree directory, by
+// file name. Other files there are skipped.
+func ListSecureTrees() ([]SecureTreeInfo, error) {
+	root := cfg.ChariotConfig.TreePath
+	trees := []SecureTreeInfo{}
+	if root == "" {
+		return trees, nil
+	}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil // Removed since listed
+		}
+		container, err := decodeSignedContainer(f)
+		f.Close()
+		if err != nil {
+			return nil
+		}
+		info := secureTreeInfo(container)
+		info.File, _ = filepath.Rel(root, path)
+		trees = append(trees, info)
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	}
+	sort.Slice(trees, func(i, j int) bool { return trees[i].File < trees[j].File })
+	return trees, err
+}
+
+// ReencryptResult is the outcome of re-encrypting a secure tree.
+type ReencryptResult struct {
+	File        string `json:"file"`
+	FromKey     string `json:"from_key"`
+	FromVersion int    `json:"from_version,omitempty"`
+	ToKey       string `json:"to_key"`
+	ToVersion   int    `json:"to_version,omitempty"`
+	Algorithm   string `json:"algorithm"`
+	Rewritten   bool   `json:"rewritten"` // False when already encrypted with the target key
+}
+
+// ReencryptSecureAgent encrypts a secure tree again with the current
+// version of newKeyID, or of the key it is encrypted with when newKeyID is
+// "", after checking its signature and checksum. The tree keeps its
+// timestamp and watermark and is signed again with the key that signed it.
+// A tree saved unencrypted is encrypted with newKeyID.
+func (ts *TreeSerializerService) ReencryptSecureAgent(filename, newKeyID string) (*ReencryptResult, error) {
+	container, err := ts.loadSignedContainer(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load container: %v", err)
+	}
+	if container.Signature != nil {
+		if err := ts.verifySignature(container, ""); err != nil {
+			return nil, fmt.Errorf("signature verification failed: %v", err)
+		}
+	}
+	if container.Checksum != nil && !bytes.Equal(getCryptoManager().HashSHA256(container.EncryptedData), container.Checksum) {
+		return nil, errors.New("checksum verification failed - data may be corrupted")
+	}
+
+	from := secureTreeInfo(container)
+	result := &ReencryptResult{File: filename, FromKey: from.KeyID, FromVersion: from.KeyVersion, ToKey: newKeyID}
+	if result.ToKey == "" {
+		result.ToKey = from.KeyID
+	}
+	if result.ToKey == "" {
+		return nil, errors.New("the tree is not encrypted; give the key to encrypt it with")
+	}
+
+	data := container.EncryptedData
+	if from.Encrypted {
+		old, err := containerCipher(container, "")
+		if err != nil {
+			return nil, err
+		}
+		if data, err = old.open(data); err != nil {
+			return nil, fmt.Errorf("decryption failed with key %s: %v", from.KeyID, err)
+		}
+	}
+	algorithm := ""
+	if result.ToKey == from.KeyID {
+		algorithm = from.Algorithm // Vault keys keep theirs
+	}
+	to, err := resolveTreeCipher("", result.ToKey, 0, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	result.ToVersion, result.Algorithm = to.version, to.algorithm
+	if from.Encrypted && to.keyID == from.KeyID && to.source == from.KeySource && to.version == from.KeyVersion && to.algorithm == from.Algorithm {
+		return result, nil
+	}
+
+	if container.EncryptedData, err = to.seal(data); err != nil {
+		return nil, err
+	}
+	if container.Metadata == nil {
+		container.Metadata = map[string]interface{}{}
+	}
+	to.record(container.Metadata)
+	container.Metadata["reencrypted_at"] = time.Now().UTC().Format(time.RFC3339)
+	if container.Checksum != nil {
+		container.Checksum = getCryptoManager().HashSHA256(container.EncryptedData)
+	}
+	if container.Signature != nil {
+		if container.Signature, err = ts.signContainer(container, container.SigningKeyID); err != nil {
+			return nil, fmt.Errorf("signing failed with key %s: %v", container.SigningKeyID, err)
+		}
+	}
+	if err := ts.saveSignedContainer(container, filename, &SecureSerializationOptions{}); err != nil {
+		return nil, err
+	}
+	result.Rewritten = true
+	ts.logger.Info("Secure agent re-encrypted",
+		zap.String("file", filename),
+		zap.String("from_key", result.FromKey),
+		zap.Int("from_version", result.FromVersion),
+		zap.String("to_key", result.ToKey),
+		zap.Int("to_version", result.ToVersion),
+		zap.String("algorithm", result.Algorithm))
+	return result, nil
+}
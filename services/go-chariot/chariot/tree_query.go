@@ -0,0 +1,616 @@
+package chariot
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A tree query selects nodes by name and attribute values:
+//
+//	orders[status='open' and total>100]
+//	catalog/item[price<=20 or featured]
+//	*[not(archived) and sku startswith 'AB-']
+//
+// The first step matches nodes anywhere in the tree, the root included; each
+// step after a / matches children of the nodes the previous one matched. *
+// matches any name. A predicate compares attributes with =, !=, <, <=, >, >=,
+// contains, startswith or endswith, as treeSearch does; an attribute alone
+// tests that the node has it. Comparisons combine with and, or, not and
+// parentheses.
+//
+// Queries walk the tree unless treeIndex indexed it, in which case the first
+// step is looked up by node name and by the indexed attributes it compares
+// with =, <, <=, > or >=.
+
+// treeQuery is a compiled tree query.
+type treeQuery struct {
+	steps []queryStep
+}
+
+type queryStep struct {
+	name string    // "*" for any
+	pred queryPred // nil when the step has none
+}
+
+type queryPred interface {
+	match(n TreeNode) bool
+}
+
+// queryTest compares an attribute with a value; op "" tests it exists.
+type queryTest struct {
+	attr  string
+	op    string
+	value Value
+}
+
+type queryAnd []queryPred
+type queryOr []queryPred
+type queryNot struct{ pred queryPred }
+
+func (t *queryTest) match(n TreeNode) bool {
+	v, ok := n.GetAttribute(t.attr)
+	if !ok {
+		return false
+	}
+	if t.op == "" {
+		return true
+	}
+	return compareValuesOp(v, t.value, t.op)
+}
+
+func (a queryAnd) match(n TreeNode) bool {
+	for _, p := range a {
+		if !p.match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (o queryOr) match(n TreeNode) bool {
+	for _, p := range o {
+		if p.match(n) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q queryNot) match(n TreeNode) bool {
+	return !q.pred.match(n)
+}
+
+// compileTreeQuery parses a query.
+func compileTreeQuery(src string) (*treeQuery, error) {
+	p := &queryParser{src: src}
+	q := &treeQuery{}
+	for {
+		step, err := p.step()
+		if err != nil {
+			return nil, err
+		}
+		q.steps = append(q.steps, step)
+		p.skipSpace()
+		if p.pos == len(p.src) {
+			return q, nil
+		}
+		if p.src[p.pos] != '/' {
+			return nil, p.errorf("expected / or end of query")
+		}
+		p.pos++
+	}
+}
+
+type queryParser struct {
+	src string
+	pos int
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("query %q at %d: %s", p.src, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func isQueryNameByte(c byte, first bool) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == '@', c >= 0x80:
+		return true
+	case c >= '0' && c <= '9', c == '-', c == '.', c == ':':
+		return !first
+	}
+	return false
+}
+
+// name reads a node or attribute name.
+func (p *queryParser) name() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) && isQueryNameByte(p.src[p.pos], p.pos == start) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// keyword consumes word when it is next, as a whole word.
+func (p *queryParser) keyword(word string) bool {
+	p.skipSpace()
+	end := p.pos + len(word)
+	if end > len(p.src) || !strings.EqualFold(p.src[p.pos:end], word) {
+		return false
+	}
+	if end < len(p.src) && isQueryNameByte(p.src[end], false) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *queryParser) step() (queryStep, error) {
+	p.skipSpace()
+	var step queryStep
+	if p.pos < len(p.src) && p.src[p.pos] == '*' {
+		step.name = "*"
+		p.pos++
+	} else if step.name = p.name(); step.name == "" {
+		return step, p.errorf("expected a node name or *")
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] == '[' {
+		p.pos++
+		pred, err := p.or()
+		if err != nil {
+			return step, err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.src) || p.src[p.pos] != ']' {
+			return step, p.errorf("expected ]")
+		}
+		p.pos++
+		step.pred = pred
+	}
+	return step, nil
+}
+
+func (p *queryParser) or() (queryPred, error) {
+	var terms queryOr
+	for {
+		term, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if !p.keyword("or") {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *queryParser) and() (queryPred, error) {
+	var terms queryAnd
+	for {
+		term, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if !p.keyword("and") {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *queryParser) unary() (queryPred, error) {
+	if p.keyword("not") {
+		pred, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return queryNot{pred}, nil
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] == '(' {
+		p.pos++
+		pred, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.src) || p.src[p.pos] != ')' {
+			return nil, p.errorf("expected )")
+		}
+		p.pos++
+		return pred, nil
+	}
+	return p.comparison()
+}
+
+var queryWordOps = []string{"contains", "startswith", "endswith"}
+
+func (p *queryParser) comparison() (queryPred, error) {
+	attr := p.name()
+	if attr == "" {
+		return nil, p.errorf("expected an attribute name")
+	}
+	test := &queryTest{attr: attr}
+	p.skipSpace()
+	for _, op := range []string{"!=", "<=", ">=", "=", "<", ">"} {
+		if strings.HasPrefix(p.src[p.pos:], op) {
+			test.op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if test.op == "" {
+		for _, op := range queryWordOps {
+			if p.keyword(op) {
+				test.op = op
+				break
+			}
+		}
+	}
+	if test.op == "" {
+		return test, nil // Exists
+	}
+	value, err := p.literal()
+	if err != nil {
+		return nil, err
+	}
+	test.value = value
+	return test, nil
+}
+
+func (p *queryParser) literal() (Value, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("expected a value")
+	}
+	switch c := p.src[p.pos]; {
+	case c == '\'' || c == '"':
+		var b strings.Builder
+		for i := p.pos + 1; i < len(p.src); i++ {
+			switch p.src[i] {
+			case '\\':
+				if i+1 < len(p.src) {
+					i++
+					b.WriteByte(p.src[i])
+				}
+			case c:
+				p.pos = i + 1
+				return Str(b.String()), nil
+			default:
+				b.WriteByte(p.src[i])
+			}
+		}
+		return nil, p.errorf("unterminated string")
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		text := p.src[start:p.pos]
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			p.pos = start
+			return nil, p.errorf("invalid number %q", text)
+		}
+		return Number(f), nil
+	}
+	if p.keyword("true") {
+		return Bool(true), nil
+	}
+	if p.keyword("false") {
+		return Bool(false), nil
+	}
+	return nil, p.errorf("expected a string, number, true or false")
+}
+
+// run returns the nodes of the tree under root the query selects, in
+// document order.
+func (q *treeQuery) run(root TreeNode) []TreeNode {
+	first := q.steps[0]
+	var candidates []TreeNode
+	if idx := currentTreeIndex(root); idx != nil {
+		candidates = idx.candidates(first)
+	}
+	if candidates == nil {
+		walkTreeNodes(root, func(n TreeNode) { candidates = append(candidates, n) })
+	}
+	matches := []TreeNode{}
+	for _, n := range candidates {
+		if first.matches(n) {
+			matches = append(matches, n)
+		}
+	}
+	for _, step := range q.steps[1:] {
+		var next []TreeNode
+		for _, m := range matches {
+			for _, child := range m.GetChildren() {
+				if step.matches(child) {
+					next = append(next, child)
+				}
+			}
+		}
+		matches = next
+	}
+	if matches == nil {
+		matches = []TreeNode{}
+	}
+	return matches
+}
+
+func (s *queryStep) matches(n TreeNode) bool {
+	return (s.name == "*" || n.Name() == s.name) && (s.pred == nil || s.pred.match(n))
+}
+
+// walkTreeNodes visits n and its descendants in document order. Unlike
+// Traverse, it visits the nodes as their parents hold them, not the
+// TreeNodeImpl they embed.
+func walkTreeNodes(n TreeNode, visit func(TreeNode)) {
+	visit(n)
+	for _, child := range n.GetChildren() {
+		walkTreeNodes(child, visit)
+	}
+}
+
+// baseNode returns the TreeNodeImpl of the nodes built on it, which keeps
+// the generation and the index of their tree.
+func (n *TreeNodeImpl) baseNode() *TreeNodeImpl { return n }
+
+type baseNoder interface{ baseNode() *TreeNodeImpl }
+
+// markTreeChanged records that n changed, in n and its ancestors, so that
+// the index of the tree is rebuilt before it is next used.
+func markTreeChanged(n TreeNode) {
+	for n != nil {
+		b, ok := n.(baseNoder)
+		if !ok {
+			return
+		}
+		base := b.baseNode()
+		if base == nil {
+			return
+		}
+		base.generation++
+		n = base.ParentNode
+	}
+}
+
+// treeIndex holds the nodes of a tree by name and by the values of some of
+// their attributes.
+type treeIndex struct {
+	attrs      []string
+	generation uint64
+	order      map[TreeNode]int // Document order
+	names      map[string][]TreeNode
+	equal      map[string]map[indexKey][]TreeNode
+	numbers    map[string][]indexedNumber // Sorted by value
+}
+
+type indexKey struct {
+	kind byte
+	str  string
+	num  float64
+}
+
+type indexedNumber struct {
+	value float64
+	node  TreeNode
+}
+
+// keyOf returns the key values equal to v share, as valuesEqual compares
+// them; other values equal none.
+func keyOf(v Value) (indexKey, bool) {
+	switch val := v.(type) {
+	case Str:
+		return indexKey{kind: 's', str: string(val)}, true
+	case Number:
+		f := float64(val)
+		if math.IsNaN(f) {
+			return indexKey{}, false
+		}
+		if f == 0 {
+			f = 0 // -0 equals 0
+		}
+		return indexKey{kind: 'n', num: f}, true
+	case Bool:
+		if val {
+			return indexKey{kind: 'b', str: "true"}, true
+		}
+		return indexKey{kind: 'b'}, true
+	}
+	return indexKey{}, false
+}
+
+// indexTree indexes the tree under root by node name and by the values of
+// attrs, replacing any index it had.
+func indexTree(root TreeNode, attrs []string) error {
+	b, ok := root.(baseNoder)
+	if !ok || b.baseNode() == nil {
+		return fmt.Errorf("%s nodes cannot be indexed", root.GetTypeLabel())
+	}
+	base := b.baseNode()
+	base.index = buildTreeIndex(root, attrs)
+	base.index.generation = base.generation
+	return nil
+}
+
+// dropTreeIndex removes the index of the tree under root, reporting whether
+// it had one.
+func dropTreeIndex(root TreeNode) bool {
+	b, ok := root.(baseNoder)
+	if !ok || b.baseNode() == nil || b.baseNode().index == nil {
+		return false
+	}
+	b.baseNode().index = nil
+	return true
+}
+
+// currentTreeIndex returns the index of the tree under root, rebuilding it
+// when the tree changed since it was built, or nil when it has none.
+func currentTreeIndex(root TreeNode) *treeIndex {
+	b, ok := root.(baseNoder)
+	if !ok || b.baseNode() == nil || b.baseNode().index == nil {
+		return nil
+	}
+	base := b.baseNode()
+	if base.index.generation != base.generation {
+		base.index = buildTreeIndex(root, base.index.attrs)
+		base.index.generation = base.generation
+	}
+	return base.index
+}
+
+func buildTreeIndex(root TreeNode, attrs []string) *treeIndex {
+	idx := &treeIndex{
+		attrs:   attrs,
+		order:   map[TreeNode]int{},
+		names:   map[string][]TreeNode{},
+		equal:   map[string]map[indexKey][]TreeNode{},
+		numbers: map[string][]indexedNumber{},
+	}
+	for _, attr := range attrs {
+		idx.equal[attr] = map[indexKey][]TreeNode{}
+	}
+	walkTreeNodes(root, func(n TreeNode) {
+		if _, seen := idx.order[n]; seen {
+			return
+		}
+		idx.order[n] = len(idx.order)
+		idx.names[n.Name()] = append(idx.names[n.Name()], n)
+		for _, attr := range attrs {
+			v, ok := n.GetAttribute(attr)
+			if !ok {
+				continue
+			}
+			if key, ok := keyOf(v); ok {
+				idx.equal[attr][key] = append(idx.equal[attr][key], n)
+			}
+			if num, ok := v.(Number); ok && !math.IsNaN(float64(num)) {
+				idx.numbers[attr] = append(idx.numbers[attr], indexedNumber{float64(num), n})
+			}
+		}
+	})
+	for _, nums := range idx.numbers {
+		sort.SliceStable(nums, func(i, j int) bool { return nums[i].value < nums[j].value })
+	}
+	return idx
+}
+
+// candidates returns the nodes the first step of a query can match, in
+// document order, or nil when the index cannot narrow them down.
+func (idx *treeIndex) candidates(step queryStep) []TreeNode {
+	var best []TreeNode
+	found := false
+	if step.name != "*" {
+		best, found = idx.names[step.name], true
+	}
+	if step.pred != nil {
+		if nodes, ok := idx.lookup(step.pred); ok && (!found || len(nodes) < len(best)) {
+			best, found = idx.sorted(nodes), true
+		}
+	}
+	if !found {
+		return nil
+	}
+	if best == nil {
+		best = []TreeNode{}
+	}
+	return best
+}
+
+// lookup returns a superset of the nodes pred matches, when the indexed
+// attributes allow finding them without a walk.
+func (idx *treeIndex) lookup(pred queryPred) ([]TreeNode, bool) {
+	switch p := pred.(type) {
+	case *queryTest:
+		equal, indexed := idx.equal[p.attr]
+		if !indexed {
+			return nil, false
+		}
+		switch p.op {
+		case "=", "==":
+			key, ok := keyOf(p.value)
+			if !ok {
+				return nil, true // Equal to nothing
+			}
+			return equal[key], true
+		case "<", "<=", ">", ">=":
+			num, ok := p.value.(Number)
+			if !ok {
+				return nil, true // Only numbers compare
+			}
+			return idx.numberRange(p.attr, p.op, float64(num)), true
+		}
+	case queryAnd:
+		var best []TreeNode
+		found := false
+		for _, term := range p {
+			if nodes, ok := idx.lookup(term); ok && (!found || len(nodes) < len(best)) {
+				best, found = nodes, true
+			}
+		}
+		return best, found
+	case queryOr:
+		seen := map[TreeNode]bool{}
+		var union []TreeNode
+		for _, term := range p {
+			nodes, ok := idx.lookup(term)
+			if !ok {
+				return nil, false
+			}
+			for _, n := range nodes {
+				if !seen[n] {
+					seen[n] = true
+					union = append(union, n)
+				}
+			}
+		}
+		return union, true
+	}
+	return nil, false
+}
+
+func (idx *treeIndex) numberRange(attr, op string, bound float64) []TreeNode {
+	nums := idx.numbers[attr]
+	var lo, hi int
+	switch op {
+	case "<":
+		lo, hi = 0, sort.Search(len(nums), func(i int) bool { return nums[i].value >= bound })
+	case "<=":
+		lo, hi = 0, sort.Search(len(nums), func(i int) bool { return nums[i].value > bound })
+	case ">":
+		lo, hi = sort.Search(len(nums), func(i int) bool { return nums[i].value > bound }), len(nums)
+	case ">=":
+		lo, hi = sort.Search(len(nums), func(i int) bool { return nums[i].value >= bound }), len(nums)
+	}
+	nodes := make([]TreeNode, 0, hi-lo)
+	for _, n := range nums[lo:hi] {
+		nodes = append(nodes, n.node)
+	}
+	return nodes
+}
+
+// sorted returns nodes in document order.
+func (idx *treeIndex) sorted(nodes []TreeNode) []TreeNode {
+	out := append([]TreeNode(nil), nodes...)
+	sort.Slice(out, func(i, j int) bool { return idx.order[out[i]] < idx.order[out[j]] })
+	return out
+}
@@ -56,7 +56,8 @@ func init() {
 
 // Update the options structures to use Key IDs
 type SecureSerializationOptions struct {
-	EncryptionKeyID   string // Key ID in Azure Key Vault
+	EncryptionKeyID   string // Keystore encryption key, or key ID in Azure Key Vault
+	Algorithm         string // aes-gcm or chacha20-poly1305; keystore keys fix their own
 	SigningKeyID      string // Signing key ID in Azure Key Vault
 	VerificationKeyID string // Verification key ID (optional)
 	Checksum          bool
@@ -66,7 +67,7 @@ type SecureSerializationOptions struct {
 }
 
 type SecureDeserializationOptions struct {
-	DecryptionKeyID   string // Key ID in Azure Key Vault
+	DecryptionKeyID   string // Key ID; "" for the one the tree records
 	VerificationKeyID string // Verification key ID in Azure Key Vault
 	RequireSignature  bool
 	AuditTrail        bool
@@ -1208,16 +1209,6 @@ func (s *TreeNodeSerializer) valueToString(val interface{}) string {
 	}
 }
 
-func (ts *TreeSerializerService) encryptData(data []byte, keyID string) ([]byte, error) {
-	crypto := getCryptoManager()
-	return crypto.EncryptWithKey(keyID, data) // keyID first, data second
-}
-
-func (ts *TreeSerializerService) decryptData(ciphertext []byte, keyID string) ([]byte, error) {
-	crypto := getCryptoManager()
-	return crypto.DecryptWithKey(keyID, ciphertext) // keyID first, ciphertext second
-}
-
 func (ts *TreeSerializerService) signContainer(container *SignedAgentContainer, signingKeyID string) ([]byte, error) {
 	crypto := getCryptoManager()
 
@@ -1272,10 +1263,10 @@ func (ts *TreeSerializerService) verifySignature(container *SignedAgentContainer
 func (ts *TreeSerializerService) SaveSecureAgent(node TreeNode, filename string, options *SecureSerializationOptions) error {
 	ts.logger.Info("Starting secure agent serialization", zap.String("file", filename), zap.String("encryption_key_id", options.EncryptionKeyID))
 
-	// Step 1: Serialize to GOB (unchanged)
+	// Step 1: Serialize to GOB, as the interface LoadSecureAgent decodes into
 	var gobBuffer bytes.Buffer
 	encoder := gob.NewEncoder(&gobBuffer)
-	if err := encoder.Encode(node); err != nil {
+	if err := encoder.Encode(&node); err != nil {
 		ts.logger.Error("GOB encoding failed", zap.Error(err))
 		return fmt.Errorf("GOB encoding failed: %v", err)
 	}
@@ -1306,16 +1297,23 @@ func (ts *TreeSerializerService) SaveSecureAgent(node TreeNode, filename string,
 		zap.Int("compressed_size", len(compressedData)),
 		zap.Float64("compression_ratio", float64(len(compressedData))/float64(len(agentData))))
 
-	// Step 3: Encrypt using Key Vault key ID - FIXED PARAMETER ORDER
+	// Step 3: Encrypt with the current version of a keystore key, or a Key Vault key
 	finalData := compressedData
+	var encryption *treeCipher
 	if options.EncryptionKeyID != "" {
-		encrypted, err := ts.encryptData(compressedData, options.EncryptionKeyID)
+		encryption, err = resolveTreeCipher("", options.EncryptionKeyID, 0, options.Algorithm)
+		if err == nil {
+			finalData, err = encryption.seal(compressedData)
+		}
 		if err != nil {
 			ts.logger.Error("Encryption failed", zap.Error(err), zap.String("key_id", options.EncryptionKeyID))
 			return fmt.Errorf("encryption failed with key %s: %v", options.EncryptionKeyID, err)
 		}
-		finalData = encrypted
-		ts.logger.Info("Encryption complete", zap.Int("encrypted_size", len(finalData)), zap.String("key_id", options.EncryptionKeyID))
+		ts.logger.Info("Encryption complete",
+			zap.Int("encrypted_size", len(finalData)),
+			zap.String("key_id", options.EncryptionKeyID),
+			zap.Int("key_version", encryption.version),
+			zap.String("algorithm", encryption.algorithm))
 	}
 
 	// Step 4: Create signed container
@@ -1336,6 +1334,9 @@ func (ts *TreeSerializerService) SaveSecureAgent(node TreeNode, filename string,
 			"compression_level": level,
 		},
 	}
+	if encryption != nil {
+		encryption.record(container.Metadata)
+	}
 
 	// Step 5: Calculate checksum - FIXED TO USE NEW SIGNATURE
 	if options.Checksum {
@@ -1397,16 +1398,21 @@ func (ts *TreeSerializerService) LoadSecureAgent(filename string, options *Secur
 		ts.logger.Info("Checksum verified")
 	}
 
-	// Step 4: Decrypt using Key Vault - FIXED PARAMETER ORDER
+	// Step 4: Decrypt with the key version and algorithm the container records
 	data := container.EncryptedData
-	if options.DecryptionKeyID != "" {
-		decrypted, err := ts.decryptData(data, options.DecryptionKeyID)
+	if options.DecryptionKeyID != "" || secureTreeInfo(container).Encrypted {
+		decryption, err := containerCipher(container, options.DecryptionKeyID)
+		if err == nil {
+			data, err = decryption.open(data)
+		}
 		if err != nil {
 			ts.logger.Error("Decryption failed", zap.Error(err), zap.String("key_id", options.DecryptionKeyID))
 			return nil, fmt.Errorf("decryption failed with key %s: %v", options.DecryptionKeyID, err)
 		}
-		data = decrypted
-		ts.logger.Info("Decryption complete", zap.String("key_id", options.DecryptionKeyID))
+		ts.logger.Info("Decryption complete",
+			zap.String("key_id", decryption.keyID),
+			zap.Int("key_version", decryption.version),
+			zap.String("algorithm", decryption.algorithm))
 	}
 
 	// Steps 5-6: Decompress and deserialize (unchanged)
@@ -1485,9 +1491,8 @@ func (ts *TreeSerializerService) loadSignedContainer(filename string) (*SignedAg
 	defer file.Close()
 
 	// Decode GOB container
-	decoder := gob.NewDecoder(file)
-	var container SignedAgentContainer
-	if err := decoder.Decode(&container); err != nil {
+	container, err := decodeSignedContainer(file)
+	if err != nil {
 		return nil, fmt.Errorf("failed to decode container from %s: %v", filename, err)
 	}
 
@@ -1500,7 +1505,7 @@ func (ts *TreeSerializerService) loadSignedContainer(filename string) (*SignedAg
 		zap.Bool("has_checksum", container.Checksum != nil),
 		zap.String("signing_key_id", container.SigningKeyID))
 
-	return &container, nil
+	return container, nil
 }
 
 // Helper to convert Go values to Chariot Values
@@ -1515,6 +1520,8 @@ func convertToValue(v interface{}) Value {
 		return Str(val)
 	case float64:
 		return Number(val)
+	case int:
+		return Number(val)
 	case bool:
 		return Bool(val)
 	case map[string]interface{}:
@@ -147,6 +147,9 @@ type TreeNodeImpl struct {
 	ParentNode TreeNode
 	Attributes map[string]Value
 	meta       *MapValue // dedicated metadata field
+
+	generation uint64     // bumped when the node or a descendant changes
+	index      *treeIndex // set by treeIndex on the root of an indexed tree
 }
 
 // NewTreeNode creates a new TreeNode with the given name
@@ -176,6 +179,7 @@ func (n *TreeNodeImpl) Name() string {
 
 // Name sets and returns the name of the node
 func (n *TreeNodeImpl) SetName(newName string) string {
+	markTreeChanged(n)
 	n.NameStr = newName
 	return n.NameStr
 }
@@ -236,6 +240,7 @@ func (n *TreeNodeImpl) GetChildByName(name string) (TreeNode, bool) {
 
 // SetChildByName sets a child node by name
 func (n *TreeNodeImpl) SetChildByName(name string, child TreeNode) {
+	markTreeChanged(n)
 	for i, c := range n.Children {
 		if c.Name() == name {
 			n.Children[i] = child
@@ -256,12 +261,14 @@ func (n *TreeNodeImpl) GetRoot() TreeNode {
 
 // AddChild adds a child node
 func (n *TreeNodeImpl) AddChild(child TreeNode) {
+	markTreeChanged(n)
 	n.Children = append(n.Children, child)
 	child.SetParent(n)
 }
 
 // AddChildAt adds a child node at the specified index position
 func (n *TreeNodeImpl) AddChildAt(index int, child TreeNode) {
+	markTreeChanged(n)
 	// First check if child already has a parent, and detach if needed
 	if child.Parent() != nil {
 		child.Parent().RemoveChild(child)
@@ -295,6 +302,7 @@ func (n *TreeNodeImpl) AddChildAt(index int, child TreeNode) {
 
 // RemoveChild removes a child node
 func (n *TreeNodeImpl) RemoveChild(child TreeNode) {
+	markTreeChanged(n)
 	for i, c := range n.Children {
 		if c == child {
 			n.Children = append(n.Children[:i], n.Children[i+1:]...)
@@ -306,6 +314,7 @@ func (n *TreeNodeImpl) RemoveChild(child TreeNode) {
 
 // RemoveChildren removes all child nodes
 func (n *TreeNodeImpl) RemoveChildren() {
+	markTreeChanged(n)
 	for _, child := range n.Children {
 		child.SetParent(nil)
 	}
@@ -367,11 +376,13 @@ func (n *TreeNodeImpl) GetAttribute(name string) (Value, bool) {
 
 // SetAttribute sets the value of the specified attribute
 func (n *TreeNodeImpl) SetAttribute(name string, value Value) {
+	markTreeChanged(n)
 	n.Attributes[name] = value
 }
 
 // RemoveAttribute removes the specified attribute
 func (n *TreeNodeImpl) RemoveAttribute(name string) {
+	markTreeChanged(n)
 	delete(n.Attributes, name)
 }
 
@@ -0,0 +1,550 @@
+package chariot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Static type checking. Function parameters and results may be annotated
+// with the type codes declare takes (see parseFunction). The checker infers
+// the type of literals, of variables declared with a type, of annotated
+// parameters and of calls whose result type is known, then reports calls
+// whose arguments cannot have the type the function takes, declarations and
+// assignments of the wrong type, and results that do not match their
+// annotation. Whatever cannot be inferred is not checked, so unannotated
+// code passes.
+//
+// Annotated functions are also checked when they run: their arguments and
+// result must match the annotations, as a declared variable's value must.
+
+// Signature describes the arguments a function takes and what it returns.
+type Signature struct {
+	Params   []string `json:"params"`   // Type code of each parameter; "" accepts any value
+	Required int      `json:"required"` // Arguments that must be passed
+	Variadic bool     `json:"variadic"` // The last parameter may repeat
+	Result   string   `json:"result"`   // Type code of the result; "" when unknown
+}
+
+// String formats the signature as (N, S?, V...) N.
+func (s Signature) String() string {
+	parts := make([]string, len(s.Params))
+	for i, p := range s.Params {
+		if p == "" {
+			p = TypeVariableExpr
+		}
+		switch {
+		case s.Variadic && i == len(s.Params)-1:
+			p += "..."
+		case i >= s.Required:
+			p += "?"
+		}
+		parts[i] = p
+	}
+	out := "(" + strings.Join(parts, ", ") + ")"
+	if s.Result != "" {
+		out += " " + s.Result
+	}
+	return out
+}
+
+// builtinSignatureSpecs are the signatures of the builtins the checker
+// knows, as "params:result". A "?" marks an optional parameter and "..." one
+// that repeats; V accepts any value.
+var builtinSignatureSpecs = map[string]string{
+	"add": "N,N:N", "sub": "N,N:N", "mul": "N,N:N", "div": "N,N:N", "mod": "N,N:N", "pow": "N,N:N",
+	"abs": "N:N", "floor": "N:N", "ceiling": "N:N", "sqrt": "N:N", "round": "N,N?:N",
+	"min": "N,N...:N", "max": "N,N...:N",
+	"upper": "S:S", "lower": "S:S", "trim": "S,S?:S", "replace": "S,S,S,N?:S",
+	"hasPrefix": "S,S:L", "hasSuffix": "S,S:L", "split": "S,S:A", "join": "A,S:S",
+	"equal": "V,V,V...:L", "unequal": "V,V,V...:L",
+	"bigger": "V,V:L", "smaller": "V,V:L", "biggerEq": "V,V:L", "smallerEq": "V,V:L",
+	"and": "L,L...:L", "or": "L,L...:L", "not": "L,L...:L",
+	"length": "V:N", "contains": "V,V:L", "string": "V:S", "toNumber": "V:N",
+	"now": ":S",
+}
+
+var builtinSignatures = func() map[string]Signature {
+	sigs := make(map[string]Signature, len(builtinSignatureSpecs))
+	for name, spec := range builtinSignatureSpecs {
+		params, result, _ := strings.Cut(spec, ":")
+		sig := Signature{Result: result}
+		if params != "" {
+			for _, p := range strings.Split(params, ",") {
+				switch {
+				case strings.HasSuffix(p, "..."):
+					p = strings.TrimSuffix(p, "...")
+					sig.Variadic = true
+				case strings.HasSuffix(p, "?"):
+					p = strings.TrimSuffix(p, "?")
+				default:
+					sig.Required++
+				}
+				sig.Params = append(sig.Params, p)
+			}
+		}
+		sigs[name] = sig
+	}
+	return sigs
+}()
+
+// BuiltinSignature returns the signature of a builtin when the checker
+// knows it.
+func BuiltinSignature(name string) (Signature, bool) {
+	sig, ok := builtinSignatures[name]
+	return sig, ok
+}
+
+// FunctionSignature returns the signature a user function's annotations
+// give it. Arguments left out are null, so only annotated parameters up to
+// the last one are required.
+func FunctionSignature(fn *FunctionValue) Signature {
+	return signatureOf(fn.Parameters, fn.ParamTypes, fn.ReturnType)
+}
+
+func signatureOf(params, paramTypes []string, result string) Signature {
+	sig := Signature{Params: make([]string, len(params)), Result: result}
+	for i := range params {
+		if i < len(paramTypes) {
+			sig.Params[i] = paramTypes[i]
+			if t := paramTypes[i]; t != "" && t != TypeVariableExpr {
+				sig.Required = i + 1
+			}
+		}
+	}
+	return sig
+}
+
+var typeNames = map[string]string{
+	TypeNumber: "number", TypeString: "string", TypeBoolean: "boolean", TypeDate: "date",
+	TypeArray: "array", TypeETLTransform: "transform", TypeXML: "XML", TypeJSON: "JSON",
+	TypeMap: "map", TypeTree: "tree", TypeFunction: "function", TypeObject: "host object",
+	TypePlan: "plan", TypeVariableExpr: "any",
+}
+
+func typeName(code string) string {
+	if name, ok := typeNames[code]; ok {
+		return code + " (" + name + ")"
+	}
+	return code
+}
+
+// typeAssignable reports whether a value inferred to be of type got may be
+// used where want is expected. An unknown type ("") matches anything.
+func typeAssignable(want, got string) bool {
+	switch {
+	case want == "" || got == "" || want == got:
+		return true
+	case want == TypeVariableExpr || got == TypeVariableExpr:
+		return true
+	case want == TypeDate && got == TypeString, want == TypeString && got == TypeDate:
+		return true // dates are strings
+	case want == TypeTree && got == TypeXML, want == TypeXML && got == TypeTree:
+		return true
+	}
+	return false
+}
+
+// checkArgTypes checks the arguments of a call to an annotated function.
+func checkArgTypes(fn *FunctionValue, args []Value) error {
+	for i, t := range fn.ParamTypes {
+		if t == "" || i >= len(fn.Parameters) {
+			continue
+		}
+		var arg Value = DBNull
+		if i < len(args) {
+			arg = args[i]
+		}
+		if se, ok := arg.(ScopeEntry); ok {
+			arg = se.Value
+		}
+		if err := validateTypeCompatibility(t, arg); err != nil {
+			return fmt.Errorf("%s: parameter '%s': %w", functionName(fn), fn.Parameters[i], err)
+		}
+	}
+	return nil
+}
+
+// checkResultType checks the result of an annotated function.
+func (rt *Runtime) checkResultType(fn *FunctionValue, result Value) error {
+	if fn.ReturnType == "" {
+		return nil
+	}
+	if se, ok := result.(ScopeEntry); ok {
+		result = se.Value
+	}
+	if err := validateTypeCompatibility(fn.ReturnType, result); err != nil {
+		return rt.withStackTrace(fmt.Errorf("%s: result: %w", functionName(fn), err))
+	}
+	return nil
+}
+
+// TypeError is a problem CheckTypes found in a program.
+type TypeError struct {
+	Pos     SourcePos `json:"pos"`
+	Message string    `json:"message"`
+}
+
+func (e TypeError) Error() string {
+	if e.Pos.Line > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", e.Pos.File, e.Pos.Line, e.Pos.Column, e.Message)
+	}
+	return e.Message
+}
+
+// typeEnv holds what is known of the variables of one scope.
+type typeEnv struct {
+	vars   map[string]string    // declared type by variable
+	fns    map[string]Signature // signature by variable holding a function literal
+	result string               // result type of the enclosing function
+	inFunc bool
+	parent *typeEnv
+}
+
+func newTypeEnv(parent *typeEnv) *typeEnv {
+	return &typeEnv{vars: map[string]string{}, fns: map[string]Signature{}, parent: parent}
+}
+
+func (e *typeEnv) varType(name string) string {
+	for s := e; s != nil; s = s.parent {
+		if t, ok := s.vars[name]; ok {
+			return t
+		}
+	}
+	return ""
+}
+
+func (e *typeEnv) funcSig(name string) (Signature, bool) {
+	for s := e; s != nil; s = s.parent {
+		if sig, ok := s.fns[name]; ok {
+			return sig, true
+		}
+	}
+	return Signature{}, false
+}
+
+func (e *typeEnv) root() *typeEnv {
+	for e.parent != nil {
+		e = e.parent
+	}
+	return e
+}
+
+type typeChecker struct {
+	rt     *Runtime
+	funcs  map[string]Signature // user functions callable by name
+	at     SourcePos            // position of the last call seen, for nodes without one
+	errors []TypeError
+}
+
+// CheckTypes checks a parsed program against the builtins' signatures and,
+// when rt is not nil, the functions registered in rt. Functions the program
+// registers with registerFunction under a literal name are known throughout
+// it. The errors are ordered by position.
+func CheckTypes(program *Block, rt *Runtime) []TypeError {
+	c := &typeChecker{rt: rt, funcs: map[string]Signature{}}
+	if rt != nil {
+		for name, fn := range rt.functions {
+			c.funcs[name] = FunctionSignature(fn)
+		}
+	}
+	c.collectRegistered(program)
+	c.infer(program, newTypeEnv(nil))
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		a, b := c.errors[i].Pos, c.errors[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return c.errors
+}
+
+// collectRegistered finds registerFunction('name', func(...) {...}) calls.
+func (c *typeChecker) collectRegistered(n Node) {
+	walkNodes(n, func(n Node) {
+		f, ok := n.(*FuncCall)
+		if !ok || f.Name != "registerFunction" || len(f.Args) < 2 {
+			return
+		}
+		lit, isLit := f.Args[0].(*Literal)
+		def, isDef := f.Args[1].(*FunctionDefNode)
+		if !isLit || !isDef {
+			return
+		}
+		if name, ok := lit.Val.(Str); ok {
+			c.funcs[string(name)] = def.signature()
+		}
+	})
+}
+
+func (f *FunctionDefNode) signature() Signature {
+	return signatureOf(f.Parameters, f.ParamTypes, f.ReturnType)
+}
+
+// walkNodes calls visit on n and every node below it.
+func walkNodes(n Node, visit func(Node)) {
+	if n == nil {
+		return
+	}
+	visit(n)
+	each := func(nodes []Node) {
+		for _, c := range nodes {
+			walkNodes(c, visit)
+		}
+	}
+	switch n := n.(type) {
+	case *Block:
+		each(n.Stmts)
+	case *FuncCall:
+		each(n.Args)
+	case *FunctionDefNode:
+		walkNodes(n.Body, visit)
+	case *ArrayLiteralNode:
+		each(n.Elements)
+	case *IfNode:
+		walkNodes(n.Condition, visit)
+		each(n.TrueBranch)
+		each(n.FalseBranch)
+	case *WhileNode:
+		walkNodes(n.Condition, visit)
+		each(n.Body)
+	case *SwitchNode:
+		walkNodes(n.TestExpr, visit)
+		for _, cs := range n.Cases {
+			walkNodes(cs.Condition, visit)
+			walkNodes(cs.Body, visit)
+		}
+		if n.DefaultCase != nil {
+			walkNodes(n.DefaultCase.Body, visit)
+		}
+	}
+}
+
+func (c *typeChecker) errorf(pos SourcePos, format string, args ...interface{}) {
+	c.errors = append(c.errors, TypeError{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// infer checks n and returns its type, "" when unknown.
+func (c *typeChecker) infer(n Node, env *typeEnv) string {
+	switch n := n.(type) {
+	case *Literal:
+		switch n.Val.(type) {
+		case Number:
+			return TypeNumber
+		case Str:
+			return TypeString
+		case Bool:
+			return TypeBoolean
+		}
+	case *VarRef:
+		return env.varType(n.Name)
+	case *ArrayLiteralNode:
+		for _, e := range n.Elements {
+			c.infer(e, env)
+		}
+		return TypeArray
+	case *FunctionDefNode:
+		c.checkFunction(n, env)
+		return TypeFunction
+	case *Block:
+		return c.inferBlock(n.Stmts, env)
+	case *IfNode:
+		c.infer(n.Condition, env)
+		c.inferBlock(n.TrueBranch, env)
+		c.inferBlock(n.FalseBranch, env)
+	case *WhileNode:
+		c.infer(n.Condition, env)
+		c.inferBlock(n.Body, env)
+	case *SwitchNode:
+		if n.TestExpr != nil {
+			c.infer(n.TestExpr, env)
+		}
+		for _, cs := range n.Cases {
+			c.infer(cs.Condition, env)
+			c.infer(cs.Body, env)
+		}
+		if n.DefaultCase != nil {
+			c.infer(n.DefaultCase.Body, env)
+		}
+	case *FuncCall:
+		return c.checkCall(n, env)
+	}
+	return ""
+}
+
+func (c *typeChecker) inferBlock(stmts []Node, env *typeEnv) string {
+	t := ""
+	for _, s := range stmts {
+		t = c.infer(s, env)
+	}
+	return t
+}
+
+// checkFunction checks a function body with its annotated parameters known,
+// and its last statement against the annotated result.
+func (c *typeChecker) checkFunction(f *FunctionDefNode, env *typeEnv) {
+	inner := newTypeEnv(env)
+	inner.inFunc, inner.result = true, f.ReturnType
+	for i, p := range f.Parameters {
+		inner.vars[p] = ""
+		if i < len(f.ParamTypes) {
+			inner.vars[p] = f.ParamTypes[i]
+		}
+	}
+	got := c.infer(f.Body, inner)
+	if !typeAssignable(f.ReturnType, got) {
+		c.errorf(lastPos(f.Body, c.at), "function returns %s, declared to return %s", typeName(got), typeName(f.ReturnType))
+	}
+}
+
+// lastPos returns the position of the last statement of body, or def.
+func lastPos(body Node, def SourcePos) SourcePos {
+	if b, ok := body.(*Block); ok && len(b.Stmts) > 0 {
+		body = b.Stmts[len(b.Stmts)-1]
+	}
+	if body != nil && body.GetPos().Line > 0 {
+		return body.GetPos()
+	}
+	return def
+}
+
+func (c *typeChecker) checkCall(f *FuncCall, env *typeEnv) string {
+	if f.Pos.Line > 0 {
+		c.at = f.Pos
+	}
+	switch f.Name {
+	case "declare", "declareGlobal", "setq":
+		return c.checkAssignment(f, env)
+	case "return":
+		var got string
+		for _, a := range f.Args {
+			got = c.infer(a, env)
+		}
+		if len(f.Args) == 1 && env.inFunc && !typeAssignable(env.result, got) {
+			c.errorf(f.Pos, "return of %s from a function declared to return %s", typeName(got), typeName(env.result))
+		}
+		return got
+	}
+
+	types := make([]string, len(f.Args))
+	for i, a := range f.Args {
+		types[i] = c.infer(a, env)
+	}
+
+	name := f.Name
+	if name == "call" && len(f.Args) > 0 {
+		if ref, ok := f.Args[0].(*VarRef); ok {
+			if sig, ok := env.funcSig(ref.Name); ok {
+				c.checkArgs(f, ref.Name, sig, f.Args[1:], types[1:])
+				return sig.Result
+			}
+			if sig, ok := c.funcs[ref.Name]; ok {
+				c.checkArgs(f, ref.Name, sig, f.Args[1:], types[1:])
+				return sig.Result
+			}
+		}
+		return ""
+	}
+	if sig, ok := c.signature(name); ok {
+		c.checkArgs(f, name, sig, f.Args, types)
+		return sig.Result
+	}
+	return ""
+}
+
+// signature resolves a called name the way the runtime does: builtins
+// first, then user functions.
+func (c *typeChecker) signature(name string) (Signature, bool) {
+	if c.rt == nil || c.rt.funcs[name] != nil {
+		if sig, ok := builtinSignatures[name]; ok {
+			return sig, true
+		}
+		if c.rt != nil {
+			return Signature{}, false
+		}
+	}
+	sig, ok := c.funcs[name]
+	return sig, ok
+}
+
+func (c *typeChecker) checkArgs(f *FuncCall, name string, sig Signature, args []Node, types []string) {
+	switch {
+	case len(args) < sig.Required:
+		c.errorf(f.Pos, "%s expects at least %d arguments %s, got %d", name, sig.Required, sig, len(args))
+	case len(args) > len(sig.Params) && !sig.Variadic:
+		c.errorf(f.Pos, "%s expects at most %d arguments %s, got %d", name, len(sig.Params), sig, len(args))
+	}
+	for i, got := range types {
+		var want string
+		switch {
+		case i < len(sig.Params):
+			want = sig.Params[i]
+		case sig.Variadic && len(sig.Params) > 0:
+			want = sig.Params[len(sig.Params)-1]
+		}
+		if !typeAssignable(want, got) {
+			pos := args[i].GetPos()
+			if pos.Line == 0 {
+				pos = f.Pos
+			}
+			c.errorf(pos, "argument %d of %s: expected %s, got %s", i+1, name, typeName(want), typeName(got))
+		}
+	}
+}
+
+// checkAssignment checks declare, declareGlobal and setq and records what
+// they tell about the variable.
+func (c *typeChecker) checkAssignment(f *FuncCall, env *typeEnv) string {
+	if len(f.Args) < 2 {
+		return ""
+	}
+	ref, ok := f.Args[0].(*VarRef)
+	var got string
+	if f.Name == "setq" {
+		got = c.infer(f.Args[1], env)
+		if !ok {
+			return got
+		}
+		if want := env.varType(ref.Name); !typeAssignable(want, got) {
+			c.errorf(f.Pos, "cannot assign %s to '%s', declared %s", typeName(got), ref.Name, typeName(want))
+		}
+		if def, isDef := f.Args[1].(*FunctionDefNode); isDef {
+			env.fns[ref.Name] = def.signature()
+		}
+		return got
+	}
+
+	label := "?"
+	if ok {
+		label = ref.Name
+	}
+	want := ""
+	if lit, isLit := f.Args[1].(*Literal); isLit {
+		if s, isStr := lit.Val.(Str); isStr && isValidTypeCode(string(s)) {
+			want = string(s)
+		}
+	} else {
+		c.infer(f.Args[1], env)
+	}
+	if len(f.Args) > 2 {
+		got = c.infer(f.Args[2], env)
+		if !typeAssignable(want, got) {
+			c.errorf(f.Pos, "cannot declare '%s' as %s with a value of %s", label, typeName(want), typeName(got))
+		}
+	}
+	if !ok {
+		return want
+	}
+	scope := env
+	if f.Name == "declareGlobal" {
+		scope = env.root()
+	}
+	scope.vars[ref.Name] = want
+	if len(f.Args) > 2 {
+		if def, isDef := f.Args[2].(*FunctionDefNode); isDef {
+			scope.fns[ref.Name] = def.signature()
+		}
+	}
+	return want
+}
@@ -4,13 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
 
 	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/storage"
 )
 
 // RegisterValues registers all value-related functions
@@ -153,21 +153,55 @@ func RegisterValues(rt *Runtime) {
 		if len(args) != 0 {
 			return nil, errors.New("inspectRuntime does not take any arguments")
 		}
-		// Create a map to hold the runtime state
-		rtState := map[string]interface{}{
-			"globals":          ConvertToNativeJSON(rt.ListGlobalVariables()),
-			"variables":        ConvertToNativeJSON(rt.ListLocalVariables()),
-			"objects":          ConvertToNativeJSON(rt.ListObjects()),
-			"lists":            ConvertToNativeJSON(rt.ListLists()),
-			"namespaces":       ConvertToNativeJSON(rt.ListNamespaces()),
-			"nodes":            ConvertToNativeJSON(rt.ListNodes()),
-			"tables":           ConvertToNativeJSON(rt.ListTables()),
-			"keycolumns":       ConvertToNativeJSON(rt.ListKeyColumns()),
-			"default_template": rt.DefaultTemplateID,
-			"timeoffset":       rt.timeOffset,
-		}
-
-		return rtState, nil
+		return rt.InspectState(), nil
+	})
+
+	// runtimeSnapshot - save variables and functions under a name
+	rt.Register("runtimeSnapshot", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, errors.New("runtimeSnapshot requires exactly 1 argument: snapshot name")
+		}
+		name, ok := args[0].(Str)
+		if !ok {
+			return nil, errors.New("snapshot name must be a string")
+		}
+		snap, err := rt.SaveSnapshotTo(string(name))
+		if err != nil {
+			return nil, err
+		}
+		return snapshotSummary(snap), nil
+	})
+
+	// runtimeRestore - restore variables and functions from a named snapshot
+	rt.Register("runtimeRestore", func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, errors.New("runtimeRestore requires exactly 1 argument: snapshot name")
+		}
+		name, ok := args[0].(Str)
+		if !ok {
+			return nil, errors.New("snapshot name must be a string")
+		}
+		snap, err := rt.RestoreSnapshotFrom(string(name))
+		if err != nil {
+			return nil, err
+		}
+		return snapshotSummary(snap), nil
+	})
+
+	// runtimeSnapshots - list the names of saved snapshots, newest first
+	rt.Register("runtimeSnapshots", func(args ...Value) (Value, error) {
+		if len(args) != 0 {
+			return nil, errors.New("runtimeSnapshots does not take any arguments")
+		}
+		infos, err := ListSnapshots(rt.SnapshotDir())
+		if err != nil {
+			return nil, err
+		}
+		names := NewArray()
+		for _, info := range infos {
+			names.Append(Str(info.Name))
+		}
+		return names, nil
 	})
 
 	// listPlans - returns array of plan names from global scope
@@ -539,6 +573,10 @@ func RegisterValues(rt *Runtime) {
 		if entry, ok := valueToSet.(ScopeEntry); ok {
 			valueToSet = entry.Value
 		}
+		// Anonymous functions take the name of the first variable they are bound to
+		if fn, ok := valueToSet.(*FunctionValue); ok && fn.Name == "" {
+			fn.Name = string(varName)
+		}
 
 		// Case 1: Simple variable assignment (2 args)
 		if len(args) == 2 {
@@ -785,7 +823,7 @@ func RegisterValues(rt *Runtime) {
 			return Str("A"), nil
 		case *MapValue, MapValue, map[string]Value:
 			return Str("M"), nil
-		case *TableValue:
+		case *TableValue, *DataFrame:
 			return Str("R"), nil
 		case *HostObjectValue:
 			return Str("H"), nil
@@ -1095,13 +1133,23 @@ func RegisterValues(rt *Runtime) {
 }
 
 func FunctionValueToMap(fn *FunctionValue) map[string]interface{} {
-	return map[string]interface{}{
+	m := map[string]interface{}{
 		"_value_type":      "function",
 		"parameters":       fn.Parameters,
 		"body":             fn.Body.ToMap(),
 		"source":           fn.SourceCode,      // Original formatted source
 		"formatted_source": fn.FormattedSource, // Add this field for editor formatting
 	}
+	if fn.ParamTypes != nil {
+		m["param_types"] = fn.ParamTypes
+	}
+	if fn.ReturnType != "" {
+		m["return_type"] = fn.ReturnType
+	}
+	if fn.Doc != "" {
+		m["doc"] = fn.Doc
+	}
+	return m
 }
 
 // Place this in a shared utils file or in value_funcs.go if needed
@@ -1391,10 +1439,16 @@ func LoadFunctionsFromFile(filename string) (map[string]*FunctionValue, error) {
 	basePath := cfg.ChariotConfig.TreePath
 	fullPath := filepath.Join(basePath, filename)
 
-	data, err := os.ReadFile(fullPath)
+	data, err := storage.Default().ReadFile(fullPath)
 	if err != nil {
 		return nil, err
 	}
+	return LoadFunctionsFromJSON(data)
+}
+
+// LoadFunctionsFromJSON decodes a function library in the format written by
+// SaveFunctionsToFile.
+func LoadFunctionsFromJSON(data []byte) (map[string]*FunctionValue, error) {
 	var funcsMap map[string]interface{}
 	if err := json.Unmarshal(data, &funcsMap); err != nil {
 		return nil, err
@@ -1409,6 +1463,7 @@ func LoadFunctionsFromFile(filename string) (map[string]*FunctionValue, error) {
 		if err != nil {
 			return nil, err
 		}
+		fn.Name = key
 		functions[key] = fn
 	}
 	return functions, nil
@@ -1419,12 +1474,6 @@ func SaveFunctionsToFile(functions map[string]*FunctionValue, filename string) e
 	basePath := cfg.ChariotConfig.TreePath
 	fullPath := filepath.Join(basePath, filename)
 
-	// Ensure directory exists
-	dir := filepath.Dir(fullPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
-
 	// Serialize functions (using your FunctionValueToMap helper)
 	funcsList := make(map[string]interface{})
 	for name, fn := range functions {
@@ -1435,21 +1484,37 @@ func SaveFunctionsToFile(functions map[string]*FunctionValue, filename string) e
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(fullPath, data, 0644)
+	return storage.Default().WriteFile(fullPath, data)
 }
 
 // MapToFunctionValue reconstructs a FunctionValue from a map[string]interface{} as loaded from JSON/YAML.
 func MapToFunctionValue(fnMap map[string]interface{}) (*FunctionValue, error) {
 	fn := &FunctionValue{}
 
-	// Parameters: expect []interface{} of strings
-	if params, ok := fnMap["parameters"].([]interface{}); ok {
+	// Parameters: []interface{} of strings from JSON, []string from FunctionValueToMap
+	switch params := fnMap["parameters"].(type) {
+	case []interface{}:
 		for _, p := range params {
 			if ps, ok := p.(string); ok {
 				fn.Parameters = append(fn.Parameters, ps)
 			}
 		}
+	case []string:
+		fn.Parameters = append([]string(nil), params...)
+	}
+
+	// Type annotations (optional)
+	switch types := fnMap["param_types"].(type) {
+	case []interface{}:
+		for _, t := range types {
+			ts, _ := t.(string)
+			fn.ParamTypes = append(fn.ParamTypes, ts)
+		}
+	case []string:
+		fn.ParamTypes = types
 	}
+	fn.ReturnType, _ = fnMap["return_type"].(string)
+	fn.Doc, _ = fnMap["doc"].(string)
 
 	// Source code (optional)
 	if src, ok := fnMap["source"].(string); ok {
@@ -162,8 +162,12 @@ type Value interface{}
 type ValueType int
 
 type FunctionValue struct {
+	Name            string   // Name the function was registered or assigned under (for call stacks)
 	Body            Node     // AST node representing the function body
 	Parameters      []string // Parameter names
+	ParamTypes      []string // Type code annotated on each parameter, "" for none; nil when none is annotated
+	ReturnType      string   // Type code annotated on the result, "" for none
+	Doc             string   // Doc comment (/// lines) written before the function
 	SourceCode      string   // Original source (for debugging)
 	FormattedSource string   // Formatted source code for display
 	IsParsed        bool     // Whether the function has been parsed
@@ -209,7 +213,7 @@ func GetValueType(v Value) ValueType {
 		return ValueArray
 	case *MapValue, MapValue:
 		return ValueMap
-	case *TableValue, TableValue:
+	case *TableValue, TableValue, *DataFrame:
 		return ValueTable
 	case *HostObjectValue, HostObjectValue:
 		return ValueHostObject
@@ -245,7 +249,7 @@ func GetValueTypeSpec(val Value) string {
 		return "A"
 	case MapValue, *MapValue, map[string]Value:
 		return "M"
-	case TableValue, *TableValue:
+	case TableValue, *TableValue, *DataFrame:
 		return "R" // Relation
 	case HostObjectValue, *HostObjectValue:
 		return "H"
@@ -626,9 +630,9 @@ func convertFromNativeValue(val interface{}) Value {
 	// Standalone converter in the opposite direction
 	switch v := val.(type) {
 	case string:
-		return Str(v)
+		return InternStr(v)
 	case float64:
-		return Number(v)
+		return BoxNumber(v)
 	case int:
 		return Number(float64(v))
 	case int64:
@@ -1,6 +1,7 @@
 package chariot
 
 import (
+	"bufio"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -239,6 +240,31 @@ func registerXMLFileOps(rt *Runtime) {
 
 		return node, nil
 	})
+
+	// parseXMLStream(filename, pathFilter, function) - call function with each
+	// element the path filter selects, as an XML node, reading the file once
+	// without loading it
+	rt.Register("parseXMLStream", func(args ...Value) (Value, error) {
+		filename, filter, fn, err := streamArgs("parseXMLStream", args)
+		if err != nil {
+			return nil, err
+		}
+		fullPath, err := getSecureFilePath(filename, "data")
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(fullPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open XML file '%s': %v", filename, err)
+		}
+		defer f.Close()
+
+		count, err := streamXML(rt, bufio.NewReader(f), parseStreamFilter(filter, "/"), streamCallback(rt, fn))
+		if err != nil {
+			return nil, fmt.Errorf("parseXMLStream '%s': %w", filename, err)
+		}
+		return Number(count), nil
+	})
 }
 
 // SetXMLValue sets a value in an XML document using an XPath-like expression
@@ -0,0 +1,387 @@
+package chariot
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAML loaded by loadYAML and loadYAMLMultiDoc keeps its document on the
+// JSONNode it is loaded into. saveYAML and saveYAMLMultiDoc write the node's
+// data back into that document, so what a script did not change keeps its
+// anchors, aliases, merge keys, tags, comments and styles. An alias stays
+// an alias while its data equals its anchor's; a merge key stays while the
+// keys it brings in are unchanged, with changed ones written as overrides.
+
+// yamlTagHandler converts the values of a YAML tag, such as !!secret or
+// !env, to and from script values.
+type yamlTagHandler struct {
+	decode *FunctionValue // fn(value, tag), the value the tag's node holds
+	encode *FunctionValue // fn(value), what to write under the tag; optional
+}
+
+// yamlStandardTags are the tags YAML resolves itself.
+var yamlStandardTags = map[string]bool{
+	"!!str": true, "!!int": true, "!!float": true, "!!bool": true, "!!null": true,
+	"!!timestamp": true, "!!binary": true, "!!map": true, "!!seq": true, "!!merge": true,
+}
+
+// yamlCodec converts between YAML documents and the native data JSONNodes
+// hold, applying the tag handlers registered on rt.
+type yamlCodec struct {
+	rt      *Runtime
+	natives map[*yaml.Node]interface{} // Converted anchored nodes
+	written map[string]interface{}     // Data saved under each anchor
+}
+
+func newYAMLCodec(rt *Runtime) *yamlCodec {
+	return &yamlCodec{rt: rt, natives: map[*yaml.Node]interface{}{}, written: map[string]interface{}{}}
+}
+
+// normalizeYAMLScalar gives a scalar the form it has after a round trip
+// through a JSONNode, so loaded and saved data compare equal.
+func normalizeYAMLScalar(v interface{}) interface{} {
+	return ConvertToNativeJSON(convertFromNativeValue(v))
+}
+
+func (c *yamlCodec) handler(n *yaml.Node) *yamlTagHandler {
+	if c.rt == nil || c.rt.yamlTags == nil {
+		return nil
+	}
+	if h, ok := c.rt.yamlTags[n.Tag]; ok {
+		return h
+	}
+	return c.rt.yamlTags[n.ShortTag()]
+}
+
+// native converts n to native data: maps, slices and scalars, with aliases
+// and merge keys resolved and tagged values converted by their handlers.
+func (c *yamlCodec) native(n *yaml.Node) (interface{}, error) {
+	if v, ok := c.natives[n]; ok {
+		return v, nil
+	}
+	v, err := c.convert(n)
+	if err != nil {
+		return nil, err
+	}
+	if n.Anchor != "" {
+		c.natives[n] = v
+	}
+	return v, nil
+}
+
+func (c *yamlCodec) convert(n *yaml.Node) (interface{}, error) {
+	if n.Kind == yaml.DocumentNode {
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return c.native(n.Content[0])
+	}
+	if n.Kind == yaml.AliasNode {
+		return c.native(n.Alias)
+	}
+
+	var plain interface{}
+	switch n.Kind {
+	case yaml.MappingNode:
+		merged, err := c.mergedKeys(n)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, len(n.Content)/2)
+		for k, v := range merged {
+			m[k] = v
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if isYAMLMergeKey(n.Content[i]) {
+				continue
+			}
+			v, err := c.native(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[n.Content[i].Value] = v
+		}
+		plain = m
+	case yaml.SequenceNode:
+		s := make([]interface{}, len(n.Content))
+		for i, item := range n.Content {
+			v, err := c.native(item)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = v
+		}
+		plain = s
+	case yaml.ScalarNode:
+		switch {
+		case n.ShortTag() == "!!timestamp", n.ShortTag() == "!!binary":
+			plain = n.Value
+		case yamlStandardTags[n.ShortTag()]:
+			if err := n.Decode(&plain); err != nil {
+				return nil, fmt.Errorf("line %d: %v", n.Line, err)
+			}
+		default:
+			plain = n.Value
+		}
+		plain = normalizeYAMLScalar(plain)
+	default:
+		return nil, fmt.Errorf("line %d: unknown YAML node kind %d", n.Line, n.Kind)
+	}
+
+	if yamlStandardTags[n.ShortTag()] {
+		return plain, nil
+	}
+	h := c.handler(n)
+	if h == nil {
+		return plain, nil
+	}
+	result, err := executeFunctionValue(c.rt, h.decode, []Value{convertFromNativeValue(plain), Str(n.Tag)})
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %s handler: %v", n.Line, n.Tag, err)
+	}
+	return ConvertToNativeJSON(result), nil
+}
+
+func isYAMLMergeKey(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.Value == "<<" && (n.Tag == "" || n.ShortTag() == "!!merge")
+}
+
+// mergedKeys returns the keys the merge keys of mapping n bring in. Of
+// several merged mappings, the first to have a key gives it.
+func (c *yamlCodec) mergedKeys(n *yaml.Node) (map[string]interface{}, error) {
+	merged := map[string]interface{}{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if !isYAMLMergeKey(n.Content[i]) {
+			continue
+		}
+		sources := []*yaml.Node{n.Content[i+1]}
+		if n.Content[i+1].Kind == yaml.SequenceNode {
+			sources = n.Content[i+1].Content
+		}
+		for _, source := range sources {
+			v, err := c.mergeSource(source)
+			if err != nil {
+				return nil, err
+			}
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("line %d: merge key needs a mapping", source.Line)
+			}
+			for k, item := range m {
+				if _, ok := merged[k]; !ok {
+					merged[k] = item
+				}
+			}
+		}
+	}
+	return merged, nil
+}
+
+// mergeSource is what a merged alias refers to: as saved when its anchor
+// has been written, as loaded otherwise.
+func (c *yamlCodec) mergeSource(n *yaml.Node) (interface{}, error) {
+	if n.Kind == yaml.AliasNode {
+		if v, ok := c.written[n.Value]; ok {
+			return v, nil
+		}
+	}
+	return c.native(n)
+}
+
+// decodeDocument converts a YAML document to native data.
+func (c *yamlCodec) decodeDocument(doc *yaml.Node) (interface{}, error) {
+	return c.native(doc)
+}
+
+// encodeDocument writes data into doc, the document it was loaded from,
+// or into a new document when doc is nil.
+func (c *yamlCodec) encodeDocument(doc *yaml.Node, data interface{}) (*yaml.Node, error) {
+	if doc == nil || doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		content, err := c.fresh(nil, data)
+		if err != nil {
+			return nil, err
+		}
+		return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{content}}, nil
+	}
+	content, err := c.reconcile(doc.Content[0], data)
+	if err != nil {
+		return nil, err
+	}
+	out := *doc
+	out.Content = []*yaml.Node{content}
+	return &out, nil
+}
+
+// reconcile returns the node that writes data where orig was. Parts of
+// orig that still hold their data are kept as they are.
+func (c *yamlCodec) reconcile(orig *yaml.Node, data interface{}) (*yaml.Node, error) {
+	switch orig.Kind {
+	case yaml.AliasNode:
+		target, ok := c.written[orig.Value]
+		if !ok {
+			var err error
+			if target, err = c.native(orig.Alias); err != nil {
+				return nil, err
+			}
+		}
+		if reflect.DeepEqual(target, data) {
+			return orig, nil
+		}
+		return c.fresh(orig, data)
+
+	case yaml.MappingNode:
+		m, ok := data.(map[string]interface{})
+		if !ok || c.handler(orig) != nil {
+			break
+		}
+		out, err := c.reconcileMapping(orig, m)
+		if err != nil {
+			return nil, err
+		}
+		c.remember(orig, data)
+		return out, nil
+
+	case yaml.SequenceNode:
+		s, ok := data.([]interface{})
+		if !ok || c.handler(orig) != nil {
+			break
+		}
+		out := *orig
+		out.Content = make([]*yaml.Node, len(s))
+		for i, item := range s {
+			var err error
+			if i < len(orig.Content) {
+				out.Content[i], err = c.reconcile(orig.Content[i], item)
+			} else {
+				out.Content[i], err = c.fresh(nil, item)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		c.remember(orig, data)
+		return &out, nil
+	}
+
+	// Scalars, and values a tag handler converts, are kept while unchanged
+	was, err := c.native(orig)
+	if err != nil {
+		return nil, err
+	}
+	if reflect.DeepEqual(was, data) {
+		c.remember(orig, data)
+		return orig, nil
+	}
+	return c.fresh(orig, data)
+}
+
+func (c *yamlCodec) reconcileMapping(orig *yaml.Node, data map[string]interface{}) (*yaml.Node, error) {
+	merged, err := c.mergedKeys(orig)
+	if err != nil {
+		return nil, err
+	}
+	explicit := map[string]bool{}
+	for i := 0; i+1 < len(orig.Content); i += 2 {
+		if !isYAMLMergeKey(orig.Content[i]) {
+			explicit[orig.Content[i].Value] = true
+		}
+	}
+	// The merge keys stay while every key they bring in is still there
+	keepMerge := true
+	for k := range merged {
+		if _, ok := data[k]; !ok && !explicit[k] {
+			keepMerge = false
+		}
+	}
+
+	out := *orig
+	out.Content = []*yaml.Node{}
+	for i := 0; i+1 < len(orig.Content); i += 2 {
+		key, value := orig.Content[i], orig.Content[i+1]
+		if isYAMLMergeKey(key) {
+			if keepMerge {
+				// Without its tag, yaml.v3 writes the key as plain <<
+				// rather than as !!merge <<
+				plain := *key
+				plain.Tag = ""
+				out.Content = append(out.Content, &plain, value)
+			}
+			continue
+		}
+		v, ok := data[key.Value]
+		if !ok {
+			continue
+		}
+		node, err := c.reconcile(value, v)
+		if err != nil {
+			return nil, err
+		}
+		out.Content = append(out.Content, key, node)
+	}
+
+	added := []string{}
+	for k, v := range data {
+		if explicit[k] {
+			continue
+		}
+		if mv, ok := merged[k]; ok && keepMerge && reflect.DeepEqual(mv, v) {
+			continue
+		}
+		added = append(added, k)
+	}
+	sort.Strings(added)
+	for _, k := range added {
+		node, err := c.fresh(nil, data[k])
+		if err != nil {
+			return nil, err
+		}
+		out.Content = append(out.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}, node)
+	}
+	return &out, nil
+}
+
+func (c *yamlCodec) remember(orig *yaml.Node, data interface{}) {
+	if orig.Anchor != "" {
+		c.written[orig.Anchor] = data
+	}
+}
+
+// fresh encodes data as a new node. In place of orig, it keeps orig's
+// anchor, comments and tag, encoding through the tag's handler.
+func (c *yamlCodec) fresh(orig *yaml.Node, data interface{}) (*yaml.Node, error) {
+	var h *yamlTagHandler
+	if orig != nil && orig.Kind != yaml.AliasNode {
+		h = c.handler(orig)
+	}
+	value := data
+	if h != nil && h.encode != nil {
+		result, err := executeFunctionValue(c.rt, h.encode, []Value{convertFromNativeValue(data)})
+		if err != nil {
+			return nil, fmt.Errorf("%s handler: %v", orig.Tag, err)
+		}
+		value = ConvertToNativeJSON(result)
+	}
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	if orig == nil {
+		return node, nil
+	}
+	node.HeadComment, node.LineComment, node.FootComment = orig.HeadComment, orig.LineComment, orig.FootComment
+	if orig.Kind != yaml.AliasNode {
+		node.Anchor = orig.Anchor
+		c.remember(orig, data)
+		if h != nil || (!yamlStandardTags[orig.ShortTag()] && strings.HasPrefix(orig.Tag, "!")) {
+			node.Tag = orig.Tag
+			if node.Kind == yaml.ScalarNode {
+				node.Style &^= yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle
+			}
+		}
+	}
+	return node, nil
+}
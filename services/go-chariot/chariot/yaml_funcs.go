@@ -41,15 +41,25 @@ func registerYAMLFileOps(rt *Runtime) {
 			return nil, fmt.Errorf("failed to read file '%s': %v", fileNameStr, err)
 		}
 
-		// Parse YAML and create JSONNode (YAML has same structure as JSON)
-		var yamlData interface{}
-		if err := yaml.Unmarshal(data, &yamlData); err != nil {
+		// Parse YAML, keeping the document so saveYAML can preserve its anchors,
+		// aliases, merge keys, tags and comments
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
 			return nil, fmt.Errorf("failed to parse YAML from '%s': %v", fileNameStr, err)
 		}
 
 		// Create JSONNode and populate it (YAML data is compatible with JSON structure)
 		node := NewJSONNode("yaml_loaded")
-		node.SetJSONValue(yamlData)
+		if doc.Kind == yaml.DocumentNode {
+			yamlData, err := newYAMLCodec(rt).decodeDocument(&doc)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse YAML from '%s': %v", fileNameStr, err)
+			}
+			node.SetJSONValue(yamlData)
+			node.yamlDoc = &doc
+		} else {
+			node.SetJSONValue(nil)
+		}
 
 		return node, nil
 	})
@@ -83,11 +93,14 @@ func registerYAMLFileOps(rt *Runtime) {
 			return nil, err
 		}
 
-		// Get data from JSONNode
-		data := jsonNode.GetJSONValue()
+		// Write the node's data into the document it was loaded from, if any
+		doc, err := newYAMLCodec(rt).encodeDocument(jsonNode.yamlDoc, jsonNode.GetJSONValue())
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert data to YAML: %v", err)
+		}
 
 		// Convert to YAML
-		yamlBytes, err := yaml.Marshal(data)
+		yamlBytes, err := yaml.Marshal(doc)
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert data to YAML: %v", err)
 		}
@@ -220,24 +233,30 @@ func registerYAMLFileOps(rt *Runtime) {
 
 		// Parse multiple YAML documents
 		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
-		var documents []interface{}
+		var documents []*yaml.Node
 
 		for {
-			var doc interface{}
+			var doc yaml.Node
 			if err := decoder.Decode(&doc); err != nil {
 				if err.Error() == "EOF" {
 					break
 				}
 				return nil, fmt.Errorf("failed to parse YAML document: %v", err)
 			}
-			documents = append(documents, doc)
+			documents = append(documents, &doc)
 		}
 
-		// Create ArrayValue with JSONNodes for each document
+		// Create ArrayValue with JSONNodes for each document; anchors are
+		// local to their document
 		arr := NewArray()
 		for i, doc := range documents {
+			docData, err := newYAMLCodec(rt).decodeDocument(doc)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse YAML document %d: %v", i, err)
+			}
 			node := NewJSONNode(fmt.Sprintf("doc%d", i))
-			node.SetJSONValue(doc)
+			node.SetJSONValue(docData)
+			node.yamlDoc = doc
 			arr.Append(node)
 		}
 
@@ -257,27 +276,43 @@ func registerYAMLFileOps(rt *Runtime) {
 		}
 
 		// Accept either ArrayValue or JSONNode containing array
-		var documents []interface{}
+		var documents []*yaml.Node
+		encode := func(orig *yaml.Node, data interface{}) error {
+			doc, err := newYAMLCodec(rt).encodeDocument(orig, data)
+			if err != nil {
+				return fmt.Errorf("failed to encode YAML document: %v", err)
+			}
+			documents = append(documents, doc)
+			return nil
+		}
 
 		switch arr := args[0].(type) {
 		case *ArrayValue:
-			// Convert ArrayValue elements to native values
+			// Convert ArrayValue elements, keeping the documents of loaded ones
 			for i := 0; i < arr.Length(); i++ {
 				elem := arr.Get(i)
+				var err error
 				if jsonNode, ok := elem.(*JSONNode); ok {
-					documents = append(documents, jsonNode.GetJSONValue())
+					err = encode(jsonNode.yamlDoc, jsonNode.GetJSONValue())
 				} else {
-					documents = append(documents, ConvertToNativeJSON(elem))
+					err = encode(nil, ConvertToNativeJSON(elem))
+				}
+				if err != nil {
+					return nil, err
 				}
 			}
 		case *JSONNode:
 			// Try to get array from JSONNode
 			data := arr.GetJSONValue()
-			if arrData, ok := data.([]interface{}); ok {
-				documents = arrData
-			} else {
+			arrData, ok := data.([]interface{})
+			if !ok {
 				return nil, fmt.Errorf("JSONNode must contain an array for multi-document YAML, got %T", data)
 			}
+			for _, doc := range arrData {
+				if err := encode(nil, doc); err != nil {
+					return nil, err
+				}
+			}
 		default:
 			return nil, fmt.Errorf("first argument must be an ArrayValue or JSONNode containing array, got %T", args[0])
 		}
@@ -317,4 +352,101 @@ func registerYAMLFileOps(rt *Runtime) {
 
 		return Bool(true), nil
 	})
+
+	rt.Register("yamlRegisterTag", func(args ...Value) (Value, error) {
+		if len(args) < 2 || len(args) > 3 {
+			return nil, errors.New("yamlRegisterTag requires 2 or 3 arguments: tag, decodeFunction, [encodeFunction]")
+		}
+
+		// Unwrap arguments
+		for i, arg := range args {
+			if tvar, ok := arg.(ScopeEntry); ok {
+				args[i] = tvar.Value
+			}
+		}
+
+		tag, ok := args[0].(Str)
+		if !ok || !strings.HasPrefix(string(tag), "!") {
+			return nil, fmt.Errorf("tag must be a string starting with '!', got %v", args[0])
+		}
+		if yamlStandardTags[string(tag)] {
+			return nil, fmt.Errorf("cannot register standard YAML tag '%s'", tag)
+		}
+		decode, ok := args[1].(*FunctionValue)
+		if !ok {
+			return nil, fmt.Errorf("decodeFunction must be a function, got %T", args[1])
+		}
+		handler := &yamlTagHandler{decode: decode}
+		if len(args) == 3 {
+			if handler.encode, ok = args[2].(*FunctionValue); !ok {
+				return nil, fmt.Errorf("encodeFunction must be a function, got %T", args[2])
+			}
+		}
+
+		if rt.yamlTags == nil {
+			rt.yamlTags = make(map[string]*yamlTagHandler)
+		}
+		rt.yamlTags[string(tag)] = handler
+
+		return Bool(true), nil
+	})
+
+	rt.Register("yamlValidate", func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, errors.New("yamlValidate requires 2 arguments: node or YAML string, schema")
+		}
+
+		// Unwrap arguments
+		for i, arg := range args {
+			if tvar, ok := arg.(ScopeEntry); ok {
+				args[i] = tvar.Value
+			}
+		}
+
+		data, err := yamlNativeData(rt, args[0])
+		if err != nil {
+			return nil, fmt.Errorf("yamlValidate: %v", err)
+		}
+		schemaData, err := yamlNativeData(rt, args[1])
+		if err != nil {
+			return nil, fmt.Errorf("yamlValidate: schema: %v", err)
+		}
+		schema, ok := schemaData.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("yamlValidate: schema must be a mapping, got %T", schemaData)
+		}
+
+		messages, err := validateSchema(data, schema)
+		if err != nil {
+			return nil, fmt.Errorf("yamlValidate: %v", err)
+		}
+
+		errs := NewArray()
+		for _, msg := range messages {
+			errs.Append(Str(msg))
+		}
+		result := NewMap()
+		result.Set("valid", Bool(len(messages) == 0))
+		result.Set("errors", errs)
+		return result, nil
+	})
+}
+
+// yamlNativeData returns the native data of a JSONNode, a YAML (or JSON)
+// string, or another script value.
+func yamlNativeData(rt *Runtime, v Value) (interface{}, error) {
+	switch x := v.(type) {
+	case *JSONNode:
+		return x.GetJSONValue(), nil
+	case Str:
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(x), &doc); err != nil {
+			return nil, fmt.Errorf("invalid YAML: %v", err)
+		}
+		if doc.Kind != yaml.DocumentNode {
+			return nil, nil
+		}
+		return newYAMLCodec(rt).decodeDocument(&doc)
+	}
+	return ConvertToNativeJSON(v), nil
 }
@@ -0,0 +1,177 @@
+package chariot
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// validateSchema checks native data against a JSON Schema subset: type,
+// enum, const, properties, required, additionalProperties, items,
+// minItems, maxItems, minimum, maximum, minLength, maxLength and pattern.
+// It returns one message per violation, prefixed with the dotted path of
+// the value, "" standing for the document itself.
+func validateSchema(data interface{}, schema map[string]interface{}) ([]string, error) {
+	errs := []string{}
+	if err := validateSchemaAt("", data, schema, &errs); err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func schemaTypeOf(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if x == math.Trunc(x) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func schemaNumber(v interface{}) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+func validateSchemaAt(path string, v interface{}, schema map[string]interface{}, errs *[]string) error {
+	fail := func(format string, args ...interface{}) {
+		where := path
+		if where == "" {
+			where = "(document)"
+		}
+		*errs = append(*errs, where+": "+fmt.Sprintf(format, args...))
+	}
+
+	if t, ok := schema["type"]; ok {
+		allowed := []string{}
+		switch x := t.(type) {
+		case string:
+			allowed = append(allowed, x)
+		case []interface{}:
+			for _, item := range x {
+				if s, ok := item.(string); ok {
+					allowed = append(allowed, s)
+				}
+			}
+		default:
+			return fmt.Errorf("schema at %q: type must be a string or an array", path)
+		}
+		actual := schemaTypeOf(v)
+		matched := false
+		for _, a := range allowed {
+			if a == actual || (a == "number" && actual == "integer") {
+				matched = true
+			}
+		}
+		if !matched {
+			fail("must be %s, not %s", strings.Join(allowed, " or "), actual)
+			return nil // Other checks assume the type
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+			}
+		}
+		if !found {
+			fail("must be one of %v", enum)
+		}
+	}
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, v) {
+		fail("must be %v", c)
+	}
+
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				if name, ok := r.(string); ok {
+					if _, present := x[name]; !present {
+						fail("missing required property %q", name)
+					}
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			childPath := joinNodePath(path, k)
+			if sub, ok := properties[k].(map[string]interface{}); ok {
+				if err := validateSchemaAt(childPath, x[k], sub, errs); err != nil {
+					return err
+				}
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					fail("property %q is not allowed", k)
+				}
+			case map[string]interface{}:
+				if err := validateSchemaAt(childPath, x[k], extra, errs); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if n, ok := schemaNumber(schema["minItems"]); ok && float64(len(x)) < n {
+			fail("must have at least %v items", n)
+		}
+		if n, ok := schemaNumber(schema["maxItems"]); ok && float64(len(x)) > n {
+			fail("must have at most %v items", n)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range x {
+				if err := validateSchemaAt(fmt.Sprintf("%s[%d]", path, i), item, items, errs); err != nil {
+					return err
+				}
+			}
+		}
+	case float64:
+		if n, ok := schemaNumber(schema["minimum"]); ok && x < n {
+			fail("must be at least %v", n)
+		}
+		if n, ok := schemaNumber(schema["maximum"]); ok && x > n {
+			fail("must be at most %v", n)
+		}
+	case string:
+		length := float64(len([]rune(x)))
+		if n, ok := schemaNumber(schema["minLength"]); ok && length < n {
+			fail("must be at least %v characters", n)
+		}
+		if n, ok := schemaNumber(schema["maxLength"]); ok && length > n {
+			fail("must be at most %v characters", n)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return fmt.Errorf("schema at %q: invalid pattern: %v", path, err)
+			}
+			if !re.MatchString(x) {
+				fail("must match %s", p)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,484 @@
+// Package charts renders simple line, bar and scatter charts as SVG or PNG
+// using only the standard library, so scripts can return plots without the
+// server depending on a graphics toolkit.
+//
+// A Chart is laid out once and drawn onto a canvas; the SVG canvas emits
+// elements and the PNG canvas rasterizes the same shapes, using a small
+// built-in bitmap font for text.
+package charts
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+)
+
+// Kind selects how series are drawn.
+type Kind string
+
+const (
+	Line    Kind = "line"
+	Bar     Kind = "bar"
+	Scatter Kind = "scatter"
+)
+
+// Format is an output format.
+type Format string
+
+const (
+	SVG Format = "svg"
+	PNG Format = "png"
+)
+
+const (
+	DefaultWidth  = 640
+	DefaultHeight = 400
+	MaxSize       = 4000 // limit on either dimension
+)
+
+// Series is one named sequence of values.
+type Series struct {
+	Name   string
+	Values []float64
+}
+
+// Chart describes a chart to render.
+type Chart struct {
+	Kind   Kind
+	Title  string
+	XLabel string
+	YLabel string
+	// X holds numeric x coordinates for line and scatter charts; when empty
+	// the values are spaced evenly.
+	X []float64
+	// Labels names the points along the x axis; ignored when X is set.
+	Labels []string
+	Series []Series
+	Width  int
+	Height int
+}
+
+// MimeType returns the media type of a format.
+func (f Format) MimeType() string {
+	if f == PNG {
+		return "image/png"
+	}
+	return "image/svg+xml"
+}
+
+// Render draws the chart in the given format.
+func (c *Chart) Render(format Format) ([]byte, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	switch format {
+	case SVG, "":
+		cv := newSVGCanvas(c.width(), c.height())
+		c.draw(cv)
+		return cv.bytes(), nil
+	case PNG:
+		cv := newRasterCanvas(c.width(), c.height())
+		c.draw(cv)
+		return cv.bytes()
+	}
+	return nil, fmt.Errorf("unknown chart format %q (use svg or png)", format)
+}
+
+func (c *Chart) validate() error {
+	switch c.Kind {
+	case Line, Bar, Scatter, "":
+	default:
+		return fmt.Errorf("unknown chart type %q (use line, bar or scatter)", c.Kind)
+	}
+	if len(c.Series) == 0 {
+		return errors.New("chart has no series")
+	}
+	n := c.points()
+	if n == 0 {
+		return errors.New("chart has no values")
+	}
+	for _, s := range c.Series {
+		if len(s.Values) != n {
+			return fmt.Errorf("series %q has %d values, expected %d", s.Name, len(s.Values), n)
+		}
+	}
+	if len(c.X) > 0 && len(c.X) != n {
+		return fmt.Errorf("chart has %d x values for %d points", len(c.X), n)
+	}
+	if c.Width < 0 || c.Height < 0 || c.Width > MaxSize || c.Height > MaxSize {
+		return fmt.Errorf("chart size must be at most %dx%d", MaxSize, MaxSize)
+	}
+	return nil
+}
+
+func (c *Chart) kind() Kind {
+	if c.Kind == "" {
+		return Line
+	}
+	return c.Kind
+}
+
+func (c *Chart) points() int { return len(c.Series[0].Values) }
+
+func (c *Chart) width() int {
+	if c.Width == 0 {
+		return DefaultWidth
+	}
+	return c.Width
+}
+
+func (c *Chart) height() int {
+	if c.Height == 0 {
+		return DefaultHeight
+	}
+	return c.Height
+}
+
+// numericX reports whether points are placed by their X coordinate rather
+// than by index.
+func (c *Chart) numericX() bool { return len(c.X) > 0 && c.kind() != Bar }
+
+// Layout constants, in pixels.
+const (
+	fontSize      = 12
+	titleSize     = 16
+	charWidth     = 8 // advance of fontSize text, generous for SVG fonts
+	tickLength    = 4
+	legendSwatch  = 10
+	marginRight   = 20
+	marginTop     = 20
+	marginBottom  = 36
+	maxXTickCount = 10
+)
+
+var (
+	black     = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	gridColor = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+	palette   = []color.RGBA{
+		{0x1f, 0x77, 0xb4, 0xff},
+		{0xff, 0x7f, 0x0e, 0xff},
+		{0x2c, 0xa0, 0x2c, 0xff},
+		{0xd6, 0x27, 0x28, 0xff},
+		{0x94, 0x67, 0xbd, 0xff},
+		{0x8c, 0x56, 0x4b, 0xff},
+		{0xe3, 0x77, 0xc2, 0xff},
+		{0x7f, 0x7f, 0x7f, 0xff},
+	}
+)
+
+type anchor int
+
+const (
+	anchorStart anchor = iota
+	anchorMiddle
+	anchorEnd
+)
+
+// canvas is what a chart is drawn on. Coordinates are pixels from the top
+// left; text is positioned by its baseline.
+type canvas interface {
+	line(x1, y1, x2, y2 float64, c color.RGBA, width float64)
+	polyline(xs, ys []float64, c color.RGBA, width float64)
+	rect(x, y, w, h float64, c color.RGBA)
+	circle(x, y, r float64, c color.RGBA)
+	text(x, y float64, s string, size int, a anchor, vertical bool, c color.RGBA)
+}
+
+// draw lays the chart out and draws it on cv.
+func (c *Chart) draw(cv canvas) {
+	w, h := float64(c.width()), float64(c.height())
+	yMin, yMax := c.valueRange()
+	yTicks := niceTicks(yMin, yMax, 5)
+	yMin, yMax = yTicks[0], yTicks[len(yTicks)-1]
+
+	// Plot area
+	left := 40.0
+	for _, t := range yTicks {
+		if l := float64(len(formatTick(t, yTicks))*charWidth) + 16; l > left {
+			left = l
+		}
+	}
+	if c.YLabel != "" {
+		left += fontSize + 6
+	}
+	top := float64(marginTop)
+	if c.Title != "" {
+		top += titleSize + 6
+	}
+	bottom := h - marginBottom
+	if c.XLabel != "" {
+		bottom -= fontSize + 6
+	}
+	right := w - marginRight
+	if len(c.Series) > 1 {
+		right -= c.legendWidth()
+	}
+	if right-left < 20 || bottom-top < 20 {
+		// Too small for axes; draw the title only
+		cv.text(w/2, top, c.Title, titleSize, anchorMiddle, false, black)
+		return
+	}
+	ypos := func(v float64) float64 {
+		if yMax == yMin {
+			return (top + bottom) / 2
+		}
+		return bottom - (v-yMin)/(yMax-yMin)*(bottom-top)
+	}
+
+	if c.Title != "" {
+		cv.text(w/2, marginTop+titleSize-2, c.Title, titleSize, anchorMiddle, false, black)
+	}
+	if c.YLabel != "" {
+		cv.text(6+fontSize, (top+bottom)/2, c.YLabel, fontSize, anchorMiddle, true, black)
+	}
+	if c.XLabel != "" {
+		cv.text((left+right)/2, h-10, c.XLabel, fontSize, anchorMiddle, false, black)
+	}
+
+	// Horizontal grid and y ticks
+	for _, t := range yTicks {
+		y := ypos(t)
+		cv.line(left, y, right, y, gridColor, 1)
+		cv.text(left-tickLength-3, y+4, formatTick(t, yTicks), fontSize, anchorEnd, false, black)
+	}
+
+	// x positions of the points and the x axis ticks
+	n := c.points()
+	xs := make([]float64, n)
+	switch {
+	case c.numericX():
+		xMin, xMax := minMax(c.X)
+		xTicks := niceTicks(xMin, xMax, 6)
+		xMin, xMax = xTicks[0], xTicks[len(xTicks)-1]
+		xpos := func(v float64) float64 {
+			if xMax == xMin {
+				return (left + right) / 2
+			}
+			return left + (v-xMin)/(xMax-xMin)*(right-left)
+		}
+		for i, v := range c.X {
+			xs[i] = xpos(v)
+		}
+		for _, t := range xTicks {
+			x := xpos(t)
+			cv.line(x, bottom, x, bottom+tickLength, black, 1)
+			cv.text(x, bottom+tickLength+fontSize+2, formatTick(t, xTicks), fontSize, anchorMiddle, false, black)
+		}
+	default:
+		// Evenly spaced slots; bars and markers sit in the middle of
+		// theirs, lines run edge to edge
+		slot := (right - left) / float64(n)
+		for i := range xs {
+			xs[i] = left + slot*(float64(i)+0.5)
+		}
+		if c.kind() == Line && n > 1 {
+			slot = (right - left) / float64(n-1)
+			for i := range xs {
+				xs[i] = left + slot*float64(i)
+			}
+		}
+		step := 1
+		if maxWidth := c.maxLabelWidth() + charWidth; maxWidth > slot || n > maxXTickCount {
+			step = int(math.Ceil(math.Max(maxWidth/slot, float64(n)/maxXTickCount)))
+		}
+		for i := 0; i < n; i += step {
+			cv.line(xs[i], bottom, xs[i], bottom+tickLength, black, 1)
+			cv.text(xs[i], bottom+tickLength+fontSize+2, c.label(i), fontSize, anchorMiddle, false, black)
+		}
+	}
+
+	// Series
+	zero := ypos(math.Max(yMin, math.Min(0, yMax)))
+	switch c.kind() {
+	case Bar:
+		slot := (right - left) / float64(n)
+		barWidth := slot * 0.8 / float64(len(c.Series))
+		for si, s := range c.Series {
+			col := palette[si%len(palette)]
+			for i, v := range s.Values {
+				x := xs[i] - slot*0.4 + barWidth*float64(si)
+				y := ypos(v)
+				if y > zero {
+					cv.rect(x, zero, barWidth, y-zero, col)
+				} else {
+					cv.rect(x, y, barWidth, zero-y, col)
+				}
+			}
+		}
+	case Scatter:
+		for si, s := range c.Series {
+			col := palette[si%len(palette)]
+			for i, v := range s.Values {
+				if !isFinite(v) {
+					continue
+				}
+				cv.circle(xs[i], ypos(v), 3, col)
+			}
+		}
+	default:
+		for si, s := range c.Series {
+			col := palette[si%len(palette)]
+			// Non-finite values break the line
+			var px, py []float64
+			for i, v := range s.Values {
+				if !isFinite(v) {
+					cv.polyline(px, py, col, 2)
+					px, py = nil, nil
+					continue
+				}
+				px = append(px, xs[i])
+				py = append(py, ypos(v))
+			}
+			cv.polyline(px, py, col, 2)
+			if n <= 30 {
+				for i := range px {
+					cv.circle(px[i], py[i], 2.5, col)
+				}
+			}
+		}
+	}
+
+	// Axes
+	cv.line(left, top, left, bottom, black, 1)
+	cv.line(left, zero, right, zero, black, 1)
+	if zero != bottom {
+		cv.line(left, bottom, right, bottom, gridColor, 1)
+	}
+
+	// Legend
+	if len(c.Series) > 1 {
+		lx := right + 12
+		for si, s := range c.Series {
+			ly := top + float64(si)*(fontSize+8)
+			cv.rect(lx, ly, legendSwatch, legendSwatch, palette[si%len(palette)])
+			cv.text(lx+legendSwatch+6, ly+legendSwatch, s.seriesName(si), fontSize, anchorStart, false, black)
+		}
+	}
+}
+
+func (s Series) seriesName(i int) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return "series " + strconv.Itoa(i+1)
+}
+
+func (c *Chart) legendWidth() float64 {
+	longest := 0
+	for i, s := range c.Series {
+		if l := len(s.seriesName(i)); l > longest {
+			longest = l
+		}
+	}
+	return float64(12 + legendSwatch + 6 + longest*charWidth)
+}
+
+// label returns the x axis label of point i.
+func (c *Chart) label(i int) string {
+	switch {
+	case i < len(c.Labels):
+		return c.Labels[i]
+	case len(c.X) > 0:
+		return strconv.FormatFloat(c.X[i], 'g', 6, 64)
+	}
+	return strconv.Itoa(i + 1)
+}
+
+func (c *Chart) maxLabelWidth() float64 {
+	longest := 0
+	for i := 0; i < c.points(); i++ {
+		if l := len(c.label(i)); l > longest {
+			longest = l
+		}
+	}
+	return float64(longest * charWidth)
+}
+
+// valueRange returns the range of the finite values, including zero for bar
+// charts so bars start at the axis.
+func (c *Chart) valueRange() (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range c.Series {
+		for _, v := range s.Values {
+			if isFinite(v) {
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+		}
+	}
+	if math.IsInf(lo, 1) {
+		return 0, 1
+	}
+	if c.kind() == Bar {
+		lo, hi = math.Min(lo, 0), math.Max(hi, 0)
+	}
+	return lo, hi
+}
+
+func minMax(vs []float64) (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range vs {
+		if isFinite(v) {
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+	}
+	if math.IsInf(lo, 1) {
+		return 0, 1
+	}
+	return lo, hi
+}
+
+func isFinite(v float64) bool { return !math.IsNaN(v) && !math.IsInf(v, 0) }
+
+// niceTicks returns about count round tick values covering [lo, hi].
+func niceTicks(lo, hi float64, count int) []float64 {
+	if lo == hi {
+		if lo == 0 {
+			hi = 1
+		} else {
+			d := math.Abs(lo) / 2
+			lo, hi = lo-d, hi+d
+		}
+	}
+	step := niceNum((hi - lo) / float64(count-1))
+	start := math.Floor(lo/step) * step
+	end := math.Ceil(hi/step) * step
+	var ticks []float64
+	for v := start; v <= end+step/2; v += step {
+		// Snap to the step to avoid 0.30000000000000004
+		ticks = append(ticks, math.Round(v/step)*step)
+	}
+	return ticks
+}
+
+// niceNum rounds x to 1, 2 or 5 times a power of ten.
+func niceNum(x float64) float64 {
+	exp := math.Floor(math.Log10(x))
+	f := x / math.Pow(10, exp)
+	switch {
+	case f < 1.5:
+		f = 1
+	case f < 3:
+		f = 2
+	case f < 7:
+		f = 5
+	default:
+		f = 10
+	}
+	return f * math.Pow(10, exp)
+}
+
+// formatTick formats a tick with as many decimals as the tick spacing needs.
+func formatTick(v float64, ticks []float64) string {
+	if math.Abs(v) >= 1e6 || (v != 0 && math.Abs(v) < 1e-4) {
+		return strconv.FormatFloat(v, 'g', 3, 64)
+	}
+	decimals := 0
+	if len(ticks) > 1 {
+		if step := ticks[1] - ticks[0]; step < 1 {
+			decimals = int(math.Ceil(-math.Log10(step) - 1e-9))
+		}
+	}
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
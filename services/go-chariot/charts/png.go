@@ -0,0 +1,196 @@
+package charts
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+)
+
+// rasterCanvas draws onto an RGBA image.
+type rasterCanvas struct {
+	img *image.RGBA
+}
+
+func newRasterCanvas(w, h int) *rasterCanvas {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	return &rasterCanvas{img: img}
+}
+
+func (cv *rasterCanvas) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, cv.img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (cv *rasterCanvas) set(x, y int, c color.RGBA) {
+	if image.Pt(x, y).In(cv.img.Rect) {
+		cv.img.SetRGBA(x, y, c)
+	}
+}
+
+// dot fills a width-sized square centred on (x, y).
+func (cv *rasterCanvas) dot(x, y float64, c color.RGBA, width float64) {
+	if width <= 1 {
+		cv.set(int(math.Floor(x)), int(math.Floor(y)), c)
+		return
+	}
+	half := width / 2
+	for py := int(math.Floor(y - half + 0.5)); py < int(math.Floor(y+half+0.5)); py++ {
+		for px := int(math.Floor(x - half + 0.5)); px < int(math.Floor(x+half+0.5)); px++ {
+			cv.set(px, py, c)
+		}
+	}
+}
+
+func (cv *rasterCanvas) line(x1, y1, x2, y2 float64, c color.RGBA, width float64) {
+	steps := int(math.Ceil(math.Max(math.Abs(x2-x1), math.Abs(y2-y1))))
+	if steps == 0 {
+		cv.dot(x1, y1, c, width)
+		return
+	}
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		cv.dot(x1+(x2-x1)*t, y1+(y2-y1)*t, c, width)
+	}
+}
+
+func (cv *rasterCanvas) polyline(xs, ys []float64, c color.RGBA, width float64) {
+	for i := 1; i < len(xs); i++ {
+		cv.line(xs[i-1], ys[i-1], xs[i], ys[i], c, width)
+	}
+}
+
+func (cv *rasterCanvas) rect(x, y, w, h float64, c color.RGBA) {
+	r := image.Rect(int(math.Round(x)), int(math.Round(y)), int(math.Round(x+w)), int(math.Round(y+h))).Intersect(cv.img.Rect)
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		for px := r.Min.X; px < r.Max.X; px++ {
+			cv.img.SetRGBA(px, py, c)
+		}
+	}
+}
+
+func (cv *rasterCanvas) circle(x, y, r float64, c color.RGBA) {
+	for py := int(math.Floor(y - r)); py <= int(math.Ceil(y+r)); py++ {
+		for px := int(math.Floor(x - r)); px <= int(math.Ceil(x+r)); px++ {
+			dx, dy := float64(px)+0.5-x, float64(py)+0.5-y
+			if dx*dx+dy*dy <= r*r {
+				cv.set(px, py, c)
+			}
+		}
+	}
+}
+
+// text draws s with the bitmap font, scaled to roughly size pixels high.
+// Lower case letters are drawn as capitals.
+func (cv *rasterCanvas) text(x, y float64, s string, size int, a anchor, vertical bool, c color.RGBA) {
+	scale := int(math.Max(1, math.Round(float64(size)/6)))
+	s = strings.ToUpper(s)
+	advance := (glyphWidth + 1) * scale
+	width := len([]rune(s))*advance - scale
+	var start int
+	switch a {
+	case anchorMiddle:
+		start = -width / 2
+	case anchorEnd:
+		start = -width
+	}
+	ox, oy := int(math.Round(x)), int(math.Round(y))
+	for i, r := range []rune(s) {
+		g, ok := glyphs[r]
+		if !ok {
+			g = glyphs['?']
+		}
+		for row := 0; row < glyphHeight; row++ {
+			for col := 0; col < glyphWidth; col++ {
+				if g[row*glyphWidth+col] != '1' {
+					continue
+				}
+				// Offsets along and across the baseline
+				along := start + i*advance + col*scale
+				across := (row - glyphHeight) * scale
+				for sy := 0; sy < scale; sy++ {
+					for sx := 0; sx < scale; sx++ {
+						if vertical {
+							cv.set(ox+across+sy, oy-along-sx, c)
+						} else {
+							cv.set(ox+along+sx, oy+across+sy, c)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+)
+
+// glyphs is a 3x5 pixel font; each glyph lists its rows top to bottom.
+var glyphs = map[rune]string{
+	' ':  "000000000000000",
+	'0':  "111101101101111",
+	'1':  "010110010010111",
+	'2':  "111001111100111",
+	'3':  "111001111001111",
+	'4':  "101101111001001",
+	'5':  "111100111001111",
+	'6':  "111100111101111",
+	'7':  "111001001001001",
+	'8':  "111101111101111",
+	'9':  "111101111001111",
+	'A':  "010101111101101",
+	'B':  "110101110101110",
+	'C':  "011100100100011",
+	'D':  "110101101101110",
+	'E':  "111100110100111",
+	'F':  "111100110100100",
+	'G':  "011100101101011",
+	'H':  "101101111101101",
+	'I':  "111010010010111",
+	'J':  "001001001101010",
+	'K':  "101101110101101",
+	'L':  "100100100100111",
+	'M':  "101111111101101",
+	'N':  "110101101101101",
+	'O':  "010101101101010",
+	'P':  "110101110100100",
+	'Q':  "010101101110011",
+	'R':  "110101110101101",
+	'S':  "011100010001110",
+	'T':  "111010010010010",
+	'U':  "101101101101111",
+	'V':  "101101101101010",
+	'W':  "101101111111101",
+	'X':  "101101010101101",
+	'Y':  "101101010010010",
+	'Z':  "111001010100111",
+	'.':  "000000000000010",
+	',':  "000000000010100",
+	'-':  "000000111000000",
+	'+':  "000010111010000",
+	':':  "000010000010000",
+	'/':  "001001010100100",
+	'%':  "101001010100101",
+	'(':  "010100100100010",
+	')':  "010001001001010",
+	'_':  "000000000000111",
+	'\'': "010010000000000",
+	'!':  "010010010000010",
+	'?':  "110001010000010",
+	'=':  "000111000111000",
+	'#':  "101111101111101",
+	'<':  "001010100010001",
+	'>':  "100010001010100",
+	'*':  "000101010101000",
+	'&':  "010101010101011",
+}
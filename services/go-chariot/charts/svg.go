@@ -0,0 +1,74 @@
+package charts
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+type svgCanvas struct {
+	buf bytes.Buffer
+}
+
+func newSVGCanvas(w, h int) *svgCanvas {
+	cv := &svgCanvas{}
+	fmt.Fprintf(&cv.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif">`+"\n", w, h, w, h)
+	fmt.Fprintf(&cv.buf, `<rect width="%d" height="%d" fill="#ffffff"/>`+"\n", w, h)
+	return cv
+}
+
+func (cv *svgCanvas) bytes() []byte {
+	cv.buf.WriteString("</svg>\n")
+	return cv.buf.Bytes()
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// num formats a coordinate compactly.
+func num(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 32)
+}
+
+func (cv *svgCanvas) line(x1, y1, x2, y2 float64, c color.RGBA, width float64) {
+	fmt.Fprintf(&cv.buf, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="%s" stroke-width="%s"/>`+"\n",
+		num(x1), num(y1), num(x2), num(y2), hexColor(c), num(width))
+}
+
+func (cv *svgCanvas) polyline(xs, ys []float64, c color.RGBA, width float64) {
+	if len(xs) < 2 {
+		return
+	}
+	points := make([]string, len(xs))
+	for i := range xs {
+		points[i] = num(xs[i]) + "," + num(ys[i])
+	}
+	fmt.Fprintf(&cv.buf, `<polyline points="%s" fill="none" stroke="%s" stroke-width="%s" stroke-linejoin="round"/>`+"\n",
+		strings.Join(points, " "), hexColor(c), num(width))
+}
+
+func (cv *svgCanvas) rect(x, y, w, h float64, c color.RGBA) {
+	fmt.Fprintf(&cv.buf, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`+"\n",
+		num(x), num(y), num(w), num(h), hexColor(c))
+}
+
+func (cv *svgCanvas) circle(x, y, r float64, c color.RGBA) {
+	fmt.Fprintf(&cv.buf, `<circle cx="%s" cy="%s" r="%s" fill="%s"/>`+"\n", num(x), num(y), num(r), hexColor(c))
+}
+
+func (cv *svgCanvas) text(x, y float64, s string, size int, a anchor, vertical bool, c color.RGBA) {
+	if s == "" {
+		return
+	}
+	anchors := [...]string{"start", "middle", "end"}
+	rotate := ""
+	if vertical {
+		rotate = fmt.Sprintf(` transform="rotate(-90 %s %s)"`, num(x), num(y))
+	}
+	fmt.Fprintf(&cv.buf, `<text x="%s" y="%s" font-size="%d" text-anchor="%s" fill="%s"%s>%s</text>`+"\n",
+		num(x), num(y), size, anchors[a], hexColor(c), rotate, html.EscapeString(s))
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/storage"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/vault"
+	"go.uber.org/zap"
+)
+
+// Exit codes of "go-chariot run", so schedulers can tell a failing script
+// from a bad invocation or a hung one.
+const (
+	exitOK          = 0
+	exitScriptError = 1
+	exitUsage       = 2
+	exitTimeout     = 124 // same as coreutils timeout(1)
+)
+
+// varFlags collects repeated --var name=value flags.
+type varFlags []string
+
+func (v *varFlags) String() string { return strings.Join(*v, ",") }
+
+func (v *varFlags) Set(s string) error {
+	name, _, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	*v = append(*v, s)
+	return nil
+}
+
+// batchValue converts a --var value: numbers and true/false keep their type,
+// anything else is a string.
+func batchValue(s string) chariot.Value {
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return chariot.Number(n)
+	}
+	switch s {
+	case "true":
+		return chariot.Bool(true)
+	case "false":
+		return chariot.Bool(false)
+	}
+	return chariot.Str(s)
+}
+
+// runBatch implements "go-chariot run": it executes one script in a local
+// runtime, without the REST server, and returns the process exit code. All
+// logs, including the script's logPrint calls and the final result, are
+// written to stdout as JSON lines.
+func runBatch(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	file := fs.String("file", "", "script to run (.ch)")
+	timeout := fs.Duration("timeout", 0, "abort the run after this long, e.g. 10m (0 = no limit)")
+	noBootstrap := fs.Bool("no-bootstrap", false, "skip the function library and bootstrap script")
+	var vars varFlags
+	fs.Var(&vars, "var", "set a global variable, name=value (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: go-chariot run --file script.ch [--var name=value ...] [--timeout 10m] [--no-bootstrap]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *file == "" && fs.NArg() == 1 {
+		*file = fs.Arg(0)
+	}
+	if *file == "" || fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	slogger := logs.NewZapLoggerTo("stdout")
+	defer slogger.Sync()
+	cfg.ChariotLogger = slogger
+
+	src, err := os.ReadFile(*file)
+	if err != nil {
+		slogger.Error("Failed to read script", zap.String("file", *file), zap.Error(err))
+		return exitUsage
+	}
+	if err := vault.InitVaultClient(); err != nil {
+		// Scripts that do not touch secrets can still run
+		slogger.Warn("Vault client unavailable", zap.Error(err))
+	}
+	files, err := openStorage()
+	if err != nil {
+		slogger.Error("Failed to open storage provider", zap.Error(err))
+		return exitUsage
+	}
+	defer files.Close()
+	storage.Use(files)
+
+	loadPlugins()
+	defer chariot.StopPlugins()
+	loadSandboxProfiles()
+
+	var rt *chariot.Runtime
+	if *noBootstrap {
+		rt = chariot.NewRuntime()
+		chariot.RegisterAll(rt)
+	} else {
+		rt = newBootstrapRuntime()
+	}
+	for _, kv := range vars {
+		name, value, _ := strings.Cut(kv, "=")
+		rt.SetGlobalVariable(strings.TrimSpace(name), batchValue(value))
+	}
+
+	type outcome struct {
+		val chariot.Value
+		err error
+	}
+	done := make(chan outcome, 1)
+	start := time.Now()
+	slogger.Info("Run started", zap.String("file", *file), zap.Strings("vars", vars))
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: fmt.Errorf("panic: %v", r)}
+			}
+		}()
+		val, err := rt.ExecProgramWithFilename(string(src), *file)
+		done <- outcome{val: val, err: err}
+	}()
+
+	var expired <-chan time.Time
+	if *timeout > 0 {
+		timer := time.NewTimer(*timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case res := <-done:
+		elapsed := time.Since(start)
+		if res.err != nil {
+			info := chariot.DescribeError(res.err)
+			slogger.Error("Run failed",
+				zap.String("file", *file),
+				zap.Int("line", info.Line),
+				zap.String("error", info.Message),
+				zap.Duration("duration", elapsed))
+			return exitScriptError
+		}
+		slogger.Info("Run finished",
+			zap.String("file", *file),
+			zap.Any("result", chariot.ValueToJSON(res.val)),
+			zap.Duration("duration", elapsed))
+		return exitOK
+	case <-expired:
+		// The runtime cannot be interrupted; exiting abandons the run
+		slogger.Error("Run timed out",
+			zap.String("file", *file),
+			zap.Duration("timeout", *timeout))
+		return exitTimeout
+	}
+}
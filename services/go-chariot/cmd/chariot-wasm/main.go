@@ -0,0 +1,104 @@
+//go:build js && wasm
+
+// Command chariot-wasm exposes the Chariot parser and the diagram code
+// generator to the browser, so the editor checks syntax and previews
+// generated code with exactly the grammar and generator the server runs.
+//
+// Build it with:
+//
+//	GOOS=js GOARCH=wasm CGO_ENABLED=0 go build -o chariot.wasm ./cmd/chariot-wasm
+//
+// and load it with the wasm_exec.js shipped with the same Go release. Once
+// started it defines a global chariotWasm object:
+//
+//	chariotWasm.check(source, filename)  -> {ok, error: {message, file, line, column}}
+//	chariotWasm.generate(diagramJSON)    -> {code, sourceMap} or {error}
+//	chariotWasm.validate(diagramJSON)    -> {valid, issues} or {error}
+//
+// and calls window.onChariotWasmReady, if defined.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"syscall/js"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/codegen"
+)
+
+func main() {
+	api := js.Global().Get("Object").New()
+	api.Set("check", js.FuncOf(check))
+	api.Set("generate", js.FuncOf(generate))
+	api.Set("validate", js.FuncOf(validate))
+	js.Global().Set("chariotWasm", api)
+
+	if ready := js.Global().Get("onChariotWasmReady"); ready.Type() == js.TypeFunction {
+		ready.Invoke()
+	}
+	select {}
+}
+
+// check parses a script without running it.
+func check(_ js.Value, args []js.Value) (result interface{}) {
+	defer recoverTo(&result)
+	src, filename := argString(args, 0), argString(args, 1)
+	if filename == "" {
+		filename = "main.ch"
+	}
+	if _, err := chariot.ParseSource(src, filename); err != nil {
+		return toJS(map[string]interface{}{"ok": false, "error": chariot.DescribeError(err)})
+	}
+	return toJS(map[string]interface{}{"ok": true})
+}
+
+// generate converts a diagram document to Chariot code. Sub Diagram blocks
+// are not resolved in the browser; diagrams using them report an error.
+func generate(_ js.Value, args []js.Value) (result interface{}) {
+	defer recoverTo(&result)
+	d, err := codegen.ParseDiagram([]byte(argString(args, 0)))
+	if err != nil {
+		return toJS(map[string]interface{}{"error": err.Error()})
+	}
+	res, err := codegen.Generate(d)
+	if err != nil {
+		return toJS(map[string]interface{}{"error": err.Error()})
+	}
+	return toJS(map[string]interface{}{"code": res.Code, "sourceMap": res.SourceMap})
+}
+
+// validate reports structural problems in a diagram document.
+func validate(_ js.Value, args []js.Value) (result interface{}) {
+	defer recoverTo(&result)
+	d, err := codegen.ParseDiagram([]byte(argString(args, 0)))
+	if err != nil {
+		return toJS(map[string]interface{}{"error": err.Error()})
+	}
+	return toJS(codegen.Validate(d))
+}
+
+func argString(args []js.Value, i int) string {
+	if i >= len(args) || args[i].Type() != js.TypeString {
+		return ""
+	}
+	return args[i].String()
+}
+
+// toJS converts v to a plain JavaScript object through its JSON encoding, so
+// results have the same shape as the server's API responses.
+func toJS(v interface{}) js.Value {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	return js.Global().Get("JSON").Call("parse", string(data))
+}
+
+// recoverTo turns a panic in the parser or generator into an error result
+// instead of terminating the wasm instance.
+func recoverTo(result *interface{}) {
+	if r := recover(); r != nil {
+		*result = toJS(map[string]interface{}{"error": fmt.Sprintf("internal error: %v", r)})
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// config is what login stores between invocations.
+type config struct {
+	Server       string    `json:"server"`
+	Token        string    `json:"token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expires      time.Time `json:"expires,omitempty"` // when Token expires, if it is short-lived
+	User         string    `json:"user,omitempty"`
+}
+
+// configPath is ~/.chariotctl.json unless CHARIOTCTL_CONFIG names another file.
+func configPath() string {
+	if p := os.Getenv("CHARIOTCTL_CONFIG"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".chariotctl.json"
+	}
+	return filepath.Join(home, ".chariotctl.json")
+}
+
+func loadConfig() config {
+	var c config
+	if data, err := os.ReadFile(configPath()); err == nil {
+		_ = json.Unmarshal(data, &c)
+	}
+	return c
+}
+
+func saveConfig(c config) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The file holds a session token
+	return os.WriteFile(configPath(), data, 0o600)
+}
+
+// envelope is the backend's response format.
+type envelope struct {
+	Result string          `json:"result"`
+	Data   json.RawMessage `json:"data"`
+	Error  *struct {
+		Message string `json:"message"`
+		File    string `json:"file"`
+		Line    int    `json:"line"`
+	} `json:"error"`
+}
+
+// apiError is an ERROR response or an unexpected status.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s (HTTP %d)", e.Message, e.Status)
+}
+
+// client calls the go-chariot REST API with the session token. With a
+// refresh token it renews a short-lived token before it expires, and stores
+// the new pair when the token came from the config file. It may be used
+// from several goroutines, as loadgen does.
+type client struct {
+	server  string
+	mu      sync.Mutex // guards the tokens while they are refreshed
+	token   string
+	refresh string
+	expires time.Time
+	http    *http.Client
+}
+
+// tokenPair is the data of login and refresh responses.
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	User         string `json:"user"`
+}
+
+// setTokens makes the client use the tokens of a login or refresh response.
+func (c *client) setTokens(t tokenPair) {
+	c.token, c.refresh, c.expires = t.Token, t.RefreshToken, time.Time{}
+	if t.RefreshToken != "" {
+		c.expires = time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+	}
+}
+
+// refreshIfExpiring renews the token when it expires within half a minute;
+// c.mu must be held.
+func (c *client) refreshIfExpiring() error {
+	if c.refresh == "" || time.Until(c.expires) > 30*time.Second {
+		return nil
+	}
+	data, _ := json.Marshal(map[string]string{"refresh_token": c.refresh})
+	resp, err := c.http.Post(c.server+"/token/refresh", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var t tokenPair
+	if err := decodeEnvelope(resp, &t); err != nil {
+		return err
+	}
+	old := c.token
+	c.setTokens(t)
+	if stored := loadConfig(); stored.Token == old {
+		stored.Token, stored.RefreshToken, stored.Expires = c.token, c.refresh, c.expires
+		return saveConfig(stored)
+	}
+	return nil
+}
+
+// currentToken returns the token to send, refreshed if it is expiring.
+func (c *client) currentToken() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.refreshIfExpiring(); err != nil {
+		return "", fmt.Errorf("refresh token: %w", err)
+	}
+	return c.token, nil
+}
+
+func newClient(server, token string, insecure bool) *client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &client{
+		server: strings.TrimRight(server, "/"),
+		token:  token,
+		http:   &http.Client{Transport: transport},
+	}
+}
+
+func (c *client) request(method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	if c.server == "" {
+		return nil, errors.New("no server configured: pass -server or set CHARIOT_SERVER")
+	}
+	token, err := c.currentToken()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, c.server+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.http.Do(req)
+}
+
+// call sends a JSON request and decodes the envelope's data into out, which
+// may be nil. An ERROR result or a non-2xx status is returned as *apiError.
+func (c *client) call(method, path string, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+	resp, err := c.request(method, path, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeEnvelope(resp, out)
+}
+
+func decodeEnvelope(resp *http.Response, out interface{}) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		if resp.StatusCode >= 300 {
+			return &apiError{Status: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+		}
+		return fmt.Errorf("unexpected response: %w", err)
+	}
+	if env.Result == "ERROR" || resp.StatusCode >= 300 {
+		msg := strings.Trim(string(env.Data), `"`)
+		if env.Error != nil && env.Error.Message != "" {
+			msg = env.Error.Message
+			if env.Error.File != "" {
+				msg = fmt.Sprintf("%s:%d: %s", env.Error.File, env.Error.Line, msg)
+			}
+		}
+		if msg == "" {
+			msg = http.StatusText(resp.StatusCode)
+		}
+		return &apiError{Status: resp.StatusCode, Message: msg}
+	}
+	if out != nil && len(env.Data) > 0 {
+		return json.Unmarshal(env.Data, out)
+	}
+	return nil
+}
+
+// streamLogs follows the log stream of an execution until it is done,
+// passing each entry to emit.
+func (c *client) streamLogs(execID string, emit func(logEntry)) error {
+	resp, err := c.request(http.MethodGet, "/api/logs/"+execID, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return decodeEnvelope(resp, nil)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data := []byte(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+			switch event {
+			case "done":
+				return nil
+			case "result":
+				// A value the script emitted
+				emit(logEntry{Timestamp: time.Now(), Level: "RESULT", Value: data})
+				continue
+			}
+			var entry logEntry
+			if err := json.Unmarshal(data, &entry); err == nil {
+				emit(entry)
+			}
+		case line == "":
+			event = ""
+		}
+	}
+	return scanner.Err()
+}
+
+type logEntry struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Level     string          `json:"level"`
+	Message   string          `json:"message"`
+	Value     json.RawMessage `json:"value,omitempty"` // value emitted by the script, with level RESULT
+}
+
+func (e logEntry) String() string {
+	return fmt.Sprintf("%s %-5s %s", e.Timestamp.Local().Format("15:04:05.000"), e.Level, e.Message)
+}
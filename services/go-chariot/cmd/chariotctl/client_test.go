@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestClientLogsAndErrors verifies that the client follows a log stream, and
+// the values emitted on it, to its done event and reports ERROR results with
+// their message.
+func TestClientLogsAndErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/logs/exec-1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"result":"ERROR","data":"Invalid or expired session"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"level\":\"INFO\",\"message\":\"one\"}\n\n")
+		fmt.Fprint(w, "event: result\nid: 1\ndata: {\"batch\":1}\n\n")
+		fmt.Fprint(w, "data: {\"level\":\"INFO\",\"message\":\"two\"}\n\n")
+		fmt.Fprint(w, "event: done\ndata: {}\n\n")
+		fmt.Fprint(w, "data: {\"level\":\"INFO\",\"message\":\"after done\"}\n\n")
+	})
+	mux.HandleFunc("/api/listeners/missing/start", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"result":"ERROR","data":"listener not found"}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := newClient(srv.URL, "tok", false)
+	var got []string
+	err := c.streamLogs("exec-1", func(e logEntry) {
+		if e.Level == "RESULT" {
+			got = append(got, string(e.Value))
+			return
+		}
+		got = append(got, e.Message)
+	})
+	if err != nil {
+		t.Fatalf("streamLogs: %v", err)
+	}
+	if len(got) != 3 || got[0] != "one" || got[1] != `{"batch":1}` || got[2] != "two" {
+		t.Fatalf("expected the entries and results before the done event, got %v", got)
+	}
+
+	err = c.call(http.MethodPost, "/api/listeners/missing/start", nil, nil)
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest || apiErr.Message != "listener not found" {
+		t.Fatalf("expected the backend's error message, got %v", err)
+	}
+
+	err = newClient(srv.URL, "", false).streamLogs("exec-1", func(logEntry) {})
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Fatalf("expected an unauthorized error, got %v", err)
+	}
+}
+
+// TestClientRefreshesExpiringToken verifies that a token about to expire is
+// exchanged for a new pair before the request, and the pair is stored.
+func TestClientRefreshesExpiringToken(t *testing.T) {
+	t.Setenv("CHARIOTCTL_CONFIG", filepath.Join(t.TempDir(), "chariotctl.json"))
+	refreshes := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token/refresh", func(w http.ResponseWriter, r *http.Request) {
+		refreshes++
+		fmt.Fprint(w, `{"result":"OK","data":{"token":"tok-2","refresh_token":"ref-2","expires_in":900,"user":"alice"}}`)
+	})
+	mux.HandleFunc("/api/agents", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "tok-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"result":"ERROR","data":"Access token expired"}`)
+			return
+		}
+		fmt.Fprint(w, `{"result":"OK","data":[]}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	if err := saveConfig(config{Server: srv.URL, Token: "tok-1", RefreshToken: "ref-1", Expires: time.Now().Add(10 * time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(srv.URL, "tok-1", false)
+	c.refresh, c.expires = "ref-1", time.Now().Add(10*time.Second)
+	for i := 0; i < 2; i++ {
+		if err := c.call(http.MethodGet, "/api/agents", nil, nil); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	if refreshes != 1 {
+		t.Errorf("refreshed %d times, want once", refreshes)
+	}
+	if stored := loadConfig(); stored.Token != "tok-2" || stored.RefreshToken != "ref-2" || time.Until(stored.Expires) < 10*time.Minute {
+		t.Errorf("stored %+v", stored)
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/workspace"
+)
+
+// command is one chariotctl subcommand.
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(c *client, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"login", "login [-u user] [-p password]", "log in and store the session token", cmdLogin},
+		{"logout", "logout", "end the stored session", cmdLogout},
+		{"run", "run [-sync] [-runtime session|ephemeral] <file>", "execute a script, streaming its logs", cmdRun},
+		{"logs", "logs <execution-id>", "tail the logs of an execution, then print its result", cmdLogs},
+		{"listeners", "listeners list|create|delete|start|stop ...", "manage listeners", cmdListeners},
+		{"agents", "agents list", "list agents", cmdAgents},
+		{"library", "library export|import <file.json>", "export or import the function library", cmdLibrary},
+		{"workspace", "workspace pull|push [-scope s] [-policy p] <dir>", "sync files, diagrams, functions and listeners with a directory", cmdWorkspace},
+		{"loadgen", "loadgen [-duration d] [-concurrency n] [-rate r] [-mix execute=70,files=20,ws=10] [-json]", "generate synthetic traffic and report latencies and error rates", cmdLoadgen},
+	}
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func cmdLogin(c *client, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	user := fs.String("u", os.Getenv("CHARIOT_USER"), "username")
+	password := fs.String("p", os.Getenv("CHARIOT_PASSWORD"), "password; read from stdin when empty")
+	fs.Parse(args)
+	if *user == "" {
+		return errors.New("login requires -u or CHARIOT_USER")
+	}
+	if *password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("read password: %w", err)
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+	var out tokenPair
+	c.setTokens(tokenPair{})
+	if err := c.call(http.MethodPost, "/login", map[string]string{"username": *user, "password": *password}, &out); err != nil {
+		return err
+	}
+	c.setTokens(out)
+	if err := saveConfig(config{Server: c.server, Token: c.token, RefreshToken: c.refresh, Expires: c.expires, User: out.User}); err != nil {
+		return fmt.Errorf("store token: %w", err)
+	}
+	fmt.Printf("Logged in to %s as %s\n", c.server, out.User)
+	return nil
+}
+
+func cmdLogout(c *client, args []string) error {
+	if err := c.call(http.MethodPost, "/logout", nil, nil); err != nil {
+		return err
+	}
+	cfg := loadConfig()
+	cfg.Token, cfg.RefreshToken, cfg.Expires = "", "", time.Time{}
+	return saveConfig(cfg)
+}
+
+func cmdRun(c *client, args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	sync := fs.Bool("sync", false, "wait for the result without streaming logs")
+	runtime := fs.String("runtime", "", "session (default) or ephemeral")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: chariotctl run [-sync] [-runtime session|ephemeral] <file>")
+	}
+	src, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	req := map[string]string{"program": string(src), "filename": filepath.Base(fs.Arg(0))}
+	if *runtime != "" {
+		req["runtime"] = *runtime
+	}
+	if *sync {
+		var result interface{}
+		if err := c.call(http.MethodPost, "/api/execute", req, &result); err != nil {
+			return err
+		}
+		return printJSON(result)
+	}
+	var started struct {
+		ExecutionID string `json:"execution_id"`
+	}
+	if err := c.call(http.MethodPost, "/api/execute-async", req, &started); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "execution", started.ExecutionID)
+	return tailExecution(c, started.ExecutionID)
+}
+
+func cmdLogs(c *client, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: chariotctl logs <execution-id>")
+	}
+	return tailExecution(c, args[0])
+}
+
+// tailExecution prints an execution's logs to stderr as they arrive, the
+// values it emits to stdout one per line, and its result to stdout once it
+// is done.
+func tailExecution(c *client, execID string) error {
+	id := url.PathEscape(execID)
+	err := c.streamLogs(id, func(e logEntry) {
+		if e.Level == "RESULT" {
+			fmt.Println(string(e.Value))
+			return
+		}
+		fmt.Fprintln(os.Stderr, e)
+	})
+	if err != nil {
+		return err
+	}
+	for {
+		var result interface{}
+		resp, err := c.request(http.MethodGet, "/api/result/"+id, nil, "")
+		if err != nil {
+			return err
+		}
+		pending := resp.StatusCode == http.StatusAccepted
+		err = decodeEnvelope(resp, &result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if !pending {
+			return printJSON(result)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+func cmdListeners(c *client, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	sub, rest := args[0], args[1:]
+	switch sub {
+	case "list":
+		var ls []struct {
+			Name      string `json:"name"`
+			Script    string `json:"script"`
+			Status    string `json:"status"`
+			AutoStart bool   `json:"auto_start"`
+		}
+		if err := c.call(http.MethodGet, "/api/listeners", nil, &ls); err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tSTATUS\tAUTOSTART\tSCRIPT")
+		for _, l := range ls {
+			fmt.Fprintf(tw, "%s\t%s\t%t\t%s\n", l.Name, l.Status, l.AutoStart, l.Script)
+		}
+		return tw.Flush()
+	case "create":
+		fs := flag.NewFlagSet("listeners create", flag.ExitOnError)
+		script := fs.String("script", "", "script file in the files directory")
+		onStart := fs.String("on-start", "", "file run when the listener starts")
+		onExit := fs.String("on-exit", "", "file run when the listener stops")
+		snapshot := fs.String("snapshot", "", "runtime snapshot restored before on-start")
+		autoStart := fs.Bool("auto-start", false, "start with the server")
+		fs.Parse(rest)
+		if fs.NArg() != 1 {
+			return errors.New("usage: chariotctl listeners create [-script f] [-on-start f] [-on-exit f] [-snapshot s] [-auto-start] <name>")
+		}
+		req := map[string]interface{}{
+			"name": fs.Arg(0), "script": *script, "on_start": *onStart, "on_exit": *onExit,
+			"snapshot": *snapshot, "auto_start": *autoStart,
+		}
+		var out interface{}
+		if err := c.call(http.MethodPost, "/api/listeners", req, &out); err != nil {
+			return err
+		}
+		return printJSON(out)
+	case "delete", "start", "stop":
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: chariotctl listeners %s <name>", sub)
+		}
+		path := "/api/listeners/" + url.PathEscape(rest[0])
+		method := http.MethodPost
+		if sub == "delete" {
+			method = http.MethodDelete
+		} else {
+			path += "/" + sub
+		}
+		var out interface{}
+		if err := c.call(method, path, nil, &out); err != nil {
+			return err
+		}
+		return printJSON(out)
+	}
+	return fmt.Errorf("unknown listeners command %q (want list, create, delete, start or stop)", sub)
+}
+
+func cmdAgents(c *client, args []string) error {
+	if len(args) > 0 && args[0] != "list" {
+		return fmt.Errorf("unknown agents command %q (want list)", args[0])
+	}
+	var out struct {
+		Agents []string `json:"agents"`
+	}
+	if err := c.call(http.MethodGet, "/api/agents", nil, &out); err != nil {
+		return err
+	}
+	sort.Strings(out.Agents)
+	for _, name := range out.Agents {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// exportWorkspace downloads the workspace archive of a scope.
+func exportWorkspace(c *client, scope string) (*zip.Reader, error) {
+	path := "/api/workspace/export"
+	if scope != "" {
+		path += "?scope=" + url.QueryEscape(scope)
+	}
+	resp, err := c.request(http.MethodGet, path, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeEnvelope(resp, nil)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// cmdLibrary exchanges the function library as {"functions": {name: definition}},
+// the format /api/functions/save-library accepts.
+func cmdLibrary(c *client, args []string) error {
+	if len(args) != 2 || (args[0] != "export" && args[0] != "import") {
+		return errors.New("usage: chariotctl library export|import <file.json>")
+	}
+	file := args[1]
+	if args[0] == "import" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var lib map[string]interface{}
+		if err := json.Unmarshal(data, &lib); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		return c.call(http.MethodPost, "/api/functions/save-library", lib, nil)
+	}
+
+	zr, err := exportWorkspace(c, "")
+	if err != nil {
+		return err
+	}
+	ws := workspace.Workspace{Functions: map[string]json.RawMessage{}, Listeners: map[string]json.RawMessage{}}
+	tmp, err := os.MkdirTemp("", "chariotctl-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	ws.FilesDir, ws.DiagramsDir = filepath.Join(tmp, "files"), filepath.Join(tmp, "diagrams")
+	if _, err := workspace.Import(zr, ws, workspace.PolicyOverwrite); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(map[string]interface{}{"functions": ws.Functions}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d functions to %s\n", len(ws.Functions), file)
+	return nil
+}
+
+// localWorkspace maps a directory laid out like a workspace archive: files/,
+// diagrams/, functions/<name>.json and listeners/<name>.json.
+func localWorkspace(dir string) (workspace.Workspace, error) {
+	ws := workspace.Workspace{
+		FilesDir:    filepath.Join(dir, "files"),
+		DiagramsDir: filepath.Join(dir, "diagrams"),
+		Functions:   map[string]json.RawMessage{},
+		Listeners:   map[string]json.RawMessage{},
+	}
+	for sub, defs := range map[string]map[string]json.RawMessage{"functions": ws.Functions, "listeners": ws.Listeners} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return ws, err
+		}
+		for _, e := range entries {
+			if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, sub, e.Name()))
+			if err != nil {
+				return ws, err
+			}
+			defs[strings.TrimSuffix(e.Name(), ".json")] = data
+		}
+	}
+	return ws, nil
+}
+
+func writeDefs(dir string, defs map[string]json.RawMessage) error {
+	if len(defs) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for name, data := range defs {
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, data, "", "  ") == nil {
+			data = pretty.Bytes()
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".json"), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdWorkspace(c *client, args []string) error {
+	if len(args) == 0 || (args[0] != "pull" && args[0] != "push") {
+		return errors.New("usage: chariotctl workspace pull|push [-scope sandbox|global] [-policy skip|overwrite|rename|fail] <dir>")
+	}
+	fs := flag.NewFlagSet("workspace "+args[0], flag.ExitOnError)
+	scope := fs.String("scope", "", "storage scope; the server default when empty")
+	policy := fs.String("policy", "overwrite", "what to do with entries that already exist")
+	fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: chariotctl workspace %s [-scope s] [-policy p] <dir>", args[0])
+	}
+	dir := fs.Arg(0)
+	p, err := workspace.ParsePolicy(*policy)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "pull" {
+		zr, err := exportWorkspace(c, *scope)
+		if err != nil {
+			return err
+		}
+		ws, err := localWorkspace(dir)
+		if err != nil {
+			return err
+		}
+		report, err := workspace.Import(zr, ws, p)
+		if err != nil {
+			if report != nil {
+				printJSON(report)
+			}
+			return err
+		}
+		if err := writeDefs(filepath.Join(dir, "functions"), ws.Functions); err != nil {
+			return err
+		}
+		if err := writeDefs(filepath.Join(dir, "listeners"), ws.Listeners); err != nil {
+			return err
+		}
+		return printJSON(report)
+	}
+
+	ws, err := localWorkspace(dir)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if _, err := workspace.Export(&buf, ws, *scope); err != nil {
+		return err
+	}
+	query := url.Values{"policy": {string(p)}}
+	if *scope != "" {
+		query.Set("scope", *scope)
+	}
+	resp, err := c.request(http.MethodPost, "/api/workspace/import?"+query.Encode(), &buf, "application/zip")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var report interface{}
+	if err := decodeEnvelope(resp, &report); err != nil {
+		return err
+	}
+	return printJSON(report)
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// loadgen sends a mix of executions, file operations and WebSocket
+// subscriptions to the server for a while and reports, per operation, the
+// latency distribution and error rate, so the execution worker pool and the
+// WebSocket proxies can be sized from measurements.
+//
+// Each of -concurrency workers picks an operation by the weights of -mix
+// and runs it, as fast as the server answers, or at -rate operations a
+// second in total. When every worker is busy at a tick the tick is counted
+// as missed, which shows the target falling behind the requested rate.
+
+// Operations of the mix; files is one save, read and delete of a file,
+// reported as file.save, file.read and file.delete.
+const (
+	loadExecute = "execute"
+	loadFiles   = "files"
+	loadWS      = "ws"
+)
+
+// loadMix is the relative weight of each operation.
+type loadMix map[string]int
+
+// parseLoadMix reads "execute=70,files=20,ws=10".
+func parseLoadMix(s string) (loadMix, error) {
+	mix := loadMix{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, weight, ok := strings.Cut(part, "=")
+		n, err := strconv.Atoi(weight)
+		if !ok || err != nil || n < 0 {
+			return nil, fmt.Errorf("mix entry %q is not op=weight", part)
+		}
+		switch name {
+		case loadExecute, loadFiles, loadWS:
+		default:
+			return nil, fmt.Errorf("unknown operation %q in mix (want execute, files or ws)", name)
+		}
+		mix[name] += n
+	}
+	total := 0
+	for _, n := range mix {
+		total += n
+	}
+	if total == 0 {
+		return nil, errors.New("mix has no operation with a weight above zero")
+	}
+	return mix, nil
+}
+
+// pick returns an operation with probability proportional to its weight.
+func (m loadMix) pick(r *rand.Rand) string {
+	names := make([]string, 0, len(m))
+	total := 0
+	for name, n := range m {
+		names = append(names, name)
+		total += n
+	}
+	sort.Strings(names)
+	x := r.Intn(total)
+	for _, name := range names {
+		if x < m[name] {
+			return name
+		}
+		x -= m[name]
+	}
+	return names[len(names)-1]
+}
+
+// loadStats collects the outcome of every operation.
+type loadStats struct {
+	mu     sync.Mutex
+	ops    map[string]*opSamples
+	missed int
+}
+
+type opSamples struct {
+	latencies []time.Duration
+	errors    map[string]int // by kind: HTTP status or network
+}
+
+func newLoadStats() *loadStats {
+	return &loadStats{ops: map[string]*opSamples{}}
+}
+
+// record adds one operation that took d and failed with err, if not nil.
+func (s *loadStats) record(op string, d time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.ops[op]
+	if o == nil {
+		o = &opSamples{errors: map[string]int{}}
+		s.ops[op] = o
+	}
+	o.latencies = append(o.latencies, d)
+	if err != nil {
+		o.errors[errorKind(err)]++
+	}
+}
+
+// errorKind groups errors for the report.
+func errorKind(err error) string {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return "HTTP " + strconv.Itoa(apiErr.Status)
+	}
+	var wsErr *websocket.CloseError
+	if errors.As(err, &wsErr) {
+		return "ws close " + strconv.Itoa(wsErr.Code)
+	}
+	return "network"
+}
+
+// loadReport is what loadgen prints, with latencies in milliseconds.
+type loadReport struct {
+	Duration float64              `json:"duration_s"`
+	Missed   int                  `json:"missed,omitempty"` // rate ticks with every worker busy
+	Ops      map[string]opSummary `json:"ops"`
+}
+
+type opSummary struct {
+	Count     int            `json:"count"`
+	Errors    int            `json:"errors"`
+	ErrorRate float64        `json:"error_rate"`
+	PerSecond float64        `json:"per_second"`
+	MeanMs    float64        `json:"mean_ms"`
+	P50Ms     float64        `json:"p50_ms"`
+	P90Ms     float64        `json:"p90_ms"`
+	P99Ms     float64        `json:"p99_ms"`
+	MaxMs     float64        `json:"max_ms"`
+	ByError   map[string]int `json:"by_error,omitempty"`
+}
+
+// report summarizes the operations recorded over elapsed.
+func (s *loadStats) report(elapsed time.Duration) loadReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := loadReport{Duration: elapsed.Seconds(), Missed: s.missed, Ops: map[string]opSummary{}}
+	for op, o := range s.ops {
+		lat := append([]time.Duration(nil), o.latencies...)
+		sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+		var sum time.Duration
+		for _, d := range lat {
+			sum += d
+		}
+		summary := opSummary{Count: len(lat), ByError: o.errors}
+		for _, n := range o.errors {
+			summary.Errors += n
+		}
+		if len(lat) > 0 {
+			summary.ErrorRate = float64(summary.Errors) / float64(len(lat))
+			summary.MeanMs = ms(sum / time.Duration(len(lat)))
+			summary.P50Ms, summary.P90Ms, summary.P99Ms = ms(percentile(lat, 50)), ms(percentile(lat, 90)), ms(percentile(lat, 99))
+			summary.MaxMs = ms(lat[len(lat)-1])
+		}
+		if elapsed > 0 {
+			summary.PerSecond = float64(len(lat)) / elapsed.Seconds()
+		}
+		r.Ops[op] = summary
+	}
+	return r
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	if i < 1 {
+		i = 1
+	}
+	return sorted[i-1]
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// loadOptions is what the operations need besides the client.
+type loadOptions struct {
+	program  string
+	runtime  string
+	scope    string
+	fileSize int
+	wsPath   string
+	wsHold   time.Duration
+}
+
+// loadWorker runs operations for one worker.
+type loadWorker struct {
+	c     *client
+	conf  loadOptions
+	stats *loadStats
+	id    int
+	seq   int
+}
+
+func (w *loadWorker) run(op string) {
+	switch op {
+	case loadExecute:
+		start := time.Now()
+		err := w.c.call(http.MethodPost, "/api/execute", map[string]string{"program": w.conf.program, "filename": "loadgen.ch", "runtime": w.conf.runtime}, nil)
+		w.stats.record(loadExecute, time.Since(start), err)
+	case loadFiles:
+		w.files()
+	case loadWS:
+		start, err := w.subscribe()
+		w.stats.record(loadWS, start, err)
+	}
+}
+
+// files saves, reads back and deletes a file of conf.fileSize bytes.
+func (w *loadWorker) files() {
+	w.seq++
+	name := fmt.Sprintf("loadgen-%d-%d.txt", w.id, w.seq)
+	query := ""
+	if w.conf.scope != "" {
+		query = "?scope=" + url.QueryEscape(w.conf.scope)
+	}
+	content := strings.Repeat("x", w.conf.fileSize)
+	start := time.Now()
+	err := w.c.call(http.MethodPost, "/api/files"+query, map[string]string{"name": name, "content": content}, nil)
+	w.stats.record("file.save", time.Since(start), err)
+	if err != nil {
+		return
+	}
+	start = time.Now()
+	err = w.c.call(http.MethodGet, "/api/files/"+url.PathEscape(name)+query, nil, nil)
+	w.stats.record("file.read", time.Since(start), err)
+	start = time.Now()
+	err = w.c.call(http.MethodDelete, "/api/files/"+url.PathEscape(name)+query, nil, nil)
+	w.stats.record("file.delete", time.Since(start), err)
+}
+
+// subscribe opens a WebSocket on conf.wsPath, reads from it for
+// conf.wsHold and closes it. It returns how long the upgrade took, and an
+// error if the upgrade failed or the server closed the stream early.
+func (w *loadWorker) subscribe() (time.Duration, error) {
+	u, err := url.Parse(w.c.server + w.conf.wsPath)
+	if err != nil {
+		return 0, err
+	}
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	token, err := w.c.currentToken()
+	if err != nil {
+		return 0, err
+	}
+	dialer := *websocket.DefaultDialer
+	if t, ok := w.c.http.Transport.(*http.Transport); ok {
+		dialer.TLSClientConfig = t.TLSClientConfig
+	}
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", token)
+	}
+	start := time.Now()
+	conn, resp, err := dialer.Dial(u.String(), header)
+	took := time.Since(start)
+	if err != nil {
+		if resp != nil {
+			return took, &apiError{Status: resp.StatusCode, Message: err.Error()}
+		}
+		return took, err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(w.conf.wsHold)
+	conn.SetReadDeadline(deadline)
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var netErr interface{ Timeout() bool }
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+				return took, nil
+			}
+			return took, err
+		}
+	}
+}
+
+// runLoad runs the workers for duration and returns what they recorded.
+func runLoad(c *client, conf loadOptions, mix loadMix, workers int, rate float64, duration time.Duration) loadReport {
+	stats := newLoadStats()
+	stop := time.Now().Add(duration)
+	var ticks chan struct{}
+	if rate > 0 {
+		ticks = make(chan struct{})
+		go func() {
+			defer close(ticks)
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+			defer ticker.Stop()
+			for now := range ticker.C {
+				if now.After(stop) {
+					return
+				}
+				select {
+				case ticks <- struct{}{}:
+				default:
+					stats.mu.Lock()
+					stats.missed++
+					stats.mu.Unlock()
+				}
+			}
+		}()
+	}
+	started := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			w := &loadWorker{c: c, conf: conf, stats: stats, id: id}
+			r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+			for time.Now().Before(stop) {
+				if ticks != nil {
+					if _, ok := <-ticks; !ok {
+						return
+					}
+				}
+				w.run(mix.pick(r))
+			}
+		}(i)
+	}
+	wg.Wait()
+	return stats.report(time.Since(started))
+}
+
+func cmdLoadgen(c *client, args []string) error {
+	fs := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	duration := fs.Duration("duration", 30*time.Second, "how long to generate traffic")
+	workers := fs.Int("concurrency", 10, "operations in flight at once")
+	rate := fs.Float64("rate", 0, "operations a second across all workers; 0 sends as fast as the server answers")
+	mixFlag := fs.String("mix", "execute=70,files=20,ws=10", "relative weights of execute, files and ws operations")
+	script := fs.String("script", "", "file whose program each execution runs; a trivial program when empty")
+	runtime := fs.String("runtime", "ephemeral", "runtime of the executions: ephemeral or session")
+	scope := fs.String("scope", "", "storage scope of the file operations")
+	fileSize := fs.Int("file-size", 1024, "bytes written by each file operation")
+	wsPath := fs.String("ws-path", "/api/dashboard/stream", "WebSocket subscribed to by ws operations")
+	wsHold := fs.Duration("ws-hold", 5*time.Second, "how long each ws operation keeps its subscription open")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+	if fs.NArg() != 0 || *workers <= 0 || *duration <= 0 || *rate < 0 || *fileSize < 0 {
+		return errors.New("usage: chariotctl loadgen [-duration d] [-concurrency n] [-rate r] [-mix execute=70,files=20,ws=10] [-script f] [-json]")
+	}
+	mix, err := parseLoadMix(*mixFlag)
+	if err != nil {
+		return err
+	}
+	conf := loadOptions{program: "add(1, 2)", runtime: *runtime, scope: *scope, fileSize: *fileSize, wsPath: *wsPath, wsHold: *wsHold}
+	if *script != "" {
+		src, err := os.ReadFile(*script)
+		if err != nil {
+			return err
+		}
+		conf.program = string(src)
+	}
+	// Fail fast on a bad server or token rather than report all errors
+	if err := c.call(http.MethodGet, "/api/session/profile", nil, nil); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Sending %s to %s for %s with %d workers\n", *mixFlag, c.server, *duration, *workers)
+	report := runLoad(c, conf, mix, *workers, *rate, *duration)
+	if *asJSON {
+		return printJSON(report)
+	}
+	return printLoadReport(report)
+}
+
+func printLoadReport(r loadReport) error {
+	ops := make([]string, 0, len(r.Ops))
+	for op := range r.Ops {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "OP\tCOUNT\tPER SEC\tERRORS\tMEAN MS\tP50 MS\tP90 MS\tP99 MS\tMAX MS\t")
+	for _, op := range ops {
+		s := r.Ops[op]
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%.1f%%\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t\n", op, s.Count, s.PerSecond, s.ErrorRate*100, s.MeanMs, s.P50Ms, s.P90Ms, s.P99Ms, s.MaxMs)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, op := range ops {
+		kinds := make([]string, 0, len(r.Ops[op].ByError))
+		for kind, n := range r.Ops[op].ByError {
+			kinds = append(kinds, fmt.Sprintf("%s: %d", kind, n))
+		}
+		if len(kinds) > 0 {
+			sort.Strings(kinds)
+			fmt.Printf("%s errors: %s\n", op, strings.Join(kinds, ", "))
+		}
+	}
+	fmt.Printf("%.1fs", r.Duration)
+	if r.Missed > 0 {
+		fmt.Printf(", %d ticks missed with every worker busy", r.Missed)
+	}
+	fmt.Println()
+	return nil
+}
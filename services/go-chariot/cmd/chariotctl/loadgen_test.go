@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestParseLoadMix verifies that mixes are read as op=weight pairs and that
+// unknown operations and empty mixes are refused.
+func TestParseLoadMix(t *testing.T) {
+	mix, err := parseLoadMix("execute=3, files=1,ws=0")
+	if err != nil || mix[loadExecute] != 3 || mix[loadFiles] != 1 || mix[loadWS] != 0 {
+		t.Fatalf("mix %v, %v", mix, err)
+	}
+	for _, bad := range []string{"execute", "execute=-1", "upload=1", "ws=0", ""} {
+		if _, err := parseLoadMix(bad); err == nil {
+			t.Errorf("mix %q accepted", bad)
+		}
+	}
+}
+
+// TestPercentile verifies the nearest-rank percentiles of the report.
+func TestPercentile(t *testing.T) {
+	var lat []time.Duration
+	for i := 1; i <= 100; i++ {
+		lat = append(lat, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[int]time.Duration{50: 50 * time.Millisecond, 90: 90 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond} {
+		if got := percentile(lat, p); got != want {
+			t.Errorf("p%d = %v, want %v", p, got, want)
+		}
+	}
+	if got := percentile(lat[:1], 99); got != time.Millisecond {
+		t.Errorf("p99 of one sample = %v", got)
+	}
+}
+
+// TestRunLoad verifies that a short run sends every operation of the mix and
+// reports failed executions by status.
+func TestRunLoad(t *testing.T) {
+	var executions atomic.Int64
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/execute", func(w http.ResponseWriter, r *http.Request) {
+		// Every other execution is refused, as by a full worker pool
+		if executions.Add(1)%2 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"result":"ERROR","data":"busy"}`)
+			return
+		}
+		fmt.Fprint(w, `{"result":"OK","data":3}`)
+	})
+	mux.HandleFunc("/api/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result":"OK","data":"saved"}`)
+	})
+	mux.HandleFunc("/api/files/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result":"OK","data":"x"}`)
+	})
+	mux.HandleFunc("/api/dashboard/stream", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := newClient(srv.URL, "tok", false)
+	opts := loadOptions{program: "add(1, 2)", runtime: "ephemeral", fileSize: 16, wsPath: "/api/dashboard/stream", wsHold: 20 * time.Millisecond}
+	r := runLoad(c, opts, loadMix{loadExecute: 2, loadFiles: 1, loadWS: 1}, 4, 0, 300*time.Millisecond)
+	for _, op := range []string{loadExecute, "file.save", "file.read", "file.delete", loadWS} {
+		if r.Ops[op].Count == 0 {
+			t.Fatalf("no %s operations in %+v", op, r)
+		}
+	}
+	if s := r.Ops[loadWS]; s.Errors != 0 {
+		t.Errorf("ws operations failed: %+v", s)
+	}
+	s := r.Ops[loadExecute]
+	if s.Errors == 0 || s.ByError["HTTP 503"] != s.Errors || s.ErrorRate <= 0 || s.ErrorRate >= 1 {
+		t.Errorf("execute summary %+v", s)
+	}
+	if s.P50Ms > s.P99Ms || s.P99Ms > s.MaxMs {
+		t.Errorf("percentiles out of order: %+v", s)
+	}
+
+	r = runLoad(newClient(srv.URL, "", false), opts, loadMix{loadWS: 1}, 1, 0, 50*time.Millisecond)
+	if s := r.Ops[loadWS]; s.Count == 0 || s.ByError["HTTP 401"] != s.Count {
+		t.Errorf("unauthorized ws summary %+v", s)
+	}
+}
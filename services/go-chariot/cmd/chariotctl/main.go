@@ -1,6 +1,11 @@
+// Command chariotctl drives a go-chariot server from the shell or CI: it logs
+// in, runs scripts and tails their logs, and manages listeners, the function
+// library and workspaces through the REST API. With -f it runs a script in a
+// local runtime instead.
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -8,14 +13,75 @@ import (
 	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
 )
 
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "usage: chariotctl [-server url] [-token t] [-insecure] <command> [args]")
+	fmt.Fprintln(out, "       chariotctl -f script.ch   (run locally)")
+	fmt.Fprintln(out, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-58s %s\n", cmd.usage, cmd.summary)
+	}
+	fmt.Fprintln(out, "\nflags:")
+	flag.PrintDefaults()
+}
+
 func main() {
-	script := flag.String("f", "", "path to .chariot script")
+	stored := loadConfig()
+	defaultServer := stored.Server
+	if s := os.Getenv("CHARIOT_SERVER"); s != "" {
+		defaultServer = s
+	}
+	if defaultServer == "" {
+		defaultServer = "http://localhost:8087"
+	}
+	defaultToken := stored.Token
+	if t := os.Getenv("CHARIOT_TOKEN"); t != "" {
+		defaultToken = t
+	}
+
+	script := flag.String("f", "", "path to .chariot script to run locally")
+	server := flag.String("server", defaultServer, "go-chariot server URL (CHARIOT_SERVER)")
+	token := flag.String("token", defaultToken, "session token (CHARIOT_TOKEN); login stores one")
+	insecure := flag.Bool("insecure", false, "skip TLS certificate verification")
+	flag.Usage = usage
 	flag.Parse()
-	if *script == "" {
-		fmt.Println("usage: chariotcli -f script.ch")
-		os.Exit(1)
+
+	if *script != "" {
+		runLocal(*script)
+		return
 	}
-	src, err := os.ReadFile(*script)
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := flag.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		c := newClient(*server, *token, *insecure)
+		if *token == stored.Token {
+			c.refresh, c.expires = stored.RefreshToken, stored.Expires
+		}
+		if err := cmd.run(c, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			var apiErr *apiError
+			if errors.As(err, &apiErr) && apiErr.Status == 401 {
+				fmt.Fprintln(os.Stderr, "Run 'chariotctl login' to start a new session.")
+			}
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// runLocal executes a script in a fresh local runtime and prints its result.
+func runLocal(path string) {
+	src, err := os.ReadFile(path)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -1,16 +1,24 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
 	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
 	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/cluster"
 	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/listeners"
 	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/pubsub"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/statestore"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/storage"
 	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/vault"
 	"go.uber.org/zap"
 
@@ -23,6 +31,10 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 )
 
+// configReloadInterval is how often the config file is checked for changes;
+// a ConfigMap update reaches the mounted files within a minute or so.
+const configReloadInterval = 10 * time.Second
+
 func init() {
 	kissflag.SetPrefix("CHARIOT_")
 
@@ -69,17 +81,104 @@ func init() {
 	cfg.ChariotConfig.StringVar("sandbox_default_scope", &cfg.ChariotConfig.SandboxDefaultScope, "sandbox")
 	// Function library
 	cfg.ChariotConfig.StringVar("function_lib", &cfg.ChariotConfig.FunctionLib, "stlib.json")
+	cfg.ChariotConfig.StringVar("plan_lib", &cfg.ChariotConfig.PlanLib, "plans.json")
 	// Bootstrap script
 	cfg.ChariotConfig.StringVar("bootstrap", &cfg.ChariotConfig.Bootstrap, "bootstrap.ch")
+	// Sandbox profiles and notification builtins
+	cfg.ChariotConfig.StringVar("sandbox_profiles", &cfg.ChariotConfig.SandboxProfiles, "sandbox_profiles.json")
+	cfg.ChariotConfig.StringVar("smtp_host", &cfg.ChariotConfig.SMTPHost, "")
+	cfg.ChariotConfig.IntVar("smtp_port", &cfg.ChariotConfig.SMTPPort, 587)
+	cfg.ChariotConfig.StringVar("smtp_username", &cfg.ChariotConfig.SMTPUsername, "")
+	cfg.ChariotConfig.StringVar("smtp_password", &cfg.ChariotConfig.SMTPPassword, "")
+	cfg.ChariotConfig.StringVar("smtp_from", &cfg.ChariotConfig.SMTPFrom, "")
+	cfg.ChariotConfig.StringVar("smtp_tls", &cfg.ChariotConfig.SMTPTLS, "starttls")
+	cfg.ChariotConfig.StringVar("slack_token", &cfg.ChariotConfig.SlackToken, "")
+	cfg.ChariotConfig.StringVar("slack_api_url", &cfg.ChariotConfig.SlackAPIURL, "https://slack.com/api")
+	// Builtin plugins
+	cfg.ChariotConfig.StringVar("plugins_dir", &cfg.ChariotConfig.PluginsDir, "")
+	// Interpreter call depth limit
+	cfg.ChariotConfig.IntVar("max_call_depth", &cfg.ChariotConfig.MaxCallDepth, 10000)
+	// Idle session runtime eviction
+	cfg.ChariotConfig.IntVar("runtime_idle_timeout", &cfg.ChariotConfig.RuntimeIdleTimeout, 0)
+	cfg.ChariotConfig.StringVar("runtime_idle_policy", &cfg.ChariotConfig.RuntimeIdlePolicy, "reset")
+	// Short-lived access tokens with refresh
+	cfg.ChariotConfig.IntVar("access_token_ttl", &cfg.ChariotConfig.AccessTokenTTL, 15)
 	// Listeners registry file (under data path by default)
 	cfg.ChariotConfig.StringVar("listeners_file", &cfg.ChariotConfig.ListenersFile, "listeners.json")
+	cfg.ChariotConfig.IntVar("listener_max_cost", &cfg.ChariotConfig.ListenerMaxCost, 100000)
+	cfg.ChariotConfig.StringVar("s3_endpoint", &cfg.ChariotConfig.S3Endpoint, "")
+	cfg.ChariotConfig.StringVar("s3_region", &cfg.ChariotConfig.S3Region, "us-east-1")
+	// Outbound webhooks
+	cfg.ChariotConfig.StringVar("webhooks_file", &cfg.ChariotConfig.WebhooksFile, "webhooks.json")
+	cfg.ChariotConfig.IntVar("webhook_max_attempts", &cfg.ChariotConfig.WebhookMaxAttempts, 5)
+	cfg.ChariotConfig.IntVar("webhook_timeout", &cfg.ChariotConfig.WebhookTimeout, 10)
+	// Dead letters
+	cfg.ChariotConfig.StringVar("dead_letter_file", &cfg.ChariotConfig.DeadLetterFile, "dead_letters.json")
+	cfg.ChariotConfig.IntVar("dead_letter_max", &cfg.ChariotConfig.DeadLetterMax, 10000)
+	// Function usage and deprecations
+	cfg.ChariotConfig.StringVar("usage_file", &cfg.ChariotConfig.UsageFile, "usage.json")
+	cfg.ChariotConfig.StringVar("tag_usage_file", &cfg.ChariotConfig.TagUsageFile, "tag_usage.json")
+	// Application log files
+	cfg.ChariotConfig.StringVar("log_file", &cfg.ChariotConfig.LogFile, "logs/chariot.log")
+	cfg.ChariotConfig.IntVar("log_max_size", &cfg.ChariotConfig.LogMaxSize, 10)
+	cfg.ChariotConfig.IntVar("log_max_files", &cfg.ChariotConfig.LogMaxFiles, 5)
+	cfg.ChariotConfig.StringVar("keystore_file", &cfg.ChariotConfig.KeystoreFile, "keystore.json")
+	cfg.ChariotConfig.StringVar("keystore_key", &cfg.ChariotConfig.KeystoreKey, "")
+	// Execution artifacts
+	cfg.ChariotConfig.IntVar("artifact_max_size", &cfg.ChariotConfig.ArtifactMaxSize, 10240)
+	cfg.ChariotConfig.IntVar("artifact_max_total", &cfg.ChariotConfig.ArtifactMaxTotal, 51200)
+	cfg.ChariotConfig.IntVar("artifact_ttl", &cfg.ChariotConfig.ArtifactTTL, 60)
+	cfg.ChariotConfig.IntVar("artifact_inline_size", &cfg.ChariotConfig.ArtifactInlineSize, 256)
+	cfg.ChariotConfig.IntVar("result_max_size", &cfg.ChariotConfig.ResultMaxSize, 1024)
 	// MCP configuration
 	cfg.ChariotConfig.BoolVar("mcp_enabled", &cfg.ChariotConfig.MCPEnabled, false)
 	cfg.ChariotConfig.StringVar("mcp_transport", &cfg.ChariotConfig.MCPTransport, "ws")
 	cfg.ChariotConfig.StringVar("mcp_ws_path", &cfg.ChariotConfig.MCPWSPath, "/mcp")
+	// Administration
+	cfg.ChariotConfig.StringVar("admin_users", &cfg.ChariotConfig.AdminUsers, "")
+	cfg.ChariotConfig.StringVar("users_file", &cfg.ChariotConfig.UsersFile, "users.json")
+	cfg.ChariotConfig.IntVar("password_min_length", &cfg.ChariotConfig.PasswordMinLength, 8)
+	cfg.ChariotConfig.IntVar("password_min_classes", &cfg.ChariotConfig.PasswordMinClasses, 0)
+	cfg.ChariotConfig.IntVar("password_max_age_days", &cfg.ChariotConfig.PasswordMaxAgeDays, 0)
+	cfg.ChariotConfig.StringVar("mfa_issuer", &cfg.ChariotConfig.MFAIssuer, "Chariot")
+	// Quotas
+	cfg.ChariotConfig.StringVar("quotas_file", &cfg.ChariotConfig.QuotasFile, "quotas.json")
+	cfg.ChariotConfig.IntVar("quota_file_bytes", &cfg.ChariotConfig.QuotaFileBytes, 0)
+	cfg.ChariotConfig.IntVar("quota_executions_per_hour", &cfg.ChariotConfig.QuotaExecutionsPerHour, 0)
+	cfg.ChariotConfig.IntVar("quota_concurrent_executions", &cfg.ChariotConfig.QuotaConcurrentExecutions, 0)
+	cfg.ChariotConfig.IntVar("quota_listeners", &cfg.ChariotConfig.QuotaListeners, 0)
+	// Execution queue
+	cfg.ChariotConfig.IntVar("execution_workers", &cfg.ChariotConfig.ExecutionWorkers, 4*runtime.NumCPU())
+	cfg.ChariotConfig.IntVar("execution_max_wait", &cfg.ChariotConfig.ExecutionMaxWait, 30)
+	// Execution traces
+	cfg.ChariotConfig.IntVar("trace_retention", &cfg.ChariotConfig.TraceRetention, 100)
+	// Idempotency keys
+	cfg.ChariotConfig.IntVar("idempotency_window", &cfg.ChariotConfig.IdempotencyWindow, 1440)
+	// Agent event history
+	cfg.ChariotConfig.IntVar("agent_event_history", &cfg.ChariotConfig.AgentEventHistory, 1000)
+	// Agent federation
+	cfg.ChariotConfig.StringVar("federation_peers", &cfg.ChariotConfig.FederationPeers, "")
+	cfg.ChariotConfig.StringVar("federation_token", &cfg.ChariotConfig.FederationToken, "")
+	// Execution and session state store
+	cfg.ChariotConfig.StringVar("state_store", &cfg.ChariotConfig.StateStore, "memory")
+	cfg.ChariotConfig.StringVar("storage_provider", &cfg.ChariotConfig.StorageProvider, "filesystem")
+	// Event fan-out between replicas
+	cfg.ChariotConfig.StringVar("pubsub", &cfg.ChariotConfig.PubSub, "local")
+	cfg.ChariotConfig.StringVar("redis_url", &cfg.ChariotConfig.RedisURL, "")
+	cfg.ChariotConfig.IntVar("leader_lease", &cfg.ChariotConfig.LeaderLease, 15)
+	// Config file or mounted ConfigMap directory
+	cfg.ChariotConfig.StringVar("config_file", &cfg.ChariotConfig.ConfigFile, "")
 
 	// Bind evars
 	_ = kissflag.BindAllEVars(cfg.ChariotConfig)
+	// The config file overrides the environment
+	if path := cfg.ChariotConfig.ConfigFile; path != "" {
+		if _, unknown, err := cfg.ChariotConfig.ApplyFile(path); err != nil {
+			log.Printf("Failed to read config file %s: %v", path, err)
+		} else if len(unknown) > 0 {
+			log.Printf("Config file %s: unknown settings %v", path, unknown)
+		}
+	}
 	// Normalize any configured paths (expand ~, make absolute, clean)
 	cfg.ExpandAndNormalizePaths()
 
@@ -92,9 +191,28 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		os.Exit(runBatch(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "storage" {
+		os.Exit(runStorage(os.Args[2:]))
+	}
+
 	slogger := logs.NewZapLogger()
+	if path := handlers.SystemLogFile(); path != "" {
+		// Also keep structured, rotated log files for /api/logs/system
+		file, err := logs.NewRotatingFile(path, int64(cfg.ChariotConfig.LogMaxSize)<<20, cfg.ChariotConfig.LogMaxFiles)
+		if err != nil {
+			log.Printf("Cannot open log file %s, logging to stderr only: %v", path, err)
+		} else {
+			defer file.Close()
+			slogger = logs.NewZapLoggerWithFile(file, "backend")
+		}
+	}
 	defer slogger.Sync() // Ensure logger is flushed before exit
 	cfg.ChariotLogger = slogger
+	// Route the standard logger's output through it as well
+	defer zap.RedirectStdLog(slogger.Get())()
 	slogger.Info("Starting Chariot service beginning...")
 	// Warn if legacy env var is present
 	if legacy := os.Getenv("CHARIOT_BOOTSTRAP_FILE"); legacy != "" {
@@ -118,10 +236,48 @@ func main() {
 	timeOut := time.Duration(cfg.ChariotConfig.Timeout) * time.Minute
 	cleanUpInterval := time.Duration(5) * time.Minute
 	sessionManager := chariot.NewSessionManager(timeOut, cleanUpInterval)
+	if err := sessionManager.SetRuntimeIdlePolicy(time.Duration(cfg.ChariotConfig.RuntimeIdleTimeout)*time.Minute, cfg.ChariotConfig.RuntimeIdlePolicy); err != nil {
+		cfg.ChariotLogger.Error("Invalid runtime idle policy", zap.Error(err))
+		return
+	}
+	if err := sessionManager.SetAccessTokenTTL(time.Duration(cfg.ChariotConfig.AccessTokenTTL) * time.Minute); err != nil {
+		cfg.ChariotLogger.Error("Invalid access token lifetime", zap.Error(err))
+		return
+	}
+	stateStore, err := statestore.Open(cfg.ChariotConfig)
+	if err != nil {
+		cfg.ChariotLogger.Error("Failed to open state store", zap.String("state_store", cfg.ChariotConfig.StateStore), zap.Error(err))
+		return
+	}
+	defer stateStore.Close()
+	sessionManager.SetStore(stateStore)
+	// Replicas sharing the state store elect one to run each singleton subsystem
+	elector := cluster.NewElector(stateStore, cluster.InstanceID(), time.Duration(cfg.ChariotConfig.LeaderLease)*time.Second)
+	defer elector.Resign()
+	if cfg.ChariotConfig.ConfigFile != "" {
+		go watchConfigFile(cfg.ChariotConfig.ConfigFile)
+	}
+	bus, err := pubsub.Open(cfg.ChariotConfig)
+	if err != nil {
+		cfg.ChariotLogger.Error("Failed to open pubsub", zap.String("pubsub", cfg.ChariotConfig.PubSub), zap.Error(err))
+		return
+	}
+	defer bus.Close()
 	if err := vault.InitVaultClient(); err != nil { // Initialize Azure Key Vault client
 		cfg.ChariotLogger.Error("Failed to initialize Vault client", zap.Error(err))
 		return
 	}
+	files, err := openStorage()
+	if err != nil {
+		cfg.ChariotLogger.Error("Failed to open storage provider", zap.String("storage_provider", cfg.ChariotConfig.StorageProvider), zap.Error(err))
+		return
+	}
+	defer files.Close()
+	storage.Use(files)
+	loadPlugins()
+	defer chariot.StopPlugins()
+	loadSandboxProfiles()
+	loadKeyStore()
 
 	// Start MCP server in stdio mode if enabled, then exit (intended to be launched as a subprocess by clients)
 	if cfg.ChariotConfig.MCPEnabled && strings.ToLower(cfg.ChariotConfig.MCPTransport) == "stdio" {
@@ -134,55 +290,39 @@ func main() {
 
 	// Optionally start headless session (does not block if Dev REST is also enabled)
 	if cfg.ChariotConfig.Headless {
-		// Initialize a bootstrap runtime that mirrors the REST handlers runtime
-		bootstrapRuntime := chariot.NewRuntime()
-		chariot.RegisterAll(bootstrapRuntime)
-
-		// Load stdlib functions from configured library and register them
-		if cfg.ChariotConfig.FunctionLib != "" {
-			if funcs, err := chariot.LoadFunctionsFromFile(cfg.ChariotConfig.FunctionLib); err == nil {
-				for name, fn := range funcs {
-					bootstrapRuntime.RegisterFunction(name, fn)
-				}
-			} else {
-				cfg.ChariotLogger.Warn("Failed to load function library", zap.String("file", cfg.ChariotConfig.FunctionLib), zap.Error(err))
-			}
-		}
-
-		// Optionally load bootstrap script (users, helpers, etc.)
-		if cfg.ChariotConfig.Bootstrap != "" {
-			if fullPath, err := chariot.GetSecureFilePath(cfg.ChariotConfig.Bootstrap, "data"); err == nil {
-				if content, err := os.ReadFile(fullPath); err == nil {
-					if _, err := bootstrapRuntime.ExecProgram(string(content)); err != nil {
-						cfg.ChariotLogger.Warn("Failed to execute bootstrap script in headless mode", zap.Error(err))
-					}
-				} else {
-					cfg.ChariotLogger.Warn("Failed to read bootstrap script in headless mode", zap.Error(err))
-				}
-			} else {
-				cfg.ChariotLogger.Warn("Failed to resolve bootstrap path in headless mode", zap.Error(err))
-			}
-		}
+		bootstrapRuntime := newBootstrapRuntime()
 
-		// Initialize listeners manager and auto-start listeners marked AutoStart
+		// Initialize listeners manager; the replica leading the listeners role
+		// auto-starts listeners marked AutoStart and stops them if it loses the role
 		lman := listeners.NewManager(bootstrapRuntime)
 		if err := lman.Load(); err != nil {
 			cfg.ChariotLogger.Warn("Failed to load listeners registry in headless mode", zap.Error(err))
 		}
-		for _, l := range lman.List() {
-			if l.AutoStart {
-				if _, err := lman.Start(l.Name, cfg.ChariotConfig.Port); err != nil {
-					cfg.ChariotLogger.Warn("Failed to auto-start listener (headless)", zap.String("name", l.Name), zap.Error(err))
-				} else {
-					cfg.ChariotLogger.Info("Auto-started listener (headless)", zap.String("name", l.Name))
+		elector.Campaign(cluster.RoleListeners, func() {
+			for _, l := range lman.List() {
+				if l.AutoStart {
+					if _, err := lman.Start(l.Name, cfg.ChariotConfig.Port); err != nil {
+						cfg.ChariotLogger.Warn("Failed to auto-start listener (headless)", zap.String("name", l.Name), zap.Error(err))
+					} else {
+						cfg.ChariotLogger.Info("Auto-started listener (headless)", zap.String("name", l.Name))
+					}
 				}
 			}
-		}
+		}, func() {
+			for _, l := range lman.List() {
+				if l.Status == "running" {
+					if _, err := lman.Stop(l.Name, cfg.ChariotConfig.Port); err != nil {
+						cfg.ChariotLogger.Warn("Failed to stop listener (headless)", zap.String("name", l.Name), zap.Error(err))
+					}
+				}
+			}
+		})
 	}
 
 	// Optionally start Dev REST API server
 	if cfg.ChariotConfig.DevRESTEnabled {
-		h := handlers.NewHandlers(sessionManager)
+		h := handlers.NewHandlers(sessionManager, bus)
+		h.SetElector(elector)
 		e := echo.New()
 		routes.RegisterRoutes(e, h)
 		e.Use(middleware.Logger())
@@ -238,3 +378,111 @@ func main() {
 		}
 	}
 }
+
+// watchConfigFile re-reads the config file every configReloadInterval and
+// applies changed settings. Settings read as they are used, such as quotas
+// and retention limits, take effect at once; those used at startup, such as
+// the port and the state store, need a restart.
+func watchConfigFile(path string) {
+	for range time.Tick(configReloadInterval) {
+		changed, unknown, err := cfg.ChariotConfig.ApplyFile(path)
+		if err != nil {
+			cfg.ChariotLogger.Warn("Failed to reload config file", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		if len(changed) > 0 {
+			cfg.ChariotLogger.Info("Reloaded config file", zap.String("path", path), zap.Strings("changed", changed), zap.Strings("unknown", unknown))
+		}
+	}
+}
+
+// loadPlugins loads the configured builtin plugins before any runtime is
+// created, so every runtime registers their functions.
+func loadPlugins() {
+	if cfg.ChariotConfig.PluginsDir == "" {
+		return
+	}
+	if _, err := chariot.LoadPlugins(cfg.ChariotConfig.PluginsDir); err != nil {
+		cfg.ChariotLogger.Warn("Failed to load plugins", zap.String("dir", cfg.ChariotConfig.PluginsDir), zap.Error(err))
+	}
+}
+
+// loadSandboxProfiles reads the sandbox profiles file under the data path.
+func loadSandboxProfiles() {
+	if cfg.ChariotConfig.SandboxProfiles == "" {
+		return
+	}
+	path := filepath.Join(cfg.ChariotConfig.DataPath, cfg.ChariotConfig.SandboxProfiles)
+	if err := chariot.LoadSandboxProfiles(path); err != nil {
+		cfg.ChariotLogger.Error("Failed to load sandbox profiles; notifications are denied", zap.String("path", path), zap.Error(err))
+	}
+}
+
+// loadKeyStore opens the keystore file under the data path, decrypting it
+// with the configured secret. Without it the *WithKey builtins use a keystore
+// that lives only as long as the process.
+func loadKeyStore() {
+	if cfg.ChariotConfig.KeystoreFile == "" {
+		return
+	}
+	path := filepath.Join(cfg.ChariotConfig.DataPath, cfg.ChariotConfig.KeystoreFile)
+	var master []byte
+	if name := cfg.ChariotConfig.KeystoreKey; name != "" {
+		secret, err := vault.GetSecretValue(context.Background(), name)
+		if err == nil {
+			master, err = base64.StdEncoding.DecodeString(secret)
+		}
+		if err != nil {
+			cfg.ChariotLogger.Error("Failed to read the keystore master key; keystore disabled", zap.String("secret", name), zap.Error(err))
+			return
+		}
+	}
+	ks, err := chariot.NewKeyStore(path, master)
+	if err != nil {
+		cfg.ChariotLogger.Error("Failed to open keystore", zap.String("path", path), zap.Error(err))
+		return
+	}
+	chariot.SetKeyStore(ks)
+}
+
+// newBootstrapRuntime initializes a runtime that mirrors the REST handlers
+// runtime: all builtins, the configured function library and the bootstrap
+// script.
+func newBootstrapRuntime() *chariot.Runtime {
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+
+	// Load stdlib functions from configured library and register them
+	if cfg.ChariotConfig.FunctionLib != "" {
+		if funcs, err := chariot.LoadFunctionsFromFile(cfg.ChariotConfig.FunctionLib); err == nil {
+			for name, fn := range funcs {
+				rt.RegisterFunction(name, fn)
+			}
+		} else {
+			cfg.ChariotLogger.Warn("Failed to load function library", zap.String("file", cfg.ChariotConfig.FunctionLib), zap.Error(err))
+		}
+	}
+
+	// Load the plan library so the bootstrap script can attach its plans
+	if cfg.ChariotConfig.PlanLib != "" {
+		if _, err := chariot.LoadPlanLibrary(cfg.ChariotConfig.PlanLib); err != nil && !os.IsNotExist(err) {
+			cfg.ChariotLogger.Warn("Failed to load plan library", zap.String("file", cfg.ChariotConfig.PlanLib), zap.Error(err))
+		}
+	}
+
+	// Optionally load bootstrap script (users, helpers, etc.)
+	if cfg.ChariotConfig.Bootstrap != "" {
+		if fullPath, err := chariot.GetSecureFilePath(cfg.ChariotConfig.Bootstrap, "data"); err == nil {
+			if content, err := os.ReadFile(fullPath); err == nil {
+				if _, err := rt.ExecProgram(string(content)); err != nil {
+					cfg.ChariotLogger.Warn("Failed to execute bootstrap script", zap.Error(err))
+				}
+			} else {
+				cfg.ChariotLogger.Warn("Failed to read bootstrap script", zap.Error(err))
+			}
+		} else {
+			cfg.ChariotLogger.Warn("Failed to resolve bootstrap path", zap.Error(err))
+		}
+	}
+	return rt
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/storage"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/vault"
+	"go.uber.org/zap"
+)
+
+// openStorage opens the configured storage provider, encrypting what it
+// stores when storage keys are configured. Keys given as secret:name are
+// read from the vault, which must be initialized first.
+func openStorage() (storage.Provider, error) {
+	files, err := storage.Open(cfg.ChariotConfig)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ChariotConfig.StorageKeys == "" {
+		return files, nil
+	}
+	keys, err := storage.ParseKeys(cfg.ChariotConfig.StorageKeys, func(name string) (string, error) {
+		return vault.GetSecretValue(context.Background(), name)
+	})
+	if err == nil {
+		var encrypted *storage.Encrypted
+		if encrypted, err = storage.NewEncrypted(files, keys); err == nil {
+			return encrypted, nil
+		}
+	}
+	files.Close()
+	return nil, err
+}
+
+// workspacePaths lists the files kept by the storage provider: the .ch
+// files, the diagrams and the function library with its versions, global
+// and in every sandbox.
+func workspacePaths(files storage.Provider) ([]string, error) {
+	var paths []string
+	walk := func(root string, keep func(path string) bool) error {
+		if root == "" {
+			return nil
+		}
+		return files.Walk(root, func(path string) error {
+			if keep(path) {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+	}
+	inDir := func(name, ext string) func(string) bool {
+		return func(path string) bool {
+			return filepath.Base(filepath.Dir(path)) == name && filepath.Ext(path) == ext
+		}
+	}
+	isJSON := func(path string) bool { return filepath.Ext(path) == ".json" }
+
+	c := cfg.ChariotConfig
+	if err := walk(filepath.Join(c.DataPath, "files"), inDir("files", ".ch")); err != nil {
+		return nil, err
+	}
+	if err := walk(c.DiagramPath, isJSON); err != nil {
+		return nil, err
+	}
+	if c.FunctionLib != "" {
+		lib := filepath.Join(c.TreePath, c.FunctionLib)
+		if _, err := files.Stat(lib); err == nil {
+			paths = append(paths, lib)
+		}
+		if err := walk(strings.TrimSuffix(lib, filepath.Ext(lib))+".versions", isJSON); err != nil {
+			return nil, err
+		}
+	}
+	if c.SandboxEnabled {
+		root, err := cfg.SandboxesPath()
+		if err != nil {
+			return nil, err
+		}
+		sandboxFile := func(path string) bool {
+			return inDir("files", ".ch")(path) || inDir("diagrams", ".json")(path)
+		}
+		if err := walk(root, sandboxFile); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// runStorage implements "go-chariot storage rotate": it encrypts every
+// workspace file with the first of the storage keys, rewriting those
+// encrypted with an older key or kept in the clear, and prints a JSON
+// report. The exit code is non-zero when a file could not be rewritten.
+func runStorage(args []string) int {
+	fs := flag.NewFlagSet("storage", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "count the files to rewrite without writing them")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: go-chariot storage rotate [--dry-run]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "rotate" {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 0 {
+		return exitUsage
+	}
+
+	slogger := logs.NewZapLoggerTo("stdout")
+	defer slogger.Sync()
+	cfg.ChariotLogger = slogger
+	if err := vault.InitVaultClient(); err != nil {
+		slogger.Warn("Vault client unavailable", zap.Error(err))
+	}
+	files, err := openStorage()
+	if err != nil {
+		slogger.Error("Failed to open storage provider", zap.Error(err))
+		return exitUsage
+	}
+	defer files.Close()
+	encrypted, ok := files.(*storage.Encrypted)
+	if !ok {
+		slogger.Error("Storage keys are not configured (CHARIOT_STORAGE_KEYS)")
+		return exitUsage
+	}
+	paths, err := workspacePaths(encrypted)
+	if err != nil {
+		slogger.Error("Failed to list workspace files", zap.Error(err))
+		return exitScriptError
+	}
+	report := encrypted.Rotate(paths, *dryRun)
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Fprintln(os.Stdout, string(out))
+	if len(report.Failed) > 0 {
+		return exitScriptError
+	}
+	return exitOK
+}
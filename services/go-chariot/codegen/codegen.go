@@ -0,0 +1,445 @@
+// Package codegen converts Visual DSL diagrams into Chariot source code on the
+// server. It mirrors the generator in packages/chariot-codegen so diagrams can
+// be executed without the editor in the loop. Node types the Go port does not
+// yet cover are reported through UnsupportedNodesError rather than emitted as
+// broken code.
+package codegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+// Diagram is the saved Visual DSL diagram document.
+type Diagram struct {
+	Name             string                    `json:"name"`
+	Description      string                    `json:"description,omitempty"`
+	Component        bool                      `json:"component,omitempty"`  // listed in the component library
+	Parameters       []string                  `json:"parameters,omitempty"` // inputs when used as a sub-diagram
+	Nodes            []Node                    `json:"nodes"`
+	Edges            []Edge                    `json:"edges"`
+	NestingRelations []NestingRelation         `json:"nestingRelations"`
+	Code             string                    `json:"code,omitempty"`      // code saved from the editor, if any
+	SourceMap        *chariot.DiagramSourceMap `json:"sourceMap,omitempty"` // source map for Code
+}
+
+// Node is a single diagram block.
+type Node struct {
+	ID       string   `json:"id"`
+	Type     string   `json:"type"`
+	Data     NodeData `json:"data"`
+	Position struct {
+		X float64 `json:"x"`
+		Y float64 `json:"y"`
+	} `json:"position"`
+}
+
+// NodeData carries the block's label and editable properties.
+type NodeData struct {
+	Label      string                 `json:"label"`
+	Icon       string                 `json:"icon"`
+	Category   string                 `json:"category"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// Edge connects two blocks in execution order.
+type Edge struct {
+	ID           string `json:"id"`
+	Source       string `json:"source"`
+	Target       string `json:"target"`
+	SourceHandle string `json:"sourceHandle,omitempty"`
+	TargetHandle string `json:"targetHandle,omitempty"`
+}
+
+// NestingRelation places a block inside a container block.
+type NestingRelation struct {
+	ParentID string  `json:"parentId"`
+	ChildID  string  `json:"childId"`
+	Order    float64 `json:"order"`
+}
+
+// Result is generated code and its source map.
+type Result struct {
+	Code      string
+	SourceMap *chariot.DiagramSourceMap
+}
+
+// UnsupportedNodesError lists block labels the server-side generator cannot emit.
+type UnsupportedNodesError struct {
+	Labels []string
+}
+
+func (e *UnsupportedNodesError) Error() string {
+	return fmt.Sprintf("server-side code generation does not support: %s (save generated code from the editor to run this diagram)", strings.Join(e.Labels, ", "))
+}
+
+// ParseDiagram decodes a diagram document.
+func ParseDiagram(data []byte) (*Diagram, error) {
+	var d Diagram
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("invalid diagram: %w", err)
+	}
+	return &d, nil
+}
+
+// Generate converts a diagram to Chariot code. Sub Diagram blocks need a
+// resolver; use GenerateWithComponents for diagrams that contain them.
+func Generate(d *Diagram) (*Result, error) {
+	return GenerateWithComponents(d, nil)
+}
+
+// GenerateWithComponents converts a diagram to Chariot code, compiling each
+// diagram referenced by a Sub Diagram block into a function defined ahead of
+// the main flow.
+func GenerateWithComponents(d *Diagram, resolve ComponentResolver) (*Result, error) {
+	g := newGenerator(d)
+	g.resolve = resolve
+	return g.generate()
+}
+
+type generator struct {
+	diagram        *Diagram
+	nodeMap        map[string]*Node
+	executionOrder []string
+	nestingMap     map[string][]string
+	nestingOrder   []string // parents in first-seen order, matching JS Map iteration
+	parentLookup   map[string]string
+	structural     map[string]bool
+	unsupported    map[string]bool
+	resolve        ComponentResolver
+	flows          *flowSet // sub-diagram functions, shared with nested generators
+	err            error
+}
+
+func newGenerator(d *Diagram) *generator {
+	g := &generator{
+		diagram:      d,
+		nodeMap:      make(map[string]*Node),
+		nestingMap:   make(map[string][]string),
+		parentLookup: make(map[string]string),
+		unsupported:  make(map[string]bool),
+		flows:        newFlowSet(),
+	}
+	for i := range d.Nodes {
+		if d.Nodes[i].Type == "group" {
+			continue
+		}
+		g.nodeMap[d.Nodes[i].ID] = &d.Nodes[i]
+	}
+	for _, rel := range d.NestingRelations {
+		if g.nodeMap[rel.ParentID] == nil || g.nodeMap[rel.ChildID] == nil {
+			continue
+		}
+		if _, ok := g.nestingMap[rel.ParentID]; !ok {
+			g.nestingOrder = append(g.nestingOrder, rel.ParentID)
+		}
+		g.nestingMap[rel.ParentID] = append(g.nestingMap[rel.ParentID], rel.ChildID)
+		g.parentLookup[rel.ChildID] = rel.ParentID
+	}
+	g.calculateExecutionOrder()
+	g.structural = g.collectStructuralInlineNodes()
+	return g
+}
+
+var inlineDeclareLabels = map[string]bool{
+	"Create": true, "New Tree": true, "Parse JSON": true, "parseJSON": true,
+	"parseJSONSimple": true, "Array": true, "Range": true,
+}
+
+type statement struct {
+	code string
+	node *Node
+}
+
+func (g *generator) generate() (*Result, error) {
+	stmts := g.statements()
+	if g.err != nil {
+		return nil, g.err
+	}
+	if len(g.unsupported) > 0 {
+		labels := make([]string, 0, len(g.unsupported))
+		for l := range g.unsupported {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		return nil, &UnsupportedNodesError{Labels: labels}
+	}
+
+	lines := []string{"// " + g.diagram.Name, ""}
+	emitted := len(lines)
+	var mappings []chariot.SourceMapping
+	// Sub-diagram functions come first and map to the block that first used them
+	for _, stmt := range append(g.flows.defs, stmts...) {
+		line := emitted + 1
+		lines = append(lines, stmt.code)
+		emitted += strings.Count(stmt.code, "\n") + 1
+		mappings = append(mappings, chariot.SourceMapping{Line: line, EndLine: emitted, NodeID: stmt.node.ID, Label: g.label(stmt.node)})
+	}
+	return &Result{
+		Code:      strings.Join(lines, "\n"),
+		SourceMap: &chariot.DiagramSourceMap{Version: 1, Diagram: g.diagram.Name, Mappings: mappings},
+	}, nil
+}
+
+// statements generates the top-level statements of the diagram in execution order.
+func (g *generator) statements() []statement {
+	inlineProcessed := make(map[string]bool)
+	for _, parentID := range g.nestingOrder {
+		childIDs := g.nestingMap[parentID]
+		parent := g.nodeMap[parentID]
+		parentLabel := g.label(parent)
+		if parentLabel == "Declare" && len(childIDs) == 1 {
+			child := g.nodeMap[childIDs[0]]
+			typeSpec := propOr(parent, "typeSpecifier", "T")
+			childLabel := g.label(child)
+			if inlineDeclareLabels[childLabel] || (childLabel == "Function" && typeSpec == "F") {
+				inlineProcessed[childIDs[0]] = true
+			}
+		} else if parentLabel == "Set Equal" || parentLabel == "Set Value" || parentLabel == "Set Q" || parentLabel == "setq" {
+			for _, id := range childIDs {
+				inlineProcessed[id] = true
+			}
+		}
+	}
+	for id := range g.structural {
+		inlineProcessed[id] = true
+	}
+
+	var stmts []statement
+	for _, id := range g.executionOrder {
+		if inlineProcessed[id] {
+			continue
+		}
+		node := g.nodeMap[id]
+		if node == nil {
+			continue
+		}
+		code, ok := g.nodeCode(node)
+		if !ok || code == "" {
+			continue
+		}
+		stmts = append(stmts, statement{code: code, node: node})
+	}
+	return stmts
+}
+
+func (g *generator) calculateExecutionOrder() {
+	var start *Node
+	for i := range g.diagram.Nodes {
+		n := &g.diagram.Nodes[i]
+		if n.Data.Label == "Start" || n.ID == "start" {
+			start = n
+			break
+		}
+	}
+	if start == nil {
+		for _, n := range g.diagram.Nodes {
+			if n.Type != "group" {
+				g.executionOrder = append(g.executionOrder, n.ID)
+			}
+		}
+		return
+	}
+	visited := make(map[string]bool)
+	stack := []string{start.ID}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+		g.executionOrder = append(g.executionOrder, current)
+
+		var mainFlow, nesting []Edge
+		for _, e := range g.diagram.Edges {
+			if e.Source != current {
+				continue
+			}
+			target := g.nodeMap[e.Target]
+			if target != nil && (e.SourceHandle == "right" || target.Data.Label == "Tree Save" || target.Data.Label == "Add Child") {
+				mainFlow = append(mainFlow, e)
+			} else {
+				nesting = append(nesting, e)
+			}
+		}
+		sort.SliceStable(mainFlow, func(i, j int) bool {
+			a, b := g.nodeMap[mainFlow[i].Target], g.nodeMap[mainFlow[j].Target]
+			if math.Abs(a.Position.Y-b.Position.Y) < 50 {
+				return a.Position.X < b.Position.X
+			}
+			return a.Position.Y < b.Position.Y
+		})
+		for i := len(mainFlow) - 1; i >= 0; i-- {
+			stack = append(stack, mainFlow[i].Target)
+		}
+		for i := len(nesting) - 1; i >= 0; i-- {
+			stack = append(stack, nesting[i].Target)
+		}
+	}
+	for _, n := range g.diagram.Nodes {
+		if n.Type != "group" && !visited[n.ID] {
+			g.executionOrder = append(g.executionOrder, n.ID)
+		}
+	}
+}
+
+func (g *generator) collectStructuralInlineNodes() map[string]bool {
+	inline := make(map[string]bool)
+	var visit func(id string)
+	visit = func(id string) {
+		if inline[id] {
+			return
+		}
+		inline[id] = true
+		for _, child := range g.nestingMap[id] {
+			visit(child)
+		}
+	}
+	for _, parentID := range g.nestingOrder {
+		switch g.label(g.nodeMap[parentID]) {
+		case "Switch", "If", "While", "Loop Body":
+			for _, childID := range g.nestingMap[parentID] {
+				visit(childID)
+				for _, extra := range g.collectBranchFlow(childID) {
+					visit(extra)
+				}
+			}
+		}
+	}
+	return inline
+}
+
+var branchMarkers = map[string]bool{"Case": true, "Default": true, "Switch": true, "Then": true, "Else": true, "Loop Body": true}
+
+func (g *generator) collectBranchFlow(parentID string) []string {
+	visited := make(map[string]bool)
+	var pending []string
+	for _, e := range g.diagram.Edges {
+		if e.Source == parentID && g.nodeMap[e.Target] != nil {
+			pending = append(pending, e.Target)
+		}
+	}
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if visited[id] {
+			continue
+		}
+		node := g.nodeMap[id]
+		if node == nil || branchMarkers[g.label(node)] {
+			continue
+		}
+		fromContainer, fromOtherBranch := false, false
+		for _, e := range g.diagram.Edges {
+			if e.Target != id {
+				continue
+			}
+			srcLabel := g.label(g.nodeMap[e.Source])
+			if srcLabel == "Switch" || srcLabel == "If" || srcLabel == "While" {
+				fromContainer = true
+			}
+			if e.Source != parentID && (srcLabel == "Case" || srcLabel == "Default" || srcLabel == "Then" || srcLabel == "Else" || srcLabel == "Loop Body") {
+				fromOtherBranch = true
+			}
+		}
+		if fromContainer || fromOtherBranch {
+			continue
+		}
+		if parent, ok := g.parentLookup[id]; ok && parent != parentID {
+			continue
+		}
+		visited[id] = true
+		for _, e := range g.diagram.Edges {
+			if e.Source == id && !visited[e.Target] {
+				pending = append(pending, e.Target)
+			}
+		}
+	}
+	var ordered []string
+	for _, id := range g.executionOrder {
+		if visited[id] {
+			ordered = append(ordered, id)
+		}
+	}
+	return ordered
+}
+
+func (g *generator) orderedChildren(parentID string) []string {
+	rels := make([]NestingRelation, 0)
+	for _, rel := range g.diagram.NestingRelations {
+		if rel.ParentID == parentID && g.nodeMap[rel.ChildID] != nil {
+			rels = append(rels, rel)
+		}
+	}
+	sort.SliceStable(rels, func(i, j int) bool { return rels[i].Order < rels[j].Order })
+	ids := make([]string, len(rels))
+	for i, rel := range rels {
+		ids[i] = rel.ChildID
+	}
+	return ids
+}
+
+func (g *generator) branchChildren(parentID string) []string {
+	result := g.orderedChildren(parentID)
+	seen := make(map[string]bool, len(result))
+	for _, id := range result {
+		seen[id] = true
+	}
+	for _, id := range g.collectBranchFlow(parentID) {
+		if !seen[id] {
+			result = append(result, id)
+			seen[id] = true
+		}
+	}
+	return result
+}
+
+func (g *generator) blockFromChildren(indent int, childIDs []string) []string {
+	var out []string
+	pad := strings.Repeat(" ", indent)
+	for _, id := range childIDs {
+		node := g.nodeMap[id]
+		if node == nil {
+			continue
+		}
+		code, ok := g.nodeCode(node)
+		if !ok || code == "" {
+			continue
+		}
+		for _, line := range strings.Split(code, "\n") {
+			out = append(out, pad+line)
+		}
+	}
+	return out
+}
+
+func (g *generator) findChild(ids []string, label string) string {
+	for _, id := range ids {
+		if g.label(g.nodeMap[id]) == label {
+			return id
+		}
+	}
+	return ""
+}
+
+var identPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func inlineBlock(raw interface{}, indent int) []string {
+	text := strings.TrimSpace(toString(raw))
+	if text == "" {
+		return nil
+	}
+	pad := strings.Repeat(" ", indent)
+	var out []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		out = append(out, pad+strings.TrimRight(line, " \t"))
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+package codegen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ComponentResolver loads the diagram a Sub Diagram block refers to by name.
+type ComponentResolver func(name string) (*Diagram, error)
+
+// flowSet collects the functions compiled from sub-diagrams. Nested
+// sub-diagrams are compiled before the diagrams that use them, so defs is
+// already in definition order.
+type flowSet struct {
+	defs      []statement
+	names     map[string]string // diagram name -> function variable
+	compiling map[string]bool
+}
+
+func newFlowSet() *flowSet {
+	return &flowSet{names: make(map[string]string), compiling: make(map[string]bool)}
+}
+
+var nonIdentChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// FlowFunctionName is the variable holding the function compiled from the
+// named sub-diagram.
+func FlowFunctionName(diagram string) string {
+	return "flow_" + strings.Trim(nonIdentChars.ReplaceAllString(strings.TrimSpace(diagram), "_"), "_")
+}
+
+// SubDiagrams returns the names of the diagrams referenced by Sub Diagram
+// blocks, in block order.
+func (d *Diagram) SubDiagrams() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for i := range d.Nodes {
+		if canonicalLabel(d.Nodes[i].Data.Label) != "Sub Diagram" {
+			continue
+		}
+		name := strings.TrimSpace(propOr(&d.Nodes[i], "diagram", ""))
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (g *generator) subDiagramCode(node *Node) string {
+	name := strings.TrimSpace(propOr(node, "diagram", ""))
+	fn := g.compileFlow(name, node)
+	call := fmt.Sprintf("call(%s)", strings.Join(append([]string{fn}, expressionList(prop(node, "arguments"))...), ", "))
+	if result := strings.TrimSpace(propOr(node, "resultVariable", "")); result != "" {
+		return fmt.Sprintf("setq(%s, %s)", result, call)
+	}
+	return call
+}
+
+// compileFlow generates the function for a sub-diagram once and returns the
+// variable that holds it. Failures are recorded on g.err.
+func (g *generator) compileFlow(name string, caller *Node) string {
+	fn := FlowFunctionName(name)
+	if name == "" || fn == "flow_" {
+		g.fail(fmt.Errorf("sub diagram block %s does not name a diagram", caller.ID))
+		return fn
+	}
+	if _, done := g.flows.names[name]; done {
+		return fn
+	}
+	if g.flows.compiling[name] {
+		g.fail(fmt.Errorf("sub diagram %q refers to itself", name))
+		return fn
+	}
+	if g.resolve == nil {
+		g.fail(fmt.Errorf("sub diagram %q cannot be resolved here", name))
+		return fn
+	}
+	sub, err := g.resolve(name)
+	if err != nil {
+		g.fail(fmt.Errorf("sub diagram %q: %w", name, err))
+		return fn
+	}
+	if sub.Name == "" {
+		sub.Name = name
+	}
+
+	g.flows.compiling[name] = true
+	child := newGenerator(sub)
+	child.resolve, child.flows = g.resolve, g.flows
+	stmts := child.statements()
+	delete(g.flows.compiling, name)
+	g.fail(child.err)
+	for label := range child.unsupported {
+		g.unsupported[label] = true
+	}
+
+	body := []string{}
+	for _, stmt := range stmts {
+		for _, line := range strings.Split(stmt.code, "\n") {
+			body = append(body, "  "+line)
+		}
+	}
+	body = append(body, "})")
+	g.flows.names[name] = fn
+	g.flows.defs = append(g.flows.defs, statement{
+		code: fmt.Sprintf("setq(%s, func(%s) {\n%s", fn, strings.Join(sub.Parameters, ", "), strings.Join(body, "\n")),
+		node: caller,
+	})
+	return fn
+}
+
+// fail keeps the first error reported while generating.
+func (g *generator) fail(err error) {
+	if g.err == nil {
+		g.err = err
+	}
+}
@@ -0,0 +1,93 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+// ListenerLimits are the checks the code of a diagram must pass before a
+// listener runs it, unattended and on the shared runtime.
+type ListenerLimits struct {
+	Runtime *chariot.Runtime        // Functions the code may call besides the builtins, for type checks (nil = builtins only)
+	Sandbox *chariot.SandboxProfile // Profile of the listener's owner (nil = not checked)
+	MaxCost int                     // Highest estimated cost score allowed (0 = no limit)
+}
+
+// ListenerCode returns the code a listener bound to d runs, chosen as
+// /api/diagrams/:name/run chooses it: the code saved by the editor, unless
+// there is none or the diagram uses sub-diagrams, which only the server
+// generates.
+func ListenerCode(d *Diagram, resolve ComponentResolver) (*Result, error) {
+	if strings.TrimSpace(d.Code) != "" && len(d.SubDiagrams()) == 0 {
+		res := &Result{Code: d.Code, SourceMap: d.SourceMap}
+		if res.SourceMap == nil {
+			res.SourceMap, _ = chariot.ExtractSourceMap(d.Code)
+		}
+		return res, nil
+	}
+	return GenerateWithComponents(d, resolve)
+}
+
+// CheckCode lints code generated from a diagram and checks it against the
+// limits of a listener: syntax and type errors, calls the sandbox profile
+// denies, and an estimated cost above MaxCost are all errors. Issues are
+// placed on the block that generated the offending line, as the source map
+// gives it. The cost is nil when the code does not parse.
+func CheckCode(res *Result, limits ListenerLimits) ([]Issue, *chariot.ProgramCost) {
+	issues := []Issue{}
+	lineIssue := func(code string, line int, message string) {
+		is := Issue{Severity: SeverityError, Code: code, Message: message}
+		if line > 0 {
+			is.Message = fmt.Sprintf("line %d: %s", line, message)
+		}
+		if mp, ok := res.SourceMap.Lookup(line); ok {
+			is.NodeID, is.Label = mp.NodeID, mp.Label
+		}
+		issues = append(issues, is)
+	}
+
+	program, err := chariot.ParseSource(res.Code, "listener.ch")
+	if err != nil {
+		info := chariot.DescribeError(err)
+		lineIssue("lint_syntax", info.Line, info.Message)
+		return issues, nil
+	}
+	for _, te := range chariot.CheckTypes(program, limits.Runtime) {
+		lineIssue("lint_type", te.Pos.Line, te.Message)
+	}
+	if limits.Sandbox != nil {
+		for _, sv := range chariot.CheckSandbox(program, limits.Sandbox) {
+			lineIssue("sandbox_denied", sv.Pos.Line, sv.Message)
+		}
+	}
+	cost := chariot.EstimateCost(program)
+	if limits.MaxCost > 0 && cost.Score > limits.MaxCost {
+		issues = append(issues, Issue{Severity: SeverityError, Code: "cost_exceeded",
+			Message: fmt.Sprintf("estimated cost %d is above the listener limit of %d", cost.Score, limits.MaxCost)})
+	}
+	return issues, &cost
+}
+
+// ValidateForListener validates d as Validate does, then checks the code a
+// listener would run as CheckCode does. Blocks the server cannot generate
+// are errors here, since nothing else can run the diagram. It also returns
+// the checked code, nil when there is none.
+func ValidateForListener(d *Diagram, resolve ComponentResolver, limits ListenerLimits) (*ValidationReport, *Result) {
+	issues := Validate(d).Issues
+	res, err := ListenerCode(d, resolve)
+	if err != nil {
+		for i := range issues {
+			if issues[i].Code == "server_codegen_unsupported" {
+				issues[i].Severity = SeverityError
+			}
+		}
+		issues = append(issues, Issue{Severity: SeverityError, Code: "codegen_failed", Message: err.Error()})
+		return newReport(issues), nil
+	}
+	codeIssues, cost := CheckCode(res, limits)
+	report := newReport(append(issues, codeIssues...))
+	report.Cost = cost
+	return report, res
+}
@@ -0,0 +1,609 @@
+package codegen
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// labelAliases canonicalizes block labels, matching canonicalLabel in the
+// TypeScript generator.
+var labelAliases = map[string]string{
+	"set equal": "Set Equal", "set value": "Set Value", "set q": "Set Q", "setq": "Set Q",
+	"logprint": "LogPrint", "log print": "Log Print", "loop body": "Loop Body", "symbol": "Symbol",
+	"and": "and", "or": "or", "not": "not",
+	"equal": "equal", "equals": "equal", "unequal": "unequal",
+	"bigger": "bigger", "greater": "bigger", "smaller": "smaller", "less": "smaller",
+	"biggereq": "biggerEq", "greaterorequal": "biggerEq", "smallereq": "smallerEq", "lessorequal": "smallerEq",
+	"add": "add", "addition": "add", "sub": "sub", "subtract": "sub",
+	"mul": "mul", "multiply": "mul", "div": "div", "divide": "div",
+	"sub diagram": "Sub Diagram", "subdiagram": "Sub Diagram",
+	"abs": "abs", "absolute": "abs", "max": "max", "maximum": "max", "min": "min", "minimum": "min",
+}
+
+func canonicalLabel(raw string) string {
+	normalized := strings.TrimSpace(raw)
+	if alias, ok := labelAliases[strings.ToLower(normalized)]; ok {
+		return alias
+	}
+	return normalized
+}
+
+func (g *generator) label(node *Node) string {
+	if node == nil {
+		return ""
+	}
+	return canonicalLabel(node.Data.Label)
+}
+
+// nodeCode generates the statement for a node. ok is false for labels the Go
+// port does not cover; those are recorded for UnsupportedNodesError.
+func (g *generator) nodeCode(node *Node) (string, bool) {
+	label := g.label(node)
+	switch label {
+	case "Start":
+		return "// Starting " + propOr(node, "name", g.diagram.Name), true
+	case "Declare":
+		return g.declareCode(node), true
+	case "Symbol":
+		return symbolCode(node), true
+	case "Create":
+		return g.createCode(node), true
+	case "New Tree":
+		return g.newTreeCode(node), true
+	case "Parse JSON", "parseJSON":
+		return g.parseJSONCode(node), true
+	case "Array":
+		return arrayCode(node), true
+	case "Range":
+		return fmt.Sprintf("range(%s, %s)", propOr(node, "start", "0"), propOr(node, "end", "10")), true
+	case "LogPrint", "Log Print", "logPrint":
+		return logPrintCode(node), true
+	case "Sleep":
+		return fmt.Sprintf("sleep(%s)", propOr(node, "milliseconds", "1000")), true
+	case "Get Env":
+		return fmt.Sprintf("getEnv('%s')", propOr(node, "varName", "PATH")), true
+	case "Exit":
+		code := propOr(node, "exitCode", "")
+		if code == "" || code == "0" {
+			return "exit()", true
+		}
+		return fmt.Sprintf("exit(%s)", code), true
+	case "Function":
+		return functionCode(node), true
+	case "Sub Diagram":
+		return g.subDiagramCode(node), true
+	case "If":
+		return g.ifCode(node), true
+	case "While":
+		return g.whileCode(node), true
+	case "Case", "Default", "Then", "Else", "Loop Body":
+		return "", true
+	case "Set Equal", "Set Value", "Set Q", "SetQ":
+		return g.setqCode(node), true
+	case "and":
+		return fmt.Sprintf("and(%s)", strings.Join(logicOperands(prop(node, "operands"), 2, "true"), ", ")), true
+	case "or":
+		return fmt.Sprintf("or(%s)", strings.Join(logicOperands(prop(node, "operands"), 2, "false"), ", ")), true
+	case "not":
+		raw := prop(node, "operands")
+		if raw == nil {
+			raw = prop(node, "operand")
+		}
+		return fmt.Sprintf("not(%s)", strings.Join(logicOperands(raw, 1, "flag"), ", ")), true
+	case "equal", "unequal":
+		left := coerceExpression(prop(node, "leftOperand"), "valueA")
+		right := coerceExpression(prop(node, "rightOperand"), "valueB")
+		raw, isList := prop(node, "operands").([]interface{})
+		if !isList {
+			raw = []interface{}{left, right}
+		}
+		return fmt.Sprintf("%s(%s)", label, strings.Join(logicOperands(raw, 2, right), ", ")), true
+	case "bigger", "biggerEq", "smaller", "smallerEq":
+		left := coerceExpression(prop(node, "leftOperand"), "valueA")
+		right := coerceExpression(prop(node, "rightOperand"), "valueB")
+		return fmt.Sprintf("%s(%s, %s)", label, left, right), true
+	case "add", "sub", "mul":
+		left, right := binaryMathOperands(node, "valueA", "valueB")
+		return fmt.Sprintf("%s(%s, %s)", label, left, right), true
+	case "div":
+		left, right := binaryMathOperands(node, "numerator", "denominator")
+		return fmt.Sprintf("div(%s, %s)", left, right), true
+	case "abs":
+		var source interface{}
+		if operands := expressionList(prop(node, "operands")); len(operands) > 0 {
+			source = operands[0]
+		} else if source = prop(node, "operand"); source == nil {
+			source = prop(node, "value")
+		}
+		return fmt.Sprintf("abs(%s)", coerceExpression(source, "value")), true
+	case "max", "min":
+		values := expressionList(prop(node, "operands"))
+		if len(values) == 0 {
+			values = []string{"valueA", "valueB"}
+		}
+		return fmt.Sprintf("%s(%s)", label, strings.Join(values, ", ")), true
+	}
+	g.unsupported[node.Data.Label] = true
+	return "", false
+}
+
+func symbolCode(node *Node) string {
+	name := strings.TrimSpace(toString(prop(node, "symbolName")))
+	if name == "" {
+		name = "value"
+	}
+	return fmt.Sprintf("symbol('%s')", escapeQuotes(name))
+}
+
+func (g *generator) declareCode(node *Node) string {
+	varName := propOr(node, "variableName", "")
+	if varName == "" {
+		varName = g.inferVariableName(node)
+	}
+	typeSpec := propOr(node, "typeSpecifier", "T")
+	fn := "declare"
+	if truthy(prop(node, "isGlobal")) {
+		fn = "declareGlobal"
+	}
+	if children := g.nestingMap[node.ID]; len(children) == 1 {
+		if child := g.nodeMap[children[0]]; child != nil {
+			childLabel := g.label(child)
+			var childCode string
+			switch {
+			case childLabel == "Function" && typeSpec == "F":
+				childCode = functionCode(child)
+			case inlineDeclareLabels[childLabel]:
+				childCode, _ = g.nodeCode(child)
+			}
+			if childCode != "" {
+				return fmt.Sprintf("%s(%s, '%s', %s)", fn, varName, typeSpec, childCode)
+			}
+		}
+	}
+	if initial := toString(prop(node, "initialValue")); strings.TrimSpace(initial) != "" {
+		return fmt.Sprintf("%s(%s, '%s', %s)", fn, varName, typeSpec, initial)
+	}
+	return fmt.Sprintf("%s(%s, '%s')", fn, varName, typeSpec)
+}
+
+func (g *generator) createCode(node *Node) string {
+	if raw, ok := node.Data.Properties["nodeName"]; ok {
+		name := strings.TrimSpace(toString(raw))
+		if name == "" {
+			return "create()"
+		}
+		return fmt.Sprintf("create('%s')", name)
+	}
+	fallback := g.diagram.Name
+	if strings.TrimSpace(fallback) == "" {
+		fallback = "newNode"
+	}
+	return fmt.Sprintf("create('%s')", fallback)
+}
+
+func (g *generator) newTreeCode(node *Node) string {
+	name := strings.TrimSpace(toString(prop(node, "nodeName")))
+	if name == "" {
+		name = g.inferNodeNameFromContext(node)
+	}
+	return fmt.Sprintf("newTree('%s')", name)
+}
+
+func (g *generator) parseJSONCode(node *Node) string {
+	jsonString := propOr(node, "jsonString", "{}")
+	nodeName := propOr(node, "nodeName", "")
+	if nodeName == "" {
+		nodeName = g.inferNodeNameFromContext(node)
+	}
+	switch jsonString {
+	case "{ [] }":
+		jsonString = "[]"
+	case `{ ["admin", "contributor", "viewer"] }`:
+		jsonString = `["admin", "contributor", "viewer"]`
+	}
+	return fmt.Sprintf("parseJSON('%s', '%s')", jsonString, nodeName)
+}
+
+func arrayCode(node *Node) string {
+	values, _ := prop(node, "values").([]interface{})
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + toString(v) + "'"
+	}
+	return fmt.Sprintf("array(%s)", strings.Join(quoted, ", "))
+}
+
+func logPrintCode(node *Node) string {
+	message := propOr(node, "message", "message")
+	level := propOr(node, "logLevel", "info")
+	extra, _ := prop(node, "additionalArgs").([]interface{})
+	var args []string
+	if identPattern.MatchString(message) {
+		args = append(args, message)
+	} else {
+		args = append(args, "'"+message+"'")
+	}
+	if level != "info" || len(extra) > 0 {
+		args = append(args, "'"+level+"'")
+		for _, a := range extra {
+			if s := toString(a); s != "" {
+				args = append(args, s)
+			}
+		}
+	}
+	return fmt.Sprintf("logPrint(%s)", strings.Join(args, ", "))
+}
+
+type functionParam struct{ name, value string }
+
+func functionParams(node *Node) []functionParam {
+	var params []functionParam
+	if raw, ok := prop(node, "parameters").([]interface{}); ok {
+		for _, entry := range raw {
+			switch e := entry.(type) {
+			case string:
+				if name := strings.TrimSpace(e); name != "" {
+					params = append(params, functionParam{name: name})
+				}
+			case map[string]interface{}:
+				name := strings.TrimSpace(toString(e["name"]))
+				value := strings.TrimSpace(toString(e["value"]))
+				if name != "" || value != "" {
+					params = append(params, functionParam{name, value})
+				}
+			}
+		}
+	}
+	names, _ := prop(node, "parameterNames").([]interface{})
+	values, _ := prop(node, "parameterValues").([]interface{})
+	for i := 0; i < len(names) || i < len(values); i++ {
+		var name, value string
+		if i < len(names) {
+			name = strings.TrimSpace(toString(names[i]))
+		}
+		if i < len(values) {
+			value = strings.TrimSpace(toString(values[i]))
+		}
+		if name != "" || value != "" {
+			params = append(params, functionParam{name, value})
+		}
+	}
+	return params
+}
+
+func functionCode(node *Node) string {
+	params := functionParams(node)
+	var names, defaults []string
+	seen := make(map[string]bool)
+	for _, p := range params {
+		if p.name == "" {
+			continue
+		}
+		if !seen[p.name] {
+			seen[p.name] = true
+			names = append(names, p.name)
+		}
+		if p.value != "" {
+			defaults = append(defaults, fmt.Sprintf("  if(equal(%s, DBNull)) {\n    setq(%s, %s);\n  }", p.name, p.name, p.value))
+		}
+	}
+	var sections []string
+	if len(defaults) > 0 {
+		sections = append(sections, strings.Join(defaults, "\n"))
+	}
+	body := strings.ReplaceAll(toString(prop(node, "body")), "\r\n", "\n")
+	if strings.TrimSpace(body) != "" {
+		sections = append(sections, body)
+	}
+	return fmt.Sprintf("func(%s) {\n%s\n}", strings.Join(names, ", "), strings.Join(sections, "\n"))
+}
+
+func (g *generator) ifCode(node *Node) string {
+	condition := strings.TrimSpace(toString(prop(node, "condition")))
+	if condition == "" {
+		condition = "true"
+	}
+	lines := []string{fmt.Sprintf("if(%s) {", condition)}
+	body := prop(node, "ifBody")
+	if body == nil {
+		body = prop(node, "body")
+	}
+	inlineIf := inlineBlock(body, 2)
+	ordered := g.orderedChildren(node.ID)
+
+	var nestedIf []string
+	if thenID := g.findChild(ordered, "Then"); thenID != "" {
+		nestedIf = g.blockFromChildren(2, g.branchChildren(thenID))
+	} else {
+		var fallback []string
+		for _, id := range ordered {
+			if g.label(g.nodeMap[id]) != "Else" {
+				fallback = append(fallback, id)
+			}
+		}
+		nestedIf = g.blockFromChildren(2, fallback)
+	}
+	lines = append(lines, inlineIf...)
+	lines = append(lines, nestedIf...)
+	if len(inlineIf) == 0 && len(nestedIf) == 0 {
+		lines = append(lines, "  // TODO: add statements")
+	}
+	lines = append(lines, "}")
+
+	var elseBlock []string
+	if elseID := g.findChild(ordered, "Else"); elseID != "" {
+		elseBlock = g.blockFromChildren(2, g.branchChildren(elseID))
+	}
+	inlineElse := inlineBlock(prop(node, "elseBody"), 2)
+	if truthy(prop(node, "hasElse")) || len(inlineElse) > 0 || len(elseBlock) > 0 {
+		lines = append(lines, "else {")
+		lines = append(lines, inlineElse...)
+		lines = append(lines, elseBlock...)
+		if len(inlineElse) == 0 && len(elseBlock) == 0 {
+			lines = append(lines, "  // TODO: add else statements")
+		}
+		lines = append(lines, "}")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (g *generator) whileCode(node *Node) string {
+	condition := strings.TrimSpace(toString(prop(node, "condition")))
+	if condition == "" {
+		condition = "true"
+	}
+	lines := []string{fmt.Sprintf("while(%s) {", condition)}
+	if max, err := strconv.ParseFloat(toString(prop(node, "maxIterations")), 64); err == nil && max > 0 && !math.IsInf(max, 0) {
+		lines = append(lines, fmt.Sprintf("  // max iterations: %d", int64(math.Floor(max))))
+	}
+	inlineBody := inlineBlock(prop(node, "body"), 2)
+	ordered := g.orderedChildren(node.ID)
+	var nested []string
+	if bodyID := g.findChild(ordered, "Loop Body"); bodyID != "" {
+		nested = g.blockFromChildren(2, g.branchChildren(bodyID))
+	} else {
+		nested = g.blockFromChildren(2, ordered)
+	}
+	lines = append(lines, inlineBody...)
+	lines = append(lines, nested...)
+	if len(inlineBody) == 0 && len(nested) == 0 {
+		lines = append(lines, "  // TODO: add loop body statements")
+	}
+	lines = append(lines, "}")
+	return strings.Join(lines, "\n")
+}
+
+func (g *generator) setqCode(node *Node) string {
+	varName := strings.TrimSpace(propOr(node, "variableName", ""))
+	if varName == "" {
+		varName = strings.TrimSpace(g.inferVariableName(node))
+	}
+	if varName == "" {
+		varName = "var"
+	}
+	children := g.orderedChildren(node.ID)
+	if len(children) == 0 {
+		return fmt.Sprintf("setq(%s, %s)", varName, setqValueFromProps(node))
+	}
+	var lines []string
+	for _, id := range children[:len(children)-1] {
+		if code, _ := g.nodeCode(g.nodeMap[id]); code != "" {
+			lines = append(lines, code)
+		}
+	}
+	value := ""
+	if final := g.nodeMap[children[len(children)-1]]; final != nil {
+		if value = g.setqInlineValue(final); value == "" {
+			if code, _ := g.nodeCode(final); code != "" {
+				lines = append(lines, code)
+			}
+		}
+	}
+	if strings.TrimSpace(value) == "" {
+		value = setqValueFromProps(node)
+	}
+	return strings.Join(append(lines, fmt.Sprintf("setq(%s, %s)", varName, value)), "\n")
+}
+
+// setqInlineValue returns the expression for a child that can be used directly
+// as a setq value, or "" when it must be emitted as its own statement.
+func (g *generator) setqInlineValue(child *Node) string {
+	switch g.label(child) {
+	case "Symbol", "Create", "New Tree", "Parse JSON", "Array", "Range", "Function", "Get Env", "and", "or", "not":
+		code, _ := g.nodeCode(child)
+		return code
+	}
+	return ""
+}
+
+func setqValueFromProps(node *Node) string {
+	value := toString(prop(node, "value"))
+	if strings.TrimSpace(value) == "" {
+		return "''"
+	}
+	if toString(prop(node, "valueType")) == "expression" {
+		return value
+	}
+	return "'" + escapeQuotes(value) + "'"
+}
+
+func (g *generator) inferVariableName(node *Node) string {
+	if name := propOr(node, "variableName", ""); name != "" {
+		return name
+	}
+	var nearby []*Node
+	for i := range g.diagram.Nodes {
+		n := &g.diagram.Nodes[i]
+		if n.ID != node.ID && math.Abs(n.Position.X-node.Position.X) < 200 && math.Abs(n.Position.Y-node.Position.Y) < 100 {
+			nearby = append(nearby, n)
+		}
+	}
+	for _, labels := range [][]string{{"Create", "New Tree"}, {"Parse JSON"}} {
+		for _, n := range nearby {
+			if n.Data.Label == labels[0] || (len(labels) > 1 && n.Data.Label == labels[1]) {
+				if name := propOr(n, "nodeName", ""); name != "" {
+					return name
+				}
+				break
+			}
+		}
+	}
+	x := node.Position.X
+	switch {
+	case x > 250 && x < 350:
+		return "users"
+	case x > 450 && x < 550:
+		return "config"
+	case x > 650 && x < 750:
+		return "roles"
+	case x > 800 && x < 900:
+		return "rules"
+	case x < 100:
+		return g.diagram.Name
+	}
+	common := []string{"users", "roles", "config", "rules", "data"}
+	index := -1
+	for i := range g.diagram.Nodes {
+		if g.diagram.Nodes[i].ID == node.ID {
+			index = i
+			break
+		}
+	}
+	if index >= 0 && index < len(common) {
+		return common[index]
+	}
+	return fmt.Sprintf("var%d", index)
+}
+
+func (g *generator) inferNodeNameFromContext(node *Node) string {
+	for _, rel := range g.diagram.NestingRelations {
+		if rel.ChildID != node.ID {
+			continue
+		}
+		if parent := g.nodeMap[rel.ParentID]; parent != nil {
+			if name := propOr(parent, "variableName", ""); name != "" {
+				return name
+			}
+		}
+		break
+	}
+	x := node.Position.X
+	switch {
+	case x > 250 && x < 300:
+		return "users"
+	case x > 450 && x < 500:
+		return "roles"
+	case x > 650 && x < 700:
+		return "rules"
+	case x > 800:
+		return "config"
+	}
+	return "data"
+}
+
+// Property helpers. Diagram properties are loosely typed JSON; these follow
+// the JavaScript coercions used by the TypeScript generator.
+
+func prop(node *Node, key string) interface{} {
+	if node == nil || node.Data.Properties == nil {
+		return nil
+	}
+	return node.Data.Properties[key]
+}
+
+// propOr returns the property as a string, or def when it is falsy.
+func propOr(node *Node, key, def string) string {
+	v := prop(node, key)
+	if !truthy(v) {
+		if s, ok := v.(string); !ok || s == "" {
+			return def
+		}
+	}
+	return toString(v)
+}
+
+func toString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	case []interface{}:
+		parts := make([]string, len(t))
+		for i, e := range t {
+			parts[i] = toString(e)
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case string:
+		return strings.EqualFold(strings.TrimSpace(t), "true")
+	case float64:
+		return t != 0
+	}
+	return false
+}
+
+func escapeQuotes(s string) string { return strings.ReplaceAll(s, "'", `\'`) }
+
+func coerceExpression(v interface{}, fallback string) string {
+	if text := strings.TrimSpace(toString(v)); text != "" {
+		return text
+	}
+	return fallback
+}
+
+func expressionList(raw interface{}) []string {
+	if list, ok := raw.([]interface{}); ok {
+		var out []string
+		for _, e := range list {
+			if s := strings.TrimSpace(toString(e)); s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	if s := strings.TrimSpace(toString(raw)); s != "" {
+		return []string{s}
+	}
+	return nil
+}
+
+func logicOperands(raw interface{}, minLength int, pad string) []string {
+	if minLength < 1 {
+		minLength = 1
+	}
+	operands := expressionList(raw)
+	if len(operands) == 0 {
+		operands = []string{pad}
+	}
+	for len(operands) < minLength {
+		operands = append(operands, operands[len(operands)-1])
+	}
+	return operands
+}
+
+func binaryMathOperands(node *Node, defLeft, defRight string) (string, string) {
+	left, right := prop(node, "leftOperand"), prop(node, "rightOperand")
+	if list, ok := prop(node, "operands").([]interface{}); ok {
+		if len(list) > 0 {
+			left = list[0]
+		}
+		if len(list) > 1 {
+			right = list[1]
+		}
+	}
+	return coerceExpression(left, defLeft), coerceExpression(right, defRight)
+}
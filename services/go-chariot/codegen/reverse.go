@@ -0,0 +1,545 @@
+package codegen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+// Unmapped is a construct FromCode could not express as diagram blocks.
+type Unmapped struct {
+	Line   int    `json:"line,omitempty"`
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+	Inline bool   `json:"inline,omitempty"` // kept as inline code in an If/While body rather than dropped
+}
+
+// ReverseReport summarizes a code→diagram conversion. Complete is true when
+// every statement became a block, so regenerating code from the diagram
+// reproduces the program.
+type ReverseReport struct {
+	Complete bool       `json:"complete"`
+	Blocks   int        `json:"blocks"`
+	Unmapped []Unmapped `json:"unmapped"`
+}
+
+// blockIcons mirrors the Visual DSL palette so converted diagrams render like
+// hand-built ones.
+var blockIcons = map[string][2]string{
+	"Start": {"🚀", "control"}, "If": {"🔀", "control"}, "While": {"⭕", "control"}, "Function": {"⚙️", "control"},
+	"Then": {"✅", "control"}, "Else": {"🚫", "control"}, "Loop Body": {"🔁", "control"},
+	"Declare": {"📋", "value"}, "Symbol": {"🔣", "value"}, "Set Equal": {"💾", "value"},
+	"Create": {"🆕", "node"}, "New Tree": {"🌳", "tree"}, "Parse JSON": {"📖", "json"},
+	"Array": {"📊", "array"}, "Range": {"🔢", "array"},
+	"Log Print": {"📝", "system"}, "Sleep": {"😴", "system"}, "Get Env": {"🌐", "system"}, "Exit": {"🚪", "system"},
+	"and": {"🤝", "comparison"}, "or": {"🔗", "comparison"}, "not": {"🚫", "comparison"},
+	"equal": {"⚖️", "comparison"}, "unequal": {"⚔️", "comparison"},
+	"bigger": {"▶️", "comparison"}, "biggerEq": {"⏩", "comparison"}, "smaller": {"◀️", "comparison"}, "smallerEq": {"⏪", "comparison"},
+	"Add": {"➕", "math"}, "Subtract": {"➖", "math"}, "Multiply": {"✖️", "math"}, "Divide": {"➗", "math"},
+	"Absolute": {"📏", "math"}, "Maximum": {"⬆️", "math"}, "Minimum": {"⬇️", "math"},
+}
+
+var mathBlocks = map[string]string{"add": "Add", "sub": "Subtract", "mul": "Multiply", "div": "Divide"}
+
+// Layout spacing, matching the editor's branch placement
+const (
+	chainSpacing  = 200
+	nestSpacing   = 150
+	stackSpacing  = 110
+	diagramOrigin = 100
+)
+
+// FromCode converts Chariot code into a diagram using the block vocabulary
+// Generate understands. Statements with no block equivalent are listed in the
+// report; inside If/While bodies they are kept as inline code instead.
+func FromCode(code, name string) (*Diagram, *ReverseReport, error) {
+	if name == "" {
+		name = headerName(code)
+	}
+	parsed, err := chariot.NewParser(code).ParseCode(code)
+	if err != nil {
+		return nil, nil, err
+	}
+	var stmts []chariot.Node
+	if block, ok := parsed.(*chariot.Block); ok {
+		stmts = block.Stmts
+	} else if parsed != nil {
+		stmts = []chariot.Node{parsed}
+	}
+
+	b := &diagramBuilder{d: &Diagram{Name: name, Nodes: []Node{}, Edges: []Edge{}, NestingRelations: []NestingRelation{}}}
+	b.report.Unmapped = []Unmapped{}
+	b.addNode("Start", map[string]interface{}{"name": name}, diagramOrigin, diagramOrigin)
+	b.d.Nodes[0].ID = "start"
+
+	prev, placed := "start", 0
+	for _, stmt := range stmts {
+		id, ok := b.statement(stmt, float64(diagramOrigin+(placed+1)*chainSpacing), diagramOrigin)
+		if !ok {
+			b.unmapped(stmt, false)
+			continue
+		}
+		b.connect(prev, id, "right", "left")
+		prev = id
+		placed++
+	}
+	b.report.Blocks = len(b.d.Nodes) - 1
+	b.report.Complete = len(b.report.Unmapped) == 0
+	return b.d, &b.report, nil
+}
+
+// headerName reads the diagram name from the "// name" comment Generate emits
+// on the first line.
+func headerName(code string) string {
+	first := strings.TrimSpace(strings.SplitN(strings.TrimSpace(code), "\n", 2)[0])
+	if strings.HasPrefix(first, "//") && !strings.Contains(first, "__VDSL_") {
+		return strings.TrimSpace(strings.TrimPrefix(first, "//"))
+	}
+	return "untitled"
+}
+
+type diagramBuilder struct {
+	d      *Diagram
+	report ReverseReport
+	seq    int
+}
+
+func (b *diagramBuilder) addNode(label string, props map[string]interface{}, x, y float64) string {
+	b.seq++
+	id := fmt.Sprintf("%s-%d", strings.ToLower(strings.ReplaceAll(label, " ", "-")), b.seq)
+	icon := blockIcons[label]
+	n := Node{ID: id, Type: "logicon", Data: NodeData{Label: label, Icon: icon[0], Category: icon[1], Properties: props}}
+	n.Position.X, n.Position.Y = x, y
+	b.d.Nodes = append(b.d.Nodes, n)
+	return id
+}
+
+func (b *diagramBuilder) connect(source, target, sourceHandle, targetHandle string) {
+	b.d.Edges = append(b.d.Edges, Edge{
+		ID: source + "-" + target, Source: source, Target: target,
+		SourceHandle: sourceHandle, TargetHandle: targetHandle,
+	})
+}
+
+func (b *diagramBuilder) nest(parent, child string, order int) {
+	b.d.NestingRelations = append(b.d.NestingRelations, NestingRelation{ParentID: parent, ChildID: child, Order: float64(order)})
+}
+
+func (b *diagramBuilder) unmapped(stmt chariot.Node, inline bool) {
+	reason := "no diagram block for this statement"
+	if call, ok := stmt.(*chariot.FuncCall); ok {
+		reason = fmt.Sprintf("no diagram block for %s() in this form", call.Name)
+	}
+	b.report.Unmapped = append(b.report.Unmapped, Unmapped{
+		Line: stmt.GetPos().Line, Code: firstLine(sourceOf(stmt, 0)), Reason: reason, Inline: inline,
+	})
+}
+
+// statement adds the block(s) for stmt at (x, y) and returns the block's ID.
+func (b *diagramBuilder) statement(stmt chariot.Node, x, y float64) (string, bool) {
+	switch n := stmt.(type) {
+	case *chariot.IfNode:
+		return b.ifBlock(n, x, y), true
+	case *chariot.WhileNode:
+		return b.whileBlock(n, x, y), true
+	case *chariot.FunctionDefNode:
+		return b.addNode("Function", functionProps(n), x, y), true
+	case *chariot.FuncCall:
+		return b.call(n, x, y)
+	}
+	return "", false
+}
+
+func (b *diagramBuilder) call(call *chariot.FuncCall, x, y float64) (string, bool) {
+	args := call.Args
+	switch call.Name {
+	case "declare", "declareGlobal":
+		return b.declare(call, x, y)
+	case "setq":
+		return b.setq(call, x, y)
+	case "logPrint":
+		if len(args) == 0 {
+			break
+		}
+		props := map[string]interface{}{}
+		if ref, ok := args[0].(*chariot.VarRef); ok {
+			props["message"] = ref.Name
+		} else if s, ok := plainString(args[0]); ok && !identPattern.MatchString(s) {
+			props["message"] = s
+		} else {
+			break
+		}
+		if len(args) > 1 {
+			level, ok := plainString(args[1])
+			if !ok {
+				break
+			}
+			props["logLevel"] = level
+			extra := make([]interface{}, 0, len(args)-2)
+			for _, a := range args[2:] {
+				extra = append(extra, sourceOf(a, 0))
+			}
+			if len(extra) > 0 {
+				props["additionalArgs"] = extra
+			}
+		}
+		return b.addNode("Log Print", props, x, y), true
+	case "sleep":
+		if len(args) == 1 {
+			return b.addNode("Sleep", map[string]interface{}{"milliseconds": sourceOf(args[0], 0)}, x, y), true
+		}
+	case "exit":
+		if len(args) == 0 {
+			return b.addNode("Exit", map[string]interface{}{}, x, y), true
+		}
+		if len(args) == 1 {
+			return b.addNode("Exit", map[string]interface{}{"exitCode": sourceOf(args[0], 0)}, x, y), true
+		}
+	}
+	if label, props, ok := valueBlock(call); ok {
+		return b.addNode(label, props, x, y), true
+	}
+	return "", false
+}
+
+// valueBlock maps expression calls that have a dedicated block.
+func valueBlock(call *chariot.FuncCall) (string, map[string]interface{}, bool) {
+	args := call.Args
+	switch call.Name {
+	case "getEnv":
+		if s, ok := stringLiteralArgs(args, 1); ok {
+			return "Get Env", map[string]interface{}{"varName": s[0]}, true
+		}
+	case "symbol":
+		if s, ok := stringLiteralArgs(args, 1); ok {
+			return "Symbol", map[string]interface{}{"symbolName": s[0]}, true
+		}
+	case "create":
+		if len(args) == 0 {
+			return "Create", map[string]interface{}{"nodeName": ""}, true
+		}
+		if s, ok := stringLiteralArgs(args, 1); ok {
+			return "Create", map[string]interface{}{"nodeName": s[0]}, true
+		}
+	case "newTree":
+		if s, ok := stringLiteralArgs(args, 1); ok && s[0] != "" {
+			return "New Tree", map[string]interface{}{"nodeName": s[0]}, true
+		}
+	case "parseJSON":
+		if s, ok := stringLiteralArgs(args, 2); ok && s[1] != "" {
+			return "Parse JSON", map[string]interface{}{"jsonString": s[0], "nodeName": s[1]}, true
+		}
+	case "array":
+		values := make([]interface{}, 0, len(args))
+		for _, a := range args {
+			s, ok := plainString(a)
+			if !ok {
+				return "", nil, false
+			}
+			values = append(values, s)
+		}
+		return "Array", map[string]interface{}{"values": values}, true
+	case "range":
+		if len(args) == 2 {
+			return "Range", map[string]interface{}{"start": sourceOf(args[0], 0), "end": sourceOf(args[1], 0)}, true
+		}
+	case "and", "or", "max", "min":
+		if len(args) == 0 {
+			break
+		}
+		label := map[string]string{"and": "and", "or": "or", "max": "Maximum", "min": "Minimum"}[call.Name]
+		if (call.Name == "and" || call.Name == "or") && len(args) < 2 {
+			break
+		}
+		return label, map[string]interface{}{"operands": sources(args)}, true
+	case "not":
+		if len(args) == 1 {
+			return "not", map[string]interface{}{"operands": sources(args)}, true
+		}
+	case "equal", "unequal":
+		if len(args) >= 2 {
+			return call.Name, map[string]interface{}{"operands": sources(args)}, true
+		}
+	case "bigger", "biggerEq", "smaller", "smallerEq":
+		if len(args) == 2 {
+			return call.Name, map[string]interface{}{"leftOperand": sourceOf(args[0], 0), "rightOperand": sourceOf(args[1], 0)}, true
+		}
+	case "add", "sub", "mul", "div":
+		if len(args) == 2 {
+			return mathBlocks[call.Name], map[string]interface{}{"operands": sources(args)}, true
+		}
+	case "abs":
+		if len(args) == 1 {
+			return "Absolute", map[string]interface{}{"operands": sources(args)}, true
+		}
+	}
+	return "", nil, false
+}
+
+func (b *diagramBuilder) declare(call *chariot.FuncCall, x, y float64) (string, bool) {
+	if len(call.Args) < 2 || len(call.Args) > 3 {
+		return "", false
+	}
+	ref, ok := call.Args[0].(*chariot.VarRef)
+	typeSpec, isStr := plainString(call.Args[1])
+	if !ok || !isStr {
+		return "", false
+	}
+	props := map[string]interface{}{"variableName": ref.Name, "typeSpecifier": typeSpec}
+	if call.Name == "declareGlobal" {
+		props["isGlobal"] = true
+	}
+	if len(call.Args) == 2 {
+		return b.addNode("Declare", props, x, y), true
+	}
+	init := call.Args[2]
+	var childLabel string
+	var childProps map[string]interface{}
+	switch v := init.(type) {
+	case *chariot.FunctionDefNode:
+		if typeSpec == "F" {
+			childLabel, childProps = "Function", functionProps(v)
+		}
+	case *chariot.FuncCall:
+		if label, p, ok := valueBlock(v); ok && inlineDeclareLabels[label] {
+			childLabel, childProps = label, p
+		}
+	}
+	if childLabel == "" {
+		props["initialValue"] = sourceOf(init, 0)
+		return b.addNode("Declare", props, x, y), true
+	}
+	id := b.addNode("Declare", props, x, y)
+	child := b.addNode(childLabel, childProps, x, y+nestSpacing)
+	b.nest(id, child, 0)
+	return id, true
+}
+
+func (b *diagramBuilder) setq(call *chariot.FuncCall, x, y float64) (string, bool) {
+	if len(call.Args) != 2 {
+		return "", false
+	}
+	ref, ok := call.Args[0].(*chariot.VarRef)
+	if !ok {
+		return "", false
+	}
+	props := map[string]interface{}{"variableName": ref.Name}
+	if fn, isFunc := call.Args[1].(*chariot.FunctionDefNode); isFunc {
+		id := b.addNode("Set Equal", props, x, y)
+		child := b.addNode("Function", functionProps(fn), x, y+nestSpacing)
+		b.nest(id, child, 0)
+		return id, true
+	}
+	if s, isStr := stringLiteral(call.Args[1]); isStr && strings.TrimSpace(s) != "" && !strings.ContainsAny(s, "\\\n") {
+		props["value"], props["valueType"] = s, "string"
+	} else {
+		props["value"], props["valueType"] = sourceOf(call.Args[1], 0), "expression"
+	}
+	return b.addNode("Set Equal", props, x, y), true
+}
+
+func (b *diagramBuilder) ifBlock(n *chariot.IfNode, x, y float64) string {
+	id := b.addNode("If", map[string]interface{}{"condition": sourceOf(n.Condition, 0)}, x, y)
+	then := b.addNode("Then", map[string]interface{}{}, x, y+nestSpacing)
+	b.nest(id, then, 0)
+	b.connect(id, then, "bottom", "top")
+	if inline := b.branch(then, n.TrueBranch, x, y+nestSpacing); inline != "" {
+		b.setProp(id, "ifBody", inline)
+	}
+	if len(n.FalseBranch) > 0 {
+		elseID := b.addNode("Else", map[string]interface{}{}, x+nestSpacing, y+nestSpacing)
+		b.nest(id, elseID, 1)
+		b.connect(id, elseID, "bottom", "top")
+		if inline := b.branch(elseID, n.FalseBranch, x+nestSpacing, y+nestSpacing); inline != "" {
+			b.setProp(id, "elseBody", inline)
+		}
+	}
+	return id
+}
+
+func (b *diagramBuilder) whileBlock(n *chariot.WhileNode, x, y float64) string {
+	id := b.addNode("While", map[string]interface{}{"condition": sourceOf(n.Condition, 0)}, x, y)
+	body := b.addNode("Loop Body", map[string]interface{}{"description": ""}, x, y+nestSpacing)
+	b.nest(id, body, 0)
+	b.connect(id, body, "bottom", "top")
+	if inline := b.branch(body, n.Body, x, y+nestSpacing); inline != "" {
+		b.setProp(id, "body", inline)
+	}
+	return id
+}
+
+// branch nests the blocks for stmts under parent. The generator emits inline
+// body text before nested blocks, so when a statement has no block the whole
+// branch is kept as inline code to preserve statement order.
+func (b *diagramBuilder) branch(parent string, stmts []chariot.Node, x, y float64) string {
+	mark := len(b.d.Nodes)
+	marks := [3]int{len(b.d.Edges), len(b.d.NestingRelations), b.seq}
+	for i, stmt := range stmts {
+		id, ok := b.statement(stmt, x+40, y+float64(i+1)*stackSpacing)
+		if !ok {
+			b.d.Nodes = b.d.Nodes[:mark]
+			b.d.Edges = b.d.Edges[:marks[0]]
+			b.d.NestingRelations = b.d.NestingRelations[:marks[1]]
+			b.seq = marks[2]
+			lines := make([]string, len(stmts))
+			for j, s := range stmts {
+				lines[j] = sourceOf(s, 0)
+				if j >= i && !mappable(s) {
+					b.unmapped(s, true)
+				}
+			}
+			return strings.Join(lines, "\n")
+		}
+		b.nest(parent, id, i)
+	}
+	return ""
+}
+
+// mappable reports whether stmt converts to a block, without keeping it.
+func mappable(stmt chariot.Node) bool {
+	scratch := &diagramBuilder{d: &Diagram{}}
+	_, ok := scratch.statement(stmt, 0, 0)
+	return ok
+}
+
+func (b *diagramBuilder) setProp(id, key string, value interface{}) {
+	for i := range b.d.Nodes {
+		if b.d.Nodes[i].ID == id {
+			b.d.Nodes[i].Data.Properties[key] = value
+			return
+		}
+	}
+}
+
+func functionProps(fn *chariot.FunctionDefNode) map[string]interface{} {
+	params := make([]interface{}, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		params[i] = map[string]interface{}{"name": p, "value": ""}
+	}
+	return map[string]interface{}{"parameters": params, "body": blockSource(fn.Body, 2)}
+}
+
+func stringLiteral(n chariot.Node) (string, bool) {
+	if lit, ok := n.(*chariot.Literal); ok {
+		if s, ok := lit.Val.(chariot.Str); ok {
+			return string(s), true
+		}
+	}
+	return "", false
+}
+
+// plainString returns a string literal that can be embedded between single
+// quotes without escaping, as the generator does for most block properties.
+func plainString(n chariot.Node) (string, bool) {
+	s, ok := stringLiteral(n)
+	if !ok || strings.ContainsAny(s, "'\\\n") {
+		return "", false
+	}
+	return s, true
+}
+
+func stringLiteralArgs(args []chariot.Node, count int) ([]string, bool) {
+	if len(args) != count {
+		return nil, false
+	}
+	out := make([]string, count)
+	for i, a := range args {
+		s, ok := plainString(a)
+		if !ok {
+			return nil, false
+		}
+		out[i] = s
+	}
+	return out, true
+}
+
+func sources(nodes []chariot.Node) []interface{} {
+	out := make([]interface{}, len(nodes))
+	for i, n := range nodes {
+		out[i] = sourceOf(n, 0)
+	}
+	return out
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i] + " ..."
+	}
+	return s
+}
+
+// sourceOf renders an AST node back to Chariot source in the style Generate
+// emits: single-quoted strings and two-space indentation.
+func sourceOf(node chariot.Node, indent int) string {
+	switch n := node.(type) {
+	case nil:
+		return ""
+	case *chariot.Literal:
+		switch v := n.Val.(type) {
+		case chariot.Str:
+			return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`, "\n", `\n`, "\t", `\t`).Replace(string(v)) + "'"
+		case chariot.Number:
+			return strconv.FormatFloat(float64(v), 'f', -1, 64)
+		case chariot.Bool:
+			return strconv.FormatBool(bool(v))
+		}
+		return n.ToString()
+	case *chariot.VarRef:
+		return n.Name
+	case *chariot.ArrayLiteralNode:
+		parts := make([]string, len(n.Elements))
+		for i, e := range n.Elements {
+			parts[i] = sourceOf(e, indent)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case *chariot.FuncCall:
+		args := n.Args
+		var trailing *chariot.Block
+		if len(args) > 0 {
+			if blk, ok := args[len(args)-1].(*chariot.Block); ok {
+				trailing, args = blk, args[:len(args)-1]
+			}
+		}
+		parts := make([]string, len(args))
+		for i, a := range args {
+			parts[i] = sourceOf(a, indent)
+		}
+		s := n.Name + "(" + strings.Join(parts, ", ") + ")"
+		if trailing != nil {
+			s += " {\n" + blockSource(trailing, indent+2) + "\n" + strings.Repeat(" ", indent) + "}"
+		}
+		return s
+	case *chariot.FunctionDefNode:
+		return "func(" + strings.Join(n.Parameters, ", ") + ") {\n" + blockSource(n.Body, indent+2) + "\n" + strings.Repeat(" ", indent) + "}"
+	case *chariot.IfNode:
+		pad := strings.Repeat(" ", indent)
+		s := "if(" + sourceOf(n.Condition, indent) + ") {\n" + stmtsSource(n.TrueBranch, indent+2) + "\n" + pad + "}"
+		if len(n.FalseBranch) > 0 {
+			s += " else {\n" + stmtsSource(n.FalseBranch, indent+2) + "\n" + pad + "}"
+		}
+		return s
+	case *chariot.WhileNode:
+		return "while(" + sourceOf(n.Condition, indent) + ") {\n" + stmtsSource(n.Body, indent+2) + "\n" + strings.Repeat(" ", indent) + "}"
+	case *chariot.Block:
+		return blockSource(n, indent)
+	}
+	return node.ToString()
+}
+
+func blockSource(node chariot.Node, indent int) string {
+	if blk, ok := node.(*chariot.Block); ok {
+		return stmtsSource(blk.Stmts, indent)
+	}
+	return strings.Repeat(" ", indent) + sourceOf(node, indent)
+}
+
+func stmtsSource(stmts []chariot.Node, indent int) string {
+	pad := strings.Repeat(" ", indent)
+	lines := make([]string, len(stmts))
+	for i, s := range stmts {
+		lines[i] = pad + sourceOf(s, indent)
+	}
+	return strings.Join(lines, "\n")
+}
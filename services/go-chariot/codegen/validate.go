@@ -0,0 +1,381 @@
+package codegen
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+// Issue severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Issue is a structural problem found in a diagram.
+type Issue struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	NodeID   string `json:"nodeId,omitempty"`
+	EdgeID   string `json:"edgeId,omitempty"`
+	Label    string `json:"label,omitempty"`
+	Property string `json:"property,omitempty"`
+}
+
+// ValidationReport is the result of Validate.
+type ValidationReport struct {
+	Valid  bool                 `json:"valid"` // no error-severity issues
+	Issues []Issue              `json:"issues"`
+	Cost   *chariot.ProgramCost `json:"cost,omitempty"` // estimated cost of the code, from ValidateForListener
+}
+
+// branchParents lists the container each branch marker must be nested in.
+var branchParents = map[string][]string{
+	"Then":      {"If"},
+	"Else":      {"If"},
+	"Loop Body": {"While"},
+	"Case":      {"Switch"},
+	"Default":   {"Switch"},
+}
+
+type requiredProp struct {
+	name     string
+	severity string
+}
+
+// requiredProps lists properties without which a block generates code that
+// relies on guessed defaults.
+var requiredProps = map[string][]requiredProp{
+	"Declare":     {{"variableName", SeverityError}},
+	"Set Q":       {{"variableName", SeverityError}},
+	"Set Equal":   {{"variableName", SeverityError}},
+	"Set Value":   {{"variableName", SeverityError}},
+	"SetQ":        {{"variableName", SeverityError}},
+	"If":          {{"condition", SeverityWarning}},
+	"While":       {{"condition", SeverityWarning}},
+	"Get Env":     {{"varName", SeverityError}},
+	"Parse JSON":  {{"jsonString", SeverityWarning}},
+	"LogPrint":    {{"message", SeverityWarning}},
+	"Log Print":   {{"message", SeverityWarning}},
+	"Sleep":       {{"milliseconds", SeverityWarning}},
+	"Sub Diagram": {{"diagram", SeverityError}},
+}
+
+// outputTypes maps blocks that produce a value to the Chariot type specifiers
+// that value satisfies.
+var outputTypes = map[string][]string{
+	"Create":     {"T", "M", "O"},
+	"New Tree":   {"T", "M", "O"},
+	"Parse JSON": {"J", "T", "O"},
+	"parseJSON":  {"J", "T", "O"},
+	"Array":      {"A"},
+	"Range":      {"A"},
+	"Function":   {"F"},
+	"Symbol":     {"S"},
+	"Get Env":    {"S"},
+	"and":        {"L"}, "or": {"L"}, "not": {"L"},
+	"equal": {"L"}, "unequal": {"L"}, "bigger": {"L"}, "biggerEq": {"L"}, "smaller": {"L"}, "smallerEq": {"L"},
+	"add": {"N"}, "sub": {"N"}, "mul": {"N"}, "div": {"N"}, "abs": {"N"}, "max": {"N"}, "min": {"N"},
+}
+
+// inputTypes maps blocks to the type specifier their operand inputs expect.
+var inputTypes = map[string]string{
+	"and": "L", "or": "L", "not": "L",
+	"bigger": "N", "biggerEq": "N", "smaller": "N", "smallerEq": "N",
+	"add": "N", "sub": "N", "mul": "N", "div": "N", "abs": "N", "max": "N", "min": "N",
+	"If": "L", "While": "L",
+}
+
+// operandProps lists the properties holding a block's operand inputs.
+var operandProps = []string{"operands", "operand", "leftOperand", "rightOperand", "numerator", "denominator", "condition"}
+
+var numberLiteral = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+
+// Validate checks a diagram for structural problems: dangling references,
+// branch blocks outside their container, values whose type does not match a
+// declaration or a block's input port, missing required properties, and
+// blocks that are disconnected or unreachable from Start.
+func Validate(d *Diagram) *ValidationReport {
+	v := &validator{g: newGenerator(d)}
+	v.checkNodes()
+	v.checkEdges()
+	v.checkNesting()
+	v.checkReachability()
+	v.checkCodegen()
+	return newReport(v.issues)
+}
+
+// newReport sorts issues by severity into a report.
+func newReport(issues []Issue) *ValidationReport {
+	sort.SliceStable(issues, func(i, j int) bool {
+		return severityRank(issues[i].Severity) < severityRank(issues[j].Severity)
+	})
+	report := &ValidationReport{Valid: true, Issues: issues}
+	if report.Issues == nil {
+		report.Issues = []Issue{}
+	}
+	for _, is := range report.Issues {
+		if is.Severity == SeverityError {
+			report.Valid = false
+			break
+		}
+	}
+	return report
+}
+
+func severityRank(s string) int {
+	switch s {
+	case SeverityError:
+		return 0
+	case SeverityWarning:
+		return 1
+	}
+	return 2
+}
+
+type validator struct {
+	g      *generator
+	issues []Issue
+}
+
+func (v *validator) add(is Issue) { v.issues = append(v.issues, is) }
+
+func (v *validator) nodeIssue(severity, code string, node *Node, format string, args ...interface{}) {
+	v.add(Issue{Severity: severity, Code: code, NodeID: node.ID, Label: node.Data.Label, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) checkNodes() {
+	seen := make(map[string]bool)
+	for i := range v.g.diagram.Nodes {
+		node := &v.g.diagram.Nodes[i]
+		if node.ID == "" {
+			v.add(Issue{Severity: SeverityError, Code: "missing_id", Label: node.Data.Label, Message: "block has no id"})
+			continue
+		}
+		if seen[node.ID] {
+			v.nodeIssue(SeverityError, "duplicate_id", node, "block id %q is used more than once", node.ID)
+		}
+		seen[node.ID] = true
+		if node.Type == "group" {
+			continue
+		}
+		label := v.g.label(node)
+		for _, req := range requiredProps[label] {
+			if strings.TrimSpace(toString(prop(node, req.name))) == "" {
+				v.add(Issue{Severity: req.severity, Code: "missing_parameter", NodeID: node.ID, Label: node.Data.Label, Property: req.name,
+					Message: fmt.Sprintf("%s block is missing %q", node.Data.Label, req.name)})
+			}
+		}
+		if label == "Declare" {
+			v.checkDeclareType(node)
+		}
+		if want, ok := inputTypes[label]; ok {
+			v.checkOperandTypes(node, want)
+		}
+	}
+}
+
+// checkDeclareType compares a declaration's type specifier with its nested
+// value block or literal initial value.
+func (v *validator) checkDeclareType(node *Node) {
+	typeSpec := strings.ToUpper(propOr(node, "typeSpecifier", "T"))
+	if typeSpec == "V" {
+		return
+	}
+	if children := v.g.nestingMap[node.ID]; len(children) == 1 {
+		if child := v.g.nodeMap[children[0]]; child != nil {
+			if types, ok := outputTypes[v.g.label(child)]; ok && !containsString(types, typeSpec) {
+				v.nodeIssue(SeverityError, "type_mismatch", node, "%s declared as type '%s' but nested %s block produces type '%s'",
+					propOr(node, "variableName", "variable"), typeSpec, child.Data.Label, strings.Join(types, "/"))
+			}
+		}
+		return
+	}
+	initial := strings.TrimSpace(toString(prop(node, "initialValue")))
+	if initial == "" {
+		return
+	}
+	if got := literalType(initial); got != "" && got != typeSpec && strings.Contains("NLS", typeSpec) {
+		v.nodeIssue(SeverityError, "type_mismatch", node, "initial value %s does not match declared type '%s'", initial, typeSpec)
+	}
+}
+
+// checkOperandTypes flags literal operands whose type cannot satisfy the
+// block's input port, e.g. a quoted string passed to add or a number used as
+// an If condition.
+func (v *validator) checkOperandTypes(node *Node, want string) {
+	for _, name := range operandProps {
+		for _, operand := range expressionList(prop(node, name)) {
+			if got := literalType(operand); got != "" && got != want {
+				v.add(Issue{Severity: SeverityError, Code: "type_mismatch", NodeID: node.ID, Label: node.Data.Label, Property: name,
+					Message: fmt.Sprintf("%s expects type '%s' but %s is type '%s'", node.Data.Label, want, operand, got)})
+			}
+		}
+	}
+}
+
+// literalType returns the type specifier of a literal expression, or "" for
+// anything that is not a literal.
+func literalType(expr string) string {
+	switch {
+	case strings.HasPrefix(expr, "'") || strings.HasPrefix(expr, `"`):
+		return "S"
+	case numberLiteral.MatchString(expr):
+		return "N"
+	case expr == "true" || expr == "false":
+		return "L"
+	}
+	return ""
+}
+
+func (v *validator) checkEdges() {
+	for _, e := range v.g.diagram.Edges {
+		for _, id := range []string{e.Source, e.Target} {
+			if !v.exists(id) {
+				v.add(Issue{Severity: SeverityError, Code: "unknown_node", EdgeID: e.ID, Message: fmt.Sprintf("connection references missing block %q", id)})
+			}
+		}
+		if src := v.g.nodeMap[e.Source]; src != nil && e.Source == e.Target {
+			v.add(Issue{Severity: SeverityError, Code: "self_loop", EdgeID: e.ID, NodeID: e.Source, Label: src.Data.Label, Message: "block is connected to itself"})
+		}
+	}
+}
+
+func (v *validator) checkNesting() {
+	for _, rel := range v.g.diagram.NestingRelations {
+		if !v.exists(rel.ParentID) || !v.exists(rel.ChildID) {
+			v.add(Issue{Severity: SeverityError, Code: "unknown_node", NodeID: rel.ChildID,
+				Message: fmt.Sprintf("nesting relation references missing block (%q in %q)", rel.ChildID, rel.ParentID)})
+		}
+	}
+	for i := range v.g.diagram.Nodes {
+		node := &v.g.diagram.Nodes[i]
+		parents, ok := branchParents[v.g.label(node)]
+		if !ok || v.g.nodeMap[node.ID] != node {
+			continue
+		}
+		container := v.branchContainer(node.ID)
+		if container == nil || !containsString(parents, v.g.label(container)) {
+			v.nodeIssue(SeverityError, "misplaced_branch", node, "%s block must be attached to a %s block", node.Data.Label, strings.Join(parents, " or "))
+		}
+	}
+}
+
+// branchContainer returns the block a branch marker belongs to, either by
+// nesting or by an incoming connection.
+func (v *validator) branchContainer(id string) *Node {
+	if parent, ok := v.g.parentLookup[id]; ok {
+		return v.g.nodeMap[parent]
+	}
+	for _, e := range v.g.diagram.Edges {
+		if e.Target == id {
+			if src := v.g.nodeMap[e.Source]; src != nil {
+				if _, isBranch := branchParents[v.g.label(src)]; !isBranch {
+					return src
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (v *validator) checkReachability() {
+	if len(v.g.nodeMap) == 0 {
+		return
+	}
+	connected := make(map[string]bool)
+	adjacent := make(map[string][]string)
+	for _, e := range v.g.diagram.Edges {
+		connected[e.Source], connected[e.Target] = true, true
+		adjacent[e.Source] = append(adjacent[e.Source], e.Target)
+	}
+	for _, rel := range v.g.diagram.NestingRelations {
+		connected[rel.ParentID], connected[rel.ChildID] = true, true
+		adjacent[rel.ParentID] = append(adjacent[rel.ParentID], rel.ChildID)
+	}
+
+	var start *Node
+	for i := range v.g.diagram.Nodes {
+		if n := &v.g.diagram.Nodes[i]; n.Type != "group" && (n.Data.Label == "Start" || n.ID == "start") {
+			start = n
+			break
+		}
+	}
+	if start == nil {
+		v.add(Issue{Severity: SeverityWarning, Code: "missing_start", Message: "diagram has no Start block; blocks run in creation order"})
+	}
+
+	reachable := make(map[string]bool)
+	if start != nil {
+		pending := []string{start.ID}
+		for len(pending) > 0 {
+			id := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			if reachable[id] {
+				continue
+			}
+			reachable[id] = true
+			pending = append(pending, adjacent[id]...)
+		}
+	}
+
+	for i := range v.g.diagram.Nodes {
+		node := &v.g.diagram.Nodes[i]
+		id := node.ID
+		if v.g.nodeMap[id] != node {
+			continue
+		}
+		switch {
+		case start != nil && id == start.ID:
+		case !connected[id] && len(v.g.nodeMap) > 1:
+			v.nodeIssue(SeverityWarning, "disconnected", node, "%s block is not connected to any other block", node.Data.Label)
+		case start != nil && connected[id] && !reachable[id]:
+			v.nodeIssue(SeverityWarning, "unreachable", node, "%s block is not reachable from Start", node.Data.Label)
+		}
+	}
+}
+
+// checkCodegen reports blocks the server-side generator cannot emit; such
+// diagrams still run from the editor but not through /api/diagrams/:name/run
+// without saved code.
+func (v *validator) checkCodegen() {
+	_, err := Generate(v.g.diagram)
+	var unsupported *UnsupportedNodesError
+	if !errors.As(err, &unsupported) {
+		return
+	}
+	labels := make(map[string]bool, len(unsupported.Labels))
+	for _, l := range unsupported.Labels {
+		labels[l] = true
+	}
+	for i := range v.g.diagram.Nodes {
+		node := &v.g.diagram.Nodes[i]
+		if labels[node.Data.Label] {
+			v.nodeIssue(SeverityInfo, "server_codegen_unsupported", node, "%s block is not supported by server-side code generation", node.Data.Label)
+		}
+	}
+}
+
+func (v *validator) exists(id string) bool {
+	for i := range v.g.diagram.Nodes {
+		if v.g.diagram.Nodes[i].ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
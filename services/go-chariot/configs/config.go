@@ -55,15 +55,95 @@ type Config struct {
 	SandboxEnabled      bool   `evar:"sandbox_enabled"`       // Enable per-user sandbox directories
 	SandboxRoot         string `evar:"sandbox_root"`          // Root directory for sandbox storage
 	SandboxDefaultScope string `evar:"sandbox_default_scope"` // Preferred default scope (sandbox or global)
+	SandboxProfiles     string `evar:"sandbox_profiles"`      // Sandbox profiles file under data path (missing = allow all notifications)
+	// Notification builtins (sendEmail, slackPost)
+	SMTPHost     string `evar:"smtp_host"`     // SMTP server for sendEmail ("" = disabled)
+	SMTPPort     int    `evar:"smtp_port"`     // SMTP port
+	SMTPUsername string `evar:"smtp_username"` // SMTP AUTH PLAIN user ("" = no authentication)
+	SMTPPassword string `evar:"smtp_password"` // SMTP AUTH PLAIN password
+	SMTPFrom     string `evar:"smtp_from"`     // Sender address of every message
+	SMTPTLS      string `evar:"smtp_tls"`      // starttls | tls | none
+	SlackToken   string `evar:"slack_token"`   // Slack bot token for slackPost ("" = disabled)
+	SlackAPIURL  string `evar:"slack_api_url"` // Slack Web API base URL
 	// Function library
 	FunctionLib string `evar:"function_lib"` // Filename of the function library
+	PlanLib     string `evar:"plan_lib"`     // Filename of the plan library shared by agents
 	Bootstrap   string `evar:"bootstrap"`    // Bootstrap script to run on startup
+	PluginsDir  string `evar:"plugins_dir"`  // Directory of builtin plugins, one subdirectory with a plugin.json each ("" = none)
+	// Interpreter limits
+	MaxCallDepth int `evar:"max_call_depth"` // Maximum nested user function calls (0 = interpreter default)
+	// Session runtimes
+	RuntimeIdleTimeout int    `evar:"runtime_idle_timeout"` // Minutes a session runtime may sit unused (0 = never evicted)
+	RuntimeIdlePolicy  string `evar:"runtime_idle_policy"`  // reset (fresh runtime) | end (end the session)
+	// Access tokens
+	AccessTokenTTL int `evar:"access_token_ttl"` // Minutes an access token is valid before the client refreshes it (0 = clients use the session token)
 	// Listeners registry persistence file (under data path)
-	ListenersFile string `evar:"listeners_file"`
+	ListenersFile   string `evar:"listeners_file"`
+	ListenerMaxCost int    `evar:"listener_max_cost"` // Highest estimated cost of the code of a diagram listener (0 = no limit)
+	// S3 access for watch listeners on s3:// sources (credentials come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN)
+	S3Endpoint string `evar:"s3_endpoint"` // scheme://host of an S3-compatible store ("" = AWS)
+	S3Region   string `evar:"s3_region"`   // Signing region
+	// Outbound webhooks
+	WebhooksFile       string `evar:"webhooks_file"`        // Subscription registry file (under data path)
+	WebhookMaxAttempts int    `evar:"webhook_max_attempts"` // Delivery attempts per event before giving up
+	WebhookTimeout     int    `evar:"webhook_timeout"`      // Seconds to wait for a webhook endpoint to respond
+	// Dead letters: listener payloads and webhook events that failed for good
+	DeadLetterFile string `evar:"dead_letter_file"` // Dead-letter store (under data path); "" keeps it in memory only
+	DeadLetterMax  int    `evar:"dead_letter_max"`  // Dead letters kept; the oldest are dropped past it
+	// Function and script file usage, and function deprecations
+	UsageFile    string `evar:"usage_file"`     // Usage file (under data path); "" keeps usage in memory only
+	TagUsageFile string `evar:"tag_usage_file"` // Usage by execution tag (under data path); "" keeps it in memory only
+	// Application log files
+	LogFile     string `evar:"log_file"`      // Structured log file (under data path), rotated and queried at /api/logs/system; "" logs to stderr only
+	LogMaxSize  int    `evar:"log_max_size"`  // MB a log file reaches before it is rotated
+	LogMaxFiles int    `evar:"log_max_files"` // Rotated log files kept
+	// Keystore for jwtSignWithKey and the other *WithKey builtins
+	KeystoreFile string `evar:"keystore_file"` // Keystore file (under data path)
+	KeystoreKey  string `evar:"keystore_key"`  // Secret holding the base64 AES key the keystore file is encrypted with ("" = not encrypted)
+	// Execution artifacts (files scripts hand back with their result)
+	ArtifactMaxSize    int `evar:"artifact_max_size"`    // KB per artifact (0 = 10 MB)
+	ArtifactMaxTotal   int `evar:"artifact_max_total"`   // KB for all artifacts of one run (0 = 50 MB)
+	ArtifactTTL        int `evar:"artifact_ttl"`         // Minutes artifacts stay downloadable
+	ArtifactInlineSize int `evar:"artifact_inline_size"` // KB up to which images are included in results
+	ResultMaxSize      int `evar:"result_max_size"`      // KB of JSON up to which results are returned whole (0 = 1 MB)
 	// MCP (Model Context Protocol) integration
 	MCPEnabled   bool   `evar:"mcp_enabled"`   // Enable MCP server
 	MCPTransport string `evar:"mcp_transport"` // stdio | ws (websocket)
 	MCPWSPath    string `evar:"mcp_ws_path"`   // WebSocket path when using ws
+	// Administration
+	AdminUsers string `evar:"admin_users"` // Comma-separated users who may manage accounts and other users' sessions, besides accounts with the admin role
+	UsersFile  string `evar:"users_file"`  // Account store file (under data path); logins are unchecked while it has no accounts
+	// Password policy and second factor for accounts
+	PasswordMinLength  int    `evar:"password_min_length"`   // Characters (at least 8)
+	PasswordMinClasses int    `evar:"password_min_classes"`  // Of lowercase, uppercase, digits and symbols (0-4)
+	PasswordMaxAgeDays int    `evar:"password_max_age_days"` // Days before a password must be changed at login (0 = never)
+	MFAIssuer          string `evar:"mfa_issuer"`            // Name authenticator apps show for TOTP enrollments
+	// Default per-user quotas (0 = unlimited); roles and users may override them
+	QuotasFile                string `evar:"quotas_file"`                 // Role and user quota limits file (under data path)
+	QuotaFileBytes            int    `evar:"quota_file_bytes"`            // Bytes stored in the user's sandbox
+	QuotaExecutionsPerHour    int    `evar:"quota_executions_per_hour"`   // Executions started in the last hour
+	QuotaConcurrentExecutions int    `evar:"quota_concurrent_executions"` // Executions running at once
+	QuotaListeners            int    `evar:"quota_listeners"`             // Listeners created by the user
+	// Execution queue: interactive runs go before scheduled ones, and those before backfills
+	ExecutionWorkers int `evar:"execution_workers"`  // Executions run at once on a replica (0 = no limit, no queue)
+	ExecutionMaxWait int `evar:"execution_max_wait"` // Seconds a queued execution waits before it goes ahead of more urgent ones (0 = never)
+	// Execution traces recorded by listeners
+	TraceRetention int `evar:"trace_retention"` // Listener traces kept (0 = all)
+	// Idempotency-Key handling on execute and listener requests
+	IdempotencyWindow int `evar:"idempotency_window"` // Minutes a response is replayed for a repeated key
+	// Agent event history
+	AgentEventHistory int `evar:"agent_event_history"` // Events kept per agent
+	// Agent federation between backends
+	FederationPeers string `evar:"federation_peers"` // name=url,... of the peers whose agents are reached as name/agent
+	FederationToken string `evar:"federation_token"` // Shared secret peers present on /federation requests
+	// Shared state for running several replicas behind a load balancer
+	StateStore      string `evar:"state_store"`      // memory (single replica) | couchbase (uses the couchbase_* settings)
+	StorageProvider string `evar:"storage_provider"` // filesystem (single replica) | couchbase: where files, diagrams and libraries are kept
+	StorageKeys     string `evar:"storage_keys"`     // id=key,... AES keys files, diagrams and libraries are encrypted with at rest, the first for new writes; a key is base64 or secret:name ("" = not encrypted)
+	PubSub          string `evar:"pubsub"`           // local (single replica) | redis
+	RedisURL        string `evar:"redis_url"`        // redis://[user:password@]host:port for pubsub=redis
+	LeaderLease     int    `evar:"leader_lease"`     // Seconds a replica leads a singleton role (auto-started listeners) without renewing it
+	ConfigFile      string `evar:"config_file"`      // KEY=value file or ConfigMap directory overriding these settings, reloaded when it changes
 }
 
 var ChariotConfig = &Config{}
@@ -184,6 +264,7 @@ func ExpandAndNormalizePaths() {
 	ChariotConfig.TreePath = expandUserPath(ChariotConfig.TreePath)
 	ChariotConfig.DiagramPath = expandUserPath(ChariotConfig.DiagramPath)
 	ChariotConfig.CertPath = expandUserPath(ChariotConfig.CertPath)
+	ChariotConfig.PluginsDir = expandUserPath(ChariotConfig.PluginsDir)
 
 	// Clean and, if relative, make absolute relative to current working directory
 	normalize := func(p string) string {
@@ -203,6 +284,7 @@ func ExpandAndNormalizePaths() {
 	ChariotConfig.TreePath = normalize(ChariotConfig.TreePath)
 	ChariotConfig.DiagramPath = normalize(ChariotConfig.DiagramPath)
 	ChariotConfig.CertPath = normalize(ChariotConfig.CertPath)
+	ChariotConfig.PluginsDir = normalize(ChariotConfig.PluginsDir)
 
 	// Default sandbox root to DataPath/sandboxes if not explicitly configured
 	if strings.TrimSpace(ChariotConfig.SandboxRoot) == "" && ChariotConfig.DataPath != "" {
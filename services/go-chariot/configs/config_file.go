@@ -0,0 +1,131 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A config file sets the same settings as the CHARIOT_* environment
+// variables and overrides them. It is either a file of KEY=value lines, or a
+// directory holding one file per setting named after it, which is how
+// Kubernetes mounts a ConfigMap. Keys may be given as trace_retention or
+// CHARIOT_TRACE_RETENTION.
+
+// readConfigFile returns the settings in path by evar name.
+func readConfigFile(path string) (map[string]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			// Skip the ..data links and timestamped directories of a ConfigMap mount
+			if strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			full := filepath.Join(path, e.Name())
+			if st, err := os.Stat(full); err != nil || st.IsDir() {
+				continue
+			}
+			data, err := os.ReadFile(full)
+			if err != nil {
+				return nil, err
+			}
+			values[configKey(e.Name())] = strings.TrimSpace(string(data))
+		}
+		return values, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", path, n)
+		}
+		values[configKey(key)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return values, scanner.Err()
+}
+
+func configKey(key string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(key)), strings.ToLower(Prefix))
+}
+
+// ApplyFile sets the settings found in the config file or directory at path
+// and returns the names of those whose value changed and of keys that are
+// not settings. Nothing is changed when a value does not parse.
+func (c *Config) ApplyFile(path string) (changed, unknown []string, err error) {
+	values, err := readConfigFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	fields := map[string]reflect.Value{}
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if tag := v.Type().Field(i).Tag.Get("evar"); tag != "" {
+			fields[tag] = v.Field(i)
+		}
+	}
+	parsed := map[string]interface{}{}
+	for key, s := range values {
+		field, ok := fields[key]
+		if !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+		var val interface{}
+		switch field.Kind() {
+		case reflect.String:
+			val = s
+		case reflect.Int:
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %q is not an integer", key, s)
+			}
+			val = n
+		case reflect.Bool:
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %q is not a boolean", key, s)
+			}
+			val = b
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %q is not a number", key, s)
+			}
+			val = f
+		default:
+			continue
+		}
+		if field.Interface() != val {
+			parsed[key] = val
+		}
+	}
+	for key, val := range parsed {
+		fields[key].Set(reflect.ValueOf(val))
+		changed = append(changed, key)
+	}
+	sort.Strings(changed)
+	sort.Strings(unknown)
+	return changed, unknown, nil
+}
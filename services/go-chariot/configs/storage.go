@@ -22,9 +22,10 @@ const (
 type StorageKind string
 
 const (
-	StorageKindData    StorageKind = "data"
-	StorageKindTree    StorageKind = "tree"
-	StorageKindDiagram StorageKind = "diagram"
+	StorageKindData     StorageKind = "data"
+	StorageKindTree     StorageKind = "tree"
+	StorageKindDiagram  StorageKind = "diagram"
+	StorageKindNotebook StorageKind = "notebook"
 )
 
 // ParseStorageScope parses a caller-provided scope string without applying defaults.
@@ -127,8 +128,17 @@ func sandboxPath(key, subdir string) (string, error) {
 	if key == "" {
 		return "", errors.New("sandbox scope requires authenticated username")
 	}
+	root, err := SandboxesPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, key, subdir), nil
+}
+
+// SandboxesPath returns the directory holding a directory per user sandbox.
+func SandboxesPath() (string, error) {
 	if ChariotConfig.SandboxRoot != "" && filepath.IsAbs(ChariotConfig.SandboxRoot) {
-		return filepath.Join(ChariotConfig.SandboxRoot, key, subdir), nil
+		return ChariotConfig.SandboxRoot, nil
 	}
 	if ChariotConfig.DataPath == "" {
 		return "", errors.New("data path not configured")
@@ -137,7 +147,7 @@ func sandboxPath(key, subdir string) (string, error) {
 	if ChariotConfig.SandboxRoot != "" && ChariotConfig.SandboxRoot != "data/sandboxes" {
 		sandboxBase = ChariotConfig.SandboxRoot
 	}
-	return filepath.Join(ChariotConfig.DataPath, sandboxBase, key, subdir), nil
+	return filepath.Join(ChariotConfig.DataPath, sandboxBase), nil
 }
 
 func globalKindPath(kind StorageKind) (string, error) {
@@ -157,6 +167,11 @@ func globalKindPath(kind StorageKind) (string, error) {
 			return "", errors.New("diagram path not configured")
 		}
 		return ChariotConfig.DiagramPath, nil
+	case StorageKindNotebook:
+		if ChariotConfig.DataPath == "" {
+			return "", errors.New("data path not configured")
+		}
+		return filepath.Join(ChariotConfig.DataPath, "notebooks"), nil
 	default:
 		return "", fmt.Errorf("unsupported storage kind '%s'", kind)
 	}
@@ -170,6 +185,8 @@ func sandboxKindSegment(kind StorageKind) string {
 		return "trees"
 	case StorageKindDiagram:
 		return "diagrams"
+	case StorageKindNotebook:
+		return "notebooks"
 	default:
 		return string(kind)
 	}
@@ -201,7 +218,7 @@ func EnsureSandboxDirectories(username string) error {
 	)
 
 	// Create all kind-specific directories using DataPath (same logic as storageBasePath)
-	kinds := []StorageKind{StorageKindData, StorageKindTree, StorageKindDiagram}
+	kinds := []StorageKind{StorageKindData, StorageKindTree, StorageKindDiagram, StorageKindNotebook}
 	for _, kind := range kinds {
 		path, err := sandboxPath(key, sandboxKindSegment(kind))
 		if err != nil {
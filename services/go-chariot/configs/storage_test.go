@@ -118,7 +118,7 @@ func TestEnsureSandboxDirectories(t *testing.T) {
 
 	// Verify all directories were created
 	key := SanitizeSandboxKey(username)
-	for _, subdir := range []string{"data", "trees", "diagrams"} {
+	for _, subdir := range []string{"data", "trees", "diagrams", "notebooks"} {
 		path := filepath.Join(ChariotConfig.SandboxRoot, key, subdir)
 		if info, err := os.Stat(path); err != nil || !info.IsDir() {
 			t.Errorf("Expected directory %s was not created: %v", path, err)
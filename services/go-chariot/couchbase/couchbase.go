@@ -0,0 +1,47 @@
+// Package couchbase opens the bucket connections shared by the packages that
+// keep server state in Couchbase, so they connect and pick their collection
+// the same way.
+package couchbase
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+)
+
+// Options locates a bucket. Documents go to the _default collection of Scope
+// (or of the default scope).
+type Options struct {
+	URL       string
+	User      string
+	Password  string
+	Bucket    string
+	Scope     string
+	KVTimeout time.Duration // Of each key-value operation
+}
+
+// Open connects to the cluster, waits for the bucket to be ready and returns
+// the collection documents go to. The caller closes the cluster.
+func Open(opts Options) (*gocb.Cluster, *gocb.Collection, error) {
+	cluster, err := gocb.Connect(opts.URL, gocb.ClusterOptions{
+		Authenticator: gocb.PasswordAuthenticator{Username: opts.User, Password: opts.Password},
+		TimeoutsConfig: gocb.TimeoutsConfig{
+			ConnectTimeout: 30 * time.Second,
+			KVTimeout:      opts.KVTimeout,
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	bucket := cluster.Bucket(opts.Bucket)
+	if err := bucket.WaitUntilReady(30*time.Second, nil); err != nil {
+		cluster.Close(nil)
+		return nil, nil, fmt.Errorf("bucket %s: %w", opts.Bucket, err)
+	}
+	collection := bucket.DefaultCollection()
+	if opts.Scope != "" && opts.Scope != "_default" {
+		collection = bucket.Scope(opts.Scope).Collection("_default")
+	}
+	return cluster, collection, nil
+}
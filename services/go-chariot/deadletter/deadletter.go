@@ -0,0 +1,229 @@
+// Package deadletter keeps the invocations that failed for good, so
+// event-driven pipelines do not lose messages silently: the payload posted
+// to a listener whose script failed, or a webhook event whose deliveries
+// gave up. Each letter records the payload, the last error and how many
+// attempts were made. Letters can be listed, retried and purged; a retry
+// that fails again counts its attempts on the same letter.
+//
+// Letters are persisted to a JSON file. The store holds at most Max
+// letters; past that the oldest are dropped.
+package deadletter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sources of dead letters
+const (
+	SourceListener = "listener" // a payload posted to a listener's invoke endpoint
+	SourceWebhook  = "webhook"  // an event delivered to a webhook subscription
+)
+
+const defaultMax = 10000
+
+// ErrNotFound is returned for an unknown letter ID.
+var ErrNotFound = errors.New("dead letter not found")
+
+// Letter is a failed invocation.
+type Letter struct {
+	ID          string          `json:"id"`
+	Source      string          `json:"source"`
+	Target      string          `json:"target"`          // listener name, or webhook subscription ID
+	Event       string          `json:"event,omitempty"` // webhook event type
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Error       string          `json:"error"`
+	Attempts    int             `json:"attempts"`
+	Owner       string          `json:"owner,omitempty"` // user who sent the payload
+	FirstFailed time.Time       `json:"first_failed"`
+	LastFailed  time.Time       `json:"last_failed"`
+}
+
+// Filter selects letters; zero fields match everything.
+type Filter struct {
+	Source string
+	Target string
+	Before time.Time // letters that last failed before this time
+}
+
+func (f Filter) matches(l *Letter) bool {
+	return (f.Source == "" || l.Source == f.Source) &&
+		(f.Target == "" || l.Target == f.Target) &&
+		(f.Before.IsZero() || l.LastFailed.Before(f.Before))
+}
+
+// Counts sums up the store for the dashboard.
+type Counts struct {
+	Total    int            `json:"total"`
+	BySource map[string]int `json:"by_source"`
+	Dropped  int64          `json:"dropped"` // letters dropped to stay within the limit since the server started
+}
+
+// Options configures a Store. Zero values select the defaults.
+type Options struct {
+	File string // JSON file letters are persisted to; "" keeps them in memory
+	Max  int    // letters kept (default 10000)
+}
+
+// Store holds the dead letters.
+type Store struct {
+	opts    Options
+	mu      sync.Mutex
+	letters []*Letter // oldest first
+	dropped int64
+}
+
+// Open loads the letters in opts.File, if it exists.
+func Open(opts Options) (*Store, error) {
+	if opts.Max <= 0 {
+		opts.Max = defaultMax
+	}
+	s := &Store{opts: opts}
+	if opts.File == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(opts.File)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.letters); err != nil {
+		return nil, fmt.Errorf("%s: %w", opts.File, err)
+	}
+	return s, nil
+}
+
+func (s *Store) saveLocked() error {
+	if s.opts.File == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.letters, "", "  ")
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(filepath.Dir(s.opts.File), 0o755)
+	// Payloads may carry personal data
+	return os.WriteFile(s.opts.File, data, 0o600)
+}
+
+// Add stores a failed invocation and returns it with its ID. The letter is
+// kept even when it cannot be persisted; the error says why.
+func (s *Store) Add(l Letter) (Letter, error) {
+	now := time.Now().UTC()
+	l.ID = uuid.New().String()
+	l.FirstFailed, l.LastFailed = now, now
+	if l.Attempts <= 0 {
+		l.Attempts = 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.letters = append(s.letters, &l)
+	if over := len(s.letters) - s.opts.Max; over > 0 {
+		s.letters = append(s.letters[:0], s.letters[over:]...)
+		s.dropped += int64(over)
+	}
+	return l, s.saveLocked()
+}
+
+// Failed records that a retry of a letter failed again after attempts
+// further attempts.
+func (s *Store) Failed(id string, attempts int, reason string) (Letter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.findLocked(id)
+	if l == nil {
+		return Letter{}, ErrNotFound
+	}
+	l.Attempts += attempts
+	l.Error = reason
+	l.LastFailed = time.Now().UTC()
+	return *l, s.saveLocked()
+}
+
+// Get returns one letter.
+func (s *Store) Get(id string) (Letter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l := s.findLocked(id); l != nil {
+		return *l, nil
+	}
+	return Letter{}, ErrNotFound
+}
+
+func (s *Store) findLocked(id string) *Letter {
+	for _, l := range s.letters {
+		if l.ID == id {
+			return l
+		}
+	}
+	return nil
+}
+
+// List returns up to limit letters matching f, newest first; limit <= 0
+// returns all of them.
+func (s *Store) List(f Filter, limit int) []Letter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Letter{}
+	for i := len(s.letters) - 1; i >= 0 && (limit <= 0 || len(out) < limit); i-- {
+		if f.matches(s.letters[i]) {
+			out = append(out, *s.letters[i])
+		}
+	}
+	return out
+}
+
+// Remove deletes one letter, once it was retried successfully or is no
+// longer wanted.
+func (s *Store) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, l := range s.letters {
+		if l.ID == id {
+			s.letters = append(s.letters[:i], s.letters[i+1:]...)
+			return s.saveLocked()
+		}
+	}
+	return ErrNotFound
+}
+
+// Purge deletes the letters matching f and returns how many there were.
+func (s *Store) Purge(f Filter) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.letters[:0]
+	for _, l := range s.letters {
+		if !f.matches(l) {
+			kept = append(kept, l)
+		}
+	}
+	purged := len(s.letters) - len(kept)
+	for i := len(kept); i < len(s.letters); i++ {
+		s.letters[i] = nil
+	}
+	s.letters = kept
+	if purged == 0 {
+		return 0, nil
+	}
+	return purged, s.saveLocked()
+}
+
+// Counts returns how many letters the store holds, by source.
+func (s *Store) Counts() Counts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := Counts{Total: len(s.letters), BySource: map[string]int{}, Dropped: s.dropped}
+	for _, l := range s.letters {
+		c.BySource[l.Source]++
+	}
+	return c
+}
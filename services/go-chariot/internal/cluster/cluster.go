@@ -0,0 +1,211 @@
+// Package cluster elects, among the replicas sharing a state store, the one
+// that runs each singleton subsystem, such as the auto-started listeners.
+//
+// A role is held through a lease in the state store that its leader renews
+// every third of the lease time. When the leader stops renewing, by exiting
+// or losing the store, another replica takes the role once the lease
+// expires. With the memory store there is one replica, which holds every
+// role.
+package cluster
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/statestore"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Roles of singleton subsystems.
+const (
+	RoleListeners = "listeners"
+)
+
+// DefaultLeaseTTL is how long a leader holds a role without renewing it.
+const DefaultLeaseTTL = 15 * time.Second
+
+var (
+	instanceOnce sync.Once
+	instanceID   string
+)
+
+// InstanceID names this replica: its hostname plus a random suffix so
+// restarts and containers sharing a hostname stay distinct.
+func InstanceID() string {
+	instanceOnce.Do(func() {
+		host, err := os.Hostname()
+		if err != nil || host == "" {
+			host = "chariot"
+		}
+		instanceID = host + "-" + uuid.New().String()[:8]
+	})
+	return instanceID
+}
+
+func leaseKey(role string) string { return "cluster-leader:" + role }
+
+type role struct {
+	leader  string
+	held    bool
+	renewed time.Time
+	elected func()
+	deposed func()
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Elector campaigns for roles on behalf of this replica. A nil elector
+// holds no roles.
+type Elector struct {
+	store    statestore.Store
+	instance string
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	roles map[string]*role
+}
+
+// NewElector returns an elector for instance leasing roles in store for ttl.
+func NewElector(store statestore.Store, instance string, ttl time.Duration) *Elector {
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+	return &Elector{store: store, instance: instance, ttl: ttl, roles: map[string]*role{}}
+}
+
+// Instance returns the replica the elector campaigns for.
+func (e *Elector) Instance() string { return e.instance }
+
+// Campaign tries to take name before returning and then every third of the
+// lease time. elected runs when this replica takes the role and deposed when
+// it loses it, one at a time.
+func (e *Elector) Campaign(name string, elected, deposed func()) {
+	r := &role{elected: elected, deposed: deposed, stop: make(chan struct{}), done: make(chan struct{})}
+	e.mu.Lock()
+	if _, ok := e.roles[name]; ok {
+		e.mu.Unlock()
+		return
+	}
+	e.roles[name] = r
+	e.mu.Unlock()
+	e.renew(name, r)
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.renew(name, r)
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// renew takes or renews the lease of a role and runs the role's callbacks
+// when this replica gains or loses it. A leader that cannot reach the store
+// steps down before its lease can expire, so two replicas never both lead.
+func (e *Elector) renew(name string, r *role) {
+	holder, err := e.store.Lease(leaseKey(name), e.instance, e.ttl)
+	now := time.Now()
+	e.mu.Lock()
+	wasHeld := r.held
+	switch {
+	case err != nil:
+		cfg.ChariotLogger.Warn("Cluster lease renewal failed", zap.String("role", name), zap.Error(err))
+		if r.held && now.Sub(r.renewed) > e.ttl*2/3 {
+			r.held, r.leader = false, ""
+		}
+	case holder == e.instance:
+		r.held, r.leader, r.renewed = true, holder, now
+	default:
+		r.held, r.leader = false, holder
+	}
+	held := r.held
+	e.mu.Unlock()
+
+	switch {
+	case held && !wasHeld:
+		cfg.ChariotLogger.Info("Elected cluster leader", zap.String("role", name), zap.String("instance", e.instance))
+		if r.elected != nil {
+			r.elected()
+		}
+	case !held && wasHeld:
+		cfg.ChariotLogger.Warn("Lost cluster leadership", zap.String("role", name), zap.String("instance", e.instance))
+		if r.deposed != nil {
+			r.deposed()
+		}
+	}
+}
+
+// IsLeader reports whether this replica holds the role.
+func (e *Elector) IsLeader(name string) bool {
+	if e == nil {
+		return false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	r, ok := e.roles[name]
+	return ok && r.held
+}
+
+// Roles lists the roles this replica holds, sorted.
+func (e *Elector) Roles() []string {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var out []string
+	for name, r := range e.roles {
+		if r.held {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Leaders maps each role campaigned for to the replica last seen holding
+// it; "" when none does.
+func (e *Elector) Leaders() map[string]string {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make(map[string]string, len(e.roles))
+	for name, r := range e.roles {
+		out[name] = r.leader
+	}
+	return out
+}
+
+// Resign stops campaigning, steps down from the roles held, running their
+// deposed callbacks, and releases their leases so another replica can take
+// them without waiting for them to expire.
+func (e *Elector) Resign() {
+	e.mu.Lock()
+	roles := e.roles
+	e.roles = map[string]*role{}
+	e.mu.Unlock()
+	for name, r := range roles {
+		close(r.stop)
+		<-r.done
+		if !r.held {
+			continue
+		}
+		if r.deposed != nil {
+			r.deposed()
+		}
+		if err := e.store.ReleaseLease(leaseKey(name), e.instance); err != nil {
+			cfg.ChariotLogger.Warn("Failed to release cluster lease", zap.String("role", name), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/statestore"
+	"github.com/labstack/echo/v4"
+)
+
+// Agent events are kept for agentEventTTL after an agent's last event, and a
+// query or WebSocket replay returns at most agentEventMaxLimit of them.
+const (
+	agentEventTTL          = 7 * 24 * time.Hour
+	agentEventDefaultLimit = 200
+	agentEventMaxLimit     = 1000
+	agentEventNamesKey     = "agent-events:names"
+)
+
+func agentEventsKey(agent string) string { return "agent-events:" + agent }
+
+// AgentEventRecord is an agent event as kept in the history. Seq numbers the
+// events of one agent, so a client can ask for those after the last it saw.
+type AgentEventRecord struct {
+	Seq int `json:"seq"`
+	chariot.AgentEvent
+	Replay bool `json:"replay,omitempty"` // sent from the history on WebSocket connect
+}
+
+// localAgentEvents keeps the history for Handlers built without a session
+// manager.
+var localAgentEvents = statestore.NewMemory()
+
+// agentEventNames holds the agents this replica has added to the names list.
+var agentEventNames sync.Map
+
+func (h *Handlers) agentEventStore() statestore.Store {
+	if h.sessionManager == nil {
+		return localAgentEvents
+	}
+	return h.sessionManager.Store()
+}
+
+func agentEventHistory() int {
+	if n := cfg.ChariotConfig.AgentEventHistory; n > 0 {
+		return n
+	}
+	return 1000
+}
+
+// RecordAgentEvent adds ev to its agent's history and returns it numbered.
+func (h *Handlers) RecordAgentEvent(ev chariot.AgentEvent) (AgentEventRecord, error) {
+	store := h.agentEventStore()
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return AgentEventRecord{}, err
+	}
+	seq, err := store.Append(agentEventsKey(ev.Agent), data, agentEventHistory(), agentEventTTL)
+	if err != nil {
+		return AgentEventRecord{}, err
+	}
+	if _, seen := agentEventNames.LoadOrStore(ev.Agent, true); !seen {
+		if _, err := store.Append(agentEventNamesKey, []byte(ev.Agent), agentEventMaxLimit, agentEventTTL); err != nil {
+			agentEventNames.Delete(ev.Agent)
+		}
+	}
+	return AgentEventRecord{Seq: seq, AgentEvent: ev}, nil
+}
+
+// agentEventQuery selects events from an agent's history. Since is a
+// sequence number, a time or a duration before now; events after it match.
+type agentEventQuery struct {
+	afterSeq  int
+	afterTime time.Time
+	types     map[string]bool
+	limit     int
+}
+
+func parseAgentEventQuery(c echo.Context) (agentEventQuery, error) {
+	q := agentEventQuery{afterSeq: -1, limit: agentEventDefaultLimit}
+	if since := c.QueryParam("since"); since != "" {
+		if n, err := strconv.Atoi(since); err == nil {
+			q.afterSeq = n
+		} else if t, err := time.Parse(time.RFC3339Nano, since); err == nil {
+			q.afterTime = t
+		} else if d, err := time.ParseDuration(since); err == nil && d > 0 {
+			q.afterTime = time.Now().Add(-d)
+		} else {
+			return q, fmt.Errorf("since must be a sequence number, an RFC 3339 time or a duration such as 12h")
+		}
+	}
+	if types := c.QueryParam("type"); types != "" {
+		q.types = map[string]bool{}
+		for _, t := range strings.Split(types, ",") {
+			q.types[strings.TrimSpace(t)] = true
+		}
+	}
+	if s := c.QueryParam("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return q, errors.New("limit must be a positive number")
+		}
+		q.limit = n
+	}
+	if q.limit > agentEventMaxLimit {
+		q.limit = agentEventMaxLimit
+	}
+	return q, nil
+}
+
+// agentEvents returns the events of agent matching q, oldest first, and
+// whether more matched than the limit allowed.
+func (h *Handlers) agentEvents(agent string, q agentEventQuery) ([]AgentEventRecord, bool, error) {
+	entries, next, err := h.agentEventStore().Range(agentEventsKey(agent), q.afterSeq+1)
+	if err != nil {
+		return nil, false, err
+	}
+	first := next - len(entries)
+	out := []AgentEventRecord{}
+	for i, data := range entries {
+		rec := AgentEventRecord{Seq: first + i}
+		if json.Unmarshal(data, &rec.AgentEvent) != nil {
+			continue
+		}
+		if !rec.Time.After(q.afterTime) || (q.types != nil && !q.types[rec.Type]) {
+			continue
+		}
+		if len(out) == q.limit {
+			return out, true, nil
+		}
+		out = append(out, rec)
+	}
+	return out, false, nil
+}
+
+// agentEventAgents lists the agents with a history.
+func (h *Handlers) agentEventAgents() ([]string, error) {
+	entries, _, err := h.agentEventStore().Range(agentEventNamesKey, 0)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var names []string
+	for _, e := range entries {
+		if name := string(e); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetAgentEvents returns an agent's recorded events, oldest first, so what it
+// did while nobody watched can be looked at later. The history survives
+// restarts when the state store is shared. Pass next as since to page on.
+//
+//	GET /api/agents/:name/events?since=&type=plan,step&limit=200
+func (h *Handlers) GetAgentEvents(c echo.Context) error {
+	name := c.Param("name")
+	q, err := parseAgentEventQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	events, more, err := h.agentEvents(name, q)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	next := q.afterSeq
+	if len(events) > 0 {
+		next = events[len(events)-1].Seq
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]any{
+		"agent":  name,
+		"events": events,
+		"next":   next,
+		"more":   more,
+	}})
+}
+
+// agentEventReplay returns the events a WebSocket client connecting with
+// ?since= missed: those of the agents named in ?agent= (all by default),
+// merged by time and limited to the latest ones.
+func (h *Handlers) agentEventReplay(c echo.Context) ([]AgentEventRecord, error) {
+	if c.QueryParam("since") == "" {
+		return nil, nil
+	}
+	q, err := parseAgentEventQuery(c)
+	if err != nil {
+		return nil, err
+	}
+	agents := strings.Split(c.QueryParam("agent"), ",")
+	if c.QueryParam("agent") == "" {
+		if agents, err = h.agentEventAgents(); err != nil {
+			return nil, err
+		}
+	}
+	limit := q.limit
+	q.limit = agentEventMaxLimit
+	var all []AgentEventRecord
+	for _, agent := range agents {
+		events, _, err := h.agentEvents(strings.TrimSpace(agent), q)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, events...)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Time.Before(all[j].Time) })
+	if len(all) > limit {
+		all = all[len(all)-limit:]
+	}
+	for i := range all {
+		all[i].Replay = true
+	}
+	return all, nil
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// How often the dashboard feed samples the server, matching the WebSocket
+// stream, and how long a long poll may wait for a change.
+const (
+	dashboardSampleInterval = 5 * time.Second
+	dashboardPollTimeout    = 25 * time.Second
+	dashboardPollMaxTimeout = 60 * time.Second
+)
+
+// DashboardDelta is the answer to a dashboard poll: the sections of
+// DashboardData (keyed by their JSON names) that changed since the cursor,
+// or all of them when Full is set because the cursor was unknown. Cursor is
+// passed to the next poll.
+type DashboardDelta struct {
+	Cursor   string                     `json:"cursor"`
+	Full     bool                       `json:"full,omitempty"`
+	Sections map[string]json.RawMessage `json:"sections"`
+}
+
+// DashboardFeed keeps the latest dashboard sections and the sequence number
+// at which each last changed, so pollers can be sent only what changed.
+type DashboardFeed struct {
+	mu       sync.Mutex
+	epoch    string // changes whenever sequence numbers restart
+	seq      int64
+	sections map[string]json.RawMessage
+	changed  map[string]int64
+	sampled  time.Time
+}
+
+// NewDashboardFeed returns an empty feed.
+func NewDashboardFeed() *DashboardFeed {
+	return &DashboardFeed{
+		epoch:    strconv.FormatInt(time.Now().UnixNano(), 36),
+		sections: map[string]json.RawMessage{},
+		changed:  map[string]int64{},
+	}
+}
+
+// Update records data as the current dashboard and returns the cursor
+// after it.
+func (f *DashboardFeed) Update(data DashboardData) (string, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &sections); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updateLocked(sections)
+	return f.cursorLocked(), nil
+}
+
+func (f *DashboardFeed) updateLocked(sections map[string]json.RawMessage) {
+	next := f.seq + 1
+	for name, value := range sections {
+		if old, ok := f.sections[name]; !ok || !bytes.Equal(old, value) {
+			f.sections[name] = value
+			f.changed[name] = next
+		}
+	}
+	for name := range f.sections {
+		if _, ok := sections[name]; !ok {
+			delete(f.sections, name)
+			f.changed[name] = next // reported as null
+		}
+	}
+	for _, s := range f.changed {
+		if s == next {
+			f.seq = next
+			return
+		}
+	}
+}
+
+func (f *DashboardFeed) cursorLocked() string {
+	return f.epoch + "." + strconv.FormatInt(f.seq, 10)
+}
+
+// Since returns the sections that changed after cursor; every section when
+// cursor is empty or from another feed.
+func (f *DashboardFeed) Since(cursor string) DashboardDelta {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delta := DashboardDelta{Cursor: f.cursorLocked(), Sections: map[string]json.RawMessage{}}
+	epoch, seqText, _ := strings.Cut(cursor, ".")
+	seq, err := strconv.ParseInt(seqText, 10, 64)
+	if epoch != f.epoch || err != nil || seq > f.seq {
+		delta.Full = true
+		seq = 0
+	}
+	for name, at := range f.changed {
+		if at > seq {
+			delta.Sections[name] = f.sections[name] // nil for a removed section
+		}
+	}
+	return delta
+}
+
+// sample refreshes the feed from the server unless it was sampled within
+// the sample interval.
+func (f *DashboardFeed) sample(collect func() DashboardData) {
+	f.mu.Lock()
+	fresh := time.Since(f.sampled) < dashboardSampleInterval
+	if !fresh {
+		f.sampled = time.Now() // other pollers wait for this sample instead of taking their own
+	}
+	f.mu.Unlock()
+	if !fresh {
+		_, _ = f.Update(collect())
+	}
+}
+
+// dashboardFeeds holds one feed per execution activity window.
+type dashboardFeeds struct {
+	mu    sync.Mutex
+	feeds map[time.Duration]*DashboardFeed
+}
+
+func (h *Handlers) dashboardFeed(window time.Duration) *DashboardFeed {
+	if h.dashFeeds == nil {
+		return NewDashboardFeed()
+	}
+	h.dashFeeds.mu.Lock()
+	defer h.dashFeeds.mu.Unlock()
+	f := h.dashFeeds.feeds[window]
+	if f == nil {
+		f = NewDashboardFeed()
+		h.dashFeeds.feeds[window] = f
+	}
+	return f
+}
+
+// HandleDashboardPoll long-polls the dashboard for networks that block
+// WebSockets and SSE. It answers with the sections that changed since cursor
+// as soon as there are any, or with none after timeout seconds (default 25,
+// at most 60). Without a cursor, or with one from a restarted or other
+// replica, every section is sent.
+//
+//	GET /api/dashboard/poll?cursor=&window=1h&timeout=25
+func (h *Handlers) HandleDashboardPoll(c echo.Context) error {
+	window, err := parseMetricsWindow(c.QueryParam("window"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	timeout := dashboardPollTimeout
+	if s := c.QueryParam("timeout"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "timeout must be a number of seconds"})
+		}
+		timeout = time.Duration(n) * time.Second
+		if timeout > dashboardPollMaxTimeout {
+			timeout = dashboardPollMaxTimeout
+		}
+	}
+	feed := h.dashboardFeed(window)
+	collect := func() DashboardData { return h.collectDashboardData(window) }
+	cursor := c.QueryParam("cursor")
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		feed.sample(collect)
+		if delta := feed.Since(cursor); len(delta.Sections) > 0 {
+			return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: delta})
+		}
+		select {
+		case <-tick.C:
+		case <-deadline.C:
+			return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: feed.Since(cursor)})
+		case <-c.Request().Context().Done():
+			return nil
+		}
+	}
+}
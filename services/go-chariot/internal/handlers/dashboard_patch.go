@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A full dashboard is sent every dashboardFullEvery updates of a delta
+// stream, so a client that misapplied a patch recovers within a minute.
+const dashboardFullEvery = 12
+
+// JSONPatchOp is one RFC 6902 operation.
+type JSONPatchOp struct {
+	Op    string      `json:"op"` // add | remove | replace
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"` // unused by remove
+}
+
+// DiffJSON returns the JSON Patch turning old into new, both decoded from
+// JSON. Objects are compared key by key and arrays index by index, with
+// elements added or removed at the end.
+func DiffJSON(old, new interface{}) []JSONPatchOp {
+	var ops []JSONPatchOp
+	diffJSON("", old, new, &ops)
+	return ops
+}
+
+func diffJSON(path string, old, new interface{}, ops *[]JSONPatchOp) {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		n, ok := new.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(o)+len(n))
+		for k := range o {
+			keys = append(keys, k)
+		}
+		for k := range n {
+			if _, ok := o[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := path + "/" + jsonPointerEscape(k)
+			ov, inOld := o[k]
+			nv, inNew := n[k]
+			switch {
+			case !inNew:
+				*ops = append(*ops, JSONPatchOp{Op: "remove", Path: p})
+			case !inOld:
+				*ops = append(*ops, JSONPatchOp{Op: "add", Path: p, Value: nv})
+			default:
+				diffJSON(p, ov, nv, ops)
+			}
+		}
+		return
+	case []interface{}:
+		n, ok := new.([]interface{})
+		if !ok {
+			break
+		}
+		common := len(o)
+		if len(n) < common {
+			common = len(n)
+		}
+		for i := 0; i < common; i++ {
+			diffJSON(path+"/"+strconv.Itoa(i), o[i], n[i], ops)
+		}
+		for i := len(o) - 1; i >= len(n); i-- {
+			*ops = append(*ops, JSONPatchOp{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+		}
+		for i := len(o); i < len(n); i++ {
+			*ops = append(*ops, JSONPatchOp{Op: "add", Path: path + "/" + strconv.Itoa(i), Value: n[i]})
+		}
+		return
+	}
+	if !reflect.DeepEqual(old, new) {
+		*ops = append(*ops, JSONPatchOp{Op: "replace", Path: path, Value: new})
+	}
+}
+
+func jsonPointerEscape(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+// dashboardStreamMessage is a message of a delta dashboard stream: the
+// whole dashboard, or the patch from the update numbered Base to Seq.
+type dashboardStreamMessage struct {
+	Result string          `json:"result"`
+	Type   string          `json:"type"` // full | delta
+	Seq    int64           `json:"seq"`
+	Base   int64           `json:"base,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Patch  []JSONPatchOp   `json:"patch,omitempty"`
+}
+
+// dashboardStream tracks what one delta stream client was last sent.
+type dashboardStream struct {
+	seq       int64
+	last      interface{}
+	sinceFull int
+}
+
+// next returns the message bringing the client up to data, or nil when
+// nothing changed. A full dashboard is sent when asked for, periodically,
+// and when the patch would not be smaller.
+func (s *dashboardStream) next(data DashboardData, full bool) ([]byte, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	s.sinceFull++
+	msg := dashboardStreamMessage{Result: "OK", Type: "full", Seq: s.seq + 1, Data: raw}
+	if !full && s.last != nil && s.sinceFull < dashboardFullEvery {
+		ops := DiffJSON(s.last, doc)
+		if len(ops) == 0 {
+			return nil, nil
+		}
+		patch, err := json.Marshal(ops)
+		if err == nil && len(patch) < len(raw) {
+			msg = dashboardStreamMessage{Result: "OK", Type: "delta", Seq: s.seq + 1, Base: s.seq, Patch: ops}
+		}
+	}
+	if msg.Type == "full" {
+		s.sinceFull = 0
+	}
+	s.seq++
+	s.last = doc
+	return json.Marshal(msg)
+}
@@ -1,22 +1,46 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/pubsub"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/statestore"
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 )
 
-// ExecutionManager manages all active and recent script executions
+const (
+	maxExecutionLogs    = 1000
+	executionRunningTTL = time.Hour       // drops records of executions whose replica went away
+	executionDoneTTL    = 5 * time.Minute // matches cleanupLoop
+)
+
+// ExecutionManager manages all active and recent script executions. When the
+// state store is shared, execution records and logs are mirrored to it so any
+// replica can answer /api/result and /api/logs for an execution; with a shared
+// bus as well, log entries are also published as they are written.
 type ExecutionManager struct {
 	contexts sync.Map // map[string]*ExecutionContext
+	store    statestore.Store
+	bus      pubsub.Bus
 	mu       sync.RWMutex
 }
 
-// NewExecutionManager creates a new execution manager
-func NewExecutionManager() *ExecutionManager {
+// NewExecutionManager creates a new execution manager. store and bus may be
+// nil for a single replica.
+func NewExecutionManager(store statestore.Store, bus pubsub.Bus) *ExecutionManager {
 	mgr := &ExecutionManager{}
+	if store != nil && store.Shared() {
+		mgr.store = store
+		if bus != nil && bus.Shared() {
+			mgr.bus = bus
+		}
+	}
 	// Start cleanup goroutine to remove old executions
 	go mgr.cleanupLoop()
 	return mgr
@@ -29,14 +53,90 @@ func (m *ExecutionManager) Create(userID, program string) *ExecutionContext {
 		UserID:    userID,
 		Program:   program,
 		StartedAt: time.Now(),
-		LogBuffer: NewLogBuffer(1000), // Max 1000 log entries
+		LogBuffer: NewLogBuffer(maxExecutionLogs),
 		Done:      false,
 		doneChan:  make(chan struct{}),
+		store:     m.store,
+		bus:       m.bus,
+	}
+	if m.store != nil {
+		ctx.LogBuffer.store = m.store
+		ctx.LogBuffer.bus = m.bus
+		ctx.LogBuffer.execID = ctx.ID
 	}
 	m.contexts.Store(ctx.ID, ctx)
+	ctx.save()
 	return ctx
 }
 
+// executionRecord is the replica-independent view of an execution.
+type executionRecord struct {
+	ID          string                  `json:"id"`
+	UserID      string                  `json:"user_id"`
+	Filename    string                  `json:"filename"`
+	StartedAt   time.Time               `json:"started_at"`
+	CompletedAt time.Time               `json:"completed_at"`
+	Done        bool                    `json:"done"`
+	Result      interface{}             `json:"result,omitempty"`
+	Error       string                  `json:"error,omitempty"`
+	ErrorInfo   *chariot.ErrorInfo      `json:"error_info,omitempty"`
+	Watches     []WatchResult           `json:"watches,omitempty"`
+	Artifacts   []artifactRef           `json:"artifacts,omitempty"`
+	Trace       string                  `json:"trace,omitempty"`
+	Planned     *chariot.DryRunReport   `json:"planned,omitempty"`
+	Truncated   *resultTruncation       `json:"truncated,omitempty"`
+	ResultType  *resultType             `json:"result_type,omitempty"`
+	Tags        map[string]string       `json:"tags,omitempty"`
+	Usage       *chariot.ExecutionUsage `json:"usage,omitempty"`
+}
+
+// logEvent is published on an execution's topic: a log entry with its
+// sequence in the stored log, or the completion marker.
+type logEvent struct {
+	Seq   int             `json:"seq"`
+	Entry json.RawMessage `json:"entry,omitempty"`
+	Done  bool            `json:"done,omitempty"`
+}
+
+func executionKey(execID string) string     { return "exec:" + execID }
+func executionLogsKey(execID string) string { return "exec:" + execID + ":logs" }
+func executionTopic(execID string) string   { return "exec:" + execID }
+
+// Bus returns the shared bus log events are published on, or nil.
+func (m *ExecutionManager) Bus() pubsub.Bus { return m.bus }
+
+// Lookup returns the record of an execution running or recently finished on
+// any replica.
+func (m *ExecutionManager) Lookup(execID string) (*executionRecord, bool) {
+	if ctx := m.Get(execID); ctx != nil {
+		return ctx.record(), true
+	}
+	if m.store == nil {
+		return nil, false
+	}
+	data, err := m.store.Get(executionKey(execID))
+	if err != nil {
+		if !errors.Is(err, statestore.ErrNotFound) {
+			cfg.ChariotLogger.Warn("Failed to load execution record", zap.String("exec_id", execID), zap.Error(err))
+		}
+		return nil, false
+	}
+	var rec executionRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, false
+	}
+	return &rec, true
+}
+
+// StoredLogs returns the log entries, as JSON, another replica recorded for
+// an execution from sequence from on, and the sequence to continue from.
+func (m *ExecutionManager) StoredLogs(execID string, from int) ([][]byte, int, error) {
+	if m.store == nil {
+		return nil, from, nil
+	}
+	return m.store.Range(executionLogsKey(execID), from)
+}
+
 // Get retrieves an execution context by ID
 func (m *ExecutionManager) Get(execID string) *ExecutionContext {
 	val, ok := m.contexts.Load(execID)
@@ -79,6 +179,8 @@ type ExecutionContext struct {
 	ID          string
 	UserID      string
 	Program     string
+	Filename    string
+	SourceMap   *chariot.DiagramSourceMap // Maps error lines back to diagram nodes, if generated
 	StartedAt   time.Time
 	CompletedAt time.Time
 
@@ -86,23 +188,145 @@ type ExecutionContext struct {
 	Result    interface{}
 	Error     error
 	Done      bool
-	doneChan  chan struct{}
+	Watches   []WatchResult // watch expressions evaluated after the run
+	// Files the run handed back with its result
+	Artifacts  []artifactRef
+	Trace      string                  // execution trace recorded for the run, if any
+	Planned    *chariot.DryRunReport   // writes skipped by a dry run
+	Truncated  *resultTruncation       // what was cut from a result over the size limit
+	ResultType *resultType             // kind of result the script declared
+	Tags       map[string]string       // team, project, ticket... the run's usage is attributed to
+	Usage      *chariot.ExecutionUsage // external calls and rows of the run
+	doneChan   chan struct{}
+
+	store statestore.Store // shared store the record is mirrored to, if any
+	bus   pubsub.Bus       // shared bus completion is announced on, if any
+	mu    sync.RWMutex
+}
 
-	mu sync.RWMutex
+// record snapshots the execution; errors are located through the source map.
+func (ctx *ExecutionContext) record() *executionRecord {
+	ctx.mu.RLock()
+	defer ctx.mu.RUnlock()
+	rec := &executionRecord{
+		ID:          ctx.ID,
+		UserID:      ctx.UserID,
+		Filename:    ctx.Filename,
+		StartedAt:   ctx.StartedAt,
+		CompletedAt: ctx.CompletedAt,
+		Done:        ctx.Done,
+		Result:      ctx.Result,
+		Watches:     ctx.Watches,
+		Artifacts:   ctx.Artifacts,
+		Trace:       ctx.Trace,
+		Planned:     ctx.Planned,
+		Truncated:   ctx.Truncated,
+		ResultType:  ctx.ResultType,
+		Tags:        ctx.Tags,
+		Usage:       ctx.Usage,
+	}
+	if ctx.Error != nil {
+		rec.Error = ctx.Error.Error()
+		rec.ErrorInfo = chariot.DescribeError(ctx.Error)
+		rec.ErrorInfo.ApplySourceMap(ctx.SourceMap, ctx.Filename)
+	}
+	return rec
+}
+
+// save mirrors the execution record to the shared store.
+func (ctx *ExecutionContext) save() {
+	if ctx.store == nil {
+		return
+	}
+	rec := ctx.record()
+	ttl := executionRunningTTL
+	if rec.Done {
+		ttl = executionDoneTTL
+	}
+	data, err := json.Marshal(rec)
+	if err == nil {
+		err = ctx.store.Put(executionKey(rec.ID), data, ttl)
+	}
+	if err != nil {
+		cfg.ChariotLogger.Warn("Failed to store execution record", zap.String("exec_id", rec.ID), zap.Error(err))
+	}
 }
 
 // MarkDone marks the execution as complete
 func (ctx *ExecutionContext) MarkDone(result interface{}, err error) {
 	ctx.mu.Lock()
-	defer ctx.mu.Unlock()
-
 	ctx.Result = result
 	ctx.Error = err
 	ctx.Done = true
 	ctx.CompletedAt = time.Now()
+	ctx.mu.Unlock()
+
+	ctx.save()
+	if ctx.bus != nil {
+		done, _ := json.Marshal(logEvent{Done: true})
+		_ = ctx.bus.Publish(executionTopic(ctx.ID), done)
+	}
 	close(ctx.doneChan)
 }
 
+// SetWatches records the watch results of the run; call before MarkDone.
+func (ctx *ExecutionContext) SetWatches(watches []WatchResult) {
+	ctx.mu.Lock()
+	ctx.Watches = watches
+	ctx.mu.Unlock()
+}
+
+// SetArtifacts records the artifacts the run produced; call before MarkDone.
+func (ctx *ExecutionContext) SetArtifacts(artifacts []artifactRef) {
+	ctx.mu.Lock()
+	ctx.Artifacts = artifacts
+	ctx.mu.Unlock()
+}
+
+// SetTrace records the name of the execution trace saved for the run.
+func (ctx *ExecutionContext) SetTrace(trace string) {
+	ctx.mu.Lock()
+	ctx.Trace = trace
+	ctx.mu.Unlock()
+}
+
+// SetPlanned records the writes a dry run skipped; call before MarkDone.
+func (ctx *ExecutionContext) SetPlanned(planned *chariot.DryRunReport) {
+	ctx.mu.Lock()
+	ctx.Planned = planned
+	ctx.mu.Unlock()
+}
+
+// SetTruncated records what was cut from the result; call before MarkDone.
+func (ctx *ExecutionContext) SetTruncated(truncated *resultTruncation) {
+	ctx.mu.Lock()
+	ctx.Truncated = truncated
+	ctx.mu.Unlock()
+}
+
+// SetResultType records the kind of result the script declared; call
+// before MarkDone.
+func (ctx *ExecutionContext) SetResultType(t *resultType) {
+	ctx.mu.Lock()
+	ctx.ResultType = t
+	ctx.mu.Unlock()
+}
+
+// SetStarted records when the run left the execution queue.
+func (ctx *ExecutionContext) SetStarted(at time.Time) {
+	ctx.mu.Lock()
+	ctx.StartedAt = at
+	ctx.mu.Unlock()
+}
+
+// SetUsage records the external calls and rows of the run; call before
+// MarkDone.
+func (ctx *ExecutionContext) SetUsage(usage *chariot.ExecutionUsage) {
+	ctx.mu.Lock()
+	ctx.Usage = usage
+	ctx.mu.Unlock()
+}
+
 // IsDone returns whether the execution is complete
 func (ctx *ExecutionContext) IsDone() bool {
 	ctx.mu.RLock()
@@ -122,41 +346,78 @@ func (ctx *ExecutionContext) GetResult() (interface{}, error) {
 	return ctx.Result, ctx.Error
 }
 
-// LogBuffer is a thread-safe circular buffer for log entries
+// LogBuffer is a thread-safe circular buffer for log entries. Each entry has
+// a sequence number, counting from 0 for the execution's first entry, which
+// log streams send as the SSE event id so a client can resume after it.
 type LogBuffer struct {
 	entries     []chariot.LogEntry
+	first       int // Sequence number of entries[0]
 	maxSize     int
-	subscribers []chan chariot.LogEntry
+	minLevel    string // Entries below this level are dropped; "" keeps all
+	subscribers []chan SequencedLog
+	store       statestore.Store // shared store entries are mirrored to, if any
+	bus         pubsub.Bus       // shared bus entries are published on, if any
+	execID      string
 	mu          sync.RWMutex
 }
 
+// SequencedLog is a log entry with its sequence number.
+type SequencedLog struct {
+	Seq   int
+	Entry chariot.LogEntry
+}
+
 // NewLogBuffer creates a new log buffer
 func NewLogBuffer(maxSize int) *LogBuffer {
 	return &LogBuffer{
 		entries:     make([]chariot.LogEntry, 0, maxSize),
 		maxSize:     maxSize,
-		subscribers: make([]chan chariot.LogEntry, 0),
+		subscribers: make([]chan SequencedLog, 0),
 	}
 }
 
+// SetLevel drops the entries appended from now on whose level is below
+// level (a name accepted by chariot.NormalizeLogLevel, "" keeping all).
+func (lb *LogBuffer) SetLevel(level string) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.minLevel = level
+}
+
 // Append adds a log entry and notifies subscribers
 func (lb *LogBuffer) Append(entry chariot.LogEntry) {
 	lb.mu.Lock()
 	defer lb.mu.Unlock()
 
+	if !chariot.LogLevelAtLeast(entry.Level, lb.minLevel) {
+		return
+	}
+
 	// Add to buffer (circular)
 	if len(lb.entries) >= lb.maxSize {
 		// Remove oldest entry
 		lb.entries = lb.entries[1:]
+		lb.first++
 	}
 	lb.entries = append(lb.entries, entry)
+	seq := lb.first + len(lb.entries) - 1
+	if lb.store != nil {
+		data := []byte(entry.JSON())
+		stored, err := lb.store.Append(executionLogsKey(lb.execID), data, lb.maxSize, executionRunningTTL)
+		if err != nil {
+			cfg.ChariotLogger.Debug("Failed to store log entry", zap.Error(err))
+		} else if lb.bus != nil {
+			ev, _ := json.Marshal(logEvent{Seq: stored, Entry: data})
+			_ = lb.bus.Publish(executionTopic(lb.execID), ev)
+		}
+	}
 
 	// Notify all subscribers (non-blocking)
 	for _, ch := range lb.subscribers {
 		select {
-		case ch <- entry:
+		case ch <- SequencedLog{Seq: seq, Entry: entry}:
 		default:
-			// Subscriber too slow, skip
+			// Subscriber too slow, skip; it catches up with Since
 		}
 	}
 }
@@ -172,18 +433,35 @@ func (lb *LogBuffer) GetAll() []chariot.LogEntry {
 	return result
 }
 
+// Since returns the buffered entries with sequence number >= from and how
+// many entries from on were dropped from the buffer before they could be.
+func (lb *LogBuffer) Since(from int) ([]SequencedLog, int) {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	missed := 0
+	if from < lb.first {
+		missed, from = lb.first-from, lb.first
+	}
+	var result []SequencedLog
+	for i := from - lb.first; i >= 0 && i < len(lb.entries); i++ {
+		result = append(result, SequencedLog{Seq: lb.first + i, Entry: lb.entries[i]})
+	}
+	return result, missed
+}
+
 // Subscribe creates a new subscriber channel for real-time log streaming
-func (lb *LogBuffer) Subscribe() chan chariot.LogEntry {
+func (lb *LogBuffer) Subscribe() chan SequencedLog {
 	lb.mu.Lock()
 	defer lb.mu.Unlock()
 
-	ch := make(chan chariot.LogEntry, 100) // Buffer to handle bursts
+	ch := make(chan SequencedLog, 100) // Buffer to handle bursts
 	lb.subscribers = append(lb.subscribers, ch)
 	return ch
 }
 
 // Unsubscribe removes a subscriber channel
-func (lb *LogBuffer) Unsubscribe(ch chan chariot.LogEntry) {
+func (lb *LogBuffer) Unsubscribe(ch chan SequencedLog) {
 	lb.mu.Lock()
 	defer lb.mu.Unlock()
 
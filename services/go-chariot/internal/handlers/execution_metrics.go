@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// executionStatsRetention is the longest window the dashboard offers.
+	executionStatsRetention = 24 * time.Hour
+	// maxExecutionSamples bounds the memory kept for busy replicas; older
+	// samples are dropped first.
+	maxExecutionSamples = 100000
+	// metricsBuckets is the number of points in a throughput series.
+	metricsBuckets    = 60
+	topFailingScripts = 5
+)
+
+// metricsWindows are the time windows the dashboard can select.
+var metricsWindows = map[string]time.Duration{
+	"15m": 15 * time.Minute,
+	"1h":  time.Hour,
+	"6h":  6 * time.Hour,
+	"24h": 24 * time.Hour,
+}
+
+const defaultMetricsWindow = "1h"
+
+// executionSample is one finished execution.
+type executionSample struct {
+	at       time.Time
+	duration time.Duration
+	filename string
+	err      string
+}
+
+// ExecutionStats keeps the executions this replica finished recently for
+// the dashboard's activity panels. A nil *ExecutionStats records nothing.
+type ExecutionStats struct {
+	mu      sync.Mutex
+	samples []executionSample // ordered by completion time
+}
+
+// NewExecutionStats returns an empty recorder.
+func NewExecutionStats() *ExecutionStats {
+	return &ExecutionStats{}
+}
+
+// ExecutionMetrics summarizes the executions of one time window.
+type ExecutionMetrics struct {
+	Window        string             `json:"window"`
+	From          time.Time          `json:"from"`
+	To            time.Time          `json:"to"`
+	Total         int                `json:"total"`
+	Succeeded     int                `json:"succeeded"`
+	Failed        int                `json:"failed"`
+	SuccessRate   float64            `json:"success_rate"` // 0..1; 0 without executions
+	ErrorRate     float64            `json:"error_rate"`
+	PerMinute     float64            `json:"per_minute"` // average over the window
+	P50Ms         float64            `json:"p50_ms"`
+	P95Ms         float64            `json:"p95_ms"`
+	BucketSeconds int                `json:"bucket_seconds"`
+	Series        []ThroughputBucket `json:"series"`
+	TopFailing    []FailingScript    `json:"top_failing"`
+}
+
+// ThroughputBucket counts the executions that finished in one slice of the
+// window.
+type ThroughputBucket struct {
+	Start     time.Time `json:"start"`
+	Succeeded int       `json:"succeeded"`
+	Failed    int       `json:"failed"`
+}
+
+// FailingScript is a script that failed in the window.
+type FailingScript struct {
+	Filename  string    `json:"filename"`
+	Failures  int       `json:"failures"`
+	Runs      int       `json:"runs"`
+	LastError string    `json:"last_error"`
+	LastAt    time.Time `json:"last_at"`
+}
+
+// Record adds a finished execution.
+func (s *ExecutionStats) Record(filename string, started, completed time.Time, errMsg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Concurrent executions may report slightly out of order
+	i := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].at.After(completed) })
+	s.samples = append(s.samples, executionSample{})
+	copy(s.samples[i+1:], s.samples[i:])
+	s.samples[i] = executionSample{at: completed, duration: completed.Sub(started), filename: filename, err: errMsg}
+	s.pruneLocked(s.samples[len(s.samples)-1].at)
+}
+
+// pruneLocked drops samples older than the retention, and the oldest ones
+// beyond maxExecutionSamples.
+func (s *ExecutionStats) pruneLocked(now time.Time) {
+	cutoff := now.Add(-executionStatsRetention)
+	drop := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].at.After(cutoff) })
+	if extra := len(s.samples) - drop - maxExecutionSamples; extra > 0 {
+		drop += extra
+	}
+	if drop > 0 {
+		s.samples = append(s.samples[:0], s.samples[drop:]...)
+	}
+}
+
+// Summary aggregates the executions that finished within window before now.
+func (s *ExecutionStats) Summary(window time.Duration, now time.Time) ExecutionMetrics {
+	from := now.Add(-window)
+	bucket := window / metricsBuckets
+	m := ExecutionMetrics{
+		Window:        formatWindow(window),
+		From:          from,
+		To:            now,
+		BucketSeconds: int(bucket / time.Second),
+		Series:        make([]ThroughputBucket, metricsBuckets),
+		TopFailing:    []FailingScript{},
+	}
+	for i := range m.Series {
+		m.Series[i].Start = from.Add(time.Duration(i) * bucket)
+	}
+	if s == nil {
+		return m
+	}
+
+	s.mu.Lock()
+	start := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].at.After(from) })
+	samples := append([]executionSample(nil), s.samples[start:]...)
+	s.mu.Unlock()
+
+	durations := make([]float64, 0, len(samples))
+	scripts := map[string]*FailingScript{}
+	for _, e := range samples {
+		if e.at.After(now) {
+			break
+		}
+		m.Total++
+		durations = append(durations, float64(e.duration)/float64(time.Millisecond))
+		i := int(e.at.Sub(from) / bucket)
+		if i >= metricsBuckets {
+			i = metricsBuckets - 1
+		}
+		f := scripts[e.filename]
+		if f == nil {
+			f = &FailingScript{Filename: e.filename}
+			scripts[e.filename] = f
+		}
+		f.Runs++
+		if e.err == "" {
+			m.Succeeded++
+			m.Series[i].Succeeded++
+			continue
+		}
+		m.Failed++
+		m.Series[i].Failed++
+		f.Failures++
+		f.LastError = e.err
+		f.LastAt = e.at
+	}
+	if m.Total > 0 {
+		m.SuccessRate = float64(m.Succeeded) / float64(m.Total)
+		m.ErrorRate = float64(m.Failed) / float64(m.Total)
+	}
+	m.PerMinute = float64(m.Total) / window.Minutes()
+	sort.Float64s(durations)
+	m.P50Ms = percentile(durations, 0.50)
+	m.P95Ms = percentile(durations, 0.95)
+
+	for _, f := range scripts {
+		if f.Failures > 0 {
+			m.TopFailing = append(m.TopFailing, *f)
+		}
+	}
+	sort.Slice(m.TopFailing, func(i, j int) bool {
+		a, b := m.TopFailing[i], m.TopFailing[j]
+		if a.Failures != b.Failures {
+			return a.Failures > b.Failures
+		}
+		return a.LastAt.After(b.LastAt)
+	})
+	if len(m.TopFailing) > topFailingScripts {
+		m.TopFailing = m.TopFailing[:topFailingScripts]
+	}
+	return m
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func formatWindow(d time.Duration) string {
+	for name, w := range metricsWindows {
+		if w == d {
+			return name
+		}
+	}
+	return d.String()
+}
+
+// parseMetricsWindow resolves a window name; "" selects the default.
+func parseMetricsWindow(name string) (time.Duration, error) {
+	if name == "" {
+		name = defaultMetricsWindow
+	}
+	w, ok := metricsWindows[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown window %q: use 15m, 1h, 6h or 24h", name)
+	}
+	return w, nil
+}
+
+// recordExecution adds a finished execution to the dashboard metrics, the
+// script file usage and the usage of its tags, and notifies the webhook
+// subscribers.
+func (h *Handlers) recordExecution(rec *executionRecord) {
+	h.execStats.Record(rec.Filename, rec.StartedAt, rec.CompletedAt, rec.Error)
+	h.tagUsage.Record(rec.Tags, rec.CompletedAt, rec.CompletedAt.Sub(rec.StartedAt), rec.Usage, rec.Error != "")
+	chariot.RecordFileUse(rec.Filename)
+	h.notifyExecution(rec)
+}
+
+// HandleDashboardMetrics returns the execution activity of this replica.
+// Query: window = 15m | 1h (default) | 6h | 24h
+func (h *Handlers) HandleDashboardMetrics(c echo.Context) error {
+	window, err := parseMetricsWindow(c.QueryParam("window"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: h.execStats.Summary(window, time.Now())})
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Execution priorities, most urgent first: runs from the editor, runs of
+// scheduled jobs and listeners, and backfills.
+const (
+	PriorityInteractive = "interactive"
+	PriorityScheduled   = "scheduled"
+	PriorityBackfill    = "backfill"
+)
+
+var executionPriorities = [...]string{PriorityInteractive, PriorityScheduled, PriorityBackfill}
+
+// maxWaitSamples bounds the queue waits kept per priority for the metrics.
+const maxWaitSamples = 1000
+
+// executionPriority resolves the priority a client asked for; "" is
+// interactive.
+func executionPriority(priority string) (string, error) {
+	if priority == "" {
+		return PriorityInteractive, nil
+	}
+	for _, p := range executionPriorities {
+		if p == priority {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown priority '%s': use interactive, scheduled or backfill", priority)
+}
+
+func priorityRank(priority string) int {
+	for i, p := range executionPriorities {
+		if p == priority {
+			return i
+		}
+	}
+	return 0
+}
+
+// ExecutionScheduler runs at most a number of executions at once; the others
+// wait in a queue per priority and are started most urgent first, in the
+// order they came. An execution that has waited longer than the maximum wait
+// goes ahead of more urgent ones, so a stream of editor runs cannot hold
+// back a backfill for good. Without a worker limit every execution starts at
+// once. A nil scheduler starts everything at once too.
+type ExecutionScheduler struct {
+	mu      sync.Mutex
+	workers int           // 0 = no limit
+	maxWait time.Duration // 0 = strict priority order
+	running [len(executionPriorities)]int
+	queues  [len(executionPriorities)][]*queuedExecution
+	stats   [len(executionPriorities)]priorityStats
+}
+
+type queuedExecution struct {
+	queuedAt time.Time
+	ready    chan struct{}
+}
+
+type priorityStats struct {
+	started   int64
+	promoted  int64
+	abandoned int64
+	waits     []float64 // Milliseconds, the latest maxWaitSamples
+}
+
+// NewExecutionScheduler creates a scheduler running at most workers
+// executions at once (0 for no limit).
+func NewExecutionScheduler(workers int, maxWait time.Duration) *ExecutionScheduler {
+	if workers < 0 {
+		workers = 0
+	}
+	return &ExecutionScheduler{workers: workers, maxWait: maxWait}
+}
+
+// Acquire waits until an execution of the priority may start and returns
+// the function to call once it has finished, and how long it waited. It
+// gives up when ctx is done.
+func (s *ExecutionScheduler) Acquire(ctx context.Context, priority string) (release func(), waited time.Duration, err error) {
+	if s == nil {
+		return func() {}, 0, nil
+	}
+	rank := priorityRank(priority)
+	s.mu.Lock()
+	if s.workers == 0 || (s.runningLocked() < s.workers && s.queuedLocked() == 0) {
+		s.startLocked(rank, 0, false)
+		s.mu.Unlock()
+		return s.releaser(rank), 0, nil
+	}
+	q := &queuedExecution{queuedAt: time.Now(), ready: make(chan struct{})}
+	s.queues[rank] = append(s.queues[rank], q)
+	s.mu.Unlock()
+
+	select {
+	case <-q.ready:
+		return s.releaser(rank), time.Since(q.queuedAt), nil
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-q.ready:
+		// Started just as it gave up: hand the worker on
+		s.running[rank]--
+		s.dispatchLocked()
+	default:
+		queue := s.queues[rank]
+		for i, other := range queue {
+			if other == q {
+				s.queues[rank] = append(queue[:i:i], queue[i+1:]...)
+				break
+			}
+		}
+		s.stats[rank].abandoned++
+	}
+	return nil, 0, ctx.Err()
+}
+
+func (s *ExecutionScheduler) releaser(rank int) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.running[rank]--
+			s.dispatchLocked()
+		})
+	}
+}
+
+func (s *ExecutionScheduler) runningLocked() int {
+	n := 0
+	for _, r := range s.running {
+		n += r
+	}
+	return n
+}
+
+func (s *ExecutionScheduler) queuedLocked() int {
+	n := 0
+	for _, queue := range s.queues {
+		n += len(queue)
+	}
+	return n
+}
+
+func (s *ExecutionScheduler) startLocked(rank int, wait time.Duration, promoted bool) {
+	s.running[rank]++
+	st := &s.stats[rank]
+	st.started++
+	if promoted {
+		st.promoted++
+	}
+	st.waits = append(st.waits, float64(wait.Microseconds())/1000)
+	if len(st.waits) > maxWaitSamples {
+		st.waits = st.waits[len(st.waits)-maxWaitSamples:]
+	}
+}
+
+// dispatchLocked starts queued executions while workers are free.
+func (s *ExecutionScheduler) dispatchLocked() {
+	now := time.Now()
+	for (s.workers == 0 || s.runningLocked() < s.workers) && s.queuedLocked() > 0 {
+		next, urgent := -1, -1
+		for rank, queue := range s.queues {
+			if len(queue) == 0 {
+				continue
+			}
+			if urgent < 0 {
+				urgent = rank
+			}
+			// The longest wait past the maximum goes first
+			if s.maxWait > 0 && now.Sub(queue[0].queuedAt) >= s.maxWait &&
+				(next < 0 || queue[0].queuedAt.Before(s.queues[next][0].queuedAt)) {
+				next = rank
+			}
+		}
+		if next < 0 {
+			next = urgent
+		}
+		q := s.queues[next][0]
+		s.queues[next] = s.queues[next][1:]
+		s.startLocked(next, now.Sub(q.queuedAt), next != urgent)
+		close(q.ready)
+	}
+}
+
+// PriorityMetrics describes the executions of one priority.
+type PriorityMetrics struct {
+	Priority     string  `json:"priority"`
+	Running      int     `json:"running"`
+	Queued       int     `json:"queued"`
+	Started      int64   `json:"started"`   // Since the replica started
+	Promoted     int64   `json:"promoted"`  // Started ahead of more urgent ones after waiting past the maximum wait
+	Abandoned    int64   `json:"abandoned"` // Given up while queued
+	WaitP50Ms    float64 `json:"wait_p50_ms"`
+	WaitP95Ms    float64 `json:"wait_p95_ms"`
+	MaxWaitMs    float64 `json:"max_wait_ms"`    // Of the latest executions started
+	OldestWaitMs float64 `json:"oldest_wait_ms"` // Of the execution queued longest
+}
+
+// ExecutionQueueStatus describes the execution queue of this replica.
+type ExecutionQueueStatus struct {
+	Workers        int               `json:"workers"` // 0 = no limit
+	Running        int               `json:"running"`
+	Queued         int               `json:"queued"`
+	MaxWaitSeconds float64           `json:"max_wait_seconds"`
+	Priorities     []PriorityMetrics `json:"priorities"`
+}
+
+// Status reports what runs and waits, by priority.
+func (s *ExecutionScheduler) Status() ExecutionQueueStatus {
+	st := ExecutionQueueStatus{Priorities: make([]PriorityMetrics, len(executionPriorities))}
+	for rank, p := range executionPriorities {
+		st.Priorities[rank].Priority = p
+	}
+	if s == nil {
+		return st
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st.Workers, st.MaxWaitSeconds = s.workers, s.maxWait.Seconds()
+	for rank := range executionPriorities {
+		m := &st.Priorities[rank]
+		ps := s.stats[rank]
+		m.Running, m.Queued = s.running[rank], len(s.queues[rank])
+		m.Started, m.Promoted, m.Abandoned = ps.started, ps.promoted, ps.abandoned
+		waits := append([]float64(nil), ps.waits...)
+		sort.Float64s(waits)
+		m.WaitP50Ms, m.WaitP95Ms = percentile(waits, 0.50), percentile(waits, 0.95)
+		if len(waits) > 0 {
+			m.MaxWaitMs = waits[len(waits)-1]
+		}
+		if m.Queued > 0 {
+			m.OldestWaitMs = float64(now.Sub(s.queues[rank][0].queuedAt).Microseconds()) / 1000
+		}
+		st.Running += m.Running
+		st.Queued += m.Queued
+	}
+	return st
+}
+
+// ExecutionQueue reports the execution queue of this replica by priority.
+//
+//	GET /api/executions/queue
+func (h *Handlers) ExecutionQueue(c echo.Context) error {
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: h.scheduler.Status()})
+}
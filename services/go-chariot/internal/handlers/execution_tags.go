@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	// tagUsageRetentionDays is how many days of tag usage are kept.
+	tagUsageRetentionDays = 90
+	defaultTagUsageDays   = 30
+	tagUsageDayFormat     = "2006-01-02"
+)
+
+// TagUsage is the usage attributed to one tag value, over a day or a range
+// of days. Executions without the tag are attributed to the empty value.
+type TagUsage struct {
+	Tag           string  `json:"tag"`
+	Value         string  `json:"value"`
+	Day           string  `json:"day,omitempty"`
+	Executions    int     `json:"executions"`
+	Failures      int     `json:"failures"`
+	DurationMs    float64 `json:"duration_ms"`
+	Rows          int     `json:"rows"`
+	ExternalCalls int     `json:"external_calls"`
+}
+
+func (u *TagUsage) add(o TagUsage) {
+	u.Executions += o.Executions
+	u.Failures += o.Failures
+	u.DurationMs += o.DurationMs
+	u.Rows += o.Rows
+	u.ExternalCalls += o.ExternalCalls
+}
+
+// tagUsageKey identifies a day's usage of a tag value; the day's totals over
+// all executions have an empty tag.
+type tagUsageKey struct {
+	day, tag, value string
+}
+
+// TagUsageStore adds up the duration, rows and external calls of finished
+// executions per tag value and day, so platform teams can attribute usage
+// to the teams, projects or tickets executions are tagged with. It is kept
+// in a file under the data path when one is configured. A nil store records
+// nothing.
+type TagUsageStore struct {
+	mu    sync.Mutex
+	usage map[tagUsageKey]*TagUsage
+	file  string // "" keeps the usage in memory only
+	dirty bool
+}
+
+// NewTagUsageStore loads the usage saved in file, if any.
+func NewTagUsageStore(file string) *TagUsageStore {
+	s := &TagUsageStore{usage: map[tagUsageKey]*TagUsage{}, file: file}
+	if file == "" {
+		return s
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			cfg.ChariotLogger.Warn("Failed to load tag usage", zap.String("file", file), zap.Error(err))
+		}
+		return s
+	}
+	var saved []TagUsage
+	if err := json.Unmarshal(data, &saved); err != nil {
+		cfg.ChariotLogger.Warn("Failed to load tag usage", zap.String("file", file), zap.Error(err))
+		return s
+	}
+	for i := range saved {
+		s.usage[tagUsageKey{saved[i].Day, saved[i].Tag, saved[i].Value}] = &saved[i]
+	}
+	return s
+}
+
+// Record adds a finished execution to the day it finished on.
+func (s *TagUsageStore) Record(tags map[string]string, completed time.Time, duration time.Duration, usage *chariot.ExecutionUsage, failed bool) {
+	if s == nil {
+		return
+	}
+	entry := TagUsage{Executions: 1, DurationMs: float64(duration.Microseconds()) / 1000}
+	if failed {
+		entry.Failures = 1
+	}
+	if usage != nil {
+		entry.Rows, entry.ExternalCalls = usage.Rows, usage.ExternalCalls
+	}
+	day := completed.UTC().Format(tagUsageDayFormat)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addLocked(tagUsageKey{day: day}, entry)
+	for tag, value := range tags {
+		s.addLocked(tagUsageKey{day, tag, value}, entry)
+	}
+	s.dirty = true
+}
+
+func (s *TagUsageStore) addLocked(key tagUsageKey, entry TagUsage) {
+	u := s.usage[key]
+	if u == nil {
+		u = &TagUsage{Tag: key.tag, Value: key.value, Day: key.day}
+		s.usage[key] = u
+	}
+	u.add(entry)
+}
+
+// TagUsageReport is the usage of the days from From to To.
+type TagUsageReport struct {
+	From   string     `json:"from"`
+	To     string     `json:"to"`
+	Total  TagUsage   `json:"total"` // Every execution, tagged or not
+	Usage  []TagUsage `json:"usage"`
+	Tagged []string   `json:"tags"` // Tag keys used in the period
+}
+
+// Report returns the usage of the days since from, of the values of tag or
+// of every tag when tag is "". With byDay set there is an entry per day.
+func (s *TagUsageStore) Report(tag string, from time.Time, byDay bool) TagUsageReport {
+	report := TagUsageReport{
+		From:   from.UTC().Format(tagUsageDayFormat),
+		To:     time.Now().UTC().Format(tagUsageDayFormat),
+		Usage:  []TagUsage{},
+		Tagged: []string{},
+	}
+	if s == nil {
+		return report
+	}
+	merged := map[tagUsageKey]*TagUsage{}
+	keys := map[string]bool{}
+	totals := map[string]TagUsage{} // By day
+	merge := func(key tagUsageKey, u TagUsage) {
+		m := merged[key]
+		if m == nil {
+			m = &TagUsage{Tag: key.tag, Value: key.value, Day: key.day}
+			merged[key] = m
+		}
+		m.add(u)
+	}
+	s.mu.Lock()
+	for key, u := range s.usage {
+		if key.day < report.From {
+			continue
+		}
+		if key.tag == "" {
+			report.Total.add(*u)
+			t := totals[key.day]
+			t.add(*u)
+			totals[key.day] = t
+			continue
+		}
+		keys[key.tag] = true
+		if tag != "" && key.tag != tag {
+			continue
+		}
+		if !byDay {
+			key.day = ""
+		}
+		merge(key, *u)
+	}
+	s.mu.Unlock()
+
+	// What the tag's values do not account for ran without it
+	if tag != "" {
+		for day, total := range totals {
+			if !byDay {
+				day = ""
+			}
+			merge(tagUsageKey{day: day, tag: tag}, total)
+		}
+		for key, u := range merged {
+			if key.value == "" {
+				continue
+			}
+			untagged := merged[tagUsageKey{day: key.day, tag: tag}]
+			if untagged == nil {
+				continue
+			}
+			untagged.Executions -= u.Executions
+			untagged.Failures -= u.Failures
+			untagged.DurationMs -= u.DurationMs
+			untagged.Rows -= u.Rows
+			untagged.ExternalCalls -= u.ExternalCalls
+		}
+	}
+	for _, u := range merged {
+		if u.Executions > 0 {
+			report.Usage = append(report.Usage, *u)
+		}
+	}
+	sort.Slice(report.Usage, func(i, j int) bool {
+		a, b := report.Usage[i], report.Usage[j]
+		if a.Tag != b.Tag {
+			return a.Tag < b.Tag
+		}
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.DurationMs != b.DurationMs {
+			return a.DurationMs > b.DurationMs
+		}
+		return a.Value < b.Value
+	})
+	for key := range keys {
+		report.Tagged = append(report.Tagged, key)
+	}
+	sort.Strings(report.Tagged)
+	return report
+}
+
+// Save writes the usage to the store's file when it changed, dropping the
+// days past the retention.
+func (s *TagUsageStore) Save() error {
+	if s == nil || s.file == "" {
+		return nil
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -tagUsageRetentionDays).Format(tagUsageDayFormat)
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	saved := make([]TagUsage, 0, len(s.usage))
+	for key, u := range s.usage {
+		if key.day < cutoff {
+			delete(s.usage, key)
+			continue
+		}
+		saved = append(saved, *u)
+	}
+	s.dirty = false
+	s.mu.Unlock()
+	sort.Slice(saved, func(i, j int) bool {
+		a, b := saved[i], saved[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.Tag != b.Tag {
+			return a.Tag < b.Tag
+		}
+		return a.Value < b.Value
+	})
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.file), 0o755); err != nil {
+		return err
+	}
+	tmp := s.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+// executionTags checks the tags a client sent with an execution.
+func executionTags(tags map[string]string) (map[string]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	return tags, chariot.ValidateTags(tags)
+}
+
+// tagParams reads the repeated ?tag=key:value parameters of a request.
+func tagParams(c echo.Context) (map[string]string, error) {
+	values := c.QueryParams()["tag"]
+	if len(values) == 0 {
+		return nil, nil
+	}
+	tags := make(map[string]string, len(values))
+	for _, v := range values {
+		key, value, ok := strings.Cut(v, ":")
+		if !ok {
+			return nil, fmt.Errorf("tag '%s' must be key:value", v)
+		}
+		tags[key] = value
+	}
+	return tags, chariot.ValidateTags(tags)
+}
+
+// recordListenerRun is the listener manager's OnRun hook: listener runs are
+// attributed to the listener's tags.
+func (h *Handlers) recordListenerRun(listener string, tags map[string]string, started time.Time, usage *chariot.ExecutionUsage, err error) {
+	now := time.Now()
+	h.tagUsage.Record(tags, now, now.Sub(started), usage, err != nil)
+}
+
+// TagUsageReport returns the executions, failures, duration, rows and
+// external calls attributed to each value of tag (every tag without it),
+// over the last days (default 30, at most 90). Executions without the tag
+// are listed under the empty value. by=day splits the usage by day (UTC).
+//
+//	GET /api/usage/tags?tag=team&days=30&by=day
+func (h *Handlers) TagUsageReport(c echo.Context) error {
+	days := defaultTagUsageDays
+	if v := c.QueryParam("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > tagUsageRetentionDays {
+			return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("days must be a number from 1 to %d", tagUsageRetentionDays)})
+		}
+		days = n
+	}
+	by := c.QueryParam("by")
+	if by != "" && by != "day" {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "by must be day"})
+	}
+	from := time.Now().UTC().AddDate(0, 0, 1-days)
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: h.tagUsage.Report(c.QueryParam("tag"), from, by == "day")})
+}
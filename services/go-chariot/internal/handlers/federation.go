@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// federationTokenHeader carries the shared federation token on requests
+// between peers.
+const federationTokenHeader = "X-Federation-Token"
+
+// Federation bridges this backend's agents to those of its peers, each
+// reached under its configured name: agent "thermostat" on peer "eu" is
+// "eu/thermostat" here. Beliefs and nudges are sent to the peer over HTTP;
+// the peer's agent events arrive over a WebSocket per peer and are handed to
+// the local agents following them.
+type Federation struct {
+	peers  map[string]*url.URL
+	token  string
+	client *http.Client
+}
+
+// NewFederation parses peers, a comma-separated list of name=url, such as
+// "eu=https://eu.example.com,us=https://us.example.com".
+func NewFederation(peers, token string) (*Federation, error) {
+	if token == "" {
+		return nil, errors.New("federation_token is required to reach federation peers")
+	}
+	f := &Federation{
+		peers:  map[string]*url.URL{},
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, entry := range strings.Split(peers, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("federation peer %q must be name=url with no / in the name", entry)
+		}
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("federation peer %s: %q is not an http(s) URL", name, raw)
+		}
+		if _, dup := f.peers[name]; dup {
+			return nil, fmt.Errorf("federation peer %s is listed twice", name)
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		f.peers[name] = u
+	}
+	if len(f.peers) == 0 {
+		return nil, errors.New("no federation peers configured")
+	}
+	return f, nil
+}
+
+// Peers returns the peer names, sorted.
+func (f *Federation) Peers() []string {
+	names := make([]string, 0, len(f.peers))
+	for name := range f.peers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasPeer reports whether name is a configured peer.
+func (f *Federation) HasPeer(name string) bool {
+	_, ok := f.peers[name]
+	return ok
+}
+
+// call sends a request to a peer's /federation API and returns the data of
+// its answer.
+func (f *Federation) call(method, peer, path string, body interface{}) (interface{}, error) {
+	base, ok := f.peers[peer]
+	if !ok {
+		return nil, fmt.Errorf("unknown federation peer %s", peer)
+	}
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, base.String()+"/federation"+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(federationTokenHeader, f.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("federation peer %s: %w", peer, err)
+	}
+	defer resp.Body.Close()
+	var res ResultJSON
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("federation peer %s: %s", peer, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("federation peer %s: %v", peer, res.Data)
+	}
+	return res.Data, nil
+}
+
+// Publish nudges the scheduler of agent on peer.
+func (f *Federation) Publish(peer, agent string) error {
+	_, err := f.call(http.MethodPost, peer, "/agents/"+url.PathEscape(agent)+"/publish", nil)
+	return err
+}
+
+// SetBelief sets a belief of agent on peer.
+func (f *Federation) SetBelief(peer, agent, key string, v chariot.Value, opts chariot.BeliefOptions) error {
+	confidence := opts.Confidence
+	req := beliefReq{
+		Key:   key,
+		Value: chariot.ValueToJSON(v),
+		beliefOptionsReq: beliefOptionsReq{
+			TTL:        opts.TTL.Seconds(),
+			Priority:   opts.Priority,
+			Confidence: &confidence,
+		},
+	}
+	_, err := f.call(http.MethodPost, peer, "/agents/"+url.PathEscape(agent)+"/beliefs", req)
+	return err
+}
+
+// Belief reads a belief of agent on peer; nil when it has none.
+func (f *Federation) Belief(peer, agent, key string) (chariot.Value, error) {
+	data, err := f.call(http.MethodGet, peer, "/agents/"+url.PathEscape(agent)+"/beliefs/"+url.PathEscape(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	m, _ := data.(map[string]interface{})
+	return toChariotValue(m["value"]), nil
+}
+
+// Start follows the agent events of every peer, reconnecting when a
+// connection drops.
+func (f *Federation) Start() {
+	for _, peer := range f.Peers() {
+		go f.follow(peer)
+	}
+}
+
+func (f *Federation) follow(peer string) {
+	u := *f.peers[peer]
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	u.Path += "/federation/events"
+	header := http.Header{federationTokenHeader: []string{f.token}}
+	backoff := time.Second
+	for {
+		conn, _, err := websocket.DefaultDialer.Dial(u.String(), header)
+		if err != nil {
+			cfg.ChariotLogger.Warn("Federation peer unreachable", zap.String("peer", peer), zap.Error(err), zap.Duration("retry", backoff))
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > 30*time.Second {
+				backoff = 30 * time.Second
+			}
+			continue
+		}
+		backoff = time.Second
+		cfg.ChariotLogger.Info("Following federation peer agents", zap.String("peer", peer))
+		f.relay(peer, conn)
+		conn.Close()
+	}
+}
+
+// relay hands the agent events read from a peer to their local followers
+// until the connection fails. The peer sends a heartbeat every 15 seconds.
+func (f *Federation) relay(peer string, conn *websocket.Conn) {
+	for {
+		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		_, payload, err := conn.ReadMessage()
+		if err != nil {
+			cfg.ChariotLogger.Warn("Federation peer connection lost", zap.String("peer", peer), zap.Error(err))
+			return
+		}
+		var rec AgentEventRecord
+		if json.Unmarshal(payload, &rec) != nil || rec.Agent == "" {
+			continue // hello and heartbeat messages
+		}
+		ev := rec.AgentEvent
+		ev.Agent = peer + "/" + ev.Agent
+		chariot.DeliverRemoteAgentEvent(ev)
+	}
+}
+
+// FederationAuth admits requests from peers presenting the federation token.
+func (h *Handlers) FederationAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := cfg.ChariotConfig.FederationToken
+		if token == "" {
+			return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "agent federation is not enabled"})
+		}
+		if subtle.ConstantTimeCompare([]byte(c.Request().Header.Get(federationTokenHeader)), []byte(token)) != 1 {
+			return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "invalid federation token"})
+		}
+		return next(c)
+	}
+}
+
+// FederationSetBelief sets a belief of a local agent for a peer.
+//
+//	POST /federation/agents/:name/beliefs {"key", "value", "ttl", "priority", "confidence"}
+func (h *Handlers) FederationSetBelief(c echo.Context) error {
+	name := c.Param("name")
+	var req beliefReq
+	if err := c.Bind(&req); err != nil || req.Key == "" {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "key is required"})
+	}
+	opts, err := req.options()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	if !chariot.DefaultAgentBeliefWithOptions(name, req.Key, toChariotValue(req.Value), opts) {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("agent '%s' not found", name)})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]any{"agent": name, "key": req.Key}})
+}
+
+// FederationGetBelief reads a belief of a local agent for a peer.
+//
+//	GET /federation/agents/:name/beliefs/:key
+func (h *Handlers) FederationGetBelief(c echo.Context) error {
+	name, key := c.Param("name"), c.Param("key")
+	beliefs := chariot.DefaultAgentGetBeliefs(name)
+	if beliefs == nil {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("agent '%s' not found", name)})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]any{"agent": name, "key": key, "value": chariot.ValueToJSON(beliefs[key])}})
+}
+
+// FederationPublish nudges the scheduler of a local agent for a peer.
+//
+//	POST /federation/agents/:name/publish
+func (h *Handlers) FederationPublish(c echo.Context) error {
+	name := c.Param("name")
+	if !chariot.DefaultAgentPublish(name) {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("agent '%s' not found", name)})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]any{"agent": name}})
+}
+
+// FederationEvents streams the agent events of every replica to a peer.
+// Only this backend's own agents' events are sent: those received from peers
+// go to their followers without being broadcast, so peers never echo events
+// back and forth.
+//
+//	GET /federation/events (WebSocket)
+func (h *Handlers) FederationEvents(c echo.Context) error {
+	if h.bus == nil {
+		return c.JSON(http.StatusServiceUnavailable, ResultJSON{Result: "ERROR", Data: "agent events are not available"})
+	}
+	conn, err := wsUpgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	chEvents, unsubscribe := h.bus.Subscribe(agentEventsTopic)
+	defer unsubscribe()
+
+	conn.SetReadLimit(512)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"hello","result":"OK","service":"federation"}`))
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case payload, ok := <-chEvents:
+			if !ok {
+				return nil
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				return nil
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"heartbeat"}`)); err != nil {
+				return nil
+			}
+		case <-done:
+			return nil
+		}
+	}
+}
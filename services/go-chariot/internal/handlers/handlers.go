@@ -1,26 +1,53 @@
 package handlers
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
 	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/deadletter"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/cluster"
 	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/listeners"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/pubsub"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/storage"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/users"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/webhooks"
 	"go.uber.org/zap"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
 // Add this to your handlers.go or appropriate file
 type ResultJSON struct {
-	Result string      `json:"result"`
-	Data   interface{} `json:"data"`
+	Result string             `json:"result"`
+	Data   interface{}        `json:"data"`
+	Error  *chariot.ErrorInfo `json:"error,omitempty"` // Structured script error, including the Chariot stack trace
+	// Watch expressions evaluated after an execution
+	Watches []WatchResult `json:"watches,omitempty"`
+	// Files the script handed back with its result, such as charts from plot
+	Artifacts []artifactRef `json:"artifacts,omitempty"`
+	// Execution trace recorded for the run, for replaying it
+	Trace string `json:"trace,omitempty"`
+	// Writes a dry run skipped
+	Planned *chariot.DryRunReport `json:"planned,omitempty"`
+	// What was cut from a result over the size limit
+	Truncated *resultTruncation `json:"truncated,omitempty"`
+	// Which elements of an array result Data holds, for a paged request
+	Page *resultPage `json:"page,omitempty"`
+	// Kind of result the script declared with resultType
+	Type *resultType `json:"type,omitempty"`
 }
 
 type etlTransformResponse struct {
@@ -35,15 +62,35 @@ type etlTransformResponse struct {
 // Handlers holds all HTTP handlers and their dependencies
 type Handlers struct {
 	sessionManager   *chariot.SessionManager
-	bootstrapRuntime *chariot.Runtime   // Global runtime for system operations
-	startTime        time.Time          // Service start time for uptime metrics
-	bootstrapLoaded  bool               // Indicates whether bootstrap script loaded successfully
-	listenerManager  *listeners.Manager // Manages configured listeners
-	execManager      *ExecutionManager  // Manages async script executions with log streaming
+	bootstrapRuntime *chariot.Runtime     // Global runtime for system operations
+	startTime        time.Time            // Service start time for uptime metrics
+	bootstrapLoaded  bool                 // Indicates whether bootstrap script loaded successfully
+	listenerManager  *listeners.Manager   // Manages configured listeners
+	execManager      *ExecutionManager    // Manages async script executions with log streaming
+	fileLeases       *FileLeases          // Advisory edit leases on files
+	bus              pubsub.Bus           // Carries log, agent and replica events between replicas
+	instanceID       string               // Names this replica on the bus
+	elector          *cluster.Elector     // Elects the replica running each singleton subsystem
+	replicas         replicaSet           // Latest status of the other replicas
+	webhooks         *webhooks.Dispatcher // Delivers execution, listener and agent events to subscribed URLs
+	execStats        *ExecutionStats      // Recently finished executions, for the dashboard
+	resources        *resourceHistory     // Recent heap, goroutine, connection and WS client samples
+	users            *users.Store         // Accounts that may log in; logins are unchecked while empty
+	quotas           *QuotaManager        // Per-user and per-role limits and execution counts
+	dashFeeds        *dashboardFeeds      // Dashboard sections served to long-polling clients
+	symbols          *SymbolIndex         // Symbols of the workspace files and library functions
+	scheduler        *ExecutionScheduler  // Queues executions by priority for the workers
+	tagUsage         *TagUsageStore       // Usage attributed to the tags of executions
+	deadLetters      *deadletter.Store    // Listener payloads and webhook events that failed for good
+	done             chan struct{}        // Closed by Close to stop the background goroutines
+	closers          []func()             // Registrations and subscriptions ended by Close
+	background       sync.WaitGroup       // Background goroutines, waited for by Close
+	closeOnce        sync.Once
 }
 
-// NewHandlers creates a new Handlers instance with dependencies
-func NewHandlers(sessionManager *chariot.SessionManager) *Handlers {
+// NewHandlers creates a new Handlers instance with dependencies. bus may be
+// nil for a single replica.
+func NewHandlers(sessionManager *chariot.SessionManager, bus pubsub.Bus) *Handlers {
 	// Create a bootstrap runtime for system operations like user authentication
 	bootstrapRuntime := chariot.NewRuntime()
 
@@ -85,14 +132,78 @@ func NewHandlers(sessionManager *chariot.SessionManager) *Handlers {
 	// In REST mode, do NOT auto-start listeners. Headless mode is responsible for starting
 	// listeners with auto_start=true (handled in cmd/main.go).
 
-	return &Handlers{
+	if bus == nil {
+		bus = pubsub.NewLocal()
+	}
+	h := &Handlers{
 		sessionManager:   sessionManager,
 		bootstrapRuntime: bootstrapRuntime,
 		startTime:        time.Now(),
 		bootstrapLoaded:  bootstrapLoaded,
 		listenerManager:  lman,
-		execManager:      NewExecutionManager(),
+		execManager:      NewExecutionManager(sessionManager.Store(), bus),
+		fileLeases:       NewFileLeases(),
+		bus:              bus,
+		instanceID:       cluster.InstanceID(),
+		replicas:         replicaSet{replicas: map[string]ReplicaStatus{}},
+		webhooks:         newWebhookDispatcher(),
+		execStats:        NewExecutionStats(),
+		resources:        newResourceHistory(),
+		users:            newUserStore(),
+		quotas:           NewQuotaManager(dataFile(cfg.ChariotConfig.QuotasFile)),
+		dashFeeds:        &dashboardFeeds{feeds: map[time.Duration]*DashboardFeed{}},
+		symbols:          NewSymbolIndex(),
+		scheduler:        NewExecutionScheduler(cfg.ChariotConfig.ExecutionWorkers, time.Duration(cfg.ChariotConfig.ExecutionMaxWait)*time.Second),
+		tagUsage:         NewTagUsageStore(dataFile(cfg.ChariotConfig.TagUsageFile)),
+		deadLetters:      newDeadLetterStore(),
+		done:             make(chan struct{}),
+	}
+	h.webhooks.OnGiveUp(h.deadLetterWebhook)
+	lman.OnUnhealthy(h.notifyListenerUnhealthy)
+	lman.OnRun(h.recordListenerRun)
+	lman.SetPreflight(h.checkListenerCode)
+	lman.SetAdmission(func(ctx context.Context) (func(), error) {
+		release, _, err := h.scheduler.Acquire(ctx, PriorityScheduled)
+		return release, err
+	})
+	h.startFanout()
+	h.startSessionsEndListener()
+	h.startUsagePersistence()
+	if peers := cfg.ChariotConfig.FederationPeers; peers != "" {
+		if fed, err := NewFederation(peers, cfg.ChariotConfig.FederationToken); err != nil {
+			cfg.ChariotLogger.Error("Agent federation disabled", zap.Error(err))
+		} else {
+			chariot.SetRemoteAgents(fed)
+			fed.Start()
+		}
 	}
+	return h
+}
+
+// Close stops the background work started by NewHandlers: the agent event
+// fan-out, the replica heartbeat, the bus subscriptions and the periodic
+// usage save. It returns once those goroutines have ended. Handlers not made
+// by NewHandlers have none.
+func (h *Handlers) Close() {
+	if h.done == nil {
+		return
+	}
+	h.closeOnce.Do(func() {
+		close(h.done)
+		for _, stop := range h.closers {
+			stop()
+		}
+		h.background.Wait()
+	})
+}
+
+// goBackground runs f in a goroutine Close waits for.
+func (h *Handlers) goBackground(f func()) {
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		f()
+	}()
 }
 
 // Listener APIs
@@ -101,7 +212,25 @@ type listenerCreateReq struct {
 	Script    string `json:"script"`
 	OnStart   string `json:"on_start"`
 	OnExit    string `json:"on_exit"`
+	Snapshot  string `json:"snapshot"`
 	AutoStart bool   `json:"auto_start"`
+	// Watch listeners run script for each file dropped into watch.source
+	Type  string                 `json:"type"`
+	Watch *listeners.WatchConfig `json:"watch"`
+	// "failures" or "all" saves execution traces of the listener's runs
+	Record string `json:"record"`
+	// Tags the usage of the listener's runs is attributed to
+	Tags map[string]string `json:"tags"`
+	// A diagram whose code is the on_start program, or the script of a
+	// watch listener; scope is where it is saved
+	Diagram string `json:"diagram"`
+	Scope   string `json:"scope"`
+	// Files under data/files run in the listener's runtime when it is
+	// created, and variables getEnv finds there first
+	Imports []string          `json:"imports"`
+	Env     map[string]string `json:"env"`
+	// How many invocations run at once, and what happens to the others
+	Concurrency *listeners.ConcurrencyConfig `json:"concurrency"`
 }
 
 func (h *Handlers) ListListeners(c echo.Context) error {
@@ -114,6 +243,27 @@ func (h *Handlers) CreateListener(c echo.Context) error {
 	if err := c.Bind(&req); err != nil || req.Name == "" {
 		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
 	}
+	owner := ""
+	if sess, ok := c.Get("session").(*chariot.Session); ok && sess != nil {
+		owner = sess.UserID
+		if qe := h.checkListenerQuota(owner); qe != nil {
+			return quotaExceeded(c, qe)
+		}
+	}
+	if req.Diagram != "" {
+		if (req.Type == listeners.TypeWatch && req.Script != "") || (req.Type != listeners.TypeWatch && req.OnStart != "") {
+			return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "diagram replaces the script of a watch listener and the on_start program of others; do not send both"})
+		}
+		code, ok, err := h.listenerDiagramCode(c, req.Diagram, req.Scope, owner)
+		if !ok {
+			return err
+		}
+		if req.Type == listeners.TypeWatch {
+			req.Script = code
+		} else {
+			req.OnStart = code
+		}
+	}
 
 	// Convert selected files to stdlib functions and set hook names
 	toAdd := make(map[string]*chariot.FunctionValue)
@@ -129,7 +279,7 @@ func (h *Handlers) CreateListener(c echo.Context) error {
 		if err != nil {
 			return "", fmt.Errorf("resolve file: %w", err)
 		}
-		content, err := os.ReadFile(fullPath)
+		content, err := storage.Default().ReadFile(fullPath)
 		if err != nil {
 			return "", fmt.Errorf("read file: %w", err)
 		}
@@ -154,6 +304,18 @@ func (h *Handlers) CreateListener(c echo.Context) error {
 	} else if newName != "" {
 		req.OnExit = newName
 	}
+	// A watch script may be a file under data/files, a function or program text
+	if req.Type == listeners.TypeWatch && req.Script != "" {
+		if p, err := chariot.GetSecureFilePath(filepath.Join("files", req.Script), "data"); err == nil {
+			if _, err := storage.Default().Stat(p); err == nil {
+				newName, err := processFile(req.Script)
+				if err != nil {
+					return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("script: %v", err)})
+				}
+				req.Script = newName
+			}
+		}
+	}
 
 	if len(toAdd) > 0 {
 		funcs := make(map[string]*chariot.FunctionValue)
@@ -175,7 +337,23 @@ func (h *Handlers) CreateListener(c echo.Context) error {
 		}
 	}
 
-	l, err := h.listenerManager.Create(req.Name, req.Script, req.OnStart, req.OnExit, req.AutoStart)
+	l, err := h.listenerManager.Create(listeners.Listener{
+		Name:        req.Name,
+		Script:      req.Script,
+		OnStart:     req.OnStart,
+		OnExit:      req.OnExit,
+		Snapshot:    req.Snapshot,
+		AutoStart:   req.AutoStart,
+		Type:        req.Type,
+		Watch:       req.Watch,
+		Owner:       owner,
+		Record:      req.Record,
+		Tags:        req.Tags,
+		Diagram:     req.Diagram,
+		Imports:     req.Imports,
+		Env:         req.Env,
+		Concurrency: req.Concurrency,
+	})
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
 	}
@@ -263,9 +441,23 @@ func (h *Handlers) StopListener(c echo.Context) error {
 
 func (h *Handlers) Execute(c echo.Context) error {
 	// Incoming JSON: {"program": "your chariot code here", "filename": "optional.ch"}
+	// Code generated from a diagram may carry a sourceMap, or name the diagram it came from.
+	// runtime "ephemeral" runs the program in a fresh runtime instead of the session's.
+	// record saves an execution trace of the run; see ReplayTrace.
+	// dryRun skips the writes of the run and reports them as planned changes.
+	// tags (team, project, ticket...) attribute the run's usage; see TagUsageReport.
+	// priority (interactive, scheduled or backfill) is the queue the run waits in.
 	type Request struct {
-		Program  string `json:"program"`
-		Filename string `json:"filename,omitempty"`
+		Program   string                    `json:"program"`
+		Filename  string                    `json:"filename,omitempty"`
+		SourceMap *chariot.DiagramSourceMap `json:"sourceMap,omitempty"`
+		Diagram   string                    `json:"diagram,omitempty"`
+		Scope     string                    `json:"scope,omitempty"`
+		Runtime   string                    `json:"runtime,omitempty"`
+		Record    bool                      `json:"record,omitempty"`
+		DryRun    bool                      `json:"dryRun,omitempty"`
+		Tags      map[string]string         `json:"tags,omitempty"`
+		Priority  string                    `json:"priority,omitempty"`
 	}
 	var req Request
 	if err := c.Bind(&req); err != nil {
@@ -274,6 +466,14 @@ func (h *Handlers) Execute(c echo.Context) error {
 			Data:   "Invalid request format",
 		})
 	}
+	tags, err := executionTags(req.Tags)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	priority, err := executionPriority(req.Priority)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
 
 	// Validate program field
 	if req.Program == "" {
@@ -361,6 +561,14 @@ func (h *Handlers) Execute(c echo.Context) error {
 	}
 	debugger := session.Runtime.Debugger
 
+	rt, release, err := executionRuntime(session, req.Runtime)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{
+			Result: "ERROR",
+			Data:   err.Error(),
+		})
+	}
+
 	// Use provided filename or default to "main.ch"
 	filename := req.Filename
 	if filename == "" {
@@ -394,6 +602,16 @@ func (h *Handlers) Execute(c echo.Context) error {
 
 	// Don't use debug mode for system calls like inspectRuntime()
 	isSystemCall := normalizedProgram == "inspectRuntime()" || normalizedProgram == "listFunctions()"
+	if !isSystemCall {
+		done, ok, err := h.admitExecution(c, session.UserID)
+		if !ok {
+			release()
+			return err
+		}
+		runtimeRelease := release
+		release = func() { runtimeRelease(); done() }
+		session.RecordExecution(filename)
+	}
 
 	if debugger != nil && debugger.IsExecutionActive() && !isSystemCall {
 		currentFile, currentLine := debugger.GetCurrentPosition()
@@ -408,10 +626,11 @@ func (h *Handlers) Execute(c echo.Context) error {
 		}
 		fmt.Printf("DEBUG: Running in background due to active breakpoints\n")
 		go func(dbg *chariot.Debugger) {
+			defer release()
 			if dbg != nil {
 				defer dbg.MarkStopped()
 			}
-			val, err := session.Runtime.ExecProgramWithFilename(req.Program, filename)
+			val, err := rt.ExecProgramWithFilename(req.Program, filename)
 			if err != nil {
 				fmt.Printf("DEBUG: Execution error: %v\n", err)
 				// Send error event
@@ -444,19 +663,71 @@ func (h *Handlers) Execute(c echo.Context) error {
 	}
 
 	// Normal synchronous execution when not debugging
-	val, err := session.Runtime.ExecProgramWithFilename(req.Program, filename)
+	defer release()
+	if !isSystemCall {
+		worker, _, err := h.scheduler.Acquire(c.Request().Context(), priority)
+		if err != nil {
+			return c.JSON(http.StatusServiceUnavailable, ResultJSON{Result: "ERROR", Data: "gave up waiting for a worker: " + err.Error()})
+		}
+		defer worker()
+	}
+	started := time.Now()
+	rt.TakeArtifacts() // left over from a debug run
+	rt.TakeResultType()
+	if req.DryRun {
+		rt.StartDryRun()
+		defer rt.StopDryRun() // in case the run panics
+	}
+	rt.StartUsage()
+	defer rt.StopUsage()
+	val, trace, err := runRecorded(session, rt, req.Record && !isSystemCall, req.Program, filename, func() (chariot.Value, error) {
+		return rt.ExecProgramWithFilename(req.Program, filename)
+	})
+	usage := rt.StopUsage()
+	planned := rt.StopDryRun()
+	var result interface{}
+	var truncated *resultTruncation
+	produced := rt.TakeArtifacts()
+	if err == nil {
+		// 3. Convert Chariot Value to proper JSON-serializable format
+		result, truncated, produced = spillResult(convertValueToJSON(val), produced)
+	}
+	artifacts := h.saveArtifacts(session.UserID, uuid.New().String(), produced)
+	truncated.linkArtifact(artifacts)
+	declared := newResultType(rt.TakeResultType())
+	var watches []WatchResult
+	if !isSystemCall {
+		watches = evaluateWatches(session, rt)
+		rec := &executionRecord{UserID: session.UserID, Filename: filename, StartedAt: started, CompletedAt: time.Now(), Done: true, Tags: tags, Usage: usage}
+		if err != nil {
+			rec.Error = err.Error()
+			rec.ErrorInfo = chariot.DescribeError(err)
+		}
+		h.recordExecution(rec)
+	}
 	if err != nil {
+		info := chariot.DescribeError(err)
+		info.ApplySourceMap(resolveSourceMap(c, req.SourceMap, req.Program, req.Diagram, req.Scope), filename)
 		return c.JSON(http.StatusBadRequest, ResultJSON{
-			Result: "ERROR",
-			Data:   fmt.Sprintf("Execution error: %v", err),
+			Result:    "ERROR",
+			Data:      fmt.Sprintf("Execution error: %v", err),
+			Error:     info,
+			Watches:   watches,
+			Artifacts: artifacts,
+			Trace:     trace,
+			Planned:   planned,
 		})
 	}
 
-	// 3. Convert Chariot Value to proper JSON-serializable format
-	result := convertValueToJSON(val)
 	resultJSON := ResultJSON{
-		Result: "OK",
-		Data:   result,
+		Result:    "OK",
+		Data:      result,
+		Watches:   watches,
+		Artifacts: artifacts,
+		Trace:     trace,
+		Planned:   planned,
+		Truncated: truncated,
+		Type:      declared,
 	}
 	return c.JSON(http.StatusOK, resultJSON)
 }
@@ -480,6 +751,18 @@ func (h *Handlers) ListFunctions(c echo.Context) error {
 	})
 }
 
+// ListPlugins lists the loaded plugins and the functions they declare
+func (h *Handlers) ListPlugins(c echo.Context) error {
+	plugins := chariot.Plugins()
+	for i := range plugins {
+		plugins[i].Env = nil // may carry credentials
+	}
+	return c.JSON(http.StatusOK, ResultJSON{
+		Result: "OK",
+		Data:   plugins,
+	})
+}
+
 // ListGlobalVariables lists all global variables from the session's runtime
 func (h *Handlers) ListGlobalVariables(c echo.Context) error {
 	// Get the authenticated session
@@ -620,14 +903,7 @@ func (h *Handlers) SaveFunctionHandler(c echo.Context) error {
 
 // Login handler - creates a new session
 func (h *Handlers) HandleLogin(c echo.Context) error {
-	if c.Request().Method != "POST" {
-		return c.JSON(http.StatusMethodNotAllowed, ResultJSON{
-			Result: "ERROR",
-			Data:   "Method not allowed",
-		})
-	}
-
-	var username, password string
+	var username, password, otp, newPassword string
 	cfg.ChariotLogger.Info("🔐 LOGIN HANDLER EXECUTED",
 		zap.String("username", username),
 	)
@@ -638,8 +914,10 @@ func (h *Handlers) HandleLogin(c echo.Context) error {
 	if strings.Contains(contentType, "application/json") {
 		// Parse JSON body
 		var loginReq struct {
-			Username string `json:"username"`
-			Password string `json:"password"`
+			Username    string `json:"username"`
+			Password    string `json:"password"`
+			OTP         string `json:"otp"`
+			NewPassword string `json:"new_password"`
 		}
 
 		if err := c.Bind(&loginReq); err != nil {
@@ -658,6 +936,8 @@ func (h *Handlers) HandleLogin(c echo.Context) error {
 		}
 		username = loginReq.Username
 		password = loginReq.Password
+		otp = loginReq.OTP
+		newPassword = loginReq.NewPassword
 
 	} else {
 		// Parse form data (existing behavior)
@@ -670,6 +950,8 @@ func (h *Handlers) HandleLogin(c echo.Context) error {
 
 		username = c.Request().FormValue("username")
 		password = c.Request().FormValue("password")
+		otp = c.Request().FormValue("otp")
+		newPassword = c.Request().FormValue("new_password")
 	}
 
 	// Validate credentials
@@ -680,15 +962,14 @@ func (h *Handlers) HandleLogin(c echo.Context) error {
 		})
 	}
 
-	// Verify credentials (implement your authentication logic)
-	/*
-		if !h.authenticateUser(username, password) {
-			return c.JSON(http.StatusUnauthorized, ResultJSON{
-				Result: "ERROR",
-				Data:   "Invalid credentials",
-			})
+	// Verify credentials once accounts exist
+	if h.users != nil && h.users.Enabled() {
+		creds := users.Credentials{ID: username, Password: password, Code: otp, NewPassword: newPassword}
+		if _, err := h.users.Login(creds); err != nil {
+			cfg.ChariotLogger.Warn("Login rejected", zap.String("username", username), zap.String("ip", c.RealIP()), zap.Error(err))
+			return loginError(c, err)
 		}
-	*/
+	}
 
 	// Generate session token (use a proper token generator)
 	token := generateSecureToken()
@@ -696,6 +977,7 @@ func (h *Handlers) HandleLogin(c echo.Context) error {
 	// Create new session
 	session := h.sessionManager.NewSession(username, cfg.ChariotLogger, token)
 	session.Authenticated = true
+	session.SetClient(c.RealIP(), c.Request().UserAgent())
 
 	// Ensure user's sandbox directories exist
 	cfg.ChariotLogger.Info("Creating sandbox directories for user",
@@ -715,16 +997,60 @@ func (h *Handlers) HandleLogin(c echo.Context) error {
 		)
 	}
 
+	tokens, err := h.sessionManager.IssueTokens(session)
+	if err != nil {
+		_ = h.sessionManager.EndSession(token)
+		cfg.ChariotLogger.Error("Failed to issue tokens", zap.String("username", username), zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: "Failed to issue tokens"})
+	}
+
 	// Success response
 	return c.JSON(http.StatusOK, ResultJSON{
 		Result: "OK",
-		Data: map[string]string{
-			"token": token,
-			"user":  username,
-		},
+		Data:   tokenResponse(username, tokens),
 	})
 }
 
+// HandleRefreshToken exchanges a refresh token for a new access and refresh
+// token of the same session: POST /token/refresh {"refresh_token"}.
+func (h *Handlers) HandleRefreshToken(c echo.Context) error {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.Bind(&req); err != nil || req.RefreshToken == "" {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "refresh_token required"})
+	}
+	session, tokens, err := h.sessionManager.RefreshTokens(req.RefreshToken)
+	if errors.Is(err, chariot.ErrRefreshTokenInvalid) {
+		return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "Invalid or expired refresh token"})
+	}
+	if err != nil {
+		cfg.ChariotLogger.Error("Failed to refresh tokens", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: "Failed to issue tokens"})
+	}
+	session.SetClient(c.RealIP(), c.Request().UserAgent())
+	username := session.Username
+	if username == "" {
+		username = session.UserID
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: tokenResponse(username, tokens)})
+}
+
+// tokenResponse is the data of login and refresh responses: the access
+// token, the seconds it is valid for, and the refresh token when access
+// tokens are short-lived.
+func tokenResponse(username string, tokens chariot.TokenGrant) map[string]interface{} {
+	data := map[string]interface{}{
+		"token":      tokens.AccessToken,
+		"user":       username,
+		"expires_in": int(time.Until(tokens.ExpiresAt).Seconds()),
+	}
+	if tokens.RefreshToken != "" {
+		data["refresh_token"] = tokens.RefreshToken
+	}
+	return data
+}
+
 // Logout handler - terminates the session
 func (h *Handlers) HandleLogout(c echo.Context) error {
 	token := c.Request().Header.Get("Authorization")
@@ -773,6 +1099,17 @@ func (h *Handlers) SessionProfile(c echo.Context) error {
 		"sandbox_scope_default": string(cfg.DefaultStorageScope()),
 		"sandbox_scopes":        []cfg.StorageScope{cfg.StorageScopeSandbox, cfg.StorageScopeGlobal},
 		"sandbox_key":           cfg.SanitizeSandboxKey(username),
+		"admin":                 h.isAdmin(sess.UserID),
+	}
+	if h.users != nil {
+		if u, err := h.users.Get(sess.UserID); err == nil {
+			profile["display_name"] = u.DisplayName
+			profile["roles"] = u.Roles
+			profile["mfa_enabled"] = u.MFAEnabled
+			if at := h.users.PasswordExpiresAt(u); !at.IsZero() {
+				profile["password_expires_at"] = at
+			}
+		}
 	}
 	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: profile})
 }
@@ -790,14 +1127,21 @@ func (h *Handlers) SessionAuth(next echo.HandlerFunc) echo.HandlerFunc {
 			if user == "" {
 				user = "oauth2-user"
 			}
+			if h.users != nil {
+				if u, err := h.users.Get(user); err == nil && u.Disabled {
+					return c.JSON(http.StatusForbidden, ResultJSON{Result: "ERROR", Data: "Account is disabled"})
+				}
+			}
 			derivedToken := "proxy-" + user
 			if sess, ok := h.sessionManager.LookupSession(derivedToken); ok {
+				sess.SetClient(c.RealIP(), r.UserAgent())
 				c.Set("session", sess)
 				return next(c)
 			}
 			// Create a per-user session keyed by derived token
 			sess := h.sessionManager.NewSession(user, cfg.ChariotLogger, derivedToken)
 			sess.Authenticated = true
+			sess.SetClient(c.RealIP(), r.UserAgent())
 			c.Set("session", sess)
 			return next(c)
 		}
@@ -812,9 +1156,13 @@ func (h *Handlers) SessionAuth(next echo.HandlerFunc) echo.HandlerFunc {
 			return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "Authentication required (empty token)"})
 		}
 		session, err := h.sessionManager.GetSession(authz)
+		if errors.Is(err, chariot.ErrAccessTokenExpired) {
+			return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "Access token expired"})
+		}
 		if err != nil {
 			return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "Invalid or expired session"})
 		}
+		session.SetClient(c.RealIP(), r.UserAgent())
 		c.Set("session", session)
 		return next(c)
 	}
@@ -860,9 +1208,12 @@ if(exists('usersAgent')) {
 }
 
 func generateSecureToken() string {
-	// Implement your secure token generation logic here
-	// For demonstration, we return a simple string
-	return "secure-token"
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		// Without randomness no token is safe to hand out
+		panic(fmt.Sprintf("generate session token: %v", err))
+	}
+	return hex.EncodeToString(b)
 }
 
 // Helper function to list available templates for user
@@ -1021,19 +1372,15 @@ func (h *Handlers) ListFiles(c echo.Context) error {
 		zap.String("filesDir", filesDir),
 	)
 
-	if err := os.MkdirAll(filesDir, 0o755); err != nil {
-		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
-	}
-
-	entries, err := os.ReadDir(filesDir)
+	entries, err := storage.Default().ReadDir(filesDir)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
 	}
 
 	var files []string
 	for _, entry := range entries {
-		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".ch" {
-			files = append(files, entry.Name())
+		if filepath.Ext(entry.Name) == ".ch" {
+			files = append(files, entry.Name)
 		}
 	}
 
@@ -1067,7 +1414,7 @@ func (h *Handlers) GetFile(c echo.Context) error {
 	}
 
 	filePath := filepath.Join(baseDir, "files", fileName)
-	content, err := os.ReadFile(filePath)
+	content, err := storage.Default().ReadFile(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "file not found"})
@@ -1075,6 +1422,9 @@ func (h *Handlers) GetFile(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
 	}
 
+	if held := h.fileLeases.Conflict(sess, filePath); held != nil {
+		c.Response().Header().Set("X-Chariot-Lock-Holder", held.Holder)
+	}
 	c.Response().Header().Set("X-Chariot-Scope", string(scope))
 	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: string(content)})
 }
@@ -1119,14 +1469,19 @@ func (h *Handlers) SaveFile(c echo.Context) error {
 		zap.String("filesDir", filesDir),
 	)
 
-	if err := os.MkdirAll(filesDir, 0o755); err != nil {
-		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
-	}
-
 	filePath := filepath.Join(filesDir, req.Name)
-	if err := os.WriteFile(filePath, []byte(req.Content), 0o644); err != nil {
+	if held := h.fileLeases.Conflict(sess, filePath); held != nil {
+		return leaseConflict(c, held)
+	}
+	if scope == cfg.StorageScopeSandbox {
+		if qe := h.checkFileQuota(username, filePath, int64(len(req.Content))); qe != nil {
+			return quotaExceeded(c, qe)
+		}
+	}
+	if err := storage.Default().WriteFile(filePath, []byte(req.Content)); err != nil {
 		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
 	}
+	h.symbols.Changed(filePath)
 
 	cfg.ChariotLogger.Info("SaveFile success",
 		zap.String("filePath", filePath),
@@ -1160,12 +1515,16 @@ func (h *Handlers) DeleteFile(c echo.Context) error {
 	}
 
 	filePath := filepath.Join(baseDir, "files", fileName)
-	if err := os.Remove(filePath); err != nil {
+	if held := h.fileLeases.Conflict(sess, filePath); held != nil {
+		return leaseConflict(c, held)
+	}
+	if err := storage.Default().Remove(filePath); err != nil {
 		if os.IsNotExist(err) {
 			return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "file not found"})
 		}
 		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
 	}
+	h.symbols.Changed(filePath)
 
 	c.Response().Header().Set("X-Chariot-Scope", string(scope))
 	return c.JSON(http.StatusNoContent, nil)
@@ -1181,6 +1540,31 @@ func (h *Handlers) Health(c echo.Context) error {
 	})
 }
 
+// HTTPError answers errors handlers and middleware return without writing a
+// response, echo's 404 and 405 among them, in the API's JSON form. A 405
+// keeps the Allow header echo set; other errors are logged and answered 500
+// without their details.
+func (h *Handlers) HTTPError(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	status, message := http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		status, message = he.Code, fmt.Sprint(he.Message)
+	} else {
+		cfg.ChariotLogger.Error("Unhandled request error", zap.String("path", c.Request().URL.Path), zap.Error(err))
+	}
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = c.JSON(status, ResultJSON{Result: "ERROR", Data: message})
+	}
+	if err != nil {
+		cfg.ChariotLogger.Warn("Failed to write error response", zap.Error(err))
+	}
+}
+
 // Ready returns readiness (e.g., bootstrap script loaded)
 func (h *Handlers) Ready(c echo.Context) error {
 	status := http.StatusOK
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/users"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// loginError reports a rejected login. A missing one-time code or an expired
+// password is flagged so clients can ask for it and log in again.
+func loginError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, users.ErrDisabled):
+		return c.JSON(http.StatusForbidden, ResultJSON{Result: "ERROR", Data: "Account is disabled"})
+	case errors.Is(err, users.ErrMFARequired):
+		return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: map[string]interface{}{
+			"error": "One-time code required", "mfa_required": true,
+		}})
+	case errors.Is(err, users.ErrPasswordExpired):
+		return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: map[string]interface{}{
+			"error": "Password has expired; choose a new one", "password_expired": true,
+		}})
+	case errors.Is(err, users.ErrInvalidCode):
+		return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "Invalid one-time code"})
+	case errors.Is(err, users.ErrCodeLocked):
+		return c.JSON(http.StatusTooManyRequests, ResultJSON{Result: "ERROR", Data: "Too many invalid one-time codes; try again later"})
+	case errors.Is(err, users.ErrInvalidCredentials):
+		return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "Invalid credentials"})
+	}
+	// The new password does not satisfy the policy
+	return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+}
+
+// accountReq is the body of the self-service account endpoints.
+type accountReq struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+	Code            string `json:"code"`
+}
+
+// accountUser returns the account of the session's user, or writes an error
+// when the session has none (logins are not checked, or came through the
+// proxy).
+func (h *Handlers) accountUser(c echo.Context) (string, bool, error) {
+	sess, ok := c.Get("session").(*chariot.Session)
+	if !ok || sess == nil {
+		return "", false, c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "session not found"})
+	}
+	if h.users == nil {
+		return "", false, c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "No account for this session"})
+	}
+	if _, err := h.users.Get(sess.UserID); err != nil {
+		return "", false, c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "No account for this session"})
+	}
+	return sess.UserID, true, nil
+}
+
+// ChangePassword replaces the caller's password.
+func (h *Handlers) ChangePassword(c echo.Context) error {
+	id, ok, err := h.accountUser(c)
+	if !ok {
+		return err
+	}
+	var req accountReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
+	}
+	if err := h.users.ChangePassword(id, req.CurrentPassword, req.NewPassword); err != nil {
+		if errors.Is(err, users.ErrInvalidCredentials) {
+			return c.JSON(http.StatusForbidden, ResultJSON{Result: "ERROR", Data: "Current password is wrong"})
+		}
+		return usersError(c, err)
+	}
+	cfg.ChariotLogger.Info("Password changed", zap.String("user", id))
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]string{"user_id": id}})
+}
+
+// EnrollMFA starts enrolling a TOTP second factor for the caller. The
+// secret is returned for manual entry; the QR endpoint shows it for
+// scanning.
+func (h *Handlers) EnrollMFA(c echo.Context) error {
+	id, ok, err := h.accountUser(c)
+	if !ok {
+		return err
+	}
+	secret, err := h.users.BeginTOTP(id)
+	if err != nil {
+		return usersError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]string{
+		"secret":      secret,
+		"otpauth_url": users.TOTPURI(cfg.ChariotConfig.MFAIssuer, id, secret),
+		"qr_url":      "/api/account/mfa/qr",
+	}})
+}
+
+// MFAQRCode returns the caller's enrollment in progress as a QR code PNG.
+func (h *Handlers) MFAQRCode(c echo.Context) error {
+	id, ok, err := h.accountUser(c)
+	if !ok {
+		return err
+	}
+	secret, err := h.users.PendingTOTP(id)
+	if err != nil {
+		return usersError(c, err)
+	}
+	img, err := users.QRCodePNG(users.TOTPURI(cfg.ChariotConfig.MFAIssuer, id, secret), 6)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.Blob(http.StatusOK, "image/png", img)
+}
+
+// ConfirmMFA completes the caller's enrollment with a code from the
+// authenticator and returns the recovery codes, once.
+func (h *Handlers) ConfirmMFA(c echo.Context) error {
+	id, ok, err := h.accountUser(c)
+	if !ok {
+		return err
+	}
+	var req accountReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
+	}
+	codes, err := h.users.ConfirmTOTP(id, req.Code)
+	if err != nil {
+		return usersError(c, err)
+	}
+	cfg.ChariotLogger.Info("Second factor enrolled", zap.String("user", id))
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]interface{}{"recovery_codes": codes}})
+}
+
+// DisableMFA removes the caller's second factor given a current one-time or
+// recovery code.
+func (h *Handlers) DisableMFA(c echo.Context) error {
+	id, ok, err := h.accountUser(c)
+	if !ok {
+		return err
+	}
+	var req accountReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
+	}
+	if err := h.users.DisableTOTP(id, req.Code); err != nil {
+		return usersError(c, err)
+	}
+	cfg.ChariotLogger.Info("Second factor removed", zap.String("user", id))
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]string{"user_id": id}})
+}
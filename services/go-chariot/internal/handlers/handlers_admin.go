@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/users"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// sessionsEndTopic carries the users whose sessions an admin ended, so every
+// replica ends the sessions it holds for them.
+const sessionsEndTopic = "sessions.end"
+
+// isAdmin reports whether user may manage accounts and other users'
+// sessions: users listed in admin_users and active accounts with the admin
+// role. Without either every authenticated user may.
+func (h *Handlers) isAdmin(user string) bool {
+	admins := strings.TrimSpace(cfg.ChariotConfig.AdminUsers)
+	for _, a := range strings.Split(admins, ",") {
+		if a = strings.TrimSpace(a); a != "" && a == user {
+			return true
+		}
+	}
+	if h.users != nil && h.users.HasAdmin() {
+		u, err := h.users.Get(user)
+		return err == nil && !u.Disabled && u.HasRole(users.RoleAdmin)
+	}
+	return admins == ""
+}
+
+// AdminAuth rejects sessions of users who are not admins. It runs after
+// SessionAuth.
+func (h *Handlers) AdminAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		session, ok := c.Get("session").(*chariot.Session)
+		if !ok || session == nil {
+			return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "Authentication required"})
+		}
+		if !h.isAdmin(session.UserID) {
+			return c.JSON(http.StatusForbidden, ResultJSON{Result: "ERROR", Data: "Admin access required"})
+		}
+		return next(c)
+	}
+}
+
+// sessionInfos converts the session manager's session maps for the
+// dashboard and the admin API, most recently seen first.
+func sessionInfos(sessions []map[string]interface{}) []SessionInfo {
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, m := range sessions {
+		var si SessionInfo
+		si.ID, _ = m["id"].(string)
+		if v, ok := m["session_id"].(string); ok {
+			si.SessionID = v
+		} else {
+			si.SessionID = si.ID
+		}
+		si.Ref, _ = m["ref"].(string)
+		si.UserID, _ = m["user_id"].(string)
+		si.Username, _ = m["username"].(string)
+		si.Created, _ = m["created"].(time.Time)
+		si.LastSeen, _ = m["last_seen"].(time.Time)
+		if v, ok := m["last_access"].(time.Time); ok {
+			si.LastAccess = v
+		} else {
+			si.LastAccess = si.LastSeen
+		}
+		si.ExpiresAt, _ = m["expires_at"].(time.Time)
+		si.RemoteAddr, _ = m["remote_addr"].(string)
+		si.UserAgent, _ = m["user_agent"].(string)
+		si.LastScript, _ = m["last_script"].(string)
+		si.LastExecuted, _ = m["last_executed"].(time.Time)
+		si.Executions, _ = m["executions"].(int)
+		si.Running, _ = m["running"].(bool)
+		if v, ok := m["status"].(string); ok {
+			si.Status = v
+		} else if !si.ExpiresAt.IsZero() && !si.ExpiresAt.After(time.Now()) {
+			si.Status = "expired"
+		} else {
+			si.Status = "active"
+		}
+		infos = append(infos, si)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].LastAccess.After(infos[j].LastAccess) })
+	return infos
+}
+
+// ListSessionsAdmin lists the sessions this replica holds with their
+// activity.
+// Query: user = only the sessions of this user
+func (h *Handlers) ListSessionsAdmin(c echo.Context) error {
+	user := c.QueryParam("user")
+	infos := sessionInfos(h.sessionManager.GetActiveSessionsInfo())
+	if user != "" {
+		filtered := infos[:0]
+		for _, si := range infos {
+			if si.UserID == user {
+				filtered = append(filtered, si)
+			}
+		}
+		infos = filtered
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: infos})
+}
+
+// GetSessionAdmin returns one session by its ref.
+func (h *Handlers) GetSessionAdmin(c echo.Context) error {
+	ref := c.Param("ref")
+	for _, si := range sessionInfos(h.sessionManager.GetActiveSessionsInfo()) {
+		if si.Ref == ref {
+			return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: si})
+		}
+	}
+	return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "Session not found"})
+}
+
+// EndSessionAdmin forces the session with the given ref to log out.
+func (h *Handlers) EndSessionAdmin(c echo.Context) error {
+	ref := c.Param("ref")
+	if err := h.sessionManager.EndSessionByRef(ref); err != nil {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	admin := c.Get("session").(*chariot.Session)
+	cfg.ChariotLogger.Info("Admin ended session", zap.String("admin", admin.UserID), zap.String("ref", ref))
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]string{"ended": ref}})
+}
+
+// EndUserSessionsAdmin forces every session of a user to log out, on every
+// replica when they share a bus. The count covers this replica only.
+func (h *Handlers) EndUserSessionsAdmin(c echo.Context) error {
+	user := c.Param("user")
+	ended := h.endUserSessions(user)
+	admin := c.Get("session").(*chariot.Session)
+	cfg.ChariotLogger.Info("Admin ended user sessions", zap.String("admin", admin.UserID), zap.String("user", user), zap.Int("ended", ended))
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]interface{}{"user": user, "ended": ended}})
+}
+
+// endUserSessions ends the sessions of user on this replica and asks the
+// other replicas to do the same. It returns how many this replica ended.
+func (h *Handlers) endUserSessions(user string) int {
+	ended := h.sessionManager.EndUserSessions(user)
+	if h.bus != nil && h.bus.Shared() {
+		if err := h.bus.Publish(sessionsEndTopic, []byte(user)); err != nil {
+			cfg.ChariotLogger.Warn("Failed to publish session termination", zap.String("user", user), zap.Error(err))
+		}
+	}
+	return ended
+}
+
+// startSessionsEndListener ends the local sessions of users whose sessions
+// an admin ended on another replica.
+func (h *Handlers) startSessionsEndListener() {
+	if !h.bus.Shared() {
+		return
+	}
+	ended, unsubscribe := h.bus.Subscribe(sessionsEndTopic)
+	h.closers = append(h.closers, unsubscribe)
+	h.goBackground(func() {
+		for user := range ended {
+			h.sessionManager.EndUserSessions(string(user))
+		}
+	})
+}
@@ -74,6 +74,27 @@ func (h *Handlers) PublishAgent(c echo.Context) error {
 type beliefReq struct {
 	Key   string      `json:"key"`
 	Value interface{} `json:"value"`
+	beliefOptionsReq
+}
+
+// beliefOptionsReq holds the optional qualifiers of a belief being set.
+type beliefOptionsReq struct {
+	TTL        float64  `json:"ttl"` // seconds; 0 never expires
+	Priority   float64  `json:"priority"`
+	Confidence *float64 `json:"confidence"` // 0..1, default 1
+}
+
+func (r beliefOptionsReq) options() (ch.BeliefOptions, error) {
+	opts := ch.DefaultBeliefOptions
+	opts.TTL = time.Duration(r.TTL * float64(time.Second))
+	opts.Priority = r.Priority
+	if r.Confidence != nil {
+		if *r.Confidence < 0 || *r.Confidence > 1 {
+			return opts, fmt.Errorf("confidence must be between 0 and 1")
+		}
+		opts.Confidence = *r.Confidence
+	}
+	return opts, nil
 }
 
 func (h *Handlers) PutBelief(c echo.Context) error {
@@ -82,8 +103,12 @@ func (h *Handlers) PutBelief(c echo.Context) error {
 	if err := c.Bind(&req); err != nil || name == "" || req.Key == "" {
 		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
 	}
+	opts, err := req.options()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
 	val := toChariotValue(req.Value)
-	if ok := ch.DefaultAgentBelief(name, req.Key, val); !ok {
+	if ok := ch.DefaultAgentBeliefWithOptions(name, req.Key, val, opts); !ok {
 		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "agent not found"})
 	}
 	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]any{"belief": req.Key}})
@@ -112,10 +137,14 @@ func (h *Handlers) CreateAgent(c echo.Context) error {
 		req.PollSeconds = 3.0
 	}
 
-	// Get the plan from bootstrap runtime
+	// Get the plan from bootstrap runtime, else from the plan library
 	planVal, ok := h.bootstrapRuntime.GlobalScope().Get(req.Plan)
 	if !ok || planVal == nil {
-		return c.JSON(http.StatusNotFound, ResultJSON{Result: "error", Data: fmt.Sprintf("plan '%s' not found", req.Plan)})
+		if lib := ch.LibraryPlan(req.Plan); lib != nil {
+			planVal = lib
+		} else {
+			return c.JSON(http.StatusNotFound, ResultJSON{Result: "error", Data: fmt.Sprintf("plan '%s' not found", req.Plan)})
+		}
 	}
 
 	plan, ok := planVal.(*ch.Plan)
@@ -139,10 +168,15 @@ func (h *Handlers) SetBelief(c echo.Context) error {
 		Name  string      `json:"name"`
 		Key   string      `json:"key"`
 		Value interface{} `json:"value"`
+		beliefOptionsReq
 	}
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "error", Data: "invalid request"})
 	}
+	opts, err := req.options()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "error", Data: err.Error()})
+	}
 
 	if req.Name == "" || req.Key == "" {
 		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "error", Data: "name and key are required"})
@@ -154,7 +188,7 @@ func (h *Handlers) SetBelief(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "error", Data: fmt.Sprintf("invalid value: %v", err)})
 	}
 
-	if !ch.DefaultAgentBelief(req.Name, req.Key, val) {
+	if !ch.DefaultAgentBeliefWithOptions(req.Name, req.Key, val, opts) {
 		return c.JSON(http.StatusNotFound, ResultJSON{Result: "error", Data: fmt.Sprintf("agent '%s' not found", req.Name)})
 	}
 
@@ -198,6 +232,27 @@ func (h *Handlers) GetAgentInfo(c echo.Context) error {
 	return c.JSON(http.StatusOK, ResultJSON{Result: "success", Data: info})
 }
 
+// GetAgent returns an agent's beliefs, its plans with their trigger, guard
+// and drop conditions, and the plan instances it is executing with the
+// step each has reached.
+//
+//	GET /api/agents/:name
+func (h *Handlers) GetAgent(c echo.Context) error {
+	name := c.Param("name")
+	detail := ch.DefaultAgentDetail(name)
+	if detail == nil {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("agent '%s' not found", name)})
+	}
+	beliefs := make(map[string]interface{}, len(detail.Beliefs))
+	for k, v := range detail.Beliefs {
+		beliefs[k] = ch.ValueToJSON(v)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: struct {
+		*ch.AgentDetail
+		Beliefs map[string]interface{} `json:"beliefs"`
+	}{detail, beliefs}})
+}
+
 // RunPlanOnce executes a plan once with custom variables (no persistent agent)
 func (h *Handlers) RunPlanOnce(c echo.Context) error {
 	var req struct {
@@ -313,18 +368,30 @@ func toChariotValue(v interface{}) ch.Value {
 	}
 }
 
-// WebSocket: stream agent events
+// WebSocket: stream agent events. With ?since= (a time, a duration such as
+// 8h, or with one agent a sequence number) the recorded events after it are
+// sent first, marked "replay"; ?agent=a,b limits the stream to those agents.
 func (h *Handlers) HandleAgentsWS(c echo.Context) error {
+	if _, err := parseAgentEventQuery(c); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	agents := map[string]bool{}
+	if names := c.QueryParam("agent"); names != "" {
+		for _, name := range strings.Split(names, ",") {
+			agents[strings.TrimSpace(name)] = true
+		}
+	}
+
 	// Upgrade to WebSocket (same Upgrader settings as dashboard)
 	conn, err := wsUpgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
+	defer wsClients.open(wsAgents)()
 
-	// Subscribe to agent events
-	chEvents := make(chan ch.AgentEvent, 128)
-	unsubscribe := ch.RegisterAgentEventSink(chEvents)
+	// Subscribe to agent events from every replica sharing the bus
+	chEvents, unsubscribe := h.bus.Subscribe(agentEventsTopic)
 	defer unsubscribe()
 
 	// Improve stability: handle control frames and keep-alive pings
@@ -349,6 +416,24 @@ func (h *Handlers) HandleAgentsWS(c echo.Context) error {
 	// Send initial hello so clients immediately see something
 	_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"hello","result":"OK","service":"agents"}`))
 
+	// Replay the recorded events the client missed; live events already
+	// replayed (they arrive between subscribing and reading the history) are
+	// skipped by sequence number
+	replayed := map[string]int{}
+	history, err := h.agentEventReplay(c)
+	if err != nil {
+		cfg.ChariotLogger.Warn("Agent event replay failed", zap.Error(err))
+	}
+	for _, rec := range history {
+		payload, _ := json.Marshal(rec)
+		if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+			return nil
+		}
+		if seq, ok := replayed[rec.Agent]; !ok || rec.Seq > seq {
+			replayed[rec.Agent] = rec.Seq
+		}
+	}
+
 	// Periodic ping to keep intermediaries happy
 	ping := time.NewTicker(30 * time.Second)
 	defer ping.Stop()
@@ -359,11 +444,20 @@ func (h *Handlers) HandleAgentsWS(c echo.Context) error {
 
 	for {
 		select {
-		case ev, ok := <-chEvents:
+		case payload, ok := <-chEvents:
 			if !ok {
 				return nil
 			}
-			payload, _ := json.Marshal(ev)
+			var rec AgentEventRecord
+			if len(agents) > 0 || len(replayed) > 0 {
+				_ = json.Unmarshal(payload, &rec)
+			}
+			if len(agents) > 0 && !agents[rec.Agent] {
+				continue
+			}
+			if seq, ok := replayed[rec.Agent]; ok && rec.Seq <= seq {
+				continue
+			}
 			if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
 				return nil
 			}
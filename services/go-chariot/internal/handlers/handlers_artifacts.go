@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/statestore"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// artifactRef describes an artifact in an execution result. Data carries
+// images small enough to show inline; everything is downloadable from URL
+// until ExpiresAt.
+type artifactRef struct {
+	Name      string    `json:"name"`
+	MimeType  string    `json:"mime_type"`
+	Size      int       `json:"size"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Data      []byte    `json:"data,omitempty"`
+}
+
+// storedArtifact is an artifact as kept in the state store.
+type storedArtifact struct {
+	UserID   string `json:"user_id"`
+	MimeType string `json:"mime_type"`
+	Data     []byte `json:"data"`
+}
+
+// artifactIndex lists the artifacts of one execution.
+type artifactIndex struct {
+	UserID    string        `json:"user_id"`
+	Artifacts []artifactRef `json:"artifacts"` // without Data
+}
+
+func artifactIndexKey(execID string) string  { return "artifacts:" + execID }
+func artifactKey(execID, name string) string { return "artifact:" + execID + ":" + name }
+
+// localArtifacts keeps artifacts for Handlers built without a session
+// manager.
+var localArtifacts = statestore.NewMemory()
+
+// artifactStore returns the state store artifacts are kept in.
+func (h *Handlers) artifactStore() statestore.Store {
+	if h.sessionManager == nil {
+		return localArtifacts
+	}
+	return h.sessionManager.Store()
+}
+
+func artifactTTL() time.Duration {
+	if m := cfg.ChariotConfig.ArtifactTTL; m > 0 {
+		return time.Duration(m) * time.Minute
+	}
+	return time.Hour
+}
+
+// saveArtifacts keeps the artifacts of an execution in the state store, so
+// any replica can serve them until they expire, and returns the references
+// for the result. Artifacts that cannot be stored are logged and left out.
+func (h *Handlers) saveArtifacts(userID, execID string, artifacts []chariot.Artifact) []artifactRef {
+	if len(artifacts) == 0 {
+		return nil
+	}
+	store := h.artifactStore()
+	ttl := artifactTTL()
+	expires := time.Now().Add(ttl)
+	inline := cfg.ChariotConfig.ArtifactInlineSize << 10
+
+	index := artifactIndex{UserID: userID}
+	refs := make([]artifactRef, 0, len(artifacts))
+	for _, a := range artifacts {
+		data, _ := json.Marshal(storedArtifact{UserID: userID, MimeType: a.MimeType, Data: a.Data})
+		if err := store.Put(artifactKey(execID, a.Name), data, ttl); err != nil {
+			cfg.ChariotLogger.Warn("Failed to store artifact", zap.String("exec_id", execID), zap.String("artifact", a.Name), zap.Error(err))
+			continue
+		}
+		ref := artifactRef{
+			Name:      a.Name,
+			MimeType:  a.MimeType,
+			Size:      len(a.Data),
+			URL:       "/api/artifacts/" + execID + "/" + url.PathEscape(a.Name),
+			ExpiresAt: expires,
+		}
+		index.Artifacts = append(index.Artifacts, ref)
+		if strings.HasPrefix(a.MimeType, "image/") && len(a.Data) <= inline {
+			ref.Data = a.Data
+		}
+		refs = append(refs, ref)
+	}
+	data, _ := json.Marshal(index)
+	if err := store.Put(artifactIndexKey(execID), data, ttl); err != nil {
+		cfg.ChariotLogger.Warn("Failed to store artifact index", zap.String("exec_id", execID), zap.Error(err))
+	}
+	return refs
+}
+
+// loadArtifactIndex returns the artifact index of an execution owned by
+// userID; other users' executions are reported as not found.
+func (h *Handlers) loadArtifactIndex(userID, execID string) (*artifactIndex, error) {
+	data, err := h.artifactStore().Get(artifactIndexKey(execID))
+	if err != nil {
+		return nil, err
+	}
+	var index artifactIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	if index.UserID != userID {
+		return nil, statestore.ErrNotFound
+	}
+	return &index, nil
+}
+
+func artifactError(c echo.Context, err error) error {
+	if errors.Is(err, statestore.ErrNotFound) {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "Artifact not found or expired"})
+	}
+	return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+}
+
+// ListArtifacts lists the artifacts of an execution.
+func (h *Handlers) ListArtifacts(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	index, err := h.loadArtifactIndex(session.UserID, c.Param("execId"))
+	if err != nil {
+		return artifactError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: index.Artifacts})
+}
+
+// DownloadArtifact sends one artifact with its media type, as an attachment
+// unless ?inline=true.
+func (h *Handlers) DownloadArtifact(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	execID := c.Param("execId")
+	name, err := url.PathUnescape(c.Param("name"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid artifact name"})
+	}
+	a, err := h.loadArtifact(session.UserID, execID, name)
+	if err != nil {
+		return artifactError(c, err)
+	}
+	disposition := "attachment"
+	if c.QueryParam("inline") == "true" {
+		disposition = "inline"
+	}
+	return sendArtifact(c, name, a, disposition)
+}
+
+// loadArtifact returns an artifact of an execution owned by userID; other
+// users' artifacts are reported as not found.
+func (h *Handlers) loadArtifact(userID, execID, name string) (*storedArtifact, error) {
+	data, err := h.artifactStore().Get(artifactKey(execID, name))
+	if err != nil {
+		return nil, err
+	}
+	var a storedArtifact
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, err
+	}
+	if a.UserID != userID {
+		return nil, statestore.ErrNotFound
+	}
+	return &a, nil
+}
+
+// sendArtifact sends an artifact with its media type.
+func sendArtifact(c echo.Context, name string, a *storedArtifact, disposition string) error {
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+	header.Set("X-Content-Type-Options", "nosniff")
+	// Script-produced content must not run scripts on this origin (SVG, HTML)
+	header.Set("Content-Security-Policy", "default-src 'none'; img-src data:; style-src 'unsafe-inline'; sandbox")
+	return c.Blob(http.StatusOK, a.MimeType, a.Data)
+}
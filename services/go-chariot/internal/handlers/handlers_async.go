@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
@@ -14,9 +18,19 @@ import (
 // ExecuteAsync starts a script execution asynchronously and returns an execution ID
 // The client can then stream logs via /logs/:execId and poll for result via /result/:execId
 func (h *Handlers) ExecuteAsync(c echo.Context) error {
-	// Incoming JSON: {"program": "your chariot code here"}
+	// Incoming JSON: {"program": "your chariot code here", "filename": "optional.ch"}
 	type Request struct {
-		Program string `json:"program"`
+		Program   string                    `json:"program"`
+		Filename  string                    `json:"filename,omitempty"`
+		SourceMap *chariot.DiagramSourceMap `json:"sourceMap,omitempty"`
+		Diagram   string                    `json:"diagram,omitempty"`
+		Scope     string                    `json:"scope,omitempty"`
+		Runtime   string                    `json:"runtime,omitempty"`   // session (default) or ephemeral
+		Record    bool                      `json:"record,omitempty"`    // save an execution trace of the run
+		DryRun    bool                      `json:"dryRun,omitempty"`    // skip writes and report them as planned changes
+		LogLevel  string                    `json:"log_level,omitempty"` // least severe log entry kept: debug (default), info, warn or error
+		Tags      map[string]string         `json:"tags,omitempty"`      // team, project, ticket... the run's usage is attributed to
+		Priority  string                    `json:"priority,omitempty"`  // interactive (default), scheduled or backfill
 	}
 	var req Request
 	if err := c.Bind(&req); err != nil {
@@ -25,6 +39,18 @@ func (h *Handlers) ExecuteAsync(c echo.Context) error {
 			Data:   "Invalid request format",
 		})
 	}
+	logLevel, err := executionLogLevel(req.LogLevel)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	tags, err := executionTags(req.Tags)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	priority, err := executionPriority(req.Priority)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
 
 	// Validate program field
 	if req.Program == "" {
@@ -45,11 +71,62 @@ func (h *Handlers) ExecuteAsync(c echo.Context) error {
 	// Get session from context
 	session := c.Get("session").(*chariot.Session)
 
-	// Create execution context
-	execCtx := h.execManager.Create(session.UserID, req.Program)
+	done, ok, err := h.admitExecution(c, session.UserID)
+	if !ok {
+		return err
+	}
+	rt, release, err := executionRuntime(session, req.Runtime)
+	if err != nil {
+		done()
+		return c.JSON(http.StatusBadRequest, ResultJSON{
+			Result: "ERROR",
+			Data:   err.Error(),
+		})
+	}
+	runtimeRelease := release
+	release = func() { runtimeRelease(); done() }
+
+	execCtx := h.startExecution(session, rt, release, req.Program, req.Filename,
+		resolveSourceMap(c, req.SourceMap, req.Program, req.Diagram, req.Scope), executionOptions{
+			Record: req.Record, DryRun: req.DryRun, LogLevel: logLevel, Tags: tags, Priority: priority,
+		})
+
+	return c.JSON(http.StatusOK, ResultJSON{
+		Result: "OK",
+		Data: map[string]string{
+			"execution_id": execCtx.ID,
+		},
+	})
+}
+
+// executionOptions are the choices a client makes for a background run.
+type executionOptions struct {
+	Record   bool              // Save an execution trace of the run
+	DryRun   bool              // Skip its writes and report them as planned changes
+	LogLevel string            // Drop log entries below this level
+	Tags     map[string]string // Attribute its duration, rows and external calls to these
+	Priority string            // Queue it as interactive, scheduled or backfill
+}
+
+// startExecution runs program on rt in the background and returns its
+// execution context; release is called once the program has finished. Logs
+// and the result are retrieved through StreamLogs and GetResult. The run
+// waits for a worker in the queue of its priority first.
+func (h *Handlers) startExecution(session *chariot.Session, rt *chariot.Runtime, release func(), program, filename string, sourceMap *chariot.DiagramSourceMap, opts executionOptions) *ExecutionContext {
+	execCtx := h.execManager.Create(session.UserID, program)
+	execCtx.LogBuffer.SetLevel(opts.LogLevel)
+	execCtx.Tags = opts.Tags
+	execCtx.Filename = filename
+	if execCtx.Filename == "" {
+		execCtx.Filename = "main.ch"
+	}
+	execCtx.SourceMap = sourceMap
+	execCtx.save()
+	session.RecordExecution(execCtx.Filename)
 
 	// Start execution in background goroutine
 	go func() {
+		defer release()
 		defer func() {
 			if r := recover(); r != nil {
 				cfg.ChariotLogger.Error("Panic in async execution",
@@ -59,48 +136,82 @@ func (h *Handlers) ExecuteAsync(c echo.Context) error {
 			}
 		}()
 
-		// Use the session's runtime (which has bootstrap globals/objects)
-		rt := session.Runtime
-
 		// Hook the runtime's logger to write to the execution context
 		rt.SetLogWriter(execCtx.LogBuffer)
 
+		worker, waited, _ := h.scheduler.Acquire(context.Background(), opts.Priority)
+		defer worker()
+		if waited > 0 {
+			execCtx.SetStarted(time.Now())
+			rt.WriteLog("INFO", fmt.Sprintf("=== Started after %s in the %s queue ===", waited.Round(time.Millisecond), opts.Priority))
+		}
+
 		// Add a test log to verify streaming works
 		rt.WriteLog("INFO", "=== Execution started ===")
 
 		// Execute the program
-		val, err := rt.ExecProgram(req.Program)
+		rt.TakeArtifacts()
+		rt.TakeResultType()
+		if opts.DryRun {
+			rt.StartDryRun()
+			defer rt.StopDryRun() // in case the run panics
+		}
+		rt.StartUsage()
+		defer rt.StopUsage()
+		val, trace, err := runRecorded(session, rt, opts.Record, program, execCtx.Filename, func() (chariot.Value, error) {
+			return rt.ExecProgramWithFilename(program, execCtx.Filename)
+		})
+		execCtx.SetUsage(rt.StopUsage())
+		execCtx.SetTrace(trace)
+		execCtx.SetPlanned(rt.StopDryRun())
+
+		// Convert result to JSON-serializable format, spilling one over the
+		// size limit into an artifact
+		var result interface{}
+		var truncated *resultTruncation
+		produced := rt.TakeArtifacts()
+		if err == nil {
+			result, truncated, produced = spillResult(convertValueToJSON(val), produced)
+		}
+		artifacts := h.saveArtifacts(session.UserID, execCtx.ID, produced)
+		truncated.linkArtifact(artifacts)
+		execCtx.SetArtifacts(artifacts)
+		execCtx.SetTruncated(truncated)
+		execCtx.SetResultType(newResultType(rt.TakeResultType()))
 
 		// Add completion log
 		if err != nil {
 			rt.WriteLog("ERROR", fmt.Sprintf("=== Execution failed: %v ===", err))
+			if stack := chariot.StackTrace(err); len(stack) > 0 {
+				rt.WriteLog("ERROR", chariot.FormatCallStack(stack))
+			}
 		} else {
 			rt.WriteLog("INFO", "=== Execution completed successfully ===")
 		}
 
-		// Convert result to JSON-serializable format
-		var result interface{}
-		if err == nil {
-			result = convertValueToJSON(val)
-		}
-
-		// Mark execution as complete
+		// Mark execution as complete, with the watch expressions evaluated
+		// against the state the run left behind
+		execCtx.SetWatches(evaluateWatches(session, rt))
 		execCtx.MarkDone(result, err)
+		h.recordExecution(execCtx.record())
 
 		cfg.ChariotLogger.Info("Async execution completed",
 			zap.String("exec_id", execCtx.ID),
 			zap.Bool("success", err == nil))
 	}()
 
-	return c.JSON(http.StatusOK, ResultJSON{
-		Result: "OK",
-		Data: map[string]string{
-			"execution_id": execCtx.ID,
-		},
-	})
+	return execCtx
 }
 
-// StreamLogs streams log entries for a given execution via Server-Sent Events (SSE)
+// StreamLogs streams log entries for a given execution via Server-Sent Events
+// (SSE). Each entry's event id is its sequence number; a client reconnecting
+// with Last-Event-ID (or ?last_event_id=, for clients that cannot set
+// headers) gets the entries after it from the execution's buffer, preceded by
+// a "gap" event when some were dropped from the buffer in between.
+// ?level= and ?q= filter the stream on the server: only entries at least as
+// severe as level whose message contains q, ignoring case, are sent. Values
+// the script streams with emit are sent as "result" events whatever the
+// filter.
 func (h *Handlers) StreamLogs(c echo.Context) error {
 	execID := c.Param("execId")
 	if execID == "" {
@@ -109,71 +220,121 @@ func (h *Handlers) StreamLogs(c echo.Context) error {
 			Data:   "Missing execution ID",
 		})
 	}
+	filter, err := newLogFilter(c.QueryParam("level"), c.QueryParam("q"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return h.followLogs(c, execID, &sseSink{c: c, filter: filter})
+}
+
+// logSink writes the entries of an execution's log to a client as they are
+// followed.
+type logSink interface {
+	start()
+	entry(seq int, entry chariot.LogEntry) error
+	gap(missed int) error
+	done()
+}
+
+// sseSink sends log entries as SSE events.
+type sseSink struct {
+	c      echo.Context
+	filter logFilter
+}
 
+func (s *sseSink) start() { startSSE(s.c) }
+
+func (s *sseSink) entry(seq int, entry chariot.LogEntry) error {
+	if entry.Level == chariot.LogResult {
+		return writeResultEvent(s.c, seq, entry.Value)
+	}
+	if !s.filter.match(entry) {
+		return nil
+	}
+	return writeLogEvent(s.c, seq, entry.JSON())
+}
+
+func (s *sseSink) gap(missed int) error { return writeGapEvent(s.c, missed) }
+
+func (s *sseSink) done() { writeDoneEvent(s.c) }
+
+// followLogs sends the log of an execution to sink from the sequence number
+// the client resumes at, then the entries appended until it completes or
+// the client disconnects.
+func (h *Handlers) followLogs(c echo.Context, execID string, sink logSink) error {
 	execCtx := h.execManager.Get(execID)
 	if execCtx == nil {
+		// The execution may be running on another replica
+		if _, ok := h.execManager.Lookup(execID); ok {
+			return h.streamStoredLogs(c, execID, sink)
+		}
 		return c.JSON(http.StatusNotFound, ResultJSON{
 			Result: "ERROR",
 			Data:   "Execution not found",
 		})
 	}
 
-	// Set SSE headers
-	c.Response().Header().Set("Content-Type", "text/event-stream")
-	c.Response().Header().Set("Cache-Control", "no-cache")
-	c.Response().Header().Set("Connection", "keep-alive")
-	c.Response().Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
-	c.Response().WriteHeader(http.StatusOK)
+	sink.start()
 
-	// Subscribe to log buffer
+	// Subscribe before reading the backlog so no entry falls in between
 	subscriber := execCtx.LogBuffer.Subscribe()
 	defer execCtx.LogBuffer.Unsubscribe(subscriber)
 
-	// Send all existing logs first
-	existingLogs := execCtx.LogBuffer.GetAll()
-	cfg.ChariotLogger.Info("Sending existing logs via SSE",
-		zap.String("exec_id", execID),
-		zap.Int("count", len(existingLogs)))
-
-	for _, entry := range existingLogs {
-		if _, err := fmt.Fprintf(c.Response(), "data: %s\n\n", entry.JSON()); err != nil {
-			cfg.ChariotLogger.Warn("Failed to write SSE log entry", zap.Error(err))
-			return err
+	next := resumeSeq(c)
+	// catchUp writes the buffered entries from next on
+	catchUp := func() error {
+		entries, missed := execCtx.LogBuffer.Since(next)
+		if missed > 0 {
+			if err := sink.gap(missed); err != nil {
+				return err
+			}
 		}
-		c.Response().Flush()
-	}
-
-	// Check if execution is already done
-	if execCtx.IsDone() {
-		cfg.ChariotLogger.Info("Execution already done, sending done event",
-			zap.String("exec_id", execID))
-		if _, err := fmt.Fprintf(c.Response(), "event: done\ndata: {}\n\n"); err != nil {
-			cfg.ChariotLogger.Warn("Failed to write SSE done event", zap.Error(err))
+		for _, e := range entries {
+			if err := sink.entry(e.Seq, e.Entry); err != nil {
+				return err
+			}
+			next = e.Seq + 1
 		}
 		c.Response().Flush()
 		return nil
 	}
+	cfg.ChariotLogger.Info("Sending existing logs",
+		zap.String("exec_id", execID),
+		zap.Int("from", next))
+	if err := catchUp(); err != nil {
+		return err
+	}
 
 	// Stream new logs as they arrive until execution completes or client disconnects
 	for {
 		select {
-		case entry, ok := <-subscriber:
+		case e, ok := <-subscriber:
 			if !ok {
 				// Channel closed, subscriber unsubscribed
 				return nil
 			}
-			if _, err := fmt.Fprintf(c.Response(), "data: %s\n\n", entry.JSON()); err != nil {
-				cfg.ChariotLogger.Warn("Failed to write SSE log entry", zap.Error(err))
+			if e.Seq < next {
+				continue
+			}
+			if e.Seq > next {
+				// Entries were skipped while we were slow: read the buffer
+				if err := catchUp(); err != nil {
+					return err
+				}
+				continue
+			}
+			next = e.Seq + 1
+			if err := sink.entry(e.Seq, e.Entry); err != nil {
 				return err
 			}
 			c.Response().Flush()
 
 		case <-execCtx.DoneChan():
-			// Execution completed, send final event and close
-			if _, err := fmt.Fprintf(c.Response(), "event: done\ndata: {}\n\n"); err != nil {
-				cfg.ChariotLogger.Warn("Failed to write SSE done event", zap.Error(err))
+			// Execution completed: send what is left, then the final event
+			if err := catchUp(); err != nil {
+				return err
 			}
-			c.Response().Flush()
+			sink.done()
 			return nil
 
 		case <-c.Request().Context().Done():
@@ -185,6 +346,183 @@ func (h *Handlers) StreamLogs(c echo.Context) error {
 	}
 }
 
+// startSSE writes the headers of a Server-Sent Events response.
+func startSSE(c echo.Context) {
+	c.Response().Header().Set("Content-Type", "text/event-stream")
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	c.Response().Header().Set("Connection", "keep-alive")
+	c.Response().Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
+	c.Response().WriteHeader(http.StatusOK)
+}
+
+// executionLogLevel validates the log_level of an execute request.
+func executionLogLevel(level string) (string, error) {
+	if level == "" {
+		return "", nil
+	}
+	return chariot.NormalizeLogLevel(level)
+}
+
+// logFilter selects the entries a log stream sends; the zero value sends all.
+type logFilter struct {
+	level    string
+	contains string // Lower case
+}
+
+func newLogFilter(level, contains string) (logFilter, error) {
+	level, err := executionLogLevel(level)
+	return logFilter{level: level, contains: strings.ToLower(contains)}, err
+}
+
+func (f logFilter) match(entry chariot.LogEntry) bool {
+	return chariot.LogLevelAtLeast(entry.Level, f.level) &&
+		(f.contains == "" || strings.Contains(strings.ToLower(entry.Message), f.contains))
+}
+
+// resumeSeq returns the sequence number a log stream starts from: the one
+// after the Last-Event-ID the client sends back when it reconnects, or 0.
+func resumeSeq(c echo.Context) int {
+	id := c.Request().Header.Get("Last-Event-ID")
+	if id == "" {
+		id = c.QueryParam("last_event_id")
+	}
+	if seq, err := strconv.Atoi(id); err == nil && seq >= 0 {
+		return seq + 1
+	}
+	return 0
+}
+
+// writeLogEvent writes a log entry as an SSE event whose id is its sequence.
+func writeLogEvent(c echo.Context, seq int, entry string) error {
+	if _, err := fmt.Fprintf(c.Response(), "id: %d\ndata: %s\n\n", seq, entry); err != nil {
+		cfg.ChariotLogger.Warn("Failed to write SSE log entry", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// writeResultEvent writes a value streamed with emit as an SSE "result"
+// event whose data is the value's JSON.
+func writeResultEvent(c echo.Context, seq int, value []byte) error {
+	if _, err := fmt.Fprintf(c.Response(), "event: result\nid: %d\ndata: %s\n\n", seq, value); err != nil {
+		cfg.ChariotLogger.Warn("Failed to write SSE result event", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// writeGapEvent tells the client that missed entries are no longer buffered.
+func writeGapEvent(c echo.Context, missed int) error {
+	if _, err := fmt.Fprintf(c.Response(), "event: gap\ndata: {\"missed\":%d}\n\n", missed); err != nil {
+		cfg.ChariotLogger.Warn("Failed to write SSE gap event", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func writeDoneEvent(c echo.Context) {
+	if _, err := fmt.Fprintf(c.Response(), "event: done\ndata: {}\n\n"); err != nil {
+		cfg.ChariotLogger.Warn("Failed to write SSE done event", zap.Error(err))
+	}
+	c.Response().Flush()
+}
+
+// storedLogPollInterval is how often streamStoredLogs checks the state store.
+// With a shared bus entries arrive as they are written, and the store is only
+// checked now and then in case the running replica went away.
+const (
+	storedLogPollInterval = 250 * time.Millisecond
+	busLogCheckInterval   = 5 * time.Second
+)
+
+// streamStoredLogs streams the logs of an execution running on another
+// replica from the shared state store, following new entries on the bus when
+// there is one and by polling otherwise, until it completes. Sequence numbers
+// are the entries' sequence in the store, which match the running replica's.
+func (h *Handlers) streamStoredLogs(c echo.Context, execID string, sink logSink) error {
+	var live <-chan []byte
+	interval := storedLogPollInterval
+	if bus := h.execManager.Bus(); bus != nil {
+		// Subscribe before reading the backlog so no entry falls in between
+		ch, cancel := bus.Subscribe(executionTopic(execID))
+		defer cancel()
+		live, interval = ch, busLogCheckInterval
+	}
+	sink.start()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	next := resumeSeq(c)
+	// catchUp writes the stored entries from next on and reports whether the
+	// execution is over.
+	catchUp := func() (bool, error) {
+		// Read the record before the logs so no entry written before completion is missed
+		rec, ok := h.execManager.Lookup(execID)
+		entries, seq, err := h.execManager.StoredLogs(execID, next)
+		if err != nil {
+			cfg.ChariotLogger.Warn("Failed to read stored logs", zap.String("exec_id", execID), zap.Error(err))
+		}
+		first := seq - len(entries)
+		if first > next {
+			if err := sink.gap(first - next); err != nil {
+				return true, err
+			}
+		}
+		next = seq
+		for i, data := range entries {
+			var entry chariot.LogEntry
+			if json.Unmarshal(data, &entry) != nil {
+				continue
+			}
+			if err := sink.entry(first+i, entry); err != nil {
+				return true, err
+			}
+		}
+		c.Response().Flush()
+		return !ok || rec.Done, nil
+	}
+
+	for {
+		if done, err := catchUp(); err != nil {
+			return err
+		} else if done {
+			sink.done()
+			return nil
+		}
+	wait:
+		for {
+			select {
+			case msg, ok := <-live:
+				if !ok {
+					live = nil
+					break wait
+				}
+				var ev logEvent
+				if json.Unmarshal(msg, &ev) != nil || ev.Done || ev.Seq > next {
+					// Completion, or a gap from dropped messages: read the store
+					break wait
+				}
+				if ev.Seq < next {
+					continue
+				}
+				next = ev.Seq + 1
+				var entry chariot.LogEntry
+				if json.Unmarshal(ev.Entry, &entry) != nil {
+					continue
+				}
+				if err := sink.entry(ev.Seq, entry); err != nil {
+					return err
+				}
+				c.Response().Flush()
+			case <-ticker.C:
+				break wait
+			case <-c.Request().Context().Done():
+				return nil
+			}
+		}
+	}
+}
+
 // GetResult returns the result of an execution (polling endpoint)
 func (h *Handlers) GetResult(c echo.Context) error {
 	execID := c.Param("execId")
@@ -195,8 +533,12 @@ func (h *Handlers) GetResult(c echo.Context) error {
 		})
 	}
 
-	execCtx := h.execManager.Get(execID)
-	if execCtx == nil {
+	// The format of a finished result depends on Accept
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+
+	// Local or, with a shared state store, from another replica
+	rec, ok := h.execManager.Lookup(execID)
+	if !ok {
 		return c.JSON(http.StatusNotFound, ResultJSON{
 			Result: "ERROR",
 			Data:   "Execution not found",
@@ -204,28 +546,52 @@ func (h *Handlers) GetResult(c echo.Context) error {
 	}
 
 	// Check if execution is complete
-	if !execCtx.IsDone() {
+	if !rec.Done {
 		return c.JSON(http.StatusAccepted, ResultJSON{
 			Result: "PENDING",
 			Data: map[string]interface{}{
 				"execution_id": execID,
 				"status":       "running",
-				"started_at":   execCtx.StartedAt.Format(time.RFC3339),
+				"started_at":   rec.StartedAt.Format(time.RFC3339),
 			},
 		})
 	}
 
-	// Get result and error
-	result, err := execCtx.GetResult()
-	if err != nil {
+	if rec.Error != "" {
 		return c.JSON(http.StatusOK, ResultJSON{
-			Result: "ERROR",
-			Data:   fmt.Sprintf("Execution error: %v", err),
+			Result:    "ERROR",
+			Data:      fmt.Sprintf("Execution error: %s", rec.Error),
+			Error:     rec.ErrorInfo,
+			Watches:   rec.Watches,
+			Artifacts: rec.Artifacts,
+			Trace:     rec.Trace,
+			Planned:   rec.Planned,
 		})
 	}
 
+	offset, limit, paged, err := pageParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	offers := resultOffers(rec)
+	as, ok := negotiate(c.Request().Header.Get(echo.HeaderAccept), offers)
+	if !ok {
+		return c.JSON(http.StatusNotAcceptable, ResultJSON{Result: "ERROR", Data: "The result can be sent as " + strings.Join(offers, ", ")})
+	}
+	if as != mimeResultEnvelope {
+		return h.sendResult(c, rec, as, offset, limit, paged)
+	}
+	if paged {
+		return h.resultPageResponse(c, rec, offset, limit)
+	}
 	return c.JSON(http.StatusOK, ResultJSON{
-		Result: "OK",
-		Data:   result,
+		Result:    "OK",
+		Data:      rec.Result,
+		Watches:   rec.Watches,
+		Artifacts: rec.Artifacts,
+		Trace:     rec.Trace,
+		Planned:   rec.Planned,
+		Truncated: rec.Truncated,
+		Type:      rec.ResultType,
 	})
 }
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/labstack/echo/v4"
+)
+
+// Limits of a benchmark run.
+const (
+	defaultBenchIterations = 100
+	defaultBenchWarmup     = 10
+	maxBenchIterations     = 10000
+	maxBenchWarmup         = 1000
+	benchMaxDuration       = 60 * time.Second
+)
+
+// BenchReport is what a benchmark measured over its timed iterations.
+type BenchReport struct {
+	Iterations  int     `json:"iterations"` // Timed; fewer than asked when the time limit was reached
+	Warmup      int     `json:"warmup"`
+	Truncated   bool    `json:"truncated,omitempty"`
+	TotalMs     float64 `json:"total_ms"`
+	MeanMs      float64 `json:"mean_ms"`
+	MinMs       float64 `json:"min_ms"`
+	P50Ms       float64 `json:"p50_ms"`
+	P95Ms       float64 `json:"p95_ms"`
+	MaxMs       float64 `json:"max_ms"`
+	AllocsPerOp float64 `json:"allocs_per_op"` // Of the whole process while the iterations ran
+	BytesPerOp  float64 `json:"bytes_per_op"`
+}
+
+// RunBenchmark runs ast on rt warmup times untimed, then iterations times
+// timed, with vars defined in its scope each time. No iteration starts once
+// limit has passed, and the report is then marked truncated; one still
+// running at twice the limit is stopped. It fails on the first iteration
+// that fails or when ctx is done.
+func RunBenchmark(ctx context.Context, rt *chariot.Runtime, ast *chariot.Block, vars map[string]chariot.Value, iterations, warmup int, limit time.Duration) (*BenchReport, error) {
+	deadline := time.Now().Add(limit)
+	ctx, cancel := context.WithDeadline(ctx, deadline.Add(limit))
+	defer cancel()
+	report := &BenchReport{}
+	for i := 0; i < warmup; i++ {
+		if _, err := rt.ExecContext(ctx, ast, vars); err != nil {
+			return nil, fmt.Errorf("warmup iteration %d: %w", i+1, err)
+		}
+		report.Warmup++
+	}
+
+	durations := make([]float64, 0, iterations)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		if i > 0 && time.Now().After(deadline) {
+			report.Truncated = true
+			break
+		}
+		t := time.Now()
+		if _, err := rt.ExecContext(ctx, ast, vars); err != nil {
+			return nil, fmt.Errorf("iteration %d: %w", i+1, err)
+		}
+		durations = append(durations, float64(time.Since(t).Microseconds())/1000)
+	}
+	report.TotalMs = float64(time.Since(start).Microseconds()) / 1000
+	runtime.ReadMemStats(&after)
+
+	n := len(durations)
+	report.Iterations = n
+	if n == 0 {
+		return report, nil
+	}
+	report.MeanMs = report.TotalMs / float64(n)
+	report.AllocsPerOp = float64(after.Mallocs-before.Mallocs) / float64(n)
+	report.BytesPerOp = float64(after.TotalAlloc-before.TotalAlloc) / float64(n)
+	sort.Float64s(durations)
+	report.MinMs, report.MaxMs = durations[0], durations[n-1]
+	report.P50Ms, report.P95Ms = percentile(durations, 0.50), percentile(durations, 0.95)
+	return report, nil
+}
+
+// Benchmark runs a program, or a function with arguments, a number of times
+// after a warmup and reports the mean, percentiles and allocations of the
+// timed runs. setup runs once before, for the definitions and data the runs
+// use. It runs in a fresh runtime unless runtime is "session", and waits
+// for a worker like any execution.
+//
+//	POST /api/bench {"program" | "function", "args", "setup", "iterations", "warmup", "runtime"}
+func (h *Handlers) Benchmark(c echo.Context) error {
+	var req struct {
+		Program    string        `json:"program"`
+		Function   string        `json:"function"`
+		Args       []interface{} `json:"args"`
+		Setup      string        `json:"setup"`
+		Iterations int           `json:"iterations"`
+		Warmup     *int          `json:"warmup"`
+		Runtime    string        `json:"runtime"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "Invalid request format"})
+	}
+	if (req.Program == "") == (req.Function == "") {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "give either program or function"})
+	}
+	iterations, warmup := defaultBenchIterations, defaultBenchWarmup
+	if req.Iterations != 0 {
+		iterations = req.Iterations
+	}
+	if req.Warmup != nil {
+		warmup = *req.Warmup
+	}
+	if iterations < 1 || iterations > maxBenchIterations || warmup < 0 || warmup > maxBenchWarmup {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("iterations must be 1 to %d and warmup 0 to %d", maxBenchIterations, maxBenchWarmup)})
+	}
+
+	program, vars := req.Program, map[string]chariot.Value(nil)
+	if req.Function != "" {
+		names := make([]string, len(req.Args))
+		vars = make(map[string]chariot.Value, len(req.Args))
+		for i, a := range req.Args {
+			names[i] = fmt.Sprintf("benchArg%d", i)
+			vars[names[i]] = chariot.FromNative(a)
+		}
+		program = fmt.Sprintf("%s(%s)", req.Function, strings.Join(names, ", "))
+	}
+	ast, err := chariot.ParseSource(program, "bench.ch")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+
+	mode := req.Runtime
+	if mode == "" {
+		mode = executionRuntimeEphemeral
+	}
+	session := c.Get("session").(*chariot.Session)
+	rt, release, err := executionRuntime(session, mode)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	defer release()
+	done, ok, err := h.admitExecution(c, session.UserID)
+	if !ok {
+		return err
+	}
+	defer done()
+	worker, _, err := h.scheduler.Acquire(c.Request().Context(), PriorityInteractive)
+	if err != nil {
+		return c.JSON(http.StatusServiceUnavailable, ResultJSON{Result: "ERROR", Data: "gave up waiting for a worker: " + err.Error()})
+	}
+	defer worker()
+
+	if req.Setup != "" {
+		if _, err := rt.ExecProgramWithFilename(req.Setup, "setup.ch"); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ResultJSON{Result: "ERROR", Data: "setup: " + err.Error()})
+		}
+	}
+	if req.Function != "" {
+		if _, ok := rt.GetFunction(req.Function); !ok {
+			if _, builtin := rt.GetRegisteredFunctions()[req.Function]; !builtin {
+				return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("function '%s' not found", req.Function)})
+			}
+		}
+	}
+	report, err := RunBenchmark(c.Request().Context(), rt, ast, vars, iterations, warmup, benchMaxDuration)
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusRequestTimeout
+		}
+		return c.JSON(status, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: report})
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/labstack/echo/v4"
+)
+
+// ListCircuits returns the circuit breakers scripts opened with circuit() on
+// this replica, with their state and failures.
+//
+//	GET /api/circuits
+func (h *Handlers) ListCircuits(c echo.Context) error {
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: chariot.Circuits()})
+}
+
+// ResetCircuit closes a circuit breaker, for when the dependency behind it
+// is known to be back before its reset time is up.
+//
+//	DELETE /api/circuits/:name
+func (h *Handlers) ResetCircuit(c echo.Context) error {
+	name := c.Param("name")
+	if !chariot.ResetCircuit(name) {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("circuit '%s' not found", name)})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: name})
+}
@@ -4,9 +4,13 @@ import (
 	"encoding/json"
 	"net/http"
 	"runtime"
+	"sort"
+	"sync/atomic"
 	"time"
 
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
 	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/deadletter"
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
@@ -14,12 +18,16 @@ import (
 
 // DashboardData represents the data shown on the dashboard
 type DashboardData struct {
-	ServerStatus   ServerStatus      `json:"server_status"`
-	SessionStats   SessionStats      `json:"session_stats"`
-	SystemMetrics  SystemMetrics     `json:"system_metrics"`
-	Configuration  ConfigurationInfo `json:"configuration"`
-	ActiveSessions []SessionInfo     `json:"active_sessions"`
-	Listeners      []ListenerInfo    `json:"listeners"`
+	ServerStatus   ServerStatus         `json:"server_status"`
+	SessionStats   SessionStats         `json:"session_stats"`
+	SystemMetrics  SystemMetrics        `json:"system_metrics"`
+	Configuration  ConfigurationInfo    `json:"configuration"`
+	ActiveSessions []SessionInfo        `json:"active_sessions"`
+	Listeners      []ListenerInfo       `json:"listeners"`
+	Replicas       []ReplicaStatus      `json:"replicas,omitempty"` // every live replica, when they share a bus
+	Executions     ExecutionMetrics     `json:"executions"`         // this replica's execution activity
+	Queue          ExecutionQueueStatus `json:"queue"`              // this replica's execution queue by priority
+	DeadLetters    deadletter.Counts    `json:"dead_letters"`       // failed listener payloads and webhook events kept for retry
 }
 
 type ServerStatus struct {
@@ -36,15 +44,22 @@ type SessionStats struct {
 }
 
 type SessionInfo struct {
-	ID         string    `json:"id"`
-	SessionID  string    `json:"session_id"`
-	UserID     string    `json:"user_id"`
-	Username   string    `json:"username"`
-	Created    time.Time `json:"created"`
-	LastSeen   time.Time `json:"last_seen"`
-	LastAccess time.Time `json:"last_access"`
-	ExpiresAt  time.Time `json:"expires_at"`
-	Status     string    `json:"status"`
+	ID           string    `json:"id"`
+	SessionID    string    `json:"session_id"`
+	Ref          string    `json:"ref"` // identifies the session to the admin API
+	UserID       string    `json:"user_id"`
+	Username     string    `json:"username"`
+	Created      time.Time `json:"created"`
+	LastSeen     time.Time `json:"last_seen"`
+	LastAccess   time.Time `json:"last_access"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Status       string    `json:"status"`
+	RemoteAddr   string    `json:"remote_addr"`
+	UserAgent    string    `json:"user_agent"`
+	LastScript   string    `json:"last_script"`
+	LastExecuted time.Time `json:"last_executed"`
+	Executions   int       `json:"executions"`
+	Running      bool      `json:"running"`
 }
 
 type ListenerInfo struct {
@@ -57,17 +72,24 @@ type ListenerInfo struct {
 }
 
 type SystemMetrics struct {
-	Memory     MemoryStats `json:"memory"`
-	Goroutines int         `json:"goroutines"`
-	CPUCount   int         `json:"cpu_count"`
-	Version    string      `json:"version"`
+	Memory      MemoryStats             `json:"memory"`
+	Goroutines  int                     `json:"goroutines"`
+	CPUCount    int                     `json:"cpu_count"`
+	Version     string                  `json:"version"`
+	GC          GCStats                 `json:"gc"`
+	Connections chariot.ConnectionStats `json:"connections"`
+	WSClients   map[string]int          `json:"ws_clients"` // open WebSocket streams by kind
+	History     []ResourceSample        `json:"history"`    // oldest first, every 5 seconds
 }
 
 type MemoryStats struct {
-	Alloc      uint64 `json:"alloc"`
-	TotalAlloc uint64 `json:"total_alloc"`
-	Sys        uint64 `json:"sys"`
-	NumGC      uint32 `json:"num_gc"`
+	Alloc       uint64 `json:"alloc"`
+	TotalAlloc  uint64 `json:"total_alloc"`
+	Sys         uint64 `json:"sys"`
+	NumGC       uint32 `json:"num_gc"`
+	HeapAlloc   uint64 `json:"heap_alloc"`
+	HeapInuse   uint64 `json:"heap_inuse"`
+	HeapObjects uint64 `json:"heap_objects"`
 }
 
 type ConfigurationInfo struct {
@@ -125,6 +147,18 @@ func (h *Handlers) HandleDashboard(c echo.Context) error {
                 <div id="serverStatus" class="loading">Loading...</div>
             </div>
             
+            <div class="card">
+                <h3>⚡ Execution Activity
+                    <select id="metricsWindow" onchange="refreshData()" style="float: right;">
+                        <option value="15m">15 min</option>
+                        <option value="1h" selected>1 hour</option>
+                        <option value="6h">6 hours</option>
+                        <option value="24h">24 hours</option>
+                    </select>
+                </h3>
+                <div id="executions" class="loading">Loading...</div>
+            </div>
+            
             <div class="card">
                 <h3>👥 Active Sessions</h3>
                 <div id="sessions" class="loading">Loading...</div>
@@ -135,6 +169,11 @@ func (h *Handlers) HandleDashboard(c echo.Context) error {
                 <div id="listeners" class="loading">Loading...</div>
             </div>
             
+            <div class="card">
+                <h3>📭 Dead Letters</h3>
+                <div id="deadLetters" class="loading">Loading...</div>
+            </div>
+            
             <div class="card">
                 <h3>💾 System Metrics</h3>
                 <div id="metrics" class="loading">Loading...</div>
@@ -151,7 +190,7 @@ func (h *Handlers) HandleDashboard(c echo.Context) error {
         function refreshData() {
             document.getElementById('lastUpdate').textContent = 'Updating...';
             
-            fetch('/api/dashboard/status')
+            fetch('/api/dashboard/status?window=' + document.getElementById('metricsWindow').value)
                 .then(response => {
                     if (!response.ok) {
                         throw new Error('Network response was not ok');
@@ -159,9 +198,11 @@ func (h *Handlers) HandleDashboard(c echo.Context) error {
                     return response.json();
                 })
                 .then(data => {
-                    updateServerStatus(data.server_status);
+                    updateServerStatus(data.server_status, data.replicas);
+                    updateExecutions(data.executions);
                     updateSessions(data.session_stats, data.active_sessions);
                     updateListeners(data.listeners);
+                    updateDeadLetters(data.dead_letters);
                     updateMetrics(data.system_metrics);
                     updateConfiguration(data.configuration);
                     document.getElementById('lastUpdate').textContent = 'Last updated: ' + new Date().toLocaleTimeString();
@@ -170,31 +211,74 @@ func (h *Handlers) HandleDashboard(c echo.Context) error {
                     console.error('Error fetching data:', error);
                     document.getElementById('lastUpdate').textContent = 'Update failed: ' + new Date().toLocaleTimeString();
                     // Show error in each section
-                    ['serverStatus', 'sessions', 'listeners', 'metrics', 'configuration'].forEach(id => {
+                    ['serverStatus', 'executions', 'sessions', 'listeners', 'deadLetters', 'metrics', 'configuration'].forEach(id => {
                         document.getElementById(id).innerHTML = '<span class="status-error">Failed to load data</span>';
                     });
                 });
         }
         
-        function updateServerStatus(status) {
+        function updateServerStatus(status, replicas) {
             const statusClass = status.status === 'running' ? 'status-good' : 'status-error';
-            document.getElementById('serverStatus').innerHTML = ` + "`" + `
+            let html = ` + "`" + `
                 <div class="metric"><span>Status:</span><span class="${statusClass}">●&#160;${status.status.toUpperCase()}</span></div>
                 <div class="metric"><span>Uptime:</span><span>${status.uptime}</span></div>
                 <div class="metric"><span>Port:</span><span>${status.port}</span></div>
                 <div class="metric"><span>SSL:</span><span>${status.ssl ? '🔒 Enabled' : '🔓 Disabled'}</span></div>
                 <div class="metric"><span>Mode:</span><span>${status.mode}</span></div>
             ` + "`" + `;
+            if (replicas && replicas.length > 0) {
+                html += ` + "`" + `<div class="metric"><span>Replicas:</span><span>${replicas.length}</span></div>` + "`" + `;
+                html += '<table><tr><th>Instance</th><th>Sessions</th><th>Memory</th></tr>';
+                replicas.forEach(r => {
+                    html += ` + "`" + `<tr><td>${r.instance}</td><td>${r.sessions}</td><td>${(r.alloc / 1024 / 1024).toFixed(1)} MB</td></tr>` + "`" + `;
+                });
+                html += '</table>';
+            }
+            document.getElementById('serverStatus').innerHTML = html;
+        }
+        
+        function esc(s) {
+            return String(s).replace(/[&<>"]/g, c => ({'&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;'})[c]);
+        }
+        
+        function updateExecutions(m) {
+            const pct = v => (v * 100).toFixed(1) + '%';
+            const errorClass = m.error_rate > 0.1 ? 'status-error' : (m.error_rate > 0 ? 'status-warning' : 'status-good');
+            const max = Math.max(1, ...m.series.map(b => b.succeeded + b.failed));
+            const w = 300 / m.series.length;
+            let bars = '';
+            m.series.forEach((b, i) => {
+                const ok = b.succeeded / max * 40, bad = b.failed / max * 40;
+                bars += ` + "`" + `<rect x="${i * w}" y="${40 - ok - bad}" width="${w - 1}" height="${ok}" fill="#22c55e"><title>${new Date(b.start).toLocaleTimeString()}: ${b.succeeded} ok, ${b.failed} failed</title></rect>` + "`" + `;
+                bars += ` + "`" + `<rect x="${i * w}" y="${40 - bad}" width="${w - 1}" height="${bad}" fill="#ef4444"></rect>` + "`" + `;
+            });
+            let html = ` + "`" + `
+                <svg viewBox="0 0 300 40" width="100%" height="40" preserveAspectRatio="none">${bars}</svg>
+                <div class="metric"><span>Executions:</span><span>${m.total} (${m.per_minute.toFixed(2)}/min)</span></div>
+                <div class="metric"><span>Success / Error:</span><span class="${errorClass}">${pct(m.success_rate)} / ${pct(m.error_rate)}</span></div>
+                <div class="metric"><span>Duration p50 / p95:</span><span>${m.p50_ms.toFixed(0)} ms / ${m.p95_ms.toFixed(0)} ms</span></div>
+            ` + "`" + `;
+            if (m.top_failing.length > 0) {
+                html += '<table><tr><th>Failing script</th><th>Failures</th><th>Last error</th></tr>';
+                m.top_failing.forEach(f => {
+                    html += ` + "`" + `<tr><td>${esc(f.filename)}</td><td class="status-error">${f.failures}/${f.runs}</td><td title="${esc(f.last_error)}">${esc(f.last_error.substring(0, 60))}</td></tr>` + "`" + `;
+                });
+                html += '</table>';
+            }
+            document.getElementById('executions').innerHTML = html;
         }
         
         function updateSessions(stats, sessions) {
             let html = ` + "`" + `<div class="metric"><span>Active Sessions:</span><span class="status-good">${stats.active_count}</span></div>` + "`" + `;
             
             if (sessions && sessions.length > 0) {
-                html += '<table><tr><th>User ID</th><th>Created</th><th>Status</th></tr>';
+                html += '<table><tr><th>User ID</th><th>Client</th><th>Last Script</th><th>Status</th><th></th></tr>';
                 sessions.forEach(session => {
                     const statusClass = session.status === 'active' ? 'status-good' : 'status-warning';
-                    html += ` + "`" + `<tr><td>${session.user_id}</td><td>${new Date(session.created).toLocaleString()}</td><td class="${statusClass}">${session.status}</td></tr>` + "`" + `;
+                    const details = ` + "`" + `Created ${new Date(session.created).toLocaleString()}\nLast seen ${new Date(session.last_access).toLocaleString()}\n${session.user_agent || 'Unknown client'}` + "`" + `;
+                    const script = session.last_script ? ` + "`" + `${esc(session.last_script)} (${session.executions}, ${new Date(session.last_executed).toLocaleTimeString()})` + "`" + ` : '-';
+                    html += ` + "`" + `<tr><td>${esc(session.user_id)}</td><td title="${esc(details)}">${esc(session.remote_addr || '-')}</td><td>${script}${session.running ? ' ▶' : ''}</td><td class="${statusClass}">${session.status}</td>` + "`" + ` +
+                        ` + "`" + `<td><button onclick="endSession('${session.ref}')">Log out</button> <button data-user="${esc(session.user_id)}" onclick="endUserSessions(this.dataset.user)">All of user</button></td></tr>` + "`" + `;
                 });
                 html += '</table>';
             } else if (stats.active_count === 0) {
@@ -204,6 +288,25 @@ func (h *Handlers) HandleDashboard(c echo.Context) error {
             document.getElementById('sessions').innerHTML = html;
         }
         
+        function adminRequest(path, confirmText) {
+            if (!confirm(confirmText)) return;
+            fetch(path, { method: 'DELETE' })
+                .then(response => response.json())
+                .then(result => {
+                    if (result.result !== 'OK') alert('Failed: ' + result.data);
+                    refreshData();
+                })
+                .catch(error => alert('Failed: ' + error));
+        }
+        
+        function endSession(ref) {
+            adminRequest('/api/admin/sessions/' + ref, 'Log out this session?');
+        }
+        
+        function endUserSessions(user) {
+            adminRequest('/api/admin/users/' + encodeURIComponent(user) + '/sessions', 'Log out every session of ' + user + '?');
+        }
+        
         function updateListeners(listeners) {
             if (!listeners || listeners.length === 0) {
                 document.getElementById('listeners').innerHTML = '<p style="color: #6b7280;">No listeners configured</p>';
@@ -221,12 +324,42 @@ func (h *Handlers) HandleDashboard(c echo.Context) error {
             document.getElementById('listeners').innerHTML = html;
         }
         
+        function updateDeadLetters(d) {
+            const cls = d.total > 0 ? 'status-warning' : 'status-good';
+            let html = ` + "`" + `<div class="metric"><span>Waiting for retry:</span><span class="${cls}">${d.total}</span></div>` + "`" + `;
+            Object.keys(d.by_source || {}).sort().forEach(source => {
+                html += ` + "`" + `<div class="metric"><span>${esc(source)}:</span><span>${d.by_source[source]}</span></div>` + "`" + `;
+            });
+            if (d.dropped > 0) {
+                html += ` + "`" + `<div class="metric"><span>Dropped over the limit:</span><span class="status-error">${d.dropped}</span></div>` + "`" + `;
+            }
+            document.getElementById('deadLetters').innerHTML = html;
+        }
+        
+        function sparkline(history, key) {
+            if (!history || history.length < 2) return '';
+            const values = history.map(h => h[key]);
+            const max = Math.max(...values), min = Math.min(...values);
+            const range = max - min || 1;
+            const points = values.map((v, i) => ` + "`" + `${(i / (values.length - 1) * 100).toFixed(1)},${(18 - (v - min) / range * 16).toFixed(1)}` + "`" + `).join(' ');
+            return ` + "`" + `<svg viewBox="0 0 100 20" width="100" height="20" preserveAspectRatio="none" style="vertical-align: middle; margin-right: 8px;"><polyline points="${points}" fill="none" stroke="#3b82f6" stroke-width="1.5" vector-effect="non-scaling-stroke"/></svg>` + "`" + `;
+        }
+        
         function updateMetrics(metrics) {
+            const mb = v => (v / 1024 / 1024).toFixed(2) + ' MB';
+            const h = metrics.history;
+            const conns = metrics.connections;
+            const ws = Object.entries(metrics.ws_clients).filter(([, n]) => n > 0).map(([k, n]) => ` + "`" + `${k} ${n}` + "`" + `).join(', ') || 'none';
+            const wsTotal = Object.values(metrics.ws_clients).reduce((a, b) => a + b, 0);
             document.getElementById('metrics').innerHTML = ` + "`" + `
-                <div class="metric"><span>Memory (Alloc):</span><span>${(metrics.memory.alloc / 1024 / 1024).toFixed(2)} MB</span></div>
-                <div class="metric"><span>Memory (Sys):</span><span>${(metrics.memory.sys / 1024 / 1024).toFixed(2)} MB</span></div>
-                <div class="metric"><span>Goroutines:</span><span>${metrics.goroutines}</span></div>
-                <div class="metric"><span>GC Runs:</span><span>${metrics.memory.num_gc}</span></div>
+                <div class="metric"><span>Heap (in use):</span><span>${sparkline(h, 'heap_inuse')}${mb(metrics.memory.heap_inuse)}</span></div>
+                <div class="metric"><span>Memory (Sys):</span><span>${mb(metrics.memory.sys)}</span></div>
+                <div class="metric"><span>Goroutines:</span><span>${sparkline(h, 'goroutines')}${metrics.goroutines}</span></div>
+                <div class="metric"><span>GC Pauses:</span><span>${sparkline(h, 'gc_pause_ms')}last ${metrics.gc.last_pause_ms.toFixed(2)} ms, max ${metrics.gc.max_pause_ms.toFixed(2)} ms</span></div>
+                <div class="metric"><span>GC Runs / CPU:</span><span>${metrics.gc.num_gc} / ${(metrics.gc.cpu_fraction * 100).toFixed(2)}%</span></div>
+                <div class="metric"><span>SQL Connections:</span><span>${sparkline(h, 'sql_open')}${conns.sql_open} open, ${conns.sql_in_use} in use (${conns.sql_pools} pools)</span></div>
+                <div class="metric"><span>Couchbase Clusters:</span><span>${sparkline(h, 'couchbase')}${conns.couchbase}</span></div>
+                <div class="metric"><span>WebSocket Clients:</span><span>${sparkline(h, 'ws_clients')}${wsTotal} (${ws})</span></div>
                 <div class="metric"><span>CPU Cores:</span><span>${metrics.cpu_count}</span></div>
                 <div class="metric"><span>Go Version:</span><span>${metrics.version}</span></div>
             ` + "`" + `;
@@ -254,9 +387,14 @@ func (h *Handlers) HandleDashboard(c echo.Context) error {
 	return c.HTML(http.StatusOK, dashboardHTML)
 }
 
-// HandleDashboardAPI provides JSON data for the dashboard
+// HandleDashboardAPI provides JSON data for the dashboard. Query: window
+// selects the execution activity window (15m, 1h (default), 6h or 24h).
 func (h *Handlers) HandleDashboardAPI(c echo.Context) error {
-	data := h.collectDashboardData()
+	window, err := parseMetricsWindow(c.QueryParam("window"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	data := h.collectDashboardData(window)
 	return c.JSON(http.StatusOK, data)
 }
 
@@ -272,6 +410,10 @@ var wsUpgrader = websocket.Upgrader{
 // HandleDashboardWS upgrades to a WebSocket and streams dashboard data periodically.
 // Auth: requires an Authorization header with a valid session token for the initial upgrade.
 // After upgrade, the connection stays alive regardless of session TTL to keep the dashboard visible.
+// The client selects the execution activity window by sending {"window": "6h"}.
+// A client sending {"protocol": "delta"} gets the whole dashboard once and
+// then JSON Patches against the previous update, with a full dashboard every
+// minute and whenever it sends {"resync": true}.
 func (h *Handlers) HandleDashboardWS(c echo.Context) error {
 	cfg.ChariotLogger.Info("WS connection attempt", zap.String("remote_addr", c.Request().RemoteAddr))
 	// Perform a non-extending auth check
@@ -293,6 +435,7 @@ func (h *Handlers) HandleDashboardWS(c echo.Context) error {
 	}
 	cfg.ChariotLogger.Info("WS connected for dashboard", zap.String("token", token))
 	defer conn.Close()
+	defer wsClients.open(wsDashboard)()
 
 	// Writer loop: send dashboard data every 5 seconds
 	ticker := time.NewTicker(5 * time.Second)
@@ -306,19 +449,57 @@ func (h *Handlers) HandleDashboardWS(c echo.Context) error {
 		return nil
 	})
 
-	// Launch a goroutine to read and discard messages (to process pings/close frames)
+	var window atomic.Int64
+	window.Store(int64(metricsWindows[defaultMetricsWindow]))
+	var deltas, resync atomic.Bool
+
+	// Launch a goroutine to read window selections (and to process pings/close frames)
 	go func() {
 		for {
-			if _, _, err := conn.ReadMessage(); err != nil {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
 				cfg.ChariotLogger.Info("WS read loop terminated", zap.Error(err))
 				return
 			}
+			var sel struct {
+				Window   string `json:"window"`
+				Protocol string `json:"protocol"`
+				Resync   bool   `json:"resync"`
+			}
+			if json.Unmarshal(msg, &sel) != nil {
+				continue
+			}
+			if sel.Window != "" {
+				if w, err := parseMetricsWindow(sel.Window); err == nil {
+					window.Store(int64(w))
+				}
+			}
+			if sel.Protocol == "delta" {
+				deltas.Store(true)
+				resync.Store(true)
+			}
+			if sel.Resync {
+				resync.Store(true)
+			}
 		}
 	}()
 
+	var stream dashboardStream
 	for range ticker.C {
-		data := h.collectDashboardData()
-		payload, _ := json.Marshal(ResultJSON{Result: "OK", Data: data})
+		data := h.collectDashboardData(time.Duration(window.Load()))
+		var payload []byte
+		if deltas.Load() {
+			payload, err = stream.next(data, resync.Swap(false))
+			if err != nil {
+				cfg.ChariotLogger.Warn("WS dashboard update not encoded", zap.Error(err))
+				continue
+			}
+			if payload == nil {
+				continue // nothing changed
+			}
+		} else {
+			payload, _ = json.Marshal(ResultJSON{Result: "OK", Data: data})
+		}
 		if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
 			cfg.ChariotLogger.Warn("WS write failed; closing stream", zap.Time("at", time.Now()), zap.Error(err))
 			return nil
@@ -327,59 +508,14 @@ func (h *Handlers) HandleDashboardWS(c echo.Context) error {
 	return nil
 }
 
-func (h *Handlers) collectDashboardData() DashboardData {
+func (h *Handlers) collectDashboardData(window time.Duration) DashboardData {
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
+	wsCounts, _ := wsClients.snapshot()
 
 	// Get session information
 	activeSessionCount := h.sessionManager.GetActiveSessions()
-	sessionData := h.sessionManager.GetActiveSessionsInfo()
-
-	// Convert to SessionInfo structs with safe type handling
-	var activeSessions []SessionInfo
-	for _, m := range sessionData {
-		var si SessionInfo
-		if v, ok := m["id"].(string); ok {
-			si.ID = v
-		}
-		if v, ok := m["session_id"].(string); ok {
-			si.SessionID = v
-		} else {
-			si.SessionID = si.ID
-		}
-		if v, ok := m["user_id"].(string); ok {
-			si.UserID = v
-		}
-		if v, ok := m["username"].(string); ok {
-			si.Username = v
-		}
-		if v, ok := m["created"].(time.Time); ok {
-			si.Created = v
-		}
-		if v, ok := m["last_seen"].(time.Time); ok {
-			si.LastSeen = v
-		}
-		if v, ok := m["last_access"].(time.Time); ok {
-			si.LastAccess = v
-		} else {
-			si.LastAccess = si.LastSeen
-		}
-		if v, ok := m["expires_at"].(time.Time); ok {
-			si.ExpiresAt = v
-		}
-		if v, ok := m["status"].(string); ok {
-			si.Status = v
-		} else {
-			if !si.ExpiresAt.IsZero() && si.ExpiresAt.After(time.Now()) {
-				si.Status = "active"
-			} else if !si.ExpiresAt.IsZero() {
-				si.Status = "expired"
-			} else {
-				si.Status = "active"
-			}
-		}
-		activeSessions = append(activeSessions, si)
-	}
+	activeSessions := sessionInfos(h.sessionManager.GetActiveSessionsInfo())
 
 	// Pull listeners from registry
 	var lInfos []ListenerInfo
@@ -395,6 +531,15 @@ func (h *Handlers) collectDashboardData() DashboardData {
 			})
 		}
 	}
+	// Stable order, so delta updates only carry what changed
+	sort.Slice(activeSessions, func(i, j int) bool {
+		a, b := activeSessions[i], activeSessions[j]
+		if !a.Created.Equal(b.Created) {
+			return a.Created.Before(b.Created)
+		}
+		return a.ID < b.ID
+	})
+	sort.Slice(lInfos, func(i, j int) bool { return lInfos[i].Name < lInfos[j].Name })
 
 	return DashboardData{
 		ServerStatus: ServerStatus{
@@ -415,14 +560,21 @@ func (h *Handlers) collectDashboardData() DashboardData {
 		},
 		SystemMetrics: SystemMetrics{
 			Memory: MemoryStats{
-				Alloc:      memStats.Alloc,
-				TotalAlloc: memStats.TotalAlloc,
-				Sys:        memStats.Sys,
-				NumGC:      memStats.NumGC,
+				Alloc:       memStats.Alloc,
+				TotalAlloc:  memStats.TotalAlloc,
+				Sys:         memStats.Sys,
+				NumGC:       memStats.NumGC,
+				HeapAlloc:   memStats.HeapAlloc,
+				HeapInuse:   memStats.HeapInuse,
+				HeapObjects: memStats.HeapObjects,
 			},
-			Goroutines: runtime.NumGoroutine(),
-			CPUCount:   runtime.NumCPU(),
-			Version:    runtime.Version(),
+			Goroutines:  runtime.NumGoroutine(),
+			CPUCount:    runtime.NumCPU(),
+			Version:     runtime.Version(),
+			GC:          gcStats(&memStats),
+			Connections: chariot.OpenConnections(),
+			WSClients:   wsCounts,
+			History:     h.resources.snapshot(),
 		},
 		Configuration: ConfigurationInfo{
 			DataPath:    cfg.ChariotConfig.DataPath,
@@ -436,5 +588,9 @@ func (h *Handlers) collectDashboardData() DashboardData {
 		},
 		ActiveSessions: activeSessions,
 		Listeners:      lInfos,
+		Replicas:       h.replicaStatuses(),
+		Executions:     h.execStats.Summary(window, time.Now()),
+		Queue:          h.scheduler.Status(),
+		DeadLetters:    h.deadLetters.Counts(),
 	}
 }
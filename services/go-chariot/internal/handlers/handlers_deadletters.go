@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/deadletter"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/listeners"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/webhooks"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// newDeadLetterStore opens the dead-letter store under the data path. An
+// unreadable store is logged and replaced by an empty in-memory one, like
+// the webhook registry.
+func newDeadLetterStore() *deadletter.Store {
+	opts := deadletter.Options{File: dataFile(cfg.ChariotConfig.DeadLetterFile), Max: cfg.ChariotConfig.DeadLetterMax}
+	s, err := deadletter.Open(opts)
+	if err != nil {
+		cfg.ChariotLogger.Warn("Failed to load dead letters; new ones will not persist", zap.Error(err))
+		opts.File = ""
+		s, _ = deadletter.Open(opts)
+	}
+	return s
+}
+
+// addDeadLetter stores a failed invocation, logging a store that could not
+// be saved.
+func (h *Handlers) addDeadLetter(l deadletter.Letter) {
+	if _, err := h.deadLetters.Add(l); err != nil {
+		cfg.ChariotLogger.Error("Dead letter not saved", zap.String("source", l.Source), zap.String("target", l.Target), zap.Error(err))
+	}
+}
+
+// deadLetterWebhook is the webhook dispatcher's OnGiveUp hook. Pings are
+// tests of the endpoint, not events, and are not kept.
+func (h *Handlers) deadLetterWebhook(sub webhooks.Subscription, ev webhooks.Event, attempts int, err error) {
+	if ev.Type == webhooks.Ping {
+		return
+	}
+	payload, merr := json.Marshal(ev)
+	if merr != nil {
+		return
+	}
+	h.addDeadLetter(deadletter.Letter{
+		Source:   deadletter.SourceWebhook,
+		Target:   sub.ID,
+		Event:    ev.Type,
+		Payload:  payload,
+		Error:    err.Error(),
+		Attempts: attempts,
+	})
+}
+
+// deadLetterFilter reads the source, target and before query parameters.
+func deadLetterFilter(c echo.Context) (deadletter.Filter, error) {
+	f := deadletter.Filter{Source: c.QueryParam("source"), Target: c.QueryParam("target")}
+	if v := c.QueryParam("before"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, errors.New("before must be an RFC 3339 time")
+		}
+		f.Before = t
+	}
+	return f, nil
+}
+
+func deadLetterError(c echo.Context, err error) error {
+	if errors.Is(err, deadletter.ErrNotFound) {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+}
+
+// ListDeadLetters returns dead letters, newest first, and the counts by
+// source.
+//
+//	GET /api/dead-letters?source=listener&target=orders&limit=100
+func (h *Handlers) ListDeadLetters(c echo.Context) error {
+	f, err := deadLetterFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	limit := 100
+	if v, err := strconv.Atoi(c.QueryParam("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]interface{}{
+		"letters": h.deadLetters.List(f, limit),
+		"counts":  h.deadLetters.Counts(),
+	}})
+}
+
+// GetDeadLetter returns one dead letter with its payload.
+//
+//	GET /api/dead-letters/:id
+func (h *Handlers) GetDeadLetter(c echo.Context) error {
+	l, err := h.deadLetters.Get(c.Param("id"))
+	if err != nil {
+		return deadLetterError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: l})
+}
+
+// RetryDeadLetter invokes a dead letter again. A listener payload is posted
+// to the listener at once: success removes the letter, and a failing script
+// counts another attempt on it. A webhook event is queued for delivery to
+// its subscription, answering 202; the letter is removed once the event is
+// delivered.
+//
+//	POST /api/dead-letters/:id/retry
+func (h *Handlers) RetryDeadLetter(c echo.Context) error {
+	l, err := h.deadLetters.Get(c.Param("id"))
+	if err != nil {
+		return deadLetterError(c, err)
+	}
+	switch l.Source {
+	case deadletter.SourceListener:
+		var payload interface{}
+		if len(l.Payload) > 0 {
+			if err := json.Unmarshal(l.Payload, &payload); err != nil {
+				return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: "unreadable payload: " + err.Error()})
+			}
+		}
+		err := h.listenerManager.Invoke(c.Request().Context(), l.Target, chariot.FromNative(payload))
+		switch {
+		case err == nil:
+			if err := h.deadLetters.Remove(l.ID); err != nil && !errors.Is(err, deadletter.ErrNotFound) {
+				return deadLetterError(c, err)
+			}
+			return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]string{"delivered": l.ID}})
+		case errors.Is(err, listeners.ErrBusy):
+			c.Response().Header().Set("Retry-After", "1")
+			return c.JSON(http.StatusServiceUnavailable, ResultJSON{Result: "ERROR", Data: err.Error()})
+		case errors.Is(err, listeners.ErrNotFound):
+			return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: err.Error()})
+		case errors.Is(err, listeners.ErrNotRunning):
+			return c.JSON(http.StatusConflict, ResultJSON{Result: "ERROR", Data: err.Error()})
+		case c.Request().Context().Err() != nil:
+			return c.JSON(http.StatusServiceUnavailable, ResultJSON{Result: "ERROR", Data: err.Error()})
+		}
+		if _, ferr := h.deadLetters.Failed(l.ID, 1, err.Error()); ferr != nil && !errors.Is(ferr, deadletter.ErrNotFound) {
+			cfg.ChariotLogger.Error("Dead letter not saved", zap.String("id", l.ID), zap.Error(ferr))
+		}
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: chariot.DescribeError(err)})
+
+	case deadletter.SourceWebhook:
+		var ev webhooks.Event
+		if err := json.Unmarshal(l.Payload, &ev); err != nil {
+			return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: "unreadable event: " + err.Error()})
+		}
+		id := l.ID
+		err := h.webhooks.Redeliver(l.Target, ev, func(attempts int, err error) {
+			if err == nil {
+				err = h.deadLetters.Remove(id)
+			} else {
+				_, err = h.deadLetters.Failed(id, attempts, err.Error())
+			}
+			if err != nil && !errors.Is(err, deadletter.ErrNotFound) {
+				cfg.ChariotLogger.Error("Dead letter not saved", zap.String("id", id), zap.Error(err))
+			}
+		})
+		if err != nil {
+			return webhookError(c, err)
+		}
+		return c.JSON(http.StatusAccepted, ResultJSON{Result: "OK", Data: map[string]string{"queued": l.ID}})
+	}
+	return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "unknown dead letter source " + l.Source})
+}
+
+// DeleteDeadLetter drops one dead letter.
+//
+//	DELETE /api/dead-letters/:id
+func (h *Handlers) DeleteDeadLetter(c echo.Context) error {
+	if err := h.deadLetters.Remove(c.Param("id")); err != nil {
+		return deadLetterError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]string{"deleted": c.Param("id")}})
+}
+
+// PurgeDeadLetters drops the dead letters matching the source, target and
+// before parameters; without any, all of them.
+//
+//	DELETE /api/dead-letters?source=webhook&before=2026-01-01T00:00:00Z
+func (h *Handlers) PurgeDeadLetters(c echo.Context) error {
+	f, err := deadLetterFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	n, err := h.deadLetters.Purge(f)
+	if err != nil {
+		return deadLetterError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]int{"purged": n}})
+}
@@ -230,6 +230,7 @@ func (h *Handlers) DebugEvents(c echo.Context) error {
 		return err
 	}
 	defer ws.Close()
+	defer wsClients.open(wsDebug)()
 
 	debugger := session.Runtime.Debugger
 	events, unsubscribe := debugger.SubscribeEvents()
@@ -3,6 +3,8 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/fs"
 	"net/http"
 	"os"
@@ -11,7 +13,10 @@ import (
 	"time"
 
 	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/codegen"
 	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/listeners"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/storage"
 	"github.com/labstack/echo/v4"
 )
 
@@ -48,22 +53,20 @@ func (h *Handlers) ListDiagrams(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
 	}
 	setScopeHeader(c, scope)
-	entries, err := os.ReadDir(base)
+	entries, err := storage.Default().ReadDir(base)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
 	}
 	out := make([]diagramMeta, 0, len(entries))
 	for _, e := range entries {
-		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+		if !strings.HasSuffix(e.Name, ".json") {
 			continue
 		}
-		if info, err := e.Info(); err == nil {
-			out = append(out, diagramMeta{
-				Name:     strings.TrimSuffix(e.Name(), ".json"),
-				Size:     info.Size(),
-				Modified: info.ModTime(),
-			})
-		}
+		out = append(out, diagramMeta{
+			Name:     strings.TrimSuffix(e.Name, ".json"),
+			Size:     e.Size,
+			Modified: e.Modified,
+		})
 	}
 	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: out})
 }
@@ -80,7 +83,7 @@ func (h *Handlers) GetDiagram(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
 	}
 	setScopeHeader(c, scope)
-	data, err := os.ReadFile(filepath.Join(base, file))
+	data, err := storage.Default().ReadFile(filepath.Join(base, file))
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "not found"})
@@ -117,7 +120,7 @@ func (h *Handlers) SaveDiagram(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "empty content"})
 	}
 	setScopeHeader(c, scope)
-	if err := os.WriteFile(filepath.Join(base, file), req.Content, 0o644); err != nil {
+	if err := storage.Default().WriteFile(filepath.Join(base, file), req.Content); err != nil {
 		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
 	}
 	return c.NoContent(http.StatusNoContent)
@@ -135,7 +138,7 @@ func (h *Handlers) DeleteDiagram(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
 	}
 	setScopeHeader(c, scope)
-	if err := os.Remove(filepath.Join(base, file)); err != nil {
+	if err := storage.Default().Remove(filepath.Join(base, file)); err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "not found"})
 		}
@@ -144,6 +147,323 @@ func (h *Handlers) DeleteDiagram(c echo.Context) error {
 	return c.NoContent(http.StatusNoContent)
 }
 
+// RunDiagram generates code for a saved diagram and executes it asynchronously.
+// Code saved with the diagram by the editor is used when present; otherwise
+// (or with ?generate=true) code is generated server-side, ?runtime=ephemeral
+// runs it in a fresh runtime instead of the session's, ?record=true saves
+// an execution trace of the run, ?dryRun=true skips its writes, reporting
+// them as planned changes, ?log_level=warn drops less severe log entries and
+// ?tag=team:data (repeated) tags the execution for usage attribution and
+// ?priority=backfill queues it behind interactive and scheduled runs.
+// Progress and the result are available through /api/logs/:execId and
+// /api/result/:execId.
+func (h *Handlers) RunDiagram(c echo.Context) error {
+	name := c.Param("name")
+	base, scope, err := resolveDiagramBase(c, c.QueryParam("scope"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	file, err := sanitizeDiagramName(name)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	setScopeHeader(c, scope)
+	data, err := storage.Default().ReadFile(filepath.Join(base, file))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	diagram, err := codegen.ParseDiagram(data)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	if diagram.Name == "" {
+		diagram.Name = strings.TrimSuffix(file, ".json")
+	}
+
+	// Editor code cannot include sub-diagrams, so those diagrams are always generated here
+	program, sourceMap, codeSource := diagram.Code, diagram.SourceMap, "saved"
+	if strings.TrimSpace(program) == "" || c.QueryParam("generate") == "true" || len(diagram.SubDiagrams()) > 0 {
+		generated, err := codegen.GenerateWithComponents(diagram, componentResolver(c, base))
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, ResultJSON{Result: "ERROR", Data: err.Error()})
+		}
+		program, sourceMap, codeSource = generated.Code, generated.SourceMap, "generated"
+	} else if sourceMap == nil {
+		sourceMap, _ = chariot.ExtractSourceMap(program)
+	}
+
+	logLevel, err := executionLogLevel(c.QueryParam("log_level"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	tags, err := tagParams(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	priority, err := executionPriority(c.QueryParam("priority"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+
+	session := c.Get("session").(*chariot.Session)
+	done, ok, err := h.admitExecution(c, session.UserID)
+	if !ok {
+		return err
+	}
+	rt, release, err := executionRuntime(session, c.QueryParam("runtime"))
+	if err != nil {
+		done()
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	runtimeRelease := release
+	release = func() { runtimeRelease(); done() }
+	execCtx := h.startExecution(session, rt, release, program, strings.TrimSuffix(file, ".json")+".ch", sourceMap, executionOptions{
+		Record:   c.QueryParam("record") == "true",
+		DryRun:   c.QueryParam("dryRun") == "true",
+		LogLevel: logLevel,
+		Tags:     tags,
+		Priority: priority,
+	})
+
+	return c.JSON(http.StatusOK, ResultJSON{
+		Result: "OK",
+		Data: map[string]string{
+			"execution_id": execCtx.ID,
+			"diagram":      diagram.Name,
+			"code_source":  codeSource,
+		},
+	})
+}
+
+// componentInfo describes a diagram published to the component library.
+type componentInfo struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Parameters  []string  `json:"parameters"`
+	Scope       string    `json:"scope"`
+	Modified    time.Time `json:"modified"`
+}
+
+// ListComponents returns the diagrams marked as components, which Sub Diagram
+// blocks can reference by name. Sandbox components are listed before global
+// ones and shadow global components with the same name.
+func (h *Handlers) ListComponents(c echo.Context) error {
+	base, scope, err := resolveDiagramBase(c, c.QueryParam("scope"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	setScopeHeader(c, scope)
+	bases := []string{base}
+	scopes := []cfg.StorageScope{scope}
+	if scope != cfg.StorageScopeGlobal {
+		if global, _, err := resolveDiagramBase(c, string(cfg.StorageScopeGlobal)); err == nil {
+			bases = append(bases, global)
+			scopes = append(scopes, cfg.StorageScopeGlobal)
+		}
+	}
+	seen := make(map[string]bool)
+	out := make([]componentInfo, 0)
+	for i, dir := range bases {
+		entries, err := storage.Default().ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := strings.TrimSuffix(e.Name, ".json")
+			if !strings.HasSuffix(e.Name, ".json") || seen[name] {
+				continue
+			}
+			data, err := storage.Default().ReadFile(filepath.Join(dir, e.Name))
+			if err != nil {
+				continue
+			}
+			diagram, err := codegen.ParseDiagram(data)
+			if err != nil || !diagram.Component {
+				continue
+			}
+			seen[name] = true
+			info := componentInfo{Name: name, Description: diagram.Description, Parameters: diagram.Parameters, Scope: string(scopes[i]), Modified: e.Modified}
+			if info.Parameters == nil {
+				info.Parameters = []string{}
+			}
+			out = append(out, info)
+		}
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: out})
+}
+
+// componentResolver loads sub-diagrams from the caller's diagram directory,
+// falling back to global storage.
+func componentResolver(c echo.Context, base string) codegen.ComponentResolver {
+	return func(name string) (*codegen.Diagram, error) {
+		file, err := sanitizeDiagramName(name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := storage.Default().ReadFile(filepath.Join(base, file))
+		if errors.Is(err, fs.ErrNotExist) {
+			if global, _, gerr := resolveDiagramBase(c, string(cfg.StorageScopeGlobal)); gerr == nil {
+				data, err = storage.Default().ReadFile(filepath.Join(global, file))
+			}
+		}
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, errors.New("diagram not found")
+			}
+			return nil, err
+		}
+		return codegen.ParseDiagram(data)
+	}
+}
+
+// ValidateDiagram checks a diagram for structural problems without saving or
+// running it. The body is the diagram JSON, either bare or wrapped in the
+// {"content": ...} envelope used by SaveDiagram. With ?listener=true the code
+// a listener would run is also checked against the listener guardrails of
+// the caller, and the report includes its estimated cost.
+func (h *Handlers) ValidateDiagram(c echo.Context) error {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil || len(body) == 0 {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
+	}
+	var envelope struct {
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil && len(envelope.Content) > 0 {
+		body = envelope.Content
+	}
+	diagram, err := codegen.ParseDiagram(body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	if c.QueryParam("listener") != "true" {
+		return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: codegen.Validate(diagram)})
+	}
+	base, scope, err := resolveDiagramBase(c, c.QueryParam("scope"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	setScopeHeader(c, scope)
+	owner := ""
+	if sess, ok := c.Get("session").(*chariot.Session); ok && sess != nil {
+		owner = sess.UserID
+	}
+	report, _ := codegen.ValidateForListener(diagram, componentResolver(c, base), h.listenerLimits(owner))
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: report})
+}
+
+// listenerLimits are the guardrails of the code run by a diagram listener
+// owned by userID: type checks against the bootstrap runtime, the listener
+// runs on, the owner's sandbox profile and CHARIOT_LISTENER_MAX_COST.
+func (h *Handlers) listenerLimits(userID string) codegen.ListenerLimits {
+	return codegen.ListenerLimits{
+		Runtime: h.bootstrapRuntime,
+		Sandbox: chariot.SandboxProfileFor(userID),
+		MaxCost: cfg.ChariotConfig.ListenerMaxCost,
+	}
+}
+
+// listenerDiagramCode loads the named diagram for a listener and returns the
+// code it runs. A diagram failing the listener guardrails is refused with its
+// validation report, as ValidateDiagram returns it with ?listener=true; ok is
+// false once the response has been written.
+func (h *Handlers) listenerDiagramCode(c echo.Context, name, scopeHint, owner string) (code string, ok bool, err error) {
+	base, _, err := resolveDiagramBase(c, scopeHint)
+	if err != nil {
+		return "", false, c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	resolve := componentResolver(c, base)
+	diagram, err := resolve(name)
+	if err != nil {
+		return "", false, c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("diagram '%s': %v", name, err)})
+	}
+	if diagram.Name == "" {
+		diagram.Name = name
+	}
+	report, res := codegen.ValidateForListener(diagram, resolve, h.listenerLimits(owner))
+	if !report.Valid {
+		return "", false, c.JSON(http.StatusUnprocessableEntity, ResultJSON{Result: "ERROR", Data: report})
+	}
+	return res.Code, true, nil
+}
+
+// checkListenerCode is the listener manager's preflight: the code of a
+// diagram listener is checked again before each start, since the owner's
+// sandbox profile or the cost limit may have changed, or the listener may
+// have been imported from a workspace without being checked.
+func (h *Handlers) checkListenerCode(l listeners.Listener) error {
+	code := l.OnStart
+	if l.Type == listeners.TypeWatch {
+		code = l.Script
+	}
+	issues, _ := codegen.CheckCode(&codegen.Result{Code: code}, h.listenerLimits(l.Owner))
+	if len(issues) == 0 {
+		return nil
+	}
+	messages := make([]string, len(issues))
+	for i, is := range issues {
+		messages[i] = is.Message
+	}
+	return fmt.Errorf("diagram '%s' fails the listener guardrails: %s", l.Diagram, strings.Join(messages, "; "))
+}
+
+// DiagramFromCode converts Chariot code into a diagram. The report lists
+// statements that have no block equivalent; the diagram reproduces the code
+// exactly only when report.complete is true.
+func (h *Handlers) DiagramFromCode(c echo.Context) error {
+	var req struct {
+		Code string `json:"code"`
+		Name string `json:"name"`
+	}
+	if err := c.Bind(&req); err != nil || strings.TrimSpace(req.Code) == "" {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "missing code"})
+	}
+	diagram, report, err := codegen.FromCode(req.Code, req.Name)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]interface{}{
+		"diagram": diagram,
+		"report":  report,
+	}})
+}
+
+// resolveSourceMap picks the source map for an execution request: an explicit
+// map, one embedded in the program, or the map stored with the named diagram.
+func resolveSourceMap(c echo.Context, explicit *chariot.DiagramSourceMap, program, diagram, scopeHint string) *chariot.DiagramSourceMap {
+	if explicit != nil {
+		return explicit
+	}
+	if sm, ok := chariot.ExtractSourceMap(program); ok {
+		return sm
+	}
+	if diagram == "" {
+		return nil
+	}
+	base, _, err := resolveDiagramBase(c, scopeHint)
+	if err != nil {
+		return nil
+	}
+	file, err := sanitizeDiagramName(diagram)
+	if err != nil {
+		return nil
+	}
+	data, err := storage.Default().ReadFile(filepath.Join(base, file))
+	if err != nil {
+		return nil
+	}
+	var stored struct {
+		SourceMap *chariot.DiagramSourceMap `json:"sourceMap"`
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil
+	}
+	return stored.SourceMap
+}
+
 func resolveDiagramBase(c echo.Context, scopeHint string) (string, cfg.StorageScope, error) {
 	scope := cfg.ResolveStorageScope(scopeHint)
 	var username string
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/labstack/echo/v4"
+)
+
+// FunctionDocs returns the function reference: the builtins, and the user
+// functions of the session runtime (the bootstrap runtime's without a
+// session) with their doc comments. JSON unless format=html is given or the
+// client asks for text/html.
+//
+//	GET /api/docs/functions?format=html
+func (h *Handlers) FunctionDocs(c echo.Context) error {
+	builtins, functions := chariot.FunctionDocs(h.referenceRuntime(c))
+
+	format := c.QueryParam("format")
+	if format == "" && strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMETextHTML) {
+		format = "html"
+	}
+	if format != "html" {
+		return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]interface{}{
+			"builtins":  builtins,
+			"functions": functions,
+		}})
+	}
+	var buf bytes.Buffer
+	if err := functionDocsTemplate.Execute(&buf, map[string]interface{}{
+		"Builtins":  builtins,
+		"Functions": functions,
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.HTML(http.StatusOK, buf.String())
+}
+
+// Builtins lists the builtins with their category, signature, summary and
+// example. The editor builds its highlighting and completion from it.
+//
+//	GET /api/builtins
+func (h *Handlers) Builtins(c echo.Context) error {
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: chariot.Builtins(h.referenceRuntime(c))})
+}
+
+// referenceRuntime is the runtime whose functions are described: the
+// session's, else the bootstrap runtime, else a fresh one.
+func (h *Handlers) referenceRuntime(c echo.Context) *chariot.Runtime {
+	if sess, ok := c.Get("session").(*chariot.Session); ok && sess != nil && sess.Runtime != nil {
+		return sess.Runtime
+	}
+	if h.bootstrapRuntime != nil {
+		return h.bootstrapRuntime
+	}
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	return rt
+}
+
+var functionDocsTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>Chariot Function Reference</title>
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; margin: 0; display: flex; }
+        nav { width: 240px; height: 100vh; overflow-y: auto; position: sticky; top: 0; background: #f5f5f5; padding: 12px; box-sizing: border-box; font-size: 13px; }
+        nav a { display: block; color: #333; text-decoration: none; padding: 1px 0; }
+        nav input { width: 100%; box-sizing: border-box; margin-bottom: 8px; }
+        main { flex: 1; padding: 20px 32px; max-width: 900px; }
+        .fn { border-bottom: 1px solid #eee; padding: 10px 0; }
+        .sig { font-family: monospace; font-size: 15px; font-weight: bold; }
+        .summary { white-space: pre-wrap; margin: 6px 0; }
+        .deprecated { color: #b00; }
+        .muted { color: #888; }
+        table { border-collapse: collapse; font-size: 14px; }
+        td { padding: 2px 12px 2px 0; vertical-align: top; }
+    </style>
+</head>
+<body>
+<nav>
+    <input id="filter" placeholder="Filter" oninput="filter(this.value)">
+    <strong>Functions</strong>
+    {{range .Functions}}<a href="#fn-{{.Name}}" data-name="{{.Name}}">{{.Name}}</a>{{end}}
+    <strong>Builtins</strong>
+    {{range .Builtins}}<a href="#builtin-{{.Name}}" data-name="{{.Name}}">{{.Name}}</a>{{end}}
+</nav>
+<main>
+    <h1>Functions</h1>
+    {{range .Functions}}
+    <div class="fn" id="fn-{{.Name}}" data-name="{{.Name}}">
+        <div class="sig">{{.Signature}}</div>
+        {{if .Deprecated}}<div class="deprecated">Deprecated{{if .Note}}: {{.Note}}{{end}}</div>{{end}}
+        {{if .Summary}}<div class="summary">{{.Summary}}</div>{{else}}<div class="muted">Not documented</div>{{end}}
+        {{if .Params}}<table>{{range .Params}}<tr><td><code>{{.Name}}</code></td><td>{{.Type}}</td><td>{{.Description}}</td></tr>{{end}}</table>{{end}}
+        {{if .Returns}}<div>Returns {{if .ReturnType}}<code>{{.ReturnType}}</code> {{end}}{{.Returns}}</div>{{end}}
+    </div>
+    {{else}}<p class="muted">No user functions.</p>{{end}}
+    <h1>Builtins</h1>
+    {{range .Builtins}}
+    <div class="fn" id="builtin-{{.Name}}" data-name="{{.Name}}">
+        <div class="sig">{{.Signature}} <span class="muted">{{.Category}}</span></div>
+        {{if .Summary}}<div class="summary">{{.Summary}}</div>{{end}}
+        {{if .Example}}<pre>{{.Example}}</pre>{{end}}
+    </div>
+    {{end}}
+</main>
+<script>
+    function filter(text) {
+        text = text.toLowerCase();
+        document.querySelectorAll('[data-name]').forEach(function (el) {
+            el.style.display = el.dataset.name.toLowerCase().includes(text) ? '' : 'none';
+        });
+    }
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/storage"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Function library versions are kept next to the library file, under
+// <library>.versions/ in the tree path: one file per version plus
+// versions.json recording their state. A new version is staged, tested and
+// then activated, which writes it over the library file and swaps its
+// functions into the bootstrap runtime between two listener runs. Rollback
+// activates the version that was active before.
+
+// Library version states.
+const (
+	LibraryStaged    = "staged"
+	LibraryActive    = "active"
+	LibraryPrevious  = "previous"  // active before the current one; rollback target
+	LibraryInactive  = "inactive"  // superseded
+	LibraryDiscarded = "discarded" // staged, then replaced by another staged version
+)
+
+// libraryTestTimeout bounds each library test function.
+const libraryTestTimeout = 30 * time.Second
+
+// LibraryTestResult is the outcome of one library test function.
+type LibraryTestResult struct {
+	Name     string `json:"name"`
+	Passed   bool   `json:"passed"`
+	Error    string `json:"error,omitempty"`
+	Duration int64  `json:"duration_ms"`
+}
+
+// LibraryTestReport is the outcome of a version's test suite: the library
+// functions whose names start with "test" and take no parameters. A test
+// passes when it returns anything but false without an error.
+type LibraryTestReport struct {
+	Passed  bool                `json:"passed"`
+	Ran     time.Time           `json:"ran"`
+	Results []LibraryTestResult `json:"results"`
+}
+
+// LibraryVersion describes one version of the function library.
+type LibraryVersion struct {
+	Version   string             `json:"version"`
+	Status    string             `json:"status"`
+	Note      string             `json:"note,omitempty"`
+	Functions int                `json:"functions"`
+	Created   time.Time          `json:"created"`
+	Activated time.Time          `json:"activated,omitempty"`
+	Tests     *LibraryTestReport `json:"tests,omitempty"`
+}
+
+type libraryState struct {
+	Next     int               `json:"next"`
+	Versions []*LibraryVersion `json:"versions"`
+}
+
+func (s *libraryState) find(version string) *LibraryVersion {
+	for _, v := range s.Versions {
+		if v.Version == version {
+			return v
+		}
+	}
+	return nil
+}
+
+func (s *libraryState) withStatus(status string) *LibraryVersion {
+	for _, v := range s.Versions {
+		if v.Status == status {
+			return v
+		}
+	}
+	return nil
+}
+
+var (
+	errLibraryVersionNotFound = errors.New("library version not found")
+	errLibraryTestsFailed     = errors.New("library version failed its tests")
+	errNoPreviousLibrary      = errors.New("no previous library version to roll back to")
+)
+
+// libraryMu serializes changes to the library versions.
+var libraryMu sync.Mutex
+
+func libraryVersionsDir() string {
+	return strings.TrimSuffix(cfg.ChariotConfig.FunctionLib, filepath.Ext(cfg.ChariotConfig.FunctionLib)) + ".versions"
+}
+
+func libraryVersionFile(version string) string {
+	return filepath.Join(libraryVersionsDir(), version+".json")
+}
+
+func loadLibraryState() (*libraryState, error) {
+	data, err := storage.Default().ReadFile(filepath.Join(cfg.ChariotConfig.TreePath, libraryVersionsDir(), "versions.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return &libraryState{Next: 1}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st libraryState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func saveLibraryState(st *libraryState) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return storage.Default().WriteFile(filepath.Join(cfg.ChariotConfig.TreePath, libraryVersionsDir(), "versions.json"), data)
+}
+
+// StageLibraryVersion saves functions as a new staged version, merged over
+// the current library unless replace is set. A version staged earlier and
+// never activated is discarded. The first version staged also records the
+// current library as the active version, so it can be rolled back to.
+func StageLibraryVersion(functions map[string]*chariot.FunctionValue, note string, replace bool) (*LibraryVersion, error) {
+	if cfg.ChariotConfig.FunctionLib == "" {
+		return nil, errors.New("function_lib not configured")
+	}
+	libraryMu.Lock()
+	defer libraryMu.Unlock()
+	st, err := loadLibraryState()
+	if err != nil {
+		return nil, err
+	}
+	current, err := chariot.LoadFunctionsFromFile(cfg.ChariotConfig.FunctionLib)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	now := time.Now()
+	if st.withStatus(LibraryActive) == nil && current != nil {
+		v := &LibraryVersion{Version: fmt.Sprintf("v%d", st.Next), Status: LibraryActive, Note: "library in use when versioning began", Functions: len(current), Created: now, Activated: now}
+		if err := chariot.SaveFunctionsToFile(current, libraryVersionFile(v.Version)); err != nil {
+			return nil, err
+		}
+		st.Versions = append(st.Versions, v)
+		st.Next++
+	}
+	staged := functions
+	if !replace {
+		staged = make(map[string]*chariot.FunctionValue, len(current)+len(functions))
+		for k, v := range current {
+			staged[k] = v
+		}
+		for k, v := range functions {
+			staged[k] = v
+		}
+	}
+	v := &LibraryVersion{Version: fmt.Sprintf("v%d", st.Next), Status: LibraryStaged, Note: note, Functions: len(staged), Created: now}
+	if err := chariot.SaveFunctionsToFile(staged, libraryVersionFile(v.Version)); err != nil {
+		return nil, err
+	}
+	if old := st.withStatus(LibraryStaged); old != nil {
+		old.Status = LibraryDiscarded
+	}
+	st.Versions = append(st.Versions, v)
+	st.Next++
+	return v, saveLibraryState(st)
+}
+
+// testRuntime returns a runtime like the bootstrap runtime with the
+// functions of a library version in place of the active library's.
+func (h *Handlers) testRuntime(functions map[string]*chariot.FunctionValue) *chariot.Runtime {
+	var rt *chariot.Runtime
+	if h.bootstrapRuntime != nil {
+		rt = h.bootstrapRuntime.CloneRuntime()
+	} else {
+		rt = chariot.NewRuntime()
+		chariot.RegisterAll(rt)
+	}
+	active, _ := chariot.LoadFunctionsFromFile(cfg.ChariotConfig.FunctionLib)
+	swapLibraryFunctions(rt, active, functions)
+	return rt
+}
+
+// swapLibraryFunctions replaces the functions of library old in rt with
+// those of library new; functions rt got elsewhere are kept.
+func swapLibraryFunctions(rt *chariot.Runtime, old, new map[string]*chariot.FunctionValue) {
+	existing := rt.ListUserFunctionsMap()
+	for name := range old {
+		if _, keep := new[name]; !keep && existing[name] != nil {
+			rt.DeleteFunction(name)
+		}
+	}
+	for name, fn := range new {
+		rt.RegisterFunction(name, fn)
+	}
+}
+
+// TestLibraryVersion runs a version's test suite in a copy of the bootstrap
+// runtime and records the report.
+func (h *Handlers) TestLibraryVersion(version string) (*LibraryTestReport, error) {
+	libraryMu.Lock()
+	defer libraryMu.Unlock()
+	return h.testLibraryVersionLocked(version)
+}
+
+func (h *Handlers) testLibraryVersionLocked(version string) (*LibraryTestReport, error) {
+	st, err := loadLibraryState()
+	if err != nil {
+		return nil, err
+	}
+	v := st.find(version)
+	if v == nil {
+		return nil, fmt.Errorf("%s: %w", version, errLibraryVersionNotFound)
+	}
+	functions, err := chariot.LoadFunctionsFromFile(libraryVersionFile(version))
+	if err != nil {
+		return nil, err
+	}
+	var tests []string
+	for name, fn := range functions {
+		if strings.HasPrefix(name, "test") && len(fn.Parameters) == 0 {
+			tests = append(tests, name)
+		}
+	}
+	sort.Strings(tests)
+	rt := h.testRuntime(functions)
+	report := &LibraryTestReport{Passed: true, Ran: time.Now(), Results: []LibraryTestResult{}}
+	for _, name := range tests {
+		res := LibraryTestResult{Name: name}
+		start := time.Now()
+		ast, err := chariot.ParseSource(name+"()", name)
+		var val chariot.Value
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), libraryTestTimeout)
+			val, err = rt.ExecContext(ctx, ast, nil)
+			cancel()
+		}
+		res.Duration = time.Since(start).Milliseconds()
+		switch {
+		case err != nil:
+			res.Error = err.Error()
+		case val == chariot.Bool(false):
+			res.Error = "returned false"
+		default:
+			res.Passed = true
+		}
+		report.Passed = report.Passed && res.Passed
+		report.Results = append(report.Results, res)
+	}
+	v.Tests = report
+	return report, saveLibraryState(st)
+}
+
+// ActivateLibraryVersion makes a version the function library: its tests
+// must pass (they are run if they have not been) unless force is set. The
+// library file is replaced and the bootstrap runtime's functions swapped
+// while no listener script runs, and the version active until then becomes
+// the rollback target.
+func (h *Handlers) ActivateLibraryVersion(version string, force bool) (*LibraryVersion, error) {
+	libraryMu.Lock()
+	defer libraryMu.Unlock()
+	return h.activateLibraryVersionLocked(version, force)
+}
+
+func (h *Handlers) activateLibraryVersionLocked(version string, force bool) (*LibraryVersion, error) {
+	st, err := loadLibraryState()
+	if err != nil {
+		return nil, err
+	}
+	v := st.find(version)
+	if v == nil {
+		return nil, fmt.Errorf("%s: %w", version, errLibraryVersionNotFound)
+	}
+	if v.Status == LibraryActive {
+		return v, nil
+	}
+	if !force && v.Status == LibraryStaged {
+		if v.Tests == nil {
+			if _, err := h.testLibraryVersionLocked(version); err != nil {
+				return nil, err
+			}
+			if st, err = loadLibraryState(); err != nil {
+				return nil, err
+			}
+			v = st.find(version)
+		}
+		if !v.Tests.Passed {
+			return nil, fmt.Errorf("%s: %w", version, errLibraryTestsFailed)
+		}
+	}
+	functions, err := chariot.LoadFunctionsFromFile(libraryVersionFile(version))
+	if err != nil {
+		return nil, err
+	}
+	data, err := storage.Default().ReadFile(filepath.Join(cfg.ChariotConfig.TreePath, libraryVersionFile(version)))
+	if err != nil {
+		return nil, err
+	}
+	active, _ := chariot.LoadFunctionsFromFile(cfg.ChariotConfig.FunctionLib)
+	if err := storage.Default().WriteFile(filepath.Join(cfg.ChariotConfig.TreePath, cfg.ChariotConfig.FunctionLib), data); err != nil {
+		return nil, err
+	}
+	if h.bootstrapRuntime != nil {
+		swapLibraryFunctions(h.bootstrapRuntime, active, functions)
+	}
+	if h.listenerManager != nil {
+		// Listener runtimes created from now on copy the bootstrap's functions
+		h.listenerManager.ForEachRuntime(func(rt *chariot.Runtime) { swapLibraryFunctions(rt, active, functions) })
+	}
+
+	for _, other := range st.Versions {
+		if other.Status == LibraryPrevious {
+			other.Status = LibraryInactive
+		}
+	}
+	if old := st.withStatus(LibraryActive); old != nil {
+		old.Status = LibraryPrevious
+	}
+	v.Status = LibraryActive
+	v.Activated = time.Now()
+	if err := saveLibraryState(st); err != nil {
+		return nil, err
+	}
+	cfg.ChariotLogger.Info("Function library version activated", zap.String("version", version), zap.Int("functions", len(functions)), zap.Bool("forced", force))
+	return v, nil
+}
+
+// RollbackLibrary activates the version that was active before the current
+// one; the current version becomes the rollback target in turn.
+func (h *Handlers) RollbackLibrary() (*LibraryVersion, error) {
+	libraryMu.Lock()
+	defer libraryMu.Unlock()
+	st, err := loadLibraryState()
+	if err != nil {
+		return nil, err
+	}
+	prev := st.withStatus(LibraryPrevious)
+	if prev == nil {
+		return nil, errNoPreviousLibrary
+	}
+	return h.activateLibraryVersionLocked(prev.Version, true)
+}
+
+func libraryError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errLibraryVersionNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errLibraryTestsFailed), errors.Is(err, errNoPreviousLibrary):
+		status = http.StatusConflict
+	}
+	return c.JSON(status, ResultJSON{Result: "ERROR", Data: err.Error()})
+}
+
+// ListLibraryVersions lists the function library versions, newest first.
+//
+//	GET /api/library/versions
+func (h *Handlers) ListLibraryVersions(c echo.Context) error {
+	libraryMu.Lock()
+	st, err := loadLibraryState()
+	libraryMu.Unlock()
+	if err != nil {
+		return libraryError(c, err)
+	}
+	out := map[string]any{}
+	versions := make([]*LibraryVersion, 0, len(st.Versions))
+	for i := len(st.Versions) - 1; i >= 0; i-- {
+		v := st.Versions[i]
+		versions = append(versions, v)
+		if v.Status == LibraryActive || v.Status == LibraryPrevious || v.Status == LibraryStaged {
+			out[v.Status] = v.Version
+		}
+	}
+	out["versions"] = versions
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: out})
+}
+
+// GetLibraryVersion describes a library version and lists its functions.
+//
+//	GET /api/library/versions/:version
+func (h *Handlers) GetLibraryVersion(c echo.Context) error {
+	version := c.Param("version")
+	libraryMu.Lock()
+	st, err := loadLibraryState()
+	libraryMu.Unlock()
+	if err != nil {
+		return libraryError(c, err)
+	}
+	v := st.find(version)
+	if v == nil {
+		return libraryError(c, fmt.Errorf("%s: %w", version, errLibraryVersionNotFound))
+	}
+	functions, err := chariot.LoadFunctionsFromFile(libraryVersionFile(version))
+	if err != nil {
+		return libraryError(c, err)
+	}
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: struct {
+		*LibraryVersion
+		Names []string `json:"names"`
+	}{v, names}})
+}
+
+// StageLibrary stages a new library version: the functions given, over the
+// current library unless replace is set.
+//
+//	POST /api/library/versions {"functions": {name: definition}, "note": "...", "replace": false}
+func (h *Handlers) StageLibrary(c echo.Context) error {
+	var req struct {
+		Functions map[string]map[string]interface{} `json:"functions"`
+		Note      string                            `json:"note"`
+		Replace   bool                              `json:"replace"`
+	}
+	if err := c.Bind(&req); err != nil || len(req.Functions) == 0 {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "no functions provided"})
+	}
+	functions := make(map[string]*chariot.FunctionValue, len(req.Functions))
+	for name, m := range req.Functions {
+		fv, err := chariot.MapToFunctionValue(m)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("invalid function '%s': %v", name, err)})
+		}
+		fv.Name = name
+		functions[name] = fv
+	}
+	v, err := StageLibraryVersion(functions, req.Note, req.Replace)
+	if err != nil {
+		return libraryError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: v})
+}
+
+// TestLibrary runs a library version's test suite.
+//
+//	POST /api/library/versions/:version/test
+func (h *Handlers) TestLibrary(c echo.Context) error {
+	report, err := h.TestLibraryVersion(c.Param("version"))
+	if err != nil {
+		return libraryError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: report})
+}
+
+// ActivateLibrary activates a library version once its tests pass, or
+// regardless with force.
+//
+//	POST /api/library/versions/:version/activate {"force": false}
+func (h *Handlers) ActivateLibrary(c echo.Context) error {
+	var req struct {
+		Force bool `json:"force"`
+	}
+	_ = c.Bind(&req)
+	v, err := h.ActivateLibraryVersion(c.Param("version"), req.Force)
+	if err != nil {
+		return libraryError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: v})
+}
+
+// RollbackLibraryHandler reactivates the previous library version.
+//
+//	POST /api/library/rollback
+func (h *Handlers) RollbackLibraryHandler(c echo.Context) error {
+	v, err := h.RollbackLibrary()
+	if err != nil {
+		return libraryError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: v})
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/labstack/echo/v4"
+)
+
+// LintDiagnostic is one problem found in a program without running it.
+type LintDiagnostic struct {
+	Kind    string `json:"kind"` // syntax | type
+	Message string `json:"message"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+}
+
+// Lint parses a program and type-checks it against the builtins and the
+// functions of the session runtime, without running it. A syntax error is
+// the only diagnostic, since checking needs the parsed program.
+//
+//	POST /api/lint {"program": "...", "filename": "main.ch"}
+func (h *Handlers) Lint(c echo.Context) error {
+	var req struct {
+		Program  string `json:"program"`
+		Filename string `json:"filename"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
+	}
+	if req.Filename == "" {
+		req.Filename = "main.ch"
+	}
+	diagnostics := []LintDiagnostic{}
+	program, err := chariot.ParseSource(req.Program, req.Filename)
+	if err != nil {
+		info := chariot.DescribeError(err)
+		diagnostics = append(diagnostics, LintDiagnostic{Kind: "syntax", Message: info.Message, File: info.File, Line: info.Line, Column: info.Column})
+		return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]interface{}{"diagnostics": diagnostics}})
+	}
+	rt := h.bootstrapRuntime
+	if sess, ok := c.Get("session").(*chariot.Session); ok && sess != nil && sess.Runtime != nil {
+		rt = sess.Runtime
+	}
+	for _, te := range chariot.CheckTypes(program, rt) {
+		diagnostics = append(diagnostics, LintDiagnostic{Kind: "type", Message: te.Message, File: te.Pos.File, Line: te.Pos.Line, Column: te.Pos.Column})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]interface{}{"diagnostics": diagnostics}})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/deadletter"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/listeners"
+	"github.com/labstack/echo/v4"
+)
+
+// listenerRuntimeError maps an error of the listener runtime APIs to its
+// HTTP status.
+func listenerRuntimeError(c echo.Context, err error) error {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, listeners.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, listeners.ErrRunning):
+		status = http.StatusConflict
+	case c.Request().Context().Err() != nil:
+		status = http.StatusServiceUnavailable
+	}
+	return c.JSON(status, ResultJSON{Result: "ERROR", Data: err.Error()})
+}
+
+// ListenerRuntime describes the dedicated runtime of a listener: when it was
+// created, how many scripts ran on it, its imports, the names of its env
+// variables and how much state it holds.
+//
+//	GET /api/listeners/:name/runtime
+func (h *Handlers) ListenerRuntime(c echo.Context) error {
+	info, err := h.listenerManager.Runtime(c.Request().Context(), c.Param("name"))
+	if err != nil {
+		return listenerRuntimeError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: info})
+}
+
+// InspectListenerRuntime returns part of the state of a listener's runtime,
+// taking the parameters of InspectRuntime. A since cursor gets a full
+// listing, since cursors are kept per session runtime only.
+//
+//	GET /api/listeners/:name/runtime/inspect?path=globals&depth=2
+func (h *Handlers) InspectListenerRuntime(c echo.Context) error {
+	q, err := inspectQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	state, err := h.listenerManager.InspectRuntime(c.Request().Context(), c.Param("name"))
+	if err != nil {
+		return listenerRuntimeError(c, err)
+	}
+	res, err := chariot.NewRuntimeInspector().Inspect(state, q)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, chariot.ErrInspectPath) {
+			status = http.StatusNotFound
+		}
+		return c.JSON(status, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: res})
+}
+
+// ResetListenerRuntime discards the runtime of a stopped listener, so its
+// next start runs its imports and on_start on a fresh one. Returns 409
+// while the listener runs.
+//
+//	POST /api/listeners/:name/runtime/reset
+func (h *Handlers) ResetListenerRuntime(c echo.Context) error {
+	name := c.Param("name")
+	if err := h.listenerManager.ResetRuntime(name); err != nil {
+		return listenerRuntimeError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]string{"reset": name}})
+}
+
+// InvokeListener runs the script of a running service listener for the
+// JSON payload in the body, within the listener's concurrency settings.
+// Returns 409 when the listener is stopped, and 503 with Retry-After when
+// it is too busy to take the invocation. A payload whose script fails is
+// kept as a dead letter.
+//
+//	POST /api/listeners/:name/invoke {"order": 42}
+func (h *Handlers) InvokeListener(c echo.Context) error {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
+	}
+	var payload interface{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid JSON payload"})
+		}
+	}
+	name := c.Param("name")
+	err = h.listenerManager.Invoke(c.Request().Context(), name, chariot.FromNative(payload))
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]string{"invoked": name}})
+	case errors.Is(err, listeners.ErrBusy):
+		c.Response().Header().Set("Retry-After", "1")
+		return c.JSON(http.StatusServiceUnavailable, ResultJSON{Result: "ERROR", Data: err.Error()})
+	case errors.Is(err, listeners.ErrNotFound):
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: err.Error()})
+	case errors.Is(err, listeners.ErrNotRunning):
+		return c.JSON(http.StatusConflict, ResultJSON{Result: "ERROR", Data: err.Error()})
+	case c.Request().Context().Err() != nil:
+		return c.JSON(http.StatusServiceUnavailable, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	letter := deadletter.Letter{Source: deadletter.SourceListener, Target: name, Error: err.Error()}
+	if payload != nil {
+		letter.Payload = body
+	}
+	if sess, ok := c.Get("session").(*chariot.Session); ok && sess != nil {
+		letter.Owner = sess.UserID
+	}
+	h.addDeadLetter(letter)
+	return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: chariot.DescribeError(err)})
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/labstack/echo/v4"
+)
+
+// FileLease is an advisory edit lease on a file. While a session holds the
+// lease, saves and deletes of the file from other sessions are rejected.
+type FileLease struct {
+	File     string    `json:"file"`
+	Scope    string    `json:"scope"`
+	Holder   string    `json:"holder"`
+	Acquired time.Time `json:"acquired"`
+
+	path      string
+	sessionID string
+	table     *FileLeases
+}
+
+// Close releases the lease. Leases are registered as session resources, so
+// they end with the session that acquired them.
+func (l *FileLease) Close() error {
+	l.table.release(l)
+	return nil
+}
+
+// FileLeases tracks edit leases by absolute file path.
+type FileLeases struct {
+	mu     sync.Mutex
+	leases map[string]*FileLease
+}
+
+// NewFileLeases creates an empty lease table.
+func NewFileLeases() *FileLeases {
+	return &FileLeases{leases: make(map[string]*FileLease)}
+}
+
+// Acquire grants the lease on path to the session, or returns the lease held
+// by another session. Acquiring a lease the session already holds returns it.
+func (t *FileLeases) Acquire(sess *chariot.Session, path, file, scope string) (lease *FileLease, conflict *FileLease) {
+	t.mu.Lock()
+	if held := t.leases[path]; held != nil {
+		t.mu.Unlock()
+		if held.sessionID == sess.ID {
+			return held, nil
+		}
+		return nil, held
+	}
+	holder := sess.Username
+	if holder == "" {
+		holder = sess.UserID
+	}
+	lease = &FileLease{File: file, Scope: scope, Holder: holder, Acquired: time.Now(), path: path, sessionID: sess.ID, table: t}
+	t.leases[path] = lease
+	t.mu.Unlock()
+	sess.AddResource("filelease:"+path, lease)
+	return lease, nil
+}
+
+// Release drops the session's lease on path. It reports false when the
+// session does not hold the lease.
+func (t *FileLeases) Release(sess *chariot.Session, path string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	held := t.leases[path]
+	if held == nil || held.sessionID != sess.ID {
+		return false
+	}
+	delete(t.leases, path)
+	return true
+}
+
+// Conflict returns the lease blocking the session from writing path, if any.
+func (t *FileLeases) Conflict(sess *chariot.Session, path string) *FileLease {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if held := t.leases[path]; held != nil && held.sessionID != sess.ID {
+		return held
+	}
+	return nil
+}
+
+// Under lists the leases on files inside dir, ordered by file name.
+func (t *FileLeases) Under(dir string) []FileLease {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]FileLease, 0)
+	for path, l := range t.leases {
+		if filepath.Dir(path) == dir {
+			out = append(out, *l)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].File < out[j].File })
+	return out
+}
+
+func (t *FileLeases) release(l *FileLease) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.leases[l.path] == l {
+		delete(t.leases, l.path)
+	}
+}
+
+// leaseConflict is the 409 response for a write blocked by another session's lease.
+func leaseConflict(c echo.Context, held *FileLease) error {
+	return c.JSON(http.StatusConflict, ResultJSON{Result: "ERROR", Data: map[string]interface{}{
+		"message":  "file is locked by " + held.Holder,
+		"holder":   held.Holder,
+		"acquired": held.Acquired,
+	}})
+}
+
+// filesDirFor resolves the files directory for the request's scope.
+func filesDirFor(c echo.Context, sess *chariot.Session) (string, cfg.StorageScope, error) {
+	username := sess.Username
+	if username == "" {
+		username = sess.UserID
+	}
+	scope := cfg.ResolveStorageScope(c.QueryParam("scope"))
+	baseDir, err := cfg.EnsureStorageBase(cfg.StorageKindData, scope, username)
+	if err != nil {
+		return "", scope, err
+	}
+	return filepath.Join(baseDir, "files"), scope, nil
+}
+
+// LockFile acquires an edit lease on a file: POST /api/file/lock {"name": ...}.
+// A lease held by another session is reported with 409 and the holder's name.
+func (h *Handlers) LockFile(c echo.Context) error {
+	sess, ok := c.Get("session").(*chariot.Session)
+	if !ok || sess == nil {
+		return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "session required"})
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.Bind(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "file name required"})
+	}
+	dir, scope, err := filesDirFor(c, sess)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	c.Response().Header().Set("X-Chariot-Scope", string(scope))
+	lease, held := h.fileLeases.Acquire(sess, filepath.Join(dir, req.Name), req.Name, string(scope))
+	if held != nil {
+		return leaseConflict(c, held)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: lease})
+}
+
+// UnlockFile releases the caller's lease: DELETE /api/file/lock?name=...
+func (h *Handlers) UnlockFile(c echo.Context) error {
+	sess, ok := c.Get("session").(*chariot.Session)
+	if !ok || sess == nil {
+		return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "session required"})
+	}
+	name := c.QueryParam("name")
+	if name == "" {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "file name required"})
+	}
+	dir, scope, err := filesDirFor(c, sess)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	c.Response().Header().Set("X-Chariot-Scope", string(scope))
+	if !h.fileLeases.Release(sess, filepath.Join(dir, name)) {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "no lease held on " + name})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListFileLocks returns the leases on files in the requested scope.
+func (h *Handlers) ListFileLocks(c echo.Context) error {
+	sess, ok := c.Get("session").(*chariot.Session)
+	if !ok || sess == nil {
+		return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "session required"})
+	}
+	dir, scope, err := filesDirFor(c, sess)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	c.Response().Header().Set("X-Chariot-Scope", string(scope))
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: h.fileLeases.Under(dir)})
+}
@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Notebook cell kinds. Only code cells run; markdown cells are kept as written.
+const (
+	notebookCellCode     = "code"
+	notebookCellMarkdown = "markdown"
+)
+
+// Notebook is a document of code and markdown cells. Code cells run one at a
+// time against the session runtime, so later cells see what earlier ones
+// defined, and each keeps the output of its last run.
+type Notebook struct {
+	Name     string         `json:"name"`
+	Cells    []NotebookCell `json:"cells"`
+	Modified time.Time      `json:"modified"`
+}
+
+// NotebookCell is one cell of a notebook.
+type NotebookCell struct {
+	ID     string          `json:"id"`
+	Kind   string          `json:"kind"` // code or markdown
+	Source string          `json:"source"`
+	Output *NotebookOutput `json:"output,omitempty"`
+}
+
+// NotebookOutput is the cached result of the last run of a code cell. It is
+// stale once the cell's source no longer matches the source that produced it.
+type NotebookOutput struct {
+	Result     string             `json:"result"` // OK or ERROR
+	Value      interface{}        `json:"value,omitempty"`
+	ValueType  string             `json:"valueType,omitempty"`
+	Error      *chariot.ErrorInfo `json:"error,omitempty"`
+	DurationMs float64            `json:"durationMs"`
+	RanAt      time.Time          `json:"ranAt"`
+	SourceHash string             `json:"sourceHash"`
+	Stale      bool               `json:"stale,omitempty"`
+}
+
+// notebookMu serializes read-modify-write cycles on notebook files, so
+// outputs of cells run concurrently are not lost.
+var notebookMu sync.Mutex
+
+func sanitizeNotebookName(name string) (string, error) {
+	n := strings.TrimSpace(name)
+	if n == "" {
+		return "", errors.New("empty notebook name")
+	}
+	// Prevent path traversal by removing any path separators
+	n = strings.ReplaceAll(n, string(os.PathSeparator), "_")
+	n = strings.ReplaceAll(n, "/", "_")
+	n = strings.TrimSuffix(n, ".chnb")
+	return n + ".chnb", nil
+}
+
+func notebookSourceHash(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:8])
+}
+
+func resolveNotebookBase(c echo.Context, scopeHint string) (string, cfg.StorageScope, error) {
+	scope := cfg.ResolveStorageScope(scopeHint)
+	var username string
+	if scope == cfg.StorageScopeSandbox {
+		sess, _ := c.Get("session").(*chariot.Session)
+		if sess == nil || strings.TrimSpace(sess.Username) == "" {
+			return "", scope, errors.New("sandbox scope requires authenticated session")
+		}
+		username = sess.Username
+	}
+	base, err := cfg.EnsureStorageBase(cfg.StorageKindNotebook, scope, username)
+	if err != nil {
+		return "", scope, err
+	}
+	return base, scope, nil
+}
+
+// notebookPath resolves the file of the notebook named in the request.
+func notebookPath(c echo.Context, name, scopeHint string) (string, error) {
+	base, scope, err := resolveNotebookBase(c, scopeHint)
+	if err != nil {
+		return "", err
+	}
+	file, err := sanitizeNotebookName(name)
+	if err != nil {
+		return "", err
+	}
+	setScopeHeader(c, scope)
+	return filepath.Join(base, file), nil
+}
+
+func loadNotebook(path string) (*Notebook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var nb Notebook
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return nil, fmt.Errorf("invalid notebook: %w", err)
+	}
+	markStaleOutputs(&nb)
+	return &nb, nil
+}
+
+func saveNotebook(path string, nb *Notebook) error {
+	nb.Modified = time.Now().UTC()
+	data, err := json.MarshalIndent(nb, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func markStaleOutputs(nb *Notebook) {
+	for i := range nb.Cells {
+		if out := nb.Cells[i].Output; out != nil {
+			out.Stale = out.SourceHash != notebookSourceHash(nb.Cells[i].Source)
+		}
+	}
+}
+
+// normalizeNotebookCells validates cells and assigns IDs to new ones. A cell
+// keeps the cached output of the stored cell with the same ID.
+func normalizeNotebookCells(cells []NotebookCell, previous *Notebook) ([]NotebookCell, error) {
+	outputs := map[string]*NotebookOutput{}
+	if previous != nil {
+		for _, cell := range previous.Cells {
+			outputs[cell.ID] = cell.Output
+		}
+	}
+	seen := map[string]bool{}
+	out := make([]NotebookCell, 0, len(cells))
+	for i, cell := range cells {
+		switch cell.Kind {
+		case "":
+			cell.Kind = notebookCellCode
+		case notebookCellCode, notebookCellMarkdown:
+		default:
+			return nil, fmt.Errorf("cell %d: unknown kind %q (want %s or %s)", i, cell.Kind, notebookCellCode, notebookCellMarkdown)
+		}
+		if cell.ID == "" {
+			cell.ID = uuid.New().String()[:8]
+		}
+		if seen[cell.ID] {
+			return nil, fmt.Errorf("cell %d: duplicate id %q", i, cell.ID)
+		}
+		seen[cell.ID] = true
+		cell.Output = nil
+		if cell.Kind == notebookCellCode {
+			cell.Output = outputs[cell.ID]
+		}
+		out = append(out, cell)
+	}
+	return out, nil
+}
+
+// runNotebookCell runs a code cell on rt and returns its output.
+func runNotebookCell(rt *chariot.Runtime, nbName string, cell NotebookCell) (out *NotebookOutput) {
+	out = &NotebookOutput{RanAt: time.Now().UTC(), SourceHash: notebookSourceHash(cell.Source)}
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			out.Result, out.Value, out.ValueType = "ERROR", nil, ""
+			out.Error = &chariot.ErrorInfo{Message: fmt.Sprintf("panic: %v", r)}
+		}
+		out.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	}()
+	// Cells share the runtime's scope, so a cell sees what earlier ones set
+	val, err := rt.EvaluateWithFilename(cell.Source, nbName+"#"+cell.ID)
+	if err != nil {
+		out.Result = "ERROR"
+		out.Error = chariot.DescribeError(err)
+		return out
+	}
+	if entry, ok := val.(chariot.ScopeEntry); ok {
+		val = entry.Value
+	}
+	out.Result = "OK"
+	out.Value = convertValueToJSON(val)
+	out.ValueType = chariot.GetValueTypeSpec(val)
+	return out
+}
+
+// ListNotebooks returns the notebooks in the requested scope.
+//
+//	GET /api/notebooks?scope=sandbox|global
+func (h *Handlers) ListNotebooks(c echo.Context) error {
+	base, scope, err := resolveNotebookBase(c, c.QueryParam("scope"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	setScopeHeader(c, scope)
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	out := make([]diagramMeta, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".chnb") {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			out = append(out, diagramMeta{
+				Name:     strings.TrimSuffix(e.Name(), ".chnb"),
+				Size:     info.Size(),
+				Modified: info.ModTime(),
+			})
+		}
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: out})
+}
+
+// GetNotebook returns a notebook with the cached output of each code cell.
+//
+//	GET /api/notebooks/:name?scope=sandbox|global
+func (h *Handlers) GetNotebook(c echo.Context) error {
+	path, err := notebookPath(c, c.Param("name"), c.QueryParam("scope"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	nb, err := loadNotebook(path)
+	if err != nil {
+		return notebookError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: nb})
+}
+
+// SaveNotebook creates or replaces a notebook. Cells without an ID get one;
+// code cells keep the cached output stored under their ID.
+//
+//	POST /api/notebooks {"name": "...", "cells": [{"id", "kind", "source"}], "scope": "..."}
+func (h *Handlers) SaveNotebook(c echo.Context) error {
+	var req struct {
+		Name  string         `json:"name"`
+		Cells []NotebookCell `json:"cells"`
+		Scope string         `json:"scope"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
+	}
+	scopeHint := c.QueryParam("scope")
+	if scopeHint == "" {
+		scopeHint = req.Scope
+	}
+	path, err := notebookPath(c, req.Name, scopeHint)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+
+	notebookMu.Lock()
+	defer notebookMu.Unlock()
+	previous, err := loadNotebook(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return notebookError(c, err)
+	}
+	cells, err := normalizeNotebookCells(req.Cells, previous)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	nb := &Notebook{Name: strings.TrimSuffix(filepath.Base(path), ".chnb"), Cells: cells}
+	markStaleOutputs(nb)
+	if err := saveNotebook(path, nb); err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: nb})
+}
+
+// DeleteNotebook removes a notebook.
+//
+//	DELETE /api/notebooks/:name?scope=sandbox|global
+func (h *Handlers) DeleteNotebook(c echo.Context) error {
+	path, err := notebookPath(c, c.Param("name"), c.QueryParam("scope"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	notebookMu.Lock()
+	defer notebookMu.Unlock()
+	if err := os.Remove(path); err != nil {
+		return notebookError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RunNotebookCell runs one code cell against the session runtime and caches
+// its output in the notebook.
+//
+//	POST /api/notebooks/:name/cells/:cell/run?scope=sandbox|global
+func (h *Handlers) RunNotebookCell(c echo.Context) error {
+	return h.runNotebook(c, c.Param("cell"), false)
+}
+
+// RunNotebook runs the notebook's code cells in order against the session
+// runtime, stopping at the first error. With ?from=<cell> it starts at that
+// cell, and ?stale=true runs only cells without a current output.
+//
+//	POST /api/notebooks/:name/run?scope=sandbox|global&from=&stale=
+func (h *Handlers) RunNotebook(c echo.Context) error {
+	return h.runNotebook(c, c.QueryParam("from"), true)
+}
+
+func (h *Handlers) runNotebook(c echo.Context, cellID string, rest bool) error {
+	session := c.Get("session").(*chariot.Session)
+	path, err := notebookPath(c, c.Param("name"), c.QueryParam("scope"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	onlyStale := c.QueryParam("stale") == "true"
+
+	notebookMu.Lock()
+	nb, err := loadNotebook(path)
+	notebookMu.Unlock()
+	if err != nil {
+		return notebookError(c, err)
+	}
+
+	start := 0
+	if cellID != "" {
+		start = -1
+		for i, cell := range nb.Cells {
+			if cell.ID == cellID {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("cell %q not found", cellID)})
+		}
+		if !rest && nb.Cells[start].Kind != notebookCellCode {
+			return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("cell %q is not a code cell", cellID)})
+		}
+	}
+	end := start + 1
+	if rest {
+		end = len(nb.Cells)
+	}
+
+	outputs := map[string]*NotebookOutput{}
+	ran := make([]NotebookCell, 0, end-start)
+	rt := session.BeginRun()
+	for _, cell := range nb.Cells[start:end] {
+		if cell.Kind != notebookCellCode {
+			continue
+		}
+		if onlyStale && cell.Output != nil && !cell.Output.Stale {
+			continue
+		}
+		cell.Output = runNotebookCell(rt, nb.Name, cell)
+		outputs[cell.ID] = cell.Output
+		ran = append(ran, cell)
+		if cell.Output.Result != "OK" {
+			break
+		}
+	}
+	watches := evaluateWatches(session, rt)
+	session.EndRun()
+
+	// Cache outputs in the stored notebook, which may have been edited meanwhile
+	notebookMu.Lock()
+	defer notebookMu.Unlock()
+	if current, err := loadNotebook(path); err == nil {
+		for i := range current.Cells {
+			if out, ok := outputs[current.Cells[i].ID]; ok {
+				current.Cells[i].Output = out
+			}
+		}
+		markStaleOutputs(current)
+		if err := saveNotebook(path, current); err != nil {
+			return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+		}
+	}
+
+	result := "OK"
+	if len(ran) > 0 && ran[len(ran)-1].Output.Result != "OK" {
+		result = "ERROR"
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: result, Data: ran, Watches: watches})
+}
+
+func notebookError(c echo.Context, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "not found"})
+	}
+	return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// libraryPlanInfo describes a library plan and the agents running it.
+type libraryPlanInfo struct {
+	chariot.AgentPlanInfo
+	Agents []string `json:"agents"`
+}
+
+func describeLibraryPlan(p *chariot.Plan) libraryPlanInfo {
+	agents := chariot.AgentsWithPlan(p.Name)
+	if agents == nil {
+		agents = []string{}
+	}
+	return libraryPlanInfo{AgentPlanInfo: chariot.DescribePlan(p), Agents: agents}
+}
+
+// savePlanLibrary writes the plan library to the plan_lib file, if one is
+// configured.
+func savePlanLibrary() error {
+	if cfg.ChariotConfig.PlanLib == "" {
+		return nil
+	}
+	return chariot.SavePlanLibrary(cfg.ChariotConfig.PlanLib)
+}
+
+// ListPlans lists the plan library.
+//
+//	GET /api/plans
+func (h *Handlers) ListPlans(c echo.Context) error {
+	plans := chariot.LibraryPlans()
+	out := make([]libraryPlanInfo, len(plans))
+	for i, p := range plans {
+		out[i] = describeLibraryPlan(p)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: out})
+}
+
+// GetPlan describes a library plan.
+//
+//	GET /api/plans/:name
+func (h *Handlers) GetPlan(c echo.Context) error {
+	p := chariot.LibraryPlan(c.Param("name"))
+	if p == nil {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("plan '%s' not found", c.Param("name"))})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: describeLibraryPlan(p)})
+}
+
+// DefinePlan adds a plan to the library under its name, replacing one of the
+// same name, and saves the library. The plan is the value of a variable in
+// the session runtime, or of a program run in a copy of the bootstrap
+// runtime. Agents running the replaced plan keep it until it is attached
+// again.
+//
+//	POST /api/plans {"variable": "p"} | {"program": "plan('Heat', ...)"}
+func (h *Handlers) DefinePlan(c echo.Context) error {
+	var req struct {
+		Variable string `json:"variable"`
+		Program  string `json:"program"`
+	}
+	if err := c.Bind(&req); err != nil || (req.Variable == "") == (req.Program == "") {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "give either variable or program"})
+	}
+	var val chariot.Value
+	if req.Variable != "" {
+		session, ok := c.Get("session").(*chariot.Session)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "no session"})
+		}
+		rt := session.BeginRun()
+		val, _ = rt.GetVariable(req.Variable)
+		session.EndRun()
+	} else {
+		var rt *chariot.Runtime
+		if h.bootstrapRuntime != nil {
+			rt = h.bootstrapRuntime.CloneRuntime()
+		} else {
+			rt = chariot.NewRuntime()
+			chariot.RegisterAll(rt)
+		}
+		var err error
+		if val, err = rt.ExecProgram(req.Program); err != nil {
+			return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+		}
+	}
+	if se, ok := val.(chariot.ScopeEntry); ok {
+		val = se.Value
+	}
+	p, ok := val.(*chariot.Plan)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("expected a plan, got %T", val)})
+	}
+	if err := chariot.DefinePlan(p); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	if err := savePlanLibrary(); err != nil {
+		cfg.ChariotLogger.Warn("Failed to save plan library", zap.String("plan", p.Name), zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: describeLibraryPlan(p)})
+}
+
+// DeletePlan removes a plan from the library; agents running it keep it.
+//
+//	DELETE /api/plans/:name
+func (h *Handlers) DeletePlan(c echo.Context) error {
+	name := c.Param("name")
+	if !chariot.RemoveLibraryPlan(name) {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("plan '%s' not found", name)})
+	}
+	if err := savePlanLibrary(); err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]any{"deleted": name}})
+}
+
+// AttachPlan attaches a library plan to a running agent, binding the plan's
+// parameters; attaching a plan the agent already has replaces its bindings.
+//
+//	POST /api/agents/:name/plans {"plan": "Heat", "bindings": {"room": "lab"}}
+func (h *Handlers) AttachPlan(c echo.Context) error {
+	var req struct {
+		Plan     string                 `json:"plan"`
+		Bindings map[string]interface{} `json:"bindings"`
+	}
+	if err := c.Bind(&req); err != nil || req.Plan == "" {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "plan is required"})
+	}
+	bindings := make(map[string]chariot.Value, len(req.Bindings))
+	for k, v := range req.Bindings {
+		bindings[k] = toChariotValue(v)
+	}
+	agent := c.Param("name")
+	if err := chariot.DefaultAgentAttach(agent, req.Plan, bindings); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]any{"agent": agent, "attached": req.Plan}})
+}
+
+// DetachPlan detaches a plan from an agent; running instances finish.
+//
+//	DELETE /api/agents/:name/plans/:plan
+func (h *Handlers) DetachPlan(c echo.Context) error {
+	agent, plan := c.Param("name"), c.Param("plan")
+	if !chariot.DefaultAgentDetach(agent, plan) {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: fmt.Sprintf("agent '%s' has no plan '%s'", agent, plan)})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]any{"agent": agent, "detached": plan}})
+}
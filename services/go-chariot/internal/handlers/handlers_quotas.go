@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/storage"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/users"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// quotaExceeded answers a request refused by a quota: 429 for the execution
+// rate and concurrency, which free up with time, and 409 for stored files
+// and listeners, which the user must remove.
+func quotaExceeded(c echo.Context, qe *QuotaError) error {
+	status := http.StatusConflict
+	if qe.Quota == quotaExecutionsPerHour || qe.Quota == quotaConcurrentExecutions {
+		status = http.StatusTooManyRequests
+	}
+	if qe.RetryAfter > 0 {
+		c.Response().Header().Set("Retry-After", fmt.Sprint(qe.RetryAfter))
+	}
+	return c.JSON(status, ResultJSON{Result: "ERROR", Data: map[string]interface{}{
+		"error":       qe.Error(),
+		"quota":       qe.Quota,
+		"limit":       qe.Limit,
+		"used":        qe.Used,
+		"retry_after": qe.RetryAfter,
+	}})
+}
+
+// userQuota returns the limits of user, taking the roles of their account
+// into account.
+func (h *Handlers) userQuota(user string) Quota {
+	var roles []string
+	if h.users != nil {
+		if u, err := h.users.Get(user); err == nil {
+			roles = u.Roles
+		}
+	}
+	return h.quotas.Limits(user, roles)
+}
+
+// admitExecution counts an execution of user against their quota. When it
+// is refused the response is written and ok is false; otherwise done must be
+// called once the execution finishes.
+func (h *Handlers) admitExecution(c echo.Context, user string) (done func(), ok bool, err error) {
+	done, qe := h.quotas.BeginExecution(user, h.userQuota(user))
+	if qe != nil {
+		cfg.ChariotLogger.Info("Execution refused by quota", zap.String("user", user), zap.String("quota", qe.Quota), zap.Int64("limit", qe.Limit))
+		return nil, false, quotaExceeded(c, qe)
+	}
+	return done, true, nil
+}
+
+// checkFileQuota reports whether writing size bytes to path in user's
+// sandbox stays within their file quota.
+func (h *Handlers) checkFileQuota(user, path string, size int64) *QuotaError {
+	limit := h.userQuota(user).FileBytes
+	if limit <= 0 || !cfg.ChariotConfig.SandboxEnabled {
+		return nil
+	}
+	used := sandboxBytes(user)
+	if info, err := storage.Default().Stat(path); err == nil {
+		used -= info.Size // replaced
+	}
+	if used+size > limit {
+		return &QuotaError{Quota: quotaFileBytes, Limit: limit, Used: used}
+	}
+	return nil
+}
+
+// checkListenerQuota reports whether user may create another listener.
+func (h *Handlers) checkListenerQuota(user string) *QuotaError {
+	limit := h.userQuota(user).Listeners
+	if limit <= 0 {
+		return nil
+	}
+	if n := h.listenerCount(user); n >= limit {
+		return &QuotaError{Quota: quotaListeners, Limit: limit, Used: n}
+	}
+	return nil
+}
+
+func (h *Handlers) listenerCount(user string) int64 {
+	var n int64
+	if h.listenerManager == nil {
+		return 0
+	}
+	for _, l := range h.listenerManager.List() {
+		if l.Owner == user {
+			n++
+		}
+	}
+	return n
+}
+
+// UserQuotaInfo is a user's effective limits and current usage.
+type UserQuotaInfo struct {
+	UserID string     `json:"user_id"`
+	Limits Quota      `json:"limits"`
+	Usage  QuotaUsage `json:"usage"`
+}
+
+func (h *Handlers) quotaInfo(user string) UserQuotaInfo {
+	lastHour, running := h.quotas.ExecutionUsage(user)
+	return UserQuotaInfo{
+		UserID: user,
+		Limits: h.userQuota(user),
+		Usage: QuotaUsage{
+			FileBytes:            sandboxBytes(user),
+			ExecutionsLastHour:   lastHour,
+			ConcurrentExecutions: running,
+			Listeners:            h.listenerCount(user),
+		},
+	}
+}
+
+// GetQuotas returns the default limits and the role and user overrides.
+func (h *Handlers) GetQuotas(c echo.Context) error {
+	roles, users := h.quotas.Overrides()
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]interface{}{
+		"defaults": defaultQuota(),
+		"roles":    roles,
+		"users":    users,
+	}})
+}
+
+// SetRoleQuota replaces the limits of a role, or removes them on DELETE.
+func (h *Handlers) SetRoleQuota(c echo.Context) error {
+	role := c.Param("role")
+	known := false
+	for _, r := range users.Roles {
+		known = known || r == role
+	}
+	if !known {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "unknown role " + role})
+	}
+	return h.setQuota(c, true, role)
+}
+
+// SetUserQuota replaces the limits of a user, or removes them on DELETE.
+func (h *Handlers) SetUserQuota(c echo.Context) error {
+	return h.setQuota(c, false, c.Param("user"))
+}
+
+func (h *Handlers) setQuota(c echo.Context, role bool, name string) error {
+	var limits *QuotaLimits
+	if c.Request().Method != http.MethodDelete {
+		limits = &QuotaLimits{}
+		if err := c.Bind(limits); err != nil {
+			return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
+		}
+	}
+	set := h.quotas.SetUserLimits
+	if role {
+		set = h.quotas.SetRoleLimits
+	}
+	if err := set(name, limits); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	kind := "user"
+	if role {
+		kind = "role"
+	}
+	h.logAccountChange(c, "Quota limits changed", kind+":"+name)
+	return h.GetQuotas(c)
+}
+
+// QuotaUsageAdmin returns the limits and usage of one user, or of every
+// account and every user with limits or executions on this replica.
+// Query: user = only this user
+func (h *Handlers) QuotaUsageAdmin(c echo.Context) error {
+	if user := c.QueryParam("user"); user != "" {
+		return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: h.quotaInfo(user)})
+	}
+	seen := map[string]bool{}
+	names := h.quotas.trackedUsers()
+	if h.users != nil {
+		for _, u := range h.users.List() {
+			names = append(names, u.ID)
+		}
+	}
+	if h.listenerManager != nil {
+		for _, l := range h.listenerManager.List() {
+			if l.Owner != "" {
+				names = append(names, l.Owner)
+			}
+		}
+	}
+	infos := []UserQuotaInfo{}
+	for _, n := range names {
+		if !seen[n] {
+			seen[n] = true
+			infos = append(infos, h.quotaInfo(n))
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].UserID < infos[j].UserID })
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: infos})
+}
+
+// ResetQuotaUsage forgets the executions a user started in the last hour on
+// this replica, lifting an hourly limit early.
+func (h *Handlers) ResetQuotaUsage(c echo.Context) error {
+	user := c.Param("user")
+	h.quotas.ResetExecutions(user)
+	h.logAccountChange(c, "Quota usage reset", user)
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: h.quotaInfo(user)})
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// RenameChange is a rename in one workspace file or library function.
+type RenameChange struct {
+	File        string              `json:"file,omitempty"`
+	Function    string              `json:"function,omitempty"`     // Library function
+	NewFunction string              `json:"new_function,omitempty"` // Its new name, when it is the function renamed
+	Occurrences []chariot.SymbolRef `json:"occurrences"`
+	Diff        string              `json:"diff"`
+
+	source string // New content
+	path   string // File path; "" for a library function
+}
+
+// RenameSymbol renames a user function or variable in the .ch files of the
+// scope's files directory and in the function library. Occurrences are found
+// by parsing (see chariot.FindSymbols), so comments and unrelated strings are
+// left alone; sources the symbol index shows mention neither name are not
+// parsed again. Without apply it only returns the changes with a diff of each;
+// a conflicting name is reported with 409 and nothing is changed.
+//
+//	POST /api/refactor/rename?scope=sandbox|global {"symbol": "total", "new_name": "grandTotal", "apply": false}
+func (h *Handlers) RenameSymbol(c echo.Context) error {
+	sess, ok := c.Get("session").(*chariot.Session)
+	if !ok || sess == nil {
+		return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "session required"})
+	}
+	var req struct {
+		Symbol  string `json:"symbol"`
+		NewName string `json:"new_name"`
+		Apply   bool   `json:"apply"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
+	}
+	rt := h.referenceRuntime(c)
+	if err := chariot.CheckRename(rt, req.Symbol, req.NewName); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	dir, scope, err := filesDirFor(c, sess)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	setScopeHeader(c, scope)
+
+	changes := []RenameChange{}
+	skipped := []SkippedSource{}
+	conflicts := []chariot.RenameConflict{}
+
+	entries, err := storage.Default().ReadDir(dir)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name) != ".ch" {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name)
+		if indexed := h.symbols.file(path); indexed != nil && indexed.err == nil && !indexed.mentions(req.Symbol, req.NewName) {
+			continue
+		}
+		content, err := storage.Default().ReadFile(path)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+		}
+		src, refs, fileConflicts, err := chariot.RenameInSource(string(content), entry.Name, req.Symbol, req.NewName, rt)
+		if err != nil {
+			skipped = append(skipped, SkippedSource{File: entry.Name, Error: chariot.DescribeError(err).Message})
+			continue
+		}
+		conflicts = append(conflicts, fileConflicts...)
+		if len(refs) > 0 {
+			changes = append(changes, RenameChange{File: entry.Name, Occurrences: refs,
+				Diff: chariot.LineDiff(entry.Name, string(content), src), source: src, path: path})
+		}
+	}
+
+	var library map[string]*chariot.FunctionValue
+	if cfg.ChariotConfig.FunctionLib != "" {
+		library, err = chariot.LoadFunctionsFromFile(cfg.ChariotConfig.FunctionLib)
+		if err != nil && !os.IsNotExist(err) {
+			return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+		}
+	}
+	if _, taken := library[req.NewName]; taken {
+		conflicts = append(conflicts, chariot.RenameConflict{Message: fmt.Sprintf("the library already has a function '%s'", req.NewName)})
+	}
+	indexed, err := h.symbols.libraryFunctions()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	names := make([]string, 0, len(library))
+	for name := range library {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if src := indexed[name]; src != nil && src.err == nil && name != req.Symbol && !src.mentions(req.Symbol, req.NewName) {
+			continue
+		}
+		before := chariot.FunctionSource(name, library[name])
+		src, refs, fnConflicts, err := chariot.RenameInSource(before, name, req.Symbol, req.NewName, rt)
+		if err != nil {
+			skipped = append(skipped, SkippedSource{Function: name, Error: chariot.DescribeError(err).Message})
+			continue
+		}
+		conflicts = append(conflicts, fnConflicts...)
+		if len(refs) > 0 || name == req.Symbol {
+			change := RenameChange{Function: name, Occurrences: refs, Diff: chariot.LineDiff(name, before, src), source: src}
+			if name == req.Symbol {
+				change.NewFunction = req.NewName
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return c.JSON(http.StatusConflict, ResultJSON{Result: "ERROR", Data: map[string]interface{}{
+			"message":   fmt.Sprintf("'%s' cannot be renamed to '%s'", req.Symbol, req.NewName),
+			"conflicts": conflicts,
+		}})
+	}
+	result := map[string]interface{}{
+		"symbol":   req.Symbol,
+		"new_name": req.NewName,
+		"changes":  changes,
+		"skipped":  skipped,
+		"applied":  false,
+	}
+	if !req.Apply || len(changes) == 0 {
+		return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: result})
+	}
+
+	// Nothing is written unless every file can be
+	username := sess.Username
+	if username == "" {
+		username = sess.UserID
+	}
+	for _, ch := range changes {
+		if ch.path == "" {
+			continue
+		}
+		if held := h.fileLeases.Conflict(sess, ch.path); held != nil {
+			return leaseConflict(c, held)
+		}
+		if scope == cfg.StorageScopeSandbox {
+			if qe := h.checkFileQuota(username, ch.path, int64(len(ch.source))); qe != nil {
+				return quotaExceeded(c, qe)
+			}
+		}
+	}
+	renamed, err := renameInLibrary(library, changes)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	for _, ch := range changes {
+		if ch.path != "" {
+			if err := storage.Default().WriteFile(ch.path, []byte(ch.source)); err != nil {
+				return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+			}
+			h.symbols.Changed(ch.path)
+		}
+	}
+	if renamed != nil {
+		if err := chariot.SaveFunctionsToFile(library, cfg.ChariotConfig.FunctionLib); err != nil {
+			return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+		}
+		if h.bootstrapRuntime != nil {
+			if _, ok := h.bootstrapRuntime.GetFunction(req.Symbol); ok && library[req.Symbol] == nil {
+				h.bootstrapRuntime.DeleteFunction(req.Symbol)
+			}
+			for name, fn := range renamed {
+				h.bootstrapRuntime.RegisterFunction(name, fn)
+			}
+		}
+	}
+	result["applied"] = true
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: result})
+}
+
+// SymbolReferences lists where a user function or variable is defined,
+// called or referred to in the .ch files of the scope's files directory and
+// in the function library, with the enclosing function of each occurrence.
+// Sources are parsed once and kept in the symbol index until they change.
+//
+//	GET /api/refactor/references?symbol=total&scope=sandbox|global
+func (h *Handlers) SymbolReferences(c echo.Context) error {
+	sess, ok := c.Get("session").(*chariot.Session)
+	if !ok || sess == nil {
+		return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "session required"})
+	}
+	symbol := c.QueryParam("symbol")
+	if !chariot.IsIdentifier(symbol) {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "symbol required"})
+	}
+	dir, scope, err := filesDirFor(c, sess)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	setScopeHeader(c, scope)
+	refs, skipped, err := h.symbols.References(dir, symbol)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]interface{}{
+		"symbol":     symbol,
+		"references": refs,
+		"skipped":    skipped,
+	}})
+}
+
+// SearchSymbols lists the symbol table of the .ch files of the scope's files
+// directory and the function library: each user function and variable whose
+// name contains q, ignoring case, with its definitions and use count. The
+// editor completes workspace names from it.
+//
+//	GET /api/index/symbols?q=tot&kind=function|variable&scope=sandbox|global
+func (h *Handlers) SearchSymbols(c echo.Context) error {
+	sess, ok := c.Get("session").(*chariot.Session)
+	if !ok || sess == nil {
+		return c.JSON(http.StatusUnauthorized, ResultJSON{Result: "ERROR", Data: "session required"})
+	}
+	kind := c.QueryParam("kind")
+	if kind != "" && kind != "function" && kind != "variable" {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "kind must be function or variable"})
+	}
+	dir, scope, err := filesDirFor(c, sess)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	setScopeHeader(c, scope)
+	symbols, err := h.symbols.Symbols(dir, c.QueryParam("q"), kind)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: symbols})
+}
+
+// IndexStatus reports what the symbol index holds and when it last scanned.
+//
+//	GET /api/index/status
+func (h *Handlers) IndexStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: h.symbols.Status()})
+}
+
+// renameInLibrary rebuilds the library functions a rename changes from their
+// new source and replaces them in library. It returns them by their new name.
+func renameInLibrary(library map[string]*chariot.FunctionValue, changes []RenameChange) (map[string]*chariot.FunctionValue, error) {
+	var renamed map[string]*chariot.FunctionValue
+	scratch := chariot.NewRuntime()
+	for _, ch := range changes {
+		if ch.Function == "" {
+			continue
+		}
+		old := library[ch.Function]
+		name := ch.Function
+		if ch.NewFunction != "" {
+			name = ch.NewFunction
+		}
+		formatted := ""
+		if old.FormattedSource != "" && chariot.FunctionSource(ch.Function, old) == old.FormattedSource {
+			formatted = ch.source
+		}
+		if err := scratch.SaveFunction(name, strings.TrimSpace(ch.source), formatted); err != nil {
+			return nil, fmt.Errorf("function '%s': %w", ch.Function, err)
+		}
+		fn, _ := scratch.GetFunction(name)
+		fn.Name = name
+		if fn.Doc == "" {
+			fn.Doc = old.Doc
+		}
+		if renamed == nil {
+			renamed = map[string]*chariot.FunctionValue{}
+		}
+		delete(library, ch.Function)
+		renamed[name] = fn
+	}
+	for name, fn := range renamed {
+		library[name] = fn
+	}
+	return renamed, nil
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// maxReplEntry bounds the size of one REPL message.
+const maxReplEntry = 1 << 20
+
+// ReplRequest is one entry sent to the REPL. A text frame that is not a JSON
+// object is evaluated as the expression itself.
+type ReplRequest struct {
+	ID   interface{} `json:"id,omitempty"`
+	Expr string      `json:"expr"`
+}
+
+// ReplResult is the REPL's answer to one entry.
+type ReplResult struct {
+	Type       string      `json:"type"` // always "result"
+	ID         interface{} `json:"id,omitempty"`
+	Result     string      `json:"result"` // OK or ERROR
+	Value      interface{} `json:"value,omitempty"`
+	ValueType  string      `json:"valueType,omitempty"` // single-letter type spec, as typeOf returns
+	Error      string      `json:"error,omitempty"`
+	DurationMs float64     `json:"durationMs"`
+}
+
+// HandleReplWS evaluates expressions as they arrive over a WebSocket and
+// answers each with its value, type and timing. Entries run on the session
+// runtime, so definitions persist between them and across executions;
+// ?runtime=ephemeral instead keeps a fresh runtime for the life of the
+// connection.
+//
+//	GET /api/repl?runtime=session|ephemeral
+func (h *Handlers) HandleReplWS(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+
+	mode := c.QueryParam("runtime")
+	var ephemeral *chariot.Runtime
+	switch mode {
+	case "", executionRuntimeSession:
+		mode = executionRuntimeSession
+	case executionRuntimeEphemeral:
+		ephemeral = session.NewEphemeralRuntime()
+	default:
+		return c.JSON(http.StatusBadRequest, ResultJSON{
+			Result: "ERROR",
+			Data:   fmt.Sprintf("unknown runtime %q (want %s or %s)", mode, executionRuntimeSession, executionRuntimeEphemeral),
+		})
+	}
+
+	conn, err := wsUpgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		cfg.ChariotLogger.Error("REPL upgrade failed", zap.Error(err))
+		return err
+	}
+	defer conn.Close()
+	defer wsClients.open(wsREPL)()
+
+	conn.SetReadLimit(maxReplEntry)
+	conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		return nil
+	})
+
+	// Keep-alive pings; control frames may be written alongside the replies
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ping := time.NewTicker(30 * time.Second)
+		defer ping.Stop()
+		for {
+			select {
+			case <-ping.C:
+				_ = conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(5*time.Second))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if err := conn.WriteJSON(map[string]string{"type": "hello", "result": "OK", "service": "repl", "runtime": mode}); err != nil {
+		return nil
+	}
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return nil
+		}
+		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+
+		req := parseReplRequest(msg)
+		if h.sessionManager != nil {
+			// Each entry counts as session activity; stop once the session has ended
+			if _, err := h.sessionManager.GetSession(session.ID); err != nil {
+				_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session ended"))
+				return nil
+			}
+		}
+
+		var res ReplResult
+		if ephemeral != nil {
+			res = evaluateReplEntry(ephemeral, req)
+		} else {
+			res = evaluateReplEntry(session.BeginRun(), req)
+			session.EndRun()
+		}
+		if err := conn.WriteJSON(res); err != nil {
+			return nil
+		}
+	}
+}
+
+func parseReplRequest(msg []byte) ReplRequest {
+	var req ReplRequest
+	if trimmed := strings.TrimSpace(string(msg)); strings.HasPrefix(trimmed, "{") {
+		if err := json.Unmarshal(msg, &req); err == nil {
+			return req
+		}
+	}
+	return ReplRequest{Expr: string(msg)}
+}
+
+func evaluateReplEntry(rt *chariot.Runtime, req ReplRequest) (res ReplResult) {
+	res.Type = "result"
+	res.ID = req.ID
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			res.Result, res.Value, res.ValueType, res.Error = "ERROR", nil, "", fmt.Sprintf("panic: %v", r)
+		}
+		res.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	}()
+	if strings.TrimSpace(req.Expr) == "" {
+		res.Result, res.Error = "ERROR", "empty expression"
+		return res
+	}
+	val, err := rt.Evaluate(req.Expr)
+	if err != nil {
+		res.Result, res.Error = "ERROR", err.Error()
+		return res
+	}
+	if entry, ok := val.(chariot.ScopeEntry); ok {
+		val = entry.Value
+	}
+	res.Result = "OK"
+	res.Value = convertValueToJSON(val)
+	res.ValueType = chariot.GetValueTypeSpec(val)
+	return res
+}
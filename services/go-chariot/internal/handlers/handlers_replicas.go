@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/cluster"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/webhooks"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Bus topics shared by every replica.
+const (
+	agentEventsTopic   = "agents"
+	replicaStatusTopic = "replicas"
+)
+
+// replicaHeartbeat is how often a replica announces its status; a replica
+// silent for three heartbeats drops off the dashboard.
+const replicaHeartbeat = 5 * time.Second
+
+// ReplicaStatus is a replica's summary as shown on every replica's dashboard.
+type ReplicaStatus struct {
+	Instance   string    `json:"instance"`
+	Sessions   int       `json:"sessions"`
+	Goroutines int       `json:"goroutines"`
+	Alloc      uint64    `json:"alloc"`
+	StartTime  time.Time `json:"start_time"`
+	SeenAt     time.Time `json:"seen_at"`
+	Roles      []string  `json:"roles,omitempty"` // Singleton subsystems this replica leads
+}
+
+// replicaSet holds the latest status heard from each replica.
+type replicaSet struct {
+	mu       sync.RWMutex
+	replicas map[string]ReplicaStatus
+}
+
+// startFanout records this replica's agent events and publishes them and its
+// status on the bus.
+// With the local bus this only feeds this replica's own subscribers.
+func (h *Handlers) startFanout() {
+	events := make(chan chariot.AgentEvent, 128)
+	unregister := chariot.RegisterAgentEventSink(events)
+	// No event is sent to the sink once unregister returns
+	h.closers = append(h.closers, func() { unregister(); close(events) })
+	h.goBackground(func() {
+		for ev := range events {
+			if ev.Type == "agent" && ev.Status == "stop" {
+				h.webhooks.Notify(webhooks.AgentStopped, map[string]interface{}{"agent": ev.Agent})
+			}
+			var payload []byte
+			if rec, err := h.RecordAgentEvent(ev); err == nil {
+				payload, _ = json.Marshal(rec)
+			} else {
+				cfg.ChariotLogger.Debug("Failed to record agent event", zap.Error(err))
+				payload, _ = json.Marshal(ev)
+			}
+			if err := h.bus.Publish(agentEventsTopic, payload); err != nil {
+				cfg.ChariotLogger.Debug("Failed to publish agent event", zap.Error(err))
+			}
+		}
+	})
+
+	if !h.bus.Shared() {
+		return
+	}
+	statuses, unsubscribe := h.bus.Subscribe(replicaStatusTopic)
+	h.closers = append(h.closers, unsubscribe)
+	h.goBackground(func() {
+		for msg := range statuses {
+			var st ReplicaStatus
+			if json.Unmarshal(msg, &st) == nil && st.Instance != "" {
+				h.replicas.mu.Lock()
+				h.replicas.replicas[st.Instance] = st
+				h.replicas.mu.Unlock()
+			}
+		}
+	})
+	h.goBackground(func() {
+		ticker := time.NewTicker(replicaHeartbeat)
+		defer ticker.Stop()
+		for {
+			payload, _ := json.Marshal(h.localReplicaStatus())
+			if err := h.bus.Publish(replicaStatusTopic, payload); err != nil {
+				cfg.ChariotLogger.Debug("Failed to publish replica status", zap.Error(err))
+			}
+			select {
+			case <-h.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+func (h *Handlers) localReplicaStatus() ReplicaStatus {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return ReplicaStatus{
+		Instance:   h.instanceID,
+		Sessions:   h.sessionManager.GetActiveSessions(),
+		Goroutines: runtime.NumGoroutine(),
+		Alloc:      mem.Alloc,
+		StartTime:  h.startTime,
+		SeenAt:     time.Now(),
+		Roles:      h.elector.Roles(),
+	}
+}
+
+// replicaStatuses lists the replicas heard from recently, this one included,
+// or nothing when the bus is not shared.
+func (h *Handlers) replicaStatuses() []ReplicaStatus {
+	if !h.bus.Shared() {
+		return nil
+	}
+	cutoff := time.Now().Add(-3 * replicaHeartbeat)
+	out := []ReplicaStatus{h.localReplicaStatus()}
+	h.replicas.mu.Lock()
+	for id, st := range h.replicas.replicas {
+		switch {
+		case st.SeenAt.Before(cutoff):
+			delete(h.replicas.replicas, id)
+		case id != h.instanceID:
+			out = append(out, st)
+		}
+	}
+	h.replicas.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Instance < out[j].Instance })
+	return out
+}
+
+// SetElector makes the replica report the singleton roles e holds.
+func (h *Handlers) SetElector(e *cluster.Elector) {
+	h.elector = e
+}
+
+// ClusterStatus reports the replicas heard from, with the singleton roles
+// each leads, and the leader of each role, for operators deciding which pod
+// to drain or whether a role is unattended.
+//
+//	GET /api/cluster/status
+func (h *Handlers) ClusterStatus(c echo.Context) error {
+	replicas := h.replicaStatuses()
+	if replicas == nil {
+		replicas = []ReplicaStatus{h.localReplicaStatus()}
+	}
+	leaders := h.elector.Leaders()
+	if leaders == nil {
+		leaders = map[string]string{}
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]any{
+		"instance": h.instanceID,
+		"shared":   h.bus.Shared(),
+		"leaders":  leaders,
+		"replicas": replicas,
+	}})
+}
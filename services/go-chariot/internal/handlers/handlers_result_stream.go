@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/labstack/echo/v4"
+)
+
+// resultMissedTrailer is the trailer in which a result stream reports how
+// many log entries were dropped from the execution's buffer before they
+// could be sent; emitted values may have been among them.
+const resultMissedTrailer = "Chariot-Missed"
+
+// StreamResults streams the values an execution sends with emit as NDJSON,
+// one line per value as it is emitted, starting with those already sent.
+// The response ends when the execution completes; its final value and
+// status are read from /api/result.
+func (h *Handlers) StreamResults(c echo.Context) error {
+	execID := c.Param("execId")
+	if execID == "" {
+		return c.JSON(http.StatusBadRequest, ResultJSON{
+			Result: "ERROR",
+			Data:   "Missing execution ID",
+		})
+	}
+	return h.followLogs(c, execID, &ndjsonSink{c: c})
+}
+
+// ndjsonSink sends the emitted values among log entries as NDJSON lines.
+type ndjsonSink struct {
+	c      echo.Context
+	missed int
+}
+
+func (s *ndjsonSink) start() {
+	header := s.c.Response().Header()
+	header.Set("Content-Type", mimeNDJSON)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no") // Disable nginx buffering
+	header.Set("Trailer", resultMissedTrailer)
+	s.c.Response().WriteHeader(http.StatusOK)
+}
+
+func (s *ndjsonSink) entry(seq int, entry chariot.LogEntry) error {
+	if entry.Level != chariot.LogResult {
+		return nil
+	}
+	_, err := s.c.Response().Write(append(entry.Value, '\n'))
+	return err
+}
+
+func (s *ndjsonSink) gap(missed int) error {
+	s.missed += missed
+	return nil
+}
+
+func (s *ndjsonSink) done() {
+	s.c.Response().Header().Set(resultMissedTrailer, strconv.Itoa(s.missed))
+	s.c.Response().Flush()
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/statestore"
+	"github.com/labstack/echo/v4"
+)
+
+// /api/result negotiates its format from the Accept header. Without one,
+// or for */*, it answers with the ResultJSON envelope, which can also be
+// asked for by name. Otherwise the result itself is sent: as JSON, as
+// NDJSON with one line per element of an array, as CSV for rows, as text
+// for a string, or as the artifact a script declared its result with
+// resultType.
+
+// Media types a result can be sent as
+const (
+	mimeResultEnvelope = "application/vnd.chariot.result+json"
+	mimeNDJSON         = "application/x-ndjson"
+	mimeCSV            = "text/csv"
+	mimeText           = "text/plain"
+)
+
+// resultType is the kind a script declared for its result with resultType.
+type resultType struct {
+	Kind     string   `json:"kind"`
+	Columns  []string `json:"columns,omitempty"`
+	Artifact string   `json:"artifact,omitempty"` // name of the artifact that is the result
+}
+
+func newResultType(t *chariot.ResultType) *resultType {
+	if t == nil {
+		return nil
+	}
+	return &resultType{Kind: t.Kind, Columns: t.Columns, Artifact: t.Artifact}
+}
+
+// resultArtifact returns the artifact a script declared as its result, if
+// the run kept it.
+func resultArtifact(rec *executionRecord) *artifactRef {
+	if rec.ResultType == nil || rec.ResultType.Kind != chariot.ResultArtifact {
+		return nil
+	}
+	for i := range rec.Artifacts {
+		if rec.Artifacts[i].Name == rec.ResultType.Artifact {
+			return &rec.Artifacts[i]
+		}
+	}
+	return nil
+}
+
+// resultOffers lists the media types a finished result can be sent as, in
+// order of preference.
+func resultOffers(rec *executionRecord) []string {
+	offers := []string{mimeResultEnvelope}
+	if a := resultArtifact(rec); a != nil {
+		offers = append(offers, mediaType(a.MimeType))
+	}
+	offers = append(offers, echo.MIMEApplicationJSON, mimeNDJSON)
+	kind := chariot.ResultJSON
+	if rec.ResultType != nil {
+		kind = rec.ResultType.Kind
+	}
+	array := rec.Truncated != nil && rec.Truncated.Items > 0
+	if _, ok := rec.Result.([]interface{}); ok {
+		array = true
+	}
+	if kind == chariot.ResultTable || array {
+		offers = append(offers, mimeCSV)
+	}
+	_, isString := rec.Result.(string)
+	if kind == chariot.ResultText || isString {
+		offers = append(offers, mimeText)
+	}
+	return offers
+}
+
+// mediaType drops the parameters of a media type.
+func mediaType(v string) string {
+	if t, _, err := mime.ParseMediaType(v); err == nil {
+		return t
+	}
+	return v
+}
+
+// negotiate picks the offer the Accept header prefers; ok is false when it
+// accepts none of them.
+func negotiate(accept string, offers []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+	type mediaRange struct {
+		typ string
+		q   float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{t, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	for _, r := range ranges {
+		for _, offer := range offers {
+			if r.typ == "*/*" || r.typ == offer || (strings.HasSuffix(r.typ, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(r.typ, "*"))) {
+				return offer, true
+			}
+		}
+	}
+	return "", false
+}
+
+// sendResult sends a finished result as the negotiated media type; the
+// envelope is left to the caller. A page of an array result is sent when
+// paged.
+func (h *Handlers) sendResult(c echo.Context, rec *executionRecord, as string, offset, limit int, paged bool) error {
+	var userID string
+	if session, ok := c.Get("session").(*chariot.Session); ok {
+		userID = session.UserID
+	}
+	if ref := resultArtifact(rec); ref != nil && as == mediaType(ref.MimeType) {
+		a, err := h.loadArtifact(userID, rec.ID, ref.Name)
+		if err != nil {
+			return artifactError(c, err)
+		}
+		return sendArtifact(c, ref.Name, a, "inline")
+	}
+
+	v, err := h.fullResult(userID, rec)
+	if errors.Is(err, statestore.ErrNotFound) {
+		return c.JSON(http.StatusGone, ResultJSON{Result: "ERROR", Data: "The full result has expired; only the leading elements in the result are kept"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	if paged {
+		items, ok := v.([]interface{})
+		if !ok {
+			return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: errNotArray.Error()})
+		}
+		start, end := pageBounds(len(items), offset, limit)
+		v = items[start:end]
+		c.Response().Header().Set("X-Total-Count", strconv.Itoa(len(items)))
+	}
+
+	switch as {
+	case echo.MIMEApplicationJSON:
+		return c.JSON(http.StatusOK, v)
+	case mimeNDJSON:
+		items, ok := v.([]interface{})
+		if !ok {
+			items = []interface{}{v}
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, item := range items {
+			if err := enc.Encode(item); err != nil {
+				return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+			}
+		}
+		return c.Blob(http.StatusOK, mimeNDJSON, buf.Bytes())
+	case mimeCSV:
+		var columns []string
+		if rec.ResultType != nil {
+			columns = rec.ResultType.Columns
+		}
+		data, err := resultCSV(v, columns)
+		if err != nil {
+			return c.JSON(http.StatusNotAcceptable, ResultJSON{Result: "ERROR", Data: err.Error()})
+		}
+		return c.Blob(http.StatusOK, "text/csv; charset=utf-8", data)
+	case mimeText:
+		s, ok := v.(string)
+		if !ok {
+			data, _ := json.Marshal(v)
+			s = string(data)
+		}
+		return c.Blob(http.StatusOK, "text/plain; charset=utf-8", []byte(s))
+	}
+	return c.JSON(http.StatusNotAcceptable, ResultJSON{Result: "ERROR", Data: "cannot send the result as " + as})
+}
+
+// resultCSV writes rows of arrays, or of maps under columns (their sorted
+// keys when none are given), as CSV. The columns are the header row when
+// declared or when there are maps.
+func resultCSV(v interface{}, columns []string) ([]byte, error) {
+	rows, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("only array results can be sent as CSV")
+	}
+	declared := columns != nil
+	keys := map[string]bool{}
+	for _, row := range rows {
+		if m, ok := row.(map[string]interface{}); ok {
+			for k := range m {
+				keys[k] = true
+			}
+		}
+	}
+	if columns == nil {
+		for k := range keys {
+			columns = append(columns, k)
+		}
+		sort.Strings(columns)
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if declared || len(keys) > 0 {
+		if err := w.Write(columns); err != nil {
+			return nil, err
+		}
+	}
+	for i, row := range rows {
+		var record []string
+		switch r := row.(type) {
+		case []interface{}:
+			for _, f := range r {
+				record = append(record, csvCell(f))
+			}
+		case map[string]interface{}:
+			for _, col := range columns {
+				record = append(record, csvCell(r[col]))
+			}
+		default:
+			return nil, fmt.Errorf("row %d is not an array or a map", i)
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func csvCell(v interface{}) string {
+	switch f := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return f
+	case float64:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(f)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/statestore"
+	"github.com/labstack/echo/v4"
+)
+
+// A result whose JSON is larger than result_max_size is cut down to what
+// fits: the leading elements of an array, the start of a string, or nothing
+// for other values. The full result is kept as the run's result.full.json
+// artifact, and array results can be read from it a page at a time through
+// /api/result.
+
+// resultArtifactName is the artifact an oversized result spills into.
+const resultArtifactName = "result.full.json"
+
+// Result pages, by default and at most
+const (
+	defaultResultPage = 100
+	maxResultPage     = 10000
+)
+
+// pageBounds returns the slice bounds of a page of n elements.
+func pageBounds(n, offset, limit int) (start, end int) {
+	start, end = offset, offset+limit
+	if start > n {
+		start = n
+	}
+	if end > n {
+		end = n
+	}
+	return start, end
+}
+
+var errNotArray = errors.New("only array results can be paged")
+
+// resultTruncation describes a result cut down to the size limit.
+type resultTruncation struct {
+	Size     int    `json:"size"`               // bytes of the full result as JSON
+	Limit    int    `json:"limit"`              // bytes allowed in a response
+	Items    int    `json:"items,omitempty"`    // elements of an array result
+	Kept     int    `json:"kept,omitempty"`     // leading elements included in data
+	Artifact string `json:"artifact,omitempty"` // URL of the full result, unless it was too large to keep
+}
+
+// resultPage describes a page of an array result.
+type resultPage struct {
+	Offset int  `json:"offset"`
+	Limit  int  `json:"limit"`
+	Count  int  `json:"count"`          // elements in data
+	Total  int  `json:"total"`          // elements of the whole result
+	Next   *int `json:"next,omitempty"` // offset of the next page
+}
+
+// limitResult returns result unchanged when its JSON fits the size limit.
+// Otherwise it returns what fits, what was cut, and the full JSON as an
+// artifact to store with the run's others; the artifact is nil when the
+// result is larger than an artifact may be.
+func limitResult(result interface{}) (interface{}, *resultTruncation, *chariot.Artifact) {
+	full, err := json.Marshal(result)
+	limit := chariot.ResultMaxSize()
+	if err != nil || len(full) <= limit {
+		return result, nil, nil
+	}
+	t := &resultTruncation{Size: len(full), Limit: limit}
+	var spill *chariot.Artifact
+	if maxSize, _ := chariot.ArtifactLimits(); len(full) <= maxSize {
+		spill = &chariot.Artifact{Name: resultArtifactName, MimeType: "application/json", Data: full}
+	}
+	var generic interface{}
+	if err := json.Unmarshal(full, &generic); err != nil {
+		return nil, t, spill
+	}
+	switch v := generic.(type) {
+	case []interface{}:
+		t.Items = len(v)
+		kept := fitItems(v, limit)
+		t.Kept = len(kept)
+		return kept, t, spill
+	case string:
+		// Leave room for quotes and escapes
+		n := limit / 2
+		for n > 0 && !utf8.RuneStart(v[n]) {
+			n--
+		}
+		return v[:n], t, spill
+	}
+	return nil, t, spill
+}
+
+// fitItems returns the leading elements whose JSON array fits in limit bytes.
+func fitItems(items []interface{}, limit int) []interface{} {
+	size := 2 // brackets
+	for i, item := range items {
+		data, _ := json.Marshal(item)
+		size += len(data) + 1
+		if size > limit {
+			return items[:i]
+		}
+	}
+	return items
+}
+
+// spillResult limits the result of a run before its artifacts are saved,
+// adding the full result to them when it was cut.
+func spillResult(result interface{}, artifacts []chariot.Artifact) (interface{}, *resultTruncation, []chariot.Artifact) {
+	result, truncated, spill := limitResult(result)
+	if spill != nil {
+		artifacts = append(artifacts, *spill)
+	}
+	return result, truncated, artifacts
+}
+
+// linkArtifact points a truncation at the saved full result, if it was saved.
+func (t *resultTruncation) linkArtifact(refs []artifactRef) {
+	if t == nil {
+		return
+	}
+	for _, ref := range refs {
+		if ref.Name == resultArtifactName {
+			t.Artifact = ref.URL
+		}
+	}
+}
+
+// pageParams reads ?offset= and ?limit=; paged is false without either.
+func pageParams(c echo.Context) (offset, limit int, paged bool, err error) {
+	o, l := c.QueryParam("offset"), c.QueryParam("limit")
+	if o == "" && l == "" {
+		return 0, 0, false, nil
+	}
+	limit = defaultResultPage
+	if o != "" {
+		if offset, err = strconv.Atoi(o); err != nil || offset < 0 {
+			return 0, 0, true, errors.New("offset must be a non-negative integer")
+		}
+	}
+	if l != "" {
+		if limit, err = strconv.Atoi(l); err != nil || limit <= 0 {
+			return 0, 0, true, errors.New("limit must be a positive integer")
+		}
+	}
+	if limit > maxResultPage {
+		limit = maxResultPage
+	}
+	return offset, limit, true, nil
+}
+
+// fullResult returns the whole result of an execution as plain JSON
+// values: from its spilled artifact when the result was truncated,
+// otherwise from the record.
+func (h *Handlers) fullResult(userID string, rec *executionRecord) (interface{}, error) {
+	data, err := json.Marshal(rec.Result)
+	if rec.Truncated != nil {
+		a, lerr := h.loadArtifact(userID, rec.ID, resultArtifactName)
+		if lerr != nil {
+			return nil, lerr
+		}
+		data, err = a.Data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Local results may hold typed slices; read them back as JSON
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// resultItems returns the elements of an array result.
+func (h *Handlers) resultItems(userID string, rec *executionRecord) ([]interface{}, error) {
+	if rec.Truncated != nil && rec.Truncated.Items == 0 {
+		return nil, errNotArray
+	}
+	v, err := h.fullResult(userID, rec)
+	if err != nil {
+		return nil, err
+	}
+	if items, ok := v.([]interface{}); ok {
+		return items, nil
+	}
+	return nil, errNotArray
+}
+
+// resultPageResponse answers GET /api/result/:execId?offset=&limit= with a
+// page of an array result. A page larger than the size limit is cut short;
+// its next offset says where to continue.
+func (h *Handlers) resultPageResponse(c echo.Context, rec *executionRecord, offset, limit int) error {
+	var userID string
+	if session, ok := c.Get("session").(*chariot.Session); ok {
+		userID = session.UserID
+	}
+	items, err := h.resultItems(userID, rec)
+	switch {
+	case errors.Is(err, errNotArray):
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	case errors.Is(err, statestore.ErrNotFound):
+		return c.JSON(http.StatusGone, ResultJSON{Result: "ERROR", Data: "The full result has expired; only the leading elements in the result are kept"})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	offset, end := pageBounds(len(items), offset, limit)
+	page := fitItems(items[offset:end], chariot.ResultMaxSize())
+	if len(page) == 0 && end > offset {
+		page = items[offset : offset+1] // an element larger than the limit on its own
+	}
+	p := &resultPage{Offset: offset, Limit: limit, Count: len(page), Total: len(items)}
+	if next := offset + len(page); next < len(items) {
+		p.Next = &next
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: page, Page: p})
+}
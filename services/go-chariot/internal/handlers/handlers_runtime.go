@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/labstack/echo/v4"
+)
+
+// Session data keys of the session's RuntimeInspector and watch list.
+const (
+	runtimeInspectorKey = "runtime_inspector"
+	watchListKey        = "watch_list"
+)
+
+// maxWatches bounds the watch list of a session, since every execution
+// evaluates all of them.
+const maxWatches = 50
+
+// runtimeInspector returns the session's inspector, creating it on first use.
+func runtimeInspector(session *chariot.Session) *chariot.RuntimeInspector {
+	if v, ok := session.GetData(runtimeInspectorKey); ok {
+		if in, ok := v.(*chariot.RuntimeInspector); ok {
+			return in
+		}
+	}
+	in := chariot.NewRuntimeInspector()
+	session.SetData(runtimeInspectorKey, in)
+	return in
+}
+
+// InspectRuntime returns part of the session runtime's state.
+//
+//	GET /api/runtime/inspect?path=globals&path=orders&depth=2&offset=0&limit=50&since=<cursor>
+//
+// Repeated path parameters select a section, an entry and keys or indexes
+// below it; without them the whole state is listed by section. depth limits
+// nesting, offset and limit page through the entries, and since, set to the
+// cursor of the previous response for the same path, returns only the
+// entries that changed.
+func (h *Handlers) InspectRuntime(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	q, err := inspectQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+
+	res, err := runtimeInspector(session).Inspect(session.Runtime.InspectState(), q)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, chariot.ErrInspectPath) {
+			status = http.StatusNotFound
+		}
+		return c.JSON(status, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: res})
+}
+
+// inspectQuery reads the path, depth, offset, limit and since parameters of
+// a runtime inspection.
+func inspectQuery(c echo.Context) (chariot.InspectQuery, error) {
+	var q chariot.InspectQuery
+	q.Path = c.QueryParams()["path"]
+	for _, p := range []struct {
+		name string
+		dest *int
+	}{{"depth", &q.Depth}, {"offset", &q.Offset}, {"limit", &q.Limit}} {
+		if raw := c.QueryParam(p.name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				return q, errors.New("Invalid " + p.name + ": must be a non-negative integer")
+			}
+			*p.dest = n
+		}
+	}
+	if raw := c.QueryParam("since"); raw != "" {
+		since, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return q, errors.New("Invalid since: must be a cursor from an earlier response")
+		}
+		q.Since = since
+	}
+	return q, nil
+}
+
+// WatchResult is the value of a watch expression after an execution, or the
+// error evaluating it.
+type WatchResult struct {
+	Expression string      `json:"expression"`
+	Value      interface{} `json:"value,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// watchList holds the expressions a session watches, in the order added.
+type watchList struct {
+	mu          sync.Mutex
+	expressions []string
+}
+
+func sessionWatches(session *chariot.Session) *watchList {
+	if v, ok := session.GetData(watchListKey); ok {
+		if w, ok := v.(*watchList); ok {
+			return w
+		}
+	}
+	w := &watchList{}
+	session.SetData(watchListKey, w)
+	return w
+}
+
+func (w *watchList) list() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.expressions...)
+}
+
+// evaluateWatches evaluates the session's watch expressions in rt, the
+// runtime a program last ran on. A failing expression reports its error
+// without affecting the others.
+func evaluateWatches(session *chariot.Session, rt *chariot.Runtime) []WatchResult {
+	exprs := sessionWatches(session).list()
+	if len(exprs) == 0 {
+		return nil
+	}
+	results := make([]WatchResult, 0, len(exprs))
+	for _, expr := range exprs {
+		results = append(results, evaluateWatch(rt, expr))
+	}
+	return results
+}
+
+func evaluateWatch(rt *chariot.Runtime, expr string) (res WatchResult) {
+	res.Expression = expr
+	defer func() {
+		if r := recover(); r != nil {
+			res.Value, res.Error = nil, fmt.Sprintf("panic: %v", r)
+		}
+	}()
+	val, err := rt.Evaluate(expr)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Value = convertValueToJSON(val)
+	return res
+}
+
+// ListWatches returns the session's watch expressions with their current values.
+//
+//	GET /api/runtime/watches
+func (h *Handlers) ListWatches(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	results := evaluateWatches(session, session.Runtime)
+	if results == nil {
+		results = []WatchResult{}
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: results})
+}
+
+// AddWatch adds an expression to the session's watch list and returns the
+// list with current values.
+//
+//	POST /api/runtime/watches {"expression": "length(orders)"}
+func (h *Handlers) AddWatch(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	var req struct {
+		Expression string `json:"expression"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "Invalid request format"})
+	}
+	expr := strings.TrimSpace(req.Expression)
+	if expr == "" {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "Missing expression"})
+	}
+	if _, err := session.Runtime.ParseProgram(expr); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "Invalid expression: " + err.Error()})
+	}
+
+	w := sessionWatches(session)
+	w.mu.Lock()
+	exists := false
+	for _, e := range w.expressions {
+		if e == expr {
+			exists = true
+			break
+		}
+	}
+	if !exists {
+		if len(w.expressions) >= maxWatches {
+			w.mu.Unlock()
+			return c.JSON(http.StatusBadRequest, ResultJSON{
+				Result: "ERROR",
+				Data:   "Watch list is full (" + strconv.Itoa(maxWatches) + " expressions)",
+			})
+		}
+		w.expressions = append(w.expressions, expr)
+	}
+	w.mu.Unlock()
+	return h.ListWatches(c)
+}
+
+// RemoveWatch removes an expression from the watch list, or clears the list
+// when no expression is given.
+//
+//	DELETE /api/runtime/watches?expression=length(orders)
+func (h *Handlers) RemoveWatch(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	expr := strings.TrimSpace(c.QueryParam("expression"))
+	w := sessionWatches(session)
+	w.mu.Lock()
+	if expr == "" {
+		w.expressions = nil
+	} else {
+		kept := w.expressions[:0]
+		for _, e := range w.expressions {
+			if e != expr {
+				kept = append(kept, e)
+			}
+		}
+		w.expressions = kept
+	}
+	w.mu.Unlock()
+	return h.ListWatches(c)
+}
+
+// Execution runtimes a request can choose: the session's persistent runtime,
+// or a fresh one that is discarded when the program finishes.
+const (
+	executionRuntimeSession   = "session"
+	executionRuntimeEphemeral = "ephemeral"
+)
+
+// executionRuntime returns the runtime a program runs on for the requested
+// mode, and a func to call once it has finished.
+func executionRuntime(session *chariot.Session, mode string) (*chariot.Runtime, func(), error) {
+	switch mode {
+	case "", executionRuntimeSession:
+		return session.BeginRun(), session.EndRun, nil
+	case executionRuntimeEphemeral:
+		return session.NewEphemeralRuntime(), func() {}, nil
+	}
+	return nil, nil, fmt.Errorf("unknown runtime %q (want %s or %s)", mode, executionRuntimeSession, executionRuntimeEphemeral)
+}
+
+// ResetRuntime replaces the session runtime with a freshly bootstrapped one.
+// Breakpoints and watch expressions are kept.
+//
+//	POST /api/runtime/reset
+func (h *Handlers) ResetRuntime(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	if err := session.ResetRuntime(); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, chariot.ErrRuntimeBusy) {
+			status = http.StatusConflict
+		}
+		return c.JSON(status, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: session.Runtime.Size()})
+}
+
+// RuntimeSize reports how much state the session runtime holds and when a
+// program last ran on it.
+//
+//	GET /api/runtime/size
+func (h *Handlers) RuntimeSize(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	data := map[string]interface{}{
+		"size":    session.Runtime.Size(),
+		"running": session.Running(),
+	}
+	if used := session.RuntimeUsed(); !used.IsZero() {
+		data["last_run"] = used
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: data})
+}
+
+// snapshotError maps a snapshot error to its HTTP status.
+func snapshotError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, chariot.ErrSnapshotNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, chariot.ErrRuntimeBusy):
+		status = http.StatusConflict
+	}
+	return c.JSON(status, ResultJSON{Result: "ERROR", Data: err.Error()})
+}
+
+// ListSnapshots lists the runtime snapshots available to the session, newest
+// first.
+//
+//	GET /api/runtime/snapshots
+func (h *Handlers) ListSnapshots(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	infos, err := chariot.ListSnapshots(session.Runtime.SnapshotDir())
+	if err != nil {
+		return snapshotError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: infos})
+}
+
+// SaveSnapshot saves the variables and functions of the session runtime
+// under a name, replacing an earlier snapshot of that name.
+//
+//	POST /api/runtime/snapshots {"name": "before-migration"}
+func (h *Handlers) SaveSnapshot(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "Invalid request format"})
+	}
+	if err := chariot.ValidateSnapshotName(req.Name); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	rt := session.BeginRun()
+	snap, err := rt.SaveSnapshotTo(req.Name)
+	session.EndRun()
+	if err != nil {
+		return snapshotError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: snapshotDescription(snap)})
+}
+
+// RestoreSnapshot replaces the state of the session runtime with a snapshot.
+// It fails with 409 while a program runs on the runtime.
+//
+//	POST /api/runtime/snapshots/:name/restore
+func (h *Handlers) RestoreSnapshot(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	name := c.Param("name")
+	if err := chariot.ValidateSnapshotName(name); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	if session.Running() {
+		return snapshotError(c, chariot.ErrRuntimeBusy)
+	}
+	rt := session.BeginRun()
+	snap, err := rt.RestoreSnapshotFrom(name)
+	session.EndRun()
+	if err != nil {
+		return snapshotError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: snapshotDescription(snap)})
+}
+
+// DeleteSnapshot removes a snapshot.
+//
+//	DELETE /api/runtime/snapshots/:name
+func (h *Handlers) DeleteSnapshot(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	name := c.Param("name")
+	if err := chariot.ValidateSnapshotName(name); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	if err := chariot.DeleteSnapshot(session.Runtime.SnapshotDir(), name); err != nil {
+		return snapshotError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: name})
+}
+
+// snapshotDescription summarizes a snapshot for API responses.
+func snapshotDescription(snap *chariot.RuntimeSnapshot) map[string]interface{} {
+	skipped := snap.Skipped
+	if skipped == nil {
+		skipped = []string{}
+	}
+	return map[string]interface{}{
+		"name":      snap.Name,
+		"created":   snap.Created,
+		"globals":   len(snap.Globals),
+		"variables": len(snap.Variables),
+		"functions": len(snap.Functions),
+		"lists":     len(snap.Lists),
+		"tables":    len(snap.Tables),
+		"nodes":     len(snap.Nodes),
+		"skipped":   skipped,
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+	"github.com/labstack/echo/v4"
+)
+
+// systemLogLimit is how many entries /api/logs/system returns by default.
+const systemLogLimit = 500
+
+// SystemLogFile returns the path of the application log file, or "" when
+// logs only go to stderr.
+func SystemLogFile() string {
+	return dataFile(cfg.ChariotConfig.LogFile)
+}
+
+// SystemLogs returns the most recent entries of the application log files,
+// oldest first. since is an RFC 3339 time or a duration back from now (15m);
+// level is the least severe level kept; component is backend for the
+// server's own entries or the component a subsystem tagged its entries with.
+//
+//	GET /api/logs/system?since=1h&level=warn&component=backend&q=timeout&limit=500
+func (h *Handlers) SystemLogs(c echo.Context) error {
+	path := SystemLogFile()
+	if path == "" {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "log files are not enabled (CHARIOT_LOG_FILE)"})
+	}
+	q := logs.Query{
+		Level:     c.QueryParam("level"),
+		Component: c.QueryParam("component"),
+		Contains:  c.QueryParam("q"),
+		Limit:     systemLogLimit,
+	}
+	if since := c.QueryParam("since"); since != "" {
+		if d, err := time.ParseDuration(since); err == nil {
+			q.Since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			q.Since = t
+		} else {
+			return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "since must be an RFC 3339 time or a duration such as 15m"})
+		}
+	}
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "limit must be a positive number"})
+		}
+		q.Limit = n
+	}
+	entries, err := logs.ReadEntries(path, q)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	if entries == nil {
+		entries = []logs.Entry{}
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: entries})
+}
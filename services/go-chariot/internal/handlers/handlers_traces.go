@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// runRecorded calls run, which runs program on rt for session. With record
+// set, the run's trace is saved to the user's trace directory and its name
+// returned.
+func runRecorded(session *chariot.Session, rt *chariot.Runtime, record bool, program, filename string, run func() (chariot.Value, error)) (chariot.Value, string, error) {
+	if !record {
+		val, err := run()
+		return val, "", err
+	}
+	t, err := rt.StartRecording(chariot.NewTraceName(session.UserID), program, nil, nil)
+	if err != nil {
+		cfg.ChariotLogger.Warn("Execution trace not recorded", zap.String("user", session.UserID), zap.Error(err))
+		val, err := run()
+		return val, "", err
+	}
+	t.Source = session.UserID
+	t.Filename = filename
+	val, runErr := run()
+	rt.StopTrace()
+	if runErr != nil {
+		t.Error = runErr.Error()
+	}
+	if err := chariot.SaveTrace(chariot.UserTraceDir(session.UserID), t); err != nil {
+		cfg.ChariotLogger.Warn("Execution trace not saved", zap.String("user", session.UserID), zap.Error(err))
+		return val, "", runErr
+	}
+	return val, t.Name, runErr
+}
+
+// traceDirs returns the user's trace directory and, when it is another
+// one, the directory of the traces listeners record.
+func traceDirs(userID string) []string {
+	own, shared := chariot.UserTraceDir(userID), chariot.SharedTraceDir()
+	if own == shared {
+		return []string{own}
+	}
+	return []string{own, shared}
+}
+
+// findTrace returns the directory holding the trace called name.
+func findTrace(userID, name string) (string, *chariot.ExecutionTrace, error) {
+	var err error
+	for _, dir := range traceDirs(userID) {
+		var t *chariot.ExecutionTrace
+		if t, err = chariot.LoadTrace(dir, name); err == nil {
+			return dir, t, nil
+		}
+		if !errors.Is(err, chariot.ErrTraceNotFound) {
+			break
+		}
+	}
+	return "", nil, err
+}
+
+func traceError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, chariot.ErrTraceNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, chariot.ErrTraceDiverged):
+		status = http.StatusConflict
+	}
+	return c.JSON(status, ResultJSON{Result: "ERROR", Data: err.Error()})
+}
+
+// ListTraces lists the session user's execution traces and those recorded
+// by listeners, newest first.
+//
+//	GET /api/traces
+func (h *Handlers) ListTraces(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	all := []chariot.TraceInfo{}
+	for i, dir := range traceDirs(session.UserID) {
+		infos, err := chariot.ListTraces(dir)
+		if err != nil {
+			return traceError(c, err)
+		}
+		for _, info := range infos {
+			info.Shared = i > 0
+			all = append(all, info)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Created.After(all[j].Created) })
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: all})
+}
+
+// GetTrace returns a trace: the program, its inputs and the recorded calls.
+//
+//	GET /api/traces/:name
+func (h *Handlers) GetTrace(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	_, t, err := findTrace(session.UserID, c.Param("name"))
+	if err != nil {
+		return traceError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: t})
+}
+
+// DeleteTrace removes a trace.
+//
+//	DELETE /api/traces/:name
+func (h *Handlers) DeleteTrace(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	name := c.Param("name")
+	dir, _, err := findTrace(session.UserID, name)
+	if err == nil {
+		err = chariot.DeleteTrace(dir, name)
+	}
+	if err != nil {
+		return traceError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: name})
+}
+
+// ReplayTrace runs a traced program again from the state it was recorded
+// in, answering the time, random numbers, database results and other
+// outside inputs from the trace. It runs on a fresh runtime unless runtime
+// is "session". A program that makes other outside calls than the recorded
+// run fails with 409.
+//
+//	POST /api/traces/:name/replay {"runtime": "ephemeral"}
+func (h *Handlers) ReplayTrace(c echo.Context) error {
+	session := c.Get("session").(*chariot.Session)
+	var req struct {
+		Runtime string `json:"runtime"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "Invalid request format"})
+	}
+	if req.Runtime == "" {
+		req.Runtime = executionRuntimeEphemeral
+	}
+	_, t, err := findTrace(session.UserID, c.Param("name"))
+	if err != nil {
+		return traceError(c, err)
+	}
+	done, ok, err := h.admitExecution(c, session.UserID)
+	if !ok {
+		return err
+	}
+	defer done()
+	rt, release, err := executionRuntime(session, req.Runtime)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	defer release()
+	session.RecordExecution(t.Filename)
+
+	val, used, runErr := rt.Replay(t)
+	if errors.Is(runErr, chariot.ErrTraceDiverged) {
+		return traceError(c, runErr)
+	}
+	report := map[string]interface{}{
+		"trace":          t.Name,
+		"calls_recorded": len(t.Calls),
+		"calls_used":     used,
+		"recorded_error": t.Error,
+	}
+	res := ResultJSON{Result: "OK", Data: report}
+	if runErr != nil {
+		report["error"] = runErr.Error()
+		report["reproduced"] = runErr.Error() == t.Error
+		res.Error = chariot.DescribeError(runErr)
+	} else {
+		report["result"] = convertValueToJSON(val)
+		report["reproduced"] = t.Error == ""
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"path/filepath"
+	"sort"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/labstack/echo/v4"
+)
+
+// TreeKeyUsage is an encryption key and the secure trees encrypted with it.
+type TreeKeyUsage struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"`         // keystore or vault
+	Type    string `json:"type,omitempty"` // Algorithm of keystore keys
+	Version int    `json:"version,omitempty"`
+	Trees   int    `json:"trees"`
+	Stale   int    `json:"stale"` // Encrypted with an older version
+}
+
+// treeKeyUsage counts the trees per key: every keystore encryption key and
+// the vault keys trees are encrypted with.
+func treeKeyUsage(trees []chariot.SecureTreeInfo) []TreeKeyUsage {
+	usage := map[string]*TreeKeyUsage{}
+	for _, k := range chariot.KeystoreKeys() {
+		if k.Type == chariot.KeyTypeAESGCM || k.Type == chariot.KeyTypeChaCha20 {
+			usage["keystore/"+k.Name] = &TreeKeyUsage{Name: k.Name, Source: "keystore", Type: k.Type, Version: k.Version}
+		}
+	}
+	for _, t := range trees {
+		if !t.Encrypted {
+			continue
+		}
+		u := usage[t.KeySource+"/"+t.KeyID]
+		if u == nil {
+			// Vault keys, and keystore keys deleted since
+			u = &TreeKeyUsage{Name: t.KeyID, Source: t.KeySource}
+			usage[t.KeySource+"/"+t.KeyID] = u
+		}
+		u.Trees++
+		if u.Version != 0 && t.KeyVersion < u.Version {
+			u.Stale++
+		}
+	}
+	out := make([]TreeKeyUsage, 0, len(usage))
+	for _, u := range usage {
+		out = append(out, *u)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Source < out[j].Source
+	})
+	return out
+}
+
+// TreeKeys lists the secure trees in the tree directory and the keys they
+// are encrypted with, so trees can be re-encrypted before old key versions
+// are pruned.
+func (h *Handlers) TreeKeys(c echo.Context) error {
+	trees, err := chariot.ListSecureTrees()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]interface{}{
+		"keys":  treeKeyUsage(trees),
+		"trees": trees,
+	}})
+}
+
+// ReencryptTrees encrypts the secure trees using a key again: with its
+// current version, or with another key when "to" is given. Files that fail
+// are reported and the others still re-encrypted.
+func (h *Handlers) ReencryptTrees(c echo.Context) error {
+	var req struct {
+		Key string `json:"key"`
+		To  string `json:"to"`
+	}
+	if err := c.Bind(&req); err != nil || req.Key == "" {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "key is required"})
+	}
+	trees, err := chariot.ListSecureTrees()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	service := chariot.GetTreeSerializerService()
+	results := []*chariot.ReencryptResult{}
+	failed := map[string]string{}
+	for _, t := range trees {
+		if !t.Encrypted || t.KeyID != req.Key {
+			continue
+		}
+		result, err := service.ReencryptSecureAgent(filepath.Join(cfg.ChariotConfig.TreePath, t.File), req.To)
+		if err != nil {
+			failed[t.File] = err.Error()
+			continue
+		}
+		result.File = t.File
+		results = append(results, result)
+	}
+	status, outcome := http.StatusOK, "OK"
+	if len(failed) > 0 {
+		status, outcome = http.StatusInternalServerError, "ERROR"
+	}
+	return c.JSON(status, ResultJSON{Result: outcome, Data: map[string]interface{}{
+		"reencrypted": results,
+		"failed":      failed,
+	}})
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// usageSaveInterval is how often the usage counts are written to the usage
+// file; deprecations are written as soon as they change.
+const usageSaveInterval = time.Minute
+
+// startUsagePersistence restores the function usage and deprecations from
+// the usage file and saves them, and the tag usage, periodically.
+func (h *Handlers) startUsagePersistence() {
+	if file := dataFile(cfg.ChariotConfig.UsageFile); file != "" {
+		if err := chariot.LoadUsage(file); err != nil {
+			cfg.ChariotLogger.Warn("Failed to load function usage", zap.String("file", file), zap.Error(err))
+		}
+	}
+	h.goBackground(func() {
+		ticker := time.NewTicker(usageSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.done:
+				return
+			case <-ticker.C:
+			}
+			saveUsage()
+			if err := h.tagUsage.Save(); err != nil {
+				cfg.ChariotLogger.Warn("Failed to save tag usage", zap.Error(err))
+			}
+		}
+	})
+}
+
+func saveUsage() {
+	file := dataFile(cfg.ChariotConfig.UsageFile)
+	if file == "" {
+		return
+	}
+	if err := chariot.SaveUsage(file); err != nil {
+		cfg.ChariotLogger.Warn("Failed to save function usage", zap.String("file", file), zap.Error(err))
+	}
+}
+
+// UsageReport returns the call counts and last use of the stored functions
+// and script files. The bootstrap runtime's functions, the function library
+// among them, are listed even if never called. With unused=N only the
+// entries not used in the last N days are returned.
+//
+//	GET /api/usage?unused=30
+func (h *Handlers) UsageReport(c echo.Context) error {
+	var known []string
+	if h.bootstrapRuntime != nil {
+		for name := range h.bootstrapRuntime.ListUserFunctionsMap() {
+			known = append(known, name)
+		}
+	}
+	report := chariot.Usage(known...)
+	if s := c.QueryParam("unused"); s != "" {
+		days, err := strconv.Atoi(s)
+		if err != nil || days < 0 {
+			return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "unused must be a number of days"})
+		}
+		cutoff := time.Now().AddDate(0, 0, -days)
+		report.Functions = unusedSince(report.Functions, cutoff)
+		report.Files = unusedSince(report.Files, cutoff)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: report})
+}
+
+func unusedSince(entries []chariot.UsageEntry, cutoff time.Time) []chariot.UsageEntry {
+	out := entries[:0]
+	for _, e := range entries {
+		if e.LastUsed.Before(cutoff) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// DeprecateFunctionHandler marks a function deprecated; calls keep working
+// but log a warning with the note.
+//
+//	PUT /api/functions/:name/deprecation {"note": "use newName"}
+func (h *Handlers) DeprecateFunctionHandler(c echo.Context) error {
+	var req struct {
+		Note string `json:"note"`
+	}
+	_ = c.Bind(&req)
+	name := c.Param("name")
+	chariot.DeprecateFunction(name, req.Note)
+	saveUsage()
+	cfg.ChariotLogger.Info("Function deprecated", zap.String("function", name), zap.String("note", req.Note))
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]string{"name": name, "note": req.Note}})
+}
+
+// UndeprecateFunctionHandler clears a function's deprecation.
+//
+//	DELETE /api/functions/:name/deprecation
+func (h *Handlers) UndeprecateFunctionHandler(c echo.Context) error {
+	name := c.Param("name")
+	if !chariot.UndeprecateFunction(name) {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: "function '" + name + "' is not deprecated"})
+	}
+	saveUsage()
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: name})
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/users"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// dataFile returns name under the data path, or "" when name is empty.
+func dataFile(name string) string {
+	if name == "" {
+		return ""
+	}
+	base := cfg.ChariotConfig.DataPath
+	if base == "" {
+		base = "./data"
+	}
+	return filepath.Join(base, name)
+}
+
+// newUserStore opens the account store under the data path.
+func newUserStore() *users.Store {
+	file := dataFile(cfg.ChariotConfig.UsersFile)
+	s, err := users.Open(file)
+	if err != nil {
+		cfg.ChariotLogger.Error("Failed to load the account store; logins are refused", zap.String("path", file), zap.Error(err))
+	}
+	s.SetPolicy(users.Policy{
+		MinLength:  cfg.ChariotConfig.PasswordMinLength,
+		MinClasses: cfg.ChariotConfig.PasswordMinClasses,
+		MaxAge:     time.Duration(cfg.ChariotConfig.PasswordMaxAgeDays) * 24 * time.Hour,
+	})
+	return s
+}
+
+// userReq is the body of the account create and update endpoints.
+type userReq struct {
+	UserID      string    `json:"user_id"`
+	DisplayName *string   `json:"display_name"`
+	Email       *string   `json:"email"`
+	Roles       *[]string `json:"roles"`
+	Disabled    *bool     `json:"disabled"`
+	Password    string    `json:"password"`
+}
+
+func usersError(c echo.Context, err error) error {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, users.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, users.ErrExists), errors.Is(err, users.ErrLastAdmin), errors.Is(err, users.ErrNoEnrollment):
+		status = http.StatusConflict
+	case errors.Is(err, users.ErrInvalidCode):
+		status = http.StatusForbidden
+	case errors.Is(err, users.ErrCodeLocked):
+		status = http.StatusTooManyRequests
+	}
+	return c.JSON(status, ResultJSON{Result: "ERROR", Data: err.Error()})
+}
+
+// ListUsers returns the accounts and the roles they may hold.
+func (h *Handlers) ListUsers(c echo.Context) error {
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]interface{}{
+		"users": h.users.List(),
+		"roles": users.Roles,
+	}})
+}
+
+func (h *Handlers) GetUser(c echo.Context) error {
+	u, err := h.users.Get(c.Param("user"))
+	if err != nil {
+		return usersError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: u})
+}
+
+// CreateUser adds an account. Without a password one is generated and
+// returned once under "password".
+func (h *Handlers) CreateUser(c echo.Context) error {
+	var req userReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
+	}
+	u := users.User{ID: req.UserID, Roles: []string{users.RoleContributor}}
+	if req.DisplayName != nil {
+		u.DisplayName = *req.DisplayName
+	}
+	if req.Email != nil {
+		u.Email = *req.Email
+	}
+	if req.Roles != nil {
+		u.Roles = *req.Roles
+	}
+	if req.Disabled != nil {
+		u.Disabled = *req.Disabled
+	}
+	password := req.Password
+	if password == "" {
+		password = h.users.GeneratePassword()
+	}
+	created, err := h.users.Create(u, password)
+	if err != nil {
+		return usersError(c, err)
+	}
+	h.logAccountChange(c, "Account created", created.ID)
+	data := map[string]interface{}{"user": created}
+	if req.Password == "" {
+		data["password"] = password
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: data})
+}
+
+// UpdateUser changes the display name, email, roles or disabled state of an
+// account. Disabling an account ends its sessions.
+func (h *Handlers) UpdateUser(c echo.Context) error {
+	var req userReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
+	}
+	id := c.Param("user")
+	u, err := h.users.Update(id, users.Update{
+		DisplayName: req.DisplayName,
+		Email:       req.Email,
+		Roles:       req.Roles,
+		Disabled:    req.Disabled,
+	})
+	if err != nil {
+		return usersError(c, err)
+	}
+	if u.Disabled {
+		h.endUserSessions(id)
+	}
+	h.logAccountChange(c, "Account updated", id)
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: u})
+}
+
+// ResetUserPassword sets an account's password, generating one when the
+// body has none, and ends the account's sessions unless it is the caller's.
+func (h *Handlers) ResetUserPassword(c echo.Context) error {
+	var req userReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
+	}
+	id := c.Param("user")
+	generated, err := h.users.SetPassword(id, req.Password)
+	if err != nil {
+		return usersError(c, err)
+	}
+	if admin, _ := c.Get("session").(*chariot.Session); admin == nil || admin.UserID != id {
+		h.endUserSessions(id)
+	}
+	h.logAccountChange(c, "Account password reset", id)
+	data := map[string]interface{}{"user_id": id}
+	if generated != "" {
+		data["password"] = generated
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: data})
+}
+
+// ResetUserMFA removes an account's second factor, for users who lost their
+// authenticator and recovery codes.
+func (h *Handlers) ResetUserMFA(c echo.Context) error {
+	id := c.Param("user")
+	u, err := h.users.ResetTOTP(id)
+	if err != nil {
+		return usersError(c, err)
+	}
+	h.logAccountChange(c, "Account second factor reset", id)
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: u})
+}
+
+// DeleteUser removes an account and ends its sessions.
+func (h *Handlers) DeleteUser(c echo.Context) error {
+	id := c.Param("user")
+	if err := h.users.Delete(id); err != nil {
+		return usersError(c, err)
+	}
+	h.endUserSessions(id)
+	h.logAccountChange(c, "Account deleted", id)
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]string{"deleted": id}})
+}
+
+func (h *Handlers) logAccountChange(c echo.Context, msg, user string) {
+	admin := ""
+	if s, ok := c.Get("session").(*chariot.Session); ok && s != nil {
+		admin = s.UserID
+	}
+	cfg.ChariotLogger.Info(msg, zap.String("admin", admin), zap.String("user", user))
+}
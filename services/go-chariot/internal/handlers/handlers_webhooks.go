@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/listeners"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/webhooks"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// newWebhookDispatcher opens the webhook registry under the data path. An
+// unreadable registry is logged and replaced by an empty in-memory one, so
+// webhooks never keep the server from starting.
+func newWebhookDispatcher() *webhooks.Dispatcher {
+	opts := webhooks.Options{
+		MaxAttempts: cfg.ChariotConfig.WebhookMaxAttempts,
+		Timeout:     time.Duration(cfg.ChariotConfig.WebhookTimeout) * time.Second,
+	}
+	if file := cfg.ChariotConfig.WebhooksFile; file != "" {
+		base := cfg.ChariotConfig.DataPath
+		if base == "" {
+			base = "./data"
+		}
+		opts.File = filepath.Join(base, file)
+	}
+	d, err := webhooks.New(opts)
+	if err != nil {
+		cfg.ChariotLogger.Warn("Failed to load webhooks registry; webhooks will not persist", zap.Error(err))
+		opts.File = ""
+		d, _ = webhooks.New(opts)
+	}
+	return d
+}
+
+// notifyExecution sends execution.finished or execution.failed for a
+// completed execution record.
+func (h *Handlers) notifyExecution(rec *executionRecord) {
+	data := map[string]interface{}{
+		"execution_id": rec.ID,
+		"user_id":      rec.UserID,
+		"filename":     rec.Filename,
+		"started_at":   rec.StartedAt,
+		"completed_at": rec.CompletedAt,
+		"duration_ms":  rec.CompletedAt.Sub(rec.StartedAt).Milliseconds(),
+	}
+	if rec.Error != "" {
+		data["error"] = rec.Error
+		data["error_info"] = rec.ErrorInfo
+		h.webhooks.Notify(webhooks.ExecutionFailed, data)
+		return
+	}
+	h.webhooks.Notify(webhooks.ExecutionFinished, data)
+}
+
+// notifyListenerUnhealthy is the listener manager's OnUnhealthy hook.
+func (h *Handlers) notifyListenerUnhealthy(l listeners.Listener, err error) {
+	h.webhooks.Notify(webhooks.ListenerUnhealthy, map[string]interface{}{
+		"listener": l.Name,
+		"status":   l.Status,
+		"error":    err.Error(),
+	})
+}
+
+type webhookReq struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Secret      string   `json:"secret"`
+	Description string   `json:"description"`
+	Active      *bool    `json:"active"` // default true
+}
+
+func (r webhookReq) subscription() webhooks.Subscription {
+	active := r.Active == nil || *r.Active
+	return webhooks.Subscription{URL: r.URL, Events: r.Events, Secret: r.Secret, Description: r.Description, Active: active}
+}
+
+func webhookError(c echo.Context, err error) error {
+	if errors.Is(err, webhooks.ErrNotFound) {
+		return c.JSON(http.StatusNotFound, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+}
+
+// ListWebhooks returns the webhook subscriptions, without their secrets, and
+// the event types that can be subscribed to.
+func (h *Handlers) ListWebhooks(c echo.Context) error {
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]interface{}{
+		"webhooks": h.webhooks.List(),
+		"events":   webhooks.EventTypes,
+	}})
+}
+
+// CreateWebhook adds a subscription. The response carries the signing
+// secret, which is not returned again.
+func (h *Handlers) CreateWebhook(c echo.Context) error {
+	var req webhookReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
+	}
+	sub, err := h.webhooks.Create(req.subscription())
+	if err != nil {
+		return webhookError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: sub})
+}
+
+// UpdateWebhook replaces a subscription's settings; an empty secret keeps
+// the current one.
+func (h *Handlers) UpdateWebhook(c echo.Context) error {
+	var req webhookReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid request"})
+	}
+	sub, err := h.webhooks.Update(c.Param("id"), req.subscription())
+	if err != nil {
+		return webhookError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: sub})
+}
+
+func (h *Handlers) DeleteWebhook(c echo.Context) error {
+	if err := h.webhooks.Delete(c.Param("id")); err != nil {
+		return webhookError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]string{"deleted": c.Param("id")}})
+}
+
+// TestWebhook queues a ping event for a subscription; its outcome appears in
+// the delivery log.
+func (h *Handlers) TestWebhook(c echo.Context) error {
+	eventID, err := h.webhooks.Ping(c.Param("id"))
+	if err != nil {
+		return webhookError(c, err)
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: map[string]string{"event": eventID}})
+}
+
+// WebhookDeliveries returns recent delivery attempts, newest first, for one
+// subscription or, without an id, for all of them.
+func (h *Handlers) WebhookDeliveries(c echo.Context) error {
+	limit := 100
+	if v, err := strconv.Atoi(c.QueryParam("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: h.webhooks.Deliveries(c.Param("id"), limit)})
+}
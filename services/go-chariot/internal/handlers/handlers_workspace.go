@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/listeners"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/workspace"
+	"github.com/labstack/echo/v4"
+)
+
+// maxWorkspaceArchive bounds the size of an uploaded workspace archive.
+const maxWorkspaceArchive = 256 << 20
+
+// loadWorkspace gathers the request scope's files and diagrams directories,
+// the function library and the listener definitions.
+func (h *Handlers) loadWorkspace(c echo.Context) (workspace.Workspace, cfg.StorageScope, error) {
+	sess, _ := c.Get("session").(*chariot.Session)
+	if sess == nil {
+		return workspace.Workspace{}, "", errors.New("session required")
+	}
+	filesDir, scope, err := filesDirFor(c, sess)
+	if err != nil {
+		return workspace.Workspace{}, scope, err
+	}
+	diagramsDir, _, err := resolveDiagramBase(c, string(scope))
+	if err != nil {
+		return workspace.Workspace{}, scope, err
+	}
+	ws := workspace.Workspace{FilesDir: filesDir, DiagramsDir: diagramsDir, Listeners: map[string]json.RawMessage{}}
+
+	if cfg.ChariotConfig.FunctionLib != "" {
+		ws.Functions = map[string]json.RawMessage{}
+		if funcs, err := chariot.LoadFunctionsFromFile(cfg.ChariotConfig.FunctionLib); err == nil {
+			for name, fn := range funcs {
+				data, err := json.Marshal(chariot.FunctionValueToMap(fn))
+				if err != nil {
+					return ws, scope, fmt.Errorf("function '%s': %w", name, err)
+				}
+				ws.Functions[name] = data
+			}
+		}
+	}
+	for _, l := range h.listenerManager.List() {
+		// Export the definition only; runtime state does not move between servers.
+		def := listeners.Listener{Name: l.Name, Script: l.Script, OnStart: l.OnStart, OnExit: l.OnExit, Snapshot: l.Snapshot, AutoStart: l.AutoStart, Status: "stopped"}
+		data, err := json.Marshal(def)
+		if err != nil {
+			return ws, scope, err
+		}
+		ws.Listeners[l.Name] = data
+	}
+	return ws, scope, nil
+}
+
+// ExportWorkspace returns a zip of the scope's files and diagrams, the function
+// library and the listener definitions: GET /api/workspace/export?scope=...
+func (h *Handlers) ExportWorkspace(c echo.Context) error {
+	ws, scope, err := h.loadWorkspace(c)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	var buf bytes.Buffer
+	if _, err := workspace.Export(&buf, ws, string(scope)); err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	setScopeHeader(c, scope)
+	filename := fmt.Sprintf("chariot-workspace-%s-%s.zip", scope, time.Now().Format("20060102-150405"))
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return c.Blob(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// ImportWorkspace unpacks a workspace zip into the request scope:
+// POST /api/workspace/import?scope=...&policy=skip|overwrite|rename|fail.
+// The archive is the raw body or a multipart "file" field. Under policy=fail,
+// conflicts are reported with 409 and nothing is imported.
+func (h *Handlers) ImportWorkspace(c echo.Context) error {
+	policy, err := workspace.ParsePolicy(c.QueryParam("policy"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	data, err := readWorkspaceArchive(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "invalid zip archive: " + err.Error()})
+	}
+	ws, scope, err := h.loadWorkspace(c)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	setScopeHeader(c, scope)
+
+	report, err := workspace.Import(zr, ws, policy)
+	if errors.Is(err, workspace.ErrConflict) {
+		return c.JSON(http.StatusConflict, ResultJSON{Result: "ERROR", Data: report})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	if err := h.persistImported(ws, report); err != nil {
+		return c.JSON(http.StatusInternalServerError, ResultJSON{Result: "ERROR", Data: err.Error()})
+	}
+	return c.JSON(http.StatusOK, ResultJSON{Result: "OK", Data: report})
+}
+
+func readWorkspaceArchive(c echo.Context) ([]byte, error) {
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, maxWorkspaceArchive)
+	var src io.Reader = req.Body
+	if fh, err := c.FormFile("file"); err == nil {
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		src = f
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("workspace archive required")
+	}
+	return data, nil
+}
+
+// persistImported stores the functions and listeners Import added to the
+// workspace maps. Files and diagrams were already written by Import; entries
+// that cannot be stored move from Imported to Failed.
+func (h *Handlers) persistImported(ws workspace.Workspace, report *workspace.Report) error {
+	kept := report.Imported[:0]
+	funcs := map[string]*chariot.FunctionValue{}
+	for _, item := range report.Imported {
+		name := item.Name
+		if item.As != "" {
+			name = item.As
+		}
+		var err error
+		switch item.Kind {
+		case workspace.KindFunction:
+			var m map[string]interface{}
+			if err = json.Unmarshal(ws.Functions[name], &m); err == nil {
+				var fn *chariot.FunctionValue
+				if fn, err = chariot.MapToFunctionValue(m); err == nil {
+					fn.Name = name
+					funcs[name] = fn
+				}
+			}
+		case workspace.KindListener:
+			var l listeners.Listener
+			if err = json.Unmarshal(ws.Listeners[name], &l); err == nil {
+				l.Name = name
+				err = h.listenerManager.Put(l)
+			}
+		}
+		if err != nil {
+			item.Error = err.Error()
+			report.Failed = append(report.Failed, item)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	report.Imported = kept
+
+	if len(funcs) == 0 {
+		return nil
+	}
+	library, err := chariot.LoadFunctionsFromFile(cfg.ChariotConfig.FunctionLib)
+	if err != nil {
+		library = map[string]*chariot.FunctionValue{}
+	}
+	for name, fn := range funcs {
+		library[name] = fn
+	}
+	if err := chariot.SaveFunctionsToFile(library, cfg.ChariotConfig.FunctionLib); err != nil {
+		return fmt.Errorf("save function library: %w", err)
+	}
+	for name, fn := range funcs {
+		h.bootstrapRuntime.RegisterFunction(name, fn)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/statestore"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyHeader  = "Idempotency-Key"
+	idempotencyReplay  = "Idempotent-Replayed" // set on responses answered from an earlier request
+	idempotencyMaxSize = 255
+)
+
+// idempotentResponse is the stored outcome of a request made with an
+// Idempotency-Key. Until the request finishes it only holds the hash.
+type idempotentResponse struct {
+	Hash        string    `json:"hash"` // of the method, path and body
+	Done        bool      `json:"done"`
+	Status      int       `json:"status,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	Created     time.Time `json:"created"`
+}
+
+func idempotencyStoreKey(user, key string) string { return "idem:" + user + ":" + key }
+
+// localIdempotency keeps responses for Handlers built without a session
+// manager.
+var localIdempotency = statestore.NewMemory()
+
+// idempotencyMu makes claiming a key atomic on this replica.
+var idempotencyMu sync.Mutex
+
+func (h *Handlers) idempotencyStore() statestore.Store {
+	if h.sessionManager == nil {
+		return localIdempotency
+	}
+	return h.sessionManager.Store()
+}
+
+func idempotencyWindow() time.Duration {
+	if m := cfg.ChariotConfig.IdempotencyWindow; m > 0 {
+		return time.Duration(m) * time.Minute
+	}
+	return 24 * time.Hour
+}
+
+// idempotencyRetryable reports whether a response means the request was not
+// carried out, so a retry with the same key should run it.
+func idempotencyRetryable(status int) bool {
+	return status >= 500 || status == http.StatusRequestTimeout || status == http.StatusConflict || status == http.StatusTooManyRequests
+}
+
+// responseTee copies what a handler writes.
+type responseTee struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (t *responseTee) Write(p []byte) (int, error) {
+	t.body.Write(p)
+	return t.ResponseWriter.Write(p)
+}
+
+// Idempotent answers a request repeating the Idempotency-Key of an earlier
+// one by the same user, within the idempotency window, with the earlier
+// response instead of running the handler again. The key may only be reused
+// for the same request; while the first request runs, repeats get 409.
+// Requests without the header are passed through.
+func (h *Handlers) Idempotent(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := strings.TrimSpace(c.Request().Header.Get(idempotencyHeader))
+		if key == "" {
+			return next(c)
+		}
+		if len(key) > idempotencyMaxSize {
+			return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "Idempotency-Key is too long"})
+		}
+		user := ""
+		if session, ok := c.Get("session").(*chariot.Session); ok {
+			user = session.UserID
+		}
+		req := c.Request()
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ResultJSON{Result: "ERROR", Data: "failed to read request body"})
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.New()
+		sum.Write([]byte(req.Method + " " + req.URL.Path + "\n"))
+		sum.Write(body)
+		hash := hex.EncodeToString(sum.Sum(nil))
+
+		store, storeKey := h.idempotencyStore(), idempotencyStoreKey(user, key)
+		prev, claimed, err := claimIdempotencyKey(store, storeKey, hash)
+		if err != nil {
+			cfg.ChariotLogger.Warn("Idempotency key not checked", zap.String("user", user), zap.Error(err))
+			return next(c)
+		}
+		if !claimed {
+			switch {
+			case prev.Hash != hash:
+				return c.JSON(http.StatusUnprocessableEntity, ResultJSON{Result: "ERROR", Data: "Idempotency-Key was already used for a different request"})
+			case !prev.Done:
+				c.Response().Header().Set("Retry-After", "1")
+				return c.JSON(http.StatusConflict, ResultJSON{Result: "ERROR", Data: "a request with this Idempotency-Key is still running"})
+			}
+			c.Response().Header().Set(idempotencyReplay, "true")
+			return c.Blob(prev.Status, prev.ContentType, prev.Body)
+		}
+
+		// Release the key unless a response worth replaying is stored, so a
+		// failed request can be retried with it
+		kept := false
+		defer func() {
+			if !kept {
+				_ = store.Delete(storeKey)
+			}
+		}()
+		tee := &responseTee{ResponseWriter: c.Response().Writer}
+		c.Response().Writer = tee
+		err = next(c)
+		c.Response().Writer = tee.ResponseWriter
+		res := c.Response()
+		if err != nil || !res.Committed || idempotencyRetryable(res.Status) {
+			return err
+		}
+		data, merr := json.Marshal(idempotentResponse{
+			Hash:        hash,
+			Done:        true,
+			Status:      res.Status,
+			ContentType: res.Header().Get(echo.HeaderContentType),
+			Body:        tee.body.Bytes(),
+			Created:     time.Now(),
+		})
+		if merr == nil {
+			merr = store.Put(storeKey, data, idempotencyWindow())
+		}
+		if merr != nil {
+			cfg.ChariotLogger.Warn("Idempotent response not stored", zap.String("user", user), zap.Error(merr))
+			return nil
+		}
+		kept = true
+		return nil
+	}
+}
+
+// claimIdempotencyKey marks key as taken by the request with hash, or
+// returns the request that holds it. Claims are atomic on one replica;
+// across replicas two requests racing with the same key may both run.
+func claimIdempotencyKey(store statestore.Store, key, hash string) (*idempotentResponse, bool, error) {
+	idempotencyMu.Lock()
+	defer idempotencyMu.Unlock()
+	data, err := store.Get(key)
+	if err == nil {
+		var prev idempotentResponse
+		if err := json.Unmarshal(data, &prev); err != nil {
+			return nil, false, err
+		}
+		return &prev, false, nil
+	}
+	if !errors.Is(err, statestore.ErrNotFound) {
+		return nil, false, err
+	}
+	data, err = json.Marshal(idempotentResponse{Hash: hash, Created: time.Now()})
+	if err != nil {
+		return nil, false, err
+	}
+	if err := store.Put(key, data, idempotencyWindow()); err != nil {
+		return nil, false, err
+	}
+	return nil, true, nil
+}
@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/storage"
+	"go.uber.org/zap"
+)
+
+// Quota names, as reported in quota errors and the usage API.
+const (
+	quotaFileBytes            = "file_bytes"
+	quotaExecutionsPerHour    = "executions_per_hour"
+	quotaConcurrentExecutions = "concurrent_executions"
+	quotaListeners            = "listeners"
+)
+
+// Quota is what one user may use; 0 is unlimited.
+type Quota struct {
+	FileBytes            int64 `json:"file_bytes"`            // stored in the user's sandbox
+	ExecutionsPerHour    int64 `json:"executions_per_hour"`   // started in the last hour
+	ConcurrentExecutions int64 `json:"concurrent_executions"` // running at once
+	Listeners            int64 `json:"listeners"`             // created by the user
+}
+
+// QuotaLimits overrides some of a role's or user's limits. Unset fields
+// inherit; 0 is unlimited.
+type QuotaLimits struct {
+	FileBytes            *int64 `json:"file_bytes,omitempty"`
+	ExecutionsPerHour    *int64 `json:"executions_per_hour,omitempty"`
+	ConcurrentExecutions *int64 `json:"concurrent_executions,omitempty"`
+	Listeners            *int64 `json:"listeners,omitempty"`
+}
+
+func (l QuotaLimits) fields() []*int64 {
+	return []*int64{l.FileBytes, l.ExecutionsPerHour, l.ConcurrentExecutions, l.Listeners}
+}
+
+func (q *Quota) fields() []*int64 {
+	return []*int64{&q.FileBytes, &q.ExecutionsPerHour, &q.ConcurrentExecutions, &q.Listeners}
+}
+
+// QuotaUsage is what a user currently uses on this replica.
+type QuotaUsage struct {
+	FileBytes            int64 `json:"file_bytes"`
+	ExecutionsLastHour   int64 `json:"executions_last_hour"`
+	ConcurrentExecutions int64 `json:"concurrent_executions"`
+	Listeners            int64 `json:"listeners"`
+}
+
+// QuotaError reports a request refused by a quota.
+type QuotaError struct {
+	Quota      string `json:"quota"`
+	Limit      int64  `json:"limit"`
+	Used       int64  `json:"used"`
+	RetryAfter int64  `json:"retry_after,omitempty"` // seconds until an hourly slot frees up
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded: %s is limited to %d (used %d)", e.Quota, e.Limit, e.Used)
+}
+
+// quotaOverrides is the persisted form of the role and user limits.
+type quotaOverrides struct {
+	Roles map[string]QuotaLimits `json:"roles"`
+	Users map[string]QuotaLimits `json:"users"`
+}
+
+// QuotaManager holds the role and user limits and counts executions per
+// user. Counts are kept per replica.
+type QuotaManager struct {
+	file      string
+	mu        sync.Mutex
+	overrides quotaOverrides
+	started   map[string][]time.Time // execution starts within the last hour
+	running   map[string]int64
+}
+
+// NewQuotaManager loads the role and user limits from file; "" keeps them in
+// memory.
+func NewQuotaManager(file string) *QuotaManager {
+	q := &QuotaManager{
+		file:      file,
+		overrides: quotaOverrides{Roles: map[string]QuotaLimits{}, Users: map[string]QuotaLimits{}},
+		started:   map[string][]time.Time{},
+		running:   map[string]int64{},
+	}
+	if file == "" {
+		return q
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			cfg.ChariotLogger.Warn("Failed to read quota limits", zap.String("path", file), zap.Error(err))
+		}
+		return q
+	}
+	var o quotaOverrides
+	if err := json.Unmarshal(data, &o); err != nil {
+		cfg.ChariotLogger.Warn("Failed to parse quota limits", zap.String("path", file), zap.Error(err))
+		return q
+	}
+	if o.Roles != nil {
+		q.overrides.Roles = o.Roles
+	}
+	if o.Users != nil {
+		q.overrides.Users = o.Users
+	}
+	return q
+}
+
+func (q *QuotaManager) saveLocked() error {
+	if q.file == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(q.overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(filepath.Dir(q.file), 0o755)
+	return os.WriteFile(q.file, data, 0o644)
+}
+
+// defaultQuota returns the limits configured for every user.
+func defaultQuota() Quota {
+	return Quota{
+		FileBytes:            int64(cfg.ChariotConfig.QuotaFileBytes),
+		ExecutionsPerHour:    int64(cfg.ChariotConfig.QuotaExecutionsPerHour),
+		ConcurrentExecutions: int64(cfg.ChariotConfig.QuotaConcurrentExecutions),
+		Listeners:            int64(cfg.ChariotConfig.QuotaListeners),
+	}
+}
+
+// Limits returns the quota of user holding roles: the configured defaults,
+// overridden by the most generous of the roles' limits, overridden by the
+// user's own.
+func (q *QuotaManager) Limits(user string, roles []string) Quota {
+	quota := defaultQuota()
+	if q == nil {
+		return quota
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := quota.fields()
+	for i := range out {
+		set := false
+		for _, role := range roles {
+			v := q.overrides.Roles[role].fields()[i]
+			if v == nil {
+				continue
+			}
+			if !set || *v == 0 || (*out[i] != 0 && *v > *out[i]) {
+				*out[i] = *v
+			}
+			set = true
+		}
+		if v := q.overrides.Users[user].fields()[i]; v != nil {
+			*out[i] = *v
+		}
+	}
+	return quota
+}
+
+// pruneLocked drops the execution starts older than an hour.
+func (q *QuotaManager) pruneLocked(user string, now time.Time) []time.Time {
+	starts := q.started[user]
+	i := 0
+	for i < len(starts) && now.Sub(starts[i]) >= time.Hour {
+		i++
+	}
+	starts = starts[i:]
+	if len(starts) == 0 {
+		delete(q.started, user)
+	} else {
+		q.started[user] = starts
+	}
+	return starts
+}
+
+// BeginExecution counts an execution of user against quota. The returned
+// function ends it; it may be called more than once.
+func (q *QuotaManager) BeginExecution(user string, quota Quota) (func(), *QuotaError) {
+	if q == nil {
+		return func() {}, nil
+	}
+	now := time.Now()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if n := q.running[user]; quota.ConcurrentExecutions > 0 && n >= quota.ConcurrentExecutions {
+		return nil, &QuotaError{Quota: quotaConcurrentExecutions, Limit: quota.ConcurrentExecutions, Used: n}
+	}
+	starts := q.pruneLocked(user, now)
+	if n := int64(len(starts)); quota.ExecutionsPerHour > 0 && n >= quota.ExecutionsPerHour {
+		wait := time.Hour - now.Sub(starts[len(starts)-int(quota.ExecutionsPerHour)])
+		return nil, &QuotaError{Quota: quotaExecutionsPerHour, Limit: quota.ExecutionsPerHour, Used: n, RetryAfter: int64(wait/time.Second) + 1}
+	}
+	q.started[user] = append(starts, now)
+	q.running[user]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			if q.running[user]--; q.running[user] <= 0 {
+				delete(q.running, user)
+			}
+		})
+	}, nil
+}
+
+// ExecutionUsage returns how many executions user started in the last hour
+// and how many are running.
+func (q *QuotaManager) ExecutionUsage(user string) (lastHour, running int64) {
+	if q == nil {
+		return 0, 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(len(q.pruneLocked(user, time.Now()))), q.running[user]
+}
+
+// ResetExecutions forgets the executions user started in the last hour.
+func (q *QuotaManager) ResetExecutions(user string) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.started, user)
+}
+
+// SetRoleLimits replaces the limits of a role; nil removes them.
+func (q *QuotaManager) SetRoleLimits(role string, limits *QuotaLimits) error {
+	return q.setLimits(true, role, limits)
+}
+
+// SetUserLimits replaces the limits of a user; nil removes them.
+func (q *QuotaManager) SetUserLimits(user string, limits *QuotaLimits) error {
+	return q.setLimits(false, user, limits)
+}
+
+func (q *QuotaManager) setLimits(role bool, name string, limits *QuotaLimits) error {
+	if q == nil {
+		return fmt.Errorf("quotas are not available")
+	}
+	for _, v := range limitsFields(limits) {
+		if v != nil && *v < 0 {
+			return fmt.Errorf("limits cannot be negative")
+		}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	m := q.overrides.Users
+	if role {
+		m = q.overrides.Roles
+	}
+	old, had := m[name]
+	if limits == nil {
+		delete(m, name)
+	} else {
+		m[name] = *limits
+	}
+	if err := q.saveLocked(); err != nil {
+		if had {
+			m[name] = old
+		} else {
+			delete(m, name)
+		}
+		return err
+	}
+	return nil
+}
+
+func limitsFields(l *QuotaLimits) []*int64 {
+	if l == nil {
+		return nil
+	}
+	return l.fields()
+}
+
+// Overrides returns copies of the role and user limits.
+func (q *QuotaManager) Overrides() (roles, users map[string]QuotaLimits) {
+	if q == nil {
+		return map[string]QuotaLimits{}, map[string]QuotaLimits{}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	roles, users = map[string]QuotaLimits{}, map[string]QuotaLimits{}
+	for k, v := range q.overrides.Roles {
+		roles[k] = v
+	}
+	for k, v := range q.overrides.Users {
+		users[k] = v
+	}
+	return roles, users
+}
+
+// trackedUsers returns the users with limits or executions on this replica.
+func (q *QuotaManager) trackedUsers() []string {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var out []string
+	for u := range q.overrides.Users {
+		out = append(out, u)
+	}
+	for u := range q.started {
+		out = append(out, u)
+	}
+	for u := range q.running {
+		out = append(out, u)
+	}
+	return out
+}
+
+// sandboxBytes returns the size of the files in user's sandbox, or 0 when
+// sandboxes are disabled.
+func sandboxBytes(user string) int64 {
+	if !cfg.ChariotConfig.SandboxEnabled {
+		return 0
+	}
+	base, err := cfg.EnsureStorageBase(cfg.StorageKindData, cfg.StorageScopeSandbox, user)
+	if err != nil {
+		return 0
+	}
+	var total int64
+	_ = filepath.WalkDir(base, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	// Files kept by a shared provider are not on this disk
+	if files := storage.Default(); files.Shared() {
+		infos, _ := files.ReadDir(filepath.Join(base, "files"))
+		for _, info := range infos {
+			total += info.Size
+		}
+	}
+	return total
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+const (
+	// resourceSampleInterval matches the dashboard stream's refresh.
+	resourceSampleInterval = 5 * time.Second
+	// resourceHistorySize keeps ten minutes of samples for the sparklines.
+	resourceHistorySize = 120
+)
+
+// WebSocket stream kinds counted on the dashboard.
+const (
+	wsDashboard = "dashboard"
+	wsAgents    = "agents"
+	wsREPL      = "repl"
+	wsDebug     = "debug"
+)
+
+// wsClients counts the open WebSocket streams of this process by kind.
+var wsClients = &wsCounter{counts: map[string]int{}}
+
+type wsCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// open counts a stream of kind until the returned function is called.
+func (w *wsCounter) open(kind string) func() {
+	w.mu.Lock()
+	w.counts[kind]++
+	w.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			w.mu.Lock()
+			w.counts[kind]--
+			w.mu.Unlock()
+		})
+	}
+}
+
+func (w *wsCounter) snapshot() (map[string]int, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	counts := map[string]int{wsDashboard: 0, wsAgents: 0, wsREPL: 0, wsDebug: 0}
+	total := 0
+	for k, n := range w.counts {
+		counts[k] = n
+		total += n
+	}
+	return counts, total
+}
+
+// GCStats summarizes garbage collection.
+type GCStats struct {
+	NumGC        uint32  `json:"num_gc"`
+	LastPauseMs  float64 `json:"last_pause_ms"`
+	MaxPauseMs   float64 `json:"max_pause_ms"` // Longest of the last 256 pauses
+	TotalPauseMs float64 `json:"total_pause_ms"`
+	CPUFraction  float64 `json:"cpu_fraction"` // Share of CPU time spent in GC since start
+}
+
+// ResourceSample is one point of the resource history.
+type ResourceSample struct {
+	At          time.Time `json:"at"`
+	HeapAlloc   uint64    `json:"heap_alloc"`
+	HeapInuse   uint64    `json:"heap_inuse"`
+	Goroutines  int       `json:"goroutines"`
+	GCPauseMs   float64   `json:"gc_pause_ms"` // GC pause time since the previous sample
+	SQLOpen     int       `json:"sql_open"`
+	Couchbase   int       `json:"couchbase"`
+	WSClients   int       `json:"ws_clients"`
+	totalPauses uint64
+}
+
+// resourceHistory samples the process periodically for the sparklines.
+type resourceHistory struct {
+	mu      sync.RWMutex
+	samples []ResourceSample // Oldest first, at most resourceHistorySize
+}
+
+func newResourceHistory() *resourceHistory {
+	r := &resourceHistory{}
+	r.sample()
+	go func() {
+		ticker := time.NewTicker(resourceSampleInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			r.sample()
+		}
+	}()
+	return r
+}
+
+func (r *resourceHistory) sample() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	conns := chariot.OpenConnections()
+	_, ws := wsClients.snapshot()
+	s := ResourceSample{
+		At:          time.Now(),
+		HeapAlloc:   ms.HeapAlloc,
+		HeapInuse:   ms.HeapInuse,
+		Goroutines:  runtime.NumGoroutine(),
+		SQLOpen:     conns.SQLOpen,
+		Couchbase:   conns.Couchbase,
+		WSClients:   ws,
+		totalPauses: ms.PauseTotalNs,
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n := len(r.samples); n > 0 {
+		s.GCPauseMs = nsToMs(ms.PauseTotalNs - r.samples[n-1].totalPauses)
+	}
+	r.samples = append(r.samples, s)
+	if len(r.samples) > resourceHistorySize {
+		r.samples = append(r.samples[:0], r.samples[len(r.samples)-resourceHistorySize:]...)
+	}
+}
+
+// snapshot returns the samples, oldest first; a nil history has none.
+func (r *resourceHistory) snapshot() []ResourceSample {
+	if r == nil {
+		return []ResourceSample{}
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]ResourceSample(nil), r.samples...)
+}
+
+func gcStats(ms *runtime.MemStats) GCStats {
+	st := GCStats{
+		NumGC:        ms.NumGC,
+		TotalPauseMs: nsToMs(ms.PauseTotalNs),
+		CPUFraction:  ms.GCCPUFraction,
+	}
+	if ms.NumGC > 0 {
+		st.LastPauseMs = nsToMs(ms.PauseNs[(ms.NumGC+255)%256])
+	}
+	pauses := ms.PauseNs[:]
+	if ms.NumGC < 256 {
+		pauses = pauses[:ms.NumGC]
+	}
+	for _, p := range pauses {
+		if pause := nsToMs(p); pause > st.MaxPauseMs {
+			st.MaxPauseMs = pause
+		}
+	}
+	return st
+}
+
+func nsToMs(ns uint64) float64 {
+	return float64(ns) / float64(time.Millisecond)
+}
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// symbolQueueSize bounds the files waiting to be indexed; a file that
+	// does not fit is parsed when it is next asked for instead.
+	symbolQueueSize = 64
+	// symbolScanInterval is how often the directories queried so far and the
+	// library are checked for changes made outside the API.
+	symbolScanInterval = 30 * time.Second
+)
+
+// SymbolIndex keeps the symbols of the workspace .ch files and of the
+// function library, so a query does not parse every source. A source is
+// parsed again when its modification time changes; files saved through the
+// API are queued and parsed in the background before they are asked for,
+// and the directories queried so far are rescanned periodically. References,
+// renames, the symbol search and completion all read it. A nil index parses
+// on every query.
+type SymbolIndex struct {
+	mu          sync.Mutex
+	files       map[string]*indexedSource // By absolute path
+	library     map[string]*indexedSource // By function name
+	libraryPath string
+	libraryTime time.Time
+	dirs        map[string]bool // Directories rescanned in the background
+	parsed      int64           // Sources parsed since start
+	lastScan    time.Time
+	scanTime    time.Duration
+	queue       chan string
+}
+
+type indexedSource struct {
+	modTime time.Time
+	refs    []chariot.SymbolRef
+	err     error
+}
+
+// SymbolReference is an occurrence of a symbol in a workspace file or, with
+// Library set, in a library function, File then naming the function and the
+// line counting from its source.
+type SymbolReference struct {
+	chariot.SymbolRef
+	Library bool `json:"library,omitempty"`
+}
+
+// IndexedSymbol is an entry of the symbol table: a name, where it is
+// defined and how often it is used.
+type IndexedSymbol struct {
+	Name        string            `json:"name"`
+	Kind        string            `json:"kind"` // function when it is defined or called as one, else variable
+	Definitions []SymbolReference `json:"definitions"`
+	References  int               `json:"references"` // Occurrences besides the definitions
+}
+
+// SymbolIndexStatus describes what the index holds.
+type SymbolIndexStatus struct {
+	Directories int       `json:"directories"`
+	Files       int       `json:"files"`
+	Functions   int       `json:"functions"` // Library functions
+	Unparsable  int       `json:"unparsable"`
+	Symbols     int       `json:"symbols"` // Distinct names
+	Pending     int       `json:"pending"` // Files queued to be parsed
+	Parsed      int64     `json:"parsed"`  // Sources parsed since start
+	LastScan    time.Time `json:"last_scan,omitempty"`
+	ScanMs      float64   `json:"scan_ms"`
+}
+
+// SkippedSource is a workspace file or library function that could not be
+// looked into because it does not parse.
+type SkippedSource struct {
+	File     string `json:"file,omitempty"`
+	Function string `json:"function,omitempty"`
+	Error    string `json:"error"`
+}
+
+// NewSymbolIndex creates an empty index and starts its background parser.
+func NewSymbolIndex() *SymbolIndex {
+	x := &SymbolIndex{
+		files:   map[string]*indexedSource{},
+		library: map[string]*indexedSource{},
+		dirs:    map[string]bool{},
+		queue:   make(chan string, symbolQueueSize),
+	}
+	go x.run()
+	return x
+}
+
+func (x *SymbolIndex) run() {
+	ticker := time.NewTicker(symbolScanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case path := <-x.queue:
+			x.file(path)
+		case <-ticker.C:
+			x.scan()
+		}
+	}
+}
+
+// scan brings the directories queried so far and the library up to date.
+func (x *SymbolIndex) scan() {
+	start := time.Now()
+	x.mu.Lock()
+	dirs := make([]string, 0, len(x.dirs))
+	for dir := range x.dirs {
+		dirs = append(dirs, dir)
+	}
+	x.mu.Unlock()
+	for _, dir := range dirs {
+		if _, err := x.each(dir, nil); err != nil {
+			cfg.ChariotLogger.Warn("Symbol index scan failed", zap.String("dir", dir), zap.Error(err))
+		}
+	}
+	x.mu.Lock()
+	x.lastScan, x.scanTime = time.Now(), time.Since(start)
+	x.mu.Unlock()
+}
+
+// Changed drops what is known of the file at path, written or deleted, and
+// queues it to be parsed again.
+func (x *SymbolIndex) Changed(path string) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	delete(x.files, path)
+	x.dirs[filepath.Dir(path)] = true
+	x.mu.Unlock()
+	select {
+	case x.queue <- path:
+	default:
+	}
+}
+
+// file returns the symbols of the file at path, parsing it when it changed
+// since it was indexed, or nil when there is no such file.
+func (x *SymbolIndex) file(path string) *indexedSource {
+	info, err := storage.Default().Stat(path)
+	if err != nil {
+		if x != nil {
+			x.mu.Lock()
+			delete(x.files, path)
+			x.mu.Unlock()
+		}
+		return nil
+	}
+	if x != nil {
+		x.mu.Lock()
+		cached := x.files[path]
+		x.mu.Unlock()
+		if cached != nil && cached.modTime.Equal(info.Modified) {
+			return cached
+		}
+	}
+	src := &indexedSource{modTime: info.Modified}
+	content, err := storage.Default().ReadFile(path)
+	if err == nil {
+		src.refs, err = chariot.FindSymbols(string(content), filepath.Base(path), nil)
+	}
+	src.err = err
+	if x != nil {
+		x.mu.Lock()
+		x.files[path] = src
+		x.parsed++
+		x.mu.Unlock()
+	}
+	return src
+}
+
+// mentions reports whether any of names occurs in the source.
+func (src *indexedSource) mentions(names ...string) bool {
+	for _, r := range src.refs {
+		for _, name := range names {
+			if r.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// libraryFunctions returns the symbols of each library function, parsing the
+// library again when its file changed.
+func (x *SymbolIndex) libraryFunctions() (map[string]*indexedSource, error) {
+	if cfg.ChariotConfig.FunctionLib == "" {
+		return nil, nil
+	}
+	path := filepath.Join(cfg.ChariotConfig.TreePath, cfg.ChariotConfig.FunctionLib)
+	info, err := storage.Default().Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if x != nil {
+		x.mu.Lock()
+		current, library := x.libraryPath == path && x.libraryTime.Equal(info.Modified), x.library
+		x.mu.Unlock()
+		if current {
+			return library, nil
+		}
+	}
+	functions, err := chariot.LoadFunctionsFromFile(cfg.ChariotConfig.FunctionLib)
+	if err != nil {
+		return nil, err
+	}
+	library := make(map[string]*indexedSource, len(functions))
+	for name, fn := range functions {
+		refs, err := chariot.FindSymbols(chariot.FunctionSource(name, fn), name, nil)
+		library[name] = &indexedSource{modTime: info.Modified, refs: refs, err: err}
+	}
+	if x != nil {
+		x.mu.Lock()
+		x.library, x.libraryPath, x.libraryTime = library, path, info.Modified
+		x.parsed += int64(len(library))
+		x.mu.Unlock()
+	}
+	return library, nil
+}
+
+// each brings the .ch files of dir and the library up to date in the index
+// and calls visit, when not nil, with every occurrence they hold: the files'
+// by file and position, then the library functions', by function. It returns
+// the sources that do not parse.
+func (x *SymbolIndex) each(dir string, visit func(SymbolReference)) ([]SkippedSource, error) {
+	skipped := []SkippedSource{}
+	entries, err := storage.Default().ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	present := map[string]bool{}
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name) != ".ch" {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name)
+		present[path] = true
+		src := x.file(path)
+		if src == nil {
+			continue
+		}
+		if src.err != nil {
+			skipped = append(skipped, SkippedSource{File: entry.Name, Error: chariot.DescribeError(src.err).Message})
+			continue
+		}
+		if visit != nil {
+			for _, r := range src.refs {
+				visit(SymbolReference{SymbolRef: r})
+			}
+		}
+	}
+	if x != nil {
+		// Forget files deleted outside the API
+		x.mu.Lock()
+		x.dirs[dir] = true
+		for path := range x.files {
+			if filepath.Dir(path) == dir && !present[path] {
+				delete(x.files, path)
+			}
+		}
+		x.mu.Unlock()
+	}
+
+	library, err := x.libraryFunctions()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(library))
+	for fn := range library {
+		names = append(names, fn)
+	}
+	sort.Strings(names)
+	for _, fn := range names {
+		src := library[fn]
+		if src.err != nil {
+			skipped = append(skipped, SkippedSource{Function: fn, Error: chariot.DescribeError(src.err).Message})
+			continue
+		}
+		if visit != nil {
+			for _, r := range src.refs {
+				visit(SymbolReference{SymbolRef: r, Library: true})
+			}
+		}
+	}
+	return skipped, nil
+}
+
+// References returns the occurrences of name in the .ch files of dir, by
+// file and position, then in the library functions, by function, with the
+// sources that do not parse.
+func (x *SymbolIndex) References(dir, name string) ([]SymbolReference, []SkippedSource, error) {
+	refs := []SymbolReference{}
+	skipped, err := x.each(dir, func(r SymbolReference) {
+		if r.Name == name {
+			refs = append(refs, r)
+		}
+	})
+	return refs, skipped, err
+}
+
+// Symbols returns the symbol table of the .ch files of dir and the library,
+// sorted by name: the names containing query, ignoring case, of the kind
+// given ("" for both).
+func (x *SymbolIndex) Symbols(dir, query, kind string) ([]IndexedSymbol, error) {
+	query = strings.ToLower(query)
+	byName := map[string]*IndexedSymbol{}
+	_, err := x.each(dir, func(r SymbolReference) {
+		if !strings.Contains(strings.ToLower(r.Name), query) {
+			return
+		}
+		sym := byName[r.Name]
+		if sym == nil {
+			sym = &IndexedSymbol{Name: r.Name, Kind: "variable", Definitions: []SymbolReference{}}
+			byName[r.Name] = sym
+		}
+		if r.Kind == "function" {
+			sym.Kind = "function"
+		}
+		if r.Role == "definition" {
+			sym.Definitions = append(sym.Definitions, r)
+		} else {
+			sym.References++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]IndexedSymbol, 0, len(byName))
+	for _, sym := range byName {
+		if kind == "" || sym.Kind == kind {
+			out = append(out, *sym)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Status describes the index.
+func (x *SymbolIndex) Status() SymbolIndexStatus {
+	if x == nil {
+		return SymbolIndexStatus{}
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	st := SymbolIndexStatus{
+		Directories: len(x.dirs),
+		Files:       len(x.files),
+		Functions:   len(x.library),
+		Pending:     len(x.queue),
+		Parsed:      x.parsed,
+		LastScan:    x.lastScan,
+		ScanMs:      float64(x.scanTime.Microseconds()) / 1000,
+	}
+	names := map[string]bool{}
+	for _, sources := range []map[string]*indexedSource{x.files, x.library} {
+		for _, src := range sources {
+			if src.err != nil {
+				st.Unparsable++
+			}
+			for _, r := range src.refs {
+				names[r.Name] = true
+			}
+		}
+	}
+	st.Symbols = len(names)
+	return st
+}
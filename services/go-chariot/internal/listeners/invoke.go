@@ -0,0 +1,227 @@
+package listeners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"go.uber.org/zap"
+)
+
+// An invocation is a run of a listener's script for one event: a file
+// dropped into a watch listener's folder, or a payload posted to a running
+// service listener. At most max_concurrent invocations of a listener run at
+// once. The first runs on the listener's runtime; the others on runtimes
+// created like it, with its imports and env, but without what on_start set
+// up. When all are busy an invocation waits in a queue of at most
+// max_queued, unless when_busy is "drop" or the queue is full, and it is
+// then dropped with ErrBusy. An invocation running past timeout is
+// interrupted before its next statement.
+
+// What an invocation does when the listener is busy
+const (
+	WhenBusyQueue = "queue"
+	WhenBusyDrop  = "drop"
+)
+
+const defaultMaxQueued = 100
+
+// ErrBusy is returned for an invocation dropped because the listener was
+// busy, and ErrNotRunning for one of a stopped listener.
+var (
+	ErrBusy       = errors.New("listener is busy")
+	ErrNotRunning = errors.New("listener is not running")
+)
+
+// ValidateConcurrency checks a concurrency configuration and fills in its
+// defaults.
+func ValidateConcurrency(c *ConcurrencyConfig) error {
+	if c.MaxConcurrent < 0 || c.MaxQueued < 0 || c.Timeout < 0 {
+		return errors.New("concurrency.max_concurrent, max_queued and timeout must not be negative")
+	}
+	if c.MaxConcurrent == 0 {
+		c.MaxConcurrent = 1
+	}
+	switch c.WhenBusy {
+	case "":
+		c.WhenBusy = WhenBusyQueue
+	case WhenBusyQueue, WhenBusyDrop:
+	default:
+		return fmt.Errorf("concurrency.when_busy must be queue or drop, got %q", c.WhenBusy)
+	}
+	if c.MaxQueued == 0 {
+		c.MaxQueued = defaultMaxQueued
+	}
+	return nil
+}
+
+// invoker admits the invocations of a running listener.
+type invoker struct {
+	conf  ConcurrencyConfig
+	slots chan *listenerRuntime // runtimes free to run an invocation
+	extra []*listenerRuntime    // runtimes beyond the listener's own
+	stats struct {
+		inFlight, queued, completed, failed, timedOut, dropped atomic.Int64
+	}
+}
+
+// newInvoker creates the invoker of l, whose runtime is lr.
+func (m *Manager) newInvoker(l *Listener, lr *listenerRuntime) (*invoker, error) {
+	conf := ConcurrencyConfig{}
+	if l.Concurrency != nil {
+		conf = *l.Concurrency
+	}
+	if err := ValidateConcurrency(&conf); err != nil {
+		return nil, err
+	}
+	inv := &invoker{conf: conf, slots: make(chan *listenerRuntime, conf.MaxConcurrent)}
+	inv.slots <- lr
+	for i := 1; i < conf.MaxConcurrent; i++ {
+		extra, err := m.newRuntime(l)
+		if err != nil {
+			return nil, err
+		}
+		inv.extra = append(inv.extra, extra)
+		inv.slots <- extra
+	}
+	return inv, nil
+}
+
+// invoke calls run with a free runtime, waiting for one while ctx lasts or
+// dropping the invocation as the invocation rules say. run holds the
+// runtime, and is interrupted once the timeout passes.
+func (inv *invoker) invoke(ctx context.Context, run func(lr *listenerRuntime) error) error {
+	var lr *listenerRuntime
+	select {
+	case lr = <-inv.slots:
+	default:
+		if inv.conf.WhenBusy == WhenBusyDrop {
+			inv.stats.dropped.Add(1)
+			return ErrBusy
+		}
+		if inv.stats.queued.Add(1) > int64(inv.conf.MaxQueued) {
+			inv.stats.queued.Add(-1)
+			inv.stats.dropped.Add(1)
+			return fmt.Errorf("%w: %d invocations queued", ErrBusy, inv.conf.MaxQueued)
+		}
+		select {
+		case lr = <-inv.slots:
+			inv.stats.queued.Add(-1)
+		case <-ctx.Done():
+			inv.stats.queued.Add(-1)
+			return ctx.Err()
+		}
+	}
+	inv.stats.inFlight.Add(1)
+	defer func() {
+		inv.stats.inFlight.Add(-1)
+		inv.slots <- lr
+	}()
+
+	lr.acquire()
+	defer lr.release()
+	// Only the timeout stops a running invocation, not a stop or a client
+	// going away
+	runCtx := context.Background()
+	if inv.conf.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, time.Duration(inv.conf.Timeout)*time.Second)
+		defer cancel()
+	}
+	err := lr.rt.RunContext(runCtx, func() error { return run(lr) })
+	switch {
+	case err == nil:
+		inv.stats.completed.Add(1)
+	case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+		// Given up while waiting for a worker; not run
+	case timedOut(runCtx):
+		inv.stats.timedOut.Add(1)
+		inv.stats.failed.Add(1)
+		err = fmt.Errorf("timed out after %ds: %w", inv.conf.Timeout, err)
+	default:
+		inv.stats.failed.Add(1)
+	}
+	return err
+}
+
+// snapshot returns the invoker's counts.
+func (inv *invoker) snapshot() *InvocationStats {
+	return &InvocationStats{
+		InFlight:  inv.stats.inFlight.Load(),
+		Queued:    inv.stats.queued.Load(),
+		Completed: inv.stats.completed.Load(),
+		Failed:    inv.stats.failed.Load(),
+		TimedOut:  inv.stats.timedOut.Load(),
+		Dropped:   inv.stats.dropped.Load(),
+	}
+}
+
+// Invoke runs the script of a running service listener for one event. A
+// function script is called with payload; program text sees it as event.
+// It fails with ErrNotFound, ErrNotRunning, ErrBusy or the script's error.
+func (m *Manager) Invoke(ctx context.Context, name string, payload ch.Value) error {
+	m.mu.RLock()
+	l, ok := m.listeners[name]
+	var def Listener
+	if ok {
+		def = *l
+	}
+	inv := m.invokers[name]
+	m.mu.RUnlock()
+	switch {
+	case !ok:
+		return fmt.Errorf("%w: '%s'", ErrNotFound, name)
+	case def.Type == TypeWatch:
+		return fmt.Errorf("listener '%s': watch listeners are invoked by the files dropped into their folder", name)
+	case def.Script == "":
+		return fmt.Errorf("listener '%s' has no script to invoke", name)
+	case inv == nil:
+		return fmt.Errorf("%w: '%s'", ErrNotRunning, name)
+	}
+	args := []ch.Value{payload}
+	vars := map[string]ch.Value{"event": payload}
+	err := inv.invoke(ctx, func(lr *listenerRuntime) error {
+		return m.recordRun(lr, name, def.Record, def.Tags, def.Script, args, vars, func() error {
+			return lr.rt.RunProgramWith(def.Script, args, vars)
+		})
+	})
+	if !errors.Is(err, ErrBusy) && ctx.Err() == nil {
+		m.invocationResult(name, inv, err)
+	}
+	return err
+}
+
+// invocationResult records the outcome of an invocation, or of a watch
+// listener's scan. Health follows the latest outcome; OnUnhealthy is called
+// when a healthy listener starts failing.
+func (m *Manager) invocationResult(name string, inv *invoker, err error) {
+	if err != nil {
+		cfg.ChariotLogger.Error("Listener invocation failed", zap.String("listener", name), zap.Error(err))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.listeners[name]
+	if !ok || m.invokers[name] != inv {
+		return // stopped meanwhile
+	}
+	wasHealthy := l.IsHealthy
+	l.LastActive = time.Now()
+	l.IsHealthy = err == nil
+	if wasHealthy != l.IsHealthy {
+		_ = m.saveLocked()
+	}
+	if wasHealthy && err != nil && m.onUnhealthy != nil {
+		m.onUnhealthy(*l, err)
+	}
+}
+
+// timedOut reports whether ctx's deadline has passed, even if the runtime,
+// which checks the deadline itself, noticed before ctx did.
+func timedOut(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	return ctx.Err() != nil || (ok && !time.Now().Before(deadline))
+}
@@ -1,6 +1,7 @@
 package listeners
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -10,17 +11,34 @@ import (
 
 	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
 	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"go.uber.org/zap"
 )
 
 // Manager manages a registry of listeners and persists them to a file
-// Scripts are executed using a provided chariot.Runtime
+// Scripts are executed on runtimes created from a provided chariot.Runtime,
+// one per listener
 
 type Manager struct {
 	mu        sync.RWMutex
 	listeners map[string]*Listener
 	filePath  string
-	// A shared runtime to execute onStart/onExit programs; optional, can defer to sessions
+	// The runtime the listeners' runtimes are created from; optional, without
+	// it no scripts run
 	runtime *ch.Runtime
+	// Dedicated runtimes of the listeners that have started; see runtime.go
+	runtimes map[string]*listenerRuntime
+	// Called when a listener becomes unhealthy; see OnUnhealthy
+	onUnhealthy func(l Listener, err error)
+	// Called after each run of a listener script; see OnRun
+	onRun func(listener string, tags map[string]string, started time.Time, usage *ch.ExecutionUsage, err error)
+	// Waits for a worker before a watch script runs; see SetAdmission
+	admit func(ctx context.Context) (release func(), err error)
+	// Checks the code of a diagram listener before it starts; see SetPreflight
+	preflight func(l Listener) error
+	// Pollers of the running watch listeners
+	watchers map[string]*watcher
+	// Admit the invocations of the running listeners; see invoke.go
+	invokers map[string]*invoker
 }
 
 func NewManager(runtime *ch.Runtime) *Manager {
@@ -34,7 +52,53 @@ func NewManager(runtime *ch.Runtime) *Manager {
 		base = "./data"
 	}
 	full := filepath.Join(base, file)
-	return &Manager{listeners: map[string]*Listener{}, filePath: full, runtime: runtime}
+	return &Manager{listeners: map[string]*Listener{}, filePath: full, runtime: runtime, runtimes: map[string]*listenerRuntime{}, watchers: map[string]*watcher{}, invokers: map[string]*invoker{}}
+}
+
+// OnUnhealthy sets a function called, with the listener as it was stored,
+// whenever a listener's on_start script fails or a watch listener's script
+// starts failing.
+func (m *Manager) OnUnhealthy(fn func(l Listener, err error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onUnhealthy = fn
+}
+
+// OnRun sets a function called after each run of an on_start or watch
+// script, with the listener's tags and the external calls and rows the run
+// made. Set it before any listener starts.
+func (m *Manager) OnRun(fn func(listener string, tags map[string]string, started time.Time, usage *ch.ExecutionUsage, err error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onRun = fn
+}
+
+// SetAdmission sets a function each watch script run waits on for a worker
+// of the execution queue; it returns the function releasing the worker.
+func (m *Manager) SetAdmission(fn func(ctx context.Context) (release func(), err error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.admit = fn
+}
+
+// SetPreflight sets a function called before a listener bound to a diagram
+// starts; an error refuses the start. It checks the diagram's code against
+// limits that may have changed since the listener was created.
+func (m *Manager) SetPreflight(fn func(l Listener) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.preflight = fn
+}
+
+// admission waits for a worker to run a watch script, or until ctx is done.
+func (m *Manager) admission(ctx context.Context) (release func(), err error) {
+	m.mu.RLock()
+	admit := m.admit
+	m.mu.RUnlock()
+	if admit == nil {
+		return func() {}, nil
+	}
+	return admit(ctx)
 }
 
 func (m *Manager) Load() error {
@@ -83,20 +147,29 @@ func (m *Manager) List() []Listener {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	res := make([]Listener, 0, len(m.listeners))
-	for _, l := range m.listeners {
-		res = append(res, *l)
+	for name, l := range m.listeners {
+		copied := *l
+		if inv := m.invokers[name]; inv != nil {
+			copied.Invocations = inv.snapshot()
+		}
+		res = append(res, copied)
 	}
 	return res
 }
 
-func (m *Manager) Create(name, script, onStart, onExit string, autoStart bool) (*Listener, error) {
+// Create registers a new listener from its definition; the listener starts
+// out stopped.
+func (m *Manager) Create(def Listener) (*Listener, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if _, exists := m.listeners[name]; exists {
-		return nil, fmt.Errorf("listener '%s' already exists", name)
+	if _, exists := m.listeners[def.Name]; exists {
+		return nil, fmt.Errorf("listener '%s' already exists", def.Name)
 	}
-	l := &Listener{Name: name, Script: script, OnStart: onStart, OnExit: onExit, Status: "stopped", IsHealthy: false, AutoStart: autoStart}
-	m.listeners[name] = l
+	if err := validate(&def); err != nil {
+		return nil, err
+	}
+	l := &Listener{Name: def.Name, Script: def.Script, OnStart: def.OnStart, OnExit: def.OnExit, Snapshot: def.Snapshot, Status: "stopped", IsHealthy: false, AutoStart: def.AutoStart, Type: def.Type, Watch: def.Watch, Owner: def.Owner, Record: def.Record, Tags: def.Tags, Diagram: def.Diagram, Imports: def.Imports, Env: def.Env, Concurrency: def.Concurrency}
+	m.listeners[def.Name] = l
 	if err := m.saveLocked(); err != nil {
 		return nil, err
 	}
@@ -111,6 +184,7 @@ func (m *Manager) Delete(name string) error {
 			return fmt.Errorf("listener '%s' is running; stop it first", name)
 		}
 		delete(m.listeners, name)
+		delete(m.runtimes, name)
 		return m.saveLocked()
 	}
 	return fmt.Errorf("listener '%s' not found", name)
@@ -126,16 +200,71 @@ func (m *Manager) Start(name string, port int) (*Listener, error) {
 	if l.Status == "running" {
 		return l, nil
 	}
-	if l.OnStart != "" && m.runtime != nil {
-		_ = m.runtime.RunProgram(l.OnStart, port)
+	if l.Diagram != "" && m.preflight != nil {
+		if err := m.preflight(*l); err != nil {
+			return nil, fmt.Errorf("listener '%s': %w", name, err)
+		}
+	}
+	var lr *listenerRuntime
+	if m.runtime != nil {
+		var err error
+		if lr, err = m.runtimeLocked(l); err != nil {
+			return nil, fmt.Errorf("listener '%s': %w", name, err)
+		}
+	}
+	var inv *invoker
+	if lr != nil {
+		var err error
+		if inv, err = m.newInvoker(l, lr); err != nil {
+			return nil, fmt.Errorf("listener '%s': %w", name, err)
+		}
+	}
+	var w *watcher
+	if l.Type == TypeWatch {
+		if inv == nil {
+			return nil, fmt.Errorf("listener '%s': watch listeners need a runtime", name)
+		}
+		var err error
+		if w, err = newWatcher(m, l, inv); err != nil {
+			return nil, fmt.Errorf("listener '%s': %w", name, err)
+		}
+	}
+	var startErr error
+	if lr != nil {
+		lr.acquire()
+		// Warm-start from a snapshot so on_start sees the saved state
+		if l.Snapshot != "" {
+			if _, err := lr.rt.RestoreSnapshotFrom(l.Snapshot); err != nil {
+				lr.release()
+				return nil, fmt.Errorf("listener '%s': restore snapshot: %w", name, err)
+			}
+		}
+		if l.OnStart != "" {
+			startErr = m.recordRun(lr, l.Name, l.Record, l.Tags, l.OnStart, []ch.Value{ch.Number(port)}, nil, func() error {
+				return lr.rt.RunProgram(l.OnStart, port)
+			})
+		}
+		lr.release()
+	}
+	if inv != nil {
+		m.invokers[name] = inv
+	}
+	if w != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		w.cancel = cancel
+		m.watchers[name] = w
+		go w.run(ctx)
 	}
 	l.Status = "running"
 	l.StartTime = time.Now()
 	l.LastActive = time.Now()
-	l.IsHealthy = true
+	l.IsHealthy = startErr == nil
 	if err := m.saveLocked(); err != nil {
 		return nil, err
 	}
+	if startErr != nil && m.onUnhealthy != nil {
+		m.onUnhealthy(*l, startErr)
+	}
 	return l, nil
 }
 
@@ -149,8 +278,15 @@ func (m *Manager) Stop(name string, port int) (*Listener, error) {
 	if l.Status != "running" {
 		return l, nil
 	}
-	if l.OnExit != "" && m.runtime != nil {
-		_ = m.runtime.RunProgram(l.OnExit, port)
+	if w, ok := m.watchers[name]; ok {
+		w.cancel()
+		delete(m.watchers, name)
+	}
+	delete(m.invokers, name)
+	if lr := m.runtimes[name]; l.OnExit != "" && lr != nil {
+		lr.acquire()
+		_ = lr.rt.RunProgram(l.OnExit, port)
+		lr.release()
 	}
 	l.Status = "stopped"
 	l.IsHealthy = false
@@ -159,3 +295,132 @@ func (m *Manager) Stop(name string, port int) (*Listener, error) {
 	}
 	return l, nil
 }
+
+// Put stores a listener definition, replacing any existing listener of the
+// same name unless it is running. The stored listener starts out stopped.
+func (m *Manager) Put(l Listener) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.listeners[l.Name]; ok && existing.Status == "running" {
+		return fmt.Errorf("listener '%s' is running; stop it first", l.Name)
+	}
+	if err := validate(&l); err != nil {
+		return err
+	}
+	l.Status = "stopped"
+	l.IsHealthy = false
+	l.StartTime = time.Time{}
+	l.LastActive = time.Time{}
+	m.listeners[l.Name] = &l
+	// The next start creates a runtime for the new definition
+	delete(m.runtimes, l.Name)
+	return m.saveLocked()
+}
+
+// validate checks the snapshot, tags and type of a listener definition.
+func validate(l *Listener) error {
+	if l.Snapshot != "" {
+		if err := ch.ValidateSnapshotName(l.Snapshot); err != nil {
+			return err
+		}
+	}
+	if err := ch.ValidateTags(l.Tags); err != nil {
+		return fmt.Errorf("listener '%s': %w", l.Name, err)
+	}
+	if err := validateRuntime(l); err != nil {
+		return fmt.Errorf("listener '%s': %w", l.Name, err)
+	}
+	if l.Concurrency != nil {
+		if err := ValidateConcurrency(l.Concurrency); err != nil {
+			return fmt.Errorf("listener '%s': %w", l.Name, err)
+		}
+	}
+	l.Invocations = nil
+	switch l.Record {
+	case RecordNone, RecordFailures, RecordAll:
+	default:
+		return fmt.Errorf("listener '%s': record must be %q or %q", l.Name, RecordFailures, RecordAll)
+	}
+	switch l.Type {
+	case TypeService:
+		if l.Watch != nil {
+			return fmt.Errorf("listener '%s': watch is only valid for watch listeners", l.Name)
+		}
+	case TypeWatch:
+		if l.Script == "" {
+			return fmt.Errorf("listener '%s': watch listeners require a script", l.Name)
+		}
+		if err := ValidateWatch(l.Watch); err != nil {
+			return fmt.Errorf("listener '%s': %w", l.Name, err)
+		}
+	default:
+		return fmt.Errorf("listener '%s': unknown type %q", l.Name, l.Type)
+	}
+	return nil
+}
+
+// runWatchScript runs a watch listener's script for one file: a function
+// is called with the file's path (relative to the data path) and a map
+// describing it; program text sees them as file and fileInfo.
+//
+// The run is an invocation of the listener, and waits for a worker of the
+// execution queue once it has a runtime.
+func (m *Manager) runWatchScript(ctx context.Context, w *watcher, file string, info *ch.MapValue) error {
+	args := []ch.Value{ch.Str(file), info}
+	vars := map[string]ch.Value{"file": ch.Str(file), "fileInfo": info}
+	return w.invoker.invoke(ctx, func(lr *listenerRuntime) error {
+		release, err := m.admission(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return m.recordRun(lr, w.name, w.record, w.tags, w.script, args, vars, func() error {
+			return lr.rt.RunProgramWith(w.script, args, vars)
+		})
+	})
+}
+
+// recordRun calls run, which runs program on the listener's runtime lr while
+// it holds lr, counting its external calls for the OnRun function. With
+// record set, the run's trace is saved to the shared trace directory when it
+// fails, or always for RecordAll.
+func (m *Manager) recordRun(lr *listenerRuntime, listener, record string, tags map[string]string, program string, args []ch.Value, vars map[string]ch.Value, run func() error) error {
+	started := time.Now()
+	lr.ran(started)
+	lr.rt.StartUsage()
+	err := m.traceRun(lr.rt, listener, record, program, args, vars, run)
+	usage := lr.rt.StopUsage()
+	if m.onRun != nil {
+		m.onRun(listener, tags, started, usage, err)
+	}
+	return err
+}
+
+// traceRun calls run, recording its trace on rt as recordRun describes.
+func (m *Manager) traceRun(rt *ch.Runtime, listener, record, program string, args []ch.Value, vars map[string]ch.Value, run func() error) error {
+	if record == RecordNone {
+		return run()
+	}
+	t, err := rt.StartRecording(ch.NewTraceName("listener-"+listener), program, args, vars)
+	if err != nil {
+		cfg.ChariotLogger.Warn("Listener trace not recorded", zap.String("listener", listener), zap.Error(err))
+		return run()
+	}
+	t.Source = "listener:" + listener
+	runErr := run()
+	rt.StopTrace()
+	if runErr == nil && record != RecordAll {
+		return nil
+	}
+	if runErr != nil {
+		t.Error = runErr.Error()
+	}
+	dir := ch.SharedTraceDir()
+	if err := ch.SaveTrace(dir, t); err != nil {
+		cfg.ChariotLogger.Warn("Listener trace not saved", zap.String("listener", listener), zap.Error(err))
+	} else {
+		cfg.ChariotLogger.Info("Listener trace saved", zap.String("listener", listener), zap.String("trace", t.Name))
+		ch.PruneTraces(dir, "listener-", cfg.ChariotConfig.TraceRetention)
+	}
+	return runErr
+}
@@ -0,0 +1,228 @@
+package listeners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/storage"
+)
+
+// Each listener runs its scripts on a runtime of its own, created from the
+// manager's runtime when the listener first starts (see
+// chariot.NewIsolatedRuntime), so variables one listener sets are not seen
+// by another. The listener's imports run in it when it is created, and its
+// env is what getEnv and hasEnv find first. The runtime is kept across stops
+// and starts until the listener is reset, redefined or deleted. Scripts run
+// on it one at a time, and on the runtimes of different listeners side by
+// side; invoke.go describes how a listener's invocations may run on further
+// runtimes.
+
+// Errors of the runtime APIs
+var (
+	ErrNotFound = errors.New("listener not found")
+	ErrRunning  = errors.New("listener is running; stop it first")
+)
+
+// listenerRuntime is the runtime of one listener.
+type listenerRuntime struct {
+	rt      *ch.Runtime
+	turn    chan struct{} // holds a token while something runs on or reads rt
+	created time.Time
+	runs    atomic.Int64
+	lastRun atomic.Int64 // unix nanoseconds
+}
+
+// RuntimeInfo describes the runtime of a listener.
+type RuntimeInfo struct {
+	Listener string         `json:"listener"`
+	Created  time.Time      `json:"created"`
+	Runs     int64          `json:"runs"` // scripts run on it since it was created
+	LastRun  *time.Time     `json:"last_run,omitempty"`
+	Imports  []string       `json:"imports,omitempty"`
+	Env      []string       `json:"env,omitempty"` // names of its variables; values are not shown
+	Size     ch.RuntimeSize `json:"size"`
+}
+
+// acquire waits until nothing else runs on the runtime.
+func (lr *listenerRuntime) acquire() {
+	lr.turn <- struct{}{}
+}
+
+// acquireContext is acquire giving up when ctx is done.
+func (lr *listenerRuntime) acquireContext(ctx context.Context) error {
+	select {
+	case lr.turn <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (lr *listenerRuntime) release() {
+	<-lr.turn
+}
+
+// ran counts a script started at started.
+func (lr *listenerRuntime) ran(started time.Time) {
+	lr.runs.Add(1)
+	lr.lastRun.Store(started.UnixNano())
+}
+
+// validateRuntime checks the imports and environment of a listener
+// definition.
+func validateRuntime(l *Listener) error {
+	for _, imp := range l.Imports {
+		if imp == "" {
+			return errors.New("imports must name files")
+		}
+		if _, err := ch.GetSecureFilePath(filepath.Join("files", imp), "data"); err != nil {
+			return fmt.Errorf("import %s: %w", imp, err)
+		}
+	}
+	for name := range l.Env {
+		if name == "" {
+			return errors.New("env variable names must not be empty")
+		}
+	}
+	return nil
+}
+
+// runtimeLocked returns the listener's runtime, creating it on first use;
+// m.mu must be held.
+func (m *Manager) runtimeLocked(l *Listener) (*listenerRuntime, error) {
+	if lr := m.runtimes[l.Name]; lr != nil {
+		return lr, nil
+	}
+	lr, err := m.newRuntime(l)
+	if err != nil {
+		return nil, err
+	}
+	m.runtimes[l.Name] = lr
+	return lr, nil
+}
+
+// newRuntime creates a runtime for l from the manager's runtime, with l's
+// env and imports.
+func (m *Manager) newRuntime(l *Listener) (*listenerRuntime, error) {
+	if m.runtime == nil {
+		return nil, errors.New("listeners have no runtime")
+	}
+	rt := ch.NewIsolatedRuntime(m.runtime)
+	if len(l.Env) > 0 {
+		env := make(map[string]string, len(l.Env))
+		for k, v := range l.Env {
+			env[k] = v
+		}
+		rt.SetEnv(env)
+	}
+	for _, imp := range l.Imports {
+		p, err := ch.GetSecureFilePath(filepath.Join("files", imp), "data")
+		if err != nil {
+			return nil, fmt.Errorf("import %s: %w", imp, err)
+		}
+		content, err := storage.Default().ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("import %s: %w", imp, err)
+		}
+		if _, err := rt.ExecProgram(string(content)); err != nil {
+			return nil, fmt.Errorf("import %s: %w", imp, err)
+		}
+	}
+	return &listenerRuntime{rt: rt, turn: make(chan struct{}, 1), created: time.Now()}, nil
+}
+
+// lookupRuntime returns a listener's runtime, creating it if the listener
+// has not started yet.
+func (m *Manager) lookupRuntime(name string) (*Listener, *listenerRuntime, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.listeners[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: '%s'", ErrNotFound, name)
+	}
+	lr, err := m.runtimeLocked(l)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listener '%s': %w", name, err)
+	}
+	copied := *l
+	return &copied, lr, nil
+}
+
+// Runtime describes the runtime of a listener, waiting for a script running
+// on it to finish or for ctx to be done.
+func (m *Manager) Runtime(ctx context.Context, name string) (RuntimeInfo, error) {
+	l, lr, err := m.lookupRuntime(name)
+	if err != nil {
+		return RuntimeInfo{}, err
+	}
+	if err := lr.acquireContext(ctx); err != nil {
+		return RuntimeInfo{}, err
+	}
+	size := lr.rt.Size()
+	lr.release()
+	info := RuntimeInfo{Listener: name, Created: lr.created, Runs: lr.runs.Load(), Imports: l.Imports, Size: size}
+	if at := lr.lastRun.Load(); at != 0 {
+		t := time.Unix(0, at)
+		info.LastRun = &t
+	}
+	for k := range l.Env {
+		info.Env = append(info.Env, k)
+	}
+	sort.Strings(info.Env)
+	return info, nil
+}
+
+// InspectRuntime returns the state of a listener's runtime, as
+// chariot.Runtime.InspectState does, once no script runs on it.
+func (m *Manager) InspectRuntime(ctx context.Context, name string) (map[string]interface{}, error) {
+	_, lr, err := m.lookupRuntime(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := lr.acquireContext(ctx); err != nil {
+		return nil, err
+	}
+	defer lr.release()
+	return lr.rt.InspectState(), nil
+}
+
+// ResetRuntime discards the runtime of a stopped listener; its next start
+// creates a fresh one.
+func (m *Manager) ResetRuntime(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.listeners[name]
+	if !ok {
+		return fmt.Errorf("%w: '%s'", ErrNotFound, name)
+	}
+	if l.Status == "running" {
+		return fmt.Errorf("%w: '%s'", ErrRunning, name)
+	}
+	delete(m.runtimes, name)
+	return nil
+}
+
+// ForEachRuntime calls fn with the runtime of each listener that has one,
+// while no script runs on it, so fn can change the runtime between two runs.
+func (m *Manager) ForEachRuntime(fn func(rt *ch.Runtime)) {
+	m.mu.RLock()
+	runtimes := make([]*listenerRuntime, 0, len(m.runtimes))
+	for _, lr := range m.runtimes {
+		runtimes = append(runtimes, lr)
+	}
+	for _, inv := range m.invokers {
+		runtimes = append(runtimes, inv.extra...)
+	}
+	m.mu.RUnlock()
+	for _, lr := range runtimes {
+		lr.acquire()
+		fn(lr.rt)
+		lr.release()
+	}
+}
@@ -10,14 +10,93 @@ import (
 
 type Listener struct {
 	Name       string    `json:"name"`
-	Script     string    `json:"script"`   // Primary script/program identifier
-	OnStart    string    `json:"on_start"` // Script to run on start
-	OnExit     string    `json:"on_exit"`  // Script to run on stop/exit
-	Status     string    `json:"status"`   // stopped|running|error
+	Script     string    `json:"script"`             // Primary script/program identifier
+	OnStart    string    `json:"on_start"`           // Script to run on start
+	OnExit     string    `json:"on_exit"`            // Script to run on stop/exit
+	Snapshot   string    `json:"snapshot,omitempty"` // Runtime snapshot restored before on_start
+	Status     string    `json:"status"`             // stopped|running|error
 	StartTime  time.Time `json:"start_time"`
 	LastActive time.Time `json:"last_active"`
 	IsHealthy  bool      `json:"is_healthy"`
 	AutoStart  bool      `json:"auto_start"`
+	// Type is "" for a service listener driven by its lifecycle scripts, or
+	// "watch" for a listener that runs Script for each file dropped into a
+	// folder described by Watch.
+	Type  string       `json:"type,omitempty"`
+	Watch *WatchConfig `json:"watch,omitempty"`
+	// Owner is the user who created the listener, counted against their
+	// listener quota.
+	Owner string `json:"owner,omitempty"`
+	// Record is "failures" or "all" to save an execution trace of the
+	// listener's failed or of all its runs, for replaying in the editor.
+	Record string `json:"record,omitempty"`
+	// Tags (team, project, ticket...) the usage of the listener's runs is
+	// attributed to.
+	Tags map[string]string `json:"tags,omitempty"`
+	// Diagram names the diagram whose code the listener runs, as its on_start
+	// program or, for a watch listener, its script. The code is checked
+	// against the listener guardrails before each start.
+	Diagram string `json:"diagram,omitempty"`
+	// Imports are files under data/files run in the listener's runtime when
+	// it is created, before any of the listener's scripts.
+	Imports []string `json:"imports,omitempty"`
+	// Env holds variables getEnv and hasEnv find in the listener's runtime
+	// before the process environment.
+	Env map[string]string `json:"env,omitempty"`
+	// Concurrency limits the invocations of the listener's script; nil runs
+	// one at a time and queues the others.
+	Concurrency *ConcurrencyConfig `json:"concurrency,omitempty"`
+	// Invocations counts the invocations of a running listener. It is filled
+	// in by List and Get, and not stored.
+	Invocations *InvocationStats `json:"invocations,omitempty"`
+}
+
+// Listener types
+const (
+	TypeService = ""
+	TypeWatch   = "watch"
+)
+
+// Listener trace recording
+const (
+	RecordNone     = ""
+	RecordFailures = "failures"
+	RecordAll      = "all"
+)
+
+// WatchConfig describes the folder a watch listener polls and what happens
+// to a file once its script has run.
+type WatchConfig struct {
+	Source       string `json:"source"`                  // Directory under the data path, or s3://bucket/prefix
+	Pattern      string `json:"pattern,omitempty"`       // Glob matched against file names (default all files)
+	Recursive    bool   `json:"recursive,omitempty"`     // Include files in subdirectories
+	PollInterval int    `json:"poll_interval,omitempty"` // Seconds between scans (default 5)
+	StableFor    int    `json:"stable_for,omitempty"`    // Seconds a file's size and modification time must not change (default 2)
+	Dedupe       string `json:"dedupe,omitempty"`        // path (default) | content | none
+	After        string `json:"after,omitempty"`         // "" (leave) | move | delete
+	MoveTo       string `json:"move_to,omitempty"`       // Destination of processed files when after is move
+	ErrorTo      string `json:"error_to,omitempty"`      // Destination of files whose script failed ("" = leave them)
+}
+
+// ConcurrencyConfig limits the invocations of a listener's script: the runs
+// for the files of a watch listener, or for the events posted to a service
+// listener.
+type ConcurrencyConfig struct {
+	MaxConcurrent int    `json:"max_concurrent,omitempty"` // Invocations running at once (default 1)
+	WhenBusy      string `json:"when_busy,omitempty"`      // queue (default) | drop
+	MaxQueued     int    `json:"max_queued,omitempty"`     // Invocations waiting for a runtime when queueing (default 100)
+	Timeout       int    `json:"timeout,omitempty"`        // Seconds an invocation may run before it is interrupted (0 = no limit)
+}
+
+// InvocationStats counts the invocations of a running listener since it
+// started.
+type InvocationStats struct {
+	InFlight  int64 `json:"in_flight"` // Running now
+	Queued    int64 `json:"queued"`    // Waiting for a runtime
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"` // Including those timed out
+	TimedOut  int64 `json:"timed_out"`
+	Dropped   int64 `json:"dropped"` // Refused because the listener was busy
 }
 
 // Snapshot is a serializable view of the registry for persistence
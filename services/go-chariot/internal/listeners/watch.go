@@ -0,0 +1,611 @@
+package listeners
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"go.uber.org/zap"
+)
+
+// Dedupe modes of a watch listener
+const (
+	DedupePath    = "path"    // a file is processed once per path, size and modification time
+	DedupeContent = "content" // a file is processed once per SHA-256 of its content
+	DedupeNone    = "none"    // nothing is remembered across restarts
+)
+
+// Post-processing of a watch listener
+const (
+	AfterLeave  = ""
+	AfterMove   = "move"
+	AfterDelete = "delete"
+)
+
+const (
+	defaultPollInterval = 5
+	defaultStableFor    = 2
+	// maxSeen bounds the remembered content hashes of a watch listener
+	maxSeen = 10000
+)
+
+// ValidateWatch checks a watch configuration and fills in its defaults.
+func ValidateWatch(w *WatchConfig) error {
+	if w == nil || w.Source == "" {
+		return errors.New("watch listener requires watch.source")
+	}
+	if strings.HasPrefix(w.Source, "s3://") {
+		if _, _, err := parseS3URL(w.Source); err != nil {
+			return err
+		}
+	} else if _, err := ch.GetSecureFilePath(w.Source, "data"); err != nil {
+		return fmt.Errorf("watch.source: %w", err)
+	}
+	if w.Pattern != "" {
+		if _, err := path.Match(w.Pattern, ""); err != nil {
+			return fmt.Errorf("watch.pattern: %w", err)
+		}
+	}
+	if w.PollInterval < 0 || w.StableFor < 0 {
+		return errors.New("watch.poll_interval and watch.stable_for must not be negative")
+	}
+	if w.PollInterval == 0 {
+		w.PollInterval = defaultPollInterval
+	}
+	if w.StableFor == 0 {
+		w.StableFor = defaultStableFor
+	}
+	switch w.Dedupe {
+	case "":
+		w.Dedupe = DedupePath
+	case DedupePath, DedupeContent, DedupeNone:
+	default:
+		return fmt.Errorf("watch.dedupe must be path, content or none, got %q", w.Dedupe)
+	}
+	switch w.After {
+	case AfterLeave, AfterDelete:
+	case AfterMove:
+		if w.MoveTo == "" {
+			return errors.New("watch.after move requires watch.move_to")
+		}
+	default:
+		return fmt.Errorf("watch.after must be move or delete, got %q", w.After)
+	}
+	if !strings.HasPrefix(w.Source, "s3://") {
+		for _, dir := range []string{w.MoveTo, w.ErrorTo} {
+			if dir == "" {
+				continue
+			}
+			if _, err := ch.GetSecureFilePath(dir, "data"); err != nil {
+				return fmt.Errorf("watch destination %s: %w", dir, err)
+			}
+		}
+	}
+	return nil
+}
+
+// watchFile is a file seen in a watched folder.
+type watchFile struct {
+	Key     string // Path below the source, slash separated
+	Size    int64
+	ModTime time.Time
+	Tag     string // ETag of an S3 object
+}
+
+// watchSource is a folder a watch listener polls.
+type watchSource interface {
+	List(ctx context.Context) ([]watchFile, error)
+	// Fetch returns the local path of a file, and a function that removes
+	// any copy made for the script.
+	Fetch(ctx context.Context, f watchFile) (string, func(), error)
+	Move(ctx context.Context, f watchFile, dir string) error
+	Delete(ctx context.Context, f watchFile) error
+}
+
+type pendingFile struct {
+	size    int64
+	modTime time.Time
+	tag     string
+	since   time.Time
+}
+
+type seenEntry struct {
+	File string    `json:"file"`
+	At   time.Time `json:"at"`
+}
+
+// watcher polls the source of a watch listener and runs the listener's
+// script for each new file once the file has stopped changing.
+type watcher struct {
+	m         *Manager
+	invoker   *invoker // runs the listener's script
+	name      string
+	script    string
+	record    string // Listener.Record
+	tags      map[string]string
+	conf      WatchConfig
+	source    watchSource
+	statePath string
+	mu        sync.Mutex             // guards seen and done while files are processed
+	seen      map[string]seenEntry   // Dedupe keys processed, persisted in statePath
+	done      map[string]string      // path keys processed by this watcher, with their file
+	pending   map[string]pendingFile // Files waiting to become stable
+	cancel    context.CancelFunc
+}
+
+func newWatcher(m *Manager, l *Listener, inv *invoker) (*watcher, error) {
+	if l.Watch == nil {
+		return nil, fmt.Errorf("listener '%s' has no watch configuration", l.Name)
+	}
+	conf := *l.Watch
+	if err := ValidateWatch(&conf); err != nil {
+		return nil, err
+	}
+	src, err := newWatchSource(l.Name, conf)
+	if err != nil {
+		return nil, err
+	}
+	w := &watcher{
+		m:         m,
+		invoker:   inv,
+		name:      l.Name,
+		script:    l.Script,
+		record:    l.Record,
+		tags:      l.Tags,
+		conf:      conf,
+		source:    src,
+		statePath: filepath.Join(filepath.Dir(m.filePath), "watch_state", l.Name+".json"),
+		seen:      map[string]seenEntry{},
+		done:      map[string]string{},
+		pending:   map[string]pendingFile{},
+	}
+	if conf.Dedupe != DedupeNone {
+		if data, err := os.ReadFile(w.statePath); err == nil {
+			if err := json.Unmarshal(data, &w.seen); err != nil {
+				return nil, fmt.Errorf("listener '%s': watch state: %w", l.Name, err)
+			}
+		}
+	}
+	return w, nil
+}
+
+func newWatchSource(name string, conf WatchConfig) (watchSource, error) {
+	dataPath, err := filepath.Abs(dataDir())
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(conf.Source, "s3://") {
+		bucket, prefix, err := parseS3URL(conf.Source)
+		if err != nil {
+			return nil, err
+		}
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if accessKey == "" || secretKey == "" {
+			return nil, errors.New("s3 watch sources require AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+		client := newS3Client(cfg.ChariotConfig.S3Endpoint, cfg.ChariotConfig.S3Region, accessKey, secretKey, os.Getenv("AWS_SESSION_TOKEN"))
+		return &s3Source{
+			client:    client,
+			bucket:    bucket,
+			prefix:    prefix,
+			recursive: conf.Recursive,
+			staging:   filepath.Join(dataPath, "watch_staging", name),
+		}, nil
+	}
+	root, err := ch.GetSecureFilePath(conf.Source, "data")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	src := &localSource{root: root, recursive: conf.Recursive, skip: map[string]bool{}}
+	// Processed files moved into the watched folder must not come back
+	for _, dir := range []string{conf.MoveTo, conf.ErrorTo} {
+		if dir != "" {
+			if p, err := ch.GetSecureFilePath(dir, "data"); err == nil {
+				src.skip[p] = true
+			}
+		}
+	}
+	return src, nil
+}
+
+func dataDir() string {
+	if cfg.ChariotConfig.DataPath == "" {
+		return "./data"
+	}
+	return cfg.ChariotConfig.DataPath
+}
+
+// run polls until the watcher is stopped.
+func (w *watcher) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(w.conf.PollInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		w.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *watcher) poll(ctx context.Context) {
+	files, err := w.source.List(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			w.m.invocationResult(w.name, w.invoker, fmt.Errorf("watch %s: %w", w.conf.Source, err))
+		}
+		return
+	}
+	now := time.Now()
+	stableFor := time.Duration(w.conf.StableFor) * time.Second
+	present := make(map[string]bool, len(files))
+	var ready []watchFile
+	for _, f := range files {
+		if ctx.Err() != nil {
+			return
+		}
+		if !w.matches(f.Key) {
+			continue
+		}
+		present[f.Key] = true
+		key := pathKey(f)
+		if _, ok := w.done[key]; ok {
+			continue
+		}
+		if _, ok := w.seen[key]; ok && w.conf.Dedupe == DedupePath {
+			continue
+		}
+		p, ok := w.pending[f.Key]
+		if !ok || p.size != f.Size || !p.modTime.Equal(f.ModTime) || p.tag != f.Tag {
+			w.pending[f.Key] = pendingFile{size: f.Size, modTime: f.ModTime, tag: f.Tag, since: now}
+			if stableFor > 0 {
+				continue
+			}
+		} else if now.Sub(p.since) < stableFor {
+			continue
+		}
+		if len(ready) < w.batchSize() {
+			// Files beyond the batch stay pending, stable, for the next poll
+			delete(w.pending, f.Key)
+			ready = append(ready, f)
+		}
+	}
+
+	// The files of a poll are processed side by side, as many at once as
+	// the listener's concurrency admits, and the next poll waits for them
+	var wg sync.WaitGroup
+	var changed atomic.Bool
+	for _, f := range ready {
+		wg.Add(1)
+		go func(f watchFile) {
+			defer wg.Done()
+			if w.process(ctx, f) {
+				changed.Store(true)
+			}
+		}(f)
+	}
+	wg.Wait()
+
+	// Forget files that are gone; a path key is no use once its file is
+	for k := range w.pending {
+		if !present[k] {
+			delete(w.pending, k)
+		}
+	}
+	for k, file := range w.done {
+		if !present[file] {
+			delete(w.done, k)
+		}
+	}
+	if w.conf.Dedupe == DedupePath {
+		for k, e := range w.seen {
+			if !present[e.File] {
+				delete(w.seen, k)
+				changed.Store(true)
+			}
+		}
+	}
+	if changed.Load() {
+		w.saveState()
+	}
+}
+
+// batchSize is how many files a poll hands to the script: those that can
+// run at once, and those that can wait for them.
+func (w *watcher) batchSize() int {
+	conf := w.invoker.conf
+	if conf.WhenBusy == WhenBusyDrop {
+		return conf.MaxConcurrent
+	}
+	return conf.MaxConcurrent + conf.MaxQueued
+}
+
+// process hands one stable file to the script and post-processes it. It
+// reports whether the persisted state changed.
+func (w *watcher) process(ctx context.Context, f watchFile) bool {
+	key := pathKey(f)
+	local, cleanup, err := w.source.Fetch(ctx, f)
+	if err != nil {
+		if ctx.Err() == nil {
+			w.m.invocationResult(w.name, w.invoker, fmt.Errorf("fetch %s: %w", f.Key, err))
+		}
+		return false
+	}
+	defer cleanup()
+	w.mu.Lock()
+	w.done[key] = f.Key
+	w.mu.Unlock()
+
+	dedupeKey := key
+	if w.conf.Dedupe == DedupeContent {
+		if dedupeKey, err = fileSHA256(local); err != nil {
+			w.m.invocationResult(w.name, w.invoker, fmt.Errorf("hash %s: %w", f.Key, err))
+			return false
+		}
+		w.mu.Lock()
+		_, dup := w.seen[dedupeKey]
+		w.mu.Unlock()
+		if dup {
+			cfg.ChariotLogger.Info("Watch listener skipped duplicate file", zap.String("listener", w.name), zap.String("file", f.Key))
+			w.finish(ctx, f, nil)
+			return false
+		}
+	}
+
+	rel, err := filepath.Rel(dataDirAbs(), local)
+	if err != nil {
+		rel = local
+	}
+	info := ch.NewMap()
+	info.Set("source", ch.Str(w.conf.Source))
+	info.Set("key", ch.Str(f.Key))
+	info.Set("size", ch.Number(f.Size))
+	info.Set("modified", ch.Str(f.ModTime.UTC().Format(ch.CHARIOT_DATETIME_FORMAT)))
+	runErr := w.m.runWatchScript(ctx, w, filepath.ToSlash(rel), info)
+	if errors.Is(runErr, ErrBusy) || (ctx.Err() != nil && errors.Is(runErr, ctx.Err())) {
+		// Not run: dropped while busy, or stopped while queued. The file is
+		// seen again on the next poll or start
+		w.mu.Lock()
+		delete(w.done, key)
+		w.mu.Unlock()
+		return false
+	}
+	w.m.invocationResult(w.name, w.invoker, runErr)
+
+	// A file whose script failed is not retried until it changes
+	if w.conf.Dedupe != DedupeNone {
+		w.mu.Lock()
+		w.seen[dedupeKey] = seenEntry{File: f.Key, At: time.Now()}
+		w.mu.Unlock()
+	}
+	w.finish(ctx, f, runErr)
+	return w.conf.Dedupe != DedupeNone
+}
+
+// finish applies the post-processing of a file once its script has run.
+func (w *watcher) finish(ctx context.Context, f watchFile, runErr error) {
+	// Post-processing completes even when the listener is being stopped
+	ctx = context.WithoutCancel(ctx)
+	var err error
+	switch {
+	case runErr != nil:
+		if w.conf.ErrorTo != "" {
+			err = w.source.Move(ctx, f, w.conf.ErrorTo)
+		}
+	case w.conf.After == AfterMove:
+		err = w.source.Move(ctx, f, w.conf.MoveTo)
+	case w.conf.After == AfterDelete:
+		err = w.source.Delete(ctx, f)
+	}
+	if err != nil {
+		cfg.ChariotLogger.Error("Watch listener post-processing failed", zap.String("listener", w.name), zap.String("file", f.Key), zap.Error(err))
+	}
+}
+
+func (w *watcher) matches(key string) bool {
+	if w.conf.Pattern == "" {
+		return true
+	}
+	name := path.Base(key)
+	if strings.Contains(w.conf.Pattern, "/") {
+		name = key
+	}
+	ok, _ := path.Match(w.conf.Pattern, name)
+	return ok
+}
+
+func (w *watcher) saveState() {
+	if len(w.seen) > maxSeen {
+		entries := make([]string, 0, len(w.seen))
+		for k := range w.seen {
+			entries = append(entries, k)
+		}
+		sort.Slice(entries, func(i, j int) bool { return w.seen[entries[i]].At.Before(w.seen[entries[j]].At) })
+		for _, k := range entries[:len(entries)-maxSeen] {
+			delete(w.seen, k)
+		}
+	}
+	data, err := json.MarshalIndent(w.seen, "", "  ")
+	if err == nil {
+		_ = os.MkdirAll(filepath.Dir(w.statePath), 0o755)
+		err = os.WriteFile(w.statePath, data, 0o644)
+	}
+	if err != nil {
+		cfg.ChariotLogger.Error("Watch listener state not saved", zap.String("listener", w.name), zap.Error(err))
+	}
+}
+
+func pathKey(f watchFile) string {
+	return fmt.Sprintf("%s|%d|%d|%s", f.Key, f.Size, f.ModTime.UnixNano(), f.Tag)
+}
+
+func fileSHA256(file string) (string, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, fh); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func dataDirAbs() string {
+	abs, err := filepath.Abs(dataDir())
+	if err != nil {
+		return dataDir()
+	}
+	return abs
+}
+
+// localSource is a directory under the data path.
+type localSource struct {
+	root      string
+	recursive bool
+	skip      map[string]bool // Directories not listed
+}
+
+func (s *localSource) List(ctx context.Context) ([]watchFile, error) {
+	var files []watchFile
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Dotfiles are usually uploads in progress
+		if p != s.root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if p != s.root && (!s.recursive || s.skip[p]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed since it was listed
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, watchFile{Key: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+		return ctx.Err()
+	})
+	return files, err
+}
+
+func (s *localSource) Fetch(ctx context.Context, f watchFile) (string, func(), error) {
+	return filepath.Join(s.root, filepath.FromSlash(f.Key)), func() {}, nil
+}
+
+func (s *localSource) Move(ctx context.Context, f watchFile, dir string) error {
+	dest, err := ch.GetSecureFilePath(filepath.Join(dir, filepath.FromSlash(f.Key)), "data")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(s.root, filepath.FromSlash(f.Key)), dest)
+}
+
+func (s *localSource) Delete(ctx context.Context, f watchFile) error {
+	return os.Remove(filepath.Join(s.root, filepath.FromSlash(f.Key)))
+}
+
+// s3Source is a key prefix of an S3 bucket. Objects are downloaded to a
+// staging directory under the data path while their script runs.
+type s3Source struct {
+	client    *s3Client
+	bucket    string
+	prefix    string
+	recursive bool
+	staging   string
+}
+
+func (s *s3Source) List(ctx context.Context) ([]watchFile, error) {
+	objects, err := s.client.List(ctx, s.bucket, s.prefix)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]watchFile, 0, len(objects))
+	for _, o := range objects {
+		key := strings.TrimPrefix(o.Key, s.prefix)
+		if key == "" || strings.HasSuffix(key, "/") || (!s.recursive && strings.Contains(key, "/")) {
+			continue
+		}
+		files = append(files, watchFile{Key: key, Size: o.Size, ModTime: o.LastModified, Tag: o.ETag})
+	}
+	return files, nil
+}
+
+func (s *s3Source) Fetch(ctx context.Context, f watchFile) (string, func(), error) {
+	body, err := s.client.Get(ctx, s.bucket, s.prefix+f.Key)
+	if err != nil {
+		return "", nil, err
+	}
+	defer body.Close()
+	local := filepath.Join(s.staging, filepath.FromSlash(f.Key))
+	if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+		return "", nil, err
+	}
+	out, err := os.Create(local)
+	if err != nil {
+		return "", nil, err
+	}
+	_, err = io.Copy(out, body)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	cleanup := func() { _ = os.Remove(local) }
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return local, cleanup, nil
+}
+
+// Move copies the object below dir, a key prefix of the same bucket, and
+// deletes the original.
+func (s *s3Source) Move(ctx context.Context, f watchFile, dir string) error {
+	dest := strings.Trim(dir, "/") + "/" + f.Key
+	if err := s.client.Copy(ctx, s.bucket, s.prefix+f.Key, dest); err != nil {
+		return err
+	}
+	return s.client.Delete(ctx, s.bucket, s.prefix+f.Key)
+}
+
+func (s *s3Source) Delete(ctx context.Context, f watchFile) error {
+	return s.client.Delete(ctx, s.bucket, s.prefix+f.Key)
+}
@@ -7,6 +7,8 @@ import (
 
 // RegisterRoutes sets up all API routes
 func RegisterRoutes(e *echo.Echo, h *handlers.Handlers) {
+	// Unknown routes, wrong methods and unhandled errors get JSON answers too
+	e.HTTPErrorHandler = h.HTTPError
 
 	// Public routes here
 	e.GET("/", func(c echo.Context) error {
@@ -16,20 +18,69 @@ func RegisterRoutes(e *echo.Echo, h *handlers.Handlers) {
 	e.GET("/ready", h.Ready)
 	e.POST("/login", h.HandleLogin)
 	e.POST("/logout", h.HandleLogout)
+	e.POST("/token/refresh", h.HandleRefreshToken) // POST /token/refresh {"refresh_token"} -> new token pair
 
 	// Protected routes
 	api := e.Group("/api")
 	api.Use(h.SessionAuth)
 	api.GET("/session/profile", h.SessionProfile)
 	api.GET("/data", h.GetData)
-	api.POST("/execute", h.Execute)
-	api.POST("/execute-async", h.ExecuteAsync)
+	api.GET("/cluster/status", h.ClusterStatus)              // replicas, the roles each leads and the leader of each role
+	api.POST("/execute", h.Execute, h.Idempotent)            // POST /api/execute (Idempotency-Key header optional)
+	api.POST("/execute-async", h.ExecuteAsync, h.Idempotent) // POST /api/execute-async (Idempotency-Key header optional)
+	api.GET("/logs/system", h.SystemLogs, h.AdminAuth)       // GET /api/logs/system?since=&level=&component=&q=&limit= (admins only)
 	api.GET("/logs/:execId", h.StreamLogs)
 	api.GET("/result/:execId", h.GetResult)
+	api.GET("/result/:execId/stream", h.StreamResults)         // GET /api/result/:execId/stream -> values the script emits, as NDJSON
+	api.GET("/executions/queue", h.ExecutionQueue)             // GET /api/executions/queue -> running and queued executions and waits by priority
+	api.GET("/circuits", h.ListCircuits)                       // GET /api/circuits -> circuit breakers opened by circuit()
+	api.DELETE("/circuits/:name", h.ResetCircuit, h.AdminAuth) // DELETE /api/circuits/:name -> closes the circuit (admins only)
+	api.POST("/bench", h.Benchmark)                            // POST /api/bench {"program" | "function", "args", "setup", "iterations", "warmup"} -> mean, p95 and allocations
+	api.POST("/lint", h.Lint)                                  // POST /api/lint {"program", "filename"} -> syntax and type diagnostics
+	api.GET("/docs/functions", h.FunctionDocs)                 // GET /api/docs/functions?format=html -> builtin and user function reference
+	api.GET("/builtins", h.Builtins)                           // GET /api/builtins -> category, signature, summary and example of each builtin
+	api.POST("/refactor/rename", h.RenameSymbol)               // POST /api/refactor/rename?scope= {"symbol", "new_name", "apply"} -> changes with diffs
+	api.GET("/refactor/references", h.SymbolReferences)        // GET /api/refactor/references?symbol=&scope= -> definitions, calls and references
+	api.GET("/index/symbols", h.SearchSymbols)                 // GET /api/index/symbols?q=&kind=&scope= -> symbol table for search and completion
+	api.GET("/index/status", h.IndexStatus)                    // GET /api/index/status -> files, functions, symbols, last scan
+	api.GET("/artifacts/:execId", h.ListArtifacts)             // GET /api/artifacts/:execId
+	api.GET("/artifacts/:execId/:name", h.DownloadArtifact)    // GET /api/artifacts/:execId/:name?inline=true
 	api.GET("/functions", h.ListFunctions)
+	api.GET("/plugins", h.ListPlugins) // GET /api/plugins
 	api.GET("/global-variables", h.ListGlobalVariables)
 	api.POST("/function/save", h.SaveFunctionHandler)
+	api.PUT("/functions/:name/deprecation", h.DeprecateFunctionHandler)      // PUT /api/functions/:name/deprecation {"note"}
+	api.DELETE("/functions/:name/deprecation", h.UndeprecateFunctionHandler) // DELETE /api/functions/:name/deprecation
+	api.GET("/usage", h.UsageReport)                                         // GET /api/usage?unused=days
+	api.GET("/usage/tags", h.TagUsageReport)                                 // GET /api/usage/tags?tag=team&days=30&by=day
 	api.POST("/functions/save-library", h.SaveFunctionLibraryHandler)
+	api.GET("/library/versions", h.ListLibraryVersions)                // GET /api/library/versions
+	api.POST("/library/versions", h.StageLibrary)                      // POST /api/library/versions {"functions", "note", "replace"} -> staged version
+	api.GET("/library/versions/:version", h.GetLibraryVersion)         // GET /api/library/versions/:version
+	api.POST("/library/versions/:version/test", h.TestLibrary)         // POST /api/library/versions/:version/test
+	api.POST("/library/versions/:version/activate", h.ActivateLibrary) // POST /api/library/versions/:version/activate {"force"}
+	api.POST("/library/rollback", h.RollbackLibraryHandler)            // POST /api/library/rollback
+	api.GET("/runtime/inspect", h.InspectRuntime)                      // GET /api/runtime/inspect?path=...&depth=&offset=&limit=&since=
+	api.GET("/runtime/watches", h.ListWatches)                         // GET /api/runtime/watches
+	api.POST("/runtime/watches", h.AddWatch)                           // POST /api/runtime/watches {"expression": "..."}
+	api.DELETE("/runtime/watches", h.RemoveWatch)                      // DELETE /api/runtime/watches?expression=...
+	api.POST("/runtime/reset", h.ResetRuntime)                         // POST /api/runtime/reset
+	api.GET("/runtime/size", h.RuntimeSize)                            // GET /api/runtime/size
+	api.GET("/repl", h.HandleReplWS)                                   // GET /api/repl?runtime=session|ephemeral (WebSocket)
+
+	// Named runtime snapshots
+	snapshots := api.Group("/runtime/snapshots")
+	snapshots.GET("", h.ListSnapshots)                  // GET /api/runtime/snapshots
+	snapshots.POST("", h.SaveSnapshot)                  // POST /api/runtime/snapshots {"name": "..."}
+	snapshots.POST("/:name/restore", h.RestoreSnapshot) // POST /api/runtime/snapshots/:name/restore
+	snapshots.DELETE("/:name", h.DeleteSnapshot)        // DELETE /api/runtime/snapshots/:name
+
+	// Execution traces recorded by runs with record set and by listeners
+	traces := api.Group("/traces")
+	traces.GET("", h.ListTraces)                // GET /api/traces
+	traces.GET("/:name", h.GetTrace)            // GET /api/traces/:name
+	traces.DELETE("/:name", h.DeleteTrace)      // DELETE /api/traces/:name
+	traces.POST("/:name/replay", h.ReplayTrace) // POST /api/traces/:name/replay {"runtime": "ephemeral"|"session"}
 
 	// Files API
 	files := api.Group("/files")
@@ -38,41 +89,128 @@ func RegisterRoutes(e *echo.Echo, h *handlers.Handlers) {
 	files.POST("", h.SaveFile)           // POST /api/files?scope=sandbox|global
 	files.DELETE("/:name", h.DeleteFile) // DELETE /api/files/:name?scope=sandbox|global
 
+	// Advisory edit leases on files; released on unlock or when the session ends
+	api.POST("/file/lock", h.LockFile)      // POST /api/file/lock?scope=sandbox|global
+	api.DELETE("/file/lock", h.UnlockFile)  // DELETE /api/file/lock?name=...&scope=sandbox|global
+	api.GET("/file/locks", h.ListFileLocks) // GET /api/file/locks?scope=sandbox|global
+
 	// Diagrams API
 	diagrams := api.Group("/diagrams")
-	diagrams.GET("", h.ListDiagrams)           // GET /api/diagrams
-	diagrams.GET("/:name", h.GetDiagram)       // GET /api/diagrams/:name
-	diagrams.POST("", h.SaveDiagram)           // POST /api/diagrams
-	diagrams.DELETE("/:name", h.DeleteDiagram) // DELETE /api/diagrams/:name
+	diagrams.GET("", h.ListDiagrams)               // GET /api/diagrams
+	diagrams.GET("/components", h.ListComponents)  // GET /api/diagrams/components
+	diagrams.GET("/:name", h.GetDiagram)           // GET /api/diagrams/:name
+	diagrams.POST("", h.SaveDiagram)               // POST /api/diagrams
+	diagrams.POST("/validate", h.ValidateDiagram)  // POST /api/diagrams/validate
+	diagrams.POST("/from-code", h.DiagramFromCode) // POST /api/diagrams/from-code
+	diagrams.DELETE("/:name", h.DeleteDiagram)     // DELETE /api/diagrams/:name
+	diagrams.POST("/:name/run", h.RunDiagram)      // POST /api/diagrams/:name/run
+
+	// Notebooks: code and markdown cells run against the session runtime
+	notebooks := api.Group("/notebooks")
+	notebooks.GET("", h.ListNotebooks)                          // GET /api/notebooks?scope=sandbox|global
+	notebooks.GET("/:name", h.GetNotebook)                      // GET /api/notebooks/:name
+	notebooks.POST("", h.SaveNotebook)                          // POST /api/notebooks {"name", "cells"}
+	notebooks.DELETE("/:name", h.DeleteNotebook)                // DELETE /api/notebooks/:name
+	notebooks.POST("/:name/run", h.RunNotebook)                 // POST /api/notebooks/:name/run?from=&stale=
+	notebooks.POST("/:name/cells/:cell/run", h.RunNotebookCell) // POST /api/notebooks/:name/cells/:cell/run
+
+	// Workspace backup and transfer
+	workspace := api.Group("/workspace")
+	workspace.GET("/export", h.ExportWorkspace)  // GET /api/workspace/export?scope=sandbox|global
+	workspace.POST("/import", h.ImportWorkspace) // POST /api/workspace/import?scope=...&policy=skip|overwrite|rename|fail
 
 	// Listener registry APIs
 	listeners := api.Group("/listeners")
-	listeners.GET("", h.ListListeners)              // GET /api/listeners
-	listeners.POST("", h.CreateListener)            // POST /api/listeners
-	listeners.DELETE("/:name", h.DeleteListener)    // DELETE /api/listeners/:name
-	listeners.POST("/:name/start", h.StartListener) // POST /api/listeners/:name/start
-	listeners.POST("/:name/stop", h.StopListener)   // POST /api/listeners/:name/stop
+	listeners.GET("", h.ListListeners)                                // GET /api/listeners
+	listeners.POST("", h.CreateListener)                              // POST /api/listeners
+	listeners.DELETE("/:name", h.DeleteListener)                      // DELETE /api/listeners/:name
+	listeners.POST("/:name/start", h.StartListener, h.Idempotent)     // POST /api/listeners/:name/start (Idempotency-Key header optional)
+	listeners.POST("/:name/stop", h.StopListener, h.Idempotent)       // POST /api/listeners/:name/stop (Idempotency-Key header optional)
+	listeners.GET("/:name/runtime", h.ListenerRuntime)                // GET /api/listeners/:name/runtime -> created, runs, imports, env names and size
+	listeners.GET("/:name/runtime/inspect", h.InspectListenerRuntime) // GET /api/listeners/:name/runtime/inspect?path=&depth=&offset=&limit=
+	listeners.POST("/:name/runtime/reset", h.ResetListenerRuntime)    // POST /api/listeners/:name/runtime/reset (409 while running)
+	listeners.POST("/:name/invoke", h.InvokeListener)                 // POST /api/listeners/:name/invoke {payload} (409 stopped, 503 busy)
+
+	// Outbound webhooks
+	hooks := api.Group("/webhooks")
+	hooks.GET("", h.ListWebhooks)                     // GET /api/webhooks
+	hooks.POST("", h.CreateWebhook)                   // POST /api/webhooks {"url","events","secret","description","active"}
+	hooks.GET("/deliveries", h.WebhookDeliveries)     // GET /api/webhooks/deliveries?limit=
+	hooks.PUT("/:id", h.UpdateWebhook)                // PUT /api/webhooks/:id
+	hooks.DELETE("/:id", h.DeleteWebhook)             // DELETE /api/webhooks/:id
+	hooks.POST("/:id/test", h.TestWebhook)            // POST /api/webhooks/:id/test
+	hooks.GET("/:id/deliveries", h.WebhookDeliveries) // GET /api/webhooks/:id/deliveries?limit=
+
+	// Listener payloads and webhook events that failed for good
+	dead := api.Group("/dead-letters")
+	dead.GET("", h.ListDeadLetters)            // GET /api/dead-letters?source=&target=&limit= -> letters and counts
+	dead.DELETE("", h.PurgeDeadLetters)        // DELETE /api/dead-letters?source=&target=&before= (all without filters)
+	dead.GET("/:id", h.GetDeadLetter)          // GET /api/dead-letters/:id
+	dead.POST("/:id/retry", h.RetryDeadLetter) // POST /api/dead-letters/:id/retry (202 for webhook events)
+	dead.DELETE("/:id", h.DeleteDeadLetter)    // DELETE /api/dead-letters/:id
 
 	// Agents APIs
 	agents := api.Group("/agents")
 	agents.GET("", h.ListAgents)
-	agents.POST("/create", h.CreateAgent)      // POST /api/agents/create
-	agents.POST("/stop", h.StopAgent)          // POST /api/agents/stop
-	agents.POST("/publish", h.PublishAgent)    // POST /api/agents/publish
-	agents.POST("/belief", h.SetBelief)        // POST /api/agents/belief
-	agents.GET("/:name/beliefs", h.GetBeliefs) // GET /api/agents/:name/beliefs
-	agents.GET("/:name/info", h.GetAgentInfo)  // GET /api/agents/:name/info
-	agents.POST("/run-once", h.RunPlanOnce)    // POST /api/agents/run-once
+	agents.POST("/create", h.CreateAgent)             // POST /api/agents/create
+	agents.POST("/stop", h.StopAgent)                 // POST /api/agents/stop
+	agents.POST("/publish", h.PublishAgent)           // POST /api/agents/publish
+	agents.POST("/belief", h.SetBelief)               // POST /api/agents/belief
+	agents.GET("/:name", h.GetAgent)                  // GET /api/agents/:name
+	agents.GET("/:name/beliefs", h.GetBeliefs)        // GET /api/agents/:name/beliefs
+	agents.GET("/:name/info", h.GetAgentInfo)         // GET /api/agents/:name/info
+	agents.GET("/:name/events", h.GetAgentEvents)     // GET /api/agents/:name/events
+	agents.POST("/run-once", h.RunPlanOnce)           // POST /api/agents/run-once
+	agents.POST("/:name/plans", h.AttachPlan)         // POST /api/agents/:name/plans {"plan": "...", "bindings": {...}}
+	agents.DELETE("/:name/plans/:plan", h.DetachPlan) // DELETE /api/agents/:name/plans/:plan
 	// Legacy routes for compatibility
 	agents.POST("/start", h.StartAgent)
 	agents.POST("/:name/stop", h.StopAgent)
 	agents.POST("/:name/publish", h.PublishAgent)
 	agents.PUT("/:name/beliefs", h.PutBelief)
 
+	// Plan library shared by agents
+	plans := api.Group("/plans")
+	plans.GET("", h.ListPlans)           // GET /api/plans
+	plans.POST("", h.DefinePlan)         // POST /api/plans {"variable": "p"} | {"program": "..."}
+	plans.GET("/:name", h.GetPlan)       // GET /api/plans/:name
+	plans.DELETE("/:name", h.DeletePlan) // DELETE /api/plans/:name
+
 	// ETL APIs
 	etl := api.Group("/etl")
 	etl.GET("/transforms", h.ListETLTransforms)
 
+	// Account and session administration (admins only)
+	admin := api.Group("/admin", h.AdminAuth)
+	admin.GET("/sessions", h.ListSessionsAdmin)                   // GET /api/admin/sessions?user=
+	admin.GET("/sessions/:ref", h.GetSessionAdmin)                // GET /api/admin/sessions/:ref
+	admin.DELETE("/sessions/:ref", h.EndSessionAdmin)             // DELETE /api/admin/sessions/:ref
+	admin.DELETE("/users/:user/sessions", h.EndUserSessionsAdmin) // DELETE /api/admin/users/:user/sessions
+	admin.GET("/users", h.ListUsers)                              // GET /api/admin/users
+	admin.POST("/users", h.CreateUser)                            // POST /api/admin/users {"user_id","display_name","email","roles","disabled","password"}
+	admin.GET("/users/:user", h.GetUser)                          // GET /api/admin/users/:user
+	admin.PUT("/users/:user", h.UpdateUser)                       // PUT /api/admin/users/:user {"display_name","email","roles","disabled"}
+	admin.POST("/users/:user/password", h.ResetUserPassword)      // POST /api/admin/users/:user/password {"password"}
+	admin.DELETE("/users/:user", h.DeleteUser)                    // DELETE /api/admin/users/:user
+	admin.DELETE("/users/:user/mfa", h.ResetUserMFA)              // DELETE /api/admin/users/:user/mfa
+	admin.GET("/quotas", h.GetQuotas)                             // GET /api/admin/quotas -> defaults, role and user limits
+	admin.PUT("/quotas/roles/:role", h.SetRoleQuota)              // PUT /api/admin/quotas/roles/:role {"file_bytes","executions_per_hour","concurrent_executions","listeners"}
+	admin.DELETE("/quotas/roles/:role", h.SetRoleQuota)           // DELETE /api/admin/quotas/roles/:role
+	admin.PUT("/quotas/users/:user", h.SetUserQuota)              // PUT /api/admin/quotas/users/:user {...same fields}
+	admin.DELETE("/quotas/users/:user", h.SetUserQuota)           // DELETE /api/admin/quotas/users/:user
+	admin.GET("/quotas/usage", h.QuotaUsageAdmin)                 // GET /api/admin/quotas/usage?user=
+	admin.DELETE("/quotas/usage/:user", h.ResetQuotaUsage)        // DELETE /api/admin/quotas/usage/:user (hourly executions)
+	admin.GET("/trees/keys", h.TreeKeys)                          // GET /api/admin/trees/keys -> encryption keys and the secure trees using them
+	admin.POST("/trees/reencrypt", h.ReencryptTrees)              // POST /api/admin/trees/reencrypt {"key","to"}
+
+	// The caller's own account: password and TOTP second factor
+	account := api.Group("/account")
+	account.POST("/password", h.ChangePassword) // POST /api/account/password {"current_password","new_password"}
+	account.POST("/mfa/enroll", h.EnrollMFA)    // POST /api/account/mfa/enroll -> secret, otpauth_url
+	account.GET("/mfa/qr", h.MFAQRCode)         // GET /api/account/mfa/qr (PNG of the enrollment in progress)
+	account.POST("/mfa/confirm", h.ConfirmMFA)  // POST /api/account/mfa/confirm {"code"} -> recovery_codes
+	account.POST("/mfa/disable", h.DisableMFA)  // POST /api/account/mfa/disable {"code"}
+
 	// Protected dashboard routes (require authentication)
 	dashboard := e.Group("/dashboard")
 	dashboard.Use(h.SessionAuth)
@@ -83,12 +221,23 @@ func RegisterRoutes(e *echo.Echo, h *handlers.Handlers) {
 	dashboardAPI := e.Group("/api/dashboard")
 	dashboardAPI.Use(h.SessionAuth)
 	dashboardAPI.GET("/status", h.HandleDashboardAPI)
+	dashboardAPI.GET("/metrics", h.HandleDashboardMetrics) // ?window=15m|1h|6h|24h
+	dashboardAPI.GET("/poll", h.HandleDashboardPoll)       // ?cursor=&window=&timeout= (long poll for networks without WS)
 	// WebSocket stream: auth is performed inside handler with non-extending lookup
 	e.GET("/api/dashboard/stream", h.HandleDashboardWS)
 
 	// Agents WS stream (canonical path under /ws)
 	e.GET("/ws/agents", h.HandleAgentsWS)
 
+	// Agent federation between backends: peers authenticate with the shared
+	// federation token instead of a session
+	federation := e.Group("/federation")
+	federation.Use(h.FederationAuth)
+	federation.GET("/events", h.FederationEvents)                       // WebSocket of this backend's agent events
+	federation.POST("/agents/:name/beliefs", h.FederationSetBelief)     // {"key", "value", "ttl", "priority", "confidence"}
+	federation.GET("/agents/:name/beliefs/:key", h.FederationGetBelief) // -> {"value"}
+	federation.POST("/agents/:name/publish", h.FederationPublish)
+
 	// Debug API routes
 	debug := api.Group("/debug")
 	debug.POST("/breakpoint", h.DebugBreakpoint)
@@ -1,8 +1,11 @@
 package logs
 
 import (
+	"os"
+
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 type Logger interface {
@@ -18,13 +21,34 @@ type ZapLogger struct {
 
 func NewZapLogger() *ZapLogger {
 	// Write logs to stderr to avoid interfering with stdio protocols (e.g., MCP)
+	return NewZapLoggerTo("stderr")
+}
+
+// NewZapLoggerTo returns a JSON logger writing to the given zap output path
+// ("stdout", "stderr" or a file path).
+func NewZapLoggerTo(output string) *ZapLogger {
 	cfg := zap.NewProductionConfig()
-	cfg.OutputPaths = []string{"stderr"}
+	cfg.OutputPaths = []string{output}
 	cfg.ErrorOutputPaths = []string{"stderr"}
 	logger, _ := cfg.Build()
 	return &ZapLogger{logger: logger}
 }
 
+// NewZapLoggerWithFile returns a JSON logger writing to stderr and to file,
+// each entry tagged with component so entries of several services can be
+// told apart. File entries carry RFC 3339 times; see ReadEntries.
+func NewZapLoggerWithFile(file *RotatingFile, component string) *ZapLogger {
+	cfg := zap.NewProductionConfig()
+	fileEncoding := cfg.EncoderConfig
+	fileEncoding.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	core := zapcore.NewTee(
+		zapcore.NewCore(zapcore.NewJSONEncoder(cfg.EncoderConfig), zapcore.Lock(os.Stderr), cfg.Level),
+		zapcore.NewCore(zapcore.NewJSONEncoder(fileEncoding), file, cfg.Level),
+	)
+	logger := zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel), zap.ErrorOutput(zapcore.Lock(os.Stderr)))
+	return &ZapLogger{logger: logger.With(zap.String("component", component))}
+}
+
 func (l *ZapLogger) Get() *zap.Logger {
 	return l.logger
 }
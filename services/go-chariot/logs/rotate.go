@@ -0,0 +1,217 @@
+package logs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotatingFile is a log file that is renamed to path.1 once it reaches its
+// size limit, path.1 to path.2 and so on; the oldest beyond keep is removed.
+type RotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	keep     int
+	file     *os.File
+	size     int64
+}
+
+// NewRotatingFile opens path for appending, creating its directory. A
+// maxBytes <= 0 never rotates; keep is the number of rotated files kept.
+func NewRotatingFile(path string, maxBytes int64, keep int) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	r := &RotatingFile{path: path, maxBytes: maxBytes, keep: keep}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first when p would take the file over its limit.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxBytes > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	if r.keep > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", r.path, r.keep))
+		for i := r.keep - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// Sync flushes the file to disk.
+func (r *RotatingFile) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Sync()
+}
+
+// Close closes the file.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// Entry is a structured log line as written by a file logger.
+type Entry struct {
+	Time      time.Time              `json:"time"`
+	Level     string                 `json:"level"`
+	Component string                 `json:"component,omitempty"`
+	Message   string                 `json:"message"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Query selects log entries; zero fields do not filter.
+type Query struct {
+	Since     time.Time
+	Level     string // Least severe level: debug, info, warn or error
+	Component string
+	Contains  string // Substring of the message, ignoring case
+	Limit     int    // Most recent entries returned
+}
+
+var levelRank = map[string]int{"debug": 0, "info": 1, "warn": 2, "error": 3, "dpanic": 4, "panic": 5, "fatal": 6}
+
+// ReadEntries returns the entries of the log file at path and its rotated
+// files matching q, oldest first. Lines that are not JSON log entries are
+// skipped.
+func ReadEntries(path string, q Query) ([]Entry, error) {
+	if q.Level != "" {
+		if _, ok := levelRank[strings.ToLower(q.Level)]; !ok {
+			return nil, fmt.Errorf("unknown log level '%s'", q.Level)
+		}
+	}
+	rotated, _ := filepath.Glob(path + ".*")
+	sort.Slice(rotated, func(i, j int) bool { return rotatedIndex(rotated[i], path) > rotatedIndex(rotated[j], path) })
+	var out []Entry
+	for _, file := range append(rotated, path) {
+		if rotatedIndex(file, path) < 0 {
+			continue
+		}
+		entries, err := readFile(file, q)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		out = append(out, entries...)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out, nil
+}
+
+// rotatedIndex returns n for path.n, 0 for path itself and -1 otherwise.
+func rotatedIndex(file, path string) int {
+	if file == path {
+		return 0
+	}
+	n := 0
+	if _, err := fmt.Sscanf(strings.TrimPrefix(file, path+"."), "%d", &n); err != nil || fmt.Sprintf("%s.%d", path, n) != file {
+		return -1
+	}
+	return n
+}
+
+func readFile(file string, q Query) ([]Entry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	min := levelRank[strings.ToLower(q.Level)]
+	contains := strings.ToLower(q.Contains)
+	var out []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry, ok := parseEntry(scanner.Bytes())
+		if !ok || entry.Time.Before(q.Since) || levelRank[entry.Level] < min ||
+			(q.Component != "" && entry.Component != q.Component) ||
+			(contains != "" && !strings.Contains(strings.ToLower(entry.Message), contains)) {
+			continue
+		}
+		out = append(out, entry)
+	}
+	return out, scanner.Err()
+}
+
+// parseEntry reads a JSON log line with ts, level, component and msg keys;
+// the other keys become the entry's fields.
+func parseEntry(line []byte) (Entry, bool) {
+	var raw map[string]interface{}
+	if json.Unmarshal(line, &raw) != nil {
+		return Entry{}, false
+	}
+	var entry Entry
+	switch ts := raw["ts"].(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return Entry{}, false
+		}
+		entry.Time = t
+	case float64:
+		entry.Time = time.Unix(0, int64(ts*float64(time.Second)))
+	default:
+		return Entry{}, false
+	}
+	entry.Level, _ = raw["level"].(string)
+	entry.Level = strings.ToLower(entry.Level)
+	entry.Component, _ = raw["component"].(string)
+	entry.Message, _ = raw["msg"].(string)
+	for _, key := range []string{"ts", "level", "component", "msg"} {
+		delete(raw, key)
+	}
+	if len(raw) > 0 {
+		entry.Fields = raw
+	}
+	return entry, true
+}
@@ -2,11 +2,11 @@ package mcp
 
 import (
 	"context"
-	"errors"
 
 	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
 
 	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/codegen"
 	"github.com/labstack/echo/v4"
 )
 
@@ -42,15 +42,21 @@ func newServer() *sdkmcp.Server {
 		return &sdkmcp.CallToolResult{Content: []sdkmcp.Content{&sdkmcp.TextContent{Text: chariot.ValueToString(resultVal)}}}, execOutput{}, nil
 	})
 
-	// Placeholder for code->diagram (to be implemented)
+	// Convert Chariot code to a Visual DSL diagram
 	type c2dInput struct {
 		Code string `json:"code"`
+		Name string `json:"name,omitempty"`
 	}
 	type c2dOutput struct {
-		Diagram map[string]any `json:"diagram"`
+		Diagram *codegen.Diagram       `json:"diagram"`
+		Report  *codegen.ReverseReport `json:"report"`
 	}
-	sdkmcp.AddTool(server, &sdkmcp.Tool{Name: "codeToDiagram", Description: "Convert Chariot code to Visual DSL diagram (WIP)"}, func(ctx context.Context, req *sdkmcp.CallToolRequest, in c2dInput) (*sdkmcp.CallToolResult, c2dOutput, error) {
-		return nil, c2dOutput{}, errors.New("codeToDiagram not implemented")
+	sdkmcp.AddTool(server, &sdkmcp.Tool{Name: "codeToDiagram", Description: "Convert Chariot code to a Visual DSL diagram, reporting statements with no block equivalent"}, func(ctx context.Context, req *sdkmcp.CallToolRequest, in c2dInput) (*sdkmcp.CallToolResult, c2dOutput, error) {
+		diagram, report, err := codegen.FromCode(in.Code, in.Name)
+		if err != nil {
+			return &sdkmcp.CallToolResult{IsError: true, Content: []sdkmcp.Content{&sdkmcp.TextContent{Text: err.Error()}}}, c2dOutput{}, nil
+		}
+		return nil, c2dOutput{Diagram: diagram, Report: report}, nil
 	})
 
 	return server
@@ -0,0 +1,144 @@
+// Package pubsub carries events between backend replicas so a client
+// connected to one replica can follow work happening on another: execution
+// logs, agent events and replica status for the dashboard.
+//
+// The local bus delivers within the process and is the default. The redis bus
+// keeps each topic in a Redis stream so every replica sees every event, and a
+// replica that reconnects reads what it missed while it was away.
+//
+// Delivery to subscribers is best effort: a subscriber that falls behind
+// misses messages rather than slowing the publisher, matching the in-process
+// event sinks.
+package pubsub
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+// subscriberBuffer is the number of messages queued per subscriber before
+// messages are dropped.
+const subscriberBuffer = 256
+
+// Bus publishes messages to topics and fans them out to subscribers.
+type Bus interface {
+	Publish(topic string, msg []byte) error
+	// Subscribe returns a channel receiving the topic's messages and a
+	// function that ends the subscription and closes the channel.
+	Subscribe(topic string) (<-chan []byte, func())
+	// Shared reports whether messages reach other processes.
+	Shared() bool
+	Close() error
+}
+
+// Open returns the bus selected by the pubsub setting: "local" (the default)
+// or "redis", which connects to redis_url.
+func Open(c *cfg.Config) (Bus, error) {
+	switch strings.ToLower(c.PubSub) {
+	case "", "local":
+		return NewLocal(), nil
+	case "redis":
+		return OpenRedis(c.RedisURL)
+	default:
+		return nil, fmt.Errorf("unknown pubsub %q (want local or redis)", c.PubSub)
+	}
+}
+
+// fanout tracks the subscribers of each topic.
+type fanout struct {
+	mu   sync.RWMutex
+	subs map[string]map[chan []byte]struct{}
+}
+
+// add registers a subscriber and reports whether it is the topic's first.
+func (f *fanout) add(topic string) (chan []byte, bool) {
+	ch := make(chan []byte, subscriberBuffer)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subs == nil {
+		f.subs = map[string]map[chan []byte]struct{}{}
+	}
+	first := len(f.subs[topic]) == 0
+	if first {
+		f.subs[topic] = map[chan []byte]struct{}{}
+	}
+	f.subs[topic][ch] = struct{}{}
+	return ch, first
+}
+
+// remove unregisters a subscriber and reports whether the topic has none left.
+func (f *fanout) remove(topic string, ch chan []byte) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	set, ok := f.subs[topic]
+	if !ok {
+		return false
+	}
+	if _, ok := set[ch]; !ok {
+		return false
+	}
+	delete(set, ch)
+	close(ch)
+	if len(set) == 0 {
+		delete(f.subs, topic)
+		return true
+	}
+	return false
+}
+
+func (f *fanout) deliver(topic string, msg []byte) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for ch := range f.subs[topic] {
+		select {
+		case ch <- msg:
+		default: /* drop on slow consumer */
+		}
+	}
+}
+
+func (f *fanout) has(topic string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.subs[topic]) > 0
+}
+
+func (f *fanout) closeAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for topic, set := range f.subs {
+		for ch := range set {
+			close(ch)
+		}
+		delete(f.subs, topic)
+	}
+}
+
+// Local is an in-process Bus.
+type Local struct {
+	subs fanout
+}
+
+// NewLocal returns an in-process bus.
+func NewLocal() *Local { return &Local{} }
+
+func (b *Local) Publish(topic string, msg []byte) error {
+	b.subs.deliver(topic, append([]byte(nil), msg...))
+	return nil
+}
+
+func (b *Local) Subscribe(topic string) (<-chan []byte, func()) {
+	ch, _ := b.subs.add(topic)
+	var once sync.Once
+	return ch, func() { once.Do(func() { b.subs.remove(topic, ch) }) }
+}
+
+func (b *Local) Shared() bool { return false }
+
+func (b *Local) Close() error {
+	b.subs.closeAll()
+	return nil
+}
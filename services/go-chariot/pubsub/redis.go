@@ -0,0 +1,428 @@
+package pubsub
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"go.uber.org/zap"
+)
+
+const (
+	redisDialTimeout = 5 * time.Second
+	redisIOTimeout   = 5 * time.Second
+	redisMaxBackoff  = 5 * time.Second
+)
+
+// Each topic is a stream keyed streamKeyPrefix plus the topic, trimmed to
+// about streamMaxLen entries and deleted once nothing has been published to
+// it for streamTTL. A read waits at most streamBlock for new entries, which
+// is also how long a newly subscribed topic may wait to be read.
+const (
+	streamKeyPrefix = "chariot::bus::"
+	streamMaxLen    = 10000
+	streamTTL       = time.Hour
+	streamBlock     = time.Second
+	streamReadCount = 256
+)
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// Redis is a Bus over Redis streams. Publishing appends to the topic's
+// stream; one connection reads the streams of every topic subscribed to
+// locally, each from the last entry it delivered. A replica that loses its
+// connection therefore receives what was published meanwhile once it has
+// reconnected, unless the stream was trimmed past it.
+type Redis struct {
+	addr     string
+	user     string
+	password string
+	subs     fanout
+
+	pubMu    sync.Mutex
+	pub      *respConn
+	pubRetry time.Time // after a failed dial, commands fail fast until then
+
+	cursorMu sync.Mutex
+	cursors  map[string]string // ID of the last entry read, by subscribed topic
+	wake     chan struct{}     // tells an idle reader a topic was subscribed
+
+	subMu sync.Mutex // guards sub
+	sub   *respConn
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// OpenRedis connects to a redis://[user:password@]host:port URL. The server
+// must be reachable at startup; later outages are retried.
+func OpenRedis(rawURL string) (*Redis, error) {
+	if rawURL == "" {
+		return nil, errors.New("redis pubsub requires redis_url")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("invalid redis_url %q (want redis://[user:password@]host:port)", rawURL)
+	}
+	r := &Redis{addr: u.Host, cursors: map[string]string{}, wake: make(chan struct{}, 1), closed: make(chan struct{})}
+	if u.Port() == "" {
+		r.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.user = u.User.Username()
+		r.password, _ = u.User.Password()
+		if r.password == "" {
+			// redis://secret@host is a password without a user
+			r.password, r.user = r.user, ""
+		}
+	}
+	if r.pub, err = r.dial(); err != nil {
+		return nil, fmt.Errorf("redis pubsub: %w", err)
+	}
+	go r.run()
+	return r, nil
+}
+
+func (r *Redis) Publish(topic string, msg []byte) error {
+	key := streamKeyPrefix + topic
+	_, err := r.do(
+		[]string{"XADD", key, "MAXLEN", "~", strconv.Itoa(streamMaxLen), "*", "msg", string(msg)},
+		[]string{"PEXPIRE", key, strconv.FormatInt(streamTTL.Milliseconds(), 10)},
+	)
+	return err
+}
+
+func (r *Redis) Subscribe(topic string) (<-chan []byte, func()) {
+	ch, first := r.subs.add(topic)
+	if first {
+		// Entries published from now on are delivered
+		start := r.lastID(topic)
+		r.cursorMu.Lock()
+		if _, ok := r.cursors[topic]; !ok {
+			r.cursors[topic] = start
+		}
+		r.cursorMu.Unlock()
+		select {
+		case r.wake <- struct{}{}:
+		default:
+		}
+	}
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			if !r.subs.remove(topic, ch) {
+				return
+			}
+			r.cursorMu.Lock()
+			defer r.cursorMu.Unlock()
+			// A new subscriber may have arrived in the meantime
+			if !r.subs.has(topic) {
+				delete(r.cursors, topic)
+			}
+		})
+	}
+}
+
+// do sends cmds in one round trip on the publishing connection and returns
+// their replies, dialling again once if the connection has gone away.
+func (r *Redis) do(cmds ...[]string) ([]interface{}, error) {
+	r.pubMu.Lock()
+	defer r.pubMu.Unlock()
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if r.pub == nil {
+			if time.Now().Before(r.pubRetry) {
+				return nil, errors.New("redis: server unavailable")
+			}
+			if r.pub, err = r.dial(); err != nil {
+				r.pubRetry = time.Now().Add(time.Second)
+				return nil, err
+			}
+		}
+		r.pub.SetDeadline(time.Now().Add(redisIOTimeout))
+		var replies []interface{}
+		replies, err = r.pub.pipeline(cmds)
+		var replyErr redisError
+		if err == nil || errors.As(err, &replyErr) {
+			return replies, err
+		}
+		r.pub.Close()
+		r.pub = nil
+	}
+	return nil, err
+}
+
+// lastID returns the ID of the newest entry of topic's stream, "0-0" when
+// it has none. When the server cannot be reached the current time stands in.
+func (r *Redis) lastID(topic string) string {
+	replies, err := r.do([]string{"XREVRANGE", streamKeyPrefix + topic, "+", "-", "COUNT", "1"})
+	if err == nil {
+		entries, _ := replies[0].([]interface{})
+		if len(entries) == 0 {
+			return "0-0"
+		}
+		if entry, ok := entries[0].([]interface{}); ok && len(entry) > 0 {
+			if id, ok := entry[0].([]byte); ok {
+				return string(id)
+			}
+		}
+	}
+	return strconv.FormatInt(time.Now().UnixMilli(), 10) + "-0"
+}
+
+// readFrom lists the subscribed topics with the ID to read each after.
+func (r *Redis) readFrom() (topics, ids []string) {
+	r.cursorMu.Lock()
+	defer r.cursorMu.Unlock()
+	for topic, id := range r.cursors {
+		topics = append(topics, topic)
+		ids = append(ids, id)
+	}
+	return topics, ids
+}
+
+// advance records that topic was read up to id, unless it was unsubscribed.
+func (r *Redis) advance(topic, id string) {
+	r.cursorMu.Lock()
+	if _, ok := r.cursors[topic]; ok {
+		r.cursors[topic] = id
+	}
+	r.cursorMu.Unlock()
+}
+
+func (r *Redis) Shared() bool { return true }
+
+func (r *Redis) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+		r.subMu.Lock()
+		if r.sub != nil {
+			r.sub.Close()
+		}
+		r.subMu.Unlock()
+		r.pubMu.Lock()
+		if r.pub != nil {
+			r.pub.Close()
+			r.pub = nil
+		}
+		r.pubMu.Unlock()
+		r.subs.closeAll()
+	})
+	return nil
+}
+
+func (r *Redis) isClosed() bool {
+	select {
+	case <-r.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// run maintains the reading connection until Close.
+func (r *Redis) run() {
+	backoff := 100 * time.Millisecond
+	for !r.isClosed() {
+		conn, err := r.dial()
+		if err == nil {
+			r.subMu.Lock()
+			r.sub = conn
+			r.subMu.Unlock()
+			backoff = 100 * time.Millisecond
+			err = r.readLoop(conn)
+			r.subMu.Lock()
+			r.sub = nil
+			r.subMu.Unlock()
+			conn.Close()
+		}
+		if r.isClosed() {
+			return
+		}
+		cfg.ChariotLogger.Warn("Redis pubsub reader disconnected; reconnecting",
+			zap.String("addr", r.addr), zap.Duration("backoff", backoff), zap.Error(err))
+		select {
+		case <-time.After(backoff):
+		case <-r.closed:
+			return
+		}
+		if backoff *= 2; backoff > redisMaxBackoff {
+			backoff = redisMaxBackoff
+		}
+	}
+}
+
+// readLoop reads the subscribed streams until the connection fails, each
+// read resuming after the last entry delivered.
+func (r *Redis) readLoop(conn *respConn) error {
+	for !r.isClosed() {
+		topics, ids := r.readFrom()
+		if len(topics) == 0 {
+			select {
+			case <-r.wake:
+			case <-r.closed:
+			}
+			continue
+		}
+		args := []string{"XREAD", "COUNT", strconv.Itoa(streamReadCount), "BLOCK", strconv.FormatInt(streamBlock.Milliseconds(), 10), "STREAMS"}
+		for _, topic := range topics {
+			args = append(args, streamKeyPrefix+topic)
+		}
+		args = append(args, ids...)
+		conn.SetDeadline(time.Now().Add(streamBlock + redisIOTimeout))
+		if err := conn.send(args...); err != nil {
+			return err
+		}
+		v, err := conn.reply()
+		if err != nil {
+			return err
+		}
+		// [[key, [[id, [field, value, ...]], ...]], ...], or nil when nothing came
+		streams, _ := v.([]interface{})
+		for _, s := range streams {
+			stream, _ := s.([]interface{})
+			if len(stream) < 2 {
+				continue
+			}
+			key, _ := stream[0].([]byte)
+			topic := strings.TrimPrefix(string(key), streamKeyPrefix)
+			entries, _ := stream[1].([]interface{})
+			for _, e := range entries {
+				entry, _ := e.([]interface{})
+				if len(entry) < 2 {
+					continue
+				}
+				id, _ := entry[0].([]byte)
+				fields, _ := entry[1].([]interface{})
+				for i := 0; i+1 < len(fields); i += 2 {
+					if name, _ := fields[i].([]byte); string(name) == "msg" {
+						payload, _ := fields[i+1].([]byte)
+						r.subs.deliver(topic, payload)
+					}
+				}
+				r.advance(topic, string(id))
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Redis) dial() (*respConn, error) {
+	nc, err := net.DialTimeout("tcp", r.addr, redisDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &respConn{Conn: nc, r: bufio.NewReader(nc)}
+	if r.password != "" {
+		args := []string{"AUTH", r.password}
+		if r.user != "" {
+			args = []string{"AUTH", r.user, r.password}
+		}
+		conn.SetDeadline(time.Now().Add(redisIOTimeout))
+		if err = conn.send(args...); err == nil {
+			_, err = conn.reply()
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn.SetDeadline(time.Time{})
+	}
+	return conn, nil
+}
+
+// respConn speaks the Redis serialization protocol (RESP2).
+type respConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *respConn) send(args ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(c.Conn, b.String())
+	return err
+}
+
+// pipeline sends cmds and reads their replies. A command failing does not
+// stop the others; the first error reply is returned after all are read.
+func (c *respConn) pipeline(cmds [][]string) ([]interface{}, error) {
+	for _, cmd := range cmds {
+		if err := c.send(cmd...); err != nil {
+			return nil, err
+		}
+	}
+	replies := make([]interface{}, len(cmds))
+	var firstErr error
+	for i := range cmds {
+		v, err := c.reply()
+		var replyErr redisError
+		if err != nil && !errors.As(err, &replyErr) {
+			return nil, err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		replies[i] = v
+	}
+	return replies, firstErr
+}
+
+// reply reads one reply: a string, int64, []byte, []interface{}, nil or a
+// redisError.
+func (c *respConn) reply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.reply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,72 @@
+package sdk_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/sdk"
+)
+
+func Example() {
+	in, err := sdk.New()
+	if err != nil {
+		panic(err)
+	}
+	policy := sdk.MustCompile("approve.ch", `and(bigger(score, 600), smaller(amount, 10000))`)
+
+	for _, app := range []map[string]interface{}{
+		{"score": 720, "amount": 5000},
+		{"score": 580, "amount": 5000},
+	} {
+		approved, err := in.Run(context.Background(), policy, app)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(approved)
+	}
+	// Output:
+	// true
+	// false
+}
+
+func ExampleInterpreter_RegisterBuiltin() {
+	in, _ := sdk.New()
+	in.RegisterBuiltin("shout", func(args ...interface{}) (interface{}, error) {
+		return strings.ToUpper(fmt.Sprint(args...)) + "!", nil
+	})
+	out, _ := in.Eval(context.Background(), `shout('hello')`, nil)
+	fmt.Println(out)
+	// Output: HELLO!
+}
+
+func ExampleInterpreter_Run_timeout() {
+	in, _ := sdk.New()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := in.Eval(ctx, `while(true) { setq(x, 1) }`, nil)
+	fmt.Println(err)
+	// Output: context deadline exceeded
+}
+
+func ExampleWithEmitter() {
+	in, _ := sdk.New(sdk.WithEmitter(func(v interface{}) {
+		fmt.Println("partial:", v)
+	}))
+	out, _ := in.Eval(context.Background(), `
+setq(total, 0)
+setq(i, 1)
+while(smaller(i, 4)) {
+	setq(total, add(total, i))
+	emit(total)
+	setq(i, add(i, 1))
+}
+total`, nil)
+	fmt.Println("final:", out)
+	// Output:
+	// partial: 1
+	// partial: 3
+	// partial: 6
+	// final: 6
+}
@@ -0,0 +1,301 @@
+// Package sdk embeds the Chariot interpreter in Go programs, so a service can
+// evaluate Chariot scripts and policies in-process instead of calling a
+// go-chariot server over HTTP.
+//
+// Compile a script once and run it as often as needed:
+//
+//	prog, err := sdk.Compile("discount.ch", `if(bigger(total, 100)) { 0.1 } else { 0 }`)
+//	...
+//	in, err := sdk.New()
+//	...
+//	rate, err := in.Run(ctx, prog, map[string]interface{}{"total": 250})
+//
+// Values cross the boundary as plain Go values: numbers are float64, strings,
+// bools, []interface{} and map[string]interface{}. See ToValue and FromValue.
+//
+// The API of this package is kept stable; the chariot package it wraps is the
+// interpreter's implementation and may change between releases.
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+// Program is a parsed script. Running a Program does not modify it, so it
+// can be compiled once and run by many interpreters.
+type Program struct {
+	name string
+	ast  *chariot.Block
+}
+
+// Name returns the file name the program was compiled with.
+func (p *Program) Name() string { return p.name }
+
+// Parse checks the syntax of src without keeping the result. The error, if
+// any, is an *Error.
+func Parse(name, src string) error {
+	_, err := Compile(name, src)
+	return err
+}
+
+// Compile parses src into a Program. The name is used in error positions
+// and stack traces.
+func Compile(name, src string) (*Program, error) {
+	ast, err := chariot.ParseSource(src, name)
+	if err != nil {
+		e := newError(err)
+		if e.File == "" {
+			e.File = name
+		}
+		return nil, e
+	}
+	return &Program{name: name, ast: ast}, nil
+}
+
+// MustCompile is like Compile but panics on a syntax error. It is meant for
+// scripts embedded in the program itself.
+func MustCompile(name, src string) *Program {
+	p, err := Compile(name, src)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Error is a script error with its source position and Chariot stack trace.
+type Error struct {
+	Message string
+	File    string
+	Line    int
+	Column  int
+	Stack   []chariot.CallFrame
+	err     error
+}
+
+func newError(err error) *Error {
+	info := chariot.DescribeError(err)
+	return &Error{
+		Message: info.Message,
+		File:    info.File,
+		Line:    info.Line,
+		Column:  info.Column,
+		Stack:   info.Stack,
+		err:     err,
+	}
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.File != "" && e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	case e.File != "":
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	}
+	return e.Message
+}
+
+// Unwrap returns the interpreter's error.
+func (e *Error) Unwrap() error { return e.err }
+
+// Builtin is a Go function callable from scripts. Arguments and the result
+// are converted with FromValue and ToValue.
+type Builtin func(args ...interface{}) (interface{}, error)
+
+// Option configures an Interpreter.
+type Option func(*Interpreter) error
+
+// WithFunctionLibrary loads user-defined functions from a function library
+// file (the JSON format of the server's function_lib).
+func WithFunctionLibrary(path string) Option {
+	return func(in *Interpreter) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		funcs, err := chariot.LoadFunctionsFromJSON(data)
+		if err != nil {
+			return fmt.Errorf("function library %s: %w", path, err)
+		}
+		for name, fn := range funcs {
+			in.rt.RegisterFunction(name, fn)
+		}
+		return nil
+	}
+}
+
+// WithMaxCallDepth limits nested user-defined function calls.
+func WithMaxCallDepth(depth int) Option {
+	return func(in *Interpreter) error {
+		in.rt.SetMaxCallDepth(depth)
+		return nil
+	}
+}
+
+// WithLogger receives the entries scripts write with logPrint.
+func WithLogger(fn func(level, message string)) Option {
+	return func(in *Interpreter) error {
+		in.host().log = fn
+		return nil
+	}
+}
+
+// WithEmitter receives the partial results scripts send with emit, as
+// plain Go values, while the run goes on. Without it emit drops them.
+func WithEmitter(fn func(value interface{})) Option {
+	return func(in *Interpreter) error {
+		in.host().emit = fn
+		return nil
+	}
+}
+
+// hostWriter passes the entries a script writes to the WithLogger and
+// WithEmitter functions.
+type hostWriter struct {
+	log  func(level, message string)
+	emit func(value interface{})
+}
+
+func (w *hostWriter) Append(entry chariot.LogEntry) {
+	if entry.Level != chariot.LogResult {
+		if w.log != nil {
+			w.log(entry.Level, entry.Message)
+		}
+		return
+	}
+	var v interface{}
+	if w.emit != nil && json.Unmarshal(entry.Value, &v) == nil {
+		w.emit(v)
+	}
+}
+
+// host returns the interpreter's hostWriter, setting it up on first use.
+func (in *Interpreter) host() *hostWriter {
+	if in.writer == nil {
+		in.writer = &hostWriter{}
+		in.rt.SetLogWriter(in.writer)
+	}
+	return in.writer
+}
+
+// Interpreter is a Chariot runtime with all builtins registered. Global
+// variables and functions defined by one run are visible to the next. An
+// Interpreter is safe for concurrent use; runs are serialized.
+type Interpreter struct {
+	mu     sync.Mutex
+	rt     *chariot.Runtime
+	writer *hostWriter
+}
+
+// New returns an interpreter with the standard builtins.
+func New(opts ...Option) (*Interpreter, error) {
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	in := &Interpreter{rt: rt}
+	for _, opt := range opts {
+		if err := opt(in); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+// RegisterBuiltin makes fn callable from scripts as name, replacing any
+// builtin of that name.
+func (in *Interpreter) RegisterBuiltin(name string, fn Builtin) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.rt.Register(name, func(args ...chariot.Value) (chariot.Value, error) {
+		native := make([]interface{}, len(args))
+		for i, arg := range args {
+			native[i] = FromValue(arg)
+		}
+		out, err := fn(native...)
+		if err != nil {
+			return nil, err
+		}
+		return ToValue(out)
+	})
+}
+
+// SetGlobal sets a global variable visible to every run.
+func (in *Interpreter) SetGlobal(name string, value interface{}) error {
+	v, err := ToValue(value)
+	if err != nil {
+		return fmt.Errorf("global %s: %w", name, err)
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.rt.SetGlobalVariable(name, v)
+	return nil
+}
+
+// Global returns the value of a global variable.
+func (in *Interpreter) Global(name string) (interface{}, bool) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	v, ok := in.rt.GlobalScope().Get(name)
+	if !ok {
+		return nil, false
+	}
+	return FromValue(v), true
+}
+
+// Run executes p and returns the value of its last statement. vars are set
+// as variables of this run only. When ctx is cancelled or its deadline
+// passes, the script stops before its next statement and Run returns
+// ctx.Err(); a builtin that is already running is allowed to finish first.
+// Script failures are returned as *Error.
+func (in *Interpreter) Run(ctx context.Context, p *Program, vars map[string]interface{}) (interface{}, error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	val, err := in.exec(ctx, p, vars)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		// The run may stop at ctx's deadline just before ctx is done
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, context.DeadlineExceeded
+		}
+		return nil, newError(err)
+	}
+	return FromValue(val), nil
+}
+
+func (in *Interpreter) exec(ctx context.Context, p *Program, vars map[string]interface{}) (val chariot.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	locals := make(map[string]chariot.Value, len(vars))
+	for name, value := range vars {
+		v, err := ToValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %w", name, err)
+		}
+		locals[name] = v
+	}
+	return in.rt.ExecContext(ctx, p.ast, locals)
+}
+
+// Eval compiles and runs src in one step.
+func (in *Interpreter) Eval(ctx context.Context, src string, vars map[string]interface{}) (interface{}, error) {
+	p, err := Compile("eval.ch", src)
+	if err != nil {
+		return nil, err
+	}
+	return in.Run(ctx, p, vars)
+}
+
+// Runtime returns the underlying chariot runtime for features this package
+// does not wrap. It must not be used while a Run is in progress.
+func (in *Interpreter) Runtime() *chariot.Runtime { return in.rt }
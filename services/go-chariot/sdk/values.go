@@ -0,0 +1,118 @@
+package sdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+// ToValue converts a Go value to a Chariot value. Numbers become Chariot
+// numbers, strings and bools keep their type, slices become arrays and
+// string-keyed maps become maps. Structs and other types are converted
+// through their JSON encoding. Chariot values are returned unchanged.
+func ToValue(v interface{}) (chariot.Value, error) {
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case chariot.Number, chariot.Str, chariot.Bool, *chariot.ArrayValue, *chariot.MapValue,
+		*chariot.FunctionValue, chariot.TreeNode:
+		return x, nil
+	case string:
+		return chariot.Str(x), nil
+	case bool:
+		return chariot.Bool(x), nil
+	case []interface{}:
+		arr := chariot.NewArray()
+		for i, item := range x {
+			iv, err := ToValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			arr.Append(iv)
+		}
+		return arr, nil
+	case map[string]interface{}:
+		m := chariot.NewMap()
+		for k, item := range x {
+			iv, err := ToValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			m.Set(k, iv)
+		}
+		return m, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return chariot.Number(float64(rv.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return chariot.Number(float64(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return chariot.Number(rv.Float()), nil
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return nil, fmt.Errorf("cannot convert %T to a Chariot value", v)
+	}
+
+	// Structs, typed slices and maps: go through JSON so field tags apply
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert %T to a Chariot value: %w", v, err)
+	}
+	var native interface{}
+	if err := json.Unmarshal(data, &native); err != nil {
+		return nil, err
+	}
+	return chariot.JSONToValue(native)
+}
+
+// FromValue converts a Chariot value to a plain Go value: float64, string,
+// bool, []interface{}, map[string]interface{} or nil. JSON and map nodes
+// become their contents and other tree nodes become a map of their
+// attributes and children. Values with no plain form, such as functions and
+// host objects, are returned unchanged.
+func FromValue(v chariot.Value) interface{} {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case chariot.ScopeEntry:
+		return FromValue(x.Value)
+	case chariot.Number:
+		return float64(x)
+	case chariot.Str:
+		return string(x)
+	case chariot.Bool:
+		return bool(x)
+	case *chariot.ArrayValue:
+		out := make([]interface{}, len(x.Elements))
+		for i, item := range x.Elements {
+			out[i] = FromValue(item)
+		}
+		return out
+	case *chariot.MapValue:
+		out := make(map[string]interface{}, len(x.Values))
+		for k, item := range x.Values {
+			out[k] = FromValue(item)
+		}
+		return out
+	case *chariot.JSONNode:
+		return x.GetJSONValue()
+	case *chariot.MapNode:
+		return x.ToMap()
+	case *chariot.FunctionValue:
+		return x
+	case chariot.TreeNode:
+		out := make(map[string]interface{})
+		for k, item := range x.GetAttributes() {
+			out[k] = FromValue(item)
+		}
+		for _, child := range x.GetChildren() {
+			out[child.Name()] = FromValue(child)
+		}
+		return out
+	}
+	return v
+}
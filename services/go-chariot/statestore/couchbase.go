@@ -0,0 +1,190 @@
+package statestore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/couchbase"
+	"github.com/couchbase/gocb/v2"
+)
+
+// keyPrefix namespaces state documents within the bucket.
+const keyPrefix = "chariot::state::"
+
+// appendRetries bounds the optimistic-locking loop in Couchbase.Append.
+const appendRetries = 16
+
+// CouchbaseOptions locates the bucket used for shared state. State documents
+// are written to the _default collection of Scope (or of the default scope).
+type CouchbaseOptions struct {
+	URL      string
+	User     string
+	Password string
+	Bucket   string
+	Scope    string
+}
+
+// Couchbase is a Store backed by Couchbase key-value operations. Values are
+// stored as raw binary documents; lists as JSON documents updated with CAS.
+type Couchbase struct {
+	cluster    *gocb.Cluster
+	collection *gocb.Collection
+	raw        gocb.Transcoder
+}
+
+// OpenCouchbase connects to the cluster and waits for the bucket to be ready.
+func OpenCouchbase(opts CouchbaseOptions) (*Couchbase, error) {
+	if opts.URL == "" || opts.Bucket == "" {
+		return nil, errors.New("couchbase state store requires couchbase_url and couchbase_bucket")
+	}
+	cluster, collection, err := couchbase.Open(couchbase.Options{
+		URL:       opts.URL,
+		User:      opts.User,
+		Password:  opts.Password,
+		Bucket:    opts.Bucket,
+		Scope:     opts.Scope,
+		KVTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couchbase state store: %w", err)
+	}
+	return &Couchbase{cluster: cluster, collection: collection, raw: gocb.NewRawBinaryTranscoder()}, nil
+}
+
+func (s *Couchbase) Put(key string, value []byte, ttl time.Duration) error {
+	_, err := s.collection.Upsert(keyPrefix+key, value, &gocb.UpsertOptions{Expiry: ttl, Transcoder: s.raw})
+	return err
+}
+
+func (s *Couchbase) Get(key string) ([]byte, error) {
+	res, err := s.collection.Get(keyPrefix+key, &gocb.GetOptions{Transcoder: s.raw})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var value []byte
+	if err := res.Content(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (s *Couchbase) Delete(key string) error {
+	_, err := s.collection.Remove(keyPrefix+key, nil)
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Append reads the list document, appends and writes it back with the CAS it
+// was read at, retrying when another writer got there first.
+func (s *Couchbase) Append(key string, entry []byte, max int, ttl time.Duration) (int, error) {
+	id := keyPrefix + key
+	for attempt := 0; attempt < appendRetries; attempt++ {
+		var l list
+		res, err := s.collection.Get(id, nil)
+		switch {
+		case errors.Is(err, gocb.ErrDocumentNotFound):
+			seq := l.append(entry, max)
+			_, err = s.collection.Insert(id, l, &gocb.InsertOptions{Expiry: ttl})
+			if errors.Is(err, gocb.ErrDocumentExists) {
+				continue
+			}
+			return seq, err
+		case err != nil:
+			return 0, err
+		}
+		if err := res.Content(&l); err != nil {
+			return 0, err
+		}
+		seq := l.append(entry, max)
+		_, err = s.collection.Replace(id, l, &gocb.ReplaceOptions{Cas: res.Cas(), Expiry: ttl})
+		if errors.Is(err, gocb.ErrCasMismatch) {
+			continue
+		}
+		return seq, err
+	}
+	return 0, fmt.Errorf("statestore: append to %s: too much contention", key)
+}
+
+func (s *Couchbase) Range(key string, from int) ([][]byte, int, error) {
+	res, err := s.collection.Get(keyPrefix+key, nil)
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return nil, from, nil
+	}
+	if err != nil {
+		return nil, from, err
+	}
+	var l list
+	if err := res.Content(&l); err != nil {
+		return nil, from, err
+	}
+	entries, next := l.from(from)
+	return entries, next, nil
+}
+
+// Lease inserts the lease document, or renews it with the CAS it was read at
+// when owner holds it; the document's expiry ends an abandoned lease.
+func (s *Couchbase) Lease(key, owner string, ttl time.Duration) (string, error) {
+	id := keyPrefix + key
+	for attempt := 0; attempt < appendRetries; attempt++ {
+		res, err := s.collection.Get(id, &gocb.GetOptions{Transcoder: s.raw})
+		if errors.Is(err, gocb.ErrDocumentNotFound) {
+			_, err = s.collection.Insert(id, []byte(owner), &gocb.InsertOptions{Expiry: ttl, Transcoder: s.raw})
+			if errors.Is(err, gocb.ErrDocumentExists) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			return owner, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		var holder []byte
+		if err := res.Content(&holder); err != nil {
+			return "", err
+		}
+		if string(holder) != owner {
+			return string(holder), nil
+		}
+		_, err = s.collection.Replace(id, []byte(owner), &gocb.ReplaceOptions{Cas: res.Cas(), Expiry: ttl, Transcoder: s.raw})
+		if errors.Is(err, gocb.ErrCasMismatch) || errors.Is(err, gocb.ErrDocumentNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return owner, nil
+	}
+	return "", fmt.Errorf("statestore: lease %s: too much contention", key)
+}
+
+func (s *Couchbase) ReleaseLease(key, owner string) error {
+	id := keyPrefix + key
+	res, err := s.collection.Get(id, &gocb.GetOptions{Transcoder: s.raw})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var holder []byte
+	if err := res.Content(&holder); err != nil || string(holder) != owner {
+		return err
+	}
+	_, err = s.collection.Remove(id, &gocb.RemoveOptions{Cas: res.Cas()})
+	if errors.Is(err, gocb.ErrCasMismatch) || errors.Is(err, gocb.ErrDocumentNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *Couchbase) Shared() bool { return true }
+
+func (s *Couchbase) Close() error { return s.cluster.Close(nil) }
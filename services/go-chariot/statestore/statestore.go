@@ -0,0 +1,226 @@
+// Package statestore holds state that must be visible to every backend
+// replica: execution records, execution log buffers and session metadata.
+//
+// Values are opaque bytes with a time-to-live. Logs are kept as bounded lists
+// whose entries carry an absolute sequence number, so a reader on another
+// replica can resume from where it left off even after old entries have been
+// trimmed.
+//
+// The memory store keeps everything in the process and is the default; it is
+// only suitable for a single replica. The couchbase store shares state through
+// a bucket so replicas can run behind a load balancer.
+package statestore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+// ErrNotFound is returned when a key does not exist or has expired.
+var ErrNotFound = errors.New("statestore: not found")
+
+// Store is the shared state backend. A ttl <= 0 means the key does not expire.
+type Store interface {
+	// Put stores value under key, replacing any previous value.
+	Put(key string, value []byte, ttl time.Duration) error
+	// Get returns the value under key or ErrNotFound.
+	Get(key string) ([]byte, error)
+	// Delete removes key and any list stored under it. Deleting a missing key
+	// is not an error.
+	Delete(key string) error
+	// Append adds entry to the list under key, keeping at most max entries
+	// (max <= 0 is unbounded), and returns the entry's sequence number.
+	Append(key string, entry []byte, max int, ttl time.Duration) (int, error)
+	// Range returns the list entries with sequence >= from and the sequence
+	// the next call should start from. A missing list yields no entries.
+	Range(key string, from int) ([][]byte, int, error)
+	// Lease gives key to owner for ttl if it is free, has expired or is
+	// owner's already, in which case the lease is renewed, and returns the
+	// owner holding it afterwards. Leases elect one replica for a role.
+	Lease(key, owner string, ttl time.Duration) (string, error)
+	// ReleaseLease frees key if owner holds it.
+	ReleaseLease(key, owner string) error
+	// Shared reports whether other processes see the same state.
+	Shared() bool
+	Close() error
+}
+
+// Open returns the store selected by the state_store setting: "memory" (the
+// default) or "couchbase", which uses the couchbase_* connection settings.
+func Open(c *cfg.Config) (Store, error) {
+	switch strings.ToLower(c.StateStore) {
+	case "", "memory":
+		return NewMemory(), nil
+	case "couchbase":
+		return OpenCouchbase(CouchbaseOptions{
+			URL:      c.CBUrl,
+			User:     c.CBUser,
+			Password: c.CBPassword,
+			Bucket:   c.CBBucket,
+			Scope:    c.CBScope,
+		})
+	default:
+		return nil, fmt.Errorf("unknown state store %q (want memory or couchbase)", c.StateStore)
+	}
+}
+
+// list is the stored form of a log list. Entries[i] has sequence Base+i.
+type list struct {
+	Base    int      `json:"base"`
+	Entries [][]byte `json:"entries"`
+}
+
+func (l *list) append(entry []byte, max int) int {
+	l.Entries = append(l.Entries, entry)
+	if max > 0 && len(l.Entries) > max {
+		drop := len(l.Entries) - max
+		l.Entries = append([][]byte(nil), l.Entries[drop:]...)
+		l.Base += drop
+	}
+	return l.Base + len(l.Entries) - 1
+}
+
+func (l *list) from(seq int) ([][]byte, int) {
+	next := l.Base + len(l.Entries)
+	if seq < l.Base {
+		seq = l.Base
+	}
+	if seq >= next {
+		return nil, next
+	}
+	out := make([][]byte, next-seq)
+	copy(out, l.Entries[seq-l.Base:])
+	return out, next
+}
+
+type memoryItem struct {
+	value   []byte
+	list    *list
+	expires time.Time
+}
+
+func (it *memoryItem) expired(now time.Time) bool {
+	return !it.expires.IsZero() && now.After(it.expires)
+}
+
+// Memory is an in-process Store.
+type Memory struct {
+	mu        sync.Mutex
+	items     map[string]*memoryItem
+	lastSweep time.Time
+}
+
+// NewMemory returns an empty in-process store.
+func NewMemory() *Memory {
+	return &Memory{items: map[string]*memoryItem{}, lastSweep: time.Now()}
+}
+
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// sweep drops expired items at most once a minute; callers hold mu.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for key, it := range m.items {
+		if it.expired(now) {
+			delete(m.items, key)
+		}
+	}
+}
+
+func (m *Memory) lookup(key string) *memoryItem {
+	it, ok := m.items[key]
+	if !ok {
+		return nil
+	}
+	if it.expired(time.Now()) {
+		delete(m.items, key)
+		return nil
+	}
+	return it
+}
+
+func (m *Memory) Put(key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(time.Now())
+	m.items[key] = &memoryItem{value: append([]byte(nil), value...), expires: expiry(ttl)}
+	return nil
+}
+
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it := m.lookup(key)
+	if it == nil || it.list != nil {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), it.value...), nil
+}
+
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, key)
+	return nil
+}
+
+func (m *Memory) Append(key string, entry []byte, max int, ttl time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(time.Now())
+	it := m.lookup(key)
+	if it == nil || it.list == nil {
+		it = &memoryItem{list: &list{}}
+		m.items[key] = it
+	}
+	it.expires = expiry(ttl)
+	return it.list.append(append([]byte(nil), entry...), max), nil
+}
+
+func (m *Memory) Range(key string, from int) ([][]byte, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it := m.lookup(key)
+	if it == nil || it.list == nil {
+		return nil, from, nil
+	}
+	entries, next := it.list.from(from)
+	return entries, next, nil
+}
+
+func (m *Memory) Lease(key, owner string, ttl time.Duration) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(time.Now())
+	if it := m.lookup(key); it != nil && it.list == nil && string(it.value) != owner {
+		return string(it.value), nil
+	}
+	m.items[key] = &memoryItem{value: []byte(owner), expires: expiry(ttl)}
+	return owner, nil
+}
+
+func (m *Memory) ReleaseLease(key, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if it := m.lookup(key); it != nil && string(it.value) == owner {
+		delete(m.items, key)
+	}
+	return nil
+}
+
+func (m *Memory) Shared() bool { return false }
+
+func (m *Memory) Close() error { return nil }
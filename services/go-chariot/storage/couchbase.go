@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/couchbase"
+	"github.com/couchbase/gocb/v2"
+)
+
+// Key prefixes of the file and directory documents within the bucket.
+const (
+	fileKeyPrefix = "chariot::storage::file::"
+	dirKeyPrefix  = "chariot::storage::dir::"
+)
+
+// maxKeyLength is the longest document key Couchbase accepts; longer paths
+// are keyed by their hash.
+const maxKeyLength = 250
+
+// indexRetries bounds the optimistic-locking loop updating a directory.
+const indexRetries = 16
+
+// CouchbaseOptions locates the bucket workspace files are kept in. Documents
+// are written to the _default collection of Scope (or of the default scope).
+type CouchbaseOptions struct {
+	URL      string
+	User     string
+	Password string
+	Bucket   string
+	Scope    string
+}
+
+// Couchbase is a Provider keeping each file as a JSON document, and each
+// directory as a document listing its files, updated with CAS.
+type Couchbase struct {
+	cluster    *gocb.Cluster
+	collection *gocb.Collection
+	keyspace   string // Of the collection, for queries
+}
+
+// fileDoc is the stored form of a file.
+type fileDoc struct {
+	Path     string    `json:"path"`
+	Data     []byte    `json:"data"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// dirDoc is the stored form of a directory: its files by name.
+type dirDoc struct {
+	Files map[string]FileInfo `json:"files"`
+}
+
+// OpenCouchbase connects to the cluster and waits for the bucket to be ready.
+func OpenCouchbase(opts CouchbaseOptions) (*Couchbase, error) {
+	if opts.URL == "" || opts.Bucket == "" {
+		return nil, errors.New("couchbase storage requires couchbase_url and couchbase_bucket")
+	}
+	cluster, collection, err := couchbase.Open(couchbase.Options{
+		URL:       opts.URL,
+		User:      opts.User,
+		Password:  opts.Password,
+		Bucket:    opts.Bucket,
+		Scope:     opts.Scope,
+		KVTimeout: 10 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couchbase storage: %w", err)
+	}
+	scope := "_default"
+	if opts.Scope != "" {
+		scope = opts.Scope
+	}
+	keyspace := fmt.Sprintf("`%s`.`%s`.`_default`", opts.Bucket, scope)
+	return &Couchbase{cluster: cluster, collection: collection, keyspace: keyspace}, nil
+}
+
+// documentKey returns the key of the document for path under prefix. Paths
+// are cleaned and use forward slashes, so replicas on any platform agree.
+func documentKey(prefix, path string) string {
+	key := prefix + filepath.ToSlash(filepath.Clean(path))
+	if len(key) <= maxKeyLength {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return prefix + "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (s *Couchbase) ReadFile(path string) ([]byte, error) {
+	res, err := s.collection.Get(documentKey(fileKeyPrefix, path), nil)
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return nil, notExist("open", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var doc fileDoc
+	if err := res.Content(&doc); err != nil {
+		return nil, err
+	}
+	return doc.Data, nil
+}
+
+// WriteFile stores the file document, then lists it in its directory.
+func (s *Couchbase) WriteFile(path string, data []byte) error {
+	doc := fileDoc{Path: filepath.ToSlash(filepath.Clean(path)), Data: data, Size: int64(len(data)), Modified: time.Now().UTC()}
+	if _, err := s.collection.Upsert(documentKey(fileKeyPrefix, path), doc, nil); err != nil {
+		return err
+	}
+	info := FileInfo{Name: filepath.Base(path), Size: doc.Size, Modified: doc.Modified}
+	return s.updateDir(filepath.Dir(path), func(d *dirDoc) { d.Files[info.Name] = info })
+}
+
+// Remove drops the file from its directory, then deletes its document.
+func (s *Couchbase) Remove(path string) error {
+	key := documentKey(fileKeyPrefix, path)
+	res, err := s.collection.Exists(key, nil)
+	if err != nil {
+		return err
+	}
+	if !res.Exists() {
+		return notExist("remove", path)
+	}
+	name := filepath.Base(path)
+	if err := s.updateDir(filepath.Dir(path), func(d *dirDoc) { delete(d.Files, name) }); err != nil {
+		return err
+	}
+	_, err = s.collection.Remove(key, nil)
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return notExist("remove", path)
+	}
+	return err
+}
+
+func (s *Couchbase) Stat(path string) (FileInfo, error) {
+	res, err := s.collection.LookupIn(documentKey(fileKeyPrefix, path), []gocb.LookupInSpec{
+		gocb.GetSpec("size", nil),
+		gocb.GetSpec("modified", nil),
+	}, nil)
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return FileInfo{}, notExist("stat", path)
+	}
+	if err != nil {
+		return FileInfo{}, err
+	}
+	info := FileInfo{Name: filepath.Base(path)}
+	if err := res.ContentAt(0, &info.Size); err != nil {
+		return FileInfo{}, err
+	}
+	if err := res.ContentAt(1, &info.Modified); err != nil {
+		return FileInfo{}, err
+	}
+	return info, nil
+}
+
+func (s *Couchbase) ReadDir(dir string) ([]FileInfo, error) {
+	res, err := s.collection.Get(documentKey(dirKeyPrefix, dir), nil)
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return []FileInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var d dirDoc
+	if err := res.Content(&d); err != nil {
+		return nil, err
+	}
+	infos := make([]FileInfo, 0, len(d.Files))
+	for _, info := range d.Files {
+		infos = append(infos, info)
+	}
+	sortInfos(infos)
+	return infos, nil
+}
+
+// Walk queries the paths of the file documents, which needs a primary
+// index on the collection; it is meant for maintenance such as key rotation
+// rather than for serving requests.
+func (s *Couchbase) Walk(root string, visit func(path string) error) error {
+	root = filepath.ToSlash(filepath.Clean(root))
+	rows, err := s.cluster.Query(
+		"SELECT RAW d.path FROM "+s.keyspace+" AS d WHERE META(d).id LIKE $prefix AND d.path LIKE $under",
+		&gocb.QueryOptions{NamedParameters: map[string]interface{}{
+			"prefix": fileKeyPrefix + "%",
+			"under":  root + "/%",
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Row(&path); err != nil {
+			return err
+		}
+		// LIKE also takes _ and % in root as wildcards
+		if strings.HasPrefix(path, root+"/") {
+			paths = append(paths, path)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := visit(filepath.FromSlash(path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateDir reads the directory document, applies change and writes it back
+// with the CAS it was read at, retrying when another writer got there first.
+func (s *Couchbase) updateDir(dir string, change func(*dirDoc)) error {
+	id := documentKey(dirKeyPrefix, dir)
+	for attempt := 0; attempt < indexRetries; attempt++ {
+		d := dirDoc{Files: map[string]FileInfo{}}
+		res, err := s.collection.Get(id, nil)
+		switch {
+		case errors.Is(err, gocb.ErrDocumentNotFound):
+			change(&d)
+			_, err = s.collection.Insert(id, d, nil)
+			if errors.Is(err, gocb.ErrDocumentExists) {
+				continue
+			}
+			return err
+		case err != nil:
+			return err
+		}
+		if err := res.Content(&d); err != nil {
+			return err
+		}
+		if d.Files == nil {
+			d.Files = map[string]FileInfo{}
+		}
+		change(&d)
+		_, err = s.collection.Replace(id, d, &gocb.ReplaceOptions{Cas: res.Cas()})
+		if errors.Is(err, gocb.ErrCasMismatch) {
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("storage: update %s: too much contention", dir)
+}
+
+func (s *Couchbase) Shared() bool { return true }
+
+func (s *Couchbase) Close() error {
+	return s.cluster.Close(nil)
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encryptedMagic starts every file Encrypted writes. It is followed by the
+// length and the id of the key, the nonce and the AES-GCM ciphertext.
+const encryptedMagic = "CHARIOT-ENC\x01"
+
+// Key is an AES key files are encrypted with. Files record the id of the
+// key they were written with, so older keys still decrypt them after a new
+// one is introduced.
+type Key struct {
+	ID       string
+	Material []byte // 16, 24 or 32 bytes
+}
+
+// ParseKeys parses the storage_keys setting: id=key entries separated by
+// commas, the first of which encrypts new writes. A key is base64 text, or
+// secret:name to have resolve fetch it, such as from the vault.
+func ParseKeys(setting string, resolve func(name string) (string, error)) ([]Key, error) {
+	var keys []Key
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(setting, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, value, ok := strings.Cut(entry, "=")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("storage key %q: expected id=key", entry)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("storage key %s: listed twice", id)
+		}
+		seen[id] = true
+		value = strings.TrimSpace(value)
+		if name, ok := strings.CutPrefix(value, "secret:"); ok {
+			if resolve == nil {
+				return nil, fmt.Errorf("storage key %s: no secret provider", id)
+			}
+			secret, err := resolve(name)
+			if err != nil {
+				return nil, fmt.Errorf("storage key %s: %w", id, err)
+			}
+			value = strings.TrimSpace(secret)
+		}
+		material, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("storage key %s: %w", id, err)
+		}
+		keys = append(keys, Key{ID: id, Material: material})
+	}
+	return keys, nil
+}
+
+// Encrypted is a Provider encrypting files with AES-GCM before another
+// provider stores them, and decrypting them as they are read. Files stored
+// in the clear, such as those saved before encryption was turned on, are
+// read as they are and encrypted when next written. Sizes are those stored.
+type Encrypted struct {
+	Provider
+	primary string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewEncrypted wraps inner so that files are written with the first of keys
+// and read with any of them.
+func NewEncrypted(inner Provider, keys []Key) (*Encrypted, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("storage encryption requires a key")
+	}
+	e := &Encrypted{Provider: inner, primary: keys[0].ID, aeads: map[string]cipher.AEAD{}}
+	for _, k := range keys {
+		block, err := aes.NewCipher(k.Material)
+		if err != nil {
+			return nil, fmt.Errorf("storage key %s: %w", k.ID, err)
+		}
+		if e.aeads[k.ID], err = cipher.NewGCM(block); err != nil {
+			return nil, fmt.Errorf("storage key %s: %w", k.ID, err)
+		}
+	}
+	return e, nil
+}
+
+// keyID returns the id of the key data was encrypted with, or false when it
+// is stored in the clear.
+func keyID(data []byte) (string, bool) {
+	if !bytes.HasPrefix(data, []byte(encryptedMagic)) || len(data) <= len(encryptedMagic) {
+		return "", false
+	}
+	n := int(data[len(encryptedMagic)])
+	start := len(encryptedMagic) + 1
+	if len(data) < start+n {
+		return "", false
+	}
+	return string(data[start : start+n]), true
+}
+
+func (e *Encrypted) seal(data []byte) ([]byte, error) {
+	aead := e.aeads[e.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(encryptedMagic)+1+len(e.primary)+len(nonce)+len(data)+aead.Overhead())
+	out = append(out, encryptedMagic...)
+	out = append(out, byte(len(e.primary)))
+	out = append(out, e.primary...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, data, []byte(e.primary)), nil
+}
+
+func (e *Encrypted) open(path string, data []byte) ([]byte, error) {
+	id, ok := keyID(data)
+	if !ok {
+		return data, nil
+	}
+	aead := e.aeads[id]
+	if aead == nil {
+		return nil, fmt.Errorf("%s: encrypted with storage key %s, which is not configured", path, id)
+	}
+	rest := data[len(encryptedMagic)+1+len(id):]
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("%s: truncated encrypted file", path)
+	}
+	plain, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("%s: cannot decrypt: %w", path, err)
+	}
+	return plain, nil
+}
+
+func (e *Encrypted) ReadFile(path string) ([]byte, error) {
+	data, err := e.Provider.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return e.open(path, data)
+}
+
+func (e *Encrypted) WriteFile(path string, data []byte) error {
+	sealed, err := e.seal(data)
+	if err != nil {
+		return err
+	}
+	return e.Provider.WriteFile(path, sealed)
+}
+
+// RotationReport is the outcome of Rotate.
+type RotationReport struct {
+	Files     int               `json:"files"`
+	Current   int               `json:"current"`   // Already encrypted with the first key
+	Rewritten int               `json:"rewritten"` // Or to be, on a dry run
+	Failed    map[string]string `json:"failed,omitempty"`
+}
+
+// Rotate encrypts each of paths with the first key unless it already is:
+// files written with an older key, or in the clear, are decrypted and
+// written again. Once it reports no failures the older keys can be removed.
+// A dry run only counts the files it would rewrite.
+func (e *Encrypted) Rotate(paths []string, dryRun bool) *RotationReport {
+	report := &RotationReport{}
+	fail := func(path string, err error) {
+		if report.Failed == nil {
+			report.Failed = map[string]string{}
+		}
+		report.Failed[path] = err.Error()
+	}
+	for _, path := range paths {
+		report.Files++
+		data, err := e.Provider.ReadFile(path)
+		if err != nil {
+			fail(path, err)
+			continue
+		}
+		if id, _ := keyID(data); id == e.primary {
+			report.Current++
+			continue
+		}
+		plain, err := e.open(path, data)
+		if err != nil {
+			fail(path, err)
+			continue
+		}
+		if !dryRun {
+			if err := e.WriteFile(path, plain); err != nil {
+				fail(path, err)
+				continue
+			}
+		}
+		report.Rewritten++
+	}
+	return report
+}
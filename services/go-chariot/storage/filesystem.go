@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Filesystem is a Provider keeping files on the local disk.
+type Filesystem struct{}
+
+func (Filesystem) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// WriteFile writes a temporary file next to path and renames it over path.
+func (Filesystem) WriteFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (Filesystem) Remove(path string) error {
+	return os.Remove(path)
+}
+
+func (Filesystem) Stat(path string) (FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if info.IsDir() {
+		return FileInfo{}, &fs.PathError{Op: "stat", Path: path, Err: errors.New("is a directory")}
+	}
+	return FileInfo{Name: info.Name(), Size: info.Size(), Modified: info.ModTime()}, nil
+}
+
+func (Filesystem) ReadDir(dir string) ([]FileInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []FileInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]FileInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // Removed since listed
+		}
+		infos = append(infos, FileInfo{Name: e.Name(), Size: info.Size(), Modified: info.ModTime()})
+	}
+	return infos, nil
+}
+
+// Walk skips the temporary files of writes in progress.
+func (Filesystem) Walk(root string, visit func(path string) error) error {
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		return visit(path)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (Filesystem) Shared() bool { return false }
+
+func (Filesystem) Close() error { return nil }
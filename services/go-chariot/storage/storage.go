@@ -0,0 +1,102 @@
+// Package storage keeps the workspace users edit: program files, diagrams
+// and function libraries.
+//
+// Files are addressed by the paths the configured data, tree and diagram
+// directories give them, so callers resolve scopes and sandboxes as before
+// and only the reads and writes go through a Provider.
+//
+// The filesystem provider is the default and keeps files where the paths
+// point. The couchbase provider keeps them as documents in a bucket, so that
+// replicas behind a load balancer share one workspace; their directories only
+// need to be configured alike.
+package storage
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+// FileInfo describes a stored file.
+type FileInfo struct {
+	Name     string    `json:"name"` // Base name
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// Provider stores workspace files by path. Errors for missing files match
+// fs.ErrNotExist, and os.IsNotExist, whatever the provider.
+type Provider interface {
+	// ReadFile returns the content of the file at path.
+	ReadFile(path string) ([]byte, error)
+	// WriteFile replaces the file at path with data, creating it and its
+	// directory as needed. Readers see the old or the new content, never
+	// part of it.
+	WriteFile(path string, data []byte) error
+	// Remove deletes the file at path.
+	Remove(path string) error
+	// Stat describes the file at path.
+	Stat(path string) (FileInfo, error)
+	// ReadDir lists the files directly in dir, sorted by name; a directory
+	// that does not exist has none. Subdirectories are not listed.
+	ReadDir(dir string) ([]FileInfo, error)
+	// Walk calls visit with the path of every file under root, at any
+	// depth. A root that does not exist has none.
+	Walk(root string, visit func(path string) error) error
+	// Shared reports whether other processes see the same files.
+	Shared() bool
+	Close() error
+}
+
+var (
+	mu      sync.RWMutex
+	current Provider = Filesystem{}
+)
+
+// Default returns the provider workspace files are kept with.
+func Default() Provider {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Use makes p the provider workspace files are kept with.
+func Use(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = p
+}
+
+// Open returns the provider selected by the storage_provider setting:
+// "filesystem" (the default) or "couchbase", which uses the couchbase_*
+// connection settings.
+func Open(c *cfg.Config) (Provider, error) {
+	switch strings.ToLower(c.StorageProvider) {
+	case "", "filesystem":
+		return Filesystem{}, nil
+	case "couchbase":
+		return OpenCouchbase(CouchbaseOptions{
+			URL:      c.CBUrl,
+			User:     c.CBUser,
+			Password: c.CBPassword,
+			Bucket:   c.CBBucket,
+			Scope:    c.CBScope,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage provider %q (want filesystem or couchbase)", c.StorageProvider)
+	}
+}
+
+// notExist is the error for a missing file, which os.IsNotExist recognizes.
+func notExist(op, path string) error {
+	return &fs.PathError{Op: op, Path: path, Err: fs.ErrNotExist}
+}
+
+func sortInfos(infos []FileInfo) {
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+}
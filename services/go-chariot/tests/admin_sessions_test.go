@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/statestore"
+	"github.com/labstack/echo/v4"
+)
+
+func sessionInfoByRef(sm *chariot.SessionManager, ref string) map[string]interface{} {
+	for _, info := range sm.GetActiveSessionsInfo() {
+		if info["ref"] == ref {
+			return info
+		}
+	}
+	return nil
+}
+
+// TestAdminSessionActivityAndLogout verifies the activity recorded for a
+// session and ending sessions by ref and by user.
+func TestAdminSessionActivityAndLogout(t *testing.T) {
+	sm := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	alice := sm.NewSession("alice", logs.NewZapLogger(), "admin-alice-1")
+	sm.NewSession("alice", logs.NewZapLogger(), "admin-alice-2")
+	sm.NewSession("bob", logs.NewZapLogger(), "admin-bob")
+	defer sm.EndSession("admin-bob")
+
+	alice.SetClient("10.0.0.7", "curl/8.5")
+	alice.RecordExecution("report.ch")
+	alice.RecordExecution("report.ch")
+
+	ref := chariot.SessionRef("admin-alice-1")
+	info := sessionInfoByRef(sm, ref)
+	if info == nil {
+		t.Fatalf("no session with ref %s", ref)
+	}
+	if info["remote_addr"] != "10.0.0.7" || info["user_agent"] != "curl/8.5" {
+		t.Errorf("client = %v %v", info["remote_addr"], info["user_agent"])
+	}
+	if info["last_script"] != "report.ch" || info["executions"] != 2 {
+		t.Errorf("activity = %v x%v", info["last_script"], info["executions"])
+	}
+	if at, _ := info["last_executed"].(time.Time); time.Since(at) > time.Minute {
+		t.Errorf("last_executed = %v", info["last_executed"])
+	}
+
+	if err := sm.EndSessionByRef("admin-alice-1"); err == nil {
+		t.Error("a token was accepted as a ref")
+	}
+	if err := sm.EndSessionByRef(ref); err != nil {
+		t.Fatalf("EndSessionByRef: %v", err)
+	}
+	if _, err := sm.GetSession("admin-alice-1"); err == nil {
+		t.Error("the ended session is still usable")
+	}
+	if err := sm.EndSessionByRef(ref); err == nil {
+		t.Error("ending the session twice succeeded")
+	}
+
+	if n := sm.EndUserSessions("alice"); n != 1 {
+		t.Errorf("EndUserSessions ended %d sessions, want 1", n)
+	}
+	if _, err := sm.GetSession("admin-alice-2"); err == nil {
+		t.Error("alice's other session is still usable")
+	}
+	if _, err := sm.GetSession("admin-bob"); err != nil {
+		t.Errorf("bob's session was ended: %v", err)
+	}
+}
+
+// TestAdminEndSessionOnOtherReplica verifies a session can be ended from a
+// replica that does not hold it when the store is shared.
+func TestAdminEndSessionOnOtherReplica(t *testing.T) {
+	store := sharedMemory{statestore.NewMemory()}
+	a := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	b := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	a.SetStore(store)
+	b.SetStore(store)
+
+	a.NewSession("carol", logs.NewZapLogger(), "admin-replica-token")
+	if err := b.EndSessionByRef(chariot.SessionRef("admin-replica-token")); err != nil {
+		t.Fatalf("EndSessionByRef on the other replica: %v", err)
+	}
+	if _, err := a.GetSession("admin-replica-token"); err == nil {
+		t.Fatal("the session is still usable on the replica holding it")
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	prev := cfg.ChariotConfig.AdminUsers
+	defer func() { cfg.ChariotConfig.AdminUsers = prev }()
+	sm := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	root := sm.NewSession("root", logs.NewZapLogger(), "admin-root")
+	defer sm.EndSession("admin-root")
+	dave := sm.NewSession("dave", logs.NewZapLogger(), "admin-dave")
+	defer sm.EndSession("admin-dave")
+
+	var h handlers.Handlers
+	protected := h.AdminAuth(func(c echo.Context) error {
+		return c.JSON(http.StatusOK, handlers.ResultJSON{Result: "OK"})
+	})
+
+	cfg.ChariotConfig.AdminUsers = "root, ops"
+	if got := callWithSession(t, root, protected, http.MethodGet, "/api/admin/sessions", ""); got.Result != "OK" {
+		t.Errorf("admin rejected: %v", got.Data)
+	}
+	if got := callWithSession(t, dave, protected, http.MethodGet, "/api/admin/sessions", ""); got.Result != "ERROR" {
+		t.Error("non-admin accepted")
+	}
+
+	cfg.ChariotConfig.AdminUsers = ""
+	if got := callWithSession(t, dave, protected, http.MethodGet, "/api/admin/sessions", ""); got.Result != "OK" {
+		t.Errorf("without admin_users every user is an admin, got %v", got.Data)
+	}
+}
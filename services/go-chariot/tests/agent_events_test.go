@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/labstack/echo/v4"
+)
+
+// TestAgentEventHistory verifies that recorded agent events can be queried
+// after a sequence number, a time and by type.
+func TestAgentEventHistory(t *testing.T) {
+	var h handlers.Handlers
+	agent := "history-" + time.Now().Format("150405.000000")
+	start := time.Now()
+	for i, status := range []string{"start", "start", "finish", "finish"} {
+		typ := "plan"
+		if i == 1 || i == 2 {
+			typ = "step"
+		}
+		ev := chariot.AgentEvent{Type: typ, Agent: agent, Plan: "restock", Status: status, Time: start.Add(time.Duration(i) * time.Minute)}
+		if rec, err := h.RecordAgentEvent(ev); err != nil || rec.Seq != i {
+			t.Fatalf("RecordAgentEvent: seq %d, %v", rec.Seq, err)
+		}
+	}
+
+	query := func(params string) (events []handlers.AgentEventRecord, next int) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/agents/"+agent+"/events?"+params, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("name")
+		c.SetParamValues(agent)
+		if err := h.GetAgentEvents(c); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("GetAgentEvents(%s): status %d, %v", params, rec.Code, err)
+		}
+		var res struct {
+			Data struct {
+				Events []handlers.AgentEventRecord `json:"events"`
+				Next   int                         `json:"next"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res.Data.Events, res.Data.Next
+	}
+
+	if events, next := query(""); len(events) != 4 || next != 3 {
+		t.Errorf("expected all 4 events, got %d (next %d)", len(events), next)
+	}
+	if events, next := query("limit=2"); len(events) != 2 || next != 1 {
+		t.Errorf("expected the first page, got %d (next %d)", len(events), next)
+	}
+	if events, _ := query("since=1&type=step"); len(events) != 1 || events[0].Status != "finish" {
+		t.Errorf("expected the finished step, got %+v", events)
+	}
+	since := start.Add(90 * time.Second).Format(time.RFC3339Nano)
+	if events, _ := query("since=" + url.QueryEscape(since)); len(events) != 2 || events[0].Seq != 2 {
+		t.Errorf("expected the events after %s, got %+v", since, events)
+	}
+}
@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/labstack/echo/v4"
+)
+
+// TestAgentFederation verifies that a "peer/agent" name reaches the peer's
+// agent over the federation API, that the token is required, and that a
+// follower gets the events of a federated agent as a belief. The backend is
+// its own peer, named "self".
+func TestAgentFederation(t *testing.T) {
+	saved := cfg.ChariotConfig.FederationToken
+	cfg.ChariotConfig.FederationToken = "s3cret"
+	defer func() { cfg.ChariotConfig.FederationToken = saved }()
+
+	var h handlers.Handlers
+	e := echo.New()
+	fed := e.Group("/federation", h.FederationAuth)
+	fed.POST("/agents/:name/beliefs", h.FederationSetBelief)
+	fed.GET("/agents/:name/beliefs/:key", h.FederationGetBelief)
+	fed.POST("/agents/:name/publish", h.FederationPublish)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/federation/agents/depot/publish", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the token, got %d", resp.StatusCode)
+	}
+
+	if _, err := handlers.NewFederation("self=ftp://example.com", "s3cret"); err == nil {
+		t.Error("expected an error for a non-http peer")
+	}
+	federation, err := handlers.NewFederation("self="+srv.URL+"/", "s3cret")
+	if err != nil {
+		t.Fatalf("NewFederation: %v", err)
+	}
+	ch.SetRemoteAgents(federation)
+	defer ch.SetRemoteAgents(nil)
+
+	rt := createNamedRuntime("agent_federation")
+	defer ch.UnregisterRuntime("agent_federation")
+	defer ch.DefaultAgentStop("depot")
+	defer ch.DefaultAgentStop("hq")
+	setup := strings.Join([]string{
+		"declare(no,'F', func(){ False })",
+		"declare(idle,'P', plan('Idle', array(), no, no, array(no), no))",
+		"agentStartNamed('depot', idle, 1, 60)",
+		"agentStartNamed('hq', idle, 1, 60)",
+		"agentBelief('self/depot', 'stock', 3, map('ttl', 60))",
+		"agentFollow('hq', 'self/depot')",
+	}, "\n")
+	if _, err := rt.ExecProgram(setup); err != nil {
+		t.Fatalf("setup exec: %v", err)
+	}
+	if got := ch.DefaultAgentGetBeliefs("depot")["stock"]; got != ch.Number(3) {
+		t.Errorf("expected the belief set over the bridge, got %v", got)
+	}
+	if v, err := rt.ExecProgram("belief('self/depot', 'stock')"); err != nil || v != ch.Number(3) {
+		t.Errorf("expected to read the belief over the bridge, got %v (%v)", v, err)
+	}
+	if _, err := rt.ExecProgram("agentPublish('self/nobody')"); err == nil {
+		t.Error("expected an error nudging a missing federated agent")
+	}
+
+	ch.DeliverRemoteAgentEvent(ch.AgentEvent{Type: "plan", Agent: "self/depot", Plan: "Restock", Status: "finish", Time: time.Now()})
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if m, ok := ch.DefaultAgentGetBeliefs("hq")["self/depot"].(*ch.MapValue); ok {
+			if m.Values["plan"] != ch.Str("Restock") || m.Values["status"] != ch.Str("finish") {
+				t.Errorf("unexpected followed event %v", m.Values)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the follower did not get the federated agent's event")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !ch.UnfollowAgent("hq", "self/depot") || ch.UnfollowAgent("hq", "self/depot") {
+		t.Error("expected to unfollow exactly once")
+	}
+}
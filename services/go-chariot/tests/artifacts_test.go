@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+	"github.com/labstack/echo/v4"
+)
+
+func executeBody(program string) string {
+	body, _ := json.Marshal(map[string]string{"program": program})
+	return string(body)
+}
+
+// downloadArtifact fetches an artifact through DownloadArtifact.
+func downloadArtifact(t *testing.T, h *handlers.Handlers, session *chariot.Session, execID, name string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/artifacts/"+execID+"/"+name, nil), rec)
+	c.Set("session", session)
+	c.SetParamNames("execId", "name")
+	c.SetParamValues(execID, name)
+	if err := h.DownloadArtifact(c); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// TestArtifacts verifies that emitArtifact hands files back with the
+// execution result, that they can be listed and downloaded only by their
+// owner, and that size limits are enforced.
+func TestArtifacts(t *testing.T) {
+	setConfig(t, &cfg.ChariotConfig.ArtifactInlineSize, 256)
+
+	sm := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	session := sm.NewSession("analyst", logs.NewZapLogger(), "artifact-token")
+	defer sm.EndSession("artifact-token")
+	other := sm.NewSession("someone-else", logs.NewZapLogger(), "other-token")
+	defer sm.EndSession("other-token")
+	var h handlers.Handlers
+
+	program := `
+emitArtifact('report.txt', 'All 3 loads finished')
+emitArtifact('rows.csv', array(map('id', 1, 'name', 'alpha'), map('id', 2, 'name', 'beta, inc')))
+emitArtifact('summary.json', map('loads', 3))
+plot(array(1, 2, 3))
+'done'`
+	res := callWithSession(t, session, h.Execute, http.MethodPost, "/api/execute", executeBody(program))
+	if res.Result != "OK" || len(res.Artifacts) != 4 {
+		t.Fatalf("Execute: %v %+v", res.Data, res.Artifacts)
+	}
+	byName := map[string]int{}
+	for i, a := range res.Artifacts {
+		byName[a.Name] = i
+	}
+	csv := res.Artifacts[byName["rows.csv"]]
+	if csv.MimeType != "text/csv; charset=utf-8" || csv.Data != nil || !strings.HasPrefix(csv.URL, "/api/artifacts/") {
+		t.Fatalf("unexpected CSV artifact %+v", csv)
+	}
+	if plot := res.Artifacts[byName["plot-4.svg"]]; len(plot.Data) == 0 || plot.ExpiresAt.Before(time.Now()) {
+		t.Fatalf("expected the chart inline, got %+v", plot)
+	}
+	execID := strings.Split(csv.URL, "/")[3]
+
+	rec := downloadArtifact(t, &h, session, execID, "rows.csv")
+	if rec.Code != http.StatusOK || rec.Body.String() != "id,name\n1,alpha\n2,\"beta, inc\"\n" {
+		t.Fatalf("download rows.csv: %d %q", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Header().Get(echo.HeaderContentDisposition), `filename=rows.csv`) {
+		t.Fatalf("unexpected Content-Disposition %q", rec.Header().Get(echo.HeaderContentDisposition))
+	}
+	if rec := downloadArtifact(t, &h, session, execID, "summary.json"); !strings.Contains(rec.Body.String(), `"loads": 3`) {
+		t.Fatalf("download summary.json: %q", rec.Body.String())
+	}
+	if rec := downloadArtifact(t, &h, other, execID, "rows.csv"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected another user's artifact to be hidden, got %d", rec.Code)
+	}
+
+	e := echo.New()
+	rec = httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/artifacts/"+execID, nil), rec)
+	c.Set("session", session)
+	c.SetParamNames("execId")
+	c.SetParamValues(execID)
+	if err := h.ListArtifacts(c); err != nil {
+		t.Fatal(err)
+	}
+	var listed struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil || len(listed.Data) != 4 || listed.Data[0]["data"] != nil {
+		t.Fatalf("ListArtifacts: %d %s", rec.Code, rec.Body.String())
+	}
+
+	setConfig(t, &cfg.ChariotConfig.ArtifactMaxSize, 1) // KB
+	setConfig(t, &cfg.ChariotConfig.ArtifactMaxTotal, 2)
+	for program, errSub := range map[string]string{
+		`emitArtifact('big.txt', padLeft('', 2000, 'x'))`: "limit is 1024",
+		"emitArtifact('a.txt', padLeft('', 1000, 'x'))\nemitArtifact('b.txt', padLeft('', 1000, 'x'))\nemitArtifact('c.txt', padLeft('', 1000, 'x'))": "limit is 2048",
+		`emitArtifact('../escape.txt', 'x')`: "plain file name",
+	} {
+		res := callWithSession(t, session, h.Execute, http.MethodPost, "/api/execute", executeBody(program))
+		if res.Result != "ERROR" || !strings.Contains(res.Data.(string), errSub) {
+			t.Errorf("%s: expected an error containing %q, got %v", program, errSub, res.Data)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+)
+
+func TestRunBenchmark(t *testing.T) {
+	rt := ch.NewRuntime()
+	ch.RegisterAll(rt)
+	ast, err := ch.ParseSource("add(n, 1)", "bench.ch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := handlers.RunBenchmark(context.Background(), rt, ast, map[string]ch.Value{"n": ch.Number(1)}, 50, 5, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Iterations != 50 || report.Warmup != 5 || report.Truncated {
+		t.Errorf("unexpected counts %+v", report)
+	}
+	if report.MinMs > report.P50Ms || report.P50Ms > report.P95Ms || report.P95Ms > report.MaxMs || report.MeanMs <= 0 {
+		t.Errorf("inconsistent timings %+v", report)
+	}
+
+	// The time limit cuts the timed iterations short
+	slow, _ := ch.ParseSource("setq(i, 0)\nwhile(smaller(i, 2000)) { setq(i, add(i, 1)) }", "bench.ch")
+	report, err = handlers.RunBenchmark(context.Background(), rt, slow, nil, 10000, 0, 20*time.Millisecond)
+	if err != nil || !report.Truncated || report.Iterations == 0 || report.Iterations == 10000 {
+		t.Errorf("expected a truncated report, got %+v, %v", report, err)
+	}
+
+	failing, _ := ch.ParseSource("undefinedFunction()", "bench.ch")
+	if _, err := handlers.RunBenchmark(context.Background(), rt, failing, nil, 10, 1, time.Minute); err == nil {
+		t.Errorf("expected a failing program to fail the benchmark")
+	}
+}
+
+// Benchmarks of the interpreter's dispatch paths. Each program is parsed
+// once, so they measure execution only:
+//
+//	go test ./tests -run '^$' -bench Dispatch -benchmem
+
+func benchmarkProgram(b *testing.B, setup, program string) {
+	rt := ch.NewRuntime()
+	ch.RegisterAll(rt)
+	if setup != "" {
+		if _, err := rt.ExecProgram(setup); err != nil {
+			b.Fatalf("setup: %v", err)
+		}
+	}
+	ast, err := ch.ParseSource(program, "bench.ch")
+	if err != nil {
+		b.Fatalf("parse: %v", err)
+	}
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := rt.ExecContext(ctx, ast, nil); err != nil {
+			b.Fatalf("run: %v", err)
+		}
+	}
+}
+
+// A builtin call: argument evaluation and callBuiltin
+func BenchmarkDispatchBuiltin(b *testing.B) {
+	benchmarkProgram(b, "", "add(1, 2)")
+}
+
+// A loop of variable reads and writes and builtin calls
+func BenchmarkDispatchLoop(b *testing.B) {
+	benchmarkProgram(b, "", "setq(i, 0)\nwhile(smaller(i, 100)) { setq(i, add(i, 1)) }")
+}
+
+// A call of a registered user function: frames and scopes
+func BenchmarkDispatchUserFunction(b *testing.B) {
+	benchmarkProgram(b, "registerFunction('double', func(x) { mul(x, 2) })", "double(21)")
+}
+
+// Tail recursion through the trampoline
+func BenchmarkDispatchTailCall(b *testing.B) {
+	benchmarkProgram(b, "registerFunction('countdown', func(n) { if(equal(n, 0)) { 0 } else { countdown(sub(n, 1)) } })", "countdown(100)")
+}
+
+// Builtins that dispatch on the type of their argument
+func BenchmarkDispatchPolymorphic(b *testing.B) {
+	benchmarkProgram(b, "", "setq(a, array(1, 2, 3))\nlength(a)\nlength('abc')\ngetAt(a, 1)")
+}
@@ -0,0 +1,34 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+// TestBuiltinMetadata verifies that every builtin RegisterAll registers is
+// described, so the editor and the reference never miss one.
+func TestBuiltinMetadata(t *testing.T) {
+	rt := createNamedRuntime("builtin_meta")
+	defer ch.UnregisterRuntime("builtin_meta")
+
+	infos := ch.Builtins(rt)
+	if len(infos) == 0 {
+		t.Fatal("no builtins described")
+	}
+	for _, info := range infos {
+		if info.Category == "other" || info.Category == "plugin" {
+			t.Errorf("builtin %s has no metadata", info.Name)
+			continue
+		}
+		if !strings.HasPrefix(info.Signature, info.Name+"(") || info.Summary == "" || info.Example == "" {
+			t.Errorf("incomplete metadata for %s: %+v", info.Name, info)
+		}
+	}
+
+	info, ok := ch.BuiltinMetadata("add")
+	if !ok || info.Category != "math" || info.Types != "(N, N) N" {
+		t.Errorf("unexpected metadata for add: %+v", info)
+	}
+}
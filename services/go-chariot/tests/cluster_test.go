@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/cluster"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/statestore"
+)
+
+// TestElectorFailover verifies that one of two replicas leads a role and
+// that the other takes it over when the leader resigns.
+func TestElectorFailover(t *testing.T) {
+	store := statestore.NewMemory()
+	a := cluster.NewElector(store, "replica-a", 300*time.Millisecond)
+	b := cluster.NewElector(store, "replica-b", 300*time.Millisecond)
+	var aDeposed bool
+	bElected := make(chan struct{}, 1)
+	a.Campaign("jobs", nil, func() { aDeposed = true })
+	b.Campaign("jobs", func() { bElected <- struct{}{} }, nil)
+	defer b.Resign()
+
+	if !a.IsLeader("jobs") || b.IsLeader("jobs") {
+		t.Fatalf("expected replica-a to lead, a=%v b=%v", a.Roles(), b.Roles())
+	}
+	if got := b.Leaders()["jobs"]; got != "replica-a" {
+		t.Errorf("replica-b sees %q leading", got)
+	}
+
+	a.Resign()
+	if !aDeposed {
+		t.Error("resigning did not run the deposed callback")
+	}
+	select {
+	case <-bElected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("replica-b did not take over the role")
+	}
+	if roles := b.Roles(); len(roles) != 1 || roles[0] != "jobs" {
+		t.Errorf("expected replica-b to lead jobs, got %v", roles)
+	}
+}
+
+// TestConfigApplyFile verifies that settings are read from a KEY=value file
+// and from a ConfigMap-style directory, and that a bad value changes nothing.
+func TestConfigApplyFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "chariot.env")
+	content := "# comment\nCHARIOT_TRACE_RETENTION=25\nverbose=true\nstate_store=\"couchbase\"\nno_such_setting=1\n"
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &cfg.Config{TraceRetention: 100}
+	changed, unknown, err := c.ApplyFile(file)
+	if err != nil {
+		t.Fatalf("ApplyFile: %v", err)
+	}
+	if strings.Join(changed, ",") != "state_store,trace_retention,verbose" || strings.Join(unknown, ",") != "no_such_setting" {
+		t.Errorf("unexpected changed %v, unknown %v", changed, unknown)
+	}
+	if c.TraceRetention != 25 || !c.Verbose || c.StateStore != "couchbase" {
+		t.Errorf("settings not applied: %+v", c)
+	}
+	if changed, _, _ := c.ApplyFile(file); len(changed) != 0 {
+		t.Errorf("unchanged file reported changes %v", changed)
+	}
+
+	mount := filepath.Join(dir, "configmap")
+	for name, value := range map[string]string{"trace_retention": "50\n", "idempotency_window": "oops", "..data": ""} {
+		if err := os.MkdirAll(mount, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(mount, name), []byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := c.ApplyFile(mount); err == nil || c.TraceRetention != 25 {
+		t.Errorf("expected a bad value to be rejected, got %v (trace_retention %d)", err, c.TraceRetention)
+	}
+	if err := os.WriteFile(filepath.Join(mount, "idempotency_window"), []byte("60"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _, err := c.ApplyFile(mount); err != nil || strings.Join(changed, ",") != "idempotency_window,trace_retention" || c.TraceRetention != 50 {
+		t.Errorf("expected the mounted settings, got %v (%v)", changed, err)
+	}
+}
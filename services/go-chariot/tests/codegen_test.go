@@ -0,0 +1,332 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/codegen"
+)
+
+const counterDiagram = `{
+  "name": "counter",
+  "nodes": [
+    {"id": "start", "type": "default", "position": {"x": 0, "y": 0}, "data": {"label": "Start"}},
+    {"id": "n1", "type": "default", "position": {"x": 0, "y": 100}, "data": {"label": "Declare",
+      "properties": {"variableName": "total", "typeSpecifier": "N", "initialValue": "0"}}},
+    {"id": "n2", "type": "default", "position": {"x": 0, "y": 200}, "data": {"label": "While",
+      "properties": {"condition": "smaller(total, 5)"}}},
+    {"id": "n3", "type": "default", "position": {"x": 40, "y": 240}, "data": {"label": "Set Q",
+      "properties": {"variableName": "total", "value": "add(total, 1)", "valueType": "expression"}}},
+    {"id": "n4", "type": "default", "position": {"x": 0, "y": 300}, "data": {"label": "Set Q",
+      "properties": {"variableName": "result", "value": "mul(total, 2)", "valueType": "expression"}}}
+  ],
+  "edges": [
+    {"id": "e1", "source": "start", "target": "n1", "sourceHandle": "right"},
+    {"id": "e2", "source": "n1", "target": "n2", "sourceHandle": "right"},
+    {"id": "e3", "source": "n2", "target": "n4", "sourceHandle": "right"}
+  ],
+  "nestingRelations": [
+    {"parentId": "n2", "childId": "n3", "order": 0}
+  ]
+}`
+
+func TestGenerateDiagramCode(t *testing.T) {
+	diagram, err := codegen.ParseDiagram([]byte(counterDiagram))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	res, err := codegen.Generate(diagram)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	want := strings.Join([]string{
+		"// counter",
+		"",
+		"// Starting counter",
+		"declare(total, 'N', 0)",
+		"while(smaller(total, 5)) {",
+		"  setq(total, add(total, 1))",
+		"}",
+		"setq(result, mul(total, 2))",
+	}, "\n")
+	if res.Code != want {
+		t.Fatalf("unexpected code:\n%s\nwant:\n%s", res.Code, want)
+	}
+
+	if mp, ok := res.SourceMap.Lookup(6); !ok || mp.NodeID != "n2" || mp.Line != 5 || mp.EndLine != 7 {
+		t.Errorf("line 6 should map to the While block, got %+v", mp)
+	}
+
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	val, err := rt.ExecProgram(res.Code)
+	if err != nil {
+		t.Fatalf("exec generated code: %v", err)
+	}
+	if val != chariot.Number(10) {
+		t.Errorf("expected 10, got %v", val)
+	}
+}
+
+func TestGenerateReportsUnsupportedNodes(t *testing.T) {
+	diagram := &codegen.Diagram{
+		Name: "mixed",
+		Nodes: []codegen.Node{
+			{ID: "start", Data: codegen.NodeData{Label: "Start"}},
+			{ID: "n1", Data: codegen.NodeData{Label: "RL Score"}},
+		},
+		Edges: []codegen.Edge{{ID: "e1", Source: "start", Target: "n1", SourceHandle: "right"}},
+	}
+	_, err := codegen.Generate(diagram)
+	var unsupported *codegen.UnsupportedNodesError
+	if !errors.As(err, &unsupported) || len(unsupported.Labels) != 1 || unsupported.Labels[0] != "RL Score" {
+		t.Fatalf("expected unsupported RL Score, got %v", err)
+	}
+}
+
+func TestValidateDiagram(t *testing.T) {
+	diagram, err := codegen.ParseDiagram([]byte(counterDiagram))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if report := codegen.Validate(diagram); !report.Valid || len(report.Issues) != 0 {
+		t.Fatalf("expected a clean report, got %+v", report)
+	}
+
+	broken := &codegen.Diagram{
+		Name: "broken",
+		Nodes: []codegen.Node{
+			{ID: "start", Data: codegen.NodeData{Label: "Start"}},
+			{ID: "d1", Data: codegen.NodeData{Label: "Declare", Properties: map[string]interface{}{"typeSpecifier": "N"}}},
+			{ID: "a1", Data: codegen.NodeData{Label: "Array"}},
+			{ID: "m1", Data: codegen.NodeData{Label: "add", Properties: map[string]interface{}{"operands": []interface{}{"'one'", "2"}}}},
+			{ID: "t1", Data: codegen.NodeData{Label: "Then"}},
+			{ID: "x1", Data: codegen.NodeData{Label: "Sleep", Properties: map[string]interface{}{"milliseconds": "10"}}},
+		},
+		Edges: []codegen.Edge{
+			{ID: "e1", Source: "start", Target: "d1", SourceHandle: "right"},
+			{ID: "e2", Source: "d1", Target: "m1", SourceHandle: "right"},
+			{ID: "e3", Source: "m1", Target: "t1", SourceHandle: "right"},
+			{ID: "e4", Source: "m1", Target: "ghost", SourceHandle: "right"},
+		},
+		NestingRelations: []codegen.NestingRelation{{ParentID: "d1", ChildID: "a1"}},
+	}
+	report := codegen.Validate(broken)
+	if report.Valid {
+		t.Fatal("expected errors")
+	}
+	found := make(map[string]string)
+	for _, is := range report.Issues {
+		found[is.Code+"/"+is.NodeID+is.EdgeID] = is.Severity
+	}
+	for _, want := range []string{
+		"missing_parameter/d1",
+		"type_mismatch/d1",
+		"type_mismatch/m1",
+		"misplaced_branch/t1",
+		"unknown_node/e4",
+		"disconnected/x1",
+	} {
+		if _, ok := found[want]; !ok {
+			t.Errorf("missing issue %s in %+v", want, report.Issues)
+		}
+	}
+	if report.Issues[0].Severity != codegen.SeverityError {
+		t.Errorf("errors should be listed first: %+v", report.Issues[0])
+	}
+}
+
+func TestDiagramFromCodeRoundTrip(t *testing.T) {
+	diagram, err := codegen.ParseDiagram([]byte(counterDiagram))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	original, err := codegen.Generate(diagram)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	rebuilt, report, err := codegen.FromCode(original.Code, "")
+	if err != nil {
+		t.Fatalf("from code: %v", err)
+	}
+	if !report.Complete || rebuilt.Name != "counter" {
+		t.Fatalf("expected a complete conversion of 'counter', got %q %+v", rebuilt.Name, report)
+	}
+	regenerated, err := codegen.Generate(rebuilt)
+	if err != nil {
+		t.Fatalf("regenerate: %v", err)
+	}
+	if regenerated.Code != original.Code {
+		t.Errorf("round trip changed the code:\n%s\nwant:\n%s", regenerated.Code, original.Code)
+	}
+}
+
+func TestDiagramFromCodeReportsUnmapped(t *testing.T) {
+	code := strings.Join([]string{
+		`declare(items, 'A', array('a', 'b'))`,
+		`setq(double, func(n) { mul(n, 2) })`,
+		`if(bigger(length(items), 1)) {`,
+		`  logPrint('many items')`,
+		`  addTo(items, 'c')`,
+		`} else {`,
+		`  setq(x, 'single')`,
+		`}`,
+		`treeSave(items, 'items.json')`,
+	}, "\n")
+	diagram, report, err := codegen.FromCode(code, "edited")
+	if err != nil {
+		t.Fatalf("from code: %v", err)
+	}
+	if report.Complete || len(report.Unmapped) != 2 {
+		t.Fatalf("expected two unmapped statements, got %+v", report.Unmapped)
+	}
+	if u := report.Unmapped[0]; !u.Inline || !strings.HasPrefix(u.Code, "addTo(") {
+		t.Errorf("addTo should be kept inline in the Then branch: %+v", u)
+	}
+	if u := report.Unmapped[1]; u.Inline || u.Line != 9 {
+		t.Errorf("treeSave should be reported at line 9: %+v", u)
+	}
+
+	res, err := codegen.Generate(diagram)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	for _, want := range []string{
+		"declare(items, 'A', array('a', 'b'))",
+		"setq(double, func(n) {\n  mul(n, 2)\n})",
+		"if(bigger(length(items), 1)) {\n  logPrint('many items')\n  addTo(items, 'c')\n}",
+		"else {\n  setq(x, 'single')\n}",
+	} {
+		if !strings.Contains(res.Code, want) {
+			t.Errorf("generated code lacks %q:\n%s", want, res.Code)
+		}
+	}
+}
+
+func TestGenerateSubDiagrams(t *testing.T) {
+	setq := func(id, variable, value string) codegen.Node {
+		return codegen.Node{ID: id, Data: codegen.NodeData{Label: "Set Q", Properties: map[string]interface{}{
+			"variableName": variable, "value": value, "valueType": "expression"}}}
+	}
+	subDiagram := func(id, name, result string, args ...interface{}) codegen.Node {
+		return codegen.Node{ID: id, Data: codegen.NodeData{Label: "Sub Diagram", Properties: map[string]interface{}{
+			"diagram": name, "arguments": args, "resultVariable": result}}}
+	}
+	chain := func(ids ...string) []codegen.Edge {
+		var edges []codegen.Edge
+		for i := 1; i < len(ids); i++ {
+			edges = append(edges, codegen.Edge{ID: "e" + ids[i], Source: ids[i-1], Target: ids[i], SourceHandle: "right"})
+		}
+		return edges
+	}
+	library := map[string]*codegen.Diagram{
+		"increment": {Name: "increment", Component: true, Parameters: []string{"n"},
+			Nodes: []codegen.Node{setq("i1", "next", "add(n, 1)")}},
+		"double plus one": {Name: "double plus one", Component: true, Parameters: []string{"n"},
+			Nodes: []codegen.Node{setq("d1", "twice", "mul(n, 2)"), subDiagram("d2", "increment", "", "twice")},
+			Edges: chain("d1", "d2")},
+		"loop": {Name: "loop", Nodes: []codegen.Node{subDiagram("l1", "loop", "")}},
+	}
+	resolve := func(name string) (*codegen.Diagram, error) {
+		if d, ok := library[name]; ok {
+			return d, nil
+		}
+		return nil, errors.New("diagram not found")
+	}
+
+	main := &codegen.Diagram{
+		Name: "main",
+		Nodes: []codegen.Node{
+			{ID: "start", Data: codegen.NodeData{Label: "Start"}},
+			setq("m1", "total", "4"),
+			subDiagram("m2", "double plus one", "result", "total"),
+		},
+		Edges: chain("start", "m1", "m2"),
+	}
+	if got := main.SubDiagrams(); len(got) != 1 || got[0] != "double plus one" {
+		t.Fatalf("unexpected sub-diagrams %v", got)
+	}
+	res, err := codegen.GenerateWithComponents(main, resolve)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	want := strings.Join([]string{
+		"// main",
+		"",
+		"setq(flow_increment, func(n) {",
+		"  setq(next, add(n, 1))",
+		"})",
+		"setq(flow_double_plus_one, func(n) {",
+		"  setq(twice, mul(n, 2))",
+		"  call(flow_increment, twice)",
+		"})",
+		"// Starting main",
+		"setq(total, 4)",
+		"setq(result, call(flow_double_plus_one, total))",
+	}, "\n")
+	if res.Code != want {
+		t.Fatalf("unexpected code:\n%s\nwant:\n%s", res.Code, want)
+	}
+	if mp, ok := res.SourceMap.Lookup(4); !ok || mp.NodeID != "d2" {
+		t.Errorf("the nested function should map to the block that uses it, got %+v", mp)
+	}
+
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	val, err := rt.ExecProgram(res.Code)
+	if err != nil {
+		t.Fatalf("exec generated code: %v", err)
+	}
+	if val != chariot.Number(9) {
+		t.Errorf("expected 9, got %v", val)
+	}
+
+	for name, wantErr := range map[string]string{"loop": "refers to itself", "missing": "diagram not found"} {
+		d := &codegen.Diagram{Name: "caller", Nodes: []codegen.Node{subDiagram("c1", name, "")}}
+		if _, err := codegen.GenerateWithComponents(d, resolve); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s: expected %q error, got %v", name, wantErr, err)
+		}
+	}
+}
+
+func TestValidateForListener(t *testing.T) {
+	diagram, err := codegen.ParseDiagram([]byte(counterDiagram))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	limits := codegen.ListenerLimits{Runtime: rt, Sandbox: &chariot.SandboxProfile{Name: "locked"}}
+	report, res := codegen.ValidateForListener(diagram, nil, limits)
+	if !report.Valid || res == nil || report.Cost == nil {
+		t.Fatalf("expected the counter diagram to pass, got %+v", report)
+	}
+	// The loop body runs an assumed 10 times
+	if report.Cost.LoopDepth != 1 || report.Cost.Score <= report.Cost.Calls {
+		t.Errorf("unexpected cost %+v", report.Cost)
+	}
+
+	limits.MaxCost = report.Cost.Score - 1
+	if report, _ := codegen.ValidateForListener(diagram, nil, limits); report.Valid || report.Issues[0].Code != "cost_exceeded" {
+		t.Errorf("expected cost_exceeded, got %+v", report.Issues)
+	}
+
+	// Saved editor code is checked as the listener would run it
+	diagram.Code = "sendEmail('ops@example.com', 'done', 'counter finished')\nadd('one', 2)"
+	diagram.SourceMap = &chariot.DiagramSourceMap{Mappings: []chariot.SourceMapping{{Line: 1, EndLine: 1, NodeID: "n9", Label: "Send Email"}}}
+	limits.MaxCost = 0
+	report, _ = codegen.ValidateForListener(diagram, nil, limits)
+	found := make(map[string]string)
+	for _, is := range report.Issues {
+		found[is.Code] = is.NodeID
+	}
+	if report.Valid || found["sandbox_denied"] != "n9" {
+		t.Errorf("expected sendEmail to be denied on block n9, got %+v", report.Issues)
+	}
+	if _, ok := found["lint_type"]; !ok {
+		t.Errorf("expected a type error, got %+v", report.Issues)
+	}
+}
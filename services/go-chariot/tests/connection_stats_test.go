@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+// stubDriver opens connections that only answer pings.
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) { return stubConn{}, nil }
+
+type stubConn struct{}
+
+func (stubConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (stubConn) Close() error                        { return nil }
+func (stubConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func init() {
+	sql.Register("chariot-stub", stubDriver{})
+}
+
+func TestOpenConnectionsTracksSQLNodes(t *testing.T) {
+	node := chariot.NewSQLNode("stats")
+	node.SetMeta("user", "u")
+	node.SetMeta("password", "p")
+	node.SetMeta("database", "d")
+	if err := node.Connect("chariot-stub", "localhost"); err != nil {
+		t.Fatal(err)
+	}
+	stats := chariot.OpenConnections()
+	if stats.SQLByDriver["chariot-stub"] != 1 || stats.SQLPools < 1 {
+		t.Fatalf("after connect: %+v", stats)
+	}
+	if err := node.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := chariot.OpenConnections(); stats.SQLByDriver["chariot-stub"] != 0 {
+		t.Fatalf("after close: %+v", stats)
+	}
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+func TestCSVDialectsAndViews(t *testing.T) {
+	setConfig(t, &cfg.ChariotConfig.DataPath, t.TempDir())
+	write := func(name string, content []byte) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(cfg.ChariotConfig.DataPath, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Semicolons, single quotes, comments and Latin-1 text
+	write("orders.csv", []byte("id;customer;zip;total;paid\n# exported nightly\n1;'M\xfcller; Anna';00123;250;true\n2;'O''Neil';02134;1200.5;false\n3;'Zhou';99999;4000;true\n"))
+	write("customers.csv", []byte("customer,country\nZhou,CN\nO'Neil,IE\n"))
+	write("plain.csv", []byte("1,a\n2,b\n"))
+
+	rt := createNamedRuntime("csv_dialect")
+	defer chariot.UnregisterRuntime("csv_dialect")
+	run := scriptRunner(t, rt)
+	rows := func(v chariot.Value) []interface{} {
+		t.Helper()
+		return v.(*chariot.JSONNode).GetJSONValue().([]interface{})
+	}
+
+	run(`setq(dialect, map('delimiter', ';', 'quote', "'", 'comment', '#', 'encoding', 'latin-1'))`)
+	loaded := rows(run(`loadCSV('orders.csv', true, dialect)`))
+	if len(loaded) != 3 {
+		t.Fatalf("loaded %d rows, want 3", len(loaded))
+	}
+	first := loaded[0].(map[string]interface{})
+	if first["customer"] != "Müller; Anna" || first["zip"] != "00123" || first["total"] != float64(250) || first["paid"] != true {
+		t.Fatalf("first row = %v", first)
+	}
+
+	// An explicit type that does not fit is an error
+	if _, err := rt.Evaluate(`loadCSV('orders.csv', true, map('delimiter', ';', 'quote', "'", 'comment', '#', 'types', map('customer', 'number')))`); err == nil {
+		t.Fatalf("expected an error for a customer typed as a number")
+	}
+
+	// Header detection
+	plain := rows(run(`loadCSV('plain.csv', true, map('header', 'auto'))`))
+	if len(plain) != 2 || plain[0].([]interface{})[0] != float64(1) {
+		t.Fatalf("headerless rows = %v", plain)
+	}
+
+	// csvLoad keeps the dialect and the column types in the node's metadata
+	run(`setq(node, csvNode('orders.csv', ';'))`)
+	run(`csvLoad(node, 'orders.csv', dialect)`)
+	if cell := run(`csvGetCell(node, 1, 'customer')`); cell != chariot.Str("O'Neil") {
+		t.Fatalf("csvGetCell = %v", cell)
+	}
+	node := run(`node`).(*chariot.CSVNode)
+	types, _ := node.GetMeta("columnTypes")
+	if total, _ := types.(*chariot.MapValue).Get("total"); total != chariot.Str("number") {
+		t.Fatalf("columnTypes = %v", types)
+	}
+
+	// Views
+	run(`setq(orders, csvOpen('orders.csv', dialect))`)
+	run(`setq(large, csvFilter(orders, func(row) { bigger(getProp(row, 'total'), 1000) }))`)
+	run(`setq(report, csvJoin(csvSelect(large, array('id', 'customer', 'total')), 'customers.csv', 'customer', map('type', 'left')))`)
+	joined := rows(run(`csvRows(report)`))
+	if len(joined) != 2 {
+		t.Fatalf("joined rows = %v", joined)
+	}
+	if r := joined[0].(map[string]interface{}); r["customer"] != "O'Neil" || r["country"] != "IE" || r["id"] != float64(2) {
+		t.Fatalf("first joined row = %v", r)
+	}
+	if limited := rows(run(`csvRows(orders, 1)`)); len(limited) != 1 {
+		t.Fatalf("csvRows with a limit = %v", limited)
+	}
+
+	run(`saveCSV(report, 'report.csv')`)
+	saved, err := os.ReadFile(filepath.Join(cfg.ChariotConfig.DataPath, "report.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "id,customer,total,country\n2,O'Neil,1200.5,IE\n3,Zhou,4000,CN\n"; string(saved) != want {
+		t.Fatalf("saved view = %q, want %q", saved, want)
+	}
+
+	if _, err := rt.Evaluate(`csvSelect(orders, 'missing')`); err == nil {
+		t.Fatalf("expected an error for an unknown column")
+	}
+}
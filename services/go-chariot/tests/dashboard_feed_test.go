@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+)
+
+// TestDashboardFeed verifies that a poll gets every section without a
+// cursor and only the changed sections with one.
+func TestDashboardFeed(t *testing.T) {
+	feed := handlers.NewDashboardFeed()
+	data := handlers.DashboardData{ServerStatus: handlers.ServerStatus{Status: "running"}}
+	first, err := feed.Update(data)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	full := feed.Since("")
+	if !full.Full || full.Cursor != first || full.Sections["server_status"] == nil || full.Sections["listeners"] == nil {
+		t.Fatalf("expected every section, got %+v", full)
+	}
+	if delta := feed.Since(first); delta.Full || len(delta.Sections) != 0 {
+		t.Fatalf("expected no changes, got %+v", delta)
+	}
+
+	if again, _ := feed.Update(data); again != first {
+		t.Errorf("cursor moved without a change: %s after %s", again, first)
+	}
+	data.Listeners = []handlers.ListenerInfo{{Name: "orders", Status: "running"}}
+	second, _ := feed.Update(data)
+	delta := feed.Since(first)
+	if delta.Full || delta.Cursor != second || len(delta.Sections) != 1 || delta.Sections["listeners"] == nil {
+		t.Fatalf("expected only the listeners, got %+v", delta)
+	}
+
+	if other := handlers.NewDashboardFeed().Since(second); !other.Full {
+		t.Error("a cursor from another feed was accepted")
+	}
+}
+
+// TestDiffJSON verifies the JSON Patch between two dashboards.
+func TestDiffJSON(t *testing.T) {
+	decode := func(s string) interface{} {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	old := decode(`{"status": "running", "sessions": [{"id": "a", "runs": 1}, {"id": "b"}, {"id": "c"}], "a/b": 1, "gone": true}`)
+	new := decode(`{"status": "running", "sessions": [{"id": "a", "runs": 2}], "a/b": 2, "added": [1]}`)
+
+	got, _ := json.Marshal(handlers.DiffJSON(old, new))
+	want := `[{"op":"replace","path":"/a~1b","value":2},` +
+		`{"op":"add","path":"/added","value":[1]},` +
+		`{"op":"remove","path":"/gone","value":null},` +
+		`{"op":"replace","path":"/sessions/0/runs","value":2},` +
+		`{"op":"remove","path":"/sessions/2","value":null},` +
+		`{"op":"remove","path":"/sessions/1","value":null}]`
+	if string(got) != want {
+		t.Errorf("unexpected patch\n got %s\nwant %s", got, want)
+	}
+	if ops := handlers.DiffJSON(old, old); len(ops) != 0 {
+		t.Errorf("expected no operations, got %v", ops)
+	}
+}
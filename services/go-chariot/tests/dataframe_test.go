@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+func TestDataFrameOperations(t *testing.T) {
+	setConfig(t, &cfg.ChariotConfig.DataPath, t.TempDir())
+	orders := "id,region,customer,total\n1,east,a,100\n2,west,b,2500\n3,east,c,\n4,north,d,1200\n5,west,b,40\n6,east,a,900\n"
+	if err := os.WriteFile(filepath.Join(cfg.ChariotConfig.DataPath, "orders.csv"), []byte(orders), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rt := createNamedRuntime("dataframe")
+	defer chariot.UnregisterRuntime("dataframe")
+	run := scriptRunner(t, rt)
+	rows := func(script string) []interface{} {
+		t.Helper()
+		return run(`tableToJSON(` + script + `)`).(*chariot.JSONNode).GetJSONValue().([]interface{})
+	}
+
+	run(`setq(orders, tableFromCSV('orders.csv'))`)
+	if n := run(`tableRowCount(orders)`); n != chariot.Number(6) {
+		t.Fatalf("tableRowCount = %v", n)
+	}
+	if typ := run(`valueType(orders)`); typ != chariot.Str("R") {
+		t.Fatalf("valueType = %v", typ)
+	}
+
+	// Both forms of filter; the null total never matches
+	large := rows(`tableFilter(orders, 'total', '>=', 900)`)
+	if len(large) != 3 {
+		t.Fatalf("column filter = %v", large)
+	}
+	west := rows(`tableFilter(orders, func(row) { equal(getProp(row, 'region'), 'west') })`)
+	if len(west) != 2 || west[0].(map[string]interface{})["id"] != float64(2) {
+		t.Fatalf("function filter = %v", west)
+	}
+
+	// Sorting puts nulls last
+	sorted := rows(`tableSort(orders, array('region', '-total'))`)
+	var ids []interface{}
+	for _, r := range sorted {
+		ids = append(ids, r.(map[string]interface{})["id"])
+	}
+	if want := []interface{}{6.0, 1.0, 3.0, 4.0, 2.0, 5.0}; !equalSlices(ids, want) {
+		t.Fatalf("sorted ids = %v, want %v", ids, want)
+	}
+
+	// Groups come in order of first appearance
+	grouped := rows(`tableGroupBy(orders, 'region', map('revenue', 'sum(total)', 'orders', 'count()', 'largest', 'max(total)'))`)
+	if len(grouped) != 3 {
+		t.Fatalf("grouped = %v", grouped)
+	}
+	east := grouped[0].(map[string]interface{})
+	if east["region"] != "east" || east["revenue"] != float64(1000) || east["orders"] != float64(3) || east["largest"] != float64(900) {
+		t.Fatalf("east group = %v", east)
+	}
+	if _, err := rt.Evaluate(`tableGroupBy(orders, 'region', map('x', 'sum(customer)'))`); err == nil {
+		t.Fatalf("expected an error summing a string column")
+	}
+
+	// Join with a table made from JSON
+	run(`setq(customers, tableFromJSON('[{"id": "a", "name": "Ann"}, {"id": "b", "name": "Bo"}]'))`)
+	joined := rows(`tableJoin(tableSelect(orders, array('id', 'customer')), customers, array('customer', 'id'), map('type', 'left'))`)
+	if len(joined) != 6 {
+		t.Fatalf("joined = %v", joined)
+	}
+	if r := joined[1].(map[string]interface{}); r["name"] != "Bo" {
+		t.Fatalf("second joined row = %v", r)
+	}
+	if r := joined[2].(map[string]interface{}); r["name"] != nil {
+		t.Fatalf("unmatched joined row = %v", r)
+	}
+
+	run(`tableToCSV(tableSelect(tableFilter(orders, 'region', '=', 'west'), array('id', 'total')), 'west.csv')`)
+	saved, err := os.ReadFile(filepath.Join(cfg.ChariotConfig.DataPath, "west.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "id,total\n2,2500\n5,40\n"; string(saved) != want {
+		t.Fatalf("saved table = %q, want %q", saved, want)
+	}
+
+	if _, err := rt.Evaluate(`tableSelect(orders, 'missing')`); err == nil {
+		t.Fatalf("expected an error for an unknown column")
+	}
+	if _, err := rt.Evaluate(`tableFilter(orders, 'total', '~', 1)`); err == nil {
+		t.Fatalf("expected an error for an unknown operator")
+	}
+}
+
+func equalSlices(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDataFrameArrow(t *testing.T) {
+	setConfig(t, &cfg.ChariotConfig.DataPath, t.TempDir())
+
+	rt := createNamedRuntime("dataframe_arrow")
+	defer chariot.UnregisterRuntime("dataframe_arrow")
+	run := scriptRunner(t, rt)
+
+	run(`setq(data, tableFromJSON('[{"id": 1, "name": "a", "ok": true}, {"id": 2.5, "ok": false}, {"id": null, "name": "c"}]'))`)
+	for _, name := range []string{"data.arrow", "data.arrows"} {
+		run(`tableToArrow(data, '` + name + `', map('batchSize', 2))`)
+		saved, err := os.ReadFile(filepath.Join(cfg.ChariotConfig.DataPath, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isFile := string(saved[:6]) == "ARROW1"; isFile != (name == "data.arrow") {
+			t.Fatalf("%s written in the wrong format", name)
+		}
+		back := run(`tableToJSON(tableFromArrow('` + name + `'))`).(*chariot.JSONNode).GetJSONValue().([]interface{})
+		if len(back) != 3 {
+			t.Fatalf("%s read back %v", name, back)
+		}
+		second := back[1].(map[string]interface{})
+		third := back[2].(map[string]interface{})
+		if second["id"] != 2.5 || second["name"] != nil || second["ok"] != false || third["id"] != nil || third["name"] != "c" {
+			t.Fatalf("%s read back %v", name, back)
+		}
+	}
+
+	if _, err := rt.Evaluate(`tableToArrow(data, 'x.arrow', map('format', 'parquet'))`); err == nil {
+		t.Fatalf("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/deadletter"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/webhooks"
+)
+
+// TestDeadLetterStore verifies that dead letters are listed newest first,
+// count retries, persist across restarts, are purged by filter, and that the
+// oldest are dropped past the limit.
+func TestDeadLetterStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dead_letters.json")
+	s, err := deadletter.Open(deadletter.Options{File: file, Max: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := s.Add(deadletter.Letter{Source: deadletter.SourceListener, Target: "orders", Payload: json.RawMessage(`{"order":1}`), Error: "boom"})
+	if err != nil || first.ID == "" || first.Attempts != 1 {
+		t.Fatalf("added %+v, %v", first, err)
+	}
+	if _, err := s.Add(deadletter.Letter{Source: deadletter.SourceWebhook, Target: "sub-1", Event: webhooks.ExecutionFailed, Error: "status 500", Attempts: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.List(deadletter.Filter{}, 0); len(got) != 2 || got[0].Source != deadletter.SourceWebhook {
+		t.Fatalf("list %+v, want newest first", got)
+	}
+	if got := s.List(deadletter.Filter{Target: "orders"}, 0); len(got) != 1 || got[0].ID != first.ID {
+		t.Fatalf("list by target %+v", got)
+	}
+	if l, err := s.Failed(first.ID, 1, "boom again"); err != nil || l.Attempts != 2 || l.Error != "boom again" {
+		t.Fatalf("failed retry %+v, %v", l, err)
+	}
+	if _, err := s.Failed("missing", 1, "x"); !errors.Is(err, deadletter.ErrNotFound) {
+		t.Fatalf("failed retry of an unknown letter: %v", err)
+	}
+
+	reopened, err := deadletter.Open(deadletter.Options{File: file, Max: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := reopened.Get(first.ID)
+	if payload, _ := json.Marshal(l.Payload); err != nil || l.Attempts != 2 || string(payload) != `{"order":1}` {
+		t.Fatalf("reopened letter %+v, %v", l, err)
+	}
+	if c := reopened.Counts(); c.Total != 2 || c.BySource[deadletter.SourceListener] != 1 || c.BySource[deadletter.SourceWebhook] != 1 {
+		t.Fatalf("counts %+v", c)
+	}
+
+	if n, err := reopened.Purge(deadletter.Filter{Source: deadletter.SourceWebhook}); err != nil || n != 1 {
+		t.Fatalf("purged %d, %v", n, err)
+	}
+	if n, _ := reopened.Purge(deadletter.Filter{Before: time.Now().Add(-time.Hour)}); n != 0 {
+		t.Fatalf("purged %d letters older than an hour", n)
+	}
+	for i := 0; i < 3; i++ {
+		reopened.Add(deadletter.Letter{Source: deadletter.SourceListener, Target: "orders", Error: "boom"})
+	}
+	if _, err := reopened.Get(first.ID); !errors.Is(err, deadletter.ErrNotFound) {
+		t.Fatalf("oldest letter kept past the limit: %v", err)
+	}
+	if c := reopened.Counts(); c.Total != 3 || c.Dropped != 1 {
+		t.Fatalf("counts past the limit %+v", c)
+	}
+	if err := reopened.Remove(reopened.List(deadletter.Filter{}, 1)[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Remove("missing"); !errors.Is(err, deadletter.ErrNotFound) {
+		t.Fatalf("remove of an unknown letter: %v", err)
+	}
+}
+
+// TestWebhookGiveUp verifies that a delivery that gives up is handed to the
+// OnGiveUp hook, and that a redelivery reports its outcome to its own
+// callback instead.
+func TestWebhookGiveUp(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	d, err := webhooks.New(webhooks.Options{MaxAttempts: 2, Backoff: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	type gaveUp struct {
+		sub      webhooks.Subscription
+		ev       webhooks.Event
+		attempts int
+		err      error
+	}
+	gaveUps := make(chan gaveUp, 4)
+	d.OnGiveUp(func(sub webhooks.Subscription, ev webhooks.Event, attempts int, err error) {
+		gaveUps <- gaveUp{sub, ev, attempts, err}
+	})
+	sub, err := d.Create(webhooks.Subscription{URL: srv.URL, Events: []string{"*"}, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Notify(webhooks.AgentStopped, map[string]interface{}{"agent": "a"})
+	var g gaveUp
+	select {
+	case g = <-gaveUps:
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery did not give up")
+	}
+	if g.sub.ID != sub.ID || g.sub.Secret != "" || g.attempts != 2 || g.ev.Type != webhooks.AgentStopped || g.err == nil {
+		t.Fatalf("gave up with %+v", g)
+	}
+
+	outcomes := make(chan error, 1)
+	failing.Store(false)
+	if err := d.Redeliver(sub.ID, g.ev, func(attempts int, err error) { outcomes <- err }); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-outcomes:
+		if err != nil {
+			t.Fatalf("redelivery failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("redelivery outcome not reported")
+	}
+	select {
+	case g := <-gaveUps:
+		t.Fatalf("redelivery reported to OnGiveUp: %+v", g)
+	default:
+	}
+	if err := d.Redeliver("missing", g.ev, nil); !errors.Is(err, webhooks.ErrNotFound) {
+		t.Fatalf("redelivery to an unknown subscription: %v", err)
+	}
+}
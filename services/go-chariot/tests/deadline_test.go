@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+func TestWithTimeout(t *testing.T) {
+	rt := ch.NewRuntime()
+	ch.RegisterAll(rt)
+	rt.Register("sqlQuery", func(args ...ch.Value) (ch.Value, error) {
+		select {
+		case <-time.After(time.Second):
+			return ch.NewArray(), nil
+		case <-rt.Context().Done():
+			return nil, rt.Context().Err()
+		}
+	})
+	// Like a plugin, it cannot be cut short
+	ch.MeterFunctions("slowPlugin")
+	rt.Register("slowPlugin", func(args ...ch.Value) (ch.Value, error) {
+		time.Sleep(100 * time.Millisecond)
+		return ch.Str("late"), nil
+	})
+
+	val, err := rt.ExecProgram("deadlineRemaining()")
+	if err != nil || val != ch.Number(-1) {
+		t.Errorf("expected -1 without a deadline, got %v, %v", val, err)
+	}
+	val, err = rt.ExecProgram("withTimeout(1000, func() { deadlineRemaining() })")
+	if n, ok := val.(ch.Number); err != nil || !ok || n <= 0 || n > 1000 {
+		t.Errorf("expected the time left inside withTimeout, got %v, %v", val, err)
+	}
+
+	// A loop stops and the fallback is returned
+	start := time.Now()
+	val, err = rt.ExecProgram("setq(i, 0)\nwithTimeout(30, func() { while(true) { setq(i, add(i, 1)) } }, 'partial')")
+	if err != nil || val != ch.Str("partial") {
+		t.Errorf("expected the fallback, got %v, %v", val, err)
+	}
+	// So is a slow external call, without waiting for it
+	val, err = rt.ExecProgram("withTimeout(30, func() { sqlQuery('db', 'SELECT 1') }, 'cached')")
+	if err != nil || val != ch.Str("cached") {
+		t.Errorf("expected the fallback, got %v, %v", val, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("giving up took %v", elapsed)
+	}
+	// And the answer of one that returns late is dropped
+	val, err = rt.ExecProgram("withTimeout(30, func() { setq(rows, slowPlugin())\n'fresh' }, 'cached')")
+	if err != nil || val != ch.Str("cached") {
+		t.Errorf("expected the fallback, got %v, %v", val, err)
+	}
+
+	// Without a fallback it fails
+	_, err = rt.ExecProgram("withTimeout(10, func() { while(true) { setq(i, 1) } })")
+	if !errors.Is(err, ch.ErrDeadlineExceeded) {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+	// Its result is returned when it finishes in time, and the deadline ends with it
+	val, err = rt.ExecProgram("withTimeout(1000, func() { add(1, 2) })\ndeadlineRemaining()")
+	if err != nil || val != ch.Number(-1) {
+		t.Errorf("expected no deadline after withTimeout, got %v, %v", val, err)
+	}
+}
@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+// TestDryRun verifies that a dry run skips writes, lists them as planned
+// changes and leaves the runtime writing again once it is stopped.
+func TestDryRun(t *testing.T) {
+	prev := cfg.ChariotConfig.DataPath
+	cfg.ChariotConfig.DataPath = t.TempDir()
+	t.Cleanup(func() { cfg.ChariotConfig.DataPath = prev })
+
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+
+	rt.StartDryRun()
+	got, err := rt.ExecProgram("setq(ok, writeFile('planned.txt', 'hello'))\nsetq(n, sqlExecute('db', 'DELETE FROM orders'))\nand(ok, equal(n, 0), not(fileExists('planned.txt')))")
+	report := rt.StopDryRun()
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if got != chariot.Bool(true) {
+		t.Fatalf("expected the skipped writes to answer like successful ones, got %v", got)
+	}
+	if report == nil || len(report.Changes) != 2 || report.Changes[0].Func != "writeFile" || report.Changes[1].Func != "sqlExecute" {
+		t.Fatalf("unexpected planned changes %+v", report)
+	}
+	if args := report.Changes[0].Args; len(args) != 2 || args[0] != "planned.txt" || args[1] != "hello" {
+		t.Fatalf("unexpected planned arguments %v", args)
+	}
+	if report.Counts["writeFile"] != 1 || report.Counts["sqlExecute"] != 1 {
+		t.Fatalf("unexpected counts %v", report.Counts)
+	}
+	if rt.StopDryRun() != nil {
+		t.Fatal("expected no report once the dry run stopped")
+	}
+
+	got, err = rt.ExecProgram("writeFile('planned.txt', 'hello')\nfileExists('planned.txt')")
+	if err != nil || got != chariot.Bool(true) {
+		t.Fatalf("expected the write after the dry run, got %v, %v", got, err)
+	}
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+)
+
+func TestExecutionMetricsSummary(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	stats := handlers.NewExecutionStats()
+	run := func(ago time.Duration, ms int, file, errMsg string) {
+		done := now.Add(-ago)
+		stats.Record(file, done.Add(-time.Duration(ms)*time.Millisecond), done, errMsg)
+	}
+	// Twenty runs of 10..200 ms in the last hour, a quarter of them failing
+	for i := 1; i <= 20; i++ {
+		errMsg := ""
+		if i%4 == 0 {
+			errMsg = "boom"
+		}
+		run(time.Duration(i)*time.Minute, i*10, "etl.ch", errMsg)
+	}
+	run(5*time.Minute, 5, "report.ch", "missing table")
+	run(2*time.Hour, 5, "old.ch", "too old for 1h")
+
+	m := stats.Summary(time.Hour, now)
+	if m.Window != "1h" || m.Total != 21 || m.Failed != 6 || m.Succeeded != 15 {
+		t.Fatalf("window %s: total %d, failed %d, succeeded %d", m.Window, m.Total, m.Failed, m.Succeeded)
+	}
+	if m.P50Ms != 100 || m.P95Ms != 190 {
+		t.Errorf("p50 = %v, p95 = %v", m.P50Ms, m.P95Ms)
+	}
+	if got := m.PerMinute; got != 21.0/60 {
+		t.Errorf("per minute = %v", got)
+	}
+	if len(m.Series) != 60 || m.BucketSeconds != 60 {
+		t.Fatalf("series of %d buckets of %ds", len(m.Series), m.BucketSeconds)
+	}
+	var counted int
+	for _, b := range m.Series {
+		counted += b.Succeeded + b.Failed
+	}
+	if counted != m.Total {
+		t.Errorf("series counts %d executions, want %d", counted, m.Total)
+	}
+	if len(m.TopFailing) != 2 || m.TopFailing[0].Filename != "etl.ch" || m.TopFailing[0].Failures != 5 || m.TopFailing[0].Runs != 20 {
+		t.Fatalf("top failing = %+v", m.TopFailing)
+	}
+	if f := m.TopFailing[1]; f.Filename != "report.ch" || f.LastError != "missing table" {
+		t.Errorf("second failing script = %+v", f)
+	}
+
+	if day := stats.Summary(24*time.Hour, now); day.Total != 22 || len(day.TopFailing) != 3 {
+		t.Errorf("24h: total %d, %d failing scripts", day.Total, len(day.TopFailing))
+	}
+	if empty := handlers.NewExecutionStats().Summary(15*time.Minute, now); empty.Total != 0 || empty.SuccessRate != 0 || len(empty.TopFailing) != 0 {
+		t.Errorf("empty summary = %+v", empty)
+	}
+}
+
+func TestDashboardMetricsWindow(t *testing.T) {
+	sm := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	session := sm.NewSession("metrics", logs.NewZapLogger(), "metrics-token")
+	defer sm.EndSession("metrics-token")
+	var h handlers.Handlers
+
+	if res := callWithSession(t, session, h.HandleDashboardMetrics, http.MethodGet, "/api/dashboard/metrics?window=6h", ""); res.Result != "OK" {
+		t.Fatalf("window=6h: %v", res.Data)
+	}
+	if res := callWithSession(t, session, h.HandleDashboardMetrics, http.MethodGet, "/api/dashboard/metrics?window=2d", ""); res.Result != "ERROR" {
+		t.Fatal("an unknown window was accepted")
+	}
+}
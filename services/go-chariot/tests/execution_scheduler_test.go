@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+)
+
+// acquireAsync queues an execution and reports its priority on started once
+// it gets the worker; the worker is released when release is closed.
+func acquireAsync(t *testing.T, s *handlers.ExecutionScheduler, priority string, started chan<- string, release <-chan struct{}) {
+	go func() {
+		done, _, err := s.Acquire(context.Background(), priority)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		started <- priority
+		<-release
+		done()
+	}()
+}
+
+// waitQueued waits until n executions are queued.
+func waitQueued(t *testing.T, s *handlers.ExecutionScheduler, n int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Status().Queued != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d queued executions, status %+v", n, s.Status())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestExecutionPriorities(t *testing.T) {
+	s := handlers.NewExecutionScheduler(1, 0)
+	first, _, err := s.Acquire(context.Background(), handlers.PriorityBackfill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan string, 3)
+	release := make(chan struct{})
+	defer close(release)
+	acquireAsync(t, s, handlers.PriorityBackfill, started, release)
+	waitQueued(t, s, 1)
+	acquireAsync(t, s, handlers.PriorityScheduled, started, release)
+	waitQueued(t, s, 2)
+	acquireAsync(t, s, handlers.PriorityInteractive, started, release)
+	waitQueued(t, s, 3)
+
+	first()
+	if p := <-started; p != handlers.PriorityInteractive {
+		t.Errorf("expected the interactive run to start first, got %s", p)
+	}
+	status := s.Status()
+	if status.Running != 1 || status.Queued != 2 || status.Priorities[0].Started != 1 || status.Priorities[2].Queued != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	// A run that gives up leaves the queue
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := s.Acquire(ctx, handlers.PriorityInteractive); err == nil {
+		t.Errorf("expected the wait to time out")
+	}
+	if status := s.Status(); status.Queued != 2 || status.Priorities[0].Abandoned != 1 {
+		t.Errorf("unexpected status after giving up %+v", status)
+	}
+}
+
+func TestExecutionStarvation(t *testing.T) {
+	s := handlers.NewExecutionScheduler(1, 20*time.Millisecond)
+	first, _, _ := s.Acquire(context.Background(), handlers.PriorityInteractive)
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	defer close(release)
+	acquireAsync(t, s, handlers.PriorityBackfill, started, release)
+	waitQueued(t, s, 1)
+	time.Sleep(30 * time.Millisecond)
+	acquireAsync(t, s, handlers.PriorityInteractive, started, release)
+	waitQueued(t, s, 2)
+
+	first()
+	if p := <-started; p != handlers.PriorityBackfill {
+		t.Errorf("expected the backfill waiting past the maximum to start first, got %s", p)
+	}
+	if promoted := s.Status().Priorities[2].Promoted; promoted != 1 {
+		t.Errorf("expected the backfill to count as promoted, got %d", promoted)
+	}
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+)
+
+// TestFileLeases verifies that edit leases block other sessions and end with
+// the session that acquired them.
+func TestFileLeases(t *testing.T) {
+	sm := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	logger := logs.NewZapLogger()
+	alice := sm.NewSession("alice", logger, "lease-token-alice")
+	bob := sm.NewSession("bob", logger, "lease-token-bob")
+
+	leases := handlers.NewFileLeases()
+	path := "/data/files/report.ch"
+
+	lease, held := leases.Acquire(alice, path, "report.ch", "global")
+	if held != nil || lease == nil {
+		t.Fatalf("expected alice to acquire the lease, got conflict %+v", held)
+	}
+	if again, held := leases.Acquire(alice, path, "report.ch", "global"); held != nil || again != lease {
+		t.Fatalf("expected re-acquire by the holder to return the same lease")
+	}
+
+	if _, held := leases.Acquire(bob, path, "report.ch", "global"); held == nil || held.Holder != "alice" {
+		t.Fatalf("expected bob to be blocked by alice, got %+v", held)
+	}
+	if c := leases.Conflict(bob, path); c == nil || c.Holder != "alice" {
+		t.Fatalf("expected a conflict for bob, got %+v", c)
+	}
+	if c := leases.Conflict(alice, path); c != nil {
+		t.Fatalf("holder should not conflict with its own lease")
+	}
+	if leases.Release(bob, path) {
+		t.Fatalf("bob must not release alice's lease")
+	}
+	if got := leases.Under("/data/files"); len(got) != 1 || got[0].File != "report.ch" {
+		t.Fatalf("expected one lease under /data/files, got %+v", got)
+	}
+
+	if err := sm.EndSession("lease-token-alice"); err != nil {
+		t.Fatalf("EndSession: %v", err)
+	}
+	if c := leases.Conflict(bob, path); c != nil {
+		t.Fatalf("expected the lease to end with alice's session, still held by %s", c.Holder)
+	}
+	if _, held := leases.Acquire(bob, path, "report.ch", "global"); held != nil {
+		t.Fatalf("expected bob to acquire the released lease")
+	}
+	if !leases.Release(bob, path) {
+		t.Fatalf("expected bob to release the lease")
+	}
+	sm.EndSession("lease-token-bob")
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/labstack/echo/v4"
+)
+
+// TestFunctionDocComments verifies that /// comments are attached to the
+// function they precede, survive the function library format, and are
+// parsed into the reference entry.
+func TestFunctionDocComments(t *testing.T) {
+	rt := createNamedRuntime("function_docs")
+	defer ch.UnregisterRuntime("function_docs")
+
+	_, err := rt.ExecProgram(`
+// not part of the doc
+/// Total of an order line.
+/// Discounts are not applied.
+/// @param price unit price
+/// @param qty number of units
+/// @return the total
+registerFunction('lineTotal', func(price: N, qty: N): N { mul(price, qty) })
+
+/// Orphaned comment
+
+registerFunction('plain', func(x) { x })`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fns := rt.ListUserFunctionsMap()
+	if fns["plain"].Doc != "" {
+		t.Errorf("comment separated by a blank line was attached: %q", fns["plain"].Doc)
+	}
+
+	restored, err := ch.MapToFunctionValue(ch.FunctionValueToMap(fns["lineTotal"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := ch.DocumentFunction("lineTotal", restored)
+	if d.Summary != "Total of an order line.\nDiscounts are not applied." {
+		t.Errorf("unexpected summary %q", d.Summary)
+	}
+	if d.Signature != "lineTotal(price: N, qty: N): N" || d.Returns != "the total" {
+		t.Errorf("unexpected entry %+v", d)
+	}
+	if len(d.Params) != 2 || d.Params[0].Description != "unit price" || d.Params[1].Type != "N" {
+		t.Errorf("unexpected params %+v", d.Params)
+	}
+
+	// Functions saved from the editor keep the comment too
+	if err := rt.SaveFunction("double", "/// Twice x.\nfunction double(x: N): N { mul(x, 2) }", ""); err != nil {
+		t.Fatal(err)
+	}
+	if d := ch.DocumentFunction("double", rt.ListUserFunctionsMap()["double"]); d.Summary != "Twice x." || d.Undocumented {
+		t.Errorf("unexpected entry %+v", d)
+	}
+}
+
+func TestFunctionDocsEndpoint(t *testing.T) {
+	var h handlers.Handlers
+	get := func(query string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/docs/functions"+query, nil)
+		rec := httptest.NewRecorder()
+		if err := h.FunctionDocs(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	var resp struct {
+		Data struct {
+			Builtins []ch.FunctionDoc `json:"builtins"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(get("").Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, d := range resp.Data.Builtins {
+		if d.Name == "add" {
+			found = d.Signature == "add(a, b)" && d.Category == "math" && d.Example != ""
+		}
+	}
+	if !found {
+		t.Errorf("add missing from the builtins or without its signature")
+	}
+
+	rec := get("?format=html")
+	if ct := rec.Header().Get(echo.HeaderContentType); !strings.HasPrefix(ct, echo.MIMETextHTML) {
+		t.Errorf("expected HTML, got %s", ct)
+	}
+	if !strings.Contains(rec.Body.String(), `id="builtin-add"`) {
+		t.Errorf("builtin missing from the HTML reference")
+	}
+}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+type usageLog []ch.LogEntry
+
+func (l *usageLog) Append(e ch.LogEntry) { *l = append(*l, e) }
+
+func usageOf(entries []ch.UsageEntry, name string) (ch.UsageEntry, bool) {
+	for _, e := range entries {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return ch.UsageEntry{}, false
+}
+
+// TestFunctionUsage verifies that calls of stored functions and executions
+// of files are counted, that a deprecated function warns once per log, and
+// that usage and deprecations survive a save and load.
+func TestFunctionUsage(t *testing.T) {
+	rt := createNamedRuntime("function_usage")
+	defer ch.UnregisterRuntime("function_usage")
+	fn, err := rt.ExecProgram("func(x) { mul(x, 2) }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.RegisterFunction("usageDouble", fn.(*ch.FunctionValue))
+	if _, err := rt.ExecProgram("usageDouble(1)\nusageDouble(2)"); err != nil {
+		t.Fatal(err)
+	}
+	ch.RecordFileUse("usage/report.ch")
+
+	report := ch.Usage("usageIdle")
+	if e, ok := usageOf(report.Functions, "usageDouble"); !ok || e.Calls != 2 || e.LastUsed.IsZero() {
+		t.Errorf("expected 2 calls of usageDouble, got %+v", e)
+	}
+	if e, ok := usageOf(report.Functions, "usageIdle"); !ok || e.Calls != 0 {
+		t.Errorf("expected the never called function listed, got %+v (%v)", e, ok)
+	}
+	if e, ok := usageOf(report.Files, "usage/report.ch"); !ok || e.Calls != 1 {
+		t.Errorf("expected the file counted once, got %+v", e)
+	}
+
+	ch.DeprecateFunction("usageDouble", "use usageTriple")
+	defer ch.UndeprecateFunction("usageDouble")
+	var log usageLog
+	rt.SetLogWriter(&log)
+	if _, err := rt.ExecProgram("usageDouble(3)\nusageDouble(4)"); err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 1 || log[0].Level != "WARN" || !strings.Contains(log[0].Message, "use usageTriple") {
+		t.Errorf("expected one deprecation warning, got %+v", log)
+	}
+
+	file := filepath.Join(t.TempDir(), "usage.json")
+	if err := ch.SaveUsage(file); err != nil {
+		t.Fatal(err)
+	}
+	ch.UndeprecateFunction("usageDouble")
+	if err := ch.LoadUsage(file); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := usageOf(ch.Usage().Functions, "usageDouble"); e.Calls != 4 || !e.Deprecated || e.Note != "use usageTriple" {
+		t.Errorf("expected usage and deprecation restored, got %+v", e)
+	}
+}
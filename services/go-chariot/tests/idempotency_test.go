@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/labstack/echo/v4"
+)
+
+// TestIdempotencyKey verifies that a repeated Idempotency-Key is answered
+// with the first response, that the key cannot be reused for another
+// request, and that refused requests do not use up the key.
+func TestIdempotencyKey(t *testing.T) {
+	var h handlers.Handlers
+	runs, status := 0, http.StatusOK
+	handler := h.Idempotent(func(c echo.Context) error {
+		runs++
+		return c.JSON(status, map[string]int{"run": runs})
+	})
+	call := func(user, key, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/execute", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.Set("session", &chariot.Session{UserID: user})
+		if err := handler(c); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	first := call("ivy", "order-42", `{"program":"1"}`)
+	again := call("ivy", "order-42", `{"program":"1"}`)
+	if runs != 1 || again.Body.String() != first.Body.String() || again.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected the first response replayed, got %d runs and %q", runs, again.Body.String())
+	}
+	if rec := call("ivy", "order-42", `{"program":"2"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused for another request: status %d", rec.Code)
+	}
+	if call("jon", "order-42", `{"program":"1"}`); runs != 2 {
+		t.Errorf("another user's key was shared: %d runs", runs)
+	}
+
+	status = http.StatusTooManyRequests
+	call("ivy", "order-43", `{"program":"1"}`)
+	status = http.StatusOK
+	if rec := call("ivy", "order-43", `{"program":"1"}`); runs != 4 || rec.Code != http.StatusOK {
+		t.Errorf("refused request was replayed: %d runs, status %d", runs, rec.Code)
+	}
+}
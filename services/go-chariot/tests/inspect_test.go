@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+func inspectTestState(orders []interface{}, extra map[string]interface{}) map[string]interface{} {
+	globals := map[string]interface{}{
+		"orders":   orders,
+		"customer": map[string]interface{}{"name": "Ada", "address": map[string]interface{}{"city": "London"}},
+		"limit":    10,
+	}
+	for k, v := range extra {
+		globals[k] = v
+	}
+	return map[string]interface{}{
+		"globals":   globals,
+		"variables": map[string]interface{}{},
+	}
+}
+
+// TestInspectScopedQueries verifies path selection, depth limits and paging.
+func TestInspectScopedQueries(t *testing.T) {
+	in := chariot.NewRuntimeInspector()
+	state := inspectTestState([]interface{}{"a", "b", "c", "d"}, nil)
+
+	res, err := in.Inspect(state, chariot.InspectQuery{Path: []string{"globals", "orders"}, Offset: 1, Limit: 2})
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if res.Kind != "array" || res.Total != 4 || !reflect.DeepEqual(res.Keys, []string{"1", "2"}) {
+		t.Fatalf("unexpected page: kind=%s total=%d keys=%v", res.Kind, res.Total, res.Keys)
+	}
+	if res.Entries["1"] != "b" || res.Entries["2"] != "c" {
+		t.Fatalf("unexpected entries: %v", res.Entries)
+	}
+
+	res, err = in.Inspect(state, chariot.InspectQuery{Path: []string{"globals"}, Depth: 1})
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	customer := res.Entries["customer"].(map[string]interface{})
+	address, ok := customer["address"].(map[string]interface{})
+	if !ok || address["$truncated"] != true || address["size"] != 1 ||
+		!reflect.DeepEqual(address["path"], []string{"globals", "customer", "address"}) {
+		t.Fatalf("expected customer.address to be truncated, got %v", customer["address"])
+	}
+
+	res, err = in.Inspect(state, chariot.InspectQuery{Path: []string{"globals", "customer", "address", "city"}})
+	if err != nil || res.Kind != "value" || res.Value != "London" {
+		t.Fatalf("expected the city value, got %+v (%v)", res, err)
+	}
+
+	if _, err := in.Inspect(state, chariot.InspectQuery{Path: []string{"globals", "missing"}}); !errors.Is(err, chariot.ErrInspectPath) {
+		t.Fatalf("expected ErrInspectPath, got %v", err)
+	}
+}
+
+// TestInspectDiff verifies that a cursor returns only the entries that
+// changed, and that an unknown cursor falls back to a full listing.
+func TestInspectDiff(t *testing.T) {
+	in := chariot.NewRuntimeInspector()
+	full, err := in.Inspect(inspectTestState([]interface{}{"a"}, map[string]interface{}{"gone": true}), chariot.InspectQuery{})
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if full.Diff || full.Entries["globals"] == nil {
+		t.Fatalf("expected a full listing by section, got %+v", full)
+	}
+
+	diff, err := in.Inspect(inspectTestState([]interface{}{"a", "b"}, map[string]interface{}{"added": 1}), chariot.InspectQuery{Since: full.Cursor})
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if !diff.Diff || diff.Cursor <= full.Cursor {
+		t.Fatalf("expected a diff with a newer cursor, got %+v", diff)
+	}
+	changed := map[string]bool{}
+	for _, ch := range diff.Changed {
+		changed[ch.Path[0]+"."+ch.Path[1]] = true
+	}
+	if !reflect.DeepEqual(changed, map[string]bool{"globals.orders": true, "globals.added": true}) {
+		t.Fatalf("unexpected changes: %+v", diff.Changed)
+	}
+	if !reflect.DeepEqual(diff.Removed, [][]string{{"globals", "gone"}}) {
+		t.Fatalf("unexpected removals: %v", diff.Removed)
+	}
+
+	again, err := in.Inspect(inspectTestState([]interface{}{"a", "b"}, map[string]interface{}{"added": 1}), chariot.InspectQuery{Since: diff.Cursor})
+	if err != nil || !again.Diff || len(again.Changed) != 0 || len(again.Removed) != 0 {
+		t.Fatalf("expected an empty diff, got %+v (%v)", again, err)
+	}
+
+	stale, err := in.Inspect(inspectTestState(nil, nil), chariot.InspectQuery{Since: full.Cursor})
+	if err != nil || stale.Diff || stale.Total != 2 {
+		t.Fatalf("expected a full listing for a stale cursor, got %+v (%v)", stale, err)
+	}
+}
+
+// TestInspectRuntimeState verifies inspection of a live runtime.
+func TestInspectRuntimeState(t *testing.T) {
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	if _, err := rt.ExecProgram(`declareGlobal(inspected, 'N', 42)`); err != nil {
+		t.Fatalf("declareGlobal: %v", err)
+	}
+	res, err := chariot.NewRuntimeInspector().Inspect(rt.InspectState(), chariot.InspectQuery{Path: []string{"globals", "inspected"}})
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if res.Kind != "value" || res.Value == nil {
+		t.Fatalf("expected the global's value, got %+v", res)
+	}
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+func TestInternStr(t *testing.T) {
+	chariot.ResetInterner()
+	defer chariot.ResetInterner()
+
+	a := chariot.InternStr("ACTIVE")
+	b := chariot.InternStr(strings.ToUpper("active"))
+	if a != b {
+		t.Fatalf("expected equal interned values, got %v and %v", a, b)
+	}
+	if _, ok := a.(chariot.Str); !ok {
+		t.Fatalf("expected chariot.Str, got %T", a)
+	}
+
+	long := strings.Repeat("x", chariot.MaxInternLength+1)
+	if v := chariot.InternStr(long); v != chariot.Str(long) {
+		t.Fatalf("long strings must still round-trip, got %v", v)
+	}
+
+	stats := chariot.GetInternStats()
+	if stats.Entries != 1 || stats.Hits != 1 {
+		t.Errorf("unexpected intern stats: %+v", stats)
+	}
+}
+
+func TestBoxNumber(t *testing.T) {
+	cases := []float64{0, 1, -128, 1024, 1025, 2.5, -129}
+	for _, f := range cases {
+		v := chariot.BoxNumber(f)
+		if n, ok := v.(chariot.Number); !ok || float64(n) != f {
+			t.Errorf("BoxNumber(%v) = %v (%T)", f, v, v)
+		}
+	}
+}
+
+func TestUDFDispatchWithPooledArgs(t *testing.T) {
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	if err := rt.SaveFunction("addPair", `setq(addPair, func(a, b) { add(a, b) })`, ""); err != nil {
+		t.Fatalf("SaveFunction: %v", err)
+	}
+	// Nested UDF calls exercise reuse of pooled argument slices
+	val, err := rt.ExecProgram(`addPair(addPair(1, 2), addPair(3, 4))`)
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if val != chariot.Number(10) {
+		t.Errorf("expected 10, got %v", val)
+	}
+}
+
+// writeBenchCSV generates a repetitive CSV typical of ETL inputs under the test data path.
+func writeBenchCSV(b *testing.B, rows int) string {
+	b.Helper()
+	var sb strings.Builder
+	sb.WriteString("id,status,region,qty,active\n")
+	statuses := []string{"NEW", "OPEN", "CLOSED", "PENDING"}
+	regions := []string{"US", "EU", "APAC"}
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&sb, "%d,%s,%s,%d,%t\n", i, statuses[i%len(statuses)], regions[i%len(regions)], i%50, i%2 == 0)
+	}
+	name := "bench_intern.csv"
+	if err := os.WriteFile(filepath.Join(cfg.ChariotConfig.DataPath, name), []byte(sb.String()), 0o644); err != nil {
+		b.Fatalf("write csv: %v", err)
+	}
+	return name
+}
+
+func benchmarkExtractCSV(b *testing.B, interning bool) {
+	name := writeBenchCSV(b, 5000)
+	defer os.Remove(filepath.Join(cfg.ChariotConfig.DataPath, name))
+
+	prev := chariot.InterningEnabled()
+	chariot.SetInterning(interning)
+	defer chariot.SetInterning(prev)
+
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	program := fmt.Sprintf(`length(extractCSV(%q))`, name)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := rt.ExecProgram(program); err != nil {
+			b.Fatalf("extractCSV: %v", err)
+		}
+	}
+}
+
+func BenchmarkExtractCSVInterned(b *testing.B)   { benchmarkExtractCSV(b, true) }
+func BenchmarkExtractCSVUninterned(b *testing.B) { benchmarkExtractCSV(b, false) }
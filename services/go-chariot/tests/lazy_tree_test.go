@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+func TestLazyTree(t *testing.T) {
+	setConfig(t, &cfg.ChariotConfig.DataPath, t.TempDir())
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(cfg.ChariotConfig.DataPath, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("shop.json", `{"name": "shop", "open": true,
+  "orders": [
+    {"id": "o1", "lines": [{"sku": "AB-7", "qty": 2}]},
+    {"id": "o2", "note": null, "lines": []},
+    {"id": "o3", "address": {"city": "Oslo"}}
+  ],
+  "tags": ["a", "b"]}`)
+	write("shop.xml", `<?xml version="1.0"?>
+<!-- orders -->
+<shop region="emea">
+  <order id="o1"><line sku="AB-7">two</line></order>
+  <order id="o2"/>
+  <order id="o3"><note>rush</note></order>
+</shop>`)
+
+	rt := createNamedRuntime("lazy_tree")
+	defer chariot.UnregisterRuntime("lazy_tree")
+	run := scriptRunner(t, rt)
+	attr := func(n chariot.TreeNode, name string) chariot.Value {
+		t.Helper()
+		v, _ := n.GetAttribute(name)
+		return v
+	}
+	child := func(n chariot.TreeNode, name string) chariot.TreeNode {
+		t.Helper()
+		c, ok := n.GetChildByName(name)
+		if !ok {
+			t.Fatalf("%s has no child %s", n.Name(), name)
+		}
+		return c
+	}
+	stat := func(name string) chariot.Value {
+		t.Helper()
+		v, _ := run(`treeLazyStats(shop)`).(*chariot.MapValue).Get(name)
+		return v
+	}
+
+	run(`setq(shop, treeOpenLazy('shop.json', map('cacheSize', 4)))`)
+	v, _ := rt.GetVariable("shop")
+	shop := v.(chariot.TreeNode)
+	if attr(shop, "name") != chariot.Str("shop") || attr(shop, "open") != chariot.Bool(true) {
+		t.Fatalf("root attributes = %v", shop.GetAttributes())
+	}
+	if n := run(`childCount(shop)`); n != chariot.Number(2) || stat("loads") != chariot.Number(1) {
+		t.Fatalf("childCount = %v, loads = %v", n, stat("loads"))
+	}
+
+	orders := child(shop, "orders")
+	if attr(orders, "type") != chariot.Str("array") || orders.GetChildCount() != 3 {
+		t.Fatalf("orders = %v with %d children", orders.GetAttributes(), orders.GetChildCount())
+	}
+	line := child(child(orders.GetChildren()[0], "lines"), "item_0")
+	if attr(line, "sku") != chariot.Str("AB-7") || attr(line, "qty") != chariot.Number(2) {
+		t.Fatalf("line = %v", line.GetAttributes())
+	}
+	if attr(orders.GetChildren()[1], "note") != chariot.DBNull {
+		t.Fatalf("null member = %v", attr(orders.GetChildren()[1], "note"))
+	}
+	if city := attr(child(orders.GetChildren()[2], "address"), "city"); city != chariot.Str("Oslo") {
+		t.Fatalf("city = %v", city)
+	}
+	if b := attr(child(child(shop, "tags"), "item_1"), "value"); b != chariot.Str("b") {
+		t.Fatalf("tags[1] = %v", b)
+	}
+
+	// Reading past the capacity drops what was read first
+	if e := stat("evictions"); e == chariot.Number(0) {
+		t.Fatalf("no evictions with %v held", stat("held"))
+	}
+	if h := stat("held"); h.(chariot.Number) > 4 {
+		t.Fatalf("held = %v", h)
+	}
+
+	// Changed nodes are kept
+	o2 := child(shop, "orders").GetChildren()[1]
+	o2.SetAttribute("status", chariot.Str("shipped"))
+	for _, o := range child(shop, "orders").GetChildren() {
+		for _, c := range o.GetChildren() {
+			c.GetChildren()
+		}
+	}
+	child(shop, "tags").GetChildren()
+	if got := attr(child(shop, "orders").GetChildren()[1], "status"); got != chariot.Str("shipped") {
+		t.Fatalf("status after eviction = %v", got)
+	}
+
+	found := run(`queryNode(shop, "item_0[sku='AB-7']")`).(*chariot.ArrayValue)
+	if found.Length() != 1 {
+		t.Fatalf("queryNode found %d nodes", found.Length())
+	}
+	clone := shop.Clone()
+	if _, ok := clone.(*chariot.TreeNodeImpl); !ok || clone.GetChildCount() != 2 {
+		t.Fatalf("Clone() = %T", clone)
+	}
+
+	run(`setq(xml, treeOpenLazy('shop.xml', map('cacheSize', 2)))`)
+	v, _ = rt.GetVariable("xml")
+	xml := v.(chariot.TreeNode)
+	if xml.Name() != "shop" || attr(xml, "region") != chariot.Str("emea") || xml.GetChildCount() != 3 {
+		t.Fatalf("xml root = %s %v", xml.Name(), xml.GetAttributes())
+	}
+	if sku := attr(child(xml.GetChildren()[0], "line"), "sku"); sku != chariot.Str("AB-7") {
+		t.Fatalf("sku = %v", sku)
+	}
+	if note := attr(child(xml.GetChildren()[2], "note"), "text"); note != chariot.Str("rush") {
+		t.Fatalf("note = %v", note)
+	}
+	if id := attr(xml.GetChildren()[1], "id"); id != chariot.Str("o2") {
+		t.Fatalf("id = %v", id)
+	}
+
+	if _, err := rt.Evaluate(`treeOpenLazy('shop.csv')`); err == nil {
+		t.Fatalf("expected an error for a csv file")
+	}
+}
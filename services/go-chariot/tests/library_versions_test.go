@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"testing"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+)
+
+// TestLibraryVersions verifies that a staged library version whose tests
+// fail cannot be activated, that one whose tests pass replaces the library,
+// and that rollback restores the library in use before.
+func TestLibraryVersions(t *testing.T) {
+	savedPath, savedLib := cfg.ChariotConfig.TreePath, cfg.ChariotConfig.FunctionLib
+	cfg.ChariotConfig.TreePath, cfg.ChariotConfig.FunctionLib = t.TempDir(), "stlib.json"
+	defer func() { cfg.ChariotConfig.TreePath, cfg.ChariotConfig.FunctionLib = savedPath, savedLib }()
+
+	rt := createNamedRuntime("library_versions")
+	defer ch.UnregisterRuntime("library_versions")
+	fn := func(src string) *ch.FunctionValue {
+		t.Helper()
+		v, err := rt.ExecProgram(src)
+		if err != nil {
+			t.Fatalf("exec %q: %v", src, err)
+		}
+		f, ok := v.(*ch.FunctionValue)
+		if !ok {
+			t.Fatalf("%q is not a function: %T", src, v)
+		}
+		return f
+	}
+	if err := ch.SaveFunctionsToFile(map[string]*ch.FunctionValue{"double": fn("func(x) { mul(x, 2) }")}, "stlib.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	var h handlers.Handlers
+	broken, err := handlers.StageLibraryVersion(map[string]*ch.FunctionValue{
+		"double":     fn("func(x) { mul(x, 3) }"),
+		"testDouble": fn("func() { equal(double(2), 4) }"),
+	}, "broken", false)
+	if err != nil {
+		t.Fatalf("stage: %v", err)
+	}
+	if broken.Version != "v2" || broken.Status != handlers.LibraryStaged {
+		t.Errorf("expected staged v2, got %+v", broken)
+	}
+	if _, err := h.ActivateLibraryVersion(broken.Version, false); err == nil {
+		t.Fatal("expected a version failing its tests to be refused")
+	}
+
+	fixed, err := handlers.StageLibraryVersion(map[string]*ch.FunctionValue{
+		"testDouble": fn("func() { equal(double(2), 4) }"),
+	}, "fixed", false)
+	if err != nil {
+		t.Fatalf("stage: %v", err)
+	}
+	report, err := h.TestLibraryVersion(fixed.Version)
+	if err != nil || !report.Passed || len(report.Results) != 1 {
+		t.Fatalf("expected one passing test, got %+v (%v)", report, err)
+	}
+	if v, err := h.ActivateLibraryVersion(fixed.Version, false); err != nil || v.Status != handlers.LibraryActive {
+		t.Fatalf("activate: %+v (%v)", v, err)
+	}
+	lib, err := ch.LoadFunctionsFromFile("stlib.json")
+	if err != nil || lib["testDouble"] == nil {
+		t.Errorf("expected the activated version in the library file, got %v (%v)", lib, err)
+	}
+
+	v, err := h.RollbackLibrary()
+	if err != nil || v.Version != "v1" {
+		t.Fatalf("expected to roll back to v1, got %+v (%v)", v, err)
+	}
+	if lib, _ := ch.LoadFunctionsFromFile("stlib.json"); lib["testDouble"] != nil || lib["double"] == nil {
+		t.Errorf("expected the original library after rollback, got %v", lib)
+	}
+	if v, err := h.RollbackLibrary(); err != nil || v.Version != fixed.Version {
+		t.Errorf("expected a second rollback to restore %s, got %+v (%v)", fixed.Version, v, err)
+	}
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/listeners"
+)
+
+// TestListenerConcurrency verifies that a listener runs at most
+// max_concurrent invocations at once, queues or drops the others as
+// when_busy says, interrupts invocations past their timeout, and reports its
+// counts in the list.
+func TestListenerConcurrency(t *testing.T) {
+	prev := cfg.ChariotConfig.DataPath
+	cfg.ChariotConfig.DataPath = t.TempDir()
+	t.Cleanup(func() { cfg.ChariotConfig.DataPath = prev })
+
+	shared := createNamedRuntime("listener-concurrency-shared")
+	t.Cleanup(func() { chariot.UnregisterRuntime("listener-concurrency-shared") })
+	gate := make(chan struct{})
+	shared.Register("waitGate", func(args ...chariot.Value) (chariot.Value, error) {
+		<-gate
+		return chariot.Bool(true), nil
+	})
+
+	m := listeners.NewManager(shared)
+	stats := func(name string) listeners.InvocationStats {
+		for _, l := range m.List() {
+			if l.Name == name && l.Invocations != nil {
+				return *l.Invocations
+			}
+		}
+		return listeners.InvocationStats{}
+	}
+	waitFor := func(name string, cond func(s listeners.InvocationStats) bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond(stats(name)) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: invocations %+v", name, stats(name))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	invoke := func(name string) chan error {
+		done := make(chan error, 1)
+		go func() { done <- m.Invoke(context.Background(), name, chariot.Str("order")) }()
+		return done
+	}
+	start := func(l listeners.Listener) {
+		t.Helper()
+		if _, err := m.Create(l); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Start(l.Name, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.Invoke(context.Background(), "missing", chariot.Str("x")); !errors.Is(err, listeners.ErrNotFound) {
+		t.Errorf("invoke of an unknown listener: %v", err)
+	}
+
+	start(listeners.Listener{Name: "dropper", Script: "waitGate()", Concurrency: &listeners.ConcurrencyConfig{WhenBusy: listeners.WhenBusyDrop}})
+	first := invoke("dropper")
+	waitFor("dropper", func(s listeners.InvocationStats) bool { return s.InFlight == 1 })
+	if err := m.Invoke(context.Background(), "dropper", chariot.Str("x")); !errors.Is(err, listeners.ErrBusy) {
+		t.Errorf("invoke of a busy dropping listener: %v", err)
+	}
+	gate <- struct{}{}
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	if s := stats("dropper"); s.Completed != 1 || s.Dropped != 1 || s.InFlight != 0 {
+		t.Errorf("dropper invocations %+v", s)
+	}
+
+	start(listeners.Listener{Name: "queuer", Script: "waitGate()", Concurrency: &listeners.ConcurrencyConfig{MaxConcurrent: 2, MaxQueued: 1}})
+	runs := []chan error{invoke("queuer"), invoke("queuer")}
+	waitFor("queuer", func(s listeners.InvocationStats) bool { return s.InFlight == 2 })
+	runs = append(runs, invoke("queuer"))
+	waitFor("queuer", func(s listeners.InvocationStats) bool { return s.Queued == 1 })
+	if err := m.Invoke(context.Background(), "queuer", chariot.Str("x")); !errors.Is(err, listeners.ErrBusy) {
+		t.Errorf("invoke past a full queue: %v", err)
+	}
+	for range runs {
+		gate <- struct{}{}
+	}
+	for _, done := range runs {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := stats("queuer"); s.Completed != 3 || s.Dropped != 1 || s.Queued != 0 {
+		t.Errorf("queuer invocations %+v", s)
+	}
+
+	start(listeners.Listener{Name: "spinner", Script: "while(true) { setq(i, 1) }", Concurrency: &listeners.ConcurrencyConfig{Timeout: 1}})
+	if err := m.Invoke(context.Background(), "spinner", chariot.Str("x")); err == nil {
+		t.Error("a script past its timeout was not interrupted")
+	}
+	if s := stats("spinner"); s.TimedOut != 1 || s.Failed != 1 {
+		t.Errorf("spinner invocations %+v", s)
+	}
+	if err := m.Invoke(context.Background(), "spinner", chariot.Str("x")); err == nil {
+		t.Error("second invocation past its timeout was not interrupted")
+	}
+
+	m.Stop("spinner", 0)
+	if err := m.Invoke(context.Background(), "spinner", chariot.Str("x")); !errors.Is(err, listeners.ErrNotRunning) {
+		t.Errorf("invoke of a stopped listener: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/listeners"
+)
+
+// TestListenerRuntimeIsolation verifies that each listener runs on a runtime
+// of its own, with its imports and env, that what one listener sets is not
+// seen by another or by the shared runtime, and that the runtime is kept
+// across restarts until it is reset.
+func TestListenerRuntimeIsolation(t *testing.T) {
+	dir := t.TempDir()
+	prev := cfg.ChariotConfig.DataPath
+	cfg.ChariotConfig.DataPath = dir
+	t.Cleanup(func() { cfg.ChariotConfig.DataPath = prev })
+	if err := os.MkdirAll(filepath.Join(dir, "files"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "files", "greeting.ch"), []byte(`declareGlobal(greeting, 'S', 'hello')`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	shared := createNamedRuntime("listener-runtime-shared")
+	t.Cleanup(func() { chariot.UnregisterRuntime("listener-runtime-shared") })
+	if _, err := shared.ExecProgram(`declareGlobal(region, 'S', 'shared')`); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var reports []string
+	shared.Register("report", func(args ...chariot.Value) (chariot.Value, error) {
+		parts := make([]string, len(args))
+		for i, a := range args {
+			if e, ok := a.(chariot.ScopeEntry); ok {
+				a = e.Value
+			}
+			parts[i] = fmt.Sprint(chariot.ConvertToNativeJSON(a))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		reports = append(reports, strings.Join(parts, " "))
+		return chariot.Bool(true), nil
+	})
+	last := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(reports) == 0 {
+			return ""
+		}
+		return reports[len(reports)-1]
+	}
+
+	m := listeners.NewManager(shared)
+	if _, err := m.Create(listeners.Listener{
+		Name:    "writer",
+		OnStart: `report(region, getEnv('STAGE'), greeting)` + "\n" + `setq(region, 'writer')`,
+		Imports: []string{"greeting.ch"},
+		Env:     map[string]string{"STAGE": "blue"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Create(listeners.Listener{Name: "reader", OnStart: `report(region, hasEnv('STAGE'))`}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Start("writer", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := last(); got != "shared blue hello" {
+		t.Errorf("writer saw %q, want its env, import and the shared global", got)
+	}
+	if _, err := m.Start("reader", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := last(); got != "shared false" {
+		t.Errorf("reader saw %q, want another listener's setq and env kept out", got)
+	}
+	if v, _ := shared.GlobalScope().Get("region"); chariot.ConvertToNativeJSON(v) != "shared" {
+		t.Errorf("shared runtime changed to %v", v)
+	}
+
+	if err := m.ResetRuntime("writer"); !errors.Is(err, listeners.ErrRunning) {
+		t.Errorf("reset of a running listener: %v", err)
+	}
+	m.Stop("writer", 0)
+	m.Start("writer", 0)
+	if got := last(); got != "writer blue hello" {
+		t.Errorf("restarted writer saw %q, want its own earlier setq", got)
+	}
+	info, err := m.Runtime(context.Background(), "writer")
+	if err != nil || info.Runs != 2 || len(info.Env) != 1 || info.Env[0] != "STAGE" {
+		t.Errorf("runtime info %+v, %v", info, err)
+	}
+
+	m.Stop("writer", 0)
+	if err := m.ResetRuntime("writer"); err != nil {
+		t.Fatal(err)
+	}
+	m.Start("writer", 0)
+	if got := last(); got != "shared blue hello" {
+		t.Errorf("writer saw %q after a reset, want a fresh runtime", got)
+	}
+	if _, err := m.Runtime(context.Background(), "missing"); !errors.Is(err, listeners.ErrNotFound) {
+		t.Errorf("runtime of an unknown listener: %v", err)
+	}
+}
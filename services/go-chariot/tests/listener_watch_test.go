@@ -0,0 +1,195 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/listeners"
+)
+
+// watchHarness runs watch listeners against a temporary data path and
+// records the files their script receives.
+type watchHarness struct {
+	t       *testing.T
+	dir     string
+	manager *listeners.Manager
+	mu      sync.Mutex
+	files   []string
+}
+
+func newWatchHarness(t *testing.T, name string) *watchHarness {
+	t.Helper()
+	prev := cfg.ChariotConfig.DataPath
+	h := &watchHarness{t: t, dir: t.TempDir()}
+	cfg.ChariotConfig.DataPath = h.dir
+	t.Cleanup(func() { cfg.ChariotConfig.DataPath = prev })
+
+	rt := createNamedRuntime(name)
+	t.Cleanup(func() { chariot.UnregisterRuntime(name) })
+	rt.Register("recordFile", func(args ...chariot.Value) (chariot.Value, error) {
+		file := string(args[0].(chariot.Str))
+		if strings.Contains(file, "bad") {
+			return nil, errors.New("cannot process " + file)
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.files = append(h.files, file)
+		return chariot.Bool(true), nil
+	})
+	h.manager = listeners.NewManager(rt)
+	return h
+}
+
+func (h *watchHarness) write(name, content string) {
+	h.t.Helper()
+	p := filepath.Join(h.dir, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		h.t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+func (h *watchHarness) recorded() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.files...)
+}
+
+// waitFor polls cond for up to ten seconds.
+func (h *watchHarness) waitFor(what string, cond func() bool) {
+	h.t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	h.t.Fatalf("timed out waiting for %s", what)
+}
+
+func (h *watchHarness) exists(name string) bool {
+	_, err := os.Stat(filepath.Join(h.dir, name))
+	return err == nil
+}
+
+func TestWatchListenerMovesProcessedFiles(t *testing.T) {
+	h := newWatchHarness(t, "watch_move")
+	var unhealthy []string
+	var mu sync.Mutex
+	h.manager.OnUnhealthy(func(l listeners.Listener, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		unhealthy = append(unhealthy, err.Error())
+	})
+
+	_, err := h.manager.Create(listeners.Listener{
+		Name:   "drop-zone",
+		Type:   listeners.TypeWatch,
+		Script: `recordFile(file, getProp(fileInfo, "key"))`,
+		Watch: &listeners.WatchConfig{
+			Source:       "inbox",
+			Pattern:      "*.csv",
+			PollInterval: 1,
+			StableFor:    1,
+			After:        listeners.AfterMove,
+			MoveTo:       "done",
+			ErrorTo:      "failed",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.write("inbox/orders.csv", "id,qty\n1,2\n")
+	h.write("inbox/bad.csv", "id,qty\n")
+	h.write("inbox/notes.txt", "not a csv")
+	if _, err := h.manager.Start("drop-zone", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer h.manager.Stop("drop-zone", 0)
+
+	h.waitFor("orders.csv to be moved", func() bool { return h.exists("done/orders.csv") })
+	h.waitFor("bad.csv to be moved", func() bool { return h.exists("failed/bad.csv") })
+	if got := h.recorded(); len(got) != 1 || got[0] != "inbox/orders.csv" {
+		t.Fatalf("script received %v, want [inbox/orders.csv]", got)
+	}
+	if !h.exists("inbox/notes.txt") {
+		t.Error("a file not matching the pattern was post-processed")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(unhealthy) != 1 || !strings.Contains(unhealthy[0], "cannot process") {
+		t.Errorf("unhealthy notifications = %v", unhealthy)
+	}
+}
+
+func TestWatchListenerDedupesContent(t *testing.T) {
+	h := newWatchHarness(t, "watch_dedupe")
+	_, err := h.manager.Create(listeners.Listener{
+		Name:   "invoices",
+		Type:   listeners.TypeWatch,
+		Script: `recordFile(file)`,
+		Watch: &listeners.WatchConfig{
+			Source:       "invoices",
+			PollInterval: 1,
+			StableFor:    1,
+			Dedupe:       listeners.DedupeContent,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.manager.Start("invoices", 0); err != nil {
+		t.Fatal(err)
+	}
+	h.write("invoices/a.json", `{"invoice": 1}`)
+	h.waitFor("a.json to be processed", func() bool { return len(h.recorded()) == 1 })
+
+	// The same content under another name is skipped, new content is not
+	h.write("invoices/copy-of-a.json", `{"invoice": 1}`)
+	h.write("invoices/b.json", `{"invoice": 2}`)
+	h.waitFor("b.json to be processed", func() bool { return len(h.recorded()) == 2 })
+	time.Sleep(2500 * time.Millisecond)
+	if got := h.recorded(); len(got) != 2 || got[1] != "invoices/b.json" {
+		t.Fatalf("script received %v", got)
+	}
+
+	// Seen content is remembered across a restart
+	if _, err := h.manager.Stop("invoices", 0); err != nil {
+		t.Fatal(err)
+	}
+	h.write("invoices/c.json", `{"invoice": 2}`)
+	if _, err := h.manager.Start("invoices", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer h.manager.Stop("invoices", 0)
+	time.Sleep(2500 * time.Millisecond)
+	if got := h.recorded(); len(got) != 2 {
+		t.Fatalf("script received %v after restart", got)
+	}
+}
+
+func TestWatchListenerValidation(t *testing.T) {
+	h := newWatchHarness(t, "watch_validation")
+	for name, l := range map[string]listeners.Listener{
+		"no source":     {Type: listeners.TypeWatch, Script: "x()", Watch: &listeners.WatchConfig{}},
+		"no script":     {Type: listeners.TypeWatch, Watch: &listeners.WatchConfig{Source: "inbox"}},
+		"move without":  {Type: listeners.TypeWatch, Script: "x()", Watch: &listeners.WatchConfig{Source: "inbox", After: "move"}},
+		"bad dedupe":    {Type: listeners.TypeWatch, Script: "x()", Watch: &listeners.WatchConfig{Source: "inbox", Dedupe: "name"}},
+		"escaping path": {Type: listeners.TypeWatch, Script: "x()", Watch: &listeners.WatchConfig{Source: "../etc"}},
+		"bad s3 url":    {Type: listeners.TypeWatch, Script: "x()", Watch: &listeners.WatchConfig{Source: "s3:///prefix"}},
+		"unknown type":  {Type: "cron", Script: "x()"},
+	} {
+		l.Name = strings.ReplaceAll(name, " ", "-")
+		if _, err := h.manager.Create(l); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
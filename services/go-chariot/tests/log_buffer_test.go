@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+)
+
+// TestLogBufferResume verifies that a log stream can resume after the last
+// event id it sent, and learns how many entries the buffer dropped.
+func TestLogBufferResume(t *testing.T) {
+	buf := handlers.NewLogBuffer(3)
+	sub := buf.Subscribe()
+	defer buf.Unsubscribe(sub)
+	for i := 0; i < 5; i++ {
+		buf.Append(chariot.LogEntry{Timestamp: time.Now(), Level: "INFO", Message: fmt.Sprintf("line %d", i)})
+	}
+	if e := <-sub; e.Seq != 0 || e.Entry.Message != "line 0" {
+		t.Errorf("unexpected first event %+v", e)
+	}
+
+	entries, missed := buf.Since(4)
+	if missed != 0 || len(entries) != 1 || entries[0].Seq != 4 || entries[0].Entry.Message != "line 4" {
+		t.Errorf("unexpected resume after 3: %+v, missed %d", entries, missed)
+	}
+	// Entries 0 and 1 were dropped from the buffer
+	entries, missed = buf.Since(0)
+	if missed != 2 || len(entries) != 3 || entries[0].Seq != 2 {
+		t.Errorf("unexpected resume from the start: %+v, missed %d", entries, missed)
+	}
+	if entries, missed := buf.Since(5); missed != 0 || len(entries) != 0 {
+		t.Errorf("expected nothing after the last entry, got %+v", entries)
+	}
+}
+
+// TestLogLevels verifies the formatted log builtins and that an execution's
+// log level drops the entries below it.
+func TestLogLevels(t *testing.T) {
+	buf := handlers.NewLogBuffer(10)
+	buf.SetLevel("WARN")
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	rt.SetLogWriter(buf)
+	_, err := rt.ExecProgram(`logInfof('%v rows', 3)
+logPrintf('warning', '%s skipped', 'row 2')
+logErrorf('failed: %v', true)
+logPrint('done')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := buf.GetAll()
+	if len(entries) != 2 || entries[0].Level != "WARN" || entries[0].Message != "row 2 skipped" || entries[1].Message != "failed: true" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+	if _, err := rt.ExecProgram(`logPrintf('loud', 'x')`); err == nil {
+		t.Errorf("expected an unknown level to fail")
+	}
+	if chariot.LogLevelAtLeast("DEBUG", "INFO") || !chariot.LogLevelAtLeast("ERROR", "WARN") || !chariot.LogLevelAtLeast("DEBUG", "") {
+		t.Errorf("unexpected level order")
+	}
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+// offlineRuntime returns a runtime whose sqlQuery fails like one without a
+// database.
+func offlineRuntime() *ch.Runtime {
+	rt := ch.NewRuntime()
+	ch.RegisterAll(rt)
+	rt.Register("sqlQuery", func(args ...ch.Value) (ch.Value, error) {
+		return nil, errors.New("no database connection")
+	})
+	return rt
+}
+
+func TestMock(t *testing.T) {
+	rt := offlineRuntime()
+	val, err := rt.ExecProgram(`setq(testCount, func() {
+		mock('sqlQuery', func(args) { array(length(args), 'row') })
+		setq(rows, sqlQuery('db', 'SELECT 1'))
+		and(equal(length(rows), 2), equal(length(mockCalls('sqlQuery')), 1))
+	})
+	call(testCount)`)
+	if err != nil || val != ch.Bool(true) {
+		t.Errorf("expected the mock to answer, got %v, %v", val, err)
+	}
+	// The mock ended with the function that set it up
+	if _, err := rt.ExecProgram("sqlQuery('db', 'SELECT 1')"); err == nil {
+		t.Errorf("expected the real sqlQuery after the test function returned")
+	}
+	if _, err := rt.ExecProgram("mock('sqlQuery', func(args) { 1 })"); err == nil {
+		t.Errorf("expected mock outside a function to fail")
+	}
+}
+
+func TestMockFixture(t *testing.T) {
+	dir := t.TempDir()
+	recorder := ch.NewRuntime()
+	ch.RegisterAll(recorder)
+	recorder.SetSnapshotDir(filepath.Join(dir, "snapshots"))
+	recorder.Register("sqlQuery", func(args ...ch.Value) (ch.Value, error) {
+		rows := ch.NewArray()
+		if args[1] == ch.Str("SELECT id FROM orders") {
+			rows.Append(ch.Str("o1"))
+			rows.Append(ch.Str("o2"))
+		}
+		return rows, nil
+	})
+	trace, err := recorder.StartRecording("orders", "import", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recorder.ExecProgram("sqlQuery('db', 'SELECT id FROM orders')\nsqlQuery('db', 'SELECT id FROM refunds')"); err != nil {
+		t.Fatal(err)
+	}
+	recorder.StopTrace()
+	if err := ch.SaveTrace(recorder.TraceDir(), trace); err != nil {
+		t.Fatal(err)
+	}
+
+	rt := offlineRuntime()
+	rt.SetSnapshotDir(filepath.Join(dir, "snapshots"))
+	val, err := rt.ExecProgram(`setq(testImport, func() {
+		mockFixture('orders', array('sqlQuery'))
+		array(length(sqlQuery('db', 'SELECT id FROM refunds')), length(sqlQuery('db', 'SELECT id FROM orders')))
+	})
+	call(testImport)`)
+	arr, ok := val.(*ch.ArrayValue)
+	if err != nil || !ok || arr.Length() != 2 || arr.Get(0) != ch.Number(0) || arr.Get(1) != ch.Number(2) {
+		t.Fatalf("expected the recorded answers by query, got %v, %v", val, err)
+	}
+	_, err = rt.ExecProgram(`setq(testOther, func() {
+		mockFixture('orders')
+		sqlQuery('db', 'SELECT 1')
+	})
+	call(testOther)`)
+	if err == nil {
+		t.Errorf("expected a query that was not recorded to fail")
+	}
+}
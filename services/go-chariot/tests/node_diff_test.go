@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+func TestNodeDiffAndMerge(t *testing.T) {
+	rt := createNamedRuntime("node_diff")
+	defer chariot.UnregisterRuntime("node_diff")
+	run := scriptRunner(t, rt)
+	prop := func(v chariot.Value, name string) chariot.Value {
+		t.Helper()
+		got, _ := v.(*chariot.MapValue).Get(name)
+		return got
+	}
+	paths := func(v chariot.Value) []string {
+		t.Helper()
+		arr := v.(*chariot.ArrayValue)
+		out := []string{}
+		for i := 0; i < arr.Length(); i++ {
+			out = append(out, string(prop(arr.Get(i), "path").(chariot.Str)))
+		}
+		return out
+	}
+	expect := func(what string, got []string, want ...string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("%s = %v, want %v", what, got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%s = %v, want %v", what, got, want)
+			}
+		}
+	}
+
+	// config { db{host, pool{size}}, feature{name=a}, feature{name=b} }
+	config := func() *chariot.TreeNodeImpl {
+		root := chariot.NewTreeNode("config")
+		root.SetAttribute("version", chariot.Number(1))
+		db := chariot.NewTreeNode("db")
+		db.SetAttribute("host", chariot.Str("localhost"))
+		pool := chariot.NewTreeNode("pool")
+		pool.SetAttribute("size", chariot.Number(10))
+		db.AddChild(pool)
+		root.AddChild(db)
+		for _, name := range []string{"a", "b"} {
+			f := chariot.NewTreeNode("feature")
+			f.SetAttribute("name", chariot.Str(name))
+			root.AddChild(f)
+		}
+		return root
+	}
+	child := func(n chariot.TreeNode, names ...string) chariot.TreeNode {
+		for _, name := range names {
+			n, _ = n.GetChildByName(name)
+		}
+		return n
+	}
+
+	base, ours, theirs := config(), config(), config()
+	rt.SetVariable("base", base)
+	rt.SetVariable("ours", ours)
+	rt.SetVariable("theirs", theirs)
+
+	if d := run(`nodeDiff(base, ours)`); prop(d, "equal") != chariot.Bool(true) {
+		t.Fatalf("nodeDiff of equal trees = %v", d)
+	}
+
+	child(ours, "db", "pool").SetAttribute("size", chariot.Number(20))
+	ours.GetChildren()[2].SetAttribute("enabled", chariot.Bool(true))
+	ours.RemoveAttribute("version")
+	ours.AddChild(chariot.NewTreeNode("cache"))
+	d := run(`nodeDiff(base, ours)`)
+	expect("changed", paths(prop(d, "changed")), "db.pool.size")
+	expect("added", paths(prop(d, "added")), "feature[1].enabled", "cache")
+	expect("removed", paths(prop(d, "removed")), "version")
+	if c := prop(d, "changed").(*chariot.ArrayValue).Get(0); prop(c, "from") != chariot.Number(10) || prop(c, "to") != chariot.Number(20) {
+		t.Fatalf("change = %v", c)
+	}
+
+	// theirs: same pool size change, a new host, a removed feature
+	child(theirs, "db", "pool").SetAttribute("size", chariot.Number(20))
+	child(theirs, "db").SetAttribute("host", chariot.Str("db.internal"))
+	theirs.RemoveChild(theirs.GetChildren()[2])
+	merge := run(`nodeMerge(base, ours, theirs)`)
+	expect("conflicts", paths(prop(merge, "conflicts")), "feature[1]")
+	merged := prop(merge, "merged").(chariot.TreeNode)
+	if host, _ := child(merged, "db").GetAttribute("host"); host != chariot.Str("db.internal") {
+		t.Fatalf("host = %v", host)
+	}
+	if size, _ := child(merged, "db", "pool").GetAttribute("size"); size != chariot.Number(20) {
+		t.Fatalf("size = %v", size)
+	}
+	if _, ok := merged.GetAttribute("version"); ok {
+		t.Fatalf("version should be removed")
+	}
+	if _, ok := merged.GetChildByName("cache"); !ok {
+		t.Fatalf("cache should be added")
+	}
+	// The feature ours changed and theirs removed is kept and marked
+	kept := merged.GetChildren()[2]
+	if conflict, _ := kept.GetMeta("conflict"); conflict != chariot.Str("removed in theirs") {
+		t.Fatalf("conflict meta = %v", conflict)
+	}
+
+	// Conflicting attribute changes hold a marker unless a side is preferred
+	child(theirs, "db", "pool").SetAttribute("size", chariot.Number(5))
+	merge = run(`nodeMerge(base, ours, theirs)`)
+	expect("conflicts", paths(prop(merge, "conflicts")), "db.pool.size", "feature[1]")
+	marker, _ := child(prop(merge, "merged").(chariot.TreeNode), "db", "pool").GetAttribute("size")
+	if prop(marker, "conflict") != chariot.Bool(true) || prop(marker, "ours") != chariot.Number(20) || prop(marker, "theirs") != chariot.Number(5) {
+		t.Fatalf("marker = %v", marker)
+	}
+	merge = run(`nodeMerge(base, ours, theirs, 'theirs')`)
+	merged = prop(merge, "merged").(chariot.TreeNode)
+	if size, _ := child(merged, "db", "pool").GetAttribute("size"); size != chariot.Number(5) || merged.GetChildCount() != 3 {
+		t.Fatalf("preferring theirs: size = %v, %d children", size, merged.GetChildCount())
+	}
+	if prop(merge, "clean") != chariot.Bool(false) {
+		t.Fatalf("preferred conflicts should still be reported")
+	}
+}
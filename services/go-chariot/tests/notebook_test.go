@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+	"github.com/labstack/echo/v4"
+)
+
+// callNotebook runs a notebook handler with path parameters and decodes the
+// response data into out.
+func callNotebook(t *testing.T, session *chariot.Session, handler echo.HandlerFunc, method, target, body string, params map[string]string, out interface{}) handlers.ResultJSON {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("session", session)
+	var names, values []string
+	for name, value := range params {
+		names = append(names, name)
+		values = append(values, value)
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+	if err := handler(c); err != nil {
+		t.Fatalf("%s %s: %v", method, target, err)
+	}
+	var res struct {
+		handlers.ResultJSON
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("%s %s: decoding %q: %v", method, target, rec.Body.String(), err)
+	}
+	if out != nil && res.Result == "OK" {
+		if err := json.Unmarshal(res.Data, out); err != nil {
+			t.Fatalf("%s %s: decoding data: %v", method, target, err)
+		}
+	}
+	res.ResultJSON.Data = string(res.Data)
+	return res.ResultJSON
+}
+
+// TestNotebooks verifies that notebook cells run against the session runtime
+// and that their outputs are cached until the cell's source changes.
+func TestNotebooks(t *testing.T) {
+	setConfig(t, &cfg.ChariotConfig.DataPath, t.TempDir())
+	setConfig(t, &cfg.ChariotConfig.SandboxEnabled, false)
+
+	sm := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	session := sm.NewSession("notebooks", logs.NewZapLogger(), "notebook-token")
+	defer sm.EndSession("notebook-token")
+	var h handlers.Handlers
+
+	var nb handlers.Notebook
+	saved := callNotebook(t, session, h.SaveNotebook, http.MethodPost, "/api/notebooks",
+		`{"name": "explore", "cells": [{"id": "load", "source": "setq(total, 40)"}, {"kind": "markdown", "source": "# Totals"}, {"id": "sum", "source": "add(total, 2)"}]}`, nil, &nb)
+	if saved.Result != "OK" || len(nb.Cells) != 3 || nb.Cells[1].ID == "" {
+		t.Fatalf("SaveNotebook: %v", saved.Data)
+	}
+	if bad := callNotebook(t, session, h.SaveNotebook, http.MethodPost, "/api/notebooks", `{"name": "bad", "cells": [{"kind": "html"}]}`, nil, nil); bad.Result != "ERROR" {
+		t.Fatalf("expected an unknown cell kind to be rejected")
+	}
+
+	params := map[string]string{"name": "explore", "cell": "sum"}
+	res := callNotebook(t, session, h.RunNotebookCell, http.MethodPost, "/api/notebooks/explore/cells/sum/run", "", params, nil)
+	var failed []handlers.NotebookCell
+	json.Unmarshal([]byte(res.Data.(string)), &failed)
+	if res.Result != "ERROR" || len(failed) != 1 || failed[0].Output.Error == nil || !strings.Contains(failed[0].Output.Error.Message, "'total' not defined") {
+		t.Fatalf("expected the cell to fail before total is defined, got %v", res.Data)
+	}
+
+	var ran []handlers.NotebookCell
+	res = callNotebook(t, session, h.RunNotebook, http.MethodPost, "/api/notebooks/explore/run", "", map[string]string{"name": "explore"}, &ran)
+	if res.Result != "OK" || len(ran) != 2 {
+		t.Fatalf("RunNotebook: %v", res.Data)
+	}
+	if out := ran[1].Output; out == nil || out.Value != float64(42) || out.ValueType != "N" {
+		t.Fatalf("expected the second code cell to see the first, got %+v", ran[1].Output)
+	}
+
+	callNotebook(t, session, h.GetNotebook, http.MethodGet, "/api/notebooks/explore", "", map[string]string{"name": "explore"}, &nb)
+	if out := nb.Cells[2].Output; out == nil || out.Stale || out.Value != float64(42) {
+		t.Fatalf("expected the output to be cached, got %+v", out)
+	}
+
+	// Editing a cell keeps its output but marks it stale; ?stale=true reruns only that cell
+	nb.Cells[2].Source = "add(total, 3)"
+	body, _ := json.Marshal(map[string]interface{}{"name": "explore", "cells": nb.Cells})
+	callNotebook(t, session, h.SaveNotebook, http.MethodPost, "/api/notebooks", string(body), nil, &nb)
+	if out := nb.Cells[2].Output; out == nil || !out.Stale {
+		t.Fatalf("expected the edited cell's output to be stale, got %+v", out)
+	}
+	if _, err := session.Runtime.Evaluate("setq(total, 0)"); err != nil {
+		t.Fatalf("reset total: %v", err)
+	}
+	res = callNotebook(t, session, h.RunNotebook, http.MethodPost, "/api/notebooks/explore/run?stale=true", "", map[string]string{"name": "explore"}, &ran)
+	if res.Result != "OK" || len(ran) != 1 || ran[0].ID != "sum" || ran[0].Output.Value != float64(3) {
+		t.Fatalf("expected only the stale cell to run, got %v", res.Data)
+	}
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodDelete, "/api/notebooks/explore", nil), rec)
+	c.Set("session", session)
+	c.SetParamNames("name")
+	c.SetParamValues("explore")
+	if err := h.DeleteNotebook(c); err != nil || rec.Code != http.StatusNoContent {
+		t.Fatalf("DeleteNotebook: %d %v", rec.Code, err)
+	}
+	if missing := callNotebook(t, session, h.GetNotebook, http.MethodGet, "/api/notebooks/explore", "", map[string]string{"name": "explore"}, nil); missing.Result != "ERROR" {
+		t.Fatalf("expected the deleted notebook to be gone")
+	}
+}
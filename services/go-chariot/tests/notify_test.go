@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+// fakeSMTP accepts SMTP sessions and sends each message's recipients and
+// data on the returned channel.
+func fakeSMTP(t *testing.T) (string, <-chan []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	messages := make(chan []string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+				reply("220 fake ESMTP")
+				var msg []string
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					cmd := strings.ToUpper(strings.TrimSpace(line))
+					switch {
+					case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+						reply("250 fake")
+					case strings.HasPrefix(cmd, "RCPT TO:"):
+						msg = append(msg, strings.TrimSpace(line[len("RCPT TO:"):]))
+						reply("250 OK")
+					case cmd == "DATA":
+						reply("354 go ahead")
+						var data strings.Builder
+						for {
+							l, err := r.ReadString('\n')
+							if err != nil || l == ".\r\n" {
+								break
+							}
+							data.WriteString(l)
+						}
+						messages <- append(msg, data.String())
+						msg = nil
+						reply("250 queued")
+					case cmd == "QUIT":
+						reply("221 bye")
+						return
+					default:
+						reply("250 OK")
+					}
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().String(), messages
+}
+
+// TestNotifyFunctions verifies that sendEmail and slackPost deliver through
+// the configured SMTP server and Slack API, and that sandbox profiles limit
+// their recipients.
+func TestNotifyFunctions(t *testing.T) {
+	smtpAddr, messages := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(smtpAddr)
+
+	var slackBody map[string]interface{}
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat.postMessage" || r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&slackBody)
+		w.Write([]byte(`{"ok":true,"ts":"1700000000.000100"}`))
+	}))
+	defer slack.Close()
+
+	smtpPort, _ := strconv.Atoi(port)
+	setConfig(t, &cfg.ChariotConfig.SMTPHost, host)
+	setConfig(t, &cfg.ChariotConfig.SMTPPort, smtpPort)
+	setConfig(t, &cfg.ChariotConfig.SMTPTLS, "none")
+	setConfig(t, &cfg.ChariotConfig.SMTPFrom, "Chariot <chariot@example.com>")
+	setConfig(t, &cfg.ChariotConfig.SlackToken, "xoxb-test")
+	setConfig(t, &cfg.ChariotConfig.SlackAPIURL, slack.URL)
+
+	profiles := filepath.Join(t.TempDir(), "sandbox_profiles.json")
+	os.WriteFile(profiles, []byte(`{
+		"default": "standard",
+		"users": {"intern": "quiet"},
+		"profiles": {
+			"standard": {"email": {"allow": ["*@example.com"]}, "slack": {"allow": ["#ops*"]}},
+			"quiet": {}
+		}
+	}`), 0o644)
+	if err := chariot.LoadSandboxProfiles(profiles); err != nil {
+		t.Fatal(err)
+	}
+	defer chariot.LoadSandboxProfiles(filepath.Join(t.TempDir(), "none.json"))
+
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	rt.SetSandboxProfile(chariot.SandboxProfileFor("alice"))
+
+	if _, err := rt.ExecProgram(`sendEmail('ops@example.com, lead@example.com', 'Nightly load: 3 failures', 'See the run log.', map('cc', 'audit@example.com'))`); err != nil {
+		t.Fatalf("sendEmail: %v", err)
+	}
+	msg := <-messages
+	if len(msg) != 4 || msg[0] != "<ops@example.com>" || msg[2] != "<audit@example.com>" {
+		t.Fatalf("unexpected recipients %v", msg)
+	}
+	if data := msg[3]; !strings.Contains(data, "Subject: Nightly load: 3 failures") || !strings.Contains(data, "Cc: <audit@example.com>") || !strings.Contains(data, "See the run log.") {
+		t.Fatalf("unexpected message:\n%s", data)
+	}
+
+	ts, err := rt.ExecProgram(`slackPost('#ops-alerts', 'Nightly load failed')`)
+	if err != nil || ts != chariot.Str("1700000000.000100") || slackBody["channel"] != "#ops-alerts" || slackBody["text"] != "Nightly load failed" {
+		t.Fatalf("slackPost = %v, %v; body %v", ts, err, slackBody)
+	}
+
+	denied := []string{
+		`sendEmail('someone@elsewhere.org', 's', 'b')`,
+		`sendEmail('ops@example.com', 's', 'b', map('bcc', 'someone@elsewhere.org'))`,
+		`slackPost('#general', 'hi')`,
+	}
+	for _, script := range denied {
+		if _, err := rt.ExecProgram(script); err == nil || !strings.Contains(err.Error(), "not allowed by sandbox profile") {
+			t.Fatalf("%s: expected a sandbox error, got %v", script, err)
+		}
+	}
+
+	quiet := chariot.NewRuntime()
+	chariot.RegisterAll(quiet)
+	quiet.SetSandboxProfile(chariot.SandboxProfileFor("intern"))
+	if _, err := quiet.ExecProgram(`sendEmail('ops@example.com', 's', 'b')`); err == nil || !strings.Contains(err.Error(), `"quiet"`) {
+		t.Fatalf("expected the quiet profile to deny email, got %v", err)
+	}
+	if _, err := rt.ExecProgram(`sendEmail('ops@example.com', 'line\nbreak', 'b')`); err == nil {
+		t.Fatal("expected a subject with a line break to be rejected")
+	}
+}
@@ -1,8 +1,10 @@
 package tests
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
+	"time"
 
 	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
 )
@@ -167,3 +169,169 @@ func TestPlan_RunOnce_WithAgentBeliefs(t *testing.T) {
 		t.Fatalf("expected true from runPlanOnceBDI, got %v (%T)", val, val)
 	}
 }
+
+// The agent detail lists beliefs and plans with their conditions, and no
+// intentions while no plan instance runs.
+func TestAgentDetail(t *testing.T) {
+	rt := createNamedRuntime("agent_detail")
+	defer ch.UnregisterRuntime("agent_detail")
+	defer ch.DefaultAgentStop("inspector")
+
+	setup := strings.Join([]string{
+		"declare(trig,'F', func(){ equal(belief('inspector', 'site'), 'south') })",
+		"declare(guard,'F', func(){ True })",
+		"declare(step,'F', func(){ True })",
+		"declare(drop,'F', func(){ False })",
+		"declareGlobal(p,'P', plan('Inspect', array('site'), trig, guard, array(step, step), drop))",
+		"agentStartNamed('inspector', p)",
+		"agentBelief('inspector', 'site', 'north')",
+	}, "\n")
+	if _, err := rt.ExecProgram(setup); err != nil {
+		t.Fatalf("setup exec: %v", err)
+	}
+
+	d := ch.DefaultAgentDetail("inspector")
+	if d == nil || !d.Running {
+		t.Fatalf("expected a running agent, got %+v", d)
+	}
+	if len(d.Plans) != 1 || d.Plans[0].Name != "Inspect" || d.Plans[0].Steps != 2 || len(d.Plans[0].Params) != 1 {
+		t.Fatalf("unexpected plans %+v", d.Plans)
+	}
+	if !strings.Contains(d.Plans[0].Trigger, "south") {
+		t.Errorf("expected the trigger source, got %q", d.Plans[0].Trigger)
+	}
+	if v, ok := d.Beliefs["site"].(ch.Str); !ok || string(v) != "north" {
+		t.Errorf("expected belief site=north, got %v", d.Beliefs["site"])
+	}
+	if len(d.Intentions) != 0 {
+		t.Errorf("expected no intentions, got %+v", d.Intentions)
+	}
+	if ch.DefaultAgentDetail("nobody") != nil {
+		t.Error("expected no detail for an unknown agent")
+	}
+}
+
+// Beliefs set with a ttl expire, and a subscribed plan runs when its belief
+// changes rather than on every poll.
+func TestAgentBeliefTTLAndSubscription(t *testing.T) {
+	rt := createNamedRuntime("agent_beliefs")
+	defer ch.UnregisterRuntime("agent_beliefs")
+	defer ch.DefaultAgentStop("watcher")
+
+	setup := strings.Join([]string{
+		"declare(trig,'F', func(){ True })",
+		"declare(guard,'F', func(){ True })",
+		"declare(step,'F', func(){ agentBelief('watcher', 'ran', True) })",
+		"declare(drop,'F', func(){ False })",
+		"declareGlobal(p,'P', plan('Watch', array(), trig, guard, array(step), drop))",
+		"agentStartNamed('watcher', p, 1, 1)",
+		"agentSubscribe('watcher', 'Watch', array('door'))",
+		"agentBelief('watcher', 'temp', 20, map('ttl', 0.2, 'confidence', 0.5))",
+	}, "\n")
+	if _, err := rt.ExecProgram(setup); err != nil {
+		t.Fatalf("setup exec: %v", err)
+	}
+
+	info, err := rt.ExecProgram("beliefInfo('watcher', 'temp')")
+	if err != nil {
+		t.Fatalf("beliefInfo: %v", err)
+	}
+	m, ok := info.(*ch.MapValue)
+	if !ok {
+		t.Fatalf("expected a map, got %T", info)
+	}
+	if v, _ := m.Get("confidence"); v != ch.Number(0.5) {
+		t.Errorf("expected confidence 0.5, got %v", v)
+	}
+	if v, _ := m.Get("expires"); v == ch.DBNull {
+		t.Error("expected an expiry time")
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	d := ch.DefaultAgentDetail("watcher")
+	if d.Beliefs["temp"] != nil {
+		t.Errorf("expected temp to have expired, got %v", d.Beliefs["temp"])
+	}
+	if d.Beliefs["ran"] != nil {
+		t.Fatal("subscribed plan ran without a belief change")
+	}
+	if len(d.Plans) != 1 || len(d.Plans[0].Subscribes) != 1 {
+		t.Errorf("expected the plan subscribed to door, got %+v", d.Plans)
+	}
+
+	if _, err := rt.ExecProgram("agentBelief('watcher', 'door', 'open')"); err != nil {
+		t.Fatalf("agentBelief: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for ch.DefaultAgentGetBeliefs("watcher")["ran"] == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("subscribed plan did not run after its belief changed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// A library plan attached to two agents runs in each with its own parameter
+// bindings, and can be detached from one of them.
+func TestPlanLibraryAttach(t *testing.T) {
+	rt := createNamedRuntime("plan_library")
+	defer ch.UnregisterRuntime("plan_library")
+	defer ch.RemoveLibraryPlan("Heat")
+	defer ch.DefaultAgentStop("lab")
+	defer ch.DefaultAgentStop("office")
+
+	setup := strings.Join([]string{
+		"declare(no,'F', func(){ False })",
+		"declare(yes,'F', func(){ True })",
+		"declare(idle,'P', plan('Idle', array(), no, yes, array(yes), no))",
+		"declare(heat,'P', plan('Heat', array('room'), yes, yes, array(func(){ agentBelief(room, 'heated', room) }), no))",
+		"planDefine(heat)",
+		"agentStartNamed('lab', idle, 1, 1)",
+		"agentStartNamed('office', idle, 1, 1)",
+		"agentAttach('lab', 'Heat', map('room', 'lab'))",
+		"agentAttach('office', 'Heat', map('room', 'office'))",
+	}, "\n")
+	if _, err := rt.ExecProgram(setup); err != nil {
+		t.Fatalf("setup exec: %v", err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for _, agent := range []string{"lab", "office"} {
+		for ch.DefaultAgentGetBeliefs(agent)["heated"] != ch.Str(agent) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Heat did not run in %s with its binding", agent)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	d := ch.DefaultAgentDetail("lab")
+	if len(d.Plans) != 2 || d.Plans[1].Name != "Heat" || d.Plans[1].Bindings["room"] != "lab" {
+		t.Errorf("expected Heat bound to lab, got %+v", d.Plans)
+	}
+	if got := ch.AgentsWithPlan("Heat"); strings.Join(got, ",") != "lab,office" {
+		t.Errorf("expected Heat in lab and office, got %v", got)
+	}
+
+	if _, err := rt.ExecProgram("agentAttach('lab', 'Heat', map('floor', 2))"); err == nil {
+		t.Error("expected an error binding an unknown parameter")
+	}
+	if v, err := rt.ExecProgram("agentDetach('lab', 'Heat')"); err != nil || v != ch.Bool(true) {
+		t.Fatalf("agentDetach: %v, %v", v, err)
+	}
+	if got := ch.AgentsWithPlan("Heat"); strings.Join(got, ",") != "office" {
+		t.Errorf("expected Heat only in office, got %v", got)
+	}
+
+	data, err := json.Marshal(ch.PlanToMap(ch.LibraryPlan("Heat")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ch.MapToPlan(m)
+	if err != nil || p.Name != "Heat" || len(p.Steps) != 1 || p.Trigger == nil || len(p.Params) != 1 {
+		t.Errorf("plan did not survive the library format: %+v, %v", p, err)
+	}
+}
@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"bytes"
+	"flag"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/charts"
+)
+
+// TestPlot verifies that plot renders SVG and PNG charts as artifacts of
+// the run and rejects malformed series.
+func TestPlot(t *testing.T) {
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+
+	name, err := rt.ExecProgram(`plot(map('2025', array(120, 90, -30, 200), '2026', array(140, 110, 60, 180)), map('type', 'bar', 'title', 'Monthly sales', 'x', array('Jan', 'Feb', 'Mar', 'Apr')))`)
+	if err != nil || name != chariot.Str("plot-1.svg") {
+		t.Fatalf("plot = %v, %v", name, err)
+	}
+	if _, err := rt.ExecProgram(`plot(array(1, 4, 2, 8), map('type', 'scatter', 'format', 'png', 'name', 'points', 'width', 320, 'height', 200))`); err != nil {
+		t.Fatalf("plot png: %v", err)
+	}
+
+	artifacts := rt.TakeArtifacts()
+	if len(artifacts) != 2 {
+		t.Fatalf("expected 2 artifacts, got %d", len(artifacts))
+	}
+	svg := artifacts[0]
+	if svg.Name != "plot-1.svg" || svg.MimeType != "image/svg+xml" {
+		t.Fatalf("unexpected SVG artifact %s %s", svg.Name, svg.MimeType)
+	}
+	for _, want := range []string{"<svg", "Monthly sales", ">Mar<", ">2026<"} {
+		if !strings.Contains(string(svg.Data), want) {
+			t.Fatalf("SVG lacks %q", want)
+		}
+	}
+	if artifacts[1].Name != "points.png" || artifacts[1].MimeType != "image/png" {
+		t.Fatalf("unexpected PNG artifact %s %s", artifacts[1].Name, artifacts[1].MimeType)
+	}
+	img, err := png.Decode(bytes.NewReader(artifacts[1].Data))
+	if err != nil || img.Bounds().Dx() != 320 || img.Bounds().Dy() != 200 {
+		t.Fatalf("bad PNG: %v", err)
+	}
+	if len(rt.TakeArtifacts()) != 0 {
+		t.Fatal("TakeArtifacts did not clear the artifacts")
+	}
+
+	for script, errSub := range map[string]string{
+		`plot(map('a', array(1, 2), 'b', array(1)))`:  "has 1 values",
+		`plot(array(1, 'two'))`:                       "must be a number",
+		`plot(array(1, 2), map('type', 'pie'))`:       "unknown chart type",
+		`plot(array(1, 2), map('format', 'gif'))`:     "unknown chart format",
+		`plot(array(1, 2), map('colour', 'red'))`:     "unknown option",
+		`plot(array(1, 2), map('width', 100000))`:     "at most",
+		`plot(array(1, 2), map('x', array(1, 2, 3)))`: "x values",
+	} {
+		if _, err := rt.ExecProgram(script); err == nil || !strings.Contains(err.Error(), errSub) {
+			t.Errorf("%s: expected error containing %q, got %v", script, errSub, err)
+		}
+	}
+
+	// Non-finite values leave gaps rather than failing
+	line := &charts.Chart{X: []float64{0, 1, 2}, Series: []charts.Series{{Values: []float64{1, math.NaN(), 3}}}}
+	if _, err := line.Render(charts.PNG); err != nil {
+		t.Fatalf("render with gaps: %v", err)
+	}
+}
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden chart files in testdata/charts")
+
+// TestChartGolden compares rendered charts with the files in testdata/charts,
+// byte for byte for SVG and pixel for pixel for PNG. After an intended
+// change to the renderer, run with -update and review the new files.
+func TestChartGolden(t *testing.T) {
+	cases := map[string]*charts.Chart{
+		"line": {
+			Kind:   charts.Line,
+			Title:  "Queue depth",
+			XLabel: "Hour",
+			YLabel: "Jobs",
+			Labels: []string{"00", "04", "08", "12", "16", "20"},
+			Series: []charts.Series{
+				{Name: "ingest", Values: []float64{12, 30, -4, math.NaN(), 41, 22}},
+				{Name: "export", Values: []float64{5, 8, 13, 21, 17, 9}},
+			},
+			Width:  480,
+			Height: 300,
+		},
+		"bar": {
+			Kind:   charts.Bar,
+			Title:  "Monthly sales",
+			Labels: []string{"Jan", "Feb", "Mar", "Apr"},
+			Series: []charts.Series{
+				{Name: "2025", Values: []float64{120, 90, -30, 200}},
+				{Name: "2026", Values: []float64{140, 110, 60, 180}},
+			},
+			Width:  480,
+			Height: 300,
+		},
+		"scatter": {
+			Kind:   charts.Scatter,
+			X:      []float64{0.5, 1.25, 2, 3.5, 5},
+			Series: []charts.Series{{Values: []float64{1, 4, 2, 8, 5.5}}},
+			Width:  320,
+			Height: 200,
+		},
+	}
+	for name, c := range cases {
+		for _, format := range []charts.Format{charts.SVG, charts.PNG} {
+			got, err := c.Render(format)
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, format, err)
+			}
+			path := filepath.Join("testdata", "charts", name+"."+string(format))
+			if *updateGolden {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%s: %v (run with -update to create it)", path, err)
+			}
+			if format == charts.SVG {
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s differs from the rendered chart:\n%s", path, got)
+				}
+				continue
+			}
+			if diff := differentPixels(t, got, want); diff != 0 {
+				t.Errorf("%s: %d pixels differ from the rendered chart", path, diff)
+			}
+		}
+	}
+}
+
+// differentPixels counts the pixels that differ between two PNG images, or
+// all of them when their sizes differ.
+func differentPixels(t *testing.T, a, b []byte) int {
+	t.Helper()
+	imgA, err := png.Decode(bytes.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imgB, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bounds := imgA.Bounds()
+	if bounds != imgB.Bounds() {
+		return bounds.Dx() * bounds.Dy()
+	}
+	diff := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if color.RGBAModel.Convert(imgA.At(x, y)) != color.RGBAModel.Convert(imgB.At(x, y)) {
+				diff++
+			}
+		}
+	}
+	return diff
+}
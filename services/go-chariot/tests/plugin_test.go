@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+// TestPluginHelperProcess is the plugin process used by TestPlugins: the test
+// binary re-runs itself with CHARIOT_TEST_PLUGIN set and answers calls on
+// stdin until it is closed.
+func TestPluginHelperProcess(t *testing.T) {
+	if os.Getenv("CHARIOT_TEST_PLUGIN") != "1" {
+		return
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req struct {
+			ID       int64         `json:"id"`
+			Function string        `json:"function"`
+			Args     []interface{} `json:"args"`
+		}
+		resp := map[string]interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp["error"] = err.Error()
+		}
+		resp["id"] = req.ID
+		switch req.Function {
+		case "shout":
+			resp["result"] = strings.ToUpper(req.Args[0].(string))
+		case "sumAll":
+			total := 0.0
+			for _, a := range req.Args {
+				total += a.(float64)
+			}
+			resp["result"] = total
+		case "badType":
+			resp["result"] = "not a number"
+		case "crash":
+			os.Exit(3)
+		default:
+			resp["error"] = "unknown function " + req.Function
+		}
+		line, _ := json.Marshal(resp)
+		fmt.Println(string(line))
+	}
+	os.Exit(0)
+}
+
+// TestPlugins verifies that manifest-declared plugin functions are callable
+// from scripts, that arguments are checked against the declared signature,
+// and that a plugin process that dies is restarted.
+func TestPlugins(t *testing.T) {
+	dir := t.TempDir()
+	pluginDir := filepath.Join(dir, "text-tools")
+	if err := os.MkdirAll(pluginDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := map[string]interface{}{
+		"name":    "text-tools",
+		"command": os.Args[0],
+		"args":    []string{"-test.run=^TestPluginHelperProcess$"},
+		"env":     map[string]string{"CHARIOT_TEST_PLUGIN": "1"},
+		"functions": []map[string]interface{}{
+			{"name": "shout", "params": []map[string]interface{}{{"name": "text", "type": "S"}}, "returns": "S"},
+			{"name": "sumAll", "params": []map[string]interface{}{{"name": "n", "type": "N"}}, "variadic": true, "returns": "N"},
+			{"name": "badType", "returns": "N"},
+			{"name": "crash"},
+			{"name": "add"}, // shadows a builtin and is ignored
+		},
+	}
+	data, _ := json.Marshal(manifest)
+	if err := os.WriteFile(filepath.Join(pluginDir, "plugin.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A directory without a manifest is not a plugin
+	if err := os.MkdirAll(filepath.Join(dir, "notes"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := chariot.LoadPlugins(dir)
+	if err != nil || len(loaded) != 1 || len(loaded[0].Functions) != 5 {
+		t.Fatalf("LoadPlugins: %v %+v", err, loaded)
+	}
+	defer func() {
+		chariot.StopPlugins()
+		chariot.LoadPlugins(t.TempDir())
+	}()
+
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+
+	tests := []struct {
+		script string
+		want   chariot.Value
+		errSub string
+	}{
+		{script: `shout('hello')`, want: chariot.Str("HELLO")},
+		{script: `sumAll(1, 2, 3.5)`, want: chariot.Number(6.5)},
+		{script: `add(1, 2)`, want: chariot.Number(3)},
+		{script: `shout(42)`, errSub: "must be of type S"},
+		{script: `shout()`, errSub: "expects 1 arguments"},
+		{script: `badType()`, errSub: "declared N"},
+		{script: `crash()`, errSub: "exited"},
+		{script: `shout('again')`, want: chariot.Str("AGAIN")},
+	}
+	for _, tc := range tests {
+		got, err := rt.ExecProgram(tc.script)
+		if tc.errSub != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.errSub) {
+				t.Fatalf("%s: expected error containing %q, got %v, %v", tc.script, tc.errSub, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("%s = %v, %v; want %v", tc.script, got, err, tc.want)
+		}
+	}
+}
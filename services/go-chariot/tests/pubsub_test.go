@@ -0,0 +1,301 @@
+package tests
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/pubsub"
+)
+
+func TestLocalBus(t *testing.T) {
+	bus := pubsub.NewLocal()
+	a, cancelA := bus.Subscribe("t")
+	b, cancelB := bus.Subscribe("t")
+	bus.Publish("t", []byte("hello"))
+	bus.Publish("other", []byte("ignored"))
+	for _, ch := range []<-chan []byte{a, b} {
+		if got := receive(t, ch); got != "hello" {
+			t.Fatalf("expected hello, got %q", got)
+		}
+	}
+	cancelA()
+	if _, ok := <-a; ok {
+		t.Fatalf("expected the cancelled subscription to be closed")
+	}
+	bus.Publish("t", []byte("again"))
+	if got := receive(t, b); got != "again" {
+		t.Fatalf("expected again, got %q", got)
+	}
+	cancelB()
+}
+
+// TestRedisBus runs two buses, standing in for two replicas, against a
+// minimal in-test Redis streams server.
+func TestRedisBus(t *testing.T) {
+	srv := newFakeRedis(t)
+	defer srv.Close()
+
+	url := "redis://:secret@" + srv.Addr().String()
+	a, err := pubsub.OpenRedis(url)
+	if err != nil {
+		t.Fatalf("OpenRedis: %v", err)
+	}
+	defer a.Close()
+	b, err := pubsub.OpenRedis(url)
+	if err != nil {
+		t.Fatalf("OpenRedis: %v", err)
+	}
+	defer b.Close()
+
+	ch, cancel := b.Subscribe("exec:1")
+	defer cancel()
+	// The subscription is confirmed asynchronously; publish until it lands
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if err := a.Publish("exec:1", []byte(`{"seq":0}`)); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		select {
+		case msg := <-ch:
+			if string(msg) != `{"seq":0}` {
+				t.Fatalf("unexpected message %q", msg)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("message from replica a never reached replica b")
+		}
+	}
+}
+
+// TestRedisBusReconnect verifies that a replica whose connection dropped
+// receives the messages published while it was reconnecting.
+func TestRedisBusReconnect(t *testing.T) {
+	srv := newFakeRedis(t)
+	defer srv.Close()
+
+	url := "redis://:secret@" + srv.Addr().String()
+	a, err := pubsub.OpenRedis(url)
+	if err != nil {
+		t.Fatalf("OpenRedis: %v", err)
+	}
+	defer a.Close()
+	b, err := pubsub.OpenRedis(url)
+	if err != nil {
+		t.Fatalf("OpenRedis: %v", err)
+	}
+	defer b.Close()
+
+	ch, cancel := b.Subscribe("agents")
+	defer cancel()
+	if err := a.Publish("agents", []byte("before")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got := receive(t, ch); got != "before" {
+		t.Fatalf("expected before, got %q", got)
+	}
+
+	srv.dropClients()
+	for _, msg := range []string{"during-1", "during-2"} {
+		if err := a.Publish("agents", []byte(msg)); err != nil {
+			t.Fatalf("Publish after the drop: %v", err)
+		}
+	}
+	for _, want := range []string{"during-1", "during-2"} {
+		select {
+		case msg := <-ch:
+			if string(msg) != want {
+				t.Fatalf("expected %s, got %q", want, msg)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("%s was lost while replica b reconnected", want)
+		}
+	}
+}
+
+func TestRedisBusRejectsBadURL(t *testing.T) {
+	if _, err := pubsub.OpenRedis("http://localhost:6379"); err == nil {
+		t.Fatalf("expected an error for a non-redis URL")
+	}
+}
+
+func receive(t *testing.T, ch <-chan []byte) string {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return string(msg)
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for a message")
+		return ""
+	}
+}
+
+// fakeRedis implements AUTH, PING, XADD, PEXPIRE, XREVRANGE and XREAD over
+// in-memory streams whose entry IDs count up from 1-0.
+type fakeRedis struct {
+	net.Listener
+	mu      sync.Mutex
+	streams map[string][]fakeEntry
+	nextID  int64
+	conns   map[net.Conn]bool
+}
+
+type fakeEntry struct {
+	id  int64
+	msg string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeRedis{Listener: l, streams: map[string][]fakeEntry{}, conns: map[net.Conn]bool{}}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns[conn] = true
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// dropClients closes every client connection, as a server restart would.
+func (s *fakeRedis) dropClients() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+// after returns the entries of key after the ID given as "n-0".
+func (s *fakeRedis) after(key, id string) []fakeEntry {
+	n, _ := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	var out []fakeEntry
+	for _, e := range s.streams[key] {
+		if e.id > n {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func writeEntries(w io.Writer, entries []fakeEntry) {
+	fmt.Fprintf(w, "*%d\r\n", len(entries))
+	for _, e := range entries {
+		id := fmt.Sprintf("%d-0", e.id)
+		fmt.Fprintf(w, "*2\r\n$%d\r\n%s\r\n*2\r\n$3\r\nmsg\r\n$%d\r\n%s\r\n", len(id), id, len(e.msg), e.msg)
+	}
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		switch strings.ToUpper(args[0]) {
+		case "AUTH":
+			if args[len(args)-1] == "secret" {
+				io.WriteString(conn, "+OK\r\n")
+			} else {
+				io.WriteString(conn, "-WRONGPASS invalid password\r\n")
+			}
+		case "PING":
+			io.WriteString(conn, "+PONG\r\n")
+		case "XADD":
+			// XADD key MAXLEN ~ n * msg value
+			s.mu.Lock()
+			s.nextID++
+			s.streams[args[1]] = append(s.streams[args[1]], fakeEntry{id: s.nextID, msg: args[len(args)-1]})
+			id := fmt.Sprintf("%d-0", s.nextID)
+			s.mu.Unlock()
+			fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(id), id)
+		case "PEXPIRE":
+			io.WriteString(conn, ":1\r\n")
+		case "XREVRANGE":
+			s.mu.Lock()
+			entries := s.streams[args[1]]
+			if len(entries) > 1 {
+				entries = entries[len(entries)-1:]
+			}
+			writeEntries(conn, entries)
+			s.mu.Unlock()
+		case "XREAD":
+			// XREAD COUNT n BLOCK ms STREAMS key... id...
+			block, _ := strconv.Atoi(args[4])
+			streams := args[6:]
+			keys, ids := streams[:len(streams)/2], streams[len(streams)/2:]
+			deadline := time.Now().Add(time.Duration(block) * time.Millisecond)
+			for {
+				s.mu.Lock()
+				var found []string
+				var entries [][]fakeEntry
+				for i, key := range keys {
+					if e := s.after(key, ids[i]); len(e) > 0 {
+						found = append(found, key)
+						entries = append(entries, e)
+					}
+				}
+				s.mu.Unlock()
+				if len(found) > 0 {
+					fmt.Fprintf(conn, "*%d\r\n", len(found))
+					for i, key := range found {
+						fmt.Fprintf(conn, "*2\r\n$%d\r\n%s\r\n", len(key), key)
+						writeEntries(conn, entries[i])
+					}
+					break
+				}
+				if time.Now().After(deadline) {
+					io.WriteString(conn, "*-1\r\n")
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		default:
+			io.WriteString(conn, "-ERR unknown command\r\n")
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+)
+
+func quotaLimit(v int64) *int64 { return &v }
+
+// TestQuotaLimits verifies that the most generous role limit applies and that
+// a user's own limits win, and that the limits survive reloading.
+func TestQuotaLimits(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "quotas.json")
+	q := handlers.NewQuotaManager(file)
+	if err := q.SetRoleLimits("viewer", &handlers.QuotaLimits{ExecutionsPerHour: quotaLimit(10), Listeners: quotaLimit(1)}); err != nil {
+		t.Fatalf("SetRoleLimits: %v", err)
+	}
+	if err := q.SetRoleLimits("contributor", &handlers.QuotaLimits{ExecutionsPerHour: quotaLimit(100)}); err != nil {
+		t.Fatalf("SetRoleLimits: %v", err)
+	}
+	if err := q.SetUserLimits("dave", &handlers.QuotaLimits{ConcurrentExecutions: quotaLimit(2)}); err != nil {
+		t.Fatalf("SetUserLimits: %v", err)
+	}
+	if err := q.SetUserLimits("eve", &handlers.QuotaLimits{Listeners: quotaLimit(-1)}); err == nil {
+		t.Error("a negative limit was accepted")
+	}
+
+	got := q.Limits("dave", []string{"viewer", "contributor"})
+	if got.ExecutionsPerHour != 100 || got.Listeners != 1 || got.ConcurrentExecutions != 2 {
+		t.Errorf("unexpected limits %+v", got)
+	}
+	if got := handlers.NewQuotaManager(file).Limits("dave", []string{"viewer"}); got.ExecutionsPerHour != 10 || got.ConcurrentExecutions != 2 {
+		t.Errorf("limits not reloaded: %+v", got)
+	}
+	if err := q.SetUserLimits("dave", nil); err != nil {
+		t.Fatalf("SetUserLimits(nil): %v", err)
+	}
+	if got := q.Limits("dave", nil); got.ConcurrentExecutions != 0 {
+		t.Errorf("removed user limit still applies: %+v", got)
+	}
+}
+
+// TestQuotaExecutions verifies the concurrency and hourly execution limits.
+func TestQuotaExecutions(t *testing.T) {
+	q := handlers.NewQuotaManager("")
+	quota := handlers.Quota{ConcurrentExecutions: 1, ExecutionsPerHour: 2}
+
+	done, qe := q.BeginExecution("dave", quota)
+	if qe != nil {
+		t.Fatalf("first execution refused: %v", qe)
+	}
+	if _, qe := q.BeginExecution("dave", quota); qe == nil || qe.Quota != "concurrent_executions" {
+		t.Fatalf("expected a concurrency refusal, got %v", qe)
+	}
+	if _, qe := q.BeginExecution("erin", quota); qe != nil {
+		t.Errorf("another user was refused: %v", qe)
+	}
+	done()
+	done()
+	if _, running := q.ExecutionUsage("dave"); running != 0 {
+		t.Errorf("expected no running executions, got %d", running)
+	}
+
+	done, qe = q.BeginExecution("dave", quota)
+	if qe != nil {
+		t.Fatalf("second execution refused: %v", qe)
+	}
+	done()
+	_, qe = q.BeginExecution("dave", quota)
+	if qe == nil || qe.Quota != "executions_per_hour" || qe.Used != 2 || qe.RetryAfter <= 0 {
+		t.Fatalf("expected an hourly refusal with a retry delay, got %+v", qe)
+	}
+
+	q.ResetExecutions("dave")
+	if lastHour, _ := q.ExecutionUsage("dave"); lastHour != 0 {
+		t.Errorf("reset left %d executions", lastHour)
+	}
+	if _, qe := q.BeginExecution("dave", quota); qe != nil {
+		t.Errorf("execution refused after reset: %v", qe)
+	}
+}
@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+)
+
+// TestRenameInSource verifies that a rename follows the parsed program:
+// comments, unrelated strings and shadowing parameters are left alone.
+func TestRenameInSource(t *testing.T) {
+	src := `// rate is the tax rate
+setq(rate, 0.2)
+registerFunction('withTax', func(amount) { mul(amount, add(1, rate)) })
+registerFunction('scaled', func(rate) { mul(rate, 2) })
+setq(label, 'rate')
+withTax(rate)`
+	out, refs, conflicts, err := ch.RenameInSource(src, "tax.ch", "rate", "taxRate", nil)
+	if err != nil || len(conflicts) > 0 {
+		t.Fatalf("rename: %v %v", err, conflicts)
+	}
+	want := `// rate is the tax rate
+setq(taxRate, 0.2)
+registerFunction('withTax', func(amount) { mul(amount, add(1, taxRate)) })
+registerFunction('scaled', func(rate) { mul(rate, 2) })
+setq(label, 'rate')
+withTax(taxRate)`
+	if out != want {
+		t.Errorf("unexpected result:\n%s", out)
+	}
+	if len(refs) != 3 || refs[0].Role != "definition" || refs[1].Function != "withTax" || refs[2].Line != 6 {
+		t.Errorf("unexpected occurrences %+v", refs)
+	}
+
+	out, _, _, _ = ch.RenameInSource(src, "tax.ch", "withTax", "gross", nil)
+	if !strings.Contains(out, "registerFunction('gross'") || !strings.Contains(out, "gross(rate)") {
+		t.Errorf("function not renamed:\n%s", out)
+	}
+
+	// amount is a parameter of withTax, which uses rate
+	if _, _, conflicts, _ := ch.RenameInSource(src, "tax.ch", "rate", "amount", nil); len(conflicts) == 0 {
+		t.Errorf("expected the parameter to conflict")
+	}
+	if _, _, conflicts, _ := ch.RenameInSource(src, "tax.ch", "rate", "label", nil); len(conflicts) == 0 {
+		t.Errorf("expected the existing name to conflict")
+	}
+	if err := ch.CheckRename(nil, "rate", "add"); err == nil {
+		t.Errorf("expected renaming to a builtin to fail")
+	}
+}
+
+func TestRenameSymbolEndpoint(t *testing.T) {
+	setConfig(t, &cfg.ChariotConfig.DataPath, t.TempDir())
+	setConfig(t, &cfg.ChariotConfig.TreePath, t.TempDir())
+	setConfig(t, &cfg.ChariotConfig.SandboxEnabled, false)
+	setConfig(t, &cfg.ChariotConfig.FunctionLib, "stlib.json")
+
+	rt := ch.NewRuntime()
+	if err := rt.SaveFunction("netPrice", "function netPrice(price) { mul(price, discount) }", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.SaveFunctionsToFile(rt.ListUserFunctionsMap(), "stlib.json"); err != nil {
+		t.Fatal(err)
+	}
+	base, err := cfg.EnsureStorageBase(cfg.StorageKindData, cfg.StorageScopeGlobal, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(base, "files")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(dir, "main.ch")
+	if err := os.WriteFile(main, []byte("setq(discount, 0.9)\nnetPrice(100)\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sm := ch.NewSessionManager(30*time.Minute, 5*time.Minute)
+	session := sm.NewSession("refactor", logs.NewZapLogger(), "refactor-token")
+	defer sm.EndSession("refactor-token")
+	var h handlers.Handlers
+
+	var preview struct {
+		Changes []handlers.RenameChange `json:"changes"`
+		Applied bool                    `json:"applied"`
+	}
+	res := callNotebook(t, session, h.RenameSymbol, http.MethodPost, "/api/refactor/rename", `{"symbol": "discount", "new_name": "rebate"}`, nil, &preview)
+	if res.Result != "OK" || preview.Applied || len(preview.Changes) != 2 {
+		t.Fatalf("preview: %v", res.Data)
+	}
+	if !strings.Contains(preview.Changes[0].Diff, "-setq(discount, 0.9)\n+setq(rebate, 0.9)") {
+		t.Errorf("unexpected diff %q", preview.Changes[0].Diff)
+	}
+	if data, _ := os.ReadFile(main); !strings.Contains(string(data), "discount") {
+		t.Errorf("preview changed the file")
+	}
+
+	res = callNotebook(t, session, h.RenameSymbol, http.MethodPost, "/api/refactor/rename", `{"symbol": "netPrice", "new_name": "priceAfterDiscount", "apply": true}`, nil, nil)
+	if res.Result != "OK" {
+		t.Fatalf("apply: %v", res.Data)
+	}
+	if data, _ := os.ReadFile(main); string(data) != "setq(discount, 0.9)\npriceAfterDiscount(100)\n" {
+		t.Errorf("unexpected file %q", data)
+	}
+	library, err := ch.LoadFunctionsFromFile("stlib.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if library["netPrice"] != nil || library["priceAfterDiscount"] == nil {
+		t.Errorf("library function not renamed: %v", library)
+	}
+
+	if res := callNotebook(t, session, h.RenameSymbol, http.MethodPost, "/api/refactor/rename", `{"symbol": "discount", "new_name": "price"}`, nil, nil); res.Result != "ERROR" {
+		t.Errorf("expected the parameter of the library function to conflict")
+	}
+}
+
+func TestSymbolReferences(t *testing.T) {
+	setConfig(t, &cfg.ChariotConfig.TreePath, t.TempDir())
+	setConfig(t, &cfg.ChariotConfig.FunctionLib, "stlib.json")
+
+	rt := ch.NewRuntime()
+	if err := rt.SaveFunction("netPrice", "function netPrice(price) { mul(price, discount) }", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.SaveFunctionsToFile(rt.ListUserFunctionsMap(), "stlib.json"); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.ch")
+	if err := os.WriteFile(main, []byte("setq(discount, 0.9)\nnetPrice(100)\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.ch"), []byte("netPrice(("), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	index := handlers.NewSymbolIndex()
+	refs, skipped, err := index.References(dir, "discount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 2 || refs[0].File != "main.ch" || refs[0].Role != "definition" || !refs[1].Library || refs[1].Function != "netPrice" {
+		t.Errorf("unexpected references %+v", refs)
+	}
+	if len(skipped) != 1 || skipped[0].File != "broken.ch" {
+		t.Errorf("unexpected skipped %+v", skipped)
+	}
+
+	// A save is seen even within the file system's time resolution
+	if err := os.WriteFile(main, []byte("setq(discount, 0.9)\nnetPrice(discount)\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	index.Changed(main)
+	if refs, _, _ := index.References(dir, "discount"); len(refs) != 3 || refs[1].Line != 2 || refs[1].Column != 10 {
+		t.Errorf("unexpected references after the save %+v", refs)
+	}
+}
+
+func TestSymbolSearch(t *testing.T) {
+	setConfig(t, &cfg.ChariotConfig.TreePath, t.TempDir())
+	setConfig(t, &cfg.ChariotConfig.FunctionLib, "")
+
+	dir := t.TempDir()
+	src := "setq(total, 0)\nregisterFunction('addTotal', func(n) { setq(total, add(total, n)) })\naddTotal(5)\n"
+	if err := os.WriteFile(filepath.Join(dir, "main.ch"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	index := handlers.NewSymbolIndex()
+	symbols, err := index.Symbols(dir, "TOT", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(symbols) != 2 || symbols[0].Name != "addTotal" || symbols[0].Kind != "function" || symbols[0].References != 1 {
+		t.Fatalf("unexpected symbols %+v", symbols)
+	}
+	if total := symbols[1]; total.Name != "total" || total.Kind != "variable" || len(total.Definitions) != 2 || total.References != 1 {
+		t.Errorf("unexpected variable %+v", total)
+	}
+	if symbols, _ := index.Symbols(dir, "", "function"); len(symbols) != 1 {
+		t.Errorf("unexpected functions %+v", symbols)
+	}
+
+	status := index.Status()
+	if status.Directories != 1 || status.Files != 1 || status.Symbols != 2 || status.Parsed != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+	// A second query finds the file unchanged
+	index.Symbols(dir, "", "")
+	if status := index.Status(); status.Parsed != 1 {
+		t.Errorf("file parsed again: %+v", status)
+	}
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// TestReplWebSocket verifies that REPL entries are evaluated one at a time on
+// the session runtime, each answered with its value, type and timing.
+func TestReplWebSocket(t *testing.T) {
+	sm := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	session := sm.NewSession("repl", logs.NewZapLogger(), "repl-token")
+	defer sm.EndSession("repl-token")
+	var h handlers.Handlers
+
+	e := echo.New()
+	e.GET("/api/repl", h.HandleReplWS, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("session", session)
+			return next(c)
+		}
+	})
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/repl", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	var hello map[string]string
+	if err := conn.ReadJSON(&hello); err != nil || hello["type"] != "hello" {
+		t.Fatalf("expected a hello message, got %v (%v)", hello, err)
+	}
+
+	eval := func(req interface{}) handlers.ReplResult {
+		t.Helper()
+		var err error
+		if s, ok := req.(string); ok {
+			err = conn.WriteMessage(websocket.TextMessage, []byte(s))
+		} else {
+			err = conn.WriteJSON(req)
+		}
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		var res handlers.ReplResult
+		if err := conn.ReadJSON(&res); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return res
+	}
+
+	if res := eval(handlers.ReplRequest{ID: "1", Expr: "setq(total, 40)"}); res.Result != "OK" || res.ID != "1" {
+		t.Fatalf("setq: %+v", res)
+	}
+	res := eval("add(total, 2)")
+	if res.Result != "OK" || res.Value != float64(42) || res.ValueType != "N" {
+		t.Fatalf("expected 42 of type N, got %+v", res)
+	}
+	if res.DurationMs < 0 {
+		t.Fatalf("expected a duration, got %v", res.DurationMs)
+	}
+	if res := eval(handlers.ReplRequest{Expr: "missingVariable"}); res.Result != "ERROR" || res.Error == "" {
+		t.Fatalf("expected an error for an undefined variable, got %+v", res)
+	}
+	if _, err := session.Runtime.Evaluate("total"); err != nil {
+		t.Fatalf("expected REPL definitions on the session runtime: %v", err)
+	}
+	if session.Running() {
+		t.Fatalf("expected the session runtime to be released after each entry")
+	}
+}
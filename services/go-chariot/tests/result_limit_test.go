@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+	"github.com/labstack/echo/v4"
+)
+
+// requestResult calls GetResult with an Accept header, if not empty.
+func requestResult(t *testing.T, h *handlers.Handlers, session *chariot.Session, execID, query, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/result/"+execID+query, nil)
+	if accept != "" {
+		req.Header.Set(echo.HeaderAccept, accept)
+	}
+	c := e.NewContext(req, rec)
+	c.Set("session", session)
+	c.SetParamNames("execId")
+	c.SetParamValues(execID)
+	if err := h.GetResult(c); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// getResult polls GetResult once for the envelope.
+func getResult(t *testing.T, h *handlers.Handlers, session *chariot.Session, execID, query string, out interface{}) handlers.ResultJSON {
+	t.Helper()
+	rec := requestResult(t, h, session, execID, query, "")
+	var res struct {
+		handlers.ResultJSON
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("GetResult: decoding %q: %v", rec.Body.String(), err)
+	}
+	if out != nil && res.Result == "OK" {
+		if err := json.Unmarshal(res.Data, out); err != nil {
+			t.Fatalf("GetResult: decoding data: %v", err)
+		}
+	}
+	res.ResultJSON.Data = string(res.Data)
+	return res.ResultJSON
+}
+
+// runAsync starts an async execution and waits for it to finish.
+func runAsync(t *testing.T, h *handlers.Handlers, session *chariot.Session, program string) string {
+	t.Helper()
+	started := callWithSession(t, session, h.ExecuteAsync, http.MethodPost, "/api/execute-async", executeBody(program))
+	execID, _ := started.Data.(map[string]interface{})["execution_id"].(string)
+	if execID == "" {
+		t.Fatalf("ExecuteAsync: %v", started.Data)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for getResult(t, h, session, execID, "", nil).Result == "PENDING" {
+		if time.Now().After(deadline) {
+			t.Fatal("execution did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return execID
+}
+
+// TestOversizedResults verifies that a result over the size limit is cut to
+// its leading elements with the full result as a downloadable artifact, and
+// that an async array result can be read a page at a time.
+func TestOversizedResults(t *testing.T) {
+	setConfig(t, &cfg.ChariotConfig.DataPath, t.TempDir())
+	setConfig(t, &cfg.ChariotConfig.ResultMaxSize, 1) // KB
+
+	sm := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	session := sm.NewSession("analyst", logs.NewZapLogger(), "result-token")
+	defer sm.EndSession("result-token")
+	h := handlers.NewHandlers(sm, nil)
+	defer h.Close()
+
+	// 200 rows of about 30 bytes each
+	program := `
+setq(rows, array())
+setq(i, 0)
+while(smaller(i, 200)) {
+	addTo(rows, map('id', i, 'name', 'row-name'))
+	setq(i, add(i, 1))
+}
+rows`
+	res := callNotebook(t, session, h.Execute, http.MethodPost, "/api/execute", executeBody(program), nil, nil)
+	if res.Result != "OK" || res.Truncated == nil {
+		t.Fatalf("Execute: %v, truncated %+v", res.Data, res.Truncated)
+	}
+	var kept []interface{}
+	json.Unmarshal([]byte(res.Data.(string)), &kept)
+	tr := res.Truncated
+	if tr.Items != 200 || tr.Kept == 0 || tr.Kept != len(kept) || len(res.Data.(string)) > 1024 || tr.Size <= 1024 {
+		t.Fatalf("truncated %+v with %d bytes of data", tr, len(res.Data.(string)))
+	}
+	parts := strings.Split(tr.Artifact, "/")
+	if len(parts) != 5 || parts[4] != "result.full.json" {
+		t.Fatalf("artifact %q", tr.Artifact)
+	}
+	rec := downloadArtifact(t, h, session, parts[3], parts[4])
+	var full []interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &full); err != nil || len(full) != 200 {
+		t.Fatalf("full result: %d rows, %v", len(full), err)
+	}
+
+	// Async runs are paged from the spilled result
+	execID := runAsync(t, h, session, program)
+	res = getResult(t, h, session, execID, "", nil)
+	if res.Result != "OK" || res.Truncated == nil {
+		t.Fatalf("GetResult: %v", res.Data)
+	}
+	var rows []map[string]interface{}
+	for offset := 0; ; {
+		var page []map[string]interface{}
+		res := getResult(t, h, session, execID, "?offset="+strconv.Itoa(offset)+"&limit=50", &page)
+		if res.Result != "OK" || res.Page == nil || res.Page.Total != 200 || res.Page.Count != len(page) || len(page) == 0 {
+			t.Fatalf("page at %d: %v %+v", offset, res.Data, res.Page)
+		}
+		rows = append(rows, page...)
+		if res.Page.Next == nil {
+			break
+		}
+		offset = *res.Page.Next
+	}
+	if len(rows) != 200 || rows[199]["id"] != float64(199) {
+		t.Fatalf("paged %d rows", len(rows))
+	}
+	if bad := getResult(t, h, session, execID, "?limit=0", nil); bad.Result != "ERROR" {
+		t.Fatalf("limit=0 accepted: %v", bad.Data)
+	}
+}
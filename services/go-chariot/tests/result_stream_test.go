@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+	"github.com/labstack/echo/v4"
+)
+
+// follow calls a streaming handler for an execution and returns the
+// complete response.
+func follow(t *testing.T, session *chariot.Session, handler echo.HandlerFunc, path, execID string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, path, nil), rec)
+	c.Set("session", session)
+	c.SetParamNames("execId")
+	c.SetParamValues(execID)
+	if err := handler(c); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// TestEmittedResults verifies that values sent with emit are streamed as
+// NDJSON and as "result" events on the log stream, whatever its filter.
+func TestEmittedResults(t *testing.T) {
+	setConfig(t, &cfg.ChariotConfig.DataPath, t.TempDir())
+
+	sm := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	session := sm.NewSession("analyst", logs.NewZapLogger(), "emit-token")
+	defer sm.EndSession("emit-token")
+	h := handlers.NewHandlers(sm, nil)
+	defer h.Close()
+
+	execID := runAsync(t, h, session, `
+setq(i, 1)
+while(smaller(i, 4)) {
+	logPrint(concat('batch ', i))
+	emit(map('batch', i, 'rows', array(i)))
+	setq(i, add(i, 1))
+}
+'done'`)
+
+	rec := follow(t, session, h.StreamResults, "/api/result/"+execID+"/stream", execID)
+	want := "{\"batch\":1,\"rows\":[1]}\n{\"batch\":2,\"rows\":[2]}\n{\"batch\":3,\"rows\":[3]}\n"
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" || rec.Body.String() != want {
+		t.Fatalf("stream: %d %s %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	if missed := rec.Result().Trailer.Get("Chariot-Missed"); missed != "0" {
+		t.Errorf("missed %q", missed)
+	}
+
+	rec = follow(t, session, h.StreamLogs, "/api/logs/"+execID+"?level=error", execID)
+	body := rec.Body.String()
+	if strings.Count(body, "event: result\n") != 3 || !strings.Contains(body, `data: {"batch":2,"rows":[2]}`) || strings.Contains(body, "batch 2") {
+		t.Errorf("log stream: %q", body)
+	}
+	if res := getResult(t, h, session, execID, "", nil); res.Result != "OK" || res.Data != `"done"` {
+		t.Errorf("result: %v", res.Data)
+	}
+
+	// Without a stream to follow, emit drops the value
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	if v, err := rt.ExecProgram(`emit(1)`); err != nil || v != chariot.Bool(false) {
+		t.Errorf("emit without a writer: %v, %v", v, err)
+	}
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+)
+
+// TestResultNegotiation verifies that /api/result sends the envelope by
+// default and the result itself as JSON, NDJSON, CSV, text or its declared
+// artifact when Accept asks for it.
+func TestResultNegotiation(t *testing.T) {
+	setConfig(t, &cfg.ChariotConfig.DataPath, t.TempDir())
+
+	sm := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	session := sm.NewSession("analyst", logs.NewZapLogger(), "negotiation-token")
+	defer sm.EndSession("negotiation-token")
+	h := handlers.NewHandlers(sm, nil)
+	defer h.Close()
+
+	table := runAsync(t, h, session, `
+resultType('table', array('name', 'id'))
+array(map('id', 1, 'name', 'alpha'), map('id', 2, 'name', 'beta, inc'))`)
+	if res := getResult(t, h, session, table, "", nil); res.Type == nil || res.Type.Kind != "table" {
+		t.Fatalf("envelope type %+v", res.Type)
+	}
+	for _, c := range []struct{ accept, query, contentType, body string }{
+		{"text/csv", "", "text/csv; charset=utf-8", "name,id\nalpha,1\n\"beta, inc\",2\n"},
+		{"application/x-ndjson", "", "application/x-ndjson", "{\"id\":1,\"name\":\"alpha\"}\n{\"id\":2,\"name\":\"beta, inc\"}\n"},
+		{"application/json", "?offset=1", "application/json", "[{\"id\":2,\"name\":\"beta, inc\"}]\n"},
+		{"text/html;q=0.9, text/csv;q=0.5", "", "text/csv; charset=utf-8", "name,id\nalpha,1\n\"beta, inc\",2\n"},
+	} {
+		rec := requestResult(t, h, session, table, c.query, c.accept)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != c.contentType || rec.Body.String() != c.body {
+			t.Errorf("Accept %s: %d %s %q", c.accept, rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+		}
+	}
+	if rec := requestResult(t, h, session, table, "", "text/plain"); rec.Code != http.StatusNotAcceptable {
+		t.Errorf("table as text: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := requestResult(t, h, session, table, "", "*/*"); !strings.Contains(rec.Body.String(), `"result":"OK"`) || rec.Header().Get("Vary") != "Accept" {
+		t.Errorf("*/* did not get the envelope: %s", rec.Body.String())
+	}
+
+	text := runAsync(t, h, session, `resultType('text')
+'All 3 loads finished'`)
+	if rec := requestResult(t, h, session, text, "", "text/*"); rec.Body.String() != "All 3 loads finished" {
+		t.Errorf("text result: %d %q", rec.Code, rec.Body.String())
+	}
+
+	chart := runAsync(t, h, session, `resultType('artifact', 'plot-1.svg')
+plot(array(1, 4, 9))`)
+	rec := requestResult(t, h, session, chart, "", "image/svg+xml")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/svg+xml" || !strings.Contains(rec.Body.String(), "<svg") {
+		t.Errorf("artifact result: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	for _, program := range []string{`resultType('chart')`, `resultType('artifact')`, `resultType('table', 'id')`, `resultType('text', 'x')`} {
+		if _, err := rt.ExecProgram(program); err == nil {
+			t.Errorf("%s accepted", program)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+// flakyRuntime registers flaky(), which fails with message until it has been
+// called more than failures times.
+func flakyRuntime(failures int, message string) (*ch.Runtime, *int) {
+	rt := ch.NewRuntime()
+	ch.RegisterAll(rt)
+	calls := 0
+	rt.Register("flaky", func(args ...ch.Value) (ch.Value, error) {
+		calls++
+		if calls <= failures {
+			return nil, errors.New(message)
+		}
+		return ch.Str("ok"), nil
+	})
+	return rt, &calls
+}
+
+func TestRetry(t *testing.T) {
+	rt, calls := flakyRuntime(2, "Error 1213: deadlock found")
+	val, err := rt.ExecProgram("retry(func() { flaky() }, 3, 1, array('1213'))")
+	if err != nil || val != ch.Str("ok") || *calls != 3 {
+		t.Errorf("expected success on the third attempt, got %v, %v after %d calls", val, err, *calls)
+	}
+
+	rt, calls = flakyRuntime(5, "Error 1213: deadlock found")
+	if _, err := rt.ExecProgram("retry(func() { flaky() }, 3, 1)"); err == nil || *calls != 3 {
+		t.Errorf("expected to give up after 3 attempts, got %v after %d calls", err, *calls)
+	}
+
+	// Errors that are not retryable fail at once
+	rt, calls = flakyRuntime(1, "Error 1064: syntax error")
+	if _, err := rt.ExecProgram("retry(func() { flaky() }, 3, 1, array('1213', 'timeout'))"); err == nil || *calls != 1 {
+		t.Errorf("expected no retry of a syntax error, got %v after %d calls", err, *calls)
+	}
+}
+
+func TestCircuit(t *testing.T) {
+	name := "test-flaky-dependency"
+	rt, calls := flakyRuntime(2, "connection refused")
+	program := fmt.Sprintf("circuit('%s', func() { flaky() }, map('threshold', 2, 'resetMs', 60000, 'fallback', 'cached'))", name)
+	for i := 0; i < 2; i++ {
+		if _, err := rt.ExecProgram(program); err == nil {
+			t.Fatalf("expected call %d to fail", i+1)
+		}
+	}
+	// Open: the fallback is returned without calling
+	val, err := rt.ExecProgram(program)
+	if err != nil || val != ch.Str("cached") || *calls != 2 {
+		t.Errorf("expected the fallback from the open circuit, got %v, %v after %d calls", val, err, *calls)
+	}
+	state := circuitState(name)
+	if state == nil || state.State != ch.CircuitOpen || state.Rejected != 1 || state.LastError == "" {
+		t.Errorf("unexpected circuit state %+v", state)
+	}
+
+	// The circuit is shared by other runtimes
+	other := ch.NewRuntime()
+	ch.RegisterAll(other)
+	_, err = other.ExecProgram(fmt.Sprintf("circuit('%s', func() { 1 })", name))
+	if !errors.Is(err, ch.ErrCircuitOpen) {
+		t.Errorf("expected the open circuit to reject another runtime's call, got %v", err)
+	}
+
+	if !ch.ResetCircuit(name) {
+		t.Fatalf("expected the circuit to be found")
+	}
+	if val, err := rt.ExecProgram(program); err != nil || val != ch.Str("ok") {
+		t.Errorf("expected the call to go through after reset, got %v, %v", val, err)
+	}
+}
+
+func circuitState(name string) *ch.CircuitState {
+	for _, st := range ch.Circuits() {
+		if st.Name == name {
+			return &st
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/labstack/echo/v4"
+)
+
+// TestHTTPErrorJSON verifies that unknown routes and wrong methods are
+// answered in the API's JSON form, with the Allow header on a 405, and that
+// named path parameters reach the handler.
+func TestHTTPErrorJSON(t *testing.T) {
+	var h handlers.Handlers
+	e := echo.New()
+	e.HTTPErrorHandler = h.HTTPError
+	e.Group("/api").GET("/result/:execId", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, handlers.ResultJSON{Result: "OK", Data: c.Param("execId")})
+	})
+	call := func(method, path string) (*httptest.ResponseRecorder, handlers.ResultJSON) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		var body handlers.ResultJSON
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s %s: body is not JSON: %q", method, path, rec.Body.String())
+		}
+		return rec, body
+	}
+
+	if rec, body := call(http.MethodGet, "/api/result/exec-7"); rec.Code != http.StatusOK || body.Data != "exec-7" {
+		t.Errorf("path parameter: status %d, data %v", rec.Code, body.Data)
+	}
+	rec, body := call(http.MethodPut, "/api/result/exec-7")
+	if rec.Code != http.StatusMethodNotAllowed || body.Result != "ERROR" {
+		t.Errorf("wrong method: status %d, result %q", rec.Code, body.Result)
+	}
+	if allow := rec.Header().Get("Allow"); allow == "" {
+		t.Error("405 without an Allow header")
+	}
+	if rec, body := call(http.MethodGet, "/api/nowhere"); rec.Code != http.StatusNotFound || body.Result != "ERROR" {
+		t.Errorf("unknown route: status %d, result %q", rec.Code, body.Result)
+	}
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+)
+
+// TestRuntimeLifetime verifies ephemeral executions, explicit resets and the
+// idle reset policy of session runtimes.
+func TestRuntimeLifetime(t *testing.T) {
+	sm := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	session := sm.NewSession("lifetime", logs.NewZapLogger(), "lifetime-token")
+	defer sm.EndSession("lifetime-token")
+	var h handlers.Handlers
+
+	defined := func() bool {
+		_, err := session.Runtime.Evaluate("kept")
+		return err == nil
+	}
+
+	res := callWithSession(t, session, h.Execute, http.MethodPost, "/api/execute", `{"program": "setq(gone, 1)", "runtime": "ephemeral"}`)
+	if res.Result != "OK" {
+		t.Fatalf("ephemeral Execute: %v", res.Data)
+	}
+	if _, err := session.Runtime.Evaluate("gone"); err == nil {
+		t.Fatalf("an ephemeral execution changed the session runtime")
+	}
+	if bad := callWithSession(t, session, h.Execute, http.MethodPost, "/api/execute", `{"program": "setq(x, 1)", "runtime": "shared"}`); bad.Result != "ERROR" {
+		t.Fatalf("expected an unknown runtime to be rejected")
+	}
+
+	res = callWithSession(t, session, h.Execute, http.MethodPost, "/api/execute", `{"program": "setq(kept, 1)"}`)
+	if res.Result != "OK" || !defined() {
+		t.Fatalf("expected the session runtime to keep its variables: %v", res.Data)
+	}
+	if session.RuntimeUsed().IsZero() {
+		t.Fatalf("expected the run to be recorded")
+	}
+
+	size := callWithSession(t, session, h.RuntimeSize, http.MethodGet, "/api/runtime/size", "")
+	if data, ok := size.Data.(map[string]interface{}); !ok || data["running"] != false || data["size"] == nil {
+		t.Fatalf("unexpected size %v", size.Data)
+	}
+
+	session.BeginRun()
+	if err := session.ResetRuntime(); err != chariot.ErrRuntimeBusy {
+		t.Fatalf("expected a busy runtime to refuse a reset, got %v", err)
+	}
+	session.EndRun()
+
+	if reset := callWithSession(t, session, h.ResetRuntime, http.MethodPost, "/api/runtime/reset", ""); reset.Result != "OK" {
+		t.Fatalf("ResetRuntime: %v", reset.Data)
+	}
+	if defined() {
+		t.Fatalf("expected the reset runtime to have lost its variables")
+	}
+
+	// The idle policy resets a runtime only once it has been used
+	if err := sm.SetRuntimeIdlePolicy(time.Millisecond, "evict"); err == nil {
+		t.Fatalf("expected an unknown policy to be rejected")
+	}
+	if err := sm.SetRuntimeIdlePolicy(time.Millisecond, chariot.RuntimeIdleReset); err != nil {
+		t.Fatalf("SetRuntimeIdlePolicy: %v", err)
+	}
+	callWithSession(t, session, h.Execute, http.MethodPost, "/api/execute", `{"program": "setq(kept, 1)"}`)
+	time.Sleep(5 * time.Millisecond)
+	sm.CleanupExpiredSessions()
+	if defined() {
+		t.Fatalf("expected the idle runtime to be reset")
+	}
+	if _, err := sm.GetSession("lifetime-token"); err != nil {
+		t.Fatalf("the reset policy ended the session: %v", err)
+	}
+}
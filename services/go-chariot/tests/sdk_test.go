@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/sdk"
+)
+
+// TestSDK verifies the embedding API: compiled programs run with per-run
+// variables and Go builtins, values convert both ways, and a cancelled
+// context stops a running script.
+func TestSDK(t *testing.T) {
+	in, err := sdk.New()
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx := context.Background()
+
+	var synErr *sdk.Error
+	if _, err := sdk.Compile("broken.ch", "add(1,\n"); !errors.As(err, &synErr) || synErr.File != "broken.ch" {
+		t.Fatalf("expected a positioned syntax error, got %v", err)
+	}
+
+	prog := sdk.MustCompile("discount.ch", `if(bigger(total, 100)) { mul(total, rate) } else { 0 }`)
+	if err := in.SetGlobal("rate", 0.1); err != nil {
+		t.Fatalf("SetGlobal: %v", err)
+	}
+	for total, want := range map[int]float64{250: 25, 50: 0} {
+		got, err := in.Run(ctx, prog, map[string]interface{}{"total": total})
+		if err != nil || got != want {
+			t.Fatalf("Run(total=%d) = %v, %v; want %v", total, got, err, want)
+		}
+	}
+	// Run variables do not outlive the run
+	if _, err := in.Eval(ctx, "add(total, 1)", nil); err == nil {
+		t.Fatalf("expected total to be undefined after the run")
+	}
+
+	in.RegisterBuiltin("tier", func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("tier expects 1 argument")
+		}
+		name, _ := args[0].(string)
+		return map[string]interface{}{"name": name, "limit": 500}, nil
+	})
+	got, err := in.Eval(ctx, `getProp(tier('gold'), 'limit')`, nil)
+	if err != nil || got != float64(500) {
+		t.Fatalf("builtin result = %v, %v", got, err)
+	}
+	if _, err := in.Eval(ctx, `tier()`, nil); err == nil {
+		t.Fatalf("expected the builtin's error to fail the script")
+	}
+
+	type order struct {
+		ID    string   `json:"id"`
+		Items []string `json:"items"`
+	}
+	got, err = in.Eval(ctx, `length(getProp(o, 'items'))`, map[string]interface{}{"o": order{ID: "a1", Items: []string{"x", "y"}}})
+	if err != nil || got != float64(2) {
+		t.Fatalf("struct variable: %v, %v", got, err)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = in.Eval(runCtx, "setq(i, 0)\nwhile(true) { setq(i, add(i, 1)) }", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to stop the loop, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("cancellation took %v", elapsed)
+	}
+	if got, err := in.Eval(ctx, "add(1, 2)", nil); err != nil || got != float64(3) {
+		t.Fatalf("interpreter unusable after cancellation: %v, %v", got, err)
+	}
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/statestore"
+)
+
+// TestAccessTokenRefresh verifies that access tokens stand for their session
+// until they expire, and that refresh tokens rotate and are good once.
+func TestAccessTokenRefresh(t *testing.T) {
+	sm := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	if err := sm.SetAccessTokenTTL(time.Hour); err == nil {
+		t.Error("an access token lifetime beyond the session timeout was accepted")
+	}
+	if err := sm.SetAccessTokenTTL(200 * time.Millisecond); err != nil {
+		t.Fatalf("SetAccessTokenTTL: %v", err)
+	}
+	session := sm.NewSession("erin", logs.NewZapLogger(), "tokens-erin")
+	defer sm.EndSession("tokens-erin")
+
+	first, err := sm.IssueTokens(session)
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	if first.AccessToken == "tokens-erin" || first.RefreshToken == "" {
+		t.Fatalf("expected a separate access token and a refresh token, got %+v", first)
+	}
+	if got, err := sm.GetSession(first.AccessToken); err != nil || got != session {
+		t.Fatalf("GetSession(access) = %v, %v", got, err)
+	}
+
+	got, second, err := sm.RefreshTokens(first.RefreshToken)
+	if err != nil || got != session {
+		t.Fatalf("RefreshTokens = %v, %v", got, err)
+	}
+	if second.AccessToken == first.AccessToken || second.RefreshToken == first.RefreshToken {
+		t.Error("refresh returned the same tokens")
+	}
+	if _, _, err := sm.RefreshTokens(first.RefreshToken); !errors.Is(err, chariot.ErrRefreshTokenInvalid) {
+		t.Errorf("a used refresh token was accepted: %v", err)
+	}
+	if _, err := sm.GetSession(first.AccessToken); err != nil {
+		t.Errorf("the previous access token stopped working before it expired: %v", err)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	if _, err := sm.GetSession(second.AccessToken); !errors.Is(err, chariot.ErrAccessTokenExpired) {
+		t.Errorf("GetSession(expired access) error = %v", err)
+	}
+	if _, ok := sm.LookupSession(second.AccessToken); ok {
+		t.Error("LookupSession accepted an expired access token")
+	}
+
+	got, third, err := sm.RefreshTokens(second.RefreshToken)
+	if err != nil || got != session {
+		t.Fatalf("refresh after expiry = %v, %v", got, err)
+	}
+	if err := sm.EndSession(second.AccessToken); err != nil {
+		t.Fatalf("logging out with an expired access token: %v", err)
+	}
+	if _, err := sm.GetSession(third.AccessToken); err == nil {
+		t.Error("the ended session is still usable")
+	}
+	if _, _, err := sm.RefreshTokens(third.RefreshToken); !errors.Is(err, chariot.ErrRefreshTokenInvalid) {
+		t.Errorf("refreshing an ended session: %v", err)
+	}
+}
+
+// TestAccessTokenOtherReplica verifies that tokens issued by one replica are
+// honored and refreshed by another sharing the state store.
+func TestAccessTokenOtherReplica(t *testing.T) {
+	store := sharedMemory{statestore.NewMemory()}
+	a := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	b := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	for _, sm := range []*chariot.SessionManager{a, b} {
+		sm.SetStore(store)
+		if err := sm.SetAccessTokenTTL(15 * time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tokens, err := a.IssueTokens(a.NewSession("frank", logs.NewZapLogger(), "tokens-frank"))
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	defer a.EndSession("tokens-frank")
+
+	if got, err := b.GetSession(tokens.AccessToken); err != nil || got.UserID != "frank" {
+		t.Fatalf("other replica GetSession = %v, %v", got, err)
+	}
+	if _, refreshed, err := b.RefreshTokens(tokens.RefreshToken); err != nil || refreshed.AccessToken == "" {
+		t.Fatalf("other replica RefreshTokens: %v", err)
+	}
+	if _, _, err := a.RefreshTokens(tokens.RefreshToken); err == nil {
+		t.Error("a refresh token used on one replica was accepted by another")
+	}
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+// TestRuntimeSnapshots verifies that a snapshot restores variables and
+// functions and leaves host objects alone.
+func TestRuntimeSnapshots(t *testing.T) {
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	rt.SetSnapshotDir(t.TempDir())
+	conn := &chariot.HostObjectValue{Name: "db"}
+	rt.GlobalScope().Set("conn", conn)
+
+	if _, err := rt.ExecProgram("setq(double, func(n) { mul(n, 2) })\nsetq(items, array(1, 2, 3))"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	saved, err := rt.Evaluate(`runtimeSnapshot('before')`)
+	if err != nil {
+		t.Fatalf("runtimeSnapshot: %v", err)
+	}
+	skipped, _ := saved.(*chariot.MapValue).Get("skipped")
+	if arr, ok := skipped.(*chariot.ArrayValue); !ok || arr.Length() != 1 || arr.Get(0) != chariot.Str("globals.conn") {
+		t.Fatalf("expected the host object to be skipped, got %v", skipped)
+	}
+
+	if _, err := rt.ExecProgram("setq(items, 'gone')\nsetq(extra, 1)"); err != nil {
+		t.Fatalf("change: %v", err)
+	}
+	if _, err := rt.Evaluate(`runtimeRestore('before')`); err != nil {
+		t.Fatalf("runtimeRestore: %v", err)
+	}
+
+	if items, ok := rt.GetVariable("items"); !ok {
+		t.Fatalf("items was not restored")
+	} else if arr, ok := items.(*chariot.ArrayValue); !ok || arr.Length() != 3 {
+		t.Fatalf("expected items to be restored to three elements, got %v", items)
+	}
+	if _, ok := rt.GetVariable("extra"); ok {
+		t.Fatalf("expected a variable set after the snapshot to be removed")
+	}
+	if got, err := rt.Evaluate(`call(double, 4)`); err != nil || got != chariot.Number(8) {
+		t.Fatalf("expected the restored function to work, got %v (%v)", got, err)
+	}
+	if v, ok := rt.GlobalScope().Get("conn"); !ok || v != chariot.Value(conn) {
+		t.Fatalf("expected the host object to be kept, got %v", v)
+	}
+
+	names, err := rt.Evaluate(`runtimeSnapshots()`)
+	if err != nil {
+		t.Fatalf("runtimeSnapshots: %v", err)
+	}
+	if arr, ok := names.(*chariot.ArrayValue); !ok || arr.Length() != 1 || arr.Get(0) != chariot.Str("before") {
+		t.Fatalf("unexpected snapshot list %v", names)
+	}
+	if _, err := rt.Evaluate(`runtimeRestore('missing')`); err == nil {
+		t.Fatalf("expected restoring a missing snapshot to fail")
+	}
+	if err := chariot.DeleteSnapshot(rt.SnapshotDir(), "before"); err != nil {
+		t.Fatalf("DeleteSnapshot: %v", err)
+	}
+	if _, err := chariot.LoadSnapshot(rt.SnapshotDir(), "before"); !errors.Is(err, chariot.ErrSnapshotNotFound) {
+		t.Fatalf("expected ErrSnapshotNotFound after delete, got %v", err)
+	}
+	if err := chariot.ValidateSnapshotName("../etc"); err == nil {
+		t.Fatalf("expected a path to be rejected as a snapshot name")
+	}
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+func TestRuntimeErrorStackTrace(t *testing.T) {
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+
+	script := strings.Join([]string{
+		`setq(inner, func(x) {`,
+		`  setq(y, 1)`,
+		`  div(x, missingVar)`,
+		`})`,
+		`setq(outer, func(x) {`,
+		`  add(1, call(inner, x))`,
+		`})`,
+		`call(outer, 5)`,
+	}, "\n")
+	_, err := rt.ExecProgramWithFilename(script, "trace.ch")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "missingVar") {
+		t.Errorf("original message should be preserved, got %q", err.Error())
+	}
+
+	stack := chariot.StackTrace(err)
+	want := []chariot.CallFrame{
+		{Function: "inner", File: "trace.ch", Line: 3},
+		{Function: "outer", File: "trace.ch", Line: 6},
+		{Function: "<main>", File: "trace.ch", Line: 8},
+	}
+	if len(stack) != len(want) {
+		t.Fatalf("expected %d frames, got %+v", len(want), stack)
+	}
+	for i, w := range want {
+		got := stack[i]
+		if got.Function != w.Function || got.File != w.File || got.Line != w.Line {
+			t.Errorf("frame %d: expected %s %s:%d, got %+v", i, w.Function, w.File, w.Line, got)
+		}
+	}
+	if stack[0].Column != 3 {
+		t.Errorf("expected innermost column 3, got %d", stack[0].Column)
+	}
+
+	info := chariot.DescribeError(err)
+	if info.Line != 3 || info.File != "trace.ch" || len(info.Stack) != 3 {
+		t.Errorf("unexpected error info: %+v", info)
+	}
+	data, _ := json.Marshal(info)
+	if !strings.Contains(string(data), `"function":"outer"`) {
+		t.Errorf("stack not serialized: %s", data)
+	}
+}
+
+func TestTopLevelErrorHasMainFrame(t *testing.T) {
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+
+	_, err := rt.ExecProgram("setq(a, 1)\nnoSuchFunction(a)")
+	stack := chariot.StackTrace(err)
+	if len(stack) != 1 || stack[0].Function != "<main>" || stack[0].Line != 2 {
+		t.Fatalf("unexpected stack: %+v (%v)", stack, err)
+	}
+}
+
+func TestSourceMapLocatesDiagramNode(t *testing.T) {
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+
+	sm := chariot.DiagramSourceMap{
+		Version: 1,
+		Diagram: "orders",
+		Mappings: []chariot.SourceMapping{
+			{Line: 3, EndLine: 3, NodeID: "n1", Label: "Declare"},
+			{Line: 4, EndLine: 6, NodeID: "n2", Label: "Function"},
+			{Line: 7, EndLine: 7, NodeID: "n3", Label: "Call"},
+		},
+	}
+	mapJSON, _ := json.Marshal(sm)
+	code := strings.Join([]string{
+		`// orders`,
+		``,
+		`declare(total, 'N', 0)`,
+		`setq(bump, func(x) {`,
+		`  add(x, undefinedThing)`,
+		`})`,
+		`call(bump, total)`,
+		``,
+		`// ` + chariot.SourceMapMarker + base64.StdEncoding.EncodeToString(mapJSON),
+	}, "\n")
+
+	_, err := rt.ExecProgramWithFilename(code, "orders.ch")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	embedded, ok := chariot.ExtractSourceMap(code)
+	if !ok {
+		t.Fatal("embedded source map not found")
+	}
+	info := chariot.DescribeError(err)
+	info.ApplySourceMap(embedded, "orders.ch")
+	if info.Diagram != "orders" || info.NodeID != "n2" || info.NodeLabel != "Function" {
+		t.Errorf("unexpected diagram location: %+v", info)
+	}
+	if len(info.Stack) != 2 || info.Stack[1].NodeID != "n3" {
+		t.Errorf("caller frame not mapped: %+v", info.Stack)
+	}
+}
+
+func TestSyntaxErrorPosition(t *testing.T) {
+	_, err := chariot.ParseSource("setq(a, 1)\nadd(1, ]\nsetq(b, 2)", "broken.ch")
+	var perr *chariot.ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a *ParseError, got %v", err)
+	}
+	info := chariot.DescribeError(err)
+	if info.File != "broken.ch" || info.Line != 2 || info.Column == 0 {
+		t.Errorf("unexpected syntax error position: %+v", info)
+	}
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/statestore"
+)
+
+// sharedMemory stands in for a shared store such as Couchbase: two managers
+// given the same instance behave like two replicas.
+type sharedMemory struct{ *statestore.Memory }
+
+func (sharedMemory) Shared() bool { return true }
+
+func TestMemoryStore(t *testing.T) {
+	s := statestore.NewMemory()
+	if err := s.Put("a", []byte("1"), 0); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if v, err := s.Get("a"); err != nil || string(v) != "1" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	s.Put("short", []byte("x"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, err := s.Get("short"); !errors.Is(err, statestore.ErrNotFound) {
+		t.Fatalf("expected expired key to be gone, got %v", err)
+	}
+	s.Delete("a")
+	if _, err := s.Get("a"); !errors.Is(err, statestore.ErrNotFound) {
+		t.Fatalf("expected deleted key to be gone, got %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		seq, err := s.Append("log", []byte{byte('a' + i)}, 3, 0)
+		if err != nil || seq != i {
+			t.Fatalf("Append #%d = %d, %v", i, seq, err)
+		}
+	}
+	entries, next, _ := s.Range("log", 0)
+	if len(entries) != 3 || string(entries[0]) != "c" || next != 5 {
+		t.Fatalf("expected the last 3 entries and next 5, got %q next %d", entries, next)
+	}
+	if entries, next, _ = s.Range("log", next); len(entries) != 0 || next != 5 {
+		t.Fatalf("expected nothing new, got %q next %d", entries, next)
+	}
+}
+
+// TestSessionsAcrossReplicas verifies a session created on one manager is
+// usable on another sharing the store, and that ending it ends it everywhere.
+func TestSessionsAcrossReplicas(t *testing.T) {
+	store := sharedMemory{statestore.NewMemory()}
+	a := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	b := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	a.SetStore(store)
+	b.SetStore(store)
+
+	a.NewSession("alice", logs.NewZapLogger(), "replica-token")
+	sess, err := b.GetSession("replica-token")
+	if err != nil {
+		t.Fatalf("expected replica b to restore the session: %v", err)
+	}
+	if sess.UserID != "alice" || sess.Runtime == nil || !sess.Authenticated {
+		t.Fatalf("unexpected restored session %+v", sess)
+	}
+
+	if err := a.EndSession("replica-token"); err != nil {
+		t.Fatalf("EndSession: %v", err)
+	}
+	if _, err := b.GetSession("replica-token"); err == nil {
+		t.Fatalf("expected the session to be gone on replica b after logout on a")
+	}
+	if _, err := a.GetSession("unknown-token"); err == nil {
+		t.Fatalf("expected an unknown token to be rejected")
+	}
+}
+
+// TestExecutionsAcrossReplicas verifies another replica can read an
+// execution's result and logs through the shared store.
+func TestExecutionsAcrossReplicas(t *testing.T) {
+	store := sharedMemory{statestore.NewMemory()}
+	a := handlers.NewExecutionManager(store, nil)
+	b := handlers.NewExecutionManager(store, nil)
+
+	exec := a.Create("alice", "setq(x, 42)")
+	exec.LogBuffer.Append(chariot.LogEntry{Timestamp: time.Now(), Level: "INFO", Message: "working"})
+	if rec, ok := b.Lookup(exec.ID); !ok || rec.Done {
+		t.Fatalf("expected a running record on replica b, got %+v", rec)
+	}
+
+	exec.MarkDone(42, nil)
+	rec, ok := b.Lookup(exec.ID)
+	if !ok || !rec.Done || rec.Result != float64(42) || rec.Error != "" {
+		t.Fatalf("expected the completed result on replica b, got %+v", rec)
+	}
+	entries, next, err := b.StoredLogs(exec.ID, 0)
+	if err != nil || len(entries) != 1 || next != 1 {
+		t.Fatalf("expected one stored log entry, got %d (next %d, err %v)", len(entries), next, err)
+	}
+
+	failed := a.Create("alice", "boom()")
+	failed.MarkDone(nil, errors.New("boom"))
+	if rec, _ := b.Lookup(failed.ID); rec == nil || rec.Error != "boom" || rec.ErrorInfo == nil {
+		t.Fatalf("expected the error on replica b, got %+v", rec)
+	}
+	if _, ok := b.Lookup("no-such-execution"); ok {
+		t.Fatalf("expected an unknown execution to be missing")
+	}
+}
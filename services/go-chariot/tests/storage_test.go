@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/storage"
+)
+
+func TestFilesystemStorage(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "files")
+	var fs storage.Filesystem
+
+	if infos, err := fs.ReadDir(dir); err != nil || len(infos) != 0 {
+		t.Fatalf("expected a missing directory to be empty, got %v, %v", infos, err)
+	}
+	if _, err := fs.ReadFile(filepath.Join(dir, "a.ch")); !os.IsNotExist(err) {
+		t.Errorf("expected a missing file, got %v", err)
+	}
+	for name, content := range map[string]string{"b.ch": "add(1, 2)", "a.ch": "setq(x, 1)"} {
+		if err := fs.WriteFile(filepath.Join(dir, name), []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := fs.ReadFile(filepath.Join(dir, "a.ch"))
+	if err != nil || string(data) != "setq(x, 1)" {
+		t.Errorf("read back %q, %v", data, err)
+	}
+	info, err := fs.Stat(filepath.Join(dir, "b.ch"))
+	if err != nil || info.Name != "b.ch" || info.Size != 9 {
+		t.Errorf("unexpected stat %+v, %v", info, err)
+	}
+	infos, err := fs.ReadDir(dir)
+	if err != nil || len(infos) != 2 || infos[0].Name != "a.ch" || infos[1].Name != "b.ch" {
+		t.Errorf("expected a.ch and b.ch, got %+v, %v", infos, err)
+	}
+	if err := fs.Remove(filepath.Join(dir, "a.ch")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove(filepath.Join(dir, "a.ch")); !os.IsNotExist(err) {
+		t.Errorf("expected removing twice to fail as missing, got %v", err)
+	}
+}
+
+// memoryStorage keeps files in a map, standing in for a shared provider.
+type memoryStorage map[string][]byte
+
+func (m memoryStorage) ReadFile(path string) ([]byte, error) {
+	data, ok := m[path]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	return data, nil
+}
+
+func (m memoryStorage) WriteFile(path string, data []byte) error {
+	m[path] = data
+	return nil
+}
+
+func (m memoryStorage) Remove(path string) error {
+	delete(m, path)
+	return nil
+}
+
+func (m memoryStorage) Stat(path string) (storage.FileInfo, error) {
+	data, err := m.ReadFile(path)
+	return storage.FileInfo{Name: filepath.Base(path), Size: int64(len(data)), Modified: time.Now()}, err
+}
+
+func (m memoryStorage) ReadDir(dir string) ([]storage.FileInfo, error)   { return nil, nil }
+func (m memoryStorage) Walk(root string, visit func(string) error) error { return nil }
+func (m memoryStorage) Shared() bool                                     { return true }
+func (m memoryStorage) Close() error                                     { return nil }
+
+func TestLibraryUsesStorageProvider(t *testing.T) {
+	files := memoryStorage{}
+	storage.Use(files)
+	defer storage.Use(storage.Filesystem{})
+
+	rt := ch.NewRuntime()
+	if err := rt.SaveFunction("triple", "function triple(x) { mul(x, 3) }", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.SaveFunctionsToFile(rt.ListUserFunctionsMap(), "storage_lib.json"); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected the library to be written to the provider, got %d files", len(files))
+	}
+	lib, err := ch.LoadFunctionsFromFile("storage_lib.json")
+	if err != nil || lib["triple"] == nil {
+		t.Errorf("expected triple back from the provider, got %v, %v", lib, err)
+	}
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	dir := t.TempDir()
+	oldKeys, err := storage.ParseKeys("k1="+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := storage.NewEncrypted(storage.Filesystem{}, oldKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, plain := filepath.Join(dir, "pricing.ch"), filepath.Join(dir, "legacy.ch")
+	if err := old.WriteFile(secret, []byte("setq(margin, 0.42)")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(plain, []byte("add(1, 2)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := os.ReadFile(secret); bytes.Contains(raw, []byte("margin")) {
+		t.Error("expected the file to be encrypted on disk")
+	}
+	if data, err := old.ReadFile(secret); err != nil || string(data) != "setq(margin, 0.42)" {
+		t.Errorf("decrypted %q, %v", data, err)
+	}
+	if data, err := old.ReadFile(plain); err != nil || string(data) != "add(1, 2)" {
+		t.Errorf("expected a file in the clear to be read as is, got %q, %v", data, err)
+	}
+
+	// A new key is introduced first; the old one still decrypts until rotation is done
+	keys, err := storage.ParseKeys("k2=secret:storage-k2, k1="+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)), func(name string) (string, error) {
+		return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := storage.NewEncrypted(storage.Filesystem{}, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := rotated.Rotate([]string{secret, plain}, true); report.Rewritten != 2 || report.Current != 0 {
+		t.Errorf("unexpected dry run %+v", report)
+	}
+	if report := rotated.Rotate([]string{secret, plain}, false); report.Rewritten != 2 || len(report.Failed) != 0 {
+		t.Errorf("unexpected rotation %+v", report)
+	}
+	if report := rotated.Rotate([]string{secret, plain}, false); report.Current != 2 {
+		t.Errorf("expected both files to be current, got %+v", report)
+	}
+	if _, err := old.ReadFile(secret); err == nil {
+		t.Error("expected the old key alone to no longer decrypt the file")
+	}
+	if data, err := rotated.ReadFile(plain); err != nil || string(data) != "add(1, 2)" {
+		t.Errorf("decrypted %q, %v", data, err)
+	}
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+func TestStreamParsers(t *testing.T) {
+	setConfig(t, &cfg.ChariotConfig.DataPath, t.TempDir())
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(cfg.ChariotConfig.DataPath, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("orders.json", `{"meta": {"count": 3}, "orders": [
+  {"id": "o1", "amount": 10, "lines": [{"sku": "a"}]},
+  {"id": "o2", "amount": 32.5},
+  {"id": "o3", "amount": 7}
+]}`)
+	write("events.jsonl", "{\"type\": \"a\", \"n\": 1}\n{\"type\": \"b\", \"n\": 2}\n")
+	write("catalog.xml", `<?xml version="1.0"?>
+<catalog>
+  <book id="b1"><title>One</title></book>
+  <magazine id="m1"/>
+  <book id="b2"><title>Two</title></book>
+</catalog>`)
+
+	rt := createNamedRuntime("stream_parse")
+	defer chariot.UnregisterRuntime("stream_parse")
+	run := scriptRunner(t, rt)
+	variable := func(name string) chariot.Value {
+		t.Helper()
+		v, _ := rt.GetVariable(name)
+		return v
+	}
+
+	run(`setq(total, 0)`)
+	run(`setq(seen, '')`)
+	n := run(`parseJSONStream('orders.json', 'orders.*', func(order, path) {
+		setq(total, add(total, getProp(order, 'amount')))
+		setq(seen, concat(seen, path, ';'))
+	})`)
+	if n != chariot.Number(3) || variable("total") != chariot.Number(49.5) || variable("seen") != chariot.Str("orders.0;orders.1;orders.2;") {
+		t.Fatalf("parseJSONStream = %v, total = %v, seen = %v", n, variable("total"), variable("seen"))
+	}
+
+	// Returning false stops reading
+	if n := run(`parseJSONStream('orders.json', 'orders.*.id', func(id) { false })`); n != chariot.Number(1) {
+		t.Fatalf("stopped stream visited %v", n)
+	}
+	if n := run(`parseJSONStream('events.jsonl', 'n', func(v) { setq(total, add(total, v)) })`); n != chariot.Number(2) || variable("total") != chariot.Number(52.5) {
+		t.Fatalf("JSON Lines stream = %v, total = %v", n, variable("total"))
+	}
+
+	run(`setq(ids, '')`)
+	n = run(`parseXMLStream('catalog.xml', 'catalog/book', func(book) {
+		setq(ids, concat(ids, getProp(book, 'id')))
+	})`)
+	if n != chariot.Number(2) || variable("ids") != chariot.Str("b1b2") {
+		t.Fatalf("parseXMLStream = %v, ids = %v", n, variable("ids"))
+	}
+	if n := run(`parseXMLStream('catalog.xml', 'catalog/*', func(e) { true })`); n != chariot.Number(3) {
+		t.Fatalf("wildcard stream = %v", n)
+	}
+
+	if _, err := rt.Evaluate(`parseJSONStream('orders.json', 'orders', 'notAFunction')`); err == nil {
+		t.Fatalf("expected an error for a missing function")
+	}
+}
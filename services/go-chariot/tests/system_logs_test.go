@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+	"go.uber.org/zap"
+)
+
+// TestSystemLogFiles verifies that log files rotate at their size limit and
+// that entries are found across the rotated files.
+func TestSystemLogFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "chariot.log")
+	file, err := logs.NewRotatingFile(path, 400, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	logger := logs.NewZapLoggerWithFile(file, "backend")
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		logger.Info("request served", zap.Int("n", i))
+	}
+	logger.Warn("slow query", zap.String("component", "sql"))
+	logger.Error("Listener failed")
+
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Errorf("expected a rotated file: %v", err)
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Errorf("expected at most 2 rotated files")
+	}
+
+	entries, err := logs.ReadEntries(path, logs.Query{Level: "warn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Component != "sql" || entries[1].Message != "Listener failed" || entries[1].Level != "error" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	if entries[0].Time.Before(start.Add(-time.Second)) {
+		t.Errorf("unexpected time %v", entries[0].Time)
+	}
+
+	entries, _ = logs.ReadEntries(path, logs.Query{Component: "backend", Contains: "SERVED", Limit: 2})
+	if len(entries) != 2 || !strings.Contains(entries[1].Message, "served") || entries[1].Fields["n"] != float64(9) {
+		t.Errorf("unexpected recent entries %+v", entries)
+	}
+	if entries, _ := logs.ReadEntries(path, logs.Query{Since: time.Now().Add(time.Hour)}); len(entries) != 0 {
+		t.Errorf("expected no entries from the future, got %d", len(entries))
+	}
+	if _, err := logs.ReadEntries(path, logs.Query{Level: "loud"}); err == nil {
+		t.Errorf("expected an unknown level to fail")
+	}
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+)
+
+// TestExecutionUsage verifies that external calls and the rows they change
+// are counted while usage is.
+func TestExecutionUsage(t *testing.T) {
+	rt := ch.NewRuntime()
+	ch.RegisterAll(rt)
+	rt.Register("sqlExecute", func(args ...ch.Value) (ch.Value, error) { return ch.Number(3), nil })
+
+	rt.StartUsage()
+	if _, err := rt.ExecProgram("sqlExecute('db', 'DELETE FROM tmp')\nsqlExecute('db', 'DELETE FROM old')\nadd(1, 2)"); err != nil {
+		t.Fatal(err)
+	}
+	usage := rt.StopUsage()
+	if usage == nil || usage.ExternalCalls != 2 || usage.Rows != 6 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+	if rt.StopUsage() != nil {
+		t.Errorf("usage still counted after StopUsage")
+	}
+
+	if err := ch.ValidateTags(map[string]string{"team": "data", "ticket": "OPS-12"}); err != nil {
+		t.Error(err)
+	}
+	if err := ch.ValidateTags(map[string]string{"team name": "data"}); err == nil {
+		t.Errorf("expected a key with a space to be rejected")
+	}
+}
+
+func TestTagUsageReport(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tag_usage.json")
+	store := handlers.NewTagUsageStore(file)
+	now := time.Now()
+	store.Record(map[string]string{"team": "data", "project": "billing"}, now, 2*time.Second, &ch.ExecutionUsage{ExternalCalls: 3, Rows: 100}, false)
+	store.Record(map[string]string{"team": "data"}, now, time.Second, &ch.ExecutionUsage{ExternalCalls: 1}, true)
+	store.Record(map[string]string{"team": "web"}, now, time.Second, nil, false)
+	store.Record(nil, now, time.Second, nil, false)
+	store.Record(map[string]string{"team": "data"}, now.AddDate(0, 0, -40), time.Second, nil, false)
+
+	report := store.Report("team", now.AddDate(0, 0, -29), false)
+	if report.Total.Executions != 4 || len(report.Tagged) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if len(report.Usage) != 3 {
+		t.Fatalf("unexpected usage %+v", report.Usage)
+	}
+	data := report.Usage[0]
+	if data.Value != "data" || data.Executions != 2 || data.Failures != 1 || data.DurationMs != 3000 || data.ExternalCalls != 4 || data.Rows != 100 {
+		t.Errorf("unexpected usage of team data %+v", data)
+	}
+	// The untagged execution and team web took a second each
+	if u := report.Usage[1]; u.Value != "" || u.Executions != 1 {
+		t.Errorf("unexpected untagged usage %+v", u)
+	}
+
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := handlers.NewTagUsageStore(file).Report("project", now.AddDate(0, 0, -29), true)
+	if len(reloaded.Usage) != 2 || reloaded.Usage[1].Value != "billing" || reloaded.Usage[1].Day == "" {
+		t.Errorf("unexpected usage after reload %+v", reloaded.Usage)
+	}
+}
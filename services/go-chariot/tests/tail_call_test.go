@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+// TestTailCalls verifies that recursion in tail position runs in constant stack space
+func TestTailCalls(t *testing.T) {
+	tests := []TestCase{
+		{
+			Name: "Tail recursion through call()",
+			Script: []string{
+				`setq(countdown, func(n) { if (equal(n, 0)) { 'done' } else { call(countdown, sub(n, 1)) } })`,
+				`call(countdown, 200000)`,
+			},
+			ExpectedValue: chariot.Str("done"),
+		},
+		{
+			Name: "Tail recursion with accumulator and return()",
+			Script: []string{
+				`setq(sumTo, func(n, acc) { if (equal(n, 0)) { return(acc) } return(call(sumTo, sub(n, 1), add(acc, n))) })`,
+				`call(sumTo, 100000, 0)`,
+			},
+			ExpectedValue: chariot.Number(5000050000),
+		},
+		{
+			Name: "Mutual tail recursion",
+			Script: []string{
+				`setq(isEven, func(n) { if (equal(n, 0)) { true } else { call(isOdd, sub(n, 1)) } })`,
+				`setq(isOdd, func(n) { if (equal(n, 0)) { false } else { call(isEven, sub(n, 1)) } })`,
+				`call(isEven, 50001)`,
+			},
+			ExpectedValue: chariot.Bool(false),
+		},
+		{
+			Name: "Non-tail recursion still computes correctly",
+			Script: []string{
+				`setq(fact, func(n) { if (smaller(n, 2)) { 1 } else { mul(n, call(fact, sub(n, 1))) } })`,
+				`call(fact, 10)`,
+			},
+			ExpectedValue: chariot.Number(3628800),
+		},
+		{
+			Name: "Non-tail recursion hits the depth limit",
+			Script: []string{
+				`setq(deep, func(n) { if (equal(n, 0)) { 0 } else { add(1, call(deep, sub(n, 1))) } })`,
+				`call(deep, 1000000)`,
+			},
+			ExpectedError:  true,
+			ErrorSubstring: "maximum call depth",
+		},
+	}
+
+	RunTestCases(t, tests)
+}
+
+func TestCallDepthErrorIncludesStack(t *testing.T) {
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	rt.SetMaxCallDepth(50)
+
+	define := strings.Join([]string{
+		`setq(deep, func(n) {`,
+		`  if (equal(n, 0)) { 0 } else { add(1, call(deep, sub(n, 1))) }`,
+		`})`,
+	}, "\n")
+	if val, err := rt.ExecProgram(define + "\ncall(deep, 40)"); err != nil || val != chariot.Number(40) {
+		t.Fatalf("expected 40 within the limit, got %v (%v)", val, err)
+	}
+
+	_, err := rt.ExecProgram(define + "\ncall(deep, 100)")
+	var depthErr *chariot.CallDepthError
+	if !errors.As(err, &depthErr) {
+		t.Fatalf("expected CallDepthError, got %v", err)
+	}
+	// 50 frames for deep plus the top-level script
+	if depthErr.Limit != 50 || len(depthErr.Stack) != 51 {
+		t.Fatalf("unexpected limit/stack size: %d/%d", depthErr.Limit, len(depthErr.Stack))
+	}
+	inner := depthErr.Stack[0]
+	if inner.Function != "deep" || inner.Line != 2 {
+		t.Errorf("unexpected innermost frame: %+v", inner)
+	}
+	if outer := depthErr.Stack[len(depthErr.Stack)-1]; outer.Function != "<main>" || outer.Line != 4 {
+		t.Errorf("outermost frame should point at the top-level call, got %+v", outer)
+	}
+	if !strings.Contains(err.Error(), "at deep") || !strings.Contains(err.Error(), "frames omitted") {
+		t.Errorf("error message lacks a readable stack: %v", err)
+	}
+	if frames := rt.CallStack(); len(frames) != 1 {
+		t.Errorf("call stack not unwound after error: %+v", frames)
+	}
+}
+
+// TestTailCallsIntoLibraryFunctions verifies that a tail call behaves like
+// any other call: a library function sees the variables of the function
+// calling it, and the caller's declared result type is still checked.
+func TestTailCallsIntoLibraryFunctions(t *testing.T) {
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	for name, src := range map[string]string{
+		"inner":     "function inner() { x }",
+		"outerTail": "function outerTail(x) { inner() }",
+		"outer":     "function outer(x) { add(inner(), 0) }",
+		"count":     "function count(n): N { mul(n, 2) }",
+		"label":     "function label(n): S { count(n) }",
+	} {
+		if err := rt.SaveFunction(name, src, ""); err != nil {
+			t.Fatalf("save %s: %v", name, err)
+		}
+	}
+	if v, err := rt.ExecProgram("outer(7)"); err != nil || v != chariot.Number(7) {
+		t.Errorf("outer(7) = %v (%v)", v, err)
+	}
+	if v, err := rt.ExecProgram("outerTail(7)"); err != nil || v != chariot.Number(7) {
+		t.Errorf("outerTail(7) = %v (%v)", v, err)
+	}
+	if _, err := rt.ExecProgram("label(2)"); err == nil || !strings.Contains(err.Error(), "label: result") {
+		t.Errorf("expected label's result type to be checked, got %v", err)
+	}
+}
@@ -680,3 +680,25 @@ func createNamedRuntime(name string) *chariot.Runtime {
 
 	return rt
 }
+
+// setConfig sets a field of the shared configuration until the test ends.
+func setConfig[T any](t *testing.T, field *T, value T) {
+	t.Helper()
+	saved := *field
+	*field = value
+	t.Cleanup(func() { *field = saved })
+}
+
+// scriptRunner returns a function that evaluates one step of a script on rt
+// and fails the test on an error. Evaluate, unlike ExecProgram, keeps the
+// variables set by earlier steps.
+func scriptRunner(t *testing.T, rt *chariot.Runtime) func(script string) chariot.Value {
+	return func(script string) chariot.Value {
+		t.Helper()
+		v, err := rt.Evaluate(script)
+		if err != nil {
+			t.Fatalf("%s: %v", script, err)
+		}
+		return v
+	}
+}
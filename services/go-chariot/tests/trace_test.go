@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+// TestExecutionTraceReplay verifies that a replay answers the traced calls
+// from the trace, starts from the recorded state and detects divergence.
+func TestExecutionTraceReplay(t *testing.T) {
+	rt := chariot.NewRuntime()
+	chariot.RegisterAll(rt)
+	rt.SetSnapshotDir(t.TempDir())
+	if _, err := rt.ExecProgram("declareGlobal(scale, 'N', 10)"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	program := "setq(stamp, now())\nconcat(stamp, '/', string(mul(random(), scale)))"
+	trace, err := rt.StartRecording("run-1", program, nil, nil)
+	if err != nil {
+		t.Fatalf("StartRecording: %v", err)
+	}
+	recorded, err := rt.ExecProgram(program)
+	if err != nil {
+		t.Fatalf("recorded run: %v", err)
+	}
+	if rt.StopTrace() != trace || len(trace.Calls) != 2 || trace.Calls[0].Func != "now" || trace.Calls[1].Func != "random" {
+		t.Fatalf("unexpected recorded calls %+v", trace.Calls)
+	}
+
+	dir := t.TempDir()
+	if err := chariot.SaveTrace(dir, trace); err != nil {
+		t.Fatalf("SaveTrace: %v", err)
+	}
+	loaded, err := chariot.LoadTrace(dir, "run-1")
+	if err != nil {
+		t.Fatalf("LoadTrace: %v", err)
+	}
+
+	fresh := chariot.NewRuntime()
+	chariot.RegisterAll(fresh)
+	got, used, err := fresh.Replay(loaded)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if got != recorded || used != 2 {
+		t.Fatalf("replay returned %v after %d calls, recorded %v", got, used, recorded)
+	}
+
+	loaded.Program = "random()\nrandom()\nrandom()"
+	if _, _, err := fresh.Replay(loaded); !errors.Is(err, chariot.ErrTraceDiverged) {
+		t.Fatalf("expected a divergence, got %v", err)
+	}
+	if _, err := chariot.LoadTrace(dir, "missing"); !errors.Is(err, chariot.ErrTraceNotFound) {
+		t.Fatalf("expected ErrTraceNotFound, got %v", err)
+	}
+}
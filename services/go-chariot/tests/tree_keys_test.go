@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+func TestSecureTreeKeyRotation(t *testing.T) {
+	setConfig(t, &cfg.ChariotConfig.TreePath, t.TempDir())
+	chariot.SetKeyStore(nil)
+	defer chariot.SetKeyStore(nil)
+
+	rt := createNamedRuntime("tree_keys")
+	defer chariot.UnregisterRuntime("tree_keys")
+	run := scriptRunner(t, rt)
+	prop := func(v chariot.Value, name string) chariot.Value {
+		t.Helper()
+		got, _ := v.(*chariot.MapValue).Get(name)
+		return got
+	}
+
+	run(`keyCreate("trees", "chacha20-poly1305")`)
+	run(`keyCreate("archive", "aes-gcm")`)
+	run(`setq(agent, create('agent'))`)
+	run(`setAttribute(agent, 'region', 'emea')`)
+	run(`treeSaveSecure(agent, 'agent.sec', 'trees', '', 'wm')`)
+
+	meta := run(`treeGetMetadata('agent.sec')`).(chariot.MapValue)
+	if meta.Values["encryption_algorithm"] != chariot.Str("chacha20-poly1305") || meta.Values["encryption_key_version"] != chariot.Number(1) {
+		t.Fatalf("metadata = %v", meta.Values)
+	}
+	if _, err := rt.Evaluate(`treeSaveSecure(agent, 'other.sec', 'trees', '', 'wm', map('algorithm', 'aes-gcm'))`); err == nil {
+		t.Fatalf("saving with an algorithm the key does not have should fail")
+	}
+	if _, err := rt.Evaluate(`jwtSignWithKey(map('sub', 'svc'), 'trees')`); err == nil {
+		t.Fatalf("an encryption key should not sign")
+	}
+
+	run(`keyRotate("trees")`)
+	trees, err := chariot.ListSecureTrees()
+	if err != nil || len(trees) != 1 || trees[0].File != "agent.sec" || trees[0].KeyID != "trees" || trees[0].KeyVersion != 1 {
+		t.Fatalf("ListSecureTrees() = %+v, %v", trees, err)
+	}
+
+	result := run(`treeReencrypt('agent.sec')`)
+	if prop(result, "fromVersion") != chariot.Number(1) || prop(result, "toVersion") != chariot.Number(2) || prop(result, "rewritten") != chariot.Bool(true) {
+		t.Fatalf("treeReencrypt = %v", result)
+	}
+	if again := run(`treeReencrypt('agent.sec')`); prop(again, "rewritten") != chariot.Bool(false) {
+		t.Fatalf("second treeReencrypt = %v", again)
+	}
+
+	// Once re-encrypted, the old version can go
+	run(`keyPrune("trees", 1)`)
+	load := func() chariot.TreeNode {
+		t.Helper()
+		node, err := chariot.GetTreeSerializerService().LoadSecureAgent(filepath.Join(cfg.ChariotConfig.TreePath, "agent.sec"), &chariot.SecureDeserializationOptions{})
+		if err != nil {
+			t.Fatalf("LoadSecureAgent: %v", err)
+		}
+		return node
+	}
+	if v, _ := load().GetAttribute("region"); v != chariot.Str("emea") {
+		t.Fatalf("region = %v", v)
+	}
+
+	result = run(`treeReencrypt('agent.sec', 'archive')`)
+	if prop(result, "toKey") != chariot.Str("archive") || prop(result, "algorithm") != chariot.Str("aes-gcm") {
+		t.Fatalf("treeReencrypt to archive = %v", result)
+	}
+	run(`keyDelete("trees")`)
+	if v, _ := load().GetAttribute("region"); v != chariot.Str("emea") {
+		t.Fatalf("region after moving keys = %v", v)
+	}
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+func TestTreeQuery(t *testing.T) {
+	rt := createNamedRuntime("tree_query")
+	defer chariot.UnregisterRuntime("tree_query")
+	run := scriptRunner(t, rt)
+	ids := func(query string) []string {
+		t.Helper()
+		arr := run(`queryNode(shop, "` + query + `")`).(*chariot.ArrayValue)
+		out := []string{}
+		for i := 0; i < arr.Length(); i++ {
+			id, _ := arr.Get(i).(chariot.TreeNode).GetAttribute("id")
+			out = append(out, string(id.(chariot.Str)))
+		}
+		return out
+	}
+	expect := func(query string, want ...string) {
+		t.Helper()
+		got := ids(query)
+		if len(got) != len(want) {
+			t.Fatalf("%s = %v, want %v", query, got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%s = %v, want %v", query, got, want)
+			}
+		}
+	}
+
+	shop := chariot.NewTreeNode("shop")
+	order := func(id, status string, total float64) *chariot.TreeNodeImpl {
+		o := chariot.NewTreeNode("orders")
+		o.SetAttribute("id", chariot.Str(id))
+		o.SetAttribute("status", chariot.Str(status))
+		o.SetAttribute("total", chariot.Number(total))
+		shop.AddChild(o)
+		return o
+	}
+	order("o1", "open", 250)
+	order("o2", "open", 40)
+	order("o3", "closed", 900)
+	line := chariot.NewTreeNode("line")
+	line.SetAttribute("id", chariot.Str("l1"))
+	line.SetAttribute("sku", chariot.Str("AB-7"))
+	o4 := order("o4", "open", 101)
+	o4.AddChild(line)
+	rt.SetVariable("shop", shop)
+	rt.SetVariable("o4", o4)
+
+	checks := func() {
+		t.Helper()
+		expect("orders[status='open' and total>100]", "o1", "o4")
+		expect("orders[status='closed' or total<=40]", "o2", "o3")
+		expect("orders[not(status='open')]", "o3")
+		expect("orders/line[sku startswith 'AB-']", "l1")
+		expect("*[sku]", "l1")
+		expect("orders[total>=101 and total<250]", "o4")
+		expect("orders[status='pending']")
+	}
+	checks()
+
+	run(`treeIndex(shop, 'status', 'total')`)
+	checks()
+
+	// Changes rebuild the index before the next query
+	run(`setAttribute(o4, 'status', 'closed')`)
+	expect("orders[status='open' and total>100]", "o1")
+	run(`removeChild(shop, o4)`)
+	expect("orders[status='closed']", "o3")
+
+	if v := run(`treeDropIndex(shop)`); v != chariot.Bool(true) {
+		t.Fatalf("treeDropIndex = %v", v)
+	}
+	expect("orders[status='closed']", "o3")
+
+	if _, err := rt.Evaluate(`queryNode(shop, "orders[status=]")`); err == nil {
+		t.Fatalf("expected a syntax error")
+	}
+}
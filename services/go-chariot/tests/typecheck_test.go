@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ch "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/labstack/echo/v4"
+)
+
+// TestTypeAnnotations verifies that annotations are parsed, survive the
+// function library format, and are enforced when the function runs.
+func TestTypeAnnotations(t *testing.T) {
+	rt := createNamedRuntime("type_annotations")
+	defer ch.UnregisterRuntime("type_annotations")
+	v, err := rt.ExecProgram("func(price: N, label, qty: N): S { concat(label, string(mul(price, qty))) }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := v.(*ch.FunctionValue)
+	if strings.Join(fn.ParamTypes, ",") != "N,,N" || fn.ReturnType != "S" {
+		t.Errorf("unexpected annotations %q %q", fn.ParamTypes, fn.ReturnType)
+	}
+	if sig := ch.FunctionSignature(fn).String(); sig != "(N, V, N) S" {
+		t.Errorf("unexpected signature %s", sig)
+	}
+	back, err := ch.MapToFunctionValue(ch.FunctionValueToMap(fn))
+	if err != nil || strings.Join(back.ParamTypes, ",") != "N,,N" || back.ReturnType != "S" {
+		t.Errorf("annotations lost in the library format: %v %v (%v)", back.ParamTypes, back.ReturnType, err)
+	}
+	if _, err := rt.ExecProgram("func(x: Q) { x }"); err == nil {
+		t.Error("expected an unknown type code to be a syntax error")
+	}
+
+	if _, err := rt.ExecProgram("registerFunction('half', func(x: N): N { div(x, 2) })\nregisterFunction('shout', func(x): N { upper(x) })"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := rt.ExecProgram("half(9)"); err != nil || v != ch.Number(4.5) {
+		t.Errorf("half(9) = %v (%v)", v, err)
+	}
+	if _, err := rt.ExecProgram("half('nine')"); err == nil || !strings.Contains(err.Error(), "parameter 'x'") {
+		t.Errorf("expected a parameter type error, got %v", err)
+	}
+	if _, err := rt.ExecProgram("shout('hey')"); err == nil || !strings.Contains(err.Error(), "result") {
+		t.Errorf("expected a result type error, got %v", err)
+	}
+}
+
+// TestCheckTypes verifies the errors the checker reports, and that
+// unannotated code passes. A wrong argument is reported where the argument
+// starts, other errors where the call does.
+func TestCheckTypes(t *testing.T) {
+	rt := createNamedRuntime("check_types")
+	defer ch.UnregisterRuntime("check_types")
+	src := strings.Join([]string{
+		"registerFunction('total', func(price: N, qty: N): N { mul(price, qty) })",
+		"declare(name, 'S', 'widget')",
+		"total(name, 2)",
+		"upper(total(1, 2))",
+		"declare(count, 'N', 'many')",
+		"setq(name, 3)",
+		"setq(f, func(x: S): N { upper(x) })",
+		"call(f, 1)",
+		"add(1)",
+		"setq(anything, func(a, b) { add(a, b) })",
+		"call(anything, 'a', name)",
+		"total(1)",
+	}, "\n")
+	program, err := ch.ParseSource(src, "check.ch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := ch.CheckTypes(program, rt)
+	want := []string{
+		"check.ch:3:7: argument 1 of total: expected N (number), got S (string)",
+		"argument 1 of upper: expected S (string), got N (number)",
+		"check.ch:5:1: cannot declare 'count' as N (number) with a value of S (string)",
+		"check.ch:6:1: cannot assign N (number) to 'name', declared S (string)",
+		"function returns S (string), declared to return N (number)",
+		"check.ch:8:9: argument 1 of f: expected S (string), got N (number)",
+		"check.ch:9:1: add expects at least 2 arguments (N, N) N, got 1",
+		"check.ch:12:1: total expects at least 2 arguments (N, N) N, got 1",
+	}
+	if len(errs) != len(want) {
+		t.Errorf("expected %d type errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, te := range errs {
+		if i < len(want) && !strings.Contains(te.Error(), want[i]) {
+			t.Errorf("error %d: expected %q, got %q", i, want[i], te.Error())
+		}
+	}
+}
+
+// TestLintEndpoint verifies that /api/lint reports syntax and type errors.
+func TestLintEndpoint(t *testing.T) {
+	var h handlers.Handlers
+	lint := func(program string) []handlers.LintDiagnostic {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"program": program})
+		req := httptest.NewRequest(http.MethodPost, "/api/lint", strings.NewReader(string(body)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		if err := h.Lint(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatal(err)
+		}
+		var resp struct {
+			Data struct {
+				Diagnostics []handlers.LintDiagnostic `json:"diagnostics"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data.Diagnostics
+	}
+	if d := lint("func(x: Q) { x }"); len(d) != 1 || d[0].Kind != "syntax" {
+		t.Errorf("expected a syntax error, got %+v", d)
+	}
+	if d := lint("add(1, 'two')"); len(d) != 1 || d[0].Kind != "type" || d[0].Line != 1 {
+		t.Errorf("expected a type error, got %+v", d)
+	}
+	if d := lint("setq(x, add(1, 2))"); len(d) != 0 {
+		t.Errorf("expected no diagnostics, got %+v", d)
+	}
+}
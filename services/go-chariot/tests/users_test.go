@@ -0,0 +1,530 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/users"
+)
+
+// TestUserStoreLifecycle verifies creating, authenticating, disabling and
+// resetting accounts, and that they survive reopening the store.
+func TestUserStoreLifecycle(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "users.json")
+	s, err := users.Open(file)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if s.Enabled() {
+		t.Fatal("an empty store checks logins")
+	}
+	if _, err := s.Create(users.User{ID: "dave", Roles: []string{users.RoleContributor}}, "dave-password"); err == nil {
+		t.Fatal("the first account was not required to be an admin")
+	}
+	if _, err := s.Create(users.User{ID: "root", Roles: []string{users.RoleAdmin}}, "root-password"); err != nil {
+		t.Fatalf("Create admin: %v", err)
+	}
+	if _, err := s.Create(users.User{ID: "dave", Roles: []string{"owner"}}, "dave-password"); err == nil {
+		t.Error("an unknown role was accepted")
+	}
+	if _, err := s.Create(users.User{ID: "dave", Roles: []string{users.RoleContributor}}, "short"); err == nil {
+		t.Error("a short password was accepted")
+	}
+	dave, err := s.Create(users.User{ID: "dave", DisplayName: "Dave", Roles: []string{users.RoleContributor}}, "dave-password")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if dave.PasswordHash != "" {
+		t.Error("Create returned the password hash")
+	}
+	if _, err := s.Create(users.User{ID: "dave", Roles: []string{users.RoleViewer}}, "dave-password"); !errors.Is(err, users.ErrExists) {
+		t.Errorf("duplicate Create = %v, want ErrExists", err)
+	}
+
+	if _, err := s.Login(users.Credentials{ID: "dave", Password: "wrong-password"}); !errors.Is(err, users.ErrInvalidCredentials) {
+		t.Errorf("wrong password = %v", err)
+	}
+	if _, err := s.Login(users.Credentials{ID: "nobody", Password: "dave-password"}); !errors.Is(err, users.ErrInvalidCredentials) {
+		t.Errorf("unknown user = %v", err)
+	}
+	if u, err := s.Login(users.Credentials{ID: "dave", Password: "dave-password"}); err != nil || u.LastLoginAt.IsZero() {
+		t.Errorf("Login = %+v, %v", u, err)
+	}
+
+	disabled := true
+	if _, err := s.Update("dave", users.Update{Disabled: &disabled}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := s.Login(users.Credentials{ID: "dave", Password: "dave-password"}); !errors.Is(err, users.ErrDisabled) {
+		t.Errorf("disabled login = %v, want ErrDisabled", err)
+	}
+
+	generated, err := s.SetPassword("dave", "")
+	if err != nil || len(generated) != 16 {
+		t.Fatalf("SetPassword = %q, %v", generated, err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("the store was not saved: %v", err)
+	}
+	if info, _ := os.Stat(file); info.Mode().Perm() != 0o600 {
+		t.Errorf("store file mode = %v, want 0600", info.Mode().Perm())
+	}
+	if len(data) == 0 {
+		t.Fatal("the store file is empty")
+	}
+
+	reopened, err := users.Open(file)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	enabled := false
+	if _, err := reopened.Update("dave", users.Update{Disabled: &enabled}); err != nil {
+		t.Fatalf("Update after reopen: %v", err)
+	}
+	if _, err := reopened.Login(users.Credentials{ID: "dave", Password: generated}); err != nil {
+		t.Errorf("the generated password does not log in after reopening: %v", err)
+	}
+	if got, _ := reopened.Get("dave"); got.DisplayName != "Dave" {
+		t.Errorf("display name = %q after reopening", got.DisplayName)
+	}
+}
+
+// TestUserStoreLastAdmin verifies the last active admin cannot be disabled,
+// demoted or deleted while other accounts remain.
+func TestUserStoreLastAdmin(t *testing.T) {
+	s, _ := users.Open("")
+	if _, err := s.Create(users.User{ID: "root", Roles: []string{users.RoleAdmin}}, "root-password"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := s.Create(users.User{ID: "dave", Roles: []string{users.RoleViewer}}, "dave-password"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	disabled := true
+	if _, err := s.Update("root", users.Update{Disabled: &disabled}); !errors.Is(err, users.ErrLastAdmin) {
+		t.Errorf("disabling the last admin = %v", err)
+	}
+	viewer := []string{users.RoleViewer}
+	if _, err := s.Update("root", users.Update{Roles: &viewer}); !errors.Is(err, users.ErrLastAdmin) {
+		t.Errorf("demoting the last admin = %v", err)
+	}
+	if err := s.Delete("root"); !errors.Is(err, users.ErrLastAdmin) {
+		t.Errorf("deleting the last admin = %v", err)
+	}
+
+	admin := []string{users.RoleAdmin}
+	if _, err := s.Update("dave", users.Update{Roles: &admin}); err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+	if err := s.Delete("root"); err != nil {
+		t.Errorf("deleting an admin with another admin left: %v", err)
+	}
+	if !s.HasAdmin() {
+		t.Error("no admin left")
+	}
+}
+
+// TestUserStoreBrokenFile verifies a store whose file cannot be parsed
+// refuses logins rather than leaving them unchecked.
+func TestUserStoreBrokenFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "users.json")
+	if err := os.WriteFile(file, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := users.Open(file)
+	if err == nil {
+		t.Fatal("a broken file loaded")
+	}
+	if !s.Enabled() {
+		t.Error("a broken store leaves logins unchecked")
+	}
+	if _, err := s.Create(users.User{ID: "root", Roles: []string{users.RoleAdmin}}, "root-password"); !errors.Is(err, users.ErrUnavailable) {
+		t.Errorf("Create on a broken store = %v", err)
+	}
+}
+
+// TestUserStorePasswordPolicy verifies complexity rules and that an expired
+// password must be replaced at login.
+func TestUserStorePasswordPolicy(t *testing.T) {
+	s, _ := users.Open("")
+	s.SetPolicy(users.Policy{MinLength: 10, MinClasses: 3})
+	if _, err := s.Create(users.User{ID: "root", Roles: []string{users.RoleAdmin}}, "alllowercase"); err == nil {
+		t.Error("a password of one class was accepted")
+	}
+	if _, err := s.Create(users.User{ID: "root", Roles: []string{users.RoleAdmin}}, "Sh0rt!"); err == nil {
+		t.Error("a short password was accepted")
+	}
+	if _, err := s.Create(users.User{ID: "root", Roles: []string{users.RoleAdmin}}, "Root-passw0rd"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := s.SetPassword("root", "onlyletters"); err == nil {
+		t.Error("SetPassword ignored the policy")
+	}
+	if generated, err := s.SetPassword("root", ""); err != nil {
+		t.Errorf("a generated password does not satisfy the policy: %q %v", generated, err)
+	} else if err := s.ChangePassword("root", generated, "Root-passw0rd"); err != nil {
+		t.Errorf("ChangePassword: %v", err)
+	}
+	if err := s.ChangePassword("root", "wrong", "An0ther-password"); !errors.Is(err, users.ErrInvalidCredentials) {
+		t.Errorf("ChangePassword with a wrong password = %v", err)
+	}
+
+	s.SetPolicy(users.Policy{MinLength: 10, MinClasses: 3, MaxAge: time.Nanosecond})
+	u, _ := s.Get("root")
+	if s.PasswordExpiresAt(u).IsZero() {
+		t.Error("no expiry reported")
+	}
+	if _, err := s.Login(users.Credentials{ID: "root", Password: "Root-passw0rd"}); !errors.Is(err, users.ErrPasswordExpired) {
+		t.Fatalf("expired login = %v, want ErrPasswordExpired", err)
+	}
+	if _, err := s.Login(users.Credentials{ID: "root", Password: "Root-passw0rd", NewPassword: "Root-passw0rd"}); err == nil {
+		t.Error("the expired password was reused")
+	}
+	if _, err := s.Login(users.Credentials{ID: "root", Password: "Root-passw0rd", NewPassword: "weak"}); err == nil {
+		t.Error("a new password breaking the policy was accepted")
+	}
+	s.SetPolicy(users.Policy{MinLength: 10, MinClasses: 3, MaxAge: time.Hour})
+	if _, err := s.Login(users.Credentials{ID: "root", Password: "Root-passw0rd"}); err != nil {
+		t.Fatalf("login within the maximum age: %v", err)
+	}
+	s.SetPolicy(users.Policy{MinLength: 10, MinClasses: 3, MaxAge: time.Nanosecond})
+	if _, err := s.Login(users.Credentials{ID: "root", Password: "Root-passw0rd", NewPassword: "Fresh-passw0rd"}); err != nil {
+		t.Fatalf("changing an expired password at login: %v", err)
+	}
+	s.SetPolicy(users.Policy{MinLength: 10, MinClasses: 3, MaxAge: time.Hour})
+	if _, err := s.Login(users.Credentials{ID: "root", Password: "Fresh-passw0rd"}); err != nil {
+		t.Errorf("login with the new password: %v", err)
+	}
+}
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 test secret "12345678901234567890", truncated to 6 digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	for at, want := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924"} {
+		if got, err := users.TOTPCode(secret, time.Unix(at, 0)); err != nil || got != want {
+			t.Errorf("TOTPCode at %d = %q, %v; want %q", at, got, err, want)
+		}
+	}
+}
+
+// TestUserStoreMFA verifies enrolling a second factor, logging in with
+// one-time and recovery codes, and removing it.
+func TestUserStoreMFA(t *testing.T) {
+	s, _ := users.Open("")
+	if _, err := s.Create(users.User{ID: "root", Roles: []string{users.RoleAdmin}}, "root-password"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := s.ConfirmTOTP("root", "123456"); !errors.Is(err, users.ErrNoEnrollment) {
+		t.Errorf("confirm without enrolling = %v", err)
+	}
+	secret, err := s.BeginTOTP("root")
+	if err != nil {
+		t.Fatalf("BeginTOTP: %v", err)
+	}
+	if _, err := s.Login(users.Credentials{ID: "root", Password: "root-password"}); err != nil {
+		t.Errorf("an unconfirmed enrollment asked for a code: %v", err)
+	}
+	if _, err := s.ConfirmTOTP("root", "000000"); !errors.Is(err, users.ErrInvalidCode) {
+		t.Errorf("confirm with a wrong code = %v", err)
+	}
+	now := time.Now()
+	code, _ := users.TOTPCode(secret, now)
+	recovery, err := s.ConfirmTOTP("root", code)
+	if err != nil || len(recovery) != 10 {
+		t.Fatalf("ConfirmTOTP = %d codes, %v", len(recovery), err)
+	}
+	if u, _ := s.Get("root"); !u.MFAEnabled || u.TOTPSecret != "" || u.RecoveryCodes != nil {
+		t.Errorf("Get = %+v, want MFA enabled without secrets", u)
+	}
+
+	if _, err := s.Login(users.Credentials{ID: "root", Password: "root-password"}); !errors.Is(err, users.ErrMFARequired) {
+		t.Errorf("login without a code = %v, want ErrMFARequired", err)
+	}
+	if _, err := s.Login(users.Credentials{ID: "root", Password: "root-password", Code: code}); !errors.Is(err, users.ErrInvalidCode) {
+		t.Errorf("reusing the enrollment code = %v, want ErrInvalidCode", err)
+	}
+	next, _ := users.TOTPCode(secret, now.Add(30*time.Second))
+	if _, err := s.Login(users.Credentials{ID: "root", Password: "root-password", Code: next}); err != nil {
+		t.Errorf("login with the next code: %v", err)
+	}
+	if _, err := s.Login(users.Credentials{ID: "root", Password: "root-password", Code: recovery[0]}); err != nil {
+		t.Errorf("login with a recovery code: %v", err)
+	}
+	if _, err := s.Login(users.Credentials{ID: "root", Password: "root-password", Code: recovery[0]}); !errors.Is(err, users.ErrInvalidCode) {
+		t.Errorf("reusing a recovery code = %v", err)
+	}
+
+	if err := s.DisableTOTP("root", "000000"); !errors.Is(err, users.ErrInvalidCode) {
+		t.Errorf("disable with a wrong code = %v", err)
+	}
+	if err := s.DisableTOTP("root", recovery[1]); err != nil {
+		t.Fatalf("DisableTOTP: %v", err)
+	}
+	if _, err := s.Login(users.Credentials{ID: "root", Password: "root-password"}); err != nil {
+		t.Errorf("login after removing the second factor: %v", err)
+	}
+}
+
+// TestUserStoreCodeLockout verifies that wrong one-time codes lock an
+// account's codes, across reopening the store, until an admin resets them,
+// and that a used code stays usable when its use cannot be saved.
+func TestUserStoreCodeLockout(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "users.json")
+	s, err := users.Open(file)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := s.Create(users.User{ID: "root", Roles: []string{users.RoleAdmin}}, "root-password"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	secret, _ := s.BeginTOTP("root")
+	now := time.Now()
+	code, _ := users.TOTPCode(secret, now)
+	recovery, err := s.ConfirmTOTP("root", code)
+	if err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+
+	// A failed save keeps the recovery code unused
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(file, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	login := func(code string) error {
+		_, err := s.Login(users.Credentials{ID: "root", Password: "root-password", Code: code})
+		return err
+	}
+	if err := login(recovery[0]); err == nil {
+		t.Error("a login that could not be saved succeeded")
+	}
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := login(recovery[0]); err != nil {
+		t.Errorf("the recovery code of the unsaved login: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := login("000000"); !errors.Is(err, users.ErrInvalidCode) {
+			t.Fatalf("wrong code %d = %v, want ErrInvalidCode", i+1, err)
+		}
+	}
+	next, _ := users.TOTPCode(secret, now.Add(30*time.Second))
+	if err := login(next); !errors.Is(err, users.ErrCodeLocked) {
+		t.Errorf("a right code after 5 wrong ones = %v, want ErrCodeLocked", err)
+	}
+	if err := s.DisableTOTP("root", recovery[1]); !errors.Is(err, users.ErrCodeLocked) {
+		t.Errorf("disabling while locked = %v, want ErrCodeLocked", err)
+	}
+	reopened, err := users.Open(file)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if _, err := reopened.Login(users.Credentials{ID: "root", Password: "root-password", Code: recovery[1]}); !errors.Is(err, users.ErrCodeLocked) {
+		t.Errorf("login after reopening = %v, want ErrCodeLocked", err)
+	}
+
+	if _, err := s.ResetTOTP("root"); err != nil {
+		t.Fatalf("ResetTOTP: %v", err)
+	}
+	if u, _ := s.Get("root"); u.CodeFailures != 0 || !u.CodeLockedUntil.IsZero() {
+		t.Errorf("after the reset, %d failures and locked until %v", u.CodeFailures, u.CodeLockedUntil)
+	}
+	if err := login(""); err != nil {
+		t.Errorf("login after the reset: %v", err)
+	}
+}
+
+func TestQRCodePNG(t *testing.T) {
+	uri := users.TOTPURI("Chariot", "alice", users.NewTOTPSecret())
+	data, err := users.QRCodePNG(uri, 4)
+	if err != nil {
+		t.Fatalf("QRCodePNG: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	// The URI needs version 7 (45 modules) plus a 4-module quiet zone
+	if b := img.Bounds(); b.Dx() != b.Dy() || b.Dx() != (45+8)*4 {
+		t.Errorf("image is %dx%d", b.Dx(), b.Dy())
+	}
+	if _, err := users.QRCodePNG(string(make([]byte, 300)), 4); err == nil {
+		t.Error("an oversized payload was encoded")
+	}
+}
+
+// TestQRCodeVectors compares QRCodePNG's modules with symbols from an
+// independent encoder, at level M and the same mask, for versions 2 (one
+// alignment pattern), 5 (two blocks) and 8 (version information and blocks
+// of two sizes).
+func TestQRCodeVectors(t *testing.T) {
+	vectors := []struct {
+		text    string
+		modules []string
+	}{
+		{
+			"0123456789abcdefghij",
+			[]string{
+				"#######...#.##..#.#######",
+				"#.....#..#..#..##.#.....#",
+				"#.###.#.#.##....#.#.###.#",
+				"#.###.#.###.####..#.###.#",
+				"#.###.#.#..#.#..#.#.###.#",
+				"#.....#.#..#...#..#.....#",
+				"#######.#.#.#.#.#.#######",
+				"........###.#.#.#........",
+				"#.#####......###..#####..",
+				".####....#####..##...#.#.",
+				"..###.########.##....##.#",
+				"..#.##..##.#...####.##.##",
+				".###..#..##....#.####.#.#",
+				"#..###.###..##..#....#.#.",
+				"#.#.#.###....###..###.#.#",
+				"#....#.####.##.#####.#..#",
+				"#.#.#.##..#.#.#######.#.#",
+				"........#......##...#..#.",
+				"#######...###...#.#.##..#",
+				"#.....#.#..#..#.#...##..#",
+				"#.###.#.##.#...######.###",
+				"#.###.#.#...###.#####..##",
+				"#.###.#.###..###........#",
+				"#.....#.....##.##.#.##..#",
+				"#######.###.#.#....#..###",
+			},
+		},
+		{
+			"otpauth://totp/Chariot:alice?secret=JBSWY3DPEHPK3PXP&issuer=Chariot",
+			[]string{
+				"#######.######.#..##.#..##.##.#######",
+				"#.....#.............#.#.#.#.#.#.....#",
+				"#.###.#..##.#.#.#########.##..#.###.#",
+				"#.###.#.#..##..#..##...#.####.#.###.#",
+				"#.###.#.###..###.....#.#.##.#.#.###.#",
+				"#.....#.##..####..#####...#.#.#.....#",
+				"#######.#.#.#.#.#.#.#.#.#.#.#.#######",
+				"........####.##..###..##.............",
+				"#...#.####....##..##..#...##.#####..#",
+				"..#.#...##..#...#..###.#...####.##.#.",
+				"#.##.##..##...#.###.#####..#..#...#..",
+				"....#...#######..#...#..#..#..#.#.##.",
+				".#....#...#.##.#####.####.....##...##",
+				"#..#.#....#..###.#.....#..##...##...#",
+				"##....#####..#.#..#.####..####..###..",
+				"####.#..###.#.###..#.#....####..#.##.",
+				".#.#..##..#.#.###..##..###..#.#.#.#.#",
+				".###.#..#.#####..###..##.####...#.##.",
+				".#.#########..##.###..###..#..#..##..",
+				".#.#.#....#.#..#######.#..#.#.#...#.#",
+				"###.###.####..#.#...####....###..#.#.",
+				"####.#..###..#..#.#..#.###.###.##..##",
+				"#.##.##....##..#.#..#..#.#.##.....#..",
+				"#....#.#....#....##.#.###.##.##.#.##.",
+				"##.##.#####..##...##..#.#...###.#####",
+				"##.###.#..#####.##.##..#.####...#....",
+				"..###.##.#..###.#...##.#.#.#...####..",
+				"...#...#.#.......#...#......##....#.#",
+				"####..##.#...#.##..###......#####...#",
+				"........##.#.#..###...##..###...##..#",
+				"#######.#..#.#.#..#.#####...#.#.#.#..",
+				"#.....#..#.#....#..#.#..#...#...#.#.#",
+				"#.###.#.####....#..##..#....#######.#",
+				"#.###.#..#..#.....##.###..######..#.#",
+				"#.###.#...#...##...#...##....###.....",
+				"#.....#..#....####.###.#..#..##..###.",
+				"#######.##...##.#....##.#..#.##.#####",
+			},
+		},
+		{
+			"otpauth://totp/Chariot%20Server:alice%40example.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=Chariot%20Server&algorithm=SHA1&digits=6&period=30",
+			[]string{
+				"#######.##...#.#.#..##....##.####..##...#.#######",
+				"#.....#..#...#.#..#.#.#....#.#..#.#.#.###.#.....#",
+				"#.###.#..#.###..###.###.#..#...######..##.#.###.#",
+				"#.###.#.###......#.....#..#.##.#...#.#.#..#.###.#",
+				"#.###.#.##..#..#.##...#####.#.#.##.##.....#.###.#",
+				"#.....#.#.....####.#.##...#.....#.#.#.#...#.....#",
+				"#######.#.#.#.#.#.#.#.#.#.#.#.#.#.#.#.#.#.#######",
+				"........##.....#.#.####...###.....#####..........",
+				"#...#.#####.#.##.###.#######.#..##.###..######..#",
+				"#.#.##.######.#.#.#.#...#.#.###.##.#..##.##..#.#.",
+				"#####.#####.##..##..##...##..#.###.#..###.###.##.",
+				"#.#.....#...#.....##.##.#....#.##.##...#......##.",
+				".#..#.#...###..####.###.##.#....#.###..##.#.##.##",
+				"..##.#..##.#...##.#######.##..#..#.#..#..###.#.#.",
+				"###.#.####...##.#..#..#..#..#.####..##..######...",
+				"###..#...##.#.#####..##.#.##.#.##.#.####..#.#.#.#",
+				"..#.#.##..##....#.#..##.#.##.#..#.#.#.#.###.#.##.",
+				".##....#..##...#....#..##.#...#.##.####..##.##...",
+				".####.#....#.##.#.#.#.###.###.#.##.#.##.#.#..###.",
+				"###....#####.#.##.....#.#.......##...#..##.##.###",
+				"#.#.###.###.#.#.###.#.#.##.#.##.#..####.#...###.#",
+				".#####.#...#.####.#.##....##..#.##....#..##.#...#",
+				"..#.#####.##.###....#########.##.#.##.#.#######..",
+				"#..##...##..#...##..###...###..####.#...#...#.#.#",
+				"...##.#.#.#..##.#.##..#.#.##.########..##.#.#.###",
+				".####...##.#.#...##.###...########.#..###...#.##.",
+				".########....###..#########.#..#....#.########.#.",
+				"#..#.#...##..#..###..#.#..##..#.##.###.....#..#..",
+				".#.#.####..#.####.###.....##.##.##..###...##...##",
+				"#####..###.#....###....###.####.##..#.#.#...#....",
+				"...#..##.###.####.#.##..##.###..#..#.#.#...##.#..",
+				"#.#.#..#.#..#.#...####..#.#...#.#.##.###.###..#..",
+				"..#.#.#.###.#...###..#....##.##.#..##.#.#..##.###",
+				"..##.#.#.##..###..#.#.#.##..#.#..#..#.###.#.#..#.",
+				"...#..#...####..#.##..##.#..#.##.#.###.###.####..",
+				"#...#..####.##.#...#.......#.#.#####.##...##..#..",
+				"#...###.###...#....##.###..#....##.##.....##..###",
+				"##.##..#####.#....#.#..##.....#..#.#..#.#.#.##..#",
+				".#...#####.##.#..#.##...##.#..#.....###.#.....#..",
+				".###...#...####.#..####..##########.###.###.#.#..",
+				"###...######..###.##..######....#.#.#...#######.#",
+				"........##.#...#....#.#...#..##.##.##.#.#...##...",
+				"#######.##....#....#..#.#.#.##.#.#..#.#.#.#.####.",
+				"#.....#..#.#...##.#.###...#.##..###.#..##...#.#..",
+				"#.###.#.#.#..###.###########.#..#####.#######..##",
+				"#.###.#..##..##.##.##..#.#...###.#..#.#####..####",
+				"#.###.#......#..##...##..#.####.........####.####",
+				"#.....#....#...##........#.#....##.#....#..#..##.",
+				"#######.#.#.#.#.#..#.#.###......##.##...#.###.###",
+			},
+		},
+	}
+	for _, v := range vectors {
+		data, err := users.QRCodePNG(v.text, 1)
+		if err != nil {
+			t.Fatalf("QRCodePNG(%q): %v", v.text, err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		const quiet = 4
+		n := len(v.modules)
+		if b := img.Bounds(); b.Dx() != n+2*quiet || b.Dy() != n+2*quiet {
+			t.Errorf("%q: image is %dx%d, want %d modules and the quiet zone", v.text, b.Dx(), b.Dy(), n)
+			continue
+		}
+		for y, want := range v.modules {
+			row := make([]byte, n)
+			for x := range row {
+				row[x] = '.'
+				if r, _, _, _ := img.At(x+quiet, y+quiet).RGBA(); r == 0 {
+					row[x] = '#'
+				}
+			}
+			if string(row) != want {
+				t.Errorf("%q: row %d = %s, want %s", v.text, y, row, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/internal/handlers"
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/logs"
+	"github.com/labstack/echo/v4"
+)
+
+// callWithSession runs a handler for one request on behalf of session.
+func callWithSession(t *testing.T, session *chariot.Session, handler echo.HandlerFunc, method, target, body string) handlers.ResultJSON {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("session", session)
+	if err := handler(c); err != nil {
+		t.Fatalf("%s %s: %v", method, target, err)
+	}
+	var out handlers.ResultJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("%s %s: decoding %q: %v", method, target, rec.Body.String(), err)
+	}
+	if out.Result == "ERROR" && rec.Code != http.StatusOK {
+		t.Logf("%s %s returned %d: %v", method, target, rec.Code, out.Data)
+	}
+	return out
+}
+
+// TestWatchExpressions verifies that watch expressions are evaluated after
+// each execution and returned with its result.
+func TestWatchExpressions(t *testing.T) {
+	sm := chariot.NewSessionManager(30*time.Minute, 5*time.Minute)
+	session := sm.NewSession("watcher", logs.NewZapLogger(), "watch-token")
+	defer sm.EndSession("watch-token")
+	var h handlers.Handlers
+
+	added := callWithSession(t, session, h.AddWatch, http.MethodPost, "/api/runtime/watches", `{"expression": "add(total, 1)"}`)
+	if added.Result != "OK" {
+		t.Fatalf("AddWatch: %v", added.Data)
+	}
+	callWithSession(t, session, h.AddWatch, http.MethodPost, "/api/runtime/watches", `{"expression": "missingVariable"}`)
+	if bad := callWithSession(t, session, h.AddWatch, http.MethodPost, "/api/runtime/watches", `{"expression": ")("}`); bad.Result != "ERROR" {
+		t.Fatalf("expected an unparsable expression to be rejected")
+	}
+
+	res := callWithSession(t, session, h.Execute, http.MethodPost, "/api/execute", `{"program": "setq(total, 41)"}`)
+	if res.Result != "OK" {
+		t.Fatalf("Execute: %v", res.Data)
+	}
+	if len(res.Watches) != 2 {
+		t.Fatalf("expected two watch results, got %+v", res.Watches)
+	}
+	if w := res.Watches[0]; w.Expression != "add(total, 1)" || w.Error != "" || w.Value != float64(42) {
+		t.Fatalf("unexpected watch result %+v", w)
+	}
+	if w := res.Watches[1]; w.Error == "" {
+		t.Fatalf("expected an error for an undefined variable, got %+v", w)
+	}
+
+	removed := callWithSession(t, session, h.RemoveWatch, http.MethodDelete, "/api/runtime/watches?expression=missingVariable", "")
+	if list, ok := removed.Data.([]interface{}); !ok || len(list) != 1 {
+		t.Fatalf("expected one watch after removal, got %v", removed.Data)
+	}
+	cleared := callWithSession(t, session, h.RemoveWatch, http.MethodDelete, "/api/runtime/watches", "")
+	if list, ok := cleared.Data.([]interface{}); !ok || len(list) != 0 {
+		t.Fatalf("expected an empty watch list, got %v", cleared.Data)
+	}
+}
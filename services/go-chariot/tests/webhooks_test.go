@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/webhooks"
+)
+
+// TestWebhooks verifies that events reach matching subscriptions signed with
+// the subscription's secret, that failed deliveries are retried and logged,
+// and that subscriptions persist across restarts.
+func TestWebhooks(t *testing.T) {
+	var calls int32
+	received := make(chan webhooks.Event, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get("X-Chariot-Timestamp"), 10, 64)
+		if r.Header.Get("X-Chariot-Signature") != webhooks.Sign("s3cret", ts, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// The first delivery fails so it is retried
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var ev webhooks.Event
+		_ = json.Unmarshal(body, &ev)
+		received <- ev
+	}))
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "webhooks.json")
+	d, err := webhooks.New(webhooks.Options{File: file, Backoff: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Create(webhooks.Subscription{URL: "ftp://example.com", Events: []string{"*"}, Active: true}); err == nil {
+		t.Fatal("expected a non-http URL to be rejected")
+	}
+	if _, err := d.Create(webhooks.Subscription{URL: srv.URL, Events: []string{"execution.exploded"}, Active: true}); err == nil {
+		t.Fatal("expected an unknown event type to be rejected")
+	}
+	sub, err := d.Create(webhooks.Subscription{URL: srv.URL, Events: []string{webhooks.ExecutionFailed}, Secret: "s3cret", Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Notify(webhooks.ExecutionFinished, map[string]interface{}{"execution_id": "a"}) // not subscribed
+	d.Notify(webhooks.ExecutionFailed, map[string]interface{}{"execution_id": "b"})
+	select {
+	case ev := <-received:
+		if ev.Type != webhooks.ExecutionFailed || ev.Data["execution_id"] != "b" {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not delivered")
+	}
+
+	// The attempt is logged once the response is back
+	var log []webhooks.Delivery
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if log = d.Deliveries(sub.ID, 0); len(log) == 2 {
+			break
+		}
+	}
+	if len(log) != 2 || !log[0].Success || log[0].Attempt != 2 || log[1].Status != http.StatusServiceUnavailable || !log[1].Retry {
+		t.Fatalf("unexpected delivery log %+v", log)
+	}
+	d.Close()
+
+	reopened, err := webhooks.New(webhooks.Options{File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	list := reopened.List()
+	if len(list) != 1 || list[0].ID != sub.ID || list[0].Secret != "" {
+		t.Fatalf("unexpected subscriptions after reload %+v", list)
+	}
+}
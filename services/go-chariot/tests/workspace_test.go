@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/workspace"
+)
+
+func newTestWorkspace(t *testing.T) workspace.Workspace {
+	t.Helper()
+	root := t.TempDir()
+	ws := workspace.Workspace{
+		FilesDir:    filepath.Join(root, "files"),
+		DiagramsDir: filepath.Join(root, "diagrams"),
+		Functions:   map[string]json.RawMessage{},
+		Listeners:   map[string]json.RawMessage{},
+	}
+	for _, dir := range []string{ws.FilesDir, ws.DiagramsDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ws
+}
+
+func TestWorkspaceExportImport(t *testing.T) {
+	src := newTestWorkspace(t)
+	os.WriteFile(filepath.Join(src.FilesDir, "main.ch"), []byte("setq(x, 1)"), 0o644)
+	os.WriteFile(filepath.Join(src.DiagramsDir, "flow.json"), []byte(`{"nodes":[]}`), 0o644)
+	src.Functions["double"] = json.RawMessage(`{"parameters":["n"],"source":"mul(n, 2)"}`)
+	src.Listeners["orders"] = json.RawMessage(`{"name":"orders","script":"orders.ch"}`)
+
+	var buf bytes.Buffer
+	manifest, err := workspace.Export(&buf, src, "global")
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(manifest.Files) != 1 || len(manifest.Diagrams) != 1 || manifest.Diagrams[0] != "flow" ||
+		len(manifest.Functions) != 1 || len(manifest.Listeners) != 1 {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+	open := func() *zip.Reader {
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return zr
+	}
+
+	// Into an empty workspace everything is imported.
+	dst := newTestWorkspace(t)
+	rep, err := workspace.Import(open(), dst, workspace.PolicySkip)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(rep.Imported) != 4 || len(rep.Skipped) != 0 {
+		t.Fatalf("expected 4 imported entries, got %+v", rep)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst.FilesDir, "main.ch")); string(data) != "setq(x, 1)" {
+		t.Fatalf("file not imported, got %q", data)
+	}
+	if _, ok := dst.Functions["double"]; !ok {
+		t.Fatalf("function not imported")
+	}
+
+	// A second import hits every name.
+	if rep, err = workspace.Import(open(), dst, workspace.PolicySkip); err != nil || len(rep.Skipped) != 4 {
+		t.Fatalf("skip policy: expected 4 skipped, got %+v (%v)", rep, err)
+	}
+	rep, err = workspace.Import(open(), dst, workspace.PolicyFail)
+	if !errors.Is(err, workspace.ErrConflict) || len(rep.Conflicts) != 4 {
+		t.Fatalf("fail policy: expected 4 conflicts, got %+v (%v)", rep, err)
+	}
+	if rep, err = workspace.Import(open(), dst, workspace.PolicyRename); err != nil || len(rep.Imported) != 4 {
+		t.Fatalf("rename policy: %+v (%v)", rep, err)
+	}
+	renamed := map[string]string{}
+	for _, item := range rep.Imported {
+		renamed[item.Kind] = item.As
+	}
+	if renamed[workspace.KindFile] != "main_2.ch" || renamed[workspace.KindFunction] != "double_2" {
+		t.Fatalf("unexpected renames: %+v", renamed)
+	}
+	if _, err := os.Stat(filepath.Join(dst.DiagramsDir, "flow_2.json")); err != nil {
+		t.Fatalf("renamed diagram missing: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dst.FilesDir, "main.ch"), []byte("changed"), 0o644)
+	if _, err = workspace.Import(open(), dst, workspace.PolicyOverwrite); err != nil {
+		t.Fatalf("overwrite policy: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst.FilesDir, "main.ch")); string(data) != "setq(x, 1)" {
+		t.Fatalf("file not overwritten, got %q", data)
+	}
+}
+
+func TestWorkspaceImportRejectsUnsafeEntries(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("files/../../escape.ch")
+	w.Write([]byte("x"))
+	zw.Close()
+	zr, _ := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if _, err := workspace.Import(zr, newTestWorkspace(t), workspace.PolicyOverwrite); err == nil {
+		t.Fatalf("expected a path traversal entry to be rejected")
+	}
+	if _, err := workspace.ParsePolicy("merge"); err == nil {
+		t.Fatalf("expected an unknown policy to be rejected")
+	}
+}
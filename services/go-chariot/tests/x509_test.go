@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+)
+
+// testCert issues a certificate for template, signed by parent (self-signed
+// when parent is nil), and returns it with its PEM and key.
+func testCert(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, string, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), key
+}
+
+func TestCertificateFunctions(t *testing.T) {
+	now := time.Now()
+	ca, caPEM, caKey := testCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	_, leafPEM, _ := testCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(0xBEEF),
+		Subject:      pkix.Name{CommonName: "api.example.com"},
+		DNSNames:     []string{"api.example.com"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(20*24*time.Hour + time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+
+	_, otherPEM, _ := testCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Other Root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+
+	rt := createNamedRuntime("x509")
+	defer chariot.UnregisterRuntime("x509")
+	rt.SetVariable("ca", chariot.Str(caPEM))
+	rt.SetVariable("leaf", chariot.Str(leafPEM))
+	rt.SetVariable("other", chariot.Str(otherPEM))
+	run := scriptRunner(t, rt)
+
+	cert := run(`parseCertificate(leaf)`).(*chariot.MapValue)
+	for key, want := range map[string]chariot.Value{
+		"commonName":    chariot.Str("api.example.com"),
+		"issuer":        chariot.Str("CN=Test Root"),
+		"serialNumber":  chariot.Str("BEEF"),
+		"daysRemaining": chariot.Number(20),
+		"expired":       chariot.Bool(false),
+		"isCA":          chariot.Bool(false),
+		"selfSigned":    chariot.Bool(false),
+		"keyAlgorithm":  chariot.Str("ECDSA"),
+	} {
+		if got, _ := cert.Get(key); got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	if got := run(`certExpiry(concat(leaf, ca))`); got != chariot.Number(20) {
+		t.Errorf("certExpiry = %v, want 20", got)
+	}
+
+	ok := run(`verifyCertificateChain(leaf, map("roots", ca, "dnsName", "api.example.com"))`).(*chariot.MapValue)
+	if v, _ := ok.Get("valid"); v != chariot.Bool(true) {
+		t.Fatalf("chain not valid: %v", ok.Values["error"])
+	}
+	if chain, _ := ok.Get("chain"); chain.(*chariot.ArrayValue).Length() != 2 {
+		t.Errorf("chain = %v", chain)
+	}
+	for _, script := range []string{
+		`verifyCertificateChain(leaf, map("roots", ca, "dnsName", "www.example.com"))`,
+		`verifyCertificateChain(leaf, map("roots", ca, "at", "2099-01-01"))`,
+		`verifyCertificateChain(leaf, map("roots", other))`,
+	} {
+		res := run(script).(*chariot.MapValue)
+		if v, _ := res.Get("valid"); v != chariot.Bool(false) {
+			t.Errorf("%s: expected an invalid chain", script)
+		}
+		if e, _ := res.Get("error"); e == chariot.Str("") {
+			t.Errorf("%s: no error reported", script)
+		}
+	}
+	if _, err := rt.Evaluate(`parseCertificate("not a certificate")`); err == nil {
+		t.Error("parseCertificate accepted garbage")
+	}
+}
+
+func TestFetchCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	serverPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+
+	rt := createNamedRuntime("fetch_cert")
+	defer chariot.UnregisterRuntime("fetch_cert")
+	rt.SetVariable("addr", chariot.Str(srv.URL))
+	rt.SetVariable("ca", chariot.Str(serverPEM))
+
+	// The test server's certificate is not in the system roots
+	res, err := rt.Evaluate(`fetchCertificate(addr)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := res.(*chariot.MapValue)
+	if v, _ := m.Get("verified"); v != chariot.Bool(false) {
+		t.Error("untrusted certificate reported as verified")
+	}
+	certs, _ := m.Get("certificates")
+	if certs.(*chariot.ArrayValue).Length() == 0 {
+		t.Fatal("no certificates returned")
+	}
+	if p, _ := m.Get("pem"); !strings.Contains(string(p.(chariot.Str)), "BEGIN CERTIFICATE") {
+		t.Error("no PEM chain returned")
+	}
+
+	res, err = rt.Evaluate(`fetchCertificate(addr, map("caCert", ca))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = res.(*chariot.MapValue)
+	if v, _ := m.Get("verified"); v != chariot.Bool(true) {
+		t.Errorf("trusted certificate not verified: %v", m.Values["verifyError"])
+	}
+}
+
+func TestLoadCSVWithTLSOptions(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("name,qty\nwidget,3\n"))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+	serverPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+
+	now := time.Now()
+	_, clientPEM, clientKey := testCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "chariot-client"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, nil, nil)
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt := createNamedRuntime("csv_tls")
+	defer chariot.UnregisterRuntime("csv_tls")
+	rt.SetVariable("url", chariot.Str(srv.URL+"/stock.csv"))
+	rt.SetVariable("ca", chariot.Str(serverPEM))
+	rt.SetVariable("cert", chariot.Str(clientPEM))
+	rt.SetVariable("key", chariot.Str(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})))
+
+	if _, err := rt.Evaluate(`loadCSV(url, true)`); err == nil {
+		t.Fatal("untrusted server accepted without a caCert")
+	}
+	if _, err := rt.Evaluate(`loadCSV(url, true, map("tls", map("caCert", ca)))`); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected HTTP 401 without a client certificate, got %v", err)
+	}
+	if _, err := rt.Evaluate(`loadCSV(url, true, map("tls", map("caCert", ca, "clientCert", cert, "clientKey", key)))`); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bhouse1273/chariot-ecosystem/services/go-chariot/chariot"
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+)
+
+func TestYAMLRoundTripFidelity(t *testing.T) {
+	setConfig(t, &cfg.ChariotConfig.DataPath, t.TempDir())
+	if err := os.WriteFile(filepath.Join(cfg.ChariotConfig.DataPath, "app.yaml"), []byte(`# database settings
+defaults: &defaults
+  adapter: postgres # the driver
+  pool: 5
+development:
+  <<: *defaults
+  database: dev
+test:
+  <<: *defaults
+  database: test
+hosts: &hosts [a, b]
+mirror: *hosts
+greeting: !upper hello
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rt := createNamedRuntime("yaml_fidelity")
+	defer chariot.UnregisterRuntime("yaml_fidelity")
+	run := scriptRunner(t, rt)
+
+	run(`yamlRegisterTag('!upper', func(v, tag) { upper(v) }, func(v) { lower(v) })`)
+	config := run(`loadYAML('app.yaml')`).(*chariot.JSONNode)
+	data := config.GetJSONValue().(map[string]interface{})
+	if data["greeting"] != "HELLO" {
+		t.Fatalf("greeting = %v, want the decode handler's result", data["greeting"])
+	}
+	if dev := data["development"].(map[string]interface{}); dev["adapter"] != "postgres" || dev["database"] != "dev" {
+		t.Fatalf("development = %v, want the merged defaults", dev)
+	}
+
+	data["development"].(map[string]interface{})["pool"] = float64(10)
+	data["greeting"] = "WORLD"
+	config.SetJSONValue(data)
+	rt.SetVariable("config", config)
+	run(`saveYAML(config, 'app.yaml')`)
+
+	saved, err := os.ReadFile(filepath.Join(cfg.ChariotConfig.DataPath, "app.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(saved)
+	for _, want := range []string{"# database settings", "&defaults", "# the driver", "<<: *defaults", "mirror: *hosts", "pool: 10", "greeting: !upper world"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("saved YAML lacks %q:\n%s", want, text)
+		}
+	}
+	if strings.Count(text, "<<: *defaults") != 2 || strings.Contains(text, "!!merge") {
+		t.Fatalf("merge keys not kept as written:\n%s", text)
+	}
+}
+
+func TestYAMLValidate(t *testing.T) {
+	rt := createNamedRuntime("yaml_validate")
+	defer chariot.UnregisterRuntime("yaml_validate")
+
+	run := scriptRunner(t, rt)
+	rt.SetVariable("schema", chariot.Str(`
+type: object
+required: [name, port]
+properties:
+  name: {type: string, minLength: 1}
+  port: {type: integer, minimum: 1, maximum: 65535}
+  tags: {type: array, items: {type: string}}
+additionalProperties: false
+`))
+
+	result := run(`yamlValidate('{name: api, port: 8080, tags: [web]}', schema)`).(*chariot.MapValue)
+	if valid, _ := result.Get("valid"); valid != chariot.Bool(true) {
+		t.Fatalf("valid document rejected: %v", result)
+	}
+
+	rt.SetVariable("doc", chariot.Str("port: 70000\ntags: [web, 3]\ndebug: true\n"))
+	result = run(`yamlValidate(doc, schema)`).(*chariot.MapValue)
+	if valid, _ := result.Get("valid"); valid != chariot.Bool(false) {
+		t.Fatalf("invalid document accepted: %v", result)
+	}
+	errs, _ := result.Get("errors")
+	got := []string{}
+	for i := 0; i < errs.(*chariot.ArrayValue).Length(); i++ {
+		got = append(got, string(errs.(*chariot.ArrayValue).Get(i).(chariot.Str)))
+	}
+	want := []string{
+		`(document): missing required property "name"`,
+		`(document): property "debug" is not allowed`,
+		`port: must be at most 65535`,
+		`tags[1]: must be string, not integer`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("errors = %q, want %q", got, want)
+	}
+}
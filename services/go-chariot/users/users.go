@@ -0,0 +1,733 @@
+// Package users holds the accounts that may log in to the server: their
+// roles, whether they are disabled, a bcrypt hash of their password and
+// their optional TOTP second factor.
+//
+// While the store is empty logins are not checked, as before accounts
+// existed; once the first account is created only active accounts with the
+// right password, and code when they enrolled a second factor, may log in.
+package users
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Roles an account can hold. Admins manage accounts and other users'
+// sessions.
+const (
+	RoleAdmin       = "admin"
+	RoleContributor = "contributor"
+	RoleViewer      = "viewer"
+)
+
+// Roles lists the roles accounts may be given.
+var Roles = []string{RoleAdmin, RoleContributor, RoleViewer}
+
+const (
+	defaultMinPasswordLength = 8
+	maxPasswordLength        = 72 // bcrypt ignores the rest
+	generatedPasswordLength  = 16
+
+	// After maxCodeFailures wrong codes in a row an account's codes are
+	// refused for codeLockout, doubling with each further wrong code up to
+	// maxCodeLockout.
+	maxCodeFailures = 5
+	codeLockout     = 30 * time.Second
+	maxCodeLockout  = time.Hour
+)
+
+var (
+	// ErrNotFound is returned for an unknown user ID.
+	ErrNotFound = errors.New("user not found")
+	// ErrExists is returned when creating a user ID that is taken.
+	ErrExists = errors.New("user already exists")
+	// ErrInvalidCredentials is returned for an unknown user or a wrong
+	// password, without saying which.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrDisabled is returned when a disabled account tries to log in.
+	ErrDisabled = errors.New("account is disabled")
+	// ErrLastAdmin is returned when a change would leave no active admin.
+	ErrLastAdmin = errors.New("at least one active admin is required")
+	// ErrUnavailable is returned for changes to a store whose file could
+	// not be loaded.
+	ErrUnavailable = errors.New("account store is unavailable")
+	// ErrPasswordExpired is returned for a login with an expired password
+	// and no new one.
+	ErrPasswordExpired = errors.New("password has expired")
+	// ErrMFARequired is returned for a login without the one-time code the
+	// account requires.
+	ErrMFARequired = errors.New("one-time code required")
+	// ErrInvalidCode is returned for a wrong, used or expired one-time or
+	// recovery code.
+	ErrInvalidCode = errors.New("invalid one-time code")
+	// ErrNoEnrollment is returned when confirming a second factor that was
+	// not started.
+	ErrNoEnrollment = errors.New("no second factor enrollment in progress")
+	// ErrCodeLocked is returned, without checking the code, while an
+	// account's codes are refused after too many wrong ones.
+	ErrCodeLocked = errors.New("too many invalid one-time codes, try again later")
+)
+
+var userIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@+-]{0,63}$`)
+
+// User is an account. PasswordHash is never reported by the API.
+type User struct {
+	ID                string    `json:"user_id"`
+	DisplayName       string    `json:"display_name,omitempty"`
+	Email             string    `json:"email,omitempty"`
+	Roles             []string  `json:"roles"`
+	Disabled          bool      `json:"disabled"`
+	PasswordHash      string    `json:"password_hash,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	PasswordChangedAt time.Time `json:"password_changed_at"`
+	LastLoginAt       time.Time `json:"last_login_at,omitempty"`
+	MFAEnabled        bool      `json:"mfa_enabled"`
+	TOTPSecret        string    `json:"totp_secret,omitempty"`
+	PendingTOTPSecret string    `json:"pending_totp_secret,omitempty"`
+	LastTOTPStep      int64     `json:"last_totp_step,omitempty"` // codes up to this step are used
+	RecoveryCodes     []string  `json:"recovery_codes,omitempty"` // sha256 of the unused codes
+	CodeFailures      int       `json:"code_failures,omitempty"`  // wrong codes since the last right one
+	CodeLockedUntil   time.Time `json:"code_locked_until,omitempty"`
+}
+
+// HasRole reports whether the user holds role.
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Update changes the fields of an account that are set.
+type Update struct {
+	DisplayName *string   `json:"display_name,omitempty"`
+	Email       *string   `json:"email,omitempty"`
+	Roles       *[]string `json:"roles,omitempty"`
+	Disabled    *bool     `json:"disabled,omitempty"`
+}
+
+// Policy is what passwords must satisfy.
+type Policy struct {
+	MinLength  int           // characters; below 8 means 8
+	MinClasses int           // of lowercase, uppercase, digits and symbols
+	MaxAge     time.Duration // after which the password must be changed at login; 0 never
+}
+
+// Credentials is a login attempt.
+type Credentials struct {
+	ID          string
+	Password    string
+	Code        string // one-time or recovery code, for accounts with a second factor
+	NewPassword string // replaces an expired password
+}
+
+// registry is the persisted form of the accounts.
+type registry struct {
+	Version int    `json:"version"`
+	Users   []User `json:"users"`
+}
+
+// Store holds the accounts, persisted to a JSON file.
+type Store struct {
+	file   string
+	locked bool // the file could not be loaded
+	mu     sync.RWMutex
+	users  map[string]*User
+	policy Policy
+}
+
+// Open loads the accounts in file, if it exists; "" keeps them in memory. A
+// file that cannot be loaded is reported along with a store that refuses
+// every login and change, so a broken file never opens the server.
+func Open(file string) (*Store, error) {
+	s := &Store{file: file, users: map[string]*User{}}
+	if file == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		s.locked = true
+		return s, err
+	}
+	var reg registry
+	if err := json.Unmarshal(data, &reg); err != nil {
+		s.locked = true
+		return s, fmt.Errorf("%s: %w", file, err)
+	}
+	for i := range reg.Users {
+		u := reg.Users[i]
+		s.users[u.ID] = &u
+	}
+	return s, nil
+}
+
+// SetPolicy sets what new passwords must satisfy and when they expire.
+func (s *Store) SetPolicy(p Policy) {
+	if p.MinLength < defaultMinPasswordLength {
+		p.MinLength = defaultMinPasswordLength
+	}
+	s.mu.Lock()
+	s.policy = p
+	s.mu.Unlock()
+}
+
+// Policy returns the password policy.
+func (s *Store) Policy() Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p := s.policy
+	if p.MinLength < defaultMinPasswordLength {
+		p.MinLength = defaultMinPasswordLength
+	}
+	return p
+}
+
+// PasswordExpiresAt returns when u's password expires, or zero when
+// passwords do not expire.
+func (s *Store) PasswordExpiresAt(u User) time.Time {
+	if age := s.Policy().MaxAge; age > 0 {
+		return u.PasswordChangedAt.Add(age)
+	}
+	return time.Time{}
+}
+
+func (s *Store) saveLocked() error {
+	if s.locked {
+		return ErrUnavailable
+	}
+	if s.file == "" {
+		return nil
+	}
+	reg := registry{Version: 1, Users: make([]User, 0, len(s.users))}
+	for _, u := range s.users {
+		reg.Users = append(reg.Users, *u)
+	}
+	sort.Slice(reg.Users, func(i, j int) bool { return reg.Users[i].ID < reg.Users[j].ID })
+	data, err := json.MarshalIndent(reg, "", "  ")
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(filepath.Dir(s.file), 0o755)
+	// The file holds password hashes
+	return os.WriteFile(s.file, data, 0o600)
+}
+
+// Enabled reports whether logins are checked: accounts exist, or the file
+// could not be loaded.
+func (s *Store) Enabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.locked || len(s.users) > 0
+}
+
+// HasAdmin reports whether an active account holds the admin role.
+func (s *Store) HasAdmin() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.activeAdminsLocked("") > 0
+}
+
+// activeAdminsLocked counts the active admins other than except.
+func (s *Store) activeAdminsLocked(except string) int {
+	n := 0
+	for id, u := range s.users {
+		if id != except && !u.Disabled && u.HasRole(RoleAdmin) {
+			n++
+		}
+	}
+	return n
+}
+
+// List returns the accounts by user ID, without password hashes.
+func (s *Store) List() []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		out = append(out, public(u))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Get returns an account without its password hash.
+func (s *Store) Get(id string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return public(u), nil
+}
+
+// Create adds an account with password. The first account must be an admin,
+// so someone can manage the others once logins are checked.
+func (s *Store) Create(u User, password string) (User, error) {
+	if !userIDPattern.MatchString(u.ID) {
+		return User{}, fmt.Errorf("user_id must be 1-64 letters, digits or . _ @ + -, starting with a letter or digit")
+	}
+	if err := validateRoles(u.Roles); err != nil {
+		return User{}, err
+	}
+	hash, err := s.hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	now := time.Now().UTC()
+	u.PasswordHash = string(hash)
+	u.CreatedAt, u.UpdatedAt, u.PasswordChangedAt = now, now, now
+	u.LastLoginAt = time.Time{}
+	u.MFAEnabled, u.TOTPSecret, u.PendingTOTPSecret, u.LastTOTPStep, u.RecoveryCodes = false, "", "", 0, nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[u.ID]; ok {
+		return User{}, ErrExists
+	}
+	if len(s.users) == 0 && (u.Disabled || !u.HasRole(RoleAdmin)) {
+		return User{}, fmt.Errorf("the first account must be an active admin")
+	}
+	s.users[u.ID] = &u
+	if err := s.saveLocked(); err != nil {
+		delete(s.users, u.ID)
+		return User{}, err
+	}
+	return public(&u), nil
+}
+
+// Update changes an account's profile, roles or disabled state. The last
+// active admin cannot be disabled or lose the admin role.
+func (s *Store) Update(id string, upd Update) (User, error) {
+	if upd.Roles != nil {
+		if err := validateRoles(*upd.Roles); err != nil {
+			return User{}, err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	u := *old
+	if upd.DisplayName != nil {
+		u.DisplayName = *upd.DisplayName
+	}
+	if upd.Email != nil {
+		u.Email = *upd.Email
+	}
+	if upd.Roles != nil {
+		u.Roles = append([]string(nil), *upd.Roles...)
+	}
+	if upd.Disabled != nil {
+		u.Disabled = *upd.Disabled
+	}
+	if !old.Disabled && old.HasRole(RoleAdmin) && (u.Disabled || !u.HasRole(RoleAdmin)) && s.activeAdminsLocked(id) == 0 {
+		return User{}, ErrLastAdmin
+	}
+	u.UpdatedAt = time.Now().UTC()
+	s.users[id] = &u
+	if err := s.saveLocked(); err != nil {
+		s.users[id] = old
+		return User{}, err
+	}
+	return public(&u), nil
+}
+
+// SetPassword replaces an account's password. An empty password generates
+// one, which is returned; otherwise the result is empty.
+func (s *Store) SetPassword(id, password string) (string, error) {
+	generated := ""
+	if password == "" {
+		generated = s.GeneratePassword()
+		password = generated
+	}
+	hash, err := s.hashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.users[id]
+	if !ok {
+		return "", ErrNotFound
+	}
+	u := *old
+	u.PasswordHash = string(hash)
+	u.PasswordChangedAt = time.Now().UTC()
+	u.UpdatedAt = u.PasswordChangedAt
+	s.users[id] = &u
+	if err := s.saveLocked(); err != nil {
+		s.users[id] = old
+		return "", err
+	}
+	return generated, nil
+}
+
+// Delete removes an account. The last active admin cannot be removed while
+// other accounts remain.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if len(s.users) > 1 && !old.Disabled && old.HasRole(RoleAdmin) && s.activeAdminsLocked(id) == 0 {
+		return ErrLastAdmin
+	}
+	delete(s.users, id)
+	if err := s.saveLocked(); err != nil {
+		s.users[id] = old
+		return err
+	}
+	return nil
+}
+
+// Login checks a login attempt and records it. A password past the
+// policy's maximum age must be replaced with NewPassword, and accounts with a
+// second factor must give a one-time or recovery code; ErrPasswordExpired and
+// ErrMFARequired ask for them.
+func (s *Store) Login(c Credentials) (User, error) {
+	s.mu.RLock()
+	u, ok := s.users[c.ID]
+	var hash []byte
+	if ok {
+		hash = []byte(u.PasswordHash)
+	}
+	s.mu.RUnlock()
+	if !ok {
+		// Spend the same time as for a wrong password
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(c.Password))
+		return User{}, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(c.Password)) != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	var newHash []byte
+	if c.NewPassword != "" {
+		if c.NewPassword == c.Password {
+			return User{}, fmt.Errorf("the new password must differ from the current one")
+		}
+		var err error
+		if newHash, err = s.hashPassword(c.NewPassword); err != nil {
+			return User{}, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.users[c.ID]
+	if !ok {
+		return User{}, ErrInvalidCredentials
+	}
+	if old.Disabled {
+		return User{}, ErrDisabled
+	}
+	now := time.Now().UTC()
+	expired := s.policy.MaxAge > 0 && now.After(old.PasswordChangedAt.Add(s.policy.MaxAge))
+	if expired && newHash == nil {
+		return User{}, ErrPasswordExpired
+	}
+	nu := *old
+	if nu.MFAEnabled {
+		if c.Code == "" {
+			return User{}, ErrMFARequired
+		}
+		if err := s.checkCodeLocked(&nu, c.Code, now); err != nil {
+			return User{}, err
+		}
+	}
+	if expired {
+		nu.PasswordHash = string(newHash)
+		nu.PasswordChangedAt = now
+		nu.UpdatedAt = now
+	}
+	nu.LastLoginAt = now
+	s.users[c.ID] = &nu
+	// Only the login time may be lost: a used code must stay used
+	if err := s.saveLocked(); err != nil && (expired || nu.MFAEnabled) {
+		s.users[c.ID] = old
+		return User{}, err
+	}
+	return public(&nu), nil
+}
+
+// ChangePassword replaces an account's password after checking the current
+// one.
+func (s *Store) ChangePassword(id, current, password string) error {
+	s.mu.RLock()
+	u, ok := s.users[id]
+	var hash []byte
+	if ok {
+		hash = []byte(u.PasswordHash)
+	}
+	s.mu.RUnlock()
+	if !ok || bcrypt.CompareHashAndPassword(hash, []byte(current)) != nil {
+		return ErrInvalidCredentials
+	}
+	if password == current {
+		return fmt.Errorf("the new password must differ from the current one")
+	}
+	newHash, err := s.hashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = s.modify(id, func(u *User) error {
+		u.PasswordHash = string(newHash)
+		u.PasswordChangedAt = time.Now().UTC()
+		u.UpdatedAt = u.PasswordChangedAt
+		return nil
+	})
+	return err
+}
+
+// BeginTOTP starts enrolling a second factor and returns its secret. Logins
+// do not ask for codes until ConfirmTOTP; enrolling again replaces the
+// secret.
+func (s *Store) BeginTOTP(id string) (string, error) {
+	secret := NewTOTPSecret()
+	_, err := s.modify(id, func(u *User) error {
+		u.PendingTOTPSecret = secret
+		return nil
+	})
+	return secret, err
+}
+
+// PendingTOTP returns the secret of the enrollment in progress.
+func (s *Store) PendingTOTP(id string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[id]
+	if !ok {
+		return "", ErrNotFound
+	}
+	if u.PendingTOTPSecret == "" {
+		return "", ErrNoEnrollment
+	}
+	return u.PendingTOTPSecret, nil
+}
+
+// ConfirmTOTP completes the enrollment with a code from the authenticator
+// and returns recovery codes, each usable once in place of a code. They are
+// not kept and cannot be shown again.
+func (s *Store) ConfirmTOTP(id, code string) ([]string, error) {
+	codes, hashes := newRecoveryCodes()
+	_, err := s.modify(id, func(u *User) error {
+		if u.PendingTOTPSecret == "" {
+			return ErrNoEnrollment
+		}
+		step, ok := totpStep(u.PendingTOTPSecret, code, time.Now())
+		if !ok {
+			return ErrInvalidCode
+		}
+		u.MFAEnabled = true
+		u.TOTPSecret, u.PendingTOTPSecret = u.PendingTOTPSecret, ""
+		u.LastTOTPStep = step
+		u.RecoveryCodes = hashes
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP removes an account's second factor after checking a one-time
+// or recovery code.
+func (s *Store) DisableTOTP(id, code string) error {
+	_, err := s.modify(id, func(u *User) error {
+		if !u.MFAEnabled {
+			return ErrInvalidCode
+		}
+		if err := s.checkCodeLocked(u, code, time.Now().UTC()); err != nil {
+			return err
+		}
+		clearTOTP(u)
+		return nil
+	})
+	return err
+}
+
+// ResetTOTP removes an account's second factor without a code, for admins
+// helping users who lost their authenticator and recovery codes.
+func (s *Store) ResetTOTP(id string) (User, error) {
+	return s.modify(id, func(u *User) error {
+		clearTOTP(u)
+		return nil
+	})
+}
+
+// modify applies fn to a copy of an account and saves it, keeping the
+// account as it was when fn or the save fails.
+func (s *Store) modify(id string, fn func(u *User) error) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	u := *old
+	if err := fn(&u); err != nil {
+		return User{}, err
+	}
+	u.UpdatedAt = time.Now().UTC()
+	s.users[id] = &u
+	if err := s.saveLocked(); err != nil {
+		s.users[id] = old
+		return User{}, err
+	}
+	return public(&u), nil
+}
+
+// checkCodeLocked checks a code for u, a copy of a stored account being
+// changed, unless its codes are refused for now. A wrong code is counted on
+// the stored account, and kept in memory when it cannot be saved, since the
+// caller abandons the change.
+func (s *Store) checkCodeLocked(u *User, code string, now time.Time) error {
+	if now.Before(u.CodeLockedUntil) {
+		return ErrCodeLocked
+	}
+	if useCode(u, code, now) {
+		u.CodeFailures, u.CodeLockedUntil = 0, time.Time{}
+		return nil
+	}
+	failed := *u
+	failed.CodeFailures++
+	if n := failed.CodeFailures - maxCodeFailures; n >= 0 {
+		lockout := maxCodeLockout
+		if n < 16 && codeLockout<<uint(n) < maxCodeLockout {
+			lockout = codeLockout << uint(n)
+		}
+		failed.CodeLockedUntil = now.Add(lockout)
+	}
+	s.users[u.ID] = &failed
+	_ = s.saveLocked()
+	return ErrInvalidCode
+}
+
+// useCode checks a one-time code, which must be newer than the last one
+// used, or consumes a recovery code.
+func useCode(u *User, code string, now time.Time) bool {
+	code = strings.TrimSpace(code)
+	if step, ok := totpStep(u.TOTPSecret, code, now); ok && step > u.LastTOTPStep {
+		u.LastTOTPStep = step
+		return true
+	}
+	h := hashRecoveryCode(code)
+	for i, rc := range u.RecoveryCodes {
+		if rc == h {
+			u.RecoveryCodes = append(u.RecoveryCodes[:i:i], u.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func clearTOTP(u *User) {
+	u.MFAEnabled = false
+	u.TOTPSecret, u.PendingTOTPSecret = "", ""
+	u.LastTOTPStep = 0
+	u.RecoveryCodes = nil
+	u.CodeFailures, u.CodeLockedUntil = 0, time.Time{}
+}
+
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("chariot"), bcrypt.DefaultCost)
+
+// hashPassword checks password against the policy and hashes it.
+func (s *Store) hashPassword(password string) ([]byte, error) {
+	p := s.Policy()
+	if len(password) < p.MinLength {
+		return nil, fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+	if len(password) > maxPasswordLength {
+		return nil, fmt.Errorf("password must be at most %d bytes", maxPasswordLength)
+	}
+	if n := passwordClasses(password); n < p.MinClasses {
+		return nil, fmt.Errorf("password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinClasses)
+	}
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// passwordClasses counts the kinds of characters in password: lowercase,
+// uppercase, digits and anything else.
+func passwordClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+func validateRoles(roles []string) error {
+	for _, r := range roles {
+		known := false
+		for _, k := range Roles {
+			known = known || r == k
+		}
+		if !known {
+			return fmt.Errorf("unknown role %q: use %s", r, strings.Join(Roles, ", "))
+		}
+	}
+	return nil
+}
+
+// public returns a copy of u without its password hash and second factor
+// secrets.
+func public(u *User) User {
+	c := *u
+	c.PasswordHash = ""
+	c.Roles = append([]string{}, u.Roles...)
+	c.TOTPSecret, c.PendingTOTPSecret, c.LastTOTPStep, c.RecoveryCodes = "", "", 0, nil
+	return c
+}
+
+const passwordAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789-_.!@#%"
+
+// GeneratePassword returns a random password that satisfies the policy: 16
+// characters, or the minimum length when longer, of every class.
+func (s *Store) GeneratePassword() string {
+	n := generatedPasswordLength
+	if l := s.Policy().MinLength; l > n && l <= maxPasswordLength {
+		n = l
+	}
+	b := make([]byte, n)
+	for {
+		for i := range b {
+			k, _ := rand.Int(rand.Reader, big.NewInt(int64(len(passwordAlphabet))))
+			b[i] = passwordAlphabet[k.Int64()]
+		}
+		if passwordClasses(string(b)) == 4 {
+			return string(b)
+		}
+	}
+}
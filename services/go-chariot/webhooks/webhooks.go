@@ -0,0 +1,558 @@
+// Package webhooks delivers Chariot events to external HTTP endpoints, so
+// systems such as Slack or PagerDuty bridges can react to executions,
+// listeners and agents without polling the API.
+//
+// Each subscription names a URL and the event types it wants. An event is
+// POSTed as JSON with these headers:
+//
+//	X-Chariot-Event      the event type, e.g. execution.failed
+//	X-Chariot-Delivery   the event ID, the same for every retry
+//	X-Chariot-Timestamp  Unix seconds when the request was signed
+//	X-Chariot-Signature  sha256=<hex HMAC-SHA256 of "<timestamp>.<body>">
+//
+// The HMAC key is the subscription's secret. Receivers should recompute the
+// signature and reject old timestamps to guard against replays.
+//
+// A delivery that fails with a network error, 408, 429 or a 5xx status is
+// retried with exponential backoff; other statuses fail it at once. Recent
+// attempts are kept in memory as the delivery log, and a delivery that gave
+// up is handed to the OnGiveUp function, which may keep it for Redeliver.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	cfg "github.com/bhouse1273/chariot-ecosystem/services/go-chariot/configs"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Event types a subscription can name. "*" subscribes to all of them.
+const (
+	ExecutionFinished = "execution.finished"
+	ExecutionFailed   = "execution.failed"
+	ListenerUnhealthy = "listener.unhealthy"
+	AgentStopped      = "agent.stopped"
+	Ping              = "ping" // sent by Dispatcher.Ping only
+)
+
+// EventTypes lists the event types subscriptions may name.
+var EventTypes = []string{ExecutionFinished, ExecutionFailed, ListenerUnhealthy, AgentStopped}
+
+const (
+	defaultMaxAttempts = 5
+	defaultTimeout     = 10 * time.Second
+	defaultBackoff     = 2 * time.Second
+	maxBackoff         = 5 * time.Minute
+	maxDeliveryLog     = 1000
+	queueSize          = 256
+	workers            = 4
+)
+
+// ErrNotFound is returned for an unknown subscription ID.
+var ErrNotFound = errors.New("webhook not found")
+
+// Event is the JSON body of a webhook request.
+type Event struct {
+	ID   string                 `json:"id"`
+	Type string                 `json:"type"`
+	Time time.Time              `json:"time"`
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// Subscription is a URL and the event types delivered to it.
+type Subscription struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Secret      string    `json:"secret,omitempty"` // HMAC key; only returned when the subscription is created
+	Description string    `json:"description,omitempty"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (s *Subscription) wants(eventType string) bool {
+	if !s.Active {
+		return false
+	}
+	for _, e := range s.Events {
+		if e == "*" || e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is one attempt to deliver an event to a subscription.
+type Delivery struct {
+	Subscription string    `json:"subscription"`
+	Event        string    `json:"event"` // event ID
+	EventType    string    `json:"event_type"`
+	Attempt      int       `json:"attempt"`
+	Status       int       `json:"status,omitempty"` // HTTP status, 0 when no response was received
+	Error        string    `json:"error,omitempty"`
+	Success      bool      `json:"success"`
+	Retry        bool      `json:"retry,omitempty"` // another attempt is scheduled
+	Time         time.Time `json:"time"`
+	DurationMs   int64     `json:"duration_ms"`
+}
+
+// Options configures a Dispatcher. Zero values select the defaults.
+type Options struct {
+	File        string        // JSON file subscriptions are persisted to; "" keeps them in memory
+	MaxAttempts int           // attempts per event and subscription (default 5)
+	Timeout     time.Duration // per request (default 10s)
+	Backoff     time.Duration // delay before the first retry, doubled for each further one (default 2s)
+	Client      *http.Client
+}
+
+// registry is the persisted form of the subscriptions.
+type registry struct {
+	Version       int            `json:"version"`
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+type job struct {
+	sub     Subscription
+	event   Event
+	body    []byte
+	attempt int
+	// done is told the outcome of a redelivery instead of OnGiveUp
+	done func(attempts int, err error)
+}
+
+// Dispatcher holds the subscriptions and delivers events to them in the
+// background.
+type Dispatcher struct {
+	opts   Options
+	client *http.Client
+
+	mu   sync.RWMutex
+	subs map[string]*Subscription
+
+	logMu sync.Mutex
+	log   []Delivery // oldest first, at most maxDeliveryLog
+
+	onGiveUp func(sub Subscription, ev Event, attempts int, err error)
+
+	queue     chan job
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// New loads the subscriptions in opts.File, if it exists, and starts the
+// delivery workers.
+func New(opts Options) (*Dispatcher, error) {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = defaultBackoff
+	}
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: opts.Timeout}
+	}
+	d := &Dispatcher{
+		opts:   opts,
+		client: client,
+		subs:   map[string]*Subscription{},
+		queue:  make(chan job, queueSize),
+		done:   make(chan struct{}),
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+	return d, nil
+}
+
+func (d *Dispatcher) load() error {
+	if d.opts.File == "" {
+		return nil
+	}
+	data, err := os.ReadFile(d.opts.File)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var reg registry
+	if err := json.Unmarshal(data, &reg); err != nil {
+		return fmt.Errorf("%s: %w", d.opts.File, err)
+	}
+	for i := range reg.Subscriptions {
+		s := reg.Subscriptions[i]
+		d.subs[s.ID] = &s
+	}
+	return nil
+}
+
+func (d *Dispatcher) saveLocked() error {
+	if d.opts.File == "" {
+		return nil
+	}
+	reg := registry{Version: 1, Subscriptions: make([]Subscription, 0, len(d.subs))}
+	for _, s := range d.subs {
+		reg.Subscriptions = append(reg.Subscriptions, *s)
+	}
+	sort.Slice(reg.Subscriptions, func(i, j int) bool { return reg.Subscriptions[i].CreatedAt.Before(reg.Subscriptions[j].CreatedAt) })
+	data, err := json.MarshalIndent(reg, "", "  ")
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(filepath.Dir(d.opts.File), 0o755)
+	// The file holds signing secrets
+	return os.WriteFile(d.opts.File, data, 0o600)
+}
+
+// List returns the subscriptions, oldest first, without their secrets.
+func (d *Dispatcher) List() []Subscription {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	out := make([]Subscription, 0, len(d.subs))
+	for _, s := range d.subs {
+		c := *s
+		c.Secret = ""
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Create validates and stores a subscription. A secret is generated when s
+// has none; the returned subscription is the only place it is reported.
+func (d *Dispatcher) Create(s Subscription) (Subscription, error) {
+	if err := validate(&s); err != nil {
+		return Subscription{}, err
+	}
+	if s.Secret == "" {
+		s.Secret = newSecret()
+	}
+	s.ID = uuid.New().String()
+	s.CreatedAt = time.Now().UTC()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subs[s.ID] = &s
+	if err := d.saveLocked(); err != nil {
+		delete(d.subs, s.ID)
+		return Subscription{}, err
+	}
+	return s, nil
+}
+
+// Update replaces the URL, events, description and active state of a
+// subscription. The secret is kept unless s sets a new one.
+func (d *Dispatcher) Update(id string, s Subscription) (Subscription, error) {
+	if err := validate(&s); err != nil {
+		return Subscription{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	old, ok := d.subs[id]
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+	s.ID, s.CreatedAt = old.ID, old.CreatedAt
+	if s.Secret == "" {
+		s.Secret = old.Secret
+	}
+	d.subs[id] = &s
+	if err := d.saveLocked(); err != nil {
+		d.subs[id] = old
+		return Subscription{}, err
+	}
+	s.Secret = ""
+	return s, nil
+}
+
+// Delete removes a subscription. Deliveries already queued still run.
+func (d *Dispatcher) Delete(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	old, ok := d.subs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(d.subs, id)
+	if err := d.saveLocked(); err != nil {
+		d.subs[id] = old
+		return err
+	}
+	return nil
+}
+
+func validate(s *Subscription) error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if len(s.Events) == 0 {
+		return fmt.Errorf("events must name at least one event type")
+	}
+	for _, e := range s.Events {
+		if e == "*" {
+			continue
+		}
+		known := false
+		for _, t := range EventTypes {
+			known = known || e == t
+		}
+		if !known {
+			return fmt.Errorf("unknown event type %q", e)
+		}
+	}
+	return nil
+}
+
+func newSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Sign returns the X-Chariot-Signature value for a body sent at timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify sends an event to every active subscription that wants it. It does
+// not block: when the delivery queue is full the event is dropped and logged.
+func (d *Dispatcher) Notify(eventType string, data map[string]interface{}) {
+	if d == nil {
+		return
+	}
+	d.mu.RLock()
+	var targets []Subscription
+	for _, s := range d.subs {
+		if s.wants(eventType) {
+			targets = append(targets, *s)
+		}
+	}
+	d.mu.RUnlock()
+	if len(targets) == 0 {
+		return
+	}
+	ev := Event{ID: uuid.New().String(), Type: eventType, Time: time.Now().UTC(), Data: data}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		cfg.ChariotLogger.Warn("Webhook event not serializable", zap.String("event", eventType), zap.Error(err))
+		return
+	}
+	for _, s := range targets {
+		d.enqueue(job{sub: s, event: ev, body: body, attempt: 1})
+	}
+}
+
+// Ping sends a ping event to one subscription, whatever events it names,
+// and returns the event ID to look for in its delivery log.
+func (d *Dispatcher) Ping(id string) (string, error) {
+	d.mu.RLock()
+	s, ok := d.subs[id]
+	var sub Subscription
+	if ok {
+		sub = *s
+	}
+	d.mu.RUnlock()
+	if !ok {
+		return "", ErrNotFound
+	}
+	ev := Event{ID: uuid.New().String(), Type: Ping, Time: time.Now().UTC(), Data: map[string]interface{}{"subscription": id}}
+	body, _ := json.Marshal(ev)
+	d.enqueue(job{sub: sub, event: ev, body: body, attempt: 1})
+	return ev.ID, nil
+}
+
+// OnGiveUp sets a function called, with the subscription's secret removed,
+// for each delivery that failed for good. Set it before events are sent.
+func (d *Dispatcher) OnGiveUp(fn func(sub Subscription, ev Event, attempts int, err error)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onGiveUp = fn
+}
+
+// Redeliver sends an event that gave up to its subscription again, with the
+// same ID so receivers can tell it from a new event. done is called once
+// the delivery succeeds or gives up again, with the attempts it made.
+func (d *Dispatcher) Redeliver(id string, ev Event, done func(attempts int, err error)) error {
+	d.mu.RLock()
+	s, ok := d.subs[id]
+	var sub Subscription
+	if ok {
+		sub = *s
+	}
+	d.mu.RUnlock()
+	if !ok {
+		return ErrNotFound
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	d.enqueue(job{sub: sub, event: ev, body: body, attempt: 1, done: done})
+	return nil
+}
+
+func (d *Dispatcher) enqueue(j job) {
+	select {
+	case <-d.done:
+	case d.queue <- j:
+	default:
+		cfg.ChariotLogger.Warn("Webhook queue full; event dropped",
+			zap.String("subscription", j.sub.ID), zap.String("event", j.event.Type))
+	}
+}
+
+func (d *Dispatcher) worker() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.done:
+			return
+		case j := <-d.queue:
+			d.deliver(j)
+		}
+	}
+}
+
+// deliver makes one attempt and schedules the next one if it may succeed.
+func (d *Dispatcher) deliver(j job) {
+	start := time.Now()
+	status, err := d.post(j)
+	rec := Delivery{
+		Subscription: j.sub.ID,
+		Event:        j.event.ID,
+		EventType:    j.event.Type,
+		Attempt:      j.attempt,
+		Status:       status,
+		Time:         start.UTC(),
+		DurationMs:   time.Since(start).Milliseconds(),
+	}
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		rec.Success = true
+	case err != nil:
+		rec.Error = err.Error()
+		rec.Retry = true
+	default:
+		rec.Error = http.StatusText(status)
+		rec.Retry = status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+	}
+	if rec.Retry && j.attempt >= d.opts.MaxAttempts {
+		rec.Retry = false
+	}
+	d.record(rec)
+
+	if rec.Retry {
+		delay := d.opts.Backoff << (j.attempt - 1)
+		if delay <= 0 || delay > maxBackoff {
+			delay = maxBackoff
+		}
+		j.attempt++
+		time.AfterFunc(delay, func() { d.enqueue(j) })
+	} else if !rec.Success {
+		cfg.ChariotLogger.Warn("Webhook delivery failed",
+			zap.String("subscription", j.sub.ID),
+			zap.String("url", j.sub.URL),
+			zap.String("event", j.event.Type),
+			zap.Int("attempts", j.attempt),
+			zap.String("error", rec.Error))
+		reason := errors.New(rec.Error)
+		if rec.Status != 0 {
+			reason = fmt.Errorf("status %d %s", rec.Status, rec.Error)
+		}
+		d.gaveUp(j, reason)
+	} else if j.done != nil {
+		j.done(j.attempt, nil)
+	}
+}
+
+// gaveUp reports a delivery that failed for good.
+func (d *Dispatcher) gaveUp(j job, err error) {
+	if j.done != nil {
+		j.done(j.attempt, err)
+		return
+	}
+	d.mu.RLock()
+	fn := d.onGiveUp
+	d.mu.RUnlock()
+	if fn != nil {
+		sub := j.sub
+		sub.Secret = ""
+		fn(sub, j.event, j.attempt, err)
+	}
+}
+
+func (d *Dispatcher) post(j job) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, j.sub.URL, bytes.NewReader(j.body))
+	if err != nil {
+		return 0, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "chariot-webhooks/1")
+	req.Header.Set("X-Chariot-Event", j.event.Type)
+	req.Header.Set("X-Chariot-Delivery", j.event.ID)
+	req.Header.Set("X-Chariot-Timestamp", fmt.Sprint(ts))
+	req.Header.Set("X-Chariot-Signature", Sign(j.sub.Secret, ts, j.body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) record(rec Delivery) {
+	d.logMu.Lock()
+	defer d.logMu.Unlock()
+	if len(d.log) >= maxDeliveryLog {
+		d.log = append(d.log[:0], d.log[len(d.log)-maxDeliveryLog+1:]...)
+	}
+	d.log = append(d.log, rec)
+}
+
+// Deliveries returns up to limit recent delivery attempts for a subscription,
+// or for all subscriptions when id is empty, newest first.
+func (d *Dispatcher) Deliveries(id string, limit int) []Delivery {
+	d.logMu.Lock()
+	defer d.logMu.Unlock()
+	out := []Delivery{}
+	for i := len(d.log) - 1; i >= 0 && (limit <= 0 || len(out) < limit); i-- {
+		if id == "" || d.log[i].Subscription == id {
+			out = append(out, d.log[i])
+		}
+	}
+	return out
+}
+
+// Close stops the workers. Queued deliveries and pending retries are dropped.
+func (d *Dispatcher) Close() {
+	d.closeOnce.Do(func() { close(d.done) })
+	d.wg.Wait()
+}
@@ -0,0 +1,373 @@
+// Package workspace packs a Chariot environment - files, diagrams, function
+// library and listener definitions - into a zip archive and unpacks it again.
+//
+// Archive layout:
+//
+//	manifest.json
+//	files/<name>
+//	diagrams/<name>.json
+//	functions/<name>.json   (function library entry, serialized form)
+//	listeners/<name>.json   (listener definition)
+//
+// Files and diagrams are read from and written to directories. Functions and
+// listeners are exchanged as JSON maps so the caller decides how they are stored.
+package workspace
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format and Version identify archives written by Export.
+const (
+	Format  = "chariot-workspace"
+	Version = 1
+)
+
+// MaxEntrySize bounds the uncompressed size of a single archive entry on import.
+const MaxEntrySize = 64 << 20
+
+// Entry kinds, also the archive directory of each kind.
+const (
+	KindFile     = "file"
+	KindDiagram  = "diagram"
+	KindFunction = "function"
+	KindListener = "listener"
+)
+
+var kindDirs = map[string]string{
+	"files":     KindFile,
+	"diagrams":  KindDiagram,
+	"functions": KindFunction,
+	"listeners": KindListener,
+}
+
+// Policy says what Import does with an entry whose name already exists.
+type Policy string
+
+const (
+	PolicySkip      Policy = "skip"      // keep the existing entry
+	PolicyOverwrite Policy = "overwrite" // replace the existing entry
+	PolicyRename    Policy = "rename"    // import under a free name (name_2, name_3, ...)
+	PolicyFail      Policy = "fail"      // import nothing if any entry conflicts
+)
+
+// ErrConflict is returned by Import under PolicyFail when entries conflict.
+var ErrConflict = errors.New("workspace entries conflict with existing ones")
+
+// ParsePolicy parses a conflict policy; the empty string means PolicySkip.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return PolicySkip, nil
+	case PolicySkip, PolicyOverwrite, PolicyRename, PolicyFail:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q (want skip, overwrite, rename or fail)", s)
+}
+
+// Manifest describes an archive's contents.
+type Manifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	Exported  time.Time `json:"exported"`
+	Scope     string    `json:"scope,omitempty"`
+	Files     []string  `json:"files"`
+	Diagrams  []string  `json:"diagrams"`
+	Functions []string  `json:"functions"`
+	Listeners []string  `json:"listeners"`
+}
+
+// Workspace locates the parts of an environment. Functions and Listeners map
+// names to their JSON definitions; Import adds to them in place.
+type Workspace struct {
+	FilesDir    string
+	DiagramsDir string
+	Functions   map[string]json.RawMessage
+	Listeners   map[string]json.RawMessage
+}
+
+// Export writes the workspace to w as a zip archive.
+func Export(w io.Writer, ws Workspace, scope string) (*Manifest, error) {
+	m := &Manifest{Format: Format, Version: Version, Exported: time.Now().UTC(), Scope: scope}
+	zw := zip.NewWriter(w)
+
+	var err error
+	if m.Files, err = exportDir(zw, "files", ws.FilesDir, ""); err != nil {
+		return nil, err
+	}
+	if m.Diagrams, err = exportDir(zw, "diagrams", ws.DiagramsDir, ".json"); err != nil {
+		return nil, err
+	}
+	if m.Functions, err = exportDefs(zw, "functions", ws.Functions); err != nil {
+		return nil, err
+	}
+	if m.Listeners, err = exportDefs(zw, "listeners", ws.Listeners); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(zw, "manifest.json", data); err != nil {
+		return nil, err
+	}
+	return m, zw.Close()
+}
+
+func exportDir(zw *zip.Writer, dir, src, ext string) ([]string, error) {
+	names := make([]string, 0)
+	if src == "" {
+		return names, nil
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return names, nil
+		}
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || (ext != "" && filepath.Ext(e.Name()) != ext) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(src, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if err := writeEntry(zw, dir+"/"+e.Name(), data); err != nil {
+			return nil, err
+		}
+		names = append(names, strings.TrimSuffix(e.Name(), ext))
+	}
+	return names, nil
+}
+
+func exportDefs(zw *zip.Writer, dir string, defs map[string]json.RawMessage) ([]string, error) {
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := writeEntry(zw, dir+"/"+name+".json", defs[name]); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+func writeEntry(zw *zip.Writer, name string, data []byte) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// Item is one imported, skipped, renamed, conflicting or failed entry.
+type Item struct {
+	Kind  string `json:"kind"`
+	Name  string `json:"name"`
+	As    string `json:"as,omitempty"`    // name it was imported under, when renamed
+	Error string `json:"error,omitempty"` // why it failed
+}
+
+// Report is the outcome of an Import.
+type Report struct {
+	Policy    Policy `json:"policy"`
+	Imported  []Item `json:"imported"`
+	Skipped   []Item `json:"skipped"`
+	Conflicts []Item `json:"conflicts,omitempty"`
+	Failed    []Item `json:"failed,omitempty"`
+}
+
+type archiveEntry struct {
+	kind string
+	name string // file name for files, bare name otherwise
+	file *zip.File
+}
+
+// Import unpacks an archive into the workspace, resolving name clashes by
+// policy. Under PolicyFail nothing is written when any entry conflicts, and
+// the report lists the conflicts alongside ErrConflict.
+func Import(zr *zip.Reader, ws Workspace, policy Policy) (*Report, error) {
+	entries, err := readArchive(zr)
+	if err != nil {
+		return nil, err
+	}
+	rep := &Report{Policy: policy, Imported: []Item{}, Skipped: []Item{}}
+
+	if policy == PolicyFail {
+		for _, e := range entries {
+			if exists(ws, e.kind, e.name) {
+				rep.Conflicts = append(rep.Conflicts, Item{Kind: e.kind, Name: e.name})
+			}
+		}
+		if len(rep.Conflicts) > 0 {
+			return rep, ErrConflict
+		}
+	}
+
+	for _, e := range entries {
+		target := e.name
+		if exists(ws, e.kind, target) {
+			switch policy {
+			case PolicySkip:
+				rep.Skipped = append(rep.Skipped, Item{Kind: e.kind, Name: e.name})
+				continue
+			case PolicyRename:
+				target = freeName(ws, e.kind, e.name)
+			}
+		}
+		data, err := readEntry(e.file)
+		if err == nil {
+			err = put(ws, e.kind, target, data)
+		}
+		item := Item{Kind: e.kind, Name: e.name}
+		if target != e.name {
+			item.As = target
+		}
+		if err != nil {
+			item.Error = err.Error()
+			rep.Failed = append(rep.Failed, item)
+			continue
+		}
+		rep.Imported = append(rep.Imported, item)
+	}
+	return rep, nil
+}
+
+func readArchive(zr *zip.Reader) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if f.Name == "manifest.json" {
+			var m Manifest
+			data, err := readEntry(f)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(data, &m); err != nil {
+				return nil, fmt.Errorf("manifest.json: %w", err)
+			}
+			if m.Format != Format || m.Version > Version {
+				return nil, fmt.Errorf("unsupported archive %s version %d", m.Format, m.Version)
+			}
+			continue
+		}
+		dir, base := path.Split(f.Name)
+		kind, ok := kindDirs[strings.TrimSuffix(dir, "/")]
+		if !ok || base == "" || base == "." || base == ".." || strings.ContainsAny(base, `\`) {
+			return nil, fmt.Errorf("unexpected archive entry %q", f.Name)
+		}
+		name := base
+		if kind != KindFile {
+			if path.Ext(base) != ".json" {
+				return nil, fmt.Errorf("unexpected archive entry %q", f.Name)
+			}
+			name = strings.TrimSuffix(base, ".json")
+		}
+		entries = append(entries, archiveEntry{kind: kind, name: name, file: f})
+	}
+	return entries, nil
+}
+
+func readEntry(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > MaxEntrySize {
+		return nil, fmt.Errorf("%s exceeds %d bytes", f.Name, MaxEntrySize)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, MaxEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxEntrySize {
+		return nil, fmt.Errorf("%s exceeds %d bytes", f.Name, MaxEntrySize)
+	}
+	return data, nil
+}
+
+func exists(ws Workspace, kind, name string) bool {
+	switch kind {
+	case KindFile:
+		_, err := os.Stat(filepath.Join(ws.FilesDir, name))
+		return err == nil
+	case KindDiagram:
+		_, err := os.Stat(filepath.Join(ws.DiagramsDir, name+".json"))
+		return err == nil
+	case KindFunction:
+		_, ok := ws.Functions[name]
+		return ok
+	case KindListener:
+		_, ok := ws.Listeners[name]
+		return ok
+	}
+	return false
+}
+
+// freeName appends _2, _3, ... to the name (before a file's extension) until
+// it no longer clashes. The underscore keeps function names valid identifiers.
+func freeName(ws Workspace, kind, name string) string {
+	stem, ext := name, ""
+	if kind == KindFile {
+		ext = filepath.Ext(name)
+		stem = strings.TrimSuffix(name, ext)
+	}
+	for i := 2; ; i++ {
+		candidate := stem + "_" + strconv.Itoa(i) + ext
+		if !exists(ws, kind, candidate) {
+			return candidate
+		}
+	}
+}
+
+func put(ws Workspace, kind, name string, data []byte) error {
+	switch kind {
+	case KindFile:
+		if err := os.MkdirAll(ws.FilesDir, 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(ws.FilesDir, name), data, 0o644)
+	case KindDiagram:
+		if !json.Valid(data) {
+			return errors.New("invalid diagram JSON")
+		}
+		if err := os.MkdirAll(ws.DiagramsDir, 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(ws.DiagramsDir, name+".json"), data, 0o644)
+	case KindFunction, KindListener:
+		if !json.Valid(data) {
+			return errors.New("invalid JSON definition")
+		}
+		defs := ws.Functions
+		if kind == KindListener {
+			defs = ws.Listeners
+		}
+		if defs == nil {
+			return fmt.Errorf("%ss cannot be imported here", kind)
+		}
+		defs[name] = json.RawMessage(data)
+		return nil
+	}
+	return fmt.Errorf("unknown kind %q", kind)
+}
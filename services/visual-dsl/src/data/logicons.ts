@@ -36,6 +36,13 @@ export const logiconDefinitions: LogiconData[] = [
     description: 'Function definition',
     category: 'control'
   },
+  {
+    id: 'subdiagram',
+    label: 'Sub Diagram',
+    icon: '🧩',
+    description: 'Run a component diagram as a function',
+    category: 'control'
+  },
   {
     id: 'switch',
     label: 'Switch',
@@ -63,6 +63,7 @@ import { ClearNodePropertiesDialog, ClearNodeProperties } from "../components/di
 import { AddToNodePropertiesDialog, AddToNodeProperties } from "../components/dialogs/AddToNodeProperties";
 import LogPrintNodeProperties, { LogPrintNodeProperties as LogPrintProperties } from "../components/dialogs/LogPrintNodeProperties";
 import { SleepNodePropertiesDialog, SleepNodeProperties } from "../components/dialogs/SleepNodeProperties";
+import { SubDiagramNodePropertiesDialog, SubDiagramNodeProperties } from "../components/dialogs/SubDiagramNodeProperties";
 import { GetEnvNodePropertiesDialog, GetEnvNodeProperties } from "../components/dialogs/GetEnvNodeProperties";
 import { ExitNodePropertiesDialog, ExitNodeProperties } from "../components/dialogs/ExitNodeProperties";
 import { AndNodePropertiesDialog, AndNodeProperties } from "../components/dialogs/AndNodeProperties";
@@ -173,6 +174,10 @@ interface DiagramData {
   edges: Edge[];
   nestingRelations: any[];
   subflows?: Record<string, Subflow>;
+  // Component library metadata, used when other diagrams reference this one from a Sub Diagram block
+  component?: boolean;
+  description?: string;
+  parameters?: string[];
   groupCount: number;
   created: string;
   modified: string;
@@ -342,6 +347,8 @@ export default function VisualDSLPrototype() {
   
   // Counter for unique node IDs
   const nodeCounterRef = React.useRef(0);
+  // Component metadata is not edited on the canvas; keep it so re-saving does not drop it
+  const componentMetaRef = React.useRef<Pick<DiagramData, 'component' | 'description' | 'parameters'>>({});
   
   // Context menu state
   const [contextMenu, setContextMenu] = React.useState<{
@@ -369,6 +376,7 @@ export default function VisualDSLPrototype() {
       edges,
       nestingRelations,
       subflows: getAllSubflows(),
+      ...componentMetaRef.current,
       groupCount,
       created: new Date().toISOString(),
       modified: new Date().toISOString()
@@ -406,6 +414,11 @@ export default function VisualDSLPrototype() {
       }
 
       const diagramData: DiagramData = parsed;
+      componentMetaRef.current = {
+        component: diagramData.component,
+        description: diagramData.description,
+        parameters: diagramData.parameters
+      };
       
       // Clear existing nesting relations
       nestingRelations.forEach(rel => {
@@ -860,6 +873,8 @@ export default function VisualDSLPrototype() {
         nodeType = 'while';
       } else if ((label === 'Function' || label === 'func') && category === 'control') {
         nodeType = 'function';
+      } else if (label === 'Sub Diagram' && category === 'control') {
+        nodeType = 'subDiagram';
       } else if ((label === 'CB Query' || label === 'cbQuery') && category === 'couchbase') {
         nodeType = 'cbQuery';
       } else if ((label === 'Switch' || label === 'switch') && category === 'control') {
@@ -4697,6 +4712,23 @@ export default function VisualDSLPrototype() {
             />
           )}
 
+          {propertiesDialog && propertiesDialog.nodeType === 'subDiagram' && (
+            <SubDiagramNodePropertiesDialog
+              isOpen={true}
+              onClose={() => setPropertiesDialog(null)}
+              onSave={(properties) => saveNodeProperties(propertiesDialog.nodeId, properties)}
+              onDelete={() => {
+                deleteNode(propertiesDialog.nodeId);
+                setPropertiesDialog(null);
+              }}
+              initialProperties={propertiesDialog.properties as SubDiagramNodeProperties || {
+                diagram: '',
+                arguments: [],
+                resultVariable: ''
+              }}
+            />
+          )}
+
           {propertiesDialog && propertiesDialog.nodeType === 'getEnv' && (
             <GetEnvNodePropertiesDialog
               isOpen={true}